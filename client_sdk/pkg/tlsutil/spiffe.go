@@ -0,0 +1,56 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tlsutil
+
+import (
+	"crypto/x509"
+	"net/url"
+	"path"
+	"strings"
+)
+
+const spiffeScheme = "spiffe"
+
+// SPIFFEID 返回X509-SVID中的SPIFFE ID;按规范SVID只能有一个URI SAN
+func SPIFFEID(cert *x509.Certificate) (*url.URL, bool) {
+	if cert == nil || len(cert.URIs) != 1 {
+		return nil, false
+	}
+	u := cert.URIs[0]
+	if !strings.EqualFold(u.Scheme, spiffeScheme) || u.Host == "" || u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+		return nil, false
+	}
+	return u, true
+}
+
+// MatchSPIFFEID 判断SPIFFE ID是否匹配模式,模式语法同 path.Match,
+// 例如 spiffe://example.org/ns/*/sa/etcd;以 "/..." 结尾时匹配该路径下的所有ID
+func MatchSPIFFEID(pattern, id string) bool {
+	if strings.HasSuffix(pattern, "/...") {
+		prefix := strings.TrimSuffix(pattern, "...")
+		return strings.HasPrefix(id, prefix) && len(id) > len(prefix)
+	}
+	ok, err := path.Match(pattern, id)
+	return err == nil && ok
+}
+
+// ValidSPIFFEIDPattern 检查模式是否合法
+func ValidSPIFFEIDPattern(pattern string) bool {
+	if !strings.HasPrefix(pattern, spiffeScheme+"://") {
+		return false
+	}
+	_, err := path.Match(strings.TrimSuffix(pattern, "/..."), "")
+	return err == nil
+}
@@ -0,0 +1,109 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// PerIPLimitListener returns a Listener that accepts at most n simultaneous
+// connections from each remote IP. Excess connections are closed right after
+// accept. Connections without an IP (e.g. unix sockets) are not limited.
+func PerIPLimitListener(l net.Listener, n int) net.Listener {
+	return &perIPLimitListener{Listener: l, max: n, conns: make(map[string]int)}
+}
+
+type perIPLimitListener struct {
+	net.Listener
+	max int
+
+	mu    sync.Mutex
+	conns map[string]int
+}
+
+func (l *perIPLimitListener) acquire(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conns[ip] >= l.max {
+		return false
+	}
+	l.conns[ip]++
+	return true
+}
+
+func (l *perIPLimitListener) release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conns[ip]--; l.conns[ip] <= 0 {
+		delete(l.conns, ip)
+	}
+}
+
+func (l *perIPLimitListener) Accept() (net.Conn, error) {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		ip := remoteIP(c)
+		if ip == "" {
+			return c, nil
+		}
+		if !l.acquire(ip) {
+			connRejections.WithLabelValues("per-ip-limit").Inc()
+			c.Close()
+			continue
+		}
+		return &perIPLimitConn{Conn: c, release: func() { l.release(ip) }}, nil
+	}
+}
+
+func remoteIP(c net.Conn) string {
+	addr, ok := c.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		return ""
+	}
+	return addr.IP.String()
+}
+
+type perIPLimitConn struct {
+	net.Conn
+	releaseOnce sync.Once
+	release     func()
+}
+
+func (c *perIPLimitConn) Close() error {
+	err := c.Conn.Close()
+	c.releaseOnce.Do(c.release)
+	return err
+}
+
+func (c *perIPLimitConn) SetKeepAlive(doKeepAlive bool) error {
+	kac, ok := c.Conn.(keepAliveConn)
+	if !ok {
+		return ErrNotTCP
+	}
+	return kac.SetKeepAlive(doKeepAlive)
+}
+
+func (c *perIPLimitConn) SetKeepAlivePeriod(d time.Duration) error {
+	kac, ok := c.Conn.(keepAliveConn)
+	if !ok {
+		return ErrNotTCP
+	}
+	return kac.SetKeepAlivePeriod(d)
+}
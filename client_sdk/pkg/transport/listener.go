@@ -132,7 +132,9 @@ type TLSInfo struct {
 
 	TrustedCAFile       string // ca证书
 	ClientCertAuth      bool   // 客户端证书验证;默认false
-	CRLFile             string // 证书吊销列表文件的路径
+	CRLFile             string // 证书吊销列表文件的路径,文件变更后自动重新加载
+	OCSPCheck           string // 通过OCSP检查对端证书状态: "" 不检查, "soft" 只拒绝已吊销的, "hard" 只接受确认有效的
+	OCSPStaple          bool   // 作为服务端时获取本节点证书的OCSP响应并在握手时附加
 	InsecureSkipVerify  bool
 	SkipClientSANVerify bool
 
@@ -156,6 +158,12 @@ type TLSInfo struct {
 	// AllowedHostname 是一个IP地址或主机名,必须与客户提供的TLS证书相匹配.
 	AllowedHostname string
 
+	// AllowedSPIFFEIDs 允许的对端SPIFFE ID模式,对端证书(X509-SVID)的SPIFFE ID需匹配其中之一
+	AllowedSPIFFEIDs []string
+
+	// VerifyCertificate 自定义的对端证书检查,不能与 AllowedCN、AllowedHostname、AllowedSPIFFEIDs 同时指定
+	VerifyCertificate func(*x509.Certificate) bool
+
 	Logger *zap.Logger
 
 	// EmptyCN indicates that the cert must have empty CN.
@@ -164,7 +172,7 @@ type TLSInfo struct {
 }
 
 func (info TLSInfo) String() string {
-	return fmt.Sprintf("cert = %s, key = %s, client-cert=%s, client-key=%s, trusted-ca = %s, client-cert-auth = %v, crl-file = %s", info.CertFile, info.KeyFile, info.ClientCertFile, info.ClientKeyFile, info.TrustedCAFile, info.ClientCertAuth, info.CRLFile)
+	return fmt.Sprintf("cert = %s, key = %s, client-cert=%s, client-key=%s, trusted-ca = %s, client-cert-auth = %v, crl-file = %s, ocsp-check = %s, ocsp-staple = %v, allowed-spiffe-ids = %v", info.CertFile, info.KeyFile, info.ClientCertFile, info.ClientKeyFile, info.TrustedCAFile, info.ClientCertAuth, info.CRLFile, info.OCSPCheck, info.OCSPStaple, info.AllowedSPIFFEIDs)
 }
 
 func (info TLSInfo) Empty() bool {
@@ -298,7 +306,8 @@ func (info TLSInfo) baseConfig() (*tls.Config, error) {
 		info.Logger = zap.NewNop()
 	}
 
-	_, err := tlsutil.NewCert(info.CertFile, info.KeyFile, info.parseFunc) // parseFunc 在主程序里是nil
+	// 证书缓存在 keyPairStore 中,文件变更后自动重新加载
+	certStore, err := keyPairStoreFor(info, CertKindCert, info.CertFile, info.KeyFile)
 	if err != nil {
 		return nil, err
 	}
@@ -307,8 +316,9 @@ func (info TLSInfo) baseConfig() (*tls.Config, error) {
 	if (info.ClientKeyFile == "") != (info.ClientCertFile == "") {
 		return nil, fmt.Errorf("ClientKeyFile和ClientCertFile必须同时存在或同时不存在.: key: %v, cert: %v]", info.ClientKeyFile, info.ClientCertFile)
 	}
+	clientCertStore := certStore
 	if info.ClientCertFile != "" {
-		_, err := tlsutil.NewCert(info.ClientCertFile, info.ClientKeyFile, info.parseFunc)
+		clientCertStore, err = keyPairStoreFor(info, CertKindClientCert, info.ClientCertFile, info.ClientKeyFile)
 		if err != nil {
 			return nil, err
 		}
@@ -338,6 +348,34 @@ func (info TLSInfo) baseConfig() (*tls.Config, error) {
 			return cert.VerifyHostname(info.AllowedHostname) == nil
 		}
 	}
+	if len(info.AllowedSPIFFEIDs) > 0 {
+		if verifyCertificate != nil {
+			return nil, fmt.Errorf("AllowedSPIFFEIDs 不能与 AllowedCN、AllowedHostname 同时指定")
+		}
+		for _, p := range info.AllowedSPIFFEIDs {
+			if !tlsutil.ValidSPIFFEIDPattern(p) {
+				return nil, fmt.Errorf("不合法的SPIFFE ID模式 %q", p)
+			}
+		}
+		verifyCertificate = func(cert *x509.Certificate) bool {
+			id, ok := tlsutil.SPIFFEID(cert)
+			if !ok {
+				return false
+			}
+			for _, p := range info.AllowedSPIFFEIDs {
+				if tlsutil.MatchSPIFFEID(p, id.String()) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	if info.VerifyCertificate != nil {
+		if verifyCertificate != nil {
+			return nil, fmt.Errorf("VerifyCertificate 不能与 AllowedCN、AllowedHostname、AllowedSPIFFEIDs 同时指定")
+		}
+		verifyCertificate = info.VerifyCertificate
+	}
 	if verifyCertificate != nil {
 		cfg.VerifyPeerCertificate = func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
 			for _, chains := range verifiedChains {
@@ -353,7 +391,7 @@ func (info TLSInfo) baseConfig() (*tls.Config, error) {
 	// 是有同一个CA签发的
 	// 服务端获取证书
 	cfg.GetCertificate = func(clientHello *tls.ClientHelloInfo) (cert *tls.Certificate, err error) {
-		cert, err = tlsutil.NewCert(info.CertFile, info.KeyFile, info.parseFunc)
+		cert, err = certStore.get()
 		if os.IsNotExist(err) {
 			if info.Logger != nil {
 				info.Logger.Warn(
@@ -381,7 +419,7 @@ func (info TLSInfo) baseConfig() (*tls.Config, error) {
 		if info.ClientCertFile != "" {
 			certfile, keyfile = info.ClientCertFile, info.ClientKeyFile
 		}
-		cert, err = tlsutil.NewCert(certfile, keyfile, info.parseFunc)
+		cert, err = clientCertStore.get()
 		if os.IsNotExist(err) {
 			if info.Logger != nil {
 				info.Logger.Warn(
@@ -435,11 +473,38 @@ func (info TLSInfo) ServerConfig() (*tls.Config, error) {
 	if len(cs) > 0 {
 		info.Logger.Info("Loading cert pool", zap.Strings("cs", cs),
 			zap.Any("tlsinfo", info))
-		cp, err := tlsutil.NewCertPool(cs)
+		ca, err := caStoreFor(info, cs)
 		if err != nil {
 			return nil, err
 		}
+		cp := ca.getPool()
 		cfg.ClientCAs = cp
+		// CA文件重新加载后,新的握手使用新的证书池
+		cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			p := ca.getPool()
+			if p == cp {
+				return nil, nil
+			}
+			c := cfg.Clone()
+			c.ClientCAs = p
+			c.GetConfigForClient = nil
+			return c, nil
+		}
+	}
+
+	if info.OCSPStaple {
+		stapler, err := ocspStaplerFor(info)
+		if err != nil {
+			return nil, err
+		}
+		getCert := cfg.GetCertificate
+		cfg.GetCertificate = func(clientHello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert, err := getCert(clientHello)
+			if err != nil {
+				return nil, err
+			}
+			return stapler.staple(cert), nil
+		}
 	}
 
 	// "h2" NextProtos is necessary for enabling HTTP2 for go's HTTP etcd
@@ -470,10 +535,13 @@ func (info TLSInfo) ClientConfig() (*tls.Config, error) {
 
 	cs := info.cafiles()
 	if len(cs) > 0 {
-		cfg.RootCAs, err = tlsutil.NewCertPool(cs)
+		// 服务端证书由tls内置逻辑按ServerName(包括IP)校验;
+		// CA文件重新加载后,建立连接时通过 RefreshClientConfig 换成新的证书池
+		ca, err := caStoreFor(info, cs)
 		if err != nil {
 			return nil, err
 		}
+		cfg.RootCAs = ca.getPool()
 	}
 
 	if info.selfCert {
@@ -19,7 +19,6 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
-	"io/ioutil"
 	"net"
 	"strings"
 	"sync"
@@ -28,8 +27,8 @@ import (
 )
 
 // tlsListener overrides a TLS listener so it will reject client
-// certificates with insufficient SAN credentials or CRL revoked
-// certificates.
+// certificates with insufficient SAN credentials or certificates
+// revoked by CRL or OCSP.
 type tlsListener struct {
 	net.Listener
 	connc            chan net.Conn
@@ -41,9 +40,7 @@ type tlsListener struct {
 
 type tlsCheckFunc func(context.Context, *tls.Conn) error
 
-var crlBytesMap sync.Map
-
-// NewTLSListener handshakes TLS connections and performs optional CRL checking.
+// NewTLSListener handshakes TLS connections and performs optional CRL and OCSP checking.
 func NewTLSListener(l net.Listener, tlsinfo *TLSInfo) (net.Listener, error) {
 	check := func(context.Context, *tls.Conn) error { return nil }
 	return newTLSListener(l, tlsinfo, check)
@@ -65,6 +62,11 @@ func newTLSListener(l net.Listener, tlsinfo *TLSInfo, check tlsCheckFunc) (net.L
 	}
 
 	if len(tlsinfo.CRLFile) > 0 {
+		// 吊销列表文件变更后自动重新加载
+		crl, err := crlStoreFor(*tlsinfo)
+		if err != nil {
+			return nil, err
+		}
 		prevCheck := check
 		check = func(ctx context.Context, tlsConn *tls.Conn) error {
 			if err := prevCheck(ctx, tlsConn); err != nil {
@@ -72,12 +74,26 @@ func newTLSListener(l net.Listener, tlsinfo *TLSInfo, check tlsCheckFunc) (net.L
 			}
 			st := tlsConn.ConnectionState()
 			if certs := st.PeerCertificates; len(certs) > 0 {
-				return checkCRL(tlsinfo.CRLFile, certs)
+				return crl.check(certs)
 			}
 			return nil
 		}
 	}
 
+	if tlsinfo.OCSPCheck != "" {
+		if err := ValidateOCSPCheck(tlsinfo.OCSPCheck); err != nil {
+			return nil, err
+		}
+		oc := newOCSPChecker(*tlsinfo)
+		prevCheck := check
+		check = func(ctx context.Context, tlsConn *tls.Conn) error {
+			if err := prevCheck(ctx, tlsConn); err != nil {
+				return err
+			}
+			return oc.check(ctx, tlsConn.ConnectionState())
+		}
+	}
+
 	tlsl := &tlsListener{
 		Listener:         tls.NewListener(l, tlscfg),
 		connc:            make(chan net.Conn),
@@ -170,36 +186,6 @@ func (l *tlsListener) acceptLoop() {
 	}
 }
 
-func checkCRL(crlPath string, cert []*x509.Certificate) error {
-	var crlBytes []byte
-
-	if v, ok := crlBytesMap.Load(crlPath); ok {
-		crlBytes = v.([]byte)
-	} else {
-		crlBytes, err := ioutil.ReadFile(crlPath)
-		if err != nil {
-			return err
-		}
-		crlBytesMap.Store(crlPath, crlBytes)
-	}
-
-	certList, err := x509.ParseCRL(crlBytes)
-	if err != nil {
-		return err
-	}
-	revokedSerials := make(map[string]struct{})
-	for _, rc := range certList.TBSCertList.RevokedCertificates {
-		revokedSerials[string(rc.SerialNumber.Bytes())] = struct{}{}
-	}
-	for _, c := range cert {
-		serial := string(c.SerialNumber.Bytes())
-		if _, ok := revokedSerials[serial]; ok {
-			return fmt.Errorf("transport: certificate serial %x revoked", serial)
-		}
-	}
-	return nil
-}
-
 func checkCertSAN(ctx context.Context, cert *x509.Certificate, remoteAddr string) error {
 	if len(cert.IPAddresses) == 0 && len(cert.DNSNames) == 0 {
 		return nil
@@ -0,0 +1,43 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	revokedCertRejections = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "etcd",
+			Subsystem: "network",
+			Name:      "tls_revoked_cert_rejections_total",
+			Help:      "Total number of TLS connections rejected because the peer certificate is revoked (crl, ocsp) or its OCSP status is unavailable in hard-fail mode (ocsp_unavailable).",
+		},
+		[]string{"reason"},
+	)
+	connRejections = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "etcd",
+			Subsystem: "network",
+			Name:      "listener_connections_rejected_total",
+			Help:      "Total number of accepted connections closed immediately by a listener limit (per-ip-limit).",
+		},
+		[]string{"reason"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(revokedCertRejections)
+	prometheus.MustRegister(connRejections)
+}
@@ -0,0 +1,428 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ls-2018/etcd_cn/client_sdk/pkg/tlsutil"
+	"go.uber.org/zap"
+)
+
+// CertReloadInterval 检查证书、私钥、CA文件是否变更的间隔,变更后的文件会在下一次检查时重新加载
+var CertReloadInterval = 10 * time.Second
+
+const (
+	CertKindCert       = "cert"
+	CertKindClientCert = "client-cert"
+	CertKindCA         = "ca"
+)
+
+// CertInfo 当前已加载证书的信息
+type CertInfo struct {
+	Kind        string
+	File        string
+	Subject     string
+	Fingerprint string // SHA-256
+	NotBefore   time.Time
+	NotAfter    time.Time
+	LoadedAt    time.Time
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func statFiles(files []string) ([]fileStamp, error) {
+	stamps := make([]fileStamp, len(files))
+	for i, f := range files {
+		fi, err := os.Stat(f)
+		if err != nil {
+			return nil, err
+		}
+		stamps[i] = fileStamp{modTime: fi.ModTime(), size: fi.Size()}
+	}
+	return stamps, nil
+}
+
+func stampsEqual(a, b []fileStamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].modTime.Equal(b[i].modTime) || a[i].size != b[i].size {
+			return false
+		}
+	}
+	return true
+}
+
+// keyPairStore 缓存证书和私钥,文件变更后重新加载;加载失败时继续使用旧证书
+type keyPairStore struct {
+	kind      string
+	certFile  string
+	keyFile   string
+	parseFunc func([]byte, []byte) (tls.Certificate, error)
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	leaf     *x509.Certificate
+	stamps   []fileStamp
+	loadedAt time.Time
+}
+
+func (s *keyPairStore) get() (*tls.Certificate, error) {
+	s.mu.RLock()
+	cert := s.cert
+	s.mu.RUnlock()
+	if cert != nil {
+		return cert, nil
+	}
+	if _, err := s.reload(true); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.cert, nil
+}
+
+// reload 文件变更或force时重新加载,返回是否重新加载
+func (s *keyPairStore) reload(force bool) (bool, error) {
+	stamps, err := statFiles([]string{s.certFile, s.keyFile})
+	if err != nil {
+		return false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !force && s.cert != nil && stampsEqual(s.stamps, stamps) {
+		return false, nil
+	}
+	cert, err := tlsutil.NewCert(s.certFile, s.keyFile, s.parseFunc)
+	if err != nil {
+		return false, err
+	}
+	var leaf *x509.Certificate
+	if len(cert.Certificate) > 0 {
+		if leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return false, err
+		}
+	}
+	s.cert, s.leaf, s.stamps, s.loadedAt = cert, leaf, stamps, time.Now()
+	return true, nil
+}
+
+// current 返回当前已加载的证书及其解析后的叶子证书
+func (s *keyPairStore) current() (*tls.Certificate, *x509.Certificate) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.cert, s.leaf
+}
+
+func (s *keyPairStore) info() []CertInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.leaf == nil {
+		return nil
+	}
+	return []CertInfo{newCertInfo(s.kind, s.certFile, s.leaf, s.loadedAt)}
+}
+
+// caStore 缓存CA证书池,文件变更后重新加载
+type caStore struct {
+	files []string
+
+	mu       sync.RWMutex
+	pool     *x509.CertPool
+	certs    []*x509.Certificate
+	stamps   []fileStamp
+	loadedAt time.Time
+	// pools 记录在 caPools 中的所有证书池,释放时一起删除
+	pools []*x509.CertPool
+}
+
+func (s *caStore) getPool() *x509.CertPool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.pool
+}
+
+func (s *caStore) reload(force bool) (bool, error) {
+	stamps, err := statFiles(s.files)
+	if err != nil {
+		return false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !force && s.pool != nil && stampsEqual(s.stamps, stamps) {
+		return false, nil
+	}
+	pool, err := tlsutil.NewCertPool(s.files)
+	if err != nil {
+		return false, err
+	}
+	var certs []*x509.Certificate
+	for _, f := range s.files {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return false, err
+		}
+		for {
+			var block *pem.Block
+			if block, b = pem.Decode(b); block == nil {
+				break
+			}
+			c, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return false, err
+			}
+			certs = append(certs, c)
+		}
+	}
+	s.pool, s.certs, s.stamps, s.loadedAt = pool, certs, stamps, time.Now()
+	s.pools = append(s.pools, pool)
+	caPools.Store(pool, s)
+	return true, nil
+}
+
+// release 从 caPools 中删除该caStore加载过的证书池
+func (s *caStore) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.pools {
+		caPools.Delete(p)
+	}
+	s.pools = nil
+}
+
+func (s *caStore) info() []CertInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	infos := make([]CertInfo, 0, len(s.certs))
+	for _, c := range s.certs {
+		infos = append(infos, newCertInfo(CertKindCA, strings.Join(s.files, ","), c, s.loadedAt))
+	}
+	return infos
+}
+
+func newCertInfo(kind, file string, c *x509.Certificate, loadedAt time.Time) CertInfo {
+	sum := sha256.Sum256(c.Raw)
+	return CertInfo{
+		Kind:        kind,
+		File:        file,
+		Subject:     c.Subject.String(),
+		Fingerprint: hex.EncodeToString(sum[:]),
+		NotBefore:   c.NotBefore,
+		NotAfter:    c.NotAfter,
+		LoadedAt:    loadedAt,
+	}
+}
+
+type reloadable interface {
+	reload(force bool) (bool, error)
+	info() []CertInfo
+}
+
+// certRegistry 进程内所有TLSInfo共用的证书缓存,相同文件只加载一份
+var certRegistry = struct {
+	sync.Mutex
+	stores map[string]reloadable
+	// watchers 调用 WatchCerts 且ctx还没有结束的个数; stop 关闭时检查协程退出
+	watchers int
+	stop     chan struct{}
+}{stores: make(map[string]reloadable)}
+
+func registerStore(key string, newStore func() reloadable) (reloadable, error) {
+	certRegistry.Lock()
+	s, ok := certRegistry.stores[key]
+	certRegistry.Unlock()
+	if ok {
+		return s, nil
+	}
+	s = newStore()
+	if _, err := s.reload(true); err != nil {
+		return nil, err
+	}
+	certRegistry.Lock()
+	if old, ok := certRegistry.stores[key]; ok {
+		s = old
+	} else {
+		certRegistry.stores[key] = s
+	}
+	certRegistry.Unlock()
+	return s, nil
+}
+
+func keyPairStoreFor(info TLSInfo, kind, certFile, keyFile string) (*keyPairStore, error) {
+	s, err := registerStore(kind+"|"+certFile+"|"+keyFile, func() reloadable {
+		return &keyPairStore{kind: kind, certFile: certFile, keyFile: keyFile, parseFunc: info.parseFunc}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.(*keyPairStore), nil
+}
+
+func caStoreFor(info TLSInfo, files []string) (*caStore, error) {
+	s, err := registerStore(CertKindCA+"|"+strings.Join(files, ","), func() reloadable {
+		return &caStore{files: files}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.(*caStore), nil
+}
+
+// WatchCerts 在ctx结束前定期检查已加载的证书文件,变更后重新加载;所有调用共用一个检查协程.
+// 所有调用的ctx都结束后停止检查,并清空证书缓存以及 caPools 中的记录
+func WatchCerts(ctx context.Context, lg *zap.Logger) {
+	if lg == nil {
+		lg = zap.NewNop()
+	}
+	certRegistry.Lock()
+	certRegistry.watchers++
+	if certRegistry.stop == nil {
+		certRegistry.stop = make(chan struct{})
+		go watchCerts(lg, certRegistry.stop)
+	}
+	certRegistry.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		certRegistry.Lock()
+		defer certRegistry.Unlock()
+		if certRegistry.watchers--; certRegistry.watchers > 0 {
+			return
+		}
+		close(certRegistry.stop)
+		certRegistry.stop = nil
+		for _, s := range certRegistry.stores {
+			if ca, ok := s.(*caStore); ok {
+				ca.release()
+			}
+		}
+		certRegistry.stores = make(map[string]reloadable)
+	}()
+}
+
+// watchCerts 定期检查证书文件,变更后重新加载,直到stop关闭
+func watchCerts(lg *zap.Logger, stop <-chan struct{}) {
+	ticker := time.NewTicker(CertReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			reloadCerts(lg, false)
+		case <-stop:
+			return
+		}
+	}
+}
+
+func reloadCerts(lg *zap.Logger, force bool) error {
+	certRegistry.Lock()
+	keys := make([]string, 0, len(certRegistry.stores))
+	stores := make([]reloadable, 0, len(certRegistry.stores))
+	for k, s := range certRegistry.stores {
+		keys = append(keys, k)
+		stores = append(stores, s)
+	}
+	certRegistry.Unlock()
+
+	var errs []string
+	for i, s := range stores {
+		reloaded, err := s.reload(force)
+		if err != nil {
+			lg.Warn("重新加载证书失败,继续使用旧证书", zap.String("files", keys[i]), zap.Error(err))
+			errs = append(errs, err.Error())
+			continue
+		}
+		if reloaded && !force {
+			lg.Info("检测到证书文件变更,已重新加载", zap.String("files", keys[i]))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// ReloadCerts 强制重新加载所有证书、私钥和CA文件;部分失败时失败的文件继续使用旧证书
+func ReloadCerts(lg *zap.Logger) ([]CertInfo, error) {
+	if lg == nil {
+		lg = zap.NewNop()
+	}
+	err := reloadCerts(lg, true)
+	return LoadedCerts(), err
+}
+
+// LoadedCerts 返回当前已加载的证书信息
+func LoadedCerts() []CertInfo {
+	certRegistry.Lock()
+	stores := make([]reloadable, 0, len(certRegistry.stores))
+	for _, s := range certRegistry.stores {
+		stores = append(stores, s)
+	}
+	certRegistry.Unlock()
+
+	var infos []CertInfo
+	for _, s := range stores {
+		infos = append(infos, s.info()...)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Kind != infos[j].Kind {
+			return infos[i].Kind < infos[j].Kind
+		}
+		if infos[i].File != infos[j].File {
+			return infos[i].File < infos[j].File
+		}
+		return infos[i].Fingerprint < infos[j].Fingerprint
+	})
+	return infos
+}
+
+// caPools 记录每个加载过的CA证书池属于哪个caStore,用于把旧的证书池换成最新的
+var caPools sync.Map // *x509.CertPool -> *caStore
+
+// RefreshClientConfig 返回使用最新CA证书池的客户端配置,CA文件没有变化时直接返回cfg.
+// 只替换RootCAs,服务端证书仍由tls内置逻辑校验,应在每次建立连接时调用
+func RefreshClientConfig(cfg *tls.Config) *tls.Config {
+	if cfg == nil || cfg.RootCAs == nil {
+		return cfg
+	}
+	v, ok := caPools.Load(cfg.RootCAs)
+	if !ok {
+		return cfg
+	}
+	p := v.(*caStore).getPool()
+	if p == cfg.RootCAs {
+		return cfg
+	}
+	c := cfg.Clone()
+	c.RootCAs = p
+	return c
+}
@@ -0,0 +1,189 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, cn string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// serverCert 签发只包含 ip 这一个IP SAN的服务端证书
+func (ca *testCA) serverCert(t *testing.T, ip string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "server"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP(ip)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func newTestTLSServer(cert tls.Certificate) *httptest.Server {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	srv.StartTLS()
+	return srv
+}
+
+// TestClientConfigVerifiesIPSAN 由受信CA签发但IP SAN不匹配的服务端证书必须被拒绝,CA重新加载后也一样
+func TestClientConfigVerifiesIPSAN(t *testing.T) {
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	ca := newTestCA(t, "ca1")
+	if err := ioutil.WriteFile(caFile, ca.pem, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	info := TLSInfo{TrustedCAFile: caFile}
+	tr, err := NewTransport(info, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tr.CloseIdleConnections()
+	cfg, err := info.ClientConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(ca *testCA, ip string, wok bool) {
+		t.Helper()
+		srv := newTestTLSServer(ca.serverCert(t, ip))
+		defer srv.Close()
+
+		resp, err := (&http.Client{Transport: tr}).Get(srv.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		if (err == nil) != wok {
+			t.Errorf("transport: cert for %s served on %s, err = %v, want ok %v", ip, srv.Listener.Addr(), err, wok)
+		}
+
+		conn, err := tls.Dial("tcp", srv.Listener.Addr().String(), RefreshClientConfig(cfg))
+		if err == nil {
+			conn.Close()
+		}
+		if (err == nil) != wok {
+			t.Errorf("tls.Dial: cert for %s served on %s, err = %v, want ok %v", ip, srv.Listener.Addr(), err, wok)
+		}
+	}
+
+	check(ca, "127.0.0.1", true)
+	check(ca, "127.0.0.2", false)
+
+	// 换成新的CA后,新CA签发的证书可用,IP SAN仍然校验
+	ca2 := newTestCA(t, "ca2")
+	if err = ioutil.WriteFile(caFile, ca2.pem, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ReloadCerts(nil); err != nil {
+		t.Fatal(err)
+	}
+	check(ca2, "127.0.0.1", true)
+	check(ca2, "127.0.0.2", false)
+	check(ca, "127.0.0.1", false)
+}
+
+// TestWatchCertsStop 所有 WatchCerts 的ctx结束后检查协程退出,证书缓存和 caPools 中的记录被清空
+func TestWatchCertsStop(t *testing.T) {
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	if err := ioutil.WriteFile(caFile, newTestCA(t, "ca").pem, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+	WatchCerts(ctx1, nil)
+	WatchCerts(ctx2, nil)
+
+	cfg, err := TLSInfo{TrustedCAFile: caFile}.ClientConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	released := func() bool {
+		certRegistry.Lock()
+		defer certRegistry.Unlock()
+		_, ok := caPools.Load(cfg.RootCAs)
+		return certRegistry.stop == nil && len(certRegistry.stores) == 0 && !ok
+	}
+
+	cancel1()
+	time.Sleep(100 * time.Millisecond)
+	if released() {
+		t.Fatal("released while a watcher is still running")
+	}
+	cancel2()
+	deadline := time.Now().Add(5 * time.Second)
+	for !released() {
+		if time.Now().After(deadline) {
+			t.Fatal("certificates not released after all watchers stopped")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,388 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ocsp"
+)
+
+// ErrCertRevoked 对端证书已被吊销
+var ErrCertRevoked = errors.New("transport: certificate revoked")
+
+const (
+	// OCSPCheckSoft 只拒绝OCSP responder明确答复已吊销的证书,responder不可用时放行
+	OCSPCheckSoft = "soft"
+	// OCSPCheckHard 只接受OCSP responder明确答复有效的证书
+	OCSPCheckHard = "hard"
+)
+
+var (
+	// OCSPTimeout 查询OCSP responder的超时时间
+	OCSPTimeout = 5 * time.Second
+	// OCSPDefaultValidity OCSP响应没有next update时的缓存时间
+	OCSPDefaultValidity = time.Hour
+
+	errNoOCSPServer = errors.New("transport: certificate has no OCSP server")
+	errNoIssuer     = errors.New("transport: issuer certificate not found")
+)
+
+const maxOCSPCacheEntries = 4096
+
+// ValidateOCSPCheck 检查OCSP校验模式
+func ValidateOCSPCheck(mode string) error {
+	switch mode {
+	case "", OCSPCheckSoft, OCSPCheckHard:
+		return nil
+	}
+	return fmt.Errorf("未知的OCSP校验模式 %q (可选 %q, %q)", mode, OCSPCheckSoft, OCSPCheckHard)
+}
+
+// crlStore 缓存证书吊销列表,文件变更后重新加载;加载失败时继续使用旧的列表
+type crlStore struct {
+	file string
+	lg   *zap.Logger
+
+	mu         sync.RWMutex
+	revoked    map[string]struct{} // 被吊销证书的序列号
+	nextUpdate time.Time
+	stamps     []fileStamp
+}
+
+func crlStoreFor(info TLSInfo) (*crlStore, error) {
+	lg := info.Logger
+	if lg == nil {
+		lg = zap.NewNop()
+	}
+	s, err := registerStore("crl|"+info.CRLFile, func() reloadable {
+		return &crlStore{file: info.CRLFile, lg: lg}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.(*crlStore), nil
+}
+
+func (s *crlStore) reload(force bool) (bool, error) {
+	stamps, err := statFiles([]string{s.file})
+	if err != nil {
+		return false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !force && s.revoked != nil && stampsEqual(s.stamps, stamps) {
+		return false, nil
+	}
+	b, err := ioutil.ReadFile(s.file)
+	if err != nil {
+		return false, err
+	}
+	certList, err := x509.ParseCRL(b)
+	if err != nil {
+		return false, err
+	}
+	revoked := make(map[string]struct{}, len(certList.TBSCertList.RevokedCertificates))
+	for _, rc := range certList.TBSCertList.RevokedCertificates {
+		revoked[string(rc.SerialNumber.Bytes())] = struct{}{}
+	}
+	nextUpdate := certList.TBSCertList.NextUpdate
+	if !nextUpdate.IsZero() && nextUpdate.Before(time.Now()) {
+		s.lg.Warn("证书吊销列表已过期,请及时更新", zap.String("crl-file", s.file), zap.Time("next-update", nextUpdate))
+	}
+	s.revoked, s.nextUpdate, s.stamps = revoked, nextUpdate, stamps
+	return true, nil
+}
+
+func (s *crlStore) info() []CertInfo { return nil }
+
+func (s *crlStore) check(certs []*x509.Certificate) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, c := range certs {
+		if _, ok := s.revoked[string(c.SerialNumber.Bytes())]; ok {
+			revokedCertRejections.WithLabelValues("crl").Inc()
+			return fmt.Errorf("%w: serial %x is listed in %s", ErrCertRevoked, c.SerialNumber.Bytes(), s.file)
+		}
+	}
+	return nil
+}
+
+type ocspResult struct {
+	status     int
+	nextUpdate time.Time
+}
+
+// ocspChecker 通过OCSP responder检查对端证书的状态,结果缓存到next update
+type ocspChecker struct {
+	mode   string
+	lg     *zap.Logger
+	client *http.Client
+
+	mu    sync.Mutex
+	cache map[string]ocspResult // 签发者公钥摘要+序列号 -> 结果
+}
+
+func newOCSPChecker(info TLSInfo) *ocspChecker {
+	lg := info.Logger
+	if lg == nil {
+		lg = zap.NewNop()
+	}
+	return &ocspChecker{
+		mode:   info.OCSPCheck,
+		lg:     lg,
+		client: &http.Client{Timeout: OCSPTimeout},
+		cache:  make(map[string]ocspResult),
+	}
+}
+
+func (c *ocspChecker) check(ctx context.Context, st tls.ConnectionState) error {
+	if len(st.PeerCertificates) == 0 {
+		return nil
+	}
+	cert := st.PeerCertificates[0]
+	var issuer *x509.Certificate
+	if len(st.VerifiedChains) > 0 && len(st.VerifiedChains[0]) > 1 {
+		issuer = st.VerifiedChains[0][1]
+	} else if len(st.PeerCertificates) > 1 {
+		issuer = st.PeerCertificates[1]
+	}
+
+	status, err := c.status(ctx, cert, issuer)
+	switch {
+	case err == nil && status == ocsp.Revoked:
+		revokedCertRejections.WithLabelValues("ocsp").Inc()
+		return fmt.Errorf("%w: OCSP responder reports serial %x as revoked", ErrCertRevoked, cert.SerialNumber.Bytes())
+	case err == nil && status == ocsp.Good:
+		return nil
+	case err == nil:
+		err = errors.New("OCSP responder reports unknown status")
+	}
+	if c.mode == OCSPCheckHard {
+		revokedCertRejections.WithLabelValues("ocsp_unavailable").Inc()
+		return fmt.Errorf("transport: cannot verify certificate serial %x via OCSP: %v", cert.SerialNumber.Bytes(), err)
+	}
+	c.lg.Warn("无法通过OCSP确认证书状态,放行连接", zap.String("subject", cert.Subject.String()), zap.Error(err))
+	return nil
+}
+
+func (c *ocspChecker) status(ctx context.Context, cert, issuer *x509.Certificate) (int, error) {
+	if issuer == nil {
+		return ocsp.Unknown, errNoIssuer
+	}
+	sum := sha256.Sum256(issuer.RawSubjectPublicKeyInfo)
+	key := string(sum[:]) + string(cert.SerialNumber.Bytes())
+	now := time.Now()
+
+	c.mu.Lock()
+	r, ok := c.cache[key]
+	c.mu.Unlock()
+	if ok && now.Before(r.nextUpdate) {
+		return r.status, nil
+	}
+
+	resp, _, err := queryOCSP(ctx, c.client, cert, issuer)
+	if err != nil {
+		return ocsp.Unknown, err
+	}
+	nextUpdate := resp.NextUpdate
+	if nextUpdate.IsZero() || nextUpdate.Sub(now) > OCSPDefaultValidity {
+		nextUpdate = now.Add(OCSPDefaultValidity)
+	}
+
+	c.mu.Lock()
+	if len(c.cache) >= maxOCSPCacheEntries {
+		for k, v := range c.cache {
+			if !now.Before(v.nextUpdate) {
+				delete(c.cache, k)
+			}
+		}
+		if len(c.cache) >= maxOCSPCacheEntries {
+			c.cache = make(map[string]ocspResult)
+		}
+	}
+	c.cache[key] = ocspResult{status: resp.Status, nextUpdate: nextUpdate}
+	c.mu.Unlock()
+	return resp.Status, nil
+}
+
+// queryOCSP 向证书中的OCSP responder查询证书状态,返回解析后的响应和原始响应
+func queryOCSP(ctx context.Context, client *http.Client, cert, issuer *x509.Certificate) (*ocsp.Response, []byte, error) {
+	if len(cert.OCSPServer) == 0 {
+		return nil, nil, errNoOCSPServer
+	}
+	req, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, cert.OCSPServer[0], bytes.NewReader(req))
+	if err != nil {
+		return nil, nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/ocsp-request")
+	httpReq.Header.Set("Accept", "application/ocsp-response")
+	httpResp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("OCSP responder %s returned %s", cert.OCSPServer[0], httpResp.Status)
+	}
+	raw, err := ioutil.ReadAll(io.LimitReader(httpResp.Body, 1<<20))
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := ocsp.ParseResponseForCert(raw, cert, issuer)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, raw, nil
+}
+
+// ocspStapler 定期获取本节点证书的OCSP响应,握手时附加到证书上
+type ocspStapler struct {
+	certs *keyPairStore
+	ca    *caStore
+	lg    *zap.Logger
+
+	mu        sync.RWMutex
+	leaf      *x509.Certificate // staple对应的证书
+	response  []byte            // 原始OCSP响应
+	expiresAt time.Time
+	refreshAt time.Time
+}
+
+func ocspStaplerFor(info TLSInfo) (*ocspStapler, error) {
+	certs, err := keyPairStoreFor(info, CertKindCert, info.CertFile, info.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	var ca *caStore
+	if cs := info.cafiles(); len(cs) > 0 {
+		if ca, err = caStoreFor(info, cs); err != nil {
+			return nil, err
+		}
+	}
+	lg := info.Logger
+	if lg == nil {
+		lg = zap.NewNop()
+	}
+	s, err := registerStore("ocsp-staple|"+info.CertFile+"|"+info.KeyFile, func() reloadable {
+		return &ocspStapler{certs: certs, ca: ca, lg: lg}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.(*ocspStapler), nil
+}
+
+// reload 证书变更或到达刷新时间时重新获取OCSP响应;获取失败时继续使用未过期的旧响应,不影响服务
+func (s *ocspStapler) reload(force bool) (bool, error) {
+	cert, leaf := s.certs.current()
+	if cert == nil || leaf == nil {
+		return false, nil
+	}
+	now := time.Now()
+	s.mu.RLock()
+	due := force || s.leaf != leaf || !now.Before(s.refreshAt)
+	s.mu.RUnlock()
+	if !due {
+		return false, nil
+	}
+
+	issuer := s.issuer(cert, leaf)
+	var (
+		resp *ocsp.Response
+		raw  []byte
+		err  = errNoIssuer
+	)
+	if issuer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), OCSPTimeout)
+		resp, raw, err = queryOCSP(ctx, &http.Client{}, leaf, issuer)
+		cancel()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.lg.Warn("获取OCSP响应失败", zap.String("subject", leaf.Subject.String()), zap.Error(err))
+		if s.leaf != leaf || !now.Before(s.expiresAt) {
+			s.leaf, s.response = leaf, nil
+		}
+		s.refreshAt = now.Add(time.Minute)
+		return false, nil
+	}
+	if resp.Status == ocsp.Revoked {
+		s.lg.Error("OCSP responder答复本节点证书已被吊销", zap.String("subject", leaf.Subject.String()), zap.Time("revoked-at", resp.RevokedAt))
+	}
+	s.leaf, s.response = leaf, raw
+	s.expiresAt = resp.NextUpdate
+	if s.expiresAt.IsZero() {
+		s.expiresAt = now.Add(OCSPDefaultValidity)
+	}
+	// 在有效期过半时刷新
+	s.refreshAt = now.Add(s.expiresAt.Sub(now) / 2)
+	return true, nil
+}
+
+func (s *ocspStapler) info() []CertInfo { return nil }
+
+// issuer 从证书链或者CA文件中查找签发者证书
+func (s *ocspStapler) issuer(cert *tls.Certificate, leaf *x509.Certificate) *x509.Certificate {
+	if len(cert.Certificate) > 1 {
+		if c, err := x509.ParseCertificate(cert.Certificate[1]); err == nil {
+			return c
+		}
+	}
+	if s.ca == nil {
+		return nil
+	}
+	s.ca.mu.RLock()
+	defer s.ca.mu.RUnlock()
+	for _, c := range s.ca.certs {
+		if bytes.Equal(c.RawSubject, leaf.RawIssuer) && leaf.CheckSignatureFrom(c) == nil {
+			return c
+		}
+	}
+	return nil
+}
+
+// staple 返回附加了OCSP响应的证书副本;没有可用的响应时原样返回
+func (s *ocspStapler) staple(cert *tls.Certificate) *tls.Certificate {
+	if cert == nil || len(cert.Certificate) == 0 {
+		return cert
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.response) == 0 || s.leaf == nil || !bytes.Equal(s.leaf.Raw, cert.Certificate[0]) || !time.Now().Before(s.expiresAt) {
+		return cert
+	}
+	c := *cert
+	c.OCSPStaple = s.response
+	return &c
+}
@@ -16,6 +16,7 @@ package transport
 
 import (
 	"context"
+	"crypto/tls"
 	"net"
 	"net/http"
 	"strings"
@@ -46,6 +47,33 @@ func NewTransport(info TLSInfo, dialtimeoutd time.Duration) (*http.Transport, er
 		KeepAlive: 30 * time.Second,
 	}
 
+	// 每个新连接使用最新的CA证书池,主机名和IP的校验仍由tls内置逻辑完成
+	t.DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		c := RefreshClientConfig(cfg)
+		if c.ServerName == "" {
+			host, _, serr := net.SplitHostPort(addr)
+			if serr != nil {
+				host = addr
+			}
+			if c == cfg {
+				c = cfg.Clone()
+			}
+			c.ServerName = host
+		}
+		hctx, cancel := context.WithTimeout(ctx, t.TLSHandshakeTimeout)
+		defer cancel()
+		tc := tls.Client(conn, c)
+		if err = tc.HandshakeContext(hctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return tc, nil
+	}
+
 	dialContext := func(ctx context.Context, net, addr string) (net.Conn, error) {
 		return dialer.DialContext(ctx, "unix", addr)
 	}
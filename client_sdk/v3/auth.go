@@ -42,6 +42,7 @@ type (
 	AuthRoleDeleteResponse           pb.AuthRoleDeleteResponse
 	AuthUserListResponse             pb.AuthUserListResponse
 	AuthRoleListResponse             pb.AuthRoleListResponse
+	AuthDenialsResponse              pb.AuthDenialsResponse
 
 	PermissionType authpb.Permission_Type
 	Permission     authpb.Permission
@@ -57,6 +58,8 @@ type UserAddOptions authpb.UserAddOptions
 
 type Auth interface {
 	Authenticate(ctx context.Context, name string, password string) (*AuthenticateResponse, error)
+	// Refresh 使用refresh token换取新的token,返回的响应中包含轮换后的refresh token
+	Refresh(ctx context.Context, refreshToken string) (*AuthenticateResponse, error)
 	AuthEnable(ctx context.Context) (*AuthEnableResponse, error)
 	AuthDisable(ctx context.Context) (*AuthDisableResponse, error)
 	AuthStatus(ctx context.Context) (*AuthStatusResponse, error)
@@ -70,10 +73,18 @@ type Auth interface {
 	UserRevokeRole(ctx context.Context, name string, role string) (*AuthUserRevokeRoleResponse, error)
 	RoleAdd(ctx context.Context, name string) (*AuthRoleAddResponse, error)
 	RoleGrantPermission(ctx context.Context, name string, key, rangeEnd string, permType PermissionType) (*AuthRoleGrantPermissionResponse, error)
+	// RoleDenyPermission 禁止角色对key范围的permType操作,禁止优先于任何角色授予的允许权限
+	RoleDenyPermission(ctx context.Context, name string, key, rangeEnd string, permType PermissionType) (*AuthRoleGrantPermissionResponse, error)
 	RoleGet(ctx context.Context, role string) (*AuthRoleGetResponse, error)
 	RoleList(ctx context.Context) (*AuthRoleListResponse, error)
 	RoleRevokePermission(ctx context.Context, role string, key, rangeEnd string) (*AuthRoleRevokePermissionResponse, error)
 	RoleDelete(ctx context.Context, role string) (*AuthRoleDeleteResponse, error)
+	// RoleGrantOperation 授予角色非KV操作权限,例如 "lease"、"snapshot"
+	RoleGrantOperation(ctx context.Context, role string, op string) (*AuthRoleGrantPermissionResponse, error)
+	// RoleRevokeOperation 撤销角色的非KV操作权限
+	RoleRevokeOperation(ctx context.Context, role string, op string) (*AuthRoleRevokePermissionResponse, error)
+	// Denials 返回所连接节点最近记录的limit条权限检查失败,limit为0时返回全部
+	Denials(ctx context.Context, limit int64) (*AuthDenialsResponse, error)
 }
 
 type authClient struct {
@@ -102,6 +113,11 @@ func (auth *authClient) Authenticate(ctx context.Context, name string, password
 	return (*AuthenticateResponse)(resp), toErr(ctx, err)
 }
 
+func (auth *authClient) Refresh(ctx context.Context, refreshToken string) (*AuthenticateResponse, error) {
+	resp, err := auth.remote.Authenticate(ctx, &pb.AuthenticateRequest{RefreshToken: refreshToken}, auth.callOpts...)
+	return (*AuthenticateResponse)(resp), toErr(ctx, err)
+}
+
 func (auth *authClient) AuthEnable(ctx context.Context) (*AuthEnableResponse, error) {
 	resp, err := auth.remote.AuthEnable(ctx, &pb.AuthEnableRequest{}, auth.callOpts...)
 	return (*AuthEnableResponse)(resp), toErr(ctx, err)
@@ -186,16 +202,43 @@ func (auth *authClient) RoleList(ctx context.Context) (*AuthRoleListResponse, er
 	return (*AuthRoleListResponse)(resp), toErr(ctx, err)
 }
 
+func (auth *authClient) RoleDenyPermission(ctx context.Context, name string, key, rangeEnd string, permType PermissionType) (*AuthRoleGrantPermissionResponse, error) {
+	perm := &authpb.Permission{
+		Key:      key,
+		RangeEnd: rangeEnd,
+		PermType: authpb.Permission_Type(permType),
+		Deny:     true,
+	}
+	resp, err := auth.remote.RoleGrantPermission(ctx, &pb.AuthRoleGrantPermissionRequest{Name: name, Perm: perm}, auth.callOpts...)
+	return (*AuthRoleGrantPermissionResponse)(resp), toErr(ctx, err)
+}
+
 func (auth *authClient) RoleRevokePermission(ctx context.Context, role string, key, rangeEnd string) (*AuthRoleRevokePermissionResponse, error) {
 	resp, err := auth.remote.RoleRevokePermission(ctx, &pb.AuthRoleRevokePermissionRequest{Role: role, Key: string(key), RangeEnd: string(rangeEnd)}, auth.callOpts...)
 	return (*AuthRoleRevokePermissionResponse)(resp), toErr(ctx, err)
 }
 
+func (auth *authClient) RoleGrantOperation(ctx context.Context, role string, op string) (*AuthRoleGrantPermissionResponse, error) {
+	perm := &authpb.Permission{Operation: op}
+	resp, err := auth.remote.RoleGrantPermission(ctx, &pb.AuthRoleGrantPermissionRequest{Name: role, Perm: perm}, auth.callOpts...)
+	return (*AuthRoleGrantPermissionResponse)(resp), toErr(ctx, err)
+}
+
+func (auth *authClient) RoleRevokeOperation(ctx context.Context, role string, op string) (*AuthRoleRevokePermissionResponse, error) {
+	resp, err := auth.remote.RoleRevokePermission(ctx, &pb.AuthRoleRevokePermissionRequest{Role: role, Operation: op}, auth.callOpts...)
+	return (*AuthRoleRevokePermissionResponse)(resp), toErr(ctx, err)
+}
+
 func (auth *authClient) RoleDelete(ctx context.Context, role string) (*AuthRoleDeleteResponse, error) {
 	resp, err := auth.remote.RoleDelete(ctx, &pb.AuthRoleDeleteRequest{Role: role}, auth.callOpts...)
 	return (*AuthRoleDeleteResponse)(resp), toErr(ctx, err)
 }
 
+func (auth *authClient) Denials(ctx context.Context, limit int64) (*AuthDenialsResponse, error) {
+	resp, err := auth.remote.Denials(ctx, &pb.AuthDenialsRequest{Limit: limit}, auth.callOpts...)
+	return (*AuthDenialsResponse)(resp), toErr(ctx, err)
+}
+
 func StrToPermissionType(s string) (PermissionType, error) {
 	val, ok := authpb.PermissionTypeValue[strings.ToUpper(s)]
 	if ok {
@@ -0,0 +1,220 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clientv3
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ls-2018/etcd_cn/client_sdk/v3/internal/endpoint"
+	"go.uber.org/zap"
+)
+
+// BalancerPolicy 决定客户端把请求发往哪个端点
+type BalancerPolicy string
+
+const (
+	// BalancerRoundRobin 在所有可用的端点之间轮询(默认)
+	BalancerRoundRobin BalancerPolicy = "round-robin"
+	// BalancerLatency 优先使用主动探测延迟最低的端点
+	BalancerLatency BalancerPolicy = "latency"
+	// BalancerZone 优先使用与客户端在同一个区域的成员,区域取自成员的标签
+	BalancerZone BalancerPolicy = "zone"
+	// BalancerLeader 优先使用leader,适合写多的客户端
+	BalancerLeader BalancerPolicy = "leader"
+)
+
+const (
+	defaultBalancerProbeInterval = 5 * time.Second
+	defaultBalancerZoneLabel     = "zone"
+	// 延迟的指数加权平均系数
+	latencyEWMAWeight = 0.3
+)
+
+// BalancerConfig 负载均衡策略的配置
+type BalancerConfig struct {
+	Policy BalancerPolicy `json:"policy"`
+	// ProbeInterval 探测延迟、leader和成员标签的间隔,默认5s
+	ProbeInterval time.Duration `json:"probe-interval"`
+	// Zone 客户端所在的区域, BalancerZone 时必须设置
+	Zone string `json:"zone"`
+	// ZoneLabel 成员标签中表示区域的键,默认为"zone"
+	ZoneLabel string `json:"zone-label"`
+}
+
+// Validate 检查配置是否有效
+func (bc *BalancerConfig) Validate() error {
+	switch bc.Policy {
+	case "", BalancerRoundRobin, BalancerLatency, BalancerLeader:
+	case BalancerZone:
+		if bc.Zone == "" {
+			return fmt.Errorf("balancer: policy %q requires a zone", bc.Policy)
+		}
+	default:
+		return fmt.Errorf("balancer: unknown policy %q", bc.Policy)
+	}
+	if bc.ProbeInterval < 0 {
+		return fmt.Errorf("balancer: probe interval must be positive, got %v", bc.ProbeInterval)
+	}
+	return nil
+}
+
+// SetBalancer 在运行时切换负载均衡策略
+func (c *Client) SetBalancer(bc BalancerConfig) error {
+	if err := bc.Validate(); err != nil {
+		return err
+	}
+	if bc.ProbeInterval == 0 {
+		bc.ProbeInterval = defaultBalancerProbeInterval
+	}
+	if bc.ZoneLabel == "" {
+		bc.ZoneLabel = defaultBalancerZoneLabel
+	}
+
+	c.balancerMu.Lock()
+	defer c.balancerMu.Unlock()
+	if c.balancerCancel != nil {
+		c.balancerCancel()
+		c.balancerCancel = nil
+	}
+	c.resolver.Selector.Prefer(nil)
+	if bc.Policy == "" || bc.Policy == BalancerRoundRobin {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(c.ctx)
+	c.balancerCancel = cancel
+	go c.runBalancer(ctx, bc)
+	return nil
+}
+
+// runBalancer 定期探测端点,更新优先使用的地址
+func (c *Client) runBalancer(ctx context.Context, bc BalancerConfig) {
+	latency := make(map[string]time.Duration)
+	for {
+		var (
+			prefer []string
+			err    error
+		)
+		switch bc.Policy {
+		case BalancerLatency:
+			prefer = c.probeLatency(ctx, bc.ProbeInterval, latency)
+		case BalancerLeader:
+			prefer, err = c.probeLeader(ctx, bc.ProbeInterval)
+		case BalancerZone:
+			prefer, err = c.probeZone(ctx, bc)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			c.lg.Info("balancer probe failed", zap.String("policy", string(bc.Policy)), zap.Error(err))
+		} else {
+			c.resolver.Selector.Prefer(prefer)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(bc.ProbeInterval):
+		}
+	}
+}
+
+// probeLatency 对每个端点调用Status,按延迟的加权平均从小到大排序;探测失败的端点排在最后
+func (c *Client) probeLatency(ctx context.Context, timeout time.Duration, latency map[string]time.Duration) []string {
+	eps := c.Endpoints()
+	failed := make(map[string]bool)
+	for _, ep := range eps {
+		sctx, cancel := context.WithTimeout(ctx, timeout)
+		start := time.Now()
+		_, err := c.Status(sctx, ep)
+		cancel()
+		if err != nil {
+			failed[ep] = true
+			delete(latency, ep)
+			continue
+		}
+		d := time.Since(start)
+		if old, ok := latency[ep]; ok {
+			d = time.Duration(latencyEWMAWeight*float64(d) + (1-latencyEWMAWeight)*float64(old))
+		}
+		latency[ep] = d
+	}
+	sort.SliceStable(eps, func(i, j int) bool {
+		if failed[eps[i]] != failed[eps[j]] {
+			return !failed[eps[i]]
+		}
+		return latency[eps[i]] < latency[eps[j]]
+	})
+	return endpointAddrs(eps)
+}
+
+// probeLeader 找到leader所在的端点
+func (c *Client) probeLeader(ctx context.Context, timeout time.Duration) ([]string, error) {
+	var lastErr error
+	for _, ep := range c.Endpoints() {
+		sctx, cancel := context.WithTimeout(ctx, timeout)
+		resp, err := c.Status(sctx, ep)
+		cancel()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if resp.Leader != 0 && resp.Header.MemberId == resp.Leader {
+			return endpointAddrs([]string{ep}), nil
+		}
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no endpoint is the leader")
+	}
+	return nil, lastErr
+}
+
+// probeZone 返回标签与客户端区域相同的成员的端点
+func (c *Client) probeZone(ctx context.Context, bc BalancerConfig) ([]string, error) {
+	mctx, cancel := context.WithTimeout(ctx, bc.ProbeInterval)
+	defer cancel()
+	resp, err := c.MemberList(mctx)
+	if err != nil {
+		return nil, err
+	}
+	local := make(map[string]bool)
+	for _, m := range resp.Members {
+		if m.Labels[bc.ZoneLabel] != bc.Zone {
+			continue
+		}
+		for _, u := range m.ClientURLs {
+			addr, _ := endpoint.Interpret(u)
+			local[addr] = true
+		}
+	}
+	var prefer []string
+	for _, addr := range endpointAddrs(c.Endpoints()) {
+		if local[addr] {
+			prefer = append(prefer, addr)
+		}
+	}
+	return prefer, nil
+}
+
+func endpointAddrs(eps []string) []string {
+	addrs := make([]string, len(eps))
+	for i, ep := range eps {
+		addrs[i], _ = endpoint.Interpret(ep)
+	}
+	return addrs
+}
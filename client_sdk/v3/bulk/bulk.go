@@ -0,0 +1,273 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package bulk 把大量的Put/Delete拆分成多个不超过服务端限制的事务.
+//
+// 设置 Config.Atomic 时,操作先写入暂存前缀,写入提交标记后再应用到目标key.
+// 应用的过程对读者可见;如果中途中断,Recover 会完成已经提交的批次,
+// 并丢弃超过指定时间仍未提交的批次.
+package bulk
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	clientv3 "github.com/ls-2018/etcd_cn/client_sdk/v3"
+)
+
+const (
+	// DefaultMaxOps 与服务端默认的 --max-txn-ops 一致
+	DefaultMaxOps = 128
+	// DefaultMaxBytes 小于服务端默认的 --max-request-bytes(1.5MiB),为请求的其它部分留出空间
+	DefaultMaxBytes = 1024 * 1024
+	// DefaultStagingPrefix Atomic 批次的暂存前缀
+	DefaultStagingPrefix = "__bulk/"
+
+	// 每个操作在请求中除key和value之外的估计开销
+	opOverhead = 32
+)
+
+// Config 拆分和提交的配置
+type Config struct {
+	// MaxOps 每个事务最多的操作数
+	MaxOps int
+	// MaxBytes 每个事务中key和value的最大字节数
+	MaxBytes int
+	// Atomic 保证所有操作要么全部应用,要么全部不应用(需要配合 Recover)
+	Atomic bool
+	// StagingPrefix Atomic 时暂存操作的前缀
+	StagingPrefix string
+}
+
+func (cfg Config) withDefaults() Config {
+	if cfg.MaxOps <= 0 {
+		cfg.MaxOps = DefaultMaxOps
+	}
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = DefaultMaxBytes
+	}
+	if cfg.StagingPrefix == "" {
+		cfg.StagingPrefix = DefaultStagingPrefix
+	}
+	return cfg
+}
+
+// KeyValue 要写入的key
+type KeyValue struct {
+	Key   string
+	Value string
+	Lease clientv3.LeaseID
+}
+
+// Result 批量操作的结果
+type Result struct {
+	// Txns 应用到目标key的事务数
+	Txns int
+	// Revision 最后一个事务的revision
+	Revision int64
+}
+
+type op struct {
+	Key    string `json:"k"`
+	Value  string `json:"v,omitempty"`
+	Lease  int64  `json:"l,omitempty"`
+	Delete bool   `json:"d,omitempty"`
+}
+
+func (o op) size() int { return len(o.Key) + len(o.Value) + opOverhead }
+
+func (o op) clientOp() clientv3.Op {
+	if o.Delete {
+		return clientv3.OpDelete(o.Key)
+	}
+	if o.Lease != 0 {
+		return clientv3.OpPut(o.Key, o.Value, clientv3.WithLease(clientv3.LeaseID(o.Lease)))
+	}
+	return clientv3.OpPut(o.Key, o.Value)
+}
+
+// Put 写入所有kvs
+func Put(ctx context.Context, kv clientv3.KV, kvs []KeyValue, cfg Config) (*Result, error) {
+	ops := make([]op, len(kvs))
+	for i, p := range kvs {
+		ops[i] = op{Key: p.Key, Value: p.Value, Lease: int64(p.Lease)}
+	}
+	return run(ctx, kv, ops, cfg.withDefaults())
+}
+
+// Delete 删除所有keys
+func Delete(ctx context.Context, kv clientv3.KV, keys []string, cfg Config) (*Result, error) {
+	ops := make([]op, len(keys))
+	for i, k := range keys {
+		ops[i] = op{Key: k, Delete: true}
+	}
+	return run(ctx, kv, ops, cfg.withDefaults())
+}
+
+func run(ctx context.Context, kv clientv3.KV, ops []op, cfg Config) (*Result, error) {
+	chunks := split(ops, cfg)
+	if !cfg.Atomic {
+		return apply(ctx, kv, chunks)
+	}
+
+	base := cfg.StagingPrefix + newID() + "/"
+	if _, err := kv.Put(ctx, base+"begin", time.Now().UTC().Format(time.RFC3339Nano)); err != nil {
+		return nil, err
+	}
+	for i, ch := range chunks {
+		data, err := json.Marshal(ch)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = kv.Put(ctx, chunkKey(base, i), string(data)); err != nil {
+			return nil, err
+		}
+	}
+	// 提交标记写入之后,这个批次就必须全部应用
+	if _, err := kv.Put(ctx, base+"commit", ""); err != nil {
+		return nil, err
+	}
+	res, err := apply(ctx, kv, chunks)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = kv.Delete(ctx, base, clientv3.WithPrefix()); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// split 按照 MaxOps 和 MaxBytes 拆分;超过 MaxBytes 的单个操作独占一个事务
+func split(ops []op, cfg Config) [][]op {
+	var (
+		chunks [][]op
+		cur    []op
+		size   int
+	)
+	for _, o := range ops {
+		if len(cur) > 0 && (len(cur) == cfg.MaxOps || size+o.size() > cfg.MaxBytes) {
+			chunks = append(chunks, cur)
+			cur, size = nil, 0
+		}
+		cur = append(cur, o)
+		size += o.size()
+	}
+	if len(cur) > 0 {
+		chunks = append(chunks, cur)
+	}
+	return chunks
+}
+
+func apply(ctx context.Context, kv clientv3.KV, chunks [][]op) (*Result, error) {
+	res := &Result{}
+	for _, ch := range chunks {
+		ops := make([]clientv3.Op, len(ch))
+		for i, o := range ch {
+			ops[i] = o.clientOp()
+		}
+		resp, err := kv.Txn(ctx).Then(ops...).Commit()
+		if err != nil {
+			return res, err
+		}
+		res.Txns++
+		res.Revision = resp.Header.Revision
+	}
+	return res, nil
+}
+
+// Recover 完成暂存前缀下已经提交的批次,并删除开始时间早于 abandonAfter 之前且没有提交的批次.
+// 应该在写入者启动时调用; abandonAfter 需要大于暂存一个批次所需的时间.
+func Recover(ctx context.Context, kv clientv3.KV, cfg Config, abandonAfter time.Duration) error {
+	cfg = cfg.withDefaults()
+	resp, err := kv.Get(ctx, cfg.StagingPrefix, clientv3.WithPrefix(), clientv3.WithKeysOnly())
+	if err != nil {
+		return err
+	}
+	batches := make(map[string]bool)
+	var ids []string
+	for _, skv := range resp.Kvs {
+		rest := strings.TrimPrefix(skv.Key, cfg.StagingPrefix)
+		i := strings.Index(rest, "/")
+		if i < 0 {
+			continue
+		}
+		id := rest[:i]
+		if _, ok := batches[id]; !ok {
+			ids = append(ids, id)
+		}
+		batches[id] = batches[id] || rest[i+1:] == "commit"
+	}
+	for _, id := range ids {
+		base := cfg.StagingPrefix + id + "/"
+		if batches[id] {
+			if err = recoverCommitted(ctx, kv, base); err != nil {
+				return err
+			}
+		} else if abandoned, err := isAbandoned(ctx, kv, base, abandonAfter); err != nil {
+			return err
+		} else if !abandoned {
+			continue
+		}
+		if _, err = kv.Delete(ctx, base, clientv3.WithPrefix()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func recoverCommitted(ctx context.Context, kv clientv3.KV, base string) error {
+	resp, err := kv.Get(ctx, base+"ops/", clientv3.WithPrefix(), clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend))
+	if err != nil {
+		return err
+	}
+	chunks := make([][]op, 0, len(resp.Kvs))
+	for _, skv := range resp.Kvs {
+		var ch []op
+		if err = json.Unmarshal([]byte(skv.Value), &ch); err != nil {
+			return fmt.Errorf("bulk: invalid staged chunk %q: %v", skv.Key, err)
+		}
+		chunks = append(chunks, ch)
+	}
+	_, err = apply(ctx, kv, chunks)
+	return err
+}
+
+func isAbandoned(ctx context.Context, kv clientv3.KV, base string, abandonAfter time.Duration) (bool, error) {
+	resp, err := kv.Get(ctx, base+"begin")
+	if err != nil {
+		return false, err
+	}
+	if len(resp.Kvs) == 0 {
+		// begin 是第一个写入的key,没有它说明批次已经在被清理
+		return true, nil
+	}
+	began, err := time.Parse(time.RFC3339Nano, resp.Kvs[0].Value)
+	if err != nil {
+		return false, fmt.Errorf("bulk: invalid begin time %q: %v", resp.Kvs[0].Value, err)
+	}
+	return time.Since(began) > abandonAfter, nil
+}
+
+func chunkKey(base string, i int) string { return fmt.Sprintf("%sops/%08d", base, i) }
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return fmt.Sprintf("%016x-%s", time.Now().UnixNano(), hex.EncodeToString(b))
+}
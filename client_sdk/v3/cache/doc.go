@@ -0,0 +1,40 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cache serves repeated range reads from a local cache that is kept
+// correct by a watch on the cached prefix. Any event on a cached key drops the
+// affected entries, so a read never returns data older than the watch has seen.
+//
+// Create a cached KV from a clientv3.Client 'cli':
+//
+//     ckv, closeCache, err := cache.NewKV(cli, cache.Config{Prefix: "config/", MaxStaleness: time.Second})
+//     if err != nil {
+//         // handle error
+//     }
+//     defer closeCache()
+//
+// Identical Get requests under the prefix are answered locally until a watched
+// event invalidates them:
+//
+//     resp, err := ckv.Get(context.TODO(), "config/a")
+//
+// With ConsistencyWatch (the default) a cached read may lag the cluster by the
+// watch propagation delay; MaxStaleness bounds how long the cache is trusted
+// without hearing from the watch. ConsistencyLinearizable first fetches the
+// cluster's current revision with a count-only read and only serves the cache
+// once the watch has caught up to it.
+//
+// Writes through the cached KV invalidate the written keys immediately, so a
+// client always reads its own writes.
+package cache
@@ -0,0 +1,366 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	v3 "github.com/ls-2018/etcd_cn/client_sdk/v3"
+	"go.uber.org/zap"
+)
+
+// Consistency 决定什么时候可以用缓存回答读请求
+type Consistency int
+
+const (
+	// ConsistencyWatch 只要watch正常,缓存就可以使用;读到的数据最多落后watch的传播延迟
+	ConsistencyWatch Consistency = iota
+	// ConsistencyLinearizable 每次读先用 count-only 的线性读获取集群当前revision,watch追上后才使用缓存
+	ConsistencyLinearizable
+)
+
+// DefaultMaxEntries 默认最多缓存的range数
+const DefaultMaxEntries = 10000
+
+// watchRetryInterval watch失败后重新建立的间隔
+const watchRetryInterval = 500 * time.Millisecond
+
+// Config 缓存配置
+type Config struct {
+	// Prefix 需要缓存的key前缀,只缓存完全落在前缀内的range,为空时缓存所有key
+	Prefix string
+	// MaxStaleness 超过这么长时间没有收到watch响应(包括进度通知)时不再使用缓存,0表示不限制.
+	// 设置后会每隔 MaxStaleness/2 请求一次进度通知
+	MaxStaleness time.Duration
+	// MaxEntries 最多缓存的range数,超过时随机淘汰,0表示使用 DefaultMaxEntries
+	MaxEntries int
+	// Consistency 一致性模式
+	Consistency Consistency
+}
+
+func (cfg Config) Validate() error {
+	if cfg.MaxStaleness < 0 {
+		return fmt.Errorf("invalid max staleness %v", cfg.MaxStaleness)
+	}
+	if cfg.MaxEntries < 0 {
+		return fmt.Errorf("invalid max entries %d", cfg.MaxEntries)
+	}
+	if cfg.Consistency != ConsistencyWatch && cfg.Consistency != ConsistencyLinearizable {
+		return errors.New("unknown cache consistency")
+	}
+	return nil
+}
+
+type entry struct {
+	key  string
+	end  string
+	resp *v3.GetResponse
+}
+
+// covers 判断key是否在entry的范围内
+func (e *entry) covers(key string) bool {
+	switch e.end {
+	case "":
+		return key == e.key
+	case "\x00":
+		return key >= e.key
+	default:
+		return key >= e.key && key < e.end
+	}
+}
+
+type cachedKV struct {
+	v3.KV
+	cl  *v3.Client
+	cfg Config
+	end string // 前缀的范围结束
+
+	mu           sync.RWMutex
+	entries      map[string]*entry
+	startRev     int64     // watch创建时的revision,0表示watch还没有建立
+	progressRev  int64     // watch已经确认的revision
+	progressTime time.Time // 上次收到watch响应的时间
+	writeRev     int64     // 通过本KV写入的最大revision,更早的响应不再缓存
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewKV 返回带读缓存的KV.只有Get会使用缓存,其它请求直接发给集群,写成功后使对应的缓存失效.
+// 返回的函数用于停止watch并释放缓存
+func NewKV(cl *v3.Client, cfg Config) (v3.KV, func(), error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	if cfg.MaxEntries == 0 {
+		cfg.MaxEntries = DefaultMaxEntries
+	}
+	cctx, cancel := context.WithCancel(cl.Ctx())
+	c := &cachedKV{
+		KV:      cl.KV,
+		cl:      cl,
+		cfg:     cfg,
+		end:     v3.GetPrefixRangeEnd(cfg.Prefix),
+		entries: make(map[string]*entry),
+		ctx:     cctx,
+		cancel:  cancel,
+	}
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.run()
+	}()
+	if cfg.MaxStaleness > 0 {
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			c.requestProgress()
+		}()
+	}
+	return c, c.Close, nil
+}
+
+func (c *cachedKV) Close() {
+	c.cancel()
+	c.wg.Wait()
+}
+
+func (c *cachedKV) Get(ctx context.Context, key string, opts ...v3.OpOption) (*v3.GetResponse, error) {
+	return c.get(ctx, v3.OpGet(key, opts...))
+}
+
+func (c *cachedKV) Put(ctx context.Context, key, val string, opts ...v3.OpOption) (*v3.PutResponse, error) {
+	resp, err := c.KV.Put(ctx, key, val, opts...)
+	if err == nil {
+		c.invalidate(resp.Header.Revision, key, "")
+	}
+	return resp, err
+}
+
+func (c *cachedKV) Delete(ctx context.Context, key string, opts ...v3.OpOption) (*v3.DeleteResponse, error) {
+	op := v3.OpDelete(key, opts...)
+	resp, err := c.KV.Do(ctx, op)
+	if err != nil {
+		return nil, err
+	}
+	c.invalidate(resp.Del().Header.Revision, key, string(op.RangeBytes()))
+	return resp.Del(), nil
+}
+
+func (c *cachedKV) Do(ctx context.Context, op v3.Op) (v3.OpResponse, error) {
+	switch {
+	case op.IsGet():
+		resp, err := c.get(ctx, op)
+		if err != nil {
+			return v3.OpResponse{}, err
+		}
+		return resp.OpResponse(), nil
+	case op.IsPut():
+		resp, err := c.KV.Do(ctx, op)
+		if err == nil {
+			c.invalidate(resp.Put().Header.Revision, string(op.KeyBytes()), "")
+		}
+		return resp, err
+	case op.IsDelete():
+		resp, err := c.KV.Do(ctx, op)
+		if err == nil {
+			c.invalidate(resp.Del().Header.Revision, string(op.KeyBytes()), string(op.RangeBytes()))
+		}
+		return resp, err
+	case op.IsTxn():
+		resp, err := c.KV.Do(ctx, op)
+		if err == nil {
+			c.invalidateAll(resp.Txn().Header.Revision)
+		}
+		return resp, err
+	}
+	return c.KV.Do(ctx, op)
+}
+
+func (c *cachedKV) Txn(ctx context.Context) v3.Txn {
+	return &txnCache{Txn: c.KV.Txn(ctx), c: c}
+}
+
+func (c *cachedKV) get(ctx context.Context, op v3.Op) (*v3.GetResponse, error) {
+	ck, ok := c.cacheKey(op)
+	if !ok {
+		resp, err := c.KV.Do(ctx, op)
+		return resp.Get(), err
+	}
+	var minRev int64
+	if c.cfg.Consistency == ConsistencyLinearizable && !op.IsSerializable() {
+		resp, err := c.KV.Get(ctx, string(op.KeyBytes()), v3.WithCountOnly())
+		if err != nil {
+			return nil, err
+		}
+		minRev = resp.Header.Revision
+	}
+	if resp := c.lookup(ck, minRev); resp != nil {
+		return resp, nil
+	}
+	resp, err := c.KV.Do(ctx, op)
+	if err != nil {
+		return nil, err
+	}
+	c.store(ck, string(op.KeyBytes()), string(op.RangeBytes()), resp.Get())
+	return resp.Get(), nil
+}
+
+// cacheKey 返回range的缓存key;指定了revision或版本过滤条件,或者range超出前缀时不缓存
+func (c *cachedKV) cacheKey(op v3.Op) (string, bool) {
+	if op.Rev() != 0 || op.SnapshotToken() != "" || op.MinModRev() != 0 || op.MaxModRev() != 0 || op.MinCreateRev() != 0 || op.MaxCreateRev() != 0 {
+		return "", false
+	}
+	key, end := string(op.KeyBytes()), string(op.RangeBytes())
+	if key < c.cfg.Prefix || (c.end != "\x00" && key >= c.end) {
+		return "", false
+	}
+	if end != "" && c.end != "\x00" && (end == "\x00" || end > c.end) {
+		return "", false
+	}
+	var sort v3.SortOption
+	if s := op.Sort(); s != nil {
+		sort = *s
+	}
+	return fmt.Sprintf("%q/%q/%d/%d/%d/%t/%t", key, end, op.Limit(), sort.Target, sort.Order, op.IsKeysOnly(), op.IsCountOnly()), true
+}
+
+// lookup 返回缓存的响应,minRev为watch至少需要确认的revision
+func (c *cachedKV) lookup(ck string, minRev int64) *v3.GetResponse {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.startRev == 0 || c.progressRev < minRev {
+		return nil
+	}
+	if c.cfg.MaxStaleness > 0 && time.Since(c.progressTime) > c.cfg.MaxStaleness {
+		return nil
+	}
+	e, ok := c.entries[ck]
+	if !ok {
+		return nil
+	}
+	resp := *e.resp
+	header := *e.resp.Header
+	resp.Header = &header
+	return &resp
+}
+
+// store 缓存range的响应.响应的revision必须不早于watch已经处理到的revision,
+// 否则在两者之间修改这个范围的事件已经错过,缓存会一直是旧数据
+func (c *cachedKV) store(ck, key, end string, resp *v3.GetResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	rev := resp.Header.Revision
+	if c.startRev == 0 || rev < c.startRev || rev < c.progressRev || rev < c.writeRev {
+		return
+	}
+	if _, ok := c.entries[ck]; !ok && len(c.entries) >= c.cfg.MaxEntries {
+		for k := range c.entries {
+			delete(c.entries, k)
+			break
+		}
+	}
+	c.entries[ck] = &entry{key: key, end: end, resp: resp}
+}
+
+// invalidate 本KV写入成功后使与[key, end)相交的缓存失效
+func (c *cachedKV) invalidate(rev int64, key, end string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if rev > c.writeRev {
+		c.writeRev = rev
+	}
+	w := &entry{key: key, end: end}
+	for k, e := range c.entries {
+		if e.covers(key) || w.covers(e.key) {
+			delete(c.entries, k)
+		}
+	}
+}
+
+func (c *cachedKV) invalidateAll(rev int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if rev > c.writeRev {
+		c.writeRev = rev
+	}
+	c.entries = make(map[string]*entry)
+}
+
+// run 维护前缀上的watch,watch中断时清空缓存并重新建立
+func (c *cachedKV) run() {
+	for {
+		c.watch()
+		c.mu.Lock()
+		c.entries = make(map[string]*entry)
+		c.startRev, c.progressRev = 0, 0
+		c.mu.Unlock()
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(watchRetryInterval):
+		}
+	}
+}
+
+func (c *cachedKV) watch() {
+	wctx, cancel := context.WithCancel(v3.WithRequireLeader(c.ctx))
+	defer cancel()
+	wch := c.cl.Watch(wctx, c.cfg.Prefix, v3.WithPrefix(), v3.WithCreatedNotify(), v3.WithProgressNotify())
+	for wr := range wch {
+		if err := wr.Err(); err != nil {
+			c.cl.GetLogger().Warn("缓存的watch中断", zap.String("prefix", c.cfg.Prefix), zap.Error(err))
+			return
+		}
+		c.mu.Lock()
+		if wr.Created {
+			c.startRev = wr.Header.Revision
+		}
+		for _, ev := range wr.Events {
+			key := string(ev.Kv.Key)
+			for k, e := range c.entries {
+				if e.resp.Header.Revision < ev.Kv.ModRevision && e.covers(key) {
+					delete(c.entries, k)
+				}
+			}
+		}
+		if wr.Header.Revision > c.progressRev {
+			c.progressRev = wr.Header.Revision
+		}
+		c.progressTime = time.Now()
+		c.mu.Unlock()
+	}
+}
+
+// requestProgress 定期请求进度通知,让空闲的前缀也能确认缓存没有过期
+func (c *cachedKV) requestProgress() {
+	t := time.NewTicker(c.cfg.MaxStaleness / 2)
+	defer t.Stop()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-t.C:
+			ctx, cancel := context.WithTimeout(c.ctx, c.cfg.MaxStaleness)
+			c.cl.RequestProgress(ctx)
+			cancel()
+		}
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	v3 "github.com/ls-2018/etcd_cn/client_sdk/v3"
+)
+
+// txnCache 提交成功后清空缓存,事务内的写可能涉及任意key
+type txnCache struct {
+	v3.Txn
+	c *cachedKV
+}
+
+func (txn *txnCache) If(cs ...v3.Cmp) v3.Txn {
+	txn.Txn = txn.Txn.If(cs...)
+	return txn
+}
+
+func (txn *txnCache) Then(ops ...v3.Op) v3.Txn {
+	txn.Txn = txn.Txn.Then(ops...)
+	return txn
+}
+
+func (txn *txnCache) Else(ops ...v3.Op) v3.Txn {
+	txn.Txn = txn.Txn.Else(ops...)
+	return txn
+}
+
+func (txn *txnCache) Commit() (*v3.TxnResponse, error) {
+	resp, err := txn.Txn.Commit()
+	if err == nil {
+		txn.c.invalidateAll(resp.Header.Revision)
+	}
+	return resp, err
+}
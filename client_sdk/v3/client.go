@@ -23,6 +23,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/ls-2018/etcd_cn/client_sdk/pkg/transport"
 	"github.com/ls-2018/etcd_cn/client_sdk/v3/credentials"
 	"github.com/ls-2018/etcd_cn/client_sdk/v3/internal/endpoint"
 	"github.com/ls-2018/etcd_cn/client_sdk/v3/internal/resolver"
@@ -57,10 +58,15 @@ type Client struct {
 	cancel          context.CancelFunc // 上下文 cancel func
 	Username        string
 	Password        string
+	tokenMu         sync.Mutex
+	refreshToken    string // 最新的refresh token
 	authTokenBundle credentials.Bundle
 	callOpts        []grpc.CallOption
 	lgMu            *sync.RWMutex
 	lg              *zap.Logger
+
+	balancerMu     sync.Mutex
+	balancerCancel context.CancelFunc // 停止当前负载均衡策略的探测
 }
 
 // New 创建一个client用于与etcd server 通信
@@ -226,12 +232,28 @@ func (c *Client) dialSetupOpts(creds grpccredentials.TransportCredentials, dopts
 	// TODO: Replace all of clientv3/retry.go with RetryPolicy:
 	// https://github.com/grpc/grpc-proto/blob/cdd9ed5c3d3f87aef62f373b93361cf7bddc620d/grpc/service_config/service_config.proto#L130
 	rrBackoff := withBackoff(c.roundRobinQuorumBackoff(defaultBackoffWaitBetween, defaultBackoffJitterFraction))
+	streamOpts := []retryOption{withMax(0), rrBackoff}
+	unaryOpts := []retryOption{withMax(defaultUnaryMaxRetries), rrBackoff}
+	if p := c.cfg.RetryPolicy; p != nil {
+		unaryOpts = p.unaryOptions(c)
+		streamOpts[1] = unaryOpts[1]
+		if p.Budget != nil {
+			// 一元调用和流共享同一个预算
+			budget := withRetryBudget(newRetryBudget(p.Budget))
+			unaryOpts = append(unaryOpts, budget)
+			streamOpts = append(streamOpts, budget)
+		}
+	}
 	opts = append(opts,
 		// Disable stream retry by default since go-grpc-middleware/retry does not support client streams.
 		// Streams that are safe to retry are enabled individually.
-		grpc.WithStreamInterceptor(c.streamClientInterceptor(withMax(0), rrBackoff)),
-		grpc.WithUnaryInterceptor(c.unaryClientInterceptor(withMax(defaultUnaryMaxRetries), rrBackoff)),
+		grpc.WithStreamInterceptor(c.streamClientInterceptor(streamOpts...)),
+		grpc.WithUnaryInterceptor(c.tracingUnaryInterceptor(c.unaryClientInterceptor(unaryOpts...))),
 	)
+	if c.cfg.Metrics != nil {
+		// 链式拦截器在重试拦截器之内执行,每次重试单独计入指标
+		opts = append(opts, grpc.WithChainUnaryInterceptor(c.metricsUnaryInterceptor()))
+	}
 
 	return opts, nil
 }
@@ -380,22 +402,51 @@ func (c *Client) Endpoints() []string {
 	return eps
 }
 
+// hasCredentials 是否配置了用户名密码或者refresh token
+func (c *Client) hasCredentials() bool {
+	return (c.Username != "" && c.Password != "") || c.refreshToken != ""
+}
+
+// RefreshToken 返回最新的refresh token,refresh token每次换取token后都会轮换,需要长期保存的客户端应该保存该值
+func (c *Client) RefreshToken() string {
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+	return c.refreshToken
+}
+
 // OK
 func (c *Client) getToken(ctx context.Context) error {
-	var err error
+	// refresh token使用后即作废,需要串行换取
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
 
-	if c.Username == "" || c.Password == "" {
-		return nil
+	var (
+		resp *AuthenticateResponse
+		err  error
+	)
+	if c.refreshToken != "" {
+		resp, err = c.Auth.Refresh(ctx, c.refreshToken)
+		if err != nil && err != rpctypes.ErrAuthNotEnabled && c.Password != "" {
+			c.GetLogger().Warn("refresh token rejected, authenticating with password", zap.Error(err))
+			resp = nil
+		}
+	}
+	if resp == nil && err != rpctypes.ErrAuthNotEnabled && c.Username != "" && c.Password != "" {
+		resp, err = c.Auth.Authenticate(ctx, c.Username, c.Password)
 	}
-
-	resp, err := c.Auth.Authenticate(ctx, c.Username, c.Password)
 	if err != nil {
 		if err == rpctypes.ErrAuthNotEnabled {
 			return nil
 		}
 		return err
 	}
+	if resp == nil {
+		return nil
+	}
 	c.authTokenBundle.UpdateAuthToken(resp.Token)
+	if resp.RefreshToken != "" {
+		c.refreshToken = resp.RefreshToken
+	}
 	return nil
 }
 
@@ -412,7 +463,7 @@ func (c *Client) dial(creds grpccredentials.TransportCredentials, dopts ...grpc.
 	if err != nil {
 		return nil, fmt.Errorf("配置dialer失败: %v", err)
 	}
-	if c.Username != "" && c.Password != "" {
+	if c.hasCredentials() {
 		c.authTokenBundle = credentials.NewBundle(credentials.Config{})
 		opts = append(opts, grpc.WithPerRPCCredentials(c.authTokenBundle.PerRPCCredentials()))
 	}
@@ -471,6 +522,21 @@ func newClient(cfg *Config) (*Client, error) {
 	if cfg == nil {
 		cfg = &Config{}
 	}
+	if cfg.RetryPolicy != nil {
+		if err := cfg.RetryPolicy.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Balancer != nil {
+		if err := cfg.Balancer.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.CircuitBreaker != nil {
+		if err := cfg.CircuitBreaker.Validate(); err != nil {
+			return nil, err
+		}
+	}
 	var creds grpccredentials.TransportCredentials
 	if cfg.TLS != nil {
 		creds = credentials.NewBundle(credentials.Config{TLSConfig: cfg.TLS}).TransportCredentials()
@@ -493,6 +559,10 @@ func newClient(cfg *Config) (*Client, error) {
 		callOpts: defaultCallOpts,
 		lgMu:     new(sync.RWMutex),
 	}
+	if cfg.TLS != nil {
+		// 证书文件的定期检查随客户端关闭而停止
+		transport.WatchCerts(ctx, cfg.Logger)
+	}
 
 	var err error
 	if cfg.Logger != nil {
@@ -510,6 +580,7 @@ func newClient(cfg *Config) (*Client, error) {
 		client.Username = cfg.Username
 		client.Password = cfg.Password
 	}
+	client.refreshToken = cfg.RefreshToken
 	if cfg.MaxCallSendMsgSize > 0 || cfg.MaxCallRecvMsgSize > 0 {
 		if cfg.MaxCallRecvMsgSize > 0 && cfg.MaxCallSendMsgSize > cfg.MaxCallRecvMsgSize {
 			return nil, fmt.Errorf("gRPC消息接收大小 (%d bytes)必须是大于发送的 (%d bytes)", cfg.MaxCallRecvMsgSize, cfg.MaxCallSendMsgSize)
@@ -528,6 +599,9 @@ func newClient(cfg *Config) (*Client, error) {
 		client.callOpts = callOpts
 	}
 	client.resolver = resolver.New(cfg.Endpoints...)
+	if cfg.CircuitBreaker != nil {
+		client.resolver.Selector.SetBreaker(cfg.CircuitBreaker.breakerConfig())
+	}
 
 	if len(cfg.Endpoints) < 1 {
 		client.cancel()
@@ -568,6 +642,10 @@ func newClient(cfg *Config) (*Client, error) {
 		}
 	}
 
+	if cfg.Balancer != nil {
+		client.SetBalancer(*cfg.Balancer)
+	}
+
 	go client.autoSync()
 	return client, nil
 }
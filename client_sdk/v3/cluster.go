@@ -30,8 +30,17 @@ type (
 	MemberRemoveResponse  pb.MemberRemoveResponse
 	MemberUpdateResponse  pb.MemberUpdateResponse
 	MemberPromoteResponse pb.MemberPromoteResponse
+
+	MemberBatchChangeResponse pb.MemberBatchChangeResponse
 )
 
+// MemberBatchChange 一次批量成员变更,通过raft联合共识原子地生效
+type MemberBatchChange struct {
+	Add     []*pb.MemberAddRequest
+	Promote []uint64
+	Remove  []uint64
+}
+
 type Cluster interface {
 	MemberList(ctx context.Context) (*MemberListResponse, error)
 	MemberAdd(ctx context.Context, peerAddrs []string) (*MemberAddResponse, error)
@@ -39,6 +48,12 @@ type Cluster interface {
 	MemberRemove(ctx context.Context, id uint64) (*MemberRemoveResponse, error)
 	MemberUpdate(ctx context.Context, id uint64, peerAddrs []string) (*MemberUpdateResponse, error)
 	MemberPromote(ctx context.Context, id uint64) (*MemberPromoteResponse, error)
+	// MemberAddWithLabels 添加一个带有标签的成员
+	MemberAddWithLabels(ctx context.Context, peerAddrs []string, isLearner bool, labels map[string]string) (*MemberAddResponse, error)
+	// MemberUpdateWithLabels 更新成员地址并合并更新成员的标签,值为空的标签会被删除;peerAddrs为空时保留原地址
+	MemberUpdateWithLabels(ctx context.Context, id uint64, peerAddrs []string, labels map[string]string) (*MemberUpdateResponse, error)
+	// MemberBatchChange 原子地添加、提升、移除多个成员,进入联合配置后返回
+	MemberBatchChange(ctx context.Context, change MemberBatchChange) (*MemberBatchChangeResponse, error)
 }
 
 type cluster struct {
@@ -70,7 +85,15 @@ func (c *cluster) MemberAddAsLearner(ctx context.Context, peerAddrs []string) (*
 	return c.memberAdd(ctx, peerAddrs, true)
 }
 
+func (c *cluster) MemberAddWithLabels(ctx context.Context, peerAddrs []string, isLearner bool, labels map[string]string) (*MemberAddResponse, error) {
+	return c.memberAddWithLabels(ctx, peerAddrs, isLearner, labels)
+}
+
 func (c *cluster) memberAdd(ctx context.Context, peerAddrs []string, isLearner bool) (*MemberAddResponse, error) {
+	return c.memberAddWithLabels(ctx, peerAddrs, isLearner, nil)
+}
+
+func (c *cluster) memberAddWithLabels(ctx context.Context, peerAddrs []string, isLearner bool, labels map[string]string) (*MemberAddResponse, error) {
 	// fail-fast before panic in rafthttp
 	if _, err := types.NewURLs(peerAddrs); err != nil {
 		return nil, err
@@ -79,6 +102,7 @@ func (c *cluster) memberAdd(ctx context.Context, peerAddrs []string, isLearner b
 	r := &pb.MemberAddRequest{
 		PeerURLs:  peerAddrs,
 		IsLearner: isLearner,
+		Labels:    labels,
 	}
 	resp, err := c.remote.MemberAdd(ctx, r, c.callOpts...)
 	if err != nil {
@@ -111,6 +135,22 @@ func (c *cluster) MemberUpdate(ctx context.Context, id uint64, peerAddrs []strin
 	return nil, toErr(ctx, err)
 }
 
+func (c *cluster) MemberUpdateWithLabels(ctx context.Context, id uint64, peerAddrs []string, labels map[string]string) (*MemberUpdateResponse, error) {
+	if len(peerAddrs) > 0 {
+		if _, err := types.NewURLs(peerAddrs); err != nil {
+			return nil, err
+		}
+	}
+
+	// 不指定peerURLs时,服务端会保留成员现有的地址
+	r := &pb.MemberUpdateRequest{ID: id, PeerURLs: peerAddrs, Labels: labels}
+	resp, err := c.remote.MemberUpdate(ctx, r, c.callOpts...)
+	if err == nil {
+		return (*MemberUpdateResponse)(resp), nil
+	}
+	return nil, toErr(ctx, err)
+}
+
 func (c *cluster) MemberList(ctx context.Context) (*MemberListResponse, error) {
 	// it is safe to retry on list.
 	resp, err := c.remote.MemberList(ctx, &pb.MemberListRequest{Linearizable: true}, c.callOpts...)
@@ -128,3 +168,40 @@ func (c *cluster) MemberPromote(ctx context.Context, id uint64) (*MemberPromoteR
 	}
 	return (*MemberPromoteResponse)(resp), nil
 }
+
+func (c *cluster) MemberBatchChange(ctx context.Context, change MemberBatchChange) (*MemberBatchChangeResponse, error) {
+	// fail-fast before panic in rafthttp
+	for _, a := range change.Add {
+		if _, err := types.NewURLs(a.PeerURLs); err != nil {
+			return nil, err
+		}
+	}
+	r := &pb.MemberBatchChangeRequest{Add: change.Add, Promote: change.Promote, Remove: change.Remove}
+	resp, err := c.remote.MemberBatchChange(ctx, r, c.callOpts...)
+	if err != nil {
+		return nil, toErr(ctx, err)
+	}
+	return (*MemberBatchChangeResponse)(resp), nil
+}
+
+// MembersWithLabel 返回带有指定标签的成员;value为空时只要求存在该标签
+func MembersWithLabel(members []*pb.Member, key, value string) []*pb.Member {
+	var ms []*pb.Member
+	for _, m := range members {
+		v, ok := m.Labels[key]
+		if !ok || (value != "" && v != value) {
+			continue
+		}
+		ms = append(ms, m)
+	}
+	return ms
+}
+
+// ClientURLsWithLabel 返回带有指定标签的成员的客户端地址,可用于选择同一zone内的endpoint
+func ClientURLsWithLabel(members []*pb.Member, key, value string) []string {
+	var urls []string
+	for _, m := range MembersWithLabel(members, key, value) {
+		urls = append(urls, m.ClientURLs...)
+	}
+	return urls
+}
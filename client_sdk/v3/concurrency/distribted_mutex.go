@@ -211,6 +211,11 @@ func (m *Mutex) IsOwner() v3.Cmp {
 
 func (m *Mutex) Key() string { return m.myKey }
 
+// FencingToken returns the create revision of the lock key. Tokens only grow across
+// successive holders, so a storage system can reject writes carrying a token lower
+// than one it has already seen from a newer holder.
+func (m *Mutex) FencingToken() int64 { return m.myRev }
+
 // Header is the response header received from etcd on acquiring the lock.
 func (m *Mutex) Header() *pb.ResponseHeader { return m.hdr }
 
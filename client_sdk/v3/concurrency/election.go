@@ -36,21 +36,23 @@ type Election struct {
 	leaderRev     int64
 	leaderSession *Session
 	hdr           *pb.ResponseHeader
+	opts          electionOptions
 }
 
 // NewElection 返回给定关键字前缀上的新选举结果.
-func NewElection(s *Session, pfx string) *Election {
-	return &Election{session: s, keyPrefix: pfx + "/"}
+func NewElection(s *Session, pfx string, opts ...ElectionOption) *Election {
+	return &Election{session: s, keyPrefix: pfx + "/", opts: newElectionOptions(opts)}
 }
 
 // ResumeElection initializes an election with a known leader.
-func ResumeElection(s *Session, pfx string, leaderKey string, leaderRev int64) *Election {
+func ResumeElection(s *Session, pfx string, leaderKey string, leaderRev int64, opts ...ElectionOption) *Election {
 	return &Election{
 		keyPrefix:     pfx,
 		session:       s,
 		leaderKey:     leaderKey,
 		leaderRev:     leaderRev,
 		leaderSession: s,
+		opts:          newElectionOptions(opts),
 	}
 }
 
@@ -58,7 +60,11 @@ func ResumeElection(s *Session, pfx string, leaderKey string, leaderRev int64) *
 // 对于同一个前缀,多个会议可以参与选举,但一次只能有一个领导人.
 // 如果context是'context. todo ()/context. background ()', Campaign将继续被阻塞,以便其他key被删除,除非etcd返回一个不可恢复的错误(例如ErrCompacted).
 // 否则,直到上下文没有被取消或超时,Campaign将继续被阻塞,直到它成为leader.
+// 设置了 WithPriority 时,更高优先级的候选人会抢占当前的leader,见 campaignPriority.
 func (e *Election) Campaign(ctx context.Context, val string) error {
+	if e.opts.prioritized {
+		return e.campaignPriority(ctx, val)
+	}
 	s := e.session
 	client := e.session.Client()
 
@@ -127,7 +133,11 @@ func (e *Election) Resign(ctx context.Context) (err error) {
 	}
 	client := e.session.Client()
 	cmp := v3.Compare(v3.CreateRevision(e.leaderKey), "=", e.leaderRev)
-	resp, err := client.Txn(ctx).If(cmp).Then(v3.OpDelete(e.leaderKey)).Commit()
+	ops := []v3.Op{v3.OpDelete(e.leaderKey)}
+	if e.opts.prioritized {
+		ops = append(ops, e.resignOps()...)
+	}
+	resp, err := client.Txn(ctx).If(cmp).Then(ops...).Commit()
 	if err == nil {
 		e.hdr = resp.Header
 	}
@@ -0,0 +1,469 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package concurrency
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	v3 "github.com/ls-2018/etcd_cn/client_sdk/v3"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+)
+
+// DefaultPreemptGrace 抢占前给当前leader主动Resign的时间
+const DefaultPreemptGrace = 5 * time.Second
+
+type electionOptions struct {
+	prioritized bool
+	priority    int
+	grace       time.Duration
+}
+
+type ElectionOption func(*electionOptions)
+
+// WithPriority 以给定的优先级参与选举,值越大优先级越高.
+// 更高优先级的候选人在宽限期之后会抢占当前的leader;
+// 没有设置优先级的候选人按优先级0处理.
+func WithPriority(p int) ElectionOption {
+	return func(o *electionOptions) {
+		o.prioritized = true
+		o.priority = p
+	}
+}
+
+// WithPreemptGrace 设置抢占前等待当前leader主动Resign的时间
+func WithPreemptGrace(d time.Duration) ElectionOption {
+	return func(o *electionOptions) { o.grace = d }
+}
+
+func newElectionOptions(opts []ElectionOption) electionOptions {
+	o := electionOptions{grace: DefaultPreemptGrace}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// Candidate 选举中的一个候选人
+type Candidate struct {
+	Key            string
+	Value          string
+	Priority       int
+	CreateRevision int64
+	ModRevision    int64
+	Lease          v3.LeaseID
+}
+
+// TransitionKind leader变化的类型
+type TransitionKind int
+
+const (
+	// TransitionElected 产生了新的leader
+	TransitionElected TransitionKind = iota
+	// TransitionVacant 当前没有leader
+	TransitionVacant
+	// TransitionProclaimed leader 通过 Proclaim 更新了值
+	TransitionProclaimed
+	// TransitionPreemptRequested 更高优先级的候选人将在 Deadline 之后抢占当前的leader
+	TransitionPreemptRequested
+)
+
+// TransitionReason 上一任leader离开的原因
+type TransitionReason string
+
+const (
+	ReasonResigned  TransitionReason = "resigned"
+	ReasonPreempted TransitionReason = "preempted"
+	// ReasonLost session过期,或者没有设置优先级的leader调用了Resign
+	ReasonLost TransitionReason = "lost"
+)
+
+// Transition 描述一次leader变化
+type Transition struct {
+	Kind     TransitionKind
+	Revision int64
+	// Leader 当前的leader, TransitionVacant 时为nil
+	Leader *Candidate
+	// Previous 和 Reason 只在 TransitionElected 和 TransitionVacant 时设置
+	Previous *Candidate
+	Reason   TransitionReason
+	// Challenger 和 Deadline 只在 TransitionPreemptRequested 时设置
+	Challenger *Candidate
+	Deadline   time.Time
+}
+
+// preemptNotice 抢占者在宽限期开始时写入,绑定抢占者的租约
+type preemptNotice struct {
+	Challenger string    `json:"challenger"`
+	Incumbent  string    `json:"incumbent"`
+	Priority   int       `json:"priority"`
+	Deadline   time.Time `json:"deadline"`
+
+	modRev int64
+}
+
+// transitionRecord 和删除leader key在同一个事务中写入,观察者据此区分离开的原因
+type transitionRecord struct {
+	Key    string           `json:"key"`
+	Reason TransitionReason `json:"reason"`
+	By     string           `json:"by,omitempty"`
+
+	modRev int64
+}
+
+type electionState struct {
+	rev    int64
+	cands  []*Candidate // 按 CreateRevision 排序,第一个是leader
+	notice *preemptNotice
+	record *transitionRecord
+}
+
+func (st *electionState) leader() *Candidate {
+	if len(st.cands) == 0 {
+		return nil
+	}
+	return st.cands[0]
+}
+
+func (st *electionState) candidate(key string) *Candidate {
+	for _, c := range st.cands {
+		if c.Key == key {
+			return c
+		}
+	}
+	return nil
+}
+
+// 元数据保存在 <pfx>@ 下,不在候选人的前缀中,不影响 Leader 和 Observe
+func (e *Election) basePrefix() string     { return strings.TrimSuffix(e.keyPrefix, "/") }
+func (e *Election) priorityPrefix() string { return e.basePrefix() + "@priority/" }
+func (e *Election) preemptKey() string     { return e.basePrefix() + "@preempt" }
+func (e *Election) transitionKey() string  { return e.basePrefix() + "@transition" }
+func (e *Election) priorityKey(k string) string {
+	return e.priorityPrefix() + strings.TrimPrefix(k, e.keyPrefix)
+}
+
+// resignOps 优先级模式下 Resign 额外执行的操作
+func (e *Election) resignOps() []v3.Op {
+	rec, _ := json.Marshal(&transitionRecord{Key: e.leaderKey, Reason: ReasonResigned})
+	return []v3.Op{v3.OpDelete(e.priorityKey(e.leaderKey)), v3.OpPut(e.transitionKey(), string(rec))}
+}
+
+// state 读取rev时的选举状态,rev为0时读取最新的状态
+func (e *Election) state(ctx context.Context, rev int64) (*electionState, error) {
+	client := e.session.Client()
+	resp, err := client.Txn(ctx).Then(
+		v3.OpGet(e.keyPrefix, v3.WithPrefix(), v3.WithSort(v3.SortByCreateRevision, v3.SortAscend), v3.WithRev(rev)),
+		v3.OpGet(e.priorityPrefix(), v3.WithPrefix(), v3.WithRev(rev)),
+		v3.OpGet(e.preemptKey(), v3.WithRev(rev)),
+		v3.OpGet(e.transitionKey(), v3.WithRev(rev)),
+	).Commit()
+	if err != nil {
+		return nil, err
+	}
+	st := &electionState{rev: resp.Header.Revision}
+	if rev != 0 {
+		st.rev = rev
+	}
+	prios := make(map[string]int)
+	for _, kv := range resp.Responses[1].GetResponseRange().Kvs {
+		p, perr := strconv.Atoi(kv.Value)
+		if perr != nil {
+			return nil, fmt.Errorf("election: invalid priority %q: %v", kv.Key, perr)
+		}
+		prios[strings.TrimPrefix(kv.Key, e.priorityPrefix())] = p
+	}
+	for _, kv := range resp.Responses[0].GetResponseRange().Kvs {
+		st.cands = append(st.cands, &Candidate{
+			Key:            kv.Key,
+			Value:          kv.Value,
+			Priority:       prios[strings.TrimPrefix(kv.Key, e.keyPrefix)],
+			CreateRevision: kv.CreateRevision,
+			ModRevision:    kv.ModRevision,
+			Lease:          v3.LeaseID(kv.Lease),
+		})
+	}
+	if kvs := resp.Responses[2].GetResponseRange().Kvs; len(kvs) > 0 {
+		n := &preemptNotice{modRev: kvs[0].ModRevision}
+		if err = json.Unmarshal([]byte(kvs[0].Value), n); err != nil {
+			return nil, err
+		}
+		st.notice = n
+	}
+	if kvs := resp.Responses[3].GetResponseRange().Kvs; len(kvs) > 0 {
+		r := &transitionRecord{modRev: kvs[0].ModRevision}
+		if err = json.Unmarshal([]byte(kvs[0].Value), r); err != nil {
+			return nil, err
+		}
+		st.record = r
+	}
+	return st, nil
+}
+
+// campaignPriority 按优先级参与选举.
+// 候选人仍按 CreateRevision 排队,因此 Leader 和 Observe 的语义不变; 在此之上:
+//   - 排在前面的候选人发现后面有更高优先级的候选人时让出位置,重新排到队尾;
+//   - 优先级最高且排在最前的等待者,在当前leader优先级更低时写入抢占通知,
+//     宽限期过后删除leader的key.leader可以通过 ObserveTransitions 收到通知并主动 Resign.
+func (e *Election) campaignPriority(ctx context.Context, val string) error {
+	s := e.session
+	client := s.Client()
+	k := fmt.Sprintf("%s%x", e.keyPrefix, s.Lease())
+	prio := strconv.Itoa(e.opts.priority)
+
+	for {
+		txn := client.Txn(ctx).If(v3.Compare(v3.CreateRevision(k), "=", 0))
+		txn = txn.Then(v3.OpPut(k, val, v3.WithLease(s.Lease())), v3.OpPut(e.priorityKey(k), prio, v3.WithLease(s.Lease())))
+		txn = txn.Else(v3.OpGet(k), v3.OpPut(e.priorityKey(k), prio, v3.WithLease(s.Lease())))
+		resp, err := txn.Commit()
+		if err != nil {
+			return err
+		}
+		e.leaderKey, e.leaderRev, e.leaderSession = k, resp.Header.Revision, s
+		if !resp.Succeeded {
+			kv := resp.Responses[0].GetResponseRange().Kvs[0]
+			e.leaderRev = kv.CreateRevision
+			if kv.Value != val {
+				if err = e.Proclaim(ctx, val); err != nil {
+					e.Resign(ctx)
+					return err
+				}
+			}
+		}
+
+		won, err := e.waitTurn(ctx)
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				e.Resign(client.Ctx())
+			default:
+				e.leaderSession = nil
+			}
+			return err
+		}
+		if won {
+			return nil
+		}
+		// 已经让出位置,重新排队
+	}
+}
+
+// waitTurn 等待成为leader; 返回false表示自己的key已经被删除,需要重新排队
+func (e *Election) waitTurn(ctx context.Context) (bool, error) {
+	client := e.session.Client()
+	for {
+		st, err := e.state(ctx, 0)
+		if err != nil {
+			return false, err
+		}
+		idx := -1
+		for i, c := range st.cands {
+			if c.Key == e.leaderKey && c.CreateRevision == e.leaderRev {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			return false, nil
+		}
+		me := st.cands[idx]
+		yield := false
+		for _, c := range st.cands[idx+1:] {
+			if c.Priority > me.Priority {
+				yield = true
+				break
+			}
+		}
+		if yield {
+			cmp := v3.Compare(v3.CreateRevision(me.Key), "=", me.CreateRevision)
+			if _, err = client.Txn(ctx).If(cmp).Then(v3.OpDelete(me.Key)).Commit(); err != nil {
+				return false, err
+			}
+			return false, nil
+		}
+		if idx == 0 {
+			e.hdr = &pb.ResponseHeader{Revision: st.rev}
+			return true, nil
+		}
+
+		// 只有排在前面的都比自己优先级低时才抢占;否则由它们去抢占
+		preempt := true
+		for _, c := range st.cands[:idx] {
+			if c.Priority >= me.Priority {
+				preempt = false
+				break
+			}
+		}
+		if !preempt {
+			if err = e.waitChange(ctx, st.rev+1, 0); err != nil {
+				return false, err
+			}
+			continue
+		}
+		leader := st.leader()
+		n := st.notice
+		if n == nil || n.Challenger != me.Key || n.Incumbent != leader.Key {
+			n = &preemptNotice{Challenger: me.Key, Incumbent: leader.Key, Priority: me.Priority, Deadline: time.Now().Add(e.opts.grace)}
+			data, err := json.Marshal(n)
+			if err != nil {
+				return false, err
+			}
+			presp, err := client.Put(ctx, e.preemptKey(), string(data), v3.WithLease(e.session.Lease()))
+			if err != nil {
+				return false, err
+			}
+			st.rev = presp.Header.Revision
+		}
+		if wait := time.Until(n.Deadline); wait > 0 {
+			if err = e.waitChange(ctx, st.rev+1, wait); err != nil {
+				return false, err
+			}
+			continue
+		}
+		rec, _ := json.Marshal(&transitionRecord{Key: leader.Key, Reason: ReasonPreempted, By: me.Key})
+		cmp := v3.Compare(v3.CreateRevision(leader.Key), "=", leader.CreateRevision)
+		_, err = client.Txn(ctx).If(cmp).Then(
+			v3.OpDelete(leader.Key),
+			v3.OpDelete(e.priorityKey(leader.Key)),
+			v3.OpDelete(e.preemptKey()),
+			v3.OpPut(e.transitionKey(), string(rec)),
+		).Commit()
+		if err != nil {
+			return false, err
+		}
+	}
+}
+
+// waitChange 等待选举状态从rev开始发生变化,d>0时最多等待d
+func (e *Election) waitChange(ctx context.Context, rev int64, d time.Duration) error {
+	wctx, cancel := context.WithCancel(ctx)
+	if d > 0 {
+		cancel()
+		wctx, cancel = context.WithTimeout(ctx, d)
+	}
+	defer cancel()
+	wch := e.session.Client().Watch(wctx, e.basePrefix(), v3.WithPrefix(), v3.WithRev(rev))
+	for wr := range wch {
+		if err := wr.Err(); err != nil {
+			return err
+		}
+		if len(wr.Events) > 0 {
+			return nil
+		}
+	}
+	return ctx.Err()
+}
+
+// ObserveTransitions 返回一个通道,按revision顺序发送leader的变化,包括离开的原因和抢占通知.
+// 第一个 Transition 描述当前的状态.出错或ctx结束时关闭通道.
+func (e *Election) ObserveTransitions(ctx context.Context) <-chan Transition {
+	ch := make(chan Transition)
+	go e.observeTransitions(ctx, ch)
+	return ch
+}
+
+func (e *Election) observeTransitions(ctx context.Context, ch chan<- Transition) {
+	defer close(ch)
+	send := func(t Transition) bool {
+		select {
+		case ch <- t:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	prev, err := e.state(ctx, 0)
+	if err != nil {
+		return
+	}
+	t := Transition{Kind: TransitionVacant, Revision: prev.rev, Leader: prev.leader()}
+	if t.Leader != nil {
+		t.Kind = TransitionElected
+	}
+	if !send(t) {
+		return
+	}
+
+	cctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	wch := e.session.Client().Watch(cctx, e.basePrefix(), v3.WithPrefix(), v3.WithRev(prev.rev+1))
+	for wr := range wch {
+		if wr.Err() != nil {
+			return
+		}
+		// 一个响应中可能包含多个revision,逐个revision比较
+		var revs []int64
+		for _, ev := range wr.Events {
+			if r := ev.Kv.ModRevision; len(revs) == 0 || revs[len(revs)-1] != r {
+				revs = append(revs, r)
+			}
+		}
+		for _, rev := range revs {
+			cur, err := e.state(ctx, rev)
+			if err != nil {
+				return
+			}
+			for _, t := range diffTransitions(prev, cur) {
+				if !send(t) {
+					return
+				}
+			}
+			prev = cur
+		}
+	}
+}
+
+func diffTransitions(prev, cur *electionState) []Transition {
+	var ts []Transition
+	pl, cl := prev.leader(), cur.leader()
+	switch {
+	case !sameCandidate(pl, cl):
+		t := Transition{Kind: TransitionVacant, Revision: cur.rev, Leader: cl, Previous: pl}
+		if cl != nil {
+			t.Kind = TransitionElected
+		}
+		if pl != nil {
+			t.Reason = ReasonLost
+			if r := cur.record; r != nil && r.modRev == cur.rev && r.Key == pl.Key {
+				t.Reason = r.Reason
+			}
+		}
+		ts = append(ts, t)
+	case cl != nil && cl.ModRevision != pl.ModRevision:
+		ts = append(ts, Transition{Kind: TransitionProclaimed, Revision: cur.rev, Leader: cl})
+	}
+	if n := cur.notice; n != nil && n.modRev == cur.rev && cl != nil && n.Incumbent == cl.Key {
+		ts = append(ts, Transition{
+			Kind:       TransitionPreemptRequested,
+			Revision:   cur.rev,
+			Leader:     cl,
+			Challenger: cur.candidate(n.Challenger),
+			Deadline:   n.Deadline,
+		})
+	}
+	return ts
+}
+
+func sameCandidate(a, b *Candidate) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Key == b.Key && a.CreateRevision == b.CreateRevision
+}
@@ -0,0 +1,183 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package concurrency
+
+import (
+	"context"
+	"fmt"
+
+	v3 "github.com/ls-2018/etcd_cn/client_sdk/v3"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+)
+
+const (
+	rwReadValue  = "read"
+	rwWriteValue = "write"
+)
+
+// RWMutex 读写锁.每个持有者或等待者在前缀下写入一个带session租约的key,值标明读或写;
+// 按key的CreateRevision先来先得:写锁等待之前的所有key删除,读锁只等待之前的写锁删除,
+// 所以排在写锁后面的读锁不会插队,写锁不会饿死.同一个session对同一个RWMutex同时只能持有一把锁
+type RWMutex struct {
+	s *Session
+
+	pfx   string
+	myKey string
+	myRev int64
+	hdr   *pb.ResponseHeader
+}
+
+func NewRWMutex(s *Session, pfx string) *RWMutex {
+	return &RWMutex{s: s, pfx: pfx + "/", myKey: "", myRev: -1}
+}
+
+// RLock 获取读锁,之前排队的写锁都释放后返回
+func (rw *RWMutex) RLock(ctx context.Context) error {
+	return rw.lock(ctx, rwReadValue, false)
+}
+
+// Lock 获取写锁,之前排队的读锁和写锁都释放后返回
+func (rw *RWMutex) Lock(ctx context.Context) error {
+	return rw.lock(ctx, rwWriteValue, false)
+}
+
+// TryRLock 不能立即获得读锁时清理自己的key并返回 ErrLocked
+func (rw *RWMutex) TryRLock(ctx context.Context) error {
+	return rw.lock(ctx, rwReadValue, true)
+}
+
+// TryLock 不能立即获得写锁时清理自己的key并返回 ErrLocked
+func (rw *RWMutex) TryLock(ctx context.Context) error {
+	return rw.lock(ctx, rwWriteValue, true)
+}
+
+func (rw *RWMutex) lock(ctx context.Context, val string, try bool) error {
+	client := rw.s.Client()
+	rw.myKey = fmt.Sprintf("%s%x", rw.pfx, rw.s.Lease())
+	rev, hdr, err := acquireKey(ctx, rw.s, rw.myKey, val)
+	if err != nil {
+		return err
+	}
+	rw.myRev = rev
+
+	blocker, err := rw.blocker(ctx, val)
+	if err != nil {
+		return err
+	}
+	if blocker == nil {
+		rw.hdr = hdr
+		return nil
+	}
+	if try {
+		if _, err := client.Delete(ctx, rw.myKey); err != nil {
+			return err
+		}
+		rw.myKey = "\x00"
+		rw.myRev = -1
+		return ErrLocked
+	}
+
+	for blocker != nil {
+		if err = waitDelete(ctx, client, blocker.key, blocker.rev); err == nil {
+			blocker, err = rw.blocker(ctx, val)
+		}
+		if err != nil {
+			// 等待失败时释放自己的key
+			rw.Unlock(client.Ctx())
+			return err
+		}
+	}
+
+	// 确认session没有过期,自己的key还在
+	gresp, err := client.Get(ctx, rw.myKey)
+	if err != nil {
+		rw.Unlock(client.Ctx())
+		return err
+	}
+	if len(gresp.Kvs) == 0 {
+		return ErrSessionExpired
+	}
+	rw.hdr = gresp.Header
+	return nil
+}
+
+type blockingKey struct {
+	key string
+	rev int64 // 开始监听删除的revision
+}
+
+// blocker 返回排在自己前面、阻止自己获得锁的最后一个key;没有时返回nil
+func (rw *RWMutex) blocker(ctx context.Context, val string) (*blockingKey, error) {
+	client := rw.s.Client()
+	opts := append(v3.WithLastCreate(), v3.WithMaxCreateRev(rw.myRev-1))
+	if val == rwReadValue {
+		// 读锁只被写锁阻塞,需要看前面所有的key
+		opts = []v3.OpOption{v3.WithPrefix(), v3.WithSort(v3.SortByCreateRevision, v3.SortDescend), v3.WithMaxCreateRev(rw.myRev - 1)}
+	}
+	resp, err := client.Get(ctx, rw.pfx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	for _, kv := range resp.Kvs {
+		if val == rwWriteValue || kv.Value == rwWriteValue {
+			return &blockingKey{key: kv.Key, rev: resp.Header.Revision}, nil
+		}
+	}
+	return nil, nil
+}
+
+// Unlock 释放读锁或写锁
+func (rw *RWMutex) Unlock(ctx context.Context) error {
+	client := rw.s.Client()
+	if _, err := client.Delete(ctx, rw.myKey); err != nil {
+		return err
+	}
+	rw.myKey = "\x00"
+	rw.myRev = -1
+	return nil
+}
+
+// RUnlock 释放读锁,和 Unlock 相同
+func (rw *RWMutex) RUnlock(ctx context.Context) error {
+	return rw.Unlock(ctx)
+}
+
+// IsOwner 用于在事务中确认仍然持有锁
+func (rw *RWMutex) IsOwner() v3.Cmp {
+	return v3.Compare(v3.CreateRevision(rw.myKey), "=", rw.myRev)
+}
+
+func (rw *RWMutex) Key() string { return rw.myKey }
+
+// FencingToken 锁key的CreateRevision,参考 Mutex.FencingToken
+func (rw *RWMutex) FencingToken() int64 { return rw.myRev }
+
+// Header is the response header received from etcd on acquiring the lock.
+func (rw *RWMutex) Header() *pb.ResponseHeader { return rw.hdr }
+
+// acquireKey 用session租约创建key,已经存在时(同一个session重入)复用它;返回key的CreateRevision
+func acquireKey(ctx context.Context, s *Session, key, val string) (int64, *pb.ResponseHeader, error) {
+	cmp := v3.Compare(v3.CreateRevision(key), "=", 0)
+	put := v3.OpPut(key, val, v3.WithLease(s.Lease()))
+	get := v3.OpGet(key)
+	resp, err := s.Client().Txn(ctx).If(cmp).Then(put).Else(get).Commit()
+	if err != nil {
+		return 0, nil, err
+	}
+	if !resp.Succeeded {
+		return resp.Responses[0].GetResponseRange().Kvs[0].CreateRevision, resp.Header, nil
+	}
+	return resp.Header.Revision, resp.Header, nil
+}
@@ -0,0 +1,151 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	v3 "github.com/ls-2018/etcd_cn/client_sdk/v3"
+	"github.com/ls-2018/etcd_cn/offical/api/v3/mvccpb"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+)
+
+// ErrNoPermits is returned by TryAcquire when all permits of the semaphore are held.
+var ErrNoPermits = errors.New("semaphore: no permits available")
+
+// Semaphore 计数信号量,最多允许n个session同时持有.每个持有者或等待者在前缀下写入一个带session租约的key,
+// 按key的CreateRevision先来先得,排在前n个的持有信号量.所有使用同一前缀的客户端需要使用相同的n
+type Semaphore struct {
+	s *Session
+	n int
+
+	pfx   string
+	myKey string
+	myRev int64
+	hdr   *pb.ResponseHeader
+}
+
+func NewSemaphore(s *Session, pfx string, n int) *Semaphore {
+	return &Semaphore{s: s, n: n, pfx: pfx + "/", myKey: "", myRev: -1}
+}
+
+// Acquire 获取一个许可,排在前面的持有者少于n个时返回
+func (sm *Semaphore) Acquire(ctx context.Context) error {
+	return sm.acquire(ctx, false)
+}
+
+// TryAcquire 不能立即获得许可时清理自己的key并返回 ErrNoPermits
+func (sm *Semaphore) TryAcquire(ctx context.Context) error {
+	return sm.acquire(ctx, true)
+}
+
+func (sm *Semaphore) acquire(ctx context.Context, try bool) error {
+	if sm.n <= 0 {
+		return fmt.Errorf("semaphore: invalid permits %d", sm.n)
+	}
+	client := sm.s.Client()
+	sm.myKey = fmt.Sprintf("%s%x", sm.pfx, sm.s.Lease())
+	rev, _, err := acquireKey(ctx, sm.s, sm.myKey, "")
+	if err != nil {
+		return err
+	}
+	sm.myRev = rev
+
+	for {
+		// 排在自己前面的key数量
+		resp, err := client.Get(ctx, sm.pfx, v3.WithPrefix(), v3.WithMaxCreateRev(sm.myRev-1), v3.WithCountOnly())
+		if err != nil {
+			sm.Release(client.Ctx())
+			return err
+		}
+		if resp.Count < int64(sm.n) {
+			break
+		}
+		if try {
+			if _, err := client.Delete(ctx, sm.myKey); err != nil {
+				return err
+			}
+			sm.myKey = "\x00"
+			sm.myRev = -1
+			return ErrNoPermits
+		}
+		// 等待前缀下任意key被删除后重新计数
+		if err = waitPrefixDelete(ctx, client, sm.pfx, resp.Header.Revision+1); err != nil {
+			sm.Release(client.Ctx())
+			return err
+		}
+	}
+
+	// 确认session没有过期,自己的key还在
+	gresp, err := client.Get(ctx, sm.myKey)
+	if err != nil {
+		sm.Release(client.Ctx())
+		return err
+	}
+	if len(gresp.Kvs) == 0 {
+		return ErrSessionExpired
+	}
+	sm.hdr = gresp.Header
+	return nil
+}
+
+// Release 释放许可
+func (sm *Semaphore) Release(ctx context.Context) error {
+	client := sm.s.Client()
+	if _, err := client.Delete(ctx, sm.myKey); err != nil {
+		return err
+	}
+	sm.myKey = "\x00"
+	sm.myRev = -1
+	return nil
+}
+
+// IsOwner 用于在事务中确认仍然持有许可
+func (sm *Semaphore) IsOwner() v3.Cmp {
+	return v3.Compare(v3.CreateRevision(sm.myKey), "=", sm.myRev)
+}
+
+func (sm *Semaphore) Key() string { return sm.myKey }
+
+// FencingToken 许可key的CreateRevision,参考 Mutex.FencingToken
+func (sm *Semaphore) FencingToken() int64 { return sm.myRev }
+
+// Header is the response header received from etcd on acquiring the permit.
+func (sm *Semaphore) Header() *pb.ResponseHeader { return sm.hdr }
+
+// waitPrefixDelete 从rev开始等待前缀下的任意一个删除事件
+func waitPrefixDelete(ctx context.Context, client *v3.Client, pfx string, rev int64) error {
+	cctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wr v3.WatchResponse
+	wch := client.Watch(cctx, pfx, v3.WithPrefix(), v3.WithRev(rev), v3.WithFilterPut())
+	for wr = range wch {
+		for _, ev := range wr.Events {
+			if ev.Type == mvccpb.DELETE {
+				return nil
+			}
+		}
+	}
+	if err := wr.Err(); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("lost watcher waiting for delete")
+}
@@ -16,6 +16,7 @@ package concurrency
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	v3 "github.com/ls-2018/etcd_cn/client_sdk/v3"
@@ -30,7 +31,11 @@ const defaultSessionTTL = 60
 type Session struct {
 	client *v3.Client
 	opts   *sessionOptions
-	id     v3.LeaseID
+
+	mu         sync.Mutex
+	id         v3.LeaseID
+	state      SessionState
+	ephemerals []EphemeralFunc
 
 	cancel context.CancelFunc
 	donec  <-chan struct{}
@@ -65,12 +70,7 @@ func NewSession(client *v3.Client, opts ...SessionOption) (*Session, error) {
 	s := &Session{client: client, opts: ops, id: id, cancel: cancel, donec: donec}
 
 	// 在客户端错误或取消上下文之前保持租约的活动状态
-	go func() {
-		defer close(donec)
-		for range keepAlive {
-			// 在保持活动频道关闭前接收信息
-		}
-	}()
+	go s.run(ctx, keepAlive, donec)
 
 	return s, nil
 	// 1、多个请求来前抢占锁,通过Revision来判断锁的先后顺序;
@@ -84,11 +84,17 @@ func (s *Session) Client() *v3.Client {
 	return s.client
 }
 
-// Lease is the lease ID for keys bound to the session.
-func (s *Session) Lease() v3.LeaseID { return s.id }
+// Lease is the lease ID for keys bound to the session. It changes when a
+// session created WithResurrect replaces a lost lease.
+func (s *Session) Lease() v3.LeaseID {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.id
+}
 
 // Done returns a channel that closes when the lease is orphaned, expires, or
-// is otherwise no longer being refreshed.
+// is otherwise no longer being refreshed. With WithResurrect it only closes
+// once the session is orphaned or its context is canceled.
 func (s *Session) Done() <-chan struct{} { return s.donec }
 
 // Orphan ends the refresh for the session lease. This is useful
@@ -104,7 +110,7 @@ func (s *Session) Close() error {
 	s.Orphan()
 	// if revoke takes longer than the ttl, lease is expired anyway
 	ctx, cancel := context.WithTimeout(s.opts.ctx, time.Duration(s.opts.ttl)*time.Second)
-	_, err := s.client.Revoke(ctx, s.id)
+	_, err := s.client.Revoke(ctx, s.Lease())
 	cancel()
 	return err
 }
@@ -113,6 +119,10 @@ type sessionOptions struct {
 	ttl     int
 	leaseID v3.LeaseID
 	ctx     context.Context
+
+	resurrect     bool
+	retryInterval time.Duration
+	onState       func(SessionState)
 }
 
 // SessionOption configures Session.
@@ -147,3 +157,25 @@ func WithContext(ctx context.Context) SessionOption {
 		so.ctx = ctx
 	}
 }
+
+// WithResurrect makes the session grant a new lease when its lease is lost,
+// for example after a network partition longer than the TTL, and then call
+// the functions registered with RegisterEphemeral to re-create its keys.
+// Failed attempts are retried after retryInterval, doubling up to the TTL;
+// retryInterval <= 0 means one second.
+//
+// Locks and elections held through the old lease are not re-acquired.
+func WithResurrect(retryInterval time.Duration) SessionOption {
+	return func(so *sessionOptions) {
+		so.resurrect = true
+		so.retryInterval = retryInterval
+	}
+}
+
+// WithStateCallback calls f on every session state change. Calls are made
+// in order from the session's keepalive goroutine and should not block.
+func WithStateCallback(f func(SessionState)) SessionOption {
+	return func(so *sessionOptions) {
+		so.onState = f
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package concurrency
+
+import (
+	"context"
+	"time"
+
+	v3 "github.com/ls-2018/etcd_cn/client_sdk/v3"
+)
+
+// SessionState is the health of a session's lease as seen by the client.
+type SessionState int
+
+const (
+	// SessionHealthy means keepalives are being acknowledged.
+	SessionHealthy SessionState = iota
+	// SessionDegraded means no keepalive has been acknowledged for half the
+	// TTL; the lease may expire soon.
+	SessionDegraded
+	// SessionLost means the lease expired or was revoked. All keys attached
+	// to it are gone.
+	SessionLost
+	// SessionRecovered means a new lease was granted after SessionLost and
+	// all ephemeral keys were re-created. It is a healthy state.
+	SessionRecovered
+)
+
+func (st SessionState) String() string {
+	switch st {
+	case SessionHealthy:
+		return "healthy"
+	case SessionDegraded:
+		return "degraded"
+	case SessionLost:
+		return "lost"
+	case SessionRecovered:
+		return "recovered"
+	}
+	return "unknown"
+}
+
+// EphemeralFunc re-creates keys bound to a session after it replaced its
+// lost lease. It must be idempotent.
+type EphemeralFunc func(ctx context.Context, lease v3.LeaseID) error
+
+// State returns the current session state.
+func (s *Session) State() SessionState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+// RegisterEphemeral registers f to run after the session replaces a lost
+// lease. It only has an effect for sessions created WithResurrect.
+func (s *Session) RegisterEphemeral(f EphemeralFunc) {
+	s.mu.Lock()
+	s.ephemerals = append(s.ephemerals, f)
+	s.mu.Unlock()
+}
+
+// PutEphemeral puts key bound to the session lease and registers it to be
+// put again whenever the lease is replaced.
+func (s *Session) PutEphemeral(ctx context.Context, key, val string) error {
+	put := func(ctx context.Context, lease v3.LeaseID) error {
+		_, err := s.client.Put(ctx, key, val, v3.WithLease(lease))
+		return err
+	}
+	if err := put(ctx, s.Lease()); err != nil {
+		return err
+	}
+	s.RegisterEphemeral(put)
+	return nil
+}
+
+func (s *Session) setState(st SessionState) {
+	s.mu.Lock()
+	changed := s.state != st
+	s.state = st
+	s.mu.Unlock()
+	if changed && s.opts.onState != nil {
+		s.opts.onState(st)
+	}
+}
+
+// run 续约租约,租约丢失后按配置重新创建
+func (s *Session) run(ctx context.Context, keepAlive <-chan *v3.LeaseKeepAliveResponse, donec chan struct{}) {
+	defer close(donec)
+	for {
+		s.keepAlive(ctx, keepAlive)
+		if ctx.Err() != nil {
+			return
+		}
+		s.setState(SessionLost)
+		if !s.opts.resurrect {
+			return
+		}
+		if keepAlive = s.resurrect(ctx); keepAlive == nil {
+			return
+		}
+		s.setState(SessionRecovered)
+	}
+}
+
+// keepAlive 接收续约响应直到租约丢失;长时间没有响应时标记为Degraded
+func (s *Session) keepAlive(ctx context.Context, keepAlive <-chan *v3.LeaseKeepAliveResponse) {
+	ttl := time.Duration(s.opts.ttl) * time.Second
+	ticker := time.NewTicker(ttl / 4)
+	defer ticker.Stop()
+	last := time.Now()
+	for {
+		select {
+		case _, ok := <-keepAlive:
+			if !ok {
+				return
+			}
+			last = time.Now()
+			if s.State() == SessionDegraded {
+				s.setState(SessionHealthy)
+			}
+		case <-ticker.C:
+			if time.Since(last) > ttl/2 && s.State() != SessionDegraded {
+				s.setState(SessionDegraded)
+			}
+		case <-ctx.Done():
+			// 等待 keepAlive 关闭,保证返回后不再使用
+			for range keepAlive {
+			}
+			return
+		}
+	}
+}
+
+// resurrect 重新创建租约和临时key,直到成功或ctx结束
+func (s *Session) resurrect(ctx context.Context) <-chan *v3.LeaseKeepAliveResponse {
+	interval := s.opts.retryInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	maxInterval := time.Duration(s.opts.ttl) * time.Second
+	for {
+		if keepAlive, err := s.renewLease(ctx); err == nil {
+			return keepAlive
+		}
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return nil
+		}
+		if interval *= 2; interval > maxInterval {
+			interval = maxInterval
+		}
+	}
+}
+
+func (s *Session) renewLease(ctx context.Context) (<-chan *v3.LeaseKeepAliveResponse, error) {
+	resp, err := s.client.Grant(ctx, int64(s.opts.ttl))
+	if err != nil {
+		return nil, err
+	}
+	keepAlive, err := s.client.KeepAlive(ctx, resp.ID)
+	if err == nil {
+		s.mu.Lock()
+		ephemerals := append([]EphemeralFunc(nil), s.ephemerals...)
+		s.mu.Unlock()
+		for _, f := range ephemerals {
+			if err = f(ctx, resp.ID); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		// 放弃这个租约,下次重新开始;撤销后 keepAlive 会关闭
+		rctx, cancel := context.WithTimeout(ctx, time.Duration(s.opts.ttl)*time.Second)
+		s.client.Revoke(rctx, resp.ID)
+		cancel()
+		return nil, err
+	}
+	s.mu.Lock()
+	s.id = resp.ID
+	s.mu.Unlock()
+	return keepAlive, nil
+}
@@ -16,11 +16,18 @@ package concurrency
 
 import (
 	"context"
+	"errors"
 	"math"
+	"sort"
+	"time"
 
 	v3 "github.com/ls-2018/etcd_cn/client_sdk/v3"
+	"github.com/ls-2018/etcd_cn/offical/api/v3/mvccpb"
 )
 
+// ErrSTMRetriesExceeded is returned when the transaction keeps conflicting after WithMaxRetries retries.
+var ErrSTMRetriesExceeded = errors.New("stm: too many conflicting retries")
+
 // STM is an interface for software transactional memory.
 type STM interface {
 	// Get returns the value for a key and inserts the key in the txn's read set.
@@ -32,6 +39,13 @@ type STM interface {
 	Rev(key string) int64
 	// Del deletes a key.
 	Del(key string)
+	// Range returns the key-value pairs in [key, end), including the txn's own writes,
+	// and inserts the whole range in the txn's read set: any write to the range by
+	// another client, including creating or deleting keys, conflicts with the txn.
+	// Every key read by a range adds a comparison to the commit txn, so large ranges
+	// are limited by the etcd's --max-txn-ops.
+	// If Range fails, it aborts the transaction with an error, never returning.
+	Range(key, end string) []*mvccpb.KeyValue
 
 	// commit attempts to apply the txn's changes to the etcd.
 	commit() *v3.TxnResponse
@@ -60,9 +74,21 @@ const (
 type stmError struct{ err error }
 
 type stmOptions struct {
-	iso      Isolation
-	ctx      context.Context
-	prefetch []string
+	iso        Isolation
+	ctx        context.Context
+	prefetch   []string
+	maxRetries int
+	hooks      STMHooks
+}
+
+// STMHooks observes transaction attempts, e.g. to export metrics. Nil hooks are skipped.
+type STMHooks struct {
+	// OnConflict is called when a commit fails because of a conflict; attempt starts at 1.
+	OnConflict func(attempt int)
+	// OnCommit is called after a successful commit with the number of attempts and the total time taken.
+	OnCommit func(attempts int, took time.Duration)
+	// OnAbort is called when apply or a request fails, or the retries are exhausted.
+	OnAbort func(attempts int, err error)
 }
 
 type stmOption func(*stmOptions)
@@ -85,6 +111,18 @@ func WithPrefetch(keys ...string) stmOption {
 	return func(so *stmOptions) { so.prefetch = append(so.prefetch, keys...) }
 }
 
+// WithMaxRetries limits how many times a conflicting transaction is retried before
+// NewSTM gives up with ErrSTMRetriesExceeded. Zero, the default, retries until the
+// transaction commits or the abort context is done.
+func WithMaxRetries(n int) stmOption {
+	return func(so *stmOptions) { so.maxRetries = n }
+}
+
+// WithHooks sets callbacks observing the transaction attempts.
+func WithHooks(h STMHooks) stmOption {
+	return func(so *stmOptions) { so.hooks = h }
+}
+
 // NewSTM initiates a new STM instance, using serializable snapshot isolation by default.
 func NewSTM(c *v3.Client, apply func(STM) error, so ...stmOption) (*v3.TxnResponse, error) {
 	opts := &stmOptions{ctx: c.Ctx()}
@@ -98,7 +136,7 @@ func NewSTM(c *v3.Client, apply func(STM) error, so ...stmOption) (*v3.TxnRespon
 			return f(s)
 		}
 	}
-	return runSTM(mkSTM(c, opts), apply)
+	return runSTM(mkSTM(c, opts), apply, opts)
 }
 
 func mkSTM(c *v3.Client, opts *stmOptions) STM {
@@ -109,7 +147,7 @@ func mkSTM(c *v3.Client, opts *stmOptions) STM {
 			prefetch: make(map[string]*v3.GetResponse),
 		}
 		s.conflicts = func() []v3.Cmp {
-			return append(s.rset.cmps(), s.wset.cmps(s.rset.first()+1)...)
+			return append(append(s.rset.cmps(), s.ranges.cmps()...), s.wset.cmps(s.firstRev()+1)...)
 		}
 		return s
 	case Serializable:
@@ -117,11 +155,11 @@ func mkSTM(c *v3.Client, opts *stmOptions) STM {
 			stm:      stm{client: c, ctx: opts.ctx},
 			prefetch: make(map[string]*v3.GetResponse),
 		}
-		s.conflicts = func() []v3.Cmp { return s.rset.cmps() }
+		s.conflicts = func() []v3.Cmp { return append(s.rset.cmps(), s.ranges.cmps()...) }
 		return s
 	case RepeatableReads:
 		s := &stm{client: c, ctx: opts.ctx, getOpts: []v3.OpOption{v3.WithSerializable()}}
-		s.conflicts = func() []v3.Cmp { return s.rset.cmps() }
+		s.conflicts = func() []v3.Cmp { return append(s.rset.cmps(), s.ranges.cmps()...) }
 		return s
 	case ReadCommitted:
 		s := &stm{client: c, ctx: opts.ctx, getOpts: []v3.OpOption{v3.WithSerializable()}}
@@ -137,8 +175,10 @@ type stmResponse struct {
 	err  error
 }
 
-func runSTM(s STM, apply func(STM) error) (*v3.TxnResponse, error) {
+func runSTM(s STM, apply func(STM) error, opts *stmOptions) (*v3.TxnResponse, error) {
 	outc := make(chan stmResponse, 1)
+	start := time.Now()
+	attempt := 0
 	go func() {
 		defer func() {
 			if r := recover(); r != nil {
@@ -152,6 +192,11 @@ func runSTM(s STM, apply func(STM) error) (*v3.TxnResponse, error) {
 		}()
 		var out stmResponse
 		for {
+			if opts.maxRetries > 0 && attempt > opts.maxRetries {
+				out.err = ErrSTMRetriesExceeded
+				break
+			}
+			attempt++
 			s.reset()
 			if out.err = apply(s); out.err != nil {
 				break
@@ -159,10 +204,20 @@ func runSTM(s STM, apply func(STM) error) (*v3.TxnResponse, error) {
 			if out.resp = s.commit(); out.resp != nil {
 				break
 			}
+			if h := opts.hooks.OnConflict; h != nil {
+				h(attempt)
+			}
 		}
 		outc <- out
 	}()
 	r := <-outc
+	if r.err != nil {
+		if h := opts.hooks.OnAbort; h != nil {
+			h(attempt, r.err)
+		}
+	} else if h := opts.hooks.OnCommit; h != nil {
+		h(attempt, time.Since(start))
+	}
 	return r.resp, r.err
 }
 
@@ -174,6 +229,8 @@ type stm struct {
 	rset readSet
 	// wset holds overwritten keys and their values
 	wset writeSet
+	// ranges holds the ranges read by Range
+	ranges rangeSet
 	// getOpts are the opts used for gets
 	getOpts []v3.OpOption
 	// conflicts computes the current conflicts on the txn
@@ -213,6 +270,52 @@ func (rs readSet) cmps() []v3.Cmp {
 	return cmps
 }
 
+type rangeKey struct{ key, end string }
+
+type rangeRead struct {
+	resp *v3.GetResponse
+	// rev is the revision the range was read at
+	rev int64
+}
+
+type rangeSet map[rangeKey]rangeRead
+
+// first returns the lowest revision the ranges were read at
+func (rs rangeSet) first() int64 {
+	ret := int64(math.MaxInt64 - 1)
+	for _, rr := range rs {
+		if rr.rev < ret {
+			ret = rr.rev
+		}
+	}
+	return ret
+}
+
+// cmps guards the txn from updates to the read ranges: no key in a range may be
+// modified or created after the range's read revision, and every key read must
+// still exist at the same revision, which catches deletions.
+func (rs rangeSet) cmps() []v3.Cmp {
+	var cmps []v3.Cmp
+	for rk, rr := range rs {
+		cmps = append(cmps, v3.Compare(v3.ModRevision(rk.key), "<", rr.rev+1).WithRange(rk.end))
+		for _, kv := range rr.resp.Kvs {
+			cmps = append(cmps, v3.Compare(v3.ModRevision(kv.Key), "=", kv.ModRevision))
+		}
+	}
+	return cmps
+}
+
+func inRange(k, key, end string) bool {
+	switch end {
+	case "":
+		return k == key
+	case "\x00":
+		return k >= key
+	default:
+		return k >= key && k < end
+	}
+}
+
 type writeSet map[string]stmPut
 
 func (ws writeSet) get(keys ...string) *stmPut {
@@ -233,6 +336,23 @@ func (ws writeSet) cmps(rev int64) []v3.Cmp {
 	return cmps
 }
 
+// overlay applies the pending writes in [key, end) to the key-values read from etcd
+func (ws writeSet) overlay(key, end string, kvs []*mvccpb.KeyValue) []*mvccpb.KeyValue {
+	ret := make([]*mvccpb.KeyValue, 0, len(kvs))
+	for _, kv := range kvs {
+		if _, ok := ws[kv.Key]; !ok {
+			ret = append(ret, kv)
+		}
+	}
+	for k, wv := range ws {
+		if inRange(k, key, end) && wv.op.IsPut() {
+			ret = append(ret, &mvccpb.KeyValue{Key: k, Value: wv.val})
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Key < ret[j].Key })
+	return ret
+}
+
 // puts is the list of ops for all pending writes
 func (ws writeSet) puts() []v3.Op {
 	puts := make([]v3.Op, 0, len(ws))
@@ -262,6 +382,18 @@ func (s *stm) Rev(key string) int64 {
 	return 0
 }
 
+func (s *stm) Range(key, end string) []*mvccpb.KeyValue {
+	return s.wset.overlay(key, end, s.fetchRange(key, end).Kvs)
+}
+
+// firstRev returns the store revision from the first fetch of a key or a range
+func (s *stm) firstRev() int64 {
+	if rev := s.ranges.first(); rev < s.rset.first() {
+		return rev
+	}
+	return s.rset.first()
+}
+
 func (s *stm) commit() *v3.TxnResponse {
 	txnresp, err := s.client.Txn(s.ctx).If(s.conflicts()...).Then(s.wset.puts()...).Commit()
 	if err != nil {
@@ -292,9 +424,29 @@ func (s *stm) fetch(keys ...string) *v3.GetResponse {
 	return (*v3.GetResponse)(txnresp.Responses[0].GetResponseRange())
 }
 
+func (s *stm) fetchRange(key, end string) *v3.GetResponse {
+	rk := rangeKey{key, end}
+	if rr, ok := s.ranges[rk]; ok {
+		return rr.resp
+	}
+	op := v3.OpGet(key, append([]v3.OpOption{v3.WithRange(end)}, s.getOpts...)...)
+	opresp, err := s.client.Do(s.ctx, op)
+	if err != nil {
+		panic(stmError{err})
+	}
+	resp := opresp.Get()
+	rev := op.Rev()
+	if rev == 0 {
+		rev = resp.Header.Revision
+	}
+	s.ranges[rk] = rangeRead{resp: resp, rev: rev}
+	return resp
+}
+
 func (s *stm) reset() {
 	s.rset = make(map[string]*v3.GetResponse)
 	s.wset = make(map[string]stmPut)
+	s.ranges = make(rangeSet)
 }
 
 type stmSerializable struct {
@@ -306,7 +458,7 @@ func (s *stmSerializable) Get(keys ...string) string {
 	if wv := s.wset.get(keys...); wv != nil {
 		return wv.val
 	}
-	firstRead := len(s.rset) == 0
+	firstRead := len(s.rset) == 0 && len(s.ranges) == 0
 	for _, key := range keys {
 		if resp, ok := s.prefetch[key]; ok {
 			delete(s.prefetch, key)
@@ -324,6 +476,19 @@ func (s *stmSerializable) Get(keys ...string) string {
 	return respToValue(resp)
 }
 
+func (s *stmSerializable) Range(key, end string) []*mvccpb.KeyValue {
+	firstRead := len(s.rset) == 0 && len(s.ranges) == 0
+	resp := s.stm.fetchRange(key, end)
+	if firstRead {
+		// txn's base revision is defined by the first read
+		s.getOpts = []v3.OpOption{
+			v3.WithRev(resp.Header.Revision),
+			v3.WithSerializable(),
+		}
+	}
+	return s.wset.overlay(key, end, resp.Kvs)
+}
+
 func (s *stmSerializable) Rev(key string) int64 {
 	s.Get(key)
 	return s.stm.Rev(key)
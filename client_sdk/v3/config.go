@@ -34,6 +34,7 @@ type Config struct {
 	TLS                  *tls.Config // 客户端sdk证书
 	Username             string      `json:"username"`
 	Password             string      `json:"password"`
+	RefreshToken         string      `json:"refresh-token"`      // 服务端签发的refresh token,设置后可以不保存密码;使用后会轮换,通过 Client.RefreshToken 获取最新的值
 	RejectOldCluster     bool        `json:"reject-old-cluster"` // 是否拒绝老版本服务器
 
 	// DialOptions is a list of dial options for the grpc client (e.g., for interceptors).
@@ -50,5 +51,34 @@ type Config struct {
 	// PermitWithoutStream when set will allow client to send keepalive pings to etcd without any active streams(RPCs).
 	PermitWithoutStream bool `json:"permit-without-stream"`
 
-	// TODO: support custom balancer picker
+	// BatchLeaseKeepAlive makes KeepAlive renew all due leases with one stream message per interval
+	// instead of one message per lease. All servers must support batch keep alive.
+	BatchLeaseKeepAlive bool `json:"batch-lease-keep-alive"`
+
+	// RetryPolicy configures attempts, exponential backoff, per-method overrides and a retry budget
+	// for the client's retry interceptors. Nil keeps the default fixed-interval retries.
+	RetryPolicy *RetryPolicy `json:"retry-policy"`
+
+	// Balancer selects the endpoint load balancing policy. Nil keeps round robin.
+	// The policy can be switched at runtime with Client.SetBalancer.
+	Balancer *BalancerConfig `json:"balancer"`
+
+	// CircuitBreaker stops picking an endpoint after consecutive unavailable or timed out
+	// requests, and lets a single probe request through once OpenTimeout has passed.
+	CircuitBreaker *CircuitBreakerConfig `json:"circuit-breaker"`
+
+	// HedgedReadDelay, when positive, makes serializable Get requests that have not completed
+	// after the delay issue a second request to another endpoint; the first success is used.
+	HedgedReadDelay time.Duration `json:"hedged-read-delay"`
+
+	// PinWritesToLeader sends Put, Delete and Txn requests to the leader hinted by the
+	// leader_client_urls of earlier write responses, saving the forwarding hop through a follower.
+	// The hint is only used when the leader's URL is one of the client's endpoints.
+	PinWritesToLeader bool `json:"pin-writes-to-leader"`
+
+	// Metrics receives request latency, watch event lag and lease keepalive health.
+	Metrics MetricsHook `json:"-"`
+
+	// Tracer wraps each unary request, including its retries, in a span.
+	Tracer TraceHook `json:"-"`
 }
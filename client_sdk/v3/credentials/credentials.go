@@ -22,6 +22,7 @@ import (
 	"net"
 	"sync"
 
+	"github.com/ls-2018/etcd_cn/client_sdk/pkg/transport"
 	"github.com/ls-2018/etcd_cn/offical/api/v3/v3rpc/rpctypes"
 	grpccredentials "google.golang.org/grpc/credentials"
 )
@@ -66,15 +67,21 @@ func (b *bundle) NewWithMode(mode string) (grpccredentials.Bundle, error) {
 // transportCredential implements "grpccredentials.TransportCredentials" interface.
 type transportCredential struct {
 	gtc grpccredentials.TransportCredentials
+	cfg *tls.Config
 }
 
 func newTransportCredential(cfg *tls.Config) *transportCredential {
 	return &transportCredential{
 		gtc: grpccredentials.NewTLS(cfg),
+		cfg: cfg,
 	}
 }
 
 func (tc *transportCredential) ClientHandshake(ctx context.Context, authority string, rawConn net.Conn) (net.Conn, grpccredentials.AuthInfo, error) {
+	// CA文件重新加载后使用新的证书池握手
+	if c := transport.RefreshClientConfig(tc.cfg); c != tc.cfg {
+		return grpccredentials.NewTLS(c).ClientHandshake(ctx, authority, rawConn)
+	}
 	return tc.gtc.ClientHandshake(ctx, authority, rawConn)
 }
 
@@ -89,10 +96,15 @@ func (tc *transportCredential) Info() grpccredentials.ProtocolInfo {
 func (tc *transportCredential) Clone() grpccredentials.TransportCredentials {
 	return &transportCredential{
 		gtc: tc.gtc.Clone(),
+		cfg: tc.cfg,
 	}
 }
 
 func (tc *transportCredential) OverrideServerName(serverNameOverride string) error {
+	if tc.cfg != nil {
+		tc.cfg = tc.cfg.Clone()
+		tc.cfg.ServerName = serverNameOverride
+	}
 	return tc.gtc.OverrideServerName(serverNameOverride)
 }
 
@@ -36,6 +36,72 @@ func WithRequireLeader(ctx context.Context) context.Context {
 	return metadata.NewOutgoingContext(ctx, copied)
 }
 
+// PriorityClass is the caller-declared importance of a request.
+type PriorityClass string
+
+const (
+	PriorityCritical PriorityClass = "critical"
+	PriorityNormal   PriorityClass = "normal"
+	PriorityBatch    PriorityClass = "batch"
+)
+
+// CallerInfo identifies the application issuing a request. Non-empty fields
+// are sent as gRPC metadata and recorded by the server in its slow request
+// log and auth denial audit records.
+type CallerInfo struct {
+	App       string
+	RequestID string
+	Priority  PriorityClass
+}
+
+// WithCallerInfo attaches caller metadata to all requests made with ctx.
+// Empty fields leave any value already set on ctx unchanged.
+func WithCallerInfo(ctx context.Context, ci CallerInfo) context.Context {
+	var kvs []string
+	if ci.App != "" {
+		kvs = append(kvs, rpctypes.MetadataCallerAppKey, ci.App)
+	}
+	if ci.RequestID != "" {
+		kvs = append(kvs, rpctypes.MetadataCallerRequestIDKey, ci.RequestID)
+	}
+	if ci.Priority != "" {
+		kvs = append(kvs, rpctypes.MetadataCallerPriorityKey, string(ci.Priority))
+	}
+	if len(kvs) == 0 {
+		return ctx
+	}
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if !ok {
+		return metadata.NewOutgoingContext(ctx, metadata.Pairs(kvs...))
+	}
+	copied := md.Copy() // avoid racey updates
+	for i := 0; i < len(kvs); i += 2 {
+		copied.Set(kvs[i], kvs[i+1])
+	}
+	return metadata.NewOutgoingContext(ctx, copied)
+}
+
+// WithRequestID is shorthand for WithCallerInfo with only RequestID set.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return WithCallerInfo(ctx, CallerInfo{RequestID: id})
+}
+
+// CallerInfoFromContext returns the caller metadata attached to ctx.
+func CallerInfoFromContext(ctx context.Context) CallerInfo {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	get := func(k string) string {
+		if vs := md.Get(k); len(vs) > 0 {
+			return vs[0]
+		}
+		return ""
+	}
+	return CallerInfo{
+		App:       get(rpctypes.MetadataCallerAppKey),
+		RequestID: get(rpctypes.MetadataCallerRequestIDKey),
+		Priority:  PriorityClass(get(rpctypes.MetadataCallerPriorityKey)),
+	}
+}
+
 // embeds client version
 func withVersion(ctx context.Context) context.Context {
 	md, ok := metadata.FromOutgoingContext(ctx)
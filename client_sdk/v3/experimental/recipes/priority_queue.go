@@ -23,6 +23,9 @@ import (
 )
 
 // PriorityQueue implements a multi-reader, multi-writer distributed queue.
+//
+// Deprecated: use the client_sdk/v3/queue package, which adds consumer
+// ownership, visibility timeouts and dead letters.
 type PriorityQueue struct {
 	client *v3.Client
 	ctx    context.Context
@@ -22,6 +22,8 @@ import (
 )
 
 // Queue implements a multi-reader, multi-writer distributed queue.
+//
+// Deprecated: use the client_sdk/v3/queue package.
 type Queue struct {
 	client *v3.Client
 	ctx    context.Context
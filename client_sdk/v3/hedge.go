@@ -0,0 +1,100 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clientv3
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ls-2018/etcd_cn/client_sdk/v3/internal/balancer"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+)
+
+const defaultCircuitBreakerOpenTimeout = 5 * time.Second
+
+// CircuitBreakerConfig 每个端点的熔断配置
+type CircuitBreakerConfig struct {
+	// FailureThreshold 连续多少次不可用或超时后停止向该端点发送请求
+	FailureThreshold int `json:"failure-threshold"`
+	// OpenTimeout 熔断之后多久放行一个探测请求,默认5s
+	OpenTimeout time.Duration `json:"open-timeout"`
+}
+
+// Validate 检查熔断配置是否有效
+func (cb *CircuitBreakerConfig) Validate() error {
+	if cb.FailureThreshold < 1 {
+		return fmt.Errorf("circuit breaker: failure threshold must be at least 1, got %d", cb.FailureThreshold)
+	}
+	if cb.OpenTimeout < 0 {
+		return fmt.Errorf("circuit breaker: open timeout must be positive, got %v", cb.OpenTimeout)
+	}
+	return nil
+}
+
+func (cb *CircuitBreakerConfig) breakerConfig() balancer.BreakerConfig {
+	timeout := cb.OpenTimeout
+	if timeout == 0 {
+		timeout = defaultCircuitBreakerOpenTimeout
+	}
+	return balancer.BreakerConfig{FailureThreshold: cb.FailureThreshold, OpenTimeout: timeout}
+}
+
+// hedgedRange 发送Range请求,超过 hedgeDelay 没有返回时再向另一个端点发送一次,使用先成功的结果.
+// 只用于serializable的请求,任何成员的结果都是可以接受的.
+func (kv *kv) hedgedRange(ctx context.Context, r *pb.RangeRequest) (*pb.RangeResponse, error) {
+	type result struct {
+		resp *pb.RangeResponse
+		err  error
+	}
+	// 两个请求共享 PickTracker, 第二个请求会避开第一个请求选择的端点
+	hctx, cancel := context.WithCancel(balancer.WithPickTracker(ctx))
+	defer cancel()
+	results := make(chan result, 2)
+	send := func() {
+		resp, err := kv.remote.Range(hctx, r, kv.callOpts...)
+		results <- result{resp, err}
+	}
+
+	go send()
+	timer := time.NewTimer(kv.hedgeDelay)
+	defer timer.Stop()
+	inflight, hedged := 1, false
+	for {
+		select {
+		case <-timer.C:
+			if !hedged {
+				hedged = true
+				inflight++
+				go send()
+			}
+		case res := <-results:
+			inflight--
+			if res.err == nil {
+				return res.resp, nil
+			}
+			if hedged {
+				if inflight == 0 {
+					return nil, res.err
+				}
+				continue
+			}
+			// 第一个请求在对冲之前就失败了,立即向另一个端点发送
+			hedged = true
+			inflight++
+			go send()
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clientv3
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// MetricsHook 接收客户端的监控数据,实现需要是并发安全的.
+// observability 包提供了Prometheus的实现.
+type MetricsHook interface {
+	// ObserveRequest 每次一元gRPC调用(包括每次重试)结束时调用;endpoint 为实际处理请求的地址
+	ObserveRequest(method, endpoint string, code codes.Code, d time.Duration)
+	// ObserveWatchLag 收到watch事件时调用,lag 是响应头中的revision与事件revision的差
+	ObserveWatchLag(lag int64)
+	// ObserveKeepAlive 收到续约响应时调用,ttl<=0 表示租约已经过期
+	ObserveKeepAlive(id LeaseID, ttl int64)
+	// ObserveKeepAliveTimeout 在租约TTL内没有收到续约响应时调用
+	ObserveKeepAliveTimeout(id LeaseID)
+}
+
+// TraceHook 为每个一元请求创建span,返回的函数在请求(包括所有重试)结束时调用
+type TraceHook interface {
+	StartRequest(ctx context.Context, method string) (context.Context, func(err error))
+}
+
+// tracingUnaryInterceptor 包在重试拦截器之外,一个逻辑请求(包括所有重试)对应一个span
+func (c *Client) tracingUnaryInterceptor(next grpc.UnaryClientInterceptor) grpc.UnaryClientInterceptor {
+	if c.cfg.Tracer == nil {
+		return next
+	}
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, end := c.cfg.Tracer.StartRequest(ctx, method)
+		err := next(ctx, method, req, reply, cc, invoker, opts...)
+		end(err)
+		return err
+	}
+}
+
+// metricsUnaryInterceptor 在重试之内,记录每次调用的延迟、端点和状态码
+func (c *Client) metricsUnaryInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		var p peer.Peer
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, append(opts, grpc.Peer(&p))...)
+		ep := ""
+		if p.Addr != nil {
+			ep = p.Addr.String()
+		}
+		c.cfg.Metrics.ObserveRequest(method, ep, status.Code(err), time.Since(start))
+		return err
+	}
+}
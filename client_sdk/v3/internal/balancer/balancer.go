@@ -0,0 +1,152 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package balancer 实现etcd客户端的gRPC负载均衡器.
+// 在ready的连接之间轮询,如果 Selector 设置了优先的地址,则选择第一个ready的优先地址.
+package balancer
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+)
+
+// Name 在service config中使用的负载均衡策略名称
+const Name = "etcd_policy"
+
+func init() {
+	balancer.Register(base.NewBalancerBuilder(Name, &pickerBuilder{}, base.Config{HealthCheck: true}))
+}
+
+type selectorKey struct{}
+
+// Selector 保存客户端优先使用的地址,可以在运行时修改
+type Selector struct {
+	mu         sync.RWMutex
+	preferred  []string
+	leader     []string
+	attrs      *attributes.Attributes
+	breakerCfg BreakerConfig
+	breakers   map[string]*breaker
+}
+
+func NewSelector() *Selector {
+	s := &Selector{}
+	s.attrs = attributes.New(selectorKey{}, s)
+	return s
+}
+
+// Attributes 附加到 resolver.Address 上,picker通过它找到 Selector
+func (s *Selector) Attributes() *attributes.Attributes { return s.attrs }
+
+// Prefer 按优先顺序设置地址;为空时在所有ready的连接之间轮询
+func (s *Selector) Prefer(addrs []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.preferred = append([]string(nil), addrs...)
+}
+
+// Preferred 返回当前优先的地址
+func (s *Selector) Preferred() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]string(nil), s.preferred...)
+}
+
+type pickerBuilder struct{}
+
+func (*pickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+	p := &picker{byAddr: make(map[string]balancer.SubConn)}
+	for sc, sci := range info.ReadySCs {
+		p.addrs = append(p.addrs, sci.Address.Addr)
+		p.byAddr[sci.Address.Addr] = sc
+		if p.sel == nil && sci.Address.Attributes != nil {
+			p.sel, _ = sci.Address.Attributes.Value(selectorKey{}).(*Selector)
+		}
+	}
+	return p
+}
+
+type picker struct {
+	sel    *Selector
+	addrs  []string
+	byAddr map[string]balancer.SubConn
+	next   uint32
+}
+
+// Pick 依次尝试: 写请求提示的leader、优先的地址、轮询;跳过熔断中的地址和对冲请求已经选过的地址.
+// 没有满足条件的地址时退回到不考虑熔断的轮询.
+func (p *picker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	tracker := pickTrackerFrom(info.Ctx)
+	now := time.Now()
+	usable := func(addr string) bool {
+		if _, ok := p.byAddr[addr]; !ok {
+			return false
+		}
+		if tracker != nil && tracker.avoided(addr) {
+			return false
+		}
+		if p.sel != nil {
+			if b, cfg := p.sel.breaker(addr); b != nil && !b.allow(cfg, now) {
+				return false
+			}
+		}
+		return true
+	}
+
+	n := int(atomic.AddUint32(&p.next, 1))
+	addr := ""
+	if p.sel != nil && preferLeader(info.Ctx) {
+		for _, a := range p.sel.Leader() {
+			if usable(a) {
+				addr = a
+				break
+			}
+		}
+	}
+	if p.sel != nil && addr == "" {
+		for _, a := range p.sel.Preferred() {
+			if usable(a) {
+				addr = a
+				break
+			}
+		}
+	}
+	for i := 0; addr == "" && i < len(p.addrs); i++ {
+		if a := p.addrs[(n+i)%len(p.addrs)]; usable(a) {
+			addr = a
+		}
+	}
+	if addr == "" {
+		addr = p.addrs[n%len(p.addrs)]
+	}
+	if tracker != nil {
+		tracker.add(addr)
+	}
+
+	res := balancer.PickResult{SubConn: p.byAddr[addr]}
+	if p.sel != nil {
+		if b, cfg := p.sel.breaker(addr); b != nil {
+			res.Done = func(di balancer.DoneInfo) { b.record(cfg, di.Err, time.Now()) }
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,154 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package balancer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// BreakerConfig 每个端点的熔断配置
+type BreakerConfig struct {
+	// FailureThreshold 连续失败多少次后熔断
+	FailureThreshold int
+	// OpenTimeout 熔断后多久放行一个探测请求
+	OpenTimeout time.Duration
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+type breaker struct {
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+}
+
+// allow 熔断中返回false;超过 OpenTimeout 后只放行一个请求
+func (b *breaker) allow(cfg BreakerConfig, now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if now.Sub(b.openedAt) < cfg.OpenTimeout {
+			return false
+		}
+		b.state = breakerHalfOpen
+		return true
+	case breakerHalfOpen:
+		// 已经有一个探测请求在进行中
+		return false
+	}
+	return true
+}
+
+func (b *breaker) record(cfg BreakerConfig, err error, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !isEndpointFailure(err) {
+		b.state, b.failures = breakerClosed, 0
+		return
+	}
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= cfg.FailureThreshold {
+		b.state, b.openedAt = breakerOpen, now
+	}
+}
+
+// isEndpointFailure 只有端点不可用或者超时才计入失败,业务错误说明端点是正常的
+func isEndpointFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	if err == context.DeadlineExceeded {
+		return true
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	}
+	return false
+}
+
+// SetBreaker 启用每个端点的熔断; FailureThreshold 为0时关闭熔断
+func (s *Selector) SetBreaker(cfg BreakerConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.breakerCfg = cfg
+	s.breakers = make(map[string]*breaker)
+}
+
+// breaker 返回地址对应的熔断器,没有启用熔断时返回nil
+func (s *Selector) breaker(addr string) (*breaker, BreakerConfig) {
+	s.mu.RLock()
+	cfg := s.breakerCfg
+	b, ok := s.breakers[addr]
+	s.mu.RUnlock()
+	if cfg.FailureThreshold <= 0 {
+		return nil, cfg
+	}
+	if !ok {
+		s.mu.Lock()
+		if b, ok = s.breakers[addr]; !ok {
+			b = &breaker{}
+			s.breakers[addr] = b
+		}
+		s.mu.Unlock()
+	}
+	return b, cfg
+}
+
+type pickTrackerKey struct{}
+
+// PickTracker 记录共享同一个 context 的请求选择过的地址,后续的请求尽量避开这些地址.用于对冲读
+type PickTracker struct {
+	mu     sync.Mutex
+	picked map[string]bool
+}
+
+// WithPickTracker 返回带有 PickTracker 的 context
+func WithPickTracker(ctx context.Context) context.Context {
+	return context.WithValue(ctx, pickTrackerKey{}, &PickTracker{picked: make(map[string]bool)})
+}
+
+func pickTrackerFrom(ctx context.Context) *PickTracker {
+	if ctx == nil {
+		return nil
+	}
+	t, _ := ctx.Value(pickTrackerKey{}).(*PickTracker)
+	return t
+}
+
+func (t *PickTracker) avoided(addr string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.picked[addr]
+}
+
+func (t *PickTracker) add(addr string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.picked[addr] = true
+}
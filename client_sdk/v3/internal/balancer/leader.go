@@ -0,0 +1,46 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package balancer
+
+import "context"
+
+// SetLeader 记录服务端在响应头中提示的leader地址,为空时清除
+func (s *Selector) SetLeader(addrs []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.leader = append([]string(nil), addrs...)
+}
+
+// Leader 返回最近一次提示的leader地址
+func (s *Selector) Leader() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]string(nil), s.leader...)
+}
+
+type preferLeaderKey struct{}
+
+// WithPreferLeader 返回的 context 上的请求优先发往提示的leader,leader不可用时按原来的策略选择
+func WithPreferLeader(ctx context.Context) context.Context {
+	return context.WithValue(ctx, preferLeaderKey{}, true)
+}
+
+func preferLeader(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	v, _ := ctx.Value(preferLeaderKey{}).(bool)
+	return v
+}
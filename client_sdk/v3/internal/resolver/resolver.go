@@ -15,6 +15,9 @@
 package resolver
 
 import (
+	"fmt"
+
+	"github.com/ls-2018/etcd_cn/client_sdk/v3/internal/balancer"
 	"github.com/ls-2018/etcd_cn/client_sdk/v3/internal/endpoint"
 	"google.golang.org/grpc/resolver"
 	"google.golang.org/grpc/resolver/manual"
@@ -29,15 +32,17 @@ type EtcdManualResolver struct {
 	*manual.Resolver
 	endpoints     []string
 	serviceConfig *serviceconfig.ParseResult
+	// Selector 决定 balancer 优先选择的地址
+	Selector *balancer.Selector
 }
 
 func New(endpoints ...string) *EtcdManualResolver {
 	r := manual.NewBuilderWithScheme(Schema) // etcd-endpoints
-	return &EtcdManualResolver{Resolver: r, endpoints: endpoints, serviceConfig: nil}
+	return &EtcdManualResolver{Resolver: r, endpoints: endpoints, serviceConfig: nil, Selector: balancer.NewSelector()}
 }
 
 func (r *EtcdManualResolver) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
-	r.serviceConfig = cc.ParseServiceConfig(`{"loadBalancingPolicy": "round_robin"}`)
+	r.serviceConfig = cc.ParseServiceConfig(fmt.Sprintf(`{"loadBalancingPolicy": "%s"}`, balancer.Name))
 	if r.serviceConfig.Err != nil {
 		return nil, r.serviceConfig.Err
 	}
@@ -60,7 +65,7 @@ func (r EtcdManualResolver) updateState() {
 		addresses := make([]resolver.Address, len(r.endpoints))
 		for i, ep := range r.endpoints {
 			addr, serverName := endpoint.Interpret(ep)
-			addresses[i] = resolver.Address{Addr: addr, ServerName: serverName}
+			addresses[i] = resolver.Address{Addr: addr, ServerName: serverName, Attributes: r.Selector.Attributes()}
 		}
 		state := resolver.State{
 			Addresses:     addresses,
@@ -16,7 +16,9 @@ package clientv3
 
 import (
 	"context"
+	"time"
 
+	"github.com/ls-2018/etcd_cn/client_sdk/v3/internal/balancer"
 	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
 
 	"google.golang.org/grpc"
@@ -68,14 +70,21 @@ func (resp *TxnResponse) OpResponse() OpResponse {
 }
 
 type kv struct {
-	remote   pb.KVClient
-	callOpts []grpc.CallOption
+	remote     pb.KVClient
+	callOpts   []grpc.CallOption
+	hedgeDelay time.Duration
+	// leader 开启 PinWritesToLeader 时记录响应头中的leader提示
+	leader *balancer.Selector
 }
 
 func NewKV(c *Client) KV {
 	api := &kv{remote: RetryKVClient(c)}
 	if c != nil {
 		api.callOpts = c.callOpts
+		api.hedgeDelay = c.cfg.HedgedReadDelay
+		if c.cfg.PinWritesToLeader && c.resolver != nil {
+			api.leader = c.resolver.Selector
+		}
 	}
 	return api
 }
@@ -125,28 +134,35 @@ func (kv *kv) Do(ctx context.Context, op Op) (OpResponse, error) {
 	switch op.t {
 	case tRange:
 		var resp *pb.RangeResponse
-		resp, err = kv.remote.Range(ctx, op.toRangeRequest(), kv.callOpts...)
+		if op.serializable && kv.hedgeDelay > 0 {
+			resp, err = kv.hedgedRange(ctx, op.toRangeRequest())
+		} else {
+			resp, err = kv.remote.Range(ctx, op.toRangeRequest(), kv.callOpts...)
+		}
 		if err == nil {
 			return OpResponse{get: (*GetResponse)(resp)}, nil
 		}
 	case tPut:
 		var resp *pb.PutResponse
-		r := &pb.PutRequest{Key: op.key, Value: op.val, Lease: int64(op.leaseID), PrevKv: op.prevKV, IgnoreValue: op.ignoreValue, IgnoreLease: op.ignoreLease}
-		resp, err = kv.remote.Put(ctx, r, kv.callOpts...)
+		r := &pb.PutRequest{Key: op.key, Value: op.val, Lease: int64(op.leaseID), PrevKv: op.prevKV, IgnoreValue: op.ignoreValue, IgnoreLease: op.ignoreLease, IdempotencyToken: op.idempotencyToken}
+		resp, err = kv.remote.Put(kv.writeCtx(ctx), r, kv.callOpts...)
 		if err == nil {
+			kv.observeLeader(resp.Header)
 			return OpResponse{put: (*PutResponse)(resp)}, nil
 		}
 	case tDeleteRange:
 		var resp *pb.DeleteRangeResponse
 		r := &pb.DeleteRangeRequest{Key: op.key, RangeEnd: op.end, PrevKv: op.prevKV}
-		resp, err = kv.remote.DeleteRange(ctx, r, kv.callOpts...)
+		resp, err = kv.remote.DeleteRange(kv.writeCtx(ctx), r, kv.callOpts...)
 		if err == nil {
+			kv.observeLeader(resp.Header)
 			return OpResponse{del: (*DeleteResponse)(resp)}, nil
 		}
 	case tTxn:
 		var resp *pb.TxnResponse
-		resp, err = kv.remote.Txn(ctx, op.toTxnRequest(), kv.callOpts...)
+		resp, err = kv.remote.Txn(kv.writeCtx(ctx), op.toTxnRequest(), kv.callOpts...)
 		if err == nil {
+			kv.observeLeader(resp.Header)
 			return OpResponse{txn: (*TxnResponse)(resp)}, nil
 		}
 	default:
@@ -154,3 +170,19 @@ func (kv *kv) Do(ctx context.Context, op Op) (OpResponse, error) {
 	}
 	return OpResponse{}, toErr(ctx, err)
 }
+
+// writeCtx 开启 PinWritesToLeader 时让写请求优先发往提示的leader
+func (kv *kv) writeCtx(ctx context.Context) context.Context {
+	if kv.leader == nil {
+		return ctx
+	}
+	return balancer.WithPreferLeader(ctx)
+}
+
+// observeLeader 记录follower在响应头中提示的leader地址;leader处理的响应没有提示,保留原来的地址
+func (kv *kv) observeLeader(h *pb.ResponseHeader) {
+	if kv.leader == nil || h == nil || len(h.LeaderClientUrls) == 0 {
+		return
+	}
+	kv.leader.SetLeader(endpointAddrs(h.LeaderClientUrls))
+}
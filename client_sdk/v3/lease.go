@@ -17,6 +17,7 @@ package clientv3
 import (
 	"context"
 	"fmt"
+	"io"
 	"sync"
 	"time"
 
@@ -38,12 +39,18 @@ type LeaseGrantResponse struct {
 	ID    LeaseID
 	TTL   int64
 	Error string
+	// ClockSkew 处理请求的成员与各对端之间最大的时钟偏差,偏差大时不同成员看到的剩余TTL会不一致
+	ClockSkew time.Duration
 }
 
 type LeaseKeepAliveResponse struct {
 	*pb.ResponseHeader
 	ID  LeaseID
 	TTL int64
+	// NextKeepAlive 服务端建议的下次续约间隔,为0时使用TTL/3
+	NextKeepAlive time.Duration
+	// ClockSkew 处理请求的成员与各对端之间最大的时钟偏差
+	ClockSkew time.Duration
 }
 
 type LeaseTimeToLiveResponse struct {
@@ -58,10 +65,20 @@ type LeaseTimeToLiveResponse struct {
 
 	// Keys is the list of keys attached to this lease.
 	Keys [][]byte `json:"keys"`
+
+	// Metadata is the opaque metadata attached at grant time.
+	Metadata string `json:"metadata,omitempty"`
+
+	// ClockSkew 处理请求的成员与各对端之间最大的时钟偏差
+	ClockSkew time.Duration `json:"clock-skew,omitempty"`
 }
 
 type LeaseStatus struct {
 	ID LeaseID `json:"id"`
+	// GrantedTTL is the initial granted time in seconds upon lease creation.
+	GrantedTTL int64 `json:"granted-ttl"`
+	// Metadata is the opaque metadata attached at grant time.
+	Metadata string `json:"metadata,omitempty"`
 	// TODO: TTL int64
 }
 
@@ -70,6 +87,19 @@ type LeaseLeasesResponse struct {
 	Leases []LeaseStatus `json:"leases"`
 }
 
+type LeaseWatchResponse struct {
+	*pb.ResponseHeader
+	Events []*pb.LeaseEvent
+
+	// closeErr is the error that closed the lease watch stream.
+	closeErr error
+}
+
+// Err returns the error that closed the lease watch stream, if any.
+func (wr *LeaseWatchResponse) Err() error {
+	return wr.closeErr
+}
+
 const (
 	// defaultTTL is the assumed lease TTL used for the first keepalive
 	// deadline before the actual TTL is known to the client.
@@ -102,10 +132,15 @@ func (e ErrKeepAliveHalted) Error() string {
 }
 
 type Lease interface {
-	Grant(ctx context.Context, ttl int64) (*LeaseGrantResponse, error)
+	Grant(ctx context.Context, ttl int64, opts ...LeaseOption) (*LeaseGrantResponse, error)
+	// GrantWithParent 创建parent的子租约: parent撤销或过期时子租约一起撤销,对parent续约时子租约一起续约
+	GrantWithParent(ctx context.Context, ttl int64, parent LeaseID) (*LeaseGrantResponse, error)
 	Revoke(ctx context.Context, id LeaseID) (*LeaseRevokeResponse, error)
 	TimeToLive(ctx context.Context, id LeaseID, opts ...LeaseOption) (*LeaseTimeToLiveResponse, error)
 	Leases(ctx context.Context) (*LeaseLeasesResponse, error)
+	// WatchLeases 订阅租约的创建、续约、检查点、过期、撤销事件; ctx结束或出错时关闭返回的chan,
+	// 出错时最后一个响应的Err()不为nil
+	WatchLeases(ctx context.Context, opts ...LeaseOption) <-chan LeaseWatchResponse
 	KeepAlive(ctx context.Context, id LeaseID) (<-chan *LeaseKeepAliveResponse, error)
 	KeepAliveOnce(ctx context.Context, id LeaseID) (*LeaseKeepAliveResponse, error)
 	Close() error
@@ -137,6 +172,11 @@ type lessor struct {
 
 	callOpts []grpc.CallOption
 
+	// batchKeepAlive 每个发送周期把所有需要续约的租约合并为一条消息
+	batchKeepAlive bool
+
+	metrics MetricsHook
+
 	lg *zap.Logger
 }
 
@@ -168,14 +208,16 @@ func NewLeaseFromLeaseClient(remote pb.LeaseClient, c *Client, keepAliveTimeout
 	}
 	if c != nil {
 		l.callOpts = c.callOpts
+		l.batchKeepAlive = c.cfg.BatchLeaseKeepAlive
+		l.metrics = c.cfg.Metrics
 	}
 	reqLeaderCtx := WithRequireLeader(context.Background())
 	l.stopCtx, l.stopCancel = context.WithCancel(reqLeaderCtx)
 	return l
 }
 
-func (l *lessor) Grant(ctx context.Context, ttl int64) (*LeaseGrantResponse, error) {
-	r := &pb.LeaseGrantRequest{TTL: ttl}
+func (l *lessor) Grant(ctx context.Context, ttl int64, opts ...LeaseOption) (*LeaseGrantResponse, error) {
+	r := toLeaseGrantRequest(ttl, opts...)
 	fmt.Println("lease--->:", *r)
 	resp, err := l.remote.LeaseGrant(ctx, r, l.callOpts...)
 	if err == nil {
@@ -184,12 +226,17 @@ func (l *lessor) Grant(ctx context.Context, ttl int64) (*LeaseGrantResponse, err
 			ID:             LeaseID(resp.ID),
 			TTL:            resp.TTL,
 			Error:          resp.Error,
+			ClockSkew:      time.Duration(resp.ClockSkewMs) * time.Millisecond,
 		}
 		return gresp, nil
 	}
 	return nil, toErr(ctx, err)
 }
 
+func (l *lessor) GrantWithParent(ctx context.Context, ttl int64, parent LeaseID) (*LeaseGrantResponse, error) {
+	return l.Grant(ctx, ttl, WithLeaseParent(parent))
+}
+
 func (l *lessor) Revoke(ctx context.Context, id LeaseID) (*LeaseRevokeResponse, error) {
 	r := &pb.LeaseRevokeRequest{ID: int64(id)}
 	resp, err := l.remote.LeaseRevoke(ctx, r, l.callOpts...)
@@ -211,6 +258,8 @@ func (l *lessor) TimeToLive(ctx context.Context, id LeaseID, opts ...LeaseOption
 		TTL:            resp.TTL,
 		GrantedTTL:     resp.GrantedTTL,
 		Keys:           resp.Keys,
+		Metadata:       resp.Metadata,
+		ClockSkew:      time.Duration(resp.ClockSkewMs) * time.Millisecond,
 	}
 	return gresp, nil
 }
@@ -220,13 +269,48 @@ func (l *lessor) Leases(ctx context.Context) (*LeaseLeasesResponse, error) {
 	if err == nil {
 		leases := make([]LeaseStatus, len(resp.Leases))
 		for i := range resp.Leases {
-			leases[i] = LeaseStatus{ID: LeaseID(resp.Leases[i].ID)}
+			leases[i] = LeaseStatus{ID: LeaseID(resp.Leases[i].ID), GrantedTTL: resp.Leases[i].GrantedTTL, Metadata: resp.Leases[i].Metadata}
 		}
 		return &LeaseLeasesResponse{ResponseHeader: resp.GetHeader(), Leases: leases}, nil
 	}
 	return nil, toErr(ctx, err)
 }
 
+func (l *lessor) WatchLeases(ctx context.Context, opts ...LeaseOption) <-chan LeaseWatchResponse {
+	ch := make(chan LeaseWatchResponse, LeaseResponseChSize)
+	go func() {
+		defer close(ch)
+		send := func(wr LeaseWatchResponse) bool {
+			select {
+			case ch <- wr:
+				return true
+			case <-ctx.Done():
+			case <-l.stopCtx.Done():
+			}
+			return false
+		}
+
+		wc, err := l.remote.LeaseWatch(ctx, toLeaseWatchRequest(opts...), l.callOpts...)
+		if err != nil {
+			send(LeaseWatchResponse{closeErr: toErr(ctx, err)})
+			return
+		}
+		for {
+			resp, err := wc.Recv()
+			if err != nil {
+				if err != io.EOF && ctx.Err() == nil {
+					send(LeaseWatchResponse{closeErr: toErr(ctx, err)})
+				}
+				return
+			}
+			if !send(LeaseWatchResponse{ResponseHeader: resp.GetHeader(), Events: resp.Events}) {
+				return
+			}
+		}
+	}()
+	return ch
+}
+
 // KeepAlive 尝试保持给定的租约永久alive
 func (l *lessor) KeepAlive(ctx context.Context, id LeaseID) (<-chan *LeaseKeepAliveResponse, error) {
 	ch := make(chan *LeaseKeepAliveResponse, LeaseResponseChSize)
@@ -387,6 +471,8 @@ func (l *lessor) keepAliveOnce(ctx context.Context, id LeaseID) (*LeaseKeepAlive
 		ResponseHeader: resp.GetHeader(),
 		ID:             LeaseID(resp.ID),
 		TTL:            resp.TTL,
+		NextKeepAlive:  time.Duration(resp.NextKeepAliveMs) * time.Millisecond,
+		ClockSkew:      time.Duration(resp.ClockSkewMs) * time.Millisecond,
 	}
 	return karesp, nil
 }
@@ -425,7 +511,13 @@ func (l *lessor) recvKeepAliveLoop() (gerr error) {
 				}
 				// 根据LeaseKeepAliveResponse更新租约
 				// 如果租约过期删除所有alive channels
-				l.recvKeepAlive(resp)
+				if len(resp.Results) == 0 {
+					l.recvKeepAlive(resp)
+					continue
+				}
+				for _, r := range resp.Results {
+					l.recvKeepAlive(&pb.LeaseKeepAliveResponse{Header: resp.Header, ID: r.ID, TTL: r.TTL, NextKeepAliveMs: r.NextKeepAliveMs, ClockSkewMs: resp.ClockSkewMs})
+				}
 			}
 		}
 
@@ -467,6 +559,8 @@ func (l *lessor) recvKeepAlive(resp *pb.LeaseKeepAliveResponse) {
 		ResponseHeader: resp.GetHeader(),
 		ID:             LeaseID(resp.ID),
 		TTL:            resp.TTL,
+		NextKeepAlive:  time.Duration(resp.NextKeepAliveMs) * time.Millisecond,
+		ClockSkew:      time.Duration(resp.ClockSkewMs) * time.Millisecond,
 	}
 
 	l.mu.Lock()
@@ -476,6 +570,9 @@ func (l *lessor) recvKeepAlive(resp *pb.LeaseKeepAliveResponse) {
 	if !ok {
 		return
 	}
+	if l.metrics != nil {
+		l.metrics.ObserveKeepAlive(karesp.ID, karesp.TTL)
+	}
 
 	if karesp.TTL <= 0 {
 		// lease expired; close all keep alive channels
@@ -486,6 +583,10 @@ func (l *lessor) recvKeepAlive(resp *pb.LeaseKeepAliveResponse) {
 
 	// send update to all channels
 	nextKeepAlive := time.Now().Add((time.Duration(karesp.TTL) * time.Second) / 3.0)
+	if karesp.NextKeepAlive > 0 {
+		// 使用服务端带抖动的建议,避免相同TTL的客户端同时续约
+		nextKeepAlive = time.Now().Add(karesp.NextKeepAlive)
+	}
 	ka.deadline = time.Now().Add(time.Duration(karesp.TTL) * time.Second)
 	for _, ch := range ka.chs {
 		select {
@@ -519,6 +620,9 @@ func (l *lessor) deadlineLoop() {
 			if ka.deadline.Before(now) {
 				// 等待响应太久；租约可能已过期
 				// waited too long for response; lease may be expired
+				if l.metrics != nil {
+					l.metrics.ObserveKeepAliveTimeout(id)
+				}
 				ka.close()
 				delete(l.keepAlives, id)
 			}
@@ -542,6 +646,16 @@ func (l *lessor) sendKeepAliveLoop(stream pb.Lease_LeaseKeepAliveClient) {
 		}
 		l.mu.Unlock()
 
+		if l.batchKeepAlive && len(tosend) > 0 {
+			r := &pb.LeaseKeepAliveRequest{IDs: make([]int64, len(tosend))}
+			for i, id := range tosend {
+				r.IDs[i] = int64(id)
+			}
+			if err := stream.Send(r); err != nil {
+				return
+			}
+			tosend = nil
+		}
 		for _, id := range tosend {
 			r := &pb.LeaseKeepAliveRequest{ID: int64(id)}
 			if err := stream.Send(r); err != nil {
@@ -193,7 +193,9 @@ func (lc *leaseCache) EvictRange(key, end string) {
 	}
 }
 
-func isBadOp(op v3.Op) bool { return op.Rev() > 0 || len(op.RangeBytes()) > 0 }
+func isBadOp(op v3.Op) bool {
+	return op.Rev() > 0 || op.SnapshotToken() != "" || len(op.RangeBytes()) > 0
+}
 
 func (lc *leaseCache) Get(ctx context.Context, op v3.Op) (*v3.GetResponse, bool) {
 	if isBadOp(op) {
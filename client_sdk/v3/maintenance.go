@@ -18,6 +18,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"time"
 
 	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
 	"go.uber.org/zap"
@@ -25,12 +26,33 @@ import (
 )
 
 type (
-	DefragmentResponse pb.DefragmentResponse
-	AlarmResponse      pb.AlarmResponse
-	AlarmMember        pb.AlarmMember
-	StatusResponse     pb.StatusResponse
-	HashKVResponse     pb.HashKVResponse
-	MoveLeaderResponse pb.MoveLeaderResponse
+	DefragmentResponse  pb.DefragmentResponse
+	AlarmResponse       pb.AlarmResponse
+	AlarmMember         pb.AlarmMember
+	StatusResponse      pb.StatusResponse
+	HashKVResponse      pb.HashKVResponse
+	MoveLeaderResponse  pb.MoveLeaderResponse
+	ReloadCertsResponse pb.ReloadCertsResponse
+	DowngradeResponse   pb.DowngradeResponse
+
+	MaintenanceModeResponse pb.MaintenanceModeResponse
+	LogLevelResponse        pb.LogLevelResponse
+	FailpointResponse       pb.FailpointResponse
+	PeerStatsResponse       pb.PeerStatsResponse
+	CompactionHoldResponse  pb.CompactionHoldResponse
+	UserUsageResponse       pb.UserUsageResponse
+	PromoteReplicaResponse  pb.PromoteReplicaResponse
+	SnapshotSessionResponse pb.SnapshotSessionResponse
+
+	DowngradeAction pb.DowngradeRequest_DowngradeAction
+)
+
+const (
+	DowngradeValidate = DowngradeAction(pb.DowngradeRequest_VALIDATE)
+	DowngradeEnable   = DowngradeAction(pb.DowngradeRequest_ENABLE)
+	DowngradeCancel   = DowngradeAction(pb.DowngradeRequest_CANCEL)
+	// DowngradePromote 在所有成员都运行目标版本后提升集群版本
+	DowngradePromote = DowngradeAction(pb.DowngradeRequest_PROMOTE)
 )
 
 type Maintenance interface {
@@ -41,6 +63,41 @@ type Maintenance interface {
 	HashKV(ctx context.Context, endpoint string, rev int64) (*HashKVResponse, error)  //
 	Snapshot(ctx context.Context) (io.ReadCloser, error)                              // 返回一个快照
 	MoveLeader(ctx context.Context, transfereeID uint64) (*MoveLeaderResponse, error) // leader 转移
+	// ReloadCerts 让端点重新加载TLS证书并返回当前已加载的证书,reportOnly 为true时只返回不加载
+	ReloadCerts(ctx context.Context, endpoint string, reportOnly bool) (*ReloadCertsResponse, error)
+	// Downgrade 校验、开启或取消集群降级,或者在升级完成后提升集群版本
+	Downgrade(ctx context.Context, action DowngradeAction, version string) (*DowngradeResponse, error)
+	// MaintenanceMode 让端点进入或退出只读维护模式
+	MaintenanceMode(ctx context.Context, endpoint string, readOnly bool) (*MaintenanceModeResponse, error)
+	// LogLevel 设置端点各子系统(raft、mvcc、auth、rafthttp、lease、apply)的日志等级并返回当前等级,
+	// levels 为空时只返回;等级为 "default" 时恢复跟随全局日志等级
+	LogLevel(ctx context.Context, endpoint string, levels map[string]string) (*LogLevelResponse, error)
+	// Failpoint 在端点注入或解除故障并返回当前生效的故障,故障到期后自动解除;
+	// 端点需要以 --experimental-failpoints 启动,只用于测试
+	Failpoint(ctx context.Context, endpoint string, req *pb.FailpointRequest) (*FailpointResponse, error)
+	// PeerStats 返回端点到各个对端的网络状况:两个方向的消息流是否连通、往返时间、发送队列和丢弃的消息数
+	PeerStats(ctx context.Context, endpoint string) (*PeerStatsResponse, error)
+	// Profile 从端点采集 cpu、trace 或 heap 等运行时 profile,duration 只对 cpu 和 trace 生效
+	Profile(ctx context.Context, endpoint string, profileType string, duration time.Duration) (io.ReadCloser, error)
+	// HoldCompaction 登记或续期owner的压缩保留,ttl 内自动压缩不会越过 rev;rev 为0时保留当前修订版本
+	HoldCompaction(ctx context.Context, owner string, rev int64, ttl time.Duration) (*CompactionHoldResponse, error)
+	// ReleaseCompactionHold 释放owner的压缩保留
+	ReleaseCompactionHold(ctx context.Context, owner string) (*CompactionHoldResponse, error)
+	// CompactionHolds 返回当前有效的压缩保留
+	CompactionHolds(ctx context.Context) (*CompactionHoldResponse, error)
+	// UserUsage 返回用户累计写入的字节数和写入预算;user 为空时返回所有用户
+	UserUsage(ctx context.Context, user string) (*UserUsageResponse, error)
+	// ResetUserUsage 把用户累计写入的字节数清零;user 为空时清零所有用户
+	ResetUserUsage(ctx context.Context, user string) (*UserUsageResponse, error)
+	// SnapshotSession 创建快照会话,ttl 内 rev 不会被自动压缩,带有 WithSnapshotToken 的 Get 在 rev 上读取;
+	// rev 为0时固定当前修订版本
+	SnapshotSession(ctx context.Context, rev int64, ttl time.Duration) (*SnapshotSessionResponse, error)
+	// KeepAliveSnapshotSession 续期快照会话,新的有效期为 ttl
+	KeepAliveSnapshotSession(ctx context.Context, token string, ttl time.Duration) (*SnapshotSessionResponse, error)
+	// ReleaseSnapshotSession 结束快照会话
+	ReleaseSnapshotSession(ctx context.Context, token string) (*SnapshotSessionResponse, error)
+	// PromoteReplica 提升只读副本集群,集群停止从上游复制并开始接受写请求
+	PromoteReplica(ctx context.Context) (*PromoteReplicaResponse, error)
 }
 
 type maintenance struct {
@@ -223,3 +280,188 @@ func (m *maintenance) MoveLeader(ctx context.Context, transfereeID uint64) (*Mov
 	resp, err := m.remote.MoveLeader(ctx, &pb.MoveLeaderRequest{TargetID: transfereeID}, m.callOpts...)
 	return (*MoveLeaderResponse)(resp), toErr(ctx, err)
 }
+
+func (m *maintenance) ReloadCerts(ctx context.Context, endpoint string, reportOnly bool) (*ReloadCertsResponse, error) {
+	remote, cancel, err := m.dial(endpoint)
+	if err != nil {
+		return nil, toErr(ctx, err)
+	}
+	defer cancel()
+	resp, err := remote.ReloadCerts(ctx, &pb.ReloadCertsRequest{ReportOnly: reportOnly}, m.callOpts...)
+	if err != nil {
+		return nil, toErr(ctx, err)
+	}
+	return (*ReloadCertsResponse)(resp), nil
+}
+
+func (m *maintenance) Downgrade(ctx context.Context, action DowngradeAction, version string) (*DowngradeResponse, error) {
+	req := &pb.DowngradeRequest{Action: pb.DowngradeRequest_DowngradeAction(action), Version: version}
+	resp, err := m.remote.Downgrade(ctx, req, m.callOpts...)
+	return (*DowngradeResponse)(resp), toErr(ctx, err)
+}
+
+func (m *maintenance) MaintenanceMode(ctx context.Context, endpoint string, readOnly bool) (*MaintenanceModeResponse, error) {
+	remote, cancel, err := m.dial(endpoint)
+	if err != nil {
+		return nil, toErr(ctx, err)
+	}
+	defer cancel()
+	resp, err := remote.MaintenanceMode(ctx, &pb.MaintenanceModeRequest{ReadOnly: readOnly}, m.callOpts...)
+	if err != nil {
+		return nil, toErr(ctx, err)
+	}
+	return (*MaintenanceModeResponse)(resp), nil
+}
+
+func (m *maintenance) LogLevel(ctx context.Context, endpoint string, levels map[string]string) (*LogLevelResponse, error) {
+	remote, cancel, err := m.dial(endpoint)
+	if err != nil {
+		return nil, toErr(ctx, err)
+	}
+	defer cancel()
+	req := &pb.LogLevelRequest{}
+	for scope, level := range levels {
+		req.Levels = append(req.Levels, &pb.LogScopeLevel{Scope: scope, Level: level})
+	}
+	resp, err := remote.LogLevel(ctx, req, m.callOpts...)
+	if err != nil {
+		return nil, toErr(ctx, err)
+	}
+	return (*LogLevelResponse)(resp), nil
+}
+
+func (m *maintenance) Failpoint(ctx context.Context, endpoint string, req *pb.FailpointRequest) (*FailpointResponse, error) {
+	remote, cancel, err := m.dial(endpoint)
+	if err != nil {
+		return nil, toErr(ctx, err)
+	}
+	defer cancel()
+	resp, err := remote.Failpoint(ctx, req, m.callOpts...)
+	if err != nil {
+		return nil, toErr(ctx, err)
+	}
+	return (*FailpointResponse)(resp), nil
+}
+
+func (m *maintenance) PeerStats(ctx context.Context, endpoint string) (*PeerStatsResponse, error) {
+	remote, cancel, err := m.dial(endpoint)
+	if err != nil {
+		return nil, toErr(ctx, err)
+	}
+	defer cancel()
+	resp, err := remote.PeerStats(ctx, &pb.PeerStatsRequest{}, m.callOpts...)
+	if err != nil {
+		return nil, toErr(ctx, err)
+	}
+	return (*PeerStatsResponse)(resp), nil
+}
+
+func (m *maintenance) Profile(ctx context.Context, endpoint string, profileType string, duration time.Duration) (io.ReadCloser, error) {
+	remote, cancel, err := m.dial(endpoint)
+	if err != nil {
+		return nil, toErr(ctx, err)
+	}
+	req := &pb.ProfileRequest{Type: profileType, Duration: int64(duration / time.Second)}
+	ps, err := remote.Profile(ctx, req, append(m.callOpts, withMax(defaultStreamMaxRetries))...)
+	if err != nil {
+		cancel()
+		return nil, toErr(ctx, err)
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		defer cancel()
+		for {
+			resp, err := ps.Recv()
+			if err != nil {
+				if err != io.EOF {
+					m.lg.Warn("从 profile 流接收失败", zap.String("endpoint", endpoint), zap.Error(err))
+				}
+				pw.CloseWithError(err)
+				return
+			}
+			if _, werr := pw.Write(resp.Blob); werr != nil {
+				pw.CloseWithError(werr)
+				return
+			}
+		}
+	}()
+	return &snapshotReadCloser{ctx: ctx, ReadCloser: pr}, nil
+}
+
+func (m *maintenance) HoldCompaction(ctx context.Context, owner string, rev int64, ttl time.Duration) (*CompactionHoldResponse, error) {
+	if owner == "" {
+		return nil, fmt.Errorf("compaction hold owner is required")
+	}
+	req := &pb.CompactionHoldRequest{Owner: owner, Revision: rev, TTL: int64(ttl / time.Second)}
+	return m.compactionHold(ctx, req)
+}
+
+func (m *maintenance) ReleaseCompactionHold(ctx context.Context, owner string) (*CompactionHoldResponse, error) {
+	if owner == "" {
+		return nil, fmt.Errorf("compaction hold owner is required")
+	}
+	return m.compactionHold(ctx, &pb.CompactionHoldRequest{Owner: owner, Release: true})
+}
+
+func (m *maintenance) CompactionHolds(ctx context.Context) (*CompactionHoldResponse, error) {
+	return m.compactionHold(ctx, &pb.CompactionHoldRequest{})
+}
+
+func (m *maintenance) compactionHold(ctx context.Context, req *pb.CompactionHoldRequest) (*CompactionHoldResponse, error) {
+	resp, err := m.remote.CompactionHold(ctx, req, m.callOpts...)
+	if err != nil {
+		return nil, toErr(ctx, err)
+	}
+	return (*CompactionHoldResponse)(resp), nil
+}
+
+func (m *maintenance) UserUsage(ctx context.Context, user string) (*UserUsageResponse, error) {
+	return m.userUsage(ctx, &pb.UserUsageRequest{User: user})
+}
+
+func (m *maintenance) ResetUserUsage(ctx context.Context, user string) (*UserUsageResponse, error) {
+	return m.userUsage(ctx, &pb.UserUsageRequest{User: user, Reset_: true})
+}
+
+func (m *maintenance) userUsage(ctx context.Context, req *pb.UserUsageRequest) (*UserUsageResponse, error) {
+	resp, err := m.remote.UserUsage(ctx, req, m.callOpts...)
+	if err != nil {
+		return nil, toErr(ctx, err)
+	}
+	return (*UserUsageResponse)(resp), nil
+}
+
+func (m *maintenance) PromoteReplica(ctx context.Context) (*PromoteReplicaResponse, error) {
+	resp, err := m.remote.PromoteReplica(ctx, &pb.PromoteReplicaRequest{}, m.callOpts...)
+	if err != nil {
+		return nil, toErr(ctx, err)
+	}
+	return (*PromoteReplicaResponse)(resp), nil
+}
+
+func (m *maintenance) SnapshotSession(ctx context.Context, rev int64, ttl time.Duration) (*SnapshotSessionResponse, error) {
+	return m.snapshotSession(ctx, &pb.SnapshotSessionRequest{Revision: rev, TTL: int64(ttl / time.Second)})
+}
+
+func (m *maintenance) KeepAliveSnapshotSession(ctx context.Context, token string, ttl time.Duration) (*SnapshotSessionResponse, error) {
+	if token == "" {
+		return nil, fmt.Errorf("snapshot session token is required")
+	}
+	return m.snapshotSession(ctx, &pb.SnapshotSessionRequest{Token: token, TTL: int64(ttl / time.Second)})
+}
+
+func (m *maintenance) ReleaseSnapshotSession(ctx context.Context, token string) (*SnapshotSessionResponse, error) {
+	if token == "" {
+		return nil, fmt.Errorf("snapshot session token is required")
+	}
+	return m.snapshotSession(ctx, &pb.SnapshotSessionRequest{Token: token, Release: true})
+}
+
+func (m *maintenance) snapshotSession(ctx context.Context, req *pb.SnapshotSessionRequest) (*SnapshotSessionResponse, error) {
+	resp, err := m.remote.SnapshotSession(ctx, req, m.callOpts...)
+	if err != nil {
+		return nil, toErr(ctx, err)
+	}
+	return (*SnapshotSessionResponse)(resp), nil
+}
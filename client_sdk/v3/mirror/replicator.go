@@ -0,0 +1,365 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	clientv3 "github.com/ls-2018/etcd_cn/client_sdk/v3"
+	"github.com/ls-2018/etcd_cn/offical/api/v3/mvccpb"
+	"github.com/ls-2018/etcd_cn/offical/api/v3/v3rpc/rpctypes"
+)
+
+// 每个目标事务最多的操作数,不超过服务端默认的 --max-txn-ops
+const maxTxnOps = 128
+
+// ConflictPolicy 目标集群上的key被本地修改过时的处理方式
+type ConflictPolicy int
+
+const (
+	// ConflictSourceWins 源集群的修改总是覆盖目标集群
+	ConflictSourceWins ConflictPolicy = iota
+	// ConflictLastWriterWins 目标上的key在上一次复制之后被本地修改过时,视为更晚的写入而保留
+	ConflictLastWriterWins
+)
+
+// ParseConflictPolicy 解析 "source-wins" 或 "last-writer"
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	switch s {
+	case "", "source-wins":
+		return ConflictSourceWins, nil
+	case "last-writer":
+		return ConflictLastWriterWins, nil
+	}
+	return 0, fmt.Errorf("mirror: unknown conflict policy %q", s)
+}
+
+// Config 复制的配置
+type Config struct {
+	// Prefix 源集群中复制的前缀,为空时复制所有key
+	Prefix string
+	// DestPrefix 在目标集群中替换 Prefix;为空时去掉 Prefix
+	DestPrefix string
+	// KeyFilter 按源集群中的key过滤,返回false时不复制这个key
+	KeyFilter func(key string) bool
+	// KeyRewrites 在前缀替换之后依次改写key
+	KeyRewrites []KeyRewrite
+	// ValueFilter 返回false时不复制这个put.增量复制中被过滤的put会删除目标上的key,
+	// 避免目标保留已经不满足条件的旧值;删除事件不经过过滤
+	ValueFilter func(key, value string) bool
+	// Transform 在前缀替换之后修改key和value,返回false时不复制这个key.删除事件的value为空
+	Transform func(key, value string) (string, string, bool)
+	// Conflict 目标上的key被本地修改过时的处理方式
+	Conflict ConflictPolicy
+	// CheckpointKey 目标集群中保存复制进度的key,重启后从这里继续;为空时每次都从头复制
+	CheckpointKey string
+	// IgnoreCheckpointKey 源集群中反向复制器的 CheckpointKey.
+	// 和它在同一个revision写入的修改来自反向复制,不会再被复制回去,用于双向复制
+	IgnoreCheckpointKey string
+}
+
+// Checkpoint 复制进度
+type Checkpoint struct {
+	// Revision 已经复制到的源集群revision
+	Revision int64 `json:"revision"`
+	// BaseKey 初始全量复制中下一个要复制的key;为空表示全量复制已经完成
+	BaseKey string `json:"base-key,omitempty"`
+}
+
+// Replicator 把源集群中的一个前缀持续复制到目标集群
+type Replicator struct {
+	src, dst *clientv3.Client
+	cfg      Config
+
+	// lastDestRev 上一次复制事务在目标集群的revision
+	lastDestRev int64
+	count       int64
+	rev         int64 // 已经复制到的源集群revision
+	base        int32 // 1 表示还在初始全量复制中
+}
+
+func NewReplicator(src, dst *clientv3.Client, cfg Config) *Replicator {
+	return &Replicator{src: src, dst: dst, cfg: cfg}
+}
+
+// Count 返回已经复制的修改数
+func (r *Replicator) Count() int64 { return atomic.LoadInt64(&r.count) }
+
+// Progress 返回当前的复制进度
+func (r *Replicator) Progress() Progress {
+	return Progress{
+		Count:    atomic.LoadInt64(&r.count),
+		Revision: atomic.LoadInt64(&r.rev),
+		Base:     atomic.LoadInt32(&r.base) == 1,
+	}
+}
+
+type replOp struct {
+	key, val string
+	del      bool
+}
+
+// Run 复制直到ctx结束或者出错;源集群已经压缩了需要的revision时返回 rpctypes.ErrCompacted
+func (r *Replicator) Run(ctx context.Context) error {
+	cp, err := r.loadCheckpoint(ctx)
+	if err != nil {
+		return err
+	}
+	if cp == nil {
+		resp, err := r.src.Get(ctx, r.startKey(), append(r.rangeOpts(), clientv3.WithCountOnly())...)
+		if err != nil {
+			return err
+		}
+		cp = &Checkpoint{Revision: resp.Header.Revision, BaseKey: r.startKey()}
+	}
+	atomic.StoreInt64(&r.rev, cp.Revision)
+	if cp.BaseKey != "" {
+		atomic.StoreInt32(&r.base, 1)
+		if err = r.copyBase(ctx, cp); err != nil {
+			return err
+		}
+		atomic.StoreInt32(&r.base, 0)
+	}
+	return r.syncUpdates(ctx, cp)
+}
+
+func (r *Replicator) startKey() string {
+	if r.cfg.Prefix == "" {
+		return "\x00"
+	}
+	return r.cfg.Prefix
+}
+
+func (r *Replicator) rangeOpts() []clientv3.OpOption {
+	if r.cfg.Prefix == "" {
+		return []clientv3.OpOption{clientv3.WithFromKey()}
+	}
+	return []clientv3.OpOption{clientv3.WithRange(clientv3.GetPrefixRangeEnd(r.cfg.Prefix))}
+}
+
+// loadCheckpoint 读取目标集群中的进度,没有进度时返回nil
+func (r *Replicator) loadCheckpoint(ctx context.Context) (*Checkpoint, error) {
+	if r.cfg.CheckpointKey == "" {
+		resp, err := r.dst.Get(ctx, "\x00", clientv3.WithCountOnly())
+		if err != nil {
+			return nil, err
+		}
+		r.lastDestRev = resp.Header.Revision
+		return nil, nil
+	}
+	resp, err := r.dst.Get(ctx, r.cfg.CheckpointKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		r.lastDestRev = resp.Header.Revision
+		return nil, nil
+	}
+	cp := &Checkpoint{}
+	if err = json.Unmarshal([]byte(resp.Kvs[0].Value), cp); err != nil {
+		return nil, fmt.Errorf("mirror: invalid checkpoint %q: %v", r.cfg.CheckpointKey, err)
+	}
+	r.lastDestRev = resp.Kvs[0].ModRevision
+	return cp, nil
+}
+
+// copyBase 在 cp.Revision 复制全量数据,每一批和进度在同一个事务中写入
+func (r *Replicator) copyBase(ctx context.Context, cp *Checkpoint) error {
+	opts := append(r.rangeOpts(), clientv3.WithLimit(maxTxnOps-1), clientv3.WithRev(cp.Revision))
+	for cp.BaseKey != "" {
+		resp, err := r.src.Get(ctx, cp.BaseKey, opts...)
+		if err != nil {
+			return err
+		}
+		var ops []replOp
+		for _, kv := range resp.Kvs {
+			// 全量复制时目标上还没有被过滤的key,不需要删除
+			if op, ok := r.mapKV(kv, false); ok && !op.del {
+				ops = append(ops, op)
+			}
+		}
+		next := &Checkpoint{Revision: cp.Revision}
+		if resp.More {
+			next.BaseKey = resp.Kvs[len(resp.Kvs)-1].Key + "\x00"
+		}
+		if err = r.apply(ctx, ops, next); err != nil {
+			return err
+		}
+		*cp = *next
+	}
+	return nil
+}
+
+// syncUpdates 从 cp.Revision+1 开始复制增量修改,每个源revision的修改在目标上原子地写入
+func (r *Replicator) syncUpdates(ctx context.Context, cp *Checkpoint) error {
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	wopts := append(r.rangeOpts(), clientv3.WithRev(cp.Revision+1))
+	for wr := range r.src.Watch(wctx, r.startKey(), wopts...) {
+		if wr.CompactRevision != 0 {
+			return rpctypes.ErrCompacted
+		}
+		if err := wr.Err(); err != nil {
+			return err
+		}
+		if wr.IsProgressNotify() {
+			// Header.Revision 之前的修改都已经收到并复制,只推进进度,不写入目标
+			if wr.Header.Revision > atomic.LoadInt64(&r.rev) {
+				atomic.StoreInt64(&r.rev, wr.Header.Revision)
+			}
+			continue
+		}
+		for i := 0; i < len(wr.Events); {
+			rev := wr.Events[i].Kv.ModRevision
+			j := i
+			for j < len(wr.Events) && wr.Events[j].Kv.ModRevision == rev {
+				j++
+			}
+			if err := r.applyRevision(ctx, rev, wr.Events[i:j]); err != nil {
+				return err
+			}
+			i = j
+		}
+	}
+	return ctx.Err()
+}
+
+func (r *Replicator) applyRevision(ctx context.Context, rev int64, evs []*clientv3.Event) error {
+	fromPeer, err := r.replicatedFromPeer(ctx, rev)
+	if err != nil {
+		return err
+	}
+	var ops []replOp
+	if !fromPeer {
+		for _, ev := range evs {
+			if op, ok := r.mapKV(ev.Kv, ev.Type == mvccpb.DELETE); ok {
+				ops = append(ops, op)
+			}
+		}
+	}
+	if err = r.apply(ctx, ops, &Checkpoint{Revision: rev}); err != nil {
+		return err
+	}
+	atomic.StoreInt64(&r.rev, rev)
+	return nil
+}
+
+// replicatedFromPeer 判断源集群在rev的修改是否由反向复制器写入
+func (r *Replicator) replicatedFromPeer(ctx context.Context, rev int64) (bool, error) {
+	if r.cfg.IgnoreCheckpointKey == "" {
+		return false, nil
+	}
+	resp, err := r.src.Get(ctx, r.cfg.IgnoreCheckpointKey, clientv3.WithRev(rev))
+	if err != nil {
+		return false, err
+	}
+	return len(resp.Kvs) > 0 && resp.Kvs[0].ModRevision == rev, nil
+}
+
+// mapKV 替换前缀、改写key、过滤value并执行 Transform
+func (r *Replicator) mapKV(kv *mvccpb.KeyValue, del bool) (replOp, bool) {
+	if kv.Key == r.cfg.CheckpointKey || kv.Key == r.cfg.IgnoreCheckpointKey {
+		return replOp{}, false
+	}
+	if r.cfg.KeyFilter != nil && !r.cfg.KeyFilter(kv.Key) {
+		return replOp{}, false
+	}
+	op := replOp{key: r.cfg.DestPrefix + strings.TrimPrefix(kv.Key, r.cfg.Prefix), del: del}
+	for _, kr := range r.cfg.KeyRewrites {
+		op.key = kr.apply(op.key)
+	}
+	if !del {
+		op.val = kv.Value
+		if r.cfg.ValueFilter != nil && !r.cfg.ValueFilter(op.key, op.val) {
+			op.del, op.val = true, ""
+		}
+	}
+	if r.cfg.Transform != nil {
+		var ok bool
+		if op.key, op.val, ok = r.cfg.Transform(op.key, op.val); !ok {
+			return replOp{}, false
+		}
+	}
+	return op, true
+}
+
+// apply 把ops写入目标集群,最后一个事务同时写入进度cp
+func (r *Replicator) apply(ctx context.Context, ops []replOp, cp *Checkpoint) error {
+	for len(ops) > maxTxnOps-1 {
+		if err := r.applyTxn(ctx, ops[:maxTxnOps-1], nil); err != nil {
+			return err
+		}
+		ops = ops[maxTxnOps-1:]
+	}
+	return r.applyTxn(ctx, ops, cp)
+}
+
+func (r *Replicator) applyTxn(ctx context.Context, ops []replOp, cp *Checkpoint) error {
+	var cpOps []clientv3.Op
+	if cp != nil && r.cfg.CheckpointKey != "" {
+		data, err := json.Marshal(cp)
+		if err != nil {
+			return err
+		}
+		cpOps = append(cpOps, clientv3.OpPut(r.cfg.CheckpointKey, string(data)))
+	}
+	if len(ops) == 0 && len(cpOps) == 0 {
+		return nil
+	}
+
+	var cmps []clientv3.Cmp
+	txnOps := make([]clientv3.Op, 0, len(ops)+len(cpOps))
+	for _, op := range ops {
+		if r.cfg.Conflict == ConflictLastWriterWins {
+			cmps = append(cmps, r.notModifiedLocally(op.key))
+		}
+		txnOps = append(txnOps, op.op())
+	}
+	resp, err := r.dst.Txn(ctx).If(cmps...).Then(append(txnOps, cpOps...)...).Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		// 部分key被本地修改过,逐个写入未被修改的key
+		for _, op := range ops {
+			if resp, err = r.dst.Txn(ctx).If(r.notModifiedLocally(op.key)).Then(op.op()).Commit(); err != nil {
+				return err
+			}
+		}
+		if len(cpOps) > 0 {
+			if resp, err = r.dst.Txn(ctx).Then(cpOps...).Commit(); err != nil {
+				return err
+			}
+		}
+	}
+	r.lastDestRev = resp.Header.Revision
+	atomic.AddInt64(&r.count, int64(len(ops)))
+	return nil
+}
+
+func (r *Replicator) notModifiedLocally(key string) clientv3.Cmp {
+	return clientv3.Compare(clientv3.ModRevision(key), "<=", r.lastDestRev)
+}
+
+func (op replOp) op() clientv3.Op {
+	if op.del {
+		return clientv3.OpDelete(op.key)
+	}
+	return clientv3.OpPut(op.key, op.val)
+}
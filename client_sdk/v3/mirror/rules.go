@@ -0,0 +1,54 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mirror
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// KeyRewrite 把key中匹配 Pattern 的部分替换为 Replacement,Replacement 中可以使用 $1 等引用分组
+type KeyRewrite struct {
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+// ParseKeyRewrite 解析 "<regexp>=<replacement>" 形式的改写规则
+func ParseKeyRewrite(s string) (KeyRewrite, error) {
+	i := strings.LastIndex(s, "=")
+	if i <= 0 {
+		return KeyRewrite{}, fmt.Errorf("mirror: invalid key rewrite %q, expected <regexp>=<replacement>", s)
+	}
+	re, err := regexp.Compile(s[:i])
+	if err != nil {
+		return KeyRewrite{}, fmt.Errorf("mirror: invalid key rewrite %q: %v", s, err)
+	}
+	return KeyRewrite{Pattern: re, Replacement: s[i+1:]}, nil
+}
+
+func (kr KeyRewrite) apply(key string) string {
+	return kr.Pattern.ReplaceAllString(key, kr.Replacement)
+}
+
+// Progress 复制进度的快照
+type Progress struct {
+	// Count 已经复制的修改数
+	Count int64
+	// Revision 已经复制到的源集群revision
+	Revision int64
+	// Base 是否还在初始全量复制中
+	Base bool
+}
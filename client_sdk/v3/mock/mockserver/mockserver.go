@@ -186,3 +186,7 @@ func (m *mockKVServer) Txn(context.Context, *pb.TxnRequest) (*pb.TxnResponse, er
 func (m *mockKVServer) Compact(context.Context, *pb.CompactionRequest) (*pb.CompactionResponse, error) {
 	return &pb.CompactionResponse{}, nil
 }
+
+func (m *mockKVServer) StagedTxn(context.Context, *pb.StagedTxnRequest) (*pb.StagedTxnResponse, error) {
+	return &pb.StagedTxnResponse{}, nil
+}
@@ -40,4 +40,19 @@
 //	fmt.Printf("%s\n", resp.Kvs[0].Value)
 //	// Output: 456
 //
+// NewKVWithOptions additionally enforces client-side policies for libraries
+// that share a cluster between teams:
+//
+//	kv, err := namespace.NewKVWithOptions(cli.KV, "team-a/",
+//		namespace.WithStrictKeys(),
+//		namespace.WithQuota(namespace.Quota{
+//			MaxOps:     10000,
+//			MaxBytes:   64 << 20,
+//			Window:     time.Minute,
+//			OnExceeded: func(u namespace.QuotaUsage) { log.Printf("%s over quota: %+v", u.Prefix, u) },
+//		}))
+//
+// WithReadOnly rejects writes with ErrReadOnly. Quotas are soft by default:
+// OnExceeded is called but requests are still sent unless Quota.Hard is set.
+//
 package namespace
@@ -24,21 +24,25 @@ import (
 
 type kvPrefix struct {
 	clientv3.KV
-	pfx string
+	pfx    string
+	policy *policy
 }
 
 // NewKV wraps a KV instance so that all requests
 // are prefixed with a given string.
 func NewKV(kv clientv3.KV, prefix string) clientv3.KV {
-	return &kvPrefix{kv, prefix}
+	return &kvPrefix{KV: kv, pfx: prefix}
 }
 
 func (kv *kvPrefix) Put(ctx context.Context, key, val string, opts ...clientv3.OpOption) (*clientv3.PutResponse, error) {
 	if len(key) == 0 {
 		return nil, rpctypes.ErrEmptyKey
 	}
-	op := kv.prefixOp(clientv3.OpPut(key, val, opts...))
-	r, err := kv.KV.Do(ctx, op)
+	op := clientv3.OpPut(key, val, opts...)
+	if err := kv.policy.check(kv.pfx, op); err != nil {
+		return nil, err
+	}
+	r, err := kv.KV.Do(ctx, kv.prefixOp(op))
 	if err != nil {
 		return nil, err
 	}
@@ -51,7 +55,11 @@ func (kv *kvPrefix) Get(ctx context.Context, key string, opts ...clientv3.OpOpti
 	if len(key) == 0 && !(clientv3.IsOptsWithFromKey(opts) || clientv3.IsOptsWithPrefix(opts)) {
 		return nil, rpctypes.ErrEmptyKey
 	}
-	r, err := kv.KV.Do(ctx, kv.prefixOp(clientv3.OpGet(key, opts...)))
+	op := clientv3.OpGet(key, opts...)
+	if err := kv.policy.check(kv.pfx, op); err != nil {
+		return nil, err
+	}
+	r, err := kv.KV.Do(ctx, kv.prefixOp(op))
 	if err != nil {
 		return nil, err
 	}
@@ -64,7 +72,11 @@ func (kv *kvPrefix) Delete(ctx context.Context, key string, opts ...clientv3.OpO
 	if len(key) == 0 && !(clientv3.IsOptsWithFromKey(opts) || clientv3.IsOptsWithPrefix(opts)) {
 		return nil, rpctypes.ErrEmptyKey
 	}
-	r, err := kv.KV.Do(ctx, kv.prefixOp(clientv3.OpDelete(key, opts...)))
+	op := clientv3.OpDelete(key, opts...)
+	if err := kv.policy.check(kv.pfx, op); err != nil {
+		return nil, err
+	}
+	r, err := kv.KV.Do(ctx, kv.prefixOp(op))
 	if err != nil {
 		return nil, err
 	}
@@ -77,6 +89,9 @@ func (kv *kvPrefix) Do(ctx context.Context, op clientv3.Op) (clientv3.OpResponse
 	if len(op.KeyBytes()) == 0 && !op.IsTxn() {
 		return clientv3.OpResponse{}, rpctypes.ErrEmptyKey
 	}
+	if err := kv.policy.check(kv.pfx, op); err != nil {
+		return clientv3.OpResponse{}, err
+	}
 	r, err := kv.KV.Do(ctx, kv.prefixOp(op))
 	if err != nil {
 		return r, err
@@ -94,31 +109,48 @@ func (kv *kvPrefix) Do(ctx context.Context, op clientv3.Op) (clientv3.OpResponse
 	return r, nil
 }
 
+func (kv *kvPrefix) Compact(ctx context.Context, rev int64, opts ...clientv3.CompactOption) (*clientv3.CompactResponse, error) {
+	if err := kv.policy.checkCompact(); err != nil {
+		return nil, err
+	}
+	return kv.KV.Compact(ctx, rev, opts...)
+}
+
 type txnPrefix struct {
 	clientv3.Txn
 	kv *kvPrefix
+	// 未加前缀的条件和操作,提交前用于检查
+	cmps    []clientv3.Cmp
+	thenOps []clientv3.Op
+	elseOps []clientv3.Op
 }
 
 func (kv *kvPrefix) Txn(ctx context.Context) clientv3.Txn {
-	return &txnPrefix{kv.KV.Txn(ctx), kv}
+	return &txnPrefix{Txn: kv.KV.Txn(ctx), kv: kv}
 }
 
 func (txn *txnPrefix) If(cs ...clientv3.Cmp) clientv3.Txn {
+	txn.cmps = append(txn.cmps, cs...)
 	txn.Txn = txn.Txn.If(txn.kv.prefixCmps(cs)...)
 	return txn
 }
 
 func (txn *txnPrefix) Then(ops ...clientv3.Op) clientv3.Txn {
+	txn.thenOps = append(txn.thenOps, ops...)
 	txn.Txn = txn.Txn.Then(txn.kv.prefixOps(ops)...)
 	return txn
 }
 
 func (txn *txnPrefix) Else(ops ...clientv3.Op) clientv3.Txn {
+	txn.elseOps = append(txn.elseOps, ops...)
 	txn.Txn = txn.Txn.Else(txn.kv.prefixOps(ops)...)
 	return txn
 }
 
 func (txn *txnPrefix) Commit() (*clientv3.TxnResponse, error) {
+	if err := txn.kv.policy.check(txn.kv.pfx, clientv3.OpTxn(txn.cmps, txn.thenOps, txn.elseOps)); err != nil {
+		return nil, err
+	}
 	resp, err := txn.Txn.Commit()
 	if err != nil {
 		return nil, err
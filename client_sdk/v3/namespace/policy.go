@@ -0,0 +1,257 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package namespace
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	clientv3 "github.com/ls-2018/etcd_cn/client_sdk/v3"
+)
+
+var (
+	ErrReadOnly      = errors.New("namespace: read-only")
+	ErrQuotaExceeded = errors.New("namespace: quota exceeded")
+	ErrInvalidKey    = errors.New("namespace: invalid key")
+)
+
+// Option configures the KV returned by NewKVWithOptions.
+type Option func(*policy)
+
+// WithReadOnly rejects all writes and compactions with ErrReadOnly before
+// they are sent to the server.
+func WithReadOnly() Option {
+	return func(p *policy) { p.readOnly = true }
+}
+
+// WithQuota limits how much the namespace may use per window; see Quota.
+func WithQuota(q Quota) Option {
+	return func(p *policy) { p.quota = &quotaState{Quota: q} }
+}
+
+// WithStrictKeys requires the prefix to end with "/" and rejects keys that
+// could be mistaken for another namespace's keys: keys starting with "/",
+// keys with empty or ".." path segments and keys containing NUL bytes.
+func WithStrictKeys() Option {
+	return func(p *policy) { p.strictKeys = true }
+}
+
+// Quota is a client-side soft quota. Usage is charged before a request is
+// sent, so failed requests still count. When a budget is first exceeded in a
+// window OnExceeded is called; requests keep being sent unless Hard is set,
+// in which case they fail with ErrQuotaExceeded until the window resets.
+type Quota struct {
+	// MaxOps is the number of key operations per window; each operation in a
+	// transaction counts, and for transactions the larger branch is charged.
+	MaxOps int64
+	// MaxBytes is the number of key and value bytes written per window.
+	MaxBytes int64
+	// Window is how often usage resets. Zero means usage never resets.
+	Window time.Duration
+	// Hard rejects requests over budget instead of only reporting them.
+	Hard bool
+	// OnExceeded is called, without holding any lock, when a budget is exceeded.
+	OnExceeded func(QuotaUsage)
+}
+
+// QuotaUsage is the usage of a namespace in the current window.
+type QuotaUsage struct {
+	Prefix string
+	Ops    int64
+	Bytes  int64
+	Quota  Quota
+}
+
+func (q Quota) validate() error {
+	if q.MaxOps < 0 || q.MaxBytes < 0 || q.Window < 0 {
+		return fmt.Errorf("namespace: invalid quota %+v", q)
+	}
+	return nil
+}
+
+type quotaState struct {
+	Quota
+
+	mu       sync.Mutex
+	start    time.Time
+	ops      int64
+	bytes    int64
+	reported bool
+}
+
+// charge 记录一次请求的用量,超过硬配额时返回 ErrQuotaExceeded 且不计入
+func (q *quotaState) charge(pfx string, ops, bytes int64) error {
+	q.mu.Lock()
+	now := time.Now()
+	if q.start.IsZero() || (q.Window > 0 && now.Sub(q.start) >= q.Window) {
+		q.start, q.ops, q.bytes, q.reported = now, 0, 0, false
+	}
+	over := (q.MaxOps > 0 && q.ops+ops > q.MaxOps) || (q.MaxBytes > 0 && q.bytes+bytes > q.MaxBytes)
+	if !over || !q.Hard {
+		q.ops += ops
+		q.bytes += bytes
+	}
+	var report *QuotaUsage
+	if over && !q.reported {
+		q.reported = true
+		report = &QuotaUsage{Prefix: pfx, Ops: q.ops, Bytes: q.bytes, Quota: q.Quota}
+	}
+	q.mu.Unlock()
+
+	if report != nil && q.OnExceeded != nil {
+		q.OnExceeded(*report)
+	}
+	if over && q.Hard {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+// usage 当前周期内的用量
+func (q *quotaState) usage(pfx string) QuotaUsage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return QuotaUsage{Prefix: pfx, Ops: q.ops, Bytes: q.bytes, Quota: q.Quota}
+}
+
+// policy 在请求发出之前执行的客户端检查,nil表示不检查
+type policy struct {
+	readOnly   bool
+	strictKeys bool
+	quota      *quotaState
+}
+
+// NewKVWithOptions is like NewKV but also enforces the given options.
+func NewKVWithOptions(kv clientv3.KV, prefix string, opts ...Option) (clientv3.KV, error) {
+	p := &policy{}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if p.strictKeys && !strings.HasSuffix(prefix, "/") {
+		return nil, fmt.Errorf("namespace: prefix %q must end with \"/\"", prefix)
+	}
+	if p.quota != nil {
+		if err := p.quota.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return &kvPrefix{KV: kv, pfx: prefix, policy: p}, nil
+}
+
+// QuotaUsageOf returns the quota usage of a KV created by NewKVWithOptions
+// with WithQuota. ok is false for any other KV.
+func QuotaUsageOf(kv clientv3.KV) (u QuotaUsage, ok bool) {
+	kp, isPrefix := kv.(*kvPrefix)
+	if !isPrefix || kp.policy == nil || kp.policy.quota == nil {
+		return QuotaUsage{}, false
+	}
+	return kp.policy.quota.usage(kp.pfx), true
+}
+
+// check 在发送op之前检查并计入配额
+func (p *policy) check(pfx string, op clientv3.Op) error {
+	if p == nil {
+		return nil
+	}
+	if err := p.validate(op); err != nil {
+		return err
+	}
+	if p.quota == nil {
+		return nil
+	}
+	ops, bytes := opUsage(op)
+	return p.quota.charge(pfx, ops, bytes)
+}
+
+func (p *policy) checkCompact() error {
+	if p != nil && p.readOnly {
+		return ErrReadOnly
+	}
+	return nil
+}
+
+func (p *policy) validate(op clientv3.Op) error {
+	if !op.IsTxn() {
+		if p.readOnly && (op.IsPut() || op.IsDelete()) {
+			return ErrReadOnly
+		}
+		return p.validateKey(string(op.KeyBytes()), len(op.RangeBytes()) > 0)
+	}
+	cmps, thenOps, elseOps := op.Txn()
+	if err := p.validateCmps(cmps); err != nil {
+		return err
+	}
+	for _, ops := range [][]clientv3.Op{thenOps, elseOps} {
+		for _, o := range ops {
+			if err := p.validate(o); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p *policy) validateCmps(cmps []clientv3.Cmp) error {
+	for i := range cmps {
+		if err := p.validateKey(string(cmps[i].KeyBytes()), cmps[i].RangeEnd != ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateKey 检查key不会被误认为其他namespace的key; 范围请求允许从namespace的开头开始
+func (p *policy) validateKey(key string, isRange bool) error {
+	if !p.strictKeys || (isRange && (key == "" || key == "\x00")) {
+		return nil
+	}
+	if strings.HasPrefix(key, "/") || strings.ContainsRune(key, 0) {
+		return fmt.Errorf("%w %q", ErrInvalidKey, key)
+	}
+	for _, seg := range strings.Split(strings.TrimSuffix(key, "/"), "/") {
+		if seg == "" || seg == ".." {
+			return fmt.Errorf("%w %q", ErrInvalidKey, key)
+		}
+	}
+	return nil
+}
+
+// opUsage 返回op计入配额的操作数和写入字节数;事务按较大的分支计算
+func opUsage(op clientv3.Op) (ops, bytes int64) {
+	if !op.IsTxn() {
+		if op.IsPut() {
+			return 1, int64(len(op.KeyBytes()) + len(op.ValueBytes()))
+		}
+		return 1, 0
+	}
+	_, thenOps, elseOps := op.Txn()
+	for _, branch := range [][]clientv3.Op{thenOps, elseOps} {
+		var o, b int64
+		for _, bop := range branch {
+			oo, bb := opUsage(bop)
+			o, b = o+oo, b+bb
+		}
+		if o > ops {
+			ops = o
+		}
+		if b > bytes {
+			bytes = b
+		}
+	}
+	return ops, bytes
+}
@@ -16,6 +16,7 @@ package namespace
 
 import (
 	"context"
+	"strings"
 	"sync"
 
 	clientv3 "github.com/ls-2018/etcd_cn/client_sdk/v3"
@@ -46,6 +47,9 @@ func (w *watcherPrefix) Watch(ctx context.Context, key string, opts ...clientv3.
 	if pfxEnd != nil {
 		opts = append(opts, clientv3.WithRange(string(pfxEnd)))
 	}
+	if glob := op.KeyGlob(); glob != "" {
+		opts = append(opts, clientv3.WithKeyGlob(escapeGlob(w.pfx)+glob))
+	}
 
 	wch := w.Watcher.Watch(ctx, string(pfxBegin), opts...)
 
@@ -82,3 +86,16 @@ func (w *watcherPrefix) Close() error {
 	w.wg.Wait()
 	return err
 }
+
+// escapeGlob 转义s中的glob元字符,使它在path.Match中只匹配自身
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		switch c {
+		case '*', '?', '[', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
@@ -17,6 +17,8 @@
 //		information from etcd.
 //	- subpackage resolver: an etcd-backed gRPC resolver for discovering gRPC
 //		services based on the endpoints configuration
+//	- subpackage registry: a service registry that keeps instance records
+//		alive with a lease and resolves or watches the live instances
 //
 // To use, first import the packages:
 //
@@ -0,0 +1,244 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package registry registers service instances in etcd and discovers them.
+//
+// Instances are stored with the endpoints package's format under
+// "<service>/<instance id>", so they can also be dialed through the
+// naming/resolver gRPC resolver:
+//
+//	reg, _ := registry.New(cli)
+//	r, _ := reg.Register(ctx, "greeter", registry.Instance{ID: "a", Addr: "10.0.0.1:50051"}, 10)
+//	defer r.Close()
+//
+//	b, _ := reg.ResolverBuilder()
+//	conn, _ := grpc.Dial("etcd:///greeter", grpc.WithResolvers(b))
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	clientv3 "github.com/ls-2018/etcd_cn/client_sdk/v3"
+	"github.com/ls-2018/etcd_cn/client_sdk/v3/concurrency"
+	"github.com/ls-2018/etcd_cn/client_sdk/v3/naming/endpoints"
+	"github.com/ls-2018/etcd_cn/client_sdk/v3/naming/resolver"
+	gresolver "google.golang.org/grpc/resolver"
+)
+
+var ErrClosed = errors.New("registry: registration closed")
+
+// Instance is one live instance of a service.
+type Instance struct {
+	ID       string
+	Addr     string
+	Metadata map[string]string
+}
+
+// Registry registers and discovers service instances.
+type Registry struct {
+	c *clientv3.Client
+}
+
+// New creates a registry backed by c.
+func New(c *clientv3.Client) (*Registry, error) {
+	if c == nil {
+		return nil, errors.New("registry: invalid etcd client")
+	}
+	return &Registry{c: c}, nil
+}
+
+// Registration keeps an instance record alive until it is closed.
+type Registration struct {
+	service string
+	key     string
+	em      endpoints.Manager
+	s       *concurrency.Session
+
+	mu   sync.Mutex
+	inst Instance
+}
+
+// Register stores inst under service with a lease of ttl seconds and keeps
+// it alive. If the lease is lost, for example after a partition longer than
+// ttl, a new lease is granted and the record is written again.
+func (r *Registry) Register(ctx context.Context, service string, inst Instance, ttl int) (*Registration, error) {
+	if err := validName(service); err != nil {
+		return nil, err
+	}
+	if err := validName(inst.ID); err != nil {
+		return nil, err
+	}
+	em, err := endpoints.NewManager(r.c, service)
+	if err != nil {
+		return nil, err
+	}
+	s, err := concurrency.NewSession(r.c, concurrency.WithTTL(ttl), concurrency.WithResurrect(0))
+	if err != nil {
+		return nil, err
+	}
+	reg := &Registration{service: service, key: service + "/" + inst.ID, em: em, s: s, inst: inst}
+	if err := reg.put(ctx, s.Lease()); err != nil {
+		s.Close()
+		return nil, err
+	}
+	s.RegisterEphemeral(reg.put)
+	return reg, nil
+}
+
+func (reg *Registration) put(ctx context.Context, lease clientv3.LeaseID) error {
+	reg.mu.Lock()
+	ep := toEndpoint(reg.inst)
+	reg.mu.Unlock()
+	return reg.em.AddEndpoint(ctx, reg.key, ep, clientv3.WithLease(lease))
+}
+
+// Update replaces the instance's metadata.
+func (reg *Registration) Update(ctx context.Context, md map[string]string) error {
+	select {
+	case <-reg.s.Done():
+		return ErrClosed
+	default:
+	}
+	reg.mu.Lock()
+	reg.inst.Metadata = md
+	reg.mu.Unlock()
+	return reg.put(ctx, reg.s.Lease())
+}
+
+// Instance returns the registered instance.
+func (reg *Registration) Instance() Instance {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	return reg.inst
+}
+
+// Close removes the instance record and stops keeping it alive.
+func (reg *Registration) Close() error { return reg.s.Close() }
+
+// Resolve returns the live instances of service sorted by ID.
+func (r *Registry) Resolve(ctx context.Context, service string) ([]Instance, error) {
+	em, err := endpoints.NewManager(r.c, service)
+	if err != nil {
+		return nil, err
+	}
+	eps, err := em.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	insts := make(map[string]Instance, len(eps))
+	for k, ep := range eps {
+		insts[k] = toInstance(service, k, ep)
+	}
+	return sortedInstances(insts), nil
+}
+
+// Watch sends the full set of live instances of service, sorted by ID, first
+// immediately and then after every change, until ctx is canceled.
+func (r *Registry) Watch(ctx context.Context, service string) (<-chan []Instance, error) {
+	em, err := endpoints.NewManager(r.c, service)
+	if err != nil {
+		return nil, err
+	}
+	wch, err := em.NewWatchChannel(ctx)
+	if err != nil {
+		return nil, err
+	}
+	insts := make(map[string]Instance)
+	apply := func(ups []*endpoints.Update) {
+		for _, up := range ups {
+			switch up.Op {
+			case endpoints.Add:
+				insts[up.Key] = toInstance(service, up.Key, up.Endpoint)
+			case endpoints.Delete:
+				delete(insts, up.Key)
+			}
+		}
+	}
+	// 已有的实例在返回前就放入了wch;没有实例时不会有初始更新
+	select {
+	case ups := <-wch:
+		apply(ups)
+	default:
+	}
+	ch := make(chan []Instance, 1)
+	ch <- sortedInstances(insts)
+	go func() {
+		defer close(ch)
+		for ups := range wch {
+			apply(ups)
+			// 只保留最新的实例列表
+			select {
+			case <-ch:
+			default:
+			}
+			select {
+			case ch <- sortedInstances(insts):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// ResolverBuilder returns a gRPC resolver builder for the "etcd" scheme that
+// resolves "etcd:///<service>" to the service's live instances.
+func (r *Registry) ResolverBuilder() (gresolver.Builder, error) {
+	return resolver.NewBuilder(r.c)
+}
+
+func validName(name string) error {
+	if name == "" || strings.Contains(name, "/") {
+		return fmt.Errorf("registry: invalid name %q", name)
+	}
+	return nil
+}
+
+func toEndpoint(inst Instance) endpoints.Endpoint {
+	ep := endpoints.Endpoint{Addr: inst.Addr}
+	if len(inst.Metadata) > 0 {
+		ep.Metadata = inst.Metadata
+	}
+	return ep
+}
+
+// toInstance 元数据经过JSON编码后是 map[string]interface{}
+func toInstance(service, key string, ep endpoints.Endpoint) Instance {
+	inst := Instance{ID: strings.TrimPrefix(key, service+"/"), Addr: ep.Addr}
+	if md, ok := ep.Metadata.(map[string]interface{}); ok {
+		inst.Metadata = make(map[string]string, len(md))
+		for k, v := range md {
+			if s, ok := v.(string); ok {
+				inst.Metadata[k] = s
+			} else {
+				inst.Metadata[k] = fmt.Sprint(v)
+			}
+		}
+	}
+	return inst
+}
+
+func sortedInstances(m map[string]Instance) []Instance {
+	insts := make([]Instance, 0, len(m))
+	for _, inst := range m {
+		insts = append(insts, inst)
+	}
+	sort.Slice(insts, func(i, j int) bool { return insts[i].ID < insts[j].ID })
+	return insts
+}
@@ -0,0 +1,99 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package observability
+
+import (
+	"time"
+
+	v3 "github.com/ls-2018/etcd_cn/client_sdk/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/codes"
+)
+
+// Prometheus 是 clientv3.MetricsHook 的Prometheus实现,同时也是 prometheus.Collector
+type Prometheus struct {
+	requestDuration   *prometheus.HistogramVec
+	watchLag          prometheus.Histogram
+	keepAlives        *prometheus.CounterVec
+	keepAliveTimeouts prometheus.Counter
+}
+
+var _ v3.MetricsHook = (*Prometheus)(nil)
+
+// NewPrometheus 创建指标,需要调用方注册到 prometheus.Registerer
+func NewPrometheus(namespace string) *Prometheus {
+	return &Prometheus{
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "client",
+			Name:      "request_duration_seconds",
+			Help:      "The latency distributions of unary requests by method, endpoint and gRPC code.",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 16),
+		}, []string{"method", "endpoint", "code"}),
+		watchLag: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "client",
+			Name:      "watch_event_lag_revisions",
+			Help:      "The number of revisions between the store revision and received watch events.",
+			Buckets:   prometheus.ExponentialBuckets(1, 4, 10),
+		}),
+		keepAlives: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "client",
+			Name:      "lease_keepalive_responses_total",
+			Help:      "The total number of lease keepalive responses, by whether the lease was alive.",
+		}, []string{"result"}),
+		keepAliveTimeouts: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "client",
+			Name:      "lease_keepalive_timeouts_total",
+			Help:      "The total number of leases that got no keepalive response within their TTL.",
+		}),
+	}
+}
+
+func (p *Prometheus) ObserveRequest(method, endpoint string, code codes.Code, d time.Duration) {
+	p.requestDuration.WithLabelValues(method, endpoint, code.String()).Observe(d.Seconds())
+}
+
+func (p *Prometheus) ObserveWatchLag(lag int64) {
+	p.watchLag.Observe(float64(lag))
+}
+
+func (p *Prometheus) ObserveKeepAlive(_ v3.LeaseID, ttl int64) {
+	if ttl <= 0 {
+		p.keepAlives.WithLabelValues("expired").Inc()
+		return
+	}
+	p.keepAlives.WithLabelValues("alive").Inc()
+}
+
+func (p *Prometheus) ObserveKeepAliveTimeout(v3.LeaseID) {
+	p.keepAliveTimeouts.Inc()
+}
+
+func (p *Prometheus) Describe(ch chan<- *prometheus.Desc) {
+	p.requestDuration.Describe(ch)
+	p.watchLag.Describe(ch)
+	p.keepAlives.Describe(ch)
+	p.keepAliveTimeouts.Describe(ch)
+}
+
+func (p *Prometheus) Collect(ch chan<- prometheus.Metric) {
+	p.requestDuration.Collect(ch)
+	p.watchLag.Collect(ch)
+	p.keepAlives.Collect(ch)
+	p.keepAliveTimeouts.Collect(ch)
+}
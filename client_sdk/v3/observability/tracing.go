@@ -0,0 +1,55 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package observability
+
+import (
+	"context"
+	"strings"
+
+	v3 "github.com/ls-2018/etcd_cn/client_sdk/v3"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/status"
+)
+
+const instrumentationName = "github.com/ls-2018/etcd_cn/client_sdk/v3"
+
+// Tracer 是 clientv3.TraceHook 的OpenTelemetry实现
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+var _ v3.TraceHook = (*Tracer)(nil)
+
+func NewTracer(tp trace.TracerProvider) *Tracer {
+	return &Tracer{tracer: tp.Tracer(instrumentationName)}
+}
+
+func (t *Tracer) StartRequest(ctx context.Context, method string) (context.Context, func(error)) {
+	// /etcdserverpb.KV/Range -> etcdserverpb.KV/Range
+	name := strings.TrimPrefix(method, "/")
+	ctx, span := t.tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("rpc.system", "grpc"), attribute.String("rpc.method", name)),
+	)
+	return ctx, func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(otelcodes.Error, status.Code(err).String())
+		}
+		span.End()
+	}
+}
@@ -16,6 +16,7 @@ package clientv3
 
 import (
 	"fmt"
+	"time"
 
 	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
 )
@@ -46,6 +47,8 @@ type Op struct {
 	maxModRev    int64
 	minCreateRev int64
 	maxCreateRev int64
+	// snapshotToken 在快照会话固定的修订版本上读取
+	snapshotToken string
 
 	// for range, watch
 	rev int64
@@ -67,6 +70,17 @@ type Op struct {
 	filterPut      bool // 过滤掉put事件
 	filterDelete   bool // 过滤掉delete事件
 
+	filterUnchanged bool   // 过滤掉没有改变value的put事件
+	keyGlob         string // 只接收key匹配glob模式的事件
+	keyRegex        string // 只接收key匹配正则表达式的事件
+
+	batchSize  int           // 合并后每个响应最多的事件数
+	batchDelay time.Duration // 合并事件时最多等待的时间
+	backlog    *WatchBacklog // 记录尚未被消费的响应
+
+	projections []string // 服务端只返回value的这些JSONPath投影
+	valueHash   bool     // 服务端只返回value的sha256摘要
+
 	// for put
 	val     string
 	leaseID LeaseID
@@ -75,6 +89,9 @@ type Op struct {
 	cmps    []Cmp
 	thenOps []Op
 	elseOps []Op
+
+	// for put, txn
+	idempotencyToken string
 }
 
 // accessors / mutators
@@ -101,6 +118,12 @@ func (op Op) RangeBytes() []byte { return []byte(op.end) }
 // Rev returns the requested revision, if any.
 func (op Op) Rev() int64 { return op.rev }
 
+// Limit returns the maximum number of keys to return, if any.
+func (op Op) Limit() int64 { return op.limit }
+
+// Sort returns the sort option of the range, if any.
+func (op Op) Sort() *SortOption { return op.sort }
+
 // IsPut returns true iff the operation is a Put.
 func (op Op) IsPut() bool { return op.t == tPut }
 
@@ -119,6 +142,12 @@ func (op Op) IsKeysOnly() bool { return op.keysOnly }
 // IsCountOnly returns whether countOnly is set.
 func (op Op) IsCountOnly() bool { return op.countOnly }
 
+// SnapshotToken returns the snapshot session the range is served at, if any.
+func (op Op) SnapshotToken() string { return op.snapshotToken }
+
+// KeyGlob returns the glob pattern watched keys must match, if any.
+func (op Op) KeyGlob() string { return op.keyGlob }
+
 // MinModRev returns the operation's minimum modify revision.
 func (op Op) MinModRev() int64 { return op.minModRev }
 
@@ -158,6 +187,7 @@ func (op Op) toRangeRequest() *pb.RangeRequest {
 		MaxModRevision:    op.maxModRev,
 		MinCreateRevision: op.minCreateRev,
 		MaxCreateRevision: op.maxCreateRev,
+		SnapshotToken:     op.snapshotToken,
 	}
 	if op.sort != nil {
 		r.SortOrder = pb.RangeRequest_SortOrder(op.sort.Order)
@@ -179,7 +209,7 @@ func (op Op) toTxnRequest() *pb.TxnRequest {
 	for i := range op.cmps {
 		cmps[i] = (*pb.Compare)(&op.cmps[i])
 	}
-	return &pb.TxnRequest{Compare: cmps, Success: thenOps, Failure: elseOps}
+	return &pb.TxnRequest{Compare: cmps, Success: thenOps, Failure: elseOps, IdempotencyToken: op.idempotencyToken}
 }
 
 func (op Op) toRequestOp() *pb.RequestOp {
@@ -257,6 +287,8 @@ func OpDelete(key string, opts ...OpOption) Op {
 		panic("unexpected filter in delete")
 	case ret.createdNotify:
 		panic("unexpected createdNotify in delete")
+	case ret.snapshotToken != "":
+		panic("unexpected snapshot token in delete")
 	}
 	return ret
 }
@@ -286,6 +318,8 @@ func OpPut(key, val string, opts ...OpOption) Op {
 		panic("unexpected filter in put")
 	case ret.createdNotify:
 		panic("unexpected createdNotify in put")
+	case ret.snapshotToken != "":
+		panic("unexpected snapshot token in put")
 	}
 	return ret
 }
@@ -314,6 +348,10 @@ func opWatch(key string, opts ...OpOption) Op {
 		panic("unexpected watch中不能过滤修订版本")
 	case ret.minCreateRev != 0, ret.maxCreateRev != 0:
 		panic("unexpected watch中不能过滤创建时的修订版本")
+	case ret.snapshotToken != "":
+		panic("unexpected watch中不能使用快照会话")
+	case len(ret.projections) != 0 && ret.valueHash:
+		panic("unexpected watch中不能同时使用projections和value hash")
 	}
 	return ret
 }
@@ -417,6 +455,13 @@ func WithSerializable() OpOption {
 	return func(op *Op) { op.serializable = true }
 }
 
+// WithSnapshotToken serves a 'Get' request at the revision pinned by the
+// snapshot session, see Maintenance.SnapshotSession. The request fails once
+// the session expires or is released.
+func WithSnapshotToken(token string) OpOption {
+	return func(op *Op) { op.snapshotToken = token }
+}
+
 // WithKeysOnly makes the 'Get' request return only the keys and the corresponding
 // values will be omitted.
 func WithKeysOnly() OpOption {
@@ -481,6 +526,26 @@ func WithFilterPut() OpOption {
 	return func(op *Op) { op.filterPut = true }
 }
 
+// WithFilterUnchanged discards PUT events that do not change the value of
+// the key from the watcher.
+func WithFilterUnchanged() OpOption {
+	return func(op *Op) { op.filterUnchanged = true }
+}
+
+// WithKeyGlob discards events whose key does not match the glob pattern from
+// the watcher. The pattern syntax is that of path.Match, so '*' does not
+// match '/'.
+func WithKeyGlob(pattern string) OpOption {
+	return func(op *Op) { op.keyGlob = pattern }
+}
+
+// WithKeyRegex discards events whose key does not match the regular
+// expression from the watcher. The expression is matched against the key as
+// stored by the server, including any namespace prefix.
+func WithKeyRegex(expr string) OpOption {
+	return func(op *Op) { op.keyRegex = expr }
+}
+
 // WithFilterDelete discards DELETE events from the watcher.
 func WithFilterDelete() OpOption {
 	return func(op *Op) { op.filterDelete = true }
@@ -505,6 +570,21 @@ func WithFragment() OpOption {
 	return func(op *Op) { op.fragment = true }
 }
 
+// WithProjections makes the server deliver, instead of the full value of
+// each watched key-value and its previous key-value, a JSON object mapping
+// every given JSONPath expression (e.g. "$.status.phase") to the element it
+// selects in the JSON value, or null if there is no such element.
+// It cannot be combined with WithValueHash.
+func WithProjections(paths ...string) OpOption {
+	return func(op *Op) { op.projections = append(op.projections, paths...) }
+}
+
+// WithValueHash makes the server deliver the hex encoded sha256 hash of each
+// watched value instead of the value itself.
+func WithValueHash() OpOption {
+	return func(op *Op) { op.valueHash = true }
+}
+
 // WithIgnoreValue updates the key using its current value.
 // This option can not be combined with non-empty values.
 // Returns an error if the key does not exist.
@@ -523,12 +603,29 @@ func WithIgnoreLease() OpOption {
 	}
 }
 
+// WithIdempotencyToken makes the server apply a put or txn with this token at most once.
+// Retries carrying the same token get the response of the first apply.
+func WithIdempotencyToken(token string) OpOption {
+	return func(op *Op) {
+		op.idempotencyToken = token
+	}
+}
+
 // LeaseOp represents an Operation that lease can execute.
 type LeaseOp struct {
 	id LeaseID
 
 	// for TimeToLive
 	attachedKeys bool
+
+	// for Grant
+	parent   LeaseID
+	metadata string
+
+	// for WatchLeases
+	idPrefix       string
+	metadataPrefix string
+	eventTypes     []pb.LeaseEvent_EventType
 }
 
 // LeaseOption configures lease operations.
@@ -545,12 +642,49 @@ func WithAttachedKeys() LeaseOption {
 	return func(op *LeaseOp) { op.attachedKeys = true }
 }
 
+// WithLeaseParent makes Grant create the lease as a child of the given lease.
+func WithLeaseParent(parent LeaseID) LeaseOption {
+	return func(op *LeaseOp) { op.parent = parent }
+}
+
+// WithLeaseMetadata attaches an opaque metadata blob (e.g. owner service name) to the granted lease.
+func WithLeaseMetadata(metadata string) LeaseOption {
+	return func(op *LeaseOp) { op.metadata = metadata }
+}
+
+// WithLeaseIDPrefix makes WatchLeases only return events of leases whose hex ID starts with the prefix.
+func WithLeaseIDPrefix(prefix string) LeaseOption {
+	return func(op *LeaseOp) { op.idPrefix = prefix }
+}
+
+// WithLeaseMetadataPrefix makes WatchLeases only return events of leases whose metadata starts with the prefix.
+func WithLeaseMetadataPrefix(prefix string) LeaseOption {
+	return func(op *LeaseOp) { op.metadataPrefix = prefix }
+}
+
+// WithLeaseEventTypes makes WatchLeases only return events of the given types.
+func WithLeaseEventTypes(types ...pb.LeaseEvent_EventType) LeaseOption {
+	return func(op *LeaseOp) { op.eventTypes = types }
+}
+
+func toLeaseGrantRequest(ttl int64, opts ...LeaseOption) *pb.LeaseGrantRequest {
+	ret := &LeaseOp{}
+	ret.applyOpts(opts)
+	return &pb.LeaseGrantRequest{TTL: ttl, Parent: int64(ret.parent), Metadata: ret.metadata}
+}
+
 func toLeaseTimeToLiveRequest(id LeaseID, opts ...LeaseOption) *pb.LeaseTimeToLiveRequest {
 	ret := &LeaseOp{id: id}
 	ret.applyOpts(opts)
 	return &pb.LeaseTimeToLiveRequest{ID: int64(id), Keys: ret.attachedKeys}
 }
 
+func toLeaseWatchRequest(opts ...LeaseOption) *pb.LeaseWatchRequest {
+	ret := &LeaseOp{}
+	ret.applyOpts(opts)
+	return &pb.LeaseWatchRequest{IDPrefix: ret.idPrefix, MetadataPrefix: ret.metadataPrefix, Types: ret.eventTypes}
+}
+
 // IsOptsWithPrefix returns true if WithPrefix option is called in the given opts.
 func IsOptsWithPrefix(opts []OpOption) bool { return isOpFuncCalled("WithPrefix", opts) }
 
@@ -0,0 +1,112 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package projection
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DirSink writes each key to a file under Dir, with "/" in keys creating
+// subdirectories. Every snapshot is written to a new directory next to Dir
+// and Dir, a symlink, is then switched to it atomically, so readers never
+// see a partially written tree. Dir must not exist or be a symlink.
+type DirSink struct {
+	Dir string
+	// FileMode defaults to 0644.
+	FileMode os.FileMode
+}
+
+func (d *DirSink) Apply(s Snapshot) error {
+	mode := d.FileMode
+	if mode == 0 {
+		mode = 0o644
+	}
+	parent, base := filepath.Split(filepath.Clean(d.Dir))
+	if parent == "" {
+		parent = "."
+	}
+	if fi, err := os.Lstat(d.Dir); err == nil && fi.Mode()&os.ModeSymlink == 0 {
+		return fmt.Errorf("projection: %s exists and is not a symlink", d.Dir)
+	}
+
+	data, err := ioutil.TempDir(parent, fmt.Sprintf(".%s-%d-", base, s.Revision))
+	if err != nil {
+		return err
+	}
+	if err := writeTree(data, s, mode); err != nil {
+		os.RemoveAll(data)
+		return err
+	}
+	// TempDir 创建的目录权限是0700
+	if err := os.Chmod(data, 0o755); err != nil {
+		os.RemoveAll(data)
+		return err
+	}
+
+	old, _ := os.Readlink(d.Dir)
+	tmp := filepath.Join(parent, "."+base+".link")
+	os.Remove(tmp)
+	if err := os.Symlink(filepath.Base(data), tmp); err != nil {
+		os.RemoveAll(data)
+		return err
+	}
+	if err := os.Rename(tmp, d.Dir); err != nil {
+		os.Remove(tmp)
+		os.RemoveAll(data)
+		return err
+	}
+	if old != "" && old != filepath.Base(data) {
+		if !filepath.IsAbs(old) {
+			old = filepath.Join(parent, old)
+		}
+		os.RemoveAll(old)
+	}
+	return nil
+}
+
+func writeTree(root string, s Snapshot, mode os.FileMode) error {
+	for _, k := range s.Keys() {
+		if strings.HasSuffix(k, "/") {
+			// 目录形式的key没有对应的文件
+			continue
+		}
+		rel, err := safePath(k)
+		if err != nil {
+			return err
+		}
+		p := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(p, []byte(s.Values[k]), mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// safePath 将key转换为相对路径,拒绝可能写到目录之外的key
+func safePath(key string) (string, error) {
+	for _, seg := range strings.Split(key, "/") {
+		if seg == "" || seg == "." || seg == ".." {
+			return "", fmt.Errorf("projection: key %q cannot be used as a file path", key)
+		}
+	}
+	return filepath.FromSlash(key), nil
+}
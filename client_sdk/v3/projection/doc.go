@@ -0,0 +1,33 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package projection keeps a local copy of a key prefix up to date so that
+// applications without etcd support can consume configuration from etcd.
+//
+// A Projector watches the prefix, resuming after disconnects and reloading
+// after compaction, and hands every new snapshot to its sinks:
+//
+//	p, _ := projection.New(cli, projection.Config{
+//		Prefix: "config/app/",
+//		Sinks: []projection.Sink{
+//			// config/app/db/host => /etc/app/db/host, swapped in atomically
+//			&projection.DirSink{Dir: "/etc/app"},
+//			// rendered with text/template, e.g. {{.Get "db/host"}}
+//			&projection.TemplateSink{Path: "/etc/app.conf", Template: tmpl},
+//		},
+//	})
+//	go p.Run(ctx)
+//
+// A ValueSink decodes snapshots into a value that can be reloaded in process.
+package projection
@@ -0,0 +1,236 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package projection
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	clientv3 "github.com/ls-2018/etcd_cn/client_sdk/v3"
+	"github.com/ls-2018/etcd_cn/offical/api/v3/v3rpc/rpctypes"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultDebounce   = 100 * time.Millisecond
+	defaultRetryDelay = time.Second
+)
+
+// Snapshot is the content of the prefix at a revision, keyed by the key with
+// the prefix removed.
+type Snapshot struct {
+	Revision int64
+	Values   map[string]string
+}
+
+// Keys returns the keys of s in order.
+func (s Snapshot) Keys() []string {
+	keys := make([]string, 0, len(s.Values))
+	for k := range s.Values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Sink consumes snapshots. Apply is called with the full snapshot after
+// every change, so it must not assume it sees every revision.
+type Sink interface {
+	Apply(s Snapshot) error
+}
+
+// Config configures a Projector.
+type Config struct {
+	// Prefix is the key prefix to project.
+	Prefix string
+	Sinks  []Sink
+	// Debounce delays applying changes so that bursts are applied once.
+	// Defaults to 100ms.
+	Debounce time.Duration
+	// RetryDelay is how long to wait before re-watching or re-applying after
+	// a failure. Defaults to 1s.
+	RetryDelay time.Duration
+	// OnError is called when reading etcd or applying a sink fails. The
+	// projector keeps running.
+	OnError func(error)
+}
+
+// Projector projects a prefix into its sinks.
+type Projector struct {
+	c   *clientv3.Client
+	cfg Config
+	lg  *zap.Logger
+
+	mu   sync.Mutex
+	snap Snapshot
+
+	// retry 上次应用sink失败,需要重新应用; 只在Run中使用
+	retry bool
+}
+
+// New creates a projector; call Run to start it.
+func New(c *clientv3.Client, cfg Config) (*Projector, error) {
+	if cfg.Prefix == "" {
+		return nil, errors.New("projection: empty prefix")
+	}
+	if len(cfg.Sinks) == 0 {
+		return nil, errors.New("projection: no sinks")
+	}
+	if cfg.Debounce <= 0 {
+		cfg.Debounce = defaultDebounce
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = defaultRetryDelay
+	}
+	return &Projector{c: c, cfg: cfg, lg: c.GetLogger()}, nil
+}
+
+// Snapshot returns the last snapshot read from etcd.
+func (p *Projector) Snapshot() Snapshot {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.snap
+}
+
+// Run projects the prefix until ctx is canceled and returns ctx's error.
+func (p *Projector) Run(ctx context.Context) error {
+	values := make(map[string]string)
+	var rev int64
+	for {
+		if rev == 0 {
+			// 首次启动或者被压缩后重新读取全部数据
+			var err error
+			if values, rev, err = p.load(ctx); err != nil {
+				p.fail(err)
+				if !sleep(ctx, p.cfg.RetryDelay) {
+					return ctx.Err()
+				}
+				continue
+			}
+			p.publish(values, rev)
+		}
+		var err error
+		if rev, err = p.watch(ctx, values, rev); err != nil && ctx.Err() == nil {
+			p.fail(err)
+		}
+		if !sleep(ctx, p.cfg.RetryDelay) {
+			return ctx.Err()
+		}
+	}
+}
+
+func (p *Projector) load(ctx context.Context) (map[string]string, int64, error) {
+	resp, err := p.c.Get(ctx, p.cfg.Prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, 0, err
+	}
+	values := make(map[string]string, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		values[strings.TrimPrefix(kv.Key, p.cfg.Prefix)] = kv.Value
+	}
+	return values, resp.Header.Revision, nil
+}
+
+// watch 从rev之后开始监听并更新values,返回已经应用的revision;返回0表示需要重新读取
+func (p *Projector) watch(ctx context.Context, values map[string]string, rev int64) (int64, error) {
+	wctx, cancel := context.WithCancel(clientv3.WithRequireLeader(ctx))
+	defer cancel()
+	wch := p.c.Watch(wctx, p.cfg.Prefix, clientv3.WithPrefix(), clientv3.WithRev(rev+1))
+
+	var debounce <-chan time.Time
+	pending := false
+	if p.retry {
+		pending, debounce = true, time.After(p.cfg.RetryDelay)
+	}
+	for {
+		select {
+		case wresp, ok := <-wch:
+			if !ok {
+				if pending {
+					p.publish(values, rev)
+				}
+				return rev, ctx.Err()
+			}
+			if err := wresp.Err(); err != nil {
+				if err == rpctypes.ErrCompacted {
+					return 0, err
+				}
+				if pending {
+					p.publish(values, rev)
+				}
+				return rev, err
+			}
+			for _, ev := range wresp.Events {
+				k := strings.TrimPrefix(ev.Kv.Key, p.cfg.Prefix)
+				if ev.Type == clientv3.EventTypeDelete {
+					delete(values, k)
+				} else {
+					values[k] = ev.Kv.Value
+				}
+			}
+			if len(wresp.Events) > 0 {
+				rev = wresp.Events[len(wresp.Events)-1].Kv.ModRevision
+				if !pending {
+					pending, debounce = true, time.After(p.cfg.Debounce)
+				}
+			}
+		case <-debounce:
+			pending, debounce = false, nil
+			if p.publish(values, rev); p.retry {
+				pending, debounce = true, time.After(p.cfg.RetryDelay)
+			}
+		case <-ctx.Done():
+			return rev, nil
+		}
+	}
+}
+
+// publish 保存快照并应用到所有sink,有sink失败时设置 p.retry
+func (p *Projector) publish(values map[string]string, rev int64) {
+	snap := Snapshot{Revision: rev, Values: make(map[string]string, len(values))}
+	for k, v := range values {
+		snap.Values[k] = v
+	}
+	p.mu.Lock()
+	p.snap = snap
+	p.mu.Unlock()
+	p.retry = false
+	for _, s := range p.cfg.Sinks {
+		if err := s.Apply(snap); err != nil {
+			p.retry = true
+			p.fail(err)
+		}
+	}
+}
+
+func (p *Projector) fail(err error) {
+	p.lg.Warn("projection failed", zap.String("prefix", p.cfg.Prefix), zap.Error(err))
+	if p.cfg.OnError != nil {
+		p.cfg.OnError(err)
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
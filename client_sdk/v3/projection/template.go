@@ -0,0 +1,116 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package projection
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// TemplateSink renders Template with a TemplateData and atomically replaces
+// Path with the result. The file is only rewritten, and OnWrite only called,
+// when the rendered content changes.
+type TemplateSink struct {
+	Path     string
+	Template *template.Template
+	// FileMode defaults to 0644.
+	FileMode os.FileMode
+	// OnWrite is called after Path was replaced, e.g. to reload a process.
+	OnWrite func(path string) error
+}
+
+// KeyValue is one entry of TemplateData.List.
+type KeyValue struct {
+	Key   string
+	Value string
+}
+
+// TemplateData is the data a TemplateSink renders its template with.
+type TemplateData struct {
+	Snapshot
+}
+
+// Get returns the value of key, or "" if it does not exist.
+func (d TemplateData) Get(key string) string { return d.Values[key] }
+
+// Exists reports whether key exists.
+func (d TemplateData) Exists(key string) bool {
+	_, ok := d.Values[key]
+	return ok
+}
+
+// List returns the entries whose keys start with prefix, sorted by key.
+func (d TemplateData) List(prefix string) []KeyValue {
+	var kvs []KeyValue
+	for k, v := range d.Values {
+		if strings.HasPrefix(k, prefix) {
+			kvs = append(kvs, KeyValue{Key: k, Value: v})
+		}
+	}
+	sort.Slice(kvs, func(i, j int) bool { return kvs[i].Key < kvs[j].Key })
+	return kvs
+}
+
+func (t *TemplateSink) Apply(s Snapshot) error {
+	var buf bytes.Buffer
+	if err := t.Template.Execute(&buf, TemplateData{s}); err != nil {
+		return err
+	}
+	if old, err := ioutil.ReadFile(t.Path); err == nil && bytes.Equal(old, buf.Bytes()) {
+		return nil
+	}
+	mode := t.FileMode
+	if mode == 0 {
+		mode = 0o644
+	}
+	if err := writeFileAtomic(t.Path, buf.Bytes(), mode); err != nil {
+		return err
+	}
+	if t.OnWrite != nil {
+		return t.OnWrite(t.Path)
+	}
+	return nil
+}
+
+// writeFileAtomic 先写入同目录下的临时文件再重命名
+func writeFileAtomic(path string, data []byte, mode os.FileMode) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+"-")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, mode)
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
@@ -0,0 +1,98 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package projection
+
+import (
+	"encoding/json"
+	"strings"
+	"sync/atomic"
+)
+
+// DecodeFunc converts a snapshot into an application value.
+type DecodeFunc func(s Snapshot) (interface{}, error)
+
+// ValueSink holds the latest successfully decoded snapshot. A snapshot that
+// fails to decode leaves the previous value in place.
+type ValueSink struct {
+	decode DecodeFunc
+	v      atomic.Value
+	// OnChange is called with the new value after each successful decode.
+	OnChange func(v interface{})
+}
+
+// NewValueSink creates a ValueSink that decodes snapshots with decode.
+func NewValueSink(decode DecodeFunc) *ValueSink {
+	return &ValueSink{decode: decode}
+}
+
+func (vs *ValueSink) Apply(s Snapshot) error {
+	v, err := vs.decode(s)
+	if err != nil {
+		return err
+	}
+	vs.v.Store(&v)
+	if vs.OnChange != nil {
+		vs.OnChange(v)
+	}
+	return nil
+}
+
+// Load returns the current value, or nil before the first snapshot.
+func (vs *ValueSink) Load() interface{} {
+	if v, ok := vs.v.Load().(*interface{}); ok {
+		return *v
+	}
+	return nil
+}
+
+// JSONDecoder decodes snapshots into the value returned by newValue, which
+// must be a pointer, as if the keys were a JSON object: "db/port" sets the
+// field or map entry "port" of the object "db". Values that are valid JSON
+// are decoded as JSON, other values as strings.
+func JSONDecoder(newValue func() interface{}) DecodeFunc {
+	return func(s Snapshot) (interface{}, error) {
+		root := make(map[string]interface{})
+		for _, k := range s.Keys() {
+			m := root
+			segs := strings.Split(strings.Trim(k, "/"), "/")
+			for _, seg := range segs[:len(segs)-1] {
+				sub, ok := m[seg].(map[string]interface{})
+				if !ok {
+					sub = make(map[string]interface{})
+					m[seg] = sub
+				}
+				m = sub
+			}
+			if _, isObj := m[segs[len(segs)-1]].(map[string]interface{}); isObj {
+				// 同时存在 "a" 和 "a/b" 时保留对象
+				continue
+			}
+			if v := s.Values[k]; json.Valid([]byte(v)) {
+				m[segs[len(segs)-1]] = json.RawMessage(v)
+			} else {
+				m[segs[len(segs)-1]] = v
+			}
+		}
+		b, err := json.Marshal(root)
+		if err != nil {
+			return nil, err
+		}
+		v := newValue()
+		if err := json.Unmarshal(b, v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	}
+}
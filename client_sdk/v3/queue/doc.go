@@ -0,0 +1,29 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package queue implements distributed work queues on etcd with priorities,
+// delayed delivery, visibility timeouts and dead letters.
+//
+// Items are stored under a prefix in four groups:
+//
+//     <prefix>/ready/<priority>/<id>        items waiting for a consumer
+//     <prefix>/delayed/<due>/<id>           items not deliverable before <due>
+//     <prefix>/inflight/<id>                items claimed by a consumer
+//     <prefix>/owner/<id>                   the claim, bound to the consumer's session lease
+//     <prefix>/dead/<id>                    items that exceeded MaxDeliveries
+//
+// Lower priorities are dequeued first, and items of the same priority in the
+// order they became ready. A claimed item is delivered again when its consumer
+// does not Ack it within the visibility timeout or the consumer's session expires.
+package queue
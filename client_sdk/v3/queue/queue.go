@@ -0,0 +1,418 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queue
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	v3 "github.com/ls-2018/etcd_cn/client_sdk/v3"
+	"github.com/ls-2018/etcd_cn/client_sdk/v3/concurrency"
+)
+
+var (
+	// ErrNotOwner 消息已经不属于当前消费者(可见性超时或session过期),会被重新投递
+	ErrNotOwner = errors.New("queue: message is no longer owned by this consumer")
+	// ErrNotFound 死信中没有这个消息
+	ErrNotFound = errors.New("queue: message not found")
+)
+
+const (
+	// DefaultVisibilityTimeout 默认的可见性超时
+	DefaultVisibilityTimeout = 30 * time.Second
+	// DefaultReapInterval 默认检查超时消息和到期延迟消息的间隔
+	DefaultReapInterval = time.Second
+)
+
+// Config 队列配置,同一个前缀的所有消费者应使用相同的配置
+type Config struct {
+	// VisibilityTimeout 消费者需要在这个时间内Ack,否则消息被重新投递
+	VisibilityTimeout time.Duration
+	// MaxDeliveries 一条消息最多投递的次数,超过后移入死信;0表示不限制
+	MaxDeliveries int
+	// ReapInterval Dequeue 检查超时消息和到期延迟消息的最小间隔
+	ReapInterval time.Duration
+}
+
+// Message 出队的消息
+type Message struct {
+	ID         string    `json:"id"`
+	Value      string    `json:"value"`
+	Priority   uint16    `json:"priority"`
+	Attempts   int       `json:"attempts"` // 已经投递的次数,包括这一次
+	EnqueuedAt time.Time `json:"enqueued-at"`
+	// Deadline 可见性超时的截止时间,只在出队的消息上有效
+	Deadline time.Time `json:"deadline,omitempty"`
+
+	ownerRev int64 // owner key 的 CreateRevision
+}
+
+// Queue 多生产者多消费者的分布式队列,消息的归属和消费者的session租约绑定
+type Queue struct {
+	s   *concurrency.Session
+	cl  *v3.Client
+	pfx string
+	cfg Config
+
+	mu       sync.Mutex
+	lastReap time.Time
+}
+
+// New 创建前缀为prefix的队列,s 的租约用于标记消费者对消息的归属
+func New(s *concurrency.Session, prefix string, cfg Config) *Queue {
+	if cfg.VisibilityTimeout <= 0 {
+		cfg.VisibilityTimeout = DefaultVisibilityTimeout
+	}
+	if cfg.ReapInterval <= 0 {
+		cfg.ReapInterval = DefaultReapInterval
+	}
+	return &Queue{s: s, cl: s.Client(), pfx: prefix + "/", cfg: cfg}
+}
+
+func (q *Queue) readyPrefix() string          { return q.pfx + "ready/" }
+func (q *Queue) delayedPrefix() string        { return q.pfx + "delayed/" }
+func (q *Queue) inflightKey(id string) string { return q.pfx + "inflight/" + id }
+func (q *Queue) ownerKey(id string) string    { return q.pfx + "owner/" + id }
+func (q *Queue) deadKey(id string) string     { return q.pfx + "dead/" + id }
+
+func (q *Queue) readyKey(m *Message) string {
+	return fmt.Sprintf("%s%05d/%s", q.readyPrefix(), m.Priority, m.ID)
+}
+
+func (q *Queue) delayedKey(due time.Time, id string) string {
+	return fmt.Sprintf("%s%020d/%s", q.delayedPrefix(), due.UnixNano(), id)
+}
+
+type enqueueOptions struct {
+	priority uint16
+	delay    time.Duration
+}
+
+type EnqueueOption func(*enqueueOptions)
+
+// WithPriority 设置优先级,值越小越先出队,默认为0
+func WithPriority(p uint16) EnqueueOption {
+	return func(o *enqueueOptions) { o.priority = p }
+}
+
+// WithDelay 消息在延迟之后才能出队
+func WithDelay(d time.Duration) EnqueueOption {
+	return func(o *enqueueOptions) { o.delay = d }
+}
+
+// Enqueue 入队并返回消息ID
+func (q *Queue) Enqueue(ctx context.Context, val string, opts ...EnqueueOption) (string, error) {
+	o := &enqueueOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	id := newID()
+	m := &Message{ID: id, Value: val, Priority: o.priority, EnqueuedAt: time.Now()}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	key := q.readyKey(m)
+	if o.delay > 0 {
+		key = q.delayedKey(time.Now().Add(o.delay), id)
+	}
+	if _, err = q.cl.Put(ctx, key, string(data)); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// Dequeue 取出优先级最高、最早就绪的消息;队列为空时阻塞.消息需要在可见性超时内 Ack
+func (q *Queue) Dequeue(ctx context.Context) (*Message, error) {
+	for {
+		if err := q.maybeReap(ctx); err != nil {
+			return nil, err
+		}
+		m, rev, err := q.claim(ctx)
+		if err != nil || m != nil {
+			return m, err
+		}
+		if err = q.waitReady(ctx, rev+1); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// claim 尝试认领一条就绪的消息,队列为空时返回nil和读取时的revision
+func (q *Queue) claim(ctx context.Context) (*Message, int64, error) {
+	for {
+		// 先找到最高的优先级,再取这个优先级中最早就绪的消息
+		resp, err := q.cl.Get(ctx, q.readyPrefix(), v3.WithFirstKey()...)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(resp.Kvs) == 0 {
+			return nil, resp.Header.Revision, nil
+		}
+		var first Message
+		if err = json.Unmarshal([]byte(resp.Kvs[0].Value), &first); err != nil {
+			return nil, 0, fmt.Errorf("queue: invalid message %q: %v", resp.Kvs[0].Key, err)
+		}
+		pri := fmt.Sprintf("%s%05d/", q.readyPrefix(), first.Priority)
+		if resp, err = q.cl.Get(ctx, pri, v3.WithFirstCreate()...); err != nil {
+			return nil, 0, err
+		}
+		if len(resp.Kvs) == 0 {
+			continue
+		}
+		kv := resp.Kvs[0]
+		m := &Message{}
+		if err = json.Unmarshal([]byte(kv.Value), m); err != nil {
+			return nil, 0, fmt.Errorf("queue: invalid message %q: %v", kv.Key, err)
+		}
+		m.Attempts++
+		m.Deadline = time.Now().Add(q.cfg.VisibilityTimeout)
+		data, err := json.Marshal(m)
+		if err != nil {
+			return nil, 0, err
+		}
+		txn, err := q.cl.Txn(ctx).
+			If(v3.Compare(v3.ModRevision(kv.Key), "=", kv.ModRevision)).
+			Then(
+				v3.OpDelete(kv.Key),
+				v3.OpPut(q.inflightKey(m.ID), string(data)),
+				v3.OpPut(q.ownerKey(m.ID), "", v3.WithLease(q.s.Lease())),
+			).Commit()
+		if err != nil {
+			return nil, 0, err
+		}
+		if txn.Succeeded {
+			// 被其它消费者抢先时重试
+			m.ownerRev = txn.Header.Revision
+			return m, 0, nil
+		}
+	}
+}
+
+// waitReady 等待新的就绪消息,最多等待 ReapInterval,以便处理到期的延迟消息和超时消息
+func (q *Queue) waitReady(ctx context.Context, rev int64) error {
+	wctx, cancel := context.WithTimeout(ctx, q.cfg.ReapInterval)
+	defer cancel()
+	for wr := range q.cl.Watch(wctx, q.readyPrefix(), v3.WithPrefix(), v3.WithRev(rev), v3.WithFilterDelete()) {
+		if err := wr.Err(); err != nil {
+			return err
+		}
+		if len(wr.Events) > 0 {
+			return nil
+		}
+	}
+	return ctx.Err()
+}
+
+// Ack 确认消息处理完成并删除它
+func (q *Queue) Ack(ctx context.Context, m *Message) error {
+	txn, err := q.cl.Txn(ctx).
+		If(v3.Compare(v3.CreateRevision(q.ownerKey(m.ID)), "=", m.ownerRev)).
+		Then(v3.OpDelete(q.inflightKey(m.ID)), v3.OpDelete(q.ownerKey(m.ID))).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !txn.Succeeded {
+		return ErrNotOwner
+	}
+	return nil
+}
+
+// Nack 放弃处理,消息在delay之后重新投递;投递次数达到 MaxDeliveries 时移入死信
+func (q *Queue) Nack(ctx context.Context, m *Message, delay time.Duration) error {
+	ok, err := q.requeue(ctx, m, v3.Compare(v3.CreateRevision(q.ownerKey(m.ID)), "=", m.ownerRev), delay)
+	if err == nil && !ok {
+		return ErrNotOwner
+	}
+	return err
+}
+
+// Extend 把消息的可见性超时延长到从现在开始的d
+func (q *Queue) Extend(ctx context.Context, m *Message, d time.Duration) error {
+	em := *m
+	em.Deadline = time.Now().Add(d)
+	data, err := json.Marshal(&em)
+	if err != nil {
+		return err
+	}
+	txn, err := q.cl.Txn(ctx).
+		If(v3.Compare(v3.CreateRevision(q.ownerKey(m.ID)), "=", m.ownerRev)).
+		Then(v3.OpPut(q.inflightKey(m.ID), string(data))).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !txn.Succeeded {
+		return ErrNotOwner
+	}
+	m.Deadline = em.Deadline
+	return nil
+}
+
+// requeue 在cmp成立时把认领的消息放回就绪或延迟队列,或者移入死信
+func (q *Queue) requeue(ctx context.Context, m *Message, cmp v3.Cmp, delay time.Duration) (bool, error) {
+	rm := *m
+	rm.Deadline = time.Time{}
+	data, err := json.Marshal(&rm)
+	if err != nil {
+		return false, err
+	}
+	var put v3.Op
+	switch {
+	case q.cfg.MaxDeliveries > 0 && m.Attempts >= q.cfg.MaxDeliveries:
+		put = v3.OpPut(q.deadKey(m.ID), string(data))
+	case delay > 0:
+		put = v3.OpPut(q.delayedKey(time.Now().Add(delay), m.ID), string(data))
+	default:
+		put = v3.OpPut(q.readyKey(m), string(data))
+	}
+	txn, err := q.cl.Txn(ctx).
+		If(cmp).
+		Then(v3.OpDelete(q.inflightKey(m.ID)), v3.OpDelete(q.ownerKey(m.ID)), put).
+		Commit()
+	if err != nil {
+		return false, err
+	}
+	return txn.Succeeded, nil
+}
+
+// maybeReap 每隔 ReapInterval 把到期的延迟消息移入就绪队列,并重新投递超时或消费者已经失效的消息
+func (q *Queue) maybeReap(ctx context.Context) error {
+	q.mu.Lock()
+	if time.Since(q.lastReap) < q.cfg.ReapInterval {
+		q.mu.Unlock()
+		return nil
+	}
+	q.lastReap = time.Now()
+	q.mu.Unlock()
+
+	if err := q.promoteDelayed(ctx); err != nil {
+		return err
+	}
+	return q.reapInflight(ctx)
+}
+
+func (q *Queue) promoteDelayed(ctx context.Context) error {
+	end := q.delayedKey(time.Now(), "")
+	resp, err := q.cl.Get(ctx, q.delayedPrefix(), v3.WithRange(end))
+	if err != nil {
+		return err
+	}
+	for _, kv := range resp.Kvs {
+		m := &Message{}
+		if err = json.Unmarshal([]byte(kv.Value), m); err != nil {
+			return fmt.Errorf("queue: invalid message %q: %v", kv.Key, err)
+		}
+		// 只有一个消费者能移动成功
+		if _, err = q.cl.Txn(ctx).
+			If(v3.Compare(v3.ModRevision(kv.Key), "=", kv.ModRevision)).
+			Then(v3.OpDelete(kv.Key), v3.OpPut(q.readyKey(m), kv.Value)).
+			Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (q *Queue) reapInflight(ctx context.Context) error {
+	resp, err := q.cl.Get(ctx, q.pfx+"inflight/", v3.WithPrefix())
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, kv := range resp.Kvs {
+		m := &Message{}
+		if err = json.Unmarshal([]byte(kv.Value), m); err != nil {
+			return fmt.Errorf("queue: invalid message %q: %v", kv.Key, err)
+		}
+		guard := v3.Compare(v3.ModRevision(kv.Key), "=", kv.ModRevision)
+		if now.Before(m.Deadline) {
+			// 没有超时,但消费者的session可能已经过期
+			oresp, err := q.cl.Get(ctx, q.ownerKey(m.ID), v3.WithCountOnly())
+			if err != nil {
+				return err
+			}
+			if oresp.Count != 0 {
+				continue
+			}
+		}
+		if _, err = q.requeue(ctx, m, guard, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeadLetters 返回死信中的消息
+func (q *Queue) DeadLetters(ctx context.Context) ([]*Message, error) {
+	resp, err := q.cl.Get(ctx, q.deadKey(""), v3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	ms := make([]*Message, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		m := &Message{}
+		if err = json.Unmarshal([]byte(kv.Value), m); err != nil {
+			return nil, fmt.Errorf("queue: invalid message %q: %v", kv.Key, err)
+		}
+		ms = append(ms, m)
+	}
+	return ms, nil
+}
+
+// Redrive 把死信中的消息重置投递次数后放回就绪队列
+func (q *Queue) Redrive(ctx context.Context, id string) error {
+	resp, err := q.cl.Get(ctx, q.deadKey(id))
+	if err != nil {
+		return err
+	}
+	if len(resp.Kvs) == 0 {
+		return ErrNotFound
+	}
+	kv := resp.Kvs[0]
+	m := &Message{}
+	if err = json.Unmarshal([]byte(kv.Value), m); err != nil {
+		return fmt.Errorf("queue: invalid message %q: %v", kv.Key, err)
+	}
+	m.Attempts = 0
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	txn, err := q.cl.Txn(ctx).
+		If(v3.Compare(v3.ModRevision(kv.Key), "=", kv.ModRevision)).
+		Then(v3.OpDelete(kv.Key), v3.OpPut(q.readyKey(m), string(data))).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !txn.Succeeded {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -92,13 +92,15 @@ func isSafeRetryMutableRPC(err error) bool {
 }
 
 type retryKVClient struct {
-	kc pb.KVClient
+	kc         pb.KVClient
+	idempotent bool // 为 Put 和 Txn 附加幂等token并按可重复请求重试
 }
 
 // RetryKVClient implements a KVClient.
 func RetryKVClient(c *Client) pb.KVClient {
 	return &retryKVClient{
-		kc: pb.NewKVClient(c.conn),
+		kc:         pb.NewKVClient(c.conn),
+		idempotent: c.cfg.RetryPolicy != nil && c.cfg.RetryPolicy.IdempotentWrites,
 	}
 }
 
@@ -107,6 +109,13 @@ func (rkv *retryKVClient) Range(ctx context.Context, in *pb.RangeRequest, opts .
 }
 
 func (rkv *retryKVClient) Put(ctx context.Context, in *pb.PutRequest, opts ...grpc.CallOption) (resp *pb.PutResponse, err error) {
+	if rkv.idempotent {
+		r := *in
+		if r.IdempotencyToken == "" {
+			r.IdempotencyToken = newIdempotencyToken()
+		}
+		return rkv.kc.Put(ctx, &r, append(opts, withRetryPolicy(repeatable))...)
+	}
 	return rkv.kc.Put(ctx, in, opts...)
 }
 
@@ -115,6 +124,13 @@ func (rkv *retryKVClient) DeleteRange(ctx context.Context, in *pb.DeleteRangeReq
 }
 
 func (rkv *retryKVClient) Txn(ctx context.Context, in *pb.TxnRequest, opts ...grpc.CallOption) (resp *pb.TxnResponse, err error) {
+	if rkv.idempotent {
+		r := *in
+		if r.IdempotencyToken == "" {
+			r.IdempotencyToken = newIdempotencyToken()
+		}
+		return rkv.kc.Txn(ctx, &r, append(opts, withRetryPolicy(repeatable))...)
+	}
 	return rkv.kc.Txn(ctx, in, opts...)
 }
 
@@ -122,6 +138,10 @@ func (rkv *retryKVClient) Compact(ctx context.Context, in *pb.CompactionRequest,
 	return rkv.kc.Compact(ctx, in, opts...)
 }
 
+func (rkv *retryKVClient) StagedTxn(ctx context.Context, in *pb.StagedTxnRequest, opts ...grpc.CallOption) (resp *pb.StagedTxnResponse, err error) {
+	return rkv.kc.StagedTxn(ctx, in, opts...)
+}
+
 type retryLeaseClient struct {
 	lc pb.LeaseClient
 }
@@ -149,6 +169,10 @@ func (rlc *retryLeaseClient) LeaseRevoke(ctx context.Context, in *pb.LeaseRevoke
 	return rlc.lc.LeaseRevoke(ctx, in, append(opts, withRetryPolicy(repeatable))...)
 }
 
+func (rlc *retryLeaseClient) LeaseWatch(ctx context.Context, in *pb.LeaseWatchRequest, opts ...grpc.CallOption) (stream pb.Lease_LeaseWatchClient, err error) {
+	return rlc.lc.LeaseWatch(ctx, in, append(opts, withRetryPolicy(repeatable))...)
+}
+
 func (rlc *retryLeaseClient) LeaseKeepAlive(ctx context.Context, opts ...grpc.CallOption) (stream pb.Lease_LeaseKeepAliveClient, err error) {
 	return rlc.lc.LeaseKeepAlive(ctx, append(opts, withRetryPolicy(repeatable))...)
 }
@@ -184,6 +208,10 @@ func (rcc *retryClusterClient) MemberPromote(ctx context.Context, in *pb.MemberP
 	return rcc.cc.MemberPromote(ctx, in, opts...)
 }
 
+func (rcc *retryClusterClient) MemberBatchChange(ctx context.Context, in *pb.MemberBatchChangeRequest, opts ...grpc.CallOption) (resp *pb.MemberBatchChangeResponse, err error) {
+	return rcc.cc.MemberBatchChange(ctx, in, opts...)
+}
+
 type retryMaintenanceClient struct {
 	mc pb.MaintenanceClient
 }
@@ -215,6 +243,10 @@ func (rmc *retryMaintenanceClient) Snapshot(ctx context.Context, in *pb.Snapshot
 	return rmc.mc.Snapshot(ctx, in, append(opts, withRetryPolicy(repeatable))...)
 }
 
+func (rmc *retryMaintenanceClient) Profile(ctx context.Context, in *pb.ProfileRequest, opts ...grpc.CallOption) (stream pb.Maintenance_ProfileClient, err error) {
+	return rmc.mc.Profile(ctx, in, append(opts, withRetryPolicy(repeatable))...)
+}
+
 func (rmc *retryMaintenanceClient) MoveLeader(ctx context.Context, in *pb.MoveLeaderRequest, opts ...grpc.CallOption) (resp *pb.MoveLeaderResponse, err error) {
 	return rmc.mc.MoveLeader(ctx, in, append(opts, withRetryPolicy(repeatable))...)
 }
@@ -227,6 +259,42 @@ func (rmc *retryMaintenanceClient) Downgrade(ctx context.Context, in *pb.Downgra
 	return rmc.mc.Downgrade(ctx, in, opts...)
 }
 
+func (rmc *retryMaintenanceClient) ReloadCerts(ctx context.Context, in *pb.ReloadCertsRequest, opts ...grpc.CallOption) (resp *pb.ReloadCertsResponse, err error) {
+	return rmc.mc.ReloadCerts(ctx, in, append(opts, withRetryPolicy(repeatable))...)
+}
+
+func (rmc *retryMaintenanceClient) MaintenanceMode(ctx context.Context, in *pb.MaintenanceModeRequest, opts ...grpc.CallOption) (resp *pb.MaintenanceModeResponse, err error) {
+	return rmc.mc.MaintenanceMode(ctx, in, append(opts, withRetryPolicy(repeatable))...)
+}
+
+func (rmc *retryMaintenanceClient) LogLevel(ctx context.Context, in *pb.LogLevelRequest, opts ...grpc.CallOption) (resp *pb.LogLevelResponse, err error) {
+	return rmc.mc.LogLevel(ctx, in, append(opts, withRetryPolicy(repeatable))...)
+}
+
+func (rmc *retryMaintenanceClient) Failpoint(ctx context.Context, in *pb.FailpointRequest, opts ...grpc.CallOption) (resp *pb.FailpointResponse, err error) {
+	return rmc.mc.Failpoint(ctx, in, opts...)
+}
+
+func (rmc *retryMaintenanceClient) PeerStats(ctx context.Context, in *pb.PeerStatsRequest, opts ...grpc.CallOption) (resp *pb.PeerStatsResponse, err error) {
+	return rmc.mc.PeerStats(ctx, in, append(opts, withRetryPolicy(repeatable))...)
+}
+
+func (rmc *retryMaintenanceClient) CompactionHold(ctx context.Context, in *pb.CompactionHoldRequest, opts ...grpc.CallOption) (resp *pb.CompactionHoldResponse, err error) {
+	return rmc.mc.CompactionHold(ctx, in, append(opts, withRetryPolicy(repeatable))...)
+}
+
+func (rmc *retryMaintenanceClient) UserUsage(ctx context.Context, in *pb.UserUsageRequest, opts ...grpc.CallOption) (resp *pb.UserUsageResponse, err error) {
+	return rmc.mc.UserUsage(ctx, in, opts...)
+}
+
+func (rmc *retryMaintenanceClient) SnapshotSession(ctx context.Context, in *pb.SnapshotSessionRequest, opts ...grpc.CallOption) (resp *pb.SnapshotSessionResponse, err error) {
+	return rmc.mc.SnapshotSession(ctx, in, append(opts, withRetryPolicy(nonRepeatable))...)
+}
+
+func (rmc *retryMaintenanceClient) PromoteReplica(ctx context.Context, in *pb.PromoteReplicaRequest, opts ...grpc.CallOption) (resp *pb.PromoteReplicaResponse, err error) {
+	return rmc.mc.PromoteReplica(ctx, in, append(opts, withRetryPolicy(repeatable))...)
+}
+
 type retryAuthClient struct {
 	ac pb.AuthClient
 }
@@ -254,6 +322,10 @@ func (rac *retryAuthClient) RoleList(ctx context.Context, in *pb.AuthRoleListReq
 	return rac.ac.RoleList(ctx, in, append(opts, withRetryPolicy(repeatable))...)
 }
 
+func (rac *retryAuthClient) Denials(ctx context.Context, in *pb.AuthDenialsRequest, opts ...grpc.CallOption) (resp *pb.AuthDenialsResponse, err error) {
+	return rac.ac.Denials(ctx, in, append(opts, withRetryPolicy(repeatable))...)
+}
+
 func (rac *retryAuthClient) AuthEnable(ctx context.Context, in *pb.AuthEnableRequest, opts ...grpc.CallOption) (resp *pb.AuthEnableResponse, err error) {
 	return rac.ac.AuthEnable(ctx, in, opts...)
 }
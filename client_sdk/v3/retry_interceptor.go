@@ -38,16 +38,28 @@ import (
 
 func (c *Client) unaryClientInterceptor(optFuncs ...retryOption) grpc.UnaryClientInterceptor {
 	intOpts := reuseOrNewWithCallOptions(defaultOptions, optFuncs)
+	var methodOpts map[string]*options
+	if p := c.cfg.RetryPolicy; p != nil {
+		methodOpts = p.methodOptions(c, intOpts)
+	}
 	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
 		ctx = withVersion(ctx)
 		grpcOpts, retryOpts := filterCallOptions(opts)
-		callOpts := reuseOrNewWithCallOptions(intOpts, retryOpts)
+		baseOpts := intOpts
+		if o, ok := methodOpts[method]; ok {
+			baseOpts = o
+		}
+		callOpts := reuseOrNewWithCallOptions(baseOpts, retryOpts)
 		// short circuit for simplicity, and avoiding allocations.
 		if callOpts.max == 0 {
 			return invoker(ctx, method, req, reply, cc, grpcOpts...)
 		}
 		var lastErr error
 		for attempt := uint(0); attempt < callOpts.max; attempt++ {
+			if !callOpts.allowAttempt(attempt) {
+				c.GetLogger().Warn("重试预算不足,放弃重试", zap.String("method", method), zap.Uint("attempt", attempt))
+				return lastErr
+			}
 			if err := waitRetryBackoff(ctx, attempt, callOpts); err != nil {
 				return err
 			}
@@ -117,7 +129,7 @@ func (c *Client) streamClientInterceptor(optFuncs ...retryOption) grpc.StreamCli
 		// getToken automatically
 		// TODO(cfc4n): keep this code block, remove codes about getToken in client.go after pr #12165 merged.
 		if c.authTokenBundle != nil {
-			// equal to c.Username != "" && c.Password != ""
+			// equal to c.hasCredentials()
 			err := c.getToken(ctx)
 			if err != nil && rpctypes.Error(err) != rpctypes.ErrAuthNotEnabled {
 				c.GetLogger().Error("clientv3/retry_interceptor: getToken failed", zap.Error(err))
@@ -157,7 +169,7 @@ func (c *Client) shouldRefreshToken(err error, callOpts *options) bool {
 	if rpctypes.Error(err) == rpctypes.ErrUserEmpty {
 		// refresh the token when username, password is present but the etcd returns ErrUserEmpty
 		// which is possible when the client token is cleared somehow
-		return c.authTokenBundle != nil // equal to c.Username != "" && c.Password != ""
+		return c.authTokenBundle != nil // equal to c.hasCredentials()
 	}
 
 	return callOpts.retryAuth &&
@@ -221,6 +233,10 @@ func (s *serverStreamingRetryingStream) RecvMsg(m interface{}) error {
 
 	// We start off from attempt 1, because zeroth was already made on normal SendMsg().
 	for attempt := uint(1); attempt < s.callOpts.max; attempt++ {
+		if !s.callOpts.allowAttempt(attempt) {
+			s.client.lg.Warn("重试预算不足,放弃重试", zap.Uint("attempt", attempt))
+			return lastErr
+		}
 		if err := waitRetryBackoff(s.ctx, attempt, s.callOpts); err != nil {
 			return err
 		}
@@ -384,6 +400,19 @@ type options struct {
 	max         uint
 	backoffFunc backoffFunc
 	retryAuth   bool
+	budget      *retryBudget // nil 表示不限制重试次数
+}
+
+// allowAttempt 第一次尝试时积累重试额度,重试时消耗额度
+func (o *options) allowAttempt(attempt uint) bool {
+	if o.budget == nil {
+		return true
+	}
+	if attempt == 0 {
+		o.budget.deposit()
+		return true
+	}
+	return o.budget.withdraw()
 }
 
 // retryOption is a grpc.CallOption that is local to clientv3's retry interceptor.
@@ -0,0 +1,192 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clientv3
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// RetryPolicy 客户端自动重试策略,替代默认的固定间隔重试.
+type RetryPolicy struct {
+	// MaxAttempts 一元调用最多尝试的次数(包括第一次),0表示使用默认值
+	MaxAttempts uint `json:"max-attempts"`
+	// InitialBackoff 第一轮重试前的等待时间;每轮重试会依次尝试法定数量的端点,端点之间不等待
+	InitialBackoff time.Duration `json:"initial-backoff"`
+	// MaxBackoff 等待时间的上限,0表示不限制
+	MaxBackoff time.Duration `json:"max-backoff"`
+	// BackoffMultiplier 每轮重试等待时间的增长倍数,小于1时按1处理,即固定间隔
+	BackoffMultiplier float64 `json:"backoff-multiplier"`
+	// JitterFraction 等待时间的随机抖动比例,例如0.2表示在[0.8, 1.2]倍之间
+	JitterFraction float64 `json:"jitter-fraction"`
+	// Budget 重试预算,限制重试占请求的比例,避免集群故障时重试把流量放大; nil表示不限制
+	Budget *RetryBudget `json:"budget"`
+	// Methods 按gRPC方法名覆盖的一元调用策略,例如 "/etcdserverpb.KV/Range"
+	Methods map[string]MethodRetryPolicy `json:"methods"`
+	// IdempotentWrites 为每个 Put 和 Txn 附加随机的幂等token,使它们在连接建立后的临时错误下也能安全重试.
+	// 服务端对相同token只应用一次;不支持幂等token的老版本服务端会忽略它,此时重试可能重复写入
+	IdempotentWrites bool `json:"idempotent-writes"`
+}
+
+// MethodRetryPolicy 单个方法的重试策略,零值字段使用 RetryPolicy 中的设置
+type MethodRetryPolicy struct {
+	MaxAttempts    uint          `json:"max-attempts"` // 1 表示不重试
+	InitialBackoff time.Duration `json:"initial-backoff"`
+	MaxBackoff     time.Duration `json:"max-backoff"`
+}
+
+// RetryBudget 重试预算.每个请求积累 Ratio 次重试额度,每次重试消耗一次;
+// 另外每秒补充 MinRetriesPerSecond 次额度,保证请求很少时也能重试
+type RetryBudget struct {
+	Ratio               float64 `json:"ratio"`
+	MinRetriesPerSecond int     `json:"min-retries-per-second"`
+}
+
+func (p *RetryPolicy) Validate() error {
+	if p.InitialBackoff < 0 || p.MaxBackoff < 0 {
+		return fmt.Errorf("retry backoff must not be negative")
+	}
+	if p.MaxBackoff > 0 && p.InitialBackoff > p.MaxBackoff {
+		return fmt.Errorf("retry initial backoff %v is greater than max backoff %v", p.InitialBackoff, p.MaxBackoff)
+	}
+	if p.JitterFraction < 0 || p.JitterFraction > 1 {
+		return fmt.Errorf("invalid retry jitter fraction %v (expected 0-1)", p.JitterFraction)
+	}
+	if b := p.Budget; b != nil && (b.Ratio < 0 || b.MinRetriesPerSecond < 0) {
+		return fmt.Errorf("retry budget must not be negative")
+	}
+	return nil
+}
+
+// unaryOptions 返回一元调用拦截器的重试选项
+func (p *RetryPolicy) unaryOptions(c *Client) []retryOption {
+	max := defaultUnaryMaxRetries
+	if p.MaxAttempts > 0 {
+		max = p.MaxAttempts
+	}
+	return []retryOption{withMax(max), withBackoff(c.policyBackoff(p.InitialBackoff, p.MaxBackoff, p.BackoffMultiplier, p.JitterFraction))}
+}
+
+// methodOptions 按方法名返回覆盖后的重试选项
+func (p *RetryPolicy) methodOptions(c *Client, base *options) map[string]*options {
+	m := make(map[string]*options, len(p.Methods))
+	for method, mp := range p.Methods {
+		o := *base
+		if mp.MaxAttempts > 0 {
+			o.max = mp.MaxAttempts
+		}
+		if mp.InitialBackoff > 0 || mp.MaxBackoff > 0 {
+			initial, max := p.InitialBackoff, p.MaxBackoff
+			if mp.InitialBackoff > 0 {
+				initial = mp.InitialBackoff
+			}
+			if mp.MaxBackoff > 0 {
+				max = mp.MaxBackoff
+			}
+			o.backoffFunc = c.policyBackoff(initial, max, p.BackoffMultiplier, p.JitterFraction)
+		}
+		m[method] = &o
+	}
+	return m
+}
+
+// policyBackoff 和 roundRobinQuorumBackoff 一样每轮依次尝试法定数量的端点,但每轮的等待时间按倍数增长
+func (c *Client) policyBackoff(initial, max time.Duration, multiplier, jitterFraction float64) backoffFunc {
+	if initial == 0 {
+		initial = defaultBackoffWaitBetween
+	}
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	return func(attempt uint) time.Duration {
+		n := uint(len(c.Endpoints()))
+		quorum := n/2 + 1
+		if attempt%quorum != 0 {
+			return 0
+		}
+		wait := float64(initial) * math.Pow(multiplier, float64(attempt/quorum-1))
+		if max > 0 && wait > float64(max) {
+			wait = float64(max)
+		}
+		c.lg.Debug("backoff", zap.Uint("attempt", attempt), zap.Uint("quorum", quorum), zap.Duration("wait", time.Duration(wait)))
+		return jitterUp(time.Duration(wait), jitterFraction)
+	}
+}
+
+// retryBudgetRequests 重试额度最多积累的请求数
+const retryBudgetRequests = 1000
+
+type retryBudget struct {
+	mu      sync.Mutex
+	ratio   float64
+	minRate float64
+	tokens  float64 // 由请求积累的额度
+	reserve float64 // 按时间补充的额度
+	last    time.Time
+}
+
+func newRetryBudget(b *RetryBudget) *retryBudget {
+	return &retryBudget{
+		ratio:   b.Ratio,
+		minRate: float64(b.MinRetriesPerSecond),
+		reserve: float64(b.MinRetriesPerSecond),
+		last:    time.Now(),
+	}
+}
+
+// deposit 每个请求第一次尝试时调用
+func (b *retryBudget) deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = math.Min(b.tokens+b.ratio, b.ratio*retryBudgetRequests)
+}
+
+// withdraw 每次重试前调用,额度不足时返回false
+func (b *retryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.reserve = math.Min(b.reserve+now.Sub(b.last).Seconds()*b.minRate, b.minRate)
+	b.last = now
+	switch {
+	case b.tokens >= 1:
+		b.tokens--
+	case b.reserve >= 1:
+		b.reserve--
+	default:
+		return false
+	}
+	return true
+}
+
+// withRetryBudget sets the retry budget shared by all calls of this interceptor.
+func withRetryBudget(b *retryBudget) retryOption {
+	return retryOption{applyFunc: func(o *options) {
+		o.budget = b
+	}}
+}
+
+// newIdempotencyToken 生成随机的幂等token
+func newIdempotencyToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
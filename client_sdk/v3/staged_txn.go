@@ -0,0 +1,106 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clientv3
+
+import (
+	"context"
+
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+)
+
+const (
+	// stagedTxnChunkOps 每次追加的最大操作数,不超过服务端默认的 --max-txn-ops
+	stagedTxnChunkOps = 128
+	// stagedTxnChunkBytes 每次追加的操作的大致字节数上限,低于服务端默认的 --max-request-bytes
+	stagedTxnChunkBytes = 1024 * 1024
+)
+
+// StagedTxn 返回一个可以超过 --max-txn-ops 的事务.Commit 时操作被分批暂存到服务端,
+// 最后在一个raft日志中原子地应用,总大小受服务端 --experimental-staged-txn-max-* 的限制.
+// 它不经过 c.KV,因此不受 namespace 等KV包装的影响.
+func (c *Client) StagedTxn(ctx context.Context) Txn {
+	return &txn{
+		kv:       &kv{remote: RetryKVClient(c), callOpts: c.callOpts},
+		ctx:      ctx,
+		callOpts: c.callOpts,
+		staged:   true,
+	}
+}
+
+func (txn *txn) commitStaged() (*TxnResponse, error) {
+	ctx := txn.ctx
+	var id int64
+	send := func(r *pb.StagedTxnRequest) (*pb.StagedTxnResponse, error) {
+		r.StageId = id
+		resp, err := txn.kv.remote.StagedTxn(ctx, r, txn.callOpts...)
+		if err != nil {
+			if id != 0 {
+				// 尽量放弃已经暂存的操作,失败时等待服务端让它过期
+				txn.kv.remote.StagedTxn(ctx, &pb.StagedTxnRequest{Action: pb.StagedTxnRequest_ABORT, StageId: id}, txn.callOpts...)
+			}
+			return nil, toErr(ctx, err)
+		}
+		id = resp.StageId
+		return resp, nil
+	}
+
+	chunk := &pb.StagedTxnRequest{}
+	ops, size := 0, 0
+	flush := func() error {
+		if _, err := send(chunk); err != nil {
+			return err
+		}
+		chunk = &pb.StagedTxnRequest{}
+		ops, size = 0, 0
+		return nil
+	}
+	add := func(n int) error {
+		ops++
+		size += n
+		if ops >= stagedTxnChunkOps || size >= stagedTxnChunkBytes {
+			return flush()
+		}
+		return nil
+	}
+	for _, cmp := range txn.cmps {
+		chunk.Compare = append(chunk.Compare, cmp)
+		if err := add(cmp.Size()); err != nil {
+			return nil, err
+		}
+	}
+	for _, op := range txn.sus {
+		chunk.Success = append(chunk.Success, op)
+		if err := add(op.Size()); err != nil {
+			return nil, err
+		}
+	}
+	for _, op := range txn.fas {
+		chunk.Failure = append(chunk.Failure, op)
+		if err := add(op.Size()); err != nil {
+			return nil, err
+		}
+	}
+	if ops > 0 || id == 0 {
+		if err := flush(); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := send(&pb.StagedTxnRequest{Action: pb.StagedTxnRequest_COMMIT})
+	if err != nil {
+		return nil, err
+	}
+	return (*TxnResponse)(resp.Txn), nil
+}
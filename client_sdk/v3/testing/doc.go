@@ -0,0 +1,29 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package testing provides an in-memory implementation of the etcd KV, Watch
+// and Lease services for unit tests that should not start an etcd server.
+//
+// The fake keeps the full revision history, so reads at old revisions,
+// compaction, watches from past revisions and transactions behave like a
+// real cluster. Leases expire only when the fake clock is advanced:
+//
+//     f := clienttest.New()
+//     defer f.Close()
+//     cli := f.Client()
+//     s, _ := concurrency.NewSession(cli, concurrency.WithTTL(5))
+//     f.Advance(6 * time.Second) // s's lease expires and its keys are deleted
+//
+// Cluster, Auth and Maintenance are not implemented and are nil on the client.
+package testing
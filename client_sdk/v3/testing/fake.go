@@ -0,0 +1,86 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testing
+
+import (
+	"context"
+	"time"
+
+	clientv3 "github.com/ls-2018/etcd_cn/client_sdk/v3"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+)
+
+// Fake 内存中的etcd,通过 Client 返回的客户端访问
+type Fake struct {
+	s      *store
+	client *clientv3.Client
+}
+
+// New 创建一个空的Fake,时钟从 Unix 0 开始,只有调用 Advance 才会前进
+func New() *Fake {
+	f := &Fake{s: newStore()}
+	c := clientv3.NewCtxClient(context.Background())
+	c.KV = clientv3.NewKVFromKVClient(f.KVClient(), c)
+	c.Watcher = clientv3.NewWatchFromWatchClient(f.WatchClient(), c)
+	// 与 clientv3.NewLease 在没有设置 DialTimeout 时的超时一致
+	c.Lease = clientv3.NewLeaseFromLeaseClient(f.LeaseClient(), c, time.Second)
+	f.client = c
+	return f
+}
+
+// Client 返回连接到f的客户端,只设置了 KV、Watcher 和 Lease
+func (f *Fake) Client() *clientv3.Client { return f.client }
+
+// KVClient 返回f的 pb.KVClient,可以用于包装成自定义的 clientv3.KV
+func (f *Fake) KVClient() pb.KVClient { return &kvClient{s: f.s} }
+
+// WatchClient 返回f的 pb.WatchClient
+func (f *Fake) WatchClient() pb.WatchClient { return &watchClient{s: f.s} }
+
+// LeaseClient 返回f的 pb.LeaseClient; LeaseWatch 没有实现
+func (f *Fake) LeaseClient() pb.LeaseClient { return &leaseClient{s: f.s} }
+
+// Advance 将时钟前进d,并撤销所有到期的租约.
+// 客户端的 KeepAlive 按真实时间续约,所以前进超过TTL相当于模拟客户端失联.
+func (f *Fake) Advance(d time.Duration) {
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+	f.s.now = f.s.now.Add(d)
+	f.s.expire()
+}
+
+// Now 返回当前的假时间
+func (f *Fake) Now() time.Time {
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+	return f.s.now
+}
+
+// Revision 返回当前的revision
+func (f *Fake) Revision() int64 {
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+	return f.s.rev
+}
+
+// Close 关闭客户端,并结束所有watch流
+func (f *Fake) Close() {
+	f.client.Close()
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+	for ws := range f.s.watchers {
+		ws.cancel()
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testing
+
+import (
+	"context"
+
+	"github.com/ls-2018/etcd_cn/offical/api/v3/v3rpc/rpctypes"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// kvClient pb.KVClient 的内存实现
+type kvClient struct{ s *store }
+
+func (c *kvClient) Range(ctx context.Context, in *pb.RangeRequest, _ ...grpc.CallOption) (*pb.RangeResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	resp, err := c.s.rangeAt(in, c.s.rev)
+	if err != nil {
+		return nil, err
+	}
+	resp.Header = c.s.header()
+	return resp, nil
+}
+
+func (c *kvClient) Put(ctx context.Context, in *pb.PutRequest, _ ...grpc.CallOption) (*pb.PutResponse, error) {
+	var resp *pb.PutResponse
+	err := c.write(ctx, func(w *writer) (err error) {
+		resp, err = w.put(in)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp.Header = c.s.header()
+	return resp, nil
+}
+
+func (c *kvClient) DeleteRange(ctx context.Context, in *pb.DeleteRangeRequest, _ ...grpc.CallOption) (*pb.DeleteRangeResponse, error) {
+	var resp *pb.DeleteRangeResponse
+	err := c.write(ctx, func(w *writer) (err error) {
+		resp, err = w.deleteRange(in)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp.Header = c.s.header()
+	return resp, nil
+}
+
+func (c *kvClient) Txn(ctx context.Context, in *pb.TxnRequest, _ ...grpc.CallOption) (*pb.TxnResponse, error) {
+	var resp *pb.TxnResponse
+	err := c.write(ctx, func(w *writer) (err error) {
+		resp, err = w.txn(in)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	setTxnHeader(resp, c.s.header())
+	return resp, nil
+}
+
+func (c *kvClient) Compact(ctx context.Context, in *pb.CompactionRequest, _ ...grpc.CallOption) (*pb.CompactionResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	if err := c.s.compact(in.Revision); err != nil {
+		return nil, err
+	}
+	return &pb.CompactionResponse{Header: c.s.header()}, nil
+}
+
+func (c *kvClient) StagedTxn(ctx context.Context, in *pb.StagedTxnRequest, _ ...grpc.CallOption) (*pb.StagedTxnResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	c.s.mu.Lock()
+	id := in.StageId
+	txn, ok := c.s.staged[id]
+	if in.Action == pb.StagedTxnRequest_APPEND && id == 0 {
+		id, txn, ok = c.s.nextStageID, &pb.TxnRequest{}, true
+		c.s.nextStageID++
+		c.s.staged[id] = txn
+	}
+	if !ok {
+		c.s.mu.Unlock()
+		return nil, rpctypes.ErrGRPCStagedTxnNotFound
+	}
+	switch in.Action {
+	case pb.StagedTxnRequest_APPEND:
+		txn.Compare = append(txn.Compare, in.Compare...)
+		txn.Success = append(txn.Success, in.Success...)
+		txn.Failure = append(txn.Failure, in.Failure...)
+		ops := int64(len(txn.Compare) + len(txn.Success) + len(txn.Failure))
+		resp := &pb.StagedTxnResponse{Header: c.s.header(), StageId: id, Ops: ops, Bytes: int64(txn.Size())}
+		c.s.mu.Unlock()
+		return resp, nil
+	case pb.StagedTxnRequest_ABORT:
+		delete(c.s.staged, id)
+		resp := &pb.StagedTxnResponse{Header: c.s.header(), StageId: id}
+		c.s.mu.Unlock()
+		return resp, nil
+	}
+	c.s.mu.Unlock()
+	resp, err := c.Txn(ctx, txn)
+	if err != nil {
+		return nil, err
+	}
+	c.s.mu.Lock()
+	delete(c.s.staged, id)
+	c.s.mu.Unlock()
+	return &pb.StagedTxnResponse{Header: resp.Header, StageId: id, Txn: resp}, nil
+}
+
+// write 在一个revision中执行f,失败时回滚所有修改
+func (c *kvClient) write(ctx context.Context, f func(w *writer) error) error {
+	if err := ctx.Err(); err != nil {
+		return status.FromContextError(err).Err()
+	}
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	w := c.s.newWriter()
+	if err := f(w); err != nil {
+		w.abort()
+		return err
+	}
+	w.commit()
+	return nil
+}
+
+func setTxnHeader(resp *pb.TxnResponse, h *pb.ResponseHeader) {
+	resp.Header = h
+	for _, op := range resp.Responses {
+		switch {
+		case op.ResponseOp_ResponseRange != nil:
+			op.ResponseOp_ResponseRange.ResponseRange.Header = h
+		case op.ResponseOp_ResponsePut != nil:
+			op.ResponseOp_ResponsePut.ResponsePut.Header = h
+		case op.ResponseOp_ResponseDeleteRange != nil:
+			op.ResponseOp_ResponseDeleteRange.ResponseDeleteRange.Header = h
+		case op.ResponseOp_ResponseTxn != nil:
+			setTxnHeader(op.ResponseOp_ResponseTxn.ResponseTxn, h)
+		}
+	}
+}
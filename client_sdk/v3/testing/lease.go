@@ -0,0 +1,247 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testing
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/ls-2018/etcd_cn/offical/api/v3/v3rpc/rpctypes"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type lease struct {
+	id       int64
+	ttl      int64
+	expiry   time.Time
+	parent   int64
+	children map[int64]bool
+	metadata string
+	keys     map[string]bool
+}
+
+// remaining 剩余的秒数,与etcd一样向下取整
+func (l *lease) remaining(now time.Time) int64 {
+	if d := l.expiry.Sub(now); d > 0 {
+		return int64(d / time.Second)
+	}
+	return 0
+}
+
+func (s *store) grant(r *pb.LeaseGrantRequest) (*pb.LeaseGrantResponse, error) {
+	id := r.ID
+	if id == 0 {
+		for s.leases[s.nextLeaseID] != nil {
+			s.nextLeaseID++
+		}
+		id = s.nextLeaseID
+		s.nextLeaseID++
+	} else if s.leases[id] != nil {
+		return nil, rpctypes.ErrGRPCLeaseExist
+	}
+	if r.Parent != 0 && s.leases[r.Parent] == nil {
+		return nil, rpctypes.ErrGRPCLeaseNotFound
+	}
+	l := &lease{
+		id:       id,
+		ttl:      r.TTL,
+		expiry:   s.now.Add(time.Duration(r.TTL) * time.Second),
+		parent:   r.Parent,
+		children: make(map[int64]bool),
+		metadata: r.Metadata,
+		keys:     make(map[string]bool),
+	}
+	s.leases[id] = l
+	if p := s.leases[r.Parent]; p != nil {
+		p.children[id] = true
+	}
+	return &pb.LeaseGrantResponse{Header: s.header(), ID: id, TTL: r.TTL}, nil
+}
+
+// revoke 撤销租约及其子租约,所有关联的key在同一个revision中删除
+func (s *store) revoke(id int64) error {
+	if s.leases[id] == nil {
+		return rpctypes.ErrGRPCLeaseNotFound
+	}
+	w := s.newWriter()
+	s.revokeLocked(w, id)
+	w.commit()
+	return nil
+}
+
+func (s *store) revokeLocked(w *writer, id int64) {
+	l := s.leases[id]
+	for _, c := range sortedIDs(l.children) {
+		s.revokeLocked(w, c)
+	}
+	keys := make([]string, 0, len(l.keys))
+	for k := range l.keys {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		w.deleteRange(&pb.DeleteRangeRequest{Key: k})
+	}
+	if p := s.leases[l.parent]; p != nil {
+		delete(p.children, id)
+	}
+	delete(s.leases, id)
+}
+
+// renew 续约租约及其子租约,返回剩余的TTL;租约不存在时返回0
+func (s *store) renew(id int64) int64 {
+	l := s.leases[id]
+	if l == nil {
+		return 0
+	}
+	for c := range l.children {
+		s.renew(c)
+	}
+	l.expiry = s.now.Add(time.Duration(l.ttl) * time.Second)
+	return l.ttl
+}
+
+// expire 撤销所有到期的租约
+func (s *store) expire() {
+	var expired []int64
+	for id, l := range s.leases {
+		if !l.expiry.After(s.now) {
+			expired = append(expired, id)
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool { return expired[i] < expired[j] })
+	for _, id := range expired {
+		if s.leases[id] != nil {
+			s.revoke(id)
+		}
+	}
+}
+
+func sortedIDs(m map[int64]bool) []int64 {
+	ids := make([]int64, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// leaseClient pb.LeaseClient 的内存实现
+type leaseClient struct{ s *store }
+
+func (c *leaseClient) LeaseGrant(ctx context.Context, in *pb.LeaseGrantRequest, _ ...grpc.CallOption) (*pb.LeaseGrantResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	return c.s.grant(in)
+}
+
+func (c *leaseClient) LeaseRevoke(ctx context.Context, in *pb.LeaseRevokeRequest, _ ...grpc.CallOption) (*pb.LeaseRevokeResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	if err := c.s.revoke(in.ID); err != nil {
+		return nil, err
+	}
+	return &pb.LeaseRevokeResponse{Header: c.s.header()}, nil
+}
+
+func (c *leaseClient) LeaseTimeToLive(ctx context.Context, in *pb.LeaseTimeToLiveRequest, _ ...grpc.CallOption) (*pb.LeaseTimeToLiveResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	l := c.s.leases[in.ID]
+	if l == nil {
+		return &pb.LeaseTimeToLiveResponse{Header: c.s.header(), ID: in.ID, TTL: -1}, nil
+	}
+	resp := &pb.LeaseTimeToLiveResponse{Header: c.s.header(), ID: l.id, TTL: l.remaining(c.s.now), GrantedTTL: l.ttl, Metadata: l.metadata}
+	if in.Keys {
+		keys := make([]string, 0, len(l.keys))
+		for k := range l.keys {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			resp.Keys = append(resp.Keys, []byte(k))
+		}
+	}
+	return resp, nil
+}
+
+func (c *leaseClient) LeaseLeases(ctx context.Context, _ *pb.LeaseLeasesRequest, _ ...grpc.CallOption) (*pb.LeaseLeasesResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	ids := make(map[int64]bool, len(c.s.leases))
+	for id := range c.s.leases {
+		ids[id] = true
+	}
+	resp := &pb.LeaseLeasesResponse{Header: c.s.header()}
+	for _, id := range sortedIDs(ids) {
+		l := c.s.leases[id]
+		resp.Leases = append(resp.Leases, &pb.LeaseStatus{ID: id, GrantedTTL: l.ttl, Metadata: l.metadata})
+	}
+	return resp, nil
+}
+
+func (c *leaseClient) LeaseKeepAlive(ctx context.Context, _ ...grpc.CallOption) (pb.Lease_LeaseKeepAliveClient, error) {
+	return &keepAliveStream{stream: newStream(ctx), s: c.s}, nil
+}
+
+func (c *leaseClient) LeaseWatch(ctx context.Context, _ *pb.LeaseWatchRequest, _ ...grpc.CallOption) (pb.Lease_LeaseWatchClient, error) {
+	return nil, status.Error(codes.Unimplemented, "method LeaseWatch not implemented")
+}
+
+type keepAliveStream struct {
+	*stream
+	s *store
+}
+
+func (ks *keepAliveStream) Send(req *pb.LeaseKeepAliveRequest) error {
+	if err := ks.sendErr(); err != nil {
+		return err
+	}
+	ks.s.mu.Lock()
+	defer ks.s.mu.Unlock()
+	resp := &pb.LeaseKeepAliveResponse{Header: ks.s.header()}
+	if len(req.IDs) == 0 {
+		resp.ID, resp.TTL = req.ID, ks.s.renew(req.ID)
+	}
+	for _, id := range req.IDs {
+		resp.Results = append(resp.Results, &pb.LeaseKeepAliveResult{ID: id, TTL: ks.s.renew(id)})
+	}
+	ks.push(resp)
+	return nil
+}
+
+func (ks *keepAliveStream) Recv() (*pb.LeaseKeepAliveResponse, error) {
+	resp, err := ks.pop()
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*pb.LeaseKeepAliveResponse), nil
+}
@@ -0,0 +1,462 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testing
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ls-2018/etcd_cn/offical/api/v3/mvccpb"
+	"github.com/ls-2018/etcd_cn/offical/api/v3/v3rpc/rpctypes"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+)
+
+// store 内存中的多版本存储
+type store struct {
+	mu sync.Mutex
+
+	rev        int64
+	compactRev int64
+	// versions 每个key的所有版本,按 ModRevision 递增;删除用 Version 为0的墓碑表示
+	versions map[string][]*mvccpb.KeyValue
+	sorted   []string
+	// log 所有未被压缩的事件,PrevKv 总是设置
+	log []*mvccpb.Event
+
+	now         time.Time
+	leases      map[int64]*lease
+	nextLeaseID int64
+
+	watchers map[*watchStream]struct{}
+
+	// staged 暂存事务,没有过期和大小限制
+	staged      map[int64]*pb.TxnRequest
+	nextStageID int64
+}
+
+func newStore() *store {
+	return &store{
+		rev:         1,
+		versions:    make(map[string][]*mvccpb.KeyValue),
+		now:         time.Unix(0, 0),
+		leases:      make(map[int64]*lease),
+		nextLeaseID: 0x1000,
+		watchers:    make(map[*watchStream]struct{}),
+		staged:      make(map[int64]*pb.TxnRequest),
+		nextStageID: 1,
+	}
+}
+
+func (s *store) header() *pb.ResponseHeader {
+	return &pb.ResponseHeader{ClusterId: 1, MemberId: 1, Revision: s.rev, RaftTerm: 1}
+}
+
+// writer 一次写操作(包括整个事务),所有修改使用同一个revision
+type writer struct {
+	s      *store
+	rev    int64
+	events []*mvccpb.Event
+	undo   []func()
+}
+
+func (s *store) newWriter() *writer { return &writer{s: s, rev: s.rev + 1} }
+
+// commit 有修改时推进revision并通知watcher
+func (w *writer) commit() {
+	if len(w.events) == 0 {
+		return
+	}
+	w.s.rev = w.rev
+	w.s.log = append(w.s.log, w.events...)
+	for ws := range w.s.watchers {
+		ws.notify(w.events, w.s.header())
+	}
+}
+
+func (w *writer) abort() {
+	for i := len(w.undo) - 1; i >= 0; i-- {
+		w.undo[i]()
+	}
+}
+
+// get 返回key在rev时的值
+func (s *store) get(key string, rev int64) *mvccpb.KeyValue {
+	vs := s.versions[key]
+	i := sort.Search(len(vs), func(i int) bool { return vs[i].ModRevision > rev })
+	if i == 0 || vs[i-1].Version == 0 {
+		return nil
+	}
+	return vs[i-1]
+}
+
+// keysInRange 返回 [key, end) 中曾经存在过的key; end为空表示单个key,"\x00"表示key之后的所有key
+func (s *store) keysInRange(key, end string) []string {
+	if end == "" {
+		if _, ok := s.versions[key]; ok {
+			return []string{key}
+		}
+		return nil
+	}
+	i := sort.SearchStrings(s.sorted, key)
+	var keys []string
+	for ; i < len(s.sorted); i++ {
+		if end != "\x00" && s.sorted[i] >= end {
+			break
+		}
+		keys = append(keys, s.sorted[i])
+	}
+	return keys
+}
+
+func (s *store) rangeKVs(key, end string, rev int64) []*mvccpb.KeyValue {
+	var kvs []*mvccpb.KeyValue
+	for _, k := range s.keysInRange(key, end) {
+		if kv := s.get(k, rev); kv != nil {
+			kvs = append(kvs, kv)
+		}
+	}
+	return kvs
+}
+
+func inRange(k, key, end string) bool {
+	switch end {
+	case "":
+		return k == key
+	case "\x00":
+		return k >= key
+	}
+	return k >= key && k < end
+}
+
+// addVersion 写入key的新版本;同一个事务中重复修改同一个key会返回错误
+func (w *writer) addVersion(kv *mvccpb.KeyValue, typ mvccpb.Event_EventType, prev *mvccpb.KeyValue) error {
+	s := w.s
+	vs, existed := s.versions[kv.Key]
+	if n := len(vs); n > 0 && vs[n-1].ModRevision == w.rev {
+		return rpctypes.ErrGRPCDuplicateKey
+	}
+	s.versions[kv.Key] = append(vs, kv)
+	if !existed {
+		s.insertSorted(kv.Key)
+	}
+	n := len(w.events)
+	w.events = append(w.events, &mvccpb.Event{Type: typ, Kv: kv, PrevKv: prev})
+	w.undo = append(w.undo, func() {
+		w.events = w.events[:n]
+		if existed {
+			s.versions[kv.Key] = vs
+		} else {
+			delete(s.versions, kv.Key)
+			s.removeSorted(kv.Key)
+		}
+	})
+	return nil
+}
+
+func (s *store) insertSorted(k string) {
+	i := sort.SearchStrings(s.sorted, k)
+	s.sorted = append(s.sorted, "")
+	copy(s.sorted[i+1:], s.sorted[i:])
+	s.sorted[i] = k
+}
+
+func (s *store) removeSorted(k string) {
+	i := sort.SearchStrings(s.sorted, k)
+	if i < len(s.sorted) && s.sorted[i] == k {
+		s.sorted = append(s.sorted[:i], s.sorted[i+1:]...)
+	}
+}
+
+func (w *writer) put(r *pb.PutRequest) (*pb.PutResponse, error) {
+	s := w.s
+	prev := s.get(r.Key, w.rev)
+	if (r.IgnoreValue || r.IgnoreLease) && prev == nil {
+		return nil, rpctypes.ErrGRPCKeyNotFound
+	}
+	kv := &mvccpb.KeyValue{Key: r.Key, Value: r.Value, Lease: r.Lease, ModRevision: w.rev, CreateRevision: w.rev, Version: 1}
+	if r.IgnoreValue {
+		kv.Value = prev.Value
+	}
+	if r.IgnoreLease {
+		kv.Lease = prev.Lease
+	}
+	if kv.Lease != 0 && s.leases[kv.Lease] == nil {
+		return nil, rpctypes.ErrGRPCLeaseNotFound
+	}
+	if prev != nil {
+		kv.CreateRevision, kv.Version = prev.CreateRevision, prev.Version+1
+		w.detach(prev)
+	}
+	w.attach(kv)
+	if err := w.addVersion(kv, mvccpb.PUT, prev); err != nil {
+		return nil, err
+	}
+
+	resp := &pb.PutResponse{}
+	if r.PrevKv {
+		resp.PrevKv = prev
+	}
+	return resp, nil
+}
+
+func (w *writer) deleteRange(r *pb.DeleteRangeRequest) (*pb.DeleteRangeResponse, error) {
+	resp := &pb.DeleteRangeResponse{}
+	for _, prev := range w.s.rangeKVs(r.Key, r.RangeEnd, w.rev) {
+		w.detach(prev)
+		if err := w.addVersion(&mvccpb.KeyValue{Key: prev.Key, ModRevision: w.rev}, mvccpb.DELETE, prev); err != nil {
+			return nil, err
+		}
+		resp.Deleted++
+		if r.PrevKv {
+			resp.PrevKvs = append(resp.PrevKvs, prev)
+		}
+	}
+	return resp, nil
+}
+
+func (w *writer) attach(kv *mvccpb.KeyValue) {
+	if l := w.s.leases[kv.Lease]; l != nil && !l.keys[kv.Key] {
+		l.keys[kv.Key] = true
+		w.undo = append(w.undo, func() { delete(l.keys, kv.Key) })
+	}
+}
+
+func (w *writer) detach(kv *mvccpb.KeyValue) {
+	if l := w.s.leases[kv.Lease]; l != nil && l.keys[kv.Key] {
+		delete(l.keys, kv.Key)
+		w.undo = append(w.undo, func() { l.keys[kv.Key] = true })
+	}
+}
+
+// rangeAt 执行Range,view 是没有指定revision时读取的revision
+func (s *store) rangeAt(r *pb.RangeRequest, view int64) (*pb.RangeResponse, error) {
+	rev := view
+	if r.Revision > 0 {
+		rev = r.Revision
+	}
+	if rev > view {
+		return nil, rpctypes.ErrGRPCFutureRev
+	}
+	if rev < s.compactRev {
+		return nil, rpctypes.ErrGRPCCompacted
+	}
+
+	kvs := s.rangeKVs(r.Key, r.RangeEnd, rev)
+	resp := &pb.RangeResponse{Count: int64(len(kvs))}
+	filtered := kvs[:0:0]
+	for _, kv := range kvs {
+		if (r.MinModRevision != 0 && kv.ModRevision < r.MinModRevision) ||
+			(r.MaxModRevision != 0 && kv.ModRevision > r.MaxModRevision) ||
+			(r.MinCreateRevision != 0 && kv.CreateRevision < r.MinCreateRevision) ||
+			(r.MaxCreateRevision != 0 && kv.CreateRevision > r.MaxCreateRevision) {
+			continue
+		}
+		filtered = append(filtered, kv)
+	}
+	kvs = filtered
+	if r.CountOnly {
+		return resp, nil
+	}
+
+	order := r.SortOrder
+	if order == pb.RangeRequest_NONE && r.SortTarget != pb.RangeRequest_KEY {
+		order = pb.RangeRequest_ASCEND
+	}
+	if order != pb.RangeRequest_NONE {
+		less := sortLess(r.SortTarget)
+		sort.SliceStable(kvs, func(i, j int) bool {
+			if order == pb.RangeRequest_DESCEND {
+				return less(kvs[j], kvs[i])
+			}
+			return less(kvs[i], kvs[j])
+		})
+	}
+	if r.Limit > 0 && int64(len(kvs)) > r.Limit {
+		kvs, resp.More = kvs[:r.Limit], true
+	}
+	for _, kv := range kvs {
+		c := *kv
+		if r.KeysOnly {
+			c.Value = ""
+		}
+		resp.Kvs = append(resp.Kvs, &c)
+	}
+	return resp, nil
+}
+
+func sortLess(t pb.RangeRequest_SortTarget) func(a, b *mvccpb.KeyValue) bool {
+	switch t {
+	case pb.RangeRequest_VERSION:
+		return func(a, b *mvccpb.KeyValue) bool { return a.Version < b.Version }
+	case pb.RangeRequest_CREATE:
+		return func(a, b *mvccpb.KeyValue) bool { return a.CreateRevision < b.CreateRevision }
+	case pb.RangeRequest_MOD:
+		return func(a, b *mvccpb.KeyValue) bool { return a.ModRevision < b.ModRevision }
+	case pb.RangeRequest_VALUE:
+		return func(a, b *mvccpb.KeyValue) bool { return a.Value < b.Value }
+	}
+	return func(a, b *mvccpb.KeyValue) bool { return a.Key < b.Key }
+}
+
+func (w *writer) txn(r *pb.TxnRequest) (*pb.TxnResponse, error) {
+	resp := &pb.TxnResponse{Succeeded: true}
+	for _, c := range r.Compare {
+		if !w.s.compare(c, w.rev) {
+			resp.Succeeded = false
+			break
+		}
+	}
+	ops := r.Success
+	if !resp.Succeeded {
+		ops = r.Failure
+	}
+	for _, op := range ops {
+		rop := &pb.ResponseOp{}
+		switch {
+		case op.RequestOp_RequestRange != nil:
+			rr, err := w.s.rangeAt(op.RequestOp_RequestRange.RequestRange, w.rev)
+			if err != nil {
+				return nil, err
+			}
+			rop.ResponseOp_ResponseRange = &pb.ResponseOp_ResponseRange{ResponseRange: rr}
+		case op.RequestOp_RequestPut != nil:
+			pr, err := w.put(op.RequestOp_RequestPut.RequestPut)
+			if err != nil {
+				return nil, err
+			}
+			rop.ResponseOp_ResponsePut = &pb.ResponseOp_ResponsePut{ResponsePut: pr}
+		case op.RequestOp_RequestDeleteRange != nil:
+			dr, err := w.deleteRange(op.RequestOp_RequestDeleteRange.RequestDeleteRange)
+			if err != nil {
+				return nil, err
+			}
+			rop.ResponseOp_ResponseDeleteRange = &pb.ResponseOp_ResponseDeleteRange{ResponseDeleteRange: dr}
+		case op.RequestOp_RequestTxn != nil:
+			tr, err := w.txn(op.RequestOp_RequestTxn.RequestTxn)
+			if err != nil {
+				return nil, err
+			}
+			rop.ResponseOp_ResponseTxn = &pb.ResponseOp_ResponseTxn{ResponseTxn: tr}
+		}
+		resp.Responses = append(resp.Responses, rop)
+	}
+	return resp, nil
+}
+
+// compare 范围中的所有key都满足时返回true;不存在的key按零值比较,但值比较总是失败
+func (s *store) compare(c *pb.Compare, rev int64) bool {
+	kvs := s.rangeKVs(c.Key, c.RangeEnd, rev)
+	if len(kvs) == 0 {
+		if c.Target == pb.Compare_VALUE {
+			return false
+		}
+		return compareKV(c, &mvccpb.KeyValue{})
+	}
+	for _, kv := range kvs {
+		if !compareKV(c, kv) {
+			return false
+		}
+	}
+	return true
+}
+
+func compareKV(c *pb.Compare, kv *mvccpb.KeyValue) bool {
+	var res int
+	switch c.Target {
+	case pb.Compare_VALUE:
+		v := ""
+		if c.Compare_Value != nil {
+			v = c.Compare_Value.Value
+		}
+		res = strings.Compare(kv.Value, v)
+	case pb.Compare_VERSION:
+		var v int64
+		if c.Compare_Version != nil {
+			v = c.Compare_Version.Version
+		}
+		res = compareInt(kv.Version, v)
+	case pb.Compare_CREATE:
+		var v int64
+		if c.Compare_CreateRevision != nil {
+			v = c.Compare_CreateRevision.CreateRevision
+		}
+		res = compareInt(kv.CreateRevision, v)
+	case pb.Compare_MOD:
+		var v int64
+		if c.Compare_ModRevision != nil {
+			v = c.Compare_ModRevision.ModRevision
+		}
+		res = compareInt(kv.ModRevision, v)
+	case pb.Compare_LEASE:
+		var v int64
+		if c.Compare_Lease != nil {
+			v = c.Compare_Lease.Lease
+		}
+		res = compareInt(kv.Lease, v)
+	}
+	switch c.Result {
+	case pb.Compare_EQUAL:
+		return res == 0
+	case pb.Compare_NOT_EQUAL:
+		return res != 0
+	case pb.Compare_GREATER:
+		return res > 0
+	case pb.Compare_LESS:
+		return res < 0
+	}
+	return false
+}
+
+func compareInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compact 删除rev之前的历史,保留每个key在rev时的值
+func (s *store) compact(rev int64) error {
+	if rev <= s.compactRev {
+		return rpctypes.ErrGRPCCompacted
+	}
+	if rev > s.rev {
+		return rpctypes.ErrGRPCFutureRev
+	}
+	for k, vs := range s.versions {
+		i := sort.Search(len(vs), func(i int) bool { return vs[i].ModRevision > rev })
+		keep := i - 1
+		if keep >= 0 && vs[keep].Version == 0 {
+			keep++
+		}
+		if keep < 0 {
+			keep = 0
+		}
+		if keep >= len(vs) {
+			delete(s.versions, k)
+			s.removeSorted(k)
+			continue
+		}
+		s.versions[k] = vs[keep:]
+	}
+	i := sort.Search(len(s.log), func(i int) bool { return s.log[i].Kv.ModRevision > rev })
+	s.log = s.log[i:]
+	s.compactRev = rev
+	return nil
+}
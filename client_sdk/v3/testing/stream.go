@@ -0,0 +1,81 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testing
+
+import (
+	"context"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// stream grpc.ClientStream 的内存实现,响应按顺序排队直到被 Recv 取走
+type stream struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	queue  []interface{}
+	signal chan struct{}
+}
+
+func newStream(ctx context.Context) *stream {
+	cctx, cancel := context.WithCancel(ctx)
+	return &stream{ctx: cctx, cancel: cancel, signal: make(chan struct{}, 1)}
+}
+
+func (st *stream) push(resp interface{}) {
+	st.mu.Lock()
+	st.queue = append(st.queue, resp)
+	st.mu.Unlock()
+	select {
+	case st.signal <- struct{}{}:
+	default:
+	}
+}
+
+func (st *stream) pop() (interface{}, error) {
+	for {
+		st.mu.Lock()
+		if len(st.queue) > 0 {
+			resp := st.queue[0]
+			st.queue = st.queue[1:]
+			st.mu.Unlock()
+			return resp, nil
+		}
+		st.mu.Unlock()
+		select {
+		case <-st.signal:
+		case <-st.ctx.Done():
+			return nil, status.FromContextError(st.ctx.Err()).Err()
+		}
+	}
+}
+
+func (st *stream) sendErr() error {
+	if err := st.ctx.Err(); err != nil {
+		return status.FromContextError(err).Err()
+	}
+	return nil
+}
+
+func (st *stream) Header() (metadata.MD, error) { return metadata.MD{}, nil }
+func (st *stream) Trailer() metadata.MD         { return metadata.MD{} }
+func (st *stream) CloseSend() error             { return nil }
+func (st *stream) Context() context.Context     { return st.ctx }
+func (st *stream) SendMsg(m interface{}) error  { return status.Error(codes.Unimplemented, "SendMsg") }
+func (st *stream) RecvMsg(m interface{}) error  { return status.Error(codes.Unimplemented, "RecvMsg") }
@@ -0,0 +1,147 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testing
+
+import (
+	"context"
+
+	"github.com/ls-2018/etcd_cn/offical/api/v3/mvccpb"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+	"google.golang.org/grpc"
+)
+
+// watchClient pb.WatchClient 的内存实现
+type watchClient struct{ s *store }
+
+func (c *watchClient) Watch(ctx context.Context, _ ...grpc.CallOption) (pb.Watch_WatchClient, error) {
+	ws := &watchStream{stream: newStream(ctx), s: c.s, watchers: make(map[int64]*pb.WatchCreateRequest)}
+	c.s.mu.Lock()
+	c.s.watchers[ws] = struct{}{}
+	c.s.mu.Unlock()
+	go func() {
+		<-ws.ctx.Done()
+		c.s.mu.Lock()
+		delete(c.s.watchers, ws)
+		c.s.mu.Unlock()
+	}()
+	return ws, nil
+}
+
+// watchStream 一个watch流,其中的watcher都已同步到最新revision,由store在提交时通知
+type watchStream struct {
+	*stream
+	s *store
+
+	// watchers 受 s.mu 保护
+	watchers map[int64]*pb.WatchCreateRequest
+	nextID   int64
+}
+
+func (ws *watchStream) Send(req *pb.WatchRequest) error {
+	if err := ws.sendErr(); err != nil {
+		return err
+	}
+	ws.s.mu.Lock()
+	defer ws.s.mu.Unlock()
+	switch {
+	case req.WatchRequest_CreateRequest != nil:
+		ws.create(req.WatchRequest_CreateRequest.CreateRequest)
+	case req.WatchRequest_CancelRequest != nil:
+		id := req.WatchRequest_CancelRequest.CancelRequest.WatchId
+		if _, ok := ws.watchers[id]; ok {
+			delete(ws.watchers, id)
+			ws.push(&pb.WatchResponse{Header: ws.s.header(), WatchId: id, Canceled: true})
+		}
+	case req.WatchRequest_ProgressRequest != nil:
+		ws.push(&pb.WatchResponse{Header: ws.s.header(), WatchId: -1})
+	}
+	return nil
+}
+
+func (ws *watchStream) Recv() (*pb.WatchResponse, error) {
+	resp, err := ws.pop()
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*pb.WatchResponse), nil
+}
+
+func (ws *watchStream) create(cr *pb.WatchCreateRequest) {
+	s := ws.s
+	id := cr.WatchId
+	if id == 0 {
+		for {
+			id = ws.nextID
+			ws.nextID++
+			if _, ok := ws.watchers[id]; !ok {
+				break
+			}
+		}
+	} else if _, ok := ws.watchers[id]; ok {
+		ws.push(&pb.WatchResponse{Header: s.header(), WatchId: id, Created: true, Canceled: true, CancelReason: "etcdserver: duplicate watch ID provided"})
+		return
+	}
+
+	ws.push(&pb.WatchResponse{Header: s.header(), WatchId: id, Created: true})
+	if cr.StartRevision > 0 && cr.StartRevision <= s.compactRev {
+		ws.push(&pb.WatchResponse{Header: s.header(), WatchId: id, CompactRevision: s.compactRev, Canceled: true})
+		return
+	}
+	ws.watchers[id] = cr
+	if cr.StartRevision > 0 && cr.StartRevision <= s.rev {
+		var evs []*mvccpb.Event
+		for _, ev := range s.log {
+			if ev.Kv.ModRevision >= cr.StartRevision {
+				evs = append(evs, ev)
+			}
+		}
+		if evs = filterEvents(cr, evs); len(evs) > 0 {
+			ws.push(&pb.WatchResponse{Header: s.header(), WatchId: id, Events: evs})
+		}
+	}
+}
+
+// notify 在 s.mu 持有时由store调用
+func (ws *watchStream) notify(evs []*mvccpb.Event, h *pb.ResponseHeader) {
+	for id, cr := range ws.watchers {
+		if fevs := filterEvents(cr, evs); len(fevs) > 0 {
+			ws.push(&pb.WatchResponse{Header: h, WatchId: id, Events: fevs})
+		}
+	}
+}
+
+func filterEvents(cr *pb.WatchCreateRequest, evs []*mvccpb.Event) []*mvccpb.Event {
+	var out []*mvccpb.Event
+	for _, ev := range evs {
+		if ev.Kv.ModRevision < cr.StartRevision || !inRange(ev.Kv.Key, cr.Key, cr.RangeEnd) || filtered(cr.Filters, ev.Type) {
+			continue
+		}
+		e := &mvccpb.Event{Type: ev.Type, Kv: ev.Kv}
+		if cr.PrevKv {
+			e.PrevKv = ev.PrevKv
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+func filtered(filters []pb.WatchCreateRequest_FilterType, typ mvccpb.Event_EventType) bool {
+	for _, f := range filters {
+		if (f == pb.WatchCreateRequest_NOPUT && typ == mvccpb.PUT) || (f == pb.WatchCreateRequest_NODELETE && typ == mvccpb.DELETE) {
+			return true
+		}
+	}
+	return false
+}
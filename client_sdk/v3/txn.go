@@ -51,6 +51,8 @@ type txn struct {
 	celse bool
 
 	isWrite bool
+	// staged 为true时分批暂存到服务端后再提交,见 Client.StagedTxn
+	staged bool
 
 	cmps []*pb.Compare
 
@@ -128,13 +130,18 @@ func (txn *txn) Commit() (*TxnResponse, error) {
 	txn.mu.Lock()
 	defer txn.mu.Unlock()
 
+	if txn.staged {
+		return txn.commitStaged()
+	}
+
 	r := &pb.TxnRequest{Compare: txn.cmps, Success: txn.sus, Failure: txn.fas}
 
 	var resp *pb.TxnResponse
 	var err error
-	resp, err = txn.kv.remote.Txn(txn.ctx, r, txn.callOpts...)
+	resp, err = txn.kv.remote.Txn(txn.kv.writeCtx(txn.ctx), r, txn.callOpts...)
 	if err != nil {
 		return nil, toErr(txn.ctx, err)
 	}
+	txn.kv.observeLeader(resp.Header)
 	return (*TxnResponse)(resp), nil
 }
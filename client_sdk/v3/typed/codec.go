@@ -0,0 +1,132 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package typed
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// Codec 值的编解码方式
+type Codec interface {
+	// Name 写入信封中的codec名称,读取时按名称找到对应的Codec
+	Name() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	// JSON 使用 encoding/json 编解码,信封中的数据保持为可读的JSON
+	JSON Codec = jsonCodec{}
+	// Proto 使用值自身的 Marshal/Unmarshal 方法编解码,适用于 gogo/protobuf 生成的消息
+	Proto Codec = protoCodec{}
+)
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{JSON.Name(): JSON, Proto.Name(): Proto}
+)
+
+// RegisterCodec 注册自定义Codec,使读取时能解码用它写入的值
+func RegisterCodec(c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[c.Name()] = c
+}
+
+func codecByName(name string) (Codec, error) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	c, ok := codecs[name]
+	if !ok {
+		return nil, fmt.Errorf("typed: unknown codec %q", name)
+	}
+	return c, nil
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string                               { return "json" }
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+type protoMarshaler interface {
+	Marshal() ([]byte, error)
+}
+
+type protoUnmarshaler interface {
+	Unmarshal([]byte) error
+}
+
+type protoCodec struct{}
+
+func (protoCodec) Name() string { return "proto" }
+
+func (protoCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(protoMarshaler)
+	if !ok {
+		return nil, fmt.Errorf("typed: %T does not implement Marshal", v)
+	}
+	return m.Marshal()
+}
+
+func (protoCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(protoUnmarshaler)
+	if !ok {
+		return fmt.Errorf("typed: %T does not implement Unmarshal", v)
+	}
+	return m.Unmarshal(data)
+}
+
+// envelope 实际写入etcd的值
+type envelope struct {
+	Codec  string          `json:"codec"`
+	Schema int             `json:"schema"`
+	Data   json.RawMessage `json:"data"`
+}
+
+func encode(c Codec, schema int, v interface{}) ([]byte, error) {
+	data, err := c.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := c.(jsonCodec); !ok {
+		// 非JSON的数据以base64字符串保存
+		if data, err = json.Marshal(data); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(envelope{Codec: c.Name(), Schema: schema, Data: data})
+}
+
+// decode 解析信封并把数据解码到v,返回值写入时的schema版本
+func decode(value []byte, v interface{}) (int, error) {
+	var env envelope
+	if err := json.Unmarshal(value, &env); err != nil {
+		return 0, fmt.Errorf("typed: invalid envelope: %v", err)
+	}
+	c, err := codecByName(env.Codec)
+	if err != nil {
+		return env.Schema, err
+	}
+	data := []byte(env.Data)
+	if _, ok := c.(jsonCodec); !ok {
+		if err = json.Unmarshal(env.Data, &data); err != nil {
+			return env.Schema, fmt.Errorf("typed: invalid envelope data: %v", err)
+		}
+	}
+	return env.Schema, c.Unmarshal(data, v)
+}
@@ -0,0 +1,33 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package typed stores Go values in etcd through pluggable codecs.
+//
+// Every value is written inside an envelope that records the codec and a schema
+// version, so readers can decode values written with another codec and refuse to
+// overwrite values written by a newer schema. The module targets Go 1.16, so
+// values are passed as pointers in the style of encoding/json:
+//
+//     tkv := typed.NewKV(cli, typed.JSON, 2)
+//     var cfg Config
+//     meta, err := tkv.Get(ctx, "config/app", &cfg)
+//
+// Update reads the current value, applies a mutation and writes it back only if
+// the key has not changed in between, retrying on conflicts:
+//
+//     _, err = tkv.Update(ctx, "config/app", &cfg, func(exists bool) error {
+//         cfg.Replicas++
+//         return nil
+//     })
+package typed
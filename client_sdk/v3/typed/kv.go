@@ -0,0 +1,180 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package typed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	v3 "github.com/ls-2018/etcd_cn/client_sdk/v3"
+	"github.com/ls-2018/etcd_cn/offical/api/v3/mvccpb"
+)
+
+var (
+	ErrKeyNotFound = errors.New("typed: key not found")
+	// ErrNewerSchema 值由更新的schema版本写入,当前版本不能安全地覆盖它
+	ErrNewerSchema = errors.New("typed: value was written by a newer schema")
+	// ErrConflict Update 重试次数用完仍然和其它写入冲突
+	ErrConflict = errors.New("typed: too many conflicting updates")
+)
+
+// DefaultUpdateRetries Update 遇到冲突时默认的最大重试次数
+const DefaultUpdateRetries = 10
+
+// Meta 读取到的值的元数据
+type Meta struct {
+	Key            string
+	Schema         int   // 写入时的schema版本
+	CreateRevision int64 // 为0表示key不存在
+	ModRevision    int64
+	Version        int64
+	Lease          int64
+}
+
+func metaOf(kv *mvccpb.KeyValue, schema int) *Meta {
+	return &Meta{
+		Key:            string(kv.Key),
+		Schema:         schema,
+		CreateRevision: kv.CreateRevision,
+		ModRevision:    kv.ModRevision,
+		Version:        kv.Version,
+		Lease:          kv.Lease,
+	}
+}
+
+// KV 按codec编解码值的KV,写入的值都带有schema版本
+type KV struct {
+	cl     *v3.Client
+	codec  Codec
+	schema int
+
+	// UpdateRetries Update 遇到冲突时的最大重试次数
+	UpdateRetries int
+}
+
+// NewKV 创建用codec写入、schema作为当前版本的KV
+func NewKV(cl *v3.Client, codec Codec, schema int) *KV {
+	return &KV{cl: cl, codec: codec, schema: schema, UpdateRetries: DefaultUpdateRetries}
+}
+
+// Get 读取key并把值解码到v;key不存在时返回 ErrKeyNotFound
+func (t *KV) Get(ctx context.Context, key string, v interface{}, opts ...v3.OpOption) (*Meta, error) {
+	resp, err := t.cl.Get(ctx, key, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, ErrKeyNotFound
+	}
+	kv := resp.Kvs[0]
+	schema, err := decode([]byte(kv.Value), v)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", key, err)
+	}
+	return metaOf(kv, schema), nil
+}
+
+// Put 编码v并写入key
+func (t *KV) Put(ctx context.Context, key string, v interface{}, opts ...v3.OpOption) (*v3.PutResponse, error) {
+	val, err := encode(t.codec, t.schema, v)
+	if err != nil {
+		return nil, err
+	}
+	return t.cl.Put(ctx, key, string(val), opts...)
+}
+
+// Update 读取key到v,调用fn修改v后写回;写回时如果key已经被其它客户端修改,重新读取并再次调用fn.
+// exists表示key是否存在,不存在时v保持调用前的值.值由更新的schema写入时返回 ErrNewerSchema
+func (t *KV) Update(ctx context.Context, key string, v interface{}, fn func(exists bool) error) (*Meta, error) {
+	for i := 0; i <= t.UpdateRetries; i++ {
+		meta, err := t.Get(ctx, key, v)
+		switch {
+		case err == ErrKeyNotFound:
+			meta = &Meta{Key: key}
+		case err != nil:
+			return nil, err
+		case meta.Schema > t.schema:
+			return meta, ErrNewerSchema
+		}
+		if err = fn(meta.CreateRevision != 0); err != nil {
+			return nil, err
+		}
+		val, err := encode(t.codec, t.schema, v)
+		if err != nil {
+			return nil, err
+		}
+		var putOpts []v3.OpOption
+		if meta.CreateRevision != 0 {
+			// 保留已有的租约
+			putOpts = append(putOpts, v3.WithIgnoreLease())
+		}
+		resp, err := t.cl.Txn(ctx).
+			If(v3.Compare(v3.ModRevision(key), "=", meta.ModRevision)).
+			Then(v3.OpPut(key, string(val), putOpts...)).
+			Commit()
+		if err != nil {
+			return nil, err
+		}
+		if resp.Succeeded {
+			meta.Schema = t.schema
+			meta.ModRevision = resp.Header.Revision
+			meta.Version++
+			if meta.CreateRevision == 0 {
+				meta.CreateRevision = resp.Header.Revision
+			}
+			return meta, nil
+		}
+	}
+	return nil, ErrConflict
+}
+
+// Event 解码后的watch事件
+type Event struct {
+	Type  mvccpb.Event_EventType
+	Meta  *Meta
+	Value interface{} // 删除事件为nil
+	Err   error       // 解码失败或watch出错
+}
+
+// Watch 监听key并解码每个PUT事件的值;newValue 为每个事件返回一个新的值指针
+func (t *KV) Watch(ctx context.Context, key string, newValue func() interface{}, opts ...v3.OpOption) <-chan Event {
+	ch := make(chan Event)
+	go func() {
+		defer close(ch)
+		for wr := range t.cl.Watch(ctx, key, opts...) {
+			if err := wr.Err(); err != nil {
+				select {
+				case ch <- Event{Err: err}:
+				case <-ctx.Done():
+				}
+				return
+			}
+			for _, ev := range wr.Events {
+				e := Event{Type: ev.Type, Meta: metaOf(ev.Kv, 0)}
+				if ev.Type == mvccpb.PUT {
+					e.Value = newValue()
+					e.Meta.Schema, e.Err = decode([]byte(ev.Kv.Value), e.Value)
+				}
+				select {
+				case ch <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return ch
+}
@@ -111,6 +111,7 @@ type watcher struct {
 	mu       sync.Mutex                  //
 	streams  map[string]*watchGrpcStream // 持有CTX 键值对的所有活动的GRPC流.
 	lg       *zap.Logger                 //
+	metrics  MetricsHook                 // 记录事件的延迟
 }
 
 // watchGrpcStream tracks all watch resources attached to a single grpc stream.
@@ -149,6 +150,13 @@ type watchRequest struct {
 	fragment       bool // 是否切分响应,当数据较大时
 	filters        []pb.WatchCreateRequest_FilterType
 	prevKV         bool
+	batchSize      int
+	batchDelay     time.Duration
+	backlog        *WatchBacklog
+	projections    []string
+	valueHash      bool
+	keyGlob        string
+	keyRegex       string
 	retc           chan chan WatchResponse
 }
 
@@ -165,6 +173,7 @@ type watcherStream struct {
 	closing bool                // 当应该安排流关闭时,closures 设置为 true.
 	id      int64               // id 是在 grpc 流上注册的 watch id
 	buf     []*WatchResponse    // buf 保存从 etcd 收到但尚未被客户端消费的所有事件
+	batchAt time.Time           // buf 中最后一个可合并的响应开始合并的时间
 }
 
 func NewWatcher(c *Client) Watcher {
@@ -180,6 +189,7 @@ func NewWatchFromWatchClient(wc pb.WatchClient, c *Client) Watcher {
 	if c != nil {
 		w.callOpts = c.callOpts
 		w.lg = c.lg
+		w.metrics = c.cfg.Metrics
 	}
 	return w
 }
@@ -229,6 +239,9 @@ func (w *watcher) Watch(ctx context.Context, key string, opts ...OpOption) Watch
 	if ow.filterDelete {
 		filters = append(filters, pb.WatchCreateRequest_NODELETE)
 	}
+	if ow.filterUnchanged {
+		filters = append(filters, pb.WatchCreateRequest_NOUNCHANGED)
+	}
 
 	wr := &watchRequest{
 		ctx:            ctx,
@@ -240,6 +253,13 @@ func (w *watcher) Watch(ctx context.Context, key string, opts ...OpOption) Watch
 		fragment:       ow.fragment,
 		filters:        filters,
 		prevKV:         ow.prevKV,
+		batchSize:      ow.batchSize,
+		batchDelay:     ow.batchDelay,
+		backlog:        ow.backlog,
+		projections:    ow.projections,
+		valueHash:      ow.valueHash,
+		keyGlob:        ow.keyGlob,
+		keyRegex:       ow.keyRegex,
 		retc:           make(chan chan WatchResponse, 1),
 	}
 
@@ -642,6 +662,9 @@ func (w *watchGrpcStream) dispatchEvent(pbresp *pb.WatchResponse) bool {
 	for i, ev := range pbresp.Events {
 		events[i] = (*Event)(ev)
 	}
+	if m := w.owner.metrics; m != nil && len(events) > 0 {
+		m.ObserveWatchLag(pbresp.Header.Revision - events[0].Kv.ModRevision)
+	}
 	// TODO: return watch ID?
 	wr := &WatchResponse{
 		Header:          *pbresp.Header,
@@ -730,16 +753,26 @@ func (w *watchGrpcStream) serveSubstream(ws *watcherStream, resumec chan struct{
 		curWr := emptyWr
 		outc := ws.outc
 
+		var batchTimer *time.Timer
+		var batchc <-chan time.Time
 		if len(ws.buf) > 0 {
 			curWr = ws.buf[0]
+			if wait := ws.batchWait(time.Now()); wait > 0 {
+				// 等待更多事件合并到同一个响应
+				outc = nil
+				batchTimer = time.NewTimer(wait)
+				batchc = batchTimer.C
+			}
 		} else {
 			outc = nil
 		}
 		select {
+		case <-batchc:
 		case outc <- *curWr:
 			if ws.buf[0].Err() != nil {
 				return
 			}
+			ws.initReq.backlog.add(-1, -len(ws.buf[0].Events))
 			ws.buf[0] = nil
 			ws.buf = ws.buf[1:]
 		case wr, ok := <-ws.recvc:
@@ -788,8 +821,10 @@ func (w *watchGrpcStream) serveSubstream(ws *watcherStream, resumec chan struct{
 				continue
 			}
 
-			// TODO pause channel if buffer gets too large
-			ws.buf = append(ws.buf, wr)
+			ws.enqueue(wr, time.Now())
+			if batchTimer != nil {
+				batchTimer.Stop()
+			}
 		case <-w.ctx.Done():
 			return
 		case <-ws.initReq.ctx.Done():
@@ -943,6 +978,10 @@ func (wr *watchRequest) toPB() *pb.WatchRequest {
 		Filters:        wr.filters,
 		PrevKv:         wr.prevKV,
 		Fragment:       wr.fragment,
+		Projections:    wr.projections,
+		ValueHash:      wr.valueHash,
+		KeyGlob:        wr.keyGlob,
+		KeyRegex:       wr.keyRegex,
 	}
 	cr := &pb.WatchRequest_CreateRequest{CreateRequest: req}
 	return &pb.WatchRequest{WatchRequest_CreateRequest: cr}
@@ -0,0 +1,109 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clientv3
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+var errWatchClosed = errors.New("clientv3: watch channel closed")
+
+// WithBatch merges watch responses that are waiting to be consumed into
+// responses of at most maxEvents events. Without maxDelay events are only
+// merged while the consumer is behind; with maxDelay a response is held for
+// up to maxDelay so that events arriving in quick succession are delivered
+// together. maxEvents <= 0 means no limit. Progress notifications and errors
+// are never merged.
+func WithBatch(maxEvents int, maxDelay time.Duration) OpOption {
+	return func(op *Op) { op.batchSize, op.batchDelay = maxEvents, maxDelay }
+}
+
+// WithBacklog records in b how many watch responses and events have been
+// received from the server but not yet handed to the watch channel, so that
+// consumers can detect when they fall behind. The count does not include the
+// one response the channel itself may hold.
+func WithBacklog(b *WatchBacklog) OpOption {
+	return func(op *Op) { op.backlog = b }
+}
+
+// WatchBacklog counts watch responses buffered by the client. It is safe for
+// concurrent use; the zero value is ready to use.
+type WatchBacklog struct {
+	responses int64
+	events    int64
+}
+
+// Responses returns the number of buffered watch responses.
+func (b *WatchBacklog) Responses() int { return int(atomic.LoadInt64(&b.responses)) }
+
+// Events returns the number of events in the buffered watch responses.
+func (b *WatchBacklog) Events() int { return int(atomic.LoadInt64(&b.events)) }
+
+func (b *WatchBacklog) add(responses, events int) {
+	if b == nil {
+		return
+	}
+	atomic.AddInt64(&b.responses, int64(responses))
+	atomic.AddInt64(&b.events, int64(events))
+}
+
+// TryRecv receives a watch response without blocking. ok is false if no
+// response is ready. A closed channel yields a canceled response with ok set.
+func (wc WatchChan) TryRecv() (wr WatchResponse, ok bool) {
+	select {
+	case resp, open := <-wc:
+		if !open {
+			return WatchResponse{Canceled: true, closeErr: errWatchClosed}, true
+		}
+		return resp, true
+	default:
+		return WatchResponse{}, false
+	}
+}
+
+// batchable 只有普通的事件响应才能合并
+func batchable(wr *WatchResponse) bool {
+	return len(wr.Events) > 0 && wr.Err() == nil && !wr.Created && wr.CreatedRevision == 0
+}
+
+// enqueue 将响应加入缓冲,开启合并时尽量合并到最后一个响应中
+func (ws *watcherStream) enqueue(wr *WatchResponse, now time.Time) {
+	batching := ws.initReq.batchSize > 0 || ws.initReq.batchDelay > 0
+	if n := len(ws.buf); batching && n > 0 && batchable(ws.buf[n-1]) && batchable(wr) &&
+		(ws.initReq.batchSize <= 0 || len(ws.buf[n-1].Events)+len(wr.Events) <= ws.initReq.batchSize) {
+		last := ws.buf[n-1]
+		events := make([]*Event, 0, len(last.Events)+len(wr.Events))
+		last.Events = append(append(events, last.Events...), wr.Events...)
+		last.Header = wr.Header
+		ws.initReq.backlog.add(0, len(wr.Events))
+		return
+	}
+	ws.buf = append(ws.buf, wr)
+	ws.batchAt = now
+	ws.initReq.backlog.add(1, len(wr.Events))
+}
+
+// batchWait 返回第一个缓冲的响应还需要等待多久才能发送
+func (ws *watcherStream) batchWait(now time.Time) time.Duration {
+	if ws.initReq.batchDelay <= 0 || len(ws.buf) != 1 || !batchable(ws.buf[0]) {
+		return 0
+	}
+	if ws.initReq.batchSize > 0 && len(ws.buf[0].Events) >= ws.initReq.batchSize {
+		return 0
+	}
+	return ws.batchAt.Add(ws.initReq.batchDelay).Sub(now)
+}
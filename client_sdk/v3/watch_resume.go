@@ -0,0 +1,196 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clientv3
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// WatchCompactionStrategy 决定恢复watch时token的revision已经被压缩该怎么处理
+type WatchCompactionStrategy int
+
+const (
+	// WatchCompactionFail 把 ErrCompacted 交给调用方,由调用方重新list
+	WatchCompactionFail WatchCompactionStrategy = iota
+	// WatchCompactionSkip 从压缩后最早可用的revision继续,被压缩掉的事件会丢失
+	WatchCompactionSkip
+	// WatchCompactionCurrent 从集群当前的revision继续
+	WatchCompactionCurrent
+)
+
+// WatchResumeToken 记录watch的范围、过滤条件和下一个要接收的revision,
+// 可以持久化下来,在进程重启后从上次处理到的位置继续watch,而不用重新list
+type WatchResumeToken struct {
+	Key            string                  `json:"key"`
+	End            string                  `json:"end,omitempty"`
+	Revision       int64                   `json:"revision"` // 下一个要接收的revision,0表示从当前revision开始
+	PrevKV         bool                    `json:"prev-kv,omitempty"`
+	FilterPut      bool                    `json:"filter-put,omitempty"`
+	FilterDelete   bool                    `json:"filter-delete,omitempty"`
+	Fragment       bool                    `json:"fragment,omitempty"`
+	ProgressNotify bool                    `json:"progress-notify,omitempty"`
+	Compaction     WatchCompactionStrategy `json:"compaction"`
+}
+
+// NewWatchResumeToken 用和 Watch 相同的参数创建token
+func NewWatchResumeToken(key string, compaction WatchCompactionStrategy, opts ...OpOption) *WatchResumeToken {
+	ow := opWatch(key, opts...)
+	return &WatchResumeToken{
+		Key:            ow.key,
+		End:            ow.end,
+		Revision:       ow.rev,
+		PrevKV:         ow.prevKV,
+		FilterPut:      ow.filterPut,
+		FilterDelete:   ow.filterDelete,
+		Fragment:       ow.fragment,
+		ProgressNotify: ow.progressNotify,
+		Compaction:     compaction,
+	}
+}
+
+// Update 在处理完一个watch响应后调用,把token推进到下一个要接收的revision
+func (t *WatchResumeToken) Update(wr WatchResponse) {
+	switch {
+	case len(wr.Events) > 0:
+		t.Revision = wr.Events[len(wr.Events)-1].Kv.ModRevision + 1
+	case wr.Created && t.Revision == 0, wr.IsProgressNotify():
+		if wr.Header.Revision+1 > t.Revision {
+			t.Revision = wr.Header.Revision + 1
+		}
+	}
+}
+
+func (t *WatchResumeToken) opts() []OpOption {
+	opts := []OpOption{WithRev(t.Revision)}
+	if t.End != "" {
+		opts = append(opts, WithRange(t.End))
+	}
+	if t.PrevKV {
+		opts = append(opts, WithPrevKV())
+	}
+	if t.FilterPut {
+		opts = append(opts, WithFilterPut())
+	}
+	if t.FilterDelete {
+		opts = append(opts, WithFilterDelete())
+	}
+	if t.Fragment {
+		opts = append(opts, WithFragment())
+	}
+	if t.ProgressNotify {
+		opts = append(opts, WithProgressNotify())
+	}
+	return opts
+}
+
+// WatchFromToken 从token记录的位置开始watch.调用方每处理完一个响应应调用 token.Update 并按需持久化token.
+// token的revision被压缩时按 token.Compaction 处理,WatchCompactionFail 以外的策略不会把压缩错误交给调用方
+func WatchFromToken(ctx context.Context, w Watcher, t *WatchResumeToken) WatchChan {
+	if t.Compaction == WatchCompactionFail {
+		return w.Watch(ctx, t.Key, t.opts()...)
+	}
+	ch := make(chan WatchResponse)
+	go func() {
+		defer close(ch)
+		rt := *t
+		for {
+			compactRev := forwardWatch(ctx, w, &rt, ch)
+			if compactRev == 0 {
+				return
+			}
+			// 重新建立watch
+			if t.Compaction == WatchCompactionSkip {
+				rt.Revision = compactRev
+			} else {
+				rt.Revision = 0
+			}
+		}
+	}()
+	return ch
+}
+
+// forwardWatch 把watch响应转发到ch,遇到压缩时返回压缩的revision,其它情况结束时返回0
+func forwardWatch(ctx context.Context, w Watcher, t *WatchResumeToken, ch chan<- WatchResponse) int64 {
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for wr := range w.Watch(wctx, t.Key, t.opts()...) {
+		if wr.CompactRevision != 0 {
+			return wr.CompactRevision
+		}
+		t.Update(wr)
+		select {
+		case ch <- wr:
+		case <-ctx.Done():
+			return 0
+		}
+		if wr.Err() != nil {
+			return 0
+		}
+	}
+	return 0
+}
+
+// Marshal 把token序列化为JSON
+func (t *WatchResumeToken) Marshal() ([]byte, error) {
+	return json.Marshal(t)
+}
+
+// ParseWatchResumeToken 解析 Marshal 的结果
+func ParseWatchResumeToken(data []byte) (*WatchResumeToken, error) {
+	t := &WatchResumeToken{}
+	if err := json.Unmarshal(data, t); err != nil {
+		return nil, fmt.Errorf("invalid watch resume token: %v", err)
+	}
+	if t.Revision < 0 {
+		return nil, fmt.Errorf("invalid watch resume token revision %d", t.Revision)
+	}
+	return t, nil
+}
+
+// SaveWatchResumeToken 把token原子地写入文件,写入过程中崩溃不会留下不完整的token
+func SaveWatchResumeToken(path string, t *WatchResumeToken) error {
+	data, err := t.Marshal()
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// LoadWatchResumeToken 读取 SaveWatchResumeToken 写入的token,文件不存在时返回的错误满足 os.IsNotExist
+func LoadWatchResumeToken(path string) (*WatchResumeToken, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseWatchResumeToken(data)
+}
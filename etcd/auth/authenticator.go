@@ -0,0 +1,340 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ls-2018/etcd_cn/client_sdk/pkg/tlsutil"
+	"github.com/ls-2018/etcd_cn/etcd/mvcc/backend"
+	"github.com/ls-2018/etcd_cn/etcd/mvcc/buckets"
+	"github.com/ls-2018/etcd_cn/offical/api/v3/authpb"
+	"go.uber.org/zap"
+)
+
+const (
+	// WebhookFailurePolicyDeny webhook不可用时拒绝认证
+	WebhookFailurePolicyDeny = "deny"
+	// WebhookFailurePolicyCache webhook不可用时使用该用户最近一次成功的认证结果(即使已经过期)
+	WebhookFailurePolicyCache = "cache"
+)
+
+var (
+	// ExternalUserTTL 外部认证的用户的有效期,过期后需要重新认证
+	ExternalUserTTL = 10 * time.Minute
+
+	ErrAuthenticatorUnavailable = errors.New("auth: external authenticator unavailable")
+)
+
+// Identity 外部认证返回的身份
+type Identity struct {
+	Username string
+	Roles    []string
+}
+
+// Authenticator 外部认证,用于认证etcd中不存在的用户,例如LDAP/OIDC
+type Authenticator interface {
+	// Authenticate 认证失败返回 ErrAuthFailed,认证服务不可用返回其他错误
+	Authenticate(ctx context.Context, username, password string) (*Identity, error)
+}
+
+// WithAuthenticator 本地不存在的用户交由a认证
+func WithAuthenticator(a Authenticator) StoreOption {
+	return func(as *authStore) { as.authenticator = a }
+}
+
+// WebhookConfig webhook认证的配置
+type WebhookConfig struct {
+	URL           string
+	CAFile        string
+	Timeout       time.Duration
+	CacheTTL      time.Duration // 认证成功的结果缓存时间,0表示不缓存
+	FailurePolicy string
+}
+
+func ValidateWebhookFailurePolicy(policy string) error {
+	switch policy {
+	case "", WebhookFailurePolicyDeny, WebhookFailurePolicyCache:
+		return nil
+	}
+	return fmt.Errorf("unknown auth webhook failure policy %q (expected %q or %q)", policy, WebhookFailurePolicyDeny, WebhookFailurePolicyCache)
+}
+
+type webhookRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type webhookResponse struct {
+	Authenticated bool     `json:"authenticated"`
+	Username      string   `json:"username,omitempty"` // 为空时使用请求中的用户名
+	Roles         []string `json:"roles,omitempty"`
+}
+
+type webhookCacheEntry struct {
+	id      Identity
+	expires time.Time
+}
+
+// webhookAuthenticator 将用户名和密码POST到外部服务,由其返回etcd用户名和角色
+type webhookAuthenticator struct {
+	lg     *zap.Logger
+	cfg    WebhookConfig
+	client *http.Client
+
+	mu    sync.Mutex
+	cache map[string]webhookCacheEntry // sha256(username, password) -> identity
+}
+
+func NewWebhookAuthenticator(lg *zap.Logger, cfg WebhookConfig) (Authenticator, error) {
+	if lg == nil {
+		lg = zap.NewNop()
+	}
+	if err := ValidateWebhookFailurePolicy(cfg.FailurePolicy); err != nil {
+		return nil, err
+	}
+	if cfg.FailurePolicy == "" {
+		cfg.FailurePolicy = WebhookFailurePolicyDeny
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.CAFile != "" {
+		pool, err := tlsutil.NewCertPool([]string{cfg.CAFile})
+		if err != nil {
+			return nil, err
+		}
+		tr.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+	return &webhookAuthenticator{
+		lg:     lg,
+		cfg:    cfg,
+		client: &http.Client{Transport: tr, Timeout: cfg.Timeout},
+		cache:  make(map[string]webhookCacheEntry),
+	}, nil
+}
+
+func (w *webhookAuthenticator) Authenticate(ctx context.Context, username, password string) (*Identity, error) {
+	sum := sha256.Sum256([]byte(username + "\x00" + password))
+	key := hex.EncodeToString(sum[:])
+
+	w.mu.Lock()
+	entry, cached := w.cache[key]
+	w.mu.Unlock()
+	if cached && time.Now().Before(entry.expires) {
+		id := entry.id
+		return &id, nil
+	}
+
+	id, err := w.call(ctx, username, password)
+	switch {
+	case err == nil:
+		if w.cfg.CacheTTL > 0 || w.cfg.FailurePolicy == WebhookFailurePolicyCache {
+			w.mu.Lock()
+			w.cache[key] = webhookCacheEntry{id: *id, expires: time.Now().Add(w.cfg.CacheTTL)}
+			w.mu.Unlock()
+		}
+		return id, nil
+	case err == ErrAuthFailed:
+		w.mu.Lock()
+		delete(w.cache, key)
+		w.mu.Unlock()
+		return nil, err
+	}
+
+	w.lg.Warn("auth webhook unavailable", zap.String("url", w.cfg.URL), zap.String("user-name", username), zap.Error(err))
+	if cached && w.cfg.FailurePolicy == WebhookFailurePolicyCache {
+		w.lg.Info("using cached auth webhook result", zap.String("user-name", username))
+		id := entry.id
+		return &id, nil
+	}
+	return nil, ErrAuthenticatorUnavailable
+}
+
+func (w *webhookAuthenticator) call(ctx context.Context, username, password string) (*Identity, error) {
+	body, err := json.Marshal(webhookRequest{Username: username, Password: password})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return nil, ErrAuthFailed
+	default:
+		return nil, fmt.Errorf("auth webhook returned %s", resp.Status)
+	}
+	var wr webhookResponse
+	if err = json.Unmarshal(b, &wr); err != nil {
+		return nil, err
+	}
+	if !wr.Authenticated {
+		return nil, ErrAuthFailed
+	}
+	id := &Identity{Username: wr.Username, Roles: wr.Roles}
+	if id.Username == "" {
+		id.Username = username
+	}
+	return id, nil
+}
+
+// ------------------------------------------------------------------------------------------------
+
+// externalUserKeyPrefix 外部认证的用户保存在鉴权桶中的key前缀,
+// externalUserKeyEnd 为前缀的范围结束('/'+1)
+var (
+	externalUserKeyPrefix = []byte("externalUser/")
+	externalUserKeyEnd    = []byte("externalUser0")
+)
+
+// ExternalUserParam 外部认证的用户,由API层生成并随raft日志同步
+type ExternalUserParam struct {
+	Roles     []string
+	ExpiresAt int64 // UnixNano,由发起认证的节点计算
+	IssuedAt  int64 // UnixNano,早于该时间过期的外部用户会被清理
+}
+
+// externalUser 外部认证的用户在鉴权桶中保存的内容
+type externalUser struct {
+	Roles     []string `json:"roles"`
+	ExpiresAt int64    `json:"expires-at"`
+}
+
+// CheckCredentials 认证用户名和密码;本地存在的用户校验本地密码,否则交给外部认证.
+// 返回的Identity.Username为认证后的etcd用户名,外部用户的Roles非nil
+func (as *authStore) CheckCredentials(ctx context.Context, username, password string) (*Identity, uint64, error) {
+	rev, err := as.CheckPassword(username, password)
+	if err != ErrAuthFailed || as.authenticator == nil || as.hasLocalUser(username) {
+		if err != nil {
+			return nil, 0, err
+		}
+		return &Identity{Username: username}, rev, nil
+	}
+
+	id, err := as.authenticator.Authenticate(ctx, username, password)
+	if err != nil {
+		return nil, 0, err
+	}
+	// 外部认证返回的用户名不能是本地用户,否则会获得本地用户(例如root)的角色
+	if id.Username != username && as.hasLocalUser(id.Username) {
+		as.lg.Warn("external user name conflicts with local user",
+			zap.String("user-name", username),
+			zap.String("etcd-user-name", id.Username),
+		)
+		return nil, 0, ErrAuthFailed
+	}
+	if id.Roles == nil {
+		id.Roles = []string{}
+	}
+	as.lg.Info("authenticated external user",
+		zap.String("user-name", username),
+		zap.String("etcd-user-name", id.Username),
+		zap.Strings("roles", id.Roles),
+	)
+	return id, as.Revision(), nil
+}
+
+func (as *authStore) hasLocalUser(username string) bool {
+	tx := as.be.BatchTx()
+	tx.Lock()
+	defer tx.Unlock()
+	return getUser(as.lg, tx, username) != nil
+}
+
+// putExternalUser 在Authenticate apply时保存外部认证的用户并清理已经过期的,
+// 时间都来自raft日志,保证所有节点一致; tx需要已经加锁
+func (as *authStore) putExternalUser(tx backend.BatchTx, username string, p *ExternalUserParam) {
+	ks, vs := tx.UnsafeRange(buckets.Auth, externalUserKeyPrefix, externalUserKeyEnd, 0)
+	for i := range ks {
+		eu := unmarshalExternalUser(as.lg, vs[i])
+		if eu.ExpiresAt <= p.IssuedAt {
+			tx.UnsafeDelete(buckets.Auth, ks[i])
+			as.invalidateCachedPerm(string(ks[i][len(externalUserKeyPrefix):]))
+		}
+	}
+
+	roles := p.Roles
+	if roles == nil {
+		roles = []string{}
+	}
+	b, err := json.Marshal(&externalUser{Roles: roles, ExpiresAt: p.ExpiresAt})
+	if err != nil {
+		as.lg.Panic("序列化失败 'externalUser'", zap.Error(err))
+	}
+	tx.UnsafePut(buckets.Auth, externalUserKey(username), b)
+	as.invalidateCachedPerm(username)
+}
+
+// delExternalUser 删除外部认证的用户; tx需要已经加锁
+func (as *authStore) delExternalUser(tx backend.BatchTx, username string) {
+	tx.UnsafeDelete(buckets.Auth, externalUserKey(username))
+	as.invalidateCachedPerm(username)
+}
+
+// lookupUser 获取本地用户,不存在时返回在at(UnixNano,为0时使用本地时间)未过期的外部用户; tx需要已经加锁
+func (as *authStore) lookupUser(tx backend.BatchTx, username string, at int64) *authpb.User {
+	if u := getUser(as.lg, tx, username); u != nil {
+		return u
+	}
+	_, vs := tx.UnsafeRange(buckets.Auth, externalUserKey(username), nil, 0)
+	if len(vs) == 0 {
+		return nil
+	}
+	eu := unmarshalExternalUser(as.lg, vs[0])
+	if at == 0 {
+		at = time.Now().UnixNano()
+	}
+	if at >= eu.ExpiresAt {
+		return nil
+	}
+	return &authpb.User{Name: username, Roles: eu.Roles}
+}
+
+func externalUserKey(username string) []byte {
+	return append(append([]byte{}, externalUserKeyPrefix...), username...)
+}
+
+func unmarshalExternalUser(lg *zap.Logger, b []byte) *externalUser {
+	eu := &externalUser{}
+	if err := json.Unmarshal(b, eu); err != nil {
+		lg.Panic("failed to unmarshal 'externalUser'", zap.Error(err))
+	}
+	return eu
+}
@@ -0,0 +1,156 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/ls-2018/etcd_cn/etcd/mvcc/backend"
+	"github.com/ls-2018/etcd_cn/etcd/mvcc/buckets"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+	"go.uber.org/zap"
+)
+
+// DefaultDenialAuditMaxEntries 默认最多保留的权限检查失败记录数
+const DefaultDenialAuditMaxEntries = 1000
+
+// DenialAudit 权限检查失败的审计配置.记录只保存在本节点的后端,不经过raft
+type DenialAudit struct {
+	SampleRate float64 // 记录的比例,0表示不记录,1表示全部记录
+	MaxEntries int     // 最多保留的记录数,超过时删除最早的
+}
+
+func (a DenialAudit) Validate() error {
+	if a.SampleRate < 0 || a.SampleRate > 1 {
+		return fmt.Errorf("invalid denial audit sample rate %v (expected 0-1)", a.SampleRate)
+	}
+	if a.SampleRate > 0 && a.MaxEntries <= 0 {
+		return fmt.Errorf("invalid denial audit max entries %d (expected > 0)", a.MaxEntries)
+	}
+	return nil
+}
+
+// WithDenialAudit 按采样比例记录权限检查失败的请求
+func WithDenialAudit(a DenialAudit) StoreOption {
+	return func(as *authStore) { as.denialAudit = a }
+}
+
+func denialKey(seq uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, seq)
+	return k
+}
+
+var denialKeyEnd = denialKey(1<<64 - 1)
+
+// loadDenialAudit 从后端恢复记录数和下一个序号,并删除超出上限的记录; tx需要已经加锁
+func (as *authStore) loadDenialAudit(tx backend.BatchTx) {
+	tx.UnsafeCreateBucket(buckets.AuthAudit)
+
+	as.auditMu.Lock()
+	defer as.auditMu.Unlock()
+	as.auditCount, as.auditSeq = 0, 0
+	tx.UnsafeForEach(buckets.AuthAudit, func(k, v []byte) error {
+		as.auditCount++
+		if seq := binary.BigEndian.Uint64(k); seq >= as.auditSeq {
+			as.auditSeq = seq + 1
+		}
+		return nil
+	})
+	if as.denialAudit.MaxEntries > 0 {
+		as.trimDenials(tx)
+	}
+}
+
+// trimDenials 删除最早的记录直到不超过上限; tx和auditMu需要已经加锁
+func (as *authStore) trimDenials(tx backend.BatchTx) {
+	n := as.auditCount - as.denialAudit.MaxEntries
+	if n <= 0 {
+		return
+	}
+	keys, _ := tx.UnsafeRange(buckets.AuthAudit, denialKey(0), denialKeyEnd, int64(n))
+	for _, k := range keys {
+		tx.UnsafeDelete(buckets.AuthAudit, k)
+	}
+	as.auditCount -= len(keys)
+}
+
+// RecordDenial 按采样比例记录一次权限检查失败
+func (as *authStore) RecordDenial(d *pb.AuthDenial) {
+	rate := as.denialAudit.SampleRate
+	if rate <= 0 || (rate < 1 && rand.Float64() >= rate) {
+		return
+	}
+	if d.Time == 0 {
+		d.Time = time.Now().Unix()
+	}
+	v, err := d.Marshal()
+	if err != nil {
+		as.lg.Warn("序列化权限检查失败记录失败", zap.Error(err))
+		return
+	}
+
+	tx := as.be.BatchTx()
+	tx.Lock()
+	defer tx.Unlock()
+	as.auditMu.Lock()
+	defer as.auditMu.Unlock()
+
+	tx.UnsafePut(buckets.AuthAudit, denialKey(as.auditSeq), v)
+	as.auditSeq++
+	as.auditCount++
+	as.trimDenials(tx)
+}
+
+// DropDenials 删除最早的最多n条记录,返回删除的条数
+func (as *authStore) DropDenials(n int) int {
+	tx := as.be.BatchTx()
+	tx.Lock()
+	defer tx.Unlock()
+	as.auditMu.Lock()
+	defer as.auditMu.Unlock()
+
+	keys, _ := tx.UnsafeRange(buckets.AuthAudit, denialKey(0), denialKeyEnd, int64(n))
+	for _, k := range keys {
+		tx.UnsafeDelete(buckets.AuthAudit, k)
+	}
+	as.auditCount -= len(keys)
+	return len(keys)
+}
+
+// Denials 返回最近的limit条记录,按时间从早到晚; limit<=0时返回全部
+func (as *authStore) Denials(limit int) []*pb.AuthDenial {
+	tx := as.be.BatchTx()
+	tx.Lock()
+	defer tx.Unlock()
+
+	_, vs := tx.UnsafeRange(buckets.AuthAudit, denialKey(0), denialKeyEnd, 0)
+	if limit > 0 && len(vs) > limit {
+		vs = vs[len(vs)-limit:]
+	}
+	denials := make([]*pb.AuthDenial, 0, len(vs))
+	for _, v := range vs {
+		d := &pb.AuthDenial{}
+		if err := d.Unmarshal(v); err != nil {
+			as.lg.Warn("解析权限检查失败记录失败", zap.Error(err))
+			continue
+		}
+		denials = append(denials, d)
+	}
+	return denials
+}
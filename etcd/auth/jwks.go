@@ -0,0 +1,204 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// DefaultJWKSRefreshInterval 未指定 jwks-refresh-interval 时JWKS缓存的有效期
+	DefaultJWKSRefreshInterval = 10 * time.Minute
+	// jwksMinRefetchInterval 遇到未知kid时重新拉取JWKS的最小间隔,防止被无效token放大请求
+	jwksMinRefetchInterval = 30 * time.Second
+
+	ErrJWKSKeyNotFound = errors.New("auth: JWKS中找不到签名密钥")
+)
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jwksKey struct {
+	alg string
+	key interface{}
+}
+
+// jwksKeySet 从JWKS地址拉取验签公钥并缓存,缓存过期或遇到未知kid时重新拉取以支持密钥轮换
+type jwksKeySet struct {
+	lg      *zap.Logger
+	url     string
+	refresh time.Duration
+	client  *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]jwksKey
+	fetchedAt time.Time
+}
+
+func newJWKSKeySet(lg *zap.Logger, url string, refresh time.Duration) *jwksKeySet {
+	if refresh <= 0 {
+		refresh = DefaultJWKSRefreshInterval
+	}
+	return &jwksKeySet{
+		lg:      lg,
+		url:     url,
+		refresh: refresh,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// key 返回kid对应的公钥
+func (ks *jwksKeySet) key(kid string) (jwksKey, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	since := time.Since(ks.fetchedAt)
+	if ks.keys == nil || since > ks.refresh {
+		if err := ks.fetchLocked(); err != nil && ks.keys == nil {
+			return jwksKey{}, err
+		}
+	}
+	if k, ok := ks.lookupLocked(kid); ok {
+		return k, nil
+	}
+	// 可能是签发方已经轮换了密钥
+	if time.Since(ks.fetchedAt) > jwksMinRefetchInterval {
+		if err := ks.fetchLocked(); err != nil {
+			return jwksKey{}, err
+		}
+		if k, ok := ks.lookupLocked(kid); ok {
+			return k, nil
+		}
+	}
+	return jwksKey{}, fmt.Errorf("%w: kid=%q", ErrJWKSKeyNotFound, kid)
+}
+
+func (ks *jwksKeySet) lookupLocked(kid string) (jwksKey, bool) {
+	if kid == "" && len(ks.keys) == 1 {
+		// token没有kid时,只有一个密钥才能确定使用哪个
+		for _, k := range ks.keys {
+			return k, true
+		}
+	}
+	k, ok := ks.keys[kid]
+	return k, ok
+}
+
+// fetchLocked 拉取JWKS;失败时保留旧的密钥
+func (ks *jwksKeySet) fetchLocked() error {
+	ks.fetchedAt = time.Now()
+	resp, err := ks.client.Get(ks.url)
+	if err != nil {
+		ks.lg.Warn("拉取JWKS失败", zap.String("url", ks.url), zap.Error(err))
+		return err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("auth: 拉取JWKS返回 %s", resp.Status)
+		ks.lg.Warn("拉取JWKS失败", zap.String("url", ks.url), zap.Error(err))
+		return err
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err = json.Unmarshal(b, &set); err != nil {
+		ks.lg.Warn("解析JWKS失败", zap.String("url", ks.url), zap.Error(err))
+		return err
+	}
+	keys := make(map[string]jwksKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			ks.lg.Warn("忽略无法解析的JWK", zap.String("kid", k.Kid), zap.String("kty", k.Kty), zap.Error(err))
+			continue
+		}
+		keys[k.Kid] = jwksKey{alg: k.Alg, key: pub}
+	}
+	ks.keys = keys
+	ks.lg.Info("已加载JWKS", zap.String("url", ks.url), zap.Int("keys", len(keys)))
+	return nil
+}
+
+func (k jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("不支持的曲线 %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, errors.New("公钥不在曲线上")
+		}
+		return pub, nil
+	}
+	return nil, fmt.Errorf("不支持的密钥类型 %q", k.Kty)
+}
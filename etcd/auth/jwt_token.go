@@ -31,6 +31,12 @@ type tokenJWT struct {
 	key        interface{}
 	ttl        time.Duration
 	verifyOnly bool
+
+	jwks           *jwksKeySet // 非空时从JWKS获取验签公钥
+	issuer         string
+	audience       string
+	usernameClaim  string
+	usernamePrefix string
 }
 
 func (t *tokenJWT) enable()                         {}
@@ -40,25 +46,13 @@ func (t *tokenJWT) genTokenPrefix() (string, error) { return "", nil }
 
 // 从ctx中的token获取用户信息
 func (t *tokenJWT) info(ctx context.Context, token string, rev uint64) (*AuthInfo, bool) {
-	// rev isn't used in JWT, it is only used in simple token
+	// rev 只用于外部签发、不带revision的token
 	var (
 		username string
 		revision uint64
 	)
 
-	parsed, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-		if token.Method.Alg() != t.signMethod.Alg() {
-			return nil, errors.New("invalid signing method")
-		}
-		switch k := t.key.(type) {
-		case *rsa.PrivateKey:
-			return &k.PublicKey, nil
-		case *ecdsa.PrivateKey:
-			return &k.PublicKey, nil
-		default:
-			return t.key, nil
-		}
-	})
+	parsed, err := jwt.Parse(token, t.keyFunc)
 	if err != nil {
 		t.lg.Warn(
 			"failed to parse a JWT token",
@@ -74,25 +68,94 @@ func (t *tokenJWT) info(ctx context.Context, token string, rev uint64) (*AuthInf
 		return nil, false
 	}
 
-	username = claims["username"].(string)
-	revision = uint64(claims["revision"].(float64))
+	if t.issuer != "" && !claims.VerifyIssuer(t.issuer, true) {
+		t.lg.Warn("JWT token issuer mismatch", zap.String("expected", t.issuer), zap.Any("iss", claims["iss"]))
+		return nil, false
+	}
+	if t.audience != "" && !claims.VerifyAudience(t.audience, true) {
+		t.lg.Warn("JWT token audience mismatch", zap.String("expected", t.audience), zap.Any("aud", claims["aud"]))
+		return nil, false
+	}
+
+	name, ok := claims[t.usernameClaim].(string)
+	if !ok || name == "" {
+		t.lg.Warn("JWT token missing username claim", zap.String("claim", t.usernameClaim))
+		return nil, false
+	}
+	username = t.usernamePrefix + name
+
+	if r, ok := claims["revision"].(float64); ok {
+		revision = uint64(r)
+	} else {
+		// 外部签发的token没有revision,视为对当前的权限版本有效
+		revision = rev
+	}
 
 	return &AuthInfo{Username: username, Revision: revision}, true
 }
 
+func (t *tokenJWT) keyFunc(token *jwt.Token) (interface{}, error) {
+	if t.signMethod != nil && token.Method.Alg() != t.signMethod.Alg() {
+		return nil, errors.New("invalid signing method")
+	}
+	if t.jwks != nil {
+		kid, _ := token.Header["kid"].(string)
+		k, err := t.jwks.key(kid)
+		if err != nil {
+			return nil, err
+		}
+		if k.alg != "" && k.alg != token.Method.Alg() {
+			return nil, errors.New("signing method does not match JWK")
+		}
+		// 防止用公钥作为HMAC密钥伪造token
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+			if _, ok := k.key.(*rsa.PublicKey); !ok {
+				return nil, errors.New("signing method does not match JWK")
+			}
+		case *jwt.SigningMethodECDSA:
+			if _, ok := k.key.(*ecdsa.PublicKey); !ok {
+				return nil, errors.New("signing method does not match JWK")
+			}
+		default:
+			return nil, errors.New("invalid signing method")
+		}
+		return k.key, nil
+	}
+	switch k := t.key.(type) {
+	case *rsa.PrivateKey:
+		return &k.PublicKey, nil
+	case *ecdsa.PrivateKey:
+		return &k.PublicKey, nil
+	default:
+		return t.key, nil
+	}
+}
+
 func (t *tokenJWT) assign(ctx context.Context, username string, revision uint64) (string, error) {
 	if t.verifyOnly {
 		return "", ErrVerifyOnly
 	}
 
+	ttl := t.ttl
+	if d, ok := ctx.Value(AuthenticateParamTokenTTL{}).(time.Duration); ok && d > 0 {
+		ttl = d
+	}
+
 	// Future work: let a jwt token include permission information would be useful for
 	// permission checking in proxy side.
-	tk := jwt.NewWithClaims(t.signMethod,
-		jwt.MapClaims{
-			"username": username,
-			"revision": revision,
-			"exp":      time.Now().Add(t.ttl).Unix(),
-		})
+	claims := jwt.MapClaims{
+		t.usernameClaim: username,
+		"revision":      revision,
+		"exp":           time.Now().Add(ttl).Unix(),
+	}
+	if t.issuer != "" {
+		claims["iss"] = t.issuer
+	}
+	if t.audience != "" {
+		claims["aud"] = t.audience
+	}
+	tk := jwt.NewWithClaims(t.signMethod, claims)
 
 	token, err := tk.SignedString(t.key)
 	if err != nil {
@@ -136,16 +199,45 @@ func newTokenProviderJWT(lg *zap.Logger, optMap map[string]string) (*tokenJWT, e
 		lg.Warn("unknown JWT options", zap.Strings("keys", keys))
 	}
 
+	if opts.UsernamePrefix != "" && opts.JWKSURL == "" {
+		// 自己签发的token中的用户名已经是etcd用户名
+		lg.Warn("username-prefix is only used with jwks-url, ignoring")
+		opts.UsernamePrefix = ""
+	}
+
+	if opts.JWKSURL != "" {
+		lg.Info("JWT token verified with JWKS, etcd will not issue tokens",
+			zap.String("jwks-url", opts.JWKSURL),
+			zap.String("issuer", opts.Issuer),
+			zap.String("audience", opts.Audience),
+			zap.String("username-claim", opts.UsernameClaim),
+		)
+		return &tokenJWT{
+			lg:             lg,
+			ttl:            opts.TTL,
+			signMethod:     opts.SignMethod,
+			verifyOnly:     true,
+			jwks:           newJWKSKeySet(lg, opts.JWKSURL, opts.JWKSRefresh),
+			issuer:         opts.Issuer,
+			audience:       opts.Audience,
+			usernameClaim:  opts.UsernameClaim,
+			usernamePrefix: opts.UsernamePrefix,
+		}, nil
+	}
+
 	key, err := opts.Key()
 	if err != nil {
 		return nil, err
 	}
 
 	t := &tokenJWT{
-		lg:         lg,
-		ttl:        opts.TTL,
-		signMethod: opts.SignMethod,
-		key:        key,
+		lg:            lg,
+		ttl:           opts.TTL,
+		signMethod:    opts.SignMethod,
+		key:           key,
+		issuer:        opts.Issuer,
+		audience:      opts.Audience,
+		usernameClaim: opts.UsernameClaim,
 	}
 
 	switch t.signMethod.(type) {
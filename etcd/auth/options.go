@@ -29,6 +29,13 @@ const (
 	optPublicKey  = "pub-key"
 	optPrivateKey = "priv-key"
 	optTTL        = "ttl"
+
+	optJWKSURL        = "jwks-url"
+	optJWKSRefresh    = "jwks-refresh-interval"
+	optIssuer         = "issuer"
+	optAudience       = "audience"
+	optUsernameClaim  = "username-claim"
+	optUsernamePrefix = "username-prefix"
 )
 
 var knownOptions = map[string]bool{
@@ -36,6 +43,13 @@ var knownOptions = map[string]bool{
 	optPublicKey:  true,
 	optPrivateKey: true,
 	optTTL:        true,
+
+	optJWKSURL:        true,
+	optJWKSRefresh:    true,
+	optIssuer:         true,
+	optAudience:       true,
+	optUsernameClaim:  true,
+	optUsernamePrefix: true,
 }
 
 // DefaultTTL will be used when a 'ttl' is not specified
@@ -46,6 +60,14 @@ type jwtOptions struct {
 	PublicKey  []byte
 	PrivateKey []byte
 	TTL        time.Duration
+
+	// 以下用于校验外部(SSO)签发的token
+	JWKSURL        string        // 设置后从该地址获取验签公钥,此时etcd只校验token不签发token
+	JWKSRefresh    time.Duration // JWKS缓存有效期
+	Issuer         string        // 非空时校验 iss
+	Audience       string        // 非空时校验 aud
+	UsernameClaim  string        // 从哪个claim中获取用户名,默认 username
+	UsernamePrefix string        // 映射到etcd用户名时添加的前缀
 }
 
 // ParseWithDefaults will load options from the specified map or set defaults where appropriate
@@ -81,8 +103,27 @@ func (opts *jwtOptions) Parse(optMap map[string]string) error {
 		}
 	}
 
-	// signing method is a required field
+	opts.JWKSURL = optMap[optJWKSURL]
+	if v := optMap[optJWKSRefresh]; v != "" {
+		opts.JWKSRefresh, err = time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+	}
+	opts.Issuer = optMap[optIssuer]
+	opts.Audience = optMap[optAudience]
+	opts.UsernameClaim = optMap[optUsernameClaim]
+	if opts.UsernameClaim == "" {
+		opts.UsernameClaim = "username"
+	}
+	opts.UsernamePrefix = optMap[optUsernamePrefix]
+
+	// signing method is a required field, unless keys come from JWKS
 	method := optMap[optSignMethod]
+	if method == "" && opts.JWKSURL != "" {
+		opts.SignMethod = nil
+		return nil
+	}
 	opts.SignMethod = jwt.GetSigningMethod(method)
 	if opts.SignMethod == nil {
 		return ErrInvalidAuthMethod
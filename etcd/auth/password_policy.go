@@ -0,0 +1,139 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"unicode"
+
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrPasswordTooWeak = errors.New("auth: password does not satisfy the password policy")
+	ErrPasswordExpired = errors.New("auth: password has expired, ask an administrator to reset it")
+	ErrAccountLocked   = errors.New("auth: account is temporarily locked due to too many failed login attempts")
+)
+
+// PasswordPolicy 密码策略,零值表示不做任何限制
+type PasswordPolicy struct {
+	MinLength        int           // 密码最小长度
+	MinClasses       int           // 至少包含几类字符: 小写字母、大写字母、数字、其他字符
+	MaxAge           time.Duration // 密码有效期,过期后不能再用该密码登录
+	LockoutThreshold int           // 连续登录失败多少次后锁定账户
+	LockoutDuration  time.Duration // 锁定时长;超过该时长没有失败的登录,失败计数清零
+}
+
+func (p PasswordPolicy) Validate() error {
+	if p.MinLength < 0 || p.MinClasses < 0 || p.MinClasses > 4 {
+		return fmt.Errorf("invalid password policy: min-length %d, min-classes %d (expected 0-4)", p.MinLength, p.MinClasses)
+	}
+	if p.MaxAge < 0 || p.LockoutThreshold < 0 || p.LockoutDuration < 0 {
+		return errors.New("invalid password policy: negative max-age or lockout settings")
+	}
+	if p.LockoutThreshold > 0 && p.LockoutDuration < time.Second {
+		return errors.New("invalid password policy: lockout-duration must be at least 1s when lockout-threshold is set")
+	}
+	return nil
+}
+
+// WithPasswordPolicy 设置密码复杂度、有效期以及登录失败锁定策略
+func WithPasswordPolicy(p PasswordPolicy) StoreOption {
+	return func(as *authStore) { as.passwordPolicy = p }
+}
+
+// ValidatePassword 检查密码是否满足复杂度要求
+func (as *authStore) ValidatePassword(password string) error {
+	p := as.passwordPolicy
+	if len([]rune(password)) < p.MinLength {
+		return ErrPasswordTooWeak
+	}
+	if p.MinClasses > 0 {
+		var lower, upper, digit, other int
+		for _, c := range password {
+			switch {
+			case unicode.IsLower(c):
+				lower = 1
+			case unicode.IsUpper(c):
+				upper = 1
+			case unicode.IsDigit(c):
+				digit = 1
+			default:
+				other = 1
+			}
+		}
+		if lower+upper+digit+other < p.MinClasses {
+			return ErrPasswordTooWeak
+		}
+	}
+	return nil
+}
+
+// NewLoginFailureRequest 本地用户密码校验失败时,生成记录失败次数的raft请求;未开启锁定或用户不存在时返回nil
+func (as *authStore) NewLoginFailureRequest(username string) *pb.InternalAuthLoginFailureRequest {
+	p := as.passwordPolicy
+	if p.LockoutThreshold <= 0 || !as.hasLocalUser(username) {
+		return nil
+	}
+	return &pb.InternalAuthLoginFailureRequest{
+		Name:      username,
+		Time:      time.Now().Unix(),
+		Threshold: int32(p.LockoutThreshold),
+		Duration:  int64(p.LockoutDuration / time.Second),
+	}
+}
+
+// LoginFailure 记录一次登录失败,在raft apply时调用.
+// 距上次失败超过锁定时长时计数从0开始,达到阈值后锁定账户并清零计数
+func (as *authStore) LoginFailure(r *pb.InternalAuthLoginFailureRequest) error {
+	tx := as.be.BatchTx()
+	tx.Lock()
+	defer tx.Unlock()
+
+	user := getUser(as.lg, tx, r.Name)
+	if user == nil {
+		return ErrUserNotFound
+	}
+
+	if r.Time-user.LastFailedLogin > r.Duration {
+		user.FailedLogins = 0
+	}
+	user.FailedLogins++
+	user.LastFailedLogin = r.Time
+	if r.Threshold > 0 && user.FailedLogins >= r.Threshold {
+		user.LockedUntil = r.Time + r.Duration
+		user.FailedLogins = 0
+		as.lg.Warn(
+			"too many failed login attempts, account locked",
+			zap.String("user-name", r.Name),
+			zap.Time("locked-until", time.Unix(user.LockedUntil, 0)),
+		)
+	}
+	// 失败计数不影响权限,不需要更新鉴权版本号
+	putUser(as.lg, tx, user)
+	return nil
+}
+
+// checkPasswordExpired 检查密码是否过期; 没有记录修改时间的旧用户不过期, now为unix秒
+func (as *authStore) checkPasswordExpired(passwordChangedAt, now int64) error {
+	maxAge := int64(as.passwordPolicy.MaxAge / time.Second)
+	if maxAge > 0 && passwordChangedAt > 0 && now-passwordChangedAt > maxAge {
+		return ErrPasswordExpired
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"testing"
+	"time"
+
+	betesting "github.com/ls-2018/etcd_cn/etcd/mvcc/backend/testing"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newTestAuthStore 创建开启了鉴权的authStore,并添加密码为bar的用户foo
+func newTestAuthStore(t *testing.T, opts ...StoreOption) *authStore {
+	be, _ := betesting.NewDefaultTmpBackend(t)
+	tp := newTokenProviderSimple(zap.NewNop(), func(uint64) <-chan struct{} {
+		ch := make(chan struct{})
+		close(ch)
+		return ch
+	}, time.Minute)
+	as := NewAuthStore(zap.NewNop(), be, tp, bcrypt.MinCost, opts...)
+	t.Cleanup(func() {
+		as.Close()
+		betesting.Close(t, be)
+	})
+
+	if _, err := as.RoleAdd(&pb.AuthRoleAddRequest{Name: rootRole}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := as.UserAdd(&pb.AuthUserAddRequest{Name: rootUser, Password: "root"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := as.UserGrantRole(&pb.AuthUserGrantRoleRequest{User: rootUser, Role: rootRole}); err != nil {
+		t.Fatal(err)
+	}
+	if err := as.AuthEnable(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := as.UserAdd(&pb.AuthUserAddRequest{Name: "foo", Password: "bar", PasswordChangedAt: time.Now().Unix()}); err != nil {
+		t.Fatal(err)
+	}
+	return as
+}
+
+func TestValidatePassword(t *testing.T) {
+	as := &authStore{passwordPolicy: PasswordPolicy{MinLength: 8, MinClasses: 3}}
+	tests := []struct {
+		password string
+		wok      bool
+	}{
+		{"Abc1", false},
+		{"abcdefgh", false},
+		{"abcdefg1", false},
+		{"Abcdefg1", true},
+		{"abcdef1!", true},
+	}
+	for _, tt := range tests {
+		if err := as.ValidatePassword(tt.password); (err == nil) != tt.wok {
+			t.Errorf("ValidatePassword(%q) = %v, want ok %v", tt.password, err, tt.wok)
+		}
+	}
+}
+
+// TestLoginFailureLockout 连续失败达到阈值后锁定账户,锁定期间即使密码正确也不能登录
+func TestLoginFailureLockout(t *testing.T) {
+	as := newTestAuthStore(t, WithPasswordPolicy(PasswordPolicy{LockoutThreshold: 3, LockoutDuration: time.Minute}))
+	r := as.NewLoginFailureRequest("foo")
+	if r == nil || r.Threshold != 3 || r.Duration != 60 {
+		t.Fatalf("login failure request = %+v, want threshold 3 duration 60", r)
+	}
+	if as.NewLoginFailureRequest("nobody") != nil {
+		t.Fatal("login failure request for an unknown user, want nil")
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := as.LoginFailure(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if resp, _ := as.UserGet(&pb.AuthUserGetRequest{Name: "foo"}); resp.FailedLogins != 2 || resp.LockedUntil != 0 {
+		t.Fatalf("user = %+v after 2 failures, want 2 failed logins and not locked", resp)
+	}
+	if _, err := as.CheckPassword("foo", "bar"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := as.LoginFailure(r); err != nil {
+		t.Fatal(err)
+	}
+	resp, _ := as.UserGet(&pb.AuthUserGetRequest{Name: "foo"})
+	if resp.LockedUntil != r.Time+60 || resp.FailedLogins != 0 {
+		t.Fatalf("user = %+v after 3 failures, want locked until %d", resp, r.Time+60)
+	}
+	if _, err := as.CheckPassword("foo", "bar"); err != ErrAccountLocked {
+		t.Fatalf("CheckPassword = %v, want %v", err, ErrAccountLocked)
+	}
+}
+
+// TestLoginFailureDecay 距上次失败超过锁定时长时失败计数重新开始
+func TestLoginFailureDecay(t *testing.T) {
+	as := newTestAuthStore(t)
+	now := time.Now().Unix()
+	for _, at := range []int64{now - 200, now - 150, now} {
+		if err := as.LoginFailure(&pb.InternalAuthLoginFailureRequest{Name: "foo", Time: at, Threshold: 3, Duration: 60}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	resp, _ := as.UserGet(&pb.AuthUserGetRequest{Name: "foo"})
+	if resp.FailedLogins != 1 || resp.LockedUntil != 0 {
+		t.Fatalf("user = %+v, want 1 failed login and not locked", resp)
+	}
+}
+
+// TestCheckPasswordExpired 密码超过有效期后不能登录;没有记录修改时间的用户不过期
+func TestCheckPasswordExpired(t *testing.T) {
+	as := newTestAuthStore(t, WithPasswordPolicy(PasswordPolicy{MaxAge: time.Hour}))
+	if _, err := as.CheckPassword("foo", "bar"); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * time.Hour).Unix()
+	if _, err := as.UserChangePassword(&pb.AuthUserChangePasswordRequest{Name: "foo", Password: "baz", PasswordChangedAt: old}); err != nil {
+		t.Fatal(err)
+	}
+	if resp, _ := as.UserGet(&pb.AuthUserGetRequest{Name: "foo"}); resp.PasswordChangedAt != old {
+		t.Fatalf("password changed at = %d, want %d", resp.PasswordChangedAt, old)
+	}
+	// 密码错误时不暴露密码已过期
+	if _, err := as.CheckPassword("foo", "bar"); err != ErrAuthFailed {
+		t.Fatalf("CheckPassword with wrong password = %v, want %v", err, ErrAuthFailed)
+	}
+	if _, err := as.CheckPassword("foo", "baz"); err != ErrPasswordExpired {
+		t.Fatalf("CheckPassword = %v, want %v", err, ErrPasswordExpired)
+	}
+	if _, err := as.CheckPassword(rootUser, "root"); err != nil {
+		t.Fatalf("CheckPassword for a user without a change time = %v, want nil", err)
+	}
+}
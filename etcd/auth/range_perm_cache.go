@@ -22,14 +22,15 @@ import (
 	"go.uber.org/zap"
 )
 
-func getMergedPerms(lg *zap.Logger, tx backend.BatchTx, userName string) *unifiedRangePermissions {
-	user := getUser(lg, tx, userName)
+func getMergedPerms(lg *zap.Logger, tx backend.BatchTx, user *authpb.User) *unifiedRangePermissions {
 	if user == nil {
 		return nil
 	}
 
 	readPerms := adt.NewIntervalTree()
 	writePerms := adt.NewIntervalTree()
+	denyReadPerms := adt.NewIntervalTree()
+	denyWritePerms := adt.NewIntervalTree()
 
 	for _, roleName := range user.Roles {
 		role := getRole(lg, tx, roleName)
@@ -51,23 +52,29 @@ func getMergedPerms(lg *zap.Logger, tx backend.BatchTx, userName string) *unifie
 				ivl = adt.NewBytesAffinePoint([]byte(perm.Key))
 			}
 
+			read, write := readPerms, writePerms
+			if perm.Deny {
+				read, write = denyReadPerms, denyWritePerms
+			}
 			switch perm.PermType {
 			case authpb.READWRITE:
-				readPerms.Insert(ivl, struct{}{})
-				writePerms.Insert(ivl, struct{}{})
+				read.Insert(ivl, struct{}{})
+				write.Insert(ivl, struct{}{})
 
 			case authpb.READ:
-				readPerms.Insert(ivl, struct{}{})
+				read.Insert(ivl, struct{}{})
 
 			case authpb.WRITE:
-				writePerms.Insert(ivl, struct{}{})
+				write.Insert(ivl, struct{}{})
 			}
 		}
 	}
 
 	return &unifiedRangePermissions{
-		readPerms:  readPerms,
-		writePerms: writePerms,
+		readPerms:      readPerms,
+		writePerms:     writePerms,
+		denyReadPerms:  denyReadPerms,
+		denyWritePerms: denyWritePerms,
 	}
 }
 
@@ -81,12 +88,13 @@ func checkKeyInterval(
 		rangeEnd = nil
 	}
 
+	// 禁止优先: 请求的范围与任意禁止范围有交集即拒绝
 	ivl := adt.NewBytesAffineInterval(key, rangeEnd)
 	switch permtyp {
 	case authpb.READ:
-		return cachedPerms.readPerms.Contains(ivl)
+		return !cachedPerms.denyReadPerms.Intersects(ivl) && cachedPerms.readPerms.Contains(ivl)
 	case authpb.WRITE:
-		return cachedPerms.writePerms.Contains(ivl)
+		return !cachedPerms.denyWritePerms.Intersects(ivl) && cachedPerms.writePerms.Contains(ivl)
 	default:
 		lg.Panic("unknown auth type", zap.String("auth-type", permtyp.String()))
 	}
@@ -97,20 +105,21 @@ func checkKeyPoint(lg *zap.Logger, cachedPerms *unifiedRangePermissions, key []b
 	pt := adt.NewBytesAffinePoint(key)
 	switch permtyp {
 	case authpb.READ:
-		return cachedPerms.readPerms.Intersects(pt)
+		return !cachedPerms.denyReadPerms.Intersects(pt) && cachedPerms.readPerms.Intersects(pt)
 	case authpb.WRITE:
-		return cachedPerms.writePerms.Intersects(pt)
+		return !cachedPerms.denyWritePerms.Intersects(pt) && cachedPerms.writePerms.Intersects(pt)
 	default:
 		lg.Panic("unknown auth type", zap.String("auth-type", permtyp.String()))
 	}
 	return false
 }
 
-func (as *authStore) isRangeOpPermitted(tx backend.BatchTx, userName string, key, rangeEnd []byte, permtyp authpb.Permission_Type) bool {
+func (as *authStore) isRangeOpPermitted(tx backend.BatchTx, user *authpb.User, key, rangeEnd []byte, permtyp authpb.Permission_Type) bool {
 	// assumption: tx is Lock()ed
+	userName := user.Name
 	_, ok := as.rangePermCache[userName]
 	if !ok {
-		perms := getMergedPerms(as.lg, tx, userName)
+		perms := getMergedPerms(as.lg, tx, user)
 		if perms == nil {
 			as.lg.Error(
 				"failed to create a merged permission",
@@ -137,7 +146,10 @@ func (as *authStore) invalidateCachedPerm(userName string) {
 	delete(as.rangePermCache, userName)
 }
 
+// unifiedRangePermissions 用户所有角色合并后的权限,deny*Perms 为禁止的范围,优先于允许的范围
 type unifiedRangePermissions struct {
-	readPerms  adt.IntervalTree
-	writePerms adt.IntervalTree
+	readPerms      adt.IntervalTree
+	writePerms     adt.IntervalTree
+	denyReadPerms  adt.IntervalTree
+	denyWritePerms adt.IntervalTree
 }
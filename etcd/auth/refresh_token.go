@@ -0,0 +1,136 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/ls-2018/etcd_cn/offical/api/v3/authpb"
+)
+
+// maxRefreshTokensPerUser 每个用户最多保留的refresh token数量,超过时丢弃最早签发的
+const maxRefreshTokensPerUser = 16
+
+var ErrInvalidRefreshToken = errors.New("auth: invalid or revoked refresh token")
+
+// AuthenticateParamRefreshToken is used for a key of context in the parameters of Authenticate(),
+// 值为 *RefreshTokenParam
+type AuthenticateParamRefreshToken struct{}
+
+// RefreshTokenParam 本次认证签发和作废的refresh token,由API层生成并随raft日志同步
+type RefreshTokenParam struct {
+	Hash      string // 新签发的refresh token摘要,为空表示不签发
+	ExpiresAt int64
+	PrevHash  string // 用于换取token的refresh token摘要,换取后作废
+	IssuedAt  int64  // 签发时间,早于该时间过期的refresh token会被清理
+}
+
+// WithRefreshTokenTTL 认证成功时签发有效期为ttl的refresh token,0表示不签发
+func WithRefreshTokenTTL(ttl time.Duration) StoreOption {
+	return func(as *authStore) { as.refreshTokenTTL = ttl }
+}
+
+// HashRefreshToken 返回refresh token的摘要,后端只保存摘要
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewRefreshToken 为用户生成refresh token,未开启时返回空字符串
+func (as *authStore) NewRefreshToken(username string) (token string, expiresAt int64, err error) {
+	if as.refreshTokenTTL <= 0 {
+		return "", 0, nil
+	}
+	b := make([]byte, 32)
+	if _, err = rand.Read(b); err != nil {
+		return "", 0, err
+	}
+	// 用户名编码在token中,校验时不需要遍历所有用户
+	token = base64.RawURLEncoding.EncodeToString([]byte(username)) + "." + hex.EncodeToString(b)
+	return token, time.Now().Add(as.refreshTokenTTL).Unix(), nil
+}
+
+// CheckRefreshToken 校验refresh token,返回对应的用户名以及当前鉴权版本号
+func (as *authStore) CheckRefreshToken(token string) (string, uint64, error) {
+	if !as.IsAuthEnabled() {
+		return "", 0, ErrAuthNotEnabled
+	}
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return "", 0, ErrInvalidRefreshToken
+	}
+	name, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", 0, ErrInvalidRefreshToken
+	}
+
+	tx := as.be.BatchTx()
+	tx.Lock()
+	defer tx.Unlock()
+
+	user := getUser(as.lg, tx, string(name))
+	if user == nil {
+		return "", 0, ErrInvalidRefreshToken
+	}
+	now := time.Now().Unix()
+	if user.LockedUntil > now {
+		return "", 0, ErrAccountLocked
+	}
+	hash := HashRefreshToken(token)
+	for _, rt := range user.RefreshTokens {
+		if rt.Hash == hash && rt.ExpiresAt > now {
+			// 与Authenticate一致,token有效后才检查密码是否过期
+			if err = as.checkPasswordExpired(user.PasswordChangedAt, now); err != nil {
+				return "", 0, err
+			}
+			return user.Name, getRevision(tx), nil
+		}
+	}
+	return "", 0, ErrInvalidRefreshToken
+}
+
+// updateRefreshTokens 作废换取token的refresh token,清理过期的并加入新签发的; tx需要已经加锁
+func (as *authStore) updateRefreshTokens(user *authpb.User, p *RefreshTokenParam) error {
+	found := p.PrevHash == ""
+	var tokens []*authpb.RefreshToken
+	for _, rt := range user.RefreshTokens {
+		if rt.ExpiresAt <= p.IssuedAt {
+			continue
+		}
+		if p.PrevHash != "" && rt.Hash == p.PrevHash {
+			found = true
+			continue
+		}
+		tokens = append(tokens, rt)
+	}
+	if !found {
+		// 已经被使用、撤销或者过期
+		return ErrInvalidRefreshToken
+	}
+	if p.Hash != "" {
+		tokens = append(tokens, &authpb.RefreshToken{Hash: p.Hash, ExpiresAt: p.ExpiresAt})
+	}
+	if len(tokens) > maxRefreshTokensPerUser {
+		tokens = tokens[len(tokens)-maxRefreshTokensPerUser:]
+	}
+	user.RefreshTokens = tokens
+	return nil
+}
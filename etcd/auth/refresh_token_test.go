@@ -0,0 +1,104 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ls-2018/etcd_cn/offical/api/v3/authpb"
+)
+
+// authenticateWithRefresh 按API层的方式认证foo,并签发、作废refresh token
+func authenticateWithRefresh(as *authStore, index uint64, p *RefreshTokenParam) error {
+	ctx := context.WithValue(context.Background(), AuthenticateParamIndex{}, index)
+	ctx = context.WithValue(ctx, AuthenticateParamSimpleTokenPrefix{}, "prefix")
+	ctx = context.WithValue(ctx, AuthenticateParamRefreshToken{}, p)
+	_, err := as.Authenticate(ctx, "foo", "")
+	return err
+}
+
+func (as *authStore) getUser(t *testing.T, name string) *authpb.User {
+	tx := as.be.BatchTx()
+	tx.Lock()
+	defer tx.Unlock()
+	user := getUser(as.lg, tx, name)
+	if user == nil {
+		t.Fatalf("user %s not found", name)
+	}
+	return user
+}
+
+func TestNewRefreshTokenDisabled(t *testing.T) {
+	as := &authStore{}
+	if tok, _, err := as.NewRefreshToken("foo"); err != nil || tok != "" {
+		t.Fatalf("NewRefreshToken = %q, %v, want no token", tok, err)
+	}
+}
+
+// TestRefreshTokenRotation refresh token换取新token后作废,不能再次使用
+func TestRefreshTokenRotation(t *testing.T) {
+	as := newTestAuthStore(t, WithRefreshTokenTTL(time.Hour))
+	now := time.Now().Unix()
+	tok1, exp, err := as.NewRefreshToken("foo")
+	if err != nil || tok1 == "" {
+		t.Fatalf("NewRefreshToken = %q, %v", tok1, err)
+	}
+	if err = authenticateWithRefresh(as, 1, &RefreshTokenParam{Hash: HashRefreshToken(tok1), ExpiresAt: exp, IssuedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	if name, _, err := as.CheckRefreshToken(tok1); err != nil || name != "foo" {
+		t.Fatalf("CheckRefreshToken = %q, %v, want foo", name, err)
+	}
+
+	tok2, exp, _ := as.NewRefreshToken("foo")
+	rotate := &RefreshTokenParam{Hash: HashRefreshToken(tok2), ExpiresAt: exp, PrevHash: HashRefreshToken(tok1), IssuedAt: now}
+	if err = authenticateWithRefresh(as, 2, rotate); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = as.CheckRefreshToken(tok1); err != ErrInvalidRefreshToken {
+		t.Fatalf("CheckRefreshToken with a used token = %v, want %v", err, ErrInvalidRefreshToken)
+	}
+	if name, _, err := as.CheckRefreshToken(tok2); err != nil || name != "foo" {
+		t.Fatalf("CheckRefreshToken = %q, %v, want foo", name, err)
+	}
+	// 同一个refresh token并发换取时只有先apply的成功
+	if err = authenticateWithRefresh(as, 3, rotate); err != ErrInvalidRefreshToken {
+		t.Fatalf("reusing a refresh token = %v, want %v", err, ErrInvalidRefreshToken)
+	}
+}
+
+// TestRefreshTokenExpired 过期的refresh token不能使用,并在下一次签发时被清理
+func TestRefreshTokenExpired(t *testing.T) {
+	as := newTestAuthStore(t, WithRefreshTokenTTL(time.Hour))
+	now := time.Now().Unix()
+	tok, _, _ := as.NewRefreshToken("foo")
+	if err := authenticateWithRefresh(as, 1, &RefreshTokenParam{Hash: HashRefreshToken(tok), ExpiresAt: now - 1, IssuedAt: now - 10}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := as.CheckRefreshToken(tok); err != ErrInvalidRefreshToken {
+		t.Fatalf("CheckRefreshToken with an expired token = %v, want %v", err, ErrInvalidRefreshToken)
+	}
+	if err := authenticateWithRefresh(as, 2, &RefreshTokenParam{IssuedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(as.getUser(t, "foo").RefreshTokens); n != 0 {
+		t.Fatalf("%d refresh tokens kept, want expired ones removed", n)
+	}
+	if _, _, err := as.CheckRefreshToken("garbage"); err != ErrInvalidRefreshToken {
+		t.Fatalf("CheckRefreshToken with a malformed token = %v, want %v", err, ErrInvalidRefreshToken)
+	}
+}
@@ -44,6 +44,7 @@ var (
 
 type simpleTokenTTLKeeper struct {
 	tokens          map[string]time.Time
+	ttls            map[string]time.Duration // 单独设置了有效期的token
 	donec           chan struct{}
 	stopc           chan struct{}
 	deleteTokenFunc func(string)
@@ -59,18 +60,28 @@ func (tm *simpleTokenTTLKeeper) stop() {
 	<-tm.donec
 }
 
-func (tm *simpleTokenTTLKeeper) addSimpleToken(token string) {
-	tm.tokens[token] = time.Now().Add(tm.simpleTokenTTL)
+func (tm *simpleTokenTTLKeeper) addSimpleToken(token string, ttl time.Duration) {
+	if ttl > 0 {
+		tm.ttls[token] = ttl
+	} else {
+		ttl = tm.simpleTokenTTL
+	}
+	tm.tokens[token] = time.Now().Add(ttl)
 }
 
 func (tm *simpleTokenTTLKeeper) resetSimpleToken(token string) {
 	if _, ok := tm.tokens[token]; ok {
-		tm.tokens[token] = time.Now().Add(tm.simpleTokenTTL)
+		ttl, ok := tm.ttls[token]
+		if !ok {
+			ttl = tm.simpleTokenTTL
+		}
+		tm.tokens[token] = time.Now().Add(ttl)
 	}
 }
 
 func (tm *simpleTokenTTLKeeper) deleteSimpleToken(token string) {
 	delete(tm.tokens, token)
+	delete(tm.ttls, token)
 }
 
 func (tm *simpleTokenTTLKeeper) run() {
@@ -88,6 +99,7 @@ func (tm *simpleTokenTTLKeeper) run() {
 				if nowtime.After(tokenendtime) {
 					tm.deleteTokenFunc(t)
 					delete(tm.tokens, t)
+					delete(tm.ttls, t)
 					//	 不过你要注意的是,Simple Token 字符串本身并未含任何有价值信息,因此 client 无法及时、准确获取到 Token 过期时间.所以 client 不容易提前去规避因 Token 失效导致的请求报错.
 				}
 			}
@@ -122,7 +134,7 @@ func (t *tokenSimple) genTokenPrefix() (string, error) {
 	return string(ret), nil
 }
 
-func (t *tokenSimple) assignSimpleTokenToUser(username, token string) {
+func (t *tokenSimple) assignSimpleTokenToUser(username, token string, ttl time.Duration) {
 	t.simpleTokensMu.Lock()
 	defer t.simpleTokensMu.Unlock()
 	if t.simpleTokenKeeper == nil {
@@ -139,7 +151,7 @@ func (t *tokenSimple) assignSimpleTokenToUser(username, token string) {
 	}
 
 	t.simpleTokens[token] = username
-	t.simpleTokenKeeper.addSimpleToken(token)
+	t.simpleTokenKeeper.addSimpleToken(token, ttl)
 }
 
 func (t *tokenSimple) invalidateUser(username string) {
@@ -173,6 +185,7 @@ func (t *tokenSimple) enable() {
 	}
 	t.simpleTokenKeeper = &simpleTokenTTLKeeper{
 		tokens:          make(map[string]time.Time),
+		ttls:            make(map[string]time.Duration),
 		donec:           make(chan struct{}),
 		stopc:           make(chan struct{}),
 		deleteTokenFunc: delf,
@@ -211,7 +224,8 @@ func (t *tokenSimple) assign(ctx context.Context, username string, rev uint64) (
 	index := ctx.Value(AuthenticateParamIndex{}).(uint64)
 	simpleTokenPrefix := ctx.Value(AuthenticateParamSimpleTokenPrefix{}).(string)
 	token := fmt.Sprintf("%s.%d", simpleTokenPrefix, index)
-	t.assignSimpleTokenToUser(username, token)
+	ttl, _ := ctx.Value(AuthenticateParamTokenTTL{}).(time.Duration)
+	t.assignSimpleTokenToUser(username, token, ttl)
 
 	return token, nil
 }
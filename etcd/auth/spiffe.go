@@ -0,0 +1,59 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"crypto/x509"
+	"fmt"
+	"strings"
+
+	"github.com/ls-2018/etcd_cn/client_sdk/pkg/tlsutil"
+	"go.uber.org/zap"
+)
+
+const (
+	// SPIFFEUserMappingNone 不使用SPIFFE ID,用户名取证书的CommonName
+	SPIFFEUserMappingNone = ""
+	// SPIFFEUserMappingID 用户名为完整的SPIFFE ID,例如 spiffe://example.org/ns/prod/sa/api
+	SPIFFEUserMappingID = "id"
+	// SPIFFEUserMappingPath 用户名为SPIFFE ID的路径部分,例如 ns/prod/sa/api
+	SPIFFEUserMappingPath = "path"
+)
+
+// ValidateSPIFFEUserMapping 检查SPIFFE用户映射方式是否合法
+func ValidateSPIFFEUserMapping(mapping string) error {
+	switch mapping {
+	case SPIFFEUserMappingNone, SPIFFEUserMappingID, SPIFFEUserMappingPath:
+		return nil
+	}
+	return fmt.Errorf("未知的SPIFFE用户映射方式 %q (支持 %q, %q)", mapping, SPIFFEUserMappingID, SPIFFEUserMappingPath)
+}
+
+// usernameFromCert 返回客户端证书对应的用户名;开启SPIFFE映射且证书为X509-SVID时使用SPIFFE ID,否则使用CommonName
+func (as *authStore) usernameFromCert(cert *x509.Certificate) string {
+	if as.spiffeMapping == SPIFFEUserMappingNone {
+		return cert.Subject.CommonName
+	}
+	id, ok := tlsutil.SPIFFEID(cert)
+	if !ok {
+		return cert.Subject.CommonName
+	}
+	name := id.String()
+	if as.spiffeMapping == SPIFFEUserMappingPath {
+		name = strings.TrimPrefix(id.EscapedPath(), "/")
+	}
+	as.lg.Debug("使用SPIFFE ID作为用户名", zap.String("spiffe-id", id.String()), zap.String("user-name", name))
+	return name
+}
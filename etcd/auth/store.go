@@ -82,6 +82,9 @@ const (
 type AuthInfo struct {
 	Username string
 	Revision uint64
+	// Time 请求的提议时间(UnixNano),apply时来自raft日志,用于判断外部用户是否过期;
+	// 为0时使用本地时间
+	Time int64
 }
 
 // AuthenticateParamIndex is used for a key of context in the parameters of Authenticate()
@@ -90,6 +93,10 @@ type AuthenticateParamIndex struct{}
 // AuthenticateParamSimpleTokenPrefix is used for a key of context in the parameters of Authenticate()
 type AuthenticateParamSimpleTokenPrefix struct{}
 
+// AuthenticateParamExternalUser is used for a key of context in the parameters of Authenticate(),
+// 值为 *ExternalUserParam,只有外部用户才设置
+type AuthenticateParamExternalUser struct{}
+
 type AuthStore interface {
 	AuthEnable() error
 	AuthDisable()
@@ -116,6 +123,7 @@ type AuthStore interface {
 	IsRangePermitted(authInfo *AuthInfo, key, rangeEnd []byte) error       // 检查用户的范围权限
 	IsDeleteRangePermitted(authInfo *AuthInfo, key, rangeEnd []byte) error //
 	IsAdminPermitted(authInfo *AuthInfo) error                             //
+	IsOpPermitted(authInfo *AuthInfo, op string) error                     // 检查用户是否可以执行非KV操作
 	GenTokenPrefix() (string, error)                                       // 在简单令牌的情况下生成一个随机字符串,在JWT的情况下,它生成一个空字符串
 	Revision() uint64                                                      //
 	CheckPassword(username, password string) (uint64, error)               // 检查给定的一对用户名和密码是否正确
@@ -125,6 +133,24 @@ type AuthStore interface {
 	WithRoot(ctx context.Context) context.Context                          // 生成并安装可作为根凭据使用的令牌
 	UserHasRole(user, role string) bool                                    // 检查用户是否有该角色
 	BcryptCost() int                                                       // 获取加密认证密码的散列强度
+	// CheckCredentials 同CheckPassword,本地不存在的用户交由外部认证
+	CheckCredentials(ctx context.Context, username, password string) (*Identity, uint64, error)
+	// ValidatePassword 检查密码是否满足密码策略
+	ValidatePassword(password string) error
+	// NewLoginFailureRequest 生成记录登录失败的raft请求,未开启锁定时返回nil
+	NewLoginFailureRequest(username string) *pb.InternalAuthLoginFailureRequest
+	// LoginFailure 记录一次登录失败,达到阈值后锁定账户
+	LoginFailure(r *pb.InternalAuthLoginFailureRequest) error
+	// NewRefreshToken 生成refresh token,未开启时返回空字符串
+	NewRefreshToken(username string) (token string, expiresAt int64, err error)
+	// CheckRefreshToken 校验refresh token,返回对应的用户名和鉴权版本号
+	CheckRefreshToken(token string) (string, uint64, error)
+	// RecordDenial 按采样比例记录一次权限检查失败,记录只保存在本节点
+	RecordDenial(d *pb.AuthDenial)
+	// Denials 返回本节点最近记录的权限检查失败
+	Denials(limit int) []*pb.AuthDenial
+	// DropDenials 删除最早的最多n条记录,返回删除的条数
+	DropDenials(n int) int
 }
 
 type TokenProvider interface {
@@ -137,14 +163,31 @@ type TokenProvider interface {
 }
 
 type authStore struct {
-	revision       uint64                              // 鉴权版本号
-	lg             *zap.Logger                         //
-	be             backend.Backend                     //
-	enabled        bool                                // 是否开启认证
-	enabledMu      sync.RWMutex                        //
-	rangePermCache map[string]*unifiedRangePermissions // username -> unifiedRangePermissions
-	tokenProvider  TokenProvider                       // TODO
-	bcryptCost     int                                 // the algorithm cost / strength for hashing auth passwords
+	revision          uint64                              // 鉴权版本号
+	lg                *zap.Logger                         //
+	be                backend.Backend                     //
+	enabled           bool                                // 是否开启认证
+	enabledMu         sync.RWMutex                        //
+	rangePermCache    map[string]*unifiedRangePermissions // username -> unifiedRangePermissions
+	tokenProvider     TokenProvider                       // TODO
+	bcryptCost        int                                 // the algorithm cost / strength for hashing auth passwords
+	spiffeMapping     string                              // 客户端SVID映射用户名的方式
+	authenticator     Authenticator                       // 本地不存在的用户交由外部认证
+	passwordPolicy    PasswordPolicy                      // 密码复杂度、有效期以及登录失败锁定策略
+	refreshTokenTTL   time.Duration                       // refresh token有效期,0表示不签发
+	tokenTTLOverrides TokenTTLOverrides                   // 按用户或角色设置的token有效期
+	denialAudit       DenialAudit                         // 权限检查失败的审计配置
+	auditMu           sync.Mutex                          //
+	auditSeq          uint64                              // 下一条审计记录的序号
+	auditCount        int                                 // 后端中审计记录的数量
+}
+
+// StoreOption 创建authStore时的可选配置
+type StoreOption func(as *authStore)
+
+// WithSPIFFEUserMapping 客户端证书为X509-SVID时,按mapping从SPIFFE ID得到用户名,代替CommonName
+func WithSPIFFEUserMapping(mapping string) StoreOption {
+	return func(as *authStore) { as.spiffeMapping = mapping }
 }
 
 func (as *authStore) AuthEnable() error {
@@ -224,12 +267,37 @@ func (as *authStore) Authenticate(ctx context.Context, username, password string
 	defer tx.Unlock()
 
 	user := getUser(as.lg, tx, username)
-	if user == nil {
+	if p, ok := ctx.Value(AuthenticateParamExternalUser{}).(*ExternalUserParam); ok {
+		// 外部认证返回的用户名与本地用户相同时拒绝,避免获得本地用户(例如root)的角色
+		if user != nil {
+			as.lg.Warn("external user name conflicts with local user", zap.String("user-name", username))
+			return nil, ErrAuthFailed
+		}
+		as.putExternalUser(tx, username, p)
+		user = &authpb.User{Name: username, Roles: p.Roles}
+	} else if user == nil {
 		return nil, ErrAuthFailed
-	}
-
-	if user.Options != nil && user.Options.NoPassword {
+	} else if user.Options != nil && user.Options.NoPassword {
 		return nil, ErrAuthFailed
+	} else {
+		updated := false
+		if user.FailedLogins != 0 || user.LastFailedLogin != 0 {
+			// 登录成功,清空失败计数
+			user.FailedLogins, user.LastFailedLogin = 0, 0
+			updated = true
+		}
+		if p, ok := ctx.Value(AuthenticateParamRefreshToken{}).(*RefreshTokenParam); ok {
+			if err := as.updateRefreshTokens(user, p); err != nil {
+				return nil, err
+			}
+			updated = true
+		}
+		if updated {
+			putUser(as.lg, tx, user)
+		}
+	}
+	if ttl := as.tokenTTL(user); ttl > 0 {
+		ctx = context.WithValue(ctx, AuthenticateParamTokenTTL{}, ttl)
 	}
 
 	// 密码在API已经校验了,因此在这不用再校验
@@ -255,6 +323,7 @@ func (as *authStore) Recover(be backend.Backend) {
 	}
 
 	as.setRevision(getRevision(tx))
+	as.loadDenialAudit(tx)
 
 	tx.Unlock()
 
@@ -267,12 +336,13 @@ func (as *authStore) authInfoFromToken(ctx context.Context, token string) (*Auth
 	return as.tokenProvider.info(ctx, token, as.Revision())
 }
 
-func (as *authStore) isOpPermitted(userName string, revision uint64, key, rangeEnd []byte, permTyp authpb.Permission_Type) error {
+func (as *authStore) isOpPermitted(authInfo *AuthInfo, key, rangeEnd []byte, permTyp authpb.Permission_Type) error {
 	// 这个函数的开销很大,所以我们需要一个缓存机制
 	if !as.IsAuthEnabled() {
 		return nil
 	}
 
+	userName, revision := authInfo.Username, authInfo.Revision
 	// only gets rev == 0 when passed AuthInfo{}; no user given
 	if revision == 0 {
 		return ErrUserEmpty
@@ -291,7 +361,7 @@ func (as *authStore) isOpPermitted(userName string, revision uint64, key, rangeE
 	tx.Lock()
 	defer tx.Unlock()
 
-	user := getUser(as.lg, tx, userName)
+	user := as.lookupUser(tx, userName, authInfo.Time)
 	if user == nil {
 		as.lg.Error("cannot find a user for permission check", zap.String("user-name", userName))
 		return ErrPermissionDenied
@@ -302,7 +372,7 @@ func (as *authStore) isOpPermitted(userName string, revision uint64, key, rangeE
 		return nil
 	}
 
-	if as.isRangeOpPermitted(tx, userName, key, rangeEnd, permTyp) {
+	if as.isRangeOpPermitted(tx, user, key, rangeEnd, permTyp) {
 		return nil
 	}
 
@@ -310,15 +380,15 @@ func (as *authStore) isOpPermitted(userName string, revision uint64, key, rangeE
 }
 
 func (as *authStore) IsPutPermitted(authInfo *AuthInfo, key []byte) error {
-	return as.isOpPermitted(authInfo.Username, authInfo.Revision, key, nil, authpb.WRITE)
+	return as.isOpPermitted(authInfo, key, nil, authpb.WRITE)
 }
 
 func (as *authStore) IsRangePermitted(authInfo *AuthInfo, key, rangeEnd []byte) error {
-	return as.isOpPermitted(authInfo.Username, authInfo.Revision, key, rangeEnd, authpb.READ) // '' ,0 ,health,nil
+	return as.isOpPermitted(authInfo, key, rangeEnd, authpb.READ) // '' ,0 ,health,nil
 }
 
 func (as *authStore) IsDeleteRangePermitted(authInfo *AuthInfo, key, rangeEnd []byte) error {
-	return as.isOpPermitted(authInfo.Username, authInfo.Revision, key, rangeEnd, authpb.WRITE)
+	return as.isOpPermitted(authInfo, key, rangeEnd, authpb.WRITE)
 }
 
 func (as *authStore) IsAdminPermitted(authInfo *AuthInfo) error {
@@ -331,7 +401,7 @@ func (as *authStore) IsAdminPermitted(authInfo *AuthInfo) error {
 
 	tx := as.be.BatchTx()
 	tx.Lock()
-	u := getUser(as.lg, tx, authInfo.Username)
+	u := as.lookupUser(tx, authInfo.Username, authInfo.Time)
 	tx.Unlock()
 
 	if u == nil {
@@ -353,7 +423,7 @@ func (as *authStore) IsAuthEnabled() bool {
 }
 
 // NewAuthStore creates a new AuthStore.
-func NewAuthStore(lg *zap.Logger, be backend.Backend, tp TokenProvider, bcryptCost int) *authStore {
+func NewAuthStore(lg *zap.Logger, be backend.Backend, tp TokenProvider, bcryptCost int, opts ...StoreOption) *authStore {
 	if lg == nil {
 		lg = zap.NewNop()
 	}
@@ -393,6 +463,10 @@ func NewAuthStore(lg *zap.Logger, be backend.Backend, tp TokenProvider, bcryptCo
 		tokenProvider:  tp,
 		bcryptCost:     bcryptCost,
 	}
+	for _, opt := range opts {
+		opt(as)
+	}
+	as.loadDenialAudit(tx)
 
 	if enabled {
 		as.tokenProvider.enable()
@@ -454,7 +528,7 @@ func (as *authStore) AuthInfoFromTLS(ctx context.Context) (ai *AuthInfo) {
 			continue
 		}
 		ai = &AuthInfo{
-			Username: chains[0].Subject.CommonName,
+			Username: as.usernameFromCert(chains[0]),
 			Revision: as.Revision(),
 		}
 		md, ok := metadata.FromIncomingContext(ctx)
@@ -520,7 +594,8 @@ func decomposeOpts(lg *zap.Logger, optstr string) (string, map[string]string, er
 
 	typeSpecificOpts := make(map[string]string)
 	for i := 1; i < len(opts); i++ {
-		pair := strings.Split(opts[i], "=")
+		// 值中可能包含'=',例如 jwks-url
+		pair := strings.SplitN(opts[i], "=", 2)
 
 		if len(pair) != 2 {
 			if lg != nil {
@@ -634,8 +709,19 @@ func (as *authStore) RoleRevokePermission(r *pb.AuthRoleRevokePermissionRequest)
 		return nil, ErrRoleNotFound
 	}
 
+	if r.Operation != "" {
+		if err := as.roleRevokeOperation(role, r.Operation); err != nil {
+			return nil, err
+		}
+		putRole(as.lg, tx, role)
+		as.commitRevision(tx)
+		as.lg.Info("撤销角色的操作权限", zap.String("role-name", r.Role), zap.String("operation", r.Operation))
+		return &pb.AuthRoleRevokePermissionResponse{}, nil
+	}
+
 	updatedRole := &authpb.Role{
-		Name: role.Name,
+		Name:         role.Name,
+		OpPermission: role.OpPermission,
 	}
 
 	for _, perm := range role.KeyPermission {
@@ -671,6 +757,17 @@ func (as *authStore) RoleGrantPermission(r *pb.AuthRoleGrantPermissionRequest) (
 	if role == nil {
 		return nil, ErrRoleNotFound
 	}
+
+	if r.Perm.Operation != "" {
+		if err := as.roleGrantOperation(role, r.Perm.Operation); err != nil {
+			return nil, err
+		}
+		putRole(as.lg, tx, role)
+		as.commitRevision(tx)
+		as.lg.Info("授予角色操作权限", zap.String("role-name", r.Name), zap.String("operation", r.Perm.Operation))
+		return &pb.AuthRoleGrantPermissionResponse{}, nil
+	}
+
 	// 在已有的权限中, 寻找第一个与key相等的,没找到的话 idx =len(role.KeyPermission)
 	idx := sort.Search(len(role.KeyPermission), func(i int) bool {
 		// a,a 0
@@ -684,11 +781,13 @@ func (as *authStore) RoleGrantPermission(r *pb.AuthRoleGrantPermissionRequest) (
 	if idx < len(role.KeyPermission) && strings.EqualFold(role.KeyPermission[idx].Key, r.Perm.Key) && strings.EqualFold(role.KeyPermission[idx].RangeEnd, r.Perm.RangeEnd) {
 		// 更新存在的权限
 		role.KeyPermission[idx].PermType = r.Perm.PermType
+		role.KeyPermission[idx].Deny = r.Perm.Deny
 	} else {
 		newPerm := &authpb.Permission{
 			Key:      r.Perm.Key,      // /
 			RangeEnd: r.Perm.RangeEnd, // ""
 			PermType: r.Perm.PermType, // readwrite
+			Deny:     r.Perm.Deny,
 		}
 
 		role.KeyPermission = append(role.KeyPermission, newPerm)
@@ -702,7 +801,7 @@ func (as *authStore) RoleGrantPermission(r *pb.AuthRoleGrantPermissionRequest) (
 
 	as.commitRevision(tx)
 
-	as.lg.Info("授予/更新用户权限", zap.String("user-name", r.Name), zap.String("permission-name", authpb.PermissionTypeName[int32(r.Perm.PermType)]))
+	as.lg.Info("授予/更新用户权限", zap.String("user-name", r.Name), zap.String("permission-name", authpb.PermissionTypeName[int32(r.Perm.PermType)]), zap.Bool("deny", r.Perm.Deny))
 	return &pb.AuthRoleGrantPermissionResponse{}, nil
 }
 
@@ -740,10 +839,16 @@ func (as *authStore) RoleDelete(r *pb.AuthRoleDeleteRequest) (*pb.AuthRoleDelete
 
 	users := getAllUsers(as.lg, tx) // 获取所有用户
 	for _, user := range users {
+		// 保留密码过期、登录锁定和refresh token状态,只移除被删除的角色
 		updatedUser := &authpb.User{
-			Name:     user.Name,
-			Password: user.Password,
-			Options:  user.Options,
+			Name:              user.Name,
+			Password:          user.Password,
+			Options:           user.Options,
+			PasswordChangedAt: user.PasswordChangedAt,
+			FailedLogins:      user.FailedLogins,
+			LastFailedLogin:   user.LastFailedLogin,
+			LockedUntil:       user.LockedUntil,
+			RefreshTokens:     user.RefreshTokens,
 		}
 		for _, role := range user.Roles {
 			if role != r.Role {
@@ -803,6 +908,7 @@ func (as *authStore) RoleGet(r *pb.AuthRoleGetRequest) (*pb.AuthRoleGetResponse,
 		return nil, ErrRoleNotFound
 	}
 	resp.Perm = append(resp.Perm, role.KeyPermission...)
+	resp.Operations = append(resp.Operations, role.OpPermission...)
 	return &resp, nil
 }
 
@@ -923,6 +1029,10 @@ func (as *authStore) CheckPassword(username, password string) (uint64, error) {
 			return 0, ErrNoPasswordUser
 		}
 
+		if user.LockedUntil > time.Now().Unix() {
+			return 0, ErrAccountLocked
+		}
+
 		return getRevision(tx), nil
 	}()
 	if err != nil {
@@ -933,6 +1043,10 @@ func (as *authStore) CheckPassword(username, password string) (uint64, error) {
 		as.lg.Info("invalid password", zap.String("user-name", username))
 		return 0, ErrAuthFailed
 	}
+	// 密码正确后才检查是否过期,避免泄露密码状态
+	if err = as.checkPasswordExpired(user.PasswordChangedAt, time.Now().Unix()); err != nil {
+		return 0, err
+	}
 	return revision, nil
 }
 
@@ -968,12 +1082,15 @@ func (as *authStore) UserAdd(r *pb.AuthUserAddRequest) (*pb.AuthUserAddResponse,
 	}
 
 	newUser := &authpb.User{
-		Name:     r.Name,
-		Password: string(password),
-		Options:  options,
+		Name:              r.Name,
+		Password:          string(password),
+		Options:           options,
+		PasswordChangedAt: r.PasswordChangedAt,
 	}
 
 	putUser(as.lg, tx, newUser)
+	// 同名的外部用户不再生效
+	as.delExternalUser(tx, r.Name)
 
 	as.commitRevision(tx)
 
@@ -1031,11 +1148,13 @@ func (as *authStore) UserChangePassword(r *pb.AuthUserChangePasswordRequest) (*p
 		}
 	}
 
+	// 修改密码同时解除锁定,并作废所有的refresh token
 	updatedUser := &authpb.User{
-		Name:     r.Name,
-		Roles:    user.Roles,
-		Password: string(password),
-		Options:  user.Options,
+		Name:              r.Name,
+		Roles:             user.Roles,
+		Password:          string(password),
+		Options:           user.Options,
+		PasswordChangedAt: r.PasswordChangedAt,
 	}
 
 	putUser(as.lg, tx, updatedUser)
@@ -1111,6 +1230,9 @@ func (as *authStore) UserGet(r *pb.AuthUserGetRequest) (*pb.AuthUserGetResponse,
 
 	var resp pb.AuthUserGetResponse
 	resp.Roles = append(resp.Roles, user.Roles...)
+	resp.PasswordChangedAt = user.PasswordChangedAt
+	resp.FailedLogins = user.FailedLogins
+	resp.LockedUntil = user.LockedUntil
 	return &resp, nil
 }
 
@@ -1146,10 +1268,15 @@ func (as *authStore) UserRevokeRole(r *pb.AuthUserRevokeRoleRequest) (*pb.AuthUs
 		return nil, ErrUserNotFound
 	}
 
+	// 移除角色时作废该用户所有的refresh token
 	updatedUser := &authpb.User{
-		Name:     user.Name,
-		Password: user.Password,
-		Options:  user.Options,
+		Name:              user.Name,
+		Password:          user.Password,
+		Options:           user.Options,
+		PasswordChangedAt: user.PasswordChangedAt,
+		FailedLogins:      user.FailedLogins,
+		LastFailedLogin:   user.LastFailedLogin,
+		LockedUntil:       user.LockedUntil,
 	}
 
 	for _, role := range user.Roles {
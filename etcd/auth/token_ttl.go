@@ -0,0 +1,79 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ls-2018/etcd_cn/offical/api/v3/authpb"
+)
+
+// AuthenticateParamTokenTTL is used for a key of context in the parameters of assign(),
+// 值为该用户token的有效期,未设置时使用token提供者的默认值
+type AuthenticateParamTokenTTL struct{}
+
+// TokenTTLOverrides 按用户或角色设置token有效期
+type TokenTTLOverrides struct {
+	Users map[string]time.Duration
+	Roles map[string]time.Duration
+}
+
+// ParseTokenTTLOverrides 解析 "user:alice=1h,role:ci=10m" 格式的配置
+func ParseTokenTTLOverrides(s string) (TokenTTLOverrides, error) {
+	o := TokenTTLOverrides{Users: map[string]time.Duration{}, Roles: map[string]time.Duration{}}
+	if s == "" {
+		return o, nil
+	}
+	for _, item := range strings.Split(s, ",") {
+		kv := strings.SplitN(strings.TrimSpace(item), "=", 2)
+		if len(kv) != 2 {
+			return o, fmt.Errorf("invalid token ttl override %q (expected user:<name>=<ttl> or role:<name>=<ttl>)", item)
+		}
+		ttl, err := time.ParseDuration(kv[1])
+		if err != nil || ttl <= 0 {
+			return o, fmt.Errorf("invalid token ttl %q in %q", kv[1], item)
+		}
+		switch {
+		case strings.HasPrefix(kv[0], "user:") && len(kv[0]) > len("user:"):
+			o.Users[strings.TrimPrefix(kv[0], "user:")] = ttl
+		case strings.HasPrefix(kv[0], "role:") && len(kv[0]) > len("role:"):
+			o.Roles[strings.TrimPrefix(kv[0], "role:")] = ttl
+		default:
+			return o, fmt.Errorf("invalid token ttl override %q (expected user:<name>=<ttl> or role:<name>=<ttl>)", item)
+		}
+	}
+	return o, nil
+}
+
+// WithTokenTTLOverrides 按用户或角色设置token有效期
+func WithTokenTTLOverrides(o TokenTTLOverrides) StoreOption {
+	return func(as *authStore) { as.tokenTTLOverrides = o }
+}
+
+// tokenTTL 用户的token有效期;用户的设置优先,否则取所有角色中最短的,都没有设置时返回0
+func (as *authStore) tokenTTL(user *authpb.User) time.Duration {
+	if ttl, ok := as.tokenTTLOverrides.Users[user.Name]; ok {
+		return ttl
+	}
+	var ttl time.Duration
+	for _, r := range user.Roles {
+		if rt, ok := as.tokenTTLOverrides.Roles[r]; ok && (ttl == 0 || rt < ttl) {
+			ttl = rt
+		}
+	}
+	return ttl
+}
@@ -25,6 +25,7 @@ import (
 	"github.com/ls-2018/etcd_cn/client_sdk/pkg/types"
 	"github.com/ls-2018/etcd_cn/etcd/datadir"
 	"github.com/ls-2018/etcd_cn/pkg/netutil"
+	"github.com/ls-2018/etcd_cn/pkg/notify"
 	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 
 	bolt "go.etcd.io/bbolt"
@@ -56,6 +57,7 @@ type ServerConfig struct {
 
 	TickMs        uint // tick计时器触发间隔
 	ElectionTicks int  // 返回选举权检查对应多少次tick触发次数
+	ManualTicks   bool // 不启动tick计时器,只能通过 EtcdServer.AdvanceTicks 推进,用于测试
 
 	// InitialElectionTickAdvance 是否提前初始化选举时钟启动,以便更快的选举
 	InitialElectionTickAdvance bool
@@ -79,6 +81,28 @@ type ServerConfig struct {
 	AuthToken             string // 认证格式  simple、jwt
 	BcryptCost            uint   // 为散列身份验证密码指定bcrypt算法的成本/强度默认10
 	TokenTTL              uint
+	// AuthSPIFFEUserMapping 客户端证书为X509-SVID时从SPIFFE ID映射用户名的方式: "", "id", "path"
+	AuthSPIFFEUserMapping string
+	// AuthWebhookURL 非空时本地不存在的用户交由该webhook认证
+	AuthWebhookURL           string
+	AuthWebhookCAFile        string
+	AuthWebhookTimeout       time.Duration
+	AuthWebhookCacheTTL      time.Duration
+	AuthWebhookFailurePolicy string
+	// 密码复杂度、有效期以及登录失败锁定策略
+	AuthPasswordMinLength  int
+	AuthPasswordMinClasses int
+	AuthPasswordMaxAge     time.Duration
+	AuthLockoutThreshold   int
+	AuthLockoutDuration    time.Duration
+	// AuthRefreshTokenTTL 认证成功时签发的refresh token有效期,0表示不签发
+	AuthRefreshTokenTTL time.Duration
+	// AuthTokenTTLOverrides 按用户或角色设置token有效期,例如 "user:alice=1h,role:ci=10m"
+	AuthTokenTTLOverrides string
+	// AuthAuditSampleRate 权限检查失败的记录比例,0表示不记录
+	AuthAuditSampleRate float64
+	// AuthAuditMaxEntries 本节点最多保留的权限检查失败记录数
+	AuthAuditMaxEntries int
 
 	InitialCorruptCheck bool // 数据毁坏检测功能,运行之后,在开始服务之前
 	CorruptCheckTime    time.Duration
@@ -98,6 +122,12 @@ type ServerConfig struct {
 	LeaseCheckpointInterval time.Duration
 	// LeaseCheckpointPersist enables persisting remainingTTL to prevent indefinite auto-renewal of long lived leases. Always enabled in v3.6. Should be used to ensure smooth upgrade from v3.5 clusters with this feature enabled.
 	LeaseCheckpointPersist bool
+	// LeaseConsolidatedCheckpointInterval 汇总所有租约剩余时间的检查点间隔,0表示关闭
+	LeaseConsolidatedCheckpointInterval time.Duration
+	// LeaseRevokeRate 每秒最多撤销的过期租约数
+	LeaseRevokeRate int
+	// LeaseTTLJitter 创建租约时TTL最多增加的比例,0表示不加抖动
+	LeaseTTLJitter float64
 
 	EnableGRPCGateway bool // 启用grpc网关,将 http 转换成 grpc / true
 
@@ -113,6 +143,93 @@ type ServerConfig struct {
 
 	DowngradeCheckTime time.Duration
 
+	// MemberUnreachableThreshold 成员持续不可达超过该时长后触发 UNREACHABLE 警报,0表示不检测
+	MemberUnreachableThreshold time.Duration
+	// MemberUnreachableWebhookURL 成员不可达/恢复/被替换时通知的地址
+	MemberUnreachableWebhookURL string
+	// MemberAutoReplace 不可达成员的替换learner追上leader之后,自动移除该成员并提升learner
+	MemberAutoReplace bool
+	// LearnerAutoPromoteAfter learner落后leader不超过 LearnerAutoPromoteMaxLag 条日志持续该时长后,leader自动提升它,0表示不自动提升
+	LearnerAutoPromoteAfter time.Duration
+	// LearnerAutoPromoteMaxLag 自动提升时learner最多落后leader的日志条数
+	LearnerAutoPromoteMaxLag uint64
+	// TopologyLabel 表示故障域的成员标签,单个故障域失效就会丢失quorum时发出 TOPOLOGY 警报,空表示不检测
+	TopologyLabel string
+	// ManualClusterVersionPromotion 所有成员升级后不自动提升集群版本,需要通过 Downgrade PROMOTE 请求提升
+	ManualClusterVersionPromotion bool
+	// RequestDeadlineAllowance 从客户端deadline中预留给网络往返的时间,剩余部分作为请求的处理预算
+	RequestDeadlineAllowance time.Duration
+	// AdmissionControl 成员过载时按服务等级拒绝请求
+	AdmissionControl bool
+	// AdmissionFsyncLatency WAL fsync平均耗时的阈值,0表示不参考该指标
+	AdmissionFsyncLatency time.Duration
+	// AdmissionApplyBacklog 已提交未apply的条目数的阈值,0表示不参考该指标
+	AdmissionApplyBacklog uint64
+	// AdmissionPendingProposals 未完成的提案数的阈值,0表示不参考该指标
+	AdmissionPendingProposals int
+	// CrashReportDir 致命错误时写入崩溃报告的目录,为空时使用 <data-dir>/crash
+	CrashReportDir string
+	// CrashReportWebhookURL 致命错误时把崩溃报告POST到该地址
+	CrashReportWebhookURL string
+	// BackupInterval 内置备份的间隔,0表示不备份
+	BackupInterval time.Duration
+	// BackupDir 备份文件的目录,为空时使用 <data-dir>/backup
+	BackupDir string
+	// BackupRetention 本地保留的备份文件个数,0表示全部保留
+	BackupRetention int
+	// BackupMember 负责备份的成员名称,为空时由leader备份
+	BackupMember string
+	// BackupTargetURL 备份完成后把文件PUT到 <url>/<文件名>,为空表示只保存在本地
+	BackupTargetURL string
+	// NotifySinks 把指定前缀下已提交的变更投递到外部sink,由leader投递
+	NotifySinks []notify.SinkConfig
+	// Replica 集群是上游集群的只读副本,在被提升之前拒绝客户端的写请求
+	Replica bool
+	// CompactionHoldMaxCount 压缩保留的最大个数,0表示不限制
+	CompactionHoldMaxCount int
+	// CompactionHoldMaxTTL 单个压缩保留的最长有效期,0表示不限制
+	CompactionHoldMaxTTL time.Duration
+	// CompactionHoldMaxRevisions 压缩保留最多落后当前修订版本多少,超过后不再阻止自动压缩,0表示不限制
+	CompactionHoldMaxRevisions int64
+	// StagedTxnMaxOps 一个暂存事务最多包含的操作数
+	StagedTxnMaxOps int
+	// StagedTxnMaxBytes 一个暂存事务的操作编码后的最大字节数
+	StagedTxnMaxBytes int64
+	// UserQuotas 每个用户的写入预算,用户名为 UserQuotaDefault 的预算用于没有单独配置的用户
+	UserQuotas []UserQuota
+	// WatchMaxPerConnection 每个gRPC连接最多的活跃watch数,0表示不限制
+	WatchMaxPerConnection int
+	// WatchMaxPerUser 每个用户最多的活跃watch数,0表示不限制
+	WatchMaxPerUser int
+	// WatchLimitOverrides 按用户设置watch数限制,例如 "user:alice=1000,user:ctrl=0",0表示不限制
+	WatchLimitOverrides string
+	// AdmissionPlugins 为key前缀加载的校验插件,例如 "/schemas/=/etc/etcd/schema.so",写请求提议到raft之前交给插件检查
+	AdmissionPlugins string
+	// ExperimentalFailpoints 开启 Maintenance.Failpoint 故障注入接口,只用于测试
+	ExperimentalFailpoints bool
+	// ExperimentalAsyncStorageWrites 由单独的协程按顺序写WAL,raft在写盘的同时继续处理下一个Ready
+	ExperimentalAsyncStorageWrites bool
+
+	// ReadIndexBatchWindow 收到线性读后等待多久再发送ReadIndex,让更多的读合并到一次请求中;0表示不等待
+	ReadIndexBatchWindow time.Duration
+	// ReadIndexAdaptiveBatching 按读请求到达速率决定是否等待 ReadIndexBatchWindow,低负载时不等待
+	ReadIndexAdaptiveBatching bool
+
+	// ReadCacheBytes 在内存中缓存解码后的 KeyValue 的大小上限,用于频繁读取的key;0表示不缓存
+	ReadCacheBytes int64
+	// RestoreWorkers 启动时重建索引、恢复租约的并发数;0表示使用 GOMAXPROCS
+	RestoreWorkers int
+	// PeerTransport 成员之间raft消息流使用的传输,"http" 或 "grpc"
+	PeerTransport string
+	// PeerCompression 按对端peer URL请求压缩接收的消息流,例如 "zstd" 或 "*=none,https://10.0.1.10:2380=gzip"
+	PeerCompression string
+	// PeerBatchInterval 发送MsgApp时最多等待多久合并写出;0表示不等待
+	PeerBatchInterval time.Duration
+	// PeerBatchBytes 合并写出的字节数上限;0表示只按时间
+	PeerBatchBytes int
+	// ClockSkewThreshold 与任一对端的时钟偏差超过该值时触发 CLOCK_SKEW 警报,0表示不发出警报
+	ClockSkewThreshold time.Duration
+
 	// ExperimentalMemoryMlock enables mlocking of etcd owned memory pages.
 	// The setting improves etcd tail latency in environments were:
 	//   - memory pressure might lead to swapping pages to disk
@@ -243,6 +360,22 @@ func (c *ServerConfig) SnapDir() string {
 	return datadir.ToSnapDir(c.DataDir)
 }
 
+// CrashDir default.etcd/crash
+func (c *ServerConfig) CrashDir() string {
+	if c.CrashReportDir != "" {
+		return c.CrashReportDir
+	}
+	return datadir.ToCrashDir(c.DataDir)
+}
+
+// BackupDirPath default.etcd/backup
+func (c *ServerConfig) BackupDirPath() string {
+	if c.BackupDir != "" {
+		return c.BackupDir
+	}
+	return datadir.ToBackupDir(c.DataDir)
+}
+
 func (c *ServerConfig) ShouldDiscover() bool { return c.DiscoveryURL != "" }
 
 // ReqTimeout 返回请求完成的超时时间
@@ -0,0 +1,98 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// UserQuotaDefault 作为用户名时表示没有单独配置的用户使用的预算
+const UserQuotaDefault = "*"
+
+// UserQuota 一个用户的写入预算
+type UserQuota struct {
+	User string `json:"user"`
+	// Bytes 用户累计写入的键和值的字节数上限,0表示不限制
+	Bytes int64 `json:"bytes"`
+	// RateBytes 用户每秒写入的字节数上限,由每个成员分别限制,0表示不限制
+	RateBytes int64 `json:"rate-bytes"`
+}
+
+// ParseUserQuota 解析分号分隔的key=value,例如 user=alice;bytes=1073741824;rate=1048576
+func ParseUserQuota(s string) (UserQuota, error) {
+	var q UserQuota
+	for _, kv := range strings.Split(s, ";") {
+		kv = strings.TrimSpace(kv)
+		if kv == "" {
+			continue
+		}
+		i := strings.Index(kv, "=")
+		if i < 0 {
+			return q, fmt.Errorf("invalid user quota option %q, expected key=value", kv)
+		}
+		k, v := kv[:i], kv[i+1:]
+		switch k {
+		case "user":
+			q.User = v
+		case "bytes", "rate":
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return q, fmt.Errorf("invalid user quota %s %q: %v", k, v, err)
+			}
+			if k == "bytes" {
+				q.Bytes = n
+			} else {
+				q.RateBytes = n
+			}
+		default:
+			return q, fmt.Errorf("unknown user quota option %q", k)
+		}
+	}
+	return q, nil
+}
+
+// ValidateUserQuotas 检查用户名不为空且不重复,预算不为负数
+func ValidateUserQuotas(qs []UserQuota) error {
+	seen := make(map[string]bool)
+	for _, q := range qs {
+		if q.User == "" {
+			return fmt.Errorf("user quota requires a user")
+		}
+		if seen[q.User] {
+			return fmt.Errorf("duplicate user quota for %q", q.User)
+		}
+		seen[q.User] = true
+		if q.Bytes < 0 || q.RateBytes < 0 {
+			return fmt.Errorf("user quota for %q must not be negative", q.User)
+		}
+	}
+	return nil
+}
+
+// UserQuotaFor 返回用户的预算,没有单独配置时使用 UserQuotaDefault 的预算
+func (c *ServerConfig) UserQuotaFor(user string) UserQuota {
+	def := UserQuota{User: user}
+	for _, q := range c.UserQuotas {
+		if q.User == user {
+			return q
+		}
+		if q.User == UserQuotaDefault {
+			def.Bytes, def.RateBytes = q.Bytes, q.RateBytes
+		}
+	}
+	return def
+}
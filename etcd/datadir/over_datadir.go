@@ -21,6 +21,8 @@ const (
 	snapDirSegment     = "snap"
 	walDirSegment      = "wal"
 	backendFileSegment = "bolt.db"
+	crashDirSegment    = "crash"
+	backupDirSegment   = "backup"
 )
 
 func ToBackendFileName(dataDir string) string {
@@ -39,3 +41,13 @@ func ToWalDir(dataDir string) string {
 func ToMemberDir(dataDir string) string {
 	return filepath.Join(dataDir, memberDirSegment) //   default.etcd/member
 }
+
+// ToCrashDir 崩溃报告目录
+func ToCrashDir(dataDir string) string {
+	return filepath.Join(dataDir, crashDirSegment) // default.etcd/crash
+}
+
+// ToBackupDir 内置备份的目录
+func ToBackupDir(dataDir string) string {
+	return filepath.Join(dataDir, backupDirSegment) // default.etcd/backup
+}
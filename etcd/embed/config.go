@@ -15,8 +15,10 @@
 package embed
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"net"
 	"net/http"
 	"net/url"
@@ -31,18 +33,25 @@ import (
 	"github.com/ls-2018/etcd_cn/client_sdk/pkg/tlsutil"
 	"github.com/ls-2018/etcd_cn/client_sdk/pkg/transport"
 	"github.com/ls-2018/etcd_cn/client_sdk/pkg/types"
+	"github.com/ls-2018/etcd_cn/etcd/auth"
 	"github.com/ls-2018/etcd_cn/etcd/config"
 	"github.com/ls-2018/etcd_cn/etcd/etcdserver"
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver/api/discovery"
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver/api/membership"
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver/api/rafthttp"
 	"github.com/ls-2018/etcd_cn/etcd/etcdserver/api/v3compactor"
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver/api/v3replication"
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver/api/v3rpc"
+	"github.com/ls-2018/etcd_cn/etcd/lease"
 	"github.com/ls-2018/etcd_cn/pkg/flags"
 	"github.com/ls-2018/etcd_cn/pkg/netutil"
+	"github.com/ls-2018/etcd_cn/pkg/notify"
 
 	bolt "go.etcd.io/bbolt"
 	"go.uber.org/multierr"
 	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
 	"google.golang.org/grpc"
-	"sigs.k8s.io/yaml"
 )
 
 const (
@@ -61,9 +70,33 @@ const (
 	DefaultGRPCKeepAliveTimeout  = 20 * time.Second
 	DefaultDowngradeCheckTime    = 5 * time.Second
 
+	// DefaultRequestDeadlineAllowance 默认从客户端deadline中预留给网络往返的时间
+	DefaultRequestDeadlineAllowance = 50 * time.Millisecond
+
+	// 准入控制的默认阈值,达到阈值时拒绝批量请求,达到两倍时拒绝普通请求
+	DefaultAdmissionFsyncLatency     = 250 * time.Millisecond
+	DefaultAdmissionApplyBacklog     = 1000
+	DefaultAdmissionPendingProposals = 2000
+
+	// 压缩保留的默认限制
+	DefaultCompactionHoldMaxCount = 100
+	DefaultCompactionHoldMaxTTL   = time.Hour
+
+	// 暂存事务的默认限制
+	DefaultStagedTxnMaxOps   = 10000
+	DefaultStagedTxnMaxBytes = 8 * 1024 * 1024
+
+	// 自动提升时learner最多落后leader的日志条数
+	DefaultLearnerAutoPromoteMaxLag = 1000
+
+	// 与对端的时钟偏差超过该值时触发 CLOCK_SKEW 警报
+	DefaultClockSkewThreshold = time.Second
+
 	DefaultListenPeerURLs   = "http://localhost:2380"
 	DefaultListenClientURLs = "http://localhost:2379"
 
+	DefaultListenDashboardURLs = "http://localhost:2390"
+
 	DefaultLogOutput = "default"
 	JournalLogOutput = "systemd/journal"
 	StdErrLogOutput  = "stderr"
@@ -77,6 +110,10 @@ const (
 	// Compress   = false // compress the rotated log in gzip format
 	DefaultLogRotationConfig = `{"maxsize": 100, "maxage": 0, "maxbackups": 0, "localtime": false, "compress": false}`
 
+	// DefaultLogSamplingInitial 和 DefaultLogSamplingThereafter 与 logutil.DefaultZapLoggerConfig 的采样配置一致
+	DefaultLogSamplingInitial    = 100
+	DefaultLogSamplingThereafter = 100
+
 	// ExperimentalDistributedTracingAddress is the default collector address.
 	ExperimentalDistributedTracingAddress = "localhost:4317"
 	// ExperimentalDistributedTracingServiceName is the default etcd service name.
@@ -94,7 +131,7 @@ const (
 
 var (
 	ErrConflictBootstrapFlags = fmt.Errorf("multiple discovery or bootstrap flags are set. " +
-		"Choose one of \"initial-cluster\", \"discovery\" or \"discovery-srv\"")
+		"Choose one of \"initial-cluster\", \"discovery\", \"discovery-srv\" or \"discovery-provider\"")
 	ErrUnsetAdvertiseClientURLsFlag = fmt.Errorf("--advertise-client-urls is required when --listen-client-urls is set explicitly")
 	ErrLogRotationInvalidLogOutput  = fmt.Errorf("--log-outputs requires a single file path when --log-rotate-config-json is defined")
 
@@ -150,6 +187,9 @@ type Config struct {
 	TickMs     uint `json:"heartbeat-interval"` // 定时器触发间隔  100ms
 	ElectionMs uint `json:"election-timeout"`   // 选举权检查周期   1s
 
+	// ManualTicks 不启动 raft tick 计时器,只能通过 Server.AdvanceTicks 推进,只用于测试.
+	ManualTicks bool `json:"-"`
+
 	// InitialElectionTickAdvance is true, then local member fast-forwards
 	// election ticks to speed up "initial" leader election trigger. This
 	// benefits the case of larger election ticks. For instance, cross
@@ -195,6 +235,8 @@ type Config struct {
 
 	ClientTLSInfo transport.TLSInfo // 与 etcdctl 交互的客户端证书信息
 	ClientAutoTLS bool
+	// ClientCertAllowedCNs 开启客户端证书认证时允许的证书CommonName,为空表示不限制;可以热加载
+	ClientCertAllowedCNs []string `json:"client-cert-allowed-cns"`
 
 	PeerTLSInfo transport.TLSInfo
 	PeerAutoTLS bool // 节点之间使用生成的证书通信;默认false
@@ -215,6 +257,11 @@ type Config struct {
 	InitialClusterToken   string `json:"initial-cluster-token"` // 此配置可使重新创建集群.即使配置和之前一样.也会再次生成新的集群和节点 uuid;否则会导致多个集群之间的冲突.造成未知的错误.
 	StrictReconfigCheck   bool   `json:"strict-reconfig-check"` // 严格配置变更检查
 
+	// DiscoveryProvider 用于引导群集的发现提供者,支持 dns-srv、ec2、gce、kubernetes、file
+	DiscoveryProvider string `json:"discovery-provider"`
+	// DiscoveryParams 发现提供者参数,格式为 "key1=value1;key2=value2"
+	DiscoveryParams string `json:"discovery-params"`
+
 	EnableV2 bool `json:"enable-v2"`
 	// AutoCompactionMode 基于时间保留模式  时间、修订版本
 	AutoCompactionMode string `json:"auto-compaction-mode"`
@@ -231,6 +278,16 @@ type Config struct {
 	GRPCKeepAliveInterval time.Duration `json:"grpc-keepalive-interval"`
 	// GRPCKeepAliveTimeout 关闭非响应连接之前的额外持续等待时间(0表示禁用).20s
 	GRPCKeepAliveTimeout time.Duration `json:"grpc-keepalive-timeout"`
+	// GRPCKeepAlivePermitWithoutStream 为true时允许客户端在没有活跃流时发送keepalive ping;
+	// 为false时这样的ping以及间隔小于 GRPCKeepAliveMinTime 的ping会让服务器发送GOAWAY并关闭连接.
+	GRPCKeepAlivePermitWithoutStream bool `json:"grpc-keepalive-permit-without-stream"`
+	// GRPCMaxConnectionIdle 连接没有活跃流的时间超过该值后服务器发送GOAWAY关闭连接(0表示不关闭).
+	GRPCMaxConnectionIdle time.Duration `json:"grpc-max-connection-idle"`
+	// MaxConcurrentStreams 每个客户端连接上最多同时存在的gRPC流,超出的流由客户端排队等待(0表示不限制).
+	MaxConcurrentStreams uint `json:"max-concurrent-streams"`
+	// MaxConnectionsPerClientIP 每个客户端IP最多同时打开的连接数,超出的连接在accept后立即关闭(0表示不限制).
+	// 不限制unix socket上的连接.
+	MaxConnectionsPerClientIP int `json:"max-connections-per-client-ip"`
 
 	// SocketOpts are socket options passed to listener config.
 	SocketOpts transport.SocketOpts
@@ -261,6 +318,28 @@ type Config struct {
 	BcryptCost uint   `json:"bcrypt-cost"` // 为散列身份验证密码指定bcrypt算法的成本/强度.有效值介于4和31之间.默认值:10
 
 	AuthTokenTTL uint `json:"auth-token-ttl"` // token 有效期
+	// AuthSPIFFEUserMapping 客户端证书为X509-SVID时从SPIFFE ID映射用户名的方式: "id" 完整ID, "path" ID路径;为空时使用CommonName
+	AuthSPIFFEUserMapping string `json:"auth-spiffe-user-mapping"`
+	// AuthWebhookURL 非空时本地不存在的用户交由该webhook认证,webhook返回etcd用户名和角色
+	AuthWebhookURL           string        `json:"auth-webhook-url"`
+	AuthWebhookCAFile        string        `json:"auth-webhook-ca-file"`
+	AuthWebhookTimeout       time.Duration `json:"auth-webhook-timeout"`
+	AuthWebhookCacheTTL      time.Duration `json:"auth-webhook-cache-ttl"`      // 认证成功的结果缓存时间
+	AuthWebhookFailurePolicy string        `json:"auth-webhook-failure-policy"` // webhook不可用时: "deny" 拒绝, "cache" 使用最近一次成功的结果
+	// 密码策略,0表示不限制
+	AuthPasswordMinLength  int           `json:"auth-password-min-length"`
+	AuthPasswordMinClasses int           `json:"auth-password-min-classes"` // 至少包含几类字符: 小写字母、大写字母、数字、其他字符
+	AuthPasswordMaxAge     time.Duration `json:"auth-password-max-age"`     // 密码有效期
+	AuthLockoutThreshold   int           `json:"auth-lockout-threshold"`    // 连续登录失败多少次后锁定账户
+	AuthLockoutDuration    time.Duration `json:"auth-lockout-duration"`     // 锁定时长,也是失败计数的衰减窗口
+	// AuthRefreshTokenTTL 认证成功时签发的refresh token有效期,客户端可以用refresh token换取新的token而不需要保存密码;0表示不签发
+	AuthRefreshTokenTTL time.Duration `json:"auth-refresh-token-ttl"`
+	// AuthTokenTTLOverrides 按用户或角色设置token有效期,例如 "user:alice=1h,role:ci=10m"
+	AuthTokenTTLOverrides string `json:"auth-token-ttl-overrides"`
+	// AuthAuditSampleRate 权限检查失败的记录比例,记录保存在本节点,可以通过 etcdctl auth denials 查看;0表示不记录
+	AuthAuditSampleRate float64 `json:"auth-audit-sample-rate"`
+	// AuthAuditMaxEntries 本节点最多保留的权限检查失败记录数,超过时删除最早的
+	AuthAuditMaxEntries int `json:"auth-audit-max-entries"`
 
 	ExperimentalInitialCorruptCheck bool          `json:"experimental-initial-corrupt-check"` // 数据毁坏检测功能
 	ExperimentalCorruptCheckTime    time.Duration `json:"experimental-corrupt-check-time"`    // 数据毁坏检测功能
@@ -274,23 +353,55 @@ type Config struct {
 	// 需要启用 experimental-enable-lease-checkpoint
 	// Deprecated in v3.6.
 	// TODO: Delete in v3.7
-	ExperimentalEnableLeaseCheckpointPersist bool          `json:"experimental-enable-lease-checkpoint-persist"`
-	ExperimentalCompactionBatchLimit         int           `json:"experimental-compaction-batch-limit"`
-	ExperimentalWatchProgressNotifyInterval  time.Duration `json:"experimental-watch-progress-notify-interval"`
+	ExperimentalEnableLeaseCheckpointPersist bool `json:"experimental-enable-lease-checkpoint-persist"`
+	// ExperimentalLeaseCheckpointInterval 单个租约检查点的时间间隔,只对剩余时间大于该值的租约调度
+	ExperimentalLeaseCheckpointInterval time.Duration `json:"experimental-lease-checkpoint-interval"`
+	// ExperimentalLeaseConsolidatedCheckpointInterval 汇总所有租约剩余时间的检查点间隔,0表示关闭
+	ExperimentalLeaseConsolidatedCheckpointInterval time.Duration `json:"experimental-lease-consolidated-checkpoint-interval"`
+	// ExperimentalLeaseRevokeRate 每秒最多撤销的过期租约数,按最早过期的顺序撤销
+	ExperimentalLeaseRevokeRate int `json:"experimental-lease-revoke-rate"`
+	// ExperimentalLeaseTTLJitter 创建租约时TTL最多增加的比例(0-1),让相同TTL的租约分散到期;0表示不加抖动
+	ExperimentalLeaseTTLJitter              float64       `json:"experimental-lease-ttl-jitter"`
+	ExperimentalCompactionBatchLimit        int           `json:"experimental-compaction-batch-limit"`
+	ExperimentalWatchProgressNotifyInterval time.Duration `json:"experimental-watch-progress-notify-interval"`
 	// ExperimentalWarningApplyDuration 是时间长度.如果应用请求的时间超过这个值.就会产生一个警告.
 	ExperimentalWarningApplyDuration time.Duration `json:"experimental-warning-apply-duration"`
 	// ExperimentalBootstrapDefragThresholdMegabytes is the minimum number of megabytes needed to be freed for etcd etcd to
 	// consider running defrag during bootstrap. Needs to be set to non-zero value to take effect.
 	ExperimentalBootstrapDefragThresholdMegabytes uint `json:"experimental-bootstrap-defrag-threshold-megabytes"`
+	// ExperimentalApplyInterceptor 拦截每个v3 raft请求的apply,所有成员都会执行,必须是确定性的.
+	ExperimentalApplyInterceptor etcdserver.ApplyInterceptor `json:"-"`
+	// ExperimentalApplyObservers 每个v3 raft请求apply之后按顺序调用,能看到最终结果,所有成员都会执行.
+	ExperimentalApplyObservers []etcdserver.ApplyObserver `json:"-"`
+	// ExperimentalGRPCInterceptors 注入客户端和维护端口gRPC服务的拦截器,与etcd自己的拦截器和鉴权的顺序见 v3rpc.Interceptors.
+	ExperimentalGRPCInterceptors v3rpc.Interceptors `json:"-"`
+
+	// EventHandlers 在server启动前注册的生命周期事件handler,不会错过启动时的选举事件.
+	// 启动后可以用 Etcd.RegisterEventHandler 注册.
+	EventHandlers []func(etcdserver.Event) `json:"-"`
 
 	// ForceNewCluster starts a new cluster even if previously started; unsafe.
 	ForceNewCluster bool `json:"force-new-cluster"`
 
+	// ConfigFileReloadInterval 检查配置文件变化的间隔,0表示不热加载;只在使用配置文件启动时生效
+	ConfigFileReloadInterval time.Duration `json:"config-file-reload-interval"`
+
 	EnablePprof           bool   `json:"enable-pprof"`
 	Metrics               string `json:"metrics"` // basic  ;extensive
 	ListenMetricsUrls     []url.URL
 	ListenMetricsUrlsJSON string `json:"listen-metrics-urls"`
 
+	// EnableDashboard 在 ListenDashboardUrls 上提供只读的 web 管理页面.
+	EnableDashboard         bool `json:"enable-dashboard"`
+	ListenDashboardUrls     []url.URL
+	ListenDashboardUrlsJSON string `json:"listen-dashboard-urls"`
+
+	// ListenMaintenanceUrls 只提供 Maintenance 服务(快照、碎片整理、hashkv等)的独立监听地址,为空时不开启.
+	ListenMaintenanceUrls     []url.URL
+	ListenMaintenanceUrlsJSON string `json:"listen-maintenance-urls"`
+	// MaxConcurrentMaintenanceRequests 独立维护监听器上同时处理的请求数上限,超过时直接拒绝;0表示不限制.
+	MaxConcurrentMaintenanceRequests int `json:"max-concurrent-maintenance-requests"`
+
 	// ExperimentalEnableDistributedTracing 表示是否启用了使用OpenTelemetry的实验性追踪.
 	ExperimentalEnableDistributedTracing bool `json:"experimental-enable-distributed-tracing"`
 	// ExperimentalDistributedTracingAddress is the address of the OpenTelemetry Collector.
@@ -320,6 +431,10 @@ type Config struct {
 	EnableLogRotation bool `json:"enable-log-rotation"`
 	// LogRotationConfigJSON is a passthrough allowing a log rotation JSON config to be passed directly.
 	LogRotationConfigJSON string `json:"log-rotation-config-json"`
+	// LogSamplingInitial 每秒内同一条日志(同等级同消息)前多少条全部输出,0 表示关闭采样
+	LogSamplingInitial int `json:"log-sampling-initial"`
+	// LogSamplingThereafter 超过 LogSamplingInitial 之后每多少条输出一条
+	LogSamplingThereafter int `json:"log-sampling-thereafter"`
 	// ZapLoggerBuilder 用于给自己构造一个zap logger
 	ZapLoggerBuilder func(*Config) error
 
@@ -328,6 +443,7 @@ type Config struct {
 	// Do not set logger directly.
 	loggerMu *sync.RWMutex
 	logger   *zap.Logger
+	logLevel *zap.AtomicLevel // 由 setupLogging 构建logger时设置,用于热加载日志等级
 	// EnableGRPCGateway 启用grpc网关,将 http 转换成 grpc / true
 	EnableGRPCGateway bool `json:"enable-grpc-gateway"`
 
@@ -336,6 +452,105 @@ type Config struct {
 	// 两次降级状态检查之间的时间间隔.
 	ExperimentalDowngradeCheckTime time.Duration `json:"experimental-downgrade-check-time"`
 
+	// ExperimentalMemberUnreachableThreshold 成员持续不可达超过该时长后触发 UNREACHABLE 警报,0表示不检测.
+	ExperimentalMemberUnreachableThreshold time.Duration `json:"experimental-member-unreachable-threshold"`
+	// ExperimentalMemberUnreachableWebhookURL 成员不可达、恢复或被替换时,leader会向该地址POST一个JSON事件.
+	ExperimentalMemberUnreachableWebhookURL string `json:"experimental-member-unreachable-webhook-url"`
+	// ExperimentalMemberAutoReplace 当带有 replaces=<成员名称或ID> 标签的learner追上leader后,自动移除不可达成员并提升该learner.
+	ExperimentalMemberAutoReplace bool `json:"experimental-member-auto-replace"`
+	// ExperimentalLearnerAutoPromoteAfter learner落后leader不超过 ExperimentalLearnerAutoPromoteMaxLag 条日志
+	// 并且处于复制状态持续该时长后,leader自动提升它为投票成员;0表示不自动提升.
+	ExperimentalLearnerAutoPromoteAfter time.Duration `json:"experimental-learner-auto-promote-after"`
+	// ExperimentalLearnerAutoPromoteMaxLag 自动提升时learner最多落后leader的日志条数.
+	ExperimentalLearnerAutoPromoteMaxLag uint64 `json:"experimental-learner-auto-promote-max-lag"`
+	// ExperimentalTopologyLabel 表示故障域(如可用区、机架)的成员标签;单个故障域失效就会丢失quorum时发出 TOPOLOGY 警报,空表示不检测.
+	ExperimentalTopologyLabel string `json:"experimental-topology-label"`
+	// ExperimentalManualClusterVersionPromotion 所有成员升级后不自动提升集群版本,需要通过 etcdctl cluster upgrade --promote 提升.
+	ExperimentalManualClusterVersionPromotion bool `json:"experimental-manual-cluster-version-promotion"`
+	// ExperimentalRequestDeadlineAllowance 从客户端deadline中预留给网络往返的时间;写请求等待raft的时间超过剩余预算时提前失败,
+	// 并在错误中给出排队和等待apply的耗时.
+	ExperimentalRequestDeadlineAllowance time.Duration `json:"experimental-request-deadline-allowance"`
+	// ExperimentalAdmissionControl 根据WAL fsync耗时、apply积压和未完成的提案数判断是否过载,过载时先拒绝批量请求,
+	// 再拒绝普通请求,返回 ErrTooManyRequests 并在 retry-after trailer 中给出建议的重试间隔.
+	ExperimentalAdmissionControl          bool          `json:"experimental-admission-control"`
+	ExperimentalAdmissionFsyncLatency     time.Duration `json:"experimental-admission-fsync-latency"`
+	ExperimentalAdmissionApplyBacklog     uint64        `json:"experimental-admission-apply-backlog"`
+	ExperimentalAdmissionPendingProposals int           `json:"experimental-admission-pending-proposals"`
+	// ExperimentalCrashReportDir 致命错误时写入崩溃报告(goroutine、最近apply的日志、raft状态和配置)的目录,为空时使用 <data-dir>/crash.
+	ExperimentalCrashReportDir string `json:"experimental-crash-report-dir"`
+	// ExperimentalCrashReportWebhookURL 致命错误时把崩溃报告以JSON格式POST到该地址.
+	ExperimentalCrashReportWebhookURL string `json:"experimental-crash-report-webhook-url"`
+
+	// BackupInterval 内置备份的间隔,0表示不备份;由leader或 BackupMember 指定的成员从本地后端生成快照.
+	BackupInterval time.Duration `json:"backup-interval"`
+	// BackupDir 备份文件的目录,为空时使用 <data-dir>/backup.
+	BackupDir string `json:"backup-dir"`
+	// BackupRetention 本地保留的备份文件个数,0表示全部保留.
+	BackupRetention int `json:"backup-retention"`
+	// BackupMember 负责备份的成员名称,为空时由leader备份.
+	BackupMember string `json:"backup-member"`
+	// BackupTargetURL 备份校验通过后把文件PUT到 <url>/<文件名>,可以是对象存储的桶地址.
+	BackupTargetURL string `json:"backup-target-url"`
+
+	// ExperimentalNotifySinks 把指定前缀下已提交的变更至少一次地投递到外部sink(webhook、NATS等),
+	// 由leader投递,每个sink已投递到的修订版本通过raft持久化.
+	ExperimentalNotifySinks []notify.SinkConfig `json:"experimental-notify-sinks"`
+	// ExperimentalReplications 由leader把指定前缀下已提交的变更异步复制到远端集群,
+	// 复制进度和数据一起写入远端集群,重启或leader变更后从进度继续.
+	ExperimentalReplications []v3replication.Config `json:"experimental-replications"`
+	// ExperimentalReplicaOf 不为空时集群作为上游集群的只读副本启动:leader持续把上游的变更写入本集群,
+	// 客户端的写请求被拒绝,直到通过 PromoteReplica 提升.
+	ExperimentalReplicaOf *v3replication.Config `json:"experimental-replica-of"`
+
+	// ExperimentalCompactionHoldMaxCount 压缩保留的最大个数,0表示不限制.
+	ExperimentalCompactionHoldMaxCount int `json:"experimental-compaction-hold-max-count"`
+	// ExperimentalCompactionHoldMaxTTL 单个压缩保留的最长有效期,0表示不限制.
+	ExperimentalCompactionHoldMaxTTL time.Duration `json:"experimental-compaction-hold-max-ttl"`
+	// ExperimentalCompactionHoldMaxRevisions 压缩保留最多可以落后当前修订版本多少,超过后不再阻止自动压缩;0表示不限制.
+	ExperimentalCompactionHoldMaxRevisions int64 `json:"experimental-compaction-hold-max-revisions"`
+	// ExperimentalStagedTxnMaxOps 一个暂存事务最多包含的操作数.
+	ExperimentalStagedTxnMaxOps int `json:"experimental-staged-txn-max-ops"`
+	// ExperimentalStagedTxnMaxBytes 一个暂存事务的操作编码后的最大字节数,提交时这些操作在一个raft日志中应用.
+	ExperimentalStagedTxnMaxBytes int64 `json:"experimental-staged-txn-max-bytes"`
+	// ExperimentalUserQuotas 每个用户的写入预算,超出时写请求返回 ErrUserQuotaExceeded 或 ErrUserRateLimited;
+	// 用户名为 "*" 的预算用于没有单独配置的用户.只统计开启鉴权后的写入.
+	ExperimentalUserQuotas []config.UserQuota `json:"experimental-user-quotas"`
+	// ExperimentalWatchMaxPerConnection 每个gRPC连接最多的活跃watch数,超出时创建watch返回 ErrWatchLimitExceeded;0表示不限制.
+	ExperimentalWatchMaxPerConnection int `json:"experimental-watch-max-per-connection"`
+	// ExperimentalWatchMaxPerUser 每个用户在本成员上最多的活跃watch数,0表示不限制.
+	ExperimentalWatchMaxPerUser int `json:"experimental-watch-max-per-user"`
+	// ExperimentalWatchLimitOverrides 按用户设置watch数限制,例如 "user:alice=1000,user:ctrl=0",0表示不限制.
+	ExperimentalWatchLimitOverrides string `json:"experimental-watch-limit-overrides"`
+	// ExperimentalAdmissionPlugins 为key前缀加载的Go插件,例如 "/schemas/=/etc/etcd/schema.so",
+	// Put/DeleteRange/Txn提议到raft之前交给插件校验,插件返回错误时拒绝请求.
+	ExperimentalAdmissionPlugins string `json:"experimental-admission-plugins"`
+	// ExperimentalFailpoints 开启 Maintenance.Failpoint 接口,root用户可以注入延迟落盘、丢弃发往某个成员的消息、
+	// 暂停apply、后端提交失败等故障,故障到期后自动解除.只用于功能测试和混沌测试.
+	ExperimentalFailpoints bool `json:"experimental-failpoints"`
+	// ExperimentalAsyncStorageWrites 由单独的协程按顺序写WAL并确认给raft,raft不必等待落盘就可以处理下一个Ready,
+	// 写盘与收发消息、追加日志流水线化,在慢盘上降低提交延迟.
+	ExperimentalAsyncStorageWrites bool `json:"experimental-async-storage-writes"`
+	// ExperimentalReadIndexBatchWindow 收到线性读后等待多久再发送ReadIndex,合并更多的读;0表示不等待.
+	ExperimentalReadIndexBatchWindow time.Duration `json:"experimental-read-index-batch-window"`
+	// ExperimentalReadIndexAdaptiveBatching 按读请求到达速率决定是否等待 ExperimentalReadIndexBatchWindow.
+	ExperimentalReadIndexAdaptiveBatching bool `json:"experimental-read-index-adaptive-batching"`
+	// ExperimentalReadCacheBytes 在内存中按LRU缓存解码后的键值对,减少热点key读取时的bolt查找和反序列化;0表示不缓存.
+	ExperimentalReadCacheBytes int64 `json:"experimental-read-cache-bytes"`
+	// ExperimentalRestoreWorkers 启动或应用快照时并发重建索引、恢复租约的协程数;0表示使用 GOMAXPROCS.
+	ExperimentalRestoreWorkers int `json:"experimental-restore-workers"`
+	// ExperimentalPeerTransport 成员之间raft消息流使用的传输:"http" 每类消息一个HTTP/1长连接;
+	// "grpc" 在peer端口的gRPC服务上建立流,两类消息复用一个HTTP/2连接并各自流控.对端不支持gRPC时回退到HTTP,可以滚动切换.
+	ExperimentalPeerTransport string `json:"experimental-peer-transport"`
+	// ExperimentalPeerCompression 请求对端压缩发给本成员的消息流,"gzip"、"snappy" 或 "zstd" 作用于所有成员,
+	// 也可以按peer URL配置,例如 "*=none,https://10.0.1.10:2380=zstd".对端不支持时按不压缩接收.
+	ExperimentalPeerCompression string `json:"experimental-peer-compression"`
+	// ExperimentalPeerBatchInterval HTTP消息流发送MsgApp时最多等待多久合并写出,跨地域链路上配合压缩减少带宽;0表示不等待.
+	ExperimentalPeerBatchInterval time.Duration `json:"experimental-peer-batch-interval"`
+	// ExperimentalPeerBatchBytes 合并的字节数达到这个值时立即写出;0表示只按 ExperimentalPeerBatchInterval.
+	ExperimentalPeerBatchBytes int `json:"experimental-peer-batch-bytes"`
+	// ExperimentalClockSkewThreshold 通过peer链路测得本成员与任一对端的时钟偏差超过该值时触发 CLOCK_SKEW 警报,0表示不发出警报.
+	ExperimentalClockSkewThreshold time.Duration `json:"experimental-clock-skew-threshold"`
+
 	// ExperimentalMemoryMlock 启用对etcd拥有的内存页的锁定. 该设置改善了以下环境中的etcd尾部延迟.
 	//   - 内存压力可能会导致将页面交换到磁盘上
 	//   - 磁盘延迟可能是不稳定的
@@ -384,6 +599,7 @@ func NewConfig() *Config {
 	lpurl, _ := url.Parse(DefaultListenPeerURLs)           // "http://localhost:2380"
 	apurl, _ := url.Parse(DefaultInitialAdvertisePeerURLs) // "http://localhost:2380"
 	lcurl, _ := url.Parse(DefaultListenClientURLs)         // "http://localhost:2379"
+	ldurl, _ := url.Parse(DefaultListenDashboardURLs)      // "http://localhost:2390"
 	acurl, _ := url.Parse(DefaultAdvertiseClientURLs)      // "http://localhost:2379"
 	cfg := &Config{
 		MaxSnapFiles: DefaultMaxSnapshots, // 最大快照数
@@ -413,6 +629,8 @@ func NewConfig() *Config {
 		APUrls: []url.URL{*apurl}, // "http://localhost:2379"
 		ACUrls: []url.URL{*acurl}, // "http://localhost:2379"
 
+		ListenDashboardUrls: []url.URL{*ldurl}, // "http://localhost:2390"
+
 		// 设置new为初始静态或DNS引导期间出现的所有成员.如果将此选项设置为existing.则etcd将尝试加入现有群集.
 		ClusterState:        ClusterStateFlagNew, // 状态标志、默认new
 		InitialClusterToken: "etcd-cluster",
@@ -426,6 +644,16 @@ func NewConfig() *Config {
 		BcryptCost:   uint(bcrypt.DefaultCost), // 为散列身份验证密码指定bcrypt算法的成本/强度
 		AuthTokenTTL: 300,                      // token 有效期
 
+		AuthWebhookTimeout:       5 * time.Second,
+		AuthWebhookCacheTTL:      time.Minute,
+		AuthWebhookFailurePolicy: auth.WebhookFailurePolicyDeny,
+		AuthLockoutDuration:      5 * time.Minute,
+		AuthAuditMaxEntries:      auth.DefaultDenialAuditMaxEntries,
+
+		ExperimentalLeaseCheckpointInterval:             lease.DefaultLeaseCheckpointInterval,
+		ExperimentalLeaseConsolidatedCheckpointInterval: lease.DefaultConsolidatedCheckpointInterval,
+		ExperimentalLeaseRevokeRate:                     lease.DefaultLeaseRevokeRate,
+
 		PreVote: true, // Raft会运行一个额外的选举阶段.以检查它是否会获得足够的票数来赢得选举.从而最大限度地减少干扰.
 
 		loggerMu:              new(sync.RWMutex),
@@ -435,11 +663,25 @@ func NewConfig() *Config {
 		LogLevel:              logutil.DefaultLogLevel,    // info
 		EnableLogRotation:     false,                      // 默认不允许日志旋转
 		LogRotationConfigJSON: DefaultLogRotationConfig,   // 是用于日志轮换的默认配置. 默认情况下,日志轮换是禁用的.
-		EnableGRPCGateway:     true,                       // 将http->grpc
+		LogSamplingInitial:    DefaultLogSamplingInitial,
+		LogSamplingThereafter: DefaultLogSamplingThereafter,
+		EnableGRPCGateway:     true, // 将http->grpc
 		// 实验性
 		ExperimentalDowngradeCheckTime:           DefaultDowngradeCheckTime, // 两次降级状态检查之间的时间间隔.
 		ExperimentalMemoryMlock:                  false,                     // 内存页锁定
 		ExperimentalTxnModeWriteWithSharedBuffer: true,                      // 启用写事务在其只读检查操作中使用共享缓冲区.
+		ExperimentalTopologyLabel:                membership.LabelZone,
+		ExperimentalRequestDeadlineAllowance:     DefaultRequestDeadlineAllowance,
+		ExperimentalAdmissionFsyncLatency:        DefaultAdmissionFsyncLatency,
+		ExperimentalAdmissionApplyBacklog:        DefaultAdmissionApplyBacklog,
+		ExperimentalAdmissionPendingProposals:    DefaultAdmissionPendingProposals,
+		ExperimentalCompactionHoldMaxCount:       DefaultCompactionHoldMaxCount,
+		ExperimentalCompactionHoldMaxTTL:         DefaultCompactionHoldMaxTTL,
+		ExperimentalStagedTxnMaxOps:              DefaultStagedTxnMaxOps,
+		ExperimentalPeerTransport:                rafthttp.PeerTransportHTTP,
+		ExperimentalStagedTxnMaxBytes:            DefaultStagedTxnMaxBytes,
+		ExperimentalLearnerAutoPromoteMaxLag:     DefaultLearnerAutoPromoteMaxLag,
+		ExperimentalClockSkewThreshold:           DefaultClockSkewThreshold,
 
 		V2Deprecation: config.V2_DEPR_DEFAULT, // not-yet
 	}
@@ -447,26 +689,45 @@ func NewConfig() *Config {
 	return cfg
 }
 
-// ConfigFromFile OK
+// ConfigFromFile OK 未知的配置项会被拒绝
 func ConfigFromFile(path string) (*Config, error) {
+	return ConfigFromFileWith(path, nil)
+}
+
+// ConfigFromFileWith is like ConfigFromFile, but also accepts the keys of
+// extra and decodes them into extra, for callers that keep their own options
+// in the same file. extra must be a pointer to a struct or nil.
+func ConfigFromFileWith(path string, extra interface{}) (*Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := ConfigFromYAML(b, extra)
+	if err != nil {
+		return nil, fmt.Errorf("解析配置文件 %q 失败: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// ConfigFromYAML parses and validates the content of a configuration file
+// the same way as ConfigFromFileWith.
+func ConfigFromYAML(b []byte, extra interface{}) (*Config, error) {
 	cfg := &configYAML{Config: *NewConfig()}
-	if err := cfg.configFromFile(path); err != nil { // ✅
+	if err := cfg.configFromYAML(b, extra); err != nil { // ✅
 		return nil, err
 	}
 	return &cfg.Config, nil
 }
 
 // OK
-func (cfg *configYAML) configFromFile(path string) error {
-	b, err := ioutil.ReadFile(path)
-	if err != nil {
-		return err
-	}
-
+func (cfg *configYAML) configFromYAML(b []byte, extra interface{}) error {
 	defaultInitialCluster := cfg.InitialCluster
 
-	err = yaml.Unmarshal(b, cfg)
-	if err != nil {
+	outs := []interface{}{cfg}
+	if extra != nil {
+		outs = append(outs, extra)
+	}
+	if err := unmarshalConfigYAML(b, outs...); err != nil {
 		return err
 	}
 
@@ -515,6 +776,24 @@ func (cfg *configYAML) configFromFile(path string) error {
 		cfg.ListenMetricsUrls = []url.URL(u)
 	}
 
+	if cfg.ListenDashboardUrlsJSON != "" {
+		u, err := types.NewURLs(strings.Split(cfg.ListenDashboardUrlsJSON, ","))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "设置时出现意外错误 listen-dashboard-urls: %v\n", err)
+			os.Exit(1)
+		}
+		cfg.ListenDashboardUrls = []url.URL(u)
+	}
+
+	if cfg.ListenMaintenanceUrlsJSON != "" {
+		u, err := types.NewURLs(strings.Split(cfg.ListenMaintenanceUrlsJSON, ","))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "设置时出现意外错误 listen-maintenance-urls: %v\n", err)
+			os.Exit(1)
+		}
+		cfg.ListenMaintenanceUrls = []url.URL(u)
+	}
+
 	if cfg.CORSJSON != "" {
 		uv := flags.NewUniqueURLsWithExceptions(cfg.CORSJSON, "*")
 		cfg.CORS = uv.Values
@@ -526,7 +805,7 @@ func (cfg *configYAML) configFromFile(path string) error {
 	}
 
 	// 如果设置了discovery flag则清除由InitialClusterFromName设置的默认初始集群
-	if (cfg.Durl != "" || cfg.DNSCluster != "") && cfg.InitialCluster == defaultInitialCluster {
+	if (cfg.Durl != "" || cfg.DNSCluster != "" || cfg.DiscoveryProvider != "") && cfg.InitialCluster == defaultInitialCluster {
 		cfg.InitialCluster = ""
 	}
 	if cfg.ClusterState == "" {
@@ -584,6 +863,20 @@ func (cfg *Config) Validate() error {
 	if err := checkBindURLs(cfg.ListenMetricsUrls); err != nil {
 		return err
 	}
+	if cfg.EnableDashboard {
+		if len(cfg.ListenDashboardUrls) == 0 {
+			return fmt.Errorf("--enable-dashboard 需要设置 --listen-dashboard-urls")
+		}
+		if err := checkBindURLs(cfg.ListenDashboardUrls); err != nil {
+			return err
+		}
+	}
+	if err := checkBindURLs(cfg.ListenMaintenanceUrls); err != nil {
+		return err
+	}
+	if cfg.MaxConcurrentMaintenanceRequests < 0 {
+		return fmt.Errorf("--max-concurrent-maintenance-requests 不能为负数, 得到 %d", cfg.MaxConcurrentMaintenanceRequests)
+	}
 	if err := checkHostURLs(cfg.APUrls); err != nil {
 		addrs := cfg.getAPURLs()
 		return fmt.Errorf(`--initial-advertise-peer-urls %q 必须是 "host:port" (%v)`, strings.Join(addrs, ","), err)
@@ -594,12 +887,133 @@ func (cfg *Config) Validate() error {
 	}
 	// 检查是否有冲突的标志通过.
 	nSet := 0
-	for _, v := range []bool{cfg.Durl != "", cfg.InitialCluster != "", cfg.DNSCluster != ""} {
+	for _, v := range []bool{cfg.Durl != "", cfg.InitialCluster != "", cfg.DNSCluster != "", cfg.DiscoveryProvider != ""} {
 		if v {
 			nSet++
 		}
 	}
 
+	if cfg.DiscoveryProvider != "" {
+		if _, err := discovery.ParseParams(cfg.DiscoveryParams); err != nil {
+			return err
+		}
+	}
+
+	if err := auth.ValidateSPIFFEUserMapping(cfg.AuthSPIFFEUserMapping); err != nil {
+		return err
+	}
+	if err := auth.ValidateWebhookFailurePolicy(cfg.AuthWebhookFailurePolicy); err != nil {
+		return err
+	}
+	if cfg.BcryptCost < uint(bcrypt.MinCost) || cfg.BcryptCost > uint(bcrypt.MaxCost) {
+		return fmt.Errorf("--bcrypt-cost 有效值介于 %d 和 %d 之间, 得到 %d", bcrypt.MinCost, bcrypt.MaxCost, cfg.BcryptCost)
+	}
+	pp := auth.PasswordPolicy{
+		MinLength:        cfg.AuthPasswordMinLength,
+		MinClasses:       cfg.AuthPasswordMinClasses,
+		MaxAge:           cfg.AuthPasswordMaxAge,
+		LockoutThreshold: cfg.AuthLockoutThreshold,
+		LockoutDuration:  cfg.AuthLockoutDuration,
+	}
+	if err := pp.Validate(); err != nil {
+		return err
+	}
+	if cfg.BackupInterval < 0 {
+		return fmt.Errorf("--backup-interval 不能为负数, 得到 %v", cfg.BackupInterval)
+	}
+	if cfg.BackupRetention < 0 {
+		return fmt.Errorf("--backup-retention 不能为负数, 得到 %d", cfg.BackupRetention)
+	}
+	if err := notify.ValidateSinks(cfg.ExperimentalNotifySinks); err != nil {
+		return err
+	}
+	if err := v3replication.ValidateConfigs(cfg.ExperimentalReplications); err != nil {
+		return err
+	}
+	if cfg.ExperimentalReplicaOf != nil {
+		if err := v3replication.ValidateReplica(*cfg.ExperimentalReplicaOf); err != nil {
+			return err
+		}
+	}
+	if cfg.ExperimentalCompactionHoldMaxCount < 0 || cfg.ExperimentalCompactionHoldMaxTTL < 0 || cfg.ExperimentalCompactionHoldMaxRevisions < 0 {
+		return fmt.Errorf("--experimental-compaction-hold-max-* 不能为负数")
+	}
+	if cfg.ExperimentalStagedTxnMaxOps <= 0 || cfg.ExperimentalStagedTxnMaxBytes <= 0 {
+		return fmt.Errorf("--experimental-staged-txn-max-* 必须大于0")
+	}
+	if cfg.ExperimentalLearnerAutoPromoteAfter < 0 {
+		return fmt.Errorf("--experimental-learner-auto-promote-after 不能为负数")
+	}
+	if err := config.ValidateUserQuotas(cfg.ExperimentalUserQuotas); err != nil {
+		return fmt.Errorf("--experimental-user-quotas: %v", err)
+	}
+	if cfg.ExperimentalWatchMaxPerConnection < 0 || cfg.ExperimentalWatchMaxPerUser < 0 {
+		return fmt.Errorf("--experimental-watch-max-* 不能为负数")
+	}
+	if _, err := etcdserver.ParseWatchLimitOverrides(cfg.ExperimentalWatchLimitOverrides); err != nil {
+		return err
+	}
+	if _, err := etcdserver.ParseAdmissionPlugins(cfg.ExperimentalAdmissionPlugins); err != nil {
+		return fmt.Errorf("--experimental-admission-plugins: %v", err)
+	}
+	if cfg.ExperimentalReadIndexBatchWindow < 0 {
+		return fmt.Errorf("--experimental-read-index-batch-window 不能为负数, 得到 %v", cfg.ExperimentalReadIndexBatchWindow)
+	}
+	if cfg.ExperimentalReadIndexAdaptiveBatching && cfg.ExperimentalReadIndexBatchWindow == 0 {
+		return fmt.Errorf("--experimental-read-index-adaptive-batching 需要设置 --experimental-read-index-batch-window")
+	}
+	if cfg.ExperimentalReadCacheBytes < 0 {
+		return fmt.Errorf("--experimental-read-cache-bytes 不能为负数, 得到 %d", cfg.ExperimentalReadCacheBytes)
+	}
+	if cfg.ExperimentalRestoreWorkers < 0 {
+		return fmt.Errorf("--experimental-restore-workers 不能为负数, 得到 %d", cfg.ExperimentalRestoreWorkers)
+	}
+	if cfg.ExperimentalPeerTransport != rafthttp.PeerTransportHTTP && cfg.ExperimentalPeerTransport != rafthttp.PeerTransportGRPC {
+		return fmt.Errorf("--experimental-peer-transport 只能是 %q 或 %q, 得到 %q", rafthttp.PeerTransportHTTP, rafthttp.PeerTransportGRPC, cfg.ExperimentalPeerTransport)
+	}
+	if _, err := rafthttp.ParsePeerCompression(cfg.ExperimentalPeerCompression); err != nil {
+		return fmt.Errorf("--experimental-peer-compression: %v", err)
+	}
+	if cfg.ExperimentalPeerBatchInterval < 0 || cfg.ExperimentalPeerBatchBytes < 0 {
+		return fmt.Errorf("--experimental-peer-batch-* 不能为负数")
+	}
+	if cfg.ExperimentalPeerBatchInterval >= time.Duration(cfg.TickMs)*time.Millisecond {
+		return fmt.Errorf("--experimental-peer-batch-interval(%v) 必须小于心跳间隔(%v)", cfg.ExperimentalPeerBatchInterval, time.Duration(cfg.TickMs)*time.Millisecond)
+	}
+	if cfg.ExperimentalClockSkewThreshold < 0 {
+		return fmt.Errorf("--experimental-clock-skew-threshold 不能为负数, 得到 %v", cfg.ExperimentalClockSkewThreshold)
+	}
+	if cfg.GRPCMaxConnectionIdle < 0 {
+		return fmt.Errorf("--grpc-max-connection-idle 不能为负数, 得到 %v", cfg.GRPCMaxConnectionIdle)
+	}
+	if cfg.MaxConcurrentStreams > math.MaxUint32 {
+		return fmt.Errorf("--max-concurrent-streams 不能大于 %d, 得到 %d", uint32(math.MaxUint32), cfg.MaxConcurrentStreams)
+	}
+	if cfg.MaxConnectionsPerClientIP < 0 {
+		return fmt.Errorf("--max-connections-per-client-ip 不能为负数, 得到 %d", cfg.MaxConnectionsPerClientIP)
+	}
+	if cfg.AuthRefreshTokenTTL < 0 {
+		return fmt.Errorf("--auth-refresh-token-ttl 不能为负数, 得到 %v", cfg.AuthRefreshTokenTTL)
+	}
+	if _, err := auth.ParseTokenTTLOverrides(cfg.AuthTokenTTLOverrides); err != nil {
+		return err
+	}
+	if err := (auth.DenialAudit{SampleRate: cfg.AuthAuditSampleRate, MaxEntries: cfg.AuthAuditMaxEntries}).Validate(); err != nil {
+		return err
+	}
+	if len(cfg.ClientCertAllowedCNs) > 0 {
+		ti := cfg.ClientTLSInfo
+		if ti.AllowedCN != "" || ti.AllowedHostname != "" || len(ti.AllowedSPIFFEIDs) > 0 {
+			return fmt.Errorf("--client-cert-allowed-cns 不能与 --client-cert-allowed-hostname、--client-cert-allowed-spiffe-id 同时指定")
+		}
+	}
+	if err := transport.ValidateOCSPCheck(cfg.ClientTLSInfo.OCSPCheck); err != nil {
+		return fmt.Errorf("--client-ocsp-check: %v", err)
+	}
+	if err := transport.ValidateOCSPCheck(cfg.PeerTLSInfo.OCSPCheck); err != nil {
+		return fmt.Errorf("--peer-ocsp-check: %v", err)
+	}
+
 	if cfg.ClusterState != ClusterStateFlagNew && cfg.ClusterState != ClusterStateFlagExisting {
 		return fmt.Errorf("意料之外的集群状态 %q", cfg.ClusterState)
 	}
@@ -632,6 +1046,18 @@ func (cfg *Config) Validate() error {
 	default:
 		return fmt.Errorf("未知的 auto-compaction-mode %q", cfg.AutoCompactionMode)
 	}
+	if cfg.ExperimentalLeaseCheckpointInterval <= 0 {
+		return fmt.Errorf("--experimental-lease-checkpoint-interval 必须大于0, 得到 %v", cfg.ExperimentalLeaseCheckpointInterval)
+	}
+	if cfg.ExperimentalLeaseConsolidatedCheckpointInterval < 0 {
+		return fmt.Errorf("--experimental-lease-consolidated-checkpoint-interval 不能为负数, 得到 %v", cfg.ExperimentalLeaseConsolidatedCheckpointInterval)
+	}
+	if cfg.ExperimentalLeaseRevokeRate <= 0 {
+		return fmt.Errorf("--experimental-lease-revoke-rate 必须大于0, 得到 %v", cfg.ExperimentalLeaseRevokeRate)
+	}
+	if cfg.ExperimentalLeaseTTLJitter < 0 || cfg.ExperimentalLeaseTTLJitter >= 1 {
+		return fmt.Errorf("--experimental-lease-ttl-jitter 必须在[0,1)之间, 得到 %v", cfg.ExperimentalLeaseTTLJitter)
+	}
 	// false,false 不会走
 	if !cfg.ExperimentalEnableLeaseCheckpointPersist && cfg.ExperimentalEnableLeaseCheckpoint {
 		cfg.logger.Warn("检测到启用了Checkpoint而没有持久性.考虑启用experimental-enable-le-checkpoint-persist")
@@ -681,6 +1107,9 @@ func (cfg *Config) PeerURLsMapAndToken(which string) (urlsmap types.URLsMap, tok
 	//		}
 	//	}
 
+	case cfg.DiscoveryProvider != "":
+		urlsmap, err = cfg.getDiscoveredCluster(which)
+
 	default:
 		// 我们是静态配置的,
 		// infra1=http://127.0.0.1:12380,infra2=http://127.0.0.1:22380,infra3=http://127.0.0.1:32380
@@ -689,6 +1118,20 @@ func (cfg *Config) PeerURLsMapAndToken(which string) (urlsmap types.URLsMap, tok
 	return urlsmap, token, err
 }
 
+// getDiscoveredCluster 通过发现提供者获取初始集群
+func (cfg *Config) getDiscoveredCluster(which string) (types.URLsMap, error) {
+	params, err := discovery.ParseParams(cfg.DiscoveryParams)
+	if err != nil {
+		return nil, err
+	}
+	// 只有etcd成员必须属于发现的集群,代理不需要
+	self := discovery.Member{PeerURLs: cfg.APUrls}
+	if which == "etcd" {
+		self.Name = cfg.Name
+	}
+	return discovery.Lookup(context.Background(), cfg.GetLogger(), cfg.DiscoveryProvider, params, self)
+}
+
 // GetDNSClusterNames 使用DNS SRV记录来获取集群启动的初始节点列表.这个函数将返回一个或多个节点的列表,以及在执行服务发现时遇到的任何错误.
 // Note: Because this checks multiple sets of SRV records, discovery should only be considered to have
 // failed if the returned node list is empty.
@@ -925,6 +1368,25 @@ func (cfg *Config) getMetricsURLs() (ss []string) {
 	return ss
 }
 
+func (cfg *Config) getMaintenanceURLs() (ss []string) {
+	ss = make([]string, len(cfg.ListenMaintenanceUrls))
+	for i := range cfg.ListenMaintenanceUrls {
+		ss[i] = cfg.ListenMaintenanceUrls[i].String()
+	}
+	return ss
+}
+
+func (cfg *Config) getDashboardURLs() (ss []string) {
+	if !cfg.EnableDashboard {
+		return nil
+	}
+	ss = make([]string, len(cfg.ListenDashboardUrls))
+	for i := range cfg.ListenDashboardUrls {
+		ss[i] = cfg.ListenDashboardUrls[i].String()
+	}
+	return ss
+}
+
 // 返回boltdb存储的数据类型
 func parseBackendFreelistType(freelistType string) bolt.FreelistType {
 	if freelistType == freelistArrayType {
@@ -22,6 +22,7 @@ import (
 	"io/ioutil"
 	"net/url"
 	"os"
+	"time"
 
 	"github.com/ls-2018/etcd_cn/client_sdk/pkg/logutil"
 	"go.uber.org/zap"
@@ -55,6 +56,9 @@ func (cfg *Config) setupLogging() error {
 				}
 			}
 		}
+		if cfg.LogSamplingInitial < 0 || cfg.LogSamplingThereafter < 0 {
+			return errors.New("--log-sampling-initial 和 --log-sampling-thereafter 不能是负数")
+		}
 		// todo
 		if cfg.EnableLogRotation {
 			if err := setupLogRotation(cfg.LogOutputs, cfg.LogRotationConfigJSON); err != nil {
@@ -102,7 +106,8 @@ func (cfg *Config) setupLogging() error {
 			copied := logutil.DefaultZapLoggerConfig
 			copied.OutputPaths = outputPaths
 			copied.ErrorOutputPaths = errOutputPaths
-			copied = logutil.MergeOutputPaths(copied)                                    // /dev/null 判断
+			copied = logutil.MergeOutputPaths(copied) // /dev/null 判断
+			copied.Sampling = cfg.logSampling()
 			copied.Level = zap.NewAtomicLevelAt(logutil.ConvertToZapLevel(cfg.LogLevel)) // 是一个方便的函数,它创建一个AtomicLevel,然后用给定的级别调用SetLevel.
 			if cfg.ZapLoggerBuilder == nil {
 				lg, err := copied.Build() // 从配置和选项中构建一个logger
@@ -110,6 +115,7 @@ func (cfg *Config) setupLogging() error {
 					return err
 				}
 				cfg.ZapLoggerBuilder = NewZapLoggerBuilder(lg)
+				cfg.logLevel = &copied.Level
 			}
 		} else {
 			if len(cfg.LogOutputs) > 1 {
@@ -133,8 +139,12 @@ func (cfg *Config) setupLogging() error {
 				zapcore.NewJSONEncoder(logutil.DefaultZapLoggerConfig.EncoderConfig),
 				syncer, lvl,
 			)
+			if s := cfg.logSampling(); s != nil {
+				cr = zapcore.NewSamplerWithOptions(cr, time.Second, s.Initial, s.Thereafter)
+			}
 			if cfg.ZapLoggerBuilder == nil {
 				cfg.ZapLoggerBuilder = NewZapLoggerBuilder(zap.New(cr, zap.AddCaller(), zap.ErrorOutput(syncer)))
+				cfg.logLevel = &lvl
 			}
 		}
 
@@ -181,6 +191,18 @@ func (cfg *Config) setupLogging() error {
 	return nil
 }
 
+// logSampling 返回每秒的日志采样配置,LogSamplingInitial 为0时不采样
+func (cfg *Config) logSampling() *zap.SamplingConfig {
+	if cfg.LogSamplingInitial == 0 {
+		return nil
+	}
+	thereafter := cfg.LogSamplingThereafter
+	if thereafter == 0 {
+		thereafter = 1
+	}
+	return &zap.SamplingConfig{Initial: cfg.LogSamplingInitial, Thereafter: thereafter}
+}
+
 // NewZapLoggerBuilder 生成一个zap logger builder,为embedded  etcd设置给定的loger.
 func NewZapLoggerBuilder(lg *zap.Logger) func(*Config) error {
 	return func(cfg *Config) error {
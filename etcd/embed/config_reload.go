@@ -0,0 +1,170 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package embed
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+var errNotReloadable = errors.New("embed: 需要重启才能生效")
+
+// allowedCNs 可以热加载的客户端证书CN白名单
+type allowedCNs struct {
+	v atomic.Value // map[string]struct{}
+}
+
+func newAllowedCNs(cns []string) *allowedCNs {
+	a := &allowedCNs{}
+	a.set(cns)
+	return a
+}
+
+func (a *allowedCNs) set(cns []string) {
+	m := make(map[string]struct{}, len(cns))
+	for _, cn := range cns {
+		m[cn] = struct{}{}
+	}
+	a.v.Store(m)
+}
+
+func (a *allowedCNs) verify(cert *x509.Certificate) bool {
+	m := a.v.Load().(map[string]struct{})
+	if len(m) == 0 {
+		return true
+	}
+	_, ok := m[cert.Subject.CommonName]
+	return ok
+}
+
+// setupClientCNs 开启了客户端证书认证且没有其他证书限制时安装CN白名单检查,之后可以热加载
+func (e *Etcd) setupClientCNs() {
+	ti := &e.cfg.ClientTLSInfo
+	if !ti.ClientCertAuth || ti.AllowedCN != "" || ti.AllowedHostname != "" || len(ti.AllowedSPIFFEIDs) > 0 {
+		return
+	}
+	e.clientCNs = newAllowedCNs(e.cfg.ClientCertAllowedCNs)
+	ti.VerifyCertificate = e.clientCNs.verify
+}
+
+// ReloadConfig applies the runtime reloadable settings of cfg to the running
+// server: log-level, client-cert-allowed-cns, auto-compaction-retention,
+// experimental-warning-apply-duration and quota-backend-bytes. Every applied
+// change is logged. It returns the changed keys that can only take effect
+// after a restart.
+func (e *Etcd) ReloadConfig(cfg *Config) (needRestart []string) {
+	e.reloadMu.Lock()
+	defer e.reloadMu.Unlock()
+
+	lg := e.GetLogger()
+	for _, v := range DiffConfig(cfg, e.reloadBase) {
+		if !v.Changed {
+			continue
+		}
+		if err := e.reload(v.Key, cfg); err != nil {
+			lg.Warn("配置项修改未生效", zap.String("key", v.Key), zap.Any("old", v.Default), zap.Any("new", v.Value), zap.Error(err))
+			needRestart = append(needRestart, v.Key)
+			continue
+		}
+		lg.Info("配置项已热加载", zap.String("key", v.Key), zap.Any("old", v.Default), zap.Any("new", v.Value))
+	}
+	if len(needRestart) > 0 {
+		lg.Warn("部分配置修改需要重启才能生效", zap.Strings("keys", needRestart))
+	}
+	e.reloadBase = cfg
+	return needRestart
+}
+
+func (e *Etcd) reload(key string, cfg *Config) error {
+	switch key {
+	case "log-level":
+		if e.cfg.logLevel == nil {
+			return errNotReloadable
+		}
+		var lvl zapcore.Level
+		if err := lvl.Set(cfg.LogLevel); err != nil {
+			return err
+		}
+		e.cfg.logLevel.SetLevel(lvl)
+	case "client-cert-allowed-cns":
+		if e.clientCNs == nil {
+			return errNotReloadable
+		}
+		e.clientCNs.set(cfg.ClientCertAllowedCNs)
+	case "auto-compaction-retention":
+		if cfg.AutoCompactionMode != e.reloadBase.AutoCompactionMode {
+			return errNotReloadable
+		}
+		ret, err := parseCompactionRetention(cfg.AutoCompactionMode, cfg.AutoCompactionRetention)
+		if err != nil {
+			return err
+		}
+		if err = e.Server.SetCompactionRetention(ret); err != nil {
+			return err
+		}
+	case "experimental-warning-apply-duration":
+		e.Server.SetWarningApplyDuration(cfg.ExperimentalWarningApplyDuration)
+	case "quota-backend-bytes":
+		if err := e.Server.SetQuotaBackendBytes(cfg.QuotaBackendBytes); err != nil {
+			return err
+		}
+	default:
+		return errNotReloadable
+	}
+	return nil
+}
+
+// WatchConfigFile checks path every interval and reloads the configuration
+// with ReloadConfig when the content changes, until the server stops. extra
+// is passed to ConfigFromFileWith for callers keeping their own options in
+// the same file.
+func (e *Etcd) WatchConfigFile(path string, interval time.Duration, extra interface{}) {
+	lg := e.GetLogger()
+	last, _ := ioutil.ReadFile(path)
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+			case <-e.stopc:
+				return
+			}
+			b, err := ioutil.ReadFile(path)
+			if err != nil {
+				lg.Warn("读取配置文件失败", zap.String("path", path), zap.Error(err))
+				continue
+			}
+			if bytes.Equal(b, last) {
+				continue
+			}
+			last = b
+			cfg, err := ConfigFromFileWith(path, extra)
+			if err != nil {
+				lg.Warn("配置文件无效,忽略本次修改", zap.String("path", path), zap.Error(err))
+				continue
+			}
+			lg.Info("配置文件已修改,开始热加载", zap.String("path", path))
+			e.ReloadConfig(cfg)
+		}
+	}()
+}
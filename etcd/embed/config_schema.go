@@ -0,0 +1,221 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package embed
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	urlType      = reflect.TypeOf(url.URL{})
+)
+
+// unmarshalConfigYAML 严格解析配置文件: 拒绝未知字段, duration 字段可以写成 "5s",
+// 以 "-bytes" 结尾的字段可以写成 "8GiB"; 同一个文件可以解码到多个结构体中.
+func unmarshalConfigYAML(b []byte, outs ...interface{}) error {
+	jb, err := yaml.YAMLToJSON(b)
+	if err != nil {
+		return err
+	}
+	var m map[string]interface{}
+	if err = json.Unmarshal(jb, &m); err != nil {
+		return fmt.Errorf("配置文件必须是键值对: %v", err)
+	}
+	fields := make(map[string]reflect.Type)
+	for _, out := range outs {
+		schemaFields(reflect.TypeOf(out), fields)
+	}
+	if err = normalizeConfigValues("", m, fields); err != nil {
+		return err
+	}
+	if jb, err = json.Marshal(m); err != nil {
+		return err
+	}
+	for _, out := range outs {
+		if err = json.Unmarshal(jb, out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// schemaFields 收集结构体中有 json 名称的字段, 匿名嵌入的结构体展开到同一层
+func schemaFields(t reflect.Type, fields map[string]reflect.Type) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if f.Anonymous && name == "" {
+			schemaFields(f.Type, fields)
+			continue
+		}
+		if f.PkgPath != "" || name == "" || name == "-" {
+			continue
+		}
+		fields[name] = f.Type
+	}
+}
+
+func normalizeConfigValues(prefix string, m map[string]interface{}, fields map[string]reflect.Type) error {
+	for k, v := range m {
+		key := prefix + k
+		t, ok := fields[k]
+		if !ok {
+			return fmt.Errorf("未知的配置项 %q", key)
+		}
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		switch {
+		case t == durationType:
+			s, ok := v.(string)
+			if !ok {
+				continue
+			}
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return fmt.Errorf("配置项 %q 不是合法的时长: %v", key, err)
+			}
+			m[k] = int64(d)
+		case strings.HasSuffix(k, "-bytes") && isIntKind(t.Kind()):
+			s, ok := v.(string)
+			if !ok {
+				continue
+			}
+			n, err := humanize.ParseBytes(s)
+			if err != nil {
+				return fmt.Errorf("配置项 %q 不是合法的大小: %v", key, err)
+			}
+			m[k] = n
+		case t.Kind() == reflect.Struct && t != urlType:
+			sub, ok := v.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			subFields := make(map[string]reflect.Type)
+			schemaFields(t, subFields)
+			if err := normalizeConfigValues(key+".", sub, subFields); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func isIntKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// ConfigValue is one configuration key with its effective and default value.
+type ConfigValue struct {
+	Key     string
+	Value   interface{}
+	Default interface{}
+	// Changed is true if Value differs from Default.
+	Changed bool
+}
+
+// Values returns the configuration keyed by the names used in the
+// configuration file. Durations are rendered as strings such as "1m0s".
+func (cfg *Config) Values() map[string]interface{} {
+	vals := make(map[string]interface{})
+	v := reflect.ValueOf(cfg).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if f.PkgPath != "" || name == "" || name == "-" {
+			continue
+		}
+		fv := v.Field(i)
+		if fv.Type() == durationType {
+			vals[name] = time.Duration(fv.Int()).String()
+			continue
+		}
+		vals[name] = fv.Interface()
+	}
+
+	// 以下配置在文件中是字符串, 在 Config 中是解析后的值
+	vals["listen-peer-urls"] = strings.Join(cfg.getLPURLs(), ",")
+	vals["listen-client-urls"] = strings.Join(cfg.getLCURLs(), ",")
+	vals["initial-advertise-peer-urls"] = strings.Join(cfg.getAPURLs(), ",")
+	vals["advertise-client-urls"] = strings.Join(cfg.getACURLs(), ",")
+	vals["listen-metrics-urls"] = strings.Join(cfg.getMetricsURLs(), ",")
+	vals["listen-dashboard-urls"] = strings.Join(cfg.getDashboardURLs(), ",")
+	vals["listen-maintenance-urls"] = strings.Join(cfg.getMaintenanceURLs(), ",")
+	vals["cors"] = strings.Join(sortedKeys(cfg.CORS), ",")
+	vals["host-whitelist"] = strings.Join(sortedKeys(cfg.HostWhitelist), ",")
+	vals["client-transport-security"] = securityConfig{
+		CertFile:       cfg.ClientTLSInfo.CertFile,
+		KeyFile:        cfg.ClientTLSInfo.KeyFile,
+		ClientCertFile: cfg.ClientTLSInfo.ClientCertFile,
+		ClientKeyFile:  cfg.ClientTLSInfo.ClientKeyFile,
+		CertAuth:       cfg.ClientTLSInfo.ClientCertAuth,
+		TrustedCAFile:  cfg.ClientTLSInfo.TrustedCAFile,
+		AutoTLS:        cfg.ClientAutoTLS,
+	}
+	vals["peer-transport-security"] = securityConfig{
+		CertFile:       cfg.PeerTLSInfo.CertFile,
+		KeyFile:        cfg.PeerTLSInfo.KeyFile,
+		ClientCertFile: cfg.PeerTLSInfo.ClientCertFile,
+		ClientKeyFile:  cfg.PeerTLSInfo.ClientKeyFile,
+		CertAuth:       cfg.PeerTLSInfo.ClientCertAuth,
+		TrustedCAFile:  cfg.PeerTLSInfo.TrustedCAFile,
+		AutoTLS:        cfg.PeerAutoTLS,
+	}
+	return vals
+}
+
+// DiffConfig compares every configuration key of cfg with base, which is
+// usually NewConfig(). The result is sorted by key.
+func DiffConfig(cfg, base *Config) []ConfigValue {
+	vals, defs := cfg.Values(), base.Values()
+	diff := make([]ConfigValue, 0, len(vals))
+	for k, v := range vals {
+		d := defs[k]
+		diff = append(diff, ConfigValue{Key: k, Value: v, Default: d, Changed: !reflect.DeepEqual(v, d)})
+	}
+	sort.Slice(diff, func(i, j int) bool { return diff[i].Key < diff[j].Key })
+	return diff
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	ks := make([]string, 0, len(m))
+	for k := range m {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	return ks
+}
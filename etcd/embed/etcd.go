@@ -35,10 +35,13 @@ import (
 
 	"github.com/ls-2018/etcd_cn/client_sdk/pkg/transport"
 	"github.com/ls-2018/etcd_cn/client_sdk/pkg/types"
+	clientv3 "github.com/ls-2018/etcd_cn/client_sdk/v3"
 	"github.com/ls-2018/etcd_cn/etcd/config"
 	"github.com/ls-2018/etcd_cn/etcd/etcdserver"
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver/api/dashboard"
 	"github.com/ls-2018/etcd_cn/etcd/etcdserver/api/etcdhttp"
 	"github.com/ls-2018/etcd_cn/etcd/etcdserver/api/rafthttp"
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver/api/v3replication"
 	"github.com/ls-2018/etcd_cn/etcd/etcdserver/api/v3rpc"
 	"github.com/ls-2018/etcd_cn/etcd/verify"
 	"github.com/ls-2018/etcd_cn/offical/api/v3/version"
@@ -80,12 +83,21 @@ type Etcd struct {
 	// 本机节点监听本地网卡的map     例如   localhost:2379   127.0.0.1:2379  0.0.0.0:2379 等等
 	sctxs                   map[string]*serveCtx
 	metricsListeners        []net.Listener
+	dashboardListeners      []net.Listener
+	maintenanceListeners    []net.Listener
+	maintenanceServers      []*grpc.Server
+	replicators             []*v3replication.Replicator
+	replicationClient       *clientv3.Client // 复制读写本成员数据的进程内客户端
 	tracingExporterShutdown func()
 	Server                  *etcdserver.EtcdServer
 	cfg                     Config
 	stopc                   chan struct{} // raft 停止,消息通道
 	errc                    chan error    // 接收运行过程中产生的err
 	closeOnce               sync.Once
+
+	reloadMu   sync.Mutex
+	reloadBase *Config     // 上次加载的配置,热加载时与之比较
+	clientCNs  *allowedCNs // 可热加载的客户端证书CN白名单
 }
 
 // 每个server的Listener
@@ -103,6 +115,8 @@ func StartEtcd(inCfg *Config) (e *Etcd, err error) {
 	}
 	serving := false
 	e = &Etcd{cfg: *inCfg, stopc: make(chan struct{})}
+	base := *inCfg
+	e.reloadBase = &base
 	cfg := &e.cfg
 	defer func() {
 		if e == nil || err == nil {
@@ -118,6 +132,14 @@ func StartEtcd(inCfg *Config) (e *Etcd, err error) {
 		e = nil
 	}()
 
+	// 证书文件的定期检查随etcd关闭而停止
+	certCtx, certCancel := context.WithCancel(context.Background())
+	go func() {
+		<-e.stopc
+		certCancel()
+	}()
+	transport.WatchCerts(certCtx, cfg.logger)
+
 	if !cfg.SocketOpts.Empty() {
 		cfg.logger.Info("配置socket选项", zap.Bool("reuse-address", cfg.SocketOpts.ReuseAddress), zap.Bool("reuse-port", cfg.SocketOpts.ReusePort))
 	}
@@ -136,6 +158,7 @@ func StartEtcd(inCfg *Config) (e *Etcd, err error) {
 	for _, sctx := range e.sctxs {
 		e.Clients = append(e.Clients, sctx.l)
 	}
+	e.setupClientCNs()
 
 	var (
 		urlsmap types.URLsMap
@@ -180,6 +203,7 @@ func StartEtcd(inCfg *Config) (e *Etcd, err error) {
 		PeerTLSInfo:                              cfg.PeerTLSInfo,                // server 证书信息
 		TickMs:                                   cfg.TickMs,                     // tick计时器触发间隔
 		ElectionTicks:                            cfg.ElectionTicks(),            // 返回选举权检查对应多少次tick触发次数
+		ManualTicks:                              cfg.ManualTicks,                // 测试用,手动推进tick
 		InitialElectionTickAdvance:               cfg.InitialElectionTickAdvance, // 是否提前初始化选举时钟启动,以便更快的选举
 		AutoCompactionRetention:                  autoCompactionRetention,        // 自动压缩值
 		AutoCompactionMode:                       cfg.AutoCompactionMode,         // 自动压缩模式
@@ -195,6 +219,21 @@ func StartEtcd(inCfg *Config) (e *Etcd, err error) {
 		AuthToken:                                cfg.AuthToken,  // 认证格式  simple、jwt
 		BcryptCost:                               cfg.BcryptCost, // 为散列身份验证密码指定bcrypt算法的成本/强度
 		TokenTTL:                                 cfg.AuthTokenTTL,
+		AuthSPIFFEUserMapping:                    cfg.AuthSPIFFEUserMapping,
+		AuthWebhookURL:                           cfg.AuthWebhookURL,
+		AuthWebhookCAFile:                        cfg.AuthWebhookCAFile,
+		AuthWebhookTimeout:                       cfg.AuthWebhookTimeout,
+		AuthWebhookCacheTTL:                      cfg.AuthWebhookCacheTTL,
+		AuthWebhookFailurePolicy:                 cfg.AuthWebhookFailurePolicy,
+		AuthPasswordMinLength:                    cfg.AuthPasswordMinLength,
+		AuthPasswordMinClasses:                   cfg.AuthPasswordMinClasses,
+		AuthPasswordMaxAge:                       cfg.AuthPasswordMaxAge,
+		AuthLockoutThreshold:                     cfg.AuthLockoutThreshold,
+		AuthLockoutDuration:                      cfg.AuthLockoutDuration,
+		AuthRefreshTokenTTL:                      cfg.AuthRefreshTokenTTL,
+		AuthTokenTTLOverrides:                    cfg.AuthTokenTTLOverrides,
+		AuthAuditSampleRate:                      cfg.AuthAuditSampleRate,
+		AuthAuditMaxEntries:                      cfg.AuthAuditMaxEntries,
 		CORS:                                     cfg.CORS,
 		HostWhitelist:                            cfg.HostWhitelist,
 		InitialCorruptCheck:                      cfg.ExperimentalInitialCorruptCheck, // 数据毁坏检测功能
@@ -207,6 +246,10 @@ func StartEtcd(inCfg *Config) (e *Etcd, err error) {
 		UnsafeNoFsync:                            cfg.UnsafeNoFsync,
 		EnableLeaseCheckpoint:                    cfg.ExperimentalEnableLeaseCheckpoint, // 允许leader定期向其他成员发送检查点,以防止leader变化时剩余TTL重置.
 		LeaseCheckpointPersist:                   cfg.ExperimentalEnableLeaseCheckpointPersist,
+		LeaseCheckpointInterval:                  cfg.ExperimentalLeaseCheckpointInterval,
+		LeaseConsolidatedCheckpointInterval:      cfg.ExperimentalLeaseConsolidatedCheckpointInterval,
+		LeaseRevokeRate:                          cfg.ExperimentalLeaseRevokeRate,
+		LeaseTTLJitter:                           cfg.ExperimentalLeaseTTLJitter,
 		CompactionBatchLimit:                     cfg.ExperimentalCompactionBatchLimit,
 		WatchProgressNotifyInterval:              cfg.ExperimentalWatchProgressNotifyInterval,
 		DowngradeCheckTime:                       cfg.ExperimentalDowngradeCheckTime,   // 两次降级状态检查之间的时间间隔.
@@ -214,6 +257,49 @@ func StartEtcd(inCfg *Config) (e *Etcd, err error) {
 		ExperimentalMemoryMlock:                  cfg.ExperimentalMemoryMlock,
 		ExperimentalTxnModeWriteWithSharedBuffer: cfg.ExperimentalTxnModeWriteWithSharedBuffer,
 		ExperimentalBootstrapDefragThresholdMegabytes: cfg.ExperimentalBootstrapDefragThresholdMegabytes,
+		MemberUnreachableThreshold:                    cfg.ExperimentalMemberUnreachableThreshold,
+		MemberUnreachableWebhookURL:                   cfg.ExperimentalMemberUnreachableWebhookURL,
+		MemberAutoReplace:                             cfg.ExperimentalMemberAutoReplace,
+		LearnerAutoPromoteAfter:                       cfg.ExperimentalLearnerAutoPromoteAfter,
+		LearnerAutoPromoteMaxLag:                      cfg.ExperimentalLearnerAutoPromoteMaxLag,
+		TopologyLabel:                                 cfg.ExperimentalTopologyLabel,
+		ManualClusterVersionPromotion:                 cfg.ExperimentalManualClusterVersionPromotion,
+		RequestDeadlineAllowance:                      cfg.ExperimentalRequestDeadlineAllowance,
+		AdmissionControl:                              cfg.ExperimentalAdmissionControl,
+		AdmissionFsyncLatency:                         cfg.ExperimentalAdmissionFsyncLatency,
+		AdmissionApplyBacklog:                         cfg.ExperimentalAdmissionApplyBacklog,
+		AdmissionPendingProposals:                     cfg.ExperimentalAdmissionPendingProposals,
+		CrashReportDir:                                cfg.ExperimentalCrashReportDir,
+		CrashReportWebhookURL:                         cfg.ExperimentalCrashReportWebhookURL,
+		BackupInterval:                                cfg.BackupInterval,
+		BackupDir:                                     cfg.BackupDir,
+		BackupRetention:                               cfg.BackupRetention,
+		BackupMember:                                  cfg.BackupMember,
+		BackupTargetURL:                               cfg.BackupTargetURL,
+		NotifySinks:                                   cfg.ExperimentalNotifySinks,
+		Replica:                                       cfg.ExperimentalReplicaOf != nil,
+		CompactionHoldMaxCount:                        cfg.ExperimentalCompactionHoldMaxCount,
+		CompactionHoldMaxTTL:                          cfg.ExperimentalCompactionHoldMaxTTL,
+		CompactionHoldMaxRevisions:                    cfg.ExperimentalCompactionHoldMaxRevisions,
+		StagedTxnMaxOps:                               cfg.ExperimentalStagedTxnMaxOps,
+		StagedTxnMaxBytes:                             cfg.ExperimentalStagedTxnMaxBytes,
+		UserQuotas:                                    cfg.ExperimentalUserQuotas,
+		WatchMaxPerConnection:                         cfg.ExperimentalWatchMaxPerConnection,
+		WatchMaxPerUser:                               cfg.ExperimentalWatchMaxPerUser,
+		WatchLimitOverrides:                           cfg.ExperimentalWatchLimitOverrides,
+		AdmissionPlugins:                              cfg.ExperimentalAdmissionPlugins,
+		ExperimentalFailpoints:                        cfg.ExperimentalFailpoints,
+		ExperimentalAsyncStorageWrites:                cfg.ExperimentalAsyncStorageWrites,
+		ReadIndexBatchWindow:                          cfg.ExperimentalReadIndexBatchWindow,
+		ReadIndexAdaptiveBatching:                     cfg.ExperimentalReadIndexAdaptiveBatching,
+		ReadCacheBytes:                                cfg.ExperimentalReadCacheBytes,
+		RestoreWorkers:                                cfg.ExperimentalRestoreWorkers,
+		PeerTransport:                                 cfg.ExperimentalPeerTransport,
+		PeerCompression:                               cfg.ExperimentalPeerCompression,
+		PeerBatchInterval:                             cfg.ExperimentalPeerBatchInterval,
+		PeerBatchBytes:                                cfg.ExperimentalPeerBatchBytes,
+		ClockSkewThreshold:                            cfg.ExperimentalClockSkewThreshold,
+		V2Deprecation:                                 cfg.V2DeprecationEffective(),
 	}
 
 	if srvcfg.ExperimentalEnableDistributedTracing { // 使用OpenTelemetry协议实现分布式跟踪.默认false
@@ -252,6 +338,13 @@ func StartEtcd(inCfg *Config) (e *Etcd, err error) {
 			return e, err
 		}
 	}
+	e.Server.SetApplyInterceptor(cfg.ExperimentalApplyInterceptor)
+	for _, o := range cfg.ExperimentalApplyObservers {
+		e.Server.AddApplyObserver(o)
+	}
+	for _, f := range cfg.EventHandlers {
+		e.Server.RegisterEventHandler(f)
+	}
 	e.Server.Start()
 
 	if err = e.servePeers(); err != nil {
@@ -263,6 +356,15 @@ func StartEtcd(inCfg *Config) (e *Etcd, err error) {
 	if err = e.serveMetrics(); err != nil { // ✅
 		return e, err
 	}
+	if err = e.serveDashboard(); err != nil {
+		return e, err
+	}
+	if err = e.serveMaintenance(); err != nil {
+		return e, err
+	}
+	if err = e.startReplications(); err != nil {
+		return e, err
+	}
 
 	e.cfg.logger.Info(
 		"启动服务 peer/client/metrics",
@@ -272,6 +374,8 @@ func StartEtcd(inCfg *Config) (e *Etcd, err error) {
 		zap.Strings("advertise-client-urls", e.cfg.getACURLs()),
 		zap.Strings("listen-client-urls", e.cfg.getLCURLs()),
 		zap.Strings("listen-metrics-urls", e.cfg.getMetricsURLs()),
+		zap.Strings("listen-dashboard-urls", e.cfg.getDashboardURLs()),
+		zap.Strings("listen-maintenance-urls", e.cfg.getMaintenanceURLs()),
 	)
 	serving = true
 	return e, nil
@@ -320,6 +424,8 @@ func print(lg *zap.Logger, ec Config, sc config.ServerConfig, memberInitialized
 		zap.Strings("advertise-client-urls", ec.getACURLs()),
 		zap.Strings("listen-client-urls", ec.getLCURLs()),
 		zap.Strings("listen-metrics-urls", ec.getMetricsURLs()),
+		zap.Strings("listen-maintenance-urls", ec.getMaintenanceURLs()),
+		zap.Int("max-concurrent-maintenance-requests", ec.MaxConcurrentMaintenanceRequests),
 		zap.Strings("cors", cors),
 		zap.Strings("host-whitelist", hss),
 		zap.String("initial-cluster", sc.InitialPeerURLsMap.String()),
@@ -335,6 +441,52 @@ func print(lg *zap.Logger, ec Config, sc config.ServerConfig, memberInitialized
 		zap.String("discovery-url", sc.DiscoveryURL),
 		zap.String("discovery-proxy", sc.DiscoveryProxy),
 		zap.String("downgrade-check-interval", sc.DowngradeCheckTime.String()),
+		zap.String("member-unreachable-threshold", sc.MemberUnreachableThreshold.String()),
+		zap.Bool("member-auto-replace", sc.MemberAutoReplace),
+		zap.String("learner-auto-promote-after", sc.LearnerAutoPromoteAfter.String()),
+		zap.Uint64("learner-auto-promote-max-lag", sc.LearnerAutoPromoteMaxLag),
+		zap.String("topology-label", sc.TopologyLabel),
+		zap.Bool("manual-cluster-version-promotion", sc.ManualClusterVersionPromotion),
+		zap.String("request-deadline-allowance", sc.RequestDeadlineAllowance.String()),
+		zap.Bool("admission-control", sc.AdmissionControl),
+		zap.String("admission-fsync-latency", sc.AdmissionFsyncLatency.String()),
+		zap.Uint64("admission-apply-backlog", sc.AdmissionApplyBacklog),
+		zap.Int("admission-pending-proposals", sc.AdmissionPendingProposals),
+		zap.String("crash-report-dir", sc.CrashDir()),
+		zap.String("crash-report-webhook-url", sc.CrashReportWebhookURL),
+		zap.String("backup-interval", sc.BackupInterval.String()),
+		zap.String("backup-dir", sc.BackupDirPath()),
+		zap.Int("backup-retention", sc.BackupRetention),
+		zap.String("backup-member", sc.BackupMember),
+		zap.String("backup-target-url", sc.BackupTargetURL),
+		zap.Int("notify-sinks", len(sc.NotifySinks)),
+		zap.Int("replications", len(ec.ExperimentalReplications)),
+		zap.Bool("replica", sc.Replica),
+		zap.Int("compaction-hold-max-count", sc.CompactionHoldMaxCount),
+		zap.String("compaction-hold-max-ttl", sc.CompactionHoldMaxTTL.String()),
+		zap.Int64("compaction-hold-max-revisions", sc.CompactionHoldMaxRevisions),
+		zap.Int("staged-txn-max-ops", sc.StagedTxnMaxOps),
+		zap.Int64("staged-txn-max-bytes", sc.StagedTxnMaxBytes),
+		zap.Int("user-quotas", len(sc.UserQuotas)),
+		zap.Int("watch-max-per-connection", sc.WatchMaxPerConnection),
+		zap.Int("watch-max-per-user", sc.WatchMaxPerUser),
+		zap.String("watch-limit-overrides", sc.WatchLimitOverrides),
+		zap.String("admission-plugins", sc.AdmissionPlugins),
+		zap.Bool("failpoints", sc.ExperimentalFailpoints),
+		zap.Bool("async-storage-writes", sc.ExperimentalAsyncStorageWrites),
+		zap.String("read-index-batch-window", sc.ReadIndexBatchWindow.String()),
+		zap.Bool("read-index-adaptive-batching", sc.ReadIndexAdaptiveBatching),
+		zap.Int64("read-cache-bytes", sc.ReadCacheBytes),
+		zap.Int("restore-workers", sc.RestoreWorkers),
+		zap.String("peer-transport", sc.PeerTransport),
+		zap.String("peer-compression", sc.PeerCompression),
+		zap.String("peer-batch-interval", sc.PeerBatchInterval.String()),
+		zap.Int("peer-batch-bytes", sc.PeerBatchBytes),
+		zap.String("clock-skew-threshold", sc.ClockSkewThreshold.String()),
+		zap.Bool("grpc-keepalive-permit-without-stream", ec.GRPCKeepAlivePermitWithoutStream),
+		zap.String("grpc-max-connection-idle", ec.GRPCMaxConnectionIdle.String()),
+		zap.Uint("max-concurrent-streams", ec.MaxConcurrentStreams),
+		zap.Int("max-connections-per-client-ip", ec.MaxConnectionsPerClientIP),
 	)
 }
 
@@ -391,6 +543,26 @@ func (e *Etcd) Close() {
 		e.metricsListeners[i].Close()
 	}
 
+	for i := range e.dashboardListeners {
+		e.dashboardListeners[i].Close()
+	}
+
+	// 维护端口上可能有长时间的快照流,直接关闭不等待
+	for i := range e.maintenanceServers {
+		e.maintenanceServers[i].Stop()
+	}
+	for i := range e.maintenanceListeners {
+		e.maintenanceListeners[i].Close()
+	}
+
+	// 复制通过进程内客户端读取数据,在停止server之前停止
+	for _, r := range e.replicators {
+		r.Stop()
+	}
+	if e.replicationClient != nil {
+		e.replicationClient.Close()
+	}
+
 	// shutdown tracing exporter
 	if e.tracingExporterShutdown != nil {
 		e.tracingExporterShutdown()
@@ -446,6 +618,15 @@ func stopServers(ctx context.Context, ss *servers) {
 	}
 }
 
+// RegisterEventHandler registers f to be called on lifecycle events of the
+// embedded server: leadership changes, applied membership changes, finished
+// compactions and corruption alarms. Events that happened before registration
+// are not replayed; use Config.EventHandlers to observe startup events.
+// The returned function unregisters f.
+func (e *Etcd) RegisterEventHandler(f func(etcdserver.Event)) (unregister func()) {
+	return e.Server.RegisterEventHandler(f)
+}
+
 // Err - return channel used to report errors during etcd run/shutdown.
 // Since etcd 3.5 the channel is being closed when the etcd is over.
 func (e *Etcd) Err() <-chan error {
@@ -532,7 +713,8 @@ func (e *Etcd) servePeers() (err error) {
 	for _, p := range e.Peers {
 
 		u := p.Listener.Addr().String()
-		grpcServer := v3rpc.Server(e.Server, peerTLScfg, nil)
+		grpcServer := v3rpc.Server(e.Server, peerTLScfg, e.cfg.ExperimentalGRPCInterceptors)
+		e.Server.RegisterRaftGRPC(grpcServer)
 		m := cmux.New(p.Listener)
 		go grpcServer.Serve(m.Match(cmux.HTTP2())) // 基于http2 tcp://127.0.0.1:2380
 
@@ -638,6 +820,9 @@ func configureClientListeners(cfg *Config) (sctxs map[string]*serveCtx, err erro
 			}
 			sctx.l = transport.LimitListener(sctx.l, int(fdLimit-reservedInternalFDNum))
 		}
+		if cfg.MaxConnectionsPerClientIP > 0 {
+			sctx.l = transport.PerIPLimitListener(sctx.l, cfg.MaxConnectionsPerClientIP)
+		}
 
 		if network == "tcp" {
 			if sctx.l, err = transport.NewKeepAliveListener(sctx.l, network, nil); err != nil {
@@ -656,6 +841,7 @@ func configureClientListeners(cfg *Config) (sctxs map[string]*serveCtx, err erro
 			sctx.userHandlers[k] = cfg.UserHandlers[k]
 		}
 		sctx.serviceRegister = cfg.ServiceRegister
+		sctx.interceptors = cfg.ExperimentalGRPCInterceptors
 		if cfg.EnablePprof || cfg.LogLevel == "debug" {
 			sctx.registerPprof()
 		}
@@ -702,20 +888,7 @@ func (e *Etcd) serveClients() (err error) {
 	etcdhttp.HandleBasic(e.cfg.logger, mux, e.Server) // ✅
 	h = mux
 
-	var gopts []grpc.ServerOption
-	if e.cfg.GRPCKeepAliveMinTime > time.Duration(0) {
-		gopts = append(gopts, grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
-			MinTime:             e.cfg.GRPCKeepAliveMinTime,
-			PermitWithoutStream: false, // 默认false
-			// 如果是true,即使没有活动流(RPCs),服务器也允许keepalive pings.如果是假的,客户端在没有活动流的情况下发送ping 流,服务器将发送GOAWAY并关闭连接.
-		}))
-	}
-	if e.cfg.GRPCKeepAliveInterval > time.Duration(0) && e.cfg.GRPCKeepAliveTimeout > time.Duration(0) {
-		gopts = append(gopts, grpc.KeepaliveParams(keepalive.ServerParameters{
-			Time:    e.cfg.GRPCKeepAliveInterval,
-			Timeout: e.cfg.GRPCKeepAliveTimeout,
-		}))
-	}
+	gopts := e.grpcServerOptions()
 
 	// 启动每一个监听网卡的程序
 	for _, sctx := range e.sctxs {
@@ -756,6 +929,122 @@ func (e *Etcd) serveMetrics() (err error) {
 	return nil
 }
 
+// grpcServerOptions 客户端端口和独立维护端口共用的 keepalive、流数量等 gRPC 选项
+func (e *Etcd) grpcServerOptions() (gopts []grpc.ServerOption) {
+	if e.cfg.GRPCKeepAliveMinTime > time.Duration(0) {
+		gopts = append(gopts, grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             e.cfg.GRPCKeepAliveMinTime,
+			PermitWithoutStream: e.cfg.GRPCKeepAlivePermitWithoutStream, // 默认false
+			// 如果是true,即使没有活动流(RPCs),服务器也允许keepalive pings.如果是假的,客户端在没有活动流的情况下发送ping 流,服务器将发送GOAWAY并关闭连接.
+		}))
+	}
+	var kp keepalive.ServerParameters
+	if e.cfg.GRPCKeepAliveInterval > time.Duration(0) && e.cfg.GRPCKeepAliveTimeout > time.Duration(0) {
+		kp.Time, kp.Timeout = e.cfg.GRPCKeepAliveInterval, e.cfg.GRPCKeepAliveTimeout
+	}
+	kp.MaxConnectionIdle = e.cfg.GRPCMaxConnectionIdle
+	if kp != (keepalive.ServerParameters{}) {
+		gopts = append(gopts, grpc.KeepaliveParams(kp))
+	}
+	if e.cfg.MaxConcurrentStreams > 0 {
+		// 覆盖 v3rpc.Server 中默认的不限制
+		gopts = append(gopts, grpc.MaxConcurrentStreams(uint32(e.cfg.MaxConcurrentStreams)))
+	}
+	return gopts
+}
+
+// serveMaintenance 在独立的监听器上只提供 Maintenance 服务,快照流不会占用客户端端口的连接和流
+func (e *Etcd) serveMaintenance() error {
+	if len(e.cfg.ListenMaintenanceUrls) == 0 {
+		return nil
+	}
+	gopts := e.grpcServerOptions()
+	for _, murl := range e.cfg.ListenMaintenanceUrls {
+		// TLS 由 gRPC 的 credentials 完成握手,鉴权时才能拿到客户端证书
+		var tlscfg *tls.Config
+		if murl.Scheme == "https" || murl.Scheme == "unixs" {
+			var err error
+			if tlscfg, err = e.cfg.ClientTLSInfo.ServerConfig(); err != nil {
+				return err
+			}
+		}
+		ml, err := transport.NewListenerWithOpts(murl.Host, murl.Scheme,
+			transport.WithSocketOpts(&e.cfg.SocketOpts),
+			transport.WithSkipTLSInfoCheck(true),
+		)
+		if err != nil {
+			return err
+		}
+		gs := v3rpc.MaintenanceServer(e.Server, tlscfg, e.cfg.MaxConcurrentMaintenanceRequests, e.cfg.ExperimentalGRPCInterceptors, gopts...)
+		e.maintenanceListeners = append(e.maintenanceListeners, ml)
+		e.maintenanceServers = append(e.maintenanceServers, gs)
+		go func(u url.URL, ln net.Listener) {
+			e.cfg.logger.Info(
+				"serving maintenance",
+				zap.String("address", u.String()),
+				zap.Int("max-concurrent-requests", e.cfg.MaxConcurrentMaintenanceRequests),
+			)
+			e.errHandler(gs.Serve(ln))
+		}(murl, ml)
+	}
+	return nil
+}
+
+// startReplications 为每个配置的复制以及副本集群的上游复制启动协程,只有leader复制
+func (e *Etcd) startReplications() error {
+	if len(e.cfg.ExperimentalReplications) == 0 && e.cfg.ExperimentalReplicaOf == nil {
+		return nil
+	}
+	e.replicationClient = v3client.New(e.Server)
+	for _, rc := range e.cfg.ExperimentalReplications {
+		r, err := v3replication.New(e.cfg.logger, e.Server, e.replicationClient, rc)
+		if err != nil {
+			return err
+		}
+		e.replicators = append(e.replicators, r)
+		go r.Run()
+	}
+	if e.cfg.ExperimentalReplicaOf != nil {
+		r, err := v3replication.NewReplica(e.cfg.logger, e.Server, e.replicationClient, *e.cfg.ExperimentalReplicaOf)
+		if err != nil {
+			return err
+		}
+		e.replicators = append(e.replicators, r)
+		go r.Run()
+	}
+	return nil
+}
+
+// serveDashboard 在独立的监听器上提供只读的 web 管理页面
+func (e *Etcd) serveDashboard() error {
+	if !e.cfg.EnableDashboard {
+		return nil
+	}
+	h := dashboard.NewHandler(e.cfg.logger, e.Server)
+	for _, durl := range e.cfg.ListenDashboardUrls {
+		tlsInfo := &e.cfg.ClientTLSInfo
+		if durl.Scheme == "http" {
+			tlsInfo = nil
+		}
+		dl, err := transport.NewListenerWithOpts(durl.Host, durl.Scheme,
+			transport.WithTLSInfo(tlsInfo),
+			transport.WithSocketOpts(&e.cfg.SocketOpts),
+		)
+		if err != nil {
+			return err
+		}
+		e.dashboardListeners = append(e.dashboardListeners, dl)
+		go func(u url.URL, ln net.Listener) {
+			e.cfg.logger.Info(
+				"serving dashboard",
+				zap.String("address", u.String()),
+			)
+			e.errHandler((&http.Server{Handler: h}).Serve(ln))
+		}(durl, dl)
+	}
+	return nil
+}
+
 // 处理err
 func (e *Etcd) errHandler(err error) {
 	select {
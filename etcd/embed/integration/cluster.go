@@ -0,0 +1,431 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ls-2018/etcd_cn/client_sdk/pkg/types"
+	clientv3 "github.com/ls-2018/etcd_cn/client_sdk/v3"
+	"github.com/ls-2018/etcd_cn/code_debug/conf"
+	"github.com/ls-2018/etcd_cn/etcd/embed"
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultSize       = 3
+	defaultTickMs     = 10
+	defaultElectionMs = 100
+)
+
+var (
+	ErrMemberStopped = errors.New("integration: member is stopped")
+	ErrMemberRunning = errors.New("integration: member is running")
+	ErrNoLeader      = errors.New("integration: no leader")
+)
+
+// socketSeq 保证同一进程中的 unix socket 名字不重复
+var socketSeq int64
+
+// ClusterConfig configures an in-process cluster.
+type ClusterConfig struct {
+	// Size is the number of members, 3 by default.
+	Size int
+	// Dir holds the data dirs of the members. A temporary dir is created
+	// and removed by Terminate when empty.
+	Dir string
+	// Logger is the parent logger of the members, zap.NewNop() by default.
+	Logger *zap.Logger
+	// TickMs and ElectionMs default to 10ms and 100ms to keep elections fast.
+	TickMs     uint
+	ElectionMs uint
+	// ManualTicks stops the raft tickers of all members: raft time only
+	// moves on AdvanceTicks, or while WaitReady and WaitLeader are waiting.
+	ManualTicks bool
+	// Configure, if set, is called on the config of every member before
+	// it is started for the first time.
+	Configure func(cfg *embed.Config)
+}
+
+// Cluster is a multi-member etcd cluster running in the current process.
+type Cluster struct {
+	cfg     ClusterConfig
+	dir     string
+	tempDir bool
+
+	mu      sync.Mutex
+	members []*Member
+	// cut 记录当前分区中不能互相通信的成员
+	cut map[[2]int]bool
+}
+
+// Member is a member of a Cluster.
+type Member struct {
+	Name string
+
+	cfg  *embed.Config
+	id   types.ID
+	etcd *embed.Etcd
+}
+
+// NewCluster creates the members of a new cluster and starts them. Use
+// WaitReady to wait until they serve requests.
+func NewCluster(cfg ClusterConfig) (*Cluster, error) {
+	if cfg.Size == 0 {
+		cfg.Size = defaultSize
+	}
+	if cfg.TickMs == 0 {
+		cfg.TickMs = defaultTickMs
+	}
+	if cfg.ElectionMs == 0 {
+		cfg.ElectionMs = defaultElectionMs
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = zap.NewNop()
+	}
+	// 和 etcdctl check perf 一样关闭连接调试输出,测试进程里可能没有 zsh/lsof
+	conf.Perf = true
+	c := &Cluster{cfg: cfg, dir: cfg.Dir, cut: make(map[[2]int]bool)}
+	if c.dir == "" {
+		dir, err := ioutil.TempDir("", "etcd-integration")
+		if err != nil {
+			return nil, err
+		}
+		c.dir, c.tempDir = dir, true
+	}
+
+	initial := make([]string, cfg.Size)
+	for i := 0; i < cfg.Size; i++ {
+		m := c.newMember(i)
+		c.members = append(c.members, m)
+		initial[i] = fmt.Sprintf("%s=%s", m.Name, m.cfg.APUrls[0].String())
+	}
+	for _, m := range c.members {
+		m.cfg.InitialCluster = strings.Join(initial, ",")
+		if cfg.Configure != nil {
+			cfg.Configure(m.cfg)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := range c.members {
+		if err := c.start(i); err != nil {
+			c.terminate()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *Cluster) newMember(i int) *Member {
+	name := fmt.Sprintf("m%d", i)
+	cfg := embed.NewConfig()
+	cfg.Name = name
+	cfg.Dir = filepath.Join(c.dir, name)
+	cfg.TickMs = c.cfg.TickMs
+	cfg.ElectionMs = c.cfg.ElectionMs
+	cfg.ManualTicks = c.cfg.ManualTicks
+	cfg.InitialClusterToken = filepath.Base(c.dir)
+	cfg.ZapLoggerBuilder = embed.NewZapLoggerBuilder(c.cfg.Logger.Named(name))
+
+	purl, curl := socketURL(), socketURL()
+	cfg.LPUrls, cfg.APUrls = []url.URL{purl}, []url.URL{purl}
+	cfg.LCUrls, cfg.ACUrls = []url.URL{curl}, []url.URL{curl}
+	return &Member{Name: name, cfg: cfg}
+}
+
+// socketURL 返回一个 unix socket 地址;rafthttp 和 clientv3 都支持 unix://host:port 的形式,
+// socket 文件建在当前目录,监听关闭时删除.
+func socketURL() url.URL {
+	n := atomic.AddInt64(&socketSeq, 1)
+	return url.URL{Scheme: "unix", Host: fmt.Sprintf("localhost:%d%05d", os.Getpid(), n)}
+}
+
+func (c *Cluster) start(i int) error {
+	m := c.members[i]
+	e, err := embed.StartEtcd(m.cfg)
+	if err != nil {
+		return fmt.Errorf("integration: start %s: %v", m.Name, err)
+	}
+	m.etcd, m.id = e, e.Server.ID()
+	c.applyCuts()
+	return nil
+}
+
+// Members returns the members of the cluster, indexed as in the other methods.
+func (c *Cluster) Members() []*Member {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*Member(nil), c.members...)
+}
+
+// Member returns the i-th member.
+func (c *Cluster) Member(i int) *Member {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.members[i]
+}
+
+// Endpoints returns the client URLs of all running members.
+func (c *Cluster) Endpoints() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var eps []string
+	for _, m := range c.members {
+		if m.etcd != nil {
+			eps = append(eps, m.Endpoints()...)
+		}
+	}
+	return eps
+}
+
+// Client returns a client connected to all running members.
+func (c *Cluster) Client() (*clientv3.Client, error) {
+	return clientv3.New(clientv3.Config{Endpoints: c.Endpoints(), DialTimeout: 5 * time.Second})
+}
+
+// WaitReady waits until all running members serve client requests.
+func (c *Cluster) WaitReady(ctx context.Context) error {
+	for _, m := range c.Members() {
+		e := m.Etcd()
+		if e == nil {
+			continue
+		}
+		if err := c.wait(ctx, e.Server.ReadyNotify()); err != nil {
+			return fmt.Errorf("integration: wait %s: %v", m.Name, err)
+		}
+	}
+	return nil
+}
+
+// Leader returns the index of the running member that is the leader
+// according to a majority of the running members, or -1 if there is none.
+func (c *Cluster) Leader() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	votes := make(map[types.ID]int)
+	for _, m := range c.members {
+		if m.etcd != nil {
+			votes[m.etcd.Server.Leader()]++
+		}
+	}
+	for i, m := range c.members {
+		if m.etcd != nil && votes[m.id] > len(c.members)/2 && m.etcd.Server.Leader() == m.id {
+			return i
+		}
+	}
+	return -1
+}
+
+// WaitLeader waits until Leader reports a leader and returns its index.
+func (c *Cluster) WaitLeader(ctx context.Context) (int, error) {
+	t := time.NewTicker(time.Duration(c.cfg.TickMs) * time.Millisecond)
+	defer t.Stop()
+	for {
+		if lead := c.Leader(); lead >= 0 {
+			return lead, nil
+		}
+		select {
+		case <-t.C:
+			if c.cfg.ManualTicks {
+				c.AdvanceTicks(1)
+			}
+		case <-ctx.Done():
+			return -1, ErrNoLeader
+		}
+	}
+}
+
+// wait 等待 done 关闭;手动推进时钟时在等待期间按 TickMs 推进 raft 时钟
+func (c *Cluster) wait(ctx context.Context, done <-chan struct{}) error {
+	var tickc <-chan time.Time
+	if c.cfg.ManualTicks {
+		t := time.NewTicker(time.Duration(c.cfg.TickMs) * time.Millisecond)
+		defer t.Stop()
+		tickc = t.C
+	}
+	for {
+		select {
+		case <-done:
+			return nil
+		case <-tickc:
+			c.AdvanceTicks(1)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// AdvanceTicks advances the raft clocks of all running members by ticks.
+func (c *Cluster) AdvanceTicks(ticks int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, m := range c.members {
+		if m.etcd != nil {
+			m.etcd.Server.AdvanceTicks(ticks)
+		}
+	}
+}
+
+// Partition splits the members into the given groups; the members not
+// listed in any group form one more group. Members in different groups
+// cannot talk to each other. A previous partition is replaced.
+func (c *Cluster) Partition(groups ...[]int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	group := make(map[int]int)
+	for g, idxs := range groups {
+		for _, i := range idxs {
+			group[i] = g + 1
+		}
+	}
+	c.cut = make(map[[2]int]bool)
+	for i := range c.members {
+		for j := range c.members {
+			if i == j {
+				continue
+			}
+			if group[i] != group[j] {
+				c.cut[[2]int{i, j}] = true
+			}
+		}
+	}
+	c.applyCuts()
+}
+
+// Heal removes the partition.
+func (c *Cluster) Heal() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cut = make(map[[2]int]bool)
+	c.applyCuts()
+}
+
+// applyCuts 按 c.cut 设置所有运行中成员的 rafthttp 丢包;重启的成员也需要重新设置
+func (c *Cluster) applyCuts() {
+	for i, m := range c.members {
+		if m.etcd == nil {
+			continue
+		}
+		for j, peer := range c.members {
+			if i == j || peer.id == 0 {
+				continue
+			}
+			if c.cut[[2]int{i, j}] {
+				m.etcd.Server.CutPeer(peer.id)
+			} else {
+				m.etcd.Server.MendPeer(peer.id)
+			}
+		}
+	}
+}
+
+// Crash stops the i-th member without a graceful shutdown: a leader does
+// not transfer its leadership first.
+func (c *Cluster) Crash(i int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m := c.members[i]
+	if m.etcd == nil {
+		return ErrMemberStopped
+	}
+	m.etcd.Server.HardStop()
+	// raft 已经停止,Close 只负责关闭监听和存储
+	m.etcd.Close()
+	m.etcd = nil
+	return nil
+}
+
+// Stop gracefully stops the i-th member.
+func (c *Cluster) Stop(i int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m := c.members[i]
+	if m.etcd == nil {
+		return ErrMemberStopped
+	}
+	m.etcd.Close()
+	m.etcd = nil
+	return nil
+}
+
+// Restart starts the stopped i-th member again from its data dir. The
+// current partition applies to it. Use WaitReady to wait until it serves
+// requests.
+func (c *Cluster) Restart(i int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.members[i].etcd != nil {
+		return ErrMemberRunning
+	}
+	return c.start(i)
+}
+
+// Terminate stops all members and removes the data dirs.
+func (c *Cluster) Terminate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.terminate()
+}
+
+func (c *Cluster) terminate() {
+	for _, m := range c.members {
+		if m.etcd != nil {
+			m.etcd.Server.HardStop()
+			m.etcd.Close()
+			m.etcd = nil
+		}
+		os.RemoveAll(m.cfg.Dir)
+	}
+	if c.tempDir {
+		os.Remove(c.dir)
+	}
+}
+
+// Etcd returns the running etcd of the member, nil if it is stopped.
+func (m *Member) Etcd() *embed.Etcd { return m.etcd }
+
+// Server returns the running server of the member, nil if it is stopped.
+func (m *Member) Server() *etcdserver.EtcdServer {
+	if m.etcd == nil {
+		return nil
+	}
+	return m.etcd.Server
+}
+
+// ID returns the member id, known once the member has been started.
+func (m *Member) ID() types.ID { return m.id }
+
+// Endpoints returns the client URLs of the member.
+func (m *Member) Endpoints() []string {
+	eps := make([]string, len(m.cfg.ACUrls))
+	for i := range m.cfg.ACUrls {
+		eps[i] = m.cfg.ACUrls[i].String()
+	}
+	return eps
+}
@@ -0,0 +1,34 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package integration starts multi-member etcd clusters inside the test
+// process, so that downstream projects can write failure-injection tests
+// without external processes or containers.
+//
+// Every member has its own data dir and talks real raft to the others over
+// unix sockets. The cluster can be partitioned and healed, members can be
+// crashed, stopped and restarted, and with ManualTicks the raft clocks only
+// move when the test advances them.
+//
+//	c, err := integration.NewCluster(integration.ClusterConfig{Size: 3})
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	defer c.Terminate()
+//	if err := c.WaitReady(ctx); err != nil {
+//		t.Fatal(err)
+//	}
+//	lead, _ := c.WaitLeader(ctx)
+//	c.Partition([]int{lead}) // isolate the leader
+package integration
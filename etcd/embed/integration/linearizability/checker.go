@@ -0,0 +1,275 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linearizability
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// 检查器实现 Wing & Gong 的线性一致性检查算法,按 Lowe 的方法缓存已经访问过的(已线性化集合,状态),
+// 和 porcupine 的 CheckOperations 相同.接口也和 porcupine 一致,模型可以直接换成 porcupine.Model.
+
+// Operation is a completed or pending operation of a history. Call and
+// Return are timestamps from one monotonic clock; an operation whose
+// outcome is unknown has Return set to math.MaxInt64.
+type Operation struct {
+	ClientID int
+	Input    interface{}
+	Call     int64
+	Output   interface{}
+	Return   int64
+}
+
+// Model is a sequential specification of the system under test.
+type Model struct {
+	// Partition optionally splits a history into independent histories
+	// that are checked separately, e.g. by key.
+	Partition func(history []Operation) [][]Operation
+	// Init returns the initial state.
+	Init func() interface{}
+	// Step returns whether the operation with input and output is legal in
+	// state, and the state after it.
+	Step func(state interface{}, input interface{}, output interface{}) (bool, interface{})
+	// Equal reports whether two states are equal; == is used when nil.
+	Equal func(state1, state2 interface{}) bool
+	// DescribeOperation optionally formats an operation for reports.
+	DescribeOperation func(input interface{}, output interface{}) string
+}
+
+// CheckResult is the result of a linearizability check.
+type CheckResult string
+
+const (
+	// Ok means the history is linearizable.
+	Ok CheckResult = "Ok"
+	// Illegal means the history is not linearizable.
+	Illegal CheckResult = "Illegal"
+	// Unknown means the check timed out.
+	Unknown CheckResult = "Unknown"
+)
+
+// CheckOperations checks whether history is linearizable with respect to
+// model. A timeout of 0 means no timeout. When the result is Illegal, the
+// partition that failed the check is returned too.
+func CheckOperations(model Model, history []Operation, timeout time.Duration) (CheckResult, []Operation) {
+	model = fillDefault(model)
+	var kill int32
+	if timeout > 0 {
+		t := time.AfterFunc(timeout, func() { atomic.StoreInt32(&kill, 1) })
+		defer t.Stop()
+	}
+	partitions := [][]Operation{history}
+	if model.Partition != nil {
+		partitions = model.Partition(history)
+	}
+	result := Ok
+	for _, p := range partitions {
+		switch checkSingle(model, p, &kill) {
+		case Illegal:
+			return Illegal, p
+		case Unknown:
+			result = Unknown
+		}
+	}
+	return result, nil
+}
+
+func fillDefault(model Model) Model {
+	if model.Equal == nil {
+		model.Equal = func(s1, s2 interface{}) bool { return s1 == s2 }
+	}
+	return model
+}
+
+type entryKind bool
+
+const (
+	callEntry   entryKind = false
+	returnEntry entryKind = true
+)
+
+type entry struct {
+	kind  entryKind
+	value interface{}
+	id    int
+	time  int64
+}
+
+// makeEntries 把操作拆成按时间排序的调用和返回事件,时间相同时调用在前,这样两个操作被视为并发
+func makeEntries(history []Operation) []entry {
+	es := make([]entry, 0, 2*len(history))
+	for i, op := range history {
+		es = append(es, entry{callEntry, op.Input, i, op.Call}, entry{returnEntry, op.Output, i, op.Return})
+	}
+	sort.SliceStable(es, func(i, j int) bool {
+		if es[i].time != es[j].time {
+			return es[i].time < es[j].time
+		}
+		return es[i].kind == callEntry && es[j].kind == returnEntry
+	})
+	return es
+}
+
+type node struct {
+	value interface{}
+	// match 调用事件指向对应的返回事件,返回事件为nil
+	match *node
+	id    int
+	next  *node
+	prev  *node
+}
+
+func makeLinkedEntries(es []entry) *node {
+	var root *node
+	match := make(map[int]*node)
+	for i := len(es) - 1; i >= 0; i-- {
+		e := es[i]
+		n := &node{value: e.value, id: e.id, next: root}
+		if e.kind == returnEntry {
+			match[e.id] = n
+		} else {
+			n.match = match[e.id]
+		}
+		if root != nil {
+			root.prev = n
+		}
+		root = n
+	}
+	head := &node{id: -1, next: root}
+	if root != nil {
+		root.prev = head
+	}
+	return head
+}
+
+// lift 从链表中摘掉调用事件和它的返回事件
+func lift(n *node) {
+	n.prev.next = n.next
+	n.next.prev = n.prev
+	m := n.match
+	m.prev.next = m.next
+	if m.next != nil {
+		m.next.prev = m.prev
+	}
+}
+
+// unlift 把 lift 摘掉的事件放回原处
+func unlift(n *node) {
+	m := n.match
+	m.prev.next = m
+	if m.next != nil {
+		m.next.prev = m
+	}
+	n.prev.next = n
+	n.next.prev = n
+}
+
+type bitset []uint64
+
+func newBitset(n int) bitset { return make(bitset, (n+63)/64) }
+
+func (b bitset) clone() bitset { return append(bitset(nil), b...) }
+
+func (b bitset) set(i int) bitset {
+	b[i/64] |= 1 << uint(i%64)
+	return b
+}
+
+func (b bitset) clear(i int) bitset {
+	b[i/64] &^= 1 << uint(i%64)
+	return b
+}
+
+func (b bitset) hash() uint64 {
+	h := uint64(len(b))
+	for _, w := range b {
+		h = h*1099511628211 ^ w
+	}
+	return h
+}
+
+func (b bitset) equals(o bitset) bool {
+	for i := range b {
+		if b[i] != o[i] {
+			return false
+		}
+	}
+	return true
+}
+
+type cacheEntry struct {
+	linearized bitset
+	state      interface{}
+}
+
+type callFrame struct {
+	n     *node
+	state interface{}
+}
+
+func cacheContains(model Model, cache map[uint64][]cacheEntry, e cacheEntry) bool {
+	for _, c := range cache[e.linearized.hash()] {
+		if e.linearized.equals(c.linearized) && model.Equal(e.state, c.state) {
+			return true
+		}
+	}
+	return false
+}
+
+func checkSingle(model Model, history []Operation, kill *int32) CheckResult {
+	head := makeLinkedEntries(makeEntries(history))
+	linearized := newBitset(len(history))
+	cache := make(map[uint64][]cacheEntry)
+	var calls []callFrame
+
+	state := model.Init()
+	n := head.next
+	for steps := 0; head.next != nil; steps++ {
+		if steps&0xfff == 0 && atomic.LoadInt32(kill) != 0 {
+			return Unknown
+		}
+		if n.match != nil {
+			ok, newState := model.Step(state, n.value, n.match.value)
+			if ok {
+				ce := cacheEntry{linearized.clone().set(n.id), newState}
+				if !cacheContains(model, cache, ce) {
+					h := ce.linearized.hash()
+					cache[h] = append(cache[h], ce)
+					calls = append(calls, callFrame{n, state})
+					state = newState
+					linearized.set(n.id)
+					lift(n)
+					n = head.next
+					continue
+				}
+			}
+			n = n.next
+			continue
+		}
+		// 遇到返回事件:它的调用无法在此之前线性化,回溯
+		if len(calls) == 0 {
+			return Illegal
+		}
+		top := calls[len(calls)-1]
+		calls = calls[:len(calls)-1]
+		n, state = top.n, top.state
+		linearized.clear(n.id)
+		unlift(n)
+		n = n.next
+	}
+	return Ok
+}
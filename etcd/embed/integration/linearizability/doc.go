@@ -0,0 +1,43 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package linearizability checks that the key-value and lease operations
+// served by an in-process cluster (see package integration) are
+// linearizable while partitions and crashes are injected.
+//
+// A History records every request of its Clients with the time it was sent
+// and the time its response arrived. Writes that fail may still have been
+// applied, so they are recorded with an unknown outcome and no return
+// time. CheckOperations then searches for a linearization of the history
+// against EtcdModel with the algorithm of Wing & Gong, as porcupine does;
+// Model and Operation have the same shape as porcupine's.
+//
+// Run combines both with a seeded workload and fault schedule:
+//
+//	c, err := integration.NewCluster(integration.ClusterConfig{Size: 3})
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	defer c.Terminate()
+//	if err = c.WaitReady(ctx); err != nil {
+//		t.Fatal(err)
+//	}
+//	r, err := linearizability.Run(ctx, c, linearizability.Config{
+//		Seed:   seed,
+//		Faults: []linearizability.Fault{linearizability.FaultPartitionLeader, linearizability.FaultCrashMember},
+//	})
+//	if err != nil {
+//		t.Fatal(r) // lists the operations that cannot be linearized
+//	}
+package linearizability
@@ -0,0 +1,166 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linearizability
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math"
+	"sync"
+	"time"
+
+	clientv3 "github.com/ls-2018/etcd_cn/client_sdk/v3"
+	"github.com/ls-2018/etcd_cn/offical/api/v3/v3rpc/rpctypes"
+)
+
+// History records the operations of several clients on one monotonic clock.
+type History struct {
+	start time.Time
+
+	mu      sync.Mutex
+	ops     []Operation
+	clients int
+}
+
+// NewHistory returns an empty history whose clock starts now.
+func NewHistory() *History {
+	return &History{start: time.Now()}
+}
+
+func (h *History) now() int64 { return int64(time.Since(h.start)) }
+
+func (h *History) append(op Operation) {
+	h.mu.Lock()
+	h.ops = append(h.ops, op)
+	h.mu.Unlock()
+}
+
+// Operations returns a copy of the recorded operations.
+func (h *History) Operations() []Operation {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]Operation(nil), h.ops...)
+}
+
+// WriteTo writes the recorded operations as JSON lines, so a failed
+// history can be kept as a CI artifact and checked again.
+func (h *History) WriteTo(w io.Writer) (int64, error) {
+	var n int64
+	enc := json.NewEncoder(w)
+	for _, op := range h.Operations() {
+		b, err := json.Marshal(op)
+		if err != nil {
+			return n, err
+		}
+		n += int64(len(b)) + 1
+		if err = enc.Encode(json.RawMessage(b)); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// Client wraps a client and records each request it sends in the history.
+// A Client must not be used concurrently: the operations of one client are
+// sequential, as the checker assumes.
+type Client struct {
+	c  *clientv3.Client
+	h  *History
+	id int
+}
+
+// NewClient returns a recording client that sends requests with c.
+func (h *History) NewClient(c *clientv3.Client) *Client {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.clients++
+	return &Client{c: c, h: h, id: h.clients}
+}
+
+// record 记录写请求;除了确定的 ErrLeaseNotFound,失败的写请求可能已经生效,结果记为未知并且没有返回时间
+func (c *Client) record(req Request, call int64, resp Response, err error) {
+	ret := c.h.now()
+	switch {
+	case err == nil:
+	case rpctypes.Error(err) == rpctypes.ErrLeaseNotFound:
+		resp = Response{LeaseNotFound: true}
+	default:
+		resp, ret = Response{Unknown: true}, math.MaxInt64
+	}
+	c.h.append(Operation{ClientID: c.id, Input: req, Call: call, Output: resp, Return: ret})
+}
+
+// Get reads key linearizably. Failed reads have no effect and are not recorded.
+func (c *Client) Get(ctx context.Context, key string) (string, bool, error) {
+	call := c.h.now()
+	resp, err := c.c.Get(ctx, key)
+	if err != nil {
+		return "", false, err
+	}
+	var r Response
+	if len(resp.Kvs) > 0 {
+		r.Value, r.Found = string(resp.Kvs[0].Value), true
+	}
+	c.record(Request{Op: OpGet, Key: key}, call, r, nil)
+	return r.Value, r.Found, nil
+}
+
+// Put writes key, attached to lease when it is not 0. Values should be
+// unique in the history, otherwise stale reads can go unnoticed.
+func (c *Client) Put(ctx context.Context, key, value string, lease clientv3.LeaseID) error {
+	call := c.h.now()
+	var err error
+	if lease != clientv3.NoLease {
+		_, err = c.c.Put(ctx, key, value, clientv3.WithLease(lease))
+	} else {
+		_, err = c.c.Put(ctx, key, value)
+	}
+	c.record(Request{Op: OpPut, Key: key, Value: value, LeaseID: int64(lease)}, call, Response{}, err)
+	return err
+}
+
+// Delete deletes key.
+func (c *Client) Delete(ctx context.Context, key string) error {
+	call := c.h.now()
+	resp, err := c.c.Delete(ctx, key)
+	var r Response
+	if err == nil {
+		r.Deleted = resp.Deleted
+	}
+	c.record(Request{Op: OpDelete, Key: key}, call, r, err)
+	return err
+}
+
+// Grant grants a lease. The lease is only recorded when the grant
+// succeeds: the ID of a lease granted by a failed request is unknown, so
+// no later operation can refer to it.
+func (c *Client) Grant(ctx context.Context, ttl int64) (clientv3.LeaseID, error) {
+	call := c.h.now()
+	resp, err := c.c.Grant(ctx, ttl)
+	if err != nil {
+		return clientv3.NoLease, err
+	}
+	c.record(Request{Op: OpGrant, LeaseID: int64(resp.ID)}, call, Response{}, nil)
+	return resp.ID, nil
+}
+
+// Revoke revokes lease and deletes the keys attached to it.
+func (c *Client) Revoke(ctx context.Context, lease clientv3.LeaseID) error {
+	call := c.h.now()
+	_, err := c.c.Revoke(ctx, lease)
+	c.record(Request{Op: OpRevoke, LeaseID: int64(lease)}, call, Response{}, err)
+	return err
+}
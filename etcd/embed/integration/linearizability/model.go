@@ -0,0 +1,229 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linearizability
+
+import "fmt"
+
+// OpType is the kind of a recorded etcd request.
+type OpType string
+
+const (
+	OpGet    OpType = "get"
+	OpPut    OpType = "put"
+	OpDelete OpType = "delete"
+	OpGrant  OpType = "grant"
+	OpRevoke OpType = "revoke"
+)
+
+// Request is the input of an etcd operation.
+type Request struct {
+	Op      OpType
+	Key     string
+	Value   string
+	LeaseID int64
+}
+
+// Response is the output of an etcd operation.
+type Response struct {
+	// Unknown is set when the request failed and may or may not have been
+	// applied.
+	Unknown bool
+	// LeaseNotFound is set when a put or revoke was rejected because the
+	// lease did not exist.
+	LeaseNotFound bool
+	// Value and Found are the result of a get.
+	Value string
+	Found bool
+	// Deleted is the number of keys removed by a delete.
+	Deleted int64
+}
+
+type keyValue struct {
+	value   string
+	leaseID int64
+}
+
+// etcdState 是不可变的,每一步都复制
+type etcdState struct {
+	kvs    map[string]keyValue
+	leases map[int64]bool
+}
+
+func (s etcdState) clone() etcdState {
+	c := etcdState{kvs: make(map[string]keyValue, len(s.kvs)), leases: make(map[int64]bool, len(s.leases))}
+	for k, v := range s.kvs {
+		c.kvs[k] = v
+	}
+	for id := range s.leases {
+		c.leases[id] = true
+	}
+	return c
+}
+
+// EtcdModel models the key-value and lease API of etcd. Leases never
+// expire in the model, so the workload must grant them with a TTL longer
+// than the test. Histories are partitioned into groups of keys connected
+// by the leases attached to them.
+var EtcdModel = Model{
+	Partition: partitionByKey,
+	Init: func() interface{} {
+		return etcdState{kvs: map[string]keyValue{}, leases: map[int64]bool{}}
+	},
+	Step: func(st, in, out interface{}) (bool, interface{}) {
+		return step(st.(etcdState), in.(Request), out.(Response))
+	},
+	Equal: func(s1, s2 interface{}) bool {
+		a, b := s1.(etcdState), s2.(etcdState)
+		if len(a.kvs) != len(b.kvs) || len(a.leases) != len(b.leases) {
+			return false
+		}
+		for k, v := range a.kvs {
+			if b.kvs[k] != v {
+				return false
+			}
+		}
+		for id := range a.leases {
+			if !b.leases[id] {
+				return false
+			}
+		}
+		return true
+	},
+	DescribeOperation: func(in, out interface{}) string {
+		return describe(in.(Request), out.(Response))
+	},
+}
+
+func step(s etcdState, req Request, resp Response) (bool, etcdState) {
+	switch req.Op {
+	case OpGet:
+		kv, ok := s.kvs[req.Key]
+		return resp.Found == ok && resp.Value == kv.value, s
+	case OpPut:
+		if req.LeaseID != 0 && !s.leases[req.LeaseID] {
+			// 结果未知的请求也可能因为租约不存在而失败
+			return resp.LeaseNotFound || resp.Unknown, s
+		}
+		if resp.LeaseNotFound {
+			return false, s
+		}
+		n := s.clone()
+		n.kvs[req.Key] = keyValue{value: req.Value, leaseID: req.LeaseID}
+		return true, n
+	case OpDelete:
+		_, ok := s.kvs[req.Key]
+		if !resp.Unknown && (resp.Deleted == 1) != ok {
+			return false, s
+		}
+		if !ok {
+			return true, s
+		}
+		n := s.clone()
+		delete(n.kvs, req.Key)
+		return true, n
+	case OpGrant:
+		n := s.clone()
+		n.leases[req.LeaseID] = true
+		return true, n
+	case OpRevoke:
+		if !s.leases[req.LeaseID] {
+			return resp.LeaseNotFound || resp.Unknown, s
+		}
+		if resp.LeaseNotFound {
+			return false, s
+		}
+		n := s.clone()
+		delete(n.leases, req.LeaseID)
+		for k, kv := range n.kvs {
+			if kv.leaseID == req.LeaseID {
+				delete(n.kvs, k)
+			}
+		}
+		return true, n
+	}
+	return false, s
+}
+
+func describe(req Request, resp Response) string {
+	var res string
+	switch {
+	case resp.Unknown:
+		res = "unknown"
+	case resp.LeaseNotFound:
+		res = "lease not found"
+	case req.Op == OpGet && !resp.Found:
+		res = "not found"
+	case req.Op == OpGet:
+		res = fmt.Sprintf("%q", resp.Value)
+	case req.Op == OpDelete:
+		res = fmt.Sprintf("deleted %d", resp.Deleted)
+	default:
+		res = "ok"
+	}
+	switch req.Op {
+	case OpPut:
+		if req.LeaseID != 0 {
+			return fmt.Sprintf("put(%q, %q, lease %x) -> %s", req.Key, req.Value, req.LeaseID, res)
+		}
+		return fmt.Sprintf("put(%q, %q) -> %s", req.Key, req.Value, res)
+	case OpGrant, OpRevoke:
+		return fmt.Sprintf("%s(%x) -> %s", req.Op, req.LeaseID, res)
+	}
+	return fmt.Sprintf("%s(%q) -> %s", req.Op, req.Key, res)
+}
+
+// partitionByKey 用并查集把通过租约关联的key归为一组
+func partitionByKey(history []Operation) [][]Operation {
+	parent := make(map[string]string)
+	var find func(x string) string
+	find = func(x string) string {
+		p, ok := parent[x]
+		if !ok || p == x {
+			parent[x] = x
+			return x
+		}
+		r := find(p)
+		parent[x] = r
+		return r
+	}
+	nodeOf := func(req Request) string {
+		if req.Key != "" {
+			return "key/" + req.Key
+		}
+		return fmt.Sprintf("lease/%x", req.LeaseID)
+	}
+	for _, op := range history {
+		req := op.Input.(Request)
+		a := find(nodeOf(req))
+		if req.Key != "" && req.LeaseID != 0 {
+			b := find(fmt.Sprintf("lease/%x", req.LeaseID))
+			parent[b] = a
+		}
+	}
+	groups := make(map[string][]Operation)
+	var order []string
+	for _, op := range history {
+		r := find(nodeOf(op.Input.(Request)))
+		if _, ok := groups[r]; !ok {
+			order = append(order, r)
+		}
+		groups[r] = append(groups[r], op)
+	}
+	ps := make([][]Operation, 0, len(order))
+	for _, r := range order {
+		ps = append(ps, groups[r])
+	}
+	return ps
+}
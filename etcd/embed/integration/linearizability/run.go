@@ -0,0 +1,266 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linearizability
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	clientv3 "github.com/ls-2018/etcd_cn/client_sdk/v3"
+	"github.com/ls-2018/etcd_cn/etcd/embed/integration"
+)
+
+// ErrNotLinearizable is returned by Run when the recorded history is not
+// linearizable.
+var ErrNotLinearizable = errors.New("linearizability: history is not linearizable")
+
+// Fault is a failure injected into the cluster while the workload runs.
+type Fault string
+
+const (
+	// FaultPartitionLeader isolates the leader from the other members.
+	FaultPartitionLeader Fault = "partition-leader"
+	// FaultPartitionMember isolates a random member.
+	FaultPartitionMember Fault = "partition-member"
+	// FaultCrashLeader crashes the leader and restarts it.
+	FaultCrashLeader Fault = "crash-leader"
+	// FaultCrashMember crashes a random member and restarts it.
+	FaultCrashMember Fault = "crash-member"
+)
+
+// Config configures Run.
+type Config struct {
+	// Seed seeds the workload and the fault schedule.
+	Seed int64
+	// Clients is the number of concurrent clients, 4 by default. Client i
+	// prefers member i modulo the cluster size.
+	Clients int
+	// Keys is the number of keys the workload writes, 5 by default.
+	Keys int
+	// Duration is how long the workload runs, 5s by default.
+	Duration time.Duration
+	// Faults are injected one at a time in random order, each for
+	// FaultDuration (1s by default) followed by the same time without
+	// faults. No faults are injected when empty.
+	Faults        []Fault
+	FaultDuration time.Duration
+	// RequestTimeout bounds each request, 1s by default.
+	RequestTimeout time.Duration
+	// LeaseTTL is the TTL of granted leases in seconds, 3600 by default. It
+	// must be longer than the test, since the model never expires leases.
+	LeaseTTL int64
+	// CheckTimeout bounds the linearizability check, 1m by default.
+	CheckTimeout time.Duration
+}
+
+// Report is the result of Run.
+type Report struct {
+	Seed       int64
+	Operations int
+	// Unknown is the number of writes with an unknown outcome.
+	Unknown int
+	// Faults lists the injected faults in order.
+	Faults []string
+	Result CheckResult
+	// NonLinearizable is the partition of the history that failed the check.
+	NonLinearizable []Operation
+	History         *History
+}
+
+// String describes the report, listing the operations of the failed
+// partition if there is one.
+func (r *Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "seed %d: %s, %d operations (%d unknown), faults %v", r.Seed, r.Result, r.Operations, r.Unknown, r.Faults)
+	for _, op := range r.NonLinearizable {
+		ret := "-"
+		if op.Return != math.MaxInt64 {
+			ret = time.Duration(op.Return).String()
+		}
+		fmt.Fprintf(&b, "\n  client %d [%v, %s] %s", op.ClientID, time.Duration(op.Call), ret, EtcdModel.DescribeOperation(op.Input, op.Output))
+	}
+	return b.String()
+}
+
+func (cfg *Config) setDefaults() {
+	if cfg.Clients == 0 {
+		cfg.Clients = 4
+	}
+	if cfg.Keys == 0 {
+		cfg.Keys = 5
+	}
+	if cfg.Duration == 0 {
+		cfg.Duration = 5 * time.Second
+	}
+	if cfg.FaultDuration == 0 {
+		cfg.FaultDuration = time.Second
+	}
+	if cfg.RequestTimeout == 0 {
+		cfg.RequestTimeout = time.Second
+	}
+	if cfg.LeaseTTL == 0 {
+		cfg.LeaseTTL = 3600
+	}
+	if cfg.CheckTimeout == 0 {
+		cfg.CheckTimeout = time.Minute
+	}
+}
+
+// Run drives a random key-value and lease workload against the ready
+// cluster c while injecting the configured faults, heals the cluster and
+// checks the recorded history against EtcdModel. It returns
+// ErrNotLinearizable together with the report when the check fails.
+func Run(ctx context.Context, c *integration.Cluster, cfg Config) (*Report, error) {
+	cfg.setDefaults()
+	h := NewHistory()
+	members := c.Members()
+
+	var clis []*clientv3.Client
+	defer func() {
+		for _, cli := range clis {
+			cli.Close()
+		}
+	}()
+	for i := 0; i < cfg.Clients; i++ {
+		// 每个客户端优先连接不同的成员,才能观察到落后成员上的读
+		var eps []string
+		for j := range members {
+			eps = append(eps, members[(i+j)%len(members)].Endpoints()...)
+		}
+		cli, err := clientv3.New(clientv3.Config{Endpoints: eps, DialTimeout: 5 * time.Second})
+		if err != nil {
+			return nil, err
+		}
+		clis = append(clis, cli)
+	}
+
+	wctx, cancel := context.WithTimeout(ctx, cfg.Duration)
+	defer cancel()
+	var wg sync.WaitGroup
+	for i, cli := range clis {
+		wg.Add(1)
+		go func(i int, cli *clientv3.Client) {
+			defer wg.Done()
+			runClient(wctx, h.NewClient(cli), rand.New(rand.NewSource(cfg.Seed+int64(i))), i, cfg)
+		}(i, cli)
+	}
+	r := &Report{Seed: cfg.Seed, History: h}
+	if len(cfg.Faults) > 0 {
+		r.Faults = injectFaults(wctx, c, rand.New(rand.NewSource(cfg.Seed-1)), cfg)
+	}
+	wg.Wait()
+
+	c.Heal()
+	for i, m := range c.Members() {
+		if m.Etcd() == nil {
+			if err := c.Restart(i); err != nil {
+				return r, err
+			}
+		}
+	}
+
+	ops := h.Operations()
+	r.Operations = len(ops)
+	for _, op := range ops {
+		if op.Output.(Response).Unknown {
+			r.Unknown++
+		}
+	}
+	r.Result, r.NonLinearizable = CheckOperations(EtcdModel, ops, cfg.CheckTimeout)
+	if r.Result == Illegal {
+		return r, ErrNotLinearizable
+	}
+	return r, nil
+}
+
+// runClient 顺序发送随机请求直到 ctx 结束;值包含客户端编号和序号,保证唯一
+func runClient(ctx context.Context, c *Client, rnd *rand.Rand, id int, cfg Config) {
+	var leases []clientv3.LeaseID
+	for seq := 0; ctx.Err() == nil; seq++ {
+		rctx, cancel := context.WithTimeout(ctx, cfg.RequestTimeout)
+		key := fmt.Sprintf("key-%d", rnd.Intn(cfg.Keys))
+		value := fmt.Sprintf("%d-%d", id, seq)
+		switch p := rnd.Intn(100); {
+		case p < 40:
+			c.Get(rctx, key)
+		case p < 70:
+			c.Put(rctx, key, value, clientv3.NoLease)
+		case p < 80:
+			c.Delete(rctx, key)
+		case p < 85:
+			if l, err := c.Grant(rctx, cfg.LeaseTTL); err == nil {
+				leases = append(leases, l)
+			}
+		case p < 95:
+			if len(leases) > 0 {
+				c.Put(rctx, key, value, leases[rnd.Intn(len(leases))])
+			}
+		default:
+			if len(leases) > 0 {
+				i := rnd.Intn(len(leases))
+				c.Revoke(rctx, leases[i])
+				leases = append(leases[:i], leases[i+1:]...)
+			}
+		}
+		cancel()
+	}
+}
+
+// injectFaults 依次注入故障,每个故障持续 FaultDuration 后恢复,再等待同样的时间
+func injectFaults(ctx context.Context, c *integration.Cluster, rnd *rand.Rand, cfg Config) []string {
+	var done []string
+	sleep := func() bool {
+		select {
+		case <-time.After(cfg.FaultDuration):
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	for ctx.Err() == nil {
+		f := cfg.Faults[rnd.Intn(len(cfg.Faults))]
+		target := rnd.Intn(len(c.Members()))
+		if f == FaultPartitionLeader || f == FaultCrashLeader {
+			if lead := c.Leader(); lead >= 0 {
+				target = lead
+			}
+		}
+		done = append(done, fmt.Sprintf("%s(%d)", f, target))
+		switch f {
+		case FaultPartitionLeader, FaultPartitionMember:
+			c.Partition([]int{target})
+			sleep()
+			c.Heal()
+		case FaultCrashLeader, FaultCrashMember:
+			if err := c.Crash(target); err != nil {
+				continue
+			}
+			sleep()
+			if err := c.Restart(target); err != nil {
+				done = append(done, fmt.Sprintf("restart(%d) failed: %v", target, err))
+			}
+		}
+		if !sleep() {
+			break
+		}
+	}
+	return done
+}
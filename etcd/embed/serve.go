@@ -61,6 +61,7 @@ type serveCtx struct {
 
 	userHandlers    map[string]http.Handler
 	serviceRegister func(*grpc.Server) // 预置的服务注册函数扩展
+	interceptors    v3rpc.Interceptors // 注入的gRPC拦截器
 	serversC        chan *servers
 }
 
@@ -107,7 +108,7 @@ func (sctx *serveCtx) serve(s *etcdserver.EtcdServer, tlsinfo *transport.TLSInfo
 	}()
 	// 不安全
 	if sctx.insecure {
-		gs = v3rpc.Server(s, nil, nil, gopts...) // 注册服务、链接参数
+		gs = v3rpc.Server(s, nil, sctx.interceptors, gopts...) // 注册服务、链接参数
 		v3electionpb.RegisterElectionServer(gs, servElection)
 		v3lockpb.RegisterLockServer(gs, servLock)
 		if sctx.serviceRegister != nil {
@@ -144,7 +145,7 @@ func (sctx *serveCtx) serve(s *etcdserver.EtcdServer, tlsinfo *transport.TLSInfo
 		if tlsErr != nil {
 			return tlsErr
 		}
-		gs = v3rpc.Server(s, tlscfg, nil, gopts...)
+		gs = v3rpc.Server(s, tlscfg, sctx.interceptors, gopts...)
 		v3electionpb.RegisterElectionServer(gs, servElection)
 		v3lockpb.RegisterLockServer(gs, servLock)
 		if sctx.serviceRegister != nil {
@@ -17,9 +17,10 @@
 package etcdmain
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"log"
 	"os"
 	"runtime"
@@ -28,11 +29,12 @@ import (
 	cconfig "github.com/ls-2018/etcd_cn/etcd/config"
 	"github.com/ls-2018/etcd_cn/etcd/embed"
 	"github.com/ls-2018/etcd_cn/etcd/etcdserver/api/rafthttp"
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver/api/v3replication"
 	"github.com/ls-2018/etcd_cn/offical/api/v3/version"
 	"github.com/ls-2018/etcd_cn/pkg/flags"
+	"github.com/ls-2018/etcd_cn/pkg/notify"
 
 	"go.uber.org/zap"
-	"sigs.k8s.io/yaml"
 )
 
 var (
@@ -82,6 +84,7 @@ type configFlags struct {
 	fallback      *flags.SelectiveStringValue
 	proxy         *flags.SelectiveStringValue
 	v2deprecation *flags.SelectiveStringsValue
+	replicaOf     string // 副本集群的上游集群,格式同 --experimental-replications
 }
 
 // config 保存etcd命令行调用的配置
@@ -91,6 +94,8 @@ type config struct {
 	cf           configFlags // 是否有一组标志用于命令行解析配置
 	configFile   string      // 从文件加载服务器配置.
 	printVersion bool        // 打印版本并退出
+	validateOnly bool        // 只校验配置并退出
+	printConfig  bool        // 打印生效的配置并退出
 	ignored      []string
 }
 
@@ -142,6 +147,8 @@ func newConfig() *config {
 	fs.Var(flags.NewUniqueURLsWithExceptions(embed.DefaultListenPeerURLs, ""), "listen-peer-urls", "和成员之间通信的地址.用于监听其他etcd member的url")
 	fs.Var(flags.NewUniqueURLsWithExceptions(embed.DefaultListenClientURLs, ""), "listen-client-urls", "对外提供服务的地址")
 	fs.Var(flags.NewUniqueURLsWithExceptions("", ""), "listen-metrics-urls", "要监听指标和运行状况端点的url列表.")
+	fs.Var(flags.NewUniqueURLsWithExceptions("", ""), "listen-maintenance-urls", "只提供 Maintenance 服务(快照、碎片整理、hashkv等)的url列表,与客户端端口分开.")
+	fs.IntVar(&cfg.ec.MaxConcurrentMaintenanceRequests, "max-concurrent-maintenance-requests", 0, "--listen-maintenance-urls 上同时处理的请求数上限,超过时直接拒绝;0表示不限制.")
 	fs.UintVar(&cfg.ec.MaxSnapFiles, "max-snapshots", cfg.ec.MaxSnapFiles, "要保留的最大快照文件数(0表示不受限制).5")
 	fs.UintVar(&cfg.ec.MaxWalFiles, "max-wals", cfg.ec.MaxWalFiles, "要保留的最大wal文件数(0表示不受限制). 5")
 	fs.StringVar(&cfg.ec.Name, "name", cfg.ec.Name, "本节点.人类可读的名字")
@@ -159,6 +166,10 @@ func newConfig() *config {
 	fs.DurationVar(&cfg.ec.GRPCKeepAliveMinTime, "grpc-keepalive-min-time", cfg.ec.GRPCKeepAliveMinTime, "客户端在ping服务器之前应等待的最短持续时间间隔.")
 	fs.DurationVar(&cfg.ec.GRPCKeepAliveInterval, "grpc-keepalive-interval", cfg.ec.GRPCKeepAliveInterval, "服务器到客户端ping的频率持续时间.以检查连接是否处于活动状态(0表示禁用).")
 	fs.DurationVar(&cfg.ec.GRPCKeepAliveTimeout, "grpc-keepalive-timeout", cfg.ec.GRPCKeepAliveTimeout, "关闭非响应连接之前的额外持续等待时间(0表示禁用).20s")
+	fs.BoolVar(&cfg.ec.GRPCKeepAlivePermitWithoutStream, "grpc-keepalive-permit-without-stream", false, "允许客户端在没有活跃流时发送keepalive ping.")
+	fs.DurationVar(&cfg.ec.GRPCMaxConnectionIdle, "grpc-max-connection-idle", 0, "连接没有活跃流超过该时间后关闭(0表示不关闭).")
+	fs.UintVar(&cfg.ec.MaxConcurrentStreams, "max-concurrent-streams", 0, "每个客户端连接上最多同时存在的gRPC流(0表示不限制).")
+	fs.IntVar(&cfg.ec.MaxConnectionsPerClientIP, "max-connections-per-client-ip", 0, "每个客户端IP最多同时打开的连接数,超出的连接直接关闭(0表示不限制).")
 	fs.BoolVar(&cfg.ec.SocketOpts.ReusePort, "socket-reuse-port", cfg.ec.SocketOpts.ReusePort, "启用在listener上设置套接字选项SO_REUSEPORT.允许重新绑定一个已经在使用的端口.false")
 	fs.BoolVar(&cfg.ec.SocketOpts.ReuseAddress, "socket-reuse-address", cfg.ec.SocketOpts.ReuseAddress, "启用在listener上设置套接字选项SO_REUSEADDR 允许重新绑定一个已经在使用的端口 在`TIME_WAIT` 状态.")
 
@@ -176,6 +187,8 @@ func newConfig() *config {
 	fs.StringVar(&cfg.ec.Dproxy, "discovery-proxy", cfg.ec.Dproxy, "用于流量到发现服务的HTTP代理.")
 	fs.StringVar(&cfg.ec.DNSCluster, "discovery-srv", cfg.ec.DNSCluster, "DNS srv域用于引导群集.")
 	fs.StringVar(&cfg.ec.DNSClusterServiceName, "discovery-srv-name", cfg.ec.DNSClusterServiceName, "使用DNS引导时查询的DNS srv名称的后缀.")
+	fs.StringVar(&cfg.ec.DiscoveryProvider, "discovery-provider", cfg.ec.DiscoveryProvider, "用于引导群集的发现提供者: dns-srv, ec2, gce, kubernetes, file.")
+	fs.StringVar(&cfg.ec.DiscoveryParams, "discovery-params", cfg.ec.DiscoveryParams, "发现提供者参数, 格式为 'key1=value1;key2=value2'.")
 	fs.StringVar(&cfg.ec.InitialCluster, "initial-cluster", cfg.ec.InitialCluster, "用于引导初始集群配置,集群中所有节点的信息..")
 	fs.StringVar(&cfg.ec.InitialClusterToken, "initial-cluster-token", cfg.ec.InitialClusterToken, "创建集群的 token.这个值每个集群保持唯一.")
 	fs.Var(cfg.cf.clusterState, "initial-cluster-state", "初始集群状态 ('new' or 'existing').")
@@ -202,8 +215,12 @@ func newConfig() *config {
 	fs.StringVar(&cfg.ec.ClientTLSInfo.ClientCertFile, "client-cert-file", "", "验证client客户端时使用的 证书文件路径,否则在需要客户认证时将使用cert-file文件")
 	fs.StringVar(&cfg.ec.ClientTLSInfo.ClientKeyFile, "client-key-file", "", "验证client客户端时使用的 密钥文件路径,否则在需要客户认证时将使用key-file文件.")
 	fs.BoolVar(&cfg.ec.ClientTLSInfo.ClientCertAuth, "client-cert-auth", false, "启用客户端证书验证;默认false")
-	fs.StringVar(&cfg.ec.ClientTLSInfo.CRLFile, "client-crl-file", "", "客户端证书吊销列表文件的路径.")
+	fs.StringVar(&cfg.ec.ClientTLSInfo.CRLFile, "client-crl-file", "", "客户端证书吊销列表文件的路径,文件变化后自动重新加载.")
+	fs.StringVar(&cfg.ec.ClientTLSInfo.OCSPCheck, "client-ocsp-check", "", "通过OCSP检查客户端证书是否吊销: 'soft'(OCSP不可用时放行)或'hard'(OCSP不可用时拒绝),为空不检查.")
+	fs.BoolVar(&cfg.ec.ClientTLSInfo.OCSPStaple, "client-ocsp-staple", false, "在TLS握手中附带定期刷新的服务端证书OCSP响应.")
 	fs.StringVar(&cfg.ec.ClientTLSInfo.AllowedHostname, "client-cert-allowed-hostname", "", "允许客户端证书认证使用TLS主机名.")
+	fs.Var(flags.NewStringsValue(""), "client-cert-allowed-spiffe-id", "逗号分隔的允许的客户端证书SPIFFE ID模式,例如 spiffe://example.org/ns/*/sa/api")
+	fs.Var(flags.NewStringsValue(""), "client-cert-allowed-cns", "逗号分隔的允许的客户端证书CommonName,可以通过配置文件热加载.")
 	fs.StringVar(&cfg.ec.ClientTLSInfo.TrustedCAFile, "trusted-ca-file", "", "客户端etcd通信 的可信CA证书文件")
 	fs.BoolVar(&cfg.ec.ClientAutoTLS, "auto-tls", false, "客户端TLS使用自动生成的证书")
 	// etcd通信之间的证书配置
@@ -217,9 +234,12 @@ func newConfig() *config {
 	fs.StringVar(&cfg.ec.PeerTLSInfo.TrustedCAFile, "peer-trusted-ca-file", "", "服务器端ca证书")
 	fs.BoolVar(&cfg.ec.PeerAutoTLS, "peer-auto-tls", false, "节点之间使用生成的证书通信;默认false")
 	fs.UintVar(&cfg.ec.SelfSignedCertValidity, "self-signed-cert-validity", 1, "客户端证书和同级证书的有效期,单位为年 ;etcd自动生成的 如果指定了ClientAutoTLS and PeerAutoTLS,")
-	fs.StringVar(&cfg.ec.PeerTLSInfo.CRLFile, "peer-crl-file", "", "服务端证书吊销列表文件的路径.")
+	fs.StringVar(&cfg.ec.PeerTLSInfo.CRLFile, "peer-crl-file", "", "服务端证书吊销列表文件的路径,文件变化后自动重新加载.")
+	fs.StringVar(&cfg.ec.PeerTLSInfo.OCSPCheck, "peer-ocsp-check", "", "通过OCSP检查server客户端证书是否吊销: 'soft'或'hard',为空不检查.")
+	fs.BoolVar(&cfg.ec.PeerTLSInfo.OCSPStaple, "peer-ocsp-staple", false, "在节点之间的TLS握手中附带定期刷新的证书OCSP响应.")
 	fs.StringVar(&cfg.ec.PeerTLSInfo.AllowedCN, "peer-cert-allowed-cn", "", "允许的server客户端证书CommonName")
 	fs.StringVar(&cfg.ec.PeerTLSInfo.AllowedHostname, "peer-cert-allowed-hostname", "", "允许的server客户端证书hostname")
+	fs.Var(flags.NewStringsValue(""), "peer-cert-allowed-spiffe-id", "逗号分隔的允许的server客户端证书SPIFFE ID模式,例如 spiffe://example.org/etcd/*")
 	fs.Var(flags.NewStringsValue(""), "cipher-suites", "客户端/etcds之间支持的TLS加密套件的逗号分隔列表(空将由Go自动填充).")
 	fs.BoolVar(&cfg.ec.PeerTLSInfo.SkipClientSANVerify, "experimental-peer-skip-client-san-verification", false, "跳过server 客户端证书中SAN字段的验证.默认false")
 
@@ -232,9 +252,13 @@ func newConfig() *config {
 	fs.StringVar(&cfg.ec.LogLevel, "log-level", logutil.DefaultLogLevel, "日志等级,只支持 debug, info, warn, error, panic, or fatal. Default 'info'.")
 	fs.BoolVar(&cfg.ec.EnableLogRotation, "enable-log-rotation", false, "启用单个日志输出文件目标的日志旋转.")
 	fs.StringVar(&cfg.ec.LogRotationConfigJSON, "log-rotation-config-json", embed.DefaultLogRotationConfig, "是用于日志轮换的默认配置. 默认情况下,日志轮换是禁用的.")
+	fs.IntVar(&cfg.ec.LogSamplingInitial, "log-sampling-initial", embed.DefaultLogSamplingInitial, "每秒内同一条日志前多少条全部输出,用于压制高频告警;0 表示关闭采样.")
+	fs.IntVar(&cfg.ec.LogSamplingThereafter, "log-sampling-thereafter", embed.DefaultLogSamplingThereafter, "每秒内超过 --log-sampling-initial 之后每多少条同样的日志输出一条.")
 
 	// 版本
 	fs.BoolVar(&cfg.printVersion, "version", false, "打印版本并退出.")
+	fs.BoolVar(&cfg.validateOnly, "validate-config", false, "校验配置并退出.")
+	fs.BoolVar(&cfg.printConfig, "print-effective-config", false, "打印合并了命令行、配置文件和环境变量之后生效的配置并退出.")
 	//--auto-compaction-mode=revision --auto-compaction-retention=1000 每5分钟自动压缩"latest revision" - 1000;
 	//--auto-compaction-mode=periodic --auto-compaction-retention=12h 每1小时自动压缩并保留12小时窗口.
 	fs.StringVar(&cfg.ec.AutoCompactionRetention, "auto-compaction-retention", "0", "在一个小时内为mvcc键值存储的自动压缩.0表示禁用自动压缩.")
@@ -242,6 +266,8 @@ func newConfig() *config {
 
 	// 性能分析器 通过 HTTP
 	fs.BoolVar(&cfg.ec.EnablePprof, "enable-pprof", false, `通过HTTP服务器启用运行时分析数据.地址位于客户端URL +/debug/pprof/`)
+	fs.BoolVar(&cfg.ec.EnableDashboard, "enable-dashboard", false, "在 --listen-dashboard-urls 上提供只读的 web 管理页面.")
+	fs.Var(flags.NewUniqueURLsWithExceptions(embed.DefaultListenDashboardURLs, ""), "listen-dashboard-urls", "web 管理页面监听的url列表.")
 
 	// additional metrics
 	fs.StringVar(&cfg.ec.Metrics, "metrics", cfg.ec.Metrics, `设置导出的指标的详细程度,指定"扩展"以包括直方图指标(extensive,basic)`)
@@ -256,6 +282,21 @@ func newConfig() *config {
 	fs.StringVar(&cfg.ec.AuthToken, "auth-token", cfg.ec.AuthToken, "指定验证令牌的具体选项. ('simple' or 'jwt')")
 	fs.UintVar(&cfg.ec.BcryptCost, "bcrypt-cost", cfg.ec.BcryptCost, "为散列身份验证密码指定bcrypt算法的成本/强度.有效值介于4和31之间.")
 	fs.UintVar(&cfg.ec.AuthTokenTTL, "auth-token-ttl", cfg.ec.AuthTokenTTL, "token过期时间")
+	fs.StringVar(&cfg.ec.AuthSPIFFEUserMapping, "auth-spiffe-user-mapping", cfg.ec.AuthSPIFFEUserMapping, "客户端证书为X509-SVID时从SPIFFE ID映射用户名的方式('id' or 'path'),为空时使用CommonName.")
+	fs.StringVar(&cfg.ec.AuthWebhookURL, "auth-webhook-url", cfg.ec.AuthWebhookURL, "本地不存在的用户交由该webhook认证,webhook返回etcd用户名和角色.")
+	fs.StringVar(&cfg.ec.AuthWebhookCAFile, "auth-webhook-ca-file", cfg.ec.AuthWebhookCAFile, "校验auth webhook服务端证书的CA文件.")
+	fs.DurationVar(&cfg.ec.AuthWebhookTimeout, "auth-webhook-timeout", cfg.ec.AuthWebhookTimeout, "auth webhook请求超时时间.")
+	fs.DurationVar(&cfg.ec.AuthWebhookCacheTTL, "auth-webhook-cache-ttl", cfg.ec.AuthWebhookCacheTTL, "auth webhook认证成功的结果缓存时间.")
+	fs.StringVar(&cfg.ec.AuthWebhookFailurePolicy, "auth-webhook-failure-policy", cfg.ec.AuthWebhookFailurePolicy, "auth webhook不可用时的策略('deny' or 'cache').")
+	fs.IntVar(&cfg.ec.AuthPasswordMinLength, "auth-password-min-length", cfg.ec.AuthPasswordMinLength, "密码最小长度,0表示不限制.")
+	fs.IntVar(&cfg.ec.AuthPasswordMinClasses, "auth-password-min-classes", cfg.ec.AuthPasswordMinClasses, "密码至少包含几类字符(小写字母、大写字母、数字、其他字符),0-4.")
+	fs.DurationVar(&cfg.ec.AuthPasswordMaxAge, "auth-password-max-age", cfg.ec.AuthPasswordMaxAge, "密码有效期,过期后需要管理员重置密码,0表示不过期.")
+	fs.IntVar(&cfg.ec.AuthLockoutThreshold, "auth-lockout-threshold", cfg.ec.AuthLockoutThreshold, "连续登录失败多少次后临时锁定账户,0表示不锁定.")
+	fs.DurationVar(&cfg.ec.AuthLockoutDuration, "auth-lockout-duration", cfg.ec.AuthLockoutDuration, "账户锁定时长;超过该时长没有失败的登录,失败计数清零.")
+	fs.DurationVar(&cfg.ec.AuthRefreshTokenTTL, "auth-refresh-token-ttl", cfg.ec.AuthRefreshTokenTTL, "认证成功时签发的refresh token有效期,0表示不签发.")
+	fs.StringVar(&cfg.ec.AuthTokenTTLOverrides, "auth-token-ttl-overrides", cfg.ec.AuthTokenTTLOverrides, "按用户或角色设置token有效期,例如 'user:alice=1h,role:ci=10m'.")
+	fs.Float64Var(&cfg.ec.AuthAuditSampleRate, "auth-audit-sample-rate", cfg.ec.AuthAuditSampleRate, "权限检查失败的记录比例(0-1),0表示不记录.")
+	fs.IntVar(&cfg.ec.AuthAuditMaxEntries, "auth-audit-max-entries", cfg.ec.AuthAuditMaxEntries, "本节点最多保留的权限检查失败记录数,超过时删除最早的.")
 
 	// gateway
 	fs.BoolVar(&cfg.ec.EnableGRPCGateway, "enable-grpc-gateway", cfg.ec.EnableGRPCGateway, "Enable GRPC gateway.")
@@ -267,9 +308,56 @@ func newConfig() *config {
 	fs.BoolVar(&cfg.ec.ExperimentalEnableLeaseCheckpoint, "experimental-enable-lease-checkpoint", true, "允许leader定期向其他成员发送检查点,以防止leader变化时剩余TTL重置")
 	// TODO: delete in v3.7
 	fs.BoolVar(&cfg.ec.ExperimentalEnableLeaseCheckpointPersist, "experimental-enable-lease-checkpoint-persist", true, "启用持续的剩余TTL,以防止长期租赁的无限期自动续约.在v3.6中始终启用.应使用该功能以确保从启用该功能的v3.5集群顺利升级.需要启用experimental-enable-lease-checkpoint.")
+	fs.DurationVar(&cfg.ec.ExperimentalLeaseCheckpointInterval, "experimental-lease-checkpoint-interval", cfg.ec.ExperimentalLeaseCheckpointInterval, "单个租约检查点的时间间隔,只对剩余时间大于该值的租约调度.")
+	fs.DurationVar(&cfg.ec.ExperimentalLeaseConsolidatedCheckpointInterval, "experimental-lease-consolidated-checkpoint-interval", cfg.ec.ExperimentalLeaseConsolidatedCheckpointInterval, "定期把所有租约(包括短租约)的剩余时间汇总成检查点的间隔,避免leader变更后租约被重置为完整的TTL;0表示关闭.")
+	fs.IntVar(&cfg.ec.ExperimentalLeaseRevokeRate, "experimental-lease-revoke-rate", cfg.ec.ExperimentalLeaseRevokeRate, "每秒最多撤销的过期租约数,按最早过期的顺序分批撤销,每批放在一个raft请求中依次撤销,避免大量租约同时过期时的删除风暴.")
+	fs.Float64Var(&cfg.ec.ExperimentalLeaseTTLJitter, "experimental-lease-ttl-jitter", cfg.ec.ExperimentalLeaseTTLJitter, "创建租约时TTL最多随机增加的比例(0-1),让相同TTL的租约分散到期;0表示不加抖动.")
 	fs.IntVar(&cfg.ec.ExperimentalCompactionBatchLimit, "experimental-compaction-batch-limit", cfg.ec.ExperimentalCompactionBatchLimit, "Sets the maximum revisions deleted in each compaction batch.")
 	fs.DurationVar(&cfg.ec.ExperimentalWatchProgressNotifyInterval, "experimental-watch-progress-notify-interval", cfg.ec.ExperimentalWatchProgressNotifyInterval, "Duration of periodic watch progress notifications.")
 	fs.DurationVar(&cfg.ec.ExperimentalDowngradeCheckTime, "experimental-downgrade-check-time", cfg.ec.ExperimentalDowngradeCheckTime, "两次降级状态检查之间的时间间隔.")
+	fs.DurationVar(&cfg.ec.ExperimentalMemberUnreachableThreshold, "experimental-member-unreachable-threshold", cfg.ec.ExperimentalMemberUnreachableThreshold, "成员持续不可达超过该时长后触发UNREACHABLE警报,0表示不检测.")
+	fs.StringVar(&cfg.ec.ExperimentalMemberUnreachableWebhookURL, "experimental-member-unreachable-webhook-url", "", "成员不可达、恢复或被替换时,leader向该地址POST一个JSON事件.")
+	fs.BoolVar(&cfg.ec.ExperimentalMemberAutoReplace, "experimental-member-auto-replace", false, "当带有replaces=<成员名称或ID>标签的learner追上leader后,自动移除不可达成员并提升该learner.")
+	fs.DurationVar(&cfg.ec.ExperimentalLearnerAutoPromoteAfter, "experimental-learner-auto-promote-after", 0, "learner落后leader不超过--experimental-learner-auto-promote-max-lag条日志持续该时长后,leader自动提升它,0表示不自动提升.")
+	fs.Uint64Var(&cfg.ec.ExperimentalLearnerAutoPromoteMaxLag, "experimental-learner-auto-promote-max-lag", cfg.ec.ExperimentalLearnerAutoPromoteMaxLag, "自动提升时learner最多落后leader的日志条数.")
+	fs.DurationVar(&cfg.ec.ExperimentalRequestDeadlineAllowance, "experimental-request-deadline-allowance", cfg.ec.ExperimentalRequestDeadlineAllowance, "从客户端deadline中预留给网络往返的时间,写请求等待raft超过剩余预算时提前失败.")
+	fs.BoolVar(&cfg.ec.ExperimentalAdmissionControl, "experimental-admission-control", false, "成员过载时先拒绝批量请求,再拒绝普通请求,并返回建议的重试间隔.")
+	fs.DurationVar(&cfg.ec.ExperimentalAdmissionFsyncLatency, "experimental-admission-fsync-latency", cfg.ec.ExperimentalAdmissionFsyncLatency, "准入控制的WAL fsync平均耗时阈值,0表示不参考该指标.")
+	fs.Uint64Var(&cfg.ec.ExperimentalAdmissionApplyBacklog, "experimental-admission-apply-backlog", cfg.ec.ExperimentalAdmissionApplyBacklog, "准入控制的已提交未apply条目数阈值,0表示不参考该指标.")
+	fs.IntVar(&cfg.ec.ExperimentalAdmissionPendingProposals, "experimental-admission-pending-proposals", cfg.ec.ExperimentalAdmissionPendingProposals, "准入控制的未完成提案数阈值,0表示不参考该指标.")
+	fs.StringVar(&cfg.ec.ExperimentalCrashReportDir, "experimental-crash-report-dir", "", "致命错误时写入崩溃报告的目录,为空时使用<data-dir>/crash.")
+	fs.StringVar(&cfg.ec.ExperimentalCrashReportWebhookURL, "experimental-crash-report-webhook-url", "", "致命错误时把崩溃报告以JSON格式POST到该地址.")
+	fs.DurationVar(&cfg.ec.BackupInterval, "backup-interval", 0, "内置备份的间隔,由leader或--backup-member指定的成员从本地后端生成快照;0表示不备份.")
+	fs.StringVar(&cfg.ec.BackupDir, "backup-dir", "", "备份文件的目录,为空时使用<data-dir>/backup.")
+	fs.IntVar(&cfg.ec.BackupRetention, "backup-retention", 0, "本地保留的备份文件个数,0表示全部保留.")
+	fs.StringVar(&cfg.ec.BackupMember, "backup-member", "", "负责备份的成员名称,为空时由leader备份.")
+	fs.StringVar(&cfg.ec.BackupTargetURL, "backup-target-url", "", "备份校验通过后把文件PUT到<url>/<文件名>,例如对象存储的桶地址;为空表示只保存在本地.")
+	fs.IntVar(&cfg.ec.ExperimentalCompactionHoldMaxCount, "experimental-compaction-hold-max-count", cfg.ec.ExperimentalCompactionHoldMaxCount, "压缩保留的最大个数,0表示不限制.")
+	fs.DurationVar(&cfg.ec.ExperimentalCompactionHoldMaxTTL, "experimental-compaction-hold-max-ttl", cfg.ec.ExperimentalCompactionHoldMaxTTL, "单个压缩保留的最长有效期,0表示不限制.")
+	fs.Int64Var(&cfg.ec.ExperimentalCompactionHoldMaxRevisions, "experimental-compaction-hold-max-revisions", 0, "压缩保留最多可以落后当前修订版本多少,超过后不再阻止自动压缩;0表示不限制.")
+	fs.IntVar(&cfg.ec.ExperimentalStagedTxnMaxOps, "experimental-staged-txn-max-ops", cfg.ec.ExperimentalStagedTxnMaxOps, "一个暂存事务最多包含的操作数.")
+	fs.Int64Var(&cfg.ec.ExperimentalStagedTxnMaxBytes, "experimental-staged-txn-max-bytes", cfg.ec.ExperimentalStagedTxnMaxBytes, "一个暂存事务的操作编码后的最大字节数,提交时这些操作在一个raft日志中应用.")
+	fs.IntVar(&cfg.ec.ExperimentalWatchMaxPerConnection, "experimental-watch-max-per-connection", 0, "每个gRPC连接最多的活跃watch数,0表示不限制.")
+	fs.IntVar(&cfg.ec.ExperimentalWatchMaxPerUser, "experimental-watch-max-per-user", 0, "每个用户在本成员上最多的活跃watch数,0表示不限制.")
+	fs.StringVar(&cfg.ec.ExperimentalWatchLimitOverrides, "experimental-watch-limit-overrides", "", "按用户设置watch数限制,例如 'user:alice=1000,user:ctrl=0',0表示不限制.")
+	fs.StringVar(&cfg.ec.ExperimentalAdmissionPlugins, "experimental-admission-plugins", "", "为key前缀加载的校验插件(Go插件),例如 '/schemas/=/etc/etcd/schema.so',写请求提议到raft之前交给插件检查.")
+	fs.BoolVar(&cfg.ec.ExperimentalFailpoints, "experimental-failpoints", false, "开启故障注入接口(Maintenance.Failpoint),只用于测试.")
+	fs.BoolVar(&cfg.ec.ExperimentalAsyncStorageWrites, "experimental-async-storage-writes", false, "异步写WAL,raft在落盘的同时继续处理下一个Ready,在慢盘上降低提交延迟.")
+	fs.DurationVar(&cfg.ec.ExperimentalReadIndexBatchWindow, "experimental-read-index-batch-window", 0, "收到线性读后等待多久再发送ReadIndex,合并更多的读;0表示不等待.")
+	fs.BoolVar(&cfg.ec.ExperimentalReadIndexAdaptiveBatching, "experimental-read-index-adaptive-batching", false, "按读请求到达速率决定是否等待 --experimental-read-index-batch-window,低负载时不等待.")
+	fs.Int64Var(&cfg.ec.ExperimentalReadCacheBytes, "experimental-read-cache-bytes", 0, "在内存中缓存解码后的键值对的大小上限(字节),用于频繁读取的key;0表示不缓存.")
+	fs.IntVar(&cfg.ec.ExperimentalRestoreWorkers, "experimental-restore-workers", 0, "启动或应用快照时并发重建索引、恢复租约的协程数;0表示使用 GOMAXPROCS.")
+	fs.StringVar(&cfg.ec.ExperimentalPeerTransport, "experimental-peer-transport", cfg.ec.ExperimentalPeerTransport, "成员之间raft消息流使用的传输:'http' 或 'grpc';对端不支持gRPC时回退到HTTP,可以逐个成员切换.")
+	fs.StringVar(&cfg.ec.ExperimentalPeerCompression, "experimental-peer-compression", "", "请求对端压缩发给本成员的消息流:'gzip'、'snappy' 或 'zstd' 作用于所有成员,或按peer URL配置,例如 '*=none,https://10.0.1.10:2380=zstd'.")
+	fs.DurationVar(&cfg.ec.ExperimentalPeerBatchInterval, "experimental-peer-batch-interval", 0, "发送MsgApp时最多等待多久合并写出,必须小于心跳间隔;0表示不等待.")
+	fs.IntVar(&cfg.ec.ExperimentalPeerBatchBytes, "experimental-peer-batch-bytes", 0, "合并的字节数达到这个值时立即写出;0表示只按 --experimental-peer-batch-interval.")
+	fs.DurationVar(&cfg.ec.ExperimentalClockSkewThreshold, "experimental-clock-skew-threshold", cfg.ec.ExperimentalClockSkewThreshold, "通过peer链路测得本成员与任一对端的时钟偏差超过该值时触发CLOCK_SKEW警报,0表示不发出警报.")
+	fs.Var(flags.NewStringsValue(""), "experimental-user-quotas", "逗号分隔的用户写入预算,每个预算是分号分隔的key=value,例如 user=alice;bytes=1073741824;rate=1048576;user=* 用于没有单独配置的用户")
+	fs.Var(flags.NewStringsValue(""), "experimental-notify-sinks", "逗号分隔的通知sink,每个sink是分号分隔的key=value,例如 name=orders;type=webhook;url=http://hook/etcd;prefix=/orders/")
+	fs.Var(flags.NewStringsValue(""), "experimental-replications", "逗号分隔的跨集群复制,每个复制是分号分隔的key=value,endpoints用|分隔,例如 name=dr;endpoints=https://dr-1:2379|https://dr-2:2379;prefix=/app/;conflict=source-wins")
+	fs.StringVar(&cfg.cf.replicaOf, "experimental-replica-of", "", "以只读副本集群启动,leader持续复制上游集群的变更并拒绝客户端的写请求,直到被提升;格式同一个复制,例如 endpoints=https://primary-1:2379|https://primary-2:2379;prefix=/app/")
+	fs.BoolVar(&cfg.ec.ExperimentalManualClusterVersionPromotion, "experimental-manual-cluster-version-promotion", false, "所有成员升级后不自动提升集群版本,需要通过etcdctl cluster upgrade --promote提升.")
+	fs.StringVar(&cfg.ec.ExperimentalTopologyLabel, "experimental-topology-label", cfg.ec.ExperimentalTopologyLabel, "表示故障域(如可用区、机架)的成员标签,单个故障域失效就会丢失quorum时发出TOPOLOGY警报;空表示不检测.")
 	fs.DurationVar(&cfg.ec.ExperimentalWarningApplyDuration, "experimental-warning-apply-duration", cfg.ec.ExperimentalWarningApplyDuration, "时间长度.如果应用请求的时间超过这个值.就会产生一个警告.")
 	fs.BoolVar(&cfg.ec.ExperimentalMemoryMlock, "experimental-memory-mlock", cfg.ec.ExperimentalMemoryMlock, "启用强制执行etcd页面(特别是bbolt)留在RAM中.")
 	fs.BoolVar(&cfg.ec.ExperimentalTxnModeWriteWithSharedBuffer, "experimental-txn-mode-write-with-shared-buffer", true, "启用写事务在其只读检查操作中使用共享缓冲区.")
@@ -324,6 +412,18 @@ func (cfg *config) parse(arguments []string) error {
 	} else {
 		err = cfg.configFromCmdLine()
 	}
+	if cfg.validateOnly || cfg.printConfig {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "配置无效: %v\n", err)
+			os.Exit(1)
+		}
+		if cfg.printConfig {
+			printEffectiveConfig(os.Stdout, &cfg.ec, cfg.defaultEffectiveConfig())
+		} else {
+			fmt.Println("配置有效")
+		}
+		os.Exit(0)
+	}
 	if runtime.GOOS == "windows" {
 		fmt.Println(os.RemoveAll(fmt.Sprintf("E:\\etcd_cn\\%s.etcd", cfg.ec.Name)))
 	} else {
@@ -343,7 +443,11 @@ func (cfg *config) configFromCmdLine() error {
 	if err != nil {
 		return err
 	}
+	return cfg.configFromFlags(lg)
+}
 
+// configFromFlags 根据已经解析的命令行标志生成配置
+func (cfg *config) configFromFlags(lg *zap.Logger) error {
 	if rafthttp.ConnReadTimeout < rafthttp.DefaultConnReadTimeout {
 		rafthttp.ConnReadTimeout = rafthttp.DefaultConnReadTimeout
 		lg.Info(fmt.Sprintf("raft-read-timeout : %v", rafthttp.DefaultConnReadTimeout))
@@ -358,14 +462,48 @@ func (cfg *config) configFromCmdLine() error {
 	cfg.ec.LCUrls = flags.UniqueURLsFromFlag(cfg.cf.flagSet, "listen-client-urls")
 	cfg.ec.ACUrls = flags.UniqueURLsFromFlag(cfg.cf.flagSet, "advertise-client-urls")
 	cfg.ec.ListenMetricsUrls = flags.UniqueURLsFromFlag(cfg.cf.flagSet, "listen-metrics-urls")
+	cfg.ec.ListenDashboardUrls = flags.UniqueURLsFromFlag(cfg.cf.flagSet, "listen-dashboard-urls")
+	cfg.ec.ListenMaintenanceUrls = flags.UniqueURLsFromFlag(cfg.cf.flagSet, "listen-maintenance-urls")
 
 	cfg.ec.CORS = flags.UniqueURLsMapFromFlag(cfg.cf.flagSet, "cors")
 	cfg.ec.HostWhitelist = flags.UniqueStringsMapFromFlag(cfg.cf.flagSet, "host-whitelist")
 
 	cfg.ec.CipherSuites = flags.StringsFromFlag(cfg.cf.flagSet, "cipher-suites")
+	cfg.ec.ClientTLSInfo.AllowedSPIFFEIDs = flags.StringsFromFlag(cfg.cf.flagSet, "client-cert-allowed-spiffe-id")
+	cfg.ec.ClientCertAllowedCNs = flags.StringsFromFlag(cfg.cf.flagSet, "client-cert-allowed-cns")
+	cfg.ec.PeerTLSInfo.AllowedSPIFFEIDs = flags.StringsFromFlag(cfg.cf.flagSet, "peer-cert-allowed-spiffe-id")
 
 	cfg.ec.LogOutputs = flags.UniqueStringsFromFlag(cfg.cf.flagSet, "log-outputs")
 
+	for _, spec := range flags.StringsFromFlag(cfg.cf.flagSet, "experimental-notify-sinks") {
+		sc, err := notify.ParseSinkConfig(spec)
+		if err != nil {
+			return err
+		}
+		cfg.ec.ExperimentalNotifySinks = append(cfg.ec.ExperimentalNotifySinks, sc)
+	}
+	for _, spec := range flags.StringsFromFlag(cfg.cf.flagSet, "experimental-replications") {
+		rc, err := v3replication.ParseConfig(spec)
+		if err != nil {
+			return err
+		}
+		cfg.ec.ExperimentalReplications = append(cfg.ec.ExperimentalReplications, rc)
+	}
+	if cfg.cf.replicaOf != "" {
+		rc, err := v3replication.ParseConfig(cfg.cf.replicaOf)
+		if err != nil {
+			return err
+		}
+		cfg.ec.ExperimentalReplicaOf = &rc
+	}
+	for _, spec := range flags.StringsFromFlag(cfg.cf.flagSet, "experimental-user-quotas") {
+		q, err := cconfig.ParseUserQuota(spec)
+		if err != nil {
+			return err
+		}
+		cfg.ec.ExperimentalUserQuotas = append(cfg.ec.ExperimentalUserQuotas, q)
+	}
+
 	cfg.ec.ClusterState = cfg.cf.clusterState.String()
 	cfg.cp.Fallback = cfg.cf.fallback.String() // proxy
 	cfg.cp.Proxy = cfg.cf.proxy.String()       // off
@@ -380,7 +518,7 @@ func (cfg *config) configFromCmdLine() error {
 	}
 
 	// 如果设置了discovery则禁用默认初始集群
-	if (cfg.ec.Durl != "" || cfg.ec.DNSCluster != "" || cfg.ec.DNSClusterServiceName != "") && !flags.IsSet(cfg.cf.flagSet, "initial-cluster") {
+	if (cfg.ec.Durl != "" || cfg.ec.DNSCluster != "" || cfg.ec.DNSClusterServiceName != "" || cfg.ec.DiscoveryProvider != "") && !flags.IsSet(cfg.cf.flagSet, "initial-cluster") {
 		cfg.ec.InitialCluster = ""
 	}
 
@@ -389,21 +527,13 @@ func (cfg *config) configFromCmdLine() error {
 
 // OK
 func (cfg *config) configFromFile(path string) error {
-	eCfg, err := embed.ConfigFromFile(path)
+	// 代理相关的配置也在同一个文件中
+	eCfg, err := embed.ConfigFromFileWith(path, &cfg.cp)
 	if err != nil {
 		return err
 	}
 	cfg.ec = *eCfg
 
-	// 加载额外的配置信息
-	b, rerr := ioutil.ReadFile(path)
-	if rerr != nil {
-		return rerr
-	}
-	if yerr := yaml.Unmarshal(b, &cfg.cp); yerr != nil {
-		return yerr
-	}
-
 	if cfg.cp.FallbackJSON != "" {
 		if err := cfg.cf.fallback.Set(cfg.cp.FallbackJSON); err != nil {
 			log.Fatalf("设置时出现意外错误 discovery-fallback flag: %v", err)
@@ -438,3 +568,30 @@ func (cfg *config) validate() error {
 func (cfg config) isProxy() bool               { return cfg.cf.proxy.String() != proxyFlagOff }
 func (cfg config) isReadonlyProxy() bool       { return cfg.cf.proxy.String() == proxyFlagReadonly }
 func (cfg config) shouldFallbackToProxy() bool { return cfg.cf.fallback.String() == fallbackFlagProxy }
+
+// printEffectiveConfig 按配置文件的格式输出配置,非默认值以 '*' 开头并注明默认值
+func printEffectiveConfig(w io.Writer, ec, base *embed.Config) {
+	for _, v := range embed.DiffConfig(ec, base) {
+		val, _ := json.Marshal(v.Value)
+		if !v.Changed {
+			fmt.Fprintf(w, "  %s: %s\n", v.Key, val)
+			continue
+		}
+		def, _ := json.Marshal(v.Default)
+		fmt.Fprintf(w, "* %s: %s  # 默认: %s\n", v.Key, val, def)
+	}
+}
+
+// defaultEffectiveConfig 不带任何标志和环境变量,或使用空配置文件时生效的配置
+func (cfg *config) defaultEffectiveConfig() *embed.Config {
+	if cfg.configFile != "" {
+		if ec, err := embed.ConfigFromYAML(nil, nil); err == nil {
+			return ec
+		}
+		return embed.NewConfig()
+	}
+	d := newConfig()
+	d.cf.flagSet.Parse(nil)
+	d.configFromFlags(zap.NewNop())
+	return &d.ec
+}
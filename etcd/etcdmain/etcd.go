@@ -109,7 +109,7 @@ func startEtcdOrProxy(args []string) {
 		lg.Info("etcd数据已经被初始化了", zap.String("data-dir", cfg.ec.Dir), zap.String("dir-type", string(which)))
 		switch which {
 		case dirMember:
-			stopped, errc, err = startEtcd(&cfg.ec)
+			stopped, errc, err = startEtcd(&cfg.ec, cfg.configFile)
 		case dirProxy:
 			err = startProxy(cfg)
 		default:
@@ -118,7 +118,7 @@ func startEtcdOrProxy(args []string) {
 	} else {
 		shouldProxy := cfg.isProxy() // 是否开启代理模式
 		if !shouldProxy {            // 一般不会开启
-			stopped, errc, err = startEtcd(&cfg.ec)
+			stopped, errc, err = startEtcd(&cfg.ec, cfg.configFile)
 			// todo 还没看
 			if derr, ok := err.(*etcdserver.DiscoveryError); ok && derr.Err == v2discovery.ErrFullCluster {
 				if cfg.shouldFallbackToProxy() {
@@ -191,11 +191,15 @@ func startEtcdOrProxy(args []string) {
 }
 
 // startEtcd
-func startEtcd(cfg *embed.Config) (<-chan struct{}, <-chan error, error) {
+func startEtcd(cfg *embed.Config, configFile string) (<-chan struct{}, <-chan error, error) {
+	applyExtensions(cfg)
 	e, err := embed.StartEtcd(cfg) // 异步启动etcd| http
 	if err != nil {
 		return nil, nil, err
 	}
+	if configFile != "" && cfg.ConfigFileReloadInterval > 0 {
+		e.WatchConfigFile(configFile, cfg.ConfigFileReloadInterval, &configProxy{})
+	}
 	osutil.RegisterInterruptHandler(e.Close) // 注册中断处理程序,但不会执行
 	select {
 	case <-e.Server.ReadyNotify(): // 等待本节点加入集群
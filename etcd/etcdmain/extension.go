@@ -0,0 +1,50 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdmain
+
+import (
+	"sync"
+
+	"github.com/ls-2018/etcd_cn/etcd/embed"
+)
+
+var (
+	extensionsMu sync.Mutex
+	extensions   []func(cfg *embed.Config)
+)
+
+// RegisterExtension registers f to be called with the parsed configuration
+// right before Main starts the etcd server, so that distributions built on
+// etcdmain can set options that are only available from Go code, such as
+// embed.Config.ExperimentalGRPCInterceptors and ExperimentalApplyObservers.
+// It must be called before Main, typically from an init function.
+// Extensions are called in the order they were registered.
+//
+// Experimental.
+func RegisterExtension(f func(cfg *embed.Config)) {
+	extensionsMu.Lock()
+	extensions = append(extensions, f)
+	extensionsMu.Unlock()
+}
+
+// applyExtensions 按注册顺序调用注册的扩展
+func applyExtensions(cfg *embed.Config) {
+	extensionsMu.Lock()
+	fs := append([]func(*embed.Config){}, extensions...)
+	extensionsMu.Unlock()
+	for _, f := range fs {
+		f(cfg)
+	}
+}
@@ -15,12 +15,15 @@
 package etcdmain
 
 import (
+	"context"
 	"fmt"
 	"net"
+	"net/http"
 	"net/url"
 	"os"
 	"time"
 
+	"github.com/ls-2018/etcd_cn/client_sdk/pkg/transport"
 	"github.com/ls-2018/etcd_cn/etcd/proxy/tcpproxy"
 
 	"github.com/spf13/cobra"
@@ -35,6 +38,11 @@ var (
 	gatewayInsecureDiscovery     bool
 	gatewayRetryDelay            time.Duration
 	gatewayCA                    string
+
+	gatewayDiscoverMembers     bool
+	gatewayDiscoveryInterval   time.Duration
+	gatewayHealthCheckInterval time.Duration
+	gatewayAdminListenAddr     string
 )
 
 var rootCmd = &cobra.Command{
@@ -75,6 +83,11 @@ func newGatewayStartCommand() *cobra.Command {
 
 	cmd.Flags().DurationVar(&gatewayRetryDelay, "retry-delay", time.Minute, "duration of delay before retrying failed endpoints")
 
+	cmd.Flags().BoolVar(&gatewayDiscoverMembers, "discover-members", false, "proxy to the client URLs in the member list of the cluster reachable through endpoints")
+	cmd.Flags().DurationVar(&gatewayDiscoveryInterval, "discovery-interval", 0, "interval to refresh endpoints from discovery-srv or the member list (0 to discover only at start)")
+	cmd.Flags().DurationVar(&gatewayHealthCheckInterval, "health-check-interval", 0, "interval of active health checks of all endpoints (0 to only retry failed endpoints after retry-delay)")
+	cmd.Flags().StringVar(&gatewayAdminListenAddr, "admin-listen-addr", "", "listen address of the admin HTTP endpoint to list, add and remove endpoints")
+
 	return &cmd
 }
 
@@ -168,10 +181,37 @@ func startGateway(cmd *cobra.Command, args []string) {
 	}
 
 	tp := tcpproxy.TCPProxy{
-		Logger:          lg,
-		Listener:        l,
-		Endpoints:       srvs.SRVs,
-		MonitorInterval: gatewayRetryDelay,
+		Logger:              lg,
+		Listener:            l,
+		Endpoints:           srvs.SRVs,
+		MonitorInterval:     gatewayRetryDelay,
+		DiscoveryInterval:   gatewayDiscoveryInterval,
+		HealthCheckInterval: gatewayHealthCheckInterval,
+	}
+	switch {
+	case gatewayDiscoverMembers:
+		d := &tcpproxy.MemberListDiscovery{Endpoints: gatewayEndpoints}
+		if gatewayCA != "" {
+			tlsInfo := transport.TLSInfo{TrustedCAFile: gatewayCA}
+			if d.TLS, err = tlsInfo.ClientConfig(); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			transport.WatchCerts(context.Background(), nil)
+		}
+		tp.Discovery = d
+	case gatewayDNSCluster != "" && gatewayDiscoveryInterval > 0:
+		// 启动时已经做过一次 SRV 发现,这里只负责定期刷新
+		tp.Discovery = &tcpproxy.SRVDiscovery{Domain: gatewayDNSCluster, ServiceName: gatewayDNSClusterServiceName}
+	}
+
+	if gatewayAdminListenAddr != "" {
+		go func() {
+			lg.Info("gateway admin endpoint serving", zap.String("address", gatewayAdminListenAddr))
+			if aerr := http.ListenAndServe(gatewayAdminListenAddr, tp.AdminHandler()); aerr != nil {
+				lg.Fatal("gateway admin endpoint returned", zap.Error(aerr))
+			}
+		}()
 	}
 
 	// At this point, etcd gateway listener is initialized
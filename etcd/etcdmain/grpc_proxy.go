@@ -35,6 +35,7 @@ import (
 	"github.com/ls-2018/etcd_cn/client_sdk/v3/namespace"
 	"github.com/ls-2018/etcd_cn/client_sdk/v3/ordering"
 	"github.com/ls-2018/etcd_cn/etcd/embed"
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver/api/etcdhttp"
 	"github.com/ls-2018/etcd_cn/etcd/etcdserver/api/v3election/v3electionpb"
 	"github.com/ls-2018/etcd_cn/etcd/etcdserver/api/v3lock/v3lockpb"
 	"github.com/ls-2018/etcd_cn/etcd/proxy/grpcproxy"
@@ -47,6 +48,7 @@ import (
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/grpclog"
 	"google.golang.org/grpc/keepalive"
 )
@@ -85,8 +87,16 @@ var (
 	grpcProxyNamespace string
 	grpcProxyLeasing   string
 
-	grpcProxyEnablePprof    bool
-	grpcProxyEnableOrdering bool
+	grpcProxyEnablePprof       bool
+	grpcProxyEnableOrdering    bool
+	grpcProxyEnableSharedCache bool
+	grpcProxyReadYourWrites    bool
+
+	grpcProxyMaxWatchersPerClient int
+	grpcProxyWatchCoalesceLimit   int
+
+	grpcProxyLeaseKeepAliveStreams int
+	grpcProxyAuthTokenCacheTTL     time.Duration
 
 	grpcProxyDebug bool
 
@@ -129,6 +139,7 @@ func newGRPCProxyStartCommand() *cobra.Command {
 	cmd.Flags().StringVar(&grpcProxyAdvertiseClientURL, "advertise-client-url", "127.0.0.1:23790", "advertise address to register (must be reachable by client)")
 	cmd.Flags().StringVar(&grpcProxyResolverPrefix, "resolver-prefix", "", "prefix to use for registering proxy (must be shared with other grpc-proxy members)")
 	cmd.Flags().IntVar(&grpcProxyResolverTTL, "resolver-ttl", 0, "specify TTL, in seconds, when registering proxy endpoints")
+	cmd.Flags().IntVar(&grpcProxyMaxWatchersPerClient, "max-watchers-per-client", 0, "maximum number of watchers a single client address may hold (0 for unlimited)")
 	cmd.Flags().StringVar(&grpcProxyNamespace, "namespace", "", "string to prefix to all keys for namespacing requests")
 	cmd.Flags().BoolVar(&grpcProxyEnablePprof, "enable-pprof", false, `Enable runtime profiling data via HTTP etcd. Address is at client URL + "/debug/pprof/"`)
 	cmd.Flags().StringVar(&grpcProxyDataDir, "data-dir", "default.proxy", "Data directory for persistent data")
@@ -155,6 +166,11 @@ func newGRPCProxyStartCommand() *cobra.Command {
 	// experimental flags
 	cmd.Flags().BoolVar(&grpcProxyEnableOrdering, "experimental-serializable-ordering", false, "Ensure serializable reads have monotonically increasing store revisions across endpoints.")
 	cmd.Flags().StringVar(&grpcProxyLeasing, "experimental-leasing-prefix", "", "leasing metadata prefix for disconnected linearized reads.")
+	cmd.Flags().IntVar(&grpcProxyWatchCoalesceLimit, "experimental-watch-coalesce-limit", 0, "Number of watchers from which a shared etcd watcher is no longer merged with others over the same range (0 for the default, negative to always coalesce).")
+	cmd.Flags().IntVar(&grpcProxyLeaseKeepAliveStreams, "experimental-lease-keepalive-streams", 1, "Number of upstream streams the lease keepalives of all clients are multiplexed over.")
+	cmd.Flags().DurationVar(&grpcProxyAuthTokenCacheTTL, "experimental-auth-token-cache-ttl", 0, "How long an auth token is reused for the same credentials (0 to disable); keep it below the etcd token TTL.")
+	cmd.Flags().BoolVar(&grpcProxyReadYourWrites, "experimental-read-your-writes", false, "Ensure serializable reads from a client observe its own earlier writes.")
+	cmd.Flags().BoolVar(&grpcProxyEnableSharedCache, "experimental-shared-cache", false, "Partition the serializable read cache among grpc-proxy members registered under resolver-prefix.")
 
 	cmd.Flags().BoolVar(&grpcProxyDebug, "debug", false, "Enable debug-level logging for grpc-proxy.")
 
@@ -211,9 +227,10 @@ func startGRPCProxy(cmd *cobra.Command, args []string) {
 		proxyClient = mustNewProxyClient(lg, tlsinfo)
 	}
 
-	srvhttp, httpl := mustHTTPListener(lg, m, tlsinfo, client, proxyClient)
+	srvgrpc, watchp := newGRPCProxyServer(lg, client, tlsinfo)
+	srvhttp, httpl := mustHTTPListener(lg, m, tlsinfo, client, proxyClient, watchp)
 	errc := make(chan error, 3)
-	go func() { errc <- newGRPCProxyServer(lg, client).Serve(grpcl) }()
+	go func() { errc <- srvgrpc.Serve(grpcl) }()
 	go func() { errc <- srvhttp.Serve(httpl) }()
 	go func() { errc <- m.Serve() }()
 	if len(grpcProxyMetricsListenAddr) > 0 {
@@ -222,6 +239,8 @@ func startGRPCProxy(cmd *cobra.Command, args []string) {
 			mux := http.NewServeMux()
 			grpcproxy.HandleHealth(lg, mux, client)
 			grpcproxy.HandleProxyHealth(lg, mux, proxyClient)
+			grpcproxy.HandleWatchGroups(lg, mux, watchp)
+			etcdhttp.HandlePrometheus(mux)
 			lg.Info("gRPC proxy etcd metrics URL serving")
 			herr := http.Serve(mhttpl, mux)
 			if herr != nil {
@@ -254,6 +273,10 @@ func checkArgs() {
 		fmt.Fprintln(os.Stderr, fmt.Errorf("invalid advertise-client-url %q", grpcProxyAdvertiseClientURL))
 		os.Exit(1)
 	}
+	if grpcProxyEnableSharedCache && grpcProxyResolverPrefix == "" {
+		fmt.Fprintln(os.Stderr, fmt.Errorf("experimental-shared-cache requires resolver-prefix"))
+		os.Exit(1)
+	}
 	if grpcProxyListenAutoTLS && selfSignedCertValidity == 0 {
 		fmt.Fprintln(os.Stderr, fmt.Errorf("selfSignedCertValidity is invalid,it should be greater than 0"))
 		os.Exit(1)
@@ -378,7 +401,7 @@ func mustListenCMux(lg *zap.Logger, tlsinfo *transport.TLSInfo) cmux.CMux {
 	return cmux.New(l)
 }
 
-func newGRPCProxyServer(lg *zap.Logger, client *clientv3.Client) *grpc.Server {
+func newGRPCProxyServer(lg *zap.Logger, client *clientv3.Client, tlsinfo *transport.TLSInfo) (*grpc.Server, pb.WatchServer) {
 	if grpcProxyEnableOrdering {
 		vf := ordering.NewOrderViolationSwitchEndpointClosure(client)
 		client.KV = ordering.NewKV(client.KV, vf)
@@ -403,16 +426,31 @@ func newGRPCProxyServer(lg *zap.Logger, client *clientv3.Client) *grpc.Server {
 		client.KV, _, _ = leasing.NewKV(client, grpcProxyLeasing)
 	}
 
-	kvp, _ := grpcproxy.NewKvProxy(client)
-	watchp, _ := grpcproxy.NewWatchProxy(client.Ctx(), lg, client)
+	kvcfg := grpcproxy.KvProxyConfig{ReadYourWrites: grpcProxyReadYourWrites}
+	if grpcProxyEnableSharedCache && grpcProxyResolverPrefix != "" {
+		kvcfg.Peers = &grpcproxy.PeerCacheConfig{
+			Self:        grpcProxyAdvertiseClientURL,
+			Prefix:      grpcProxyResolverPrefix,
+			DialOptions: mustPeerDialOptions(tlsinfo),
+		}
+	}
+	kvp, _ := grpcproxy.NewKvProxyWithConfig(lg, client, kvcfg)
+	watchp, _ := grpcproxy.NewWatchProxyWithConfig(client.Ctx(), lg, client, grpcproxy.WatchProxyConfig{
+		MaxWatchersPerClient: grpcProxyMaxWatchersPerClient,
+		CoalesceLimit:        grpcProxyWatchCoalesceLimit,
+	})
 	if grpcProxyResolverPrefix != "" {
 		grpcproxy.Register(lg, client, grpcProxyResolverPrefix, grpcProxyAdvertiseClientURL, grpcProxyResolverTTL)
 	}
 	clusterp, _ := grpcproxy.NewClusterProxy(lg, client, grpcProxyAdvertiseClientURL, grpcProxyResolverPrefix)
-	leasep, _ := grpcproxy.NewLeaseProxy(client.Ctx(), client)
+	leasep, _ := grpcproxy.NewLeaseProxyWithConfig(client.Ctx(), client, grpcproxy.LeaseProxyConfig{
+		KeepAliveStreams: grpcProxyLeaseKeepAliveStreams,
+	})
 
 	mainp := grpcproxy.NewMaintenanceProxy(client)
-	authp := grpcproxy.NewAuthProxy(client)
+	authp := grpcproxy.NewAuthProxyWithConfig(client, grpcproxy.AuthProxyConfig{
+		TokenCacheTTL: grpcProxyAuthTokenCacheTTL,
+	})
 	electionp := grpcproxy.NewElectionProxy(client)
 	lockp := grpcproxy.NewLockProxy(client)
 
@@ -446,14 +484,29 @@ func newGRPCProxyServer(lg *zap.Logger, client *clientv3.Client) *grpc.Server {
 	v3electionpb.RegisterElectionServer(server, electionp)
 	v3lockpb.RegisterLockServer(server, lockp)
 
-	return server
+	return server, watchp
+}
+
+// mustPeerDialOptions 返回连接其他 grpc-proxy 成员所用的拨号参数
+func mustPeerDialOptions(tlsinfo *transport.TLSInfo) []grpc.DialOption {
+	if tlsinfo == nil {
+		return []grpc.DialOption{grpc.WithInsecure()}
+	}
+	clientTLS, err := tlsinfo.ClientConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	return []grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(clientTLS))}
 }
 
-func mustHTTPListener(lg *zap.Logger, m cmux.CMux, tlsinfo *transport.TLSInfo, c *clientv3.Client, proxy *clientv3.Client) (*http.Server, net.Listener) {
+func mustHTTPListener(lg *zap.Logger, m cmux.CMux, tlsinfo *transport.TLSInfo, c *clientv3.Client, proxy *clientv3.Client, watchp pb.WatchServer) (*http.Server, net.Listener) {
 	httpmux := http.NewServeMux()
 	httpmux.HandleFunc("/", http.NotFound)
+	etcdhttp.HandlePrometheus(httpmux)
 	grpcproxy.HandleHealth(lg, httpmux, c)
 	grpcproxy.HandleProxyHealth(lg, httpmux, proxy)
+	grpcproxy.HandleWatchGroups(lg, httpmux, watchp)
 	if grpcProxyEnablePprof {
 		for p, h := range debugutil.PProfHandlers() {
 			httpmux.Handle(p, h)
@@ -474,6 +527,7 @@ func mustHTTPListener(lg *zap.Logger, m cmux.CMux, tlsinfo *transport.TLSInfo, c
 		lg.Fatal("failed to set up TLS", zap.Error(err))
 	}
 	srvhttp.TLSConfig = srvTLS
+	transport.WatchCerts(context.Background(), lg)
 	return srvhttp, m.Match(cmux.Any())
 }
 
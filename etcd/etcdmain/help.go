@@ -37,6 +37,14 @@ var (
 
   etcd --config-file
     Path to the etcd configuration file. Note that if a configuration file is provided, other command line flags and environment variables will be ignored.
+    配置文件中设置 config-file-reload-interval 后会定期检查文件,热加载 log-level、client-cert-allowed-cns、
+    auto-compaction-retention、experimental-warning-apply-duration、quota-backend-bytes.
+
+  etcd --validate-config [flags]
+    校验合并了命令行、配置文件和环境变量之后的配置,有错误时以非0退出.
+
+  etcd --print-effective-config [flags]
+    打印合并后生效的配置并退出,非默认值用 '*' 标出.
 
   etcd gateway
     启动 L4 TCP网关代理
@@ -113,6 +121,10 @@ Clustering:
     DNS srv域用于引导群集.
   --discovery-srv-name ''
     使用DNS引导时查询的DNS srv名称的后缀.
+  --discovery-provider ''
+    用于引导群集的发现提供者: dns-srv, ec2, gce, kubernetes, file.
+  --discovery-params ''
+    发现提供者参数, 格式为 'key1=value1;key2=value2'. 通用参数: expected-size, timeout, peer-port, peer-scheme.
   --strict-reconfig-check '` + strconv.FormatBool(embed.DefaultStrictReconfigCheck) + `'
     拒绝可能导致仲裁丢失的重新配置请求.true
   --pre-vote 'true'
@@ -137,9 +149,17 @@ Security:
   --client-cert-auth 'false'
     启用客户端证书验证;默认false
   --client-crl-file ''
-    客户端证书吊销列表文件的路径.
+    客户端证书吊销列表文件的路径,文件变化后自动重新加载.
+  --client-ocsp-check ''
+    通过OCSP检查客户端证书是否吊销: 'soft'(OCSP不可用时放行)或'hard'(OCSP不可用时拒绝),为空不检查.
+  --client-ocsp-staple 'false'
+    在TLS握手中附带定期刷新的服务端证书OCSP响应.
   --client-cert-allowed-hostname ''
     允许客户端证书认证使用TLS主机名
+  --client-cert-allowed-spiffe-id ''
+    逗号分隔的允许的客户端证书SPIFFE ID模式,例如 spiffe://example.org/ns/*/sa/api
+  --client-cert-allowed-cns ''
+    逗号分隔的允许的客户端证书CommonName,可以通过配置文件热加载.
   --trusted-ca-file ''
     客户端etcd通信 的可信CA证书文件
   --auto-tls 'false'
@@ -156,12 +176,18 @@ Security:
     允许的server客户端证书CommonName
   --peer-cert-allowed-hostname ''
     允许的server客户端证书hostname
+  --peer-cert-allowed-spiffe-id ''
+    逗号分隔的允许的server客户端证书SPIFFE ID模式,例如 spiffe://example.org/etcd/*
   --peer-auto-tls 'false'
     节点之间使用生成的证书通信;默认false
   --self-signed-cert-validity '1'
     客户端证书和同级证书的有效期,单位为年 ;etcd自动生成的 如果指定了ClientAutoTLS and PeerAutoTLS,
   --peer-crl-file ''
-    服务端证书吊销列表文件的路径.
+    服务端证书吊销列表文件的路径,文件变化后自动重新加载.
+  --peer-ocsp-check ''
+    通过OCSP检查server客户端证书是否吊销: 'soft'或'hard',为空不检查.
+  --peer-ocsp-staple 'false'
+    在节点之间的TLS握手中附带定期刷新的证书OCSP响应.
   --cipher-suites ''
     客户端/etcds之间支持的TLS加密套件的逗号分隔列表(空将由Go自动填充).
   --cors '*'
@@ -172,10 +198,44 @@ Security:
 Auth:
   --auth-token 'simple'
     指定验证令牌的具体选项. ('simple' or 'jwt')
+    jwt可以通过 jwks-url=<url> 使用外部签发的token(只校验不签发),并可通过 issuer、audience 校验 iss/aud,
+    username-claim、username-prefix 将token中的用户映射为etcd用户,jwks-refresh-interval 指定公钥缓存时间.
   --bcrypt-cost ` + fmt.Sprintf("%d", bcrypt.DefaultCost) + `
     为散列身份验证密码指定bcrypt算法的成本/强度.有效值介于4和31之间.
   --auth-token-ttl 300
     token过期时间
+  --auth-spiffe-user-mapping ''
+    客户端证书为X509-SVID时从SPIFFE ID映射用户名的方式('id' or 'path'),为空时使用CommonName.
+  --auth-webhook-url ''
+    本地不存在的用户交由该webhook认证,webhook返回etcd用户名和角色.
+  --auth-webhook-ca-file ''
+    校验auth webhook服务端证书的CA文件.
+  --auth-webhook-timeout '5s'
+    auth webhook请求超时时间.
+  --auth-webhook-cache-ttl '1m'
+    auth webhook认证成功的结果缓存时间.
+  --auth-webhook-failure-policy 'deny'
+    auth webhook不可用时的策略('deny' 拒绝, 'cache' 使用最近一次成功的认证结果).
+  --auth-password-min-length 0
+    密码最小长度,0表示不限制.
+  --auth-password-min-classes 0
+    密码至少包含几类字符(小写字母、大写字母、数字、其他字符),0-4.
+  --auth-password-max-age '0s'
+    密码有效期,过期后需要管理员重置密码,0表示不过期.
+  --auth-lockout-threshold 0
+    连续登录失败多少次后临时锁定账户,0表示不锁定.
+  --auth-lockout-duration '5m'
+    账户锁定时长;超过该时长没有失败的登录,失败计数清零.
+  --auth-refresh-token-ttl '0s'
+    认证成功时签发的refresh token有效期,客户端可以用refresh token换取新的token而不需要保存密码.
+    refresh token每次使用后轮换,修改密码、移除角色或删除用户时作废.0表示不签发.
+  --auth-token-ttl-overrides ''
+    按用户或角色设置token有效期,例如 'user:alice=1h,role:ci=10m';用户的设置优先,多个角色取最短的.
+  --auth-audit-sample-rate '0'
+    权限检查失败的记录比例(0-1),记录用户、key范围、操作和客户端地址,可以通过 'etcdctl auth denials' 查看.
+    记录只保存在本节点,0表示不记录.
+  --auth-audit-max-entries '1000'
+    本节点最多保留的权限检查失败记录数,超过时删除最早的.
 
 Profiling and Monitoring:
   --enable-pprof 'false'
@@ -184,6 +244,15 @@ Profiling and Monitoring:
     设置导出的指标的详细程度,指定"扩展"以包括直方图指标(extensive,basic)
   --listen-metrics-urls ''
     List of URLs to listen on for the metrics and health endpoints.
+  --listen-maintenance-urls ''
+    只提供 Maintenance 服务(快照、碎片整理、hashkv等)的url列表,与客户端端口分开,避免快照流影响kv请求.
+  --max-concurrent-maintenance-requests '0'
+    --listen-maintenance-urls 上同时处理的请求数上限,超过时直接拒绝;0表示不限制.
+  --enable-dashboard 'false'
+    在 --listen-dashboard-urls 上提供只读的 web 管理页面,展示成员、健康状态、key、告警和指标.
+    开启认证时需要使用 basic auth 登录,只能看到有读权限的 key.
+  --listen-dashboard-urls 'http://localhost:2390'
+    web 管理页面监听的url列表.
 
 Logging:
   --logger 'zap'
@@ -230,6 +299,14 @@ Experimental feature:
     Serve v2 requests through the v3 backend under a given prefix. Deprecated and to be decommissioned in v3.6.
   --experimental-enable-lease-checkpoint 'false'
     ExperimentalEnableLeaseCheckpoint enables primary lessor to persist lease remainingTTL to prevent indefinite auto-renewal of long lived leases.
+  --experimental-lease-checkpoint-interval '5m'
+    单个租约检查点的时间间隔,只对剩余时间大于该值的租约调度.
+  --experimental-lease-consolidated-checkpoint-interval '0s'
+    定期把所有租约(包括短租约)的剩余时间汇总成检查点的间隔,避免leader变更后租约被重置为完整的TTL;0表示关闭.
+  --experimental-lease-revoke-rate 1000
+    每秒最多撤销的过期租约数,按最早过期的顺序分批撤销,每批放在一个raft请求中依次撤销,避免大量租约同时过期时的删除风暴.
+  --experimental-lease-ttl-jitter '0'
+    创建租约时TTL最多随机增加的比例(0-1),让相同TTL的租约分散到期;0表示不加抖动.
   --experimental-compaction-batch-limit 1000
     ExperimentalCompactionBatchLimit sets the maximum revisions deleted in each compaction batch.
   --experimental-peer-skip-client-san-verification 'false'
@@ -0,0 +1,192 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdserver
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// QoSClass 请求的服务等级,过载时等级低的请求先被拒绝
+type QoSClass int
+
+const (
+	// QoSBatch 全量扫描、压缩等可以推迟的批量请求
+	QoSBatch QoSClass = iota
+	// QoSNormal 普通读写
+	QoSNormal
+	// QoSCritical 鉴权、租约、集群和维护请求,不会被准入控制拒绝
+	QoSCritical
+)
+
+func (c QoSClass) String() string {
+	switch c {
+	case QoSBatch:
+		return "batch"
+	case QoSNormal:
+		return "normal"
+	case QoSCritical:
+		return "critical"
+	}
+	return "unknown"
+}
+
+// ParseQoSClass 解析客户端声明的优先级,与 clientv3.PriorityClass 的取值一致
+func ParseQoSClass(s string) (QoSClass, bool) {
+	switch s {
+	case "batch":
+		return QoSBatch, true
+	case "normal":
+		return QoSNormal, true
+	case "critical":
+		return QoSCritical, true
+	}
+	return QoSNormal, false
+}
+
+const (
+	// fsync耗时的指数加权平均系数
+	fsyncEWMAWeight = 0.2
+	// 超过该时间没有写WAL时忽略fsync耗时,避免空闲后一直按旧的耗时拒绝请求
+	fsyncIdleReset = time.Second
+	// 压力达到阈值的倍数时拒绝对应等级的请求
+	shedBatchPressure  = 1
+	shedNormalPressure = 2
+
+	minRetryAfter = time.Second
+	maxRetryAfter = 30 * time.Second
+)
+
+var (
+	admissionPressure = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "etcd",
+		Subsystem: "server",
+		Name:      "admission_pressure",
+		Help:      "Overload pressure of the member as a multiple of the admission thresholds. Batch requests are shed at 1, normal requests at 2.",
+	})
+	admissionRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "etcd",
+		Subsystem: "server",
+		Name:      "admission_rejected_total",
+		Help:      "The total number of requests rejected by admission control.",
+	}, []string{"class"})
+	walSaveDurationEWMA = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "etcd",
+		Subsystem: "server",
+		Name:      "admission_wal_save_duration_seconds",
+		Help:      "Exponentially weighted moving average of WAL save and fsync duration used by admission control.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(admissionPressure)
+	prometheus.MustRegister(admissionRejected)
+	prometheus.MustRegister(walSaveDurationEWMA)
+}
+
+// admission 根据WAL fsync耗时、apply积压和未完成的提案数判断成员是否过载
+type admission struct {
+	fsyncEWMA   int64 // 纳秒
+	lastSave    int64 // 最近一次写WAL完成的时间,UnixNano
+	savingSince int64 // 正在写WAL的开始时间,0表示没有在写
+	pending     int64 // 已提交给raft、还没有apply结果的提案数
+}
+
+// saveStarted 在写WAL前调用
+func (a *admission) saveStarted(now time.Time) {
+	atomic.StoreInt64(&a.savingSince, now.UnixNano())
+}
+
+// saveFinished 在写WAL后调用,更新fsync耗时的平均值
+func (a *admission) saveFinished(now time.Time) {
+	start := atomic.SwapInt64(&a.savingSince, 0)
+	if start == 0 {
+		return
+	}
+	took := float64(now.UnixNano() - start)
+	avg := took
+	if old := atomic.LoadInt64(&a.fsyncEWMA); old > 0 {
+		avg = fsyncEWMAWeight*took + (1-fsyncEWMAWeight)*float64(old)
+	}
+	atomic.StoreInt64(&a.fsyncEWMA, int64(avg))
+	atomic.StoreInt64(&a.lastSave, now.UnixNano())
+	walSaveDurationEWMA.Set(avg / float64(time.Second))
+}
+
+// fsyncLatency 返回当前的fsync耗时;正在进行的写入耗时超过平均值时以它为准
+func (a *admission) fsyncLatency(now time.Time) time.Duration {
+	lat := time.Duration(atomic.LoadInt64(&a.fsyncEWMA))
+	if now.UnixNano()-atomic.LoadInt64(&a.lastSave) > int64(fsyncIdleReset) {
+		lat = 0
+	}
+	if start := atomic.LoadInt64(&a.savingSince); start != 0 {
+		if cur := time.Duration(now.UnixNano() - start); cur > lat {
+			lat = cur
+		}
+	}
+	return lat
+}
+
+// admissionPressure 计算过载压力:各项指标与对应阈值之比的最大值
+func (s *EtcdServer) admissionPressure() float64 {
+	cfg := s.Cfg
+	now := time.Now()
+	var p float64
+	if cfg.AdmissionFsyncLatency > 0 {
+		p = math.Max(p, float64(s.admission.fsyncLatency(now))/float64(cfg.AdmissionFsyncLatency))
+	}
+	if cfg.AdmissionApplyBacklog > 0 {
+		if ci, ai := s.getCommittedIndex(), s.getAppliedIndex(); ci > ai {
+			p = math.Max(p, float64(ci-ai)/float64(cfg.AdmissionApplyBacklog))
+		}
+	}
+	if cfg.AdmissionPendingProposals > 0 {
+		p = math.Max(p, float64(atomic.LoadInt64(&s.admission.pending))/float64(cfg.AdmissionPendingProposals))
+	}
+	admissionPressure.Set(p)
+	return p
+}
+
+// Admit 判断是否接受一个给定等级的请求.成员过载时返回 ErrTooManyRequests,
+// 以及建议客户端重试前等待的时间;未开启准入控制时总是接受.
+func (s *EtcdServer) Admit(class QoSClass) (retryAfter time.Duration, err error) {
+	if !s.Cfg.AdmissionControl || class >= QoSCritical {
+		return 0, nil
+	}
+	p := s.admissionPressure()
+	limit := float64(shedNormalPressure)
+	if class == QoSBatch {
+		limit = shedBatchPressure
+	}
+	if p < limit {
+		return 0, nil
+	}
+	admissionRejected.WithLabelValues(class.String()).Inc()
+	// 压力越大等待越久,批量请求加倍
+	retryAfter = time.Duration(p * float64(time.Second))
+	if class == QoSBatch {
+		retryAfter *= 2
+	}
+	if retryAfter < minRetryAfter {
+		retryAfter = minRetryAfter
+	}
+	if retryAfter > maxRetryAfter {
+		retryAfter = maxRetryAfter
+	}
+	return retryAfter, ErrTooManyRequests
+}
@@ -0,0 +1,210 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdserver
+
+import (
+	"fmt"
+	"path/filepath"
+	"plugin"
+	"strings"
+
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// 准入插件: 运维人员为key前缀加载校验模块,Put/DeleteRange/Txn在提议到raft之前交给模块检查,模块返回错误时拒绝请求,
+// 可以在存储层对value做schema校验. 校验只在接收请求的成员上进行,不影响apply,所以模块不需要是确定性的.
+//
+// 模块是用 go build -buildmode=plugin 构建的Go插件,导出
+//
+//	func ValidatePut(key, value []byte) error        // 必须
+//	func ValidateDelete(key, rangeEnd []byte) error  // 可选,rangeEnd为空表示单个key
+//
+// 插件必须用与etcd相同的Go版本和依赖构建. WASM模块需要的运行时没有编译进etcd,暂不支持.
+
+var admissionPluginRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "etcd",
+	Subsystem: "server",
+	Name:      "admission_plugin_rejected_total",
+	Help:      "The total number of write requests rejected by admission plugins.",
+}, []string{"prefix"})
+
+func init() {
+	prometheus.MustRegister(admissionPluginRejected)
+}
+
+// AdmissionPluginSpec 一个前缀及负责校验它的模块路径
+type AdmissionPluginSpec struct {
+	Prefix string
+	Path   string
+}
+
+// ParseAdmissionPlugins 解析 "<prefix>=<plugin.so>,..." 格式的配置
+func ParseAdmissionPlugins(s string) ([]AdmissionPluginSpec, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var specs []AdmissionPluginSpec
+	for _, item := range strings.Split(s, ",") {
+		kv := strings.SplitN(strings.TrimSpace(item), "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return nil, fmt.Errorf("invalid admission plugin %q (expected <prefix>=<path>)", item)
+		}
+		if strings.EqualFold(filepath.Ext(kv[1]), ".wasm") {
+			return nil, fmt.Errorf("admission plugin %q: WASM modules are not supported by this build", kv[1])
+		}
+		specs = append(specs, AdmissionPluginSpec{Prefix: kv[0], Path: kv[1]})
+	}
+	return specs, nil
+}
+
+// AdmissionError 准入插件拒绝了请求
+type AdmissionError struct {
+	Key     string
+	Message string
+}
+
+func (e *AdmissionError) Error() string {
+	return fmt.Sprintf("etcdserver: request for key %q rejected by admission plugin: %s", e.Key, e.Message)
+}
+
+// admissionPlugin 一个已加载的校验模块
+type admissionPlugin struct {
+	prefix         string
+	path           string
+	validatePut    func(key, value []byte) error
+	validateDelete func(key, rangeEnd []byte) error
+}
+
+func loadAdmissionPlugins(specs []AdmissionPluginSpec) ([]*admissionPlugin, error) {
+	ps := make([]*admissionPlugin, 0, len(specs))
+	for _, spec := range specs {
+		p, err := plugin.Open(spec.Path)
+		if err != nil {
+			return nil, fmt.Errorf("open admission plugin %q: %v", spec.Path, err)
+		}
+		ap := &admissionPlugin{prefix: spec.Prefix, path: spec.Path}
+		sym, err := p.Lookup("ValidatePut")
+		if err != nil {
+			return nil, fmt.Errorf("admission plugin %q: %v", spec.Path, err)
+		}
+		var ok bool
+		if ap.validatePut, ok = sym.(func(key, value []byte) error); !ok {
+			return nil, fmt.Errorf("admission plugin %q: ValidatePut has type %T, want func(key, value []byte) error", spec.Path, sym)
+		}
+		if sym, err = p.Lookup("ValidateDelete"); err == nil {
+			if ap.validateDelete, ok = sym.(func(key, rangeEnd []byte) error); !ok {
+				return nil, fmt.Errorf("admission plugin %q: ValidateDelete has type %T, want func(key, rangeEnd []byte) error", spec.Path, sym)
+			}
+		}
+		ps = append(ps, ap)
+	}
+	return ps, nil
+}
+
+// covers 范围 [key, end) 是否与插件的前缀有交集
+func (p *admissionPlugin) covers(key, end string) bool {
+	if end == "" {
+		return strings.HasPrefix(key, p.prefix)
+	}
+	if strings.HasPrefix(key, p.prefix) {
+		return true
+	}
+	// 范围起点在前缀之前时,只要终点越过前缀的起点就有交集
+	return key < p.prefix && (end == "\x00" || end > p.prefix)
+}
+
+// callAdmissionPlugin 调用模块,模块panic时按拒绝处理
+func (s *EtcdServer) callAdmissionPlugin(p *admissionPlugin, f func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.Logger().Warn("准入插件panic", zap.String("plugin", p.path), zap.Any("panic", r))
+			err = fmt.Errorf("plugin panicked: %v", r)
+		}
+	}()
+	return f()
+}
+
+// admitPut 依次交给覆盖key的插件检查
+func (s *EtcdServer) admitPut(r *pb.PutRequest) error {
+	if r.IgnoreValue {
+		// value没有变化
+		return nil
+	}
+	for _, p := range s.validators {
+		if !p.covers(r.Key, "") {
+			continue
+		}
+		if err := s.callAdmissionPlugin(p, func() error { return p.validatePut([]byte(r.Key), []byte(r.Value)) }); err != nil {
+			admissionPluginRejected.WithLabelValues(p.prefix).Inc()
+			return &AdmissionError{Key: r.Key, Message: err.Error()}
+		}
+	}
+	return nil
+}
+
+func (s *EtcdServer) admitDelete(r *pb.DeleteRangeRequest) error {
+	for _, p := range s.validators {
+		if p.validateDelete == nil || !p.covers(r.Key, r.RangeEnd) {
+			continue
+		}
+		if err := s.callAdmissionPlugin(p, func() error { return p.validateDelete([]byte(r.Key), []byte(r.RangeEnd)) }); err != nil {
+			admissionPluginRejected.WithLabelValues(p.prefix).Inc()
+			return &AdmissionError{Key: r.Key, Message: err.Error()}
+		}
+	}
+	return nil
+}
+
+// admitTxn 检查事务两个分支中的所有写操作
+func (s *EtcdServer) admitTxn(success, failure []*pb.RequestOp) error {
+	for _, ops := range [][]*pb.RequestOp{success, failure} {
+		for _, op := range ops {
+			var err error
+			switch {
+			case op.GetRequestPut() != nil:
+				err = s.admitPut(op.GetRequestPut())
+			case op.GetRequestDeleteRange() != nil:
+				err = s.admitDelete(op.GetRequestDeleteRange())
+			case op.GetRequestTxn() != nil:
+				err = s.admitTxn(op.GetRequestTxn().Success, op.GetRequestTxn().Failure)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// admit 提议到raft之前用准入插件检查写请求
+func (s *EtcdServer) admit(r *pb.InternalRaftRequest) error {
+	if len(s.validators) == 0 {
+		return nil
+	}
+	switch {
+	case r.Put != nil:
+		return s.admitPut(r.Put)
+	case r.DeleteRange != nil:
+		return s.admitDelete(r.DeleteRange)
+	case r.Txn != nil:
+		return s.admitTxn(r.Txn.Success, r.Txn.Failure)
+	case r.StagedTxn != nil && r.StagedTxn.Request.Action == pb.StagedTxnRequest_APPEND:
+		return s.admitTxn(r.StagedTxn.Request.Success, r.StagedTxn.Request.Failure)
+	}
+	return nil
+}
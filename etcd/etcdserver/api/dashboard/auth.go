@@ -0,0 +1,133 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dashboard
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ls-2018/etcd_cn/etcd/auth"
+	"github.com/ls-2018/etcd_cn/offical/api/v3/v3rpc/rpctypes"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// errUnauthorized means the response asking for credentials was already written.
+var errUnauthorized = errors.New("dashboard: unauthorized")
+
+// withAuth calls f with the credentials of the request when auth is enabled.
+// Tokens are cached, since every authentication goes through raft.
+func (d *dashboard) withAuth(w http.ResponseWriter, r *http.Request, f func(ctx context.Context) (*pb.RangeResponse, error)) (*pb.RangeResponse, error) {
+	ctx := r.Context()
+	if !d.srv.AuthStore().IsAuthEnabled() {
+		return f(ctx)
+	}
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		unauthorized(w)
+		return nil, errUnauthorized
+	}
+
+	for retry := true; ; retry = false {
+		token, err := d.token(ctx, user, password)
+		if err != nil {
+			if err == auth.ErrAuthFailed {
+				unauthorized(w)
+				return nil, errUnauthorized
+			}
+			return nil, err
+		}
+		resp, err := f(metadata.NewIncomingContext(ctx, metadata.Pairs(rpctypes.TokenFieldNameGRPC, token)))
+		if err == auth.ErrInvalidAuthToken && retry {
+			// 令牌过期,重新认证一次
+			d.tokens.invalidate(user, password)
+			continue
+		}
+		return resp, err
+	}
+}
+
+func (d *dashboard) token(ctx context.Context, user, password string) (string, error) {
+	if token, ok := d.tokens.get(user, password); ok {
+		return token, nil
+	}
+	resp, err := d.srv.Authenticate(ctx, &pb.AuthenticateRequest{Name: user, Password: password})
+	if err != nil {
+		return "", err
+	}
+	d.tokens.add(user, password, resp.Token)
+	return resp.Token, nil
+}
+
+func unauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="etcd"`)
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+}
+
+// tokenCache maps credentials to auth tokens for a limited time.
+type tokenCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]tokenEntry
+}
+
+type tokenEntry struct {
+	token   string
+	expires time.Time
+}
+
+func newTokenCache(ttl time.Duration) *tokenCache {
+	return &tokenCache{ttl: ttl, entries: make(map[[sha256.Size]byte]tokenEntry)}
+}
+
+func credentialsKey(user, password string) [sha256.Size]byte {
+	return sha256.Sum256([]byte(user + "\x00" + password))
+}
+
+func (tc *tokenCache) get(user, password string) (string, bool) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	k := credentialsKey(user, password)
+	e, ok := tc.entries[k]
+	if !ok || time.Now().After(e.expires) {
+		delete(tc.entries, k)
+		return "", false
+	}
+	return e.token, true
+}
+
+func (tc *tokenCache) add(user, password, token string) {
+	now := time.Now()
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	for k, e := range tc.entries {
+		if now.After(e.expires) {
+			delete(tc.entries, k)
+		}
+	}
+	tc.entries[credentialsKey(user, password)] = tokenEntry{token: token, expires: now.Add(tc.ttl)}
+}
+
+func (tc *tokenCache) invalidate(user, password string) {
+	tc.mu.Lock()
+	delete(tc.entries, credentialsKey(user, password))
+	tc.mu.Unlock()
+}
@@ -0,0 +1,259 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dashboard
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver"
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver/api/etcdhttp"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+
+	"go.uber.org/zap"
+)
+
+const (
+	PathOverview = "/"
+	PathKeys     = "/keys"
+	PathMetrics  = "/metrics"
+
+	defaultPageSize = 50
+	maxPageSize     = 1000
+	// previewSize 是键列表中值预览的最大字节数
+	previewSize = 128
+)
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+var templates = template.Must(template.New("").Funcs(template.FuncMap{
+	"hex": func(id uint64) string { return strconv.FormatUint(id, 16) },
+}).ParseFS(templateFS, "templates/*.html"))
+
+type dashboard struct {
+	lg     *zap.Logger
+	srv    *etcdserver.EtcdServer
+	tokens *tokenCache
+}
+
+// NewHandler returns the dashboard of the local server.
+func NewHandler(lg *zap.Logger, srv *etcdserver.EtcdServer) http.Handler {
+	if lg == nil {
+		lg = zap.NewNop()
+	}
+	d := &dashboard{lg: lg, srv: srv, tokens: newTokenCache(time.Minute)}
+	mux := http.NewServeMux()
+	mux.HandleFunc(PathOverview, d.serveOverview)
+	mux.HandleFunc(PathKeys, d.serveKeys)
+	mux.HandleFunc(PathMetrics, d.serveMetrics)
+	return mux
+}
+
+// Member is a cluster member shown on the overview.
+type Member struct {
+	ID         uint64   `json:"id"`
+	Name       string   `json:"name"`
+	PeerURLs   []string `json:"peer_urls"`
+	ClientURLs []string `json:"client_urls"`
+	IsLearner  bool     `json:"is_learner"`
+	IsLeader   bool     `json:"is_leader"`
+	IsLocal    bool     `json:"is_local"`
+}
+
+// Alarm is an active alarm shown on the overview.
+type Alarm struct {
+	MemberID uint64 `json:"member_id"`
+	Alarm    string `json:"alarm"`
+}
+
+// Overview is the data of the overview page.
+type Overview struct {
+	ClusterID uint64          `json:"cluster_id"`
+	Version   string          `json:"version"`
+	Health    etcdhttp.Health `json:"health"`
+	Members   []Member        `json:"members"`
+	Alarms    []Alarm         `json:"alarms"`
+}
+
+func (d *dashboard) serveOverview(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != PathOverview {
+		http.NotFound(w, r)
+		return
+	}
+	if !allowGet(w, r) {
+		return
+	}
+	cl := d.srv.Cluster()
+	ov := Overview{
+		ClusterID: uint64(cl.ID()),
+		Health:    etcdhttp.CheckV3Health(d.lg, d.srv, true),
+	}
+	if v := cl.Version(); v != nil {
+		ov.Version = v.String()
+	}
+	leader := d.srv.Leader()
+	for _, m := range cl.Members() {
+		ov.Members = append(ov.Members, Member{
+			ID:         uint64(m.ID),
+			Name:       m.Name,
+			PeerURLs:   m.PeerURLs,
+			ClientURLs: m.ClientURLs,
+			IsLearner:  m.IsLearner,
+			IsLeader:   m.ID == leader,
+			IsLocal:    m.ID == d.srv.ID(),
+		})
+	}
+	for _, a := range d.srv.Alarms() {
+		ov.Alarms = append(ov.Alarms, Alarm{MemberID: a.MemberID, Alarm: a.Alarm.String()})
+	}
+	d.render(w, r, "overview.html", ov)
+}
+
+// KeyValue is a key shown by the key browser.
+type KeyValue struct {
+	Key            string `json:"key"`
+	Value          string `json:"value"`
+	Truncated      bool   `json:"truncated,omitempty"`
+	CreateRevision int64  `json:"create_revision"`
+	ModRevision    int64  `json:"mod_revision"`
+	Version        int64  `json:"version"`
+	Lease          int64  `json:"lease,omitempty"`
+}
+
+// KeyPage is a page of the key browser.
+type KeyPage struct {
+	Prefix   string     `json:"prefix"`
+	From     string     `json:"from,omitempty"`
+	Limit    int64      `json:"limit"`
+	Revision int64      `json:"revision"`
+	Count    int64      `json:"count"`
+	Keys     []KeyValue `json:"keys"`
+	// Next is the start key of the next page; empty on the last page.
+	Next  string `json:"next,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+func (d *dashboard) serveKeys(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+	q := r.URL.Query()
+	page := KeyPage{Prefix: q.Get("prefix"), From: q.Get("from"), Limit: defaultPageSize}
+	if l, err := strconv.ParseInt(q.Get("limit"), 10, 64); err == nil && l > 0 {
+		page.Limit = l
+		if page.Limit > maxPageSize {
+			page.Limit = maxPageSize
+		}
+	}
+
+	key, end := page.Prefix, prefixEnd(page.Prefix)
+	if page.From > key {
+		key = page.From
+	}
+	if key == "" {
+		key = "\x00"
+	}
+	req := &pb.RangeRequest{Key: key, RangeEnd: end, Limit: page.Limit, Serializable: true}
+	resp, err := d.withAuth(w, r, func(ctx context.Context) (*pb.RangeResponse, error) {
+		return d.srv.Range(ctx, req)
+	})
+	switch {
+	case err == errUnauthorized:
+		return
+	case err != nil:
+		page.Error = err.Error()
+	default:
+		page.Revision = resp.Header.Revision
+		page.Count = resp.Count
+		for _, kv := range resp.Kvs {
+			v := KeyValue{
+				Key:            kv.Key,
+				Value:          kv.Value,
+				CreateRevision: kv.CreateRevision,
+				ModRevision:    kv.ModRevision,
+				Version:        kv.Version,
+				Lease:          kv.Lease,
+			}
+			if len(v.Value) > previewSize {
+				v.Value, v.Truncated = v.Value[:previewSize], true
+			}
+			page.Keys = append(page.Keys, v)
+		}
+		if resp.More && len(resp.Kvs) > 0 {
+			page.Next = resp.Kvs[len(resp.Kvs)-1].Key + "\x00"
+		}
+	}
+	d.render(w, r, "keys.html", page)
+}
+
+func (d *dashboard) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+	prefix := r.URL.Query().Get("prefix")
+	if prefix == "" {
+		prefix = "etcd_"
+	}
+	snap, err := gatherMetrics(prefix)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	d.render(w, r, "metrics.html", snap)
+}
+
+func (d *dashboard) render(w http.ResponseWriter, r *http.Request, name string, data interface{}) {
+	if r.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(data); err != nil {
+			d.lg.Warn("failed to encode dashboard page", zap.String("page", name), zap.Error(err))
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := templates.ExecuteTemplate(w, name, data); err != nil {
+		d.lg.Warn("failed to render dashboard page", zap.String("page", name), zap.Error(err))
+	}
+}
+
+func allowGet(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return true
+	}
+	w.Header().Set("Allow", http.MethodGet)
+	http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	return false
+}
+
+// prefixEnd returns the range end of all keys with the prefix.
+func prefixEnd(prefix string) string {
+	if prefix == "" {
+		return "\x00"
+	}
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+	return "\x00"
+}
@@ -0,0 +1,25 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dashboard serves a read-only web UI of the local etcd server.
+//
+// The dashboard shows the cluster members and the local member's health,
+// active alarms, a paginated key browser and a snapshot of the etcd
+// metrics. Every page is also available as JSON with "?format=json".
+//
+// When auth is enabled the key browser asks for HTTP basic credentials and
+// reads keys as that user, so it only shows what the user may read. The
+// other pages do not require credentials; serve the dashboard on a listener
+// reachable only by operators.
+package dashboard
@@ -0,0 +1,83 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dashboard
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// MetricsSnapshot is the data of the metrics page.
+type MetricsSnapshot struct {
+	Prefix  string    `json:"prefix"`
+	Time    time.Time `json:"time"`
+	Metrics []Metric  `json:"metrics"`
+}
+
+// Metric is a metric family of the snapshot.
+type Metric struct {
+	Name    string   `json:"name"`
+	Help    string   `json:"help"`
+	Type    string   `json:"type"`
+	Samples []Sample `json:"samples"`
+}
+
+// Sample is a single series of a metric; histograms and summaries report
+// their count and sum.
+type Sample struct {
+	Labels string  `json:"labels,omitempty"`
+	Value  float64 `json:"value"`
+	Count  uint64  `json:"count,omitempty"`
+}
+
+func gatherMetrics(prefix string) (MetricsSnapshot, error) {
+	mfs, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		return MetricsSnapshot{}, err
+	}
+	snap := MetricsSnapshot{Prefix: prefix, Time: time.Now()}
+	for _, mf := range mfs {
+		if !strings.HasPrefix(mf.GetName(), prefix) {
+			continue
+		}
+		m := Metric{Name: mf.GetName(), Help: mf.GetHelp(), Type: strings.ToLower(mf.GetType().String())}
+		for _, pm := range mf.GetMetric() {
+			labels := make([]string, 0, len(pm.GetLabel()))
+			for _, lp := range pm.GetLabel() {
+				labels = append(labels, lp.GetName()+"="+lp.GetValue())
+			}
+			s := Sample{Labels: strings.Join(labels, ",")}
+			switch {
+			case pm.Counter != nil:
+				s.Value = pm.Counter.GetValue()
+			case pm.Gauge != nil:
+				s.Value = pm.Gauge.GetValue()
+			case pm.Untyped != nil:
+				s.Value = pm.Untyped.GetValue()
+			case pm.Histogram != nil:
+				s.Value, s.Count = pm.Histogram.GetSampleSum(), pm.Histogram.GetSampleCount()
+			case pm.Summary != nil:
+				s.Value, s.Count = pm.Summary.GetSampleSum(), pm.Summary.GetSampleCount()
+			}
+			m.Samples = append(m.Samples, s)
+		}
+		snap.Metrics = append(snap.Metrics, m)
+	}
+	sort.Slice(snap.Metrics, func(i, j int) bool { return snap.Metrics[i].Name < snap.Metrics[j].Name })
+	return snap, nil
+}
@@ -0,0 +1,233 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package discovery 提供可插拔的集群引导发现,成员通过云厂商实例标签、Kubernetes API、
+// DNS SRV或模板文件找到初始成员,不需要手动维护 initial-cluster.
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ls-2018/etcd_cn/client_sdk/pkg/types"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrUnknownProvider = errors.New("discovery: unknown provider")
+	ErrBadParams       = errors.New("discovery: bad provider params")
+	ErrMissingParam    = errors.New("discovery: missing required param")
+	ErrSelfNotFound    = errors.New("discovery: local member not found")
+	ErrTooFewMembers   = errors.New("discovery: too few members found")
+)
+
+const (
+	// ParamExpectedSize 期望的初始集群大小,发现的成员数不足时会一直重试
+	ParamExpectedSize = "expected-size"
+	// ParamTimeout 等待发现完成的最长时间
+	ParamTimeout = "timeout"
+	// ParamPeerPort 拼接peer URL使用的端口
+	ParamPeerPort = "peer-port"
+	// ParamPeerScheme 拼接peer URL使用的scheme
+	ParamPeerScheme = "peer-scheme"
+
+	defaultTimeout    = 5 * time.Minute
+	defaultPeerPort   = "2380"
+	defaultPeerScheme = "http"
+	minRetryInterval  = time.Second
+	maxRetryInterval  = 30 * time.Second
+)
+
+// Member 本地成员信息
+type Member struct {
+	Name     string
+	PeerURLs types.URLs
+}
+
+// Discovery 发现集群初始成员
+type Discovery interface {
+	// Discover 返回当前发现的成员 name -> peer urls
+	Discover(ctx context.Context, self Member) (types.URLsMap, error)
+}
+
+// Factory 根据参数创建 Discovery
+type Factory func(lg *zap.Logger, params Params) (Discovery, error)
+
+var (
+	providersMu sync.RWMutex
+	providers   = map[string]Factory{
+		"dns-srv":    newDNSDiscovery,
+		"ec2":        newEC2Discovery,
+		"gce":        newGCEDiscovery,
+		"kubernetes": newKubernetesDiscovery,
+		"file":       newFileDiscovery,
+	}
+)
+
+// Register 注册一个发现提供者,同名会覆盖
+func Register(name string, f Factory) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	providers[name] = f
+}
+
+// Providers 返回所有已注册的提供者名称
+func Providers() []string {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New 创建指定的发现提供者
+func New(lg *zap.Logger, provider string, params Params) (Discovery, error) {
+	providersMu.RLock()
+	f, ok := providers[provider]
+	providersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q (支持 %s)", ErrUnknownProvider, provider, strings.Join(Providers(), ","))
+	}
+	return f(lg, params)
+}
+
+// Lookup 通过provider发现初始集群,直到发现的成员包含本地成员且数量满足 expected-size
+func Lookup(ctx context.Context, lg *zap.Logger, provider string, params Params, self Member) (types.URLsMap, error) {
+	if lg == nil {
+		lg = zap.NewNop()
+	}
+	d, err := New(lg, provider, params)
+	if err != nil {
+		return nil, err
+	}
+	size, err := params.Int(ParamExpectedSize, 0)
+	if err != nil {
+		return nil, err
+	}
+	timeout, err := params.Duration(ParamTimeout, defaultTimeout)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	interval := minRetryInterval
+	for {
+		urlsmap, derr := d.Discover(ctx, self)
+		if derr == nil {
+			switch {
+			case self.Name != "" && urlsmap[self.Name] == nil:
+				derr = fmt.Errorf("%w: %q", ErrSelfNotFound, self.Name)
+			case len(urlsmap) < size:
+				derr = fmt.Errorf("%w: 发现%d个,期望%d个", ErrTooFewMembers, len(urlsmap), size)
+			default:
+				lg.Info("发现初始集群成员", zap.String("provider", provider), zap.String("initial-cluster", urlsmap.String()))
+				return urlsmap, nil
+			}
+		}
+		lg.Warn("发现初始集群失败,稍后重试", zap.String("provider", provider), zap.Duration("retry-interval", interval), zap.Error(derr))
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("discovery: %s 发现超时: %v", provider, derr)
+		case <-time.After(interval):
+		}
+		if interval *= 2; interval > maxRetryInterval {
+			interval = maxRetryInterval
+		}
+	}
+}
+
+// Params 提供者参数,格式为 "key1=value1;key2=value2"
+type Params map[string]string
+
+// ParseParams 解析提供者参数,值中允许出现 ',' 和 '='
+func ParseParams(s string) (Params, error) {
+	p := Params{}
+	for _, kv := range strings.Split(s, ";") {
+		kv = strings.TrimSpace(kv)
+		if kv == "" {
+			continue
+		}
+		i := strings.Index(kv, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("%w: %q", ErrBadParams, kv)
+		}
+		p[strings.TrimSpace(kv[:i])] = strings.TrimSpace(kv[i+1:])
+	}
+	return p, nil
+}
+
+// Get 返回参数值,不存在时返回默认值
+func (p Params) Get(key, def string) string {
+	if v, ok := p[key]; ok && v != "" {
+		return v
+	}
+	return def
+}
+
+// Require 返回必须的参数值
+func (p Params) Require(key string) (string, error) {
+	v := p[key]
+	if v == "" {
+		return "", fmt.Errorf("%w: %q", ErrMissingParam, key)
+	}
+	return v, nil
+}
+
+func (p Params) Int(key string, def int) (int, error) {
+	v, ok := p[key]
+	if !ok || v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%w: %s=%q", ErrBadParams, key, v)
+	}
+	return n, nil
+}
+
+func (p Params) Duration(key string, def time.Duration) (time.Duration, error) {
+	v, ok := p[key]
+	if !ok || v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%w: %s=%q", ErrBadParams, key, v)
+	}
+	return d, nil
+}
+
+// peerURL 根据主机地址和 peer-scheme/peer-port 参数生成peer URL
+func (p Params) peerURL(host string) (url.URL, error) {
+	u := url.URL{
+		Scheme: p.Get(ParamPeerScheme, defaultPeerScheme),
+		Host:   net.JoinHostPort(host, p.Get(ParamPeerPort, defaultPeerPort)),
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return u, fmt.Errorf("%w: %s=%q", ErrBadParams, ParamPeerScheme, u.Scheme)
+	}
+	return u, nil
+}
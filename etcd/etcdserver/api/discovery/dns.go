@@ -0,0 +1,65 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package discovery
+
+import (
+	"context"
+	"strings"
+
+	"github.com/ls-2018/etcd_cn/client_sdk/pkg/srv"
+	"github.com/ls-2018/etcd_cn/client_sdk/pkg/types"
+	"go.uber.org/zap"
+)
+
+// dnsDiscovery 通过 _etcd-etcd-ssl._tcp / _etcd-etcd._tcp SRV记录发现成员
+//
+//	domain        查询的域名(必须)
+//	service-name  SRV服务名后缀
+type dnsDiscovery struct {
+	lg          *zap.Logger
+	domain      string
+	serviceName string
+}
+
+func newDNSDiscovery(lg *zap.Logger, params Params) (Discovery, error) {
+	domain, err := params.Require("domain")
+	if err != nil {
+		return nil, err
+	}
+	return &dnsDiscovery{lg: lg, domain: domain, serviceName: params.Get("service-name", "")}, nil
+}
+
+func (d *dnsDiscovery) Discover(ctx context.Context, self Member) (types.URLsMap, error) {
+	suffix := ""
+	if d.serviceName != "" {
+		suffix = "-" + d.serviceName
+	}
+	var strs []string
+	for _, s := range []struct{ scheme, service string }{
+		{"https", "etcd-etcd-ssl" + suffix},
+		{"http", "etcd-etcd" + suffix},
+	} {
+		ss, err := srv.GetCluster(s.scheme, s.service, self.Name, d.domain, self.PeerURLs)
+		if err != nil {
+			d.lg.Debug("查询SRV记录失败", zap.String("service", s.service), zap.String("domain", d.domain), zap.Error(err))
+			continue
+		}
+		strs = append(strs, ss...)
+	}
+	if len(strs) == 0 {
+		return types.URLsMap{}, nil
+	}
+	return types.NewURLsMap(strings.Join(strs, ","))
+}
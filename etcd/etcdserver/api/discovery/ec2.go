@@ -0,0 +1,309 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package discovery
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ls-2018/etcd_cn/client_sdk/pkg/types"
+	"go.uber.org/zap"
+)
+
+const ec2MetadataEndpoint = "http://169.254.169.254"
+
+// ec2Discovery 通过 DescribeInstances 查找带有指定标签的运行中实例
+//
+//	tag-key    实例标签名(必须)
+//	tag-value  实例标签值(必须)
+//	name-tag   作为成员名称的标签,默认 Name,没有该标签时使用实例ID
+//	region     默认从实例元数据获取
+//	endpoint   EC2 API地址,默认 https://ec2.<region>.amazonaws.com
+//
+// 凭证优先从 AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY/AWS_SESSION_TOKEN 环境变量读取,否则使用实例角色.
+type ec2Discovery struct {
+	lg       *zap.Logger
+	params   Params
+	tagKey   string
+	tagValue string
+	nameTag  string
+	region   string
+	endpoint string
+	client   *http.Client
+}
+
+func newEC2Discovery(lg *zap.Logger, params Params) (Discovery, error) {
+	d := &ec2Discovery{
+		lg:       lg,
+		params:   params,
+		nameTag:  params.Get("name-tag", "Name"),
+		region:   params.Get("region", os.Getenv("AWS_REGION")),
+		endpoint: params.Get("endpoint", ""),
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+	var err error
+	if d.tagKey, err = params.Require("tag-key"); err != nil {
+		return nil, err
+	}
+	if d.tagValue, err = params.Require("tag-value"); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+type ec2Credentials struct {
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	Token           string `json:"Token"`
+}
+
+type ec2Instance struct {
+	InstanceID       string `xml:"instanceId"`
+	PrivateIPAddress string `xml:"privateIpAddress"`
+	Tags             []struct {
+		Key   string `xml:"key"`
+		Value string `xml:"value"`
+	} `xml:"tagSet>item"`
+}
+
+type ec2DescribeInstancesResponse struct {
+	Reservations []struct {
+		Instances []ec2Instance `xml:"instancesSet>item"`
+	} `xml:"reservationSet>item"`
+	NextToken string `xml:"nextToken"`
+}
+
+func (d *ec2Discovery) Discover(ctx context.Context, self Member) (types.URLsMap, error) {
+	if d.region == "" {
+		region, err := d.metadata(ctx, "/latest/meta-data/placement/region")
+		if err != nil {
+			return nil, fmt.Errorf("discovery: 获取EC2 region失败: %v", err)
+		}
+		d.region = region
+	}
+	if d.endpoint == "" {
+		d.endpoint = "https://ec2." + d.region + ".amazonaws.com"
+	}
+	creds, err := d.credentials(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	urlsmap := types.URLsMap{}
+	nextToken := ""
+	for {
+		q := url.Values{}
+		q.Set("Action", "DescribeInstances")
+		q.Set("Version", "2016-11-15")
+		q.Set("Filter.1.Name", "tag:"+d.tagKey)
+		q.Set("Filter.1.Value.1", d.tagValue)
+		q.Set("Filter.2.Name", "instance-state-name")
+		q.Set("Filter.2.Value.1", "pending")
+		q.Set("Filter.2.Value.2", "running")
+		if nextToken != "" {
+			q.Set("NextToken", nextToken)
+		}
+		var resp ec2DescribeInstancesResponse
+		if err = d.call(ctx, creds, q, &resp); err != nil {
+			return nil, err
+		}
+		for _, r := range resp.Reservations {
+			for _, inst := range r.Instances {
+				if inst.PrivateIPAddress == "" {
+					continue
+				}
+				name := inst.InstanceID
+				for _, t := range inst.Tags {
+					if t.Key == d.nameTag && t.Value != "" {
+						name = t.Value
+					}
+				}
+				u, err := d.params.peerURL(inst.PrivateIPAddress)
+				if err != nil {
+					return nil, err
+				}
+				urlsmap[name] = types.URLs{u}
+			}
+		}
+		if nextToken = resp.NextToken; nextToken == "" {
+			return urlsmap, nil
+		}
+	}
+}
+
+func (d *ec2Discovery) call(ctx context.Context, creds ec2Credentials, q url.Values, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.endpoint+"/?"+awsCanonicalQuery(q), nil)
+	if err != nil {
+		return err
+	}
+	signAWSv4(req, creds, d.region, "ec2", time.Now())
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("discovery: DescribeInstances 返回 %s: %s", resp.Status, b)
+	}
+	return xml.Unmarshal(b, v)
+}
+
+// credentials 从环境变量或实例角色获取凭证
+func (d *ec2Discovery) credentials(ctx context.Context) (ec2Credentials, error) {
+	if id := os.Getenv("AWS_ACCESS_KEY_ID"); id != "" {
+		return ec2Credentials{
+			AccessKeyID:     id,
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			Token:           os.Getenv("AWS_SESSION_TOKEN"),
+		}, nil
+	}
+	const path = "/latest/meta-data/iam/security-credentials/"
+	role, err := d.metadata(ctx, path)
+	if err != nil {
+		return ec2Credentials{}, fmt.Errorf("discovery: 获取EC2实例角色失败: %v", err)
+	}
+	role = strings.TrimSpace(strings.SplitN(role, "\n", 2)[0])
+	b, err := d.metadata(ctx, path+role)
+	if err != nil {
+		return ec2Credentials{}, fmt.Errorf("discovery: 获取EC2实例角色凭证失败: %v", err)
+	}
+	var creds ec2Credentials
+	err = json.Unmarshal([]byte(b), &creds)
+	return creds, err
+}
+
+// metadata 使用 IMDSv2 读取实例元数据
+func (d *ec2Discovery) metadata(ctx context.Context, path string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, ec2MetadataEndpoint+"/latest/api/token", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "60")
+	token, err := doRequest(d.client, req)
+	if err != nil {
+		return "", err
+	}
+	if req, err = http.NewRequestWithContext(ctx, http.MethodGet, ec2MetadataEndpoint+path, nil); err != nil {
+		return "", err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token", token)
+	return doRequest(d.client, req)
+}
+
+func awsCanonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		for _, v := range q[k] {
+			parts = append(parts, awsEscape(k)+"="+awsEscape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func awsEscape(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
+
+// signAWSv4 对不带请求体的请求进行 AWS Signature Version 4 签名
+func signAWSv4(req *http.Request, creds ec2Credentials, region, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.Token != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.Token)
+	}
+
+	headers := map[string]string{"host": req.URL.Host, "x-amz-date": amzDate}
+	if creds.Token != "" {
+		headers["x-amz-security-token"] = creds.Token
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	emptyHash := sha256.Sum256(nil)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		"/",
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(emptyHash[:]),
+	}, "\n")
+	crHash := sha256.Sum256([]byte(canonicalRequest))
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(crHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// doRequest 执行请求并返回响应体,非2xx视为错误
+func doRequest(c *http.Client, req *http.Request) (string, error) {
+	resp, err := c.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode/100 != 2 {
+		return "", fmt.Errorf("%s %s 返回 %s", req.Method, req.URL.Path, resp.Status)
+	}
+	return string(b), nil
+}
@@ -0,0 +1,93 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/ls-2018/etcd_cn/client_sdk/pkg/types"
+	"go.uber.org/zap"
+)
+
+// fileDiscovery 从静态文件读取初始集群,文件内容先按 text/template 渲染,
+// 可使用 {{.Name}}、{{.Hostname}}、{{.Env.XXX}}、{{.PeerURL}};渲染结果每行或以逗号分隔一个 name=url,'#' 开头为注释
+//
+//	path  文件路径(必须)
+type fileDiscovery struct {
+	lg   *zap.Logger
+	path string
+}
+
+func newFileDiscovery(lg *zap.Logger, params Params) (Discovery, error) {
+	path, err := params.Require("path")
+	if err != nil {
+		return nil, err
+	}
+	return &fileDiscovery{lg: lg, path: path}, nil
+}
+
+type fileTemplateData struct {
+	Name     string
+	Hostname string
+	PeerURL  string
+	Env      map[string]string
+}
+
+func (d *fileDiscovery) Discover(ctx context.Context, self Member) (types.URLsMap, error) {
+	b, err := ioutil.ReadFile(d.path)
+	if err != nil {
+		return nil, err
+	}
+	t, err := template.New(d.path).Option("missingkey=error").Parse(string(b))
+	if err != nil {
+		return nil, err
+	}
+	data := fileTemplateData{Name: self.Name, Env: make(map[string]string)}
+	data.Hostname, _ = os.Hostname()
+	if len(self.PeerURLs) > 0 {
+		data.PeerURL = self.PeerURLs[0].String()
+	}
+	for _, kv := range os.Environ() {
+		if i := strings.Index(kv, "="); i > 0 {
+			data.Env[kv[:i]] = kv[i+1:]
+		}
+	}
+	var buf bytes.Buffer
+	if err = t.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+
+	var parts []string
+	for _, line := range strings.Split(buf.String(), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		for _, p := range strings.Split(line, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				parts = append(parts, p)
+			}
+		}
+	}
+	if len(parts) == 0 {
+		return types.URLsMap{}, nil
+	}
+	return types.NewURLsMap(strings.Join(parts, ","))
+}
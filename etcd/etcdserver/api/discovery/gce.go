@@ -0,0 +1,178 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/ls-2018/etcd_cn/client_sdk/pkg/types"
+	"go.uber.org/zap"
+)
+
+const gceMetadataEndpoint = "http://metadata.google.internal/computeMetadata/v1"
+
+// gceDiscovery 通过 Compute Engine API 查找带有指定网络标签或label的运行中实例,成员名称为实例名
+//
+//	tag          实例网络标签
+//	label-key    实例label名
+//	label-value  实例label值
+//	project      默认从实例元数据获取
+//	zone         默认从实例元数据获取
+//	endpoint     Compute API地址,默认 https://compute.googleapis.com/compute/v1
+//
+// tag 和 label-key 至少指定一个,使用实例默认服务账号访问API.
+type gceDiscovery struct {
+	lg         *zap.Logger
+	params     Params
+	tag        string
+	labelKey   string
+	labelValue string
+	project    string
+	zone       string
+	endpoint   string
+	client     *http.Client
+}
+
+func newGCEDiscovery(lg *zap.Logger, params Params) (Discovery, error) {
+	d := &gceDiscovery{
+		lg:         lg,
+		params:     params,
+		tag:        params.Get("tag", ""),
+		labelKey:   params.Get("label-key", ""),
+		labelValue: params.Get("label-value", ""),
+		project:    params.Get("project", ""),
+		zone:       params.Get("zone", ""),
+		endpoint:   params.Get("endpoint", "https://compute.googleapis.com/compute/v1"),
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}
+	if d.tag == "" && d.labelKey == "" {
+		return nil, fmt.Errorf("%w: \"tag\" 或 \"label-key\"", ErrMissingParam)
+	}
+	return d, nil
+}
+
+type gceInstanceList struct {
+	Items []struct {
+		Name   string `json:"name"`
+		Status string `json:"status"`
+		Tags   struct {
+			Items []string `json:"items"`
+		} `json:"tags"`
+		Labels            map[string]string `json:"labels"`
+		NetworkInterfaces []struct {
+			NetworkIP string `json:"networkIP"`
+		} `json:"networkInterfaces"`
+	} `json:"items"`
+	NextPageToken string `json:"nextPageToken"`
+}
+
+func (d *gceDiscovery) Discover(ctx context.Context, self Member) (types.URLsMap, error) {
+	var err error
+	if d.project == "" {
+		if d.project, err = d.metadata(ctx, "/project/project-id"); err != nil {
+			return nil, fmt.Errorf("discovery: 获取GCE project失败: %v", err)
+		}
+	}
+	if d.zone == "" {
+		// 格式为 projects/<num>/zones/<zone>
+		zone, err := d.metadata(ctx, "/instance/zone")
+		if err != nil {
+			return nil, fmt.Errorf("discovery: 获取GCE zone失败: %v", err)
+		}
+		d.zone = path.Base(zone)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	b, err := d.metadata(ctx, "/instance/service-accounts/default/token")
+	if err != nil {
+		return nil, fmt.Errorf("discovery: 获取GCE访问令牌失败: %v", err)
+	}
+	if err = json.Unmarshal([]byte(b), &token); err != nil {
+		return nil, err
+	}
+
+	urlsmap := types.URLsMap{}
+	pageToken := ""
+	for {
+		q := url.Values{}
+		if d.labelKey != "" {
+			q.Set("filter", fmt.Sprintf("labels.%s=%q", d.labelKey, d.labelValue))
+		}
+		if pageToken != "" {
+			q.Set("pageToken", pageToken)
+		}
+		u := fmt.Sprintf("%s/projects/%s/zones/%s/instances?%s", d.endpoint, d.project, d.zone, q.Encode())
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+		body, err := doRequest(d.client, req)
+		if err != nil {
+			return nil, err
+		}
+		var list gceInstanceList
+		if err = json.Unmarshal([]byte(body), &list); err != nil {
+			return nil, err
+		}
+		for _, inst := range list.Items {
+			if inst.Status != "RUNNING" && inst.Status != "STAGING" && inst.Status != "PROVISIONING" {
+				continue
+			}
+			if d.labelKey != "" && inst.Labels[d.labelKey] != d.labelValue {
+				continue
+			}
+			if d.tag != "" && !containsString(inst.Tags.Items, d.tag) {
+				continue
+			}
+			if len(inst.NetworkInterfaces) == 0 || inst.NetworkInterfaces[0].NetworkIP == "" {
+				continue
+			}
+			pu, err := d.params.peerURL(inst.NetworkInterfaces[0].NetworkIP)
+			if err != nil {
+				return nil, err
+			}
+			urlsmap[inst.Name] = types.URLs{pu}
+		}
+		if pageToken = list.NextPageToken; pageToken == "" {
+			return urlsmap, nil
+		}
+	}
+}
+
+func (d *gceDiscovery) metadata(ctx context.Context, p string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, gceMetadataEndpoint+p, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	return doRequest(d.client, req)
+}
+
+func containsString(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
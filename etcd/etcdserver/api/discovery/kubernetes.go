@@ -0,0 +1,150 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package discovery
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ls-2018/etcd_cn/client_sdk/pkg/types"
+	"go.uber.org/zap"
+)
+
+const k8sServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// kubernetesDiscovery 通过 Kubernetes API 列出匹配标签的Pod,成员名称为Pod名,使用Pod内的服务账号访问API
+//
+//	label-selector  Pod标签选择器(必须),例如 app=etcd,tier=db
+//	namespace       默认为Pod所在命名空间
+//	service         headless service名称;设置后peer URL使用 <pod>.<service>.<namespace>.svc.<cluster-domain>,
+//	                否则使用Pod IP
+//	cluster-domain  默认 cluster.local
+type kubernetesDiscovery struct {
+	lg            *zap.Logger
+	params        Params
+	selector      string
+	namespace     string
+	service       string
+	clusterDomain string
+	host          string
+	token         string
+	client        *http.Client
+}
+
+func newKubernetesDiscovery(lg *zap.Logger, params Params) (Discovery, error) {
+	selector, err := params.Require("label-selector")
+	if err != nil {
+		return nil, err
+	}
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("discovery: 不在Kubernetes集群中运行,KUBERNETES_SERVICE_HOST/KUBERNETES_SERVICE_PORT 未设置")
+	}
+	token, err := ioutil.ReadFile(k8sServiceAccountDir + "/token")
+	if err != nil {
+		return nil, err
+	}
+	ca, err := ioutil.ReadFile(k8sServiceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("discovery: 无法解析Kubernetes CA证书")
+	}
+	namespace := params.Get("namespace", "")
+	if namespace == "" {
+		ns, err := ioutil.ReadFile(k8sServiceAccountDir + "/namespace")
+		if err != nil {
+			return nil, err
+		}
+		namespace = strings.TrimSpace(string(ns))
+	}
+	return &kubernetesDiscovery{
+		lg:            lg,
+		params:        params,
+		selector:      selector,
+		namespace:     namespace,
+		service:       params.Get("service", ""),
+		clusterDomain: params.Get("cluster-domain", "cluster.local"),
+		host:          "https://" + net.JoinHostPort(host, port),
+		token:         strings.TrimSpace(string(token)),
+		client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		},
+	}, nil
+}
+
+type k8sPodList struct {
+	Items []struct {
+		Metadata struct {
+			Name              string  `json:"name"`
+			DeletionTimestamp *string `json:"deletionTimestamp"`
+		} `json:"metadata"`
+		Status struct {
+			Phase string `json:"phase"`
+			PodIP string `json:"podIP"`
+		} `json:"status"`
+	} `json:"items"`
+}
+
+func (d *kubernetesDiscovery) Discover(ctx context.Context, self Member) (types.URLsMap, error) {
+	u := fmt.Sprintf("%s/api/v1/namespaces/%s/pods?labelSelector=%s", d.host, url.PathEscape(d.namespace), url.QueryEscape(d.selector))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+d.token)
+	body, err := doRequest(d.client, req)
+	if err != nil {
+		return nil, err
+	}
+	var pods k8sPodList
+	if err = json.Unmarshal([]byte(body), &pods); err != nil {
+		return nil, err
+	}
+
+	urlsmap := types.URLsMap{}
+	for _, pod := range pods.Items {
+		if pod.Metadata.DeletionTimestamp != nil || pod.Status.Phase == "Failed" || pod.Status.Phase == "Succeeded" {
+			continue
+		}
+		host := pod.Status.PodIP
+		if d.service != "" {
+			host = fmt.Sprintf("%s.%s.%s.svc.%s", pod.Metadata.Name, d.service, d.namespace, d.clusterDomain)
+		}
+		if host == "" {
+			// Pod IP 还未分配
+			continue
+		}
+		pu, err := d.params.peerURL(host)
+		if err != nil {
+			return nil, err
+		}
+		urlsmap[pod.Metadata.Name] = types.URLs{pu}
+	}
+	return urlsmap, nil
+}
@@ -35,6 +35,8 @@ const (
 	PathHealth       = "/health"
 	PathProxyMetrics = "/proxy/metrics"
 	PathProxyHealth  = "/proxy/health"
+
+	PathProxyWatchGroups = "/proxy/watch/groups"
 )
 
 // HandleMetricsHealth registers metrics and health handlers.
@@ -57,6 +59,11 @@ func HandlePrometheus(mux *http.ServeMux) {
 	mux.Handle(PathMetrics, promhttp.Handler())
 }
 
+// CheckV3Health checks the health of srv the same way '/health' does, without excluding any alarm.
+func CheckV3Health(lg *zap.Logger, srv *etcdserver.EtcdServer, serializable bool) Health {
+	return checkV3Health(lg, srv, AlarmSet{}, serializable)
+}
+
 // NewHealthHandler handles '/health' requests.
 func NewHealthHandler(lg *zap.Logger, hfunc func(excludedAlarms AlarmSet) Health) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -117,6 +124,8 @@ func init() {
 type Health struct {
 	Health string `json:"health"`
 	Reason string `json:"reason"`
+	// Startup 成员启动未完成时的阶段和进度,用于区分启动缓慢和卡住
+	Startup *etcdserverpb.StartupStatus `json:"startup,omitempty"`
 }
 
 type AlarmSet map[string]struct{}
@@ -146,6 +155,11 @@ func checkHealth(lg *zap.Logger, srv etcdserver.ServerV2, excludedAlarms AlarmSe
 				lg.Debug("/health excluded alarm", zap.String("alarm", v.String()))
 				continue
 			}
+			if v.Alarm == etcdserverpb.AlarmType_UNREACHABLE || v.Alarm == etcdserverpb.AlarmType_TOPOLOGY || v.Alarm == etcdserverpb.AlarmType_BACKUP || v.Alarm == etcdserverpb.AlarmType_CLOCK_SKEW {
+				// 其他成员不可达、拓扑风险、备份失败、时钟偏差不影响本成员的健康状态
+				lg.Debug("/health ignored alarm", zap.String("alarm", v.String()))
+				continue
+			}
 
 			h.Health = "false"
 			switch v.Alarm {
@@ -188,6 +202,13 @@ func checkV2Health(lg *zap.Logger, srv etcdserver.ServerV2, excludedAlarms Alarm
 }
 
 func checkV3Health(lg *zap.Logger, srv *etcdserver.EtcdServer, excludedAlarms AlarmSet, serializable bool) (h Health) {
+	if st := srv.StartupStatus(); st.Phase != etcdserver.StartupPhaseReady {
+		h.Health = "false"
+		h.Reason = fmt.Sprintf("STARTING: %s", st.Phase)
+		h.Startup = st
+		lg.Warn("serving /health false; member is starting", zap.String("phase", st.Phase), zap.Float64("wal-replay-percent", st.WalReplayPercent))
+		return
+	}
 	if h = checkHealth(lg, srv, excludedAlarms, serializable); h.Health != "true" {
 		return
 	}
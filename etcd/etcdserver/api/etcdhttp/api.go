@@ -52,6 +52,7 @@ func newPeerHandler(lg *zap.Logger, s etcdserver.Server, raftHandler http.Handle
 	if leaseHandler != nil {
 		mux.Handle(leasehttp.LeasePrefix, leaseHandler)         // /leases
 		mux.Handle(leasehttp.LeaseInternalPrefix, leaseHandler) // /leases/internal
+		mux.Handle(leasehttp.LeaseBatchPrefix, leaseHandler)    // /leases/batch
 	}
 	if downgradeEnabledHandler != nil {
 		mux.Handle(etcdserver.DowngradeEnabledPath, downgradeEnabledHandler) // /downgrade/enabled
@@ -0,0 +1,137 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package membership
+
+import (
+	"encoding/json"
+
+	"github.com/ls-2018/etcd_cn/client_sdk/pkg/types"
+	"github.com/ls-2018/etcd_cn/raft/raftpb"
+)
+
+// BatchChangeContext 批量成员变更,作为 ConfChangeV2 的Context通过raft提交;
+// ConfChangeV2 没有ID字段,等待变更结果用的请求ID也放在这里
+type BatchChangeContext struct {
+	ID      uint64     `json:"id"`
+	Add     []Member   `json:"add,omitempty"`
+	Promote []types.ID `json:"promote,omitempty"`
+	Remove  []types.ID `json:"remove,omitempty"`
+}
+
+// ConfChange 返回对应的raft配置变更;总是进入联合共识,提交后由leader自动离开
+func (bc *BatchChangeContext) ConfChange() (raftpb.ConfChangeV2, error) {
+	b, err := json.Marshal(bc)
+	if err != nil {
+		return raftpb.ConfChangeV2{}, err
+	}
+	cc := raftpb.ConfChangeV2{
+		Transition: raftpb.ConfChangeTransitionJointImplicit,
+		Context:    string(b),
+	}
+	for _, m := range bc.Add {
+		t := raftpb.ConfChangeAddNode
+		if m.IsLearner {
+			t = raftpb.ConfChangeAddLearnerNode
+		}
+		cc.Changes = append(cc.Changes, raftpb.ConfChangeSingle{Type: t, NodeID: uint64(m.ID)})
+	}
+	for _, id := range bc.Promote {
+		cc.Changes = append(cc.Changes, raftpb.ConfChangeSingle{Type: raftpb.ConfChangeAddNode, NodeID: uint64(id)})
+	}
+	for _, id := range bc.Remove {
+		cc.Changes = append(cc.Changes, raftpb.ConfChangeSingle{Type: raftpb.ConfChangeRemoveNode, NodeID: uint64(id)})
+	}
+	return cc, nil
+}
+
+// ValidateBatchChange 和 ValidateConfigurationChange 相同的检查,作用于变更后的整个成员集合
+func (c *RaftCluster) ValidateBatchChange(bc *BatchChangeContext) error {
+	if len(bc.Add)+len(bc.Promote)+len(bc.Remove) == 0 {
+		return ErrBadBatchChange
+	}
+	members, removed := membersFromStore(c.lg, c.v2store)
+	seen := make(map[types.ID]bool)
+	for _, id := range append(append([]types.ID(nil), bc.Promote...), bc.Remove...) {
+		if seen[id] {
+			return ErrBadBatchChange
+		}
+		seen[id] = true
+		if removed[id] {
+			return ErrIDRemoved
+		}
+		if members[id] == nil {
+			return ErrIDNotFound
+		}
+	}
+	for _, id := range bc.Promote {
+		if !members[id].IsLearner {
+			return ErrMemberNotLearner
+		}
+	}
+
+	urls := make(map[string]bool)
+	for _, m := range members {
+		for _, u := range m.PeerURLs {
+			urls[u] = true
+		}
+	}
+	numLearners := 0
+	for id, m := range members {
+		if m.IsLearner && !seen[id] {
+			numLearners++
+		}
+	}
+	for _, m := range bc.Add {
+		if seen[m.ID] {
+			return ErrBadBatchChange
+		}
+		seen[m.ID] = true
+		if removed[m.ID] {
+			return ErrIDRemoved
+		}
+		if members[m.ID] != nil {
+			return ErrIDExists
+		}
+		// 新成员之间的peer地址也不能重复
+		for _, u := range m.PeerURLs {
+			if urls[u] {
+				return ErrPeerURLexists
+			}
+			urls[u] = true
+		}
+		if m.IsLearner {
+			numLearners++
+		}
+	}
+	if numLearners > maxLearners {
+		return ErrTooManyLearners
+	}
+
+	voters := 0
+	for id, m := range members {
+		if !seen[id] && !m.IsLearner {
+			voters++
+		}
+	}
+	for _, m := range bc.Add {
+		if !m.IsLearner {
+			voters++
+		}
+	}
+	if voters+len(bc.Promote) == 0 {
+		return ErrBadBatchChange
+	}
+	return nil
+}
@@ -27,6 +27,8 @@ var (
 	ErrPeerURLexists    = errors.New("membership: peerURL 已存在")
 	ErrMemberNotLearner = errors.New("membership: 只能提升一个learner成员")
 	ErrTooManyLearners  = errors.New("membership: 集群中成员太多")
+	ErrBadLabels        = errors.New("membership: 成员标签不合法")
+	ErrBadBatchChange   = errors.New("membership: 批量成员变更不合法")
 )
 
 func isKeyNotFound(err error) bool {
@@ -0,0 +1,65 @@
+// Copyright 2016 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package membership
+
+import "strings"
+
+const (
+	// 常用的成员标签
+	LabelZone = "zone"
+	LabelRack = "rack"
+	LabelRole = "role"
+	// LabelReplaces 标记learner用来替换哪个成员,值为被替换成员的名称或ID
+	LabelReplaces = "replaces"
+
+	maxLabels           = 32
+	maxLabelKeyLength   = 63
+	maxLabelValueLength = 253
+)
+
+// ValidateLabels 检查成员标签是否合法
+func ValidateLabels(labels map[string]string) error {
+	if len(labels) > maxLabels {
+		return ErrBadLabels
+	}
+	for k, v := range labels {
+		if len(k) == 0 || len(k) > maxLabelKeyLength || len(v) > maxLabelValueLength {
+			return ErrBadLabels
+		}
+		if strings.ContainsAny(k, "=, \t\n") {
+			return ErrBadLabels
+		}
+	}
+	return nil
+}
+
+// MergeLabels 将 update 合并到 cur 中,返回新的标签;update中值为空的标签会被删除
+func MergeLabels(cur, update map[string]string) map[string]string {
+	merged := make(map[string]string, len(cur)+len(update))
+	for k, v := range cur {
+		merged[k] = v
+	}
+	for k, v := range update {
+		if v == "" {
+			delete(merged, k)
+			continue
+		}
+		merged[k] = v
+	}
+	if len(merged) == 0 {
+		return nil
+	}
+	return merged
+}
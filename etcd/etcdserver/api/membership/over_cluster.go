@@ -256,23 +256,25 @@ func (c *RaftCluster) genID() {
 	c.cid = types.ID(binary.BigEndian.Uint64(hash[:8]))
 }
 
-// UpdateRaftAttributes 节点的属性更新
+// UpdateRaftAttributes 节点的属性更新;raftAttr中的标签是增量,在apply时合并到现有标签上
 func (c *RaftCluster) UpdateRaftAttributes(id types.ID, raftAttr RaftAttributes, shouldApplyV3 ShouldApplyV3) {
 	c.Lock()
 	defer c.Unlock()
 
+	raftAttr.Labels = MergeLabels(c.members[id].Labels, raftAttr.Labels)
 	c.members[id].RaftAttributes = raftAttr
 	if c.v2store != nil {
 		mustUpdateMemberInStore(c.lg, c.v2store, c.members[id])
 	}
 	if c.be != nil && shouldApplyV3 {
-		unsafeSaveMemberToBackend(c.lg, c.be, c.members[id])
+		unsafeUpdateMemberInBackend(c.lg, c.be, c.members[id])
 	}
 
 	c.lg.Info("更新成员属性", zap.String("cluster-id", c.cid.String()),
 		zap.String("local-member-id", c.localID.String()),
 		zap.String("updated-remote-peer-id", id.String()),
 		zap.Strings("updated-remote-peer-urls", raftAttr.PeerURLs),
+		zap.Any("updated-remote-peer-labels", raftAttr.Labels),
 	)
 }
 
@@ -332,6 +334,22 @@ func (c *RaftCluster) VotingMembers() []*Member {
 	return []*Member(ms)
 }
 
+// MembersWithLabel 返回带有指定标签的成员;value为空时只要求存在该标签
+func (c *RaftCluster) MembersWithLabel(key, value string) []*Member {
+	c.Lock()
+	defer c.Unlock()
+	var ms MembersByID
+	for _, m := range c.members {
+		v, ok := m.Labels[key]
+		if !ok || (value != "" && v != value) {
+			continue
+		}
+		ms = append(ms, m.Clone())
+	}
+	sort.Sort(ms)
+	return []*Member(ms)
+}
+
 // Version 集群版本
 func (c *RaftCluster) Version() *semver.Version {
 	c.Lock()
@@ -388,6 +406,22 @@ func NewClusterFromURLsMap(lg *zap.Logger, token string, urlsmap types.URLsMap)
 	return c, nil
 }
 
+// NewClusterFromMemberList 用已经确定ID的成员创建集群,集群ID与 NewClusterFromURLsMap 一样由成员ID生成
+func NewClusterFromMemberList(lg *zap.Logger, membs []*Member) (*RaftCluster, error) {
+	c := NewCluster(lg)
+	for _, m := range membs {
+		if _, ok := c.members[m.ID]; ok {
+			return nil, fmt.Errorf("成员ID重复 %s", m.ID)
+		}
+		if uint64(m.ID) == raft.None {
+			return nil, fmt.Errorf("不能使用 %x作为成员ID", raft.None)
+		}
+		c.members[m.ID] = m
+	}
+	c.genID()
+	return c, nil
+}
+
 // PeerURLs 返回所有成员的通信地址
 func (c *RaftCluster) PeerURLs() []string {
 	c.Lock()
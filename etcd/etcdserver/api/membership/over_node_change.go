@@ -25,8 +25,9 @@ type Member struct {
 
 // RaftAttributes  与raft相关的etcd成员属性
 type RaftAttributes struct {
-	PeerURLs  []string `json:"peerURLs"`            // 是raft集群中的对等体列表.
-	IsLearner bool     `json:"isLearner,omitempty"` // 表示该成员是否是raft Learner.
+	PeerURLs  []string          `json:"peerURLs"`            // 是raft集群中的对等体列表.
+	IsLearner bool              `json:"isLearner,omitempty"` // 表示该成员是否是raft Learner.
+	Labels    map[string]string `json:"labels,omitempty"`    // 成员的标签,如 zone、rack、role
 }
 
 // Attributes 代表一个etcd成员的所有非raft的相关属性.
@@ -271,9 +272,21 @@ func (m *Member) Clone() *Member {
 		mm.ClientURLs = make([]string, len(m.ClientURLs))
 		copy(mm.ClientURLs, m.ClientURLs)
 	}
+	if m.Labels != nil {
+		mm.Labels = make(map[string]string, len(m.Labels))
+		for k, v := range m.Labels {
+			mm.Labels[k] = v
+		}
+	}
 	return mm
 }
 
+// Label 返回成员指定标签的值
+func (m *Member) Label(key string) (string, bool) {
+	v, ok := m.Labels[key]
+	return v, ok
+}
+
 func (m *Member) IsStarted() bool {
 	return len(m.Name) != 0
 }
@@ -153,6 +153,20 @@ func unsafeSaveMemberToBackend(lg *zap.Logger, be backend.Backend, m *Member) er
 	return nil
 }
 
+// 覆盖bolt.db中已有的member信息
+func unsafeUpdateMemberInBackend(lg *zap.Logger, be backend.Backend, m *Member) {
+	mkey := backendMemberKey(m.ID)
+	mvalue, err := json.Marshal(m)
+	if err != nil {
+		lg.Panic("序列化失败", zap.Error(err))
+	}
+
+	tx := be.BatchTx()
+	tx.Lock()
+	defer tx.Unlock()
+	tx.UnsafePut(buckets.Members, mkey, mvalue)
+}
+
 // MemberStoreKey 15   ----->  /0/members/e
 func MemberStoreKey(id types.ID) string {
 	return path.Join(StoreMembersPrefix, id.String()) // /0/members/e
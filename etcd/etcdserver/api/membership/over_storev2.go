@@ -16,6 +16,11 @@ package membership
 
 import (
 	"github.com/ls-2018/etcd_cn/etcd/etcdserver/api/v2store"
+	"github.com/ls-2018/etcd_cn/etcd/mvcc/backend"
+	"github.com/ls-2018/etcd_cn/etcd/mvcc/buckets"
+
+	"github.com/coreos/go-semver/semver"
+	"go.uber.org/zap"
 )
 
 // IsMetaStoreOnly 验证给定的`store`是否只包含元信息(成员,版本);可以从后端(storev3)恢复,而不是用户数据.
@@ -32,3 +37,31 @@ func IsMetaStoreOnly(store v2store.Store) (bool, error) {
 
 	return true, nil
 }
+
+// MigrateV2StoreToBackend 以v2store为准把成员、已移除成员和集群版本写入后端,后端中多出的成员会被删除.
+func MigrateV2StoreToBackend(lg *zap.Logger, st v2store.Store, be backend.Backend) (members, removed int, ver *semver.Version) {
+	ms, rms := membersFromStore(lg, st)
+	mustCreateBackendBuckets(be)
+	bms, _ := mustReadMembersFromBackend(lg, be)
+	for id := range bms {
+		if _, ok := ms[id]; !ok {
+			tx := be.BatchTx()
+			tx.Lock()
+			tx.UnsafeDelete(buckets.Members, backendMemberKey(id))
+			tx.Unlock()
+		}
+	}
+	for _, m := range ms {
+		unsafeUpdateMemberInBackend(lg, be, m)
+	}
+	tx := be.BatchTx()
+	tx.Lock()
+	for id := range rms {
+		tx.UnsafePut(buckets.MembersRemoved, backendMemberKey(id), []byte("removed"))
+	}
+	tx.Unlock()
+	if ver = clusterVersionFromStore(lg, st); ver != nil {
+		mustSaveClusterVersionToBackend(be, ver)
+	}
+	return len(ms), len(rms), ver
+}
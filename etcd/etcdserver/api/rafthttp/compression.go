@@ -0,0 +1,328 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rafthttp
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/grpc/encoding"
+	grpcgzip "google.golang.org/grpc/encoding/gzip"
+)
+
+const (
+	// CompressionNone 消息流不压缩
+	CompressionNone = "none"
+	// CompressionGzip 消息流使用gzip(最快压缩级别),gRPC流使用gRPC自带的gzip压缩
+	CompressionGzip = "gzip"
+	// CompressionSnappy 消息流使用snappy的分帧格式,压缩率低但CPU开销最小
+	CompressionSnappy = "snappy"
+	// CompressionZstd 消息流使用zstd(最快压缩级别),压缩率接近gzip而CPU开销更小
+	CompressionZstd = "zstd"
+)
+
+func init() {
+	// gRPC流按名字选择压缩方式,收发双方都需要注册
+	encoding.RegisterCompressor(&snappyCompressor{})
+	encoding.RegisterCompressor(&zstdCompressor{})
+}
+
+// PeerCompression 按对端peer URL选择从对端接收的消息流是否压缩.
+// 压缩由接收方在建立流时请求,发送方支持时才压缩,不支持的旧版本成员按不压缩处理.
+type PeerCompression struct {
+	// Default 没有单独配置的peer URL使用的压缩方式
+	Default string
+	// URLs 按peer URL单独配置的压缩方式
+	URLs map[string]string
+}
+
+// ParsePeerCompression 解析压缩配置,例如 "zstd" 或 "*=none,https://10.0.1.10:2380=gzip",
+// "*" 表示没有单独配置的peer URL.
+func ParsePeerCompression(s string) (PeerCompression, error) {
+	pc := PeerCompression{Default: CompressionNone, URLs: make(map[string]string)}
+	if s == "" {
+		return pc, nil
+	}
+	if !strings.Contains(s, "=") {
+		if err := checkCompression(s); err != nil {
+			return pc, err
+		}
+		pc.Default = s
+		return pc, nil
+	}
+	for _, kv := range strings.Split(s, ",") {
+		i := strings.LastIndex(kv, "=")
+		if i < 0 {
+			return pc, fmt.Errorf("无效的压缩配置 %q, 应该是 <peer-url>=<压缩方式>", kv)
+		}
+		u, c := strings.TrimSpace(kv[:i]), strings.TrimSpace(kv[i+1:])
+		if err := checkCompression(c); err != nil {
+			return pc, err
+		}
+		if u == "*" {
+			pc.Default = c
+			continue
+		}
+		if _, err := url.Parse(u); err != nil {
+			return pc, fmt.Errorf("无效的peer URL %q: %v", u, err)
+		}
+		pc.URLs[u] = c
+	}
+	return pc, nil
+}
+
+func checkCompression(c string) error {
+	switch c {
+	case CompressionNone, CompressionGzip, CompressionSnappy, CompressionZstd:
+		return nil
+	}
+	return fmt.Errorf("不支持的压缩方式 %q, 只能是 %q、%q、%q 或 %q",
+		c, CompressionNone, CompressionGzip, CompressionSnappy, CompressionZstd)
+}
+
+// grpcCompressor 返回gRPC流使用的压缩器名字,不压缩时返回空
+func grpcCompressor(c string) string {
+	switch c {
+	case CompressionGzip:
+		return grpcgzip.Name
+	case CompressionSnappy, CompressionZstd:
+		return c
+	}
+	return ""
+}
+
+// forURL 返回从u接收消息流时请求的压缩方式
+func (pc PeerCompression) forURL(u url.URL) string {
+	if c, ok := pc.URLs[u.String()]; ok {
+		return c
+	}
+	if pc.Default == "" {
+		return CompressionNone
+	}
+	return pc.Default
+}
+
+// streamBatch 发送MsgApp时合并写出的时间和字节数上限;interval为0时发送队列一空就写出
+type streamBatch struct {
+	interval time.Duration
+	bytes    int
+}
+
+// flushWriter 可以把已经写入的数据压缩刷出的写入器
+type flushWriter interface {
+	io.Writer
+	Flush() error
+}
+
+// compressFlushWriter 压缩写入http响应,Flush时先把压缩数据刷出再刷新连接
+type compressFlushWriter struct {
+	cw flushWriter
+	f  http.Flusher
+}
+
+// newCompressFlushWriter 按压缩方式c压缩写入w,c为none或不支持时返回nil
+func newCompressFlushWriter(c string, w io.Writer, f http.Flusher) *compressFlushWriter {
+	var cw flushWriter
+	switch c {
+	case CompressionGzip:
+		cw, _ = gzip.NewWriterLevel(w, gzip.BestSpeed)
+	case CompressionSnappy:
+		cw = snappy.NewBufferedWriter(w)
+	case CompressionZstd:
+		cw, _ = zstd.NewWriter(w, zstdEncoderOptions...)
+	default:
+		return nil
+	}
+	return &compressFlushWriter{cw: cw, f: f}
+}
+
+func (w *compressFlushWriter) Write(p []byte) (int, error) { return w.cw.Write(p) }
+
+func (w *compressFlushWriter) Flush() {
+	if err := w.cw.Flush(); err != nil {
+		return
+	}
+	w.f.Flush()
+}
+
+// decompressReadCloser 解压响应体,关闭时释放解压器并关闭原来的响应体
+type decompressReadCloser struct {
+	io.Reader
+	release func()
+	body    io.Closer
+}
+
+// newDecompressReadCloser 按压缩方式c解压body,c为none或不支持时原样返回body
+func newDecompressReadCloser(c string, body io.ReadCloser) (io.ReadCloser, error) {
+	rc := &decompressReadCloser{body: body}
+	switch c {
+	case CompressionGzip:
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		gz.Multistream(false)
+		rc.Reader = gz
+	case CompressionSnappy:
+		rc.Reader = snappy.NewReader(body)
+	case CompressionZstd:
+		d, err := zstd.NewReader(body, zstdDecoderOptions...)
+		if err != nil {
+			return nil, err
+		}
+		rc.Reader, rc.release = d, d.Close
+	default:
+		return body, nil
+	}
+	return rc, nil
+}
+
+func (r *decompressReadCloser) Close() error {
+	err := r.body.Close()
+	if r.release != nil {
+		r.release()
+	}
+	return err
+}
+
+var (
+	// 每个流一个编码器,只用一个协程,窗口限制在1MB以减少每个流占用的内存
+	zstdEncoderOptions = []zstd.EOption{
+		zstd.WithEncoderLevel(zstd.SpeedFastest),
+		zstd.WithEncoderConcurrency(1),
+		zstd.WithWindowSize(1 << 20),
+	}
+	// 同步解码,读到一个完整的块就返回,不会为了预读而阻塞
+	zstdDecoderOptions = []zstd.DOption{
+		zstd.WithDecoderConcurrency(1),
+	}
+)
+
+// snappyCompressor gRPC流使用的snappy压缩器,编码器和解码器都复用
+type snappyCompressor struct {
+	writers sync.Pool // *snappyWriter
+	readers sync.Pool // *snappyReader
+}
+
+type snappyWriter struct {
+	*snappy.Writer
+	pool *sync.Pool
+}
+
+type snappyReader struct {
+	*snappy.Reader
+	pool *sync.Pool
+}
+
+func (c *snappyCompressor) Name() string { return CompressionSnappy }
+
+func (c *snappyCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	sw, ok := c.writers.Get().(*snappyWriter)
+	if !ok {
+		return &snappyWriter{Writer: snappy.NewBufferedWriter(w), pool: &c.writers}, nil
+	}
+	sw.Reset(w)
+	return sw, nil
+}
+
+func (w *snappyWriter) Close() error {
+	defer w.pool.Put(w)
+	return w.Writer.Close()
+}
+
+func (c *snappyCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	sr, ok := c.readers.Get().(*snappyReader)
+	if !ok {
+		return &snappyReader{Reader: snappy.NewReader(r), pool: &c.readers}, nil
+	}
+	sr.Reset(r)
+	return sr, nil
+}
+
+func (r *snappyReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err == io.EOF {
+		r.pool.Put(r)
+	}
+	return n, err
+}
+
+// zstdCompressor gRPC流使用的zstd压缩器,编码器和解码器都复用
+type zstdCompressor struct {
+	writers sync.Pool // *zstdWriter
+	readers sync.Pool // *zstdReader
+}
+
+type zstdWriter struct {
+	*zstd.Encoder
+	pool *sync.Pool
+}
+
+type zstdReader struct {
+	*zstd.Decoder
+	pool *sync.Pool
+}
+
+func (c *zstdCompressor) Name() string { return CompressionZstd }
+
+func (c *zstdCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	zw, ok := c.writers.Get().(*zstdWriter)
+	if !ok {
+		e, err := zstd.NewWriter(w, zstdEncoderOptions...)
+		if err != nil {
+			return nil, err
+		}
+		return &zstdWriter{Encoder: e, pool: &c.writers}, nil
+	}
+	zw.Reset(w)
+	return zw, nil
+}
+
+func (w *zstdWriter) Close() error {
+	defer w.pool.Put(w)
+	return w.Encoder.Close()
+}
+
+func (c *zstdCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	zr, ok := c.readers.Get().(*zstdReader)
+	if !ok {
+		d, err := zstd.NewReader(r, zstdDecoderOptions...)
+		if err != nil {
+			return nil, err
+		}
+		return &zstdReader{Decoder: d, pool: &c.readers}, nil
+	}
+	if err := zr.Reset(r); err != nil {
+		c.readers.Put(zr)
+		return nil, err
+	}
+	return zr, nil
+}
+
+func (r *zstdReader) Read(p []byte) (int, error) {
+	n, err := r.Decoder.Read(p)
+	if err == io.EOF {
+		r.pool.Put(r)
+	}
+	return n, err
+}
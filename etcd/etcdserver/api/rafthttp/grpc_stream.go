@@ -0,0 +1,442 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rafthttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ls-2018/etcd_cn/client_sdk/pkg/types"
+	stats "github.com/ls-2018/etcd_cn/etcd/etcdserver/api/v2stats"
+	"github.com/ls-2018/etcd_cn/offical/api/v3/version"
+	"github.com/ls-2018/etcd_cn/raft/raftpb"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// PeerTransportHTTP raft消息流使用HTTP/1长连接,每类消息一个TCP连接
+	PeerTransportHTTP = "http"
+	// PeerTransportGRPC raft消息流使用peer端口上的gRPC流,两类消息复用一个HTTP/2连接
+	PeerTransportGRPC = "grpc"
+
+	// StreamMethod raft消息流的gRPC方法名
+	StreamMethod = "/rafthttp.Raft/Stream"
+
+	// 对端不支持gRPC消息流(旧版本)时,在这段时间内直接使用HTTP流
+	grpcFallbackInterval = time.Minute
+	// 每个流、每个连接的HTTP/2接收窗口;高延迟链路上更大的窗口可以提高吞吐
+	grpcStreamWindowSize = 1 << 20
+	grpcConnWindowSize   = 4 << 20
+)
+
+var errGRPCStreamUnsupported = errors.New("对端不支持gRPC消息流")
+
+// raftStreamServer 接收其他成员建立的gRPC消息流
+type raftStreamServer interface {
+	serveStream(ss grpc.ServerStream) error
+}
+
+var raftStreamServiceDesc = grpc.ServiceDesc{
+	ServiceName: "rafthttp.Raft",
+	HandlerType: (*raftStreamServer)(nil),
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName: "Stream",
+			Handler: func(srv interface{}, ss grpc.ServerStream) error {
+				return srv.(raftStreamServer).serveStream(ss)
+			},
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+}
+
+// RegisterGRPC 在peer端口的gRPC服务上注册raft消息流.不论本地使用哪种传输都注册,
+// 滚动切换期间已经切到gRPC的成员可以连进来,本地读取仍按 PeerTransport 选择.
+func (t *Transport) RegisterGRPC(gs *grpc.Server) {
+	h := &grpcStreamHandler{
+		lg:         t.Logger,
+		tr:         t,
+		peerGetter: t,
+		r:          t.Raft,
+		id:         t.ID,
+		cid:        t.ClusterID,
+	}
+	if h.lg == nil {
+		h.lg = zap.NewNop()
+	}
+	gs.RegisterService(&raftStreamServiceDesc, h)
+}
+
+type grpcStreamHandler struct {
+	lg         *zap.Logger
+	tr         *Transport
+	peerGetter peerGetter
+	r          Raft
+	id         types.ID
+	cid        types.ID
+}
+
+// serveStream 与 streamHandler.ServeHTTP 相同的检查,请求头放在gRPC元数据中
+func (h *grpcStreamHandler) serveStream(ss grpc.ServerStream) error {
+	header := make(http.Header)
+	if md, ok := metadata.FromIncomingContext(ss.Context()); ok {
+		for k, vs := range md {
+			for _, v := range vs {
+				header.Add(k, v)
+			}
+		}
+	}
+	if err := checkClusterCompatibilityFromHeader(h.lg, h.tr.ID, header, h.cid); err != nil {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	var t streamType
+	switch streamType(header.Get("X-Stream-Type")) {
+	case streamTypeMsgAppV2:
+		t = streamTypeMsgAppV2
+	case streamTypeMessage:
+		t = streamTypeMessage
+	default:
+		return status.Errorf(codes.InvalidArgument, "无效的流类型 %q", header.Get("X-Stream-Type"))
+	}
+
+	from, err := types.IDFromString(header.Get("X-Server-From"))
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "invalid from")
+	}
+	if h.r.IsIDRemoved(uint64(from)) {
+		h.lg.Warn(
+			"拒绝gRPC流,该节点已被移除",
+			zap.String("local-member-id", h.tr.ID.String()),
+			zap.String("remote-peer-id-from", from.String()),
+		)
+		return status.Error(codes.PermissionDenied, errMemberRemoved.Error())
+	}
+	p := h.peerGetter.Get(from)
+	if p == nil {
+		if urls := header.Get("X-PeerURLs"); urls != "" {
+			h.tr.AddRemote(from, strings.Split(urls, ","))
+		}
+		h.lg.Warn(
+			"在集群中没有找到远端节点",
+			zap.String("local-member-id", h.tr.ID.String()),
+			zap.String("remote-peer-id-from", from.String()),
+			zap.String("cluster-id", h.cid.String()),
+		)
+		return status.Error(codes.NotFound, "发送方没有发现该节点")
+	}
+	if gto := header.Get("X-Raft-To"); gto != h.id.String() {
+		h.lg.Warn(
+			"忽略gRPC流请求; ID 不匹配",
+			zap.String("local-member-id", h.tr.ID.String()),
+			zap.String("remote-peer-id-header", gto),
+			zap.String("remote-peer-id-from", from.String()),
+		)
+		return status.Error(codes.FailedPrecondition, "to field mismatch")
+	}
+
+	if err := ss.SendHeader(metadata.Pairs(
+		"x-server-version", version.Version,
+		"x-etcd-cluster-id", h.cid.String(),
+	)); err != nil {
+		return err
+	}
+
+	c := newCloseNotifier()
+	p.attachOutgoingConn(&outgoingConn{
+		t:       t,
+		Flusher: nopFlusher{},
+		Closer:  c,
+		ss:      ss,
+		localID: h.tr.ID,
+		peerID:  from,
+	})
+	// 只有streamWriter会在流上发送,必须等它放弃这个连接之后才能返回
+	<-c.closeNotify()
+	return nil
+}
+
+type nopFlusher struct{}
+
+func (nopFlusher) Flush() {}
+
+// grpcStreamEncoder 把raft消息逐条发送到gRPC流,gRPC自己合并写出
+type grpcStreamEncoder struct {
+	ss grpc.ServerStream
+	fs *stats.FollowerStats
+}
+
+func (enc *grpcStreamEncoder) encode(m *raftpb.Message) error {
+	start := time.Now()
+	if err := enc.ss.SendMsg(m); err != nil {
+		return err
+	}
+	if enc.fs != nil && m.Type == raftpb.MsgApp {
+		enc.fs.Succ(time.Since(start))
+	}
+	return nil
+}
+
+// grpcStreamDecoder 从gRPC流读取raft消息;超过 ConnReadTimeout 没有收到消息(包括链路心跳)就关闭流
+type grpcStreamDecoder struct {
+	cs     grpc.ClientStream
+	cancel context.CancelFunc
+	timer  *time.Timer
+}
+
+func newGRPCStreamDecoder(cs grpc.ClientStream, cancel context.CancelFunc) *grpcStreamDecoder {
+	return &grpcStreamDecoder{cs: cs, cancel: cancel, timer: time.AfterFunc(ConnReadTimeout, cancel)}
+}
+
+func (dec *grpcStreamDecoder) decode() (raftpb.Message, error) {
+	var m raftpb.Message
+	dec.timer.Reset(ConnReadTimeout)
+	err := dec.cs.RecvMsg(&m)
+	return m, err
+}
+
+func (dec *grpcStreamDecoder) Close() error {
+	dec.timer.Stop()
+	dec.cancel()
+	return nil
+}
+
+// grpcCodec 和peer端gRPC服务一样,直接使用raft消息自带的 Marshal/Unmarshal
+type grpcCodec struct{}
+
+type selfMarshaler interface {
+	Marshal() ([]byte, error)
+	Unmarshal([]byte) error
+}
+
+func (grpcCodec) Marshal(v interface{}) ([]byte, error) { return v.(selfMarshaler).Marshal() }
+
+func (grpcCodec) Unmarshal(data []byte, v interface{}) error {
+	return v.(selfMarshaler).Unmarshal(data)
+}
+
+func (grpcCodec) Name() string { return "proto" }
+
+// grpcStreamDialer 为一个远端成员维护gRPC连接;两类消息流复用同一个HTTP/2连接,各自有独立的流控窗口
+type grpcStreamDialer struct {
+	tr *Transport
+
+	mu            sync.Mutex
+	u             url.URL
+	cc            *grpc.ClientConn
+	unsupportedAt time.Time
+}
+
+func newGRPCStreamDialer(t *Transport) *grpcStreamDialer {
+	return &grpcStreamDialer{tr: t}
+}
+
+// enabled 对端最近报告过不支持gRPC消息流时返回false
+func (d *grpcStreamDialer) enabled() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return time.Since(d.unsupportedAt) >= grpcFallbackInterval
+}
+
+func (d *grpcStreamDialer) markUnsupported() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.unsupportedAt = time.Now()
+}
+
+// conn 返回到u的连接,地址变化时重新建立
+func (d *grpcStreamDialer) conn(u url.URL) (*grpc.ClientConn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.cc != nil && d.u == u {
+		return d.cc, nil
+	}
+	d.closeUnlocked()
+
+	network := "tcp"
+	if u.Scheme == "unix" || u.Scheme == "unixs" {
+		network = "unix"
+	}
+	dialTimeout := d.tr.DialTimeout
+	bc := backoff.DefaultConfig
+	bc.MaxDelay = time.Second
+	opts := []grpc.DialOption{
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			dialer := &net.Dialer{Timeout: dialTimeout}
+			return dialer.DialContext(ctx, network, addr)
+		}),
+		grpc.WithConnectParams(grpc.ConnectParams{Backoff: bc, MinConnectTimeout: dialTimeout}),
+		grpc.WithInitialWindowSize(grpcStreamWindowSize),
+		grpc.WithInitialConnWindowSize(grpcConnWindowSize),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(grpcCodec{}), grpc.MaxCallRecvMsgSize(math.MaxInt32)),
+	}
+	if u.Scheme == "https" || u.Scheme == "unixs" {
+		// 与HTTP流使用同一套peer证书
+		cfg, err := d.tr.TLSInfo.ClientConfig()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(cfg)))
+	} else {
+		opts = append(opts, grpc.WithInsecure())
+	}
+	cc, err := grpc.Dial("passthrough:///"+u.Host, opts...)
+	if err != nil {
+		return nil, err
+	}
+	d.u, d.cc = u, cc
+	return cc, nil
+}
+
+// close 关闭当前连接,之后的 conn 会重新建立
+func (d *grpcStreamDialer) close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.closeUnlocked()
+}
+
+func (d *grpcStreamDialer) closeUnlocked() {
+	if d.cc != nil {
+		d.cc.Close()
+	}
+	d.cc = nil
+}
+
+// dialGRPC 在到对端的gRPC连接上打开一个消息流,请求头放在元数据中
+func (cr *streamReader) dialGRPC(t streamType) (io.Closer, decoder, error) {
+	u := cr.picker.pick()
+	cc, err := cr.grpc.conn(u)
+	if err != nil {
+		cr.picker.unreachable(u)
+		return nil, nil, err
+	}
+
+	peerURLs := make([]string, cr.tr.URLs.Len())
+	for i := range cr.tr.URLs {
+		peerURLs[i] = cr.tr.URLs[i].String()
+	}
+	md := metadata.Pairs(
+		"x-server-from", cr.tr.ID.String(),
+		"x-server-version", version.Version,
+		"x-min-cluster-version", version.MinClusterVersion,
+		"x-etcd-cluster-id", cr.tr.ClusterID.String(),
+		"x-raft-to", cr.peerID.String(),
+		"x-stream-type", string(t),
+	)
+	if len(peerURLs) > 0 {
+		md.Set("x-peerurls", strings.Join(peerURLs, ","))
+	}
+
+	cr.mu.Lock()
+	select {
+	case <-cr.ctx.Done():
+		cr.mu.Unlock()
+		return nil, nil, fmt.Errorf("stream reader is stopped")
+	default:
+	}
+	cr.mu.Unlock()
+
+	var callOpts []grpc.CallOption
+	if c := grpcCompressor(cr.tr.Compression.forURL(u)); c != "" {
+		// 服务端用请求的压缩方式发送响应
+		callOpts = append(callOpts, grpc.UseCompressor(c))
+	}
+
+	ctx, cancel := context.WithCancel(metadata.NewOutgoingContext(cr.ctx, md))
+	cs, err := cc.NewStream(ctx, &raftStreamServiceDesc.Streams[0], StreamMethod, callOpts...)
+	if err == nil {
+		err = cs.CloseSend()
+	}
+	if err == nil {
+		// 等待对端的响应头,对端拒绝时在这里返回错误
+		_, err = cs.Header()
+	}
+	if err != nil {
+		cancel()
+		return nil, nil, cr.grpcStreamError(u, err)
+	}
+	dec := newGRPCStreamDecoder(cs, cancel)
+	return dec, dec, nil
+}
+
+// grpcStreamError 把对端返回的状态转换成与HTTP流相同的错误
+func (cr *streamReader) grpcStreamError(u url.URL, err error) error {
+	st := status.Convert(err)
+	switch st.Code() {
+	case codes.Unimplemented:
+		cr.grpc.markUnsupported()
+		return errGRPCStreamUnsupported
+
+	case codes.PermissionDenied:
+		cr.picker.unreachable(u)
+		reportCriticalError(errMemberRemoved, cr.errorc)
+		return errMemberRemoved
+
+	case codes.FailedPrecondition:
+		cr.picker.unreachable(u)
+		switch st.Message() {
+		case errIncompatibleVersion.Error():
+			if cr.lg != nil {
+				cr.lg.Warn(
+					"request sent was ignored by remote peer due to etcd version incompatibility",
+					zap.String("local-member-id", cr.tr.ID.String()),
+					zap.String("remote-peer-id", cr.peerID.String()),
+					zap.Error(errIncompatibleVersion),
+				)
+			}
+			return errIncompatibleVersion
+
+		case errClusterIDMismatch.Error():
+			if cr.lg != nil {
+				cr.lg.Warn(
+					"request sent was ignored by remote peer due to cluster ID mismatch",
+					zap.String("remote-peer-id", cr.peerID.String()),
+					zap.String("local-member-id", cr.tr.ID.String()),
+					zap.String("local-member-cluster-id", cr.tr.ClusterID.String()),
+					zap.Error(errClusterIDMismatch),
+				)
+			}
+			return errClusterIDMismatch
+		}
+		return err
+
+	case codes.Unavailable:
+		// 连接已经断开,下次重新建立,避免等待gRPC的重连退避
+		cr.grpc.close()
+		cr.picker.unreachable(u)
+		return err
+
+	default:
+		cr.picker.unreachable(u)
+		return err
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rafthttp
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	rttSec = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "etcd",
+		Subsystem: "network",
+		Name:      "peer_round_trip_time_seconds",
+		Help:      "Round-Trip-Time histogram between peers",
+		// 最低桶上限0.0001秒(0.1ms),因子2,最高桶上限0.0001*2^15 == 3.2768秒
+		Buckets: prometheus.ExponentialBuckets(0.0001, 2, 16),
+	},
+		[]string{"To"},
+	)
+
+	clockOffsetSec = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "etcd",
+		Subsystem: "network",
+		Name:      "peer_clock_offset_seconds",
+		Help:      "The clock offset of this member relative to the peer measured by the prober; positive if the local clock is ahead.",
+	},
+		[]string{"To"},
+	)
+
+	sendQueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "etcd",
+		Subsystem: "network",
+		Name:      "peer_send_queue_depth",
+		Help:      "The number of raft messages queued for sending to the peer.",
+	},
+		[]string{"To"},
+	)
+
+	sentDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "etcd",
+		Subsystem: "network",
+		Name:      "peer_sent_dropped_total",
+		Help:      "The total number of raft messages dropped because the sending buffer of the peer was full.",
+	},
+		[]string{"To"},
+	)
+
+	receivedDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "etcd",
+		Subsystem: "network",
+		Name:      "peer_received_dropped_total",
+		Help:      "The total number of raft messages dropped because the receiving buffer was full.",
+	},
+		[]string{"From"},
+	)
+
+	asymmetricPartitions = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "etcd",
+		Subsystem: "network",
+		Name:      "peer_asymmetric_partition_suspected",
+		Help:      "Set to 1 if only one direction of the stream connections with the peer works.",
+	},
+		[]string{"To"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(rttSec)
+	prometheus.MustRegister(clockOffsetSec)
+	prometheus.MustRegister(sendQueueDepth)
+	prometheus.MustRegister(sentDropped)
+	prometheus.MustRegister(receivedDropped)
+	prometheus.MustRegister(asymmetricPartitions)
+}
@@ -15,11 +15,9 @@
 package rafthttp
 
 import (
-	"bytes"
 	"encoding/binary"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"time"
 
 	"github.com/ls-2018/etcd_cn/client_sdk/pkg/types"
@@ -75,23 +73,14 @@ func (enc *msgAppV2Encoder) encode(m *raftpb.Message) error {
 			return err
 		}
 		for i := 0; i < len(m.Entries); i++ {
-			binary.BigEndian.PutUint64(enc.uint64buf, uint64(m.Entries[i].Size()))
+			// Entry 的 Size() 与 Marshal() 的长度不一致,按实际序列化后的长度写入
+			data := pbutil.MustMarshal(&m.Entries[i])
+			binary.BigEndian.PutUint64(enc.uint64buf, uint64(len(data)))
 			if _, err := enc.w.Write(enc.uint64buf); err != nil {
 				return err
 			}
-			if n := m.Entries[i].Size(); n < msgAppV2BufSize {
-				temp, err := m.Entries[i].Marshal()
-				enc.buf = append(enc.buf, temp...)
-				if err != nil {
-					return err
-				}
-				if _, err := enc.w.Write(enc.buf[:n]); err != nil {
-					return err
-				}
-			} else {
-				if _, err := enc.w.Write(pbutil.MustMarshal(&m.Entries[i])); err != nil {
-					return err
-				}
+			if _, err := enc.w.Write(data); err != nil {
+				return err
 			}
 			enc.index++
 		}
@@ -151,8 +140,6 @@ func (dec *msgAppV2Decoder) decode() (raftpb.Message, error) {
 		m   raftpb.Message
 		typ uint8
 	)
-	xxx, _ := ioutil.ReadAll(dec.r)
-	dec.r = bytes.NewReader(xxx)
 	if _, err := io.ReadFull(dec.r, dec.uint8buf); err != nil {
 		return m, err
 	}
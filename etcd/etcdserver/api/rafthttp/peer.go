@@ -83,6 +83,8 @@ type Peer interface {
 	// activeSince returns the time that the connection with the
 	// peer becomes active.
 	activeSince() time.Time
+	// stats 返回与对端之间的网络状况
+	stats() PeerStats
 	// stop performs any necessary finalization and terminates the peer
 	// elegantly.
 	stop()
@@ -118,6 +120,7 @@ type peer struct {
 	snapSender     *snapshotSender // snapshot sender to send v3 snapshot messages
 	msgAppV2Reader *streamReader
 	msgAppReader   *streamReader
+	grpcDialer     *grpcStreamDialer // 使用gRPC传输时两个streamReader共用
 
 	recvc chan raftpb.Message
 	propc chan raftpb.Message
@@ -161,8 +164,8 @@ func startPeer(t *Transport, urls types.URLs, peerID types.ID, fs *stats.Followe
 		r:              r,
 		status:         status,
 		picker:         picker,
-		msgAppV2Writer: startStreamWriter(t.Logger, t.ID, peerID, status, fs, r),
-		writer:         startStreamWriter(t.Logger, t.ID, peerID, status, fs, r),
+		msgAppV2Writer: startStreamWriter(t.Logger, t.ID, peerID, status, fs, r, streamBatch{interval: t.BatchInterval, bytes: t.BatchBytes}),
+		writer:         startStreamWriter(t.Logger, t.ID, peerID, status, fs, r, streamBatch{}),
 		pipeline:       pipeline,
 		snapSender:     newSnapshotSender(t, picker, peerID, status),
 		recvc:          make(chan raftpb.Message, recvBufSize),
@@ -170,6 +173,10 @@ func startPeer(t *Transport, urls types.URLs, peerID types.ID, fs *stats.Followe
 		stopc:          make(chan struct{}),
 	}
 
+	if t.PeerTransport == PeerTransportGRPC {
+		p.grpcDialer = newGRPCStreamDialer(t)
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	p.cancel = cancel
 	go func() {
@@ -215,6 +222,7 @@ func startPeer(t *Transport, urls types.URLs, peerID types.ID, fs *stats.Followe
 		recvc:  p.recvc,
 		propc:  p.propc,
 		rl:     rate.NewLimiter(t.DialRetryFrequency, 1),
+		grpc:   p.grpcDialer,
 	}
 	p.msgAppReader = &streamReader{
 		lg:     t.Logger,
@@ -226,6 +234,7 @@ func startPeer(t *Transport, urls types.URLs, peerID types.ID, fs *stats.Followe
 		recvc:  p.recvc,
 		propc:  p.propc,
 		rl:     rate.NewLimiter(t.DialRetryFrequency, 1),
+		grpc:   p.grpcDialer,
 	}
 
 	p.msgAppV2Reader.start()
@@ -251,6 +260,7 @@ func (p *peer) send(m raftpb.Message) {
 	 */
 	case writec <- m:
 	default:
+		p.status.dropSent()
 		p.r.ReportUnreachable(m.To)
 		if isMsgSnap(m) {
 			p.r.ReportSnapshot(m.To, raft.SnapshotFailure)
@@ -348,6 +358,9 @@ func (p *peer) stop() {
 	p.snapSender.stop()
 	p.msgAppV2Reader.stop()
 	p.msgAppReader.stop()
+	if p.grpcDialer != nil {
+		p.grpcDialer.close()
+	}
 }
 
 // 根据消息的类型选择合适的消息通道,
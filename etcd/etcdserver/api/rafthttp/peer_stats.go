@@ -0,0 +1,146 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rafthttp
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/ls-2018/etcd_cn/client_sdk/pkg/types"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/xiang90/probing"
+	"go.uber.org/zap"
+)
+
+var (
+	// peerStatsInterval 刷新发送队列指标和检查单向分区的间隔
+	peerStatsInterval = time.Second
+	// asymmetricPartitionTimeout 只有一个方向连通持续多久后认为疑似单向分区,
+	// 需要大于对端重新建立消息流的时间
+	asymmetricPartitionTimeout = 2 * ConnReadTimeout
+)
+
+// PeerStats 本成员到一个对端的网络状况
+type PeerStats struct {
+	ID     types.ID
+	Active bool
+	// Outbound 本成员拨号建立的消息流(从对端读取消息)是否已连接,即本成员能连上对端
+	Outbound bool
+	// Inbound 对端拨号建立的消息流(向对端发送消息)是否已连接,即对端能连上本成员
+	Inbound bool
+	// RTT 探测得到的平滑往返时间,还没有探测结果时为0
+	RTT time.Duration
+	// ClockOffset 探测得到的本成员时钟领先对端的时间,为负表示落后;最近一次探测失败时为0
+	ClockOffset time.Duration
+	// SendQueueDepth 等待发送给对端的消息数
+	SendQueueDepth  int
+	DroppedSent     uint64
+	DroppedReceived uint64
+	// AsymmetricPartition 只有一个方向连通并且持续超过一段时间
+	AsymmetricPartition bool
+	LastError           string
+}
+
+func (p *peer) stats() PeerStats {
+	msgAppc, msgAppOK := p.msgAppV2Writer.writec()
+	msgc, msgOK := p.writer.writec()
+	outbound, inbound := p.status.isDialed(), msgAppOK || msgOK
+	return PeerStats{
+		ID:                  p.id,
+		Active:              p.status.isActive(),
+		Outbound:            outbound,
+		Inbound:             inbound,
+		SendQueueDepth:      len(msgAppc) + len(msgc) + len(p.pipeline.msgc),
+		DroppedSent:         atomic.LoadUint64(&p.status.droppedSent),
+		DroppedReceived:     atomic.LoadUint64(&p.status.droppedReceived),
+		AsymmetricPartition: p.status.checkPartition(outbound, inbound, time.Now()),
+		LastError:           p.status.lastError(),
+	}
+}
+
+// PeerStats 返回本成员到各个对端的网络状况,按成员ID排序
+func (t *Transport) PeerStats() []PeerStats {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	ss := make([]PeerStats, 0, len(t.peers))
+	for id, p := range t.peers {
+		ss = append(ss, t.peerStats(id, p))
+	}
+	sort.Slice(ss, func(i, j int) bool { return ss[i].ID < ss[j].ID })
+	return ss
+}
+
+// peerStats 在p.stats()的基础上补充探测得到的往返时间和时钟偏差;调用方需要持有t.mu
+func (t *Transport) peerStats(id types.ID, p Peer) PeerStats {
+	st := p.stats()
+	if s, err := t.streamProber.Status(id.String()); err == nil {
+		st.RTT = s.SRTT()
+		if s.Health() {
+			st.ClockOffset = s.ClockDiff()
+		}
+	}
+	return st
+}
+
+// monitorPeers 定期刷新发送队列指标并检查单向分区,直到stopc关闭
+func (t *Transport) monitorPeers(stopc <-chan struct{}) {
+	ticker := time.NewTicker(peerStatsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			t.mu.RLock()
+			for id, p := range t.peers {
+				st := t.peerStats(id, p)
+				sendQueueDepth.WithLabelValues(id.String()).Set(float64(st.SendQueueDepth))
+				clockOffsetSec.WithLabelValues(id.String()).Set(st.ClockOffset.Seconds())
+			}
+			t.mu.RUnlock()
+		case <-stopc:
+			return
+		}
+	}
+}
+
+// deletePeerMetrics 删除已移除对端的指标
+func deletePeerMetrics(id types.ID) {
+	rttSec.DeleteLabelValues(id.String())
+	sendQueueDepth.DeleteLabelValues(id.String())
+	clockOffsetSec.DeleteLabelValues(id.String())
+	sentDropped.DeleteLabelValues(id.String())
+	receivedDropped.DeleteLabelValues(id.String())
+	asymmetricPartitions.DeleteLabelValues(id.String())
+}
+
+func addPeerToProber(lg *zap.Logger, p probing.Prober, id string, us []string, roundTripperName string, rttSecProm *prometheus.HistogramVec) {
+	hus := make([]string, len(us))
+	for i := range us {
+		hus[i] = us[i] + ProbingPrefix
+	}
+
+	p.AddHTTP(id, proberInterval, hus)
+
+	s, err := p.Status(id)
+	if err != nil {
+		if lg != nil {
+			lg.Warn("failed to add peer into prober", zap.String("remote-peer-id", id), zap.Error(err))
+		}
+		return
+	}
+
+	go monitorProbingStatus(lg, s, id, roundTripperName, rttSecProm)
+}
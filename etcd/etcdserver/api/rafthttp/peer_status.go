@@ -18,6 +18,7 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ls-2018/etcd_cn/client_sdk/pkg/types"
@@ -37,13 +38,22 @@ type peerStatus struct { // 节点状态
 	mu     sync.Mutex // protect variables below
 	active bool
 	since  time.Time
+
+	dialed  map[streamType]bool // 本成员拨号建立的各类消息流是否已连接
+	lastErr string              // 最近一次发送或接收失败的原因
+
+	asymSince  time.Time // 开始出现单向连通的时间
+	asymWarned bool
+
+	droppedSent     uint64 // 原子操作
+	droppedReceived uint64 // 原子操作
 }
 
 func newPeerStatus(lg *zap.Logger, local, id types.ID) *peerStatus {
 	if lg == nil {
 		lg = zap.NewNop()
 	}
-	return &peerStatus{lg: lg, local: local, id: id}
+	return &peerStatus{lg: lg, local: local, id: id, dialed: make(map[streamType]bool)}
 }
 
 func (s *peerStatus) activate() {
@@ -61,6 +71,7 @@ func (s *peerStatus) deactivate(failure failureType, reason string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	msg := fmt.Sprintf("failed to %s %s on %s (%s)", failure.action, s.id, failure.source, reason)
+	s.lastErr = msg
 	if s.active {
 		s.lg.Warn("peer became inactive (message send to peer failed)", zap.String("peer-id", s.id.String()), zap.Error(errors.New(msg)))
 		s.active = false
@@ -85,3 +96,81 @@ func (s *peerStatus) activeSince() time.Time {
 	defer s.mu.Unlock()
 	return s.since
 }
+
+// setDialed 记录本成员拨号建立的t类型消息流是否已连接
+func (s *peerStatus) setDialed(t streamType, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dialed[t] = ok
+}
+
+// isDialed 本成员拨号建立的消息流中是否有已连接的
+func (s *peerStatus) isDialed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ok := range s.dialed {
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *peerStatus) lastError() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastErr
+}
+
+func (s *peerStatus) dropSent() {
+	atomic.AddUint64(&s.droppedSent, 1)
+	sentDropped.WithLabelValues(s.id.String()).Inc()
+}
+
+func (s *peerStatus) dropReceived() {
+	atomic.AddUint64(&s.droppedReceived, 1)
+	receivedDropped.WithLabelValues(s.id.String()).Inc()
+}
+
+// checkPartition 根据两个方向的连通情况判断是否疑似单向网络分区:
+// outbound 表示本成员能连上对端,inbound 表示对端能连上本成员.
+// 只有一个方向可用并持续超过 asymmetricPartitionTimeout 时告警一次,恢复后再记录一次.
+func (s *peerStatus) checkPartition(outbound, inbound bool, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if outbound == inbound {
+		if s.asymWarned {
+			s.lg.Info(
+				"asymmetric partition resolved",
+				zap.String("local-member-id", s.local.String()),
+				zap.String("remote-peer-id", s.id.String()),
+				zap.Bool("outbound-ok", outbound),
+				zap.Bool("inbound-ok", inbound),
+			)
+		}
+		s.asymSince = time.Time{}
+		s.asymWarned = false
+		asymmetricPartitions.WithLabelValues(s.id.String()).Set(0)
+		return false
+	}
+	if s.asymSince.IsZero() {
+		s.asymSince = now
+	}
+	if now.Sub(s.asymSince) < asymmetricPartitionTimeout {
+		return false
+	}
+	if !s.asymWarned {
+		s.lg.Warn(
+			"asymmetric partition suspected",
+			zap.String("local-member-id", s.local.String()),
+			zap.String("remote-peer-id", s.id.String()),
+			zap.Bool("outbound-ok", outbound),
+			zap.Bool("inbound-ok", inbound),
+			zap.Duration("duration", now.Sub(s.asymSince)),
+			zap.String("last-error", s.lastErr),
+		)
+		s.asymWarned = true
+		asymmetricPartitions.WithLabelValues(s.id.String()).Set(1)
+	}
+	return true
+}
@@ -57,6 +57,7 @@ func monitorProbingStatus(lg *zap.Logger, s probing.Status, id string, roundTrip
 				interval = statusErrorInterval
 			} else {
 				interval = statusMonitoringInterval
+				rttSecProm.WithLabelValues(id).Observe(s.SRTT().Seconds())
 			}
 			if s.ClockDiff() > time.Second {
 				if lg != nil {
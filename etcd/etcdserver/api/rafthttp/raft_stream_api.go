@@ -1,6 +1,7 @@
 package rafthttp
 
 import (
+	"io"
 	"net/http"
 	"path"
 	"strings"
@@ -122,15 +123,31 @@ func (h *streamHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "to field mismatch", http.StatusPreconditionFailed)
 		return
 	}
+	// 接收方请求压缩时压缩整个流,不认识这个请求头的旧版本按不压缩接收
+	// 请求了不支持的压缩方式时同样按不压缩发送
+	encoding := r.Header.Get("X-Raft-Accept-Encoding")
+	cw := newCompressFlushWriter(encoding, w, w.(http.Flusher))
+	if cw != nil {
+		w.Header().Set("X-Raft-Content-Encoding", encoding)
+	}
 	/* 这个地方需要注意一下,此处并没有包把应答报文发出去,但是具体处理逻辑需要参考net/http中Flush */
 	w.WriteHeader(http.StatusOK)
 	w.(http.Flusher).Flush()
 
+	var (
+		writer  io.Writer    = w
+		flusher http.Flusher = w.(http.Flusher)
+	)
+	if cw != nil {
+		cw.Flush() // 先写出gzip头,接收方建立gzip解压器时需要读到它
+		writer, flusher = cw, cw
+	}
+
 	c := newCloseNotifier()
 	conn := &outgoingConn{
 		t:       t, // 连接类型
-		Writer:  w,
-		Flusher: w.(http.Flusher),
+		Writer:  writer,
+		Flusher: flusher,
 		Closer:  c,
 		localID: h.tr.ID,
 		peerID:  from,
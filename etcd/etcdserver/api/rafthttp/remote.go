@@ -15,6 +15,8 @@
 package rafthttp
 
 import (
+	"sync"
+
 	"github.com/ls-2018/etcd_cn/client_sdk/pkg/types"
 	"github.com/ls-2018/etcd_cn/raft/raftpb"
 
@@ -27,6 +29,10 @@ type remote struct {
 	id       types.ID
 	status   *peerStatus
 	pipeline *pipeline
+
+	mu sync.Mutex
+	// paused 为true时pipeline已经停止;Pause/Resume 可以重复调用,pipeline 只能启动和停止一次
+	paused bool
 }
 
 func startRemote(tr *Transport, urls types.URLs, id types.ID) *remote {
@@ -82,13 +88,29 @@ func (g *remote) send(m raftpb.Message) {
 }
 
 func (g *remote) stop() {
-	g.pipeline.stop()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.paused {
+		g.pipeline.stop()
+	}
 }
 
 func (g *remote) Pause() {
-	g.stop()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.paused {
+		return
+	}
+	g.paused = true
+	g.pipeline.stop()
 }
 
 func (g *remote) Resume() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.paused {
+		return
+	}
+	g.paused = false
 	g.pipeline.start()
 }
@@ -35,6 +35,7 @@ import (
 	"github.com/coreos/go-semver/semver"
 	"go.uber.org/zap"
 	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
 )
 
 const (
@@ -103,6 +104,7 @@ type outgoingConn struct {
 	io.Writer
 	http.Flusher
 	io.Closer
+	ss grpc.ServerStream // 非空时消息经gRPC流发送
 
 	localID types.ID
 	peerID  types.ID
@@ -118,6 +120,7 @@ type streamWriter struct {
 	status *peerStatus
 	fs     *stats.FollowerStats
 	r      Raft
+	batch  streamBatch
 
 	mu      sync.Mutex // guard field working and closer
 	closer  io.Closer
@@ -131,7 +134,7 @@ type streamWriter struct {
 
 // startStreamWriter creates a streamWrite and starts a long running go-routine that accepts
 // messages and writes to the attached outgoing connection.
-func startStreamWriter(lg *zap.Logger, local, id types.ID, status *peerStatus, fs *stats.FollowerStats, r Raft) *streamWriter {
+func startStreamWriter(lg *zap.Logger, local, id types.ID, status *peerStatus, fs *stats.FollowerStats, r Raft, batch streamBatch) *streamWriter {
 	w := &streamWriter{
 		lg: lg,
 
@@ -141,6 +144,7 @@ func startStreamWriter(lg *zap.Logger, local, id types.ID, status *peerStatus, f
 		status: status,
 		fs:     fs,
 		r:      r,
+		batch:  batch,
 		msgc:   make(chan raftpb.Message, streamBufSize),
 		connc:  make(chan *outgoingConn),
 		stopc:  make(chan struct{}),
@@ -158,6 +162,7 @@ func (cw *streamWriter) run() {
 		enc        encoder             // 编码器,负责将消息序列化并写入连接的缓冲区
 		flusher    http.Flusher        // 负责刷新底层连接,将数据真正发送出去
 		batched    int                 // 当前未Flush的消息个数
+		flushc     <-chan time.Time    // 合并写出时,到期后Flush
 	)
 	tickc := time.NewTicker(ConnReadTimeout / 3)
 	defer tickc.Stop()
@@ -181,6 +186,7 @@ func (cw *streamWriter) run() {
 				flusher.Flush()
 				batched = 0
 				unflushed = 0
+				flushc = nil
 				continue
 			}
 
@@ -195,17 +201,26 @@ func (cw *streamWriter) run() {
 					zap.String("remote-peer-id", cw.peerID.String()),
 				)
 			}
-			heartbeatc, msgc = nil, nil
+			heartbeatc, msgc, flushc = nil, nil, nil
 
 		case m := <-msgc:
 			err := enc.encode(&m) // 格式化消息,如选举消息
 			if err == nil {
 				unflushed += m.Size()
+				if cw.batch.interval > 0 && batched <= streamBufSize/2 && (cw.batch.bytes == 0 || unflushed < cw.batch.bytes) {
+					// 合并写出,等定时器到期或积累的字节数达到上限;压缩时更大的批次压缩率更高
+					if flushc == nil {
+						flushc = time.After(cw.batch.interval)
+					}
+					batched++
+					continue
+				}
 				// msgc通道中的消息全部发送完成或是未Flush的消息较多,则触发Flush,否则只是递增batched变量
 				if len(msgc) == 0 || batched > streamBufSize/2 { // batched批处理 streamBufSize全局变量 4096
 					flusher.Flush() //  刷新缓冲区,发送到对端.Flush代码为net/http模块
 					unflushed = 0
 					batched = 0
+					flushc = nil
 				} else {
 					batched++
 				}
@@ -223,17 +238,22 @@ func (cw *streamWriter) run() {
 					zap.String("remote-peer-id", cw.peerID.String()),
 				)
 			}
-			heartbeatc, msgc = nil, nil
+			heartbeatc, msgc, flushc = nil, nil, nil
 			cw.r.ReportUnreachable(m.To)
 
 		case conn := <-cw.connc: // 从channel读取conn对象,表示会话已经建立
 			cw.mu.Lock()
 			closed := cw.closeUnlocked()
 			t = conn.t
-			switch conn.t {
-			case streamTypeMsgAppV2:
+			switch {
+			case conn.ss != nil:
+				enc = &grpcStreamEncoder{ss: conn.ss}
+				if t == streamTypeMsgAppV2 {
+					enc.(*grpcStreamEncoder).fs = cw.fs
+				}
+			case conn.t == streamTypeMsgAppV2:
 				enc = newMsgAppV2Encoder(conn.Writer, cw.fs)
-			case streamTypeMessage:
+			case conn.t == streamTypeMessage:
 				enc = &messageEncoder{w: conn.Writer}
 			default:
 				if cw.lg != nil {
@@ -273,7 +293,13 @@ func (cw *streamWriter) run() {
 					zap.String("remote-peer-id", cw.peerID.String()),
 				)
 			}
-			heartbeatc, msgc = tickc.C, cw.msgc // 保存心跳和message的通道
+			heartbeatc, msgc, flushc = tickc.C, cw.msgc, nil // 保存心跳和message的通道
+
+		case <-flushc:
+			flusher.Flush()
+			unflushed = 0
+			batched = 0
+			flushc = nil
 
 		case <-cw.stopc:
 			if cw.close() {
@@ -361,6 +387,8 @@ type streamReader struct {
 
 	rl *rate.Limiter // alters the frequency of dial retrial attempts
 
+	grpc *grpcStreamDialer // 非空时优先使用gRPC流
+
 	errorc chan<- error
 
 	mu     sync.Mutex
@@ -395,17 +423,19 @@ func (cr *streamReader) run() {
 	}
 
 	for {
-		rc, err := cr.dial(t)
+		rc, dec, err := cr.dialStream(t)
 		if err != nil {
 			if err != errUnsupportedStreamType {
 				cr.status.deactivate(failureType{source: t.String(), action: "dial"}, err.Error())
 			}
 		} else {
 			cr.status.activate()
+			cr.status.setDialed(t, true)
 			if cr.lg != nil {
 				cr.lg.Info("已建立的TCP流媒体连接与远程节点", zap.String("stream-reader-type", cr.typ.String()), zap.String("local-member-id", cr.tr.ID.String()), zap.String("remote-peer-id", cr.peerID.String()))
 			}
-			err = cr.decodeLoop(rc, t)
+			err = cr.decodeLoop(rc, dec)
+			cr.status.setDialed(t, false)
 			if cr.lg != nil {
 				cr.lg.Warn("丢失TCP流媒体连接与远程节点", zap.String("stream-reader-type", cr.typ.String()), zap.String("local-member-id", cr.tr.ID.String()), zap.String("remote-peer-id", cr.peerID.String()), zap.Error(err))
 			}
@@ -446,19 +476,22 @@ func (cr *streamReader) run() {
 	}
 }
 
-func (cr *streamReader) decodeLoop(rc io.ReadCloser, t streamType) error {
-	var dec decoder
-	cr.mu.Lock()
+func (cr *streamReader) newDecoder(rc io.ReadCloser, t streamType) decoder {
 	switch t {
 	case streamTypeMsgAppV2:
-		dec = newMsgAppV2Decoder(rc, cr.tr.ID, cr.peerID)
+		return newMsgAppV2Decoder(rc, cr.tr.ID, cr.peerID)
 	case streamTypeMessage:
-		dec = &messageDecoder{r: rc}
+		return &messageDecoder{r: rc}
 	default:
 		if cr.lg != nil {
 			cr.lg.Panic("unknown stream type", zap.String("type", t.String()))
 		}
 	}
+	return nil
+}
+
+func (cr *streamReader) decodeLoop(rc io.Closer, dec decoder) error {
+	cr.mu.Lock()
 	select {
 	case <-cr.ctx.Done():
 		cr.mu.Unlock()
@@ -507,6 +540,7 @@ func (cr *streamReader) decodeLoop(rc io.ReadCloser, t streamType) error {
 		select {
 		case recvc <- m: // 将消息写到channel中 channel另外一段是rafthttp/peer.go startPeer
 		default:
+			cr.status.dropReceived()
 			if cr.status.isActive() {
 				if cr.lg != nil {
 					cr.lg.Warn(
@@ -542,6 +576,29 @@ func (cr *streamReader) stop() {
 	<-cr.done
 }
 
+// dialStream 使用gRPC传输时先尝试gRPC流,对端不支持时回退到HTTP流
+func (cr *streamReader) dialStream(t streamType) (io.Closer, decoder, error) {
+	if cr.grpc != nil && cr.grpc.enabled() {
+		c, dec, err := cr.dialGRPC(t)
+		if err != errGRPCStreamUnsupported {
+			return c, dec, err
+		}
+		if cr.lg != nil {
+			cr.lg.Info(
+				"对端不支持gRPC消息流,使用HTTP流",
+				zap.String("stream-reader-type", t.String()),
+				zap.String("local-member-id", cr.tr.ID.String()),
+				zap.String("remote-peer-id", cr.peerID.String()),
+			)
+		}
+	}
+	rc, err := cr.dial(t)
+	if err != nil {
+		return nil, nil, err
+	}
+	return rc, cr.newDecoder(rc, t), nil
+}
+
 func (cr *streamReader) dial(t streamType) (io.ReadCloser, error) {
 	u := cr.picker.pick()
 	uu := u
@@ -565,6 +622,9 @@ func (cr *streamReader) dial(t streamType) (io.ReadCloser, error) {
 	req.Header.Set("X-Min-Cluster-Version", version.MinClusterVersion)
 	req.Header.Set("X-Etcd-Cluster-ID", cr.tr.ClusterID.String())
 	req.Header.Set("X-Raft-To", cr.peerID.String())
+	if c := cr.tr.Compression.forURL(u); c != CompressionNone {
+		req.Header.Set("X-Raft-Accept-Encoding", c)
+	}
 
 	setPeerURLsHeader(req, cr.tr.URLs)
 
@@ -601,7 +661,13 @@ func (cr *streamReader) dial(t streamType) (io.ReadCloser, error) {
 		return nil, errMemberRemoved
 
 	case http.StatusOK:
-		return resp.Body, nil
+		rc, err := newDecompressReadCloser(resp.Header.Get("X-Raft-Content-Encoding"), resp.Body)
+		if err != nil {
+			httputil.GracefulClose(resp)
+			cr.picker.unreachable(u)
+			return nil, err
+		}
+		return rc, nil
 
 	case http.StatusNotFound:
 		httputil.GracefulClose(resp)
@@ -31,6 +31,7 @@ import (
 	"github.com/xiang90/probing"
 	"go.uber.org/zap"
 	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
 )
 
 type Raft interface {
@@ -45,6 +46,8 @@ type Transporter interface {
 	// Start必须是called before calling other functions in the interface.
 	Start() error
 	Handler() http.Handler
+	// RegisterGRPC 在peer端口的gRPC服务上注册raft消息流
+	RegisterGRPC(gs *grpc.Server)
 	// Send sends out the given messages to the remote peers.
 	// Each message has a To field, which is an id that maps
 	// to an existing peer in the transport.
@@ -66,6 +69,8 @@ type Transporter interface {
 	ActiveSince(id types.ID) time.Time // 返回与给定id的对等体的连接开始活动的时间
 	// ActivePeers returns the number of active peers.
 	ActivePeers() int
+	// PeerStats 返回本成员到各个对端的网络状况
+	PeerStats() []PeerStats
 	// Stop closes the connections and stops the transporter.
 	Stop()
 }
@@ -89,6 +94,10 @@ type Transport struct {
 	Raft               Raft              // raft状态机,Transport向其转发收到的信息并报告状态.
 	Snapshotter        *snap.Snapshotter
 	ServerStats        *stats.ServerStats // used to record general transportation statistics
+	PeerTransport      string             // 读取raft消息流使用的传输;选择gRPC时对端不支持会回退到HTTP,可以逐个成员切换
+	Compression        PeerCompression    // 按对端peer URL请求压缩接收的消息流
+	BatchInterval      time.Duration      // HTTP流发送MsgApp时最多等待多久合并写出;0表示发送队列一空就写出
+	BatchBytes         int                // 合并写出的字节数上限,达到后立即写出;0表示只按时间
 	// used to record transportation statistics with followers when
 	// performing as leader in raft protocol
 	LeaderStats *stats.LeaderStats
@@ -104,6 +113,7 @@ type Transport struct {
 	remotes        map[types.ID]*remote // 类型）: remote 中只封装了pipeline 实例,remote主要负责发送快照数据,帮助新加入的节点快速追赶上其他节点的数据.
 	pipelineProber probing.Prober
 	streamProber   probing.Prober
+	stopc          chan struct{} // 关闭后停止monitorPeers
 }
 
 func (t *Transport) Start() error {
@@ -120,6 +130,8 @@ func (t *Transport) Start() error {
 	t.peers = make(map[types.ID]Peer)
 	t.pipelineProber = probing.NewProber(t.pipelineRt)
 	t.streamProber = probing.NewProber(t.streamRt)
+	t.stopc = make(chan struct{})
+	go t.monitorPeers(t.stopc)
 
 	// If client didn't provide dial retry frequency, use the default
 	// (100ms backoff between attempts to create a new stream),
@@ -196,6 +208,10 @@ func (t *Transport) Stop() {
 	}
 	t.pipelineProber.RemoveAll()
 	t.streamProber.RemoveAll()
+	if t.stopc != nil {
+		close(t.stopc)
+		t.stopc = nil
+	}
 	if tr, ok := t.streamRt.(*http.Transport); ok {
 		tr.CloseIdleConnections()
 	}
@@ -288,6 +304,8 @@ func (t *Transport) AddPeer(id types.ID, us []string) {
 	}
 	fs := t.LeaderStats.Follower(id.String())
 	t.peers[id] = startPeer(t, urls, id, fs)
+	addPeerToProber(t.Logger, t.pipelineProber, id.String(), us, RoundTripperNameSnapshot, rttSec)
+	addPeerToProber(t.Logger, t.streamProber, id.String(), us, RoundTripperNameRaftMessage, rttSec)
 
 	if t.Logger != nil {
 		t.Logger.Info(
@@ -326,6 +344,7 @@ func (t *Transport) removePeer(id types.ID) {
 	delete(t.LeaderStats.Followers, id.String())
 	t.pipelineProber.Remove(id.String())
 	t.streamProber.Remove(id.String())
+	deletePeerMetrics(id)
 
 	if t.Logger != nil {
 		t.Logger.Info(
@@ -353,6 +372,8 @@ func (t *Transport) UpdatePeer(id types.ID, us []string) {
 
 	t.pipelineProber.Remove(id.String())
 	t.streamProber.Remove(id.String())
+	addPeerToProber(t.Logger, t.pipelineProber, id.String(), us, RoundTripperNameSnapshot, rttSec)
+	addPeerToProber(t.Logger, t.streamProber, id.String(), us, RoundTripperNameRaftMessage, rttSec)
 
 	if t.Logger != nil {
 		t.Logger.Info(
@@ -41,6 +41,9 @@ type Compactor interface {
 	Pause()
 	// Resume restarts the compactor suspended by Pause().
 	Resume()
+	// SetRetention changes the retention at runtime; it takes effect from
+	// the next compaction round.
+	SetRetention(retention time.Duration)
 }
 
 type Compactable interface {
@@ -40,7 +40,7 @@ type Periodic struct {
 	ctx    context.Context
 	cancel context.CancelFunc
 
-	// mu protects paused
+	// mu protects paused and period
 	mu     sync.RWMutex
 	paused bool
 }
@@ -96,16 +96,18 @@ Compaction period 5-sec:
 
 // Run runs periodic compactor.
 func (pc *Periodic) Run() {
-	compactInterval := pc.getCompactInterval()
-	retryInterval := pc.getRetryInterval()
-	retentions := pc.getRetentions()
-
 	go func() {
 		lastSuccess := pc.clock.Now()
-		baseInterval := pc.period
+		first := true
 		for {
+			// period 可以在运行时修改,每轮重新计算
+			period := pc.getPeriod()
+			compactInterval := pc.getCompactInterval()
+			retryInterval := pc.getRetryInterval()
+			retentions := pc.getRetentions()
+
 			pc.revs = append(pc.revs, pc.rg.Rev())
-			if len(pc.revs) > retentions {
+			for len(pc.revs) > retentions {
 				pc.revs = pc.revs[1:] // pc.revs[0] is always the rev at pc.period ago
 			}
 
@@ -121,20 +123,21 @@ func (pc *Periodic) Run() {
 				}
 			}
 
+			// wait up to initial given period
+			baseInterval := compactInterval
+			if first {
+				baseInterval = period
+			}
 			if pc.clock.Now().Sub(lastSuccess) < baseInterval {
 				continue
 			}
-
-			// wait up to initial given period
-			if baseInterval == pc.period {
-				baseInterval = compactInterval
-			}
+			first = false
 			rev := pc.revs[0]
 
 			pc.lg.Info(
 				"starting auto periodic compaction",
 				zap.Int64("revision", rev),
-				zap.Duration("compact-period", pc.period),
+				zap.Duration("compact-period", period),
 			)
 			startTime := pc.clock.Now()
 			_, err := pc.c.Compact(pc.ctx, &pb.CompactionRequest{Revision: rev})
@@ -142,7 +145,7 @@ func (pc *Periodic) Run() {
 				pc.lg.Info(
 					"completed auto periodic compaction",
 					zap.Int64("revision", rev),
-					zap.Duration("compact-period", pc.period),
+					zap.Duration("compact-period", period),
 					zap.Duration("took", pc.clock.Now().Sub(startTime)),
 				)
 				lastSuccess = pc.clock.Now()
@@ -150,7 +153,7 @@ func (pc *Periodic) Run() {
 				pc.lg.Warn(
 					"failed auto periodic compaction",
 					zap.Int64("revision", rev),
-					zap.Duration("compact-period", pc.period),
+					zap.Duration("compact-period", period),
 					zap.Duration("retry-interval", retryInterval),
 					zap.Error(err),
 				)
@@ -164,7 +167,7 @@ func (pc *Periodic) Run() {
 // if given compaction period x is >1-hour, compact every hour.
 // (e.g. --auto-compaction-mode 'periodic' --auto-compaction-retention='2h', then compact every 1-hour)
 func (pc *Periodic) getCompactInterval() time.Duration {
-	itv := pc.period
+	itv := pc.getPeriod()
 	if itv > time.Hour {
 		itv = time.Hour
 	}
@@ -172,13 +175,13 @@ func (pc *Periodic) getCompactInterval() time.Duration {
 }
 
 func (pc *Periodic) getRetentions() int {
-	return int(pc.period/pc.getRetryInterval()) + 1
+	return int(pc.getPeriod()/pc.getRetryInterval()) + 1
 }
 
 const retryDivisor = 10
 
 func (pc *Periodic) getRetryInterval() time.Duration {
-	itv := pc.period
+	itv := pc.getPeriod()
 	if itv > time.Hour {
 		itv = time.Hour
 	}
@@ -203,3 +206,16 @@ func (pc *Periodic) Resume() {
 	pc.paused = false
 	pc.mu.Unlock()
 }
+
+func (pc *Periodic) getPeriod() time.Duration {
+	pc.mu.RLock()
+	defer pc.mu.RUnlock()
+	return pc.period
+}
+
+// SetRetention changes the compaction period of periodic compactor.
+func (pc *Periodic) SetRetention(retention time.Duration) {
+	pc.mu.Lock()
+	pc.period = retention
+	pc.mu.Unlock()
+}
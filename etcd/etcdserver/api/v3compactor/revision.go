@@ -40,6 +40,7 @@ type Revision struct {
 	ctx    context.Context
 	cancel context.CancelFunc
 
+	// mu protects paused and retention
 	mu     sync.Mutex
 	paused bool
 }
@@ -77,7 +78,8 @@ func (rc *Revision) Run() {
 				}
 			}
 
-			rev := rc.rg.Rev() - rc.retention
+			retention := rc.getRetention()
+			rev := rc.rg.Rev() - retention
 			if rev <= 0 || rev == prev {
 				continue
 			}
@@ -86,7 +88,7 @@ func (rc *Revision) Run() {
 			rc.lg.Info(
 				"starting auto revision compaction",
 				zap.Int64("revision", rev),
-				zap.Int64("revision-compaction-retention", rc.retention),
+				zap.Int64("revision-compaction-retention", retention),
 			)
 			_, err := rc.c.Compact(rc.ctx, &pb.CompactionRequest{Revision: rev})
 			if err == nil || err == mvcc.ErrCompacted {
@@ -94,14 +96,14 @@ func (rc *Revision) Run() {
 				rc.lg.Info(
 					"completed auto revision compaction",
 					zap.Int64("revision", rev),
-					zap.Int64("revision-compaction-retention", rc.retention),
+					zap.Int64("revision-compaction-retention", retention),
 					zap.Duration("took", time.Since(now)),
 				)
 			} else {
 				rc.lg.Warn(
 					"failed auto revision compaction",
 					zap.Int64("revision", rev),
-					zap.Int64("revision-compaction-retention", rc.retention),
+					zap.Int64("revision-compaction-retention", retention),
 					zap.Duration("retry-interval", revInterval),
 					zap.Error(err),
 				)
@@ -128,3 +130,16 @@ func (rc *Revision) Resume() {
 	rc.paused = false
 	rc.mu.Unlock()
 }
+
+func (rc *Revision) getRetention() int64 {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.retention
+}
+
+// SetRetention changes the number of revisions revision-based compactor keeps.
+func (rc *Revision) SetRetention(retention time.Duration) {
+	rc.mu.Lock()
+	rc.retention = int64(retention)
+	rc.mu.Unlock()
+}
@@ -0,0 +1,190 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v3replication
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ls-2018/etcd_cn/client_sdk/v3/mirror"
+)
+
+// DefaultCheckpointKeyPrefix prefixes the destination key the cursor of a
+// replication is persisted under when CheckpointKey is not set.
+const DefaultCheckpointKeyPrefix = "__etcd_replication/"
+
+// Config configures the replication of one prefix to a remote cluster.
+type Config struct {
+	// Name identifies the replication in logs and metrics.
+	Name string `json:"name"`
+	// Prefix selects the keys whose changes are replicated; empty means all keys.
+	Prefix string `json:"prefix"`
+	// DestPrefix replaces Prefix in the destination cluster.
+	DestPrefix string `json:"dest-prefix"`
+	// Endpoints are the client URLs of the destination cluster.
+	Endpoints []string `json:"endpoints"`
+	// Conflict is "source-wins" (default) or "last-writer".
+	Conflict string `json:"conflict,omitempty"`
+	// CheckpointKey is the destination key the replicated revision is
+	// persisted under; defaults to DefaultCheckpointKeyPrefix+Name.
+	CheckpointKey string `json:"checkpoint-key,omitempty"`
+	// DialTimeout bounds establishing a connection to the destination.
+	DialTimeout time.Duration `json:"dial-timeout,omitempty"`
+
+	CertFile           string `json:"cert-file,omitempty"`
+	KeyFile            string `json:"key-file,omitempty"`
+	TrustedCAFile      string `json:"trusted-ca-file,omitempty"`
+	ServerName         string `json:"server-name,omitempty"`
+	InsecureSkipVerify bool   `json:"insecure-skip-tls-verify,omitempty"`
+
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// Validate checks the configuration.
+func (cfg Config) Validate() error {
+	if cfg.Name == "" {
+		return fmt.Errorf("replication: name is required")
+	}
+	if len(cfg.Endpoints) == 0 {
+		return fmt.Errorf("replication %q: endpoints are required", cfg.Name)
+	}
+	if _, err := mirror.ParseConflictPolicy(cfg.Conflict); err != nil {
+		return fmt.Errorf("replication %q: %v", cfg.Name, err)
+	}
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return fmt.Errorf("replication %q: cert-file and key-file must be set together", cfg.Name)
+	}
+	if cfg.Password != "" && cfg.Username == "" {
+		return fmt.Errorf("replication %q: password requires username", cfg.Name)
+	}
+	return nil
+}
+
+// ValidateConfigs validates every replication and checks that names are unique.
+func ValidateConfigs(cfgs []Config) error {
+	names := make(map[string]struct{}, len(cfgs))
+	for _, c := range cfgs {
+		if err := c.Validate(); err != nil {
+			return err
+		}
+		if _, ok := names[c.Name]; ok {
+			return fmt.Errorf("replication: duplicate name %q", c.Name)
+		}
+		names[c.Name] = struct{}{}
+	}
+	return nil
+}
+
+// ParseConfig parses a replication given as semicolon separated key=value
+// pairs, e.g. "name=dr;endpoints=https://dr-1:2379|https://dr-2:2379;prefix=/app/".
+// Endpoints are separated by '|' since commas separate replications on the
+// command line.
+func ParseConfig(s string) (Config, error) {
+	var cfg Config
+	for _, kv := range strings.Split(s, ";") {
+		kv = strings.TrimSpace(kv)
+		if kv == "" {
+			continue
+		}
+		i := strings.Index(kv, "=")
+		if i < 0 {
+			return cfg, fmt.Errorf("replication: invalid option %q, expected key=value", kv)
+		}
+		k, v := kv[:i], kv[i+1:]
+		switch k {
+		case "name":
+			cfg.Name = v
+		case "prefix":
+			cfg.Prefix = v
+		case "dest-prefix":
+			cfg.DestPrefix = v
+		case "endpoints":
+			cfg.Endpoints = strings.Split(v, "|")
+		case "conflict":
+			cfg.Conflict = v
+		case "checkpoint-key":
+			cfg.CheckpointKey = v
+		case "dial-timeout":
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return cfg, fmt.Errorf("replication: invalid dial-timeout %q: %v", v, err)
+			}
+			cfg.DialTimeout = d
+		case "cert-file":
+			cfg.CertFile = v
+		case "key-file":
+			cfg.KeyFile = v
+		case "trusted-ca-file":
+			cfg.TrustedCAFile = v
+		case "server-name":
+			cfg.ServerName = v
+		case "insecure-skip-tls-verify":
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return cfg, fmt.Errorf("replication: invalid insecure-skip-tls-verify %q: %v", v, err)
+			}
+			cfg.InsecureSkipVerify = b
+		case "username":
+			cfg.Username = v
+		case "password":
+			cfg.Password = v
+		default:
+			return cfg, fmt.Errorf("replication: unknown option %q", k)
+		}
+	}
+	return cfg, nil
+}
+
+// DefaultReplicaName names the replication of a replica cluster when Name is not set.
+const DefaultReplicaName = "replica"
+
+// ValidateReplica checks the configuration of the upstream cluster a replica
+// cluster replicates from. Name defaults to DefaultReplicaName.
+func ValidateReplica(cfg Config) error {
+	return replicaDefaults(cfg).Validate()
+}
+
+// replicaDefaults 副本集群默认使用和上游相同的key
+func replicaDefaults(cfg Config) Config {
+	if cfg.Name == "" {
+		cfg.Name = DefaultReplicaName
+	}
+	if cfg.DestPrefix == "" {
+		cfg.DestPrefix = cfg.Prefix
+	}
+	return cfg
+}
+
+func (cfg Config) checkpointKey() string {
+	if cfg.CheckpointKey != "" {
+		return cfg.CheckpointKey
+	}
+	return DefaultCheckpointKeyPrefix + cfg.Name
+}
+
+func (cfg Config) secure() bool {
+	if cfg.CertFile != "" || cfg.TrustedCAFile != "" || cfg.InsecureSkipVerify {
+		return true
+	}
+	for _, ep := range cfg.Endpoints {
+		if strings.HasPrefix(ep, "https://") || strings.HasPrefix(ep, "unixs://") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,363 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v3replication
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ls-2018/etcd_cn/client_sdk/pkg/transport"
+	clientv3 "github.com/ls-2018/etcd_cn/client_sdk/v3"
+	"github.com/ls-2018/etcd_cn/client_sdk/v3/mirror"
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver"
+	"github.com/ls-2018/etcd_cn/offical/api/v3/v3rpc/rpctypes"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// 只有leader复制:通过进程内的客户端watch本地的变更,写入远端集群.
+// 复制进度和数据在同一个事务中写入远端的 CheckpointKey,leader变更或重启后新leader从这里继续,
+// 因此远端可能重复收到同一个修改,但不会丢失.
+// 副本集群方向相反:leader watch上游集群,通过进程内的客户端写入本集群,进度保存在本集群,提升后停止.
+
+const (
+	// leaderCheckInterval 非leader检查自己是否成为leader的间隔
+	leaderCheckInterval = time.Second
+	// metricsInterval 复制期间更新延迟指标的间隔
+	metricsInterval = time.Second
+
+	defaultDialTimeout = 5 * time.Second
+
+	retryMin = 100 * time.Millisecond
+	retryMax = 30 * time.Second
+)
+
+var (
+	replicatedChanges = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "etcd",
+		Subsystem: "replication",
+		Name:      "replicated_changes_total",
+		Help:      "The total number of changes written to the destination cluster.",
+	}, []string{"name"})
+	replicationErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "etcd",
+		Subsystem: "replication",
+		Name:      "errors_total",
+		Help:      "The total number of times replication stopped on an error and was retried.",
+	}, []string{"name"})
+	replicationCompacted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "etcd",
+		Subsystem: "replication",
+		Name:      "compacted_total",
+		Help:      "The total number of times the replicated revision was compacted away and a full copy was restarted.",
+	}, []string{"name"})
+	replicationLag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "etcd",
+		Subsystem: "replication",
+		Name:      "lag_revisions",
+		Help:      "The number of source revisions not yet replicated to the destination cluster.",
+	}, []string{"name"})
+	replicationRevision = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "etcd",
+		Subsystem: "replication",
+		Name:      "revision",
+		Help:      "The last source revision replicated to the destination cluster.",
+	}, []string{"name"})
+	replicationActive = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "etcd",
+		Subsystem: "replication",
+		Name:      "active",
+		Help:      "Set to 1 when this member is replicating, which is only the case on the leader.",
+	}, []string{"name"})
+)
+
+func init() {
+	prometheus.MustRegister(replicatedChanges)
+	prometheus.MustRegister(replicationErrors)
+	prometheus.MustRegister(replicationCompacted)
+	prometheus.MustRegister(replicationLag)
+	prometheus.MustRegister(replicationRevision)
+	prometheus.MustRegister(replicationActive)
+}
+
+// Replicator 把本集群一个前缀下的变更复制到远端集群,或者把上游集群的变更复制到副本集群
+type Replicator struct {
+	lg      *zap.Logger
+	s       *etcdserver.EtcdServer
+	src     *clientv3.Client
+	dst     *clientv3.Client
+	remote  *clientv3.Client // src 和 dst 中连接远端集群的那个
+	cfg     Config
+	replica bool
+
+	conflict mirror.ConflictPolicy
+	stopOnce sync.Once
+	stopc    chan struct{}
+	donec    chan struct{}
+}
+
+// New 创建到远端集群的客户端,src 为连接本成员的进程内客户端
+func New(lg *zap.Logger, s *etcdserver.EtcdServer, src *clientv3.Client, cfg Config) (*Replicator, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	lg = lg.With(zap.String("replication", cfg.Name))
+	dst, err := newRemoteClient(lg, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return newReplicator(lg, s, src, dst, dst, cfg), nil
+}
+
+// NewReplica 创建到上游集群的客户端,把上游的变更写入 local,local 为连接本成员的进程内客户端.
+// 只在本集群是还没有被提升的副本集群时复制
+func NewReplica(lg *zap.Logger, s *etcdserver.EtcdServer, local *clientv3.Client, cfg Config) (*Replicator, error) {
+	cfg = replicaDefaults(cfg)
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	lg = lg.With(zap.String("replication", cfg.Name))
+	src, err := newRemoteClient(lg, cfg)
+	if err != nil {
+		return nil, err
+	}
+	r := newReplicator(lg, s, src, local, src, cfg)
+	r.replica = true
+	return r, nil
+}
+
+func newReplicator(lg *zap.Logger, s *etcdserver.EtcdServer, src, dst, remote *clientv3.Client, cfg Config) *Replicator {
+	conflict, _ := mirror.ParseConflictPolicy(cfg.Conflict)
+	return &Replicator{
+		lg:       lg,
+		s:        s,
+		src:      src,
+		dst:      dst,
+		remote:   remote,
+		cfg:      cfg,
+		conflict: conflict,
+		stopc:    make(chan struct{}),
+		donec:    make(chan struct{}),
+	}
+}
+
+func newRemoteClient(lg *zap.Logger, cfg Config) (*clientv3.Client, error) {
+	ccfg := clientv3.Config{
+		Endpoints:   cfg.Endpoints,
+		DialTimeout: cfg.DialTimeout,
+		Username:    cfg.Username,
+		Password:    cfg.Password,
+		Logger:      lg,
+	}
+	if ccfg.DialTimeout == 0 {
+		ccfg.DialTimeout = defaultDialTimeout
+	}
+	if cfg.secure() {
+		tlsinfo := transport.TLSInfo{
+			CertFile:           cfg.CertFile,
+			KeyFile:            cfg.KeyFile,
+			TrustedCAFile:      cfg.TrustedCAFile,
+			ServerName:         cfg.ServerName,
+			InsecureSkipVerify: cfg.InsecureSkipVerify,
+			Logger:             lg,
+		}
+		tlscfg, err := tlsinfo.ClientConfig()
+		if err != nil {
+			return nil, err
+		}
+		ccfg.TLS = tlscfg
+	}
+	return clientv3.New(ccfg)
+}
+
+// Run 在本成员是leader时复制,直到 Stop 或者server停止
+func (r *Replicator) Run() {
+	defer close(r.donec)
+	select {
+	case <-r.s.ReadyNotify():
+	case <-r.stopc:
+		return
+	case <-r.s.StoppingNotify():
+		return
+	}
+	for {
+		if r.active() {
+			r.replicate()
+		}
+		select {
+		case <-time.After(leaderCheckInterval):
+		case <-r.stopc:
+			return
+		case <-r.s.StoppingNotify():
+			return
+		}
+	}
+}
+
+// Stop 停止复制并关闭到远端集群的客户端
+func (r *Replicator) Stop() {
+	r.stopOnce.Do(func() {
+		close(r.stopc)
+		<-r.donec
+		r.remote.Close()
+	})
+}
+
+// active 只有leader复制;副本集群被提升后不再复制
+func (r *Replicator) active() bool {
+	if r.s.Leader() != r.s.ID() {
+		return false
+	}
+	return !r.replica || r.s.IsReplica()
+}
+
+// replicate 复制直到不再是leader或者停止,出错时退避重试
+func (r *Replicator) replicate() {
+	term := r.s.Term()
+	leaderChanged := r.s.LeaderChangedNotify()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		defer cancel()
+		ticker := time.NewTicker(leaderCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if !r.active() {
+					return
+				}
+				continue
+			case <-leaderChanged:
+			case <-r.stopc:
+			case <-r.s.StoppingNotify():
+			case <-ctx.Done():
+			}
+			return
+		}
+	}()
+	// 副本集群只放行带有复制标记的写入
+	runCtx := ctx
+	if r.replica {
+		runCtx = etcdserver.WithReplicaApply(ctx)
+	}
+
+	replicationActive.WithLabelValues(r.cfg.Name).Set(1)
+	defer replicationActive.WithLabelValues(r.cfg.Name).Set(0)
+	r.lg.Info("开始复制",
+		zap.Bool("replica", r.replica),
+		zap.String("prefix", r.cfg.Prefix),
+		zap.String("dest-prefix", r.cfg.DestPrefix),
+		zap.Strings("endpoints", r.cfg.Endpoints),
+		zap.String("checkpoint-key", r.cfg.checkpointKey()),
+	)
+
+	wait := retryMin
+	for {
+		m := mirror.NewReplicator(r.src, r.dst, mirror.Config{
+			Prefix:        r.cfg.Prefix,
+			DestPrefix:    r.cfg.DestPrefix,
+			Conflict:      r.conflict,
+			CheckpointKey: r.cfg.checkpointKey(),
+		})
+		done, tracked := make(chan struct{}), make(chan struct{})
+		go func() {
+			defer close(tracked)
+			r.track(ctx, m, done)
+		}()
+		err := m.Run(runCtx)
+		close(done)
+		<-tracked
+		if ctx.Err() != nil {
+			r.lg.Info("停止复制", zap.Int64("revision", m.Progress().Revision))
+			return
+		}
+		if m.Count() > 0 {
+			wait = retryMin
+		}
+		if err == rpctypes.ErrCompacted {
+			// 未复制的修改已被压缩,删除进度后重新全量复制
+			replicationCompacted.WithLabelValues(r.cfg.Name).Inc()
+			r.lg.Warn("未复制的修改已被压缩,重新全量复制", zap.Int64("revision", m.Progress().Revision))
+			_, err = r.dst.Delete(runCtx, r.cfg.checkpointKey())
+		}
+		if err != nil {
+			replicationErrors.WithLabelValues(r.cfg.Name).Inc()
+			r.lg.Warn("复制失败", zap.Duration("retry-after", wait), zap.Error(err))
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return
+		}
+		if !r.active() || r.s.Term() != term {
+			return
+		}
+		if wait *= 2; wait > retryMax {
+			wait = retryMax
+		}
+	}
+}
+
+// track 定期更新复制数和延迟指标,done 关闭时最后更新一次后返回.
+// 前缀下没有修改时复制进度不会推进,因此每次都请求一次watch进度通知,让进度跟上源集群的revision
+func (r *Replicator) track(ctx context.Context, m *mirror.Replicator, done <-chan struct{}) {
+	var count int64
+	observe := func() {
+		p := m.Progress()
+		replicatedChanges.WithLabelValues(r.cfg.Name).Add(float64(p.Count - count))
+		count = p.Count
+		if p.Revision == 0 {
+			return
+		}
+		replicationRevision.WithLabelValues(r.cfg.Name).Set(float64(p.Revision))
+		rev := r.sourceRev(ctx)
+		if rev == 0 {
+			return
+		}
+		lag := rev - p.Revision
+		if lag < 0 {
+			lag = 0
+		}
+		replicationLag.WithLabelValues(r.cfg.Name).Set(float64(lag))
+	}
+	ticker := time.NewTicker(metricsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			observe()
+			if !m.Progress().Base {
+				r.src.RequestProgress(ctx)
+			}
+		case <-done:
+			observe()
+			return
+		}
+	}
+}
+
+// sourceRev 返回源集群当前的revision,副本集群从上游的响应头中获取
+func (r *Replicator) sourceRev(ctx context.Context) int64 {
+	if !r.replica {
+		return r.s.KV().Rev()
+	}
+	resp, err := r.src.Get(ctx, r.cfg.Prefix, clientv3.WithCountOnly())
+	if err != nil {
+		return 0
+	}
+	return resp.Header.Revision
+}
@@ -164,3 +164,11 @@ func (as *AuthServer) UserChangePassword(ctx context.Context, r *pb.AuthUserChan
 	}
 	return resp, nil
 }
+
+func (as *AuthServer) Denials(ctx context.Context, r *pb.AuthDenialsRequest) (*pb.AuthDenialsResponse, error) {
+	resp, err := as.authenticator.Denials(ctx, r)
+	if err != nil {
+		return nil, togRPCError(err)
+	}
+	return resp, nil
+}
@@ -14,16 +14,40 @@
 
 package v3rpc
 
-import "github.com/golang/protobuf/proto"
+import (
+	"github.com/golang/protobuf/proto"
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+)
 
 type codec struct{}
 
+// 生成的消息自带 Marshal/Unmarshal,直接调用它们,避免经过proto反射包装;
+// 返回的字节直接交给gRPC写出,不再复制
+type selfMarshaler interface {
+	Marshal() ([]byte, error)
+	Unmarshal([]byte) error
+}
+
 func (c *codec) Marshal(v interface{}) ([]byte, error) {
+	if m, ok := v.(selfMarshaler); ok {
+		b, err := m.Marshal()
+		// 编码之后gRPC不再使用响应,归还从池中分配的切片
+		if resp, ok := v.(*pb.RangeResponse); ok {
+			etcdserver.ReleaseRangeResponse(resp)
+		}
+		return b, err
+	}
 	b, err := proto.Marshal(v.(proto.Message))
 	return b, err
 }
 
 func (c *codec) Unmarshal(data []byte, v interface{}) error {
+	if m, ok := v.(selfMarshaler); ok {
+		// 与 proto.Unmarshal 一致,解码前先清空
+		v.(proto.Message).Reset()
+		return m.Unmarshal(data)
+	}
 	return proto.Unmarshal(data, v.(proto.Message))
 }
 
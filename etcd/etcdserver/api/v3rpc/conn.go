@@ -0,0 +1,52 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v3rpc
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/stats"
+)
+
+// connTagger 给每个gRPC连接分配一个ID;unix socket 等连接的对端地址可能相同,不能用来区分连接
+type connTagger struct{}
+
+type connIDKey struct{}
+
+var connSeq uint64
+
+func (connTagger) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return context.WithValue(ctx, connIDKey{}, atomic.AddUint64(&connSeq, 1))
+}
+
+func (connTagger) HandleConn(context.Context, stats.ConnStats) {}
+
+func (connTagger) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context { return ctx }
+
+func (connTagger) HandleRPC(context.Context, stats.RPCStats) {}
+
+// connID 返回请求所在连接的标识,没有经过 connTagger 时使用对端地址
+func connID(ctx context.Context) string {
+	if id, ok := ctx.Value(connIDKey{}).(uint64); ok {
+		return strconv.FormatUint(id, 10)
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return p.Addr.String()
+	}
+	return ""
+}
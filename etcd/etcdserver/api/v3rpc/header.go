@@ -16,6 +16,7 @@ package v3rpc
 
 import (
 	"github.com/ls-2018/etcd_cn/etcd/etcdserver"
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver/api"
 	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
 )
 
@@ -23,6 +24,7 @@ type header struct {
 	clusterID int64
 	memberID  int64 // 本节点的ID
 	sg        etcdserver.RaftStatusGetter
+	cluster   api.Cluster
 	rev       func() int64
 }
 
@@ -31,6 +33,7 @@ func newHeader(s *etcdserver.EtcdServer) header {
 		clusterID: int64(s.Cluster().ID()),
 		memberID:  int64(s.ID()),
 		sg:        s,
+		cluster:   s.Cluster(),
 		rev:       func() int64 { return s.KV().Rev() },
 	}
 }
@@ -47,3 +50,15 @@ func (h *header) fill(rh *pb.ResponseHeader) {
 		rh.Revision = h.rev()
 	}
 }
+
+// fillLeaderHint 写请求由follower处理(经raft转发给leader)时,在响应头中附带leader的客户端URL,
+// 客户端可以据此把之后的写请求直接发给leader
+func (h *header) fillLeaderHint(rh *pb.ResponseHeader) {
+	lead := h.sg.Leader()
+	if lead == 0 || int64(lead) == h.memberID {
+		return
+	}
+	if m := h.cluster.Member(lead); m != nil {
+		rh.LeaderClientUrls = m.ClientURLs
+	}
+}
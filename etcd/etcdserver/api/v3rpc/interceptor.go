@@ -16,6 +16,8 @@ package v3rpc
 
 import (
 	"context"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -24,10 +26,14 @@ import (
 	"github.com/ls-2018/etcd_cn/client_sdk/pkg/types"
 	"github.com/ls-2018/etcd_cn/etcd/etcdserver"
 	"github.com/ls-2018/etcd_cn/etcd/etcdserver/api"
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver/api/rafthttp"
 	"github.com/ls-2018/etcd_cn/offical/api/v3/v3rpc/rpctypes"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
 
+	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 )
 
 const (
@@ -63,14 +69,147 @@ func newUnaryInterceptor(s *etcdserver.EtcdServer) grpc.UnaryServerInterceptor {
 			}
 		}
 
-		return handler(ctx, req)
+		if retryAfter, err := s.Admit(qosClassOf(ctx, info.FullMethod, req)); err != nil {
+			secs := int((retryAfter + time.Second - 1) / time.Second)
+			grpc.SetTrailer(ctx, metadata.Pairs(rpctypes.MetadataRetryAfterKey, strconv.Itoa(secs)))
+			return nil, togRPCError(err)
+		}
+
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		if err == rpctypes.ErrGRPCPermissionDenied {
+			recordDenial(ctx, s, info.FullMethod, req)
+		}
+		if took := time.Since(start); took > warnUnaryRequestLatency && info.FullMethod != snapshotMethod {
+			warnSlowRequest(ctx, s, info.FullMethod, req, took, err)
+		}
+		return resp, err
+	}
+}
+
+// qosClassOf 返回请求的服务等级:鉴权、租约撤销、集群和维护请求为critical,
+// 全量范围查询和压缩为batch,其余请求为normal;客户端声明的优先级可以覆盖KV和租约请求的等级
+func qosClassOf(ctx context.Context, method string, req interface{}) etcdserver.QoSClass {
+	switch {
+	case strings.HasPrefix(method, "/etcdserverpb.Auth/"),
+		strings.HasPrefix(method, "/etcdserverpb.Cluster/"),
+		strings.HasPrefix(method, "/etcdserverpb.Maintenance/"),
+		method == "/etcdserverpb.Lease/LeaseRevoke":
+		return etcdserver.QoSCritical
+	}
+	if c, ok := etcdserver.ParseQoSClass(callerInfoFromContext(ctx).priority); ok {
+		return c
+	}
+	switch r := req.(type) {
+	case *pb.CompactionRequest:
+		return etcdserver.QoSBatch
+	case *pb.RangeRequest:
+		if len(r.RangeEnd) > 0 && r.Limit == 0 && !r.CountOnly {
+			return etcdserver.QoSBatch
+		}
 	}
+	return etcdserver.QoSNormal
+}
+
+// callerInfo 客户端通过metadata附加的调用方信息
+type callerInfo struct {
+	app, requestID, priority string
+}
+
+func callerInfoFromContext(ctx context.Context) callerInfo {
+	md, _ := metadata.FromIncomingContext(ctx)
+	get := func(k string) string {
+		if vs := md.Get(k); len(vs) > 0 {
+			return vs[0]
+		}
+		return ""
+	}
+	return callerInfo{
+		app:       get(rpctypes.MetadataCallerAppKey),
+		requestID: get(rpctypes.MetadataCallerRequestIDKey),
+		priority:  get(rpctypes.MetadataCallerPriorityKey),
+	}
+}
+
+// warnSlowRequest 记录耗时超过 warnUnaryRequestLatency 的请求及其调用方
+func warnSlowRequest(ctx context.Context, s *etcdserver.EtcdServer, method string, req interface{}, took time.Duration, err error) {
+	ci := callerInfoFromContext(ctx)
+	key, end := requestKeyRange(req)
+	fields := []zap.Field{
+		zap.String("method", method),
+		zap.Duration("took", took),
+		zap.String("key", key),
+		zap.String("range-end", end),
+		zap.String("caller-app", ci.app),
+		zap.String("caller-request-id", ci.requestID),
+		zap.String("caller-priority", ci.priority),
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		fields = append(fields, zap.String("remote", p.Addr.String()))
+	}
+	if err != nil {
+		fields = append(fields, zap.Error(err))
+	}
+	s.Logger().Warn("请求耗时过长", fields...)
+}
+
+// recordDenial 记录权限检查失败的请求,由鉴权模块按采样比例写入本节点后端
+func recordDenial(ctx context.Context, s *etcdserver.EtcdServer, method string, req interface{}) {
+	if s.DowngradeFeatureBlocked(etcdserver.FeatureDenialAudit) {
+		return
+	}
+	d := &pb.AuthDenial{Op: method[strings.LastIndex(method, "/")+1:]}
+	d.Key, d.RangeEnd = requestKeyRange(req)
+	if ai, _ := s.AuthInfoFromCtx(ctx); ai != nil {
+		d.User = ai.Username
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		d.Caller = p.Addr.String()
+	}
+	ci := callerInfoFromContext(ctx)
+	d.App, d.RequestId, d.Priority = ci.app, ci.requestID, ci.priority
+	s.AuthStore().RecordDenial(d)
+}
+
+// requestKeyRange 返回KV请求涉及的key范围;事务取第一个比较条件或操作的key
+func requestKeyRange(req interface{}) (string, string) {
+	switch r := req.(type) {
+	case *pb.RangeRequest:
+		return r.Key, r.RangeEnd
+	case *pb.PutRequest:
+		return r.Key, ""
+	case *pb.DeleteRangeRequest:
+		return r.Key, r.RangeEnd
+	case *pb.TxnRequest:
+		if len(r.Compare) > 0 {
+			return r.Compare[0].Key, r.Compare[0].RangeEnd
+		}
+		for _, ops := range [][]*pb.RequestOp{r.Success, r.Failure} {
+			for _, op := range ops {
+				switch {
+				case op.GetRequestRange() != nil:
+					return requestKeyRange(op.GetRequestRange())
+				case op.GetRequestPut() != nil:
+					return requestKeyRange(op.GetRequestPut())
+				case op.GetRequestDeleteRange() != nil:
+					return requestKeyRange(op.GetRequestDeleteRange())
+				case op.GetRequestTxn() != nil:
+					return requestKeyRange(op.GetRequestTxn())
+				}
+			}
+		}
+	}
+	return "", ""
 }
 
 func newStreamInterceptor(s *etcdserver.EtcdServer) grpc.StreamServerInterceptor {
 	smap := monitorLeader(s)
 
 	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if info.FullMethod == rafthttp.StreamMethod {
+			// 成员之间的raft消息流,集群版本确定之前、learner上也必须可用
+			return handler(srv, ss)
+		}
 		if !api.IsCapabilityEnabled(api.V3rpcCapability) {
 			return rpctypes.ErrGRPCNotCapable
 		}
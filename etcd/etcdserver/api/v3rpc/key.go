@@ -49,6 +49,7 @@ func (s *kvServer) Put(ctx context.Context, r *pb.PutRequest) (*pb.PutResponse,
 	}
 
 	s.hdr.fill(resp.Header)
+	s.hdr.fillLeaderHint(resp.Header)
 	return resp, nil
 }
 
@@ -65,6 +66,7 @@ func (s *kvServer) DeleteRange(ctx context.Context, r *pb.DeleteRangeRequest) (*
 	}
 
 	s.hdr.fill(resp.Header)
+	s.hdr.fillLeaderHint(resp.Header)
 	return resp, nil
 }
 
@@ -88,6 +90,7 @@ func (s *kvServer) Txn(ctx context.Context, r *pb.TxnRequest) (*pb.TxnResponse,
 	}
 
 	s.hdr.fill(resp.Header)
+	s.hdr.fillLeaderHint(resp.Header)
 	return resp, nil
 }
 
@@ -103,6 +106,46 @@ func (s *kvServer) Compact(ctx context.Context, r *pb.CompactionRequest) (*pb.Co
 	return resp, nil
 }
 
+// StagedTxn 分多次暂存超过 max-txn-ops 的操作,提交时作为一个事务原子地应用.
+// 每次追加的操作仍然受 max-txn-ops 和请求大小的限制,提交前检查整个事务中是否有重复的key
+func (s *kvServer) StagedTxn(ctx context.Context, r *pb.StagedTxnRequest) (*pb.StagedTxnResponse, error) {
+	switch r.Action {
+	case pb.StagedTxnRequest_APPEND:
+		chunk := &pb.TxnRequest{Compare: r.Compare, Success: r.Success, Failure: r.Failure}
+		if err := checkTxnRequest(chunk, int(s.maxTxnOps)); err != nil {
+			return nil, err
+		}
+		if _, _, err := checkIntervals(r.Success); err != nil {
+			return nil, err
+		}
+		if _, _, err := checkIntervals(r.Failure); err != nil {
+			return nil, err
+		}
+	case pb.StagedTxnRequest_COMMIT:
+		txn, err := s.kv.LoadStagedTxn(ctx, r.StageId)
+		if err != nil {
+			return nil, togRPCError(err)
+		}
+		if _, _, err := checkIntervals(txn.Success); err != nil {
+			return nil, err
+		}
+		if _, _, err := checkIntervals(txn.Failure); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := s.kv.StagedTxn(ctx, r)
+	if err != nil {
+		return nil, togRPCError(err)
+	}
+
+	s.hdr.fill(resp.Header)
+	if resp.Txn != nil {
+		s.hdr.fill(resp.Txn.Header)
+	}
+	return resp, nil
+}
+
 func checkPutRequest(r *pb.PutRequest) error {
 	if len(r.Key) == 0 {
 		return rpctypes.ErrGRPCEmptyKey
@@ -18,13 +18,19 @@ import (
 	"context"
 	"crypto/sha256"
 	"io"
+	"runtime/pprof"
+	"runtime/trace"
 	"time"
 
+	"github.com/coreos/go-semver/semver"
 	"github.com/dustin/go-humanize"
 	"github.com/ls-2018/etcd_cn/raft"
 
+	"github.com/ls-2018/etcd_cn/client_sdk/pkg/transport"
 	"github.com/ls-2018/etcd_cn/etcd/auth"
 	"github.com/ls-2018/etcd_cn/etcd/etcdserver"
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver/api/membership"
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver/api/rafthttp"
 	"github.com/ls-2018/etcd_cn/etcd/mvcc"
 	"github.com/ls-2018/etcd_cn/etcd/mvcc/backend"
 	"github.com/ls-2018/etcd_cn/offical/api/v3/v3rpc/rpctypes"
@@ -55,6 +61,41 @@ type LeaderTransferrer interface {
 	MoveLeader(ctx context.Context, lead, target uint64) error
 }
 
+type ReadOnlyController interface {
+	ReadOnly() bool
+	SetReadOnly(on bool) error
+}
+
+type LogLevelController interface {
+	LogLevels() []etcdserver.LogScopeLevel
+	SetLogLevels(levels map[string]string) error
+}
+
+type FaultInjector interface {
+	Failpoint(ctx context.Context, r *pb.FailpointRequest) (*pb.FailpointResponse, error)
+}
+
+type PeerStatsGetter interface {
+	PeerStats() []rafthttp.PeerStats
+}
+
+type CompactionHolder interface {
+	CompactionHold(ctx context.Context, r *pb.CompactionHoldRequest) (*pb.CompactionHoldResponse, error)
+}
+
+type UserUsageGetter interface {
+	UserUsage(ctx context.Context, r *pb.UserUsageRequest) (*pb.UserUsageResponse, error)
+}
+
+type SnapshotSessioner interface {
+	SnapshotSession(ctx context.Context, r *pb.SnapshotSessionRequest) (*pb.SnapshotSessionResponse, error)
+}
+
+type ReplicaPromoter interface {
+	IsReplica() bool
+	PromoteReplica(ctx context.Context) (int64, error)
+}
+
 type AuthGetter interface {
 	AuthInfoFromCtx(ctx context.Context) (*auth.AuthInfo, error)
 	AuthStore() auth.AuthStore
@@ -62,6 +103,12 @@ type AuthGetter interface {
 
 type ClusterStatusGetter interface {
 	IsLearner() bool
+	ClusterVersion() *semver.Version
+	DowngradeInfo() *membership.DowngradeInfo
+	DowngradeFeatures() []*pb.DowngradeFeatureStatus
+	LatencySummaries() []*pb.LatencySummary
+	StartupStatus() *pb.StartupStatus
+	LearnerProgress() []*pb.LearnerProgress
 }
 
 type maintenanceServer struct {
@@ -74,10 +121,18 @@ type maintenanceServer struct {
 	hdr header
 	cs  ClusterStatusGetter
 	d   Downgrader
+	ro  ReadOnlyController
+	ll  LogLevelController
+	fi  FaultInjector
+	ps  PeerStatsGetter
+	ch  CompactionHolder
+	uu  UserUsageGetter
+	ss  SnapshotSessioner
+	rp  ReplicaPromoter
 }
 
 func NewMaintenanceServer(s *etcdserver.EtcdServer) pb.MaintenanceServer {
-	srv := &maintenanceServer{lg: s.Cfg.Logger, rg: s, kg: s, bg: s, a: s, lt: s, hdr: newHeader(s), cs: s, d: s}
+	srv := &maintenanceServer{lg: s.Cfg.Logger, rg: s, kg: s, bg: s, a: s, lt: s, hdr: newHeader(s), cs: s, d: s, ro: s, ll: s, fi: s, ps: s, ch: s, uu: s, ss: s, rp: s}
 	if srv.lg == nil {
 		srv.lg = zap.NewNop()
 	}
@@ -121,6 +176,136 @@ func (ms *maintenanceServer) Downgrade(ctx context.Context, r *pb.DowngradeReque
 	return resp, nil
 }
 
+// ReloadCerts 重新加载 peer、client 的证书、私钥和CA文件,并返回当前已加载的证书
+func (ms *maintenanceServer) ReloadCerts(ctx context.Context, r *pb.ReloadCertsRequest) (*pb.ReloadCertsResponse, error) {
+	resp := &pb.ReloadCertsResponse{Header: &pb.ResponseHeader{}}
+	var infos []transport.CertInfo
+	if r.ReportOnly {
+		infos = transport.LoadedCerts()
+	} else {
+		ms.lg.Info("开始 重新加载证书")
+		var err error
+		if infos, err = transport.ReloadCerts(ms.lg); err != nil {
+			resp.Error = err.Error()
+		}
+	}
+	for _, ci := range infos {
+		resp.Certs = append(resp.Certs, &pb.CertInfo{
+			Kind:        ci.Kind,
+			File:        ci.File,
+			Subject:     ci.Subject,
+			Fingerprint: ci.Fingerprint,
+			NotBefore:   ci.NotBefore.Unix(),
+			NotAfter:    ci.NotAfter.Unix(),
+			LoadedAt:    ci.LoadedAt.Unix(),
+		})
+	}
+	ms.hdr.fill(resp.Header)
+	return resp, nil
+}
+
+// MaintenanceMode 切换本成员的只读维护模式
+func (ms *maintenanceServer) MaintenanceMode(ctx context.Context, r *pb.MaintenanceModeRequest) (*pb.MaintenanceModeResponse, error) {
+	if err := ms.ro.SetReadOnly(r.ReadOnly); err != nil {
+		return nil, togRPCError(err)
+	}
+	resp := &pb.MaintenanceModeResponse{Header: &pb.ResponseHeader{}, ReadOnly: ms.ro.ReadOnly()}
+	ms.hdr.fill(resp.Header)
+	return resp, nil
+}
+
+// LogLevel 设置并返回各子系统的日志等级
+func (ms *maintenanceServer) LogLevel(ctx context.Context, r *pb.LogLevelRequest) (*pb.LogLevelResponse, error) {
+	if len(r.Levels) > 0 {
+		levels := make(map[string]string, len(r.Levels))
+		for _, l := range r.Levels {
+			levels[l.Scope] = l.Level
+		}
+		if err := ms.ll.SetLogLevels(levels); err != nil {
+			return nil, togRPCError(err)
+		}
+	}
+	resp := &pb.LogLevelResponse{Header: &pb.ResponseHeader{}}
+	for _, l := range ms.ll.LogLevels() {
+		resp.Levels = append(resp.Levels, &pb.LogScopeLevel{Scope: l.Scope, Level: l.Level.String(), Inherited: l.Inherited})
+	}
+	ms.hdr.fill(resp.Header)
+	return resp, nil
+}
+
+// Failpoint 注入或解除本成员的故障,并返回当前生效的故障
+func (ms *maintenanceServer) Failpoint(ctx context.Context, r *pb.FailpointRequest) (*pb.FailpointResponse, error) {
+	resp, err := ms.fi.Failpoint(ctx, r)
+	if err != nil {
+		return nil, togRPCError(err)
+	}
+	ms.hdr.fill(resp.Header)
+	return resp, nil
+}
+
+// PeerStats 返回本成员到各个对端的网络状况
+func (ms *maintenanceServer) PeerStats(ctx context.Context, r *pb.PeerStatsRequest) (*pb.PeerStatsResponse, error) {
+	resp := &pb.PeerStatsResponse{Header: &pb.ResponseHeader{}}
+	for _, st := range ms.ps.PeerStats() {
+		resp.Peers = append(resp.Peers, &pb.PeerNetworkStats{
+			ID:                  uint64(st.ID),
+			Active:              st.Active,
+			Outbound:            st.Outbound,
+			Inbound:             st.Inbound,
+			RttUs:               st.RTT.Microseconds(),
+			SendQueueDepth:      int64(st.SendQueueDepth),
+			DroppedSent:         st.DroppedSent,
+			DroppedReceived:     st.DroppedReceived,
+			AsymmetricPartition: st.AsymmetricPartition,
+			LastError:           st.LastError,
+			ClockOffsetUs:       st.ClockOffset.Microseconds(),
+		})
+	}
+	ms.hdr.fill(resp.Header)
+	return resp, nil
+}
+
+// CompactionHold 登记、续期或释放压缩保留,并返回当前有效的保留
+func (ms *maintenanceServer) CompactionHold(ctx context.Context, r *pb.CompactionHoldRequest) (*pb.CompactionHoldResponse, error) {
+	resp, err := ms.ch.CompactionHold(ctx, r)
+	if err != nil {
+		return nil, togRPCError(err)
+	}
+	ms.hdr.fill(resp.Header)
+	return resp, nil
+}
+
+// UserUsage 返回每个用户的写入统计和预算,可以先把统计清零
+func (ms *maintenanceServer) UserUsage(ctx context.Context, r *pb.UserUsageRequest) (*pb.UserUsageResponse, error) {
+	resp, err := ms.uu.UserUsage(ctx, r)
+	if err != nil {
+		return nil, togRPCError(err)
+	}
+	ms.hdr.fill(resp.Header)
+	return resp, nil
+}
+
+// SnapshotSession 创建、续期或释放快照会话
+func (ms *maintenanceServer) SnapshotSession(ctx context.Context, r *pb.SnapshotSessionRequest) (*pb.SnapshotSessionResponse, error) {
+	resp, err := ms.ss.SnapshotSession(ctx, r)
+	if err != nil {
+		return nil, togRPCError(err)
+	}
+	ms.hdr.fill(resp.Header)
+	return resp, nil
+}
+
+// PromoteReplica 提升只读副本集群,停止从上游复制并开始接受写请求
+func (ms *maintenanceServer) PromoteReplica(ctx context.Context, r *pb.PromoteReplicaRequest) (*pb.PromoteReplicaResponse, error) {
+	rev, err := ms.rp.PromoteReplica(ctx)
+	if err != nil {
+		return nil, togRPCError(err)
+	}
+	resp := &pb.PromoteReplicaResponse{Header: &pb.ResponseHeader{}, Revision: rev}
+	ms.hdr.fill(resp.Header)
+	return resp, nil
+}
+
 type authMaintenanceServer struct {
 	*maintenanceServer
 	ag AuthGetter
@@ -135,8 +320,18 @@ func (ams *authMaintenanceServer) isAuthenticated(ctx context.Context) error {
 	return ams.ag.AuthStore().IsAdminPermitted(authInfo)
 }
 
+// isOpPermitted 检查用户是否可以执行非KV操作,root用户或角色被授予了op的用户可以执行
+func (ams *authMaintenanceServer) isOpPermitted(ctx context.Context, op string) error {
+	authInfo, err := ams.ag.AuthInfoFromCtx(ctx)
+	if err != nil {
+		return err
+	}
+
+	return ams.ag.AuthStore().IsOpPermitted(authInfo, op)
+}
+
 func (ams *authMaintenanceServer) Defragment(ctx context.Context, sr *pb.DefragmentRequest) (*pb.DefragmentResponse, error) {
-	if err := ams.isAuthenticated(ctx); err != nil {
+	if err := ams.isOpPermitted(ctx, auth.OpDefragment); err != nil {
 		return nil, err
 	}
 
@@ -144,7 +339,7 @@ func (ams *authMaintenanceServer) Defragment(ctx context.Context, sr *pb.Defragm
 }
 
 func (ams *authMaintenanceServer) Hash(ctx context.Context, r *pb.HashRequest) (*pb.HashResponse, error) {
-	if err := ams.isAuthenticated(ctx); err != nil {
+	if err := ams.isOpPermitted(ctx, auth.OpHash); err != nil {
 		return nil, err
 	}
 
@@ -152,7 +347,7 @@ func (ams *authMaintenanceServer) Hash(ctx context.Context, r *pb.HashRequest) (
 }
 
 func (ams *authMaintenanceServer) HashKV(ctx context.Context, r *pb.HashKVRequest) (*pb.HashKVResponse, error) {
-	if err := ams.isAuthenticated(ctx); err != nil {
+	if err := ams.isOpPermitted(ctx, auth.OpHash); err != nil {
 		return nil, err
 	}
 	return ams.maintenanceServer.HashKV(ctx, r)
@@ -170,6 +365,69 @@ func (ams *authMaintenanceServer) Downgrade(ctx context.Context, r *pb.Downgrade
 	return ams.maintenanceServer.Downgrade(ctx, r)
 }
 
+func (ams *authMaintenanceServer) ReloadCerts(ctx context.Context, r *pb.ReloadCertsRequest) (*pb.ReloadCertsResponse, error) {
+	if err := ams.isAuthenticated(ctx); err != nil {
+		return nil, err
+	}
+	return ams.maintenanceServer.ReloadCerts(ctx, r)
+}
+
+func (ams *authMaintenanceServer) MaintenanceMode(ctx context.Context, r *pb.MaintenanceModeRequest) (*pb.MaintenanceModeResponse, error) {
+	if err := ams.isAuthenticated(ctx); err != nil {
+		return nil, err
+	}
+	return ams.maintenanceServer.MaintenanceMode(ctx, r)
+}
+
+func (ams *authMaintenanceServer) LogLevel(ctx context.Context, r *pb.LogLevelRequest) (*pb.LogLevelResponse, error) {
+	if err := ams.isAuthenticated(ctx); err != nil {
+		return nil, err
+	}
+	return ams.maintenanceServer.LogLevel(ctx, r)
+}
+
+func (ams *authMaintenanceServer) Failpoint(ctx context.Context, r *pb.FailpointRequest) (*pb.FailpointResponse, error) {
+	if err := ams.isAuthenticated(ctx); err != nil {
+		return nil, err
+	}
+	return ams.maintenanceServer.Failpoint(ctx, r)
+}
+
+func (ams *authMaintenanceServer) PeerStats(ctx context.Context, r *pb.PeerStatsRequest) (*pb.PeerStatsResponse, error) {
+	if err := ams.isAuthenticated(ctx); err != nil {
+		return nil, err
+	}
+	return ams.maintenanceServer.PeerStats(ctx, r)
+}
+
+func (ams *authMaintenanceServer) CompactionHold(ctx context.Context, r *pb.CompactionHoldRequest) (*pb.CompactionHoldResponse, error) {
+	if err := ams.isOpPermitted(ctx, auth.OpCompactionHold); err != nil {
+		return nil, err
+	}
+	return ams.maintenanceServer.CompactionHold(ctx, r)
+}
+
+func (ams *authMaintenanceServer) UserUsage(ctx context.Context, r *pb.UserUsageRequest) (*pb.UserUsageResponse, error) {
+	if err := ams.isOpPermitted(ctx, auth.OpUserUsage); err != nil {
+		return nil, err
+	}
+	return ams.maintenanceServer.UserUsage(ctx, r)
+}
+
+func (ams *authMaintenanceServer) SnapshotSession(ctx context.Context, r *pb.SnapshotSessionRequest) (*pb.SnapshotSessionResponse, error) {
+	if err := ams.isOpPermitted(ctx, auth.OpSnapshotSession); err != nil {
+		return nil, err
+	}
+	return ams.maintenanceServer.SnapshotSession(ctx, r)
+}
+
+func (ams *authMaintenanceServer) PromoteReplica(ctx context.Context, r *pb.PromoteReplicaRequest) (*pb.PromoteReplicaResponse, error) {
+	if err := ams.isAuthenticated(ctx); err != nil {
+		return nil, err
+	}
+	return ams.maintenanceServer.PromoteReplica(ctx, r)
+}
+
 // ------------------------------------  OVER ---------------------------------------------------------------
 
 // Alarm ok
@@ -199,6 +457,18 @@ func (ms *maintenanceServer) Status(ctx context.Context, ar *pb.StatusRequest) (
 		DbSize:           ms.bg.Backend().Size(),
 		DbSizeInUse:      ms.bg.Backend().SizeInUse(),
 		IsLearner:        ms.cs.IsLearner(),
+		ReadOnly:         ms.ro.ReadOnly(),
+		Replica:          ms.rp.IsReplica(),
+		Latency:          ms.cs.LatencySummaries(),
+		Startup:          ms.cs.StartupStatus(),
+		LearnerProgress:  ms.cs.LearnerProgress(),
+	}
+	if cv := ms.cs.ClusterVersion(); cv != nil {
+		resp.ClusterVersion = cv.String()
+	}
+	if d := ms.cs.DowngradeInfo(); d.Enabled {
+		resp.DowngradeTargetVersion = d.TargetVersion
+		resp.DowngradeFeatures = ms.cs.DowngradeFeatures()
 	}
 	if resp.Leader == raft.None {
 		resp.Errors = append(resp.Errors, etcdserver.ErrNoLeader.Error())
@@ -211,13 +481,20 @@ func (ms *maintenanceServer) Status(ctx context.Context, ar *pb.StatusRequest) (
 
 // Snapshot 获取一个快照
 func (ams *authMaintenanceServer) Snapshot(sr *pb.SnapshotRequest, srv pb.Maintenance_SnapshotServer) error {
-	if err := ams.isAuthenticated(srv.Context()); err != nil {
+	if err := ams.isOpPermitted(srv.Context(), auth.OpSnapshot); err != nil {
 		return err
 	}
 
 	return ams.maintenanceServer.Snapshot(sr, srv)
 }
 
+func (ams *authMaintenanceServer) Profile(pr *pb.ProfileRequest, srv pb.Maintenance_ProfileServer) error {
+	if err := ams.isAuthenticated(srv.Context()); err != nil {
+		return err
+	}
+	return ams.maintenanceServer.Profile(pr, srv)
+}
+
 // Snapshot 获取一个快照
 func (ms *maintenanceServer) Snapshot(sr *pb.SnapshotRequest, srv pb.Maintenance_SnapshotServer) error {
 	snap := ms.bg.Backend().Snapshot() // 快照结构体, 初始化 发送超时
@@ -282,6 +559,92 @@ func (ms *maintenanceServer) Snapshot(sr *pb.SnapshotRequest, srv pb.Maintenance
 	return nil
 }
 
+// maxProfileDuration cpu profile 和 trace 的最长采集时间
+const maxProfileDuration = 5 * time.Minute
+
+// Profile 在本成员上采集 profile 并分块流式返回,不需要开启 pprof HTTP 监听
+func (ms *maintenanceServer) Profile(pr *pb.ProfileRequest, srv pb.Maintenance_ProfileServer) error {
+	d := time.Duration(pr.Duration) * time.Second
+	switch pr.Type {
+	case "cpu", "trace":
+		if d <= 0 || d > maxProfileDuration {
+			return rpctypes.ErrGRPCInvalidProfileDuration
+		}
+	default:
+		if pprof.Lookup(pr.Type) == nil {
+			return rpctypes.ErrGRPCInvalidProfileType
+		}
+	}
+
+	ctx, cancel := context.WithCancel(srv.Context())
+	defer cancel()
+	r, w := io.Pipe()
+	defer r.Close()
+
+	// cpu profile 和 trace 进程内只能同时有一个,需要同步启动以便返回错误
+	stop := func() {}
+	switch pr.Type {
+	case "cpu":
+		if err := pprof.StartCPUProfile(w); err != nil {
+			return rpctypes.ErrGRPCProfileInProgress
+		}
+		stop = pprof.StopCPUProfile
+	case "trace":
+		if err := trace.Start(w); err != nil {
+			return rpctypes.ErrGRPCProfileInProgress
+		}
+		stop = trace.Stop
+	}
+	go func() {
+		if pr.Type == "cpu" || pr.Type == "trace" {
+			t := time.NewTimer(d)
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				t.Stop()
+			}
+			stop()
+			w.Close()
+			return
+		}
+		w.CloseWithError(pprof.Lookup(pr.Type).WriteTo(w, 0))
+	}()
+
+	start := time.Now()
+	ms.lg.Info("开始采集 profile", zap.String("type", pr.Type), zap.Duration("duration", d))
+	sent := 0
+	for {
+		buf := make([]byte, snapshotSendBufferSize)
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			resp := &pb.ProfileResponse{Blob: buf[:n]}
+			if sent == 0 {
+				resp.Header = &pb.ResponseHeader{}
+				ms.hdr.fill(resp.Header)
+			}
+			if serr := srv.Send(resp); serr != nil {
+				return togRPCError(serr)
+			}
+			sent += n
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return togRPCError(err)
+		}
+	}
+	if ctx.Err() != nil {
+		return togRPCError(ctx.Err())
+	}
+
+	ms.lg.Info("成功发送 profile 到客户端", zap.String("type", pr.Type),
+		zap.String("size", humanize.Bytes(uint64(sent))),
+		zap.String("took", humanize.Time(start)),
+	)
+	return nil
+}
+
 // Hash ok
 func (ms *maintenanceServer) Hash(ctx context.Context, r *pb.HashRequest) (*pb.HashResponse, error) {
 	h, rev, err := ms.kg.KV().Hash()
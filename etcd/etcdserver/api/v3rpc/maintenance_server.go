@@ -0,0 +1,132 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v3rpc
+
+import (
+	"context"
+	"crypto/tls"
+
+	"github.com/ls-2018/etcd_cn/client_sdk/v3/credentials"
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver"
+	"github.com/ls-2018/etcd_cn/offical/api/v3/v3rpc/rpctypes"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+var (
+	maintenanceInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "etcd",
+		Subsystem: "maintenance",
+		Name:      "requests_in_flight",
+		Help:      "The number of requests being served on the dedicated maintenance listener.",
+	})
+	maintenanceRejected = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "etcd",
+		Subsystem: "maintenance",
+		Name:      "requests_rejected_total",
+		Help:      "The total number of requests rejected because the dedicated maintenance listener reached its concurrency limit.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(maintenanceInFlight)
+	prometheus.MustRegister(maintenanceRejected)
+}
+
+// MaintenanceServer 创建只提供 Maintenance 服务的 gRPC 服务端,与客户端端口分开监听,
+// 快照、碎片整理等耗时请求不会和kv请求抢占连接和流.maxConcurrent 限制同时处理的请求数,0表示不限制.
+func MaintenanceServer(s *etcdserver.EtcdServer, tls *tls.Config, maxConcurrent int, ics Interceptors, gopts ...grpc.ServerOption) *grpc.Server {
+	var opts []grpc.ServerOption
+	opts = append(opts, grpc.CustomCodec(&codec{}))
+	if tls != nil {
+		bundle := credentials.NewBundle(credentials.Config{TLSConfig: tls})
+		opts = append(opts, grpc.Creds(bundle.TransportCredentials()))
+	}
+	lim := newConcurrencyLimiter(maxConcurrent)
+	// 并发限制放在注入的拦截器之后,只限制真正处理请求的时间
+	unary, stream := ics.chain(
+		[]grpc.UnaryServerInterceptor{newUnaryInterceptor(s), grpc_prometheus.UnaryServerInterceptor},
+		[]grpc.StreamServerInterceptor{newStreamInterceptor(s), grpc_prometheus.StreamServerInterceptor},
+	)
+	opts = append(opts, grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(append(unary, lim.unary)...)))
+	opts = append(opts, grpc.StreamInterceptor(grpc_middleware.ChainStreamServer(append(stream, lim.stream)...)))
+	opts = append(opts, grpc.MaxRecvMsgSize(int(s.Cfg.MaxRequestBytes+grpcOverheadBytes)))
+	opts = append(opts, grpc.MaxSendMsgSize(maxSendBytes))
+	opts = append(opts, grpc.MaxConcurrentStreams(maxStreams))
+
+	grpcServer := grpc.NewServer(append(opts, gopts...)...)
+	pb.RegisterMaintenanceServer(grpcServer, NewMaintenanceServer(s))
+
+	hsrv := health.NewServer()
+	hsrv.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(grpcServer, hsrv)
+	grpc_prometheus.Register(grpcServer)
+	return grpcServer
+}
+
+// concurrencyLimiter 限制同时处理的请求数,超过时直接拒绝,不排队
+type concurrencyLimiter struct {
+	sem chan struct{} // nil 表示不限制
+}
+
+func newConcurrencyLimiter(n int) *concurrencyLimiter {
+	l := &concurrencyLimiter{}
+	if n > 0 {
+		l.sem = make(chan struct{}, n)
+	}
+	return l
+}
+
+func (l *concurrencyLimiter) acquire() bool {
+	if l.sem != nil {
+		select {
+		case l.sem <- struct{}{}:
+		default:
+			maintenanceRejected.Inc()
+			return false
+		}
+	}
+	maintenanceInFlight.Inc()
+	return true
+}
+
+func (l *concurrencyLimiter) release() {
+	maintenanceInFlight.Dec()
+	if l.sem != nil {
+		<-l.sem
+	}
+}
+
+func (l *concurrencyLimiter) unary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if !l.acquire() {
+		return nil, rpctypes.ErrGRPCRequestTooManyRequests
+	}
+	defer l.release()
+	return handler(ctx, req)
+}
+
+func (l *concurrencyLimiter) stream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if !l.acquire() {
+		return rpctypes.ErrGRPCRequestTooManyRequests
+	}
+	defer l.release()
+	return handler(srv, ss)
+}
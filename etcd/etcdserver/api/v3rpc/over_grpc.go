@@ -36,7 +36,29 @@ const (
 	maxSendBytes      = math.MaxInt32
 )
 
-func Server(s *etcdserver.EtcdServer, tls *tls.Config, interceptor grpc.UnaryServerInterceptor, gopts ...grpc.ServerOption) *grpc.Server {
+// Interceptors 嵌入etcd的程序注入的gRPC拦截器.拦截器链的顺序固定为:
+//
+//	PreUnary/PreStream -> etcd的请求检查 -> prometheus指标 -> 分布式追踪 -> Unary/Stream -> 服务
+//
+// 鉴权在服务中进行,注入的拦截器总是在鉴权之前运行,需要用户信息时用 EtcdServer.AuthInfoFromCtx 获取.
+// 同一组中的拦截器按切片顺序运行.
+type Interceptors struct {
+	// PreUnary/PreStream 最先运行,能看到被etcd拒绝的请求,它们的耗时不计入指标
+	PreUnary  []grpc.UnaryServerInterceptor
+	PreStream []grpc.StreamServerInterceptor
+	// Unary/Stream 在etcd的请求检查和指标之后运行,它们拒绝的请求也会计入指标
+	Unary  []grpc.UnaryServerInterceptor
+	Stream []grpc.StreamServerInterceptor
+}
+
+// chain 按 Interceptors 规定的顺序把注入的拦截器和etcd自己的拦截器连接起来
+func (ics Interceptors) chain(unary []grpc.UnaryServerInterceptor, stream []grpc.StreamServerInterceptor) ([]grpc.UnaryServerInterceptor, []grpc.StreamServerInterceptor) {
+	u := append(append(append([]grpc.UnaryServerInterceptor{}, ics.PreUnary...), unary...), ics.Unary...)
+	st := append(append(append([]grpc.StreamServerInterceptor{}, ics.PreStream...), stream...), ics.Stream...)
+	return u, st
+}
+
+func Server(s *etcdserver.EtcdServer, tls *tls.Config, ics Interceptors, gopts ...grpc.ServerOption) *grpc.Server {
 	var opts []grpc.ServerOption
 	opts = append(opts, grpc.CustomCodec(&codec{}))
 	if tls != nil {
@@ -48,9 +70,6 @@ func Server(s *etcdserver.EtcdServer, tls *tls.Config, interceptor grpc.UnarySer
 		newUnaryInterceptor(s), // 元信息校验
 		grpc_prometheus.UnaryServerInterceptor,
 	}
-	if interceptor != nil {
-		chainUnaryInterceptors = append(chainUnaryInterceptors, interceptor)
-	}
 	// 流式通信
 	chainStreamInterceptors := []grpc.StreamServerInterceptor{
 		newStreamInterceptor(s),
@@ -61,6 +80,7 @@ func Server(s *etcdserver.EtcdServer, tls *tls.Config, interceptor grpc.UnarySer
 		chainUnaryInterceptors = append(chainUnaryInterceptors, otelgrpc.UnaryServerInterceptor(s.Cfg.ExperimentalTracerOptions...))
 		chainStreamInterceptors = append(chainStreamInterceptors, otelgrpc.StreamServerInterceptor(s.Cfg.ExperimentalTracerOptions...))
 	}
+	chainUnaryInterceptors, chainStreamInterceptors = ics.chain(chainUnaryInterceptors, chainStreamInterceptors)
 
 	opts = append(opts, grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(chainUnaryInterceptors...)))
 	opts = append(opts, grpc.StreamInterceptor(grpc_middleware.ChainStreamServer(chainStreamInterceptors...)))
@@ -68,6 +88,7 @@ func Server(s *etcdserver.EtcdServer, tls *tls.Config, interceptor grpc.UnarySer
 	opts = append(opts, grpc.MaxRecvMsgSize(int(s.Cfg.MaxRequestBytes+grpcOverheadBytes)))
 	opts = append(opts, grpc.MaxSendMsgSize(maxSendBytes))
 	opts = append(opts, grpc.MaxConcurrentStreams(maxStreams))
+	opts = append(opts, grpc.StatsHandler(connTagger{})) // 按连接限制watch数时区分连接
 
 	grpcServer := grpc.NewServer(append(opts, gopts...)...)
 
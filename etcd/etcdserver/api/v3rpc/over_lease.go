@@ -17,7 +17,9 @@ package v3rpc
 import (
 	"context"
 	"io"
+	"time"
 
+	"github.com/ls-2018/etcd_cn/etcd/auth"
 	"github.com/ls-2018/etcd_cn/etcd/etcdserver"
 	"github.com/ls-2018/etcd_cn/etcd/lease"
 	"github.com/ls-2018/etcd_cn/offical/api/v3/v3rpc/rpctypes"
@@ -26,21 +28,40 @@ import (
 	"go.uber.org/zap"
 )
 
+// ClockSkewGetter 返回本成员与各对端之间最大的时钟偏差,用于标注租约操作的响应
+type ClockSkewGetter interface {
+	ClockSkew() time.Duration
+}
+
 type LeaseServer struct {
 	lg  *zap.Logger
 	hdr header
 	le  etcdserver.Lessor
+	ag  AuthGetter
+	cs  ClockSkewGetter
 }
 
 func NewLeaseServer(s *etcdserver.EtcdServer) pb.LeaseServer {
-	srv := &LeaseServer{lg: s.Cfg.Logger, le: s, hdr: newHeader(s)}
+	srv := &LeaseServer{lg: s.Cfg.Logger, le: s, hdr: newHeader(s), ag: s, cs: s}
 	if srv.lg == nil {
 		srv.lg = zap.NewNop()
 	}
 	return srv
 }
 
+// isPermitted 检查用户是否有租约操作权限
+func (ls *LeaseServer) isPermitted(ctx context.Context) error {
+	authInfo, err := ls.ag.AuthInfoFromCtx(ctx)
+	if err != nil {
+		return err
+	}
+	return ls.ag.AuthStore().IsOpPermitted(authInfo, auth.OpLease)
+}
+
 func (ls *LeaseServer) LeaseTimeToLive(ctx context.Context, rr *pb.LeaseTimeToLiveRequest) (*pb.LeaseTimeToLiveResponse, error) {
+	if err := ls.isPermitted(ctx); err != nil {
+		return nil, togRPCError(err)
+	}
 	resp, err := ls.le.LeaseTimeToLive(ctx, rr)
 	if err != nil && err != lease.ErrLeaseNotFound {
 		return nil, togRPCError(err)
@@ -53,11 +74,15 @@ func (ls *LeaseServer) LeaseTimeToLive(ctx context.Context, rr *pb.LeaseTimeToLi
 		}
 	}
 	ls.hdr.fill(resp.Header)
+	resp.ClockSkewMs = ls.cs.ClockSkew().Milliseconds()
 	return resp, nil
 }
 
 // LeaseLeases 获取当前节点上的所有租约
 func (ls *LeaseServer) LeaseLeases(ctx context.Context, rr *pb.LeaseLeasesRequest) (*pb.LeaseLeasesResponse, error) {
+	if err := ls.isPermitted(ctx); err != nil {
+		return nil, togRPCError(err)
+	}
 	resp, err := ls.le.LeaseLeases(ctx, rr)
 	if err != nil && err != lease.ErrLeaseNotFound {
 		return nil, togRPCError(err)
@@ -72,6 +97,21 @@ func (ls *LeaseServer) LeaseLeases(ctx context.Context, rr *pb.LeaseLeasesReques
 	return resp, nil
 }
 
+// LeaseWatch 推送租约的生命周期事件
+func (ls *LeaseServer) LeaseWatch(rr *pb.LeaseWatchRequest, stream pb.Lease_LeaseWatchServer) error {
+	if err := ls.isPermitted(stream.Context()); err != nil {
+		return togRPCError(err)
+	}
+	err := ls.le.LeaseWatch(stream.Context(), rr, func(resp *pb.LeaseWatchResponse) error {
+		ls.hdr.fill(resp.Header)
+		return stream.Send(resp)
+	})
+	if err != nil {
+		return togRPCError(err)
+	}
+	return nil
+}
+
 // LeaseKeepAlive OK
 func (ls *LeaseServer) LeaseKeepAlive(stream pb.Lease_LeaseKeepAliveServer) (err error) {
 	errc := make(chan error, 1)
@@ -90,6 +130,9 @@ func (ls *LeaseServer) LeaseKeepAlive(stream pb.Lease_LeaseKeepAliveServer) (err
 }
 
 func (ls *LeaseServer) leaseKeepAlive(stream pb.Lease_LeaseKeepAliveServer) error {
+	if err := ls.isPermitted(stream.Context()); err != nil {
+		return togRPCError(err)
+	}
 	for {
 		req, err := stream.Recv()
 		if err == io.EOF {
@@ -106,20 +149,28 @@ func (ls *LeaseServer) leaseKeepAlive(stream pb.Lease_LeaseKeepAliveServer) erro
 
 		// 在发送更新请求之前创建报头.这可以确保修订严格小于或等于本地etcd(当本地etcd是leader时)或远端leader发生keepalive.
 		// 如果没有这个,租约可能在rev 3被撤销,但客户端可以看到在rev 4成功的keepalive.
-		resp := &pb.LeaseKeepAliveResponse{ID: req.ID, Header: &pb.ResponseHeader{}}
+		resp := &pb.LeaseKeepAliveResponse{ID: req.ID, Header: &pb.ResponseHeader{}, ClockSkewMs: ls.cs.ClockSkew().Milliseconds()}
 		ls.hdr.fill(resp.Header)
 
-		ttl, err := ls.le.LeaseRenew(stream.Context(), lease.LeaseID(req.ID))
-		if err == lease.ErrLeaseNotFound {
-			err = nil
-			ttl = 0
-		}
+		if len(req.IDs) > 0 {
+			// 批量续约,一条消息续约所有租约
+			if err = ls.leaseKeepAliveBatch(stream.Context(), req, resp); err != nil {
+				return togRPCError(err)
+			}
+		} else {
+			ttl, err := ls.le.LeaseRenew(stream.Context(), lease.LeaseID(req.ID))
+			if err == lease.ErrLeaseNotFound {
+				err = nil
+				ttl = 0
+			}
 
-		if err != nil {
-			return togRPCError(err)
+			if err != nil {
+				return togRPCError(err)
+			}
+			resp.TTL = ttl
+			resp.NextKeepAliveMs = lease.NextKeepAlive(ttl).Milliseconds()
 		}
 
-		resp.TTL = ttl
 		err = stream.Send(resp)
 		if err != nil {
 			if isClientCtxErr(stream.Context().Err(), err) {
@@ -132,6 +183,22 @@ func (ls *LeaseServer) leaseKeepAlive(stream pb.Lease_LeaseKeepAliveServer) erro
 	}
 }
 
+func (ls *LeaseServer) leaseKeepAliveBatch(ctx context.Context, req *pb.LeaseKeepAliveRequest, resp *pb.LeaseKeepAliveResponse) error {
+	ids := make([]lease.LeaseID, len(req.IDs))
+	for i, id := range req.IDs {
+		ids[i] = lease.LeaseID(id)
+	}
+	ttls, err := ls.le.LeaseRenewBatch(ctx, ids)
+	if err != nil {
+		return err
+	}
+	resp.Results = make([]*pb.LeaseKeepAliveResult, len(ids))
+	for i := range ids {
+		resp.Results[i] = &pb.LeaseKeepAliveResult{ID: req.IDs[i], TTL: ttls[i], NextKeepAliveMs: lease.NextKeepAlive(ttls[i]).Milliseconds()}
+	}
+	return nil
+}
+
 type quotaLeaseServer struct {
 	pb.LeaseServer
 	qa quotaAlarmer
@@ -147,11 +214,15 @@ func (s *quotaLeaseServer) LeaseGrant(ctx context.Context, cr *pb.LeaseGrantRequ
 
 // LeaseGrant 创建租约
 func (ls *LeaseServer) LeaseGrant(ctx context.Context, cr *pb.LeaseGrantRequest) (*pb.LeaseGrantResponse, error) {
+	if err := ls.isPermitted(ctx); err != nil {
+		return nil, togRPCError(err)
+	}
 	resp, err := ls.le.LeaseGrant(ctx, cr)
 	if err != nil {
 		return nil, togRPCError(err)
 	}
 	ls.hdr.fill(resp.Header)
+	resp.ClockSkewMs = ls.cs.ClockSkew().Milliseconds()
 	return resp, nil
 }
 
@@ -164,6 +235,9 @@ func NewQuotaLeaseServer(s *etcdserver.EtcdServer) pb.LeaseServer {
 
 // LeaseRevoke OK
 func (ls *LeaseServer) LeaseRevoke(ctx context.Context, rr *pb.LeaseRevokeRequest) (*pb.LeaseRevokeResponse, error) {
+	if err := ls.isPermitted(ctx); err != nil {
+		return nil, togRPCError(err)
+	}
 	resp, err := ls.le.LeaseRevoke(ctx, rr)
 	if err != nil {
 		return nil, togRPCError(err)
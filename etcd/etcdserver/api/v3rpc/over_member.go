@@ -32,6 +32,7 @@ type ClusterServerInterFace interface {
 	MemberRemove(ctx context.Context, response *pb.MemberRemoveRequest) (*pb.MemberRemoveResponse, error)
 	MemberUpdate(ctx context.Context, response *pb.MemberUpdateRequest) (*pb.MemberUpdateResponse, error)
 	MemberPromote(ctx context.Context, response *pb.MemberPromoteRequest) (*pb.MemberPromoteResponse, error)
+	MemberBatchChange(ctx context.Context, response *pb.MemberBatchChangeRequest) (*pb.MemberBatchChangeResponse, error)
 }
 
 var _ ClusterServerInterFace = &ClusterServer{}
@@ -56,7 +57,7 @@ func (cs *ClusterServer) MemberList(ctx context.Context, r *pb.MemberListRequest
 		}
 	}
 	membs := membersToProtoMembers(cs.cluster.Members())
-	return &pb.MemberListResponse{Header: cs.header(), Members: membs}, nil
+	return &pb.MemberListResponse{Header: cs.header(), Members: membs, LearnerProgress: cs.server.LearnerProgress()}, nil
 }
 
 // MemberAdd ok
@@ -66,6 +67,10 @@ func (cs *ClusterServer) MemberAdd(ctx context.Context, r *pb.MemberAddRequest)
 		return nil, rpctypes.ErrGRPCMemberBadURLs
 	}
 
+	if err := membership.ValidateLabels(r.Labels); err != nil {
+		return nil, togRPCError(err)
+	}
+
 	now := time.Now()
 	var m *membership.Member
 	if r.IsLearner {
@@ -73,6 +78,7 @@ func (cs *ClusterServer) MemberAdd(ctx context.Context, r *pb.MemberAddRequest)
 	} else {
 		m = membership.NewMember("", urls, "", &now)
 	}
+	m.Labels = membership.MergeLabels(nil, r.Labels)
 	membs, merr := cs.server.AddMember(ctx, *m)
 	if merr != nil {
 		return nil, togRPCError(merr)
@@ -84,6 +90,7 @@ func (cs *ClusterServer) MemberAdd(ctx context.Context, r *pb.MemberAddRequest)
 			ID:        uint64(m.ID),
 			PeerURLs:  m.PeerURLs,
 			IsLearner: m.IsLearner,
+			Labels:    m.Labels,
 		},
 		Members: membersToProtoMembers(membs),
 	}, nil
@@ -98,9 +105,23 @@ func (cs *ClusterServer) MemberRemove(ctx context.Context, r *pb.MemberRemoveReq
 }
 
 func (cs *ClusterServer) MemberUpdate(ctx context.Context, r *pb.MemberUpdateRequest) (*pb.MemberUpdateResponse, error) {
+	if err := membership.ValidateLabels(r.Labels); err != nil {
+		return nil, togRPCError(err)
+	}
+	// 只提议标签的增量,apply时再合并到现有标签上,避免并发的更新互相覆盖
 	m := membership.Member{
 		ID:             types.ID(r.ID),
-		RaftAttributes: membership.RaftAttributes{PeerURLs: r.PeerURLs},
+		RaftAttributes: membership.RaftAttributes{PeerURLs: r.PeerURLs, Labels: r.Labels},
+	}
+	// 未指定peerURLs时保留原地址
+	if cur := cs.cluster.Member(m.ID); cur != nil && len(m.PeerURLs) == 0 {
+		m.PeerURLs = cur.PeerURLs
+	}
+	if len(m.PeerURLs) == 0 {
+		return nil, rpctypes.ErrGRPCMemberBadURLs
+	}
+	if _, err := types.NewURLs(m.PeerURLs); err != nil {
+		return nil, rpctypes.ErrGRPCMemberBadURLs
 	}
 	membs, err := cs.server.UpdateMember(ctx, m)
 	if err != nil {
@@ -120,6 +141,54 @@ func (cs *ClusterServer) MemberPromote(ctx context.Context, r *pb.MemberPromoteR
 	}, nil
 }
 
+// MemberBatchChange 通过联合共识一次完成多个成员变更
+func (cs *ClusterServer) MemberBatchChange(ctx context.Context, r *pb.MemberBatchChangeRequest) (*pb.MemberBatchChangeResponse, error) {
+	bc := membership.BatchChangeContext{}
+	now := time.Now()
+	for _, a := range r.Add {
+		urls, err := types.NewURLs(a.PeerURLs)
+		if err != nil {
+			return nil, rpctypes.ErrGRPCMemberBadURLs
+		}
+		if err := membership.ValidateLabels(a.Labels); err != nil {
+			return nil, togRPCError(err)
+		}
+		var m *membership.Member
+		if a.IsLearner {
+			m = membership.NewMemberAsLearner("", urls, "", &now)
+		} else {
+			m = membership.NewMember("", urls, "", &now)
+		}
+		m.Labels = membership.MergeLabels(nil, a.Labels)
+		bc.Add = append(bc.Add, *m)
+	}
+	for _, id := range r.Promote {
+		bc.Promote = append(bc.Promote, types.ID(id))
+	}
+	for _, id := range r.Remove {
+		bc.Remove = append(bc.Remove, types.ID(id))
+	}
+
+	membs, err := cs.server.BatchChangeMembers(ctx, bc)
+	if err != nil {
+		return nil, togRPCError(err)
+	}
+	added := make([]*pb.Member, 0, len(bc.Add))
+	for _, m := range bc.Add {
+		added = append(added, &pb.Member{
+			ID:        uint64(m.ID),
+			PeerURLs:  m.PeerURLs,
+			IsLearner: m.IsLearner,
+			Labels:    m.Labels,
+		})
+	}
+	return &pb.MemberBatchChangeResponse{
+		Header:  cs.header(),
+		Added:   added,
+		Members: membersToProtoMembers(membs),
+	}, nil
+}
+
 func (cs *ClusterServer) header() *pb.ResponseHeader {
 	return &pb.ResponseHeader{
 		ClusterId: uint64(cs.cluster.ID()),
@@ -137,6 +206,7 @@ func membersToProtoMembers(membs []*membership.Member) []*pb.Member {
 			PeerURLs:   membs[i].PeerURLs,
 			ClientURLs: membs[i].ClientURLs,
 			IsLearner:  membs[i].IsLearner,
+			Labels:     membs[i].Labels,
 		}
 	}
 	return protoMembs
@@ -71,3 +71,12 @@ func (s *quotaKVServer) Txn(ctx context.Context, r *pb.TxnRequest) (*pb.TxnRespo
 	}
 	return s.KVServer.Txn(ctx, r)
 }
+
+func (s *quotaKVServer) StagedTxn(ctx context.Context, r *pb.StagedTxnRequest) (*pb.StagedTxnResponse, error) {
+	if r.Action == pb.StagedTxnRequest_APPEND {
+		if err := s.qa.check(ctx, r); err != nil {
+			return nil, err
+		}
+	}
+	return s.KVServer.StagedTxn(ctx, r)
+}
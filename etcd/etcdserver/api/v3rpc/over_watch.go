@@ -16,8 +16,11 @@ package v3rpc
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"math/rand"
+	"path"
+	"regexp"
 	"sync"
 	"time"
 
@@ -29,6 +32,7 @@ import (
 	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
 
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
 )
 
 const minWatchProgressInterval = 100 * time.Millisecond
@@ -41,6 +45,13 @@ type watchServer struct {
 	sg              etcdserver.RaftStatusGetter
 	watchable       mvcc.WatchableKV
 	ag              AuthGetter
+	wl              WatchLimiter
+}
+
+// WatchLimiter 限制每个连接和每个用户的活跃watch数
+type WatchLimiter interface {
+	AcquireWatch(conn, user string) error
+	ReleaseWatch(conn, user string, n int)
 }
 
 var (
@@ -74,19 +85,28 @@ type serverWatchStream struct {
 	sg              etcdserver.RaftStatusGetter
 	watchable       mvcc.WatchableKV
 	ag              AuthGetter
+	wl              WatchLimiter
+	conn            string                 // 客户端连接的标识,用于按连接限制watch数
+	user            string                 // 创建流的用户,未开启鉴权时为空
 	gRPCStream      pb.Watch_WatchServer   // 与客户端进行连接的 Stream
 	watchStream     mvcc.WatchStream       // key 变动的消息管道
 	ctrlStream      chan *pb.WatchResponse // 用来发送控制响应的Chan,比如watcher创建和取消.
+	// pooled 流是真正的gRPC流时为true,Send返回前已经完成编码,发送后可以把响应归还到池中;
+	// 进程内的客户端(v3client)通过channel传递响应指针,接收方还在读取时不能复用
+	pooled bool
 
-	// mu protects progress, prevKV, fragment
+	// mu protects progress, prevKV, fragment, transform
 	mu sync.RWMutex
 	// tracks the watchID that stream might need to send progress to
 	// TODO: combine progress and prevKV into a single struct?
 	progress map[mvcc.WatchID]bool // 该类型的 watch,服务端会定时发送类似心跳消息
 	prevKV   map[mvcc.WatchID]bool // 该类型表明,对于/a/b 这样的监听范围, 如果 b 变化了, 前缀/a也需要通知
 	fragment map[mvcc.WatchID]bool // 该类型表明,传输数据量大于阈值,需要拆分发送
-	closec   chan struct{}
-	wg       sync.WaitGroup // 等待send loop 完成
+	held     map[mvcc.WatchID]bool // 占用了watch数限额的watcher
+	// 在服务端改写事件value的watcher,只返回JSONPath投影或value摘要
+	transform map[mvcc.WatchID]ValueTransform
+	closec    chan struct{}
+	wg        sync.WaitGroup // 等待send loop 完成
 }
 
 // Watch 创建一个watcher stream
@@ -98,15 +118,23 @@ func (ws *watchServer) Watch(stream pb.Watch_WatchServer) (err error) {
 		maxRequestBytes: ws.maxRequestBytes,
 		sg:              ws.sg, // 获取状态
 		watchable:       ws.watchable,
-		ag:              ws.ag,  // 认证服务
+		ag:              ws.ag, // 认证服务
+		wl:              ws.wl,
 		gRPCStream:      stream, //
 		watchStream:     ws.watchable.NewWatchStream(),
 		ctrlStream:      make(chan *pb.WatchResponse, ctrlStreamBufLen), // 用来发送控制响应的Chan,比如watcher创建和取消.
 		progress:        make(map[mvcc.WatchID]bool),
 		prevKV:          make(map[mvcc.WatchID]bool),
 		fragment:        make(map[mvcc.WatchID]bool),
+		held:            make(map[mvcc.WatchID]bool),
+		transform:       make(map[mvcc.WatchID]ValueTransform),
 		closec:          make(chan struct{}),
 	}
+	sws.conn = connID(stream.Context())
+	sws.pooled = grpc.ServerTransportStreamFromContext(stream.Context()) != nil
+	if ai, err := ws.ag.AuthInfoFromCtx(stream.Context()); err == nil && ai != nil {
+		sws.user = ai.Username
+	}
 
 	sws.wg.Add(1)
 	go func() {
@@ -152,6 +180,9 @@ func (sws *serverWatchStream) isWatchPermitted(wcr *pb.WatchCreateRequest) bool
 		// if auth is enabled, IsRangePermitted() can cause an error
 		authInfo = &auth.AuthInfo{}
 	}
+	if sws.ag.AuthStore().IsOpPermitted(authInfo, auth.OpWatch) != nil {
+		return false
+	}
 	return sws.ag.AuthStore().IsRangePermitted(authInfo, []byte(wcr.Key), []byte(wcr.RangeEnd)) == nil
 }
 
@@ -206,14 +237,53 @@ func (sws *serverWatchStream) recvLoop() error {
 				}
 			}
 
-			filters := FiltersFromRequest(creq) // server端  从watch请求中 获取一些过滤调价
+			filters, err := FiltersFromRequest(creq) // server端  从watch请求中 获取一些过滤调价
+			var transform ValueTransform
+			if err == nil {
+				transform, err = ValueTransformFromRequest(creq)
+			}
+			if err != nil {
+				wr := &pb.WatchResponse{
+					Header:       sws.newResponseHeader(sws.watchStream.Rev()),
+					WatchId:      creq.WatchId,
+					Canceled:     true,
+					Created:      true,
+					CancelReason: err.Error(),
+				}
+				select {
+				case sws.ctrlStream <- wr:
+					continue
+				case <-sws.closec:
+					return nil
+				}
+			}
+
+			if err := sws.wl.AcquireWatch(sws.conn, sws.user); err != nil {
+				wr := &pb.WatchResponse{
+					Header:       sws.newResponseHeader(sws.watchStream.Rev()),
+					WatchId:      creq.WatchId,
+					Canceled:     true,
+					Created:      true,
+					CancelReason: rpctypes.ErrorDesc(togRPCError(err)),
+				}
+				select {
+				case sws.ctrlStream <- wr:
+					continue
+				case <-sws.closec:
+					return nil
+				}
+			}
 
 			wsrev := sws.watchStream.Rev() // 获取当前kv的修订版本
 			rev := creq.StartRevision      // 监听从哪个修订版本之后的变更,没穿就是当前
 			if rev == 0 {
 				rev = wsrev + 1
 			}
-			id, err := sws.watchStream.Watch(mvcc.WatchID(creq.WatchId), []byte(creq.Key), []byte(creq.RangeEnd), rev, filters...)
+			watch := sws.watchStream.Watch
+			if wantsUnchangedFiltered(creq) {
+				watch = sws.watchStream.WatchChanged
+			}
+			id, err := watch(mvcc.WatchID(creq.WatchId), []byte(creq.Key), []byte(creq.RangeEnd), rev, filters...)
 			if err == nil {
 				sws.mu.Lock()
 				if creq.ProgressNotify { // 默认FALSE
@@ -225,7 +295,13 @@ func (sws *serverWatchStream) recvLoop() error {
 				if creq.Fragment { // 拆分大的事件
 					sws.fragment[id] = true
 				}
+				if transform != nil {
+					sws.transform[id] = transform
+				}
+				sws.held[id] = true
 				sws.mu.Unlock()
+			} else {
+				sws.wl.ReleaseWatch(sws.conn, sws.user, 1)
 			}
 			wr := &pb.WatchResponse{
 				Header:   sws.newResponseHeader(wsrev), //
@@ -258,7 +334,9 @@ func (sws *serverWatchStream) recvLoop() error {
 					delete(sws.progress, mvcc.WatchID(id))
 					delete(sws.prevKV, mvcc.WatchID(id))
 					delete(sws.fragment, mvcc.WatchID(id))
+					delete(sws.transform, mvcc.WatchID(id))
 					sws.mu.Unlock()
+					sws.releaseWatch(mvcc.WatchID(id))
 				}
 			}
 		}
@@ -275,6 +353,21 @@ func (sws *serverWatchStream) recvLoop() error {
 	}
 }
 
+// newResponse 返回携带events个事件的响应,只有gRPC流才从池中取
+func (sws *serverWatchStream) newResponse(events int) *pb.WatchResponse {
+	if sws.pooled {
+		return watchResponsePool.get(events)
+	}
+	return &pb.WatchResponse{Events: make([]*mvccpb.Event, events)}
+}
+
+// releaseResponse 发送或丢弃响应后调用,只有gRPC流才把它归还到池中
+func (sws *serverWatchStream) releaseResponse(wr *pb.WatchResponse) {
+	if sws.pooled {
+		watchResponsePool.put(wr)
+	}
+}
+
 // 往watch stream 发送消息
 func (sws *serverWatchStream) sendLoop() {
 	// 当前活动的watcher
@@ -287,6 +380,14 @@ func (sws *serverWatchStream) sendLoop() {
 
 	defer func() {
 		progressTicker.Stop()
+		// 丢弃还没有发送的响应
+		for _, wrs := range pending {
+			for _, wr := range wrs {
+				if wr != nil {
+					sws.releaseResponse(wr)
+				}
+			}
+		}
 	}()
 
 	for {
@@ -296,9 +397,11 @@ func (sws *serverWatchStream) sendLoop() {
 				return
 			}
 			evs := wresp.Events
-			events := make([]*mvccpb.Event, len(evs))
+			wr := sws.newResponse(len(evs))
+			events := wr.Events
 			sws.mu.RLock()
 			needPrevKV := sws.prevKV[wresp.WatchID]
+			transform := sws.transform[wresp.WatchID]
 			sws.mu.RUnlock()
 			for i := range evs {
 				events[i] = &evs[i]
@@ -309,16 +412,14 @@ func (sws *serverWatchStream) sendLoop() {
 						events[i].PrevKv = &(r.KVs[0])
 					}
 				}
+				transform.Apply(events[i])
 			}
 
 			canceled := wresp.CompactRevision != 0
-			wr := &pb.WatchResponse{
-				Header:          sws.newResponseHeader(wresp.Revision),
-				WatchId:         int64(wresp.WatchID),
-				Events:          events,
-				CompactRevision: wresp.CompactRevision,
-				Canceled:        canceled,
-			}
+			wr.Header = sws.newResponseHeader(wresp.Revision)
+			wr.WatchId = int64(wresp.WatchID)
+			wr.CompactRevision = wresp.CompactRevision
+			wr.Canceled = canceled
 			_, okID := ids[wresp.WatchID]
 			if !okID { // 当前id 不活跃
 				// 缓冲,如果ID尚未公布
@@ -337,6 +438,7 @@ func (sws *serverWatchStream) sendLoop() {
 			} else {
 				serr = sendFragments(wr, sws.maxRequestBytes, sws.gRPCStream.Send)
 			}
+			sws.releaseResponse(wr)
 
 			if serr != nil {
 				if isClientCtxErr(sws.gRPCStream.Context().Err(), serr) {
@@ -346,6 +448,9 @@ func (sws *serverWatchStream) sendLoop() {
 				}
 				return
 			}
+			if canceled {
+				sws.releaseWatch(wresp.WatchID)
+			}
 
 			sws.mu.Lock()
 			if len(evs) > 0 && sws.progress[wresp.WatchID] {
@@ -377,8 +482,11 @@ func (sws *serverWatchStream) sendLoop() {
 			}
 			if c.Created {
 				ids[wid] = struct{}{}
-				for _, v := range pending[wid] {
-					if err := sws.gRPCStream.Send(v); err != nil {
+				for i, v := range pending[wid] {
+					err := sws.gRPCStream.Send(v)
+					sws.releaseResponse(v)
+					pending[wid][i] = nil
+					if err != nil {
 						if isClientCtxErr(sws.gRPCStream.Context().Err(), err) {
 							sws.lg.Debug("未能向gRPC流发送待处理的watch响应", zap.Error(err))
 						} else {
@@ -452,6 +560,7 @@ func NewWatchServer(s *etcdserver.EtcdServer) pb.WatchServer {
 		sg:              s,
 		watchable:       s.Watchable(),
 		ag:              s,
+		wl:              s,
 	}
 	if srv.lg == nil {
 		srv.lg = zap.NewNop()
@@ -479,18 +588,49 @@ func GetProgressReportInterval() time.Duration {
 	return interval + jitter
 }
 
-func FiltersFromRequest(creq *pb.WatchCreateRequest) []mvcc.FilterFunc {
-	filters := make([]mvcc.FilterFunc, 0, len(creq.Filters))
+// FiltersFromRequest 返回watch请求的事件过滤条件;key_glob、key_regex无效时返回错误.
+// NOUNCHANGED 的过滤依赖事件的PrevKv,etcd本身在mvcc扇出之前处理它(见 mvcc.WatchStream.WatchChanged)
+func FiltersFromRequest(creq *pb.WatchCreateRequest) ([]mvcc.FilterFunc, error) {
+	filters := make([]mvcc.FilterFunc, 0, len(creq.Filters)+2)
 	for _, ft := range creq.Filters {
 		switch ft {
 		case pb.WatchCreateRequest_NOPUT:
 			filters = append(filters, filterNoPut)
 		case pb.WatchCreateRequest_NODELETE:
 			filters = append(filters, filterNoDelete)
+		case pb.WatchCreateRequest_NOUNCHANGED:
+			filters = append(filters, filterUnchanged)
 		default:
 		}
 	}
-	return filters
+	if creq.KeyGlob != "" {
+		glob := creq.KeyGlob
+		if _, err := path.Match(glob, ""); err != nil {
+			return nil, fmt.Errorf("etcdserver: invalid watch key glob %q", glob)
+		}
+		filters = append(filters, func(e mvccpb.Event) bool {
+			ok, _ := path.Match(glob, e.Kv.Key)
+			return !ok
+		})
+	}
+	if creq.KeyRegex != "" {
+		re, err := regexp.Compile(creq.KeyRegex)
+		if err != nil {
+			return nil, fmt.Errorf("etcdserver: invalid watch key regex: %v", err)
+		}
+		filters = append(filters, func(e mvccpb.Event) bool { return !re.MatchString(e.Kv.Key) })
+	}
+	return filters, nil
+}
+
+// wantsUnchangedFiltered 请求是否要过滤掉没有改变value的put事件
+func wantsUnchangedFiltered(creq *pb.WatchCreateRequest) bool {
+	for _, ft := range creq.Filters {
+		if ft == pb.WatchCreateRequest_NOUNCHANGED {
+			return true
+		}
+	}
+	return false
 }
 
 // 当前的修订版本
@@ -511,6 +651,22 @@ func (sws *serverWatchStream) close() {
 	sws.watchStream.Close()
 	close(sws.closec)
 	sws.wg.Wait()
+	sws.mu.Lock()
+	n := len(sws.held)
+	sws.held = make(map[mvcc.WatchID]bool)
+	sws.mu.Unlock()
+	sws.wl.ReleaseWatch(sws.conn, sws.user, n)
+}
+
+// releaseWatch 归还已经取消的watcher占用的限额
+func (sws *serverWatchStream) releaseWatch(id mvcc.WatchID) {
+	sws.mu.Lock()
+	held := sws.held[id]
+	delete(sws.held, id)
+	sws.mu.Unlock()
+	if held {
+		sws.wl.ReleaseWatch(sws.conn, sws.user, 1)
+	}
 }
 
 func filterNoDelete(e mvccpb.Event) bool {
@@ -520,3 +676,7 @@ func filterNoDelete(e mvccpb.Event) bool {
 func filterNoPut(e mvccpb.Event) bool {
 	return e.Type == mvccpb.PUT
 }
+
+func filterUnchanged(e mvccpb.Event) bool {
+	return e.Type == mvccpb.PUT && e.PrevKv != nil && e.PrevKv.Value == e.Kv.Value
+}
@@ -0,0 +1,65 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v3rpc
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/ls-2018/etcd_cn/offical/api/v3/mvccpb"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+)
+
+// 超过这个事件数的响应不放回池中
+const maxPooledWatchEvents = 1024
+
+// watchResponsePool 复用watch流发送的响应和它的事件切片.gRPC的Send在返回前已经完成编码,
+// 所以发送之后(或者流关闭时丢弃未发送的响应时)就可以归还;进程内的流不使用这个池,见 serverWatchStream.pooled.
+var watchResponsePool = &responsePool{}
+
+type responsePool struct {
+	p sync.Pool // *pb.WatchResponse
+	// inUse 取出后还没有归还的响应数,测试中在所有流关闭后检查它是否为0以发现泄漏
+	inUse int64
+}
+
+func (p *responsePool) get(events int) *pb.WatchResponse {
+	atomic.AddInt64(&p.inUse, 1)
+	wr, ok := p.p.Get().(*pb.WatchResponse)
+	if !ok {
+		wr = &pb.WatchResponse{}
+	}
+	if cap(wr.Events) < events {
+		wr.Events = make([]*mvccpb.Event, events)
+	}
+	wr.Events = wr.Events[:events]
+	return wr
+}
+
+func (p *responsePool) put(wr *pb.WatchResponse) {
+	atomic.AddInt64(&p.inUse, -1)
+	evs := wr.Events[:cap(wr.Events)]
+	if len(evs) > maxPooledWatchEvents {
+		return
+	}
+	for i := range evs {
+		evs[i] = nil
+	}
+	*wr = pb.WatchResponse{Events: evs[:0]}
+	p.p.Put(wr)
+}
+
+// outstanding 返回取出后还没有归还的响应数
+func (p *responsePool) outstanding() int64 { return atomic.LoadInt64(&p.inUse) }
@@ -0,0 +1,249 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v3rpc
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/ls-2018/etcd_cn/client_sdk/pkg/types"
+	"github.com/ls-2018/etcd_cn/etcd/auth"
+	"github.com/ls-2018/etcd_cn/etcd/lease"
+	"github.com/ls-2018/etcd_cn/etcd/mvcc"
+	betesting "github.com/ls-2018/etcd_cn/etcd/mvcc/backend/testing"
+	"github.com/ls-2018/etcd_cn/etcd/proxy/grpcproxy/adapter"
+	"github.com/ls-2018/etcd_cn/offical/api/v3/mvccpb"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+type fakeRaftStatus struct{}
+
+func (fakeRaftStatus) ID() types.ID           { return 1 }
+func (fakeRaftStatus) Leader() types.ID       { return 1 }
+func (fakeRaftStatus) CommittedIndex() uint64 { return 0 }
+func (fakeRaftStatus) AppliedIndex() uint64   { return 0 }
+func (fakeRaftStatus) Term() uint64           { return 1 }
+
+type fakeAuthGetter struct{ as auth.AuthStore }
+
+func (g fakeAuthGetter) AuthInfoFromCtx(ctx context.Context) (*auth.AuthInfo, error) { return nil, nil }
+func (g fakeAuthGetter) AuthStore() auth.AuthStore                                   { return g.as }
+
+type fakeWatchLimiter struct{}
+
+func (fakeWatchLimiter) AcquireWatch(conn, user string) error  { return nil }
+func (fakeWatchLimiter) ReleaseWatch(conn, user string, n int) {}
+
+// fakeTransportStream 让流的ctx看起来来自gRPC服务端,watch流据此使用响应池
+type fakeTransportStream struct{}
+
+func (fakeTransportStream) Method() string                  { return "/etcdserverpb.Watch/Watch" }
+func (fakeTransportStream) SetHeader(md metadata.MD) error  { return nil }
+func (fakeTransportStream) SendHeader(md metadata.MD) error { return nil }
+func (fakeTransportStream) SetTrailer(md metadata.MD) error { return nil }
+
+// fakeWatchStream 模拟gRPC的watch流; Send返回后响应会被归还,所以只记录事件数
+type fakeWatchStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	reqc chan *pb.WatchRequest
+	evc  chan int
+	crc  chan int64
+}
+
+func (s *fakeWatchStream) Context() context.Context { return s.ctx }
+
+func (s *fakeWatchStream) Send(wr *pb.WatchResponse) error {
+	if wr.Created {
+		s.crc <- wr.WatchId
+		return nil
+	}
+	select {
+	case s.evc <- len(wr.Events):
+	default:
+	}
+	return nil
+}
+
+func (s *fakeWatchStream) Recv() (*pb.WatchRequest, error) {
+	select {
+	case r := <-s.reqc:
+		return r, nil
+	case <-s.ctx.Done():
+		return nil, s.ctx.Err()
+	}
+}
+
+// newTestWatchServer 创建基于临时后端的watch服务,测试结束时关闭
+func newTestWatchServer(t *testing.T) (*watchServer, mvcc.WatchableKV) {
+	be, _ := betesting.NewDefaultTmpBackend(t)
+	lg := zap.NewNop()
+	kv := mvcc.New(lg, be, &lease.FakeLessor{}, mvcc.StoreConfig{})
+	t.Cleanup(func() {
+		kv.Close()
+		betesting.Close(t, be)
+	})
+	tp, err := auth.NewTokenProvider(lg, "simple", nil, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws := &watchServer{
+		lg:              lg,
+		maxRequestBytes: math.MaxInt32,
+		sg:              fakeRaftStatus{},
+		watchable:       kv,
+		ag:              fakeAuthGetter{as: auth.NewAuthStore(lg, be, tp, 4)},
+		wl:              fakeWatchLimiter{},
+	}
+	return ws, kv
+}
+
+// TestWatchResponsePoolOutstanding 驱动watch流直到关闭,所有从池中取出的响应都应该被归还
+func TestWatchResponsePoolOutstanding(t *testing.T) {
+	ws, kv := newTestWatchServer(t)
+
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithCancel(grpc.NewContextWithServerTransportStream(context.Background(), fakeTransportStream{}))
+		stream := &fakeWatchStream{
+			ctx:  ctx,
+			reqc: make(chan *pb.WatchRequest),
+			evc:  make(chan int, 100),
+			crc:  make(chan int64, 1),
+		}
+		donec := make(chan struct{})
+		go func() {
+			ws.Watch(stream)
+			close(donec)
+		}()
+
+		stream.reqc <- &pb.WatchRequest{WatchRequest_CreateRequest: &pb.WatchRequest_CreateRequest{
+			CreateRequest: &pb.WatchCreateRequest{Key: "foo"},
+		}}
+		select {
+		case <-stream.crc:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for watch creation")
+		}
+
+		for j := 0; j < 10; j++ {
+			kv.Put([]byte("foo"), []byte("bar"), lease.NoLease)
+		}
+		// 前两轮收完所有事件后关闭,最后一轮在事件还没有发送完时关闭
+		if i < 2 {
+			for n := 0; n < 10; {
+				select {
+				case c := <-stream.evc:
+					n += c
+				case <-time.After(5 * time.Second):
+					t.Fatalf("timed out waiting for events, got %d", n)
+				}
+			}
+		}
+		cancel()
+		<-donec
+	}
+
+	if n := watchResponsePool.outstanding(); n != 0 {
+		t.Fatalf("outstanding watch responses = %d, want 0", n)
+	}
+}
+
+// TestWatchInProcessStream 进程内的客户端(v3client)通过channel拿到响应指针,
+// 服务端不能在发送后复用响应,否则接收方读到的是被清空或者被覆盖的响应
+func TestWatchInProcessStream(t *testing.T) {
+	ws, kv := newTestWatchServer(t)
+	// 响应被清空时收不到足够的事件,超时后Recv返回错误
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	wc, err := adapter.WatchServerToWatchClient(ws).Watch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = wc.Send(&pb.WatchRequest{WatchRequest_CreateRequest: &pb.WatchRequest_CreateRequest{
+		CreateRequest: &pb.WatchCreateRequest{Key: "foo"},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	if resp, err := wc.Recv(); err != nil || !resp.Created {
+		t.Fatalf("created response = %v, %v", resp, err)
+	}
+
+	const n = 50
+	for i := 0; i < n; i++ {
+		kv.Put([]byte("foo"), []byte(fmt.Sprintf("bar%d", i)), lease.NoLease)
+	}
+	var got []*pb.WatchResponse
+	for cnt := 0; cnt < n; {
+		resp, err := wc.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, resp)
+		cnt += len(resp.Events)
+	}
+	// 全部收完之后再检查,之前收到的响应不应该被服务端改动
+	i := 0
+	for _, resp := range got {
+		if resp.Header == nil {
+			t.Fatalf("response %+v has no header", resp)
+		}
+		for _, ev := range resp.Events {
+			if want := fmt.Sprintf("bar%d", i); ev.Kv.Key != "foo" || ev.Kv.Value != want {
+				t.Fatalf("event %d = %s=%s, want foo=%s", i, ev.Kv.Key, ev.Kv.Value, want)
+			}
+			i++
+		}
+	}
+	if i != n {
+		t.Fatalf("got %d events, want %d", i, n)
+	}
+}
+
+// TestCodecReleasesRangeResponse Range响应编码之后 Kvs 切片应该被归还
+func TestCodecReleasesRangeResponse(t *testing.T) {
+	kvs := make([]*mvccpb.KeyValue, 2, 8)
+	kvs[0] = &mvccpb.KeyValue{Key: "a", Value: "1"}
+	kvs[1] = &mvccpb.KeyValue{Key: "b", Value: "2"}
+	resp := &pb.RangeResponse{Header: &pb.ResponseHeader{}, Kvs: kvs, Count: 2}
+
+	b, err := (&codec{}).Marshal(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Kvs != nil {
+		t.Fatalf("resp.Kvs = %v after marshal, want nil", resp.Kvs)
+	}
+	// 归还前会清空切片中的指针
+	for i, kv := range kvs[:cap(kvs)] {
+		if kv != nil {
+			t.Fatalf("kvs[%d] = %v after marshal, want nil", i, kv)
+		}
+	}
+
+	var got pb.RangeResponse
+	if err = (&codec{}).Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Kvs) != 2 || got.Kvs[0].Key != "a" || got.Kvs[1].Value != "2" {
+		t.Fatalf("decoded kvs = %v, want a=1 b=2", got.Kvs)
+	}
+}
@@ -37,6 +37,8 @@ var toGRPCErrorMap = map[error]error{
 	membership.ErrPeerURLexists:           rpctypes.ErrGRPCPeerURLExist,
 	membership.ErrMemberNotLearner:        rpctypes.ErrGRPCMemberNotLearner,
 	membership.ErrTooManyLearners:         rpctypes.ErrGRPCTooManyLearners,
+	membership.ErrBadLabels:               rpctypes.ErrGRPCMemberBadLabels,
+	membership.ErrBadBatchChange:          rpctypes.ErrGRPCMemberBadBatchChange,
 	etcdserver.ErrNotEnoughStartedMembers: rpctypes.ErrMemberNotEnoughStarted,
 	etcdserver.ErrLearnerNotReady:         rpctypes.ErrGRPCLearnerNotReady,
 
@@ -63,10 +65,35 @@ var toGRPCErrorMap = map[error]error{
 	etcdserver.ErrInvalidDowngradeTargetVersion: rpctypes.ErrGRPCInvalidDowngradeTargetVersion,
 	etcdserver.ErrDowngradeInProcess:            rpctypes.ErrGRPCDowngradeInProcess,
 	etcdserver.ErrNoInflightDowngrade:           rpctypes.ErrGRPCNoInflightDowngrade,
-
-	lease.ErrLeaseNotFound:    rpctypes.ErrGRPCLeaseNotFound,
-	lease.ErrLeaseExists:      rpctypes.ErrGRPCLeaseExist,
-	lease.ErrLeaseTTLTooLarge: rpctypes.ErrGRPCLeaseTTLTooLarge,
+	etcdserver.ErrInvalidUpgradeTargetVersion:   rpctypes.ErrGRPCInvalidUpgradeTargetVersion,
+	etcdserver.ErrMembersNotUpgraded:            rpctypes.ErrGRPCMembersNotUpgraded,
+	etcdserver.ErrDowngradeFeatureBlocked:       rpctypes.ErrGRPCDowngradeFeatureBlocked,
+	etcdserver.ErrMemberReadOnly:                rpctypes.ErrGRPCMemberReadOnly,
+	etcdserver.ErrReadOnlySoleVoter:             rpctypes.ErrGRPCReadOnlySoleVoter,
+	etcdserver.ErrReplicaReadOnly:               rpctypes.ErrGRPCReplicaReadOnly,
+	etcdserver.ErrNotReplica:                    rpctypes.ErrGRPCNotReplica,
+	etcdserver.ErrUnknownLogScope:               rpctypes.ErrGRPCUnknownLogScope,
+	etcdserver.ErrInvalidLogLevel:               rpctypes.ErrGRPCInvalidLogLevel,
+	etcdserver.ErrFailpointsDisabled:            rpctypes.ErrGRPCFailpointsDisabled,
+	etcdserver.ErrInvalidFailpoint:              rpctypes.ErrGRPCInvalidFailpoint,
+	etcdserver.ErrCompactionHoldTTL:             rpctypes.ErrGRPCCompactionHoldTTL,
+	etcdserver.ErrCompactionHoldTooOld:          rpctypes.ErrGRPCCompactionHoldTooOld,
+	etcdserver.ErrCompactionHoldTooMany:         rpctypes.ErrGRPCCompactionHoldTooMany,
+	etcdserver.ErrSnapshotSessionNotFound:       rpctypes.ErrGRPCSnapshotSessionNotFound,
+	etcdserver.ErrSnapshotSessionRevision:       rpctypes.ErrGRPCSnapshotSessionRevision,
+	etcdserver.ErrStagedTxnNotFound:             rpctypes.ErrGRPCStagedTxnNotFound,
+	etcdserver.ErrStagedTxnTooLarge:             rpctypes.ErrGRPCStagedTxnTooLarge,
+	etcdserver.ErrStagedTxnTooMany:              rpctypes.ErrGRPCStagedTxnTooMany,
+	etcdserver.ErrUserQuotaExceeded:             rpctypes.ErrGRPCUserQuotaExceeded,
+	etcdserver.ErrUserRateLimited:               rpctypes.ErrGRPCUserRateLimited,
+	etcdserver.ErrWatchLimitExceeded:            rpctypes.ErrGRPCWatchLimitExceeded,
+	etcdserver.ErrLeaseWatcherSlow:              rpctypes.ErrGRPCLeaseWatcherSlow,
+
+	lease.ErrLeaseNotFound:         rpctypes.ErrGRPCLeaseNotFound,
+	lease.ErrLeaseExists:           rpctypes.ErrGRPCLeaseExist,
+	lease.ErrLeaseTTLTooLarge:      rpctypes.ErrGRPCLeaseTTLTooLarge,
+	lease.ErrParentLeaseNotFound:   rpctypes.ErrGRPCParentLeaseNotFound,
+	lease.ErrLeaseMetadataTooLarge: rpctypes.ErrGRPCLeaseMetadataTooLarge,
 
 	auth.ErrRootUserNotExist:     rpctypes.ErrGRPCRootUserNotExist,
 	auth.ErrRootRoleNotExist:     rpctypes.ErrGRPCRootRoleNotExist,
@@ -84,7 +111,12 @@ var toGRPCErrorMap = map[error]error{
 	auth.ErrAuthNotEnabled:       rpctypes.ErrGRPCAuthNotEnabled,
 	auth.ErrInvalidAuthToken:     rpctypes.ErrGRPCInvalidAuthToken,
 	auth.ErrInvalidAuthMgmt:      rpctypes.ErrGRPCInvalidAuthMgmt,
+	auth.ErrInvalidAuthOperation: rpctypes.ErrGRPCInvalidAuthOperation,
 	auth.ErrAuthOldRevision:      rpctypes.ErrGRPCAuthOldRevision,
+	auth.ErrPasswordTooWeak:      rpctypes.ErrGRPCPasswordTooWeak,
+	auth.ErrPasswordExpired:      rpctypes.ErrGRPCPasswordExpired,
+	auth.ErrAccountLocked:        rpctypes.ErrGRPCAccountLocked,
+	auth.ErrInvalidRefreshToken:  rpctypes.ErrGRPCInvalidRefreshToken,
 
 	// In sync with status.FromContextError
 	context.Canceled:         rpctypes.ErrGRPCCanceled,
@@ -96,6 +128,13 @@ func togRPCError(err error) error {
 	if err == context.Canceled || err == context.DeadlineExceeded {
 		return err
 	}
+	// 和 ErrTimeout 一样使用 Unavailable:请求结果未知,不能让客户端当作单次调用超时而重试写请求
+	if be, ok := err.(*etcdserver.RequestBudgetError); ok {
+		return status.Error(codes.Unavailable, be.Error())
+	}
+	if ae, ok := err.(*etcdserver.AdmissionError); ok {
+		return status.Error(codes.InvalidArgument, ae.Error())
+	}
 	grpcErr, ok := toGRPCErrorMap[err]
 	if !ok {
 		return status.Error(codes.Unknown, err.Error())
@@ -0,0 +1,102 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v3rpc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ls-2018/etcd_cn/offical/api/v3/mvccpb"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+	"github.com/ls-2018/etcd_cn/pkg/jsonpath"
+)
+
+// ValueTransform 在服务端改写watch事件的value,返回新的KeyValue,不修改传入的kv(它可能被多个watcher共享)
+type ValueTransform func(kv *mvccpb.KeyValue) *mvccpb.KeyValue
+
+// ValueTransformFromRequest 根据watch创建请求中的projections/value_hash返回value的改写函数,都没有设置时返回nil
+func ValueTransformFromRequest(creq *pb.WatchCreateRequest) (ValueTransform, error) {
+	if len(creq.Projections) == 0 && !creq.ValueHash {
+		return nil, nil
+	}
+	if len(creq.Projections) != 0 && creq.ValueHash {
+		return nil, errors.New("etcdserver: watch projections and value hash are mutually exclusive")
+	}
+	if creq.ValueHash {
+		return transformValue(hashValue), nil
+	}
+	paths := make([]*jsonpath.Path, 0, len(creq.Projections))
+	for _, expr := range creq.Projections {
+		p, err := jsonpath.Parse(expr)
+		if err != nil {
+			return nil, fmt.Errorf("etcdserver: invalid watch projection: %v", err)
+		}
+		paths = append(paths, p)
+	}
+	return transformValue(func(v string) string { return projectValue(paths, v) }), nil
+}
+
+// Apply 改写事件及其PrevKv的value;删除事件的value为空,保持不变
+func (t ValueTransform) Apply(ev *mvccpb.Event) {
+	if t == nil {
+		return
+	}
+	if ev.Kv != nil && ev.Type == mvccpb.PUT {
+		ev.Kv = t(ev.Kv)
+	}
+	if ev.PrevKv != nil {
+		ev.PrevKv = t(ev.PrevKv)
+	}
+}
+
+func transformValue(f func(string) string) ValueTransform {
+	return func(kv *mvccpb.KeyValue) *mvccpb.KeyValue {
+		nkv := *kv
+		nkv.Value = f(kv.Value)
+		return &nkv
+	}
+}
+
+func hashValue(v string) string {
+	sum := sha256.Sum256([]byte(v))
+	return hex.EncodeToString(sum[:])
+}
+
+// projectValue 返回表达式到所选元素的JSON对象;元素不存在或value不是JSON时为null
+func projectValue(paths []*jsonpath.Path, v string) string {
+	var doc interface{}
+	dec := json.NewDecoder(strings.NewReader(v))
+	dec.UseNumber()
+	valid := dec.Decode(&doc) == nil
+	out := make(map[string]interface{}, len(paths))
+	for _, p := range paths {
+		out[p.String()] = nil
+		if !valid {
+			continue
+		}
+		if e, ok := p.Lookup(doc); ok {
+			out[p.String()] = e
+		}
+	}
+	b, err := json.Marshal(out)
+	if err != nil {
+		return "{}"
+	}
+	return string(b)
+}
@@ -47,6 +47,7 @@ func (aa *authApplierV3) Apply(r *pb.InternalRaftRequest, shouldApplyV3 membersh
 		// 当internalRaftRequest没有header时,向后兼容3.0之前的版本
 		aa.authInfo.Username = r.Header.Username
 		aa.authInfo.Revision = r.Header.AuthRevision
+		aa.authInfo.Time = r.Header.Time
 	}
 	if needAdminPermission(r) {
 		if err := aa.as.IsAdminPermitted(&aa.authInfo); err != nil {
@@ -56,8 +57,7 @@ func (aa *authApplierV3) Apply(r *pb.InternalRaftRequest, shouldApplyV3 membersh
 		}
 	}
 	ret := aa.applierV3.Apply(r, shouldApplyV3)
-	aa.authInfo.Username = ""
-	aa.authInfo.Revision = 0
+	aa.authInfo = auth.AuthInfo{}
 	return ret
 }
 
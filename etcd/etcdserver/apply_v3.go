@@ -15,10 +15,11 @@
 package etcdserver
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"sort"
+	"strings"
+	"time"
 
 	"github.com/coreos/go-semver/semver"
 	"github.com/ls-2018/etcd_cn/client_sdk/pkg/types"
@@ -41,6 +42,8 @@ type applyResult struct {
 	err   error
 	physc <-chan struct{} // disk、内存都写好数据了
 	trace *traceutil.Trace
+	// applyStart 开始apply的时间,用于计算从提交给raft到开始apply的耗时
+	applyStart time.Time
 }
 
 // applierV3Internal 内部v3 raft 请求
@@ -62,6 +65,7 @@ type applierV3 interface {
 	LeaseCheckpoint(lc *pb.LeaseCheckpointRequest) (*pb.LeaseCheckpointResponse, error)
 	Alarm(*pb.AlarmRequest) (*pb.AlarmResponse, error)
 	Authenticate(r *pb.InternalAuthenticateRequest) (*pb.AuthenticateResponse, error)
+	LoginFailure(r *pb.InternalAuthLoginFailureRequest) (*pb.EmptyResponse, error)
 	AuthEnable() (*pb.AuthEnableResponse, error)
 	AuthDisable() (*pb.AuthDisableResponse, error)
 	AuthStatus() (*pb.AuthStatusResponse, error)
@@ -84,12 +88,13 @@ type checkReqFunc func(mvcc.ReadView, *pb.RequestOp) error
 
 type applierV3backend struct {
 	s          *EtcdServer
+	lg         *zap.Logger
 	checkPut   checkReqFunc
 	checkRange checkReqFunc
 }
 
 func (s *EtcdServer) newApplierV3Backend() applierV3 {
-	base := &applierV3backend{s: s}
+	base := &applierV3backend{s: s, lg: s.logScopes.logger(s.Logger(), LogScopeApply)}
 	base.checkPut = func(rv mvcc.ReadView, req *pb.RequestOp) error {
 		return base.checkRequestPut(rv, req)
 	}
@@ -100,7 +105,7 @@ func (s *EtcdServer) newApplierV3Backend() applierV3 {
 }
 
 func (s *EtcdServer) newApplierV3Internal() applierV3Internal {
-	base := &applierV3backend{s: s}
+	base := &applierV3backend{s: s, lg: s.logScopes.logger(s.Logger(), LogScopeApply)}
 	return base
 }
 
@@ -116,7 +121,7 @@ func (a *applierV3backend) Put(ctx context.Context, txn mvcc.TxnWrite, p *pb.Put
 	// 如果上下文中的trace为空,则创建put跟踪
 	if trace.IsEmpty {
 		trace = traceutil.New("put",
-			a.s.Logger(),
+			a.lg,
 			traceutil.Field{Key: "key", Value: string([]byte(p.Key))},
 			traceutil.Field{Key: "req_size", Value: p.Size()},
 		)
@@ -195,7 +200,7 @@ func (a *applierV3backend) DeleteRange(txn mvcc.TxnWrite, dr *pb.DeleteRangeRequ
 func (a *applierV3backend) Txn(ctx context.Context, rt *pb.TxnRequest) (*pb.TxnResponse, *traceutil.Trace, error) {
 	trace := traceutil.Get(ctx)
 	if trace.IsEmpty {
-		trace = traceutil.New("transaction", a.s.Logger())
+		trace = traceutil.New("transaction", a.lg)
 		ctx = context.WithValue(ctx, traceutil.TraceKey, trace)
 	}
 	isWrite := !isTxnReadonly(rt)
@@ -321,7 +326,8 @@ func applyCompare(rv mvcc.ReadView, c *pb.Compare) bool {
 	// * rewrite rules for common patterns:
 	//	ex. "[a, b) createrev > 0" => "limit 1 /\ kvs > 0"
 	// * caching
-	rr, err := rv.Range(context.TODO(), []byte(c.Key), mkGteRange([]byte(c.RangeEnd)), mvcc.RangeOptions{})
+	// 只有比较值时需要解码值
+	rr, err := rv.Range(context.TODO(), []byte(c.Key), mkGteRange([]byte(c.RangeEnd)), mvcc.RangeOptions{KeysOnly: c.Target != pb.Compare_VALUE})
 	if err != nil {
 		return false
 	}
@@ -346,13 +352,12 @@ func compareKV(c *pb.Compare, ckv mvccpb.KeyValue) bool {
 	rev := int64(0)
 	switch c.Target {
 	case pb.Compare_VALUE:
-		v := []byte{}
-
+		v := ""
 		if c.Compare_Value != nil {
-			v = []byte(c.Compare_Value.Value)
+			v = c.Compare_Value.Value
 		}
-
-		result = bytes.Compare([]byte(ckv.Value), v)
+		// 直接比较字符串,避免把值复制成[]byte
+		result = strings.Compare(ckv.Value, v)
 	case pb.Compare_CREATE:
 		if c.Compare_CreateRevision != nil {
 			rev = c.Compare_CreateRevision.CreateRevision
@@ -394,7 +399,7 @@ func (a *applierV3backend) applyTxn(ctx context.Context, txn mvcc.TxnWrite, rt *
 		reqs = rt.Failure
 	}
 
-	lg := a.s.Logger()
+	lg := a.lg
 	for i, req := range reqs {
 
 		if req.RequestOp_RequestRange != nil {
@@ -453,7 +458,7 @@ func (a *applierV3backend) Compaction(compaction *pb.CompactionRequest) (*pb.Com
 	resp := &pb.CompactionResponse{}
 	resp.Header = &pb.ResponseHeader{}
 	trace := traceutil.New("compact",
-		a.s.Logger(),
+		a.lg,
 		traceutil.Field{Key: "revision", Value: compaction.Revision},
 	)
 
@@ -461,6 +466,10 @@ func (a *applierV3backend) Compaction(compaction *pb.CompactionRequest) (*pb.Com
 	if err != nil {
 		return nil, ch, nil, err
 	}
+	go func(rev int64) {
+		<-ch
+		a.s.notifyEvent(Event{Type: EventCompactionFinished, Revision: rev})
+	}(compaction.Revision)
 	// 获得当前版本.拿哪把key并不重要.
 	rr, _ := a.s.KV().Range(context.TODO(), []byte("compaction"), nil, mvcc.RangeOptions{})
 	resp.Header.Revision = rr.Rev
@@ -488,6 +497,9 @@ func (a *applierV3backend) DowngradeInfoSet(r *membershippb.DowngradeInfoSetRequ
 		d = membership.DowngradeInfo{Enabled: true, TargetVersion: r.Ver}
 	}
 	a.s.cluster.SetDowngradeInfo(&d, shouldApplyV3)
+	if shouldApplyV3 {
+		a.s.applyDowngradeTranslation(&d)
+	}
 }
 
 func (a *quotaApplierV3) Txn(ctx context.Context, rt *pb.TxnRequest) (*pb.TxnResponse, *traceutil.Trace, error) {
@@ -654,6 +666,8 @@ func (a *applierV3backend) Range(ctx context.Context, txn mvcc.TxnRead, r *pb.Ra
 		Limit: limit,       // 0
 		Rev:   r.Revision,  // 0
 		Count: r.CountOnly, // false
+		// 按值排序时仍然需要值
+		KeysOnly: r.KeysOnly && r.SortTarget != pb.RangeRequest_VALUE,
 	}
 	// 主要逻辑
 	rr, err := txn.Range(ctx, []byte(r.Key), mkGteRange([]byte(r.RangeEnd)), ro)
@@ -713,7 +727,7 @@ func (a *applierV3backend) Range(ctx context.Context, txn mvcc.TxnRead, r *pb.Ra
 	trace.Step("筛选键值对并对其排序")
 	resp.Header.Revision = rr.Rev
 	resp.Count = int64(rr.Count)
-	resp.Kvs = make([]*mvccpb.KeyValue, len(rr.KVs))
+	resp.Kvs = getRangeKvs(len(rr.KVs))
 	for i := range rr.KVs {
 		if r.KeysOnly {
 			rr.KVs[i].Value = ""
@@ -744,7 +758,7 @@ func (s *kvSort) Len() int { return len(s.kvs) }
 type kvSortByKey struct{ *kvSort }
 
 func (s *kvSortByKey) Less(i, j int) bool {
-	return bytes.Compare([]byte(s.kvs[i].Key), []byte(s.kvs[j].Key)) < 0
+	return s.kvs[i].Key < s.kvs[j].Key
 }
 
 type kvSortByVersion struct{ *kvSort }
@@ -768,14 +782,14 @@ func (s *kvSortByMod) Less(i, j int) bool {
 type kvSortByValue struct{ *kvSort }
 
 func (s *kvSortByValue) Less(i, j int) bool {
-	return bytes.Compare([]byte(s.kvs[i].Value), []byte(s.kvs[j].Value)) < 0
+	return s.kvs[i].Value < s.kvs[j].Value
 }
 
 func (a *applierV3backend) Alarm(ar *pb.AlarmRequest) (*pb.AlarmResponse, error) {
 	resp := &pb.AlarmResponse{}
 	oldCount := len(a.s.alarmStore.Get(ar.Alarm)) // 获取指定类型的警报数量
 
-	lg := a.s.Logger()
+	lg := a.lg
 	switch ar.Action {
 	case pb.AlarmRequest_GET:
 		resp.Alarms = a.s.alarmStore.Get(ar.Alarm)
@@ -796,8 +810,11 @@ func (a *applierV3backend) Alarm(ar *pb.AlarmRequest) (*pb.AlarmResponse, error)
 		switch m.Alarm {
 		case pb.AlarmType_CORRUPT:
 			a.s.applyV3 = newApplierV3Corrupt(a)
+			a.s.notifyEvent(Event{Type: EventCorruptionAlarm, MemberID: types.ID(m.MemberID)})
 		case pb.AlarmType_NOSPACE:
 			a.s.applyV3 = newApplierV3Capped(a)
+		case pb.AlarmType_UNREACHABLE, pb.AlarmType_TOPOLOGY, pb.AlarmType_BACKUP, pb.AlarmType_CLOCK_SKEW:
+			// 成员不可达、拓扑风险、备份失败、时钟偏差只是通知,不影响请求的应用
 		default:
 			lg.Panic("未实现的警报", zap.String("alarm", fmt.Sprintf("%+v", m)))
 		}
@@ -816,6 +833,8 @@ func (a *applierV3backend) Alarm(ar *pb.AlarmRequest) (*pb.AlarmResponse, error)
 		case pb.AlarmType_NOSPACE, pb.AlarmType_CORRUPT:
 			lg.Warn("警报解除", zap.String("alarm", m.Alarm.String()), zap.String("from", types.ID(m.MemberID).String()))
 			a.s.applyV3 = a.s.newApplierV3()
+		case pb.AlarmType_UNREACHABLE, pb.AlarmType_TOPOLOGY, pb.AlarmType_BACKUP, pb.AlarmType_CLOCK_SKEW:
+			lg.Info("警报解除", zap.String("alarm", m.Alarm.String()), zap.String("from", types.ID(m.MemberID).String()))
 		default:
 			lg.Warn("未实现的警报解除类型", zap.String("alarm", fmt.Sprintf("%+v", m)))
 		}
@@ -958,6 +977,21 @@ func (a *applierV3backend) AuthStatus() (*pb.AuthStatusResponse, error) {
 
 func (a *applierV3backend) Authenticate(r *pb.InternalAuthenticateRequest) (*pb.AuthenticateResponse, error) {
 	ctx := context.WithValue(context.WithValue(a.s.ctx, auth.AuthenticateParamIndex{}, a.s.consistIndex.ConsistentIndex()), auth.AuthenticateParamSimpleTokenPrefix{}, r.SimpleToken)
+	if r.External {
+		ctx = context.WithValue(ctx, auth.AuthenticateParamExternalUser{}, &auth.ExternalUserParam{
+			Roles:     r.Roles,
+			ExpiresAt: r.ExternalExpires,
+			IssuedAt:  r.ExternalIssuedAt,
+		})
+	}
+	if r.RefreshTokenHash != "" || r.PrevRefreshTokenHash != "" {
+		ctx = context.WithValue(ctx, auth.AuthenticateParamRefreshToken{}, &auth.RefreshTokenParam{
+			Hash:      r.RefreshTokenHash,
+			ExpiresAt: r.RefreshTokenExpires,
+			PrevHash:  r.PrevRefreshTokenHash,
+			IssuedAt:  r.IssuedAt,
+		})
+	}
 	resp, err := a.s.AuthStore().Authenticate(ctx, r.Name, r.Password)
 	if resp != nil {
 		resp.Header = newHeader(a.s)
@@ -965,9 +999,17 @@ func (a *applierV3backend) Authenticate(r *pb.InternalAuthenticateRequest) (*pb.
 	return resp, err
 }
 
+// LoginFailure 记录登录失败次数
+func (a *applierV3backend) LoginFailure(r *pb.InternalAuthLoginFailureRequest) (*pb.EmptyResponse, error) {
+	if err := a.s.AuthStore().LoginFailure(r); err != nil {
+		return nil, err
+	}
+	return &pb.EmptyResponse{}, nil
+}
+
 // LeaseGrant 创建租约
 func (a *applierV3backend) LeaseGrant(lc *pb.LeaseGrantRequest) (*pb.LeaseGrantResponse, error) {
-	l, err := a.s.lessor.Grant(lease.LeaseID(lc.ID), lc.TTL)
+	l, err := a.s.lessor.Grant(lease.LeaseID(lc.ID), lc.TTL, lease.LeaseID(lc.Parent), lc.Metadata)
 	resp := &pb.LeaseGrantResponse{}
 	if err == nil {
 		resp.ID = int64(l.ID)
@@ -980,7 +1022,12 @@ func (a *applierV3backend) LeaseGrant(lc *pb.LeaseGrantRequest) (*pb.LeaseGrantR
 // LeaseRevoke ok
 func (a *applierV3backend) LeaseRevoke(lc *pb.LeaseRevokeRequest) (*pb.LeaseRevokeResponse, error) {
 	fmt.Println("LeaseRevoke", lc)
-	err := a.s.lessor.Revoke(lease.LeaseID(lc.ID))
+	var err error
+	if lc.Expired {
+		err = a.s.lessor.RevokeExpired(lease.LeaseID(lc.ID))
+	} else {
+		err = a.s.lessor.Revoke(lease.LeaseID(lc.ID))
+	}
 	return &pb.LeaseRevokeResponse{Header: newHeader(a.s)}, err
 }
 
@@ -988,7 +1035,7 @@ func (a *applierV3backend) LeaseRevoke(lc *pb.LeaseRevokeRequest) (*pb.LeaseRevo
 func (a *applierV3backend) LeaseCheckpoint(lc *pb.LeaseCheckpointRequest) (*pb.LeaseCheckpointResponse, error) {
 	fmt.Println("接收到checkpoint消息", lc.Checkpoints)
 	for _, c := range lc.Checkpoints {
-		err := a.s.lessor.Checkpoint(lease.LeaseID(c.ID), c.RemainingTtl)
+		err := a.s.lessor.Checkpoint(lease.LeaseID(c.ID), c.RemainingTtl, c.CheckpointTime)
 		if err != nil {
 			return &pb.LeaseCheckpointResponse{Header: newHeader(a.s)}, err
 		}
@@ -0,0 +1,261 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdserver
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ls-2018/etcd_cn/client_sdk/pkg/fileutil"
+	"github.com/ls-2018/etcd_cn/etcd/verify"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+const (
+	backupFilePrefix = "backup-"
+	backupFileSuffix = ".db"
+	// 上传备份到对象存储的超时时间
+	backupUploadTimeout = 5 * time.Minute
+)
+
+var (
+	backupLastSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "etcd",
+		Subsystem: "server",
+		Name:      "backup_last_success_timestamp_seconds",
+		Help:      "The unix timestamp of the last successful scheduled backup.",
+	})
+	backupLastDuration = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "etcd",
+		Subsystem: "server",
+		Name:      "backup_last_duration_seconds",
+		Help:      "The duration of the last successful scheduled backup.",
+	})
+	backupLastSize = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "etcd",
+		Subsystem: "server",
+		Name:      "backup_last_size_bytes",
+		Help:      "The size of the last successful scheduled backup.",
+	})
+	backupFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "etcd",
+		Subsystem: "server",
+		Name:      "backup_failures_total",
+		Help:      "The total number of failed scheduled backups.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(backupLastSuccess)
+	prometheus.MustRegister(backupLastDuration)
+	prometheus.MustRegister(backupLastSize)
+	prometheus.MustRegister(backupFailures)
+}
+
+// monitorBackup 按 BackupInterval 定期从本地后端做快照备份;未指定 BackupMember 时由leader负责,
+// 否则由名称为 BackupMember 的成员负责.
+func (s *EtcdServer) monitorBackup() {
+	if s.Cfg.BackupInterval <= 0 {
+		return
+	}
+	select {
+	case <-s.ReadyNotify():
+	case <-s.stopping:
+		return
+	}
+
+	for {
+		select {
+		case <-time.After(s.Cfg.BackupInterval):
+		case <-s.stopping:
+			return
+		}
+		if s.isBackupMember() {
+			s.backup()
+		}
+	}
+}
+
+func (s *EtcdServer) isBackupMember() bool {
+	if s.Cfg.BackupMember == "" {
+		return s.isLeader()
+	}
+	return s.Cfg.BackupMember == s.Cfg.Name
+}
+
+// backup 做一次备份,失败时发出本成员的 BACKUP 警报,成功后解除
+func (s *EtcdServer) backup() {
+	lg := s.Logger()
+	start := time.Now()
+	path, size, err := s.saveBackup()
+	if err == nil && s.Cfg.BackupTargetURL != "" {
+		err = s.uploadBackup(path)
+	}
+	if err != nil {
+		backupFailures.Inc()
+		lg.Warn("备份失败", zap.String("backup-dir", s.Cfg.BackupDirPath()), zap.Error(err))
+		if !s.hasBackupAlarm() {
+			s.setBackupAlarm(pb.AlarmRequest_ACTIVATE)
+		}
+		return
+	}
+	took := time.Since(start)
+	backupLastSuccess.Set(float64(time.Now().Unix()))
+	backupLastDuration.Set(took.Seconds())
+	backupLastSize.Set(float64(size))
+	lg.Info("备份完成", zap.String("path", path), zap.Int64("size", size), zap.Duration("took", took))
+
+	s.pruneBackups()
+	if s.hasBackupAlarm() {
+		s.setBackupAlarm(pb.AlarmRequest_DEACTIVATE)
+	}
+}
+
+// saveBackup 将后端快照写入临时文件,校验通过后再重命名为最终的备份文件
+func (s *EtcdServer) saveBackup() (path string, size int64, err error) {
+	dir := s.Cfg.BackupDirPath()
+	if err = fileutil.TouchDirAll(dir); err != nil {
+		return "", 0, err
+	}
+	// 快照至少包含到此索引为止已应用的数据
+	index := s.consistIndex.ConsistentIndex()
+	name := fmt.Sprintf("%s%s-%s-%d%s", backupFilePrefix, time.Now().UTC().Format("20060102T150405.000Z"), s.ID(), index, backupFileSuffix)
+	path = filepath.Join(dir, name)
+	part := path + ".part"
+
+	f, err := os.OpenFile(part, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fileutil.PrivateFileMode)
+	if err != nil {
+		return "", 0, err
+	}
+	snapshot := s.Backend().Snapshot()
+	size, err = snapshot.WriteTo(f)
+	snapshot.Close()
+	if err == nil {
+		err = fileutil.Fsync(f)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = verify.VerifyBackend(verify.BackendConfig{Path: part, MinIndex: index, Logger: s.Logger()})
+	}
+	if err == nil {
+		err = os.Rename(part, path)
+	}
+	if err != nil {
+		os.Remove(part)
+		return "", 0, err
+	}
+	return path, size, nil
+}
+
+// uploadBackup 将备份文件 PUT 到 BackupTargetURL 下同名的对象
+func (s *EtcdServer) uploadBackup(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, backupUploadTimeout)
+	defer cancel()
+	url := strings.TrimSuffix(s.Cfg.BackupTargetURL, "/") + "/" + filepath.Base(path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, f)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = fi.Size()
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	ioutil.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("etcdserver: upload backup to %q failed: %s", url, resp.Status)
+	}
+	return nil
+}
+
+// pruneBackups 只保留最新的 BackupRetention 个备份,0 表示不清理
+func (s *EtcdServer) pruneBackups() {
+	if s.Cfg.BackupRetention <= 0 {
+		return
+	}
+	dir := s.Cfg.BackupDirPath()
+	names, err := fileutil.ReadDir(dir)
+	if err != nil {
+		s.Logger().Warn("读取备份目录失败", zap.String("backup-dir", dir), zap.Error(err))
+		return
+	}
+	var backups []string
+	for _, n := range names {
+		if strings.HasPrefix(n, backupFilePrefix) && strings.HasSuffix(n, backupFileSuffix) {
+			backups = append(backups, n)
+		}
+	}
+	// 文件名以UTC时间开头,按名称排序即按时间排序
+	sort.Strings(backups)
+	for len(backups) > s.Cfg.BackupRetention {
+		p := filepath.Join(dir, backups[0])
+		if err := os.Remove(p); err != nil {
+			s.Logger().Warn("删除过期备份失败", zap.String("path", p), zap.Error(err))
+		} else {
+			s.Logger().Info("删除过期备份", zap.String("path", p))
+		}
+		backups = backups[1:]
+	}
+}
+
+func (s *EtcdServer) hasBackupAlarm() bool {
+	for _, a := range s.alarmStore.Get(pb.AlarmType_BACKUP) {
+		if a.MemberID == uint64(s.ID()) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *EtcdServer) setBackupAlarm(action pb.AlarmRequest_AlarmAction) {
+	if action == pb.AlarmRequest_ACTIVATE && s.DowngradeFeatureBlocked(FeatureMemberAlarms) {
+		return
+	}
+	a := &pb.AlarmRequest{
+		MemberID: uint64(s.ID()),
+		Action:   action,
+		Alarm:    pb.AlarmType_BACKUP,
+	}
+	s.GoAttach(func() {
+		ctx, cancel := context.WithTimeout(s.ctx, s.Cfg.ReqTimeout())
+		defer cancel()
+		if _, err := s.raftRequest(ctx, pb.InternalRaftRequest{Alarm: a}); err != nil {
+			s.Logger().Warn("更新备份警报失败", zap.Error(err))
+		}
+	})
+}
@@ -0,0 +1,79 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdserver
+
+import (
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver/cindex"
+	"github.com/ls-2018/etcd_cn/etcd/mvcc/backend"
+	"github.com/ls-2018/etcd_cn/etcd/mvcc/buckets"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+)
+
+// raftRequestBucket 返回请求apply时会修改的非KV桶,不修改租约、鉴权、报警桶的请求返回nil
+func raftRequestBucket(r *pb.InternalRaftRequest) backend.Bucket {
+	switch {
+	case r.LeaseGrant != nil, r.LeaseRevoke != nil, r.LeaseRevokeExpired != nil, r.LeaseCheckpoint != nil:
+		return buckets.Lease
+	case r.Alarm != nil:
+		if r.Alarm.Action == pb.AlarmRequest_GET {
+			return nil
+		}
+		return buckets.Alarm
+	case r.DowngradeInfoSet != nil:
+		// 开启降级时会改写旧版本不认识的报警
+		return buckets.Alarm
+	case r.AuthEnable != nil, r.AuthDisable != nil, r.AuthLoginFailure != nil,
+		r.AuthUserAdd != nil, r.AuthUserDelete != nil, r.AuthUserChangePassword != nil,
+		r.AuthUserGrantRole != nil, r.AuthUserRevokeRole != nil,
+		r.AuthRoleAdd != nil, r.AuthRoleDelete != nil,
+		r.AuthRoleGrantPermission != nil, r.AuthRoleRevokePermission != nil:
+		return buckets.Auth
+	case r.Authenticate != nil:
+		// 外部认证的用户保存在鉴权桶中,本地用户登录成功会清空失败计数
+		return buckets.Auth
+	}
+	return nil
+}
+
+// saveBucketIndex 在apply之前记录请求会修改的桶对应的日志索引,
+// 修改所在的事务提交前由 backendHooks 把索引和桶内容的摘要写入同一个事务
+func (s *EtcdServer) saveBucketIndex(r *pb.InternalRaftRequest, index uint64) {
+	if b := raftRequestBucket(r); b != nil {
+		s.beHooks.setBucketIndex(b, index)
+	}
+}
+
+func (bh *backendHooks) setBucketIndex(b backend.Bucket, index uint64) {
+	bh.bucketIndexLock.Lock()
+	defer bh.bucketIndexLock.Unlock()
+	if bh.bucketIndexes == nil {
+		bh.bucketIndexes = make(map[backend.BucketID]uint64)
+	}
+	bh.bucketIndexes[b.ID()] = index
+}
+
+// unsafeSaveBucketIndexes 为本次提交中修改过的桶写入标记; 没有经过apply记录索引的修改
+// (例如启动时的初始化)使用同一事务中的consistent_index
+func (bh *backendHooks) unsafeSaveBucketIndexes(tx backend.BatchTx) {
+	bh.bucketIndexLock.Lock()
+	defer bh.bucketIndexLock.Unlock()
+	for _, bk := range cindex.BucketIndexKeys {
+		if !cindex.UnsafeBucketModified(tx, bk.Bucket) {
+			continue
+		}
+		cindex.UnsafeUpdateBucketIndex(tx, bk.Bucket, bh.bucketIndexes[bk.Bucket.ID()])
+	}
+	bh.bucketIndexes = nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdserver
+
+import (
+	"testing"
+
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver/api/membership"
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver/cindex"
+	"github.com/ls-2018/etcd_cn/etcd/lease"
+	"github.com/ls-2018/etcd_cn/etcd/mvcc/backend"
+	betesting "github.com/ls-2018/etcd_cn/etcd/mvcc/backend/testing"
+	"github.com/ls-2018/etcd_cn/etcd/mvcc/buckets"
+	"go.uber.org/zap"
+)
+
+// newHookedBackend 创建带 backendHooks 的后端,提交前会写入consistent_index和桶标记
+func newHookedBackend(t *testing.T) (backend.Backend, *backendHooks) {
+	ci := cindex.NewConsistentIndex(nil)
+	bh := &backendHooks{lg: zap.NewNop(), indexer: ci}
+	bcfg := backend.DefaultBackendConfig()
+	bcfg.Hooks = bh
+	be, _ := betesting.NewTmpBackendFromCfg(t, bcfg)
+	t.Cleanup(func() { betesting.Close(t, be) })
+	ci.SetBackend(be)
+	cindex.CreateMetaBucket(be.BatchTx())
+	return be, bh
+}
+
+func readBucketIndex(t *testing.T, be backend.Backend, b backend.Bucket) cindex.BucketIndex {
+	bi, ok := cindex.ReadBucketIndexes(be.BatchTx())[b.String()]
+	if !ok {
+		t.Fatalf("no index recorded for bucket %s", b)
+	}
+	return bi
+}
+
+// TestBucketIndexCommittedWithMutation 桶标记和桶的修改在同一次提交中写入,摘要与提交的内容一致
+func TestBucketIndexCommittedWithMutation(t *testing.T) {
+	be, bh := newHookedBackend(t)
+	le := lease.NewLessor(zap.NewNop(), be, membership.NewCluster(zap.NewNop()), lease.LessorConfig{MinLeaseTTL: 1})
+	defer le.Stop()
+
+	bh.indexer.SetConsistentIndex(5, 1)
+	bh.setBucketIndex(buckets.Lease, 5)
+	if _, err := le.Grant(1, 10, lease.NoLease, ""); err != nil {
+		t.Fatal(err)
+	}
+	be.ForceCommit()
+
+	bi := readBucketIndex(t, be, buckets.Lease)
+	tx := be.BatchTx()
+	tx.Lock()
+	digest := cindex.UnsafeBucketDigest(tx, buckets.Lease)
+	tx.Unlock()
+	if bi.Index != 5 || bi.Digest != digest {
+		t.Fatalf("lease index = %+v, want index 5 digest %08x", bi, digest)
+	}
+
+	// 没有修改租约桶的提交不改变标记
+	bh.indexer.SetConsistentIndex(6, 1)
+	bh.setBucketIndex(buckets.Lease, 6)
+	be.ForceCommit()
+	if got := readBucketIndex(t, be, buckets.Lease); got != bi {
+		t.Fatalf("lease index = %+v after an unrelated commit, want %+v", got, bi)
+	}
+
+	// 没有经过apply记录索引的修改使用当前的consistent_index
+	bh.indexer.SetConsistentIndex(7, 1)
+	if _, err := le.Grant(2, 10, lease.NoLease, ""); err != nil {
+		t.Fatal(err)
+	}
+	be.ForceCommit()
+	if got := readBucketIndex(t, be, buckets.Lease); got.Index != 7 || got.Digest == bi.Digest {
+		t.Fatalf("lease index = %+v after grant, want index 7 and a new digest", got)
+	}
+}
@@ -16,6 +16,7 @@ package cindex
 
 import (
 	"encoding/binary"
+	"hash/crc32"
 	"sync"
 	"sync/atomic"
 
@@ -123,6 +124,105 @@ func UnsafeUpdateConsistentIndex(tx backend.BatchTx, index uint64, term uint64,
 	}
 }
 
+// BucketIndexKeys 非KV桶及其在meta中记录apply索引的key; Digest 是标记中的摘要覆盖的桶
+var BucketIndexKeys = []struct {
+	Bucket backend.Bucket
+	Key    []byte
+	Digest []backend.Bucket
+}{
+	{buckets.Lease, buckets.MetaLeaseConsistentIndexKeyName, []backend.Bucket{buckets.Lease}},
+	{buckets.Auth, buckets.MetaAuthConsistentIndexKeyName, []backend.Bucket{buckets.Auth, buckets.AuthUsers, buckets.AuthRoles}},
+	{buckets.Alarm, buckets.MetaAlarmConsistentIndexKeyName, []backend.Bucket{buckets.Alarm}},
+}
+
+// BucketIndex 桶的apply索引标记
+type BucketIndex struct {
+	Index uint64
+	// Digest 写入标记时桶内容的摘要
+	Digest uint32
+}
+
+func bucketIndexKey(b backend.Bucket) []byte {
+	for _, bk := range BucketIndexKeys {
+		if bk.Bucket.ID() == b.ID() {
+			return bk.Key
+		}
+	}
+	return nil
+}
+
+// UnsafeBucketModified 返回tx中是否修改过桶b的标记覆盖的桶
+func UnsafeBucketModified(tx backend.BatchTx, b backend.Bucket) bool {
+	for _, bk := range BucketIndexKeys {
+		if bk.Bucket.ID() != b.ID() {
+			continue
+		}
+		for _, d := range bk.Digest {
+			if tx.UnsafeModified(d) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// UnsafeBucketDigest 计算桶b的标记覆盖的所有桶的内容摘要
+func UnsafeBucketDigest(tx backend.ReadTx, b backend.Bucket) uint32 {
+	h := crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	for _, bk := range BucketIndexKeys {
+		if bk.Bucket.ID() != b.ID() {
+			continue
+		}
+		for _, d := range bk.Digest {
+			h.Write(d.Name())
+			tx.UnsafeForEach(d, func(k, v []byte) error {
+				h.Write(k)
+				h.Write(v)
+				return nil
+			})
+		}
+	}
+	return h.Sum32()
+}
+
+// UnsafeUpdateBucketIndex 记录桶b最后一次修改时apply到的日志索引以及当时的内容摘要,
+// 在提交前的钩子中与该桶的修改写入同一个事务; index为0时使用tx中的consistent_index
+func UnsafeUpdateBucketIndex(tx backend.BatchTx, b backend.Bucket, index uint64) {
+	if index == 0 {
+		index, _ = unsafeReadConsistentIndex(tx)
+	}
+	key := bucketIndexKey(b)
+	if key == nil || index == 0 {
+		return
+	}
+	bs := make([]byte, 12)
+	binary.BigEndian.PutUint64(bs, index)
+	binary.BigEndian.PutUint32(bs[8:], UnsafeBucketDigest(tx, b))
+	tx.UnsafePut(buckets.Meta, key, bs)
+}
+
+// ReadBucketIndexes 按桶返回各非KV桶记录的apply索引标记,没有记录的桶不出现在结果中
+func ReadBucketIndexes(tx backend.ReadTx) map[string]BucketIndex {
+	tx.Lock()
+	defer tx.Unlock()
+	indexes := make(map[string]BucketIndex)
+	for _, bk := range BucketIndexKeys {
+		_, vs := tx.UnsafeRange(buckets.Meta, bk.Key, nil, 0)
+		if len(vs) == 0 {
+			continue
+		}
+		var bi BucketIndex
+		if len(vs[0]) >= 8 {
+			bi.Index = binary.BigEndian.Uint64(vs[0])
+		}
+		if len(vs[0]) >= 12 {
+			bi.Digest = binary.BigEndian.Uint32(vs[0][8:])
+		}
+		indexes[bk.Bucket.String()] = bi
+	}
+	return indexes
+}
+
 // ----------------------------------------- OVER -----------------------------------------------
 
 func (ci *consistentIndex) ConsistentIndex() uint64 {
@@ -0,0 +1,126 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdserver
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/ls-2018/etcd_cn/client_sdk/pkg/types"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// clockSkewCheckInterval 略大于rafthttp探测对端的间隔,每次检查都能拿到新的采样
+const clockSkewCheckInterval = 5 * time.Second
+
+var clockSkewSec = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: "etcd",
+	Subsystem: "server",
+	Name:      "clock_skew_seconds",
+	Help:      "The largest absolute clock offset between this member and its peers measured over the peer transport.",
+})
+
+func init() {
+	prometheus.MustRegister(clockSkewSec)
+}
+
+// ClockSkew 返回最近一次测得的本成员与各对端之间最大的时钟偏差(绝对值).
+// 租约到期由leader的时钟决定,偏差大时通过不同成员看到的剩余TTL会不一致.
+func (s *EtcdServer) ClockSkew() time.Duration {
+	return time.Duration(atomic.LoadInt64(&s.clockSkew))
+}
+
+// monitorClockSkew 定期根据rafthttp探测得到的时钟偏差更新指标;偏差超过 ClockSkewThreshold 时
+// 本成员发出 CLOCK_SKEW 警报,恢复后解除.每个成员只负责自己的警报.
+func (s *EtcdServer) monitorClockSkew() {
+	select {
+	case <-s.ReadyNotify():
+	case <-s.stopping:
+		return
+	}
+	for {
+		select {
+		case <-time.After(clockSkewCheckInterval):
+		case <-s.stopping:
+			return
+		}
+
+		var (
+			skew time.Duration
+			peer types.ID
+		)
+		for _, st := range s.r.transport.PeerStats() {
+			off := st.ClockOffset
+			if off < 0 {
+				off = -off
+			}
+			if off > skew {
+				skew, peer = off, st.ID
+			}
+		}
+		atomic.StoreInt64(&s.clockSkew, int64(skew))
+		clockSkewSec.Set(skew.Seconds())
+		s.checkClockSkewAlarm(skew, peer)
+	}
+}
+
+func (s *EtcdServer) checkClockSkewAlarm(skew time.Duration, peer types.ID) {
+	// 阈值为0时不发出警报,但仍然解除之前发出的警报
+	over := s.Cfg.ClockSkewThreshold > 0 && skew > s.Cfg.ClockSkewThreshold
+	alarmed := s.hasClockSkewAlarm()
+	switch {
+	case over && !alarmed:
+		s.Logger().Warn("与对端的时钟偏差超过阈值,发出警报",
+			zap.String("local-member-id", s.ID().String()),
+			zap.String("remote-peer-id", peer.String()),
+			zap.Duration("clock-skew", skew),
+			zap.Duration("threshold", s.Cfg.ClockSkewThreshold),
+		)
+		s.setClockSkewAlarm(pb.AlarmRequest_ACTIVATE)
+	case !over && alarmed:
+		s.Logger().Info("与对端的时钟偏差已恢复", zap.String("local-member-id", s.ID().String()), zap.Duration("clock-skew", skew))
+		s.setClockSkewAlarm(pb.AlarmRequest_DEACTIVATE)
+	}
+}
+
+func (s *EtcdServer) hasClockSkewAlarm() bool {
+	for _, a := range s.alarmStore.Get(pb.AlarmType_CLOCK_SKEW) {
+		if a.MemberID == uint64(s.ID()) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *EtcdServer) setClockSkewAlarm(action pb.AlarmRequest_AlarmAction) {
+	if action == pb.AlarmRequest_ACTIVATE && s.DowngradeFeatureBlocked(FeatureMemberAlarms) {
+		return
+	}
+	a := &pb.AlarmRequest{
+		MemberID: uint64(s.ID()),
+		Action:   action,
+		Alarm:    pb.AlarmType_CLOCK_SKEW,
+	}
+	s.GoAttach(func() {
+		ctx, cancel := context.WithTimeout(s.ctx, s.Cfg.ReqTimeout())
+		defer cancel()
+		if _, err := s.raftRequest(ctx, pb.InternalRaftRequest{Alarm: a}); err != nil {
+			s.Logger().Warn("更新时钟偏差警报失败", zap.Error(err))
+		}
+	})
+}
@@ -0,0 +1,216 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdserver
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/ls-2018/etcd_cn/etcd/mvcc"
+	"github.com/ls-2018/etcd_cn/etcd/mvcc/buckets"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// 压缩保留: 客户端登记一个需要保持可读的最低修订版本和有效期,自动压缩不会越过其中最低的修订版本.
+// 保留通过raft记录在 compaction_hold bucket 中,leader变更后仍然生效;手动压缩不受限制.
+
+var (
+	compactionHoldsActive = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "etcd",
+		Subsystem: "server",
+		Name:      "compaction_holds",
+		Help:      "The number of active compaction holds.",
+	})
+	compactionHoldFloor = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "etcd",
+		Subsystem: "server",
+		Name:      "compaction_hold_floor_revision",
+		Help:      "The lowest revision held by an active compaction hold; 0 if there is none.",
+	})
+	compactionHeldBack = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "etcd",
+		Subsystem: "server",
+		Name:      "compaction_held_back_total",
+		Help:      "The total number of auto compactions limited by a compaction hold.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(compactionHoldsActive)
+	prometheus.MustRegister(compactionHoldFloor)
+	prometheus.MustRegister(compactionHeldBack)
+}
+
+type compactionHoldRecord struct {
+	Revision int64 `json:"revision"`
+	Expires  int64 `json:"expires"`
+}
+
+// CompactionHold 登记、续期或释放压缩保留,返回当前有效的保留;owner为空时只返回列表
+func (s *EtcdServer) CompactionHold(ctx context.Context, r *pb.CompactionHoldRequest) (*pb.CompactionHoldResponse, error) {
+	if r.Owner != "" {
+		ir, err := s.newCompactionHoldRequest(r)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = s.raftRequest(ctx, pb.InternalRaftRequest{CompactionHold: ir}); err != nil {
+			return nil, err
+		}
+	}
+	holds := s.CompactionHolds()
+	s.updateCompactionHoldMetrics(holds)
+	return &pb.CompactionHoldResponse{Header: &pb.ResponseHeader{}, Holds: holds}, nil
+}
+
+// newCompactionHoldRequest 按本成员的配置检查限制,并填写过期时间
+func (s *EtcdServer) newCompactionHoldRequest(r *pb.CompactionHoldRequest) (*pb.InternalCompactionHoldRequest, error) {
+	now := time.Now()
+	ir := &pb.InternalCompactionHoldRequest{Owner: r.Owner, Release: r.Release, Time: now.Unix()}
+	if r.Release {
+		return ir, nil
+	}
+	if s.DowngradeFeatureBlocked(FeatureCompactionHold) {
+		return nil, ErrDowngradeFeatureBlocked
+	}
+	ttl := time.Duration(r.TTL) * time.Second
+	if ttl <= 0 || (s.Cfg.CompactionHoldMaxTTL > 0 && ttl > s.Cfg.CompactionHoldMaxTTL) {
+		return nil, ErrCompactionHoldTTL
+	}
+	cur := s.KV().Rev()
+	rev := r.Revision
+	if rev == 0 {
+		rev = cur
+	}
+	if rev < s.KV().FirstRev() {
+		return nil, mvcc.ErrCompacted
+	}
+	if max := s.Cfg.CompactionHoldMaxRevisions; max > 0 && cur-rev > max {
+		return nil, ErrCompactionHoldTooOld
+	}
+	if max := s.Cfg.CompactionHoldMaxCount; max > 0 {
+		n := 0
+		for _, h := range s.CompactionHolds() {
+			if h.Owner != r.Owner {
+				n++
+			}
+		}
+		if n >= max {
+			return nil, ErrCompactionHoldTooMany
+		}
+	}
+	ir.Revision = rev
+	ir.Expires = now.Add(ttl).Unix()
+	return ir, nil
+}
+
+// applyCompactionHold 清理在请求时间已经过期的保留,然后登记或释放owner的保留
+func (s *EtcdServer) applyCompactionHold(r *pb.InternalCompactionHoldRequest) (*pb.EmptyResponse, error) {
+	// 登记和压缩可能并发提交,保留的修订版本在apply时已被压缩则拒绝
+	if !r.Release && r.Revision < s.KV().FirstRev() {
+		return nil, mvcc.ErrCompacted
+	}
+	tx := s.backend.BatchTx()
+	tx.Lock()
+	defer tx.Unlock()
+	tx.UnsafeCreateBucket(buckets.CompactionHold)
+	var expired [][]byte
+	tx.UnsafeForEach(buckets.CompactionHold, func(k, v []byte) error {
+		var rec compactionHoldRecord
+		if err := json.Unmarshal(v, &rec); err != nil || rec.Expires <= r.Time {
+			expired = append(expired, append([]byte{}, k...))
+		}
+		return nil
+	})
+	for _, k := range expired {
+		tx.UnsafeDelete(buckets.CompactionHold, k)
+	}
+	if r.Release {
+		tx.UnsafeDelete(buckets.CompactionHold, []byte(r.Owner))
+		return &pb.EmptyResponse{}, nil
+	}
+	v, err := json.Marshal(compactionHoldRecord{Revision: r.Revision, Expires: r.Expires})
+	if err != nil {
+		s.lg.Panic("序列化压缩保留失败", zap.Error(err))
+	}
+	tx.UnsafePut(buckets.CompactionHold, []byte(r.Owner), v)
+	return &pb.EmptyResponse{}, nil
+}
+
+// CompactionHolds 返回当前有效的保留,按owner排序
+func (s *EtcdServer) CompactionHolds() []*pb.CompactionHold {
+	now := time.Now().Unix()
+	var holds []*pb.CompactionHold
+	tx := s.backend.BatchTx()
+	tx.Lock()
+	tx.UnsafeCreateBucket(buckets.CompactionHold)
+	tx.UnsafeForEach(buckets.CompactionHold, func(k, v []byte) error {
+		var rec compactionHoldRecord
+		if err := json.Unmarshal(v, &rec); err != nil || rec.Expires <= now {
+			return nil
+		}
+		holds = append(holds, &pb.CompactionHold{Owner: string(k), Revision: rec.Revision, Expires: rec.Expires})
+		return nil
+	})
+	tx.Unlock()
+	sort.Slice(holds, func(i, j int) bool { return holds[i].Owner < holds[j].Owner })
+	return holds
+}
+
+// compactionFloor 返回自动压缩不能越过的修订版本;落后超过 CompactionHoldMaxRevisions 的保留不再生效
+func (s *EtcdServer) compactionFloor() (floor int64, ok bool) {
+	holds := s.CompactionHolds()
+	s.updateCompactionHoldMetrics(holds)
+	cur := s.KV().Rev()
+	for _, h := range holds {
+		if max := s.Cfg.CompactionHoldMaxRevisions; max > 0 && cur-h.Revision > max {
+			s.Logger().Warn("压缩保留落后太多,不再阻止自动压缩",
+				zap.String("owner", h.Owner), zap.Int64("revision", h.Revision), zap.Int64("current-revision", cur))
+			continue
+		}
+		if !ok || h.Revision < floor {
+			floor, ok = h.Revision, true
+		}
+	}
+	return floor, ok
+}
+
+func (s *EtcdServer) updateCompactionHoldMetrics(holds []*pb.CompactionHold) {
+	compactionHoldsActive.Set(float64(len(holds)))
+	var floor int64
+	for _, h := range holds {
+		if floor == 0 || h.Revision < floor {
+			floor = h.Revision
+		}
+	}
+	compactionHoldFloor.Set(float64(floor))
+}
+
+// holdingCompactable 供自动压缩使用,压缩的修订版本不越过压缩保留
+type holdingCompactable struct {
+	s *EtcdServer
+}
+
+func (c holdingCompactable) Compact(ctx context.Context, r *pb.CompactionRequest) (*pb.CompactionResponse, error) {
+	if floor, ok := c.s.compactionFloor(); ok && r.Revision > floor {
+		c.s.Logger().Info("压缩保留限制了自动压缩", zap.Int64("revision", r.Revision), zap.Int64("hold-revision", floor))
+		compactionHeldBack.Inc()
+		r = &pb.CompactionRequest{Revision: floor, Physical: r.Physical}
+	}
+	return c.s.Compact(ctx, r)
+}
@@ -0,0 +1,376 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/ls-2018/etcd_cn/etcd/config"
+	"github.com/ls-2018/etcd_cn/offical/api/v3/version"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+	"github.com/ls-2018/etcd_cn/raft"
+	"github.com/ls-2018/etcd_cn/raft/raftpb"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// 崩溃报告中保留的最近apply的日志条数
+	crashRecentEntries = 64
+	// 采集单项状态的超时时间,崩溃时相关goroutine可能已经卡住
+	crashCaptureTimeout = time.Second
+	// goroutine dump的最大长度
+	crashMaxStackBytes = 64 << 20
+)
+
+// CrashReport 致命错误时写入崩溃目录的现场信息
+type CrashReport struct {
+	Time       time.Time `json:"time"`
+	Reason     string    `json:"reason"`
+	Caller     string    `json:"caller,omitempty"`
+	Version    string    `json:"version"`
+	MemberID   string    `json:"member-id,omitempty"`
+	ClusterID  string    `json:"cluster-id,omitempty"`
+	Goroutines string    `json:"goroutines"`
+
+	ConsistentIndex uint64          `json:"consistent-index"`
+	AppliedIndex    uint64          `json:"applied-index"`
+	CommittedIndex  uint64          `json:"committed-index"`
+	Term            uint64          `json:"term"`
+	RaftStatus      json.RawMessage `json:"raft-status,omitempty"`
+
+	RecentEntries []AppliedEntrySummary `json:"recent-entries"`
+	Config        map[string]string     `json:"config"`
+	// CaptureErrors 采集失败的项及原因
+	CaptureErrors []string `json:"capture-errors,omitempty"`
+}
+
+// AppliedEntrySummary 最近apply的一条日志的摘要,不包含数据内容
+type AppliedEntrySummary struct {
+	Index uint64 `json:"index"`
+	Term  uint64 `json:"term"`
+	Type  string `json:"type"`
+	Op    string `json:"op,omitempty"`
+	Size  int    `json:"size"`
+}
+
+// ReadCrashReport 读取崩溃报告文件
+func ReadCrashReport(path string) (*CrashReport, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var r CrashReport
+	if err = json.Unmarshal(b, &r); err != nil {
+		return nil, fmt.Errorf("解析崩溃报告 %q 失败: %v", path, err)
+	}
+	return &r, nil
+}
+
+// crashReporter 记录最近apply的日志,并在 Fatal/Panic 日志或未恢复的panic时写崩溃报告
+type crashReporter struct {
+	cfg  config.ServerConfig
+	once sync.Once
+
+	mu      sync.Mutex
+	s       *EtcdServer
+	entries [crashRecentEntries]AppliedEntrySummary
+	next    int
+	count   int
+}
+
+func newCrashReporter(cfg config.ServerConfig) *crashReporter {
+	return &crashReporter{cfg: cfg}
+}
+
+// hook 在日志器上挂一个只处理 Panic/Fatal 级别的core,在进程退出前写崩溃报告;
+// 不依赖原日志器的级别配置
+func (c *crashReporter) hook(lg *zap.Logger) *zap.Logger {
+	if lg == nil {
+		return nil
+	}
+	return lg.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return zapcore.NewTee(core, crashCore{c})
+	}))
+}
+
+// crashCore 只在 Panic/Fatal 级别的日志写入时触发崩溃报告
+type crashCore struct {
+	c *crashReporter
+}
+
+func (cc crashCore) Enabled(l zapcore.Level) bool      { return l >= zapcore.PanicLevel }
+func (cc crashCore) With([]zapcore.Field) zapcore.Core { return cc }
+func (cc crashCore) Sync() error                       { return nil }
+func (cc crashCore) Write(e zapcore.Entry, _ []zapcore.Field) error {
+	if !cc.Enabled(e.Level) {
+		// 子系统日志等级比全局更详细时 Tee 会把低等级日志也交给这里
+		return nil
+	}
+	var caller string
+	if e.Caller.Defined {
+		caller = e.Caller.String()
+	}
+	cc.c.report(e.Message, caller)
+	return nil
+}
+
+func (cc crashCore) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if cc.Enabled(e.Level) {
+		return ce.AddCore(e, cc)
+	}
+	return ce
+}
+
+func (c *crashReporter) setServer(s *EtcdServer) {
+	c.mu.Lock()
+	c.s = s
+	c.mu.Unlock()
+}
+
+// recordApplied 在apply日志前调用,记录摘要
+func (c *crashReporter) recordApplied(e *raftpb.Entry) {
+	c.mu.Lock()
+	c.entries[c.next] = AppliedEntrySummary{Index: e.Index, Term: e.Term, Type: e.Type.String(), Size: len(e.Data)}
+	c.next = (c.next + 1) % crashRecentEntries
+	if c.count < crashRecentEntries {
+		c.count++
+	}
+	c.mu.Unlock()
+}
+
+// setAppliedOp 补充最近一条日志的请求类型
+func (c *crashReporter) setAppliedOp(index uint64, op string) {
+	c.mu.Lock()
+	last := &c.entries[(c.next+crashRecentEntries-1)%crashRecentEntries]
+	if last.Index == index {
+		last.Op = op
+	}
+	c.mu.Unlock()
+}
+
+func (c *crashReporter) recentEntries() []AppliedEntrySummary {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	es := make([]AppliedEntrySummary, 0, c.count)
+	for i := c.count; i > 0; i-- {
+		es = append(es, c.entries[(c.next+crashRecentEntries-i)%crashRecentEntries])
+	}
+	return es
+}
+
+// recoverPanic 在goroutine退出前捕获panic并写崩溃报告,然后继续panic
+func (c *crashReporter) recoverPanic() {
+	if r := recover(); r != nil {
+		c.report(fmt.Sprintf("panic: %v", r), "")
+		panic(r)
+	}
+}
+
+// report 写崩溃报告,每个进程只写一次
+func (c *crashReporter) report(reason, caller string) {
+	c.once.Do(func() {
+		r := c.capture(reason, caller)
+		b, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			return
+		}
+		lg := c.cfg.Logger
+		dir := c.cfg.CrashDir()
+		path := filepath.Join(dir, fmt.Sprintf("crash-%s.json", r.Time.UTC().Format("20060102T150405.000Z")))
+		if err = os.MkdirAll(dir, 0o700); err == nil {
+			err = ioutil.WriteFile(path, b, 0o600)
+		}
+		if lg != nil {
+			if err != nil {
+				lg.Warn("写崩溃报告失败", zap.String("path", path), zap.Error(err))
+			} else {
+				lg.Warn("已写崩溃报告", zap.String("path", path))
+			}
+		}
+		if url := c.cfg.CrashReportWebhookURL; url != "" {
+			if err = postCrashReport(url, b); err != nil && lg != nil {
+				lg.Warn("发送崩溃报告失败", zap.String("url", url), zap.Error(err))
+			}
+		}
+	})
+}
+
+func (c *crashReporter) capture(reason, caller string) *CrashReport {
+	r := &CrashReport{
+		Time:          time.Now(),
+		Reason:        reason,
+		Caller:        caller,
+		Version:       version.Version,
+		Goroutines:    goroutineDump(),
+		RecentEntries: c.recentEntries(),
+		Config:        crashConfig(c.cfg),
+	}
+	c.mu.Lock()
+	s := c.s
+	c.mu.Unlock()
+	if s == nil {
+		r.CaptureErrors = append(r.CaptureErrors, "server 尚未创建")
+		return r
+	}
+	r.MemberID = s.ID().String()
+	r.AppliedIndex = s.getAppliedIndex()
+	r.CommittedIndex = s.getCommittedIndex()
+	r.Term = s.getTerm()
+	if s.cluster != nil {
+		r.ClusterID = s.cluster.ID().String()
+	}
+	if err := captureWithTimeout(func() {
+		if s.consistIndex != nil {
+			r.ConsistentIndex = s.consistIndex.ConsistentIndex()
+		}
+	}); err != nil {
+		r.CaptureErrors = append(r.CaptureErrors, "consistent-index: "+err.Error())
+	}
+	var st raft.Status
+	if err := captureWithTimeout(func() { st = s.r.Status() }); err != nil {
+		r.CaptureErrors = append(r.CaptureErrors, "raft-status: "+err.Error())
+	} else if b, err := json.Marshal(st); err == nil {
+		r.RaftStatus = b
+	}
+	return r
+}
+
+// captureWithTimeout 在单独的goroutine中采集状态,超时则放弃
+func captureWithTimeout(f func()) error {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f()
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-time.After(crashCaptureTimeout):
+		return fmt.Errorf("超过 %v 未完成", crashCaptureTimeout)
+	}
+}
+
+func goroutineDump() string {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) || len(buf) >= crashMaxStackBytes {
+			return string(buf[:n])
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// crashConfig 崩溃报告中记录的配置,不包含证书等敏感信息
+func crashConfig(cfg config.ServerConfig) map[string]string {
+	return map[string]string{
+		"name":                  cfg.Name,
+		"data-dir":              cfg.DataDir,
+		"wal-dir":               cfg.WALDir(),
+		"client-urls":           fmt.Sprint(cfg.ClientURLs.StringSlice()),
+		"peer-urls":             fmt.Sprint(cfg.PeerURLs.StringSlice()),
+		"initial-cluster":       cfg.InitialPeerURLsMap.String(),
+		"new-cluster":           fmt.Sprint(cfg.NewCluster),
+		"snapshot-count":        fmt.Sprint(cfg.SnapshotCount),
+		"snapshot-catchup":      fmt.Sprint(cfg.SnapshotCatchUpEntries),
+		"tick-ms":               fmt.Sprint(cfg.TickMs),
+		"election-ticks":        fmt.Sprint(cfg.ElectionTicks),
+		"quota-backend-bytes":   fmt.Sprint(cfg.QuotaBackendBytes),
+		"max-request-bytes":     fmt.Sprint(cfg.MaxRequestBytes),
+		"auto-compaction-mode":  cfg.AutoCompactionMode,
+		"auto-compaction":       cfg.AutoCompactionRetention.String(),
+		"pre-vote":              fmt.Sprint(cfg.PreVote),
+		"force-new-cluster":     fmt.Sprint(cfg.ForceNewCluster),
+		"initial-corrupt-check": fmt.Sprint(cfg.InitialCorruptCheck),
+	}
+}
+
+func postCrashReport(url string, b []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook返回状态 %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// raftRequestOp 返回请求的类型,用于崩溃报告中的日志摘要
+func raftRequestOp(r *pb.InternalRaftRequest) string {
+	switch {
+	case r.V2 != nil:
+		return "v2"
+	case r.Put != nil:
+		return "put"
+	case r.DeleteRange != nil:
+		return "delete-range"
+	case r.Txn != nil:
+		return "txn"
+	case r.Range != nil:
+		return "range"
+	case r.Compaction != nil:
+		return "compaction"
+	case r.LeaseGrant != nil:
+		return "lease-grant"
+	case r.LeaseRevoke != nil:
+		return "lease-revoke"
+	case r.LeaseCheckpoint != nil:
+		return "lease-checkpoint"
+	case r.Alarm != nil:
+		return "alarm"
+	case r.NotifyCursor != nil:
+		return "notify-cursor"
+	case r.CompactionHold != nil:
+		return "compaction-hold"
+	case r.StagedTxn != nil:
+		return "staged-txn"
+	case r.UserUsageReset != nil:
+		return "user-usage-reset"
+	case r.ReplicaPromote != nil:
+		return "replica-promote"
+	case r.LeaseRevokeExpired != nil:
+		return "lease-revoke-expired"
+	case r.ClusterVersionSet != nil:
+		return "cluster-version-set"
+	case r.ClusterMemberAttrSet != nil:
+		return "cluster-member-attr-set"
+	case r.DowngradeInfoSet != nil:
+		return "downgrade-info-set"
+	case r.Authenticate != nil:
+		return "authenticate"
+	}
+	return "other"
+}
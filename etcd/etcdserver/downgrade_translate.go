@@ -0,0 +1,281 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdserver
+
+import (
+	"sync"
+	"time"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/ls-2018/etcd_cn/client_sdk/pkg/types"
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver/api/membership"
+	"github.com/ls-2018/etcd_cn/etcd/mvcc/backend"
+	"github.com/ls-2018/etcd_cn/etcd/mvcc/buckets"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+	"go.uber.org/zap"
+)
+
+// 开启降级后,对降级目标版本不支持的特性:
+//   - 拒绝使用这些特性的新请求,避免写入旧版本无法回放的数据
+//   - 把后端中这些特性的数据改写成旧版本的格式
+// 需要所有成员一致的数据在应用 DowngradeInfoSet 时同步改写,只保存在本节点的数据在后台分批改写,
+// 进度通过 Maintenance Status 返回. WAL中已有的条目不会改写,旧版本回放时忽略其中不认识的字段.
+
+const (
+	// FeatureIdempotencyToken 带 IdempotencyToken 的 Put/Txn
+	FeatureIdempotencyToken = "idempotency-token"
+	// FeatureMemberAlarms UNREACHABLE、TOPOLOGY、BACKUP 和 CLOCK_SKEW 警报
+	FeatureMemberAlarms = "member-alarms"
+	// FeatureLoginLockout 通过raft记录登录失败并锁定用户
+	FeatureLoginLockout = "auth-login-lockout"
+	// FeatureDenialAudit 记录权限检查失败
+	FeatureDenialAudit = "auth-denial-audit"
+	// FeatureNotifyCursor 通过raft记录通知sink的游标
+	FeatureNotifyCursor = "notify-cursor"
+	// FeatureCompactionHold 压缩保留
+	FeatureCompactionHold = "compaction-hold"
+	// FeatureStagedTxn 暂存事务
+	FeatureStagedTxn = "staged-txn"
+	// FeatureUserUsage 按用户统计写入的字节数
+	FeatureUserUsage = "user-usage"
+	// FeatureReplicaPromote 通过raft提升只读副本集群
+	FeatureReplicaPromote = "replica-promote"
+	// FeatureLeaseRevokeExpired 在一个raft请求中按顺序撤销一批过期租约
+	FeatureLeaseRevokeExpired = "lease-revoke-expired"
+)
+
+const (
+	translationPending   = "pending"
+	translationRunning   = "translating"
+	translationDone      = "done"
+	translationNotNeeded = "not-needed"
+
+	translateBatch    = 1000
+	translateInterval = 100 * time.Millisecond
+)
+
+type downgradeFeature struct {
+	name  string
+	since semver.Version
+	// applyTranslate 在应用 DowngradeInfoSet 时同步改写所有成员一致的数据,返回改写的记录数
+	applyTranslate func(s *EtcdServer) int
+	// localTranslate 分批改写只保存在本节点的数据,返回本批改写的记录数,0表示完成
+	localTranslate func(s *EtcdServer) int
+}
+
+var downgradeFeatures = []downgradeFeature{
+	{name: FeatureIdempotencyToken, since: semver.Version{Major: 3, Minor: 5}, applyTranslate: dropIdempotencyRecords},
+	{name: FeatureMemberAlarms, since: semver.Version{Major: 3, Minor: 5}, applyTranslate: deactivateMemberAlarms},
+	// 用户的登录失败字段旧版本会忽略,不需要改写
+	{name: FeatureLoginLockout, since: semver.Version{Major: 3, Minor: 5}},
+	{name: FeatureDenialAudit, since: semver.Version{Major: 3, Minor: 5}, localTranslate: func(s *EtcdServer) int {
+		return s.AuthStore().DropDenials(translateBatch)
+	}},
+	{name: FeatureNotifyCursor, since: semver.Version{Major: 3, Minor: 5}, applyTranslate: func(s *EtcdServer) int {
+		return dropBucketRecords(s, buckets.Notify)
+	}},
+	{name: FeatureCompactionHold, since: semver.Version{Major: 3, Minor: 5}, applyTranslate: func(s *EtcdServer) int {
+		return dropBucketRecords(s, buckets.CompactionHold)
+	}},
+	{name: FeatureStagedTxn, since: semver.Version{Major: 3, Minor: 5}, applyTranslate: func(s *EtcdServer) int {
+		return dropBucketRecords(s, buckets.StagedTxn)
+	}},
+	{name: FeatureUserUsage, since: semver.Version{Major: 3, Minor: 5}, applyTranslate: func(s *EtcdServer) int {
+		return dropBucketRecords(s, buckets.UserUsage)
+	}},
+	// 旧版本会忽略 meta bucket 中的提升标记,不需要改写
+	{name: FeatureReplicaPromote, since: semver.Version{Major: 3, Minor: 5}},
+	// 只改变撤销请求的形式,不在后端留下数据
+	{name: FeatureLeaseRevokeExpired, since: semver.Version{Major: 3, Minor: 5}},
+}
+
+// unsupportedFeatures 返回降级目标版本不支持的特性
+func unsupportedFeatures(d *membership.DowngradeInfo) []downgradeFeature {
+	if d == nil || !d.Enabled {
+		return nil
+	}
+	target := d.GetTargetVersion()
+	var fs []downgradeFeature
+	for _, f := range downgradeFeatures {
+		if target.LessThan(f.since) {
+			fs = append(fs, f)
+		}
+	}
+	return fs
+}
+
+// DowngradeFeatureBlocked 集群正在降级到不支持该特性的版本时返回true
+func (s *EtcdServer) DowngradeFeatureBlocked(name string) bool {
+	for _, f := range unsupportedFeatures(s.cluster.DowngradeInfo()) {
+		if f.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// downgradeTranslation 记录本节点改写数据的进度
+type downgradeTranslation struct {
+	mu       sync.Mutex
+	target   string
+	features []*pb.DowngradeFeatureStatus
+}
+
+func (t *downgradeTranslation) reset(target string, fs []downgradeFeature) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.target = target
+	t.features = nil
+	for _, f := range fs {
+		state := translationNotNeeded
+		if f.applyTranslate != nil || f.localTranslate != nil {
+			state = translationPending
+		}
+		t.features = append(t.features, &pb.DowngradeFeatureStatus{Name: f.name, State: state})
+	}
+}
+
+// update 更新特性的进度;降级目标已经变化时返回false
+func (t *downgradeTranslation) update(target, name, state string, n int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.target != target {
+		return false
+	}
+	for _, f := range t.features {
+		if f.Name == name {
+			f.State = state
+			f.Translated += int64(n)
+		}
+	}
+	return true
+}
+
+func (t *downgradeTranslation) status() []*pb.DowngradeFeatureStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fs := make([]*pb.DowngradeFeatureStatus, 0, len(t.features))
+	for _, f := range t.features {
+		c := *f
+		fs = append(fs, &c)
+	}
+	return fs
+}
+
+// DowngradeFeatures 返回降级目标版本不支持的特性以及本节点改写数据的进度
+func (s *EtcdServer) DowngradeFeatures() []*pb.DowngradeFeatureStatus {
+	return s.translation.status()
+}
+
+// applyDowngradeTranslation 在应用 DowngradeInfoSet 之后调用,开启降级时同步改写所有成员一致的数据,
+// 并在后台改写本节点的数据
+func (s *EtcdServer) applyDowngradeTranslation(d *membership.DowngradeInfo) {
+	fs := unsupportedFeatures(d)
+	s.translation.reset(d.TargetVersion, fs)
+	if len(fs) == 0 {
+		return
+	}
+	lg := s.Logger()
+	for _, f := range fs {
+		if f.applyTranslate == nil {
+			continue
+		}
+		n := f.applyTranslate(s)
+		s.translation.update(d.TargetVersion, f.name, translationDone, n)
+		lg.Info("已改写降级目标版本不支持的数据", zap.String("feature", f.name), zap.String("target-version", d.TargetVersion), zap.Int("records", n))
+	}
+	s.GoAttach(func() { s.translateLocalData(d.TargetVersion, fs) })
+}
+
+// resumeDowngradeTranslation 重启后继续改写本节点的数据;同步改写的数据已经在应用时完成
+func (s *EtcdServer) resumeDowngradeTranslation() {
+	d := s.cluster.DowngradeInfo()
+	fs := unsupportedFeatures(d)
+	if len(fs) == 0 {
+		return
+	}
+	s.translation.reset(d.TargetVersion, fs)
+	for _, f := range fs {
+		if f.applyTranslate != nil {
+			s.translation.update(d.TargetVersion, f.name, translationDone, 0)
+		}
+	}
+	s.translateLocalData(d.TargetVersion, fs)
+}
+
+func (s *EtcdServer) translateLocalData(target string, fs []downgradeFeature) {
+	lg := s.Logger()
+	for _, f := range fs {
+		if f.localTranslate == nil {
+			continue
+		}
+		total := 0
+		for {
+			n := f.localTranslate(s)
+			if n == 0 {
+				break
+			}
+			total += n
+			if !s.translation.update(target, f.name, translationRunning, n) {
+				// 降级已取消或目标变化
+				return
+			}
+			select {
+			case <-time.After(translateInterval):
+			case <-s.stopping:
+				return
+			}
+		}
+		if !s.translation.update(target, f.name, translationDone, 0) {
+			return
+		}
+		lg.Info("已改写降级目标版本不支持的本地数据", zap.String("feature", f.name), zap.String("target-version", target), zap.Int("records", total))
+	}
+}
+
+// dropIdempotencyRecords 删除所有幂等请求记录;降级期间不再查找和记录token,各成员结果一致
+func dropIdempotencyRecords(s *EtcdServer) int {
+	return dropBucketRecords(s, buckets.Idempotency)
+}
+
+// dropBucketRecords 清空旧版本不认识的bucket,返回删除的记录数.
+// 通知游标被删除后sink从当前修订版本重新开始投递,压缩保留被删除后自动压缩不再受限,暂存事务被删除后需要重新暂存
+func dropBucketRecords(s *EtcdServer, b backend.Bucket) int {
+	tx := s.backend.BatchTx()
+	tx.Lock()
+	defer tx.Unlock()
+	tx.UnsafeCreateBucket(b)
+	n := 0
+	tx.UnsafeForEach(b, func(k, v []byte) error {
+		n++
+		return nil
+	})
+	tx.UnsafeDeleteBucket(b)
+	tx.UnsafeCreateBucket(b)
+	return n
+}
+
+// deactivateMemberAlarms 解除旧版本不认识的警报
+func deactivateMemberAlarms(s *EtcdServer) int {
+	n := 0
+	for _, at := range []pb.AlarmType{pb.AlarmType_UNREACHABLE, pb.AlarmType_TOPOLOGY, pb.AlarmType_BACKUP, pb.AlarmType_CLOCK_SKEW} {
+		for _, m := range s.alarmStore.Get(at) {
+			if s.alarmStore.Deactivate(types.ID(m.MemberID), at) != nil {
+				n++
+			}
+		}
+	}
+	return n
+}
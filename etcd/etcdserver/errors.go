@@ -17,6 +17,7 @@ package etcdserver
 import (
 	"errors"
 	"fmt"
+	"time"
 )
 
 var (
@@ -44,6 +45,30 @@ var (
 	ErrInvalidDowngradeTargetVersion = errors.New("etcdserver: invalid downgrade target version")
 	ErrDowngradeInProcess            = errors.New("etcdserver: cluster has a downgrade job in progress")
 	ErrNoInflightDowngrade           = errors.New("etcdserver: no inflight downgrade job")
+	ErrInvalidUpgradeTargetVersion   = errors.New("etcdserver: invalid upgrade target version")
+	ErrMembersNotUpgraded            = errors.New("etcdserver: not all members run the upgrade target version")
+	ErrDowngradeFeatureBlocked       = errors.New("etcdserver: feature is not supported by the downgrade target version")
+	ErrMemberReadOnly                = errors.New("etcdserver: member is in read-only maintenance mode")
+	ErrReadOnlySoleVoter             = errors.New("etcdserver: the only voting member cannot enter read-only maintenance mode")
+	ErrReplicaReadOnly               = errors.New("etcdserver: cluster is a read-only replica")
+	ErrNotReplica                    = errors.New("etcdserver: cluster is not a read-only replica")
+	ErrUnknownLogScope               = errors.New("etcdserver: unknown log scope")
+	ErrInvalidLogLevel               = errors.New("etcdserver: invalid log level")
+	ErrFailpointsDisabled            = errors.New("etcdserver: failpoints are disabled")
+	ErrInvalidFailpoint              = errors.New("etcdserver: invalid failpoint")
+	ErrFailpointCommit               = errors.New("etcdserver: backend commit failed by failpoint")
+	ErrCompactionHoldTTL             = errors.New("etcdserver: invalid compaction hold ttl")
+	ErrCompactionHoldTooOld          = errors.New("etcdserver: compaction hold revision is too old")
+	ErrCompactionHoldTooMany         = errors.New("etcdserver: too many compaction holds")
+	ErrSnapshotSessionNotFound       = errors.New("etcdserver: snapshot session not found or expired")
+	ErrSnapshotSessionRevision       = errors.New("etcdserver: revision conflicts with snapshot session")
+	ErrStagedTxnNotFound             = errors.New("etcdserver: staged txn not found")
+	ErrStagedTxnTooLarge             = errors.New("etcdserver: staged txn exceeds the size limit")
+	ErrStagedTxnTooMany              = errors.New("etcdserver: too many staged txns")
+	ErrUserQuotaExceeded             = errors.New("etcdserver: user write quota exceeded")
+	ErrUserRateLimited               = errors.New("etcdserver: user write rate limit exceeded")
+	ErrWatchLimitExceeded            = errors.New("etcdserver: too many watches")
+	ErrLeaseWatcherSlow              = errors.New("etcdserver: 租约watcher处理过慢,已被移除")
 )
 
 type DiscoveryError struct {
@@ -54,3 +79,21 @@ type DiscoveryError struct {
 func (e DiscoveryError) Error() string {
 	return fmt.Sprintf("failed to %s discovery cluster (%v)", e.Op, e.Err)
 }
+
+// RequestBudgetError 写请求等待raft的时间超过了由客户端deadline推算出的处理预算
+type RequestBudgetError struct {
+	Budget    time.Duration // 处理预算
+	QueueWait time.Duration // 提交给raft之前排队的时间
+	ApplyWait time.Duration // 提交给raft之后等待apply的时间
+	Pending   uint64        // 失败时已提交未apply的日志条数
+	Cause     error         // 按超时处理时推断的原因,可能为nil
+}
+
+func (e *RequestBudgetError) Error() string {
+	s := fmt.Sprintf("etcdserver: request exceeded its deadline budget (budget %v, queue wait %v, apply wait %v, %d entries pending apply)",
+		e.Budget, e.QueueWait, e.ApplyWait, e.Pending)
+	if e.Cause != nil {
+		s += ": " + e.Cause.Error()
+	}
+	return s
+}
@@ -0,0 +1,257 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdserver
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ls-2018/etcd_cn/client_sdk/pkg/types"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+
+	"go.uber.org/zap"
+)
+
+// 故障注入: 以 --experimental-failpoints 启动的成员通过 Maintenance.Failpoint 接口注入故障,供功能测试和混沌工具使用.
+// 每个故障都有TTL,到期后自动解除;成员停止时解除全部故障.故障只在本成员生效,不会经过raft.
+
+type faultKey struct {
+	typ  pb.Failpoint_Type
+	peer uint64
+}
+
+type fault struct {
+	delay   time.Duration
+	expires time.Time
+	timer   *time.Timer
+}
+
+type peerCutter interface {
+	CutPeer(id types.ID)
+	MendPeer(id types.ID)
+}
+
+// faultInjector 保存当前生效的故障
+type faultInjector struct {
+	lg      *zap.Logger
+	enabled bool
+	peers   peerCutter
+
+	mu     sync.Mutex
+	faults map[faultKey]*fault
+	// resume 暂停apply时不为nil,解除暂停时关闭
+	resume chan struct{}
+
+	// 热路径上读取的故障,避免加锁
+	fsyncDelay int64 // time.Duration
+	commitErr  int32
+}
+
+func newFaultInjector(lg *zap.Logger, enabled bool) *faultInjector {
+	return &faultInjector{lg: lg, enabled: enabled, faults: make(map[faultKey]*fault)}
+}
+
+func keyOf(f *pb.Failpoint) faultKey {
+	k := faultKey{typ: f.Type}
+	if f.Type == pb.Failpoint_DROP_PEER {
+		k.peer = f.Peer
+	}
+	return k
+}
+
+// inject 注入一个故障,替换同类型(DROP_PEER 还要求同一个peer)的故障
+func (fi *faultInjector) inject(f *pb.Failpoint) {
+	k := keyOf(f)
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	fi.removeLocked(k)
+	ttl := time.Duration(f.Ttl) * time.Second
+	ft := &fault{delay: time.Duration(f.DelayMs) * time.Millisecond, expires: time.Now().Add(ttl)}
+	ft.timer = time.AfterFunc(ttl, func() { fi.expire(k, ft) })
+	fi.faults[k] = ft
+	switch k.typ {
+	case pb.Failpoint_FSYNC_DELAY:
+		atomic.StoreInt64(&fi.fsyncDelay, int64(ft.delay))
+	case pb.Failpoint_DROP_PEER:
+		fi.peers.CutPeer(types.ID(k.peer))
+	case pb.Failpoint_PAUSE_APPLY:
+		fi.resume = make(chan struct{})
+	case pb.Failpoint_COMMIT_ERROR:
+		atomic.StoreInt32(&fi.commitErr, 1)
+	}
+	fi.lg.Warn("注入故障", zap.String("type", k.typ.String()), zap.String("peer", types.ID(k.peer).String()),
+		zap.Duration("delay", ft.delay), zap.Duration("ttl", ttl))
+}
+
+func (fi *faultInjector) expire(k faultKey, ft *fault) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	if fi.faults[k] != ft {
+		return
+	}
+	fi.removeLocked(k)
+	fi.lg.Info("故障已到期", zap.String("type", k.typ.String()), zap.String("peer", types.ID(k.peer).String()))
+}
+
+func (fi *faultInjector) remove(k faultKey) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	if fi.removeLocked(k) {
+		fi.lg.Info("解除故障", zap.String("type", k.typ.String()), zap.String("peer", types.ID(k.peer).String()))
+	}
+}
+
+func (fi *faultInjector) removeLocked(k faultKey) bool {
+	ft, ok := fi.faults[k]
+	if !ok {
+		return false
+	}
+	ft.timer.Stop()
+	delete(fi.faults, k)
+	switch k.typ {
+	case pb.Failpoint_FSYNC_DELAY:
+		atomic.StoreInt64(&fi.fsyncDelay, 0)
+	case pb.Failpoint_DROP_PEER:
+		fi.peers.MendPeer(types.ID(k.peer))
+	case pb.Failpoint_PAUSE_APPLY:
+		close(fi.resume)
+		fi.resume = nil
+	case pb.Failpoint_COMMIT_ERROR:
+		atomic.StoreInt32(&fi.commitErr, 0)
+	}
+	return true
+}
+
+// clear 解除全部故障
+func (fi *faultInjector) clear() {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	for k := range fi.faults {
+		fi.removeLocked(k)
+	}
+}
+
+// active 返回当前生效的故障,ttl为剩余的秒数
+func (fi *faultInjector) active() []*pb.Failpoint {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	now := time.Now()
+	fs := make([]*pb.Failpoint, 0, len(fi.faults))
+	for k, ft := range fi.faults {
+		ttl := ft.expires.Sub(now)
+		if ttl < 0 {
+			ttl = 0
+		}
+		fs = append(fs, &pb.Failpoint{
+			Type:    k.typ,
+			Peer:    k.peer,
+			DelayMs: int64(ft.delay / time.Millisecond),
+			Ttl:     int64((ttl + time.Second - 1) / time.Second),
+		})
+	}
+	return fs
+}
+
+// delayFsync 在WAL落盘或后端提交前按 FSYNC_DELAY 等待
+func (fi *faultInjector) delayFsync() {
+	if fi == nil {
+		return
+	}
+	if d := time.Duration(atomic.LoadInt64(&fi.fsyncDelay)); d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// beforeBackendCommit 后端提交前调用,COMMIT_ERROR 只让下一次提交失败
+func (fi *faultInjector) beforeBackendCommit() error {
+	if fi == nil {
+		return nil
+	}
+	fi.delayFsync()
+	if atomic.CompareAndSwapInt32(&fi.commitErr, 1, 0) {
+		fi.remove(faultKey{typ: pb.Failpoint_COMMIT_ERROR})
+		return ErrFailpointCommit
+	}
+	return nil
+}
+
+// waitApply 暂停apply时阻塞,直到解除暂停;stopc 关闭时返回false
+func (fi *faultInjector) waitApply(stopc <-chan struct{}) bool {
+	if fi == nil {
+		return true
+	}
+	fi.mu.Lock()
+	resume := fi.resume
+	fi.mu.Unlock()
+	if resume == nil {
+		return true
+	}
+	select {
+	case <-resume:
+		return true
+	case <-stopc:
+		return false
+	}
+}
+
+// Failpoint 注入或解除本成员的故障,并返回当前生效的故障
+func (s *EtcdServer) Failpoint(ctx context.Context, r *pb.FailpointRequest) (*pb.FailpointResponse, error) {
+	if !s.faults.enabled {
+		return nil, ErrFailpointsDisabled
+	}
+	for _, f := range r.Inject {
+		if err := s.validateFailpoint(f); err != nil {
+			return nil, err
+		}
+		if f.Ttl <= 0 {
+			return nil, ErrInvalidFailpoint
+		}
+	}
+	for _, f := range r.Remove {
+		if _, ok := pb.Failpoint_Type_name[int32(f.Type)]; !ok {
+			return nil, ErrInvalidFailpoint
+		}
+	}
+	if r.Clear {
+		s.faults.clear()
+	}
+	for _, f := range r.Remove {
+		s.faults.remove(keyOf(f))
+	}
+	for _, f := range r.Inject {
+		s.faults.inject(f)
+	}
+	return &pb.FailpointResponse{Header: &pb.ResponseHeader{}, Active: s.faults.active()}, nil
+}
+
+func (s *EtcdServer) validateFailpoint(f *pb.Failpoint) error {
+	switch f.Type {
+	case pb.Failpoint_FSYNC_DELAY:
+		if f.DelayMs <= 0 {
+			return ErrInvalidFailpoint
+		}
+	case pb.Failpoint_DROP_PEER:
+		id := types.ID(f.Peer)
+		if id == s.ID() || s.cluster.Member(id) == nil {
+			return ErrInvalidFailpoint
+		}
+	case pb.Failpoint_PAUSE_APPLY, pb.Failpoint_COMMIT_ERROR:
+	default:
+		return ErrInvalidFailpoint
+	}
+	return nil
+}
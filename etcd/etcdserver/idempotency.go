@@ -0,0 +1,137 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdserver
+
+import (
+	"encoding/binary"
+
+	"github.com/ls-2018/etcd_cn/etcd/auth"
+	"github.com/ls-2018/etcd_cn/etcd/mvcc/buckets"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+	"go.uber.org/zap"
+)
+
+// 带 IdempotencyToken 的 Put/Txn 在apply时记录token和响应,相同token的重复请求不再应用,直接返回第一次的响应.
+// 记录随raft日志在所有成员上写入和清理,与kv数据在同一个后端事务里,重启或从快照恢复后各成员结果一致.
+// token按用户隔离,返回记录的响应前仍做一次与authApplierV3相同的权限检查.
+
+// idempotencyTokenWindow token记录保留的raft日志条数,超过后被清理,同一token的重试需要在这个窗口内完成
+const idempotencyTokenWindow = 100000
+
+var (
+	idempotencyTokenPrefix = []byte("t/") // t/<user>\x00<token> -> <index><response>
+	idempotencyIndexPrefix = []byte("i/") // i/<index><user>\x00<token> -> 空, 按日志索引清理
+)
+
+// idempotencyScopedToken 把token限定在请求的用户下,不同用户的相同token互不可见
+func idempotencyScopedToken(h *pb.RequestHeader, token string) string {
+	return idempotencyAuthInfo(h).Username + "\x00" + token
+}
+
+func idempotencyAuthInfo(h *pb.RequestHeader) *auth.AuthInfo {
+	if h == nil {
+		return &auth.AuthInfo{}
+	}
+	return &auth.AuthInfo{Username: h.Username, Revision: h.AuthRevision, Time: h.Time}
+}
+
+// idempotentPutPermitted 对记录的Put响应做与authApplierV3.Put相同的权限检查
+func (s *EtcdServer) idempotentPutPermitted(h *pb.RequestHeader, r *pb.PutRequest) bool {
+	if s.authStore == nil {
+		return true
+	}
+	ai := idempotencyAuthInfo(h)
+	if err := s.authStore.IsPutPermitted(ai, []byte(r.Key)); err != nil {
+		return false
+	}
+	if r.PrevKv {
+		if err := s.authStore.IsRangePermitted(ai, []byte(r.Key), nil); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// idempotentTxnPermitted 对记录的Txn响应做与authApplierV3.Txn相同的权限检查
+func (s *EtcdServer) idempotentTxnPermitted(h *pb.RequestHeader, r *pb.TxnRequest) bool {
+	if s.authStore == nil {
+		return true
+	}
+	return checkTxnAuth(s.authStore, idempotencyAuthInfo(h), r) == nil
+}
+
+func idempotencyTokenKey(token string) []byte {
+	return append(append([]byte{}, idempotencyTokenPrefix...), token...)
+}
+
+func idempotencyIndexKey(index uint64, token string) []byte {
+	k := make([]byte, len(idempotencyIndexPrefix)+8, len(idempotencyIndexPrefix)+8+len(token))
+	copy(k, idempotencyIndexPrefix)
+	binary.BigEndian.PutUint64(k[len(idempotencyIndexPrefix):], index)
+	return append(k, token...)
+}
+
+// idempotentResponse 查找该用户的token第一次应用时的响应,找到时解析到resp并返回true
+func (s *EtcdServer) idempotentResponse(h *pb.RequestHeader, token string, resp interface{ Unmarshal([]byte) error }) bool {
+	// 降级期间忽略token,记录可能已被删除
+	if token == "" || s.DowngradeFeatureBlocked(FeatureIdempotencyToken) {
+		return false
+	}
+	scoped := idempotencyScopedToken(h, token)
+	tx := s.backend.BatchTx()
+	tx.Lock()
+	defer tx.Unlock()
+	tx.UnsafeCreateBucket(buckets.Idempotency)
+	_, vs := tx.UnsafeRange(buckets.Idempotency, idempotencyTokenKey(scoped), nil, 0)
+	if len(vs) == 0 || len(vs[0]) < 8 {
+		return false
+	}
+	if err := resp.Unmarshal(vs[0][8:]); err != nil {
+		s.lg.Warn("解析幂等请求的响应失败", zap.String("token", token), zap.Error(err))
+		return false
+	}
+	return true
+}
+
+// saveIdempotentResponse 记录token和响应,并清理超出窗口的旧记录
+func (s *EtcdServer) saveIdempotentResponse(h *pb.RequestHeader, token string, resp interface{ Marshal() ([]byte, error) }) {
+	if token == "" || s.DowngradeFeatureBlocked(FeatureIdempotencyToken) {
+		return
+	}
+	v, err := resp.Marshal()
+	if err != nil {
+		s.lg.Warn("序列化幂等请求的响应失败", zap.String("token", token), zap.Error(err))
+		return
+	}
+	index := s.consistIndex.ConsistentIndex()
+	val := make([]byte, 8, 8+len(v))
+	binary.BigEndian.PutUint64(val, index)
+
+	tx := s.backend.BatchTx()
+	tx.Lock()
+	defer tx.Unlock()
+	scoped := idempotencyScopedToken(h, token)
+	tx.UnsafePut(buckets.Idempotency, idempotencyTokenKey(scoped), append(val, v...))
+	tx.UnsafePut(buckets.Idempotency, idempotencyIndexKey(index, scoped), []byte{})
+
+	if index <= idempotencyTokenWindow {
+		return
+	}
+	keys, _ := tx.UnsafeRange(buckets.Idempotency, idempotencyIndexKey(0, ""), idempotencyIndexKey(index-idempotencyTokenWindow, ""), 0)
+	for _, k := range keys {
+		tx.UnsafeDelete(buckets.Idempotency, k)
+		tx.UnsafeDelete(buckets.Idempotency, idempotencyTokenKey(string(k[len(idempotencyIndexPrefix)+8:])))
+	}
+}
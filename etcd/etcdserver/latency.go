@@ -0,0 +1,119 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdserver
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// 写路径的各个阶段
+const (
+	// latencyProposalCommit 从提交给raft到开始apply,包括复制、提交和等待前面的日志apply
+	latencyProposalCommit = "proposal-commit"
+	// latencyApply 执行一条日志的耗时
+	latencyApply = "apply"
+	// latencyBackendCommit 后端bolt事务提交的耗时
+	latencyBackendCommit = "backend-commit"
+	// latencyWALFsync 写WAL并fsync的耗时
+	latencyWALFsync = "wal-fsync"
+
+	// 每个阶段保留的最近样本数
+	latencyWindowSize = 1024
+)
+
+var latencyStages = []string{latencyProposalCommit, latencyApply, latencyBackendCommit, latencyWALFsync}
+
+var writePathDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "etcd",
+	Subsystem: "server",
+	Name:      "write_path_duration_seconds",
+	Help:      "The latency distributions of the stages of the write path: proposal-commit, apply, backend-commit and wal-fsync.",
+	// 100us ~ 13s
+	Buckets: prometheus.ExponentialBuckets(0.0001, 2, 18),
+}, []string{"stage"})
+
+func init() {
+	prometheus.MustRegister(writePathDuration)
+}
+
+// latencyWindow 保存最近 latencyWindowSize 个样本
+type latencyWindow struct {
+	mu      sync.Mutex
+	samples [latencyWindowSize]time.Duration
+	next    int
+	count   int
+}
+
+func (w *latencyWindow) add(d time.Duration) {
+	w.mu.Lock()
+	w.samples[w.next] = d
+	w.next = (w.next + 1) % latencyWindowSize
+	if w.count < latencyWindowSize {
+		w.count++
+	}
+	w.mu.Unlock()
+}
+
+func (w *latencyWindow) summary(stage string) *pb.LatencySummary {
+	w.mu.Lock()
+	ds := make([]time.Duration, w.count)
+	copy(ds, w.samples[:w.count])
+	w.mu.Unlock()
+
+	ls := &pb.LatencySummary{Stage: stage, Count: int64(len(ds))}
+	if len(ds) == 0 {
+		return ls
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+	at := func(q float64) int64 { return int64(ds[int(q*float64(len(ds)-1))]) }
+	ls.P50, ls.P90, ls.P99, ls.Max = at(0.5), at(0.9), at(0.99), int64(ds[len(ds)-1])
+	return ls
+}
+
+// latencyTracker 记录写路径各阶段最近的耗时,供 Status 返回百分位数
+type latencyTracker struct {
+	windows map[string]*latencyWindow
+}
+
+func newLatencyTracker() *latencyTracker {
+	t := &latencyTracker{windows: make(map[string]*latencyWindow, len(latencyStages))}
+	for _, st := range latencyStages {
+		t.windows[st] = &latencyWindow{}
+	}
+	return t
+}
+
+func (t *latencyTracker) observe(stage string, d time.Duration) {
+	if t == nil {
+		return
+	}
+	writePathDuration.WithLabelValues(stage).Observe(d.Seconds())
+	t.windows[stage].add(d)
+}
+
+// LatencySummaries 返回写路径各阶段最近耗时的百分位数
+func (s *EtcdServer) LatencySummaries() []*pb.LatencySummary {
+	ls := make([]*pb.LatencySummary, 0, len(latencyStages))
+	for _, st := range latencyStages {
+		ls = append(ls, s.latency.windows[st].summary(st))
+	}
+	return ls
+}
@@ -0,0 +1,160 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdserver
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/ls-2018/etcd_cn/client_sdk/pkg/types"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+	"github.com/ls-2018/etcd_cn/raft/tracker"
+	"go.uber.org/zap"
+)
+
+const maxLearnerPromotionCheckInterval = 5 * time.Second
+
+// LearnerProgress 返回leader上各learner的复制进度,非leader返回nil
+func (s *EtcdServer) LearnerProgress() []*pb.LearnerProgress {
+	rs := s.raftStatus()
+	if rs.Progress == nil {
+		return nil
+	}
+	leaderMatch := rs.Progress[rs.ID].Match
+	now := time.Now()
+
+	s.learnerReadyMu.Lock()
+	defer s.learnerReadyMu.Unlock()
+	var lps []*pb.LearnerProgress
+	for id, pr := range rs.Progress {
+		if !pr.IsLearner {
+			continue
+		}
+		lp := &pb.LearnerProgress{
+			ID:              id,
+			MatchIndex:      pr.Match,
+			State:           learnerState(pr.State),
+			PendingSnapshot: pr.PendingSnapshot,
+		}
+		if leaderMatch > pr.Match {
+			lp.Lag = leaderMatch - pr.Match
+		}
+		if since, ok := s.learnerReadySince[id]; ok {
+			lp.ReadySeconds = now.Sub(since).Seconds()
+		}
+		lps = append(lps, lp)
+	}
+	sort.Slice(lps, func(i, j int) bool { return lps[i].ID < lps[j].ID })
+	return lps
+}
+
+func learnerState(st tracker.StateType) string {
+	switch st {
+	case tracker.StateReplicate:
+		return "replicate"
+	case tracker.StateSnapshot:
+		return "snapshot"
+	default:
+		return "probe"
+	}
+}
+
+// monitorLearnerPromotion leader定期检查learner的复制进度,learner处于复制状态、最近活跃且落后不超过
+// LearnerAutoPromoteMaxLag 条日志持续 LearnerAutoPromoteAfter 后,自动提升为投票成员.
+func (s *EtcdServer) monitorLearnerPromotion() {
+	after := s.Cfg.LearnerAutoPromoteAfter
+	if after == 0 {
+		return
+	}
+	interval := after / 4
+	if interval > maxLearnerPromotionCheckInterval {
+		interval = maxLearnerPromotionCheckInterval
+	}
+	if interval < 100*time.Millisecond {
+		interval = 100 * time.Millisecond
+	}
+
+	for {
+		select {
+		case <-time.After(interval):
+		case <-s.stopping:
+			return
+		}
+
+		// 只在leader上计时,leader变更后重新计时
+		if !s.isLeader() {
+			s.learnerReadyMu.Lock()
+			s.learnerReadySince = nil
+			s.learnerReadyMu.Unlock()
+			continue
+		}
+		for _, id := range s.updateLearnerReadiness(after) {
+			s.autoPromoteLearner(id)
+		}
+	}
+}
+
+// updateLearnerReadiness 更新learner满足提升条件的起始时间,返回已经满足足够久的learner
+func (s *EtcdServer) updateLearnerReadiness(after time.Duration) []uint64 {
+	rs := s.raftStatus()
+	if rs.Progress == nil {
+		return nil
+	}
+	leaderMatch := rs.Progress[rs.ID].Match
+	now := time.Now()
+
+	s.learnerReadyMu.Lock()
+	defer s.learnerReadyMu.Unlock()
+	since := make(map[uint64]time.Time)
+	var ready []uint64
+	for id, pr := range rs.Progress {
+		if !pr.IsLearner || pr.State != tracker.StateReplicate || !pr.RecentActive {
+			continue
+		}
+		if leaderMatch > pr.Match && leaderMatch-pr.Match > s.Cfg.LearnerAutoPromoteMaxLag {
+			continue
+		}
+		t, ok := s.learnerReadySince[id]
+		if !ok {
+			t = now
+		}
+		since[id] = t
+		if now.Sub(t) >= after {
+			ready = append(ready, id)
+		}
+	}
+	// 不满足条件或已被移除的learner重新计时
+	s.learnerReadySince = since
+	return ready
+}
+
+func (s *EtcdServer) autoPromoteLearner(id uint64) {
+	lg := s.Logger()
+	ctx, cancel := context.WithTimeout(s.ctx, s.Cfg.ReqTimeout())
+	defer cancel()
+	if _, err := s.promoteLearner(ctx, id); err != nil {
+		lg.Warn("自动提升learner失败", zap.String("learner-id", types.ID(id).String()), zap.Error(err))
+		return
+	}
+	lg.Info("已自动提升learner",
+		zap.String("local-member-id", s.ID().String()),
+		zap.String("promoted-member-id", types.ID(id).String()),
+		zap.Duration("ready-for", s.Cfg.LearnerAutoPromoteAfter),
+	)
+	s.learnerReadyMu.Lock()
+	delete(s.learnerReadySince, id)
+	s.learnerReadyMu.Unlock()
+}
@@ -0,0 +1,124 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdserver
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+)
+
+// leaseWatchBufLen 每个租约watcher可以缓存的事件数,超过后watcher被移除
+const leaseWatchBufLen = 1024
+
+type leaseWatcher struct {
+	req   *pb.LeaseWatchRequest
+	evc   chan *pb.LeaseEvent
+	slowc chan struct{} // 缓存满时关闭
+}
+
+// match 判断事件是否满足watcher的过滤条件
+func (w *leaseWatcher) match(ev *pb.LeaseEvent) bool {
+	if w.req.IDPrefix != "" && !strings.HasPrefix(fmt.Sprintf("%016x", ev.ID), strings.ToLower(w.req.IDPrefix)) {
+		return false
+	}
+	if !strings.HasPrefix(ev.Metadata, w.req.MetadataPrefix) {
+		return false
+	}
+	if len(w.req.Types) == 0 {
+		return true
+	}
+	for _, t := range w.req.Types {
+		if t == ev.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// leaseEventHub 把lessor产生的租约事件分发给所有LeaseWatch
+type leaseEventHub struct {
+	mu       sync.Mutex
+	watchers map[*leaseWatcher]struct{}
+}
+
+func newLeaseEventHub() *leaseEventHub {
+	return &leaseEventHub{watchers: make(map[*leaseWatcher]struct{})}
+}
+
+// notify 由lessor在持有锁时调用,不能阻塞; 处理不过来的watcher直接移除
+func (h *leaseEventHub) notify(ev *pb.LeaseEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for w := range h.watchers {
+		if !w.match(ev) {
+			continue
+		}
+		select {
+		case w.evc <- ev:
+		default:
+			delete(h.watchers, w)
+			close(w.slowc)
+		}
+	}
+}
+
+func (h *leaseEventHub) watch(r *pb.LeaseWatchRequest) *leaseWatcher {
+	w := &leaseWatcher{
+		req:   r,
+		evc:   make(chan *pb.LeaseEvent, leaseWatchBufLen),
+		slowc: make(chan struct{}),
+	}
+	h.mu.Lock()
+	h.watchers[w] = struct{}{}
+	h.mu.Unlock()
+	return w
+}
+
+func (h *leaseEventHub) cancel(w *leaseWatcher) {
+	h.mu.Lock()
+	delete(h.watchers, w)
+	h.mu.Unlock()
+}
+
+// LeaseWatch 把本节点apply的租约事件发送给send,直到ctx结束或watcher处理过慢;
+// RENEWED事件只在处理续约的leader上产生
+func (s *EtcdServer) LeaseWatch(ctx context.Context, r *pb.LeaseWatchRequest, send func(*pb.LeaseWatchResponse) error) error {
+	w := s.leaseEvents.watch(r)
+	defer s.leaseEvents.cancel(w)
+
+	for {
+		select {
+		case ev := <-w.evc:
+			evs := []*pb.LeaseEvent{ev}
+			// 合并已经到达的事件,减少发送次数
+			for n := len(w.evc); n > 0; n-- {
+				evs = append(evs, <-w.evc)
+			}
+			if err := send(&pb.LeaseWatchResponse{Header: newHeader(s), Events: evs}); err != nil {
+				return err
+			}
+		case <-w.slowc:
+			return ErrLeaseWatcherSlow
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.stopping:
+			return ErrStopped
+		}
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdserver
+
+import (
+	"sort"
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// 可以独立设置日志等级的子系统
+const (
+	LogScopeRaft     = "raft"
+	LogScopeMvcc     = "mvcc"
+	LogScopeAuth     = "auth"
+	LogScopeRafthttp = "rafthttp"
+	LogScopeLease    = "lease"
+	LogScopeApply    = "apply"
+)
+
+// LogScopes 所有子系统的名字
+var LogScopes = []string{LogScopeRaft, LogScopeMvcc, LogScopeAuth, LogScopeRafthttp, LogScopeLease, LogScopeApply}
+
+// LogScopeLevel 子系统当前生效的日志等级;Inherited 为true时跟随全局 --log-level
+type LogScopeLevel struct {
+	Scope     string
+	Level     zapcore.Level
+	Inherited bool
+}
+
+// logScopes 保存每个子系统的日志等级,未设置的子系统跟随全局日志等级
+type logScopes struct {
+	mu     sync.RWMutex
+	levels map[string]*zapcore.Level
+	// base 用来推算全局日志等级
+	base zapcore.Core
+}
+
+func newLogScopes(base *zap.Logger) *logScopes {
+	ls := &logScopes{levels: make(map[string]*zapcore.Level, len(LogScopes)), base: base.Core()}
+	for _, scope := range LogScopes {
+		ls.levels[scope] = nil
+	}
+	return ls
+}
+
+// logger 返回属于 scope 的 logger,日志等级随 setLevel 即时生效
+func (ls *logScopes) logger(lg *zap.Logger, scope string) *zap.Logger {
+	return lg.Named(scope).WithOptions(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+		return &scopedCore{Core: c, ls: ls, scope: scope}
+	}))
+}
+
+func (ls *logScopes) level(scope string) (zapcore.Level, bool) {
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+	if l := ls.levels[scope]; l != nil {
+		return *l, true
+	}
+	return 0, false
+}
+
+// setLevels 原子地设置一组子系统的日志等级,等级为 "default" 或空时恢复跟随全局日志等级
+func (ls *logScopes) setLevels(levels map[string]string) error {
+	parsed := make(map[string]*zapcore.Level, len(levels))
+	for scope, s := range levels {
+		if _, ok := ls.levels[scope]; !ok {
+			return ErrUnknownLogScope
+		}
+		if s == "" || s == "default" {
+			parsed[scope] = nil
+			continue
+		}
+		l := new(zapcore.Level)
+		if err := l.Set(s); err != nil {
+			return ErrInvalidLogLevel
+		}
+		parsed[scope] = l
+	}
+	ls.mu.Lock()
+	for scope, l := range parsed {
+		ls.levels[scope] = l
+	}
+	ls.mu.Unlock()
+	return nil
+}
+
+func (ls *logScopes) list() []LogScopeLevel {
+	global := zapcore.FatalLevel
+	for l := zapcore.DebugLevel; l < zapcore.FatalLevel; l++ {
+		if ls.base.Enabled(l) {
+			global = l
+			break
+		}
+	}
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+	out := make([]LogScopeLevel, 0, len(ls.levels))
+	for scope, l := range ls.levels {
+		if l == nil {
+			out = append(out, LogScopeLevel{Scope: scope, Level: global, Inherited: true})
+			continue
+		}
+		out = append(out, LogScopeLevel{Scope: scope, Level: *l})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Scope < out[j].Scope })
+	return out
+}
+
+// scopedCore 按子系统的日志等级过滤;子系统没有单独设置等级时完全交给底层 core,
+// 设置得比全局等级更详细时绕过底层 core 的等级检查直接写入
+type scopedCore struct {
+	zapcore.Core
+	ls    *logScopes
+	scope string
+}
+
+func (c *scopedCore) Enabled(l zapcore.Level) bool {
+	if lvl, ok := c.ls.level(c.scope); ok {
+		return lvl.Enabled(l)
+	}
+	return c.Core.Enabled(l)
+}
+
+func (c *scopedCore) With(fields []zapcore.Field) zapcore.Core {
+	return &scopedCore{Core: c.Core.With(fields), ls: c.ls, scope: c.scope}
+}
+
+func (c *scopedCore) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	lvl, ok := c.ls.level(c.scope)
+	if !ok {
+		return c.Core.Check(e, ce)
+	}
+	if !lvl.Enabled(e.Level) {
+		return ce
+	}
+	if c.Core.Enabled(e.Level) {
+		// 保留底层 core 的采样等行为
+		return c.Core.Check(e, ce)
+	}
+	return ce.AddCore(e, c)
+}
+
+// LogLevels 返回每个子系统当前生效的日志等级
+func (s *EtcdServer) LogLevels() []LogScopeLevel {
+	return s.logScopes.list()
+}
+
+// SetLogLevels 设置子系统的日志等级,key 为子系统名,value 为日志等级或 "default";
+// 只保存在内存中,成员重启后恢复跟随全局日志等级
+func (s *EtcdServer) SetLogLevels(levels map[string]string) error {
+	if err := s.logScopes.setLevels(levels); err != nil {
+		return err
+	}
+	if len(levels) > 0 {
+		s.Logger().Info("更新子系统日志等级", zap.Any("levels", levels))
+	}
+	return nil
+}
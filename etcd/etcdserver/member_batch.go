@@ -0,0 +1,272 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdserver
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/ls-2018/etcd_cn/client_sdk/pkg/types"
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver/api/membership"
+	"github.com/ls-2018/etcd_cn/pkg/pbutil"
+	"github.com/ls-2018/etcd_cn/raft"
+	"github.com/ls-2018/etcd_cn/raft/raftpb"
+	"go.uber.org/zap"
+)
+
+// BatchChangeMembers 通过raft联合共识原子地添加、提升、移除多个成员.
+// 进入联合配置后,新旧两组投票成员都要多数同意,所以不会经过只有部分变更生效的中间配置;
+// 进入联合配置后返回;新配置的多数追上后leader自动离开联合配置,被移除的投票成员在那时才从集群中移除.
+func (s *EtcdServer) BatchChangeMembers(ctx context.Context, bc membership.BatchChangeContext) ([]*membership.Member, error) {
+	if err := s.checkMembershipOperationPermission(ctx); err != nil {
+		return nil, err
+	}
+	if err := s.mayBatchChangeMembers(&bc); err != nil {
+		return nil, err
+	}
+
+	lg := s.Logger()
+	bc.ID = s.reqIDGen.Next()
+	cc, err := bc.ConfChange()
+	if err != nil {
+		return nil, err
+	}
+	ch := s.w.Register(bc.ID)
+
+	start := time.Now()
+	if err := s.r.ProposeConfChange(ctx, cc); err != nil {
+		s.w.Trigger(bc.ID, nil)
+		return nil, err
+	}
+
+	select {
+	case x := <-ch:
+		if x == nil {
+			lg.Panic("配置失败")
+		}
+		resp := x.(*confChangeResponse)
+		lg.Info(
+			"通过raft联合共识应用批量成员变更",
+			zap.String("local-member-id", s.ID().String()),
+			zap.Int("added", len(bc.Add)),
+			zap.Int("promoted", len(bc.Promote)),
+			zap.Int("removed", len(bc.Remove)),
+		)
+		return resp.membs, resp.err
+
+	case <-ctx.Done():
+		s.w.Trigger(bc.ID, nil) // GC wait
+		return nil, s.parseProposeCtxErr(ctx.Err(), start)
+
+	case <-s.stopping:
+		return nil, ErrStopped
+	}
+}
+
+// mayBatchChangeMembers 严格配置变更检查:变更后的投票成员中,当前连通的成员必须构成多数
+func (s *EtcdServer) mayBatchChangeMembers(bc *membership.BatchChangeContext) error {
+	if err := s.cluster.ValidateBatchChange(bc); err != nil {
+		return err
+	}
+	for _, id := range bc.Promote {
+		if err := s.isLearnerReady(uint64(id)); err != nil {
+			return err
+		}
+	}
+	if !s.Cfg.StrictReconfigCheck {
+		return nil
+	}
+
+	lg := s.Logger()
+	// 进入联合配置需要旧配置的多数
+	if !isConnectedFullySince(s.r.transport, time.Now().Add(-HealthInterval), s.ID(), s.cluster.VotingMembers()) {
+		lg.Warn("拒绝批量成员变更;本地成员尚未连接到所有投票成员", zap.String("local-member-id", s.ID().String()), zap.Error(ErrUnhealthy))
+		return ErrUnhealthy
+	}
+	// 离开联合配置还需要新配置的多数,新加入的成员还没有启动
+	removed := make(map[types.ID]bool)
+	for _, id := range bc.Remove {
+		removed[id] = true
+	}
+	var incoming []*membership.Member
+	for _, m := range s.cluster.VotingMembers() {
+		if !removed[m.ID] {
+			incoming = append(incoming, m)
+		}
+	}
+	for _, id := range bc.Promote {
+		if m := s.cluster.Member(id); m != nil {
+			incoming = append(incoming, m)
+		}
+	}
+	nvoters := len(incoming)
+	for _, m := range bc.Add {
+		if !m.IsLearner {
+			nvoters++
+		}
+	}
+	if active := numConnectedSince(s.r.transport, time.Now().Add(-HealthInterval), s.ID(), incoming); active < nvoters/2+1 {
+		lg.Warn("拒绝批量成员变更;新配置中健康成员个数不足",
+			zap.String("local-member-id", s.ID().String()),
+			zap.Int("active-voters", active),
+			zap.Int("voters", nvoters),
+			zap.Error(ErrNotEnoughStartedMembers),
+		)
+		return ErrNotEnoughStartedMembers
+	}
+	return nil
+}
+
+// applyConfChangeV2 应用 EntryConfChangeV2;空的变更表示离开联合配置
+func (s *EtcdServer) applyConfChangeV2(e *raftpb.Entry, confState *raftpb.ConfState, shouldApplyV3 membership.ShouldApplyV3) bool {
+	var cc raftpb.ConfChangeV2
+	if len(e.Data) != 0 {
+		pbutil.MustUnmarshal(&cc, e.Data)
+	}
+	if cc.LeaveJoint() {
+		return s.leaveJoint(cc, confState, shouldApplyV3)
+	}
+
+	lg := s.Logger()
+	bc := new(membership.BatchChangeContext)
+	if err := json.Unmarshal([]byte(cc.Context), bc); err != nil {
+		lg.Panic("反序列化批量成员变更失败", zap.Error(err))
+	}
+	if err := s.cluster.ValidateBatchChange(bc); err != nil {
+		// 和 applyConfChange 一样,应用一个不会改变配置的变更
+		s.r.ApplyConfChange(raftpb.ConfChangeV1{Type: raftpb.ConfChangeAddNode, NodeID: raft.None})
+		s.w.Trigger(bc.ID, &confChangeResponse{s.cluster.Members(), err})
+		return false
+	}
+
+	*confState = *s.r.ApplyConfChange(cc)
+	s.beHooks.SetConfState(confState)
+	for i := range bc.Add {
+		m := &bc.Add[i]
+		s.cluster.AddMember(m, shouldApplyV3)
+		if m.ID != s.id {
+			s.r.transport.AddPeer(m.ID, m.PeerURLs)
+		}
+		s.notifyMemberChange(shouldApplyV3, m.ID, MemberAdded)
+	}
+	for _, id := range bc.Promote {
+		s.cluster.PromoteMember(id, shouldApplyV3)
+		s.notifyMemberChange(shouldApplyV3, id, MemberPromoted)
+	}
+	// learner不在旧配置中,可以立即移除;投票成员在离开联合配置前还要参与旧配置的多数
+	removedSelf := false
+	for _, id := range bc.Remove {
+		if m := s.cluster.Member(id); m != nil && m.IsLearner {
+			removedSelf = s.removeMemberFromCluster(id, shouldApplyV3) || removedSelf
+		}
+	}
+	s.w.Trigger(bc.ID, &confChangeResponse{s.cluster.Members(), nil})
+	return removedSelf
+}
+
+// leaveJoint 离开联合配置,移除不在新配置中的投票成员
+func (s *EtcdServer) leaveJoint(cc raftpb.ConfChangeV2, confState *raftpb.ConfState, shouldApplyV3 membership.ShouldApplyV3) bool {
+	outgoing := confState.VotersOutgoing
+	if len(outgoing) == 0 {
+		// raft在日志apply之前就推进了applied,leader可能重复追加离开联合配置的日志,多余的按空变更处理
+		s.r.ApplyConfChange(raftpb.ConfChangeV1{Type: raftpb.ConfChangeAddNode, NodeID: raft.None})
+		return false
+	}
+	*confState = *s.r.ApplyConfChange(cc)
+	s.beHooks.SetConfState(confState)
+
+	remain := make(map[uint64]bool)
+	for _, id := range append(append([]uint64(nil), confState.Voters...), confState.Learners...) {
+		remain[id] = true
+	}
+	removedSelf := false
+	for _, id := range outgoing {
+		if !remain[id] && s.cluster.Member(types.ID(id)) != nil {
+			removedSelf = s.removeMemberFromCluster(types.ID(id), shouldApplyV3) || removedSelf
+		}
+	}
+	return removedSelf
+}
+
+func (s *EtcdServer) removeMemberFromCluster(id types.ID, shouldApplyV3 membership.ShouldApplyV3) bool {
+	s.cluster.RemoveMember(id, shouldApplyV3)
+	s.notifyMemberChange(shouldApplyV3, id, MemberRemoved)
+	if id == s.id {
+		return true
+	}
+	s.r.transport.RemovePeer(id)
+	return false
+}
+
+// batchChangeReplayer 不经过raft时把批量变更作用到集群成员;和 applyConfChangeV2 一样,
+// 进入联合配置时只移除learner,被移除的投票成员等到离开联合配置的日志才移除
+type batchChangeReplayer struct {
+	// outgoing 已经进入联合配置、等待离开时移除的投票成员
+	outgoing []types.ID
+}
+
+// newBatchChangeReplayer 从快照的配置开始重放; 快照处于联合配置时,
+// 只在旧配置中的投票成员在之后离开联合配置时移除
+func newBatchChangeReplayer(cs raftpb.ConfState) *batchChangeReplayer {
+	remain := make(map[uint64]bool)
+	for _, id := range append(append([]uint64(nil), cs.Voters...), cs.Learners...) {
+		remain[id] = true
+	}
+	r := &batchChangeReplayer{}
+	for _, id := range cs.VotersOutgoing {
+		if !remain[id] {
+			r.outgoing = append(r.outgoing, types.ID(id))
+		}
+	}
+	return r
+}
+
+func (r *batchChangeReplayer) apply(lg *zap.Logger, cl *membership.RaftCluster, e raftpb.Entry, shouldApplyV3 membership.ShouldApplyV3) {
+	var cc raftpb.ConfChangeV2
+	if len(e.Data) != 0 {
+		pbutil.MustUnmarshal(&cc, e.Data)
+	}
+	if cc.LeaveJoint() {
+		// 重复的离开联合配置的日志没有要移除的成员
+		for _, id := range r.outgoing {
+			if cl.Member(id) != nil {
+				cl.RemoveMember(id, shouldApplyV3)
+			}
+		}
+		r.outgoing = nil
+		return
+	}
+	bc := new(membership.BatchChangeContext)
+	if err := json.Unmarshal([]byte(cc.Context), bc); err != nil {
+		lg.Panic("反序列化批量成员变更失败", zap.Error(err))
+	}
+	if err := cl.ValidateBatchChange(bc); err != nil {
+		return
+	}
+	for i := range bc.Add {
+		cl.AddMember(&bc.Add[i], shouldApplyV3)
+	}
+	for _, id := range bc.Promote {
+		cl.PromoteMember(id, shouldApplyV3)
+	}
+	for _, id := range bc.Remove {
+		if m := cl.Member(id); m != nil && m.IsLearner {
+			cl.RemoveMember(id, shouldApplyV3)
+		} else if m != nil {
+			r.outgoing = append(r.outgoing, id)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdserver
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/ls-2018/etcd_cn/client_sdk/pkg/types"
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver/api/membership"
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver/api/rafthttp"
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver/api/v2store"
+	"github.com/ls-2018/etcd_cn/pkg/pbutil"
+	"github.com/ls-2018/etcd_cn/pkg/wait"
+	"github.com/ls-2018/etcd_cn/raft"
+	"github.com/ls-2018/etcd_cn/raft/raftpb"
+	"go.uber.org/zap"
+)
+
+// fakeConfNode 用RawNode计算配置变更后的ConfState,其余方法不会被调用
+type fakeConfNode struct {
+	raft.RaftNodeInterFace
+	rn *raft.RawNode
+	// cs 最后一次变更后的配置
+	cs *raftpb.ConfState
+}
+
+func (n *fakeConfNode) ApplyConfChange(cc raftpb.ConfChangeI) *raftpb.ConfState {
+	n.cs = n.rn.ApplyConfChange(cc)
+	return n.cs
+}
+
+type fakePeerTransport struct {
+	rafthttp.Transporter
+	removed []types.ID
+}
+
+func (t *fakePeerTransport) AddPeer(id types.ID, urls []string) {}
+func (t *fakePeerTransport) RemovePeer(id types.ID)             { t.removed = append(t.removed, id) }
+
+func testMember(id uint64, learner bool) *membership.Member {
+	return &membership.Member{ID: types.ID(id), RaftAttributes: membership.RaftAttributes{
+		PeerURLs:  []string{fmt.Sprintf("http://127.0.0.1:%d", 2380+id)},
+		IsLearner: learner,
+	}}
+}
+
+// newTestCluster 创建投票成员为1、2、3,learner为4的集群
+func newTestCluster(lg *zap.Logger) *membership.RaftCluster {
+	cl := membership.NewCluster(lg)
+	cl.SetStore(v2store.New(StoreClusterPrefix, StoreKeysPrefix))
+	for id := uint64(1); id <= 4; id++ {
+		cl.AddMember(testMember(id, id == 4), membership.ApplyV2storeOnly)
+	}
+	return cl
+}
+
+// newTestBatchServer 创建本地成员为1的EtcdServer,raft配置与 newTestCluster 一致
+func newTestBatchServer(t *testing.T) (*EtcdServer, *fakePeerTransport) {
+	lg := zap.NewNop()
+	ms := raft.NewMemoryStorage()
+	if err := ms.ApplySnapshot(raftpb.Snapshot{Metadata: raftpb.SnapshotMetadata{
+		Index: 1, Term: 1, ConfState: raftpb.ConfState{Voters: []uint64{1, 2, 3}, Learners: []uint64{4}},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	rn, err := raft.NewRawNode(&raft.Config{ID: 1, ElectionTick: 10, HeartbeatTick: 1, Storage: ms, MaxInflightMsgs: 256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := &fakePeerTransport{}
+	s := &EtcdServer{
+		lgMu:    new(sync.RWMutex),
+		lg:      lg,
+		id:      1,
+		cluster: newTestCluster(lg),
+		w:       wait.New(),
+		beHooks: &backendHooks{lg: lg},
+		r: raftNode{raftNodeConfig: raftNodeConfig{
+			lg:                lg,
+			RaftNodeInterFace: &fakeConfNode{rn: rn},
+			transport:         tr,
+		}},
+	}
+	return s, tr
+}
+
+func batchChangeEntry(t *testing.T, index uint64, bc membership.BatchChangeContext) raftpb.Entry {
+	cc, err := bc.ConfChange()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raftpb.Entry{Type: raftpb.EntryConfChangeV2, Index: index, Term: 1, Data: pbutil.MustMarshal(&cc)}
+}
+
+// leaveJointEntry raft离开联合配置时追加的空变更
+func leaveJointEntry(index uint64) raftpb.Entry {
+	return raftpb.Entry{Type: raftpb.EntryConfChangeV2, Index: index, Term: 1}
+}
+
+func memberIDs(cl *membership.RaftCluster) []uint64 {
+	var ids []uint64
+	for _, m := range cl.Members() {
+		ids = append(ids, uint64(m.ID))
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// TestApplyConfChangeV2ValidationFailure apply时校验失败的批量变更不改变配置,并把错误返回给调用者
+func TestApplyConfChangeV2ValidationFailure(t *testing.T) {
+	s, _ := newTestBatchServer(t)
+	bc := membership.BatchChangeContext{ID: 100, Remove: []types.ID{9}}
+	e := batchChangeEntry(t, 2, bc)
+	ch := s.w.Register(bc.ID)
+
+	cs := raftpb.ConfState{Voters: []uint64{1, 2, 3}, Learners: []uint64{4}}
+	if s.applyConfChangeV2(&e, &cs, membership.ApplyV2storeOnly) {
+		t.Fatal("removedSelf = true, want false")
+	}
+	resp := (<-ch).(*confChangeResponse)
+	if resp.err != membership.ErrIDNotFound {
+		t.Fatalf("err = %v, want %v", resp.err, membership.ErrIDNotFound)
+	}
+	if got := memberIDs(s.cluster); !reflect.DeepEqual(got, []uint64{1, 2, 3, 4}) {
+		t.Fatalf("members = %v, want [1 2 3 4]", got)
+	}
+	// raft应用的是不改变配置的空变更
+	if got := s.r.RaftNodeInterFace.(*fakeConfNode).cs; len(got.VotersOutgoing) != 0 || !reflect.DeepEqual(got.Voters, []uint64{1, 2, 3}) {
+		t.Fatalf("conf state = %+v, want voters [1 2 3]", got)
+	}
+}
+
+// TestApplyConfChangeV2RemovesVoterAtLeaveJoint learner在进入联合配置时移除,投票成员在离开联合配置时才移除
+func TestApplyConfChangeV2RemovesVoterAtLeaveJoint(t *testing.T) {
+	s, tr := newTestBatchServer(t)
+	bc := membership.BatchChangeContext{ID: 100, Remove: []types.ID{3, 4}}
+	e := batchChangeEntry(t, 2, bc)
+	ch := s.w.Register(bc.ID)
+
+	var cs raftpb.ConfState
+	s.applyConfChangeV2(&e, &cs, membership.ApplyV2storeOnly)
+	if resp := (<-ch).(*confChangeResponse); resp.err != nil {
+		t.Fatal(resp.err)
+	}
+	if !reflect.DeepEqual(cs.VotersOutgoing, []uint64{1, 2, 3}) {
+		t.Fatalf("outgoing voters = %v, want [1 2 3]", cs.VotersOutgoing)
+	}
+	if got := memberIDs(s.cluster); !reflect.DeepEqual(got, []uint64{1, 2, 3}) {
+		t.Fatalf("members in joint config = %v, want [1 2 3]", got)
+	}
+
+	leave := leaveJointEntry(3)
+	s.applyConfChangeV2(&leave, &cs, membership.ApplyV2storeOnly)
+	if len(cs.VotersOutgoing) != 0 || !reflect.DeepEqual(cs.Voters, []uint64{1, 2}) {
+		t.Fatalf("conf state after leaving = %+v, want voters [1 2]", cs)
+	}
+	if got := memberIDs(s.cluster); !reflect.DeepEqual(got, []uint64{1, 2}) {
+		t.Fatalf("members after leaving = %v, want [1 2]", got)
+	}
+	if !reflect.DeepEqual(tr.removed, []types.ID{4, 3}) {
+		t.Fatalf("removed peers = %v, want [4 3]", tr.removed)
+	}
+}
+
+// TestLeaveJointDuplicate 重复的离开联合配置日志按空变更处理
+func TestLeaveJointDuplicate(t *testing.T) {
+	s, tr := newTestBatchServer(t)
+	cs := raftpb.ConfState{Voters: []uint64{1, 2, 3}, Learners: []uint64{4}}
+	leave := leaveJointEntry(2)
+	if s.applyConfChangeV2(&leave, &cs, membership.ApplyV2storeOnly) {
+		t.Fatal("removedSelf = true, want false")
+	}
+	if !reflect.DeepEqual(cs.Voters, []uint64{1, 2, 3}) || !reflect.DeepEqual(cs.Learners, []uint64{4}) {
+		t.Fatalf("conf state = %+v, want it unchanged", cs)
+	}
+	if got := memberIDs(s.cluster); !reflect.DeepEqual(got, []uint64{1, 2, 3, 4}) {
+		t.Fatalf("members = %v, want [1 2 3 4]", got)
+	}
+	if len(tr.removed) != 0 {
+		t.Fatalf("removed peers = %v, want none", tr.removed)
+	}
+}
+
+// TestGetIDsConfChangeV2 批量变更的添加和移除都计入,离开联合配置的空日志跳过
+func TestGetIDsConfChangeV2(t *testing.T) {
+	snap := &raftpb.Snapshot{Metadata: raftpb.SnapshotMetadata{ConfState: raftpb.ConfState{Voters: []uint64{1, 2, 3}}}}
+	ents := []raftpb.Entry{
+		batchChangeEntry(t, 2, membership.BatchChangeContext{
+			Add:    []membership.Member{*testMember(5, false), *testMember(6, true)},
+			Remove: []types.ID{3},
+		}),
+		leaveJointEntry(3),
+	}
+	if got := getIDs(zap.NewNop(), snap, ents); !reflect.DeepEqual(got, []uint64{1, 2, 5, 6}) {
+		t.Fatalf("ids = %v, want [1 2 5 6]", got)
+	}
+}
+
+// TestReplayerBatchChange 重放与apply一样,投票成员在离开联合配置时才移除
+func TestReplayerBatchChange(t *testing.T) {
+	r, err := NewReplayer(zap.NewNop(), filepath.Join(t.TempDir(), "db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	for id := uint64(1); id <= 4; id++ {
+		r.s.cluster.AddMember(testMember(id, id == 4), membership.ApplyBoth)
+	}
+
+	r.Apply(batchChangeEntry(t, 1, membership.BatchChangeContext{
+		Add:    []membership.Member{*testMember(5, false)},
+		Remove: []types.ID{3, 4},
+	}))
+	if got := memberIDs(r.s.cluster); !reflect.DeepEqual(got, []uint64{1, 2, 3, 5}) {
+		t.Fatalf("members in joint config = %v, want [1 2 3 5]", got)
+	}
+	r.Apply(leaveJointEntry(2))
+	if got := memberIDs(r.s.cluster); !reflect.DeepEqual(got, []uint64{1, 2, 5}) {
+		t.Fatalf("members after leaving = %v, want [1 2 5]", got)
+	}
+	// 重复的离开联合配置日志不再移除成员
+	r.Apply(leaveJointEntry(3))
+	if got := memberIDs(r.s.cluster); !reflect.DeepEqual(got, []uint64{1, 2, 5}) {
+		t.Fatalf("members after duplicate leave = %v, want [1 2 5]", got)
+	}
+}
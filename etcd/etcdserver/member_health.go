@@ -0,0 +1,253 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/ls-2018/etcd_cn/client_sdk/pkg/types"
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver/api/membership"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+	"go.uber.org/zap"
+)
+
+const (
+	memberEventUnreachable = "member-unreachable"
+	memberEventRecovered   = "member-recovered"
+	memberEventReplaced    = "member-replaced"
+
+	maxMemberHealthCheckInterval = 5 * time.Second
+)
+
+// MemberEvent 成员不可达相关事件,以JSON格式POST到webhook
+type MemberEvent struct {
+	Event            string            `json:"event"`
+	ClusterID        string            `json:"cluster-id"`
+	LeaderID         string            `json:"leader-id"`
+	MemberID         string            `json:"member-id"`
+	Name             string            `json:"name,omitempty"`
+	PeerURLs         []string          `json:"peer-urls,omitempty"`
+	Labels           map[string]string `json:"labels,omitempty"`
+	UnreachableSince time.Time         `json:"unreachable-since,omitempty"`
+	ReplacedBy       string            `json:"replaced-by,omitempty"`
+}
+
+// monitorMemberHealth leader定期检查其他成员的连通性,持续不可达超过阈值的成员会触发 UNREACHABLE 警报,
+// 恢复或被移除后解除警报;开启自动替换时,替换learner追上leader后会移除不可达成员并提升该learner.
+func (s *EtcdServer) monitorMemberHealth() {
+	threshold := s.Cfg.MemberUnreachableThreshold
+	if threshold == 0 {
+		return
+	}
+	interval := threshold / 4
+	if interval > maxMemberHealthCheckInterval {
+		interval = maxMemberHealthCheckInterval
+	}
+	if interval < 100*time.Millisecond {
+		interval = 100 * time.Millisecond
+	}
+
+	// 只在leader上记录,leader变更后重新计时
+	unreachableSince := make(map[types.ID]time.Time)
+	for {
+		select {
+		case <-time.After(interval):
+		case <-s.stopping:
+			return
+		}
+
+		if !s.isLeader() {
+			unreachableSince = make(map[types.ID]time.Time)
+			continue
+		}
+		s.checkMemberHealth(unreachableSince, threshold)
+	}
+}
+
+func (s *EtcdServer) checkMemberHealth(unreachableSince map[types.ID]time.Time, threshold time.Duration) {
+	lg := s.Logger()
+	now := time.Now()
+
+	members := make(map[types.ID]*membership.Member)
+	for _, m := range s.cluster.Members() {
+		members[m.ID] = m
+		// 从未启动过的成员不认为是丢失的
+		if m.ID == s.ID() || !m.IsStarted() {
+			continue
+		}
+		if !s.r.transport.ActiveSince(m.ID).IsZero() {
+			delete(unreachableSince, m.ID)
+			continue
+		}
+		if _, ok := unreachableSince[m.ID]; !ok {
+			unreachableSince[m.ID] = now
+		}
+	}
+	for id := range unreachableSince {
+		if _, ok := members[id]; !ok {
+			delete(unreachableSince, id)
+		}
+	}
+
+	alarmed := make(map[types.ID]bool)
+	for _, a := range s.alarmStore.Get(pb.AlarmType_UNREACHABLE) {
+		alarmed[types.ID(a.MemberID)] = true
+	}
+
+	for id, since := range unreachableSince {
+		if now.Sub(since) < threshold {
+			continue
+		}
+		m := members[id]
+		if !alarmed[id] {
+			lg.Warn("成员持续不可达,发出警报",
+				zap.String("local-member-id", s.ID().String()),
+				zap.String("unreachable-member-id", id.String()),
+				zap.Time("unreachable-since", since),
+				zap.Duration("threshold", threshold),
+			)
+			s.setUnreachableAlarm(id, pb.AlarmRequest_ACTIVATE)
+			s.notifyMemberEvent(memberEventUnreachable, m, since, "")
+		}
+		if s.Cfg.MemberAutoReplace {
+			if s.tryReplaceMember(m) {
+				delete(unreachableSince, id)
+			}
+		}
+	}
+
+	for id := range alarmed {
+		if _, ok := unreachableSince[id]; ok {
+			continue
+		}
+		// 成员恢复或已被移除
+		s.setUnreachableAlarm(id, pb.AlarmRequest_DEACTIVATE)
+		if m, ok := members[id]; ok {
+			lg.Info("不可达成员已恢复", zap.String("local-member-id", s.ID().String()), zap.String("recovered-member-id", id.String()))
+			s.notifyMemberEvent(memberEventRecovered, m, time.Time{}, "")
+		}
+	}
+}
+
+func (s *EtcdServer) setUnreachableAlarm(id types.ID, action pb.AlarmRequest_AlarmAction) {
+	if action == pb.AlarmRequest_ACTIVATE && s.DowngradeFeatureBlocked(FeatureMemberAlarms) {
+		return
+	}
+	a := &pb.AlarmRequest{
+		MemberID: uint64(id),
+		Action:   action,
+		Alarm:    pb.AlarmType_UNREACHABLE,
+	}
+	s.GoAttach(func() {
+		ctx, cancel := context.WithTimeout(s.ctx, s.Cfg.ReqTimeout())
+		defer cancel()
+		if _, err := s.raftRequest(ctx, pb.InternalRaftRequest{Alarm: a}); err != nil {
+			s.Logger().Warn("更新成员不可达警报失败", zap.String("member-id", id.String()), zap.Error(err))
+		}
+	})
+}
+
+// replacementLearner 返回带有 replaces 标签指向m的learner
+func (s *EtcdServer) replacementLearner(m *membership.Member) *membership.Member {
+	for _, l := range s.cluster.MembersWithLabel(membership.LabelReplaces, "") {
+		if !l.IsLearner {
+			continue
+		}
+		if v, _ := l.Label(membership.LabelReplaces); v == m.ID.String() || (m.Name != "" && v == m.Name) {
+			return l
+		}
+	}
+	return nil
+}
+
+// tryReplaceMember 替换learner已经追上leader时,移除不可达成员并提升learner
+func (s *EtcdServer) tryReplaceMember(m *membership.Member) bool {
+	lg := s.Logger()
+	learner := s.replacementLearner(m)
+	if learner == nil {
+		return false
+	}
+	// learner必须在线且在leader的进度中
+	if s.r.transport.ActiveSince(learner.ID).IsZero() {
+		return false
+	}
+	if _, ok := s.raftStatus().Progress[uint64(learner.ID)]; !ok {
+		return false
+	}
+	if err := s.isLearnerReady(uint64(learner.ID)); err != nil {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, s.Cfg.ReqTimeout())
+	defer cancel()
+	if _, err := s.removeMember(ctx, uint64(m.ID)); err != nil {
+		lg.Warn("自动移除不可达成员失败", zap.String("member-id", m.ID.String()), zap.Error(err))
+		return false
+	}
+	lg.Warn("已自动移除不可达成员", zap.String("removed-member-id", m.ID.String()), zap.String("replacement-learner-id", learner.ID.String()))
+	s.notifyMemberEvent(memberEventReplaced, m, time.Time{}, learner.ID.String())
+
+	if _, err := s.promoteLearner(ctx, uint64(learner.ID)); err != nil {
+		lg.Warn("提升替换learner失败", zap.String("learner-id", learner.ID.String()), zap.Error(err))
+	}
+	return true
+}
+
+// notifyMemberEvent 异步通知webhook,失败只记录日志
+func (s *EtcdServer) notifyMemberEvent(event string, m *membership.Member, since time.Time, replacedBy string) {
+	url := s.Cfg.MemberUnreachableWebhookURL
+	if url == "" || m == nil {
+		return
+	}
+	ev := MemberEvent{
+		Event:            event,
+		ClusterID:        s.cluster.ID().String(),
+		LeaderID:         s.ID().String(),
+		MemberID:         m.ID.String(),
+		Name:             m.Name,
+		PeerURLs:         m.PeerURLs,
+		Labels:           m.Labels,
+		UnreachableSince: since,
+		ReplacedBy:       replacedBy,
+	}
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	s.GoAttach(func() {
+		lg := s.Logger()
+		ctx, cancel := context.WithTimeout(s.ctx, s.Cfg.ReqTimeout())
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+		if err != nil {
+			lg.Warn("创建webhook请求失败", zap.String("url", url), zap.Error(err))
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			lg.Warn("通知webhook失败", zap.String("url", url), zap.String("event", event), zap.Error(err))
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			lg.Warn("webhook返回非2xx状态", zap.String("url", url), zap.String("event", event), zap.Int("status", resp.StatusCode))
+		}
+	})
+}
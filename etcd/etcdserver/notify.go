@@ -0,0 +1,282 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdserver
+
+import (
+	"context"
+	"encoding/binary"
+	"time"
+
+	"github.com/ls-2018/etcd_cn/etcd/mvcc"
+	"github.com/ls-2018/etcd_cn/etcd/mvcc/buckets"
+	"github.com/ls-2018/etcd_cn/offical/api/v3/mvccpb"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+	"github.com/ls-2018/etcd_cn/pkg/notify"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// 通知sink: leader通过内部watch读取已apply的变更,按修订版本顺序投递到外部sink,投递成功后才推进游标.
+// 游标通过raft记录在 notify bucket 中,leader变更后新leader从游标继续投递,因此同一批变更可能被投递多次.
+
+const (
+	// notifyCursorSaveInterval 游标最多每隔这么久通过raft保存一次,避免每次投递都产生一次提案
+	notifyCursorSaveInterval = time.Second
+	// notifyLeaderCheckInterval 非leader检查自己是否成为leader的间隔
+	notifyLeaderCheckInterval = time.Second
+
+	notifyRetryMin = 100 * time.Millisecond
+	notifyRetryMax = 30 * time.Second
+)
+
+var (
+	notifyDeliveredEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "etcd",
+		Subsystem: "server",
+		Name:      "notify_delivered_events_total",
+		Help:      "The total number of events delivered to a notification sink.",
+	}, []string{"sink"})
+	notifyDeliveryFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "etcd",
+		Subsystem: "server",
+		Name:      "notify_delivery_failures_total",
+		Help:      "The total number of failed delivery attempts to a notification sink.",
+	}, []string{"sink"})
+	notifyCompacted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "etcd",
+		Subsystem: "server",
+		Name:      "notify_compacted_total",
+		Help:      "The total number of times undelivered changes of a notification sink were compacted away.",
+	}, []string{"sink"})
+	notifyCursorRevision = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "etcd",
+		Subsystem: "server",
+		Name:      "notify_cursor_revision",
+		Help:      "The last revision delivered to a notification sink.",
+	}, []string{"sink"})
+)
+
+func init() {
+	prometheus.MustRegister(notifyDeliveredEvents)
+	prometheus.MustRegister(notifyDeliveryFailures)
+	prometheus.MustRegister(notifyCompacted)
+	prometheus.MustRegister(notifyCursorRevision)
+}
+
+// monitorNotify 为每个配置的sink启动投递协程,只有leader投递
+func (s *EtcdServer) monitorNotify() {
+	if len(s.Cfg.NotifySinks) == 0 {
+		return
+	}
+	select {
+	case <-s.ReadyNotify():
+	case <-s.stopping:
+		return
+	}
+	for _, cfg := range s.Cfg.NotifySinks {
+		cfg := cfg
+		s.GoAttach(func() { s.runNotifySink(cfg) })
+	}
+}
+
+func (s *EtcdServer) runNotifySink(cfg notify.SinkConfig) {
+	lg := s.Logger().With(zap.String("sink", cfg.Name))
+	sink, err := notify.New(cfg)
+	if err != nil {
+		lg.Warn("创建通知sink失败", zap.Error(err))
+		return
+	}
+	defer sink.Close()
+	for {
+		if s.isLeader() {
+			s.deliverNotify(lg, cfg, sink)
+		}
+		select {
+		case <-time.After(notifyLeaderCheckInterval):
+		case <-s.stopping:
+			return
+		}
+	}
+}
+
+// deliverNotify 从游标开始投递,直到不再是leader、停止或者需要重新开始
+func (s *EtcdServer) deliverNotify(lg *zap.Logger, cfg notify.SinkConfig, sink notify.Sink) {
+	term := s.Term()
+	leaderChanged := s.LeaderChangedNotify()
+	cursor := s.NotifyCursor(cfg.Name)
+	if cursor == 0 {
+		// 新的sink只投递此后的变更
+		cursor = s.KV().Rev()
+		if err := s.saveNotifyCursor(cfg.Name, cursor); err != nil {
+			lg.Warn("保存通知游标失败", zap.Error(err))
+			return
+		}
+	}
+	saved := cursor
+	notifyCursorRevision.WithLabelValues(cfg.Name).Set(float64(cursor))
+
+	ws := s.KV().NewWatchStream()
+	defer ws.Close()
+	key, end := notifyRange(cfg.Prefix)
+	if _, err := ws.Watch(mvcc.AutoWatchID, key, end, cursor+1); err != nil {
+		lg.Warn("监听通知前缀失败", zap.String("prefix", cfg.Prefix), zap.Error(err))
+		return
+	}
+	lg.Info("开始投递通知", zap.String("prefix", cfg.Prefix), zap.Int64("cursor", cursor))
+
+	ticker := time.NewTicker(notifyCursorSaveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case resp, ok := <-ws.Chan():
+			if !ok {
+				return
+			}
+			if resp.CompactRevision != 0 {
+				lg.Warn("未投递的变更已被压缩,从压缩后的修订版本继续投递",
+					zap.Int64("cursor", cursor), zap.Int64("compact-revision", resp.CompactRevision))
+				notifyCompacted.WithLabelValues(cfg.Name).Inc()
+				if err := s.saveNotifyCursor(cfg.Name, resp.CompactRevision-1); err != nil {
+					lg.Warn("保存通知游标失败", zap.Error(err))
+				}
+				return
+			}
+			if len(resp.Events) == 0 {
+				continue
+			}
+			b := newNotifyBatch(cfg, resp.Events)
+			if !s.sendNotifyBatch(lg, sink, b, term) {
+				return
+			}
+			notifyDeliveredEvents.WithLabelValues(cfg.Name).Add(float64(len(b.Events)))
+			cursor = b.Revision
+			notifyCursorRevision.WithLabelValues(cfg.Name).Set(float64(cursor))
+		case <-ticker.C:
+			if cursor == saved {
+				continue
+			}
+			if err := s.saveNotifyCursor(cfg.Name, cursor); err != nil {
+				lg.Warn("保存通知游标失败", zap.Int64("cursor", cursor), zap.Error(err))
+				continue
+			}
+			saved = cursor
+		case <-leaderChanged:
+			return
+		case <-s.stopping:
+			return
+		}
+	}
+}
+
+// sendNotifyBatch 重试投递直到成功;不再是同一任期的leader或停止时返回false
+func (s *EtcdServer) sendNotifyBatch(lg *zap.Logger, sink notify.Sink, b notify.Batch, term uint64) bool {
+	wait := notifyRetryMin
+	for {
+		ctx, cancel := context.WithTimeout(s.ctx, s.notifySinkTimeout(b.Sink))
+		err := sink.Send(ctx, b)
+		cancel()
+		if err == nil {
+			return true
+		}
+		notifyDeliveryFailures.WithLabelValues(b.Sink).Inc()
+		lg.Warn("投递通知失败", zap.Int64("revision", b.Revision), zap.Duration("retry-after", wait), zap.Error(err))
+		select {
+		case <-time.After(wait):
+		case <-s.stopping:
+			return false
+		}
+		if !s.isLeader() || s.Term() != term {
+			return false
+		}
+		if wait *= 2; wait > notifyRetryMax {
+			wait = notifyRetryMax
+		}
+	}
+}
+
+func (s *EtcdServer) notifySinkTimeout(name string) time.Duration {
+	for _, c := range s.Cfg.NotifySinks {
+		if c.Name == name {
+			return c.DeliveryTimeout()
+		}
+	}
+	return notify.DefaultTimeout
+}
+
+// notifyRange 返回前缀对应的watch范围;空的结束键(非nil)表示大于等于key的所有键
+func notifyRange(prefix string) (key, end []byte) {
+	if prefix == "" {
+		return []byte{0}, []byte{}
+	}
+	end = []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return []byte(prefix), end[:i+1]
+		}
+	}
+	return []byte(prefix), []byte{}
+}
+
+func newNotifyBatch(cfg notify.SinkConfig, evs []mvccpb.Event) notify.Batch {
+	b := notify.Batch{Sink: cfg.Name, Prefix: cfg.Prefix, Events: make([]notify.Event, 0, len(evs))}
+	for _, ev := range evs {
+		e := notify.Event{Type: ev.Type.String(), Key: ev.Kv.Key, ModRevision: ev.Kv.ModRevision}
+		if ev.Type == mvccpb.PUT {
+			e.Value = ev.Kv.Value
+			e.CreateRevision = ev.Kv.CreateRevision
+			e.Version = ev.Kv.Version
+			e.Lease = ev.Kv.Lease
+		}
+		b.Events = append(b.Events, e)
+		b.Revision = ev.Kv.ModRevision
+	}
+	return b
+}
+
+// NotifyCursor 返回sink已投递到的修订版本,0表示还没有投递过
+func (s *EtcdServer) NotifyCursor(name string) int64 {
+	tx := s.backend.BatchTx()
+	tx.Lock()
+	defer tx.Unlock()
+	tx.UnsafeCreateBucket(buckets.Notify)
+	_, vs := tx.UnsafeRange(buckets.Notify, []byte(name), nil, 0)
+	if len(vs) == 0 || len(vs[0]) != 8 {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(vs[0]))
+}
+
+func (s *EtcdServer) saveNotifyCursor(name string, rev int64) error {
+	if s.DowngradeFeatureBlocked(FeatureNotifyCursor) {
+		return ErrDowngradeFeatureBlocked
+	}
+	ctx, cancel := context.WithTimeout(s.ctx, s.Cfg.ReqTimeout())
+	defer cancel()
+	_, err := s.raftRequest(ctx, pb.InternalRaftRequest{NotifyCursor: &pb.InternalNotifyCursorRequest{Sink: name, Revision: rev}})
+	return err
+}
+
+// applyNotifyCursor 记录sink的游标;旧leader的请求可能晚于新leader的提交,游标回退只会导致重复投递
+func (s *EtcdServer) applyNotifyCursor(r *pb.InternalNotifyCursorRequest) (*pb.EmptyResponse, error) {
+	v := make([]byte, 8)
+	binary.BigEndian.PutUint64(v, uint64(r.Revision))
+	tx := s.backend.BatchTx()
+	tx.Lock()
+	defer tx.Unlock()
+	tx.UnsafeCreateBucket(buckets.Notify)
+	tx.UnsafePut(buckets.Notify, []byte(r.Sink), v)
+	return &pb.EmptyResponse{}, nil
+}
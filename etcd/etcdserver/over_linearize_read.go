@@ -6,6 +6,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/ls-2018/etcd_cn/pkg/traceutil"
@@ -14,8 +15,9 @@ import (
 )
 
 type notifier struct {
-	c   chan struct{}
-	err error
+	c       chan struct{}
+	err     error
+	waiters int64 // 等待该通知的读请求数
 }
 
 // 通知
@@ -45,6 +47,16 @@ func (s *EtcdServer) linearizableReadLoop() {
 			return
 		}
 
+		window := s.readBatch.window(s.Cfg.ReadIndexBatchWindow, s.Cfg.ReadIndexAdaptiveBatching)
+		readIndexBatchWindow.Set(window.Seconds())
+		if window > 0 {
+			select {
+			case <-time.After(window):
+			case <-s.stopping:
+				return
+			}
+		}
+
 		// 因为一个循环可以解锁多个读数所以从Txn或Range传播追踪不是很有用.
 		trace := traceutil.New("linearizableReadLoop", s.Logger())
 
@@ -52,10 +64,12 @@ func (s *EtcdServer) linearizableReadLoop() {
 		nr := s.readNotifier
 		s.readNotifier = newNotifier()
 		s.readMu.Unlock()
+		readIndexBatchSize.Observe(float64(atomic.LoadInt64(&nr.waiters)))
 		// 处理不同的消息
 		// 这里会监听 readwaitc,发送MsgReadIndex 并等待 MsgReadIndexRsp
 		// 同时获取当前已提交的日志索引
 		// 串行执行的
+		start := time.Now()
 		confirmedIndex, err := s.requestCurrentIndex(leaderChangedNotifier, requestId) // MsgReadIndex 携带requestId经过raft走一圈
 		if isStopped(err) {
 			return
@@ -64,6 +78,7 @@ func (s *EtcdServer) linearizableReadLoop() {
 			nr.notify(err)
 			continue
 		}
+		readIndexDuration.Observe(time.Since(start).Seconds())
 
 		trace.Step("收到要读的索引")
 		trace.AddField(traceutil.Field{Key: "readStateIndex", Value: confirmedIndex})
@@ -170,7 +185,9 @@ func (s *EtcdServer) sendReadIndex(requestIndex uint64) error {
 func (s *EtcdServer) linearizeReadNotify(ctx context.Context) error {
 	s.readMu.RLock()
 	nc := s.readNotifier
+	atomic.AddInt64(&nc.waiters, 1)
 	s.readMu.RUnlock()
+	s.readBatch.arrive()
 
 	select {
 	case s.readwaitc <- struct{}{}: // linearizableReadLoop就会开始结束阻塞开始工作
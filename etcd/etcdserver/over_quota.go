@@ -16,6 +16,7 @@ package etcdserver
 
 import (
 	"sync"
+	"sync/atomic"
 
 	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
 
@@ -103,9 +104,17 @@ func NewBackendQuota(s *EtcdServer, name string) Quota {
 	return &backendQuota{s, s.Cfg.QuotaBackendBytes}
 }
 
+// limit 运行时修改过配额时以修改后的为准
+func (b *backendQuota) limit() int64 {
+	if n := atomic.LoadInt64(&b.s.quotaBackendBytes); n > 0 {
+		return n
+	}
+	return b.maxBackendBytes
+}
+
 // Available 粗略计算是否可以存储
 func (b *backendQuota) Available(v interface{}) bool {
-	return b.s.Backend().Size()+int64(b.Cost(v)) < b.maxBackendBytes
+	return b.s.Backend().Size()+int64(b.Cost(v)) < b.limit()
 }
 
 // Cost 操作的开销
@@ -115,6 +124,9 @@ func (b *backendQuota) Cost(v interface{}) int {
 		return costPut(r)
 	case *pb.TxnRequest:
 		return costTxn(r)
+	case *pb.StagedTxnRequest:
+		// 暂存的操作提交时才写入键值存储,这里只计算暂存本身
+		return costTxn(&pb.TxnRequest{Success: r.Success, Failure: r.Failure})
 	case *pb.LeaseGrantRequest:
 		return leaseOverhead
 	default:
@@ -148,5 +160,5 @@ func costTxn(r *pb.TxnRequest) int {
 }
 
 func (b *backendQuota) Remaining() int64 {
-	return b.maxBackendBytes - b.s.Backend().Size()
+	return b.limit() - b.s.Backend().Size()
 }
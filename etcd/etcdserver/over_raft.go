@@ -43,6 +43,9 @@ import (
 const (
 	maxSizePerMsg   = 1 * 1024 * 1024 // 1M
 	maxInflightMsgs = 4096 / 8        // 512
+
+	// maxInflightStorageWrites 异步写模式下最多有多少个Ready等待落盘,写满后raft循环阻塞
+	maxInflightStorageWrites = 64
 )
 
 var (
@@ -85,6 +88,16 @@ type raftNodeConfig struct {
 	raftStorage *raft.MemoryStorage
 	storage     Storage
 	heartbeat   time.Duration // for logging
+	// manualTicks 为 true 时不启动 ticker,只能通过 advanceTicks 推进 raft 时钟
+	manualTicks bool
+	// admission 记录写WAL的耗时,供准入控制判断磁盘是否过载
+	admission *admission
+	// latency 记录写WAL的耗时
+	latency *latencyTracker
+	// faults 注入的故障,FSYNC_DELAY 推迟写WAL
+	faults *faultInjector
+	// asyncWrites 由单独的协程按顺序写WAL,写完后通过AdvanceStorage确认,raft不等待落盘
+	asyncWrites bool
 	// transport specifies the transport to send and receive msgs to members.
 	// Sending messages MUST NOT block. It is okay to drop messages, since
 	// clients should timeout and reissue their messages.
@@ -118,7 +131,7 @@ func newRaftNode(cfg raftNodeConfig) *raftNode {
 		stopped:    make(chan struct{}),
 		done:       make(chan struct{}),
 	}
-	if r.heartbeat == 0 {
+	if r.heartbeat == 0 || r.manualTicks {
 		r.ticker = &time.Ticker{}
 	} else {
 		r.ticker = time.NewTicker(r.heartbeat)
@@ -141,7 +154,7 @@ type raftNode struct {
 }
 
 // 启动节点
-func startNode(cfg config.ServerConfig, cl *membership.RaftCluster, ids []types.ID) (id types.ID, n raft.RaftNodeInterFace, s *raft.MemoryStorage, w *wal.WAL) {
+func startNode(cfg config.ServerConfig, cl *membership.RaftCluster, ids []types.ID, campaignDisabled func() bool, raftLg *zap.Logger) (id types.ID, n raft.RaftNodeInterFace, s *raft.MemoryStorage, w *wal.WAL) {
 	var err error
 	member := cl.MemberByName(cfg.Name)
 	metadata := pbutil.MustMarshal(
@@ -181,7 +194,10 @@ func startNode(cfg config.ServerConfig, cl *membership.RaftCluster, ids []types.
 		MaxInflightMsgs: maxInflightMsgs,   // 512
 		CheckQuorum:     true,              // 检查是否是leader
 		PreVote:         cfg.PreVote,       // true      // 是否启用PreVote扩展,建议开启
-		Logger:          NewRaftLoggerZap(cfg.Logger.Named("raft")),
+		Logger:          NewRaftLoggerZap(raftLg),
+
+		CampaignDisabled:   campaignDisabled, // 只读维护模式下不参与竞选
+		AsyncStorageWrites: cfg.ExperimentalAsyncStorageWrites,
 	}
 
 	_ = membership.NewClusterFromURLsMap
@@ -197,7 +213,7 @@ func startNode(cfg config.ServerConfig, cl *membership.RaftCluster, ids []types.
 	return id, n, s, w
 }
 
-func restartNode(cfg config.ServerConfig, snapshot *raftpb.Snapshot) (types.ID, *membership.RaftCluster, raft.RaftNodeInterFace, *raft.MemoryStorage, *wal.WAL) {
+func restartNode(cfg config.ServerConfig, snapshot *raftpb.Snapshot, campaignDisabled func() bool, raftLg *zap.Logger) (types.ID, *membership.RaftCluster, raft.RaftNodeInterFace, *raft.MemoryStorage, *wal.WAL) {
 	var walsnap walpb.Snapshot
 	if snapshot != nil {
 		walsnap.Index, walsnap.Term = snapshot.Metadata.Index, snapshot.Metadata.Term
@@ -227,7 +243,10 @@ func restartNode(cfg config.ServerConfig, snapshot *raftpb.Snapshot) (types.ID,
 		MaxInflightMsgs: maxInflightMsgs,
 		CheckQuorum:     true,
 		PreVote:         cfg.PreVote, // PreVote 是否启用PreVote
-		Logger:          NewRaftLoggerZap(cfg.Logger.Named("raft")),
+		Logger:          NewRaftLoggerZap(raftLg),
+
+		CampaignDisabled:   campaignDisabled, // 只读维护模式下不参与竞选
+		AsyncStorageWrites: cfg.ExperimentalAsyncStorageWrites,
 	}
 
 	n := raft.RestartNode(c)
@@ -237,7 +256,7 @@ func restartNode(cfg config.ServerConfig, snapshot *raftpb.Snapshot) (types.ID,
 	return id, cl, n, s, w
 }
 
-func restartAsStandaloneNode(cfg config.ServerConfig, snapshot *raftpb.Snapshot) (types.ID, *membership.RaftCluster, raft.RaftNodeInterFace, *raft.MemoryStorage, *wal.WAL) {
+func restartAsStandaloneNode(cfg config.ServerConfig, snapshot *raftpb.Snapshot, raftLg *zap.Logger) (types.ID, *membership.RaftCluster, raft.RaftNodeInterFace, *raft.MemoryStorage, *wal.WAL) {
 	var walsnap walpb.Snapshot
 	if snapshot != nil {
 		walsnap.Index, walsnap.Term = snapshot.Metadata.Index, snapshot.Metadata.Term
@@ -301,7 +320,9 @@ func restartAsStandaloneNode(cfg config.ServerConfig, snapshot *raftpb.Snapshot)
 		MaxInflightMsgs: maxInflightMsgs,
 		CheckQuorum:     true,
 		PreVote:         cfg.PreVote, // PreVote 是否启用PreVote
-		Logger:          NewRaftLoggerZap(cfg.Logger.Named("raft")),
+		Logger:          NewRaftLoggerZap(raftLg),
+
+		AsyncStorageWrites: cfg.ExperimentalAsyncStorageWrites,
 	}
 
 	n := raft.RestartNode(c)
@@ -323,22 +344,36 @@ func getIDs(lg *zap.Logger, snap *raftpb.Snapshot, ents []raftpb.Entry) []uint64
 		}
 	}
 	for _, e := range ents {
-		if e.Type != raftpb.EntryConfChange {
+		var ccs []raftpb.ConfChangeSingle
+		switch e.Type {
+		case raftpb.EntryConfChange:
+			var cc raftpb.ConfChangeV1
+			pbutil.MustUnmarshal(&cc, e.Data)
+			ccs = cc.AsV2().Changes
+		case raftpb.EntryConfChangeV2:
+			// 离开联合配置的日志没有内容,批量变更的移除在这里直接生效
+			if len(e.Data) == 0 {
+				continue
+			}
+			var cc raftpb.ConfChangeV2
+			pbutil.MustUnmarshal(&cc, e.Data)
+			ccs = cc.Changes
+		default:
 			continue
 		}
-		var cc raftpb.ConfChangeV1
-		pbutil.MustUnmarshal(&cc, e.Data)
-		switch cc.Type {
-		case raftpb.ConfChangeAddLearnerNode:
-			ids[cc.NodeID] = true
-		case raftpb.ConfChangeAddNode:
-			ids[cc.NodeID] = true
-		case raftpb.ConfChangeRemoveNode:
-			delete(ids, cc.NodeID)
-		case raftpb.ConfChangeUpdateNode:
-			// do nothing
-		default:
-			lg.Panic("unknown ConfChange Type", zap.String("type", cc.Type.String()))
+		for _, cc := range ccs {
+			switch cc.Type {
+			case raftpb.ConfChangeAddLearnerNode:
+				ids[cc.NodeID] = true
+			case raftpb.ConfChangeAddNode:
+				ids[cc.NodeID] = true
+			case raftpb.ConfChangeRemoveNode:
+				delete(ids, cc.NodeID)
+			case raftpb.ConfChangeUpdateNode:
+				// do nothing
+			default:
+				lg.Panic("unknown ConfChange Type", zap.String("type", cc.Type.String()))
+			}
 		}
 	}
 	sids := make(types.Uint64Slice, 0, len(ids))
@@ -424,8 +459,22 @@ func (r *raftNode) tick() {
 func (r *raftNode) start(rh *raftReadyHandler) {
 	internalTimeout := time.Second
 
+	var writec chan storageWrite
+	writerStop, writerDone := make(chan struct{}), make(chan struct{})
+	if r.asyncWrites {
+		writec = make(chan storageWrite, maxInflightStorageWrites)
+		go r.runStorageWriter(writec, writerStop, writerDone)
+	} else {
+		close(writerDone)
+	}
+
 	go func() {
-		defer r.onStop()
+		defer func() {
+			// 等写协程退出后再关闭WAL
+			close(writerStop)
+			<-writerDone
+			r.onStop()
+		}()
 		islead := false
 
 		for {
@@ -477,84 +526,17 @@ func (r *raftNode) start(rh *raftReadyHandler) {
 					r.transport.Send(r.processMessages(rd.Messages))
 				}
 
-				// 如果有snapshot
-				if !raft.IsEmptySnap(rd.Snapshot) {
-					// gofail: var raftBeforeSaveSnap struct{}
-					if err := r.storage.SaveSnap(rd.Snapshot); err != nil {
-						r.lg.Fatal("failed to save Raft snapshot", zap.Error(err))
-					}
-					// gofail: var raftAfterSaveSnap struct{}
-				}
-
-				// 将hardState和日志条目保存到WAL中
-				if err := r.storage.Save(rd.HardState, rd.Entries); err != nil {
-					r.lg.Fatal("failed to save Raft hard state and entries", zap.Error(err))
-				}
-				if !raft.IsEmptyHardState(rd.HardState) {
-				}
-				// gofail: var raftAfterSave struct{}
-
-				if !raft.IsEmptySnap(rd.Snapshot) {
-					// Force WAL to fsync its hard state before Release() releases
-					// old data from the WAL. Otherwise could get an error like:
-					// panic: tocommit(107) is out of range [lastIndex(84)]. Was the raft log corrupted, truncated, or lost?
-					// See https://github.com/etcd-io/etcd/issues/10219 for more details.
-					if err := r.storage.Sync(); err != nil { // 强制wal日志落盘
-						r.lg.Fatal("failed to sync Raft snapshot", zap.Error(err))
-					}
-
-					// etcdserver now claim the snapshot has been persisted onto the disk
-					notifyc <- struct{}{}
-
-					// gofail: var raftBeforeApplySnap struct{}
-					r.raftStorage.ApplySnapshot(rd.Snapshot) // 从持久化的内存存储中恢复出快照
-					r.lg.Info("applied incoming Raft snapshot", zap.Uint64("snapshot-index", rd.Snapshot.Metadata.Index))
-					// gofail: var raftAfterApplySnap struct{}
-
-					if err := r.storage.Release(rd.Snapshot); err != nil {
-						r.lg.Fatal("failed to release Raft wal", zap.Error(err))
+				if r.asyncWrites {
+					// 交给写协程落盘,不等待写完就处理下一个Ready
+					select {
+					case writec <- storageWrite{rd: rd, notifyc: notifyc, islead: islead}:
+					case <-r.stopped:
+						return
 					}
-					// gofail: var raftAfterWALRelease struct{}
+					continue
 				}
-
-				r.raftStorage.Append(rd.Entries) // 从持久化的内存存储中恢复出日志
-
-				if !islead {
-					// 对消息封装成传输协议要求的格式,还会做超时控制
-					msgs := r.processMessages(rd.Messages)
-
-					// now unblocks 'applyAll' that waits on Raft log disk writes before triggering snapshots
-					notifyc <- struct{}{}
-
-					// Candidate or follower needs to wait for all pending configuration
-					// changes to backend applied before sending messages.
-					// Otherwise we might incorrectly count votes (e.g. votes from removed members).
-					// Also slow machine's follower raft-layer could proceed to become the leader
-					// on its own single-node cluster, before apply-layer applies the config change.
-					// We simply wait for ALL pending entries to backend applied for now.
-					// We might improve this later on if it causes unnecessary long blocking issues.
-					waitApply := false
-					for _, ent := range rd.CommittedEntries {
-						if ent.Type == raftpb.EntryConfChange {
-							waitApply = true
-							break
-						}
-					}
-					if waitApply {
-						// blocks until 'applyAll' calls 'applyWait.Trigger'
-						// to backend in sync with scheduled config-change job
-						// (assume notifyc has cap of 1)
-						select {
-						case notifyc <- struct{}{}:
-						case <-r.stopped:
-							return
-						}
-					}
-					// 将响应数据返回给对端
-					r.transport.Send(msgs)
-				} else {
-					// leader already processed 'MsgSnap' and signaled
-					notifyc <- struct{}{}
+				if !r.persist(rd, notifyc, islead, r.stopped) {
+					return
 				}
 				// 更新raft模块的applied index和将日志从unstable转到stable中
 				// 这里需要注意的是,在将已提交日志条目应用到状态机的操作是异步完成的,在Apply完成后,会将结果写到客户端调用进来时注册的channel中.这样一次完整的写操作就完成了.
@@ -566,6 +548,124 @@ func (r *raftNode) start(rh *raftReadyHandler) {
 	}()
 }
 
+// storageWrite 等待写协程持久化的Ready
+type storageWrite struct {
+	rd      raft.Ready
+	notifyc chan struct{}
+	islead  bool
+}
+
+// runStorageWriter 异步写模式下按顺序持久化Ready,写完后确认给raft
+func (r *raftNode) runStorageWriter(writec <-chan storageWrite, stopc <-chan struct{}, donec chan<- struct{}) {
+	defer close(donec)
+	for {
+		select {
+		case w := <-writec:
+			if !r.persist(w.rd, w.notifyc, w.islead, stopc) {
+				return
+			}
+			r.AdvanceStorage(w.rd)
+		case <-stopc:
+			return
+		}
+	}
+}
+
+// persist 持久化rd中的快照、HardState和日志并写入raftStorage,follower在写完后才发送消息;
+// stopc 关闭时返回false
+func (r *raftNode) persist(rd raft.Ready, notifyc chan struct{}, islead bool, stopc <-chan struct{}) bool {
+	if !raft.IsEmptySnap(rd.Snapshot) {
+		// gofail: var raftBeforeSaveSnap struct{}
+		if err := r.storage.SaveSnap(rd.Snapshot); err != nil {
+			r.lg.Fatal("failed to save Raft snapshot", zap.Error(err))
+		}
+		// gofail: var raftAfterSaveSnap struct{}
+	}
+
+	// 将hardState和日志条目保存到WAL中
+	timed := r.admission != nil && (!raft.IsEmptyHardState(rd.HardState) || len(rd.Entries) > 0)
+	saveStart := time.Now()
+	if timed {
+		r.admission.saveStarted(saveStart)
+	}
+	if !raft.IsEmptyHardState(rd.HardState) || len(rd.Entries) > 0 {
+		r.faults.delayFsync()
+	}
+	if err := r.storage.Save(rd.HardState, rd.Entries); err != nil {
+		r.lg.Fatal("failed to save Raft hard state and entries", zap.Error(err))
+	}
+	if timed {
+		now := time.Now()
+		r.admission.saveFinished(now)
+		r.latency.observe(latencyWALFsync, now.Sub(saveStart))
+	}
+	// gofail: var raftAfterSave struct{}
+
+	if !raft.IsEmptySnap(rd.Snapshot) {
+		// Force WAL to fsync its hard state before Release() releases
+		// old data from the WAL. Otherwise could get an error like:
+		// panic: tocommit(107) is out of range [lastIndex(84)]. Was the raft log corrupted, truncated, or lost?
+		// See https://github.com/etcd-io/etcd/issues/10219 for more details.
+		if err := r.storage.Sync(); err != nil { // 强制wal日志落盘
+			r.lg.Fatal("failed to sync Raft snapshot", zap.Error(err))
+		}
+
+		// etcdserver now claim the snapshot has been persisted onto the disk
+		notifyc <- struct{}{}
+
+		// gofail: var raftBeforeApplySnap struct{}
+		r.raftStorage.ApplySnapshot(rd.Snapshot) // 从持久化的内存存储中恢复出快照
+		r.lg.Info("applied incoming Raft snapshot", zap.Uint64("snapshot-index", rd.Snapshot.Metadata.Index))
+		// gofail: var raftAfterApplySnap struct{}
+
+		if err := r.storage.Release(rd.Snapshot); err != nil {
+			r.lg.Fatal("failed to release Raft wal", zap.Error(err))
+		}
+		// gofail: var raftAfterWALRelease struct{}
+	}
+
+	r.raftStorage.Append(rd.Entries) // 从持久化的内存存储中恢复出日志
+
+	if !islead {
+		// 对消息封装成传输协议要求的格式,还会做超时控制
+		msgs := r.processMessages(rd.Messages)
+
+		// now unblocks 'applyAll' that waits on Raft log disk writes before triggering snapshots
+		notifyc <- struct{}{}
+
+		// Candidate or follower needs to wait for all pending configuration
+		// changes to backend applied before sending messages.
+		// Otherwise we might incorrectly count votes (e.g. votes from removed members).
+		// Also slow machine's follower raft-layer could proceed to become the leader
+		// on its own single-node cluster, before apply-layer applies the config change.
+		// We simply wait for ALL pending entries to backend applied for now.
+		// We might improve this later on if it causes unnecessary long blocking issues.
+		waitApply := false
+		for _, ent := range rd.CommittedEntries {
+			if ent.Type == raftpb.EntryConfChange || ent.Type == raftpb.EntryConfChangeV2 {
+				waitApply = true
+				break
+			}
+		}
+		if waitApply {
+			// blocks until 'applyAll' calls 'applyWait.Trigger'
+			// to backend in sync with scheduled config-change job
+			// (assume notifyc has cap of 1)
+			select {
+			case notifyc <- struct{}{}:
+			case <-stopc:
+				return false
+			}
+		}
+		// 将响应数据返回给对端
+		r.transport.Send(msgs)
+	} else {
+		// leader already processed 'MsgSnap' and signaled
+		notifyc <- struct{}{}
+	}
+	return true
+}
+
 func updateCommittedIndex(ap *apply, rh *raftReadyHandler) {
 	var ci uint64
 	if len(ap.entries) != 0 {
@@ -635,7 +735,9 @@ func (r *raftNode) stop() {
 
 func (r *raftNode) onStop() {
 	r.Stop()
-	r.ticker.Stop()
+	if r.ticker.C != nil {
+		r.ticker.Stop()
+	}
 	r.transport.Stop()
 	if err := r.storage.Close(); err != nil {
 		r.lg.Panic("failed to close Raft storage", zap.Error(err))
@@ -69,7 +69,11 @@ func (s *EtcdServer) RemoveMember(ctx context.Context, id uint64) ([]*membership
 	if err := s.checkMembershipOperationPermission(ctx); err != nil {
 		return nil, err
 	}
+	return s.removeMember(ctx, id)
+}
 
+// removeMember 不做权限检查的移除成员,供内部使用
+func (s *EtcdServer) removeMember(ctx context.Context, id uint64) ([]*membership.Member, error) {
 	if err := s.mayRemoveMember(types.ID(id)); err != nil {
 		return nil, err
 	}
@@ -140,7 +144,11 @@ func (s *EtcdServer) promoteMember(ctx context.Context, id uint64) ([]*membershi
 	if err := s.checkMembershipOperationPermission(ctx); err != nil {
 		return nil, err
 	}
+	return s.promoteLearner(ctx, id)
+}
 
+// promoteLearner 不做权限检查的learner提升,必须在leader上调用
+func (s *EtcdServer) promoteLearner(ctx context.Context, id uint64) ([]*membership.Member, error) {
 	if err := s.mayPromoteMember(types.ID(id)); err != nil {
 		return nil, err
 	}
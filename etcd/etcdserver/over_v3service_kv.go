@@ -15,9 +15,14 @@ type RaftKV interface {
 	DeleteRange(ctx context.Context, r *pb.DeleteRangeRequest) (*pb.DeleteRangeResponse, error)
 	Txn(ctx context.Context, r *pb.TxnRequest) (*pb.TxnResponse, error)
 	Compact(ctx context.Context, r *pb.CompactionRequest) (*pb.CompactionResponse, error)
+	StagedTxn(ctx context.Context, r *pb.StagedTxnRequest) (*pb.StagedTxnResponse, error)
+	LoadStagedTxn(ctx context.Context, id int64) (*pb.TxnRequest, error)
 }
 
 func (s *EtcdServer) Txn(ctx context.Context, r *pb.TxnRequest) (*pb.TxnResponse, error) {
+	if r.IdempotencyToken != "" && s.DowngradeFeatureBlocked(FeatureIdempotencyToken) {
+		return nil, ErrDowngradeFeatureBlocked
+	}
 	if isTxnReadonly(r) {
 		trace := traceutil.New("transaction", s.Logger(), traceutil.Field{Key: "read_only", Value: true})
 		ctx = context.WithValue(ctx, traceutil.TraceKey, trace)
@@ -120,6 +125,19 @@ func (s *EtcdServer) Range(ctx context.Context, r *pb.RangeRequest) (*pb.RangeRe
 			return nil, err
 		}
 	}
+	// 快照会话在读取到最新的状态之后再检查,会话固定的修订版本不会被自动压缩
+	if r.SnapshotToken != "" {
+		rev, serr := s.snapshotSessionRevision(r.SnapshotToken)
+		if serr != nil {
+			return nil, serr
+		}
+		if r.Revision != 0 && r.Revision != rev {
+			return nil, ErrSnapshotSessionRevision
+		}
+		rr := *r
+		rr.Revision = rev
+		r = &rr
+	}
 	// serializable read 会直接读取当前节点的数据返回给客户端,它并不能保证返回给客户端的数据是最新的
 	chk := func(ai *auth.AuthInfo) error {
 		return s.authStore.IsRangePermitted(ai, []byte(r.Key), []byte(r.RangeEnd)) // health,nil
@@ -140,6 +158,9 @@ func (s *EtcdServer) Range(ctx context.Context, r *pb.RangeRequest) (*pb.RangeRe
 
 // Put OK
 func (s *EtcdServer) Put(ctx context.Context, r *pb.PutRequest) (*pb.PutResponse, error) {
+	if r.IdempotencyToken != "" && s.DowngradeFeatureBlocked(FeatureIdempotencyToken) {
+		return nil, ErrDowngradeFeatureBlocked
+	}
 	ctx = context.WithValue(ctx, traceutil.StartTimeKey, time.Now())
 	resp, err := s.raftRequest(ctx, pb.InternalRaftRequest{Put: r})
 	if err != nil {
@@ -18,12 +18,19 @@ type Lessor interface {
 	LeaseGrant(ctx context.Context, r *pb.LeaseGrantRequest) (*pb.LeaseGrantResponse, error)                // 创建租约
 	LeaseRevoke(ctx context.Context, r *pb.LeaseRevokeRequest) (*pb.LeaseRevokeResponse, error)             // 移除租约
 	LeaseRenew(ctx context.Context, id lease.LeaseID) (int64, error)                                        // 租约 续租
+	LeaseRenewBatch(ctx context.Context, ids []lease.LeaseID) ([]int64, error)                              // 批量续租,不存在的租约TTL为0
 	LeaseTimeToLive(ctx context.Context, r *pb.LeaseTimeToLiveRequest) (*pb.LeaseTimeToLiveResponse, error) // 检索租约信息.
 	LeaseLeases(ctx context.Context, r *pb.LeaseLeasesRequest) (*pb.LeaseLeasesResponse, error)             // 显示所有租约信息
+	LeaseWatch(ctx context.Context, r *pb.LeaseWatchRequest, send func(*pb.LeaseWatchResponse) error) error // 订阅租约事件
 }
 
 // LeaseGrant 创建租约
 func (s *EtcdServer) LeaseGrant(ctx context.Context, r *pb.LeaseGrantRequest) (*pb.LeaseGrantResponse, error) {
+	if len(r.Metadata) > lease.MaxLeaseMetadataSize {
+		return nil, lease.ErrLeaseMetadataTooLarge
+	}
+	// 在提交前加上抖动,所有成员apply相同的TTL
+	r.TTL = lease.JitterTTL(r.TTL, s.Cfg.LeaseTTLJitter)
 	// 没有提供租约ID,自己生成一个
 	for r.ID == int64(lease.NoLease) {
 		// 只使用正的int64 id
@@ -40,6 +47,12 @@ func (s *EtcdServer) LeaseGrant(ctx context.Context, r *pb.LeaseGrantRequest) (*
 
 // LeaseRevoke 移除租约
 func (s *EtcdServer) LeaseRevoke(ctx context.Context, r *pb.LeaseRevokeRequest) (*pb.LeaseRevokeResponse, error) {
+	// Expired 只能由leader撤销过期租约时设置
+	r.Expired = false
+	return s.leaseRevoke(ctx, r)
+}
+
+func (s *EtcdServer) leaseRevoke(ctx context.Context, r *pb.LeaseRevokeRequest) (*pb.LeaseRevokeResponse, error) {
 	resp, err := s.raftRequestOnce(ctx, pb.InternalRaftRequest{LeaseRevoke: r})
 	if err != nil {
 		return nil, err
@@ -47,6 +60,31 @@ func (s *EtcdServer) LeaseRevoke(ctx context.Context, r *pb.LeaseRevokeRequest)
 	return resp.(*pb.LeaseRevokeResponse), nil
 }
 
+// revokeExpiredBatch 把一批过期租约按给定顺序放进一个raft请求撤销;
+// 降级目标版本不认识这种请求时退回逐个串行撤销,遇到错误就停下,剩下的租约由lessor稍后重新发送,顺序不变
+func (s *EtcdServer) revokeExpiredBatch(ctx context.Context, ids []int64) error {
+	if s.DowngradeFeatureBlocked(FeatureLeaseRevokeExpired) {
+		for _, id := range ids {
+			if _, err := s.leaseRevoke(ctx, &pb.LeaseRevokeRequest{ID: id, Expired: true}); err != nil && err != lease.ErrLeaseNotFound {
+				return err
+			}
+		}
+		return nil
+	}
+	_, err := s.raftRequestOnce(ctx, pb.InternalRaftRequest{LeaseRevokeExpired: &pb.InternalLeaseRevokeExpiredRequest{IDs: ids}})
+	return err
+}
+
+// applyLeaseRevokeExpired 按请求中的顺序撤销过期租约,已经不存在的租约跳过
+func (s *EtcdServer) applyLeaseRevokeExpired(r *pb.InternalLeaseRevokeExpiredRequest) (*pb.LeaseRevokeResponse, error) {
+	for _, id := range r.IDs {
+		if err := s.lessor.RevokeExpired(lease.LeaseID(id)); err != nil && err != lease.ErrLeaseNotFound {
+			return nil, err
+		}
+	}
+	return &pb.LeaseRevokeResponse{Header: newHeader(s)}, nil
+}
+
 // LeaseRenew 租约 续租
 func (s *EtcdServer) LeaseRenew(ctx context.Context, id lease.LeaseID) (int64, error) {
 	ttl, err := s.lessor.Renew(id) //  已经向主要出租人（领导人）提出请求
@@ -83,6 +121,61 @@ func (s *EtcdServer) LeaseRenew(ctx context.Context, id lease.LeaseID) (int64, e
 	return -1, ErrCanceled
 }
 
+// LeaseRenewBatch 批量续租,不存在或已过期的租约TTL为0
+func (s *EtcdServer) LeaseRenewBatch(ctx context.Context, ids []lease.LeaseID) ([]int64, error) {
+	ttls, err := s.lessor.RenewBatch(ids)
+	if err == nil {
+		return ttls, nil
+	}
+	if err != lease.ErrNotPrimary {
+		return nil, err
+	}
+
+	cctx, cancel := context.WithTimeout(ctx, s.Cfg.ReqTimeout())
+	defer cancel()
+
+	// 与LeaseRenew一样手动转发给leader
+	for cctx.Err() == nil && err != nil {
+		leader, lerr := s.waitLeader(cctx)
+		if lerr != nil {
+			return nil, lerr
+		}
+		for _, url := range leader.PeerURLs {
+			lurl := url + leasehttp.LeaseBatchPrefix
+			ttls, err = leasehttp.RenewBatchHTTP(cctx, ids, lurl, s.peerRt)
+			if err == nil {
+				return ttls, nil
+			}
+			if err == leasehttp.ErrBatchRenewUnsupported {
+				return s.leaseRenewEach(ctx, ids)
+			}
+		}
+		// Throttle in case of e.g. connection problems.
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	if cctx.Err() == context.DeadlineExceeded {
+		return nil, ErrTimeout
+	}
+	return nil, ErrCanceled
+}
+
+// leaseRenewEach 逐个续租,用于leader不支持批量续约时
+func (s *EtcdServer) leaseRenewEach(ctx context.Context, ids []lease.LeaseID) ([]int64, error) {
+	ttls := make([]int64, len(ids))
+	for i, id := range ids {
+		ttl, err := s.LeaseRenew(ctx, id)
+		if err == lease.ErrLeaseNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		ttls[i] = ttl
+	}
+	return ttls, nil
+}
+
 // LeaseTimeToLive 检索租约信息
 func (s *EtcdServer) LeaseTimeToLive(ctx context.Context, r *pb.LeaseTimeToLiveRequest) (*pb.LeaseTimeToLiveResponse, error) {
 	if s.Leader() == s.ID() {
@@ -90,7 +183,7 @@ func (s *EtcdServer) LeaseTimeToLive(ctx context.Context, r *pb.LeaseTimeToLiveR
 		if le == nil {
 			return nil, lease.ErrLeaseNotFound
 		}
-		resp := &pb.LeaseTimeToLiveResponse{Header: &pb.ResponseHeader{}, ID: r.ID, TTL: int64(le.Remaining().Seconds()), GrantedTTL: le.TTL()}
+		resp := &pb.LeaseTimeToLiveResponse{Header: &pb.ResponseHeader{}, ID: r.ID, TTL: int64(le.Remaining().Seconds()), GrantedTTL: le.TTL(), Metadata: le.Metadata()}
 		if r.Keys {
 			ks := le.Keys()
 			kbs := make([][]byte, len(ks))
@@ -135,7 +228,7 @@ func (s *EtcdServer) LeaseLeases(ctx context.Context, r *pb.LeaseLeasesRequest)
 	ls := s.lessor.Leases() // 获取当前节点上的所有租约
 	lss := make([]*pb.LeaseStatus, len(ls))
 	for i := range ls {
-		lss[i] = &pb.LeaseStatus{ID: int64(ls[i].ID)}
+		lss[i] = &pb.LeaseStatus{ID: int64(ls[i].ID), GrantedTTL: ls[i].TTL(), Metadata: ls[i].Metadata()}
 	}
 	return &pb.LeaseLeasesResponse{Header: newHeader(s), Leases: lss}, nil
 }
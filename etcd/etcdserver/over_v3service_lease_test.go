@@ -0,0 +1,82 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdserver
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver/api/membership"
+	"github.com/ls-2018/etcd_cn/etcd/lease"
+	"github.com/ls-2018/etcd_cn/etcd/mvcc"
+	betesting "github.com/ls-2018/etcd_cn/etcd/mvcc/backend/testing"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+	"go.uber.org/zap"
+)
+
+// newTestLeaseServer 创建只带lessor和kv的EtcdServer,用来直接调用apply
+func newTestLeaseServer(t *testing.T) *EtcdServer {
+	lg := zap.NewNop()
+	be, _ := betesting.NewDefaultTmpBackend(t)
+	cl := membership.NewCluster(lg)
+	le := lease.NewLessor(lg, be, cl, lease.LessorConfig{MinLeaseTTL: 1})
+	kv := mvcc.New(lg, be, le, mvcc.StoreConfig{})
+	t.Cleanup(func() {
+		le.Stop()
+		kv.Close()
+		betesting.Close(t, be)
+	})
+	return &EtcdServer{lgMu: new(sync.RWMutex), lg: lg, cluster: cl, lessor: le, kv: kv, backend: be}
+}
+
+// TestApplyLeaseRevokeExpiredOrder 一个请求中的过期租约按给出的顺序撤销,已经不存在的租约跳过
+func TestApplyLeaseRevokeExpiredOrder(t *testing.T) {
+	s := newTestLeaseServer(t)
+	var got []int64
+	s.lessor.SetEventNotifier(func(ev *pb.LeaseEvent) {
+		if ev.Type == pb.LeaseEvent_EXPIRED {
+			got = append(got, ev.ID)
+		}
+	})
+	for _, id := range []int64{1, 2, 3, 4} {
+		if _, err := s.lessor.Grant(lease.LeaseID(id), 10, lease.NoLease, ""); err != nil {
+			t.Fatal(err)
+		}
+		s.kv.Put([]byte(fmt.Sprintf("foo%d", id)), []byte("bar"), lease.LeaseID(id))
+	}
+
+	if _, err := s.applyLeaseRevokeExpired(&pb.InternalLeaseRevokeExpiredRequest{IDs: []int64{3, 1, 4}}); err != nil {
+		t.Fatal(err)
+	}
+	// 1 已经被撤销,跳过后继续撤销 2
+	if _, err := s.applyLeaseRevokeExpired(&pb.InternalLeaseRevokeExpiredRequest{IDs: []int64{1, 2}}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []int64{3, 1, 4, 2}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("expired order = %v, want %v", got, want)
+	}
+	for _, id := range want {
+		if s.lessor.Lookup(lease.LeaseID(id)) != nil {
+			t.Fatalf("lease %d still exists", id)
+		}
+	}
+	if r, err := s.kv.Range(context.TODO(), []byte("foo"), []byte("fop"), mvcc.RangeOptions{}); err != nil || len(r.KVs) != 0 {
+		t.Fatalf("range = %v, %v, want no keys", r, err)
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdserver
+
+import (
+	"sync"
+
+	"github.com/ls-2018/etcd_cn/offical/api/v3/mvccpb"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+)
+
+// 超过这个长度的 Kvs 切片不放回池中,避免一次大的range长期占用内存
+const maxPooledRangeKvs = 4096
+
+// rangeKvsPool 复用Range响应中的 Kvs 指针切片.切片由 applyRange 从池中取出,
+// 响应编码之后通过 ReleaseRangeResponse 归还;没有归还的切片由GC回收.
+var rangeKvsPool sync.Pool // *[]*mvccpb.KeyValue
+
+func getRangeKvs(n int) []*mvccpb.KeyValue {
+	if n > 0 && n <= maxPooledRangeKvs {
+		if v, ok := rangeKvsPool.Get().(*[]*mvccpb.KeyValue); ok && cap(*v) >= n {
+			return (*v)[:n]
+		}
+	}
+	return make([]*mvccpb.KeyValue, n)
+}
+
+// ReleaseRangeResponse 在Range响应编码之后归还它的 Kvs 切片,之后不能再使用 resp.Kvs.
+// 只能由最后一个使用响应的地方调用一次
+func ReleaseRangeResponse(resp *pb.RangeResponse) {
+	kvs := resp.Kvs
+	resp.Kvs = nil
+	if cap(kvs) == 0 || cap(kvs) > maxPooledRangeKvs {
+		return
+	}
+	kvs = kvs[:cap(kvs)]
+	for i := range kvs {
+		kvs[i] = nil
+	}
+	rangeKvsPool.Put(&kvs)
+}
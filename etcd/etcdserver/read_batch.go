@@ -0,0 +1,89 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdserver
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// 线性读合并: 一次ReadIndex请求可以服务它发出前到达的所有线性读.配置了等待窗口时,
+// 收到第一个读请求后先等待窗口时间再发送ReadIndex,让更多的读合并到同一次请求中.
+// 开启自适应时,按读请求到达速率估计窗口内不会有其他读到达的情况下不等待,避免低负载时增加延迟.
+
+// 到达速率的指数加权平均系数
+const readRateEWMAWeight = 0.3
+
+var (
+	readIndexBatchSize = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "etcd",
+		Subsystem: "server",
+		Name:      "read_index_batch_size",
+		Help:      "The number of linearizable reads served by each read index request.",
+		// 1 ~ 8192
+		Buckets: prometheus.ExponentialBuckets(1, 2, 14),
+	})
+	readIndexDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "etcd",
+		Subsystem: "server",
+		Name:      "read_index_duration_seconds",
+		Help:      "The round trip latency of read index requests, from sending the request to receiving the confirmed index.",
+		// 100us ~ 13s
+		Buckets: prometheus.ExponentialBuckets(0.0001, 2, 18),
+	})
+	readIndexBatchWindow = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "etcd",
+		Subsystem: "server",
+		Name:      "read_index_batch_window_seconds",
+		Help:      "The batching window the last read index request waited for before it was sent.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(readIndexBatchSize)
+	prometheus.MustRegister(readIndexDuration)
+	prometheus.MustRegister(readIndexBatchWindow)
+}
+
+// readBatcher 统计线性读的到达速率,只在 linearizableReadLoop 中计算窗口
+type readBatcher struct {
+	arrivals uint64 // 原子操作
+	last     time.Time
+	rate     float64 // 每秒到达的读请求数
+}
+
+func (b *readBatcher) arrive() { atomic.AddUint64(&b.arrivals, 1) }
+
+// window 返回发送ReadIndex前等待的时间
+func (b *readBatcher) window(max time.Duration, adaptive bool) time.Duration {
+	now := time.Now()
+	n := atomic.SwapUint64(&b.arrivals, 0)
+	if !b.last.IsZero() {
+		if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+			b.rate = readRateEWMAWeight*float64(n)/elapsed + (1-readRateEWMAWeight)*b.rate
+		}
+	}
+	b.last = now
+	if max <= 0 || !adaptive {
+		return max
+	}
+	// 预计窗口内到达的读不足一个时不等待
+	if b.rate*max.Seconds() < 1 {
+		return 0
+	}
+	return max
+}
@@ -0,0 +1,88 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdserver
+
+import (
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+var readOnlyGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: "etcd",
+	Subsystem: "server",
+	Name:      "read_only",
+	Help:      "Whether the member is in read-only maintenance mode. 1 is read-only, 0 is not.",
+})
+
+func init() {
+	prometheus.MustRegister(readOnlyGauge)
+}
+
+// readOnlyMode 本成员的只读维护模式开关,只保存在内存中,成员重启后自动退出
+type readOnlyMode struct {
+	enabled int32
+}
+
+// Enabled 返回是否处于只读维护模式;raft 据此决定本成员能否参与竞选
+func (m *readOnlyMode) Enabled() bool {
+	return atomic.LoadInt32(&m.enabled) == 1
+}
+
+// set 切换模式,返回状态是否发生了变化
+func (m *readOnlyMode) set(on bool) bool {
+	var v int32
+	if on {
+		v = 1
+	}
+	if atomic.SwapInt32(&m.enabled, v) == v {
+		return false
+	}
+	readOnlyGauge.Set(float64(v))
+	return true
+}
+
+// ReadOnly 返回本成员是否处于只读维护模式
+func (s *EtcdServer) ReadOnly() bool {
+	return s.readOnly.Enabled()
+}
+
+// SetReadOnly 进入或退出只读维护模式.只读成员不参与竞选、拒绝写请求,仍然提供串行化读;
+// 进入时如果本成员是leader,会先把leader转移给其他投票成员,转移失败时退回原状态.
+func (s *EtcdServer) SetReadOnly(on bool) error {
+	lg := s.Logger()
+	if !on {
+		if s.readOnly.set(false) {
+			lg.Info("退出只读维护模式", zap.String("local-member-id", s.ID().String()))
+		}
+		return nil
+	}
+
+	// 唯一的投票成员不能放弃leader
+	if !s.IsLearner() && !s.hasMultipleVotingMembers() {
+		return ErrReadOnlySoleVoter
+	}
+	if !s.readOnly.set(true) {
+		return nil
+	}
+	lg.Info("进入只读维护模式", zap.String("local-member-id", s.ID().String()))
+	if err := s.TransferLeadership(); err != nil {
+		s.readOnly.set(false)
+		lg.Warn("leader转移失败,退出只读维护模式", zap.String("local-member-id", s.ID().String()), zap.Error(err))
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdserver
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	ErrCompactorDisabled  = errors.New("etcdserver: auto compaction is disabled")
+	ErrQuotaNotAdjustable = errors.New("etcdserver: backend quota is disabled or invalid")
+)
+
+// SetCompactionRetention changes the retention of auto compaction at runtime.
+// The compaction mode cannot be changed, and auto compaction must have been
+// enabled when the server started.
+func (s *EtcdServer) SetCompactionRetention(retention time.Duration) error {
+	if s.compactor == nil || retention <= 0 {
+		return ErrCompactorDisabled
+	}
+	s.compactor.SetRetention(retention)
+	s.Logger().Info("修改自动压缩保留值", zap.Duration("retention", retention))
+	return nil
+}
+
+// SetWarningApplyDuration changes the threshold above which applying a
+// request logs a warning.
+func (s *EtcdServer) SetWarningApplyDuration(d time.Duration) {
+	atomic.StoreInt64(&s.warnApplyDuration, int64(d))
+}
+
+func (s *EtcdServer) warningApplyDuration() time.Duration {
+	if d := atomic.LoadInt64(&s.warnApplyDuration); d > 0 {
+		return time.Duration(d)
+	}
+	return s.Cfg.WarningApplyDuration
+}
+
+// SetQuotaBackendBytes changes the backend quota at runtime. It only changes
+// the limit checked for new requests; the mmap size of the backend is fixed
+// at startup. The quota must have been enabled when the server started.
+func (s *EtcdServer) SetQuotaBackendBytes(n int64) error {
+	if s.Cfg.QuotaBackendBytes < 0 || n <= 0 {
+		return ErrQuotaNotAdjustable
+	}
+	atomic.StoreInt64(&s.quotaBackendBytes, n)
+	return nil
+}
@@ -0,0 +1,208 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdserver
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/ls-2018/etcd_cn/client_sdk/pkg/types"
+	"github.com/ls-2018/etcd_cn/etcd/auth"
+	"github.com/ls-2018/etcd_cn/etcd/config"
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver/api/membership"
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver/api/v2store"
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver/cindex"
+	"github.com/ls-2018/etcd_cn/etcd/lease"
+	"github.com/ls-2018/etcd_cn/etcd/mvcc"
+	"github.com/ls-2018/etcd_cn/etcd/mvcc/backend"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+	"github.com/ls-2018/etcd_cn/pkg/pbutil"
+	"github.com/ls-2018/etcd_cn/pkg/wait"
+	"github.com/ls-2018/etcd_cn/raft/raftpb"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Replayer 在一个全新的后端上使用真实的 applier 重放 raft 日志,用于离线排查数据不一致.
+// 重放不经过 raft,不触发租约过期,也不受后端配额限制;警报日志仍然按原样生效.
+type Replayer struct {
+	s  *EtcdServer
+	bc *batchChangeReplayer
+}
+
+// NewReplayer 在 path 创建新的后端并返回重放器,path 处不能已经存在数据库文件.
+func NewReplayer(lg *zap.Logger, path string) (*Replayer, error) {
+	if lg == nil {
+		lg = zap.NewNop()
+	}
+	ci := cindex.NewConsistentIndex(nil)
+	bh := &backendHooks{lg: lg, indexer: ci}
+	bcfg := backend.DefaultBackendConfig()
+	bcfg.Path = path
+	bcfg.UnsafeNoFsync = true
+	bcfg.Logger = lg
+	bcfg.Hooks = bh
+	be := backend.New(bcfg)
+	ci.SetBackend(be)
+	cindex.CreateMetaBucket(be.BatchTx())
+
+	st := v2store.New(StoreClusterPrefix, StoreKeysPrefix)
+	cl := membership.NewCluster(lg)
+	cl.SetStore(st)
+	cl.SetBackend(be)
+
+	s := &EtcdServer{
+		Cfg:          config.ServerConfig{Logger: lg, QuotaBackendBytes: -1},
+		lgMu:         new(sync.RWMutex),
+		lg:           lg,
+		ctx:          context.Background(),
+		stopping:     make(chan struct{}),
+		w:            wait.New(),
+		v2store:      st,
+		cluster:      cl,
+		backend:      be,
+		beHooks:      bh,
+		consistIndex: ci,
+		logScopes:    newLogScopes(lg),
+	}
+	// 重放时不启动任何后台任务
+	close(s.stopping)
+	s.applyV2 = NewApplierV2(lg, st, cl)
+	s.lessor = lease.NewLessor(lg, be, cl, lease.LessorConfig{})
+	s.kv = mvcc.New(lg, be, s.lessor, mvcc.StoreConfig{})
+	tp, err := auth.NewTokenProvider(lg, "", nil, 0)
+	if err != nil {
+		closeReplayStores(s)
+		return nil, err
+	}
+	s.authStore = auth.NewAuthStore(lg, be, tp, bcrypt.DefaultCost)
+	s.applyV3Base = s.newApplierV3Backend()
+	s.applyV3Internal = s.newApplierV3Internal()
+	if err = s.restoreAlarms(); err != nil {
+		closeReplayStores(s)
+		return nil, err
+	}
+	return &Replayer{s: s, bc: newBatchChangeReplayer(raftpb.ConfState{})}, nil
+}
+
+// Apply 按 etcd 应用已提交日志的方式应用 e,返回日志中请求的类型.
+func (r *Replayer) Apply(e raftpb.Entry) (op string) {
+	s := r.s
+	shouldApplyV3 := membership.ApplyV2storeOnly
+	if e.Index > s.consistIndex.ConsistentIndex() {
+		s.consistIndex.SetConsistentIndex(e.Index, e.Term)
+		shouldApplyV3 = membership.ApplyBoth
+	}
+	s.setAppliedIndex(e.Index)
+	s.setTerm(e.Term)
+
+	switch e.Type {
+	case raftpb.EntryConfChange:
+		var cc raftpb.ConfChangeV1
+		pbutil.MustUnmarshal(&cc, e.Data)
+		applyConfChangeToCluster(s.lg, s.cluster, cc, shouldApplyV3)
+		return "conf-change"
+	case raftpb.EntryConfChangeV2:
+		r.bc.apply(s.lg, s.cluster, e, shouldApplyV3)
+		return "conf-change"
+	case raftpb.EntryNormal:
+	default:
+		s.lg.Panic("未知的日志类型", zap.String("type", e.Type.String()))
+	}
+
+	if len(e.Data) == 0 {
+		return "noop"
+	}
+	var raftReq pb.InternalRaftRequest
+	if !pbutil.MaybeUnmarshal(&raftReq, e.Data) {
+		var req pb.Request
+		pbutil.MustUnmarshal(&req, e.Data)
+		s.applyV2Request((*RequestV2)(&req), shouldApplyV3)
+		return "v2"
+	}
+	op = raftRequestOp(&raftReq)
+	if raftReq.V2 != nil {
+		s.applyV2Request((*RequestV2)(raftReq.V2), shouldApplyV3)
+		return op
+	}
+	// 重放时没有等待结果的调用者,和 applyEntryNormal 一样跳过没有副作用的请求
+	if noSideEffect(&raftReq) {
+		return op
+	}
+	if raftReq.Txn != nil {
+		removeNeedlessRangeReqs(raftReq.Txn)
+	}
+	ar := s.applyV3Request(&raftReq, shouldApplyV3)
+	if ar != nil && ar.physc != nil {
+		// 等物理压缩完成,保证随后计算的哈希稳定
+		<-ar.physc
+	}
+	return op
+}
+
+// applyConfChangeToCluster 只更新成员信息,离线重放时没有 raft 节点和网络传输需要变更
+func applyConfChangeToCluster(lg *zap.Logger, cl *membership.RaftCluster, cc raftpb.ConfChangeV1, shouldApplyV3 membership.ShouldApplyV3) {
+	if err := cl.ValidateConfigurationChange(cc); err != nil {
+		return
+	}
+	switch cc.Type {
+	case raftpb.ConfChangeAddNode, raftpb.ConfChangeAddLearnerNode:
+		ctx := new(membership.ConfigChangeContext)
+		if err := json.Unmarshal([]byte(cc.Context), ctx); err != nil {
+			lg.Panic("发序列化成员失败", zap.Error(err))
+		}
+		if ctx.IsPromote {
+			cl.PromoteMember(ctx.Member.ID, shouldApplyV3)
+		} else {
+			cl.AddMember(&ctx.Member, shouldApplyV3)
+		}
+	case raftpb.ConfChangeRemoveNode:
+		cl.RemoveMember(types.ID(cc.NodeID), shouldApplyV3)
+	case raftpb.ConfChangeUpdateNode:
+		m := new(membership.Member)
+		if err := json.Unmarshal([]byte(cc.Context), m); err != nil {
+			lg.Panic("反序列化失败", zap.Error(err))
+		}
+		cl.UpdateRaftAttributes(m.ID, m.RaftAttributes, shouldApplyV3)
+	}
+}
+
+// HashByRev 返回重放结果在 rev 处的哈希,语义与 mvcc 的 HashByRev 相同.
+func (r *Replayer) HashByRev(rev int64) (hash uint32, currentRev int64, compactRev int64, err error) {
+	r.s.backend.ForceCommit()
+	return r.s.kv.HashByRev(rev)
+}
+
+// Rev 返回重放到目前为止的 mvcc 版本号.
+func (r *Replayer) Rev() int64 { return r.s.kv.Rev() }
+
+// ConsistentIndex 返回最后重放的日志索引.
+func (r *Replayer) ConsistentIndex() uint64 { return r.s.consistIndex.ConsistentIndex() }
+
+// Close 关闭重放使用的存储,不删除后端文件.
+func (r *Replayer) Close() error {
+	return closeReplayStores(r.s)
+}
+
+func closeReplayStores(s *EtcdServer) error {
+	s.lessor.Stop()
+	if err := s.kv.Close(); err != nil {
+		s.backend.Close()
+		return err
+	}
+	return s.backend.Close()
+}
@@ -0,0 +1,137 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdserver
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/ls-2018/etcd_cn/etcd/mvcc/buckets"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// 副本集群: 整个集群作为上游集群的只读副本启动,leader持续把上游的变更写入本集群,客户端的写请求被拒绝.
+// 提升通过raft记录在 meta bucket 中,所有成员一致地停止复制并开始接受写请求,提升后不能撤销.
+
+// replicaPromotedKey meta bucket 中记录副本集群已被提升的key
+var replicaPromotedKey = []byte("replica_promoted")
+
+var replicaGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: "etcd",
+	Subsystem: "server",
+	Name:      "replica",
+	Help:      "Whether the cluster is a read-only replica of an upstream cluster. 1 is replica, 0 is not.",
+})
+
+func init() {
+	prometheus.MustRegister(replicaGauge)
+}
+
+type replicaApplyKey struct{}
+
+// WithReplicaApply 标记ctx中的写请求来自上游集群的复制,副本集群不会拒绝这些请求
+func WithReplicaApply(ctx context.Context) context.Context {
+	return context.WithValue(ctx, replicaApplyKey{}, struct{}{})
+}
+
+func isReplicaApply(ctx context.Context) bool {
+	return ctx.Value(replicaApplyKey{}) != nil
+}
+
+// IsReplica 返回集群是否是还没有被提升的只读副本
+func (s *EtcdServer) IsReplica() bool {
+	return s.Cfg.Replica && atomic.LoadInt32(&s.replicaPromoted) == 0
+}
+
+// loadReplicaPromoted 启动或者应用快照后从后端读取提升状态;
+// 不论本成员是否以副本方式启动都要读取,apply时的判断不能依赖成员本地的配置
+func (s *EtcdServer) loadReplicaPromoted() {
+	tx := s.backend.BatchTx()
+	tx.Lock()
+	_, vs := tx.UnsafeRange(buckets.Meta, replicaPromotedKey, nil, 0)
+	tx.Unlock()
+	var v int32
+	if len(vs) != 0 {
+		v = 1
+	}
+	atomic.StoreInt32(&s.replicaPromoted, v)
+	if s.Cfg.Replica {
+		replicaGauge.Set(float64(1 - v))
+	}
+}
+
+// rejectReplicaWrite 副本集群拒绝客户端的写请求,复制写入、登录和集群内部的请求仍然放行;
+// 提升之后反过来拒绝复制写入,避免上游的旧数据覆盖提升后的写入
+func (s *EtcdServer) rejectReplicaWrite(ctx context.Context, r *pb.InternalRaftRequest) error {
+	if !s.Cfg.Replica {
+		return nil
+	}
+	if isReplicaApply(ctx) {
+		if !s.IsReplica() {
+			return ErrNotReplica
+		}
+		return nil
+	}
+	if !s.IsReplica() {
+		return nil
+	}
+	if r.Put != nil || r.DeleteRange != nil || r.Txn != nil || r.StagedTxn != nil ||
+		r.LeaseGrant != nil || r.LeaseRevoke != nil {
+		return ErrReplicaReadOnly
+	}
+	return nil
+}
+
+// rejectPromotedReplicaApply 在apply时拒绝提升之前提议、提升之后才apply的复制写入;
+// 提升状态也是在apply时修改的,只依据请求头和后端记录的提升状态判断,所有成员按日志顺序得到相同的结果
+func (s *EtcdServer) rejectPromotedReplicaApply(r *pb.InternalRaftRequest) error {
+	if r.Header == nil || !r.Header.Replica {
+		return nil
+	}
+	if atomic.LoadInt32(&s.replicaPromoted) == 1 {
+		return ErrNotReplica
+	}
+	return nil
+}
+
+// PromoteReplica 提升只读副本集群,返回提升时的修订版本;集群已经被提升时直接返回
+func (s *EtcdServer) PromoteReplica(ctx context.Context) (int64, error) {
+	if !s.Cfg.Replica {
+		return 0, ErrNotReplica
+	}
+	if s.IsReplica() {
+		if s.DowngradeFeatureBlocked(FeatureReplicaPromote) {
+			return 0, ErrDowngradeFeatureBlocked
+		}
+		if _, err := s.raftRequest(ctx, pb.InternalRaftRequest{ReplicaPromote: &pb.InternalReplicaPromoteRequest{}}); err != nil {
+			return 0, err
+		}
+	}
+	return s.KV().Rev(), nil
+}
+
+func (s *EtcdServer) applyReplicaPromote(r *pb.InternalReplicaPromoteRequest) (*pb.EmptyResponse, error) {
+	tx := s.backend.BatchTx()
+	tx.Lock()
+	tx.UnsafePut(buckets.Meta, replicaPromotedKey, []byte{1})
+	tx.Unlock()
+	if atomic.SwapInt32(&s.replicaPromoted, 1) == 0 && s.Cfg.Replica {
+		replicaGauge.Set(0)
+		s.Logger().Info("副本集群已被提升,停止复制并开始接受写请求", zap.Int64("revision", s.KV().Rev()))
+	}
+	return &pb.EmptyResponse{}, nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdserver
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var requestBudgetExceeded = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "etcd",
+	Subsystem: "server",
+	Name:      "request_budget_exceeded_total",
+	Help:      "The total number of write requests failed fast because they exceeded the budget derived from the client deadline.",
+})
+
+func init() {
+	prometheus.MustRegister(requestBudgetExceeded)
+}
+
+// requestBudget 返回请求的处理预算:客户端deadline减去预留的网络往返时间,且不超过 ReqTimeout;
+// limited 为true表示预算由客户端deadline决定
+func (s *EtcdServer) requestBudget(ctx context.Context) (budget time.Duration, limited bool) {
+	budget = s.Cfg.ReqTimeout()
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return budget, false
+	}
+	if b := time.Until(deadline) - s.Cfg.RequestDeadlineAllowance; b < budget {
+		return b, true
+	}
+	return budget, false
+}
+
+// budgetExceeded 生成预算耗尽的错误,start 为开始处理的时间,proposed 为提交给raft的时间
+func (s *EtcdServer) budgetExceeded(budget time.Duration, start, proposed time.Time) error {
+	requestBudgetExceeded.Inc()
+	now := time.Now()
+	e := &RequestBudgetError{
+		Budget:    budget,
+		QueueWait: proposed.Sub(start),
+		ApplyWait: now.Sub(proposed),
+		Cause:     s.parseProposeCtxErr(context.DeadlineExceeded, start),
+	}
+	if ci, ai := s.getCommittedIndex(), s.getAppliedIndex(); ci > ai {
+		e.Pending = ci - ai
+	}
+	if e.Cause == ErrTimeout {
+		// 没有更具体的原因
+		e.Cause = nil
+	}
+	return e
+}
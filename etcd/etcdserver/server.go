@@ -36,6 +36,7 @@ import (
 	humanize "github.com/dustin/go-humanize"
 	"github.com/ls-2018/etcd_cn/etcd/config"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
 
 	"github.com/ls-2018/etcd_cn/client_sdk/pkg/fileutil"
 	"github.com/ls-2018/etcd_cn/client_sdk/pkg/types"
@@ -91,9 +92,6 @@ const (
 
 	releaseDelayAfterSnapshot = 30 * time.Second
 
-	// maxPendingRevokes is the maximum number of outstanding expired lease revocations.
-	maxPendingRevokes = 16
-
 	recommendedMaxRequestBytes = 10 * 1024 * 1024 // 10M
 
 	readyPercent = 0.9
@@ -166,6 +164,9 @@ type Server interface {
 // EtcdServer 整个etcd节点的功能的入口,包含etcd节点运行过程中需要的大部分成员.
 type EtcdServer struct {
 	inflightSnapshots int64  // 当前正在发送的snapshot数量
+	warnApplyDuration int64  // 运行时修改的apply告警阈值,0表示使用配置值
+	quotaBackendBytes int64  // 运行时修改的后端配额,0表示使用配置值
+	clockSkew         int64  // 最近一次测得的与各对端之间最大的时钟偏差(纳秒)
 	appliedIndex      uint64 // 已经apply到状态机的日志index
 	committedIndex    uint64 // 已经提交的日志index,也就是leader确认多数成员已经同步了的日志index
 	term              uint64
@@ -180,6 +181,7 @@ type EtcdServer struct {
 	readMu            sync.RWMutex  // 下面3个结果都是为了实现linearizable 读使用的
 	readwaitc         chan struct{} // 通过向readwaitC发送一个空结构体来通知etcd服务器它正在等待读取
 	readNotifier      *notifier     // 在没有错误时通知read goroutine 可以处理请求
+	readBatch         readBatcher   // 线性读的到达速率,用于自适应合并窗口
 
 	stop            chan struct{}           // 停止通道
 	stopping        chan struct{}           // 停止时关闭这个通道
@@ -199,6 +201,23 @@ type EtcdServer struct {
 	applyWait       wait.WaitTime           // apply的等待队列,等待某个index的日志apply完成
 	kv              mvcc.WatchableKV        // v3用的kv存储
 	lessor          lease.Lessor            // v3用,作用是实现过期时间
+	leaseEvents     *leaseEventHub          // 分发租约事件给LeaseWatch
+	events          *serverEventHub         // 分发server生命周期事件给注册的handler
+	isLeaderEvent   bool                    // 上次发送事件时是否为leader,只在raft goroutine中访问
+	interceptor     ApplyInterceptor        // 实验性的apply拦截器
+	observers       []ApplyObserver         // 实验性的apply观察者,按添加顺序调用
+	translation     downgradeTranslation    // 降级时改写旧版本不支持的数据的进度
+	readOnly        *readOnlyMode           // 只读维护模式,只在本成员生效
+	replicaPromoted int32                   // 1 表示副本集群已被提升,见 replica.go
+	admission       *admission              // 准入控制使用的负载指标
+	crash           *crashReporter          // 致命错误时写崩溃报告
+	latency         *latencyTracker         // 写路径各阶段最近的耗时
+	logScopes       *logScopes              // 各子系统独立的日志等级
+	faults          *faultInjector          // 通过 Failpoint 接口注入的故障,只在本成员生效
+	startup         *startupTracker         // 启动所处的阶段和进度
+	userRates       userRateLimiters        // 每个用户的写入速率限制,只在本成员生效
+	watchLimits     watchLimiter            // 每个连接和每个用户的watch数限制,只在本成员生效
+	validators      []*admissionPlugin      // 写请求提议前的准入校验插件,只在本成员生效
 	backendLock     sync.Mutex              // 守护后端存储的锁,改变后端存储和获取后端存储是使用
 	backend         backend.Backend         // 后端存储  bolt.db
 	beHooks         *backendHooks           // 存储钩子
@@ -221,6 +240,8 @@ type EtcdServer struct {
 	leadElectedTime     time.Time
 	firstCommitInTermMu sync.RWMutex
 	firstCommitInTermC  chan struct{} // 任期内的第一次commit时创建的
+	learnerReadyMu      sync.Mutex
+	learnerReadySince   map[uint64]time.Time // leader上learner持续满足自动提升条件的起始时间
 	*AccessController
 }
 
@@ -233,10 +254,24 @@ type backendHooks struct {
 	// not initialized `confState` is meaningless.
 	confStateDirty bool
 	confStateLock  sync.Mutex
+	// bucketIndexes 本次提交前apply的请求会修改的非KV桶及其日志索引
+	bucketIndexes   map[backend.BucketID]uint64
+	bucketIndexLock sync.Mutex
+	latency         *latencyTracker
+	faults          *faultInjector
+}
+
+func (bh *backendHooks) BeforeCommit() error {
+	return bh.faults.beforeBackendCommit()
+}
+
+func (bh *backendHooks) OnCommit(took time.Duration) {
+	bh.latency.observe(latencyBackendCommit, took)
 }
 
 func (bh *backendHooks) OnPreCommitUnsafe(tx backend.BatchTx) {
 	bh.indexer.UnsafeSave(tx)
+	bh.unsafeSaveBucketIndexes(tx)
 	bh.confStateLock.Lock()
 	defer bh.confStateLock.Unlock()
 	if bh.confStateDirty {
@@ -269,10 +304,16 @@ type Temp struct {
 	BeExist  bool
 	BeHooks  *backendHooks
 	BE       backend.Backend
+	RO       *readOnlyMode
+	Latency  *latencyTracker
+	Logs     *logScopes
+	Startup  *startupTracker
+	Faults   *faultInjector
 }
 
 func MySelfStartRaft(cfg config.ServerConfig) (temp *Temp, err error) {
-	temp = &Temp{}
+	temp = &Temp{RO: &readOnlyMode{}, Latency: newLatencyTracker(), Logs: newLogScopes(cfg.Logger), Startup: newStartupTracker(cfg.Logger), Faults: newFaultInjector(cfg.Logger, cfg.ExperimentalFailpoints)}
+	raftLg := temp.Logs.logger(cfg.Logger, LogScopeRaft)
 	temp.ST = v2store.New(StoreClusterPrefix, StoreKeysPrefix) // 创建了一个store结构体   /0 /1
 
 	if cfg.MaxRequestBytes > recommendedMaxRequestBytes { // 10M
@@ -315,7 +356,7 @@ func MySelfStartRaft(cfg config.ServerConfig) (temp *Temp, err error) {
 	temp.BeExist = fileutil.Exist(temp.Bepath)
 
 	temp.CI = cindex.NewConsistentIndex(nil) // pointer
-	temp.BeHooks = &backendHooks{lg: cfg.Logger, indexer: temp.CI}
+	temp.BeHooks = &backendHooks{lg: cfg.Logger, indexer: temp.CI, latency: temp.Latency, faults: temp.Faults}
 	temp.BE = openBackend(cfg, temp.BeHooks)
 	temp.CI.SetBackend(temp.BE)
 	cindex.CreateMetaBucket(temp.BE.BatchTx())
@@ -363,7 +404,7 @@ func MySelfStartRaft(cfg config.ServerConfig) (temp *Temp, err error) {
 		temp.CL.SetID(types.ID(0), existingCluster.ID())
 		temp.CL.SetStore(temp.ST)
 		temp.CL.SetBackend(temp.BE)
-		temp.ID, temp.N, temp.S, temp.W = startNode(cfg, temp.CL, nil)
+		temp.ID, temp.N, temp.S, temp.W = startNode(cfg, temp.CL, nil, temp.RO.Enabled, raftLg)
 		temp.CL.SetID(temp.ID, existingCluster.ID())
 
 	case !haveWAL && cfg.NewCluster: // false true   初始新成员
@@ -401,7 +442,7 @@ func MySelfStartRaft(cfg config.ServerConfig) (temp *Temp, err error) {
 		temp.CL.SetStore(temp.ST) // 结构体
 		temp.CL.SetBackend(temp.BE)
 		// 启动节点
-		temp.ID, temp.N, temp.S, temp.W = startNode(cfg, temp.CL, temp.CL.MemberIDs()) // ✅✈️ 🚗🚴🏻😁
+		temp.ID, temp.N, temp.S, temp.W = startNode(cfg, temp.CL, temp.CL.MemberIDs(), temp.RO.Enabled, raftLg) // ✅✈️ 🚗🚴🏻😁
 		temp.CL.SetID(temp.ID, temp.CL.ID())
 
 	case haveWAL:
@@ -420,6 +461,7 @@ func MySelfStartRaft(cfg config.ServerConfig) (temp *Temp, err error) {
 			)
 		}
 
+		temp.Startup.enter(StartupPhaseLoadingSnapshot)
 		// Find a snapshot to start/restart a raft node
 		walSnaps, err := wal.ValidSnapshotEntries(cfg.Logger, cfg.WALDir())
 		if err != nil {
@@ -437,6 +479,9 @@ func MySelfStartRaft(cfg config.ServerConfig) (temp *Temp, err error) {
 				cfg.Logger.Panic("failed to recover from snapshot", zap.Error(err))
 			}
 
+			if err = dropMigratedV2StoreContent(cfg.Logger, temp.ST, temp.BE, cfg.V2Deprecation); err != nil {
+				return nil, err
+			}
 			if err = assertNoV2StoreContent(cfg.Logger, temp.ST, cfg.V2Deprecation); err != nil {
 				cfg.Logger.Error("illegal v2store content", zap.Error(err))
 				return nil, err
@@ -466,10 +511,11 @@ func MySelfStartRaft(cfg config.ServerConfig) (temp *Temp, err error) {
 			cfg.Logger.Info("No snapshot found. Recovering WAL from scratch!")
 		}
 
+		temp.Startup.enter(StartupPhaseReadingWAL)
 		if !cfg.ForceNewCluster {
-			temp.ID, temp.CL, temp.N, temp.S, temp.W = restartNode(cfg, temp.Snapshot)
+			temp.ID, temp.CL, temp.N, temp.S, temp.W = restartNode(cfg, temp.Snapshot, temp.RO.Enabled, raftLg)
 		} else {
-			temp.ID, temp.CL, temp.N, temp.S, temp.W = restartAsStandaloneNode(cfg, temp.Snapshot)
+			temp.ID, temp.CL, temp.N, temp.S, temp.W = restartAsStandaloneNode(cfg, temp.Snapshot, raftLg)
 		}
 
 		temp.CL.SetStore(temp.ST)
@@ -493,12 +539,15 @@ func MySelfStartRaft(cfg config.ServerConfig) (temp *Temp, err error) {
 
 // NewServer 根据提供的配置创建一个新的EtcdServer.在EtcdServer的生命周期内,该配置被认为是静态的.
 func NewServer(cfg config.ServerConfig) (srv *EtcdServer, err error) {
+	cr := newCrashReporter(cfg)
+	cfg.Logger = cr.hook(cfg.Logger)
 	temp := &Temp{}
 	temp, err = MySelfStartRaft(cfg) // 逻辑时钟初始化
 	serverStats := stats.NewServerStats(cfg.Name, temp.ID.String())
 	leaderStats := stats.NewLeaderStats(cfg.Logger, temp.ID.String())
 
 	heartbeat := time.Duration(cfg.TickMs) * time.Millisecond
+	adm := &admission{}
 	srv = &EtcdServer{
 		readych:     make(chan struct{}),
 		Cfg:         cfg,
@@ -509,12 +558,17 @@ func NewServer(cfg config.ServerConfig) (srv *EtcdServer, err error) {
 		snapshotter: temp.SS,
 		r: *newRaftNode(
 			raftNodeConfig{
-				lg:                cfg.Logger,
+				lg:                temp.Logs.logger(cfg.Logger, LogScopeRaft),
 				isIDRemoved:       func(id uint64) bool { return temp.CL.IsIDRemoved(types.ID(id)) },
 				RaftNodeInterFace: temp.N,
 				heartbeat:         heartbeat,
+				manualTicks:       cfg.ManualTicks,
 				raftStorage:       temp.S,
 				storage:           NewStorage(temp.W, temp.SS),
+				admission:         adm,
+				latency:           temp.Latency,
+				faults:            temp.Faults,
+				asyncWrites:       cfg.ExperimentalAsyncStorageWrites,
 			},
 		),
 		id:                 temp.ID,
@@ -528,22 +582,39 @@ func NewServer(cfg config.ServerConfig) (srv *EtcdServer, err error) {
 		AccessController:   &AccessController{CORS: cfg.CORS, HostWhitelist: cfg.HostWhitelist},
 		consistIndex:       temp.CI,
 		firstCommitInTermC: make(chan struct{}),
-	}
-	srv.applyV2 = NewApplierV2(cfg.Logger, srv.v2store, srv.cluster)
+		readOnly:           temp.RO,
+		admission:          adm,
+		crash:              cr,
+		latency:            temp.Latency,
+		logScopes:          temp.Logs,
+		startup:            temp.Startup,
+		faults:             temp.Faults,
+	}
+	temp.Faults.peers = srv
+	cr.setServer(srv)
+	srv.applyV2 = NewApplierV2(temp.Logs.logger(cfg.Logger, LogScopeApply), srv.v2store, srv.cluster)
 
 	srv.backend = temp.BE
 	srv.beHooks = temp.BeHooks
+	srv.loadReplicaPromoted()
 	// 可能为了确保发生leader选举时,lease不会过期,最小ttl应该比选举时间长,看代码
 	minTTL := time.Duration((3*cfg.ElectionTicks)/2) * heartbeat
 	// 默认的情况下应该是2s,
 
+	srv.startup.enter(StartupPhaseRebuildingIndex)
 	// 始终在KV之前恢复出租人.当我们恢复mvcc.KV时,它将把钥匙重新连接到它的租约上.如果我们先恢复mvcc.KV,它将在恢复前把钥匙附加到错误的出租人上.
-	srv.lessor = lease.NewLessor(srv.Logger(), srv.backend, srv.cluster, lease.LessorConfig{
-		MinLeaseTTL:                int64(math.Ceil(minTTL.Seconds())),
-		CheckpointInterval:         cfg.LeaseCheckpointInterval,
-		CheckpointPersist:          cfg.LeaseCheckpointPersist,
-		ExpiredLeasesRetryInterval: srv.Cfg.ReqTimeout(),
+	srv.lessor = lease.NewLessor(temp.Logs.logger(cfg.Logger, LogScopeLease), srv.backend, srv.cluster, lease.LessorConfig{
+		MinLeaseTTL:                    int64(math.Ceil(minTTL.Seconds())),
+		CheckpointInterval:             cfg.LeaseCheckpointInterval,
+		CheckpointPersist:              cfg.LeaseCheckpointPersist,
+		ConsolidatedCheckpointInterval: cfg.LeaseConsolidatedCheckpointInterval,
+		ExpiredLeasesRevokeRate:        cfg.LeaseRevokeRate,
+		ExpiredLeasesRetryInterval:     srv.Cfg.ReqTimeout(),
+		RestoreWorkers:                 cfg.RestoreWorkers,
 	})
+	srv.leaseEvents = newLeaseEventHub()
+	srv.events = newServerEventHub(srv.Logger())
+	srv.lessor.SetEventNotifier(srv.leaseEvents.notify)
 
 	tp, err := auth.NewTokenProvider(cfg.Logger, cfg.AuthToken, // 认证格式  simple、jwt
 		func(index uint64) <-chan struct{} {
@@ -556,7 +627,7 @@ func NewServer(cfg config.ServerConfig) (srv *EtcdServer, err error) {
 		return nil, err
 	}
 	// watch | kv ...
-	srv.kv = mvcc.New(srv.Logger(), srv.backend, srv.lessor, mvcc.StoreConfig{CompactionBatchLimit: cfg.CompactionBatchLimit})
+	srv.kv = mvcc.New(temp.Logs.logger(cfg.Logger, LogScopeMvcc), srv.backend, srv.lessor, mvcc.StoreConfig{CompactionBatchLimit: cfg.CompactionBatchLimit, ReadCacheBytes: cfg.ReadCacheBytes, RestoreWorkers: cfg.RestoreWorkers})
 
 	kvindex := temp.CI.ConsistentIndex()
 	srv.lg.Debug("恢复consistentIndex", zap.Uint64("index", kvindex))
@@ -574,7 +645,45 @@ func NewServer(cfg config.ServerConfig) (srv *EtcdServer, err error) {
 		}
 	}
 
-	srv.authStore = auth.NewAuthStore(srv.Logger(), srv.backend, tp, int(cfg.BcryptCost)) // BcryptCost 为散列身份验证密码指定bcrypt算法的成本/强度默认10
+	authOpts := []auth.StoreOption{auth.WithSPIFFEUserMapping(cfg.AuthSPIFFEUserMapping)}
+	if cfg.AuthWebhookURL != "" {
+		a, err := auth.NewWebhookAuthenticator(cfg.Logger, auth.WebhookConfig{
+			URL:           cfg.AuthWebhookURL,
+			CAFile:        cfg.AuthWebhookCAFile,
+			Timeout:       cfg.AuthWebhookTimeout,
+			CacheTTL:      cfg.AuthWebhookCacheTTL,
+			FailurePolicy: cfg.AuthWebhookFailurePolicy,
+		})
+		if err != nil {
+			return nil, err
+		}
+		authOpts = append(authOpts, auth.WithAuthenticator(a))
+	}
+	authOpts = append(authOpts, auth.WithPasswordPolicy(auth.PasswordPolicy{
+		MinLength:        cfg.AuthPasswordMinLength,
+		MinClasses:       cfg.AuthPasswordMinClasses,
+		MaxAge:           cfg.AuthPasswordMaxAge,
+		LockoutThreshold: cfg.AuthLockoutThreshold,
+		LockoutDuration:  cfg.AuthLockoutDuration,
+	}))
+	ttlOverrides, err := auth.ParseTokenTTLOverrides(cfg.AuthTokenTTLOverrides)
+	if err != nil {
+		return nil, err
+	}
+	if srv.watchLimits.overrides, err = ParseWatchLimitOverrides(cfg.WatchLimitOverrides); err != nil {
+		return nil, err
+	}
+	srv.watchLimits.maxPerConn, srv.watchLimits.maxPerUser = cfg.WatchMaxPerConnection, cfg.WatchMaxPerUser
+	admissionSpecs, err := ParseAdmissionPlugins(cfg.AdmissionPlugins)
+	if err != nil {
+		return nil, err
+	}
+	if srv.validators, err = loadAdmissionPlugins(admissionSpecs); err != nil {
+		return nil, err
+	}
+	authOpts = append(authOpts, auth.WithTokenTTLOverrides(ttlOverrides), auth.WithRefreshTokenTTL(cfg.AuthRefreshTokenTTL))
+	authOpts = append(authOpts, auth.WithDenialAudit(auth.DenialAudit{SampleRate: cfg.AuthAuditSampleRate, MaxEntries: cfg.AuthAuditMaxEntries}))
+	srv.authStore = auth.NewAuthStore(temp.Logs.logger(cfg.Logger, LogScopeAuth), srv.backend, tp, int(cfg.BcryptCost), authOpts...) // BcryptCost 为散列身份验证密码指定bcrypt算法的成本/强度默认10
 
 	newSrv := srv // since srv == nil in defer if srv is returned as nil
 	defer func() {
@@ -585,7 +694,7 @@ func NewServer(cfg config.ServerConfig) (srv *EtcdServer, err error) {
 		}
 	}()
 	if num := cfg.AutoCompactionRetention; num != 0 {
-		srv.compactor, err = v3compactor.New(cfg.Logger, cfg.AutoCompactionMode, num, srv.kv, srv)
+		srv.compactor, err = v3compactor.New(cfg.Logger, cfg.AutoCompactionMode, num, srv.kv, holdingCompactable{s: srv})
 		if err != nil {
 			return nil, err
 		}
@@ -610,7 +719,7 @@ func NewServer(cfg config.ServerConfig) (srv *EtcdServer, err error) {
 
 	// TODO: move transport initialization near the definition of remote
 	tr := &rafthttp.Transport{
-		Logger:      cfg.Logger,
+		Logger:      temp.Logs.logger(cfg.Logger, LogScopeRafthttp),
 		TLSInfo:     cfg.PeerTLSInfo,
 		DialTimeout: cfg.PeerDialTimeout(),
 		ID:          temp.ID,
@@ -621,6 +730,13 @@ func NewServer(cfg config.ServerConfig) (srv *EtcdServer, err error) {
 		ServerStats: serverStats,
 		LeaderStats: leaderStats,
 		ErrorC:      srv.errorc,
+
+		PeerTransport: cfg.PeerTransport,
+		BatchInterval: cfg.PeerBatchInterval,
+		BatchBytes:    cfg.PeerBatchBytes,
+	}
+	if tr.Compression, err = rafthttp.ParsePeerCompression(cfg.PeerCompression); err != nil {
+		return nil, err
 	}
 	if err = tr.Start(); err != nil {
 		return nil, err
@@ -740,6 +856,38 @@ func (s *EtcdServer) Start() {
 	s.GoAttach(s.linearizableReadLoop)
 	s.GoAttach(s.monitorKVHash)
 	s.GoAttach(s.monitorDowngrade)
+	s.GoAttach(s.monitorMemberHealth)
+	s.GoAttach(s.monitorLearnerPromotion)
+	s.GoAttach(s.monitorTopology)
+	s.GoAttach(s.monitorClockSkew)
+	s.GoAttach(s.monitorBackup)
+	s.GoAttach(s.monitorNotify)
+	s.GoAttach(s.resumeDowngradeTranslation)
+	s.GoAttach(s.revokeExpiredLeases)
+	s.GoAttach(func() { s.events.run(s.stopping) })
+}
+
+// revokeExpiredLeases 把lessor给出的一批过期租约(最早过期的在前)按顺序放进一个raft请求撤销;
+// 一批没处理完之前不接收下一批,lessor会推迟发送,避免大量租约同时过期时的删除风暴压垮apply和watcher
+func (s *EtcdServer) revokeExpiredLeases() {
+	if s.lessor == nil {
+		return
+	}
+	lg := s.Logger()
+	for {
+		select {
+		case leases := <-s.lessor.ExpiredLeasesC():
+			ids := make([]int64, 0, len(leases))
+			for _, l := range leases {
+				ids = append(ids, int64(l.ID))
+			}
+			if err := s.revokeExpiredBatch(s.authStore.WithRoot(s.ctx), ids); err != nil {
+				lg.Warn("移除过期租约失败", zap.Int("leases", len(ids)), zap.Error(err))
+			}
+		case <-s.stopping:
+			return
+		}
+	}
 }
 
 func (s *EtcdServer) start() {
@@ -826,6 +974,16 @@ func (s *EtcdServer) RaftHandler() http.Handler {
 	return s.r.transport.Handler()
 }
 
+// RegisterRaftGRPC 在peer端口的gRPC服务上注册raft消息流
+func (s *EtcdServer) RegisterRaftGRPC(gs *grpc.Server) {
+	s.r.transport.RegisterGRPC(gs)
+}
+
+// PeerStats 返回本成员到各个对端的网络状况
+func (s *EtcdServer) PeerStats() []rafthttp.PeerStats {
+	return s.r.transport.PeerStats()
+}
+
 type ServerPeerV2 interface {
 	ServerPeer
 	HashKVHandler() http.Handler
@@ -860,12 +1018,15 @@ type raftReadyHandler struct {
 }
 
 func (s *EtcdServer) run() {
+	defer s.crash.recoverPanic()
 	lg := s.Logger()
 
 	sn, err := s.r.raftStorage.Snapshot()
 	if err != nil {
 		lg.Panic("从Raft存储获取快照失败", zap.Error(err))
 	}
+	hs, _, _ := s.r.raftStorage.InitialState()
+	s.startup.beginReplay(sn.Metadata.Index, hs.Commit)
 
 	// asynchronously accept apply packets, dispatch progress in-order
 	sched := schedule.NewFIFOScheduler()
@@ -898,6 +1059,10 @@ func (s *EtcdServer) run() {
 					s.compactor.Pause()
 				}
 				setSyncC(nil)
+				if s.isLeaderEvent {
+					s.isLeaderEvent = false
+					s.notifyEvent(Event{Type: EventLostLeader})
+				}
 			} else {
 				if newLeader {
 					t := time.Now()
@@ -909,6 +1074,10 @@ func (s *EtcdServer) run() {
 				if s.compactor != nil {
 					s.compactor.Resume()
 				}
+				if !s.isLeaderEvent {
+					s.isLeaderEvent = true
+					s.notifyEvent(Event{Type: EventBecameLeader})
+				}
 			}
 			if newLeader {
 				s.leaderChangedMu.Lock()
@@ -944,6 +1113,7 @@ func (s *EtcdServer) run() {
 		close(s.stopping)
 		s.wgMu.Unlock()
 		s.cancel()
+		s.faults.clear()
 		sched.Stop()
 
 		// wait for gouroutines before closing raft so wal stays open
@@ -959,11 +1129,6 @@ func (s *EtcdServer) run() {
 
 		close(s.done)
 	}()
-	var expiredLeaseC <-chan []*lease.Lease // 返回一个用于接收过期租约的CHAN.
-	if s.lessor != nil {                    // v3用,作用是实现过期时间
-		expiredLeaseC = s.lessor.ExpiredLeasesC()
-	}
-
 	for {
 		select {
 		case ap := <-s.r.apply():
@@ -976,28 +1141,6 @@ func (s *EtcdServer) run() {
 				s.applyAll(&ep, &ap)
 			}
 			sched.Schedule(f)
-		case leases := <-expiredLeaseC:
-			s.GoAttach(func() {
-				// 通过并行化增加过期租约删除过程的吞吐量
-				c := make(chan struct{}, maxPendingRevokes) // 控制每一批  并发数为16
-				for _, lease := range leases {
-					select {
-					case c <- struct{}{}:
-					case <-s.stopping:
-						return
-					}
-					lid := lease.ID
-					s.GoAttach(func() {
-						ctx := s.authStore.WithRoot(s.ctx)
-						_, lerr := s.LeaseRevoke(ctx, &pb.LeaseRevokeRequest{ID: int64(lid)})
-						if lerr == nil {
-						} else {
-							lg.Warn("移除租约失败", zap.String("lease-id", fmt.Sprintf("%016x", lid)), zap.Error(lerr))
-						}
-						<-c
-					})
-				}
-			})
 		case err := <-s.errorc:
 			lg.Warn("etcd error", zap.Error(err))
 			lg.Warn("本机使用的data-dir必须移除")
@@ -1035,8 +1178,12 @@ func (s *EtcdServer) Cleanup() {
 }
 
 func (s *EtcdServer) applyAll(ep *etcdProgress, apply *apply) {
+	if !s.faults.waitApply(s.stopping) {
+		return
+	}
 	s.applySnapshot(ep, apply) // 从持久化的内存存储中恢复出快照
 	s.applyEntries(ep, apply)
+	s.startup.applied(ep.appliedi)
 
 	s.applyWait.Trigger(ep.appliedi)
 
@@ -1138,6 +1285,8 @@ func (s *EtcdServer) applySnapshot(ep *etcdProgress, apply *apply) {
 
 	lg.Info("restored alarm store")
 
+	s.loadReplicaPromoted()
+
 	if s.authStore != nil {
 		lg.Info("restoring auth store")
 
@@ -1151,6 +1300,9 @@ func (s *EtcdServer) applySnapshot(ep *etcdProgress, apply *apply) {
 		lg.Panic("failed to restore v2 store", zap.Error(err))
 	}
 
+	if err := dropMigratedV2StoreContent(lg, s.v2store, newbe, s.Cfg.V2Deprecation); err != nil {
+		lg.Panic("failed to drop migrated v2store content", zap.Error(err))
+	}
 	if err := assertNoV2StoreContent(lg, s.v2store, s.Cfg.V2Deprecation); err != nil {
 		lg.Panic("illegal v2store content", zap.Error(err))
 	}
@@ -1375,7 +1527,7 @@ func (s *EtcdServer) checkMembershipOperationPermission(ctx context.Context) err
 		return err
 	}
 
-	return s.AuthStore().IsAdminPermitted(authInfo)
+	return s.AuthStore().IsOpPermitted(authInfo, auth.OpMember)
 }
 
 // 检查learner是否追上了leader
@@ -1550,6 +1702,7 @@ func (s *EtcdServer) publish(timeout time.Duration) {
 		cancel()
 		switch err {
 		case nil:
+			s.startup.enter(StartupPhaseReady)
 			close(s.readych)
 			lg.Info(
 				"published local member to cluster through raft",
@@ -1631,6 +1784,7 @@ func (s *EtcdServer) apply(es []raftpb.Entry, confState *raftpb.ConfState) (appl
 	for i := range es {
 		e := es[i]
 		s.lg.Debug("开始应用日志", zap.Uint64("index", e.Index), zap.Uint64("term", e.Term), zap.Stringer("type", e.Type))
+		s.crash.recordApplied(&e)
 		switch e.Type {
 		case raftpb.EntryNormal:
 			s.applyEntryNormal(&e)
@@ -1654,10 +1808,22 @@ func (s *EtcdServer) apply(es []raftpb.Entry, confState *raftpb.ConfState) (appl
 			shouldStop = shouldStop || removedSelf
 			s.w.Trigger(cc.ID, &confChangeResponse{s.cluster.Members(), err})
 
+		case raftpb.EntryConfChangeV2:
+			shouldApplyV3 := membership.ApplyV2storeOnly
+			if e.Index > s.consistIndex.ConsistentIndex() {
+				s.consistIndex.SetConsistentIndex(e.Index, e.Term)
+				shouldApplyV3 = membership.ApplyBoth
+			}
+			// 批量成员变更的请求方在 applyConfChangeV2 中通知
+			removedSelf := s.applyConfChangeV2(&e, confState, shouldApplyV3)
+			s.setAppliedIndex(e.Index)
+			s.setTerm(e.Term)
+			shouldStop = shouldStop || removedSelf
+
 		default:
 			lg := s.Logger()
 			lg.Panic(
-				"未知的日志类型;必须是 EntryNormal 或 EntryConfChange",
+				"未知的日志类型;必须是 EntryNormal、EntryConfChange 或 EntryConfChangeV2",
 				zap.String("type", e.Type.String()),
 			)
 		}
@@ -1759,6 +1925,10 @@ func (s *EtcdServer) MendPeer(id types.ID) {
 	}
 }
 
+// AdvanceTicks advances the raft clock by ticks. It is meant to drive a
+// server started with ManualTicks from tests.
+func (s *EtcdServer) AdvanceTicks(ticks int) { s.r.advanceTicks(ticks) }
+
 func (s *EtcdServer) PauseSending() { s.r.pauseSending() }
 
 func (s *EtcdServer) ResumeSending() { s.r.resumeSending() }
@@ -1802,6 +1972,10 @@ func (s *EtcdServer) monitorVersions() {
 		}
 
 		if v != nil && membership.IsValidVersionChange(s.cluster.Version(), v) {
+			// 手动提升时只处理降级,升级需要通过 Downgrade PROMOTE 请求完成
+			if s.Cfg.ManualClusterVersionPromotion && s.cluster.Version().LessThan(*v) {
+				continue
+			}
 			s.GoAttach(func() { s.updateClusterVersionV2(v.String()) })
 		}
 	}
@@ -1990,10 +2164,12 @@ func (s *EtcdServer) applyEntryNormal(e *raftpb.Entry) {
 		var r pb.Request
 		rp := &r
 		pbutil.MustUnmarshal(rp, e.Data)
+		s.crash.setAppliedOp(e.Index, "v2")
 		s.w.Trigger(r.ID, s.applyV2Request((*RequestV2)(rp), shouldApplyV3))
 		fmt.Println("pbutil.MustUnmarshal return")
 		return
 	}
+	s.crash.setAppliedOp(e.Index, raftRequestOp(&raftReq))
 	// 如果能
 	//{"header":{"ID":7587861231285799685},"put":{"key":"YQ==","value":"Yg=="}}
 	if raftReq.V2 != nil {
@@ -2013,7 +2189,19 @@ func (s *EtcdServer) applyEntryNormal(e *raftpb.Entry) {
 		if !needResult && raftReq.Txn != nil {
 			removeNeedlessRangeReqs(raftReq.Txn)
 		}
-		ar = s.applyV3.Apply(&raftReq, shouldApplyV3)
+		if shouldApplyV3 {
+			s.saveBucketIndex(&raftReq, e.Index)
+		}
+		start := time.Now()
+		ar = s.applyV3Request(&raftReq, shouldApplyV3)
+		if ar != nil {
+			ar.applyStart = start
+		}
+		took := time.Since(start)
+		s.latency.observe(latencyApply, took)
+		if d := s.warningApplyDuration(); d > 0 && took > d {
+			s.Logger().Warn("apply 耗时过长", zap.Duration("took", took), zap.Duration("expected-duration", d), zap.Uint64("index", e.Index))
+		}
 	}
 
 	if !shouldApplyV3 { //  是否存储到bolt.db
@@ -2023,7 +2211,6 @@ func (s *EtcdServer) applyEntryNormal(e *raftpb.Entry) {
 	if ar == nil {
 		return
 	}
-
 	if ar.err != ErrNoSpace || len(s.alarmStore.Get(pb.AlarmType_NOSPACE)) > 0 {
 		s.w.Trigger(id, ar)
 		return
@@ -2118,16 +2305,19 @@ func (s *EtcdServer) applyConfChange(cc raftpb.ConfChangeV1, confState *raftpb.C
 		}
 		if confChangeContext.IsPromote { // 是否角色提升
 			s.cluster.PromoteMember(confChangeContext.Member.ID, shouldApplyV3)
+			s.notifyMemberChange(shouldApplyV3, confChangeContext.Member.ID, MemberPromoted)
 		} else {
 			s.cluster.AddMember(&confChangeContext.Member, shouldApplyV3) // 添加节点  /0/members/8e9e05c52164694d
 			if confChangeContext.Member.ID != s.id {                      // 不是本实例
 				s.r.transport.AddPeer(confChangeContext.Member.ID, confChangeContext.PeerURLs)
 			}
+			s.notifyMemberChange(shouldApplyV3, confChangeContext.Member.ID, MemberAdded)
 		}
 
 	case raftpb.ConfChangeRemoveNode:
 		id := types.ID(cc.NodeID)
 		s.cluster.RemoveMember(id, shouldApplyV3) // ✅
+		s.notifyMemberChange(shouldApplyV3, id, MemberRemoved)
 		if id == s.id {
 			return true, nil
 		}
@@ -2145,6 +2335,7 @@ func (s *EtcdServer) applyConfChange(cc raftpb.ConfChangeV1, confState *raftpb.C
 			)
 		}
 		s.cluster.UpdateRaftAttributes(m.ID, m.RaftAttributes, shouldApplyV3)
+		s.notifyMemberChange(shouldApplyV3, m.ID, MemberUpdated)
 		if m.ID != s.id {
 			s.r.transport.UpdatePeer(m.ID, m.PeerURLs)
 		}
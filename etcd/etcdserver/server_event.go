@@ -0,0 +1,240 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdserver
+
+import (
+	"sync"
+
+	"github.com/ls-2018/etcd_cn/client_sdk/pkg/types"
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver/api/membership"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+
+	"github.com/gogo/protobuf/proto"
+	"go.uber.org/zap"
+)
+
+// EventType is the type of a server lifecycle event.
+type EventType int
+
+const (
+	// EventBecameLeader is sent when the local member becomes the raft leader.
+	EventBecameLeader EventType = iota + 1
+	// EventLostLeader is sent when the local member steps down from leadership.
+	EventLostLeader
+	// EventMembershipChanged is sent after a membership change is applied.
+	EventMembershipChanged
+	// EventCompactionFinished is sent after a compaction is applied and written to disk.
+	EventCompactionFinished
+	// EventCorruptionAlarm is sent when a CORRUPT alarm is activated.
+	EventCorruptionAlarm
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventBecameLeader:
+		return "became-leader"
+	case EventLostLeader:
+		return "lost-leader"
+	case EventMembershipChanged:
+		return "membership-changed"
+	case EventCompactionFinished:
+		return "compaction-finished"
+	case EventCorruptionAlarm:
+		return "corruption-alarm"
+	}
+	return "unknown"
+}
+
+// MemberChangeType describes the kind of an EventMembershipChanged event.
+type MemberChangeType int
+
+const (
+	MemberAdded MemberChangeType = iota + 1
+	MemberPromoted
+	MemberRemoved
+	MemberUpdated
+)
+
+// Event is a server lifecycle event delivered to handlers registered
+// with RegisterEventHandler.
+type Event struct {
+	Type EventType
+	// MemberID is the changed member for EventMembershipChanged and the
+	// reporting member for EventCorruptionAlarm.
+	MemberID types.ID
+	// MemberChange is only set for EventMembershipChanged.
+	MemberChange MemberChangeType
+	// Revision is the compacted revision for EventCompactionFinished.
+	Revision int64
+	// Term is the raft term when the event was generated.
+	Term uint64
+}
+
+// ApplyInterceptor intercepts the apply of a v3 raft request. apply runs the
+// regular apply and returns its result; the interceptor may inspect or replace
+// the result, or reject the request by returning an error without calling apply.
+// It runs on every member in the apply loop, so it must be deterministic and fast.
+//
+// Experimental.
+type ApplyInterceptor func(r *pb.InternalRaftRequest, apply func() (proto.Message, error)) (proto.Message, error)
+
+// ApplyObserver is called after a v3 raft request has been applied with its
+// final result, after the ApplyInterceptor if any. Observers are called in the
+// order they were added, on every member in the apply loop, so they must be
+// fast and must not modify r or resp.
+//
+// Experimental.
+type ApplyObserver func(r *pb.InternalRaftRequest, resp proto.Message, err error)
+
+// serverEventBufLen 事件缓存长度,分发跟不上时丢弃新事件
+const serverEventBufLen = 128
+
+// serverEventHub 把server事件按产生顺序异步分发给注册的handler,不阻塞raft和apply
+type serverEventHub struct {
+	lg       *zap.Logger
+	mu       sync.RWMutex
+	nextID   int
+	handlers map[int]func(Event)
+	evc      chan Event
+}
+
+func newServerEventHub(lg *zap.Logger) *serverEventHub {
+	return &serverEventHub{
+		lg:       lg,
+		handlers: make(map[int]func(Event)),
+		evc:      make(chan Event, serverEventBufLen),
+	}
+}
+
+func (h *serverEventHub) register(f func(Event)) (unregister func()) {
+	h.mu.Lock()
+	id := h.nextID
+	h.nextID++
+	h.handlers[id] = f
+	h.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.handlers, id)
+			h.mu.Unlock()
+		})
+	}
+}
+
+func (h *serverEventHub) notify(ev Event) {
+	h.mu.RLock()
+	n := len(h.handlers)
+	h.mu.RUnlock()
+	if n == 0 {
+		return
+	}
+	select {
+	case h.evc <- ev:
+	default:
+		h.lg.Warn("事件处理过慢,丢弃事件", zap.String("event", ev.Type.String()))
+	}
+}
+
+func (h *serverEventHub) run(stopping <-chan struct{}) {
+	for {
+		select {
+		case ev := <-h.evc:
+			h.mu.RLock()
+			fs := make([]func(Event), 0, len(h.handlers))
+			for _, f := range h.handlers {
+				fs = append(fs, f)
+			}
+			h.mu.RUnlock()
+			for _, f := range fs {
+				f(ev)
+			}
+		case <-stopping:
+			return
+		}
+	}
+}
+
+// RegisterEventHandler registers f to be called for every server lifecycle
+// event. Handlers are called sequentially from a single goroutine in the order
+// the events happened; a slow handler delays the others and may cause events
+// to be dropped. Events that happened before registration are not replayed.
+// The returned function unregisters f.
+func (s *EtcdServer) RegisterEventHandler(f func(Event)) (unregister func()) {
+	return s.events.register(f)
+}
+
+// SetApplyInterceptor sets the interceptor for v3 raft requests. It must be
+// called before Start.
+//
+// Experimental.
+func (s *EtcdServer) SetApplyInterceptor(ic ApplyInterceptor) {
+	s.interceptor = ic
+}
+
+// AddApplyObserver adds an observer for applied v3 raft requests. It must be
+// called before Start.
+//
+// Experimental.
+func (s *EtcdServer) AddApplyObserver(o ApplyObserver) {
+	s.observers = append(s.observers, o)
+}
+
+func (s *EtcdServer) notifyEvent(ev Event) {
+	if s.events == nil {
+		return
+	}
+	if ev.Term == 0 {
+		ev.Term = s.Term()
+	}
+	s.events.notify(ev)
+}
+
+// applyV3Request 执行apply,设置了拦截器时交给拦截器决定,然后通知观察者
+func (s *EtcdServer) applyV3Request(r *pb.InternalRaftRequest, shouldApplyV3 membership.ShouldApplyV3) *applyResult {
+	ar := s.interceptApplyV3(r, shouldApplyV3)
+	if shouldApplyV3 && ar != nil {
+		for _, o := range s.observers {
+			o(r, ar.resp, ar.err)
+		}
+	}
+	return ar
+}
+
+func (s *EtcdServer) interceptApplyV3(r *pb.InternalRaftRequest, shouldApplyV3 membership.ShouldApplyV3) *applyResult {
+	ic := s.interceptor
+	if ic == nil {
+		return s.applyV3.Apply(r, shouldApplyV3)
+	}
+	var ar *applyResult
+	resp, err := ic(r, func() (proto.Message, error) {
+		ar = s.applyV3.Apply(r, shouldApplyV3)
+		return ar.resp, ar.err
+	})
+	if ar == nil {
+		ar = &applyResult{}
+	}
+	ar.resp, ar.err = resp, err
+	return ar
+}
+
+// notifyMemberChange 重放已经apply过的日志时不再发送事件
+func (s *EtcdServer) notifyMemberChange(shouldApplyV3 membership.ShouldApplyV3, id types.ID, c MemberChangeType) {
+	if !shouldApplyV3 {
+		return
+	}
+	s.notifyEvent(Event{Type: EventMembershipChanged, MemberID: id, MemberChange: c})
+}
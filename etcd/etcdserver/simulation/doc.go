@@ -0,0 +1,47 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package simulation runs the etcdserver apply path of several members in a
+// single goroutine under a deterministic schedule, so that ordering bugs can
+// be found by trying many seeds and replayed from the seed that failed.
+//
+// Every member is a real raft node on an in-memory raft log whose committed
+// entries are applied by the real etcdserver applier (see
+// etcdserver.Replayer) to a backend that is never fsynced. One seeded random
+// source decides every step: ticking the fake clock, delivering, delaying,
+// reordering or dropping raft messages, persisting raft state, applying a
+// batch of committed entries on a member (the apply loop lags behind raft as
+// it does in the server) and starting elections. Elections are only started
+// by the schedule, since the election timeouts of the raft package are not
+// seeded.
+//
+// After every step the invariants are checked: entries are applied without
+// gaps, the consistent index never goes backwards and always matches the
+// applied entry, and all members apply the same entry at the same index.
+// CheckHashes additionally compares the state of members that applied the
+// same index. A violation is reported as an *InvariantError carrying the seed
+// and the step.
+//
+//	s, err := simulation.New(simulation.Config{Seed: seed, Dir: t.TempDir(), DropRate: 0.05})
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	defer s.Close()
+//	s.SetWorkload(func(r *rand.Rand) *pb.InternalRaftRequest {
+//		return &pb.InternalRaftRequest{Put: &pb.PutRequest{Key: fmt.Sprint(r.Intn(10)), Value: "v"}}
+//	})
+//	if err := s.Run(10000); err != nil {
+//		t.Fatal(err) // rerun with the seed in the error to reproduce
+//	}
+package simulation
@@ -0,0 +1,570 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package simulation
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ls-2018/etcd_cn/client_sdk/pkg/types"
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver"
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver/api/membership"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+	"github.com/ls-2018/etcd_cn/pkg/pbutil"
+	"github.com/ls-2018/etcd_cn/raft"
+	"github.com/ls-2018/etcd_cn/raft/raftpb"
+
+	"github.com/jonboulle/clockwork"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultSize         = 3
+	defaultTickInterval = 100 * time.Millisecond
+	defaultMaxDelay     = 10
+	heartbeatTick       = 1
+	// 选举超时远大于模拟的步数,选举只由调度发起
+	electionTick = 1 << 30
+	// traceSize InvariantError 中保留的最近的步骤数
+	traceSize = 64
+)
+
+var ErrNoMember = errors.New("simulation: no member accepted the proposal")
+
+// Config configures a simulation.
+type Config struct {
+	// Seed drives every decision of the simulation. Zero picks a seed from
+	// the current time; Seed returns the one in use.
+	Seed int64
+	// Size is the number of members, 3 by default.
+	Size int
+	// Dir holds the backend files of the members.
+	Dir string
+	// DropRate is the probability that a raft message is lost.
+	DropRate float64
+	// ReorderRate is the probability that a raft message is delayed by up
+	// to MaxDelay steps, so that later messages overtake it.
+	ReorderRate float64
+	MaxDelay    int
+	// CampaignRate is the probability that a step starts an election on a
+	// random member although a leader exists. Without a leader elections are
+	// always possible.
+	CampaignRate float64
+	// TickInterval is how far the fake clock moves on every tick, 100ms by
+	// default.
+	TickInterval time.Duration
+	// HashCheckInterval, if positive, runs CheckHashes every that many steps.
+	HashCheckInterval int
+	Logger            *zap.Logger
+}
+
+// InvariantError reports a violated invariant together with the seed and the
+// step, so that the run can be reproduced.
+type InvariantError struct {
+	Seed   int64
+	Step   int
+	Member int
+	Reason string
+	// Trace holds the most recent steps, oldest first.
+	Trace []string
+}
+
+func (e *InvariantError) Error() string {
+	return fmt.Sprintf("simulation: seed %d step %d member %d: %s\n%s", e.Seed, e.Step, e.Member, e.Reason, strings.Join(e.Trace, "\n"))
+}
+
+// Simulation is a deterministic cluster of etcdserver apply paths.
+type Simulation struct {
+	cfg   Config
+	lg    *zap.Logger
+	rnd   *rand.Rand
+	clock clockwork.FakeClock
+
+	members  []*member
+	net      []envelope
+	cut      map[[2]int]bool
+	workload func(r *rand.Rand) *pb.InternalRaftRequest
+
+	step    int
+	reqID   uint64
+	applied map[uint64]raftpb.Entry // 已经被任一成员应用的日志,用于比较各成员应用的内容
+	trace   []string
+}
+
+type member struct {
+	id      uint64
+	node    *raft.RawNode
+	storage *raft.MemoryStorage
+	rp      *etcdserver.Replayer
+	// pending 已提交、等待应用的日志,模拟落后于raft的apply循环
+	pending []raftpb.Entry
+	applied uint64
+	ci      uint64
+}
+
+// envelope 网络中的一条消息,at 之前不投递
+type envelope struct {
+	from, to int
+	msg      raftpb.Message
+	at       int
+}
+
+// New creates a simulation with bootstrapped members. Call Close to release
+// the backends.
+func New(cfg Config) (*Simulation, error) {
+	if cfg.Size == 0 {
+		cfg.Size = defaultSize
+	}
+	if cfg.TickInterval == 0 {
+		cfg.TickInterval = defaultTickInterval
+	}
+	if cfg.MaxDelay == 0 {
+		cfg.MaxDelay = defaultMaxDelay
+	}
+	if cfg.Seed == 0 {
+		cfg.Seed = time.Now().UnixNano()
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = zap.NewNop()
+	}
+	if cfg.Dir == "" {
+		return nil, errors.New("simulation: Dir is required")
+	}
+	s := &Simulation{
+		cfg:     cfg,
+		lg:      cfg.Logger,
+		rnd:     rand.New(rand.NewSource(cfg.Seed)),
+		clock:   clockwork.NewFakeClock(),
+		cut:     make(map[[2]int]bool),
+		applied: make(map[uint64]raftpb.Entry),
+	}
+	peers := make([]raft.Peer, cfg.Size)
+	for i := range peers {
+		id := uint64(i + 1)
+		ctx, err := json.Marshal(&membership.Member{
+			ID:             types.ID(id),
+			RaftAttributes: membership.RaftAttributes{PeerURLs: []string{fmt.Sprintf("sim://%d", id)}},
+		})
+		if err != nil {
+			return nil, err
+		}
+		peers[i] = raft.Peer{ID: id, Context: ctx}
+	}
+	for i := 0; i < cfg.Size; i++ {
+		m, err := s.newMember(uint64(i+1), peers)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		s.members = append(s.members, m)
+	}
+	s.lg.Info("模拟开始", zap.Int64("seed", cfg.Seed), zap.Int("size", cfg.Size))
+	return s, nil
+}
+
+func (s *Simulation) newMember(id uint64, peers []raft.Peer) (*member, error) {
+	rp, err := etcdserver.NewReplayer(s.lg.Named(fmt.Sprintf("m%d", id)), filepath.Join(s.cfg.Dir, fmt.Sprintf("m%d.db", id)))
+	if err != nil {
+		return nil, err
+	}
+	m := &member{id: id, storage: raft.NewMemoryStorage(), rp: rp}
+	m.node, err = raft.NewRawNode(&raft.Config{
+		ID:              id,
+		ElectionTick:    electionTick,
+		HeartbeatTick:   heartbeatTick,
+		Storage:         m.storage,
+		MaxSizePerMsg:   1024 * 1024,
+		MaxInflightMsgs: 256,
+		Logger:          etcdserver.NewRaftLoggerZap(s.lg.Named(fmt.Sprintf("raft%d", id))),
+	})
+	if err == nil {
+		err = m.node.Bootstrap(peers)
+	}
+	if err != nil {
+		rp.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+// Seed returns the seed in use.
+func (s *Simulation) Seed() int64 { return s.cfg.Seed }
+
+// Clock returns the fake clock of the simulation. It only moves on ticks.
+func (s *Simulation) Clock() clockwork.FakeClock { return s.clock }
+
+// Steps returns the number of steps taken so far.
+func (s *Simulation) Steps() int { return s.step }
+
+// SetWorkload sets the generator of proposals. The simulation calls it with
+// its own random source whenever the schedule decides to propose, so the
+// proposals are part of the reproducible run.
+func (s *Simulation) SetWorkload(f func(r *rand.Rand) *pb.InternalRaftRequest) { s.workload = f }
+
+// Partition splits the members into the given groups; the members not
+// listed in any group form one more group. Messages between groups are
+// dropped. A previous partition is replaced.
+func (s *Simulation) Partition(groups ...[]int) {
+	group := make(map[int]int)
+	for g, idxs := range groups {
+		for _, i := range idxs {
+			group[i] = g + 1
+		}
+	}
+	s.cut = make(map[[2]int]bool)
+	for i := range s.members {
+		for j := range s.members {
+			if i != j && group[i] != group[j] {
+				s.cut[[2]int{i, j}] = true
+			}
+		}
+	}
+	s.record("partition %v", groups)
+}
+
+// Heal removes the partition.
+func (s *Simulation) Heal() {
+	s.cut = make(map[[2]int]bool)
+	s.record("heal")
+}
+
+// Propose proposes r through the member that believes to be the leader, or a
+// random member if none does. The request ID is assigned if it is not set.
+func (s *Simulation) Propose(r *pb.InternalRaftRequest) error {
+	if r.Header == nil {
+		r.Header = &pb.RequestHeader{}
+	}
+	if r.Header.ID == 0 {
+		s.reqID++
+		r.Header.ID = s.reqID
+	}
+	i := s.leader()
+	if i < 0 {
+		i = s.rnd.Intn(len(s.members))
+	}
+	if err := s.members[i].node.Propose(pbutil.MustMarshal(r)); err != nil {
+		s.record("propose %d on m%d: %v", r.Header.ID, i, err)
+		return ErrNoMember
+	}
+	s.record("propose %d on m%d", r.Header.ID, i)
+	return nil
+}
+
+// leader 返回自认为是leader的成员,有多个时返回任期最大的
+func (s *Simulation) leader() int {
+	lead, term := -1, uint64(0)
+	for i, m := range s.members {
+		if st := m.node.BasicStatus(); st.RaftState == raft.StateLeader && st.Term >= term {
+			lead, term = i, st.Term
+		}
+	}
+	return lead
+}
+
+// Run takes n steps, stopping at the first violated invariant.
+func (s *Simulation) Run(n int) error {
+	for i := 0; i < n; i++ {
+		if err := s.Step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 每一步按权重选择一种动作
+const (
+	actTick = iota
+	actDeliver
+	actReady
+	actApply
+	actCampaign
+	actPropose
+)
+
+var actWeights = [...]int{actTick: 10, actDeliver: 40, actReady: 20, actApply: 15, actCampaign: 1, actPropose: 14}
+
+// Step takes one step of the schedule and checks the invariants.
+func (s *Simulation) Step() error {
+	s.step++
+	var enabled []int
+	total := 0
+	for act, w := range actWeights {
+		if s.enabled(act) {
+			enabled = append(enabled, act)
+			total += w
+		}
+	}
+	n := s.rnd.Intn(total)
+	act := enabled[len(enabled)-1]
+	for _, a := range enabled {
+		if n < actWeights[a] {
+			act = a
+			break
+		}
+		n -= actWeights[a]
+	}
+	var err error
+	switch act {
+	case actTick:
+		s.tick()
+	case actDeliver:
+		s.deliver()
+	case actReady:
+		s.ready()
+	case actApply:
+		err = s.apply()
+	case actCampaign:
+		i := s.rnd.Intn(len(s.members))
+		s.record("campaign m%d", i)
+		s.members[i].node.Campaign()
+	case actPropose:
+		s.Propose(s.workload(s.rnd))
+	}
+	if err == nil && s.cfg.HashCheckInterval > 0 && s.step%s.cfg.HashCheckInterval == 0 {
+		err = s.CheckHashes()
+	}
+	return err
+}
+
+func (s *Simulation) enabled(act int) bool {
+	switch act {
+	case actDeliver:
+		for _, e := range s.net {
+			if e.at <= s.step {
+				return true
+			}
+		}
+		return false
+	case actReady:
+		for _, m := range s.members {
+			if m.node.HasReady() {
+				return true
+			}
+		}
+		return false
+	case actApply:
+		for _, m := range s.members {
+			if len(m.pending) > 0 {
+				return true
+			}
+		}
+		return false
+	case actCampaign:
+		return s.leader() < 0 || s.rnd.Float64() < s.cfg.CampaignRate
+	case actPropose:
+		return s.workload != nil
+	}
+	return true
+}
+
+// tick 推进假时钟,所有成员的raft时钟同时前进一次
+func (s *Simulation) tick() {
+	s.clock.Advance(s.cfg.TickInterval)
+	for _, m := range s.members {
+		m.node.Tick()
+	}
+	s.record("tick")
+}
+
+// deliver 随机投递一条已经到期的消息,后发的消息可能先到
+func (s *Simulation) deliver() {
+	var due []int
+	for i, e := range s.net {
+		if e.at <= s.step {
+			due = append(due, i)
+		}
+	}
+	k := due[s.rnd.Intn(len(due))]
+	e := s.net[k]
+	s.net = append(s.net[:k], s.net[k+1:]...)
+	if s.cut[[2]int{e.from, e.to}] {
+		s.record("cut %s m%d->m%d", e.msg.Type, e.from, e.to)
+		s.members[e.from].node.ReportUnreachable(e.msg.To)
+		return
+	}
+	s.record("deliver %s m%d->m%d term=%d index=%d", e.msg.Type, e.from, e.to, e.msg.Term, e.msg.Index)
+	s.members[e.to].node.Step(e.msg)
+}
+
+// ready 处理一个成员的Ready: 保存raft状态,发送消息,把已提交的日志交给apply循环
+func (s *Simulation) ready() {
+	var ready []int
+	for i, m := range s.members {
+		if m.node.HasReady() {
+			ready = append(ready, i)
+		}
+	}
+	i := ready[s.rnd.Intn(len(ready))]
+	m := s.members[i]
+	rd := m.node.Ready()
+	if !raft.IsEmptyHardState(rd.HardState) {
+		m.storage.SetHardState(rd.HardState)
+	}
+	m.storage.Append(rd.Entries)
+	for _, msg := range rd.Messages {
+		s.send(i, msg)
+	}
+	m.pending = append(m.pending, rd.CommittedEntries...)
+	m.node.Advance(rd)
+	s.record("ready m%d entries=%d committed=%d messages=%d", i, len(rd.Entries), len(rd.CommittedEntries), len(rd.Messages))
+}
+
+func (s *Simulation) send(from int, msg raftpb.Message) {
+	to := int(msg.To) - 1
+	if s.rnd.Float64() < s.cfg.DropRate {
+		s.record("drop %s m%d->m%d", msg.Type, from, to)
+		return
+	}
+	at := s.step
+	if s.rnd.Float64() < s.cfg.ReorderRate {
+		at += 1 + s.rnd.Intn(s.cfg.MaxDelay)
+	}
+	s.net = append(s.net, envelope{from: from, to: to, msg: msg, at: at})
+}
+
+// apply 在一个成员上应用一批已提交的日志并检查不变量
+func (s *Simulation) apply() error {
+	var ready []int
+	for i, m := range s.members {
+		if len(m.pending) > 0 {
+			ready = append(ready, i)
+		}
+	}
+	i := ready[s.rnd.Intn(len(ready))]
+	m := s.members[i]
+	n := 1 + s.rnd.Intn(len(m.pending))
+	ents := m.pending[:n]
+	m.pending = m.pending[n:]
+	for _, e := range ents {
+		if e.Index != m.applied+1 {
+			return s.violation(i, "applied entry %d after %d", e.Index, m.applied)
+		}
+		if prev, ok := s.applied[e.Index]; ok {
+			if prev.Term != e.Term || prev.Type != e.Type || !bytes.Equal(prev.Data, e.Data) {
+				return s.violation(i, "entry %d (term %d) differs from the entry applied by another member (term %d)", e.Index, e.Term, prev.Term)
+			}
+		} else {
+			s.applied[e.Index] = e
+		}
+		op := m.rp.Apply(e)
+		if e.Type == raftpb.EntryConfChange {
+			var cc raftpb.ConfChangeV1
+			pbutil.MustUnmarshal(&cc, e.Data)
+			m.node.ApplyConfChange(cc)
+		}
+		ci := m.rp.ConsistentIndex()
+		if ci < m.ci {
+			return s.violation(i, "consistent index went back from %d to %d", m.ci, ci)
+		}
+		if ci != e.Index {
+			return s.violation(i, "consistent index %d after applying entry %d", ci, e.Index)
+		}
+		m.applied, m.ci = e.Index, ci
+		s.record("apply m%d index=%d term=%d op=%s", i, e.Index, e.Term, op)
+	}
+	return nil
+}
+
+// CheckHashes compares the state of the members that applied the same index.
+func (s *Simulation) CheckHashes() error {
+	type state struct {
+		member int
+		hash   uint32
+		rev    int64
+	}
+	seen := make(map[uint64]state)
+	for i, m := range s.members {
+		hash, rev, _, err := m.rp.HashByRev(0)
+		if err != nil {
+			return s.violation(i, "hash: %v", err)
+		}
+		if st, ok := seen[m.applied]; ok && (st.hash != hash || st.rev != rev) {
+			return s.violation(i, "state at index %d (rev %d, hash %x) differs from m%d (rev %d, hash %x)",
+				m.applied, rev, hash, st.member, st.rev, st.hash)
+		}
+		seen[m.applied] = state{member: i, hash: hash, rev: rev}
+	}
+	return nil
+}
+
+// Converge heals the partition and takes up to maxSteps steps without
+// drops, reordering and new proposals until every member applied everything
+// that was committed, then compares the states.
+func (s *Simulation) Converge(maxSteps int) error {
+	s.Heal()
+	drop, reorder, workload := s.cfg.DropRate, s.cfg.ReorderRate, s.workload
+	s.cfg.DropRate, s.cfg.ReorderRate, s.workload = 0, 0, nil
+	defer func() { s.cfg.DropRate, s.cfg.ReorderRate, s.workload = drop, reorder, workload }()
+	for i := 0; i < maxSteps && !s.converged(); i++ {
+		if err := s.Step(); err != nil {
+			return err
+		}
+	}
+	if !s.converged() {
+		return s.violation(-1, "members did not converge within %d steps", maxSteps)
+	}
+	return s.CheckHashes()
+}
+
+// converged 有leader,所有成员都应用到了leader的提交索引
+func (s *Simulation) converged() bool {
+	lead := s.leader()
+	if lead < 0 {
+		return false
+	}
+	commit := s.members[lead].node.BasicStatus().Commit
+	for _, m := range s.members {
+		if m.node.HasReady() || len(m.pending) > 0 || m.applied != commit {
+			return false
+		}
+	}
+	return true
+}
+
+// Close releases the backends. The backend files are left in Dir.
+func (s *Simulation) Close() error {
+	var err error
+	for _, m := range s.members {
+		if cerr := m.rp.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (s *Simulation) record(format string, args ...interface{}) {
+	s.trace = append(s.trace, fmt.Sprintf("%d: ", s.step)+fmt.Sprintf(format, args...))
+	if len(s.trace) > traceSize {
+		s.trace = s.trace[len(s.trace)-traceSize:]
+	}
+}
+
+func (s *Simulation) violation(member int, format string, args ...interface{}) error {
+	err := &InvariantError{
+		Seed:   s.cfg.Seed,
+		Step:   s.step,
+		Member: member,
+		Reason: fmt.Sprintf(format, args...),
+		Trace:  append([]string(nil), s.trace...),
+	}
+	s.lg.Warn("违反不变量", zap.Int64("seed", err.Seed), zap.Int("step", err.Step), zap.Int("member", member), zap.String("reason", err.Reason))
+	return err
+}
@@ -0,0 +1,95 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdserver
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/ls-2018/etcd_cn/etcd/mvcc/buckets"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+)
+
+// 快照会话: 固定一个修订版本并在有效期内保护它不被自动压缩,带有会话token的Range在这个修订版本上读取,
+// 跨多次分页请求的列表和备份因此是一致的. 会话就是owner为 snapshotSessionOwnerPrefix+token 的压缩保留,
+// 数量、有效期和落后的修订版本受同样的限制.
+
+// snapshotSessionOwnerPrefix 快照会话对应的压缩保留的owner前缀
+const snapshotSessionOwnerPrefix = "snapshot-session/"
+
+// SnapshotSession 创建、续期或释放快照会话;token为空时创建新的会话
+func (s *EtcdServer) SnapshotSession(ctx context.Context, r *pb.SnapshotSessionRequest) (*pb.SnapshotSessionResponse, error) {
+	token := r.Token
+	if token == "" {
+		if r.Release {
+			return nil, ErrSnapshotSessionNotFound
+		}
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		token = hex.EncodeToString(b)
+	}
+	hr := &pb.CompactionHoldRequest{Owner: snapshotSessionOwnerPrefix + token, Revision: r.Revision, TTL: r.TTL, Release: r.Release}
+	if r.Token != "" && !r.Release {
+		// 续期时保持原来的修订版本;先读到最新的状态,刚创建的会话在落后的成员上也能找到
+		if err := s.linearizeReadNotify(ctx); err != nil {
+			return nil, err
+		}
+		h, ok := s.compactionHold(hr.Owner)
+		if !ok {
+			return nil, ErrSnapshotSessionNotFound
+		}
+		hr.Revision = h.Revision
+	}
+	ir, err := s.newCompactionHoldRequest(hr)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = s.raftRequest(ctx, pb.InternalRaftRequest{CompactionHold: ir}); err != nil {
+		return nil, err
+	}
+	s.updateCompactionHoldMetrics(s.CompactionHolds())
+	return &pb.SnapshotSessionResponse{Header: &pb.ResponseHeader{}, Token: token, Revision: ir.Revision, Expires: ir.Expires}, nil
+}
+
+// snapshotSessionRevision 返回会话固定的修订版本,会话不存在或已过期时返回 ErrSnapshotSessionNotFound
+func (s *EtcdServer) snapshotSessionRevision(token string) (int64, error) {
+	h, ok := s.compactionHold(snapshotSessionOwnerPrefix + token)
+	if !ok {
+		return 0, ErrSnapshotSessionNotFound
+	}
+	return h.Revision, nil
+}
+
+// compactionHold 返回owner当前有效的保留
+func (s *EtcdServer) compactionHold(owner string) (*pb.CompactionHold, bool) {
+	tx := s.backend.BatchTx()
+	tx.Lock()
+	tx.UnsafeCreateBucket(buckets.CompactionHold)
+	_, vs := tx.UnsafeRange(buckets.CompactionHold, []byte(owner), nil, 0)
+	tx.Unlock()
+	if len(vs) == 0 {
+		return nil, false
+	}
+	var rec compactionHoldRecord
+	if err := json.Unmarshal(vs[0], &rec); err != nil || rec.Expires <= time.Now().Unix() {
+		return nil, false
+	}
+	return &pb.CompactionHold{Owner: owner, Revision: rec.Revision, Expires: rec.Expires}, true
+}
@@ -0,0 +1,325 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdserver
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	"github.com/ls-2018/etcd_cn/etcd/mvcc/backend"
+	"github.com/ls-2018/etcd_cn/etcd/mvcc/buckets"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+	"github.com/ls-2018/etcd_cn/pkg/traceutil"
+	"go.uber.org/zap"
+)
+
+// 暂存事务: 客户端分多次追加超过 max-txn-ops 的操作,每次追加通过raft记录在 staged_txn bucket 中;
+// 提交时在一个raft日志中读出全部操作,作为一个事务原子地应用.未提交的暂存事务过期后被清理.
+// bucket 中 8 字节的键保存暂存事务的元数据,8 字节ID加 4 字节序号的键保存每次追加的操作.
+
+const (
+	// stagedTxnTTL 暂存事务在最后一次追加之后的有效期
+	stagedTxnTTL = time.Minute
+	// stagedTxnMaxStages 同时存在的暂存事务的最大个数
+	stagedTxnMaxStages = 64
+)
+
+type stagedTxnMeta struct {
+	Owner   string `json:"owner"`
+	Expires int64  `json:"expires"`
+	Chunks  uint32 `json:"chunks"`
+	Ops     int64  `json:"ops"`
+	Bytes   int64  `json:"bytes"`
+}
+
+func stagedTxnKey(id int64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, uint64(id))
+	return k
+}
+
+func stagedTxnChunkKey(id int64, seq uint32) []byte {
+	k := make([]byte, 12)
+	binary.BigEndian.PutUint64(k, uint64(id))
+	binary.BigEndian.PutUint32(k[8:], seq)
+	return k
+}
+
+// stagedTxnChunk 只保留请求中需要暂存的操作
+func stagedTxnChunk(r *pb.StagedTxnRequest) *pb.StagedTxnRequest {
+	return &pb.StagedTxnRequest{Compare: r.Compare, Success: r.Success, Failure: r.Failure}
+}
+
+// StagedTxn 追加、提交或放弃暂存事务
+func (s *EtcdServer) StagedTxn(ctx context.Context, r *pb.StagedTxnRequest) (*pb.StagedTxnResponse, error) {
+	ir, err := s.newStagedTxnRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	ctx = context.WithValue(ctx, traceutil.StartTimeKey, time.Now())
+	resp, err := s.raftRequest(ctx, pb.InternalRaftRequest{StagedTxn: ir})
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*pb.StagedTxnResponse), nil
+}
+
+// newStagedTxnRequest 按本成员的配置检查限制,新建暂存事务时分配ID,并填写过期时间
+func (s *EtcdServer) newStagedTxnRequest(r *pb.StagedTxnRequest) (*pb.InternalStagedTxnRequest, error) {
+	now := time.Now()
+	ir := &pb.InternalStagedTxnRequest{
+		Request:   r,
+		Time:      now.Unix(),
+		MaxStages: stagedTxnMaxStages,
+		MaxOps:    int64(s.Cfg.StagedTxnMaxOps),
+		MaxBytes:  s.Cfg.StagedTxnMaxBytes,
+	}
+	if r.Action != pb.StagedTxnRequest_APPEND {
+		if r.StageId == 0 {
+			return nil, ErrStagedTxnNotFound
+		}
+		return ir, nil
+	}
+	if s.DowngradeFeatureBlocked(FeatureStagedTxn) {
+		return nil, ErrDowngradeFeatureBlocked
+	}
+	chunk := stagedTxnChunk(r)
+	ops := int64(len(chunk.Compare) + len(chunk.Success) + len(chunk.Failure))
+	size := int64(chunk.Size())
+	metas := s.stagedTxnMetas(now.Unix())
+	if r.StageId == 0 {
+		if len(metas) >= int(ir.MaxStages) {
+			return nil, ErrStagedTxnTooMany
+		}
+		req := *r
+		req.StageId = int64(s.reqIDGen.Next() & ((1 << 63) - 1))
+		ir.Request, ir.Create = &req, true
+	} else {
+		m, ok := metas[r.StageId]
+		if !ok {
+			return nil, ErrStagedTxnNotFound
+		}
+		ops += m.Ops
+		size += m.Bytes
+	}
+	if ops > ir.MaxOps || size > ir.MaxBytes {
+		return nil, ErrStagedTxnTooLarge
+	}
+	ir.Expires = now.Add(stagedTxnTTL).Unix()
+	return ir, nil
+}
+
+// stagedTxnMetas 返回在 now 时仍然有效的暂存事务
+func (s *EtcdServer) stagedTxnMetas(now int64) map[int64]stagedTxnMeta {
+	metas := make(map[int64]stagedTxnMeta)
+	tx := s.backend.BatchTx()
+	tx.Lock()
+	defer tx.Unlock()
+	tx.UnsafeCreateBucket(buckets.StagedTxn)
+	tx.UnsafeForEach(buckets.StagedTxn, func(k, v []byte) error {
+		if len(k) != 8 {
+			return nil
+		}
+		var m stagedTxnMeta
+		if err := json.Unmarshal(v, &m); err != nil || m.Expires <= now {
+			return nil
+		}
+		metas[int64(binary.BigEndian.Uint64(k))] = m
+		return nil
+	})
+	return metas
+}
+
+// LoadStagedTxn 线性一致地读出暂存的全部操作,用于提交前检查整个事务
+func (s *EtcdServer) LoadStagedTxn(ctx context.Context, id int64) (*pb.TxnRequest, error) {
+	if err := s.linearizeReadNotify(ctx); err != nil {
+		return nil, err
+	}
+	owner := ""
+	ai, err := s.AuthInfoFromCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if ai != nil {
+		owner = ai.Username
+	}
+	m, ok := s.stagedTxnMetas(time.Now().Unix())[id]
+	if !ok || m.Owner != owner {
+		return nil, ErrStagedTxnNotFound
+	}
+	tx := s.backend.BatchTx()
+	tx.Lock()
+	defer tx.Unlock()
+	return unsafeStagedTxnOps(tx, id, m)
+}
+
+// applyStagedTxn 清理在请求时间已经过期的暂存事务,然后追加、提交或放弃暂存事务.
+// 暂存事务只能由创建它的用户操作,提交时的权限检查和普通事务相同
+func (s *EtcdServer) applyStagedTxn(h *pb.RequestHeader, r *pb.InternalStagedTxnRequest) (*pb.StagedTxnResponse, *traceutil.Trace, error) {
+	owner := ""
+	if h != nil {
+		owner = h.Username
+	}
+	req := r.Request
+	id := req.StageId
+	tx := s.backend.BatchTx()
+	tx.Lock()
+	tx.UnsafeCreateBucket(buckets.StagedTxn)
+	unsafePurgeStagedTxns(tx, r.Time)
+	m, ok := unsafeStagedTxnMeta(tx, id)
+	if ok && m.Owner != owner {
+		ok = false
+	}
+	if req.Action == pb.StagedTxnRequest_APPEND && r.Create && !ok {
+		m, ok = stagedTxnMeta{Owner: owner}, true
+	}
+	if !ok {
+		tx.Unlock()
+		return nil, nil, ErrStagedTxnNotFound
+	}
+
+	switch req.Action {
+	case pb.StagedTxnRequest_APPEND:
+		if len(s.alarmStore.Get(pb.AlarmType_NOSPACE)) > 0 {
+			tx.Unlock()
+			return nil, nil, ErrNoSpace
+		}
+		if r.Create && r.MaxStages > 0 && unsafeCountStagedTxns(tx, id) >= int(r.MaxStages) {
+			tx.Unlock()
+			return nil, nil, ErrStagedTxnTooMany
+		}
+		chunk := stagedTxnChunk(req)
+		v, err := chunk.Marshal()
+		if err != nil {
+			s.lg.Panic("序列化暂存事务失败", zap.Error(err))
+		}
+		ops := m.Ops + int64(len(chunk.Compare)+len(chunk.Success)+len(chunk.Failure))
+		size := m.Bytes + int64(len(v))
+		// 发起请求时的检查之后可能有其他追加先被apply,这里按请求携带的限制再检查一次
+		if (r.MaxOps > 0 && ops > r.MaxOps) || (r.MaxBytes > 0 && size > r.MaxBytes) {
+			tx.Unlock()
+			return nil, nil, ErrStagedTxnTooLarge
+		}
+		tx.UnsafePut(buckets.StagedTxn, stagedTxnChunkKey(id, m.Chunks), v)
+		m.Chunks++
+		m.Ops, m.Bytes = ops, size
+		m.Expires = r.Expires
+		unsafePutStagedTxnMeta(s.lg, tx, id, m)
+		tx.Unlock()
+		return &pb.StagedTxnResponse{Header: &pb.ResponseHeader{}, StageId: id, Ops: m.Ops, Bytes: m.Bytes}, nil, nil
+	case pb.StagedTxnRequest_ABORT:
+		unsafeDeleteStagedTxn(tx, id, m)
+		tx.Unlock()
+		return &pb.StagedTxnResponse{Header: &pb.ResponseHeader{}, StageId: id}, nil, nil
+	}
+
+	txn, err := unsafeStagedTxnOps(tx, id, m)
+	tx.Unlock()
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, trace, err := s.applyV3.Txn(context.TODO(), txn)
+	if err != nil {
+		// 失败时保留暂存事务,客户端可以放弃或等待过期
+		return nil, trace, err
+	}
+	// 事务和删除暂存记录在同一次apply中,先写事务,避免提交前崩溃后重放时找不到暂存记录
+	tx.Lock()
+	unsafeDeleteStagedTxn(tx, id, m)
+	tx.Unlock()
+	s.accountUserWrite(h, txnWrittenBytes(txn, resp))
+	return &pb.StagedTxnResponse{
+		Header:  &pb.ResponseHeader{Revision: resp.Header.Revision},
+		StageId: id,
+		Ops:     m.Ops,
+		Bytes:   m.Bytes,
+		Txn:     resp,
+	}, trace, nil
+}
+
+func unsafeStagedTxnMeta(tx backend.BatchTx, id int64) (stagedTxnMeta, bool) {
+	var m stagedTxnMeta
+	_, vs := tx.UnsafeRange(buckets.StagedTxn, stagedTxnKey(id), nil, 0)
+	if len(vs) == 0 || json.Unmarshal(vs[0], &m) != nil {
+		return m, false
+	}
+	return m, true
+}
+
+func unsafePutStagedTxnMeta(lg *zap.Logger, tx backend.BatchTx, id int64, m stagedTxnMeta) {
+	v, err := json.Marshal(m)
+	if err != nil {
+		lg.Panic("序列化暂存事务失败", zap.Error(err))
+	}
+	tx.UnsafePut(buckets.StagedTxn, stagedTxnKey(id), v)
+}
+
+func unsafeDeleteStagedTxn(tx backend.BatchTx, id int64, m stagedTxnMeta) {
+	for i := uint32(0); i < m.Chunks; i++ {
+		tx.UnsafeDelete(buckets.StagedTxn, stagedTxnChunkKey(id, i))
+	}
+	tx.UnsafeDelete(buckets.StagedTxn, stagedTxnKey(id))
+}
+
+// unsafePurgeStagedTxns 删除在 now 时已经过期的暂存事务
+func unsafePurgeStagedTxns(tx backend.BatchTx, now int64) {
+	expired := make(map[int64]stagedTxnMeta)
+	tx.UnsafeForEach(buckets.StagedTxn, func(k, v []byte) error {
+		if len(k) != 8 {
+			return nil
+		}
+		var m stagedTxnMeta
+		if err := json.Unmarshal(v, &m); err != nil || m.Expires <= now {
+			expired[int64(binary.BigEndian.Uint64(k))] = m
+		}
+		return nil
+	})
+	for id, m := range expired {
+		unsafeDeleteStagedTxn(tx, id, m)
+	}
+}
+
+// unsafeCountStagedTxns 返回除 id 以外的暂存事务个数
+func unsafeCountStagedTxns(tx backend.BatchTx, id int64) int {
+	n := 0
+	tx.UnsafeForEach(buckets.StagedTxn, func(k, v []byte) error {
+		if len(k) == 8 && int64(binary.BigEndian.Uint64(k)) != id {
+			n++
+		}
+		return nil
+	})
+	return n
+}
+
+// unsafeStagedTxnOps 按追加的顺序拼接暂存的操作
+func unsafeStagedTxnOps(tx backend.BatchTx, id int64, m stagedTxnMeta) (*pb.TxnRequest, error) {
+	txn := &pb.TxnRequest{}
+	for i := uint32(0); i < m.Chunks; i++ {
+		_, vs := tx.UnsafeRange(buckets.StagedTxn, stagedTxnChunkKey(id, i), nil, 0)
+		if len(vs) == 0 {
+			return nil, ErrStagedTxnNotFound
+		}
+		var chunk pb.StagedTxnRequest
+		if err := chunk.Unmarshal(vs[0]); err != nil {
+			return nil, err
+		}
+		txn.Compare = append(txn.Compare, chunk.Compare...)
+		txn.Success = append(txn.Success, chunk.Success...)
+		txn.Failure = append(txn.Failure, chunk.Failure...)
+	}
+	return txn, nil
+}
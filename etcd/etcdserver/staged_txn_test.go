@@ -0,0 +1,103 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdserver
+
+import (
+	"testing"
+
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver/api/v3alarm"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+)
+
+func newTestStagedTxnServer(t *testing.T) *EtcdServer {
+	s := newTestLeaseServer(t)
+	as, err := v3alarm.NewAlarmStore(s.lg, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.alarmStore = as
+	return s
+}
+
+func stagedPut(id int64, keys ...string) *pb.StagedTxnRequest {
+	r := &pb.StagedTxnRequest{Action: pb.StagedTxnRequest_APPEND, StageId: id}
+	for _, k := range keys {
+		r.Success = append(r.Success, &pb.RequestOp{RequestOp_RequestPut: &pb.RequestOp_RequestPut{
+			RequestPut: &pb.PutRequest{Key: k, Value: "bar"},
+		}})
+	}
+	return r
+}
+
+// TestApplyStagedTxnMaxOps 追加按请求携带的操作数限制检查,超过时不改变已暂存的内容
+func TestApplyStagedTxnMaxOps(t *testing.T) {
+	s := newTestStagedTxnServer(t)
+	ir := &pb.InternalStagedTxnRequest{Request: stagedPut(1, "a", "b"), Create: true, Expires: 100, Time: 1, MaxStages: 4, MaxOps: 3}
+	if _, _, err := s.applyStagedTxn(nil, ir); err != nil {
+		t.Fatal(err)
+	}
+	// 两个追加都在发起时通过了检查,先apply的那个占用了额度
+	ir = &pb.InternalStagedTxnRequest{Request: stagedPut(1, "c", "d"), Expires: 100, Time: 2, MaxStages: 4, MaxOps: 3}
+	if _, _, err := s.applyStagedTxn(nil, ir); err != ErrStagedTxnTooLarge {
+		t.Fatalf("err = %v, want %v", err, ErrStagedTxnTooLarge)
+	}
+	ir = &pb.InternalStagedTxnRequest{Request: stagedPut(1, "c"), Expires: 100, Time: 3, MaxStages: 4, MaxOps: 3}
+	resp, _, err := s.applyStagedTxn(nil, ir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Ops != 3 {
+		t.Fatalf("ops = %d, want 3", resp.Ops)
+	}
+}
+
+// TestApplyStagedTxnMaxBytes 追加按请求携带的字节数限制检查
+func TestApplyStagedTxnMaxBytes(t *testing.T) {
+	s := newTestStagedTxnServer(t)
+	chunk := stagedTxnChunk(stagedPut(1, "a"))
+	ir := &pb.InternalStagedTxnRequest{Request: stagedPut(1, "a"), Create: true, Expires: 100, Time: 1, MaxStages: 4, MaxBytes: int64(chunk.Size())}
+	if _, _, err := s.applyStagedTxn(nil, ir); err != nil {
+		t.Fatal(err)
+	}
+	ir = &pb.InternalStagedTxnRequest{Request: stagedPut(1, "b"), Expires: 100, Time: 2, MaxStages: 4, MaxBytes: int64(chunk.Size())}
+	if _, _, err := s.applyStagedTxn(nil, ir); err != ErrStagedTxnTooLarge {
+		t.Fatalf("err = %v, want %v", err, ErrStagedTxnTooLarge)
+	}
+}
+
+// TestApplyStagedTxnMaxStages 创建暂存事务时按请求携带的个数限制检查,过期的暂存事务不计入
+func TestApplyStagedTxnMaxStages(t *testing.T) {
+	s := newTestStagedTxnServer(t)
+	for id := int64(1); id <= 2; id++ {
+		ir := &pb.InternalStagedTxnRequest{Request: stagedPut(id, "a"), Create: true, Expires: 10 * id, Time: 1, MaxStages: 2}
+		if _, _, err := s.applyStagedTxn(nil, ir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ir := &pb.InternalStagedTxnRequest{Request: stagedPut(3, "a"), Create: true, Expires: 100, Time: 2, MaxStages: 2}
+	if _, _, err := s.applyStagedTxn(nil, ir); err != ErrStagedTxnTooMany {
+		t.Fatalf("err = %v, want %v", err, ErrStagedTxnTooMany)
+	}
+	// 已有的暂存事务仍然可以追加
+	ir = &pb.InternalStagedTxnRequest{Request: stagedPut(2, "b"), Expires: 100, Time: 2, MaxStages: 2}
+	if _, _, err := s.applyStagedTxn(nil, ir); err != nil {
+		t.Fatal(err)
+	}
+	// 1 在时间10过期后不再计入
+	ir = &pb.InternalStagedTxnRequest{Request: stagedPut(3, "a"), Create: true, Expires: 100, Time: 10, MaxStages: 2}
+	if _, _, err := s.applyStagedTxn(nil, ir); err != nil {
+		t.Fatal(err)
+	}
+}
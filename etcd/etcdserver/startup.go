@@ -0,0 +1,198 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdserver
+
+import (
+	"sync"
+	"time"
+
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// 启动的各个阶段,按顺序推进
+const (
+	// StartupPhaseOpeningBackend 打开bolt.db,必要时进行碎片整理
+	StartupPhaseOpeningBackend = "opening-backend"
+	// StartupPhaseLoadingSnapshot 加载快照,恢复v2store和后端
+	StartupPhaseLoadingSnapshot = "loading-snapshot"
+	// StartupPhaseReadingWAL 读取快照之后的WAL日志
+	StartupPhaseReadingWAL = "reading-wal"
+	// StartupPhaseRebuildingIndex 恢复租约、重建mvcc索引
+	StartupPhaseRebuildingIndex = "rebuilding-index"
+	// StartupPhaseReplayingWAL apply 启动时已经提交的日志
+	StartupPhaseReplayingWAL = "replaying-wal"
+	// StartupPhaseJoining 等待把本成员的属性发布到集群
+	StartupPhaseJoining = "joining"
+	// StartupPhaseReady 启动完成
+	StartupPhaseReady = "ready"
+)
+
+var startupPhases = []string{
+	StartupPhaseOpeningBackend, StartupPhaseLoadingSnapshot, StartupPhaseReadingWAL,
+	StartupPhaseRebuildingIndex, StartupPhaseReplayingWAL, StartupPhaseJoining, StartupPhaseReady,
+}
+
+// replay 期间打印进度日志的间隔
+const startupProgressInterval = 10 * time.Second
+
+var (
+	startupPhaseGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "etcd",
+		Subsystem: "server",
+		Name:      "startup_phase",
+		Help:      "Set to 1 for the current startup phase of the member, 0 for the others.",
+	}, []string{"phase"})
+	startupWALReplayPercent = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "etcd",
+		Subsystem: "server",
+		Name:      "startup_wal_replay_percent",
+		Help:      "The percentage of the entries committed at boot that have been applied.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(startupPhaseGauge)
+	prometheus.MustRegister(startupWALReplayPercent)
+}
+
+// startupTracker 记录启动所处的阶段,供 /health、Status 和日志使用
+type startupTracker struct {
+	lg *zap.Logger
+
+	mu         sync.Mutex
+	phase      string
+	start      time.Time
+	phaseStart time.Time
+	took       time.Duration // 进入 ready 时的总耗时
+
+	// replay 的起止索引,replayFrom 为启动时已经apply的索引,replayTo 为启动时已经提交的索引
+	replayFrom, replayTo uint64
+	replayed             uint64
+	lastLog              time.Time
+}
+
+func newStartupTracker(lg *zap.Logger) *startupTracker {
+	now := time.Now()
+	t := &startupTracker{lg: lg, start: now, phaseStart: now}
+	t.enter(StartupPhaseOpeningBackend)
+	return t
+}
+
+// enter 进入新的阶段,并记录上一阶段的耗时
+func (t *startupTracker) enter(phase string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.enterLocked(phase)
+}
+
+func (t *startupTracker) enterLocked(phase string) {
+	if t.phase == phase || t.phase == StartupPhaseReady {
+		return
+	}
+	now := time.Now()
+	if t.phase != "" {
+		t.lg.Info(
+			"启动阶段完成",
+			zap.String("phase", t.phase),
+			zap.Duration("took", now.Sub(t.phaseStart)),
+		)
+	}
+	t.phase, t.phaseStart = phase, now
+	for _, p := range startupPhases {
+		v := 0.0
+		if p == phase {
+			v = 1
+		}
+		startupPhaseGauge.WithLabelValues(p).Set(v)
+	}
+	if phase == StartupPhaseReady {
+		t.took = now.Sub(t.start)
+		t.lg.Info("启动完成", zap.Duration("took", t.took))
+		return
+	}
+	t.lg.Info("进入启动阶段", zap.String("phase", phase), zap.Duration("elapsed", now.Sub(t.start)))
+}
+
+// beginReplay 进入 replaying-wal 阶段,from 为已经apply的索引,to 为启动时已经提交的索引
+func (t *startupTracker) beginReplay(from, to uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.replayFrom, t.replayTo, t.replayed, t.lastLog = from, to, from, time.Now()
+	t.enterLocked(StartupPhaseReplayingWAL)
+	t.lg.Info("开始apply启动时已提交的日志", zap.Uint64("from-index", from), zap.Uint64("to-index", to))
+	if to <= from {
+		startupWALReplayPercent.Set(100)
+		t.enterLocked(StartupPhaseJoining)
+	}
+}
+
+// applied 在每批日志apply后调用,replay 完成后进入 joining 阶段
+func (t *startupTracker) applied(index uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.phase != StartupPhaseReplayingWAL {
+		return
+	}
+	t.replayed = index
+	pct := t.replayPercentLocked()
+	startupWALReplayPercent.Set(pct)
+	if index >= t.replayTo {
+		t.enterLocked(StartupPhaseJoining)
+		return
+	}
+	if time.Since(t.lastLog) >= startupProgressInterval {
+		t.lastLog = time.Now()
+		t.lg.Info(
+			"正在apply启动时已提交的日志",
+			zap.Uint64("applied-index", index),
+			zap.Uint64("to-index", t.replayTo),
+			zap.Float64("percent", pct),
+			zap.Duration("elapsed", time.Since(t.phaseStart)),
+		)
+	}
+}
+
+func (t *startupTracker) replayPercentLocked() float64 {
+	if t.phase != StartupPhaseReplayingWAL || t.replayed >= t.replayTo {
+		return 100
+	}
+	return float64(t.replayed-t.replayFrom) * 100 / float64(t.replayTo-t.replayFrom)
+}
+
+func (t *startupTracker) status() *pb.StartupStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	st := &pb.StartupStatus{
+		Phase:        t.phase,
+		PhaseSeconds: time.Since(t.phaseStart).Seconds(),
+		TotalSeconds: time.Since(t.start).Seconds(),
+	}
+	switch t.phase {
+	case StartupPhaseReplayingWAL, StartupPhaseJoining, StartupPhaseReady:
+		st.WalReplayPercent = t.replayPercentLocked()
+	}
+	if t.phase == StartupPhaseReady {
+		st.TotalSeconds = t.took.Seconds()
+	}
+	return st
+}
+
+// StartupStatus 返回本成员当前所处的启动阶段和进度
+func (s *EtcdServer) StartupStatus() *pb.StartupStatus {
+	return s.startup.status()
+}
@@ -0,0 +1,150 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdserver
+
+import (
+	"context"
+	"time"
+
+	"github.com/ls-2018/etcd_cn/client_sdk/pkg/types"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+	"github.com/ls-2018/etcd_cn/pkg/topology"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+const topologyCheckInterval = 10 * time.Second
+
+var (
+	topologyQuorumAtRisk = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "etcd",
+		Subsystem: "server",
+		Name:      "topology_quorum_at_risk",
+		Help:      "Whether the failure of a single failure domain loses quorum. 1 is at risk, 0 is not.",
+	})
+	topologyDomains = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "etcd",
+		Subsystem: "server",
+		Name:      "topology_domains",
+		Help:      "The number of failure domains the voting members are spread over.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(topologyQuorumAtRisk)
+	prometheus.MustRegister(topologyDomains)
+}
+
+// TopologyReport 按 TopologyLabel 分析当前投票成员在故障域上的分布
+func (s *EtcdServer) TopologyReport() topology.Report {
+	var ms []topology.Member
+	for _, m := range s.cluster.Members() {
+		d, _ := m.Label(s.Cfg.TopologyLabel)
+		ms = append(ms, topology.Member{ID: uint64(m.ID), Name: m.Name, IsLearner: m.IsLearner, Domain: d})
+	}
+	return topology.Analyze(s.Cfg.TopologyLabel, ms)
+}
+
+// monitorTopology 定期检查单个故障域失效是否会丢失quorum;所有成员都更新指标并在状态变化时打印日志,
+// 只有leader负责发出和解除 TOPOLOGY 警报.
+func (s *EtcdServer) monitorTopology() {
+	if s.Cfg.TopologyLabel == "" {
+		return
+	}
+	// 启动时先等待成员信息应用完成
+	select {
+	case <-s.ReadyNotify():
+	case <-s.stopping:
+		return
+	}
+
+	first, atRisk := true, false
+	for {
+		r := s.TopologyReport()
+		// 未使用该标签或少于3个投票成员(本就无法容忍任何故障)时不检查
+		checked := r.Labeled() && r.Voters >= 3
+		risk := checked && !r.Safe()
+		if checked {
+			topologyDomains.Set(float64(len(r.Domains)))
+		}
+		if risk {
+			topologyQuorumAtRisk.Set(1)
+		} else {
+			topologyQuorumAtRisk.Set(0)
+		}
+		if risk != atRisk || (first && checked) {
+			s.logTopology(r, risk)
+		}
+		first, atRisk = false, risk
+
+		if s.isLeader() {
+			s.checkTopologyAlarm(risk)
+		}
+
+		select {
+		case <-time.After(topologyCheckInterval):
+		case <-s.stopping:
+			return
+		}
+	}
+}
+
+func (s *EtcdServer) logTopology(r topology.Report, risk bool) {
+	fields := []zap.Field{
+		zap.String("local-member-id", s.ID().String()),
+		zap.String("label", r.Label),
+		zap.Int("voters", r.Voters),
+		zap.Int("quorum", r.Quorum),
+		zap.Int("domains", len(r.Domains)),
+		zap.Strings("unlabeled-voters", r.Unlabeled),
+	}
+	if risk {
+		fields = append(fields, zap.Strings("at-risk-domains", r.AtRisk()))
+		s.Logger().Warn("单个故障域失效就会丢失quorum", fields...)
+		return
+	}
+	s.Logger().Info("任意单个故障域失效都不会丢失quorum", fields...)
+}
+
+func (s *EtcdServer) checkTopologyAlarm(risk bool) {
+	alarms := s.alarmStore.Get(pb.AlarmType_TOPOLOGY)
+	if risk {
+		if len(alarms) == 0 {
+			s.setTopologyAlarm(s.ID(), pb.AlarmRequest_ACTIVATE)
+		}
+		return
+	}
+	for _, a := range alarms {
+		s.setTopologyAlarm(types.ID(a.MemberID), pb.AlarmRequest_DEACTIVATE)
+	}
+}
+
+func (s *EtcdServer) setTopologyAlarm(id types.ID, action pb.AlarmRequest_AlarmAction) {
+	if action == pb.AlarmRequest_ACTIVATE && s.DowngradeFeatureBlocked(FeatureMemberAlarms) {
+		return
+	}
+	a := &pb.AlarmRequest{
+		MemberID: uint64(id),
+		Action:   action,
+		Alarm:    pb.AlarmType_TOPOLOGY,
+	}
+	s.GoAttach(func() {
+		ctx, cancel := context.WithTimeout(s.ctx, s.Cfg.ReqTimeout())
+		defer cancel()
+		if _, err := s.raftRequest(ctx, pb.InternalRaftRequest{Alarm: a}); err != nil {
+			s.Logger().Warn("更新拓扑警报失败", zap.String("member-id", id.String()), zap.Error(err))
+		}
+	})
+}
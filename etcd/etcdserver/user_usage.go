@@ -0,0 +1,251 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdserver
+
+import (
+	"context"
+	"encoding/binary"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ls-2018/etcd_cn/etcd/config"
+	"github.com/ls-2018/etcd_cn/etcd/mvcc/buckets"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+)
+
+// 用户写入统计: apply时按请求头中的用户名累计实际写入的键和值的字节数,记录在 user_usage bucket 中,
+// 各成员一致. 提交请求前按配置的预算检查: 累计字节数超出预算时拒绝,直到通过 UserUsage 重置;
+// 速率预算由接收请求的成员在本地限制. 未开启鉴权时请求没有用户名,不统计也不限制.
+
+var (
+	userWrittenBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "etcd",
+		Subsystem: "server",
+		Name:      "user_written_bytes_total",
+		Help:      "The total size of the keys and values written by each auth user.",
+	}, []string{"user"})
+	userQuotaRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "etcd",
+		Subsystem: "server",
+		Name:      "user_quota_rejected_total",
+		Help:      "The total number of write requests rejected because a user exceeded its write budget.",
+	}, []string{"user", "reason"})
+)
+
+func init() {
+	prometheus.MustRegister(userWrittenBytes)
+	prometheus.MustRegister(userQuotaRejected)
+}
+
+// userRateLimiters 每个用户一个令牌桶,容量为一秒的预算
+type userRateLimiters struct {
+	mu sync.Mutex
+	m  map[string]*rate.Limiter
+}
+
+func (l *userRateLimiters) allow(user string, bytesPerSec int64, n int64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.m == nil {
+		l.m = make(map[string]*rate.Limiter)
+	}
+	lim, ok := l.m[user]
+	if !ok || lim.Burst() != int(bytesPerSec) {
+		lim = rate.NewLimiter(rate.Limit(bytesPerSec), int(bytesPerSec))
+		l.m[user] = lim
+	}
+	// 大于一秒预算的请求在桶满时放行,否则永远无法写入
+	if n > bytesPerSec {
+		n = bytesPerSec
+	}
+	return lim.AllowN(time.Now(), int(n))
+}
+
+func putBytes(r *pb.PutRequest) int64 { return int64(len(r.Key) + len(r.Value)) }
+
+// txnWriteEstimate 估计事务写入的字节数,取两个分支中较大的
+func txnWriteEstimate(r *pb.TxnRequest) int64 {
+	branch := func(ops []*pb.RequestOp) (n int64) {
+		for _, op := range ops {
+			switch {
+			case op.GetRequestPut() != nil:
+				n += putBytes(op.GetRequestPut())
+			case op.GetRequestTxn() != nil:
+				n += txnWriteEstimate(op.GetRequestTxn())
+			}
+		}
+		return n
+	}
+	s, f := branch(r.Success), branch(r.Failure)
+	if f > s {
+		return f
+	}
+	return s
+}
+
+// txnWrittenBytes 按事务的执行结果计算实际写入的字节数
+func txnWrittenBytes(r *pb.TxnRequest, resp *pb.TxnResponse) (n int64) {
+	if resp == nil {
+		return 0
+	}
+	ops := r.Failure
+	if resp.Succeeded {
+		ops = r.Success
+	}
+	for i, op := range ops {
+		switch {
+		case op.GetRequestPut() != nil:
+			n += putBytes(op.GetRequestPut())
+		case op.GetRequestTxn() != nil && i < len(resp.Responses):
+			n += txnWrittenBytes(op.GetRequestTxn(), resp.Responses[i].GetResponseTxn())
+		}
+	}
+	return n
+}
+
+// writeEstimate 估计raft请求写入的字节数,暂存事务在追加时计算
+func writeEstimate(r *pb.InternalRaftRequest) int64 {
+	switch {
+	case r.Put != nil:
+		return putBytes(r.Put)
+	case r.Txn != nil:
+		return txnWriteEstimate(r.Txn)
+	case r.StagedTxn != nil && r.StagedTxn.Request.Action == pb.StagedTxnRequest_APPEND:
+		return txnWriteEstimate(&pb.TxnRequest{Success: r.StagedTxn.Request.Success, Failure: r.StagedTxn.Request.Failure})
+	}
+	return 0
+}
+
+// checkUserQuota 提交请求前检查用户的写入预算
+func (s *EtcdServer) checkUserQuota(r *pb.InternalRaftRequest) error {
+	if len(s.Cfg.UserQuotas) == 0 || r.Header == nil || r.Header.Username == "" {
+		return nil
+	}
+	n := writeEstimate(r)
+	if n == 0 {
+		return nil
+	}
+	user := r.Header.Username
+	q := s.Cfg.UserQuotaFor(user)
+	if q.Bytes > 0 && s.UserWrittenBytes(user)+n > q.Bytes {
+		userQuotaRejected.WithLabelValues(user, "bytes").Inc()
+		return ErrUserQuotaExceeded
+	}
+	if q.RateBytes > 0 && !s.userRates.allow(user, q.RateBytes, n) {
+		userQuotaRejected.WithLabelValues(user, "rate").Inc()
+		return ErrUserRateLimited
+	}
+	return nil
+}
+
+// accountUserWrite 在apply时累计用户写入的字节数
+func (s *EtcdServer) accountUserWrite(h *pb.RequestHeader, n int64) {
+	if h == nil || h.Username == "" || n == 0 || s.DowngradeFeatureBlocked(FeatureUserUsage) {
+		return
+	}
+	key := []byte(h.Username)
+	tx := s.backend.BatchTx()
+	tx.Lock()
+	tx.UnsafeCreateBucket(buckets.UserUsage)
+	var total int64
+	if _, vs := tx.UnsafeRange(buckets.UserUsage, key, nil, 0); len(vs) == 1 && len(vs[0]) == 8 {
+		total = int64(binary.BigEndian.Uint64(vs[0]))
+	}
+	v := make([]byte, 8)
+	binary.BigEndian.PutUint64(v, uint64(total+n))
+	tx.UnsafePut(buckets.UserUsage, key, v)
+	tx.Unlock()
+	userWrittenBytes.WithLabelValues(h.Username).Add(float64(n))
+}
+
+// UserWrittenBytes 返回用户累计写入的字节数
+func (s *EtcdServer) UserWrittenBytes(user string) int64 {
+	return s.userWrittenBytes()[user]
+}
+
+func (s *EtcdServer) userWrittenBytes() map[string]int64 {
+	m := make(map[string]int64)
+	tx := s.backend.BatchTx()
+	tx.Lock()
+	defer tx.Unlock()
+	tx.UnsafeCreateBucket(buckets.UserUsage)
+	tx.UnsafeForEach(buckets.UserUsage, func(k, v []byte) error {
+		if len(v) == 8 {
+			m[string(k)] = int64(binary.BigEndian.Uint64(v))
+		}
+		return nil
+	})
+	return m
+}
+
+// UserUsage 返回用户的写入统计和预算;reset 时先通过raft把统计清零
+func (s *EtcdServer) UserUsage(ctx context.Context, r *pb.UserUsageRequest) (*pb.UserUsageResponse, error) {
+	if r.Reset_ {
+		if s.DowngradeFeatureBlocked(FeatureUserUsage) {
+			return nil, ErrDowngradeFeatureBlocked
+		}
+		if _, err := s.raftRequest(ctx, pb.InternalRaftRequest{UserUsageReset: r}); err != nil {
+			return nil, err
+		}
+	}
+	written := s.userWrittenBytes()
+	users := make(map[string]bool)
+	for u := range written {
+		users[u] = true
+	}
+	for _, q := range s.Cfg.UserQuotas {
+		if q.User != config.UserQuotaDefault {
+			users[q.User] = true
+		}
+	}
+	resp := &pb.UserUsageResponse{Header: &pb.ResponseHeader{}}
+	for u := range users {
+		if r.User != "" && u != r.User {
+			continue
+		}
+		q := s.Cfg.UserQuotaFor(u)
+		resp.Usages = append(resp.Usages, &pb.UserUsage{User: u, WrittenBytes: written[u], QuotaBytes: q.Bytes, RateBytes: q.RateBytes})
+	}
+	if r.User != "" && len(resp.Usages) == 0 {
+		q := s.Cfg.UserQuotaFor(r.User)
+		resp.Usages = append(resp.Usages, &pb.UserUsage{User: r.User, QuotaBytes: q.Bytes, RateBytes: q.RateBytes})
+	}
+	sort.Slice(resp.Usages, func(i, j int) bool { return resp.Usages[i].User < resp.Usages[j].User })
+	return resp, nil
+}
+
+// applyUserUsageReset 把用户的写入统计清零,用户为空时清空所有用户的统计
+func (s *EtcdServer) applyUserUsageReset(r *pb.UserUsageRequest) (*pb.EmptyResponse, error) {
+	tx := s.backend.BatchTx()
+	tx.Lock()
+	defer tx.Unlock()
+	tx.UnsafeCreateBucket(buckets.UserUsage)
+	if r.User != "" {
+		tx.UnsafeDelete(buckets.UserUsage, []byte(r.User))
+		return &pb.EmptyResponse{}, nil
+	}
+	var keys [][]byte
+	tx.UnsafeForEach(buckets.UserUsage, func(k, v []byte) error {
+		keys = append(keys, append([]byte{}, k...))
+		return nil
+	})
+	for _, k := range keys {
+		tx.UnsafeDelete(buckets.UserUsage, k)
+	}
+	return &pb.EmptyResponse{}, nil
+}
@@ -0,0 +1,261 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdserver
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ls-2018/etcd_cn/client_sdk/pkg/types"
+	"github.com/ls-2018/etcd_cn/etcd/config"
+	"github.com/ls-2018/etcd_cn/etcd/datadir"
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver/api/membership"
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver/api/snap"
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver/api/v2store"
+	"github.com/ls-2018/etcd_cn/etcd/mvcc/backend"
+	"github.com/ls-2018/etcd_cn/etcd/mvcc/buckets"
+	"github.com/ls-2018/etcd_cn/etcd/verify"
+	"github.com/ls-2018/etcd_cn/etcd/wal"
+	"github.com/ls-2018/etcd_cn/etcd/wal/walpb"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+	"github.com/ls-2018/etcd_cn/pkg/pbutil"
+	"github.com/ls-2018/etcd_cn/raft/raftpb"
+
+	"github.com/coreos/go-semver/semver"
+	"go.uber.org/zap"
+)
+
+// v2store迁移: etcdutl migrate-v2 在成员停止时离线执行,从最新的快照和WAL中已提交的日志恢复v2store,
+// 以v2store为准把成员信息写入后端的 members/members_removed/cluster 桶,把用户数据写入 v2store 桶,
+// 用verify包校验数据目录后再在meta桶中写入迁移标记. 有标记的成员以 --v2-deprecation=write-only 及以上的阶段启动时,
+// 直接丢弃v2store中已经迁移过的用户数据,不再拒绝启动.
+
+// V2MigrateReport v2store迁移的结果
+type V2MigrateReport struct {
+	// Index 迁移的v2store状态对应的日志索引
+	Index          uint64 `json:"index"`
+	Members        int    `json:"members"`
+	RemovedMembers int    `json:"removed-members"`
+	ClusterVersion string `json:"cluster-version,omitempty"`
+	// Keys 写入 v2store 桶的用户节点数(包括目录)
+	Keys int `json:"keys"`
+}
+
+// MigrateV2Store 把数据目录中v2store剩余的内容迁移到后端,成员必须已经停止.
+func MigrateV2Store(lg *zap.Logger, dataDir string) (*V2MigrateReport, error) {
+	if lg == nil {
+		lg = zap.NewNop()
+	}
+	st, index, err := recoverV2Store(lg, dataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &V2MigrateReport{Index: index}
+	be := openMigrateBackend(lg, dataDir)
+	var ver *semver.Version
+	r.Members, r.RemovedMembers, ver = membership.MigrateV2StoreToBackend(lg, st, be)
+	if ver != nil {
+		r.ClusterVersion = ver.String()
+	}
+	r.Keys, err = migrateV2StoreContent(st, be)
+	be.ForceCommit()
+	be.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = verify.Verify(verify.Config{DataDir: dataDir, Logger: lg}); err != nil {
+		return nil, fmt.Errorf("verify migrated data dir: %v", err)
+	}
+
+	be = openMigrateBackend(lg, dataDir)
+	tx := be.BatchTx()
+	tx.Lock()
+	v := make([]byte, 8)
+	binary.BigEndian.PutUint64(v, index)
+	tx.UnsafePut(buckets.Meta, buckets.MetaV2StoreMigratedKeyName, v)
+	tx.Unlock()
+	be.ForceCommit()
+	be.Close()
+	lg.Info("v2store迁移完成", zap.String("data-dir", dataDir), zap.Uint64("index", index),
+		zap.Int("members", r.Members), zap.Int("removed-members", r.RemovedMembers), zap.Int("keys", r.Keys))
+	return r, nil
+}
+
+func openMigrateBackend(lg *zap.Logger, dataDir string) backend.Backend {
+	bcfg := backend.DefaultBackendConfig()
+	bcfg.Path = datadir.ToBackendFileName(dataDir)
+	bcfg.Logger = lg
+	return backend.New(bcfg)
+}
+
+// recoverV2Store 从最新的快照和WAL中已提交的日志恢复v2store,返回恢复到的日志索引
+func recoverV2Store(lg *zap.Logger, dataDir string) (v2store.Store, uint64, error) {
+	walDir := datadir.ToWalDir(dataDir)
+	walSnaps, err := wal.ValidSnapshotEntries(lg, walDir)
+	if err != nil {
+		return nil, 0, err
+	}
+	st := v2store.New(StoreClusterPrefix, StoreKeysPrefix)
+	var walsnap walpb.Snapshot
+	var confState raftpb.ConfState
+	snapshot, err := snap.New(lg, datadir.ToSnapDir(dataDir)).LoadNewestAvailable(walSnaps)
+	switch err {
+	case nil:
+		if err = st.Recovery(snapshot.Data); err != nil {
+			return nil, 0, err
+		}
+		walsnap.Index, walsnap.Term = snapshot.Metadata.Index, snapshot.Metadata.Term
+		confState = snapshot.Metadata.ConfState
+	case snap.ErrNoSnapshot:
+	default:
+		return nil, 0, err
+	}
+
+	w, err := wal.OpenForRead(lg, walDir, walsnap)
+	if err != nil {
+		return nil, 0, err
+	}
+	_, hs, ents, err := w.ReadAll()
+	w.Close()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	cl := membership.NewCluster(lg)
+	cl.SetStore(st)
+	cl.Recover(func(*zap.Logger, *semver.Version) {})
+	s := &EtcdServer{applyV2: NewApplierV2(lg, st, cl)}
+	bcr := newBatchChangeReplayer(confState)
+	index := walsnap.Index
+	for _, e := range ents {
+		if e.Index > hs.Commit {
+			break
+		}
+		applyV2StoreEntry(lg, s, cl, bcr, e)
+		index = e.Index
+	}
+	return st, index, nil
+}
+
+// applyV2StoreEntry 只应用日志中会修改v2store的部分
+func applyV2StoreEntry(lg *zap.Logger, s *EtcdServer, cl *membership.RaftCluster, bcr *batchChangeReplayer, e raftpb.Entry) {
+	if e.Type == raftpb.EntryConfChange {
+		var cc raftpb.ConfChangeV1
+		pbutil.MustUnmarshal(&cc, e.Data)
+		applyConfChangeToCluster(lg, cl, cc, membership.ApplyV2storeOnly)
+		return
+	}
+	if e.Type == raftpb.EntryConfChangeV2 {
+		bcr.apply(lg, cl, e, membership.ApplyV2storeOnly)
+		return
+	}
+	if e.Type != raftpb.EntryNormal || len(e.Data) == 0 {
+		return
+	}
+	var raftReq pb.InternalRaftRequest
+	if !pbutil.MaybeUnmarshal(&raftReq, e.Data) {
+		var req pb.Request
+		pbutil.MustUnmarshal(&req, e.Data)
+		raftReq.V2 = &req
+	}
+	switch {
+	case raftReq.V2 != nil:
+		s.applyV2Request((*RequestV2)(raftReq.V2), membership.ApplyV2storeOnly)
+	case raftReq.ClusterVersionSet != nil:
+		cl.SetVersion(semver.Must(semver.NewVersion(raftReq.ClusterVersionSet.Ver)), func(*zap.Logger, *semver.Version) {}, membership.ApplyV2storeOnly)
+	case raftReq.ClusterMemberAttrSet != nil:
+		r := raftReq.ClusterMemberAttrSet
+		cl.UpdateAttributes(types.ID(r.Member_ID), membership.Attributes{Name: r.MemberAttributes.Name, ClientURLs: r.MemberAttributes.ClientUrls}, membership.ApplyV2storeOnly)
+	}
+}
+
+// migrateV2StoreContent 把成员信息以外的v2store节点写入 v2store 桶,key为节点路径,value为不含子节点的 NodeExtern
+func migrateV2StoreContent(st v2store.Store, be backend.Backend) (int, error) {
+	ev, err := st.Get("/", true, true)
+	if err != nil {
+		return 0, err
+	}
+	tx := be.BatchTx()
+	tx.Lock()
+	defer tx.Unlock()
+	tx.UnsafeCreateBucket(buckets.V2Store)
+	n := 0
+	var walk func(ns v2store.NodeExterns) error
+	walk = func(ns v2store.NodeExterns) error {
+		for _, node := range ns {
+			rec := *node
+			rec.ExternNodes = nil
+			v, err := json.Marshal(&rec)
+			if err != nil {
+				return err
+			}
+			tx.UnsafePut(buckets.V2Store, []byte(node.Key), v)
+			n++
+			if err = walk(node.ExternNodes); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, node := range ev.NodeExtern.ExternNodes {
+		if node.Key == StoreClusterPrefix {
+			continue
+		}
+		if err = walk(node.ExternNodes); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// v2StoreMigrated 后端是否有 etcdutl migrate-v2 写入的迁移标记
+func v2StoreMigrated(be backend.Backend) bool {
+	tx := be.ReadTx()
+	tx.RLock()
+	defer tx.RUnlock()
+	_, vs := tx.UnsafeRange(buckets.Meta, buckets.MetaV2StoreMigratedKeyName, nil, 0)
+	return len(vs) != 0
+}
+
+// dropMigratedV2StoreContent 数据目录迁移过v2store并且废弃阶段不再允许v2store中有用户数据时,丢弃这些数据;
+// 它们已经保存在后端的 v2store 桶中
+func dropMigratedV2StoreContent(lg *zap.Logger, st v2store.Store, be backend.Backend, deprecationStage config.V2DeprecationEnum) error {
+	if !deprecationStage.IsAtLeast(config.V2_DEPR_1_WRITE_ONLY) || !v2StoreMigrated(be) {
+		return nil
+	}
+	ev, err := st.Get("/", true, false)
+	if err != nil {
+		return err
+	}
+	n := 0
+	for _, top := range ev.NodeExtern.ExternNodes {
+		if top.Key == StoreClusterPrefix {
+			continue
+		}
+		for _, node := range top.ExternNodes {
+			if _, err = st.Delete(node.Key, true, true); err != nil {
+				return err
+			}
+			n++
+		}
+	}
+	if n > 0 {
+		lg.Info("丢弃已迁移到后端的v2store数据", zap.Int("nodes", n), zap.String("v2-deprecation", string(deprecationStage)))
+	}
+	return nil
+}
@@ -17,6 +17,7 @@ package etcdserver
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/ls-2018/etcd_cn/etcd/etcdserver/api/membership"
@@ -96,6 +97,13 @@ func (a *reqV2HandlerEtcdServer) QGet(ctx context.Context, r *RequestV2) (Respon
 }
 
 func (a *reqV2HandlerEtcdServer) processRaftRequest(ctx context.Context, r *RequestV2) (Response, error) {
+	if a.s.ReadOnly() && r.Method != "QGET" {
+		return Response{}, ErrMemberReadOnly
+	}
+	// 成员信息也通过v2写入,副本集群只拒绝客户端的key
+	if a.s.IsReplica() && r.Method != "QGET" && strings.HasPrefix(r.Path, StoreKeysPrefix) {
+		return Response{}, ErrReplicaReadOnly
+	}
 	data, err := ((*pb.Request)(r)).Marshal()
 	if err != nil {
 		return Response{}, err
@@ -19,6 +19,7 @@ import (
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/ls-2018/etcd_cn/raft"
@@ -27,6 +28,7 @@ import (
 	"github.com/ls-2018/etcd_cn/etcd/etcdserver/api/membership"
 	"github.com/ls-2018/etcd_cn/etcd/mvcc"
 	"github.com/ls-2018/etcd_cn/offical/api/v3/membershippb"
+	"github.com/ls-2018/etcd_cn/offical/api/v3/version"
 	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
 	"github.com/ls-2018/etcd_cn/pkg/traceutil"
 
@@ -61,6 +63,7 @@ type Authenticator interface {
 	RoleDelete(ctx context.Context, r *pb.AuthRoleDeleteRequest) (*pb.AuthRoleDeleteResponse, error)
 	UserList(ctx context.Context, r *pb.AuthUserListRequest) (*pb.AuthUserListResponse, error)
 	RoleList(ctx context.Context, r *pb.AuthRoleListRequest) (*pb.AuthRoleListResponse, error)
+	Denials(ctx context.Context, r *pb.AuthDenialsRequest) (*pb.AuthDenialsResponse, error)
 }
 
 func isTxnSerializable(r *pb.TxnRequest) bool {
@@ -112,6 +115,8 @@ func (s *EtcdServer) Downgrade(ctx context.Context, r *pb.DowngradeRequest) (*pb
 		return s.downgradeEnable(ctx, r)
 	case pb.DowngradeRequest_CANCEL:
 		return s.downgradeCancel(ctx)
+	case pb.DowngradeRequest_PROMOTE:
+		return s.upgradePromote(ctx, r.Version)
 	default:
 		return nil, ErrUnknownMethod
 	}
@@ -196,6 +201,49 @@ func (s *EtcdServer) downgradeCancel(ctx context.Context) (*pb.DowngradeResponse
 	return &resp, nil
 }
 
+// upgradePromote 在所有成员都运行目标版本之后,把集群版本提升到目标版本;目标版本只能比当前集群版本高一个小版本.
+func (s *EtcdServer) upgradePromote(ctx context.Context, v string) (*pb.DowngradeResponse, error) {
+	targetVersion, err := convertToClusterVersion(v)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.linearizeReadNotify(ctx); err != nil {
+		return nil, err
+	}
+
+	cv := s.ClusterVersion()
+	if cv == nil {
+		return nil, ErrClusterVersionUnavailable
+	}
+	if cv.Equal(*targetVersion) {
+		return &pb.DowngradeResponse{Version: cv.String()}, nil
+	}
+	if targetVersion.Major != cv.Major || targetVersion.Minor != cv.Minor+1 {
+		return nil, ErrInvalidUpgradeTargetVersion
+	}
+	if s.cluster.DowngradeInfo().Enabled {
+		return nil, ErrDowngradeInProcess
+	}
+
+	lg := s.Logger()
+	mv := decideClusterVersion(lg, getVersions(lg, s.cluster, s.id, s.peerRt))
+	if mv == nil || mv.LessThan(*targetVersion) {
+		return nil, ErrMembersNotUpgraded
+	}
+
+	lg.Info("提升集群版本", zap.String("from", version.Cluster(cv.String())), zap.String("to", version.Cluster(targetVersion.String())))
+	req := pb.Request{
+		Method: "PUT",
+		Path:   membership.StoreClusterVersionKey(),
+		Val:    targetVersion.String(),
+	}
+	if _, err = s.Do(ctx, req); err != nil {
+		lg.Warn("提升集群版本失败", zap.Error(err))
+		return nil, err
+	}
+	return &pb.DowngradeResponse{Version: s.ClusterVersion().String()}, nil
+}
+
 // ----------------------------------------   OVER  ------------------------------------------------------------
 
 // AuthInfoFromCtx 获取认证信息
@@ -272,9 +320,21 @@ func (s *EtcdServer) processInternalRaftRequestOnce(ctx context.Context, r pb.In
 	if ci > ai+maxGapBetweenApplyAndCommitIndex {
 		return nil, ErrTooManyRequests
 	}
+	// 只读维护模式下拒绝写请求,登录仍然放行以便提供读服务
+	if s.ReadOnly() && r.Authenticate == nil {
+		return nil, ErrMemberReadOnly
+	}
+	if err := s.rejectReplicaWrite(ctx, &r); err != nil {
+		return nil, err
+	}
+	if err := s.admit(&r); err != nil {
+		return nil, err
+	}
 
 	r.Header = &pb.RequestHeader{
-		ID: s.reqIDGen.Next(), // 生成一个requestID
+		ID:      s.reqIDGen.Next(), // 生成一个requestID
+		Time:    time.Now().UnixNano(),
+		Replica: isReplicaApply(ctx),
 	}
 
 	// 检查authinfo是否不是InternalAuthenticateRequest
@@ -288,6 +348,9 @@ func (s *EtcdServer) processInternalRaftRequestOnce(ctx context.Context, r pb.In
 			r.Header.AuthRevision = authInfo.Revision
 		}
 	}
+	if err := s.checkUserQuota(&r); err != nil {
+		return nil, err
+	}
 	// 反序列化请求数据
 
 	data, err := r.Marshal()
@@ -303,26 +366,48 @@ func (s *EtcdServer) processInternalRaftRequestOnce(ctx context.Context, r pb.In
 	if id == 0 {
 		id = r.Header.ID
 	}
+	// 客户端剩余的时间不够处理请求时直接失败
+	budget, limited := s.requestBudget(ctx)
+	if limited && budget <= 0 {
+		requestBudgetExceeded.Inc()
+		return nil, &RequestBudgetError{Budget: budget}
+	}
+
 	ch := s.w.Register(id) // 注册一个channel,等待处理完成
 
-	cctx, cancel := context.WithTimeout(ctx, s.Cfg.ReqTimeout()) // 设置请求超时
+	cctx, cancel := context.WithTimeout(ctx, budget) // 设置请求超时
 	// cctx, cancel := context.WithTimeout(ctx, time.Second*1000) // 设置请求超时
 	defer cancel()
 
+	atomic.AddInt64(&s.admission.pending, 1)
+	defer atomic.AddInt64(&s.admission.pending, -1)
+
 	start := time.Now()
 	_ = s.applyEntryNormal
 	err = s.r.Propose(cctx, data) // 调用raft模块的Propose处理请求,存入到了待发送队列
 	if err != nil {
 		s.w.Trigger(id, nil)
+		if limited && err == context.DeadlineExceeded && ctx.Err() == nil {
+			return nil, s.budgetExceeded(budget, start, time.Now())
+		}
 		return nil, err
 	}
+	proposed := time.Now()
 
 	select {
 	// 等待收到apply结果返回给客户端
 	case x := <-ch:
-		return x.(*applyResult), nil
+		ar := x.(*applyResult)
+		if ar != nil && !ar.applyStart.IsZero() {
+			s.latency.observe(latencyProposalCommit, ar.applyStart.Sub(proposed))
+		}
+		return ar, nil
 	case <-cctx.Done():
 		s.w.Trigger(id, nil)
+		// 在客户端超时之前提前失败,并给出排队和等待apply的耗时
+		if limited && ctx.Err() == nil {
+			return nil, s.budgetExceeded(budget, start, proposed)
+		}
 		return nil, s.parseProposeCtxErr(cctx.Err(), start)
 	case <-s.done:
 		return nil, ErrStopped
@@ -351,35 +436,70 @@ func (a *applierV3backend) Apply(r *pb.InternalRaftRequest, shouldApplyV3 member
 	case r.DowngradeInfoSet != nil:
 		// 成员降级
 		a.s.applyV3Internal.DowngradeInfoSet(r.DowngradeInfoSet, shouldApplyV3)
-		return nil
+		// 返回空结果通知等待的请求,否则开启、取消降级的请求会一直等到超时
+		return ar
 	}
 
 	if !shouldApplyV3 {
 		return nil
 	}
+	if err := a.s.rejectPromotedReplicaApply(r); err != nil {
+		ar.err = err
+		return ar
+	}
 
 	switch {
 	case r.Range != nil:
 		ar.resp, ar.err = a.s.applyV3.Range(context.TODO(), nil, r.Range) // ✅
 	case r.Put != nil:
+		if resp := (&pb.PutResponse{}); a.s.idempotentPutPermitted(r.Header, r.Put) && a.s.idempotentResponse(r.Header, r.Put.IdempotencyToken, resp) {
+			ar.resp = resp
+			break
+		}
 		ar.resp, ar.trace, ar.err = a.s.applyV3.Put(context.TODO(), nil, r.Put) // ✅
+		if ar.err == nil {
+			a.s.saveIdempotentResponse(r.Header, r.Put.IdempotencyToken, ar.resp.(*pb.PutResponse))
+			a.s.accountUserWrite(r.Header, putBytes(r.Put))
+		}
 	case r.DeleteRange != nil:
 		ar.resp, ar.err = a.s.applyV3.DeleteRange(nil, r.DeleteRange) // ✅
 	case r.Txn != nil:
+		if resp := (&pb.TxnResponse{}); a.s.idempotentTxnPermitted(r.Header, r.Txn) && a.s.idempotentResponse(r.Header, r.Txn.IdempotencyToken, resp) {
+			ar.resp = resp
+			break
+		}
 		ar.resp, ar.trace, ar.err = a.s.applyV3.Txn(context.TODO(), r.Txn)
+		if ar.err == nil {
+			a.s.saveIdempotentResponse(r.Header, r.Txn.IdempotencyToken, ar.resp.(*pb.TxnResponse))
+			a.s.accountUserWrite(r.Header, txnWrittenBytes(r.Txn, ar.resp.(*pb.TxnResponse)))
+		}
 	case r.Compaction != nil:
 		ar.resp, ar.physc, ar.trace, ar.err = a.s.applyV3.Compaction(r.Compaction) // ✅ 压缩kv 历史事件
 	case r.LeaseGrant != nil:
 		ar.resp, ar.err = a.s.applyV3.LeaseGrant(r.LeaseGrant) // ✅ 创建租约
 	case r.LeaseRevoke != nil:
 		ar.resp, ar.err = a.s.applyV3.LeaseRevoke(r.LeaseRevoke) // ✅ 删除租约
+	case r.LeaseRevokeExpired != nil:
+		ar.resp, ar.err = a.s.applyLeaseRevokeExpired(r.LeaseRevokeExpired)
 	case r.LeaseCheckpoint != nil:
 		// 避免 leader 变更时,导致的租约重置
 		ar.resp, ar.err = a.s.applyV3.LeaseCheckpoint(r.LeaseCheckpoint) // ✅
 	case r.Alarm != nil:
 		ar.resp, ar.err = a.s.applyV3.Alarm(r.Alarm) // ✅
+	case r.NotifyCursor != nil:
+		ar.resp, ar.err = a.s.applyNotifyCursor(r.NotifyCursor)
+	case r.CompactionHold != nil:
+		ar.resp, ar.err = a.s.applyCompactionHold(r.CompactionHold)
+	case r.StagedTxn != nil:
+		ar.resp, ar.trace, ar.err = a.s.applyStagedTxn(r.Header, r.StagedTxn)
+	case r.UserUsageReset != nil:
+		ar.resp, ar.err = a.s.applyUserUsageReset(r.UserUsageReset)
+	case r.ReplicaPromote != nil:
+		ar.resp, ar.err = a.s.applyReplicaPromote(r.ReplicaPromote)
 	case r.Authenticate != nil:
 		ar.resp, ar.err = a.s.applyV3.Authenticate(r.Authenticate) // ✅
+	case r.AuthLoginFailure != nil:
+		ar.resp, ar.err = a.s.applyV3.LoginFailure(r.AuthLoginFailure)
 	case r.AuthEnable != nil:
 		ar.resp, ar.err = a.s.applyV3.AuthEnable() // ✅
 	case r.AuthDisable != nil:
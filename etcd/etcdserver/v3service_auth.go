@@ -3,6 +3,7 @@ package etcdserver
 import (
 	"context"
 	"encoding/base64"
+	"time"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/ls-2018/etcd_cn/etcd/auth"
@@ -30,6 +31,7 @@ type AuthClient interface {
 	RoleDelete(ctx context.Context, in *pb.AuthRoleDeleteRequest, opts ...grpc.CallOption) (*pb.AuthRoleDeleteResponse, error)
 	RoleGrantPermission(ctx context.Context, in *pb.AuthRoleGrantPermissionRequest, opts ...grpc.CallOption) (*pb.AuthRoleGrantPermissionResponse, error)
 	RoleRevokePermission(ctx context.Context, in *pb.AuthRoleRevokePermissionRequest, opts ...grpc.CallOption) (*pb.AuthRoleRevokePermissionResponse, error)
+	Denials(ctx context.Context, in *pb.AuthDenialsRequest, opts ...grpc.CallOption) (*pb.AuthDenialsResponse, error)
 }
 
 func (s *EtcdServer) AuthEnable(ctx context.Context, r *pb.AuthEnableRequest) (*pb.AuthEnableResponse, error) {
@@ -64,8 +66,23 @@ func (s *EtcdServer) Authenticate(ctx context.Context, r *pb.AuthenticateRequest
 	lg := s.Logger()
 
 	var resp proto.Message
+	var refreshToken string
 	for {
-		checkedRevision, err := s.AuthStore().CheckPassword(r.Name, r.Password)
+		var (
+			id              *auth.Identity
+			checkedRevision uint64
+			err             error
+		)
+		if r.RefreshToken != "" {
+			var name string
+			name, checkedRevision, err = s.AuthStore().CheckRefreshToken(r.RefreshToken)
+			id = &auth.Identity{Username: name}
+		} else {
+			id, checkedRevision, err = s.AuthStore().CheckCredentials(ctx, r.Name, r.Password)
+			if err == auth.ErrAuthFailed {
+				s.recordLoginFailure(ctx, r.Name)
+			}
+		}
 		if err != nil {
 			if err != auth.ErrAuthNotEnabled {
 				lg.Warn(
@@ -85,9 +102,32 @@ func (s *EtcdServer) Authenticate(ctx context.Context, r *pb.AuthenticateRequest
 		// internalReq doesn't need to have Password because the above s.AuthStore().CheckPassword() already did it.
 		// In addition, it will let a WAL entry not record password as a plain text.
 		internalReq := &pb.InternalAuthenticateRequest{
-			Name:        r.Name,
+			Name:        id.Username,
 			SimpleToken: st,
 		}
+		if id.Roles != nil {
+			// 外部认证的用户,角色随raft日志同步到所有节点
+			internalReq.External = true
+			internalReq.Roles = id.Roles
+			now := time.Now()
+			internalReq.ExternalIssuedAt = now.UnixNano()
+			internalReq.ExternalExpires = now.Add(auth.ExternalUserTTL).UnixNano()
+		} else {
+			// refresh token只在API层可见,raft日志中只记录摘要
+			var expiresAt int64
+			refreshToken, expiresAt, err = s.AuthStore().NewRefreshToken(id.Username)
+			if err != nil {
+				return nil, err
+			}
+			if refreshToken != "" {
+				internalReq.RefreshTokenHash = auth.HashRefreshToken(refreshToken)
+				internalReq.RefreshTokenExpires = expiresAt
+			}
+			if r.RefreshToken != "" {
+				internalReq.PrevRefreshTokenHash = auth.HashRefreshToken(r.RefreshToken)
+			}
+			internalReq.IssuedAt = time.Now().Unix()
+		}
 
 		resp, err = s.raftRequestOnce(ctx, pb.InternalRaftRequest{Authenticate: internalReq})
 		if err != nil {
@@ -98,21 +138,60 @@ func (s *EtcdServer) Authenticate(ctx context.Context, r *pb.AuthenticateRequest
 		}
 
 		lg.Info("revision when password checked became stale; retrying")
+		if r.RefreshToken != "" {
+			// 旧的refresh token已经作废,使用刚签发的重试
+			if refreshToken == "" {
+				return nil, auth.ErrInvalidRefreshToken
+			}
+			r.RefreshToken = refreshToken
+		}
+	}
+
+	ar := resp.(*pb.AuthenticateResponse)
+	ar.RefreshToken = refreshToken
+	return ar, nil
+}
+
+// recordLoginFailure 通过raft记录一次登录失败,保证所有节点的失败计数和锁定状态一致
+func (s *EtcdServer) recordLoginFailure(ctx context.Context, name string) {
+	if s.DowngradeFeatureBlocked(FeatureLoginLockout) {
+		return
 	}
+	req := s.AuthStore().NewLoginFailureRequest(name)
+	if req == nil {
+		return
+	}
+	if _, err := s.raftRequestOnce(ctx, pb.InternalRaftRequest{AuthLoginFailure: req}); err != nil {
+		s.Logger().Warn("failed to record login failure", zap.String("user", name), zap.Error(err))
+	}
+}
 
-	return resp.(*pb.AuthenticateResponse), nil
+// Denials 返回本节点记录的权限检查失败;记录不经过raft,只有root用户可以查看
+func (s *EtcdServer) Denials(ctx context.Context, r *pb.AuthDenialsRequest) (*pb.AuthDenialsResponse, error) {
+	authInfo, err := s.AuthInfoFromCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.AuthStore().IsAdminPermitted(authInfo); err != nil {
+		return nil, err
+	}
+	return &pb.AuthDenialsResponse{Header: newHeader(s), Denials: s.AuthStore().Denials(int(r.Limit))}, nil
 }
 
 // ------------------------------------------- OVER ---------------------------------------------------------vv
 
 func (s *EtcdServer) UserAdd(ctx context.Context, r *pb.AuthUserAddRequest) (*pb.AuthUserAddResponse, error) {
 	if r.Options == nil || !r.Options.NoPassword {
+		if err := s.AuthStore().ValidatePassword(r.Password); err != nil {
+			return nil, err
+		}
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(r.Password), s.authStore.BcryptCost())
 		if err != nil {
 			return nil, err
 		}
 		r.HashedPassword = base64.StdEncoding.EncodeToString(hashedPassword)
 		r.Password = ""
+		r.PasswordChangedAt = time.Now().Unix()
 	}
 
 	resp, err := s.raftRequest(ctx, pb.InternalRaftRequest{AuthUserAdd: r})
@@ -132,12 +211,16 @@ func (s *EtcdServer) UserDelete(ctx context.Context, r *pb.AuthUserDeleteRequest
 
 func (s *EtcdServer) UserChangePassword(ctx context.Context, r *pb.AuthUserChangePasswordRequest) (*pb.AuthUserChangePasswordResponse, error) {
 	if r.Password != "" {
+		if err := s.AuthStore().ValidatePassword(r.Password); err != nil {
+			return nil, err
+		}
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(r.Password), s.authStore.BcryptCost())
 		if err != nil {
 			return nil, err
 		}
 		r.HashedPassword = base64.StdEncoding.EncodeToString(hashedPassword)
 		r.Password = ""
+		r.PasswordChangedAt = time.Now().Unix()
 	}
 
 	resp, err := s.raftRequest(ctx, pb.InternalRaftRequest{AuthUserChangePassword: r})
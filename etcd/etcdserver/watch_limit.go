@@ -0,0 +1,129 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdserver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	watchLimitRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "etcd",
+		Subsystem: "server",
+		Name:      "watch_limit_rejected_total",
+		Help:      "The total number of watch creations rejected by the per-connection or per-user watch limit.",
+	}, []string{"limit"})
+	watchesPerUser = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "etcd",
+		Subsystem: "server",
+		Name:      "user_watches",
+		Help:      "The number of active watches created by each auth user on this member.",
+	}, []string{"user"})
+)
+
+func init() {
+	prometheus.MustRegister(watchLimitRejected)
+	prometheus.MustRegister(watchesPerUser)
+}
+
+// ParseWatchLimitOverrides 解析 "user:alice=1000,user:ctrl=0" 格式的配置,0表示不限制该用户
+func ParseWatchLimitOverrides(s string) (map[string]int, error) {
+	o := make(map[string]int)
+	if s == "" {
+		return o, nil
+	}
+	for _, item := range strings.Split(s, ",") {
+		kv := strings.SplitN(strings.TrimSpace(item), "=", 2)
+		if len(kv) != 2 || !strings.HasPrefix(kv[0], "user:") || len(kv[0]) == len("user:") {
+			return nil, fmt.Errorf("invalid watch limit override %q (expected user:<name>=<limit>)", item)
+		}
+		n, err := strconv.Atoi(kv[1])
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid watch limit %q in %q", kv[1], item)
+		}
+		o[strings.TrimPrefix(kv[0], "user:")] = n
+	}
+	return o, nil
+}
+
+// watchLimiter 统计本成员每个gRPC连接和每个用户的活跃watch数
+type watchLimiter struct {
+	maxPerConn int
+	maxPerUser int
+	overrides  map[string]int
+
+	mu    sync.Mutex
+	conns map[string]int
+	users map[string]int
+}
+
+func (l *watchLimiter) userLimit(user string) int {
+	if n, ok := l.overrides[user]; ok {
+		return n
+	}
+	return l.maxPerUser
+}
+
+// AcquireWatch 在创建watch前调用,超过连接或用户的限制时返回 ErrWatchLimitExceeded;
+// user 为空(未开启鉴权)时只检查连接的限制
+func (s *EtcdServer) AcquireWatch(conn, user string) error {
+	l := &s.watchLimits
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conns == nil {
+		l.conns, l.users = make(map[string]int), make(map[string]int)
+	}
+	if l.maxPerConn > 0 && l.conns[conn] >= l.maxPerConn {
+		watchLimitRejected.WithLabelValues("connection").Inc()
+		return ErrWatchLimitExceeded
+	}
+	if user != "" {
+		if max := l.userLimit(user); max > 0 && l.users[user] >= max {
+			watchLimitRejected.WithLabelValues("user").Inc()
+			return ErrWatchLimitExceeded
+		}
+		l.users[user]++
+		watchesPerUser.WithLabelValues(user).Set(float64(l.users[user]))
+	}
+	l.conns[conn]++
+	return nil
+}
+
+// ReleaseWatch 在watch取消或流关闭时归还 n 个watch
+func (s *EtcdServer) ReleaseWatch(conn, user string, n int) {
+	if n <= 0 {
+		return
+	}
+	l := &s.watchLimits
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conns[conn] -= n; l.conns[conn] <= 0 {
+		delete(l.conns, conn)
+	}
+	if user == "" {
+		return
+	}
+	if l.users[user] -= n; l.users[user] <= 0 {
+		delete(l.users, user)
+		watchesPerUser.DeleteLabelValues(user)
+		return
+	}
+	watchesPerUser.WithLabelValues(user).Set(float64(l.users[user]))
+}
@@ -0,0 +1,48 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lease
+
+import (
+	"math/rand"
+	"time"
+)
+
+// JitterTTL 给ttl加上[0, ttl*jitter]的随机秒数,使大量相同TTL的租约不会同时到期; jitter为0时原样返回.
+// 需要在提交到raft之前调用,保证所有成员使用相同的TTL
+func JitterTTL(ttl int64, jitter float64) int64 {
+	if jitter <= 0 || ttl <= 0 {
+		return ttl
+	}
+	n := int64(float64(ttl) * jitter)
+	if n <= 0 {
+		return ttl
+	}
+	ttl += rand.Int63n(n + 1)
+	if ttl > MaxLeaseTTL {
+		ttl = MaxLeaseTTL
+	}
+	return ttl
+}
+
+// NextKeepAlive 返回TTL为ttl秒的租约建议的下次续约间隔,在ttl的1/4到1/3之间随机,
+// 避免使用相同TTL的客户端同时续约
+func NextKeepAlive(ttl int64) time.Duration {
+	if ttl <= 0 {
+		return 0
+	}
+	max := time.Duration(ttl) * time.Second / 3
+	min := time.Duration(ttl) * time.Second / 4
+	return min + time.Duration(rand.Int63n(int64(max-min)+1))
+}
@@ -0,0 +1,51 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lease
+
+import "sort"
+
+// Parent 返回父租约ID,没有时返回NoLease
+func (l *Lease) Parent() LeaseID {
+	return l.parent
+}
+
+// addChild 需要持有lessor.mu
+func (l *Lease) addChild(id LeaseID) {
+	if l.children == nil {
+		l.children = make(map[LeaseID]struct{})
+	}
+	l.children[id] = struct{}{}
+}
+
+// unsafeDescendants 返回l的所有子孙租约,子租约排在父租约之前,同一层按ID排序,
+// 保证所有成员以相同的顺序删除; 需要持有lessor.mu
+func (le *lessor) unsafeDescendants(l *Lease) []*Lease {
+	ids := make([]LeaseID, 0, len(l.children))
+	for id := range l.children {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	var ds []*Lease
+	for _, id := range ids {
+		c := le.leaseMap[id]
+		if c == nil {
+			continue
+		}
+		ds = append(ds, le.unsafeDescendants(c)...)
+		ds = append(ds, c)
+	}
+	return ds
+}
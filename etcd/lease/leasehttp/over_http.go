@@ -32,8 +32,11 @@ import (
 var (
 	LeasePrefix         = "/leases"
 	LeaseInternalPrefix = "/leases/internal"
+	LeaseBatchPrefix    = "/leases/batch"
 	applyTimeout        = time.Second
 	ErrLeaseHTTPTimeout = errors.New("waiting for node to catch up its applied index has timed out")
+	// ErrBatchRenewUnsupported leader不支持批量续约,调用方应逐个续约
+	ErrBatchRenewUnsupported = errors.New("lease: leader不支持批量续约")
 )
 
 func NewHandler(l lease.Lessor, waitch func() <-chan struct{}) http.Handler {
@@ -90,6 +93,38 @@ func (h *leaseHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+	case LeaseBatchPrefix:
+		lreq := pb.LeaseKeepAliveRequest{}
+		if uerr := lreq.Unmarshal(b); uerr != nil {
+			http.Error(w, "反序列失败", http.StatusBadRequest)
+			return
+		}
+		select {
+		case <-h.waitch():
+		case <-time.After(applyTimeout):
+			http.Error(w, ErrLeaseHTTPTimeout.Error(), http.StatusRequestTimeout)
+			return
+		}
+		ids := make([]lease.LeaseID, len(lreq.IDs))
+		for i, id := range lreq.IDs {
+			ids[i] = lease.LeaseID(id)
+		}
+		ttls, rerr := h.l.RenewBatch(ids)
+		if rerr != nil {
+			// 不使用404,404表示leader不支持批量续约
+			http.Error(w, rerr.Error(), http.StatusBadRequest)
+			return
+		}
+		resp := &pb.LeaseKeepAliveResponse{Results: make([]*pb.LeaseKeepAliveResult, len(ids))}
+		for i := range ids {
+			resp.Results[i] = &pb.LeaseKeepAliveResult{ID: lreq.IDs[i], TTL: ttls[i]}
+		}
+		v, err = resp.Marshal()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
 	case LeaseInternalPrefix:
 		lreq := leasepb.LeaseInternalRequest{}
 		if lerr := lreq.Unmarshal(b); lerr != nil {
@@ -113,6 +148,7 @@ func (h *leaseHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				ID:         lreq.LeaseTimeToLiveRequest.ID,
 				TTL:        int64(l.Remaining().Seconds()),
 				GrantedTTL: l.TTL(),
+				Metadata:   l.Metadata(),
 			},
 		}
 		if lreq.LeaseTimeToLiveRequest.Keys {
@@ -184,6 +220,64 @@ func RenewHTTP(ctx context.Context, id lease.LeaseID, url string, rt http.RoundT
 	return lresp.TTL, nil
 }
 
+// RenewBatchHTTP 把批量续约请求转发给leader,返回每个租约续约后的TTL;
+// leader不支持时返回ErrBatchRenewUnsupported
+func RenewBatchHTTP(ctx context.Context, ids []lease.LeaseID, url string, rt http.RoundTripper) ([]int64, error) {
+	lr := &pb.LeaseKeepAliveRequest{IDs: make([]int64, len(ids))}
+	for i, id := range ids {
+		lr.IDs[i] = int64(id)
+	}
+	lreq, err := lr.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	cc := &http.Client{Transport: rt}
+	req, err := http.NewRequest("POST", url, bytes.NewReader(lreq))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/protobuf")
+	req = req.WithContext(ctx)
+
+	resp, err := cc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	b, err := readResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusRequestTimeout {
+		return nil, ErrLeaseHTTPTimeout
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrBatchRenewUnsupported
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("lease: unknown error(%s)", string(b))
+	}
+
+	lresp := &pb.LeaseKeepAliveResponse{}
+	if err := lresp.Unmarshal(b); err != nil {
+		return nil, fmt.Errorf(`lease: %v. data = "%s"`, err, string(b))
+	}
+	if len(lresp.Results) != len(ids) {
+		return nil, fmt.Errorf("lease: renew batch size mismatch")
+	}
+	ttls := make([]int64, len(ids))
+	for i, r := range lresp.Results {
+		if r.ID != int64(ids[i]) {
+			return nil, fmt.Errorf("lease: renew id mismatch")
+		}
+		ttls[i] = r.TTL
+	}
+	return ttls, nil
+}
+
 func TimeToLiveHTTP(ctx context.Context, id lease.LeaseID, keys bool, url string, rt http.RoundTripper) (*leasepb.LeaseInternalResponse, error) {
 	// will post lreq protobuf to leader
 	lreq, err := (&leasepb.LeaseInternalRequest{
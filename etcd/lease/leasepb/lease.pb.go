@@ -31,6 +31,12 @@ type Lease struct {
 	ID           int64 `protobuf:"varint,1,opt,name=ID,proto3" json:"ID,omitempty"`
 	TTL          int64 `protobuf:"varint,2,opt,name=TTL,proto3" json:"TTL,omitempty"`
 	RemainingTTL int64 `protobuf:"varint,3,opt,name=RemainingTTL,proto3" json:"RemainingTTL,omitempty"`
+	// CheckpointTime 最近一次检查点的unix纳秒时间戳,0表示未知
+	CheckpointTime int64 `protobuf:"varint,4,opt,name=CheckpointTime,proto3" json:"CheckpointTime,omitempty"`
+	// Parent 父租约ID,0表示没有
+	Parent int64 `protobuf:"varint,5,opt,name=Parent,proto3" json:"Parent,omitempty"`
+	// Metadata 创建租约时附带的数据
+	Metadata string `protobuf:"bytes,6,opt,name=Metadata,proto3" json:"Metadata,omitempty"`
 }
 
 func (m *Lease) Reset()         { *m = Lease{} }
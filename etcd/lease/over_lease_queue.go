@@ -29,7 +29,11 @@ type LeaseQueue []*LeaseWithTime
 
 func (pq LeaseQueue) Len() int { return len(pq) }
 
+// Less 时间相同时按租约ID排序,保证顺序确定
 func (pq LeaseQueue) Less(i, j int) bool {
+	if pq[i].time.Equal(pq[j].time) {
+		return pq[i].id < pq[j].id
+	}
 	return pq[i].time.Before(pq[j].time)
 }
 
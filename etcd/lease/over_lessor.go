@@ -21,6 +21,7 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"runtime"
 	"sort"
 	"sync"
 	"time"
@@ -36,21 +37,29 @@ import (
 const (
 	NoLease     = LeaseID(0) // 是一个特殊的LeaseID,表示没有租约.
 	MaxLeaseTTL = 9000000000
+	// MaxLeaseMetadataSize 租约metadata的最大字节数,metadata随每个租约保存在内存和后端中
+	MaxLeaseMetadataSize = 1024
 )
 
 var v3_6 = semver.Version{Major: 3, Minor: 6}
 
+// expiredLeaseRevokeInterval 查找过期租约的时间间隔,每次最多撤销 revokeRate*interval 个
+const expiredLeaseRevokeInterval = 500 * time.Millisecond
+
 var (
-	forever                          = time.Time{}
-	leaseRevokeRate                  = 1000            // 每秒撤销租约的最大数量；可为测试配置
-	leaseCheckpointRate              = 1000            // 每秒记录在共识日志中的最大租约快照数量；可对测试进行配置
-	defaultLeaseCheckpointInterval   = 5 * time.Minute // 租约快照的默认时间间隔
-	maxLeaseCheckpointBatchSize      = 1000            // 租约快照的最大数量,以批处理为一个单一的共识日志条目
-	defaultExpiredleaseRetryInterval = 3 * time.Second // 检查过期租约是否被撤销的默认时间间隔.
-	ErrNotPrimary                    = errors.New("不是主 lessor")
-	ErrLeaseNotFound                 = errors.New("lease没有发现")
-	ErrLeaseExists                   = errors.New("lease已存在")
-	ErrLeaseTTLTooLarge              = errors.New("过大的TTL")
+	forever                               = time.Time{}
+	DefaultLeaseRevokeRate                = 1000            // 每秒撤销过期租约的最大数量的默认值
+	leaseCheckpointRate                   = 1000            // 每秒记录在共识日志中的最大租约快照数量；可对测试进行配置
+	DefaultLeaseCheckpointInterval        = 5 * time.Minute // 租约快照的默认时间间隔
+	DefaultConsolidatedCheckpointInterval = 0 * time.Second // 汇总检查点默认关闭,租约较多时会带来大量raft写入,需要显式开启
+	maxLeaseCheckpointBatchSize           = 1000            // 租约快照的最大数量,以批处理为一个单一的共识日志条目
+	defaultExpiredleaseRetryInterval      = 3 * time.Second // 检查过期租约是否被撤销的默认时间间隔.
+	ErrNotPrimary                         = errors.New("不是主 lessor")
+	ErrLeaseNotFound                      = errors.New("lease没有发现")
+	ErrLeaseExists                        = errors.New("lease已存在")
+	ErrLeaseTTLTooLarge                   = errors.New("过大的TTL")
+	ErrParentLeaseNotFound                = errors.New("父租约不存在")
+	ErrLeaseMetadataTooLarge              = fmt.Errorf("租约metadata超过%d字节", MaxLeaseMetadataSize)
 )
 
 type TxnDelete interface {
@@ -63,6 +72,9 @@ type RangeDeleter func() TxnDelete
 // Checkpointer 允许对租约剩余ttl的检查点到 wal日志.这里定义是为了避免与mvcc的循环依赖.
 type Checkpointer func(ctx context.Context, lc *pb.LeaseCheckpointRequest)
 
+// EventNotifier 接收租约的生命周期事件,在持有lessor锁时调用,不能阻塞也不能回调lessor.
+type EventNotifier func(ev *pb.LeaseEvent)
+
 type LeaseID int64
 
 // Lessor 创建、移除、更新租约
@@ -72,15 +84,18 @@ type Lessor interface {
 	// new TxnDeletes.
 	SetRangeDeleter(rd RangeDeleter)
 	SetCheckpointer(cp Checkpointer)
-	Grant(id LeaseID, ttl int64) (*Lease, error)     // 创建一个制定了过期时间的租约
-	Revoke(id LeaseID) error                         // 移除租约
-	Checkpoint(id LeaseID, remainingTTL int64) error // 更新租约的剩余时间到其他节点
-	Attach(id LeaseID, items []LeaseItem) error      //
-	GetLease(item LeaseItem) LeaseID                 // 返回给定项目的LeaseID.如果没有找到租约,则返回NoLease值.
-	Detach(id LeaseID, items []LeaseItem) error      // 将租约从key上移除
-	Promote(extend time.Duration)                    // 推动lessor成为主lessor.主lessor管理租约的到期和续期.新晋升的lessor更新所有租约的ttl 以延长先前的ttl
-	Demote()                                         // leader变更,触发
-	Renew(id LeaseID) (int64, error)                 // 重新计算过期时间
+	SetEventNotifier(en EventNotifier)
+	Grant(id LeaseID, ttl int64, parent LeaseID, metadata string) (*Lease, error) // 创建一个制定了过期时间的租约,parent不为NoLease时作为该租约的子租约
+	Revoke(id LeaseID) error                                                      // 移除租约以及所有子租约
+	RevokeExpired(id LeaseID) error                                               // 同Revoke,但通知的事件为过期
+	Checkpoint(id LeaseID, remainingTTL, checkpointTime int64) error              // 更新租约的剩余时间到其他节点
+	Attach(id LeaseID, items []LeaseItem) error                                   //
+	GetLease(item LeaseItem) LeaseID                                              // 返回给定项目的LeaseID.如果没有找到租约,则返回NoLease值.
+	Detach(id LeaseID, items []LeaseItem) error                                   // 将租约从key上移除
+	Promote(extend time.Duration)                                                 // 推动lessor成为主lessor.主lessor管理租约的到期和续期.新晋升的lessor更新所有租约的ttl 以延长先前的ttl
+	Demote()                                                                      // leader变更,触发
+	Renew(id LeaseID) (int64, error)                                              // 重新计算过期时间
+	RenewBatch(ids []LeaseID) ([]int64, error)                                    // 一次续约多个租约,不存在或已过期的租约TTL为0
 	Lookup(id LeaseID) *Lease
 	Leases() []*Lease                // 获取当前节点上的所有租约
 	ExpiredLeasesC() <-chan []*Lease // 返回一个用于接收过期租约的CHAN.
@@ -97,6 +112,7 @@ type lessor struct {
 	itemMap              map[LeaseItem]LeaseID // key 关联到了哪个租约
 	rd                   RangeDeleter          // 租约过期时,使用范围删除
 	cp                   Checkpointer          // 当一个租约的最后期限应该被持久化,以保持跨领袖选举和重启的剩余TTL,出租人将通过Checkpointer对租约进行检查.
+	en                   EventNotifier         // 租约事件通知,可以为nil
 	b                    backend.Backend       // 持久化租约到bolt.db.
 	minLeaseTTL          int64                 // 是可授予租约的最小租期TTL.任何缩短TTL的请求都被扩展到最小TTL.
 	expiredC             chan []*Lease         // 发送一批已经过期的租约
@@ -107,17 +123,26 @@ type lessor struct {
 	checkpointInterval        time.Duration // 租约快照的默认时间间隔
 	expiredLeaseRetryInterval time.Duration // 检查过期租约是否被撤销的默认时间间隔
 	checkpointPersist         bool          // lessor是否应始终保持剩余的TTL（在v3.6中始终启用）.
-	cluster                   cluster       // 基于集群版本  调整lessor逻辑
+	// consolidatedInterval 定期把所有租约(包括ttl小于checkpointInterval的短租约)的剩余时间汇总成检查点,0表示关闭
+	consolidatedInterval time.Duration
+	lastConsolidated     time.Time
+	revokeRate           int     // 每秒最多撤销的过期租约数
+	restoreWorkers       int     // 恢复租约时并发解码的协程数
+	cluster              cluster // 基于集群版本  调整lessor逻辑
 }
 type Lease struct {
 	ID           LeaseID                // 租约ID ,   自增得到的,
 	ttl          int64                  // 租约的生存时间,以秒为单位
 	remainingTTL int64                  // 剩余生存时间,以秒为单位,如果为零,则视为未设置,应使用完整的tl.
+	checkpointAt int64                  // 计算remainingTTL时的unix纳秒时间戳,0表示未知
 	expiryMu     sync.RWMutex           // 保护并发的访问
 	expiry       time.Time              // 是租约到期的时间.当expiry.IsZero()为真时,永久存在.
 	mu           sync.RWMutex           // 保护并发的访问 itemSet
 	itemSet      map[LeaseItem]struct{} // 哪些租约附加到了key
 	revokec      chan struct{}          // 租约被删除、到期 关闭此channel,触发后续逻辑
+	parent       LeaseID                // 父租约,NoLease表示没有
+	children     map[LeaseID]struct{}   // 子租约,由lessor.mu保护
+	metadata     string                 // 创建租约时附带的数据,例如所属服务名
 }
 
 type cluster interface {
@@ -129,6 +154,12 @@ type LessorConfig struct {
 	CheckpointInterval         time.Duration // 租约快照的默认时间间隔
 	ExpiredLeasesRetryInterval time.Duration // 租约快照的默认时间间隔
 	CheckpointPersist          bool          // lessor是否应始终保持剩余的TTL（在v3.6中始终启用）.
+	// ConsolidatedCheckpointInterval 汇总检查点的时间间隔,0表示关闭
+	ConsolidatedCheckpointInterval time.Duration
+	// ExpiredLeasesRevokeRate 每秒最多撤销的过期租约数,0使用默认值
+	ExpiredLeasesRevokeRate int
+	// RestoreWorkers 从bolt.db恢复租约时并发解码的协程数,0表示使用 GOMAXPROCS
+	RestoreWorkers int
 }
 
 func NewLessor(lg *zap.Logger, b backend.Backend, cluster cluster, cfg LessorConfig) Lessor {
@@ -160,7 +191,7 @@ func (le *lessor) Promote(extend time.Duration) {
 		le.scheduleCheckpointIfNeeded(l)
 	}
 
-	if len(le.leaseMap) < leaseRevokeRate {
+	if len(le.leaseMap) < le.revokeRate {
 		// 没有租约堆积的可能性
 		return
 	}
@@ -173,7 +204,7 @@ func (le *lessor) Promote(extend time.Duration) {
 	nextWindow := baseWindow + time.Second
 	expires := 0 // 到期
 	// 失效期限少于总失效率,所以堆积的租约不会消耗整个失效限制
-	targetExpiresPerSecond := (3 * leaseRevokeRate) / 4
+	targetExpiresPerSecond := (3 * le.revokeRate) / 4
 	for _, l := range leases {
 		remaining := l.Remaining()
 		if remaining > nextWindow {
@@ -237,11 +268,17 @@ func (fl *FakeLessor) SetRangeDeleter(dr RangeDeleter) {}
 
 func (fl *FakeLessor) SetCheckpointer(cp Checkpointer) {}
 
-func (fl *FakeLessor) Grant(id LeaseID, ttl int64) (*Lease, error) { return nil, nil }
+func (fl *FakeLessor) SetEventNotifier(en EventNotifier) {}
+
+func (fl *FakeLessor) Grant(id LeaseID, ttl int64, parent LeaseID, metadata string) (*Lease, error) {
+	return nil, nil
+}
 
 func (fl *FakeLessor) Revoke(id LeaseID) error { return nil }
 
-func (fl *FakeLessor) Checkpoint(id LeaseID, remainingTTL int64) error { return nil }
+func (fl *FakeLessor) RevokeExpired(id LeaseID) error { return nil }
+
+func (fl *FakeLessor) Checkpoint(id LeaseID, remainingTTL, checkpointTime int64) error { return nil }
 
 func (fl *FakeLessor) Attach(id LeaseID, items []LeaseItem) error { return nil }
 
@@ -255,6 +292,14 @@ func (fl *FakeLessor) Demote() {}
 
 func (fl *FakeLessor) Renew(id LeaseID) (int64, error) { return 10, nil }
 
+func (fl *FakeLessor) RenewBatch(ids []LeaseID) ([]int64, error) {
+	ttls := make([]int64, len(ids))
+	for i := range ttls {
+		ttls[i] = 10
+	}
+	return ttls, nil
+}
+
 func (fl *FakeLessor) Lookup(id LeaseID) *Lease { return nil }
 
 func (fl *FakeLessor) Leases() []*Lease { return nil }
@@ -275,7 +320,7 @@ func (ftd *FakeTxnDelete) End()                                       { ftd.Unlo
 // --------------------------------------------- OVER  -----------------------------------------------------------------
 
 // Grant 创建租约
-func (le *lessor) Grant(id LeaseID, ttl int64) (*Lease, error) {
+func (le *lessor) Grant(id LeaseID, ttl int64, parent LeaseID, metadata string) (*Lease, error) {
 	if id == NoLease {
 		return nil, ErrLeaseNotFound
 	}
@@ -283,13 +328,18 @@ func (le *lessor) Grant(id LeaseID, ttl int64) (*Lease, error) {
 	if ttl > MaxLeaseTTL {
 		return nil, ErrLeaseTTLTooLarge
 	}
+	if len(metadata) > MaxLeaseMetadataSize {
+		return nil, ErrLeaseMetadataTooLarge
+	}
 
 	// lessor在高负荷时,应延长租期,以减少续租.
 	l := &Lease{
-		ID:      id,
-		ttl:     ttl,
-		itemSet: make(map[LeaseItem]struct{}),
-		revokec: make(chan struct{}), // 租约被删除、到期 关闭此channel,触发后续逻辑
+		ID:       id,
+		ttl:      ttl,
+		itemSet:  make(map[LeaseItem]struct{}),
+		revokec:  make(chan struct{}), // 租约被删除、到期 关闭此channel,触发后续逻辑
+		parent:   parent,
+		metadata: metadata,
 	}
 
 	le.mu.Lock()
@@ -298,6 +348,13 @@ func (le *lessor) Grant(id LeaseID, ttl int64) (*Lease, error) {
 	if _, ok := le.leaseMap[id]; ok {
 		return nil, ErrLeaseExists
 	}
+	if parent != NoLease {
+		p := le.leaseMap[parent]
+		if p == nil {
+			return nil, ErrParentLeaseNotFound
+		}
+		p.addChild(id)
+	}
 
 	if l.ttl < le.minLeaseTTL {
 		l.ttl = le.minLeaseTTL
@@ -317,6 +374,7 @@ func (le *lessor) Grant(id LeaseID, ttl int64) (*Lease, error) {
 		le.leaseExpiredNotifier.RegisterOrUpdate(item)
 		le.scheduleCheckpointIfNeeded(l)
 	}
+	le.unsafeNotify(pb.LeaseEvent_GRANTED, l, l.ttl)
 
 	return l, nil
 }
@@ -380,8 +438,11 @@ func (le *lessor) findExpiredLeases(limit int) []*Lease {
 func (le *lessor) revokeExpiredLeases() {
 	var ls []*Lease
 
-	// 每秒撤销租约的最大数量,  500ms调用一次,那么限制应该改为 /2
-	revokeLimit := leaseRevokeRate / 2
+	// 每秒撤销租约的最大数量,按调用间隔折算成每次的上限
+	revokeLimit := int(int64(le.revokeRate) * int64(expiredLeaseRevokeInterval) / int64(time.Second))
+	if revokeLimit < 1 {
+		revokeLimit = 1
+	}
 
 	le.mu.RLock()
 	if le.isPrimary() { // 主
@@ -389,6 +450,14 @@ func (le *lessor) revokeExpiredLeases() {
 		ls = le.findExpiredLeases(revokeLimit)
 	}
 	le.mu.RUnlock()
+	// 最早过期的先撤销,过期时间相同时按ID,所有leader产生的顺序一致
+	sort.Slice(ls, func(i, j int) bool {
+		ei, ej := ls[i].expiryTime(), ls[j].expiryTime()
+		if ei.Equal(ej) {
+			return ls[i].ID < ls[j].ID
+		}
+		return ei.Before(ej)
+	})
 
 	if len(ls) != 0 {
 		select {
@@ -406,20 +475,40 @@ func (le *lessor) ExpiredLeasesC() <-chan []*Lease {
 	return le.expiredC
 }
 
-// Revoke 从kvindex以及bolt.db中删除
+// Revoke 从kvindex以及bolt.db中删除; 子租约先于父租约被删除
 func (le *lessor) Revoke(id LeaseID) error {
-	le.mu.Lock()
+	return le.revokeTree(id, pb.LeaseEvent_REVOKED)
+}
 
+// RevokeExpired 撤销过期的租约,该租约通知EXPIRED事件,级联撤销的子租约通知REVOKED事件
+func (le *lessor) RevokeExpired(id LeaseID) error {
+	return le.revokeTree(id, pb.LeaseEvent_EXPIRED)
+}
+
+func (le *lessor) revokeTree(id LeaseID, typ pb.LeaseEvent_EventType) error {
+	le.mu.Lock()
 	l := le.leaseMap[id]
 	if l == nil {
 		le.mu.Unlock()
 		return ErrLeaseNotFound
 	}
-	defer close(l.revokec)
+	descendants := le.unsafeDescendants(l)
 	le.mu.Unlock()
+
+	for _, d := range descendants {
+		le.revoke(d, pb.LeaseEvent_REVOKED)
+	}
+	le.revoke(l, typ)
+	return nil
+}
+
+// revoke 删除单个租约以及附加在上面的key
+func (le *lessor) revoke(l *Lease, typ pb.LeaseEvent_EventType) {
+	id := l.ID
+	defer close(l.revokec)
 	// mvcc.newWatchableStore
 	if le.rd == nil {
-		return nil
+		return
 	}
 
 	txn := le.rd()
@@ -435,10 +524,13 @@ func (le *lessor) Revoke(id LeaseID) error {
 	le.mu.Lock()
 	defer le.mu.Unlock()
 	delete(le.leaseMap, l.ID)
+	if p := le.leaseMap[l.parent]; p != nil {
+		delete(p.children, l.ID)
+	}
 	// 租约的删除需要与kv的删除在同一个后台事务中.否则,如果 etcdserver 在两者之间发生故障,我们可能会出现不执行撤销或不删除钥匙的结果.
 	le.b.BatchTx().UnsafeDelete(buckets.Lease, int64ToBytes(int64(l.ID))) // 删除bolt.db 里的key
 	txn.End()
-	return nil
+	le.unsafeNotify(typ, l, 0)
 }
 
 // Remaining 返回剩余时间
@@ -466,11 +558,18 @@ func (l *Lease) expired() bool {
 	return l.Remaining() <= 0
 }
 
+// expiryTime 返回租约的到期时间
+func (l *Lease) expiryTime() time.Time {
+	l.expiryMu.RLock()
+	defer l.expiryMu.RUnlock()
+	return l.expiry
+}
+
 // 持久化租约
 func (l *Lease) persistTo(b backend.Backend) {
 	key := int64ToBytes(int64(l.ID))
 
-	lpb := leasepb.Lease{ID: int64(l.ID), TTL: l.ttl, RemainingTTL: l.remainingTTL}
+	lpb := leasepb.Lease{ID: int64(l.ID), TTL: l.ttl, RemainingTTL: l.remainingTTL, CheckpointTime: l.checkpointAt, Parent: int64(l.parent), Metadata: l.metadata}
 	val, err := lpb.Marshal()
 	if err != nil {
 		panic("序列化lease消息失败")
@@ -485,6 +584,11 @@ func (l *Lease) TTL() int64 {
 	return l.ttl
 }
 
+// Metadata 返回创建租约时附带的数据
+func (l *Lease) Metadata() string {
+	return l.metadata
+}
+
 // Keys 返回当前组约绑定到了哪些key
 func (l *Lease) Keys() []string {
 	l.mu.RLock()
@@ -504,16 +608,36 @@ func (l *Lease) getRemainingTTL() int64 {
 	return l.ttl
 }
 
+// remainingAt 返回now时租约还剩多少时间;检查点记录了生成时间时,扣除从检查点到now经过的时间,
+// 避免leader变更后租约按检查点时的剩余时间重新计时
+func (l *Lease) remainingAt(now time.Time) time.Duration {
+	remaining := time.Duration(l.getRemainingTTL()) * time.Second
+	if l.remainingTTL <= 0 || l.checkpointAt <= 0 {
+		return remaining
+	}
+	if elapsed := now.Sub(time.Unix(0, l.checkpointAt)); elapsed > 0 {
+		remaining -= elapsed
+	}
+	if remaining < 0 {
+		remaining = 0
+	}
+	return remaining
+}
+
 // 创建租约管理器
 func newLessor(lg *zap.Logger, b backend.Backend, cluster cluster, cfg LessorConfig) *lessor {
 	checkpointInterval := cfg.CheckpointInterval
 	expiredLeaseRetryInterval := cfg.ExpiredLeasesRetryInterval
 	if checkpointInterval == 0 {
-		checkpointInterval = defaultLeaseCheckpointInterval
+		checkpointInterval = DefaultLeaseCheckpointInterval
 	}
 	if expiredLeaseRetryInterval == 0 {
 		expiredLeaseRetryInterval = defaultExpiredleaseRetryInterval
 	}
+	revokeRate := cfg.ExpiredLeasesRevokeRate
+	if revokeRate <= 0 {
+		revokeRate = DefaultLeaseRevokeRate
+	}
 	l := &lessor{
 		leaseMap:                  make(map[LeaseID]*Lease),
 		itemMap:                   make(map[LeaseItem]LeaseID),
@@ -524,7 +648,10 @@ func newLessor(lg *zap.Logger, b backend.Backend, cluster cluster, cfg LessorCon
 		checkpointInterval:        checkpointInterval,        // 租约快照的默认时间间隔
 		expiredLeaseRetryInterval: expiredLeaseRetryInterval, // 检查过期租约是否被撤销的默认时间间隔
 		checkpointPersist:         cfg.CheckpointPersist,     //  lessor是否应始终保持剩余的TTL（在v3.6中始终启用）.
-		expiredC:                  make(chan []*Lease, 16),   // 避免不必要的阻塞
+		consolidatedInterval:      cfg.ConsolidatedCheckpointInterval,
+		revokeRate:                revokeRate,
+		restoreWorkers:            cfg.RestoreWorkers,
+		expiredC:                  make(chan []*Lease, 16), // 避免不必要的阻塞
 		stopC:                     make(chan struct{}),
 		doneC:                     make(chan struct{}),
 		lg:                        lg,
@@ -568,8 +695,10 @@ func (le *lessor) Renew(id LeaseID) (int64, error) {
 		le.mu.RUnlock()
 		return -1, ErrLeaseNotFound
 	}
+	// 续约父租约时同时续约所有子租约
+	tree := append([]*Lease{l}, le.unsafeDescendants(l)...)
 	// 清空剩余时间
-	clearRemainingTTL := le.cp != nil && l.remainingTTL > 0
+	clears := le.unsafeCheckpointClears(tree, nil)
 
 	le.mu.RUnlock()
 	if l.expired() { // 租约过期了
@@ -586,21 +715,95 @@ func (le *lessor) Renew(id LeaseID) (int64, error) {
 	// Clear remaining TTL when we renew if it is set
 	// By applying a RAFT entry only when the remainingTTL is already set, we limit the number
 	// of RAFT entries written per lease to a max of 2 per checkpoint interval.
-	if clearRemainingTTL {
+	if len(clears) > 0 {
 		// 定期批量地将 Lease 剩余的 TTL 基于 Raft Log 同步给 Follower 节点,Follower 节点收到 CheckPoint 请求后,
 		// 更新内存数据结构 LeaseMap 的剩余 TTL 信息.
-		le.cp(context.Background(), &pb.LeaseCheckpointRequest{Checkpoints: []*pb.LeaseCheckpoint{{ID: int64(l.ID), RemainingTtl: 0}}})
+		le.cp(context.Background(), &pb.LeaseCheckpointRequest{Checkpoints: clears})
 	}
 
 	le.mu.Lock()
-	l.refresh(0)
-	item := &LeaseWithTime{id: l.ID, time: l.expiry}
-	le.leaseExpiredNotifier.RegisterOrUpdate(item)
+	le.unsafeRefreshTree(tree)
 	le.mu.Unlock()
 
 	return l.ttl, nil
 }
 
+// RenewBatch 在一次操作中续约多个租约(及其子租约),只加一次锁、最多提交一次检查点清理;
+// 返回每个租约续约后的TTL,租约不存在或已过期时为0
+func (le *lessor) RenewBatch(ids []LeaseID) ([]int64, error) {
+	le.mu.RLock()
+	if !le.isPrimary() {
+		le.mu.RUnlock()
+		return nil, ErrNotPrimary
+	}
+
+	trees := make([][]*Lease, len(ids))
+	var clears []*pb.LeaseCheckpoint
+	cleared := make(map[LeaseID]struct{})
+	for i, id := range ids {
+		l := le.leaseMap[id]
+		if l == nil || l.expired() {
+			// 过期的租约等待撤销,不再续约
+			continue
+		}
+		trees[i] = append([]*Lease{l}, le.unsafeDescendants(l)...)
+		clears = append(clears, le.unsafeCheckpointClears(trees[i], cleared)...)
+	}
+	le.mu.RUnlock()
+
+	if len(clears) > 0 {
+		le.cp(context.Background(), &pb.LeaseCheckpointRequest{Checkpoints: clears})
+	}
+
+	ttls := make([]int64, len(ids))
+	le.mu.Lock()
+	defer le.mu.Unlock()
+	for i, tree := range trees {
+		if tree == nil || le.leaseMap[tree[0].ID] == nil {
+			continue
+		}
+		le.unsafeRefreshTree(tree)
+		ttls[i] = tree[0].ttl
+	}
+	return ttls, nil
+}
+
+// unsafeCheckpointClears 返回清空租约树中已设置的剩余时间的检查点,cleared不为nil时跳过已经清理过的租约;
+// 需要持有lessor.mu
+func (le *lessor) unsafeCheckpointClears(tree []*Lease, cleared map[LeaseID]struct{}) []*pb.LeaseCheckpoint {
+	if le.cp == nil {
+		return nil
+	}
+	var clears []*pb.LeaseCheckpoint
+	for _, t := range tree {
+		if t.remainingTTL <= 0 {
+			continue
+		}
+		if cleared != nil {
+			if _, ok := cleared[t.ID]; ok {
+				continue
+			}
+			cleared[t.ID] = struct{}{}
+		}
+		clears = append(clears, &pb.LeaseCheckpoint{ID: int64(t.ID), RemainingTtl: 0})
+	}
+	return clears
+}
+
+// unsafeRefreshTree 刷新租约树的过期时间,tree[0]为续约的租约; 需要持有lessor.mu
+func (le *lessor) unsafeRefreshTree(tree []*Lease) {
+	for i, t := range tree {
+		if i > 0 && t.expired() {
+			// 已经过期的子租约等待撤销,不再续约
+			continue
+		}
+		t.refresh(0)
+		item := &LeaseWithTime{id: t.ID, time: t.expiry}
+		le.leaseExpiredNotifier.RegisterOrUpdate(item)
+		le.unsafeNotify(pb.LeaseEvent_RENEWED, t, t.ttl)
+	}
+}
+
 // Lookup 查找租约
 func (le *lessor) Lookup(id LeaseID) *Lease {
 	le.mu.RLock()
@@ -657,7 +860,8 @@ func (le *lessor) Detach(id LeaseID, items []LeaseItem) error {
 
 // refresh 刷新租约的过期时间
 func (l *Lease) refresh(extend time.Duration) {
-	newExpiry := time.Now().Add(extend + time.Duration(l.getRemainingTTL())*time.Second)
+	now := time.Now()
+	newExpiry := now.Add(extend + l.remainingAt(now))
 	l.expiryMu.Lock()
 	defer l.expiryMu.Unlock()
 	l.expiry = newExpiry
@@ -716,13 +920,13 @@ func (le *lessor) initAndRecover() {
 
 	tx.UnsafeCreateBucket(buckets.Lease)
 	_, vs := tx.UnsafeRange(buckets.Lease, int64ToBytes(0), int64ToBytes(math.MaxInt64), 0)
-	for i := range vs {
-		var lpb leasepb.Lease
-		err := lpb.Unmarshal(vs[i])
-		if err != nil {
-			tx.Unlock()
-			panic("反序列化lease 消息失败")
-		}
+	lpbs, err := unmarshalLeases(vs, le.restoreWorkers)
+	if err != nil {
+		tx.Unlock()
+		panic("反序列化lease 消息失败")
+	}
+	for i := range lpbs {
+		lpb := &lpbs[i]
 		ID := LeaseID(lpb.ID)
 		if lpb.TTL < le.minLeaseTTL {
 			lpb.TTL = le.minLeaseTTL
@@ -735,6 +939,16 @@ func (le *lessor) initAndRecover() {
 			expiry:       forever,
 			revokec:      make(chan struct{}),
 			remainingTTL: lpb.RemainingTTL,
+			checkpointAt: lpb.CheckpointTime,
+			parent:       LeaseID(lpb.Parent),
+			metadata:     lpb.Metadata,
+		}
+	}
+	for _, l := range le.leaseMap {
+		if p := le.leaseMap[l.parent]; p != nil {
+			p.addChild(l.ID)
+		} else {
+			l.parent = NoLease
 		}
 	}
 	le.leaseExpiredNotifier.Init() // 填充mq.m
@@ -744,12 +958,66 @@ func (le *lessor) initAndRecover() {
 	le.b.ForceCommit()
 }
 
+// unmarshalLeases 把租约分成若干段并发解码,返回结果与vs一一对应
+func unmarshalLeases(vs [][]byte, workers int) ([]leasepb.Lease, error) {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	lpbs := make([]leasepb.Lease, len(vs))
+	if len(vs) == 0 {
+		return lpbs, nil
+	}
+	per := (len(vs) + workers - 1) / workers
+	errc := make(chan error, workers)
+	var wg sync.WaitGroup
+	for lo := 0; lo < len(vs); lo += per {
+		hi := lo + per
+		if hi > len(vs) {
+			hi = len(vs)
+		}
+		wg.Add(1)
+		go func(lo, hi int) {
+			defer wg.Done()
+			for i := lo; i < hi; i++ {
+				if err := lpbs[i].Unmarshal(vs[i]); err != nil {
+					errc <- err
+					return
+				}
+			}
+		}(lo, hi)
+	}
+	wg.Wait()
+	close(errc)
+	return lpbs, <-errc
+}
+
 func (le *lessor) SetCheckpointer(cp Checkpointer) {
 	le.mu.Lock()
 	defer le.mu.Unlock()
 	le.cp = cp
 }
 
+func (le *lessor) SetEventNotifier(en EventNotifier) {
+	le.mu.Lock()
+	defer le.mu.Unlock()
+	le.en = en
+}
+
+// unsafeNotify 通知租约事件,需要持有lessor.mu
+func (le *lessor) unsafeNotify(typ pb.LeaseEvent_EventType, l *Lease, ttl int64) {
+	if le.en == nil {
+		return
+	}
+	le.en(&pb.LeaseEvent{
+		Type:       typ,
+		ID:         int64(l.ID),
+		TTL:        ttl,
+		GrantedTTL: l.ttl,
+		Metadata:   l.metadata,
+		Parent:     int64(l.parent),
+	})
+}
+
 // OK
 func (le *lessor) runLoop() {
 	defer close(le.doneC)
@@ -758,9 +1026,10 @@ func (le *lessor) runLoop() {
 		le.revokeExpiredLeases()
 		// 查找所有到期的预定租约检查点将它们提交给检查点以将它们持久化到共识日志中.
 		le.checkpointScheduledLeases() // 定时触发更新 Lease 的剩余到期时间的操作.
+		le.checkpointConsolidated()
 
 		select {
-		case <-time.After(500 * time.Millisecond):
+		case <-time.After(expiredLeaseRevokeInterval):
 		case <-le.stopC:
 			return
 		}
@@ -798,8 +1067,7 @@ func (le *lessor) scheduleCheckpointIfNeeded(lease *Lease) {
 	if le.cp == nil {
 		return
 	}
-	// 剩余存活时间,大于 checkpointInterval
-	le.checkpointInterval = time.Second * 20
+	// 剩余存活时间,大于 checkpointInterval; 更短的租约由汇总检查点覆盖
 	if lease.getRemainingTTL() > int64(le.checkpointInterval.Seconds()) {
 		if le.lg != nil {
 			le.lg.Info("开始调度 租约 检查", zap.Int64("leaseID", int64(lease.ID)), zap.Duration("intervalSeconds", le.checkpointInterval))
@@ -808,7 +1076,6 @@ func (le *lessor) scheduleCheckpointIfNeeded(lease *Lease) {
 			id:   lease.ID,
 			time: time.Now().Add(le.checkpointInterval), // 300 秒后租约到期, 检查这个租约
 		})
-		le.lg.Info("租约", zap.Int("checkpoint", len(le.leaseCheckpointHeap)), zap.Int("lease", len(le.leaseMap)))
 	}
 }
 
@@ -841,19 +1108,69 @@ func (le *lessor) findDueScheduledCheckpoints(checkpointLimit int) []*pb.LeaseCh
 		if le.lg != nil {
 			le.lg.Debug("检查租约ing", zap.Int64("leaseID", int64(lt.id)), zap.Int64("remainingTTL", remainingTTL))
 		}
-		cps = append(cps, &pb.LeaseCheckpoint{ID: int64(lt.id), RemainingTtl: remainingTTL})
+		cps = append(cps, &pb.LeaseCheckpoint{ID: int64(lt.id), RemainingTtl: remainingTTL, CheckpointTime: le.checkpointTime(now)})
 	}
 	return cps
 }
 
+// checkpointTime 检查点中携带的生成时间;集群中可能有不认识该字段的旧版本成员时不携带,
+// 以免升级过程中各成员对同一租约的剩余时间计算不一致
+func (le *lessor) checkpointTime(now time.Time) int64 {
+	if !le.shouldPersistCheckpoints() {
+		return 0
+	}
+	return now.UnixNano()
+}
+
+// checkpointConsolidated 每隔consolidatedInterval把所有未续约租约的剩余时间汇总成检查点,
+// 这样ttl较短、不会被单独调度检查点的租约在leader变更后也不会被重置为完整的ttl
+func (le *lessor) checkpointConsolidated() {
+	le.mu.Lock()
+	if !le.isPrimary() || le.cp == nil || le.consolidatedInterval <= 0 || time.Since(le.lastConsolidated) < le.consolidatedInterval {
+		le.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	le.lastConsolidated = now
+	var cps []*pb.LeaseCheckpoint
+	for _, l := range le.leaseMap {
+		l.expiryMu.RLock()
+		expiry := l.expiry
+		l.expiryMu.RUnlock()
+		if expiry.IsZero() || !now.Before(expiry) {
+			continue
+		}
+		remainingTTL := int64(math.Ceil(expiry.Sub(now).Seconds()))
+		if remainingTTL >= l.ttl {
+			// 刚续约过,不需要检查点
+			continue
+		}
+		cps = append(cps, &pb.LeaseCheckpoint{ID: int64(l.ID), RemainingTtl: remainingTTL, CheckpointTime: le.checkpointTime(now)})
+	}
+	le.mu.Unlock()
+
+	for len(cps) > 0 {
+		n := len(cps)
+		if n > maxLeaseCheckpointBatchSize {
+			n = maxLeaseCheckpointBatchSize
+		}
+		le.cp(context.Background(), &pb.LeaseCheckpointRequest{Checkpoints: cps[:n]})
+		cps = cps[n:]
+	}
+}
+
 // Checkpoint 更新租约的剩余时间
-func (le *lessor) Checkpoint(id LeaseID, remainingTTL int64) error {
+func (le *lessor) Checkpoint(id LeaseID, remainingTTL, checkpointTime int64) error {
 	le.mu.Lock()
 	defer le.mu.Unlock()
 
 	if l, ok := le.leaseMap[id]; ok {
 		// 当检查点时,我们只更新剩余的TTL,Promote 负责将其应用于租赁到期.
 		l.remainingTTL = remainingTTL
+		l.checkpointAt = checkpointTime
+		if remainingTTL == 0 {
+			l.checkpointAt = 0
+		}
 		if le.shouldPersistCheckpoints() { // true
 			l.persistTo(le.b)
 		}
@@ -861,6 +1178,9 @@ func (le *lessor) Checkpoint(id LeaseID, remainingTTL int64) error {
 			// 根据需要,安排下一个检查点
 			le.scheduleCheckpointIfNeeded(l)
 		}
+		if remainingTTL > 0 {
+			le.unsafeNotify(pb.LeaseEvent_CHECKPOINTED, l, remainingTTL)
+		}
 	}
 	return nil
 }
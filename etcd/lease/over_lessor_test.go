@@ -0,0 +1,289 @@
+// Copyright 2015 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lease
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/ls-2018/etcd_cn/etcd/lease/leasepb"
+	betesting "github.com/ls-2018/etcd_cn/etcd/mvcc/backend/testing"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+	"go.uber.org/zap"
+)
+
+type fakeCluster struct{}
+
+func (fakeCluster) Version() *semver.Version { return nil }
+
+// newTestLessor 创建基于临时后端的主lessor,测试结束时关闭
+func newTestLessor(t *testing.T, cfg LessorConfig) *lessor {
+	be, _ := betesting.NewDefaultTmpBackend(t)
+	le := newLessor(zap.NewNop(), be, fakeCluster{}, cfg)
+	t.Cleanup(func() {
+		le.Stop()
+		betesting.Close(t, be)
+	})
+	le.Promote(0)
+	return le
+}
+
+// expireAt 把租约的到期时间改成t,并同步到过期堆
+func (le *lessor) expireAt(id LeaseID, t time.Time) {
+	l := le.leaseMap[id]
+	l.expiryMu.Lock()
+	l.expiry = t
+	l.expiryMu.Unlock()
+	le.leaseExpiredNotifier.RegisterOrUpdate(&LeaseWithTime{id: id, time: t})
+}
+
+// TestLessorExpiredLeasesOrder 过期租约按最早过期的顺序发送,过期时间相同时按ID
+func TestLessorExpiredLeasesOrder(t *testing.T) {
+	le := newTestLessor(t, LessorConfig{MinLeaseTTL: 1})
+	for _, id := range []LeaseID{5, 3, 9, 1} {
+		if _, err := le.Grant(id, 100, NoLease, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 一次改完所有到期时间,runLoop 看到的是同一批
+	now := time.Now()
+	le.mu.Lock()
+	le.expireAt(9, now.Add(-3*time.Second))
+	le.expireAt(3, now.Add(-time.Second))
+	le.expireAt(5, now.Add(-3*time.Second))
+	le.expireAt(1, now.Add(-2*time.Second))
+	le.mu.Unlock()
+
+	select {
+	case ls := <-le.ExpiredLeasesC():
+		var got []LeaseID
+		for _, l := range ls {
+			got = append(got, l.ID)
+		}
+		want := []LeaseID{5, 9, 1, 3}
+		if len(got) != len(want) {
+			t.Fatalf("expired leases = %v, want %v", got, want)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("expired leases = %v, want %v", got, want)
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for expired leases")
+	}
+}
+
+// TestLessorExpiredLeasesRevokeRate 每批最多发送 revokeRate*expiredLeaseRevokeInterval 个租约,剩下的留到下一批
+func TestLessorExpiredLeasesRevokeRate(t *testing.T) {
+	le := newTestLessor(t, LessorConfig{MinLeaseTTL: 1, ExpiredLeasesRevokeRate: 4})
+	for id := LeaseID(1); id <= 5; id++ {
+		if _, err := le.Grant(id, 100, NoLease, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now()
+	le.mu.Lock()
+	for id := LeaseID(1); id <= 5; id++ {
+		le.expireAt(id, now.Add(-time.Duration(10-id)*time.Second))
+	}
+	le.mu.Unlock()
+
+	var got []LeaseID
+	for len(got) < 5 {
+		select {
+		case ls := <-le.ExpiredLeasesC():
+			if len(ls) > 2 {
+				t.Fatalf("batch of %d leases, want at most 2", len(ls))
+			}
+			for _, l := range ls {
+				got = append(got, l.ID)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for expired leases, got %v", got)
+		}
+	}
+	for i, id := range got {
+		if id != LeaseID(i+1) {
+			t.Fatalf("expired leases = %v, want 1..5 in order", got)
+		}
+	}
+}
+
+// TestLeaseRemainingAtCheckpointTime 检查点带有生成时间时,扣除从检查点到现在经过的时间
+func TestLeaseRemainingAtCheckpointTime(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		checkpointAt int64
+		want         time.Duration
+	}{
+		{0, 50 * time.Second},
+		{now.Add(-10 * time.Second).UnixNano(), 40 * time.Second},
+		{now.Add(-time.Minute).UnixNano(), 0},
+		// 检查点时间在未来时不加时间
+		{now.Add(time.Second).UnixNano(), 50 * time.Second},
+	}
+	for i, tt := range tests {
+		l := &Lease{ttl: 100, remainingTTL: 50, checkpointAt: tt.checkpointAt}
+		if got := l.remainingAt(now); got != tt.want {
+			t.Errorf("#%d: remaining = %v, want %v", i, got, tt.want)
+		}
+	}
+}
+
+// TestLessorCheckpointTimeRecovered 检查点的生成时间随租约持久化,新的主lessor按它计算剩余时间
+func TestLessorCheckpointTimeRecovered(t *testing.T) {
+	be, _ := betesting.NewDefaultTmpBackend(t)
+	defer betesting.Close(t, be)
+	cfg := LessorConfig{MinLeaseTTL: 1, CheckpointPersist: true}
+
+	le := newLessor(zap.NewNop(), be, fakeCluster{}, cfg)
+	if _, err := le.Grant(1, 100, NoLease, ""); err != nil {
+		t.Fatal(err)
+	}
+	at := time.Now().Add(-10 * time.Second).UnixNano()
+	if err := le.Checkpoint(1, 50, at); err != nil {
+		t.Fatal(err)
+	}
+	le.Stop()
+
+	le = newLessor(zap.NewNop(), be, fakeCluster{}, cfg)
+	defer le.Stop()
+	l := le.Lookup(1)
+	if l == nil || l.remainingTTL != 50 || l.checkpointAt != at {
+		t.Fatalf("recovered lease = %+v, want remainingTTL 50 and checkpoint time %d", l, at)
+	}
+	le.Promote(0)
+	if r := le.Lookup(1).Remaining(); r > 40*time.Second || r < 39*time.Second {
+		t.Fatalf("remaining after promote = %v, want about 40s", r)
+	}
+}
+
+type fakeDeleter struct{}
+
+func (fakeDeleter) DeleteRange(key, end []byte) (n, rev int64) { return 0, 0 }
+func (fakeDeleter) End()                                       {}
+
+// TestLessorRevokeParent 撤销父租约时先撤销所有子孙租约
+func TestLessorRevokeParent(t *testing.T) {
+	le := newTestLessor(t, LessorConfig{MinLeaseTTL: 1})
+	le.SetRangeDeleter(func() TxnDelete { return fakeDeleter{} })
+	var revoked []LeaseID
+	le.SetEventNotifier(func(ev *pb.LeaseEvent) {
+		if ev.Type == pb.LeaseEvent_REVOKED || ev.Type == pb.LeaseEvent_EXPIRED {
+			revoked = append(revoked, LeaseID(ev.ID))
+		}
+	})
+	for _, g := range []struct{ id, parent LeaseID }{{1, NoLease}, {2, 1}, {3, 2}, {4, NoLease}} {
+		if _, err := le.Grant(g.id, 100, g.parent, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := le.Grant(5, 100, 9, ""); err != ErrParentLeaseNotFound {
+		t.Fatalf("grant with missing parent err = %v, want %v", err, ErrParentLeaseNotFound)
+	}
+
+	if err := le.Revoke(1); err != nil {
+		t.Fatal(err)
+	}
+	if len(revoked) != 3 || revoked[2] != 1 {
+		t.Fatalf("revoked = %v, want descendants of 1 before 1", revoked)
+	}
+	for _, id := range []LeaseID{1, 2, 3} {
+		if le.Lookup(id) != nil {
+			t.Fatalf("lease %d still exists", id)
+		}
+	}
+	if le.Lookup(4) == nil {
+		t.Fatal("unrelated lease 4 revoked")
+	}
+}
+
+// TestLessorRenewParent 续约父租约时子租约一起续约
+func TestLessorRenewParent(t *testing.T) {
+	le := newTestLessor(t, LessorConfig{MinLeaseTTL: 1})
+	if _, err := le.Grant(1, 100, NoLease, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := le.Grant(2, 100, 1, ""); err != nil {
+		t.Fatal(err)
+	}
+	le.mu.Lock()
+	le.expireAt(2, time.Now().Add(10*time.Second))
+	le.mu.Unlock()
+
+	if _, err := le.Renew(1); err != nil {
+		t.Fatal(err)
+	}
+	if r := le.Lookup(2).Remaining(); r < 99*time.Second {
+		t.Fatalf("child remaining after renewing parent = %v, want about 100s", r)
+	}
+}
+
+// TestLessorParentRecovered 父子关系随租约持久化,父租约不存在时恢复为没有父租约
+func TestLessorParentRecovered(t *testing.T) {
+	be, _ := betesting.NewDefaultTmpBackend(t)
+	defer betesting.Close(t, be)
+	le := newLessor(zap.NewNop(), be, fakeCluster{}, LessorConfig{MinLeaseTTL: 1})
+	for _, g := range []struct{ id, parent LeaseID }{{1, NoLease}, {2, 1}} {
+		if _, err := le.Grant(g.id, 100, g.parent, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	le.Stop()
+
+	le = newLessor(zap.NewNop(), be, fakeCluster{}, LessorConfig{MinLeaseTTL: 1})
+	defer le.Stop()
+	if l := le.Lookup(2); l == nil || l.parent != 1 {
+		t.Fatalf("recovered lease 2 = %+v, want parent 1", l)
+	}
+	if _, ok := le.Lookup(1).children[2]; !ok {
+		t.Fatal("recovered lease 1 has no child 2")
+	}
+}
+
+// TestUnmarshalLeases 并发解码的结果与输入顺序一致,任一租约解码失败时返回错误
+func TestUnmarshalLeases(t *testing.T) {
+	vs := make([][]byte, 10)
+	for i := range vs {
+		lpb := leasepb.Lease{ID: int64(i + 1), TTL: int64(10 * (i + 1))}
+		v, err := lpb.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		vs[i] = v
+	}
+	for _, workers := range []int{0, 1, 3, 20} {
+		lpbs, err := unmarshalLeases(vs, workers)
+		if err != nil {
+			t.Fatalf("workers %d: %v", workers, err)
+		}
+		if len(lpbs) != len(vs) {
+			t.Fatalf("workers %d: got %d leases, want %d", workers, len(lpbs), len(vs))
+		}
+		for i := range lpbs {
+			if lpbs[i].ID != int64(i+1) || lpbs[i].TTL != int64(10*(i+1)) {
+				t.Fatalf("workers %d: lease %d = %+v, want ID %d", workers, i, lpbs[i], i+1)
+			}
+		}
+	}
+
+	vs[7] = []byte{0xff}
+	if _, err := unmarshalLeases(vs, 3); err == nil {
+		t.Fatal("err = nil for a corrupted lease, want error")
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"math"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	bolt "go.etcd.io/bbolt"
 	"go.uber.org/zap"
@@ -42,6 +43,8 @@ type BatchTx interface {
 	UnsafePut(bucket Bucket, key []byte, value []byte)
 	UnsafeSeqPut(bucket Bucket, key []byte, value []byte)
 	UnsafeDelete(bucket Bucket, key []byte)
+	// UnsafeModified 返回当前还没有提交的事务是否修改过bucket
+	UnsafeModified(bucket Bucket) bool
 	Commit()        // Commit commits a previous tx and begins a new writable one.
 	CommitAndStop() // CommitAndStop commits the previous tx and does not create a new one.
 }
@@ -51,6 +54,8 @@ type batchTx struct {
 	tx      *bolt.Tx
 	backend *backend
 	pending int // 当前事务中的写入次数
+	// modified 当前事务中修改过的桶,提交后清空
+	modified map[BucketID]struct{}
 }
 
 func (t *batchTx) Lock() {
@@ -77,7 +82,7 @@ func (t *batchTx) UnsafeCreateBucket(bucket Bucket) {
 	if err != nil && err != bolt.ErrBucketExists {
 		t.backend.lg.Fatal("创建bucket", zap.Stringer("bucket-name", bucket), zap.Error(err))
 	}
-	t.pending++
+	t.markModified(bucket)
 }
 
 func (t *batchTx) UnsafePut(bucket Bucket, key []byte, value []byte) {
@@ -106,7 +111,7 @@ func (t *batchTx) unsafePut(bucketType Bucket, key []byte, value []byte, seq boo
 			"桶写数据失败", zap.Stringer("bucket-name", bucketType), zap.Error(err),
 		)
 	}
-	t.pending++
+	t.markModified(bucketType)
 }
 
 // UnsafeRange 调用法必须持锁
@@ -160,7 +165,22 @@ func (t *batchTx) UnsafeDelete(bucketType Bucket, key []byte) {
 			zap.Error(err),
 		)
 	}
+	t.markModified(bucketType)
+}
+
+// markModified 记录一次对bucket的写入
+func (t *batchTx) markModified(bucket Bucket) {
 	t.pending++
+	if t.modified == nil {
+		t.modified = make(map[BucketID]struct{})
+	}
+	t.modified[bucket.ID()] = struct{}{}
+}
+
+// UnsafeModified 调用方必须持锁
+func (t *batchTx) UnsafeModified(bucket Bucket) bool {
+	_, ok := t.modified[bucket.ID()]
+	return ok
 }
 
 // Commit commits a previous tx and begins a new writable one.
@@ -189,10 +209,21 @@ func (t *batchTx) commit(stop bool) {
 		if t.pending == 0 && !stop {
 			return
 		}
-		err := t.tx.Commit() // bolt.Commit
+		start := time.Now()
+		var err error
+		if ci, ok := t.backend.hooks.(CommitInterceptor); ok {
+			err = ci.BeforeCommit()
+		}
+		if err == nil {
+			err = t.tx.Commit() // bolt.Commit
+		}
 		atomic.AddInt64(&t.backend.commits, 1)
+		if o, ok := t.backend.hooks.(CommitObserver); ok {
+			o.OnCommit(time.Since(start))
+		}
 
 		t.pending = 0
+		t.modified = nil
 		if err != nil {
 			t.backend.lg.Fatal("提交事务失败", zap.Error(err))
 		}
@@ -222,5 +253,5 @@ func (t *batchTx) UnsafeDeleteBucket(bucket Bucket) {
 	if err != nil && err != bolt.ErrBucketNotFound {
 		t.backend.lg.Fatal("删除桶失败", zap.Stringer("bucket-name", bucket), zap.Error(err))
 	}
-	t.pending++
+	t.markModified(bucket)
 }
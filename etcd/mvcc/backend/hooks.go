@@ -14,6 +14,8 @@
 
 package backend
 
+import "time"
+
 type HookFunc func(tx BatchTx)
 
 // Hooks 允许事务有效期内执行的额外逻辑.
@@ -21,6 +23,16 @@ type Hooks interface {
 	OnPreCommitUnsafe(tx BatchTx) // 事务提交前执行的钩子
 }
 
+// CommitObserver 可选接口,Hooks 实现它时在每次事务提交后收到提交耗时
+type CommitObserver interface {
+	OnCommit(took time.Duration)
+}
+
+// CommitInterceptor 可选接口,Hooks 实现它时在每次事务提交前调用,返回的错误按提交失败处理
+type CommitInterceptor interface {
+	BeforeCommit() error
+}
+
 type hooks struct {
 	onPreCommitUnsafe HookFunc
 }
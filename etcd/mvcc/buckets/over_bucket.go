@@ -26,6 +26,18 @@ var (
 	Lease   = backend.Bucket(bucket{id: 3, name: []byte("lease"), safeRangeBucket: false})
 	Alarm   = backend.Bucket(bucket{id: 4, name: []byte("alarm"), safeRangeBucket: false})
 	Cluster = backend.Bucket(bucket{id: 5, name: []byte("cluster"), safeRangeBucket: false})
+	// Idempotency 带幂等token的写请求的响应
+	Idempotency = backend.Bucket(bucket{id: 6, name: []byte("idempotency"), safeRangeBucket: false})
+	// Notify 通知sink已投递到的修订版本
+	Notify = backend.Bucket(bucket{id: 7, name: []byte("notify"), safeRangeBucket: false})
+	// CompactionHold 压缩保留
+	CompactionHold = backend.Bucket(bucket{id: 8, name: []byte("compaction_hold"), safeRangeBucket: false})
+	// StagedTxn 暂存事务
+	StagedTxn = backend.Bucket(bucket{id: 9, name: []byte("staged_txn"), safeRangeBucket: false})
+	// UserUsage 每个用户写入的字节数
+	UserUsage = backend.Bucket(bucket{id: 12, name: []byte("user_usage"), safeRangeBucket: false})
+	// V2Store etcdutl migrate-v2 从v2store迁移过来的用户数据
+	V2Store = backend.Bucket(bucket{id: 13, name: []byte("v2store"), safeRangeBucket: false})
 
 	Members        = backend.Bucket(bucket{id: 10, name: []byte("members"), safeRangeBucket: false})
 	MembersRemoved = backend.Bucket(bucket{id: 11, name: []byte("members_removed"), safeRangeBucket: false})
@@ -33,6 +45,7 @@ var (
 	Auth      = backend.Bucket(bucket{id: 20, name: []byte("auth"), safeRangeBucket: false})
 	AuthUsers = backend.Bucket(bucket{id: 21, name: []byte("authUsers"), safeRangeBucket: false})
 	AuthRoles = backend.Bucket(bucket{id: 22, name: []byte("authRoles"), safeRangeBucket: false})
+	AuthAudit = backend.Bucket(bucket{id: 23, name: []byte("authAudit"), safeRangeBucket: false})
 
 	Test = backend.Bucket(bucket{id: 100, name: []byte("test"), safeRangeBucket: false})
 )
@@ -51,12 +64,41 @@ func (b bucket) IsSafeRangeBucket() bool { return b.safeRangeBucket }
 var (
 	MetaConsistentIndexKeyName = []byte("consistent_index")
 	MetaTermKeyName            = []byte("term")
+	// MetaScheduledCompactKeyName 已计划的压缩版本; MetaFinishedCompactKeyName 已完成的压缩版本
+	MetaScheduledCompactKeyName = []byte("scheduledCompactRev")
+	MetaFinishedCompactKeyName  = []byte("finishedCompactRev")
+	// MetaV2StoreMigratedKeyName v2store迁移到后端时对应的日志索引
+	MetaV2StoreMigratedKeyName = []byte("v2store_migrated")
+	// 租约、鉴权、报警各自最后一次apply对应的日志索引,用于校验部分apply
+	MetaLeaseConsistentIndexKeyName = []byte("lease_consistent_index")
+	MetaAuthConsistentIndexKeyName  = []byte("auth_consistent_index")
+	MetaAlarmConsistentIndexKeyName = []byte("alarm_consistent_index")
 )
 
 // DefaultIgnores 定义在哈希检查中要忽略的桶和键.
 func DefaultIgnores(bucket, key []byte) bool {
+	// 鉴权审计记录只保存在本节点,各节点之间不一致
+	if bytes.Compare(bucket, AuthAudit.Name()) == 0 {
+		return true
+	}
+	// 迁移v2store是每个成员各自离线完成的
+	if bytes.Compare(bucket, V2Store.Name()) == 0 ||
+		(bytes.Compare(bucket, Meta.Name()) == 0 && bytes.Compare(key, MetaV2StoreMigratedKeyName) == 0) {
+		return true
+	}
 	// consistent index & term might be changed due to v2 internal sync, which
 	// is not controllable by the user.
-	return bytes.Compare(bucket, Meta.Name()) == 0 &&
-		(bytes.Compare(key, MetaTermKeyName) == 0 || bytes.Compare(key, MetaConsistentIndexKeyName) == 0)
+	if bytes.Compare(bucket, Meta.Name()) != 0 {
+		return false
+	}
+	for _, k := range [][]byte{
+		MetaTermKeyName, MetaConsistentIndexKeyName,
+		// 旧版本成员不记录各桶的索引
+		MetaLeaseConsistentIndexKeyName, MetaAuthConsistentIndexKeyName, MetaAlarmConsistentIndexKeyName,
+	} {
+		if bytes.Compare(key, k) == 0 {
+			return true
+		}
+	}
+	return false
 }
@@ -19,8 +19,11 @@ import (
 	"errors"
 	"fmt"
 	"hash/crc32"
+	"hash/fnv"
 	"math"
+	"runtime"
 	"sync"
+	"time"
 
 	"github.com/ls-2018/etcd_cn/etcd/lease"
 	"github.com/ls-2018/etcd_cn/etcd/mvcc/backend"
@@ -33,8 +36,8 @@ import (
 )
 
 var (
-	scheduledCompactKeyName = []byte("scheduledCompactRev")
-	finishedCompactKeyName  = []byte("finishedCompactRev")
+	scheduledCompactKeyName = buckets.MetaScheduledCompactKeyName
+	finishedCompactKeyName  = buckets.MetaFinishedCompactKeyName
 
 	ErrCompacted = errors.New("mvcc: 指定的修订版本已被压缩")
 	ErrFutureRev = errors.New("mvcc: 指定的修订版本还没有")
@@ -52,10 +55,16 @@ const (
 var (
 	restoreChunkKeys         = 10000 // non-const for testing
 	defaultCompactBatchLimit = 1000
+	// restoreProgressInterval 恢复索引时打印进度日志的间隔
+	restoreProgressInterval = 10 * time.Second
 )
 
 type StoreConfig struct {
 	CompactionBatchLimit int
+	// ReadCacheBytes 缓存解码后的 KeyValue 的内存上限,0表示不缓存
+	ReadCacheBytes int64
+	// RestoreWorkers 恢复索引时解码键值对、构建索引的并发数,0表示使用 GOMAXPROCS
+	RestoreWorkers int
 }
 
 type store struct {
@@ -66,6 +75,7 @@ type store struct {
 	mu             sync.RWMutex
 	b              backend.Backend
 	kvindex        index
+	readCache      *readCache   // 按修订版本缓存的 KeyValue,可以为nil
 	le             lease.Lessor // 租约管理器
 	revMu          sync.RWMutex // 保护currentRev和compactMainRev
 	currentRev     int64        // 是最后一个已完成事务的修订
@@ -89,6 +99,8 @@ func NewStore(lg *zap.Logger, b backend.Backend, le lease.Lessor, cfg StoreConfi
 		b:       b,
 		kvindex: newTreeIndex(lg),
 
+		readCache: newReadCache(cfg.ReadCacheBytes),
+
 		le: le,
 
 		currentRev:     1,
@@ -324,6 +336,7 @@ func (s *store) Restore(b backend.Backend) error {
 
 	s.b = b
 	s.kvindex = newTreeIndex(s.lg)
+	s.readCache.reset()
 
 	{
 		// During restore the metrics might report 'special' values
@@ -369,16 +382,27 @@ func (s *store) restore() error {
 		scheduledCompact = bytesToRev(scheduledCompactBytes[0]).Main
 	}
 
+	workers := s.cfg.RestoreWorkers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	start, lastLog, restored := time.Now(), time.Now(), 0
+
 	// index keys concurrently as they're loaded in from tx
-	rkvc, revc := restoreIntoIndex(s.lg, s.kvindex)
+	rkvcs, revc := restoreIntoIndex(s.lg, s.kvindex, workers)
 	for {
 		keys, vals := tx.UnsafeRange(buckets.Key, min, max, int64(restoreChunkKeys))
 		if len(keys) == 0 {
 			break
 		}
-		// rkvc blocks if the total pending keys exceeds the restore
+		// rkvcs blocks if the total pending keys exceeds the restore
 		// chunk size to keep keys from consuming too much memory.
-		restoreChunk(s.lg, rkvc, keys, vals, keyToLease)
+		restoreChunk(s.lg, rkvcs, keys, vals, keyToLease, workers)
+		restored += len(keys)
+		if time.Since(lastLog) >= restoreProgressInterval {
+			lastLog = time.Now()
+			s.lg.Info("正在恢复kvstore索引", zap.Int("restored-keys", restored), zap.Duration("took", time.Since(start)))
+		}
 		if len(keys) < restoreChunkKeys {
 			// partial set implies final set
 			break
@@ -388,7 +412,9 @@ func (s *store) restore() error {
 		newMin.Sub++
 		revToBytes(newMin, min)
 	}
-	close(rkvc)
+	for _, rkvc := range rkvcs {
+		close(rkvc)
+	}
 
 	{
 		s.revMu.Lock()
@@ -407,12 +433,17 @@ func (s *store) restore() error {
 		scheduledCompact = 0
 	}
 
+	if len(keyToLease) != 0 && s.le == nil {
+		tx.Unlock()
+		panic("no lessor to attach lease")
+	}
+	// 按租约合并后批量挂载,减少租约管理器加锁次数
+	leaseItems := make(map[lease.LeaseID][]lease.LeaseItem)
 	for key, lid := range keyToLease {
-		if s.le == nil {
-			tx.Unlock()
-			panic("no lessor to attach lease")
-		}
-		err := s.le.Attach(lid, []lease.LeaseItem{{Key: key}})
+		leaseItems[lid] = append(leaseItems[lid], lease.LeaseItem{Key: key})
+	}
+	for lid, items := range leaseItems {
+		err := s.le.Attach(lid, items)
 		if err != nil {
 			s.lg.Error(
 				"failed to attach a lease",
@@ -424,7 +455,13 @@ func (s *store) restore() error {
 
 	tx.Unlock()
 
-	s.lg.Info("kvstore restored", zap.Int64("current-rev", s.currentRev))
+	s.lg.Info(
+		"kvstore restored",
+		zap.Int64("current-rev", s.currentRev),
+		zap.Int("restored-keys", restored),
+		zap.Int("workers", workers),
+		zap.Duration("took", time.Since(start)),
+	)
 
 	if scheduledCompact != 0 {
 		if _, err := s.compactLockfree(scheduledCompact); err != nil {
@@ -448,69 +485,116 @@ type revKeyValue struct {
 	kstr string
 }
 
-func restoreIntoIndex(lg *zap.Logger, idx index) (chan<- revKeyValue, <-chan int64) {
-	rkvc, revc := make(chan revKeyValue, restoreChunkKeys), make(chan int64, 1)
+// restoreIntoIndex 按key的哈希把索引构建分到多个goroutine上,同一个key总是落在同一个分片,
+// 因此每个分片内修订版本仍然有序.返回的修订版本是所有分片中最大的.
+func restoreIntoIndex(lg *zap.Logger, idx index, shards int) ([]chan<- revKeyValue, <-chan int64) {
+	rkvcs, revc := make([]chan<- revKeyValue, shards), make(chan int64, 1)
+	cacheSize := restoreChunkKeys/shards + 1
+	shardRevc := make(chan int64, shards)
+	for i := range rkvcs {
+		rkvc := make(chan revKeyValue, cacheSize)
+		rkvcs[i] = rkvc
+		go restoreShardIntoIndex(lg, idx, rkvc, cacheSize, shardRevc)
+	}
 	go func() {
 		currentRev := int64(1)
-		defer func() { revc <- currentRev }()
-		// restore the tree index from streaming the unordered index.
-		kiCache := make(map[string]*keyIndex, restoreChunkKeys)
-		for rkv := range rkvc {
-			ki, ok := kiCache[rkv.kstr]
-			// purge kiCache if many keys but still missing in the cache
-			if !ok && len(kiCache) >= restoreChunkKeys {
-				i := 10
-				for k := range kiCache {
-					delete(kiCache, k)
-					if i--; i == 0 {
-						break
-					}
-				}
+		for i := 0; i < shards; i++ {
+			if rev := <-shardRevc; rev > currentRev {
+				currentRev = rev
 			}
-			// cache miss, fetch from tree index if there
-			if !ok {
-				ki = &keyIndex{Key: rkv.kv.Key}
-				if idxKey := idx.KeyIndex(ki); idxKey != nil {
-					kiCache[rkv.kstr], ki = idxKey, idxKey
-					ok = true
+		}
+		revc <- currentRev
+	}()
+	return rkvcs, revc
+}
+
+func restoreShardIntoIndex(lg *zap.Logger, idx index, rkvc <-chan revKeyValue, cacheSize int, revc chan<- int64) {
+	currentRev := int64(1)
+	defer func() { revc <- currentRev }()
+	// restore the tree index from streaming the unordered index.
+	kiCache := make(map[string]*keyIndex, cacheSize)
+	for rkv := range rkvc {
+		ki, ok := kiCache[rkv.kstr]
+		// purge kiCache if many keys but still missing in the cache
+		if !ok && len(kiCache) >= cacheSize {
+			i := 10
+			for k := range kiCache {
+				delete(kiCache, k)
+				if i--; i == 0 {
+					break
 				}
 			}
-			rev := bytesToRev(rkv.key)
-			currentRev = rev.Main
-			if ok {
-				if isTombstone(rkv.key) {
-					if err := ki.tombstone(lg, rev.Main, rev.Sub); err != nil {
-						lg.Warn("tombstone encountered error", zap.Error(err))
-					}
-					continue
+		}
+		// cache miss, fetch from tree index if there
+		if !ok {
+			ki = &keyIndex{Key: rkv.kv.Key}
+			if idxKey := idx.KeyIndex(ki); idxKey != nil {
+				kiCache[rkv.kstr], ki = idxKey, idxKey
+				ok = true
+			}
+		}
+		rev := bytesToRev(rkv.key)
+		currentRev = rev.Main
+		if ok {
+			if isTombstone(rkv.key) {
+				if err := ki.tombstone(lg, rev.Main, rev.Sub); err != nil {
+					lg.Warn("tombstone encountered error", zap.Error(err))
 				}
-				ki.put(lg, rev.Main, rev.Sub)
-			} else if !isTombstone(rkv.key) {
-				ki.restore(lg, revision{rkv.kv.CreateRevision, 0}, rev, rkv.kv.Version)
-				idx.Insert(ki)
-				kiCache[rkv.kstr] = ki
+				continue
 			}
+			ki.put(lg, rev.Main, rev.Sub)
+		} else if !isTombstone(rkv.key) {
+			ki.restore(lg, revision{rkv.kv.CreateRevision, 0}, rev, rkv.kv.Version)
+			idx.Insert(ki)
+			kiCache[rkv.kstr] = ki
 		}
-	}()
-	return rkvc, revc
+	}
 }
 
-func restoreChunk(lg *zap.Logger, kvc chan<- revKeyValue, keys, vals [][]byte, keyToLease map[string]lease.LeaseID) {
-	for i, key := range keys {
-		rkv := revKeyValue{key: key}
-		if err := rkv.kv.Unmarshal(vals[i]); err != nil {
-			lg.Fatal("failed to unmarshal mvccpb.KeyValue", zap.Error(err))
+// restoreChunk 并发解码一批键值对,再按修订版本顺序分发到各索引分片
+func restoreChunk(lg *zap.Logger, kvcs []chan<- revKeyValue, keys, vals [][]byte, keyToLease map[string]lease.LeaseID, workers int) {
+	rkvs := make([]revKeyValue, len(keys))
+	per := (len(keys) + workers - 1) / workers
+	var wg sync.WaitGroup
+	for lo := 0; lo < len(keys); lo += per {
+		hi := lo + per
+		if hi > len(keys) {
+			hi = len(keys)
 		}
-		rkv.kstr = string(rkv.kv.Key)
-		if isTombstone(key) {
+		wg.Add(1)
+		go func(lo, hi int) {
+			defer wg.Done()
+			for i := lo; i < hi; i++ {
+				rkvs[i].key = keys[i]
+				if err := rkvs[i].kv.Unmarshal(vals[i]); err != nil {
+					lg.Fatal("failed to unmarshal mvccpb.KeyValue", zap.Error(err))
+				}
+				rkvs[i].kstr = rkvs[i].kv.Key
+			}
+		}(lo, hi)
+	}
+	wg.Wait()
+
+	for i := range rkvs {
+		rkv := rkvs[i]
+		if isTombstone(rkv.key) {
 			delete(keyToLease, rkv.kstr)
 		} else if lid := lease.LeaseID(rkv.kv.Lease); lid != lease.NoLease {
 			keyToLease[rkv.kstr] = lid
 		} else {
 			delete(keyToLease, rkv.kstr)
 		}
-		kvc <- rkv
+		kvcs[restoreShard(rkv.kstr, len(kvcs))] <- rkv
+	}
+}
+
+func restoreShard(key string, shards int) int {
+	if shards == 1 {
+		return 0
 	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(shards))
 }
 
 func (s *store) Close() error {
@@ -0,0 +1,83 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mvcc
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/ls-2018/etcd_cn/etcd/lease"
+	betesting "github.com/ls-2018/etcd_cn/etcd/mvcc/backend/testing"
+	"go.uber.org/zap"
+)
+
+// fakeAttachLessor 记录每次Attach挂载的key
+type fakeAttachLessor struct {
+	lease.FakeLessor
+	attached map[lease.LeaseID][][]lease.LeaseItem
+}
+
+func (le *fakeAttachLessor) Attach(id lease.LeaseID, items []lease.LeaseItem) error {
+	le.attached[id] = append(le.attached[id], items)
+	return nil
+}
+
+// TestRestoreParallel 多个协程分片恢复的索引与单个协程恢复的一致,同一租约的key一次挂载
+func TestRestoreParallel(t *testing.T) {
+	defer func(n int) { restoreChunkKeys = n }(restoreChunkKeys)
+	restoreChunkKeys = 7
+
+	be, _ := betesting.NewDefaultTmpBackend(t)
+	defer betesting.Close(t, be)
+	s := NewStore(zap.NewNop(), be, &lease.FakeLessor{}, StoreConfig{})
+	for i := 0; i < 30; i++ {
+		s.Put([]byte(fmt.Sprintf("foo%d", i%11)), []byte(fmt.Sprintf("bar%d", i)), lease.LeaseID(i%11%3))
+		if i%7 == 6 {
+			s.DeleteRange([]byte(fmt.Sprintf("foo%d", i%5)), nil)
+		}
+	}
+	rev := s.Rev()
+	s.Close()
+
+	restore := func(workers int) (*store, *fakeAttachLessor) {
+		le := &fakeAttachLessor{attached: make(map[lease.LeaseID][][]lease.LeaseItem)}
+		s := NewStore(zap.NewNop(), be, le, StoreConfig{RestoreWorkers: workers})
+		t.Cleanup(func() { s.Close() })
+		return s, le
+	}
+	want, _ := restore(1)
+	got, le := restore(4)
+	if got.Rev() != rev || want.Rev() != rev {
+		t.Fatalf("rev = %d (1 worker %d), want %d", got.Rev(), want.Rev(), rev)
+	}
+	for r := int64(1); r <= rev; r++ {
+		wr, werr := want.Range(context.TODO(), []byte("foo"), []byte("fop"), RangeOptions{Rev: r})
+		gr, gerr := got.Range(context.TODO(), []byte("foo"), []byte("fop"), RangeOptions{Rev: r})
+		if werr != gerr || !reflect.DeepEqual(wr, gr) {
+			t.Fatalf("range at rev %d = %+v (%v), want %+v (%v)", r, gr, gerr, wr, werr)
+		}
+	}
+
+	for id, batches := range le.attached {
+		if len(batches) != 1 {
+			t.Fatalf("lease %d attached %d times, want 1", id, len(batches))
+		}
+	}
+	if len(le.attached) != 2 {
+		t.Fatalf("attached leases = %v, want 1 and 2", le.attached)
+	}
+}
@@ -26,6 +26,8 @@ type RangeOptions struct {
 	Limit int64 // 用户限制的数据量
 	Rev   int64 // 指定的修订版本
 	Count bool  // 是否统计修订版本数
+	// KeysOnly 不解码值,返回的 KeyValue 的 Value 为空,避免复制只读key时用不到的值
+	KeysOnly bool
 }
 
 // RangeResult 响应
@@ -30,11 +30,12 @@ func (tw *storeTxnWrite) deleteRange(key, end []byte) int64 {
 	if len(tw.changes) > 0 {
 		rrev++
 	}
-	keys, _ := tw.s.kvindex.Range(key, end, rrev)
+	keys, revs := tw.s.kvindex.Range(key, end, rrev)
 	if len(keys) == 0 {
 		return 0
 	}
-	for _, key := range keys {
+	for i, key := range keys {
+		tw.s.readCache.invalidate(revs[i])
 		tw.delete(key)
 	} // 4.20 号
 	return int64(len(keys))
@@ -2,6 +2,7 @@ package mvcc
 
 import (
 	"context"
+	"encoding/json"
 
 	"github.com/ls-2018/etcd_cn/etcd/mvcc/buckets"
 	"github.com/ls-2018/etcd_cn/offical/api/v3/mvccpb"
@@ -59,19 +60,51 @@ func (tr *storeTxnRead) rangeKeys(ctx context.Context, key, end []byte, curRev i
 			return nil, ctx.Err()
 		default:
 		}
+		if kv, ok := tr.s.readCache.get(revpair); ok {
+			if ro.KeysOnly {
+				kv.Value = ""
+			}
+			kvs[i] = kv
+			continue
+		}
 		revToBytes(revpair, revBytes)
 		// 根据修订版本获取数据
 		_, vs := tr.tx.UnsafeRange(buckets.Key, revBytes, nil, 0)
 		if len(vs) != 1 {
 			tr.s.lg.Fatal("Range找不到修订对", zap.Int64("revision-Main", revpair.Main), zap.Int64("revision-Sub", revpair.Sub))
 		}
-		if err := kvs[i].Unmarshal([]byte(vs[0])); err != nil {
+		if ro.KeysOnly {
+			if err := unmarshalKeyOnly(vs[0], &kvs[i]); err != nil {
+				tr.s.lg.Fatal("反序列失败 mvccpb.KeyValue", zap.Error(err))
+			}
+			continue
+		}
+		if err := kvs[i].Unmarshal(vs[0]); err != nil {
 			tr.s.lg.Fatal(
 				"反序列失败 mvccpb.KeyValue",
 				zap.Error(err),
 			)
 		}
+		tr.s.readCache.add(revpair, kvs[i])
 	}
 	tr.trace.Step("从bolt.db 中range Key")
 	return &RangeResult{KVs: kvs, Count: total, Rev: curRev}, nil
 }
+
+// keyValueMeta 与 mvccpb.KeyValue 的编码相同但没有值字段,解码时跳过值而不复制它
+type keyValueMeta struct {
+	Key            string `json:"key,omitempty"`
+	CreateRevision int64  `json:"create_revision,omitempty"`
+	ModRevision    int64  `json:"mod_revision,omitempty"`
+	Version        int64  `json:"version,omitempty"`
+	Lease          int64  `json:"lease,omitempty"`
+}
+
+func unmarshalKeyOnly(data []byte, kv *mvccpb.KeyValue) error {
+	var m keyValueMeta
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	*kv = mvccpb.KeyValue{Key: m.Key, CreateRevision: m.CreateRevision, ModRevision: m.ModRevision, Version: m.Version, Lease: m.Lease}
+	return nil
+}
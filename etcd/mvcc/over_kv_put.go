@@ -14,8 +14,9 @@ func (tw *storeTxnWrite) put(key, value []byte, leaseID lease.LeaseID) {
 	oldLease := lease.NoLease
 
 	// 如果该键之前存在,使用它之前创建的并获取它之前的leaseID
-	_, created, beforeVersion, err := tw.s.kvindex.Get(key, rev) // 0,0,nil  <= rev的最新修改
+	modified, created, beforeVersion, err := tw.s.kvindex.Get(key, rev) // 0,0,nil  <= rev的最新修改
 	if err == nil {
+		tw.s.readCache.invalidate(modified)
 		c = created.Main
 		oldLease = tw.s.le.GetLease(lease.LeaseItem{Key: string(key)})
 		tw.trace.Step("获取键先前的created_revision和leaseID")
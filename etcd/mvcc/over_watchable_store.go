@@ -38,7 +38,7 @@ var (
 )
 
 type watchable interface {
-	watch(key, end []byte, startRev int64, id WatchID, ch chan<- WatchResponse, fcs ...FilterFunc) (*watcher, cancelFunc)
+	watch(key, end []byte, startRev int64, id WatchID, ch chan<- WatchResponse, skipUnchanged bool, fcs ...FilterFunc) (*watcher, cancelFunc)
 	progress(w *watcher)
 	rev() int64
 }
@@ -81,6 +81,7 @@ func newWatchableStore(lg *zap.Logger, b backend.Backend, le lease.Lessor, cfg S
 			return s.Write(traceutil.TODO())
 		})
 	}
+	watchCollector.add(s)
 	s.wg.Add(2)
 	go s.syncWatchersLoop()
 	go s.syncVictimsLoop() // 用于循环清除watchableStore中的victims
@@ -88,6 +89,7 @@ func newWatchableStore(lg *zap.Logger, b backend.Backend, le lease.Lessor, cfg S
 }
 
 func (s *watchableStore) Close() error {
+	watchCollector.remove(s)
 	close(s.stopc)
 	s.wg.Wait()
 	return s.store.Close()
@@ -103,14 +105,15 @@ func (s *watchableStore) NewWatchStream() WatchStream {
 }
 
 // watcher 初始化
-func (s *watchableStore) watch(key, end []byte, startRev int64, id WatchID, ch chan<- WatchResponse, fcs ...FilterFunc) (*watcher, cancelFunc) {
+func (s *watchableStore) watch(key, end []byte, startRev int64, id WatchID, ch chan<- WatchResponse, skipUnchanged bool, fcs ...FilterFunc) (*watcher, cancelFunc) {
 	wa := &watcher{
-		key:         string(key),
-		end:         string(end),
-		minRev:      startRev,
-		id:          id,
-		ch:          ch, // 将变更事件塞进去,可能会与其他watcher 共享
-		filterFuncs: fcs,
+		key:           string(key),
+		end:           string(end),
+		minRev:        startRev,
+		id:            id,
+		ch:            ch, // 将变更事件塞进去,可能会与其他watcher 共享
+		filterFuncs:   fcs,
+		skipUnchanged: skipUnchanged,
 	}
 
 	s.mu.Lock()
@@ -332,10 +335,10 @@ func (s *watchableStore) syncWatchers() int {
 	tx.RLock()
 	revs, vs := tx.UnsafeRange(buckets.Key, minBytes, maxBytes, 0) // 对key Bucket进行范围查找
 	evs := kvsToEvents(s.store.lg, wg, revs, vs)                   // 负责将BoltDB中查询的键值对信息转换成相应的event实例
+	wb := newWatcherBatch(wg, evs, s.unchangedFunc(tx))
 	tx.RUnlock()
 
 	var victims watcherBatch
-	wb := newWatcherBatch(wg, evs)
 	for w := range wg.watchers { // 事件发送值每一个watcher对应的Channel中
 		w.minRev = curRev + 1
 
@@ -401,11 +404,12 @@ func kvsToEvents(lg *zap.Logger, wg *watcherGroup, revs, vals [][]byte) (evs []m
 }
 
 // notify 当前的修订版本,当前的变更事件   用于通知对应的watcher
-func (s *watchableStore) notify(rev int64, evs []mvccpb.Event) {
+// tx 是写事务持有的BatchTx,用于读取事件的上一个版本
+func (s *watchableStore) notify(rev int64, evs []mvccpb.Event, tx backend.ReadTx) {
 	var victim watcherBatch
 	// type watcherBatch map[*watcher]*eventBatch
 	// 找到所有的watch,synced使用了map和红黑树来快速找到监听的key
-	for watcher, eb := range newWatcherBatch(&s.synced, evs) {
+	for watcher, eb := range newWatcherBatch(&s.synced, evs, s.unchangedFunc(tx)) {
 		if eb.revs != 1 {
 			s.store.lg.Panic("在watch通知中出现多次修订", zap.Int("number-of-revisions", eb.revs))
 		}
@@ -467,6 +471,8 @@ type watcher struct {
 	id          WatchID              // watcher id
 	filterFuncs []FilterFunc         // 事件过滤
 	ch          chan<- WatchResponse // 将变更事件塞进去,可能会与其他watcher 共享
+	// 扇出之前丢弃value与上一个版本相同的put事件
+	skipUnchanged bool
 }
 
 // 向客户端发送事件
@@ -501,3 +507,28 @@ func (w *watcher) send(wr WatchResponse) bool {
 		return false
 	}
 }
+
+// unchangedFunc 返回判断put事件的value是否与上一个版本相同的函数;tx必须已经被调用者锁定
+func (s *watchableStore) unchangedFunc(tx backend.ReadTx) func(ev mvccpb.Event) bool {
+	return func(ev mvccpb.Event) bool {
+		if ev.Type != mvccpb.PUT || ev.Kv.Version <= 1 {
+			return false
+		}
+		rev, _, _, err := s.store.kvindex.Get([]byte(ev.Kv.Key), ev.Kv.ModRevision-1)
+		if err != nil {
+			// 上一个版本已经被压缩
+			return false
+		}
+		rb := newRevBytes()
+		revToBytes(rev, rb)
+		_, vs := tx.UnsafeRange(buckets.Key, rb, nil, 0)
+		if len(vs) != 1 {
+			return false
+		}
+		var kv mvccpb.KeyValue
+		if err := kv.Unmarshal(vs[0]); err != nil {
+			return false
+		}
+		return kv.Value == ev.Kv.Value
+	}
+}
@@ -41,6 +41,9 @@ type WatchStream interface {
 	// Watch 创建watch id 默认为0  , 范围监听   起始的修订版本   事件过滤
 	Watch(id WatchID, key, end []byte, startRev int64, fcs ...FilterFunc) (WatchID, error)
 
+	// WatchChanged 与Watch相同,但在扇出之前丢弃value与上一个版本相同的put事件
+	WatchChanged(id WatchID, key, end []byte, startRev int64, fcs ...FilterFunc) (WatchID, error)
+
 	Chan() <-chan WatchResponse // 所有watch的响应会会被塞入返回的channel
 
 	// RequestProgress requests the progress of the watcher with given ID. The response
@@ -93,6 +96,15 @@ type watchStream struct {
 
 // Watch 在当前stream创建watcher并返回 WatchID.
 func (ws *watchStream) Watch(id WatchID, key, end []byte, startRev int64, fcs ...FilterFunc) (WatchID, error) {
+	return ws.watch(id, key, end, startRev, false, fcs...)
+}
+
+// WatchChanged 在当前stream创建只接收value有变化的事件的watcher
+func (ws *watchStream) WatchChanged(id WatchID, key, end []byte, startRev int64, fcs ...FilterFunc) (WatchID, error) {
+	return ws.watch(id, key, end, startRev, true, fcs...)
+}
+
+func (ws *watchStream) watch(id WatchID, key, end []byte, startRev int64, skipUnchanged bool, fcs ...FilterFunc) (WatchID, error) {
 	// 防止键>按字典顺序结束的错误范围
 	// 监视请求'WithFromKey'有空字节范围结束
 	if len(end) != 0 && bytes.Compare(key, end) != -1 {
@@ -116,7 +128,7 @@ func (ws *watchStream) Watch(id WatchID, key, end []byte, startRev int64, fcs ..
 		return -1, ErrWatcherDuplicateID
 	}
 
-	w, c := ws.watchable.watch(key, end, startRev, id, ws.ch, fcs...)
+	w, c := ws.watchable.watch(key, end, startRev, id, ws.ch, skipUnchanged, fcs...)
 	ws.cancels[id] = c  // 回调函数用于删除watcher
 	ws.watchers[id] = w // 记录watcher事件及其Id
 	return id, nil
@@ -137,6 +149,7 @@ func (ws *watchStream) Cancel(id WatchID) error {
 		return ErrWatcherNotExist
 	}
 	cancel()
+	watchCancellations.WithLabelValues(watchCancelClient).Inc()
 
 	ws.mu.Lock()
 	// The watch isn't removed until cancel so that if Close() is called,
@@ -158,6 +171,7 @@ func (ws *watchStream) Close() {
 	for _, cancel := range ws.cancels {
 		cancel()
 	}
+	watchCancellations.WithLabelValues(watchCancelStreamClose).Add(float64(len(ws.cancels)))
 	ws.closed = true
 	close(ws.ch)
 }
@@ -76,18 +76,29 @@ func (wb watcherBatch) add(w *watcher, ev mvccpb.Event) {
 	eb.add(ev)
 }
 
-// newWatcherBatch 当收到一批事件后,去watchGroup组找匹配的watcher ,然后发送出去
-func newWatcherBatch(wg *watcherGroup, evs []mvccpb.Event) watcherBatch {
+// newWatcherBatch 当收到一批事件后,去watchGroup组找匹配的watcher ,然后发送出去;
+// unchanged 判断put事件的value是否没有变化,只在有skipUnchanged的watcher匹配时才调用,每个事件最多一次
+func newWatcherBatch(wg *watcherGroup, evs []mvccpb.Event, unchanged func(ev mvccpb.Event) bool) watcherBatch {
 	if len(wg.watchers) == 0 { // 没有watcher
 		return nil
 	}
 	wb := make(watcherBatch) // 给watcher发送一批事件
 	for _, ev := range evs {
+		checked, same := false, false
 		for w := range wg.watcherSetByKey(ev.Kv.Key) {
-			if ev.Kv.ModRevision >= w.minRev {
+			if ev.Kv.ModRevision < w.minRev {
 				// 不要重复通知
-				wb.add(w, ev)
+				continue
 			}
+			if w.skipUnchanged {
+				if !checked {
+					checked, same = true, unchanged(ev)
+				}
+				if same {
+					continue
+				}
+			}
+			wb.add(w, ev)
 		}
 	}
 	return wb
@@ -255,6 +266,7 @@ func (wg *watcherGroup) chooseAll(curRev, compactRev int64) int64 {
 			}:
 				w.compacted = true
 				wg.delete(w)
+				watchCancellations.WithLabelValues(watchCancelCompacted).Inc()
 			default:
 				// retry next time
 			}
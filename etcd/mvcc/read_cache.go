@@ -0,0 +1,148 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mvcc
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/ls-2018/etcd_cn/offical/api/v3/mvccpb"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// 每个缓存项除键和值以外的估计开销
+const readCacheEntryOverhead = 128
+
+var (
+	readCacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "etcd",
+		Subsystem: "mvcc",
+		Name:      "read_cache_requests_total",
+		Help:      "The total number of key-value lookups in the read cache by result (hit or miss).",
+	}, []string{"result"})
+	readCacheEvictions = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "etcd",
+		Subsystem: "mvcc",
+		Name:      "read_cache_evictions_total",
+		Help:      "The total number of read cache entries evicted to stay within the size limit.",
+	})
+	readCacheBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "etcd",
+		Subsystem: "mvcc",
+		Name:      "read_cache_bytes",
+		Help:      "The estimated size of the key-values held in the read cache.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(readCacheRequests)
+	prometheus.MustRegister(readCacheEvictions)
+	prometheus.MustRegister(readCacheBytes)
+}
+
+// readCache 按修订版本缓存解码后的 KeyValue,省去range时读取bolt页和反序列化.
+// 一个修订版本的数据不会改变;apply覆盖或删除key时删除它上一个修订版本的缓存,
+// 被压缩的修订版本不会再被读到,由LRU淘汰.nil表示不缓存.
+type readCache struct {
+	maxBytes int64
+
+	mu    sync.Mutex
+	ll    *list.List // 最近使用的在前面
+	items map[revision]*list.Element
+	bytes int64
+}
+
+type readCacheEntry struct {
+	rev  revision
+	kv   mvccpb.KeyValue
+	size int64
+}
+
+func newReadCache(maxBytes int64) *readCache {
+	if maxBytes <= 0 {
+		return nil
+	}
+	return &readCache{maxBytes: maxBytes, ll: list.New(), items: make(map[revision]*list.Element)}
+}
+
+func (c *readCache) get(rev revision) (mvccpb.KeyValue, bool) {
+	if c == nil {
+		return mvccpb.KeyValue{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[rev]
+	if !ok {
+		readCacheRequests.WithLabelValues("miss").Inc()
+		return mvccpb.KeyValue{}, false
+	}
+	readCacheRequests.WithLabelValues("hit").Inc()
+	c.ll.MoveToFront(e)
+	return e.Value.(*readCacheEntry).kv, true
+}
+
+func (c *readCache) add(rev revision, kv mvccpb.KeyValue) {
+	if c == nil {
+		return
+	}
+	size := int64(len(kv.Key)+len(kv.Value)) + readCacheEntryOverhead
+	if size > c.maxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.items[rev]; ok {
+		return
+	}
+	c.items[rev] = c.ll.PushFront(&readCacheEntry{rev: rev, kv: kv, size: size})
+	c.bytes += size
+	for c.bytes > c.maxBytes {
+		c.removeElement(c.ll.Back())
+		readCacheEvictions.Inc()
+	}
+	readCacheBytes.Set(float64(c.bytes))
+}
+
+// invalidate 删除一个修订版本的缓存
+func (c *readCache) invalidate(rev revision) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[rev]; ok {
+		c.removeElement(e)
+		readCacheBytes.Set(float64(c.bytes))
+	}
+}
+
+// reset 清空缓存,用于从快照恢复后端
+func (c *readCache) reset() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ll.Init()
+	c.items = make(map[revision]*list.Element)
+	c.bytes = 0
+	readCacheBytes.Set(0)
+}
+
+func (c *readCache) removeElement(e *list.Element) {
+	ent := c.ll.Remove(e).(*readCacheEntry)
+	delete(c.items, ent.rev)
+	c.bytes -= ent.size
+}
@@ -0,0 +1,150 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mvcc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ls-2018/etcd_cn/etcd/lease"
+	betesting "github.com/ls-2018/etcd_cn/etcd/mvcc/backend/testing"
+	"github.com/ls-2018/etcd_cn/offical/api/v3/mvccpb"
+	"go.uber.org/zap"
+)
+
+// newCachedStore 创建带读缓存的store
+func newCachedStore(t *testing.T) *store {
+	be, _ := betesting.NewDefaultTmpBackend(t)
+	s := NewStore(zap.NewNop(), be, &lease.FakeLessor{}, StoreConfig{ReadCacheBytes: 1 << 20})
+	t.Cleanup(func() {
+		s.Close()
+		betesting.Close(t, be)
+	})
+	return s
+}
+
+func (c *readCache) has(rev revision) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.items[rev]
+	return ok
+}
+
+func mustRange(t *testing.T, s *store, key string) []mvccpb.KeyValue {
+	r, err := s.Range(context.TODO(), []byte(key), nil, RangeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r.KVs
+}
+
+func TestReadCacheDisabled(t *testing.T) {
+	if c := newReadCache(0); c != nil {
+		t.Fatalf("newReadCache(0) = %v, want nil", c)
+	}
+	var c *readCache
+	c.add(revision{Main: 1}, mvccpb.KeyValue{Key: "foo"})
+	if _, ok := c.get(revision{Main: 1}); ok {
+		t.Fatal("nil cache returned a hit")
+	}
+}
+
+// TestReadCacheEvict 超过字节上限时淘汰最久没有使用的项,超过上限的单个项不缓存
+func TestReadCacheEvict(t *testing.T) {
+	kv := mvccpb.KeyValue{Key: "k", Value: "v"}
+	size := int64(len(kv.Key)+len(kv.Value)) + readCacheEntryOverhead
+	c := newReadCache(2 * size)
+
+	c.add(revision{Main: 1}, kv)
+	c.add(revision{Main: 2}, kv)
+	// 访问1后,2成为最久没有使用的
+	if _, ok := c.get(revision{Main: 1}); !ok {
+		t.Fatal("rev 1 not cached")
+	}
+	c.add(revision{Main: 3}, kv)
+	if c.has(revision{Main: 2}) || !c.has(revision{Main: 1}) || !c.has(revision{Main: 3}) {
+		t.Fatalf("cached revisions = %v, want 1 and 3", c.items)
+	}
+	if c.bytes != 2*size {
+		t.Fatalf("bytes = %d, want %d", c.bytes, 2*size)
+	}
+
+	c.add(revision{Main: 4}, mvccpb.KeyValue{Key: "k", Value: string(make([]byte, 2*size))})
+	if c.has(revision{Main: 4}) || c.bytes != 2*size {
+		t.Fatal("cached an entry larger than the limit")
+	}
+}
+
+// TestReadCacheInvalidateOnPut 覆盖key时删除上一个修订版本的缓存
+func TestReadCacheInvalidateOnPut(t *testing.T) {
+	s := newCachedStore(t)
+	s.Put([]byte("foo"), []byte("bar"), lease.NoLease)
+	if kvs := mustRange(t, s, "foo"); len(kvs) != 1 || kvs[0].Value != "bar" {
+		t.Fatalf("range = %v, want foo=bar", kvs)
+	}
+	old := revision{Main: 2}
+	if !s.readCache.has(old) {
+		t.Fatal("range did not fill the cache")
+	}
+
+	s.Put([]byte("foo"), []byte("baz"), lease.NoLease)
+	if s.readCache.has(old) {
+		t.Fatal("overwritten revision still cached")
+	}
+	if kvs := mustRange(t, s, "foo"); len(kvs) != 1 || kvs[0].Value != "baz" {
+		t.Fatalf("range = %v, want foo=baz", kvs)
+	}
+}
+
+// TestReadCacheInvalidateOnDelete 删除key时删除它的缓存
+func TestReadCacheInvalidateOnDelete(t *testing.T) {
+	s := newCachedStore(t)
+	s.Put([]byte("foo"), []byte("bar"), lease.NoLease)
+	mustRange(t, s, "foo")
+	if !s.readCache.has(revision{Main: 2}) {
+		t.Fatal("range did not fill the cache")
+	}
+
+	s.DeleteRange([]byte("foo"), nil)
+	if s.readCache.has(revision{Main: 2}) {
+		t.Fatal("deleted revision still cached")
+	}
+	if kvs := mustRange(t, s, "foo"); len(kvs) != 0 {
+		t.Fatalf("range = %v, want no keys", kvs)
+	}
+}
+
+// TestReadCacheResetOnRestore 从快照恢复后端时清空缓存,同一修订版本不会读到旧值
+func TestReadCacheResetOnRestore(t *testing.T) {
+	s := newCachedStore(t)
+	s.Put([]byte("foo"), []byte("bar"), lease.NoLease)
+	mustRange(t, s, "foo")
+
+	be, _ := betesting.NewDefaultTmpBackend(t)
+	defer betesting.Close(t, be)
+	snap := NewStore(zap.NewNop(), be, &lease.FakeLessor{}, StoreConfig{})
+	snap.Put([]byte("foo"), []byte("baz"), lease.NoLease)
+	snap.Close()
+
+	if err := s.Restore(be); err != nil {
+		t.Fatal(err)
+	}
+	if s.readCache.ll.Len() != 0 || s.readCache.bytes != 0 {
+		t.Fatalf("cache holds %d entries (%d bytes) after restore, want none", s.readCache.ll.Len(), s.readCache.bytes)
+	}
+	if kvs := mustRange(t, s, "foo"); len(kvs) != 1 || kvs[0].Value != "baz" {
+		t.Fatalf("range = %v after restore, want foo=baz", kvs)
+	}
+}
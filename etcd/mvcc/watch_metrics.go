@@ -0,0 +1,219 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mvcc
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// watchBucketSegments 按key的前几段(以 / 分隔)把watcher归到同一个范围桶
+	watchBucketSegments = 2
+	// maxWatchBuckets 每次采集最多输出的范围桶数,其余的合并到 other
+	maxWatchBuckets  = 50
+	watchBucketOther = "other"
+
+	// watcher取消的原因
+	watchCancelClient      = "client"
+	watchCancelStreamClose = "stream-closed"
+	watchCancelCompacted   = "compacted"
+)
+
+var (
+	watchCancellations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "etcd",
+		Subsystem: "mvcc",
+		Name:      "watch_cancellations_total",
+		Help:      "The total number of canceled watchers by reason.",
+	}, []string{"reason"})
+
+	watchersDesc = prometheus.NewDesc(
+		"etcd_mvcc_watchers",
+		"The number of watchers by key range bucket and state (synced, unsynced or victim).",
+		[]string{"bucket", "state"}, nil)
+	watchPendingEventsDesc = prometheus.NewDesc(
+		"etcd_mvcc_watch_pending_events",
+		"The number of events held for blocked (victim) watchers by key range bucket.",
+		[]string{"bucket"}, nil)
+	watchSlowestLagDesc = prometheus.NewDesc(
+		"etcd_mvcc_watch_slowest_lag_revisions",
+		"The lag in revisions of the slowest unsynced or victim watcher by key range bucket.",
+		[]string{"bucket"}, nil)
+)
+
+func init() {
+	prometheus.MustRegister(watchCancellations)
+	prometheus.MustRegister(watchCollector)
+}
+
+// watchCollector 在采集时遍历所有 watchableStore 计算watcher指标,避免在发送事件的路径上维护计数;
+// 同一进程中有多个store时按桶合并
+var watchCollector = &watchMetricsCollector{stores: make(map[*watchableStore]struct{})}
+
+type watchMetricsCollector struct {
+	mu     sync.Mutex
+	stores map[*watchableStore]struct{}
+}
+
+func (c *watchMetricsCollector) add(s *watchableStore) {
+	c.mu.Lock()
+	c.stores[s] = struct{}{}
+	c.mu.Unlock()
+}
+
+func (c *watchMetricsCollector) remove(s *watchableStore) {
+	c.mu.Lock()
+	delete(c.stores, s)
+	c.mu.Unlock()
+}
+
+// watchBucketStats 一个范围桶内的统计
+type watchBucketStats struct {
+	synced, unsynced, victim int
+	pending                  int
+	lag                      int64
+}
+
+func (st *watchBucketStats) total() int { return st.synced + st.unsynced + st.victim }
+
+func (st *watchBucketStats) merge(o *watchBucketStats) {
+	st.synced += o.synced
+	st.unsynced += o.unsynced
+	st.victim += o.victim
+	st.pending += o.pending
+	if o.lag > st.lag {
+		st.lag = o.lag
+	}
+}
+
+func (c *watchMetricsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- watchersDesc
+	ch <- watchPendingEventsDesc
+	ch <- watchSlowestLagDesc
+}
+
+func (c *watchMetricsCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	stores := make([]*watchableStore, 0, len(c.stores))
+	for s := range c.stores {
+		stores = append(stores, s)
+	}
+	c.mu.Unlock()
+
+	buckets := make(map[string]*watchBucketStats)
+	for _, s := range stores {
+		s.watchBucketStats(buckets)
+	}
+	for b, st := range limitWatchBuckets(buckets) {
+		ch <- prometheus.MustNewConstMetric(watchersDesc, prometheus.GaugeValue, float64(st.synced), b, "synced")
+		ch <- prometheus.MustNewConstMetric(watchersDesc, prometheus.GaugeValue, float64(st.unsynced), b, "unsynced")
+		ch <- prometheus.MustNewConstMetric(watchersDesc, prometheus.GaugeValue, float64(st.victim), b, "victim")
+		ch <- prometheus.MustNewConstMetric(watchPendingEventsDesc, prometheus.GaugeValue, float64(st.pending), b)
+		ch <- prometheus.MustNewConstMetric(watchSlowestLagDesc, prometheus.GaugeValue, float64(st.lag), b)
+	}
+}
+
+// limitWatchBuckets 只保留watcher最多的 maxWatchBuckets 个桶,其余合并到 other
+func limitWatchBuckets(buckets map[string]*watchBucketStats) map[string]*watchBucketStats {
+	if len(buckets) <= maxWatchBuckets {
+		return buckets
+	}
+	names := make([]string, 0, len(buckets))
+	for b := range buckets {
+		names = append(names, b)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if ti, tj := buckets[names[i]].total(), buckets[names[j]].total(); ti != tj {
+			return ti > tj
+		}
+		return names[i] < names[j]
+	})
+	ret := make(map[string]*watchBucketStats, maxWatchBuckets)
+	other := &watchBucketStats{}
+	for i, b := range names {
+		if i < maxWatchBuckets-1 {
+			ret[b] = buckets[b]
+		} else {
+			other.merge(buckets[b])
+		}
+	}
+	if o, ok := ret[watchBucketOther]; ok {
+		other.merge(o)
+	}
+	ret[watchBucketOther] = other
+	return ret
+}
+
+// watchBucketStats 把本store的watcher统计累加到 buckets 中
+func (s *watchableStore) watchBucketStats(buckets map[string]*watchBucketStats) {
+	get := func(w *watcher) *watchBucketStats {
+		b := watchRangeBucket(w.key)
+		st, ok := buckets[b]
+		if !ok {
+			st = &watchBucketStats{}
+			buckets[b] = st
+		}
+		return st
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	curRev := s.rev()
+	for w := range s.synced.watchers {
+		get(w).synced++
+	}
+	for w := range s.unsynced.watchers {
+		st := get(w)
+		st.unsynced++
+		if lag := curRev - w.minRev + 1; lag > st.lag {
+			st.lag = lag
+		}
+	}
+	for _, wb := range s.victims {
+		for w, eb := range wb {
+			st := get(w)
+			st.victim++
+			st.pending += len(eb.evs)
+			// 以最早一个未送达事件的修订版本计算落后量
+			if len(eb.evs) > 0 {
+				if lag := curRev - eb.evs[0].Kv.ModRevision + 1; lag > st.lag {
+					st.lag = lag
+				}
+			}
+		}
+	}
+}
+
+// watchRangeBucket 返回watch key所属的范围桶:key 的前 watchBucketSegments 段,
+// 例如 /registry/pods/default/a 属于 /registry/pods;监听所有key时为 *
+func watchRangeBucket(key string) string {
+	if key == "" {
+		return "*"
+	}
+	n := watchBucketSegments
+	if strings.HasPrefix(key, "/") {
+		n++
+	}
+	parts := strings.SplitN(key, "/", n+1)
+	if len(parts) > n {
+		parts = parts[:n]
+	}
+	// 标签值必须是合法的UTF-8
+	return strings.ToValidUTF8(strings.Join(parts, "/"), "?")
+}
@@ -47,3 +47,7 @@ func (s *kvs2kvc) Txn(ctx context.Context, in *pb.TxnRequest, opts ...grpc.CallO
 func (s *kvs2kvc) Compact(ctx context.Context, in *pb.CompactionRequest, opts ...grpc.CallOption) (*pb.CompactionResponse, error) {
 	return s.kvs.Compact(ctx, in)
 }
+
+func (s *kvs2kvc) StagedTxn(ctx context.Context, in *pb.StagedTxnRequest, opts ...grpc.CallOption) (*pb.StagedTxnResponse, error) {
+	return s.kvs.StagedTxn(ctx, in)
+}
@@ -53,6 +53,13 @@ func (c *ls2lc) LeaseLeases(ctx context.Context, in *pb.LeaseLeasesRequest, opts
 	return c.leaseServer.LeaseLeases(ctx, in)
 }
 
+func (c *ls2lc) LeaseWatch(ctx context.Context, in *pb.LeaseWatchRequest, opts ...grpc.CallOption) (pb.Lease_LeaseWatchClient, error) {
+	cs := newPipeStream(ctx, func(ss chanServerStream) error {
+		return c.leaseServer.LeaseWatch(in, &lw2lwServerStream{ss})
+	})
+	return &lw2lwClientStream{cs}, nil
+}
+
 // ls2lcClientStream implements Lease_LeaseKeepAliveClient
 type ls2lcClientStream struct{ chanClientStream }
 
@@ -82,3 +89,21 @@ func (s *ls2lcServerStream) Recv() (*pb.LeaseKeepAliveRequest, error) {
 	}
 	return v.(*pb.LeaseKeepAliveRequest), nil
 }
+
+// lw2lwClientStream implements Lease_LeaseWatchClient
+type lw2lwClientStream struct{ chanClientStream }
+
+// lw2lwServerStream implements Lease_LeaseWatchServer
+type lw2lwServerStream struct{ chanServerStream }
+
+func (s *lw2lwClientStream) Recv() (*pb.LeaseWatchResponse, error) {
+	var v interface{}
+	if err := s.RecvMsg(&v); err != nil {
+		return nil, err
+	}
+	return v.(*pb.LeaseWatchResponse), nil
+}
+
+func (s *lw2lwServerStream) Send(rr *pb.LeaseWatchResponse) error {
+	return s.SendMsg(rr)
+}
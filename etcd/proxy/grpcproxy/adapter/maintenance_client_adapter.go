@@ -56,6 +56,42 @@ func (s *mts2mtc) Downgrade(ctx context.Context, r *pb.DowngradeRequest, opts ..
 	return s.mts.Downgrade(ctx, r)
 }
 
+func (s *mts2mtc) ReloadCerts(ctx context.Context, r *pb.ReloadCertsRequest, opts ...grpc.CallOption) (*pb.ReloadCertsResponse, error) {
+	return s.mts.ReloadCerts(ctx, r)
+}
+
+func (s *mts2mtc) MaintenanceMode(ctx context.Context, r *pb.MaintenanceModeRequest, opts ...grpc.CallOption) (*pb.MaintenanceModeResponse, error) {
+	return s.mts.MaintenanceMode(ctx, r)
+}
+
+func (s *mts2mtc) LogLevel(ctx context.Context, r *pb.LogLevelRequest, opts ...grpc.CallOption) (*pb.LogLevelResponse, error) {
+	return s.mts.LogLevel(ctx, r)
+}
+
+func (s *mts2mtc) Failpoint(ctx context.Context, r *pb.FailpointRequest, opts ...grpc.CallOption) (*pb.FailpointResponse, error) {
+	return s.mts.Failpoint(ctx, r)
+}
+
+func (s *mts2mtc) PeerStats(ctx context.Context, r *pb.PeerStatsRequest, opts ...grpc.CallOption) (*pb.PeerStatsResponse, error) {
+	return s.mts.PeerStats(ctx, r)
+}
+
+func (s *mts2mtc) CompactionHold(ctx context.Context, r *pb.CompactionHoldRequest, opts ...grpc.CallOption) (*pb.CompactionHoldResponse, error) {
+	return s.mts.CompactionHold(ctx, r)
+}
+
+func (s *mts2mtc) UserUsage(ctx context.Context, r *pb.UserUsageRequest, opts ...grpc.CallOption) (*pb.UserUsageResponse, error) {
+	return s.mts.UserUsage(ctx, r)
+}
+
+func (s *mts2mtc) SnapshotSession(ctx context.Context, r *pb.SnapshotSessionRequest, opts ...grpc.CallOption) (*pb.SnapshotSessionResponse, error) {
+	return s.mts.SnapshotSession(ctx, r)
+}
+
+func (s *mts2mtc) PromoteReplica(ctx context.Context, r *pb.PromoteReplicaRequest, opts ...grpc.CallOption) (*pb.PromoteReplicaResponse, error) {
+	return s.mts.PromoteReplica(ctx, r)
+}
+
 func (s *mts2mtc) Snapshot(ctx context.Context, in *pb.SnapshotRequest, opts ...grpc.CallOption) (pb.Maintenance_SnapshotClient, error) {
 	cs := newPipeStream(ctx, func(ss chanServerStream) error {
 		return s.mts.Snapshot(in, &ss2scServerStream{ss})
@@ -92,3 +128,28 @@ func (s *ss2scServerStream) Recv() (*pb.SnapshotRequest, error) {
 	}
 	return v.(*pb.SnapshotRequest), nil
 }
+
+func (s *mts2mtc) Profile(ctx context.Context, in *pb.ProfileRequest, opts ...grpc.CallOption) (pb.Maintenance_ProfileClient, error) {
+	cs := newPipeStream(ctx, func(ss chanServerStream) error {
+		return s.mts.Profile(in, &ps2pcServerStream{ss})
+	})
+	return &ps2pcClientStream{cs}, nil
+}
+
+// ps2pcClientStream implements Maintenance_ProfileClient
+type ps2pcClientStream struct{ chanClientStream }
+
+// ps2pcServerStream implements Maintenance_ProfileServer
+type ps2pcServerStream struct{ chanServerStream }
+
+func (s *ps2pcClientStream) Recv() (*pb.ProfileResponse, error) {
+	var v interface{}
+	if err := s.RecvMsg(&v); err != nil {
+		return nil, err
+	}
+	return v.(*pb.ProfileResponse), nil
+}
+
+func (s *ps2pcServerStream) Send(rr *pb.ProfileResponse) error {
+	return s.SendMsg(rr)
+}
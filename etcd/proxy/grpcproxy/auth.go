@@ -16,6 +16,7 @@ package grpcproxy
 
 import (
 	"context"
+	"time"
 
 	clientv3 "github.com/ls-2018/etcd_cn/client_sdk/v3"
 
@@ -24,18 +25,40 @@ import (
 
 type AuthProxy struct {
 	client *clientv3.Client
+
+	// tokens caches Authenticate responses; nil disables caching.
+	tokens *tokenCache
+}
+
+// AuthProxyConfig tunes the auth proxy.
+type AuthProxyConfig struct {
+	// TokenCacheTTL is how long a successful Authenticate response is reused
+	// for the same credentials; 0 disables caching. It should stay well below
+	// the token TTL of the etcd servers.
+	TokenCacheTTL time.Duration
 }
 
 func NewAuthProxy(c *clientv3.Client) pb.AuthServer {
 	return &AuthProxy{client: c}
 }
 
+// NewAuthProxyWithConfig is like NewAuthProxy, with token caching set by cfg.
+func NewAuthProxyWithConfig(c *clientv3.Client, cfg AuthProxyConfig) pb.AuthServer {
+	ap := &AuthProxy{client: c}
+	if cfg.TokenCacheTTL > 0 {
+		ap.tokens = newTokenCache(cfg.TokenCacheTTL)
+	}
+	return ap
+}
+
 func (ap *AuthProxy) AuthEnable(ctx context.Context, r *pb.AuthEnableRequest) (*pb.AuthEnableResponse, error) {
+	ap.tokens.reset()
 	conn := ap.client.ActiveConnection()
 	return pb.NewAuthClient(conn).AuthEnable(ctx, r)
 }
 
 func (ap *AuthProxy) AuthDisable(ctx context.Context, r *pb.AuthDisableRequest) (*pb.AuthDisableResponse, error) {
+	ap.tokens.reset()
 	conn := ap.client.ActiveConnection()
 	return pb.NewAuthClient(conn).AuthDisable(ctx, r)
 }
@@ -46,8 +69,15 @@ func (ap *AuthProxy) AuthStatus(ctx context.Context, r *pb.AuthStatusRequest) (*
 }
 
 func (ap *AuthProxy) Authenticate(ctx context.Context, r *pb.AuthenticateRequest) (*pb.AuthenticateResponse, error) {
+	if resp, ok := ap.tokens.get(r.Name, r.Password); ok {
+		return resp, nil
+	}
 	conn := ap.client.ActiveConnection()
-	return pb.NewAuthClient(conn).Authenticate(ctx, r)
+	resp, err := pb.NewAuthClient(conn).Authenticate(ctx, r)
+	if err == nil {
+		ap.tokens.add(r.Name, r.Password, resp)
+	}
+	return resp, err
 }
 
 func (ap *AuthProxy) RoleAdd(ctx context.Context, r *pb.AuthRoleAddRequest) (*pb.AuthRoleAddResponse, error) {
@@ -86,6 +116,7 @@ func (ap *AuthProxy) UserAdd(ctx context.Context, r *pb.AuthUserAddRequest) (*pb
 }
 
 func (ap *AuthProxy) UserDelete(ctx context.Context, r *pb.AuthUserDeleteRequest) (*pb.AuthUserDeleteResponse, error) {
+	ap.tokens.invalidate(r.Name)
 	conn := ap.client.ActiveConnection()
 	return pb.NewAuthClient(conn).UserDelete(ctx, r)
 }
@@ -111,6 +142,12 @@ func (ap *AuthProxy) UserRevokeRole(ctx context.Context, r *pb.AuthUserRevokeRol
 }
 
 func (ap *AuthProxy) UserChangePassword(ctx context.Context, r *pb.AuthUserChangePasswordRequest) (*pb.AuthUserChangePasswordResponse, error) {
+	ap.tokens.invalidate(r.Name)
 	conn := ap.client.ActiveConnection()
 	return pb.NewAuthClient(conn).UserChangePassword(ctx, r)
 }
+
+func (ap *AuthProxy) Denials(ctx context.Context, r *pb.AuthDenialsRequest) (*pb.AuthDenialsResponse, error) {
+	conn := ap.client.ActiveConnection()
+	return pb.NewAuthClient(conn).Denials(ctx, r)
+}
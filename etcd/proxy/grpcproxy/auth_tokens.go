@@ -0,0 +1,104 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcproxy
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+)
+
+// tokenCache reuses Authenticate responses so that clients logging in
+// through the proxy do not each cost a password check on the etcd servers.
+// A nil *tokenCache caches nothing.
+type tokenCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[tokenCacheKey]tokenCacheEntry
+}
+
+type tokenCacheKey struct {
+	name string
+	// 只保存密码摘要
+	password [sha256.Size]byte
+}
+
+type tokenCacheEntry struct {
+	resp    *pb.AuthenticateResponse
+	expires time.Time
+}
+
+func newTokenCache(ttl time.Duration) *tokenCache {
+	return &tokenCache{ttl: ttl, entries: make(map[tokenCacheKey]tokenCacheEntry)}
+}
+
+func (tc *tokenCache) get(name, password string) (*pb.AuthenticateResponse, bool) {
+	if tc == nil {
+		return nil, false
+	}
+	k := tokenCacheKey{name: name, password: sha256.Sum256([]byte(password))}
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	e, ok := tc.entries[k]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(e.expires) {
+		delete(tc.entries, k)
+		return nil, false
+	}
+	return e.resp, true
+}
+
+func (tc *tokenCache) add(name, password string, resp *pb.AuthenticateResponse) {
+	if tc == nil {
+		return
+	}
+	now := time.Now()
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	for k, e := range tc.entries {
+		if now.After(e.expires) {
+			delete(tc.entries, k)
+		}
+	}
+	tc.entries[tokenCacheKey{name: name, password: sha256.Sum256([]byte(password))}] = tokenCacheEntry{resp: resp, expires: now.Add(tc.ttl)}
+}
+
+// invalidate drops the cached tokens of a user.
+func (tc *tokenCache) invalidate(name string) {
+	if tc == nil {
+		return
+	}
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	for k := range tc.entries {
+		if k.name == name {
+			delete(tc.entries, k)
+		}
+	}
+}
+
+func (tc *tokenCache) reset() {
+	if tc == nil {
+		return
+	}
+	tc.mu.Lock()
+	tc.entries = make(map[tokenCacheKey]tokenCacheEntry)
+	tc.mu.Unlock()
+}
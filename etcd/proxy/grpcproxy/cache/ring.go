@@ -0,0 +1,100 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// DefaultVirtualNodes is the number of points each member occupies on a Ring.
+const DefaultVirtualNodes = 100
+
+// Ring is a consistent hash ring that maps keys to members. Adding or
+// removing a member only moves the keys owned by that member.
+type Ring struct {
+	replicas int
+
+	mu      sync.RWMutex
+	hashes  []uint32
+	owners  map[uint32]string
+	members []string
+}
+
+// NewRing returns an empty ring placing each member at the given number of
+// virtual nodes; non-positive values use DefaultVirtualNodes.
+func NewRing(replicas int) *Ring {
+	if replicas <= 0 {
+		replicas = DefaultVirtualNodes
+	}
+	return &Ring{replicas: replicas, owners: make(map[uint32]string)}
+}
+
+// Set replaces the ring membership.
+func (r *Ring) Set(members []string) {
+	ms := make([]string, 0, len(members))
+	seen := make(map[string]struct{}, len(members))
+	for _, m := range members {
+		if _, ok := seen[m]; ok || m == "" {
+			continue
+		}
+		seen[m] = struct{}{}
+		ms = append(ms, m)
+	}
+	sort.Strings(ms)
+
+	hashes := make([]uint32, 0, len(ms)*r.replicas)
+	owners := make(map[uint32]string, len(ms)*r.replicas)
+	for _, m := range ms {
+		for i := 0; i < r.replicas; i++ {
+			h := crc32.ChecksumIEEE([]byte(strconv.Itoa(i) + "/" + m))
+			// 冲突时保留字典序较小的成员,保证各副本计算结果一致
+			if _, ok := owners[h]; ok {
+				continue
+			}
+			owners[h] = m
+			hashes = append(hashes, h)
+		}
+	}
+	sort.Slice(hashes, func(i, j int) bool { return hashes[i] < hashes[j] })
+
+	r.mu.Lock()
+	r.hashes, r.owners, r.members = hashes, owners, ms
+	r.mu.Unlock()
+}
+
+// Get returns the member owning key, or "" if the ring is empty.
+func (r *Ring) Get(key string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.hashes) == 0 {
+		return ""
+	}
+	h := crc32.ChecksumIEEE([]byte(key))
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.owners[r.hashes[i]]
+}
+
+// Members returns the sorted ring membership.
+func (r *Ring) Members() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]string(nil), r.members...)
+}
@@ -72,6 +72,10 @@ type cache struct {
 
 // Add adds the response of a request to the cache if its revision is larger than the compacted revision of the cache.
 func (c *cache) Add(req *pb.RangeRequest, resp *pb.RangeResponse) {
+	// 快照会话可能已经过期或被释放,每次都由服务端检查
+	if req.SnapshotToken != "" {
+		return
+	}
 	key := keyFunc(req)
 
 	c.mu.Lock()
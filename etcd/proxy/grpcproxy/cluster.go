@@ -124,6 +124,14 @@ func (cp *clusterProxy) monitor(wa endpoints.WatchChannel) {
 }
 
 func (cp *clusterProxy) MemberAdd(ctx context.Context, r *pb.MemberAddRequest) (*pb.MemberAddResponse, error) {
+	if len(r.Labels) > 0 {
+		mresp, err := cp.clus.MemberAddWithLabels(ctx, r.PeerURLs, r.IsLearner, r.Labels)
+		if err != nil {
+			return nil, err
+		}
+		resp := (pb.MemberAddResponse)(*mresp)
+		return &resp, err
+	}
 	if r.IsLearner {
 		return cp.memberAddAsLearner(ctx, r.PeerURLs)
 	}
@@ -158,7 +166,7 @@ func (cp *clusterProxy) MemberRemove(ctx context.Context, r *pb.MemberRemoveRequ
 }
 
 func (cp *clusterProxy) MemberUpdate(ctx context.Context, r *pb.MemberUpdateRequest) (*pb.MemberUpdateResponse, error) {
-	mresp, err := cp.clus.MemberUpdate(ctx, r.ID, r.PeerURLs)
+	mresp, err := cp.clus.MemberUpdateWithLabels(ctx, r.ID, r.PeerURLs, r.Labels)
 	if err != nil {
 		return nil, err
 	}
@@ -212,3 +220,12 @@ func (cp *clusterProxy) MemberPromote(ctx context.Context, r *pb.MemberPromoteRe
 	// TODO: implement
 	return nil, errors.New("not implemented")
 }
+
+func (cp *clusterProxy) MemberBatchChange(ctx context.Context, r *pb.MemberBatchChangeRequest) (*pb.MemberBatchChangeResponse, error) {
+	mresp, err := cp.clus.MemberBatchChange(ctx, clientv3.MemberBatchChange{Add: r.Add, Promote: r.Promote, Remove: r.Remove})
+	if err != nil {
+		return nil, err
+	}
+	resp := (pb.MemberBatchChangeResponse)(*mresp)
+	return &resp, err
+}
@@ -16,41 +16,122 @@ package grpcproxy
 
 import (
 	"context"
+	"sync"
+	"time"
 
 	clientv3 "github.com/ls-2018/etcd_cn/client_sdk/v3"
 
 	"github.com/ls-2018/etcd_cn/etcd/proxy/grpcproxy/cache"
 	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+	"go.uber.org/zap"
 )
 
 type kvProxy struct {
-	kv    clientv3.KV
-	cache cache.Cache
+	kv     clientv3.KV
+	remote pb.KVClient
+	cache  cache.Cache
+
+	// staged 暂存事务写入的范围,提交后失效这些缓存
+	stagedMu sync.Mutex
+	staged   map[int64]*stagedRanges
+
+	// peers 为 nil 时不与其他代理共享缓存
+	peers *peerCache
+
+	// writes 为 nil 时不保证读己之写
+	writes  *writeTracker
+	rywWait time.Duration
+}
+
+// KvProxyConfig tunes the KV proxy.
+type KvProxyConfig struct {
+	// Peers, if set, shares the read cache with other proxies; see NewKvProxyWithPeers.
+	Peers *PeerCacheConfig
+
+	// ReadYourWrites makes serializable reads of a client observe its own
+	// earlier writes, identifying clients by their remote address.
+	ReadYourWrites bool
+	// ReadYourWritesWait is how long a serializable read may wait for the
+	// member to catch up before falling back to a linearizable read.
+	ReadYourWritesWait time.Duration
+	// ReadYourWritesSessionTTL is how long the last write of an idle client is remembered.
+	ReadYourWritesSessionTTL time.Duration
 }
 
 func NewKvProxy(c *clientv3.Client) (pb.KVServer, <-chan struct{}) {
+	return NewKvProxyWithConfig(nil, c, KvProxyConfig{})
+}
+
+// NewKvProxyWithConfig is like NewKvProxy, with cache sharing and read
+// consistency set by cfg. The returned channel is closed once the proxy's
+// background work, if any, has stopped.
+func NewKvProxyWithConfig(lg *zap.Logger, c *clientv3.Client, cfg KvProxyConfig) (pb.KVServer, <-chan struct{}) {
+	if lg == nil {
+		lg = zap.NewNop()
+	}
 	kv := &kvProxy{
-		kv:    c.KV,
-		cache: cache.NewCache(cache.DefaultMaxEntries),
+		kv:      c.KV,
+		remote:  clientv3.RetryKVClient(c),
+		cache:   cache.NewCache(cache.DefaultMaxEntries),
+		staged:  make(map[int64]*stagedRanges),
+		rywWait: cfg.ReadYourWritesWait,
+	}
+	if kv.rywWait <= 0 {
+		kv.rywWait = defaultReadYourWritesWait
+	}
+	if cfg.ReadYourWrites {
+		ttl := cfg.ReadYourWritesSessionTTL
+		if ttl <= 0 {
+			ttl = defaultReadYourWritesSessionTTL
+		}
+		kv.writes = newWriteTracker(ttl)
+	}
+
+	var donec <-chan struct{}
+	if cfg.Peers != nil {
+		kv.peers, donec = newPeerCache(lg, c, *cfg.Peers)
+	}
+	if donec == nil {
+		ch := make(chan struct{})
+		close(ch)
+		donec = ch
 	}
-	donec := make(chan struct{})
-	close(donec)
 	return kv, donec
 }
 
 func (p *kvProxy) Range(ctx context.Context, r *pb.RangeRequest) (*pb.RangeResponse, error) {
+	minRev := p.minRevision(ctx, r)
+	if p.peers != nil {
+		if fromPeer(ctx, metadataInvalidate) {
+			p.cache.Invalidate([]byte(r.Key), []byte(r.RangeEnd))
+			return &pb.RangeResponse{}, nil
+		}
+		if r.Serializable && !fromPeer(ctx, metadataForwarded) {
+			if owner := p.peers.owner(r.Key); owner != "" {
+				resp, err := p.peers.forward(ctx, owner, r, minRev)
+				if err == nil {
+					return resp, nil
+				}
+				p.peers.lg.Warn("failed to forward range to peer proxy; serving locally", zap.String("peer", owner), zap.Error(err))
+			}
+		}
+	}
+
 	if r.Serializable {
 		resp, err := p.cache.Get(r)
 		switch err {
 		case nil:
-			return resp, nil
+			// 缓存落后于客户端自己的写入时回源
+			if headerRevision(resp.Header) >= minRev {
+				return resp, nil
+			}
 		case cache.ErrCompacted:
 			return nil, err
 		}
 
 	}
 
-	resp, err := p.kv.Do(ctx, RangeRequestToOp(r))
+	resp, err := p.rangeAtLeast(ctx, r, minRev)
 	if err != nil {
 		return nil, err
 	}
@@ -68,6 +149,10 @@ func (p *kvProxy) Put(ctx context.Context, r *pb.PutRequest) (*pb.PutResponse, e
 	p.cache.Invalidate([]byte(r.Key), nil)
 
 	resp, err := p.kv.Do(ctx, PutRequestToOp(r))
+	p.invalidatePeers(r.Key, "")
+	if err == nil {
+		p.observeWrite(ctx, resp.Put().Header)
+	}
 	return (*pb.PutResponse)(resp.Put()), err
 }
 
@@ -75,18 +160,25 @@ func (p *kvProxy) DeleteRange(ctx context.Context, r *pb.DeleteRangeRequest) (*p
 	p.cache.Invalidate([]byte(r.Key), []byte(r.RangeEnd))
 
 	resp, err := p.kv.Do(ctx, DelRequestToOp(r))
+	p.invalidatePeers(r.Key, r.RangeEnd)
+	if err == nil {
+		p.observeWrite(ctx, resp.Del().Header)
+	}
 	return (*pb.DeleteRangeResponse)(resp.Del()), err
 }
 
 func (p *kvProxy) txnToCache(reqs []*pb.RequestOp, resps []*pb.ResponseOp) {
 	for i := range resps {
 		if resps[i].ResponseOp_ResponsePut != nil {
-			p.cache.Invalidate([]byte(reqs[i].GetRequestPut().Key), nil)
+			key := reqs[i].GetRequestPut().Key
+			p.cache.Invalidate([]byte(key), nil)
+			p.invalidatePeers(key, "")
 		}
 
 		if resps[i].ResponseOp_ResponseDeleteRange != nil {
 			rdr := reqs[i].GetRequestDeleteRange()
 			p.cache.Invalidate([]byte(rdr.Key), []byte(rdr.RangeEnd))
+			p.invalidatePeers(rdr.Key, rdr.RangeEnd)
 		}
 		if resps[i].ResponseOp_ResponseRange != nil {
 			tv := resps[i].ResponseOp_ResponseRange
@@ -105,10 +197,12 @@ func (p *kvProxy) Txn(ctx context.Context, r *pb.TxnRequest) (*pb.TxnResponse, e
 		return nil, err
 	}
 	resp := opResp.Txn()
+	p.observeWrite(ctx, resp.Header)
 
 	// txn may claim an outdated key is updated; be safe and invalidate
 	for _, cmp := range r.Compare {
 		p.cache.Invalidate([]byte(cmp.Key), []byte(cmp.RangeEnd))
+		p.invalidatePeers(cmp.Key, cmp.RangeEnd)
 	}
 	// update any fetched keys
 	if resp.Succeeded {
@@ -120,6 +214,13 @@ func (p *kvProxy) Txn(ctx context.Context, r *pb.TxnRequest) (*pb.TxnResponse, e
 	return (*pb.TxnResponse)(resp), nil
 }
 
+// invalidatePeers drops cached ranges overlapping [key, end) on every peer proxy.
+func (p *kvProxy) invalidatePeers(key, end string) {
+	if p.peers != nil {
+		p.peers.invalidate(key, end)
+	}
+}
+
 func (p *kvProxy) Compact(ctx context.Context, r *pb.CompactionRequest) (*pb.CompactionResponse, error) {
 	var opts []clientv3.CompactOption
 	if r.Physical {
@@ -134,6 +235,76 @@ func (p *kvProxy) Compact(ctx context.Context, r *pb.CompactionRequest) (*pb.Com
 	return (*pb.CompactionResponse)(resp), err
 }
 
+// stagedRangesTTL 超过这么久没有追加的暂存事务不再记录,服务端也已经让它过期
+const stagedRangesTTL = 10 * time.Minute
+
+type stagedRanges struct {
+	ranges [][2]string
+	last   time.Time
+}
+
+// StagedTxn 转发暂存事务;追加时记录写入的范围,提交成功后失效这些范围的缓存
+func (p *kvProxy) StagedTxn(ctx context.Context, r *pb.StagedTxnRequest) (*pb.StagedTxnResponse, error) {
+	resp, err := p.remote.StagedTxn(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	p.stagedMu.Lock()
+	defer p.stagedMu.Unlock()
+	switch r.Action {
+	case pb.StagedTxnRequest_APPEND:
+		now := time.Now()
+		for id, sr := range p.staged {
+			if now.Sub(sr.last) > stagedRangesTTL {
+				delete(p.staged, id)
+			}
+		}
+		sr, ok := p.staged[resp.StageId]
+		if !ok {
+			sr = &stagedRanges{}
+			p.staged[resp.StageId] = sr
+		}
+		sr.last = now
+		for _, cmp := range r.Compare {
+			sr.ranges = append(sr.ranges, [2]string{cmp.Key, cmp.RangeEnd})
+		}
+		sr.ranges = appendWriteRanges(sr.ranges, r.Success)
+		sr.ranges = appendWriteRanges(sr.ranges, r.Failure)
+	case pb.StagedTxnRequest_COMMIT:
+		if sr, ok := p.staged[r.StageId]; ok {
+			for _, rg := range sr.ranges {
+				p.cache.Invalidate([]byte(rg[0]), []byte(rg[1]))
+				p.invalidatePeers(rg[0], rg[1])
+			}
+		}
+		delete(p.staged, r.StageId)
+		if resp.Txn != nil {
+			p.observeWrite(ctx, resp.Txn.Header)
+		}
+	case pb.StagedTxnRequest_ABORT:
+		delete(p.staged, r.StageId)
+	}
+	return resp, nil
+}
+
+// appendWriteRanges 收集ops(包括嵌套事务)中put和delete的范围
+func appendWriteRanges(ranges [][2]string, ops []*pb.RequestOp) [][2]string {
+	for _, op := range ops {
+		switch {
+		case op.GetRequestPut() != nil:
+			ranges = append(ranges, [2]string{op.GetRequestPut().Key, ""})
+		case op.GetRequestDeleteRange() != nil:
+			rdr := op.GetRequestDeleteRange()
+			ranges = append(ranges, [2]string{rdr.Key, rdr.RangeEnd})
+		case op.GetRequestTxn() != nil:
+			ranges = appendWriteRanges(ranges, op.GetRequestTxn().Success)
+			ranges = appendWriteRanges(ranges, op.GetRequestTxn().Failure)
+		}
+	}
+	return ranges
+}
+
 func requestOpToOp(union *pb.RequestOp) clientv3.Op {
 	if union.RequestOp_RequestRange != nil {
 		tv := union.RequestOp_RequestRange
@@ -203,6 +374,9 @@ func PutRequestToOp(r *pb.PutRequest) clientv3.Op {
 	if r.PrevKv {
 		opts = append(opts, clientv3.WithPrevKV())
 	}
+	if r.IdempotencyToken != "" {
+		opts = append(opts, clientv3.WithIdempotencyToken(r.IdempotencyToken))
+	}
 	return clientv3.OpPut(string(r.Key), string(r.Value), opts...)
 }
 
@@ -230,5 +404,9 @@ func TxnRequestToOp(r *pb.TxnRequest) clientv3.Op {
 	for i := range r.Failure {
 		elseops[i] = requestOpToOp(r.Failure[i])
 	}
-	return clientv3.OpTxn(cmps, thenops, elseops)
+	op := clientv3.OpTxn(cmps, thenops, elseops)
+	if r.IdempotencyToken != "" {
+		clientv3.WithIdempotencyToken(r.IdempotencyToken)(&op)
+	}
+	return op
 }
@@ -0,0 +1,261 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcproxy
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	clientv3 "github.com/ls-2018/etcd_cn/client_sdk/v3"
+	"github.com/ls-2018/etcd_cn/client_sdk/v3/naming/endpoints"
+	"github.com/ls-2018/etcd_cn/etcd/proxy/grpcproxy/cache"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// metadataForwarded marks a range forwarded by a peer proxy; it is served locally.
+	metadataForwarded = "grpcproxy-forwarded"
+	// metadataInvalidate marks a range carrying a cache invalidation from a peer proxy.
+	metadataInvalidate = "grpcproxy-invalidate"
+	// metadataMinRevision carries the oldest revision a forwarded range may be served at.
+	metadataMinRevision = "grpcproxy-min-revision"
+
+	defaultPeerForwardTimeout = time.Second
+)
+
+// PeerCacheConfig configures a cache shared by grpc-proxy replicas.
+type PeerCacheConfig struct {
+	// Self is the advertised client URL of this proxy, as registered under Prefix.
+	Self string
+	// Prefix is the resolver prefix the proxies register themselves under.
+	Prefix string
+	// VirtualNodes is the number of ring points per proxy; defaults to cache.DefaultVirtualNodes.
+	VirtualNodes int
+	// ForwardTimeout bounds forwarded reads and invalidations; defaults to one second.
+	ForwardTimeout time.Duration
+	// DialOptions are used to connect to peer proxies.
+	DialOptions []grpc.DialOption
+}
+
+// peerCache partitions cacheable serializable reads among proxy replicas.
+type peerCache struct {
+	lg   *zap.Logger
+	ctx  context.Context
+	cfg  PeerCacheConfig
+	ring *cache.Ring
+
+	mu    sync.Mutex
+	peers map[string]string // endpoint key -> addr
+	conns map[string]*grpc.ClientConn
+}
+
+// NewKvProxyWithPeers is like NewKvProxy, but partitions the serializable read
+// cache among the proxies registered under cfg.Prefix by consistent hashing.
+// Reads for keys owned by another proxy are forwarded to it and writes are
+// broadcast to every peer for invalidation. The returned channel is closed
+// once the client's context is canceled and the peer watch has stopped.
+func NewKvProxyWithPeers(lg *zap.Logger, c *clientv3.Client, cfg PeerCacheConfig) (pb.KVServer, <-chan struct{}) {
+	return NewKvProxyWithConfig(lg, c, KvProxyConfig{Peers: &cfg})
+}
+
+// newPeerCache starts watching the peer proxies; it returns nil if cfg is incomplete.
+func newPeerCache(lg *zap.Logger, c *clientv3.Client, cfg PeerCacheConfig) (*peerCache, <-chan struct{}) {
+	if cfg.Self == "" || cfg.Prefix == "" {
+		return nil, nil
+	}
+	em, err := endpoints.NewManager(c, cfg.Prefix)
+	if err != nil {
+		lg.Error("failed to provision endpointsManager", zap.String("prefix", cfg.Prefix), zap.Error(err))
+		return nil, nil
+	}
+	if cfg.ForwardTimeout <= 0 {
+		cfg.ForwardTimeout = defaultPeerForwardTimeout
+	}
+
+	pc := &peerCache{
+		lg:    lg,
+		ctx:   c.Ctx(),
+		cfg:   cfg,
+		ring:  cache.NewRing(cfg.VirtualNodes),
+		peers: make(map[string]string),
+		conns: make(map[string]*grpc.ClientConn),
+	}
+	pc.ring.Set([]string{cfg.Self})
+
+	donec := make(chan struct{})
+	go func() {
+		defer close(donec)
+		defer pc.close()
+		pc.establishEndpointWatch(em)
+	}()
+	return pc, donec
+}
+
+func (pc *peerCache) establishEndpointWatch(em endpoints.Manager) {
+	rm := rate.NewLimiter(rate.Limit(resolveRetryRate), resolveRetryRate)
+	for rm.Wait(pc.ctx) == nil {
+		wc, err := em.NewWatchChannel(pc.ctx)
+		if err != nil {
+			pc.lg.Warn("failed to establish peer proxy watch", zap.String("prefix", pc.cfg.Prefix), zap.Error(err))
+			continue
+		}
+		pc.monitor(wc)
+	}
+}
+
+func (pc *peerCache) monitor(wc endpoints.WatchChannel) {
+	for {
+		select {
+		case <-pc.ctx.Done():
+			return
+		case updates, ok := <-wc:
+			if !ok {
+				return
+			}
+			pc.mu.Lock()
+			for _, up := range updates {
+				switch up.Op {
+				case endpoints.Add:
+					pc.peers[up.Key] = up.Endpoint.Addr
+				case endpoints.Delete:
+					delete(pc.peers, up.Key)
+				}
+			}
+			members := []string{pc.cfg.Self}
+			live := make(map[string]struct{}, len(pc.peers))
+			for _, addr := range pc.peers {
+				members = append(members, addr)
+				live[addr] = struct{}{}
+			}
+			for addr, conn := range pc.conns {
+				if _, ok := live[addr]; !ok {
+					conn.Close()
+					delete(pc.conns, addr)
+				}
+			}
+			pc.mu.Unlock()
+			pc.ring.Set(members)
+			pc.lg.Info("peer proxies updated", zap.Strings("members", pc.ring.Members()))
+		}
+	}
+}
+
+// owner returns the address of the peer owning key, or "" if it is owned by this proxy.
+func (pc *peerCache) owner(key string) string {
+	if o := pc.ring.Get(key); o != pc.cfg.Self {
+		return o
+	}
+	return ""
+}
+
+func (pc *peerCache) client(addr string) (pb.KVClient, error) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if conn, ok := pc.conns[addr]; ok {
+		return pb.NewKVClient(conn), nil
+	}
+	conn, err := grpc.DialContext(pc.ctx, dialTarget(addr), pc.cfg.DialOptions...)
+	if err != nil {
+		return nil, err
+	}
+	pc.conns[addr] = conn
+	return pb.NewKVClient(conn), nil
+}
+
+// forward serves r from the peer owning its key.
+// A positive minRev asks the peer to serve a response no older than that revision.
+func (pc *peerCache) forward(ctx context.Context, addr string, r *pb.RangeRequest, minRev int64) (*pb.RangeResponse, error) {
+	kc, err := pc.client(addr)
+	if err != nil {
+		return nil, err
+	}
+	fctx, cancel := context.WithTimeout(ctx, pc.cfg.ForwardTimeout)
+	defer cancel()
+	fctx = metadata.AppendToOutgoingContext(fctx, metadataForwarded, pc.cfg.Self)
+	if minRev > 0 {
+		fctx = metadata.AppendToOutgoingContext(fctx, metadataMinRevision, strconv.FormatInt(minRev, 10))
+	}
+	return kc.Range(fctx, r)
+}
+
+// invalidate asks every peer to drop cached ranges overlapping [key, end).
+func (pc *peerCache) invalidate(key, end string) {
+	pc.mu.Lock()
+	addrs := make([]string, 0, len(pc.peers))
+	for _, addr := range pc.peers {
+		if addr != pc.cfg.Self {
+			addrs = append(addrs, addr)
+		}
+	}
+	pc.mu.Unlock()
+	if len(addrs) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(pc.ctx, pc.cfg.ForwardTimeout)
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, metadataInvalidate, pc.cfg.Self)
+	var wg sync.WaitGroup
+	for _, addr := range addrs {
+		kc, err := pc.client(addr)
+		if err != nil {
+			pc.lg.Warn("failed to dial peer proxy", zap.String("peer", addr), zap.Error(err))
+			continue
+		}
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			if _, err := kc.Range(ctx, &pb.RangeRequest{Key: key, RangeEnd: end}); err != nil {
+				pc.lg.Warn("failed to invalidate peer proxy cache", zap.String("peer", addr), zap.Error(err))
+			}
+		}(addr)
+	}
+	// 等待失效广播完成后再返回写结果,保证读己之写
+	wg.Wait()
+}
+
+func (pc *peerCache) close() {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	for addr, conn := range pc.conns {
+		conn.Close()
+		delete(pc.conns, addr)
+	}
+}
+
+// fromPeer reports whether the request was sent by a peer proxy with the given marker.
+func fromPeer(ctx context.Context, key string) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	return ok && len(md.Get(key)) > 0
+}
+
+// dialTarget strips the scheme from an advertised client URL.
+func dialTarget(addr string) string {
+	if strings.Contains(addr, "://") {
+		if u, err := url.Parse(addr); err == nil {
+			return u.Host
+		}
+	}
+	return addr
+}
@@ -0,0 +1,143 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcproxy
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	clientv3 "github.com/ls-2018/etcd_cn/client_sdk/v3"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	defaultReadYourWritesWait       = 100 * time.Millisecond
+	defaultReadYourWritesSessionTTL = time.Minute
+
+	// rywRetryInterval 是等待成员追上写入版本时的重试间隔
+	rywRetryInterval = 10 * time.Millisecond
+)
+
+// writeTracker remembers the revision of the last write of each client.
+type writeTracker struct {
+	ttl time.Duration
+
+	mu        sync.Mutex
+	writes    map[string]trackedWrite
+	lastPrune time.Time
+}
+
+type trackedWrite struct {
+	rev int64
+	at  time.Time
+}
+
+func newWriteTracker(ttl time.Duration) *writeTracker {
+	return &writeTracker{ttl: ttl, writes: make(map[string]trackedWrite), lastPrune: time.Now()}
+}
+
+func (t *writeTracker) observe(client string, rev int64) {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if w, ok := t.writes[client]; !ok || w.rev < rev {
+		t.writes[client] = trackedWrite{rev: rev, at: now}
+	}
+	if now.Sub(t.lastPrune) > t.ttl {
+		for c, w := range t.writes {
+			if now.Sub(w.at) > t.ttl {
+				delete(t.writes, c)
+			}
+		}
+		t.lastPrune = now
+	}
+}
+
+// last returns the revision of the client's last write, or 0 if it expired.
+func (t *writeTracker) last(client string) int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	w, ok := t.writes[client]
+	if !ok || time.Since(w.at) > t.ttl {
+		return 0
+	}
+	return w.rev
+}
+
+// observeWrite records a write of the client sending the request.
+func (p *kvProxy) observeWrite(ctx context.Context, h *pb.ResponseHeader) {
+	if p.writes == nil || h == nil {
+		return
+	}
+	p.writes.observe(clientAddr(ctx), h.Revision)
+}
+
+// minRevision returns the oldest revision a serializable range may be served
+// at to observe the client's own writes; 0 means any revision.
+func (p *kvProxy) minRevision(ctx context.Context, r *pb.RangeRequest) int64 {
+	if !r.Serializable || r.Revision > 0 {
+		return 0
+	}
+	var rev int64
+	if p.writes != nil {
+		rev = p.writes.last(clientAddr(ctx))
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, v := range md.Get(metadataMinRevision) {
+			if mr, err := strconv.ParseInt(v, 10, 64); err == nil && mr > rev {
+				rev = mr
+			}
+		}
+	}
+	return rev
+}
+
+// rangeAtLeast serves r from etcd at a revision no older than minRev. The
+// serializable read is retried until the member catches up and falls back to
+// a linearizable read once the read-your-writes wait is exhausted.
+func (p *kvProxy) rangeAtLeast(ctx context.Context, r *pb.RangeRequest, minRev int64) (clientv3.OpResponse, error) {
+	resp, err := p.kv.Do(ctx, RangeRequestToOp(r))
+	if err != nil || minRev <= 0 {
+		return resp, err
+	}
+	deadline := time.Now().Add(p.rywWait)
+	for headerRevision(resp.Get().Header) < minRev {
+		if time.Now().After(deadline) {
+			lr := *r
+			lr.Serializable = false
+			return p.kv.Do(ctx, RangeRequestToOp(&lr))
+		}
+		select {
+		case <-time.After(rywRetryInterval):
+		case <-ctx.Done():
+			return resp, ctx.Err()
+		}
+		if resp, err = p.kv.Do(ctx, RangeRequestToOp(r)); err != nil {
+			return resp, err
+		}
+	}
+	return resp, nil
+}
+
+func headerRevision(h *pb.ResponseHeader) int64 {
+	if h == nil {
+		return 0
+	}
+	return h.Revision
+}
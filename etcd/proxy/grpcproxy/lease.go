@@ -37,6 +37,9 @@ type leaseProxy struct {
 
 	lessor clientv3.Lease
 
+	// hub multiplexes keepalives of the same lease from all client streams.
+	hub *keepAliveHub
+
 	ctx context.Context
 
 	leader *leader
@@ -48,17 +51,39 @@ type leaseProxy struct {
 	wg sync.WaitGroup
 }
 
+// LeaseProxyConfig tunes the lease proxy.
+type LeaseProxyConfig struct {
+	// KeepAliveStreams is the number of upstream keepalive streams the
+	// leases of all proxied clients are spread over; defaults to 1.
+	KeepAliveStreams int
+}
+
 func NewLeaseProxy(ctx context.Context, c *clientv3.Client) (pb.LeaseServer, <-chan struct{}) {
+	return NewLeaseProxyWithConfig(ctx, c, LeaseProxyConfig{})
+}
+
+// NewLeaseProxyWithConfig is like NewLeaseProxy, with the upstream keepalive streams set by cfg.
+func NewLeaseProxyWithConfig(ctx context.Context, c *clientv3.Client, cfg LeaseProxyConfig) (pb.LeaseServer, <-chan struct{}) {
 	cctx, cancel := context.WithCancel(ctx)
+	lessors := []clientv3.Lease{c.Lease}
+	for i := 1; i < cfg.KeepAliveStreams; i++ {
+		lessors = append(lessors, clientv3.NewLease(c))
+	}
 	lp := &leaseProxy{
 		leaseClient: pb.NewLeaseClient(c.ActiveConnection()),
 		lessor:      c.Lease,
+		hub:         newKeepAliveHub(cctx, lessors),
 		ctx:         cctx,
 		leader:      newLeader(cctx, c.Watcher),
 	}
 	ch := make(chan struct{})
 	go func() {
 		defer close(ch)
+		defer func() {
+			for _, l := range lessors[1:] {
+				l.Close()
+			}
+		}()
 		<-lp.leader.stopNotify()
 		lp.mu.Lock()
 		select {
@@ -130,6 +155,31 @@ func (lp *leaseProxy) LeaseLeases(ctx context.Context, rr *pb.LeaseLeasesRequest
 	return rp, err
 }
 
+func (lp *leaseProxy) LeaseWatch(rr *pb.LeaseWatchRequest, stream pb.Lease_LeaseWatchServer) error {
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+
+	ctx = withClientAuthToken(ctx, stream.Context())
+
+	wc, err := lp.leaseClient.LeaseWatch(ctx, rr)
+	if err != nil {
+		return err
+	}
+
+	for {
+		resp, err := wc.Recv()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if err = stream.Send(resp); err != nil {
+			return err
+		}
+	}
+}
+
 func (lp *leaseProxy) LeaseKeepAlive(stream pb.Lease_LeaseKeepAliveServer) error {
 	lp.mu.Lock()
 	select {
@@ -145,6 +195,7 @@ func (lp *leaseProxy) LeaseKeepAlive(stream pb.Lease_LeaseKeepAliveServer) error
 	lps := leaseProxyStream{
 		stream:          stream,
 		lessor:          lp.lessor,
+		hub:             lp.hub,
 		keepAliveLeases: make(map[int64]*atomicCounter),
 		respc:           make(chan *pb.LeaseKeepAliveResponse),
 		ctx:             ctx,
@@ -229,6 +280,7 @@ type leaseProxyStream struct {
 	stream pb.Lease_LeaseKeepAliveServer
 
 	lessor clientv3.Lease
+	hub    *keepAliveHub
 	// wg tracks keepAliveLoop goroutines
 	wg sync.WaitGroup
 	// mu protects keepAliveLeases
@@ -251,35 +303,49 @@ func (lps *leaseProxyStream) recvLoop() error {
 		if err != nil {
 			return err
 		}
-		lps.mu.Lock()
-		neededResps, ok := lps.keepAliveLeases[rr.ID]
-		if !ok {
-			neededResps = &atomicCounter{}
-			lps.keepAliveLeases[rr.ID] = neededResps
-			lps.wg.Add(1)
-			go func() {
-				defer lps.wg.Done()
-				if err := lps.keepAliveLoop(rr.ID, neededResps); err != nil {
-					lps.cancel()
-				}
-			}()
+		if len(rr.IDs) == 0 {
+			lps.keepAlive(rr.ID)
+			continue
+		}
+		// 批量续约拆成单个租约续约,结果按租约逐条返回
+		for _, id := range rr.IDs {
+			lps.keepAlive(id)
 		}
-		neededResps.add(1)
-		lps.mu.Unlock()
 	}
 }
 
+func (lps *leaseProxyStream) keepAlive(leaseID int64) {
+	lps.mu.Lock()
+	defer lps.mu.Unlock()
+	neededResps, ok := lps.keepAliveLeases[leaseID]
+	if !ok {
+		neededResps = &atomicCounter{}
+		lps.keepAliveLeases[leaseID] = neededResps
+		lps.wg.Add(1)
+		go func() {
+			defer lps.wg.Done()
+			if err := lps.keepAliveLoop(leaseID, neededResps); err != nil {
+				lps.cancel()
+			}
+		}()
+	}
+	neededResps.add(1)
+}
+
 func (lps *leaseProxyStream) keepAliveLoop(leaseID int64, neededResps *atomicCounter) error {
 	cctx, ccancel := context.WithCancel(lps.ctx)
 	defer ccancel()
-	respc, err := lps.lessor.KeepAlive(cctx, clientv3.LeaseID(leaseID))
+	respc, unsubscribe, err := lps.hub.subscribe(leaseID)
 	if err != nil {
 		return err
 	}
+	defer unsubscribe()
 	// ticker expires when loop hasn't received keepalive within TTL
 	var ticker <-chan time.Time
 	for {
 		select {
+		case <-lps.ctx.Done():
+			return nil
 		case <-ticker:
 			lps.mu.Lock()
 			// if there are outstanding keepAlive reqs at the moment of ticker firing,
@@ -324,9 +390,10 @@ func (lps *leaseProxyStream) keepAliveLoop(leaseID int64, neededResps *atomicCou
 			}
 			ticker = time.After(time.Duration(rp.TTL) * time.Second)
 			r := &pb.LeaseKeepAliveResponse{
-				Header: rp.ResponseHeader,
-				ID:     int64(rp.ID),
-				TTL:    rp.TTL,
+				Header:          rp.ResponseHeader,
+				ID:              int64(rp.ID),
+				TTL:             rp.TTL,
+				NextKeepAliveMs: rp.NextKeepAlive.Milliseconds(),
 			}
 			lps.replyToClient(r, neededResps)
 		}
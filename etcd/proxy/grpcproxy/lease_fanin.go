@@ -0,0 +1,121 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcproxy
+
+import (
+	"context"
+	"sync"
+
+	clientv3 "github.com/ls-2018/etcd_cn/client_sdk/v3"
+)
+
+// keepAliveHub fans the keepalive requests for a lease from all proxied
+// client streams into a single upstream keepalive. Leases are spread over
+// a fixed set of lessors, each holding one upstream keepalive stream.
+type keepAliveHub struct {
+	ctx     context.Context
+	lessors []clientv3.Lease
+
+	mu     sync.Mutex
+	leases map[int64]*keepAliveFanIn
+}
+
+// keepAliveFanIn is the upstream keepalive of a lease and its subscribers.
+type keepAliveFanIn struct {
+	cancel context.CancelFunc
+	subs   map[chan *clientv3.LeaseKeepAliveResponse]struct{}
+}
+
+func newKeepAliveHub(ctx context.Context, lessors []clientv3.Lease) *keepAliveHub {
+	return &keepAliveHub{
+		ctx:     ctx,
+		lessors: lessors,
+		leases:  make(map[int64]*keepAliveFanIn),
+	}
+}
+
+func (h *keepAliveHub) lessor(id int64) clientv3.Lease {
+	if id < 0 {
+		id = -id
+	}
+	return h.lessors[id%int64(len(h.lessors))]
+}
+
+// subscribe returns a channel receiving the upstream keepalive responses of
+// the lease; it is closed once the upstream keepalive stops. The returned
+// function must be called to release the subscription.
+func (h *keepAliveHub) subscribe(id int64) (<-chan *clientv3.LeaseKeepAliveResponse, func(), error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fi, ok := h.leases[id]
+	if !ok {
+		ctx, cancel := context.WithCancel(h.ctx)
+		respc, err := h.lessor(id).KeepAlive(ctx, clientv3.LeaseID(id))
+		if err != nil {
+			cancel()
+			return nil, nil, err
+		}
+		fi = &keepAliveFanIn{cancel: cancel, subs: make(map[chan *clientv3.LeaseKeepAliveResponse]struct{})}
+		h.leases[id] = fi
+		go h.fanOut(id, fi, respc)
+	}
+
+	ch := make(chan *clientv3.LeaseKeepAliveResponse, 1)
+	fi.subs[ch] = struct{}{}
+	var once sync.Once
+	unsubscribe := func() { once.Do(func() { h.unsubscribe(id, fi, ch) }) }
+	return ch, unsubscribe, nil
+}
+
+func (h *keepAliveHub) unsubscribe(id int64, fi *keepAliveFanIn, ch chan *clientv3.LeaseKeepAliveResponse) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := fi.subs[ch]; !ok {
+		// 上游已停止,订阅已被关闭
+		return
+	}
+	delete(fi.subs, ch)
+	if len(fi.subs) == 0 && h.leases[id] == fi {
+		delete(h.leases, id)
+		fi.cancel()
+	}
+}
+
+func (h *keepAliveHub) fanOut(id int64, fi *keepAliveFanIn, respc <-chan *clientv3.LeaseKeepAliveResponse) {
+	for resp := range respc {
+		h.mu.Lock()
+		for ch := range fi.subs {
+			// 只保留最新的响应,不阻塞慢的订阅者
+			select {
+			case <-ch:
+			default:
+			}
+			ch <- resp
+		}
+		h.mu.Unlock()
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.leases[id] == fi {
+		delete(h.leases, id)
+	}
+	fi.cancel()
+	for ch := range fi.subs {
+		close(ch)
+		delete(fi.subs, ch)
+	}
+}
@@ -65,6 +65,33 @@ func (mp *maintenanceProxy) Snapshot(sr *pb.SnapshotRequest, stream pb.Maintenan
 	}
 }
 
+func (mp *maintenanceProxy) Profile(pr *pb.ProfileRequest, stream pb.Maintenance_ProfileServer) error {
+	conn := mp.client.ActiveConnection()
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+
+	ctx = withClientAuthToken(ctx, stream.Context())
+
+	pc, err := pb.NewMaintenanceClient(conn).Profile(ctx, pr)
+	if err != nil {
+		return err
+	}
+
+	for {
+		rr, err := pc.Recv()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		err = stream.Send(rr)
+		if err != nil {
+			return err
+		}
+	}
+}
+
 func (mp *maintenanceProxy) Hash(ctx context.Context, r *pb.HashRequest) (*pb.HashResponse, error) {
 	conn := mp.client.ActiveConnection()
 	return pb.NewMaintenanceClient(conn).Hash(ctx, r)
@@ -94,3 +121,48 @@ func (mp *maintenanceProxy) Downgrade(ctx context.Context, r *pb.DowngradeReques
 	conn := mp.client.ActiveConnection()
 	return pb.NewMaintenanceClient(conn).Downgrade(ctx, r)
 }
+
+func (mp *maintenanceProxy) ReloadCerts(ctx context.Context, r *pb.ReloadCertsRequest) (*pb.ReloadCertsResponse, error) {
+	conn := mp.client.ActiveConnection()
+	return pb.NewMaintenanceClient(conn).ReloadCerts(ctx, r)
+}
+
+func (mp *maintenanceProxy) MaintenanceMode(ctx context.Context, r *pb.MaintenanceModeRequest) (*pb.MaintenanceModeResponse, error) {
+	conn := mp.client.ActiveConnection()
+	return pb.NewMaintenanceClient(conn).MaintenanceMode(ctx, r)
+}
+
+func (mp *maintenanceProxy) LogLevel(ctx context.Context, r *pb.LogLevelRequest) (*pb.LogLevelResponse, error) {
+	conn := mp.client.ActiveConnection()
+	return pb.NewMaintenanceClient(conn).LogLevel(ctx, r)
+}
+
+func (mp *maintenanceProxy) Failpoint(ctx context.Context, r *pb.FailpointRequest) (*pb.FailpointResponse, error) {
+	conn := mp.client.ActiveConnection()
+	return pb.NewMaintenanceClient(conn).Failpoint(ctx, r)
+}
+
+func (mp *maintenanceProxy) PeerStats(ctx context.Context, r *pb.PeerStatsRequest) (*pb.PeerStatsResponse, error) {
+	conn := mp.client.ActiveConnection()
+	return pb.NewMaintenanceClient(conn).PeerStats(ctx, r)
+}
+
+func (mp *maintenanceProxy) CompactionHold(ctx context.Context, r *pb.CompactionHoldRequest) (*pb.CompactionHoldResponse, error) {
+	conn := mp.client.ActiveConnection()
+	return pb.NewMaintenanceClient(conn).CompactionHold(ctx, r)
+}
+
+func (mp *maintenanceProxy) UserUsage(ctx context.Context, r *pb.UserUsageRequest) (*pb.UserUsageResponse, error) {
+	conn := mp.client.ActiveConnection()
+	return pb.NewMaintenanceClient(conn).UserUsage(ctx, r)
+}
+
+func (mp *maintenanceProxy) SnapshotSession(ctx context.Context, r *pb.SnapshotSessionRequest) (*pb.SnapshotSessionResponse, error) {
+	conn := mp.client.ActiveConnection()
+	return pb.NewMaintenanceClient(conn).SnapshotSession(ctx, r)
+}
+
+func (mp *maintenanceProxy) PromoteReplica(ctx context.Context, r *pb.PromoteReplicaRequest) (*pb.PromoteReplicaResponse, error) {
+	conn := mp.client.ActiveConnection()
+	return pb.NewMaintenanceClient(conn).PromoteReplica(ctx, r)
+}
@@ -0,0 +1,86 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcproxy
+
+import (
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// watcherCount 和 watchGroupCount 用于计算去重比例
+	watcherCount    int64
+	watchGroupCount int64
+
+	watchersCoalescing = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "etcd",
+		Subsystem: "grpc_proxy",
+		Name:      "watchers_coalescing_total",
+		Help:      "Total number of current watchers coalescing",
+	})
+	eventsCoalescing = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "etcd",
+		Subsystem: "grpc_proxy",
+		Name:      "events_coalescing_total",
+		Help:      "Total number of events coalescing",
+	})
+	watchers = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "etcd",
+		Subsystem: "grpc_proxy",
+		Name:      "watchers",
+		Help:      "Number of client watchers served by the proxy.",
+	}, func() float64 { return float64(atomic.LoadInt64(&watcherCount)) })
+	watchGroups = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "etcd",
+		Subsystem: "grpc_proxy",
+		Name:      "watch_broadcast_groups",
+		Help:      "Number of etcd watchers shared by the proxy's client watchers.",
+	}, func() float64 { return float64(atomic.LoadInt64(&watchGroupCount)) })
+	watchDedupRatio = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "etcd",
+		Subsystem: "grpc_proxy",
+		Name:      "watch_dedup_ratio",
+		Help:      "Client watchers per etcd watcher; 1 means no coalescing.",
+	}, func() float64 {
+		groups := atomic.LoadInt64(&watchGroupCount)
+		if groups == 0 {
+			return 0
+		}
+		return float64(atomic.LoadInt64(&watcherCount)) / float64(groups)
+	})
+	watchSlowClientsDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "etcd",
+		Subsystem: "grpc_proxy",
+		Name:      "watch_slow_clients_dropped_total",
+		Help:      "Total number of watch streams closed because the client could not keep up.",
+	})
+	watchLimitRejected = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "etcd",
+		Subsystem: "grpc_proxy",
+		Name:      "watch_limit_rejected_total",
+		Help:      "Total number of watch creations rejected by the per-client watcher limit.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(watchersCoalescing)
+	prometheus.MustRegister(eventsCoalescing)
+	prometheus.MustRegister(watchers)
+	prometheus.MustRegister(watchGroups)
+	prometheus.MustRegister(watchDedupRatio)
+	prometheus.MustRegister(watchSlowClientsDropped)
+	prometheus.MustRegister(watchLimitRejected)
+}
@@ -16,6 +16,7 @@ package grpcproxy
 
 import (
 	"context"
+	"errors"
 	"sync"
 
 	clientv3 "github.com/ls-2018/etcd_cn/client_sdk/v3"
@@ -27,9 +28,12 @@ import (
 	"go.uber.org/zap"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 )
 
+var errTooManyWatchers = errors.New("grpcproxy: too many watchers for client")
+
 type watchProxy struct {
 	cw  clientv3.Watcher
 	ctx context.Context
@@ -47,9 +51,32 @@ type watchProxy struct {
 	// kv is used for permission checking
 	kv clientv3.KV
 	lg *zap.Logger
+
+	cfg WatchProxyConfig
+
+	// cmu protects clients.
+	cmu sync.Mutex
+	// clients counts the watchers held by each client address.
+	clients map[string]int
+}
+
+// WatchProxyConfig tunes how the watch proxy shares etcd watchers.
+type WatchProxyConfig struct {
+	// MaxWatchersPerClient limits the watchers a single client address may
+	// hold across its watch streams; 0 means unlimited.
+	MaxWatchersPerClient int
+	// CoalesceLimit is the number of receivers from which a broadcast is no
+	// longer merged into another one over the same range. 0 uses the default;
+	// a negative value always coalesces.
+	CoalesceLimit int
 }
 
 func NewWatchProxy(ctx context.Context, lg *zap.Logger, c *clientv3.Client) (pb.WatchServer, <-chan struct{}) {
+	return NewWatchProxyWithConfig(ctx, lg, c, WatchProxyConfig{})
+}
+
+// NewWatchProxyWithConfig is like NewWatchProxy, with coalescing and per-client limits set by cfg.
+func NewWatchProxyWithConfig(ctx context.Context, lg *zap.Logger, c *clientv3.Client, cfg WatchProxyConfig) (pb.WatchServer, <-chan struct{}) {
 	cctx, cancel := context.WithCancel(ctx)
 	wp := &watchProxy{
 		cw:     c.Watcher,
@@ -58,6 +85,9 @@ func NewWatchProxy(ctx context.Context, lg *zap.Logger, c *clientv3.Client) (pb.
 
 		kv: c.KV, // for permission checking
 		lg: lg,
+
+		cfg:     cfg,
+		clients: make(map[string]int),
 	}
 	wp.ranges = newWatchRanges(wp)
 	ch := make(chan struct{})
@@ -96,6 +126,8 @@ func (wp *watchProxy) Watch(stream pb.Watch_WatchServer) (err error) {
 
 	ctx, cancel := context.WithCancel(stream.Context())
 	wps := &watchProxyStream{
+		wp:       wp,
+		client:   clientAddr(stream.Context()),
 		ranges:   wp.ranges,
 		watchers: make(map[int64]*watcher),
 		stream:   stream,
@@ -165,8 +197,46 @@ func (wp *watchProxy) Watch(stream pb.Watch_WatchServer) (err error) {
 	}
 }
 
+func (wp *watchProxy) coalesceLimit() int {
+	if wp.cfg.CoalesceLimit == 0 {
+		return defaultCoalesceLimit
+	}
+	return wp.cfg.CoalesceLimit
+}
+
+// acquireWatcher reserves a watcher for client, failing when its limit is reached.
+func (wp *watchProxy) acquireWatcher(client string) bool {
+	wp.cmu.Lock()
+	defer wp.cmu.Unlock()
+	if max := wp.cfg.MaxWatchersPerClient; max > 0 && wp.clients[client] >= max {
+		return false
+	}
+	wp.clients[client]++
+	return true
+}
+
+func (wp *watchProxy) releaseWatcher(client string, n int) {
+	wp.cmu.Lock()
+	defer wp.cmu.Unlock()
+	if wp.clients[client] -= n; wp.clients[client] <= 0 {
+		delete(wp.clients, client)
+	}
+}
+
+// clientAddr identifies the client of a stream by its remote address.
+func clientAddr(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return p.Addr.String()
+	}
+	return ""
+}
+
 // watchProxyStream forwards etcd watch events to a proxied client stream.
 type watchProxyStream struct {
+	wp *watchProxy
+	// client is the remote address the stream's watchers are accounted to.
+	client string
+
 	ranges *watchRanges
 
 	// mu protects watchers and nextWatcherID
@@ -194,6 +264,7 @@ func (wps *watchProxyStream) close() {
 	wps.cancel()
 	wps.mu.Lock()
 	wg.Add(len(wps.watchers))
+	wps.wp.releaseWatcher(wps.client, len(wps.watchers))
 	for _, wpsw := range wps.watchers {
 		go func(w *watcher) {
 			wps.ranges.delete(w)
@@ -236,6 +307,22 @@ func (wps *watchProxyStream) recvLoop() error {
 			uv := req.WatchRequest_CreateRequest
 			cr := uv.CreateRequest
 
+			filters, err := v3rpc.FiltersFromRequest(cr)
+			var transform v3rpc.ValueTransform
+			if err == nil {
+				transform, err = v3rpc.ValueTransformFromRequest(cr)
+			}
+			if err != nil {
+				wps.watchCh <- &pb.WatchResponse{
+					Header:       &pb.ResponseHeader{},
+					WatchId:      -1,
+					Created:      true,
+					Canceled:     true,
+					CancelReason: err.Error(),
+				}
+				continue
+			}
+
 			if err := wps.checkPermissionForWatch([]byte(cr.Key), []byte(cr.RangeEnd)); err != nil {
 				wps.watchCh <- &pb.WatchResponse{
 					Header:       &pb.ResponseHeader{},
@@ -256,13 +343,27 @@ func (wps *watchProxyStream) recvLoop() error {
 				nextrev:  cr.StartRevision,
 				progress: cr.ProgressNotify,
 				prevKV:   cr.PrevKv,
-				filters:  v3rpc.FiltersFromRequest(cr),
+				filters:  filters,
+
+				transform: transform,
 			}
 			if !w.wr.valid() {
 				w.post(&pb.WatchResponse{WatchId: -1, Created: true, Canceled: true})
 				wps.mu.Unlock()
 				continue
 			}
+			if !wps.wp.acquireWatcher(wps.client) {
+				watchLimitRejected.Inc()
+				w.post(&pb.WatchResponse{
+					Header:       &pb.ResponseHeader{},
+					WatchId:      -1,
+					Created:      true,
+					Canceled:     true,
+					CancelReason: errTooManyWatchers.Error(),
+				})
+				wps.mu.Unlock()
+				continue
+			}
 			wps.nextWatcherID++
 			w.nextrev = cr.StartRevision
 			wps.watchers[w.id] = w
@@ -306,6 +407,7 @@ func (wps *watchProxyStream) delete(id int64) {
 	}
 	wps.ranges.delete(w)
 	delete(wps.watchers, id)
+	wps.wp.releaseWatcher(wps.client, 1)
 	resp := &pb.WatchResponse{
 		Header:   &w.lastHeader,
 		WatchId:  id,
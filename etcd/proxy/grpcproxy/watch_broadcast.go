@@ -17,6 +17,7 @@ package grpcproxy
 import (
 	"context"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	clientv3 "github.com/ls-2018/etcd_cn/client_sdk/v3"
@@ -51,6 +52,7 @@ func newWatchBroadcast(lg *zap.Logger, wp *watchProxy, w *watcher, update func(*
 		donec:     make(chan struct{}),
 		lg:        lg,
 	}
+	atomic.AddInt64(&watchGroupCount, 1)
 	wb.add(w)
 	go func() {
 		defer close(wb.donec)
@@ -88,6 +90,7 @@ func (wb *watchBroadcast) bcast(wr clientv3.WatchResponse) {
 		r.send(wr)
 	}
 	if len(wb.receivers) > 0 {
+		eventsCoalescing.Add(float64(len(wb.receivers) - 1))
 	}
 }
 
@@ -103,6 +106,9 @@ func (wb *watchBroadcast) add(w *watcher) bool {
 	}
 	if wb.responses == 0 {
 		// Newly created; create event will be sent by etcd.
+		if len(wb.receivers) > 0 {
+			watchersCoalescing.Inc()
+		}
 		wb.receivers[w] = struct{}{}
 		return true
 	}
@@ -120,6 +126,9 @@ func (wb *watchBroadcast) add(w *watcher) bool {
 	if !ok {
 		return false
 	}
+	if len(wb.receivers) > 0 {
+		watchersCoalescing.Inc()
+	}
 	wb.receivers[w] = struct{}{}
 
 	return true
@@ -134,6 +143,7 @@ func (wb *watchBroadcast) delete(w *watcher) {
 	delete(wb.receivers, w)
 	if len(wb.receivers) > 0 {
 		// do not dec the only left watcher for coalescing.
+		watchersCoalescing.Dec()
 	}
 }
 
@@ -148,7 +158,9 @@ func (wb *watchBroadcast) empty() bool { return wb.size() == 0 }
 func (wb *watchBroadcast) stop() {
 	if !wb.empty() {
 		// do not dec the only left watcher for coalescing.
+		watchersCoalescing.Sub(float64(wb.size() - 1))
 	}
+	atomic.AddInt64(&watchGroupCount, -1)
 
 	wb.cancel()
 
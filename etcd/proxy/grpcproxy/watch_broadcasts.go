@@ -31,7 +31,9 @@ type watchBroadcasts struct {
 }
 
 // maxCoalesceRecievers prevents a popular watchBroadcast from being coalseced.
-const maxCoalesceReceivers = 5
+// defaultCoalesceLimit is the broadcast size from which a broadcast is no
+// longer merged into others, unless configured by WatchProxyConfig.
+const defaultCoalesceLimit = 5
 
 func newWatchBroadcasts(wp *watchProxy) *watchBroadcasts {
 	wbs := &watchBroadcasts{
@@ -51,7 +53,7 @@ func newWatchBroadcasts(wp *watchProxy) *watchBroadcasts {
 }
 
 func (wbs *watchBroadcasts) coalesce(wb *watchBroadcast) {
-	if wb.size() >= maxCoalesceReceivers {
+	if limit := wbs.wp.coalesceLimit(); limit > 0 && wb.size() >= limit {
 		return
 	}
 	wbs.mu.Lock()
@@ -65,6 +67,9 @@ func (wbs *watchBroadcasts) coalesce(wb *watchBroadcast) {
 		// 2. ensure wbswb started; nextrev == 0 may mean wbswb is waiting
 		// for a current watcher and expects a create event from the etcd.
 		if wb.nextrev >= wbswb.nextrev && wbswb.responses > 0 {
+			if len(wb.receivers) > 0 && len(wbswb.receivers) > 0 {
+				watchersCoalescing.Inc()
+			}
 			for w := range wb.receivers {
 				wbswb.receivers[w] = struct{}{}
 				wbs.watchers[w] = wbswb
@@ -0,0 +1,77 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcproxy
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver/api/etcdhttp"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+
+	"go.uber.org/zap"
+)
+
+// WatchGroup describes one etcd watcher shared by proxied client watchers.
+type WatchGroup struct {
+	Key          string `json:"key"`
+	RangeEnd     string `json:"range_end,omitempty"`
+	NextRevision int64  `json:"next_revision"`
+	Watchers     int    `json:"watchers"`
+	Responses    int    `json:"responses"`
+}
+
+// WatchGroupsStatus is served by HandleWatchGroups.
+type WatchGroupsStatus struct {
+	Groups []WatchGroup `json:"groups"`
+	// Clients maps client addresses to the number of watchers they hold.
+	Clients map[string]int `json:"clients"`
+}
+
+// HandleWatchGroups registers a handler on '/proxy/watch/groups' listing the
+// watch groups of a watch proxy created by NewWatchProxy.
+func HandleWatchGroups(lg *zap.Logger, mux *http.ServeMux, ws pb.WatchServer) {
+	if lg == nil {
+		lg = zap.NewNop()
+	}
+	wp, ok := ws.(*watchProxy)
+	if !ok {
+		return
+	}
+	mux.HandleFunc(etcdhttp.PathProxyWatchGroups, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(wp.status()); err != nil {
+			lg.Warn("failed to encode watch groups", zap.Error(err))
+		}
+	})
+}
+
+func (wp *watchProxy) status() WatchGroupsStatus {
+	st := WatchGroupsStatus{Groups: wp.ranges.groups(), Clients: make(map[string]int)}
+	if st.Groups == nil {
+		st.Groups = []WatchGroup{}
+	}
+	wp.cmu.Lock()
+	for c, n := range wp.clients {
+		st.Clients[c] = n
+	}
+	wp.cmu.Unlock()
+	return st
+}
@@ -15,7 +15,9 @@
 package grpcproxy
 
 import (
+	"sort"
 	"sync"
+	"sync/atomic"
 )
 
 // watchRanges tracks all open watches for the proxy.
@@ -36,6 +38,7 @@ func newWatchRanges(wp *watchProxy) *watchRanges {
 func (wrs *watchRanges) add(w *watcher) {
 	wrs.mu.Lock()
 	defer wrs.mu.Unlock()
+	atomic.AddInt64(&watcherCount, 1)
 
 	if wbs := wrs.bcasts[w.wr]; wbs != nil {
 		wbs.add(w)
@@ -53,6 +56,7 @@ func (wrs *watchRanges) delete(w *watcher) {
 	if !ok {
 		panic("deleting missing range")
 	}
+	atomic.AddInt64(&watcherCount, -1)
 	if wbs.delete(w) == 0 {
 		wbs.stop()
 		delete(wrs.bcasts, w.wr)
@@ -67,3 +71,35 @@ func (wrs *watchRanges) stop() {
 	}
 	wrs.bcasts = nil
 }
+
+// groups returns the etcd watchers currently shared by client watchers.
+func (wrs *watchRanges) groups() []WatchGroup {
+	wrs.mu.Lock()
+	defer wrs.mu.Unlock()
+	var gs []WatchGroup
+	for wr, wbs := range wrs.bcasts {
+		wbs.mu.Lock()
+		for wb := range wbs.bcasts {
+			wb.mu.RLock()
+			gs = append(gs, WatchGroup{
+				Key:          wr.key,
+				RangeEnd:     wr.end,
+				NextRevision: wb.nextrev,
+				Watchers:     len(wb.receivers),
+				Responses:    wb.responses,
+			})
+			wb.mu.RUnlock()
+		}
+		wbs.mu.Unlock()
+	}
+	sort.Slice(gs, func(i, j int) bool {
+		if gs[i].Key != gs[j].Key {
+			return gs[i].Key < gs[j].Key
+		}
+		if gs[i].RangeEnd != gs[j].RangeEnd {
+			return gs[i].RangeEnd < gs[j].RangeEnd
+		}
+		return gs[i].NextRevision < gs[j].NextRevision
+	})
+	return gs
+}
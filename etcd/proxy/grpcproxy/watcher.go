@@ -18,6 +18,7 @@ import (
 	"time"
 
 	clientv3 "github.com/ls-2018/etcd_cn/client_sdk/v3"
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver/api/v3rpc"
 	"github.com/ls-2018/etcd_cn/etcd/mvcc"
 	"github.com/ls-2018/etcd_cn/offical/api/v3/mvccpb"
 	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
@@ -38,6 +39,8 @@ type watcher struct {
 	filters  []mvcc.FilterFunc
 	progress bool
 	prevKV   bool
+	// transform rewrites event values into projections or hashes.
+	transform v3rpc.ValueTransform
 
 	// id is the id returned to the client on its watch stream.
 	id int64
@@ -89,9 +92,12 @@ func (w *watcher) send(wr clientv3.WatchResponse) {
 			continue
 		}
 
-		if !w.prevKV {
+		if !w.prevKV || w.transform != nil {
 			evCopy := *ev
-			evCopy.PrevKv = nil
+			if !w.prevKV {
+				evCopy.PrevKv = nil
+			}
+			w.transform.Apply(&evCopy)
 			ev = &evCopy
 		}
 		events = append(events, ev)
@@ -123,6 +129,7 @@ func (w *watcher) post(wr *pb.WatchResponse) bool {
 	case w.wps.watchCh <- wr:
 	case <-time.After(50 * time.Millisecond):
 		w.wps.cancel()
+		watchSlowClientsDropped.Inc()
 		w.wps.lg.Error("failed to put a watch response on the watcher's proxy stream channel,err is timeout")
 		return false
 	}
@@ -0,0 +1,150 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcpproxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// PathEndpoints is the admin path listing and editing the proxy endpoints.
+const PathEndpoints = "/endpoints"
+
+var (
+	ErrEndpointExists   = errors.New("tcpproxy: endpoint already exists")
+	ErrEndpointNotFound = errors.New("tcpproxy: endpoint not found")
+)
+
+// EndpointStatus describes a backend endpoint of the proxy.
+type EndpointStatus struct {
+	Addr       string `json:"addr"`
+	Priority   uint16 `json:"priority"`
+	Weight     uint16 `json:"weight"`
+	Active     bool   `json:"active"`
+	Discovered bool   `json:"discovered"`
+}
+
+// EndpointStatuses returns the current backend endpoints.
+func (tp *TCPProxy) EndpointStatuses() []EndpointStatus {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	st := make([]EndpointStatus, 0, len(tp.remotes))
+	for _, r := range tp.remotes {
+		st = append(st, EndpointStatus{
+			Addr:       r.addr,
+			Priority:   r.srv.Priority,
+			Weight:     r.srv.Weight,
+			Active:     r.isActive(),
+			Discovered: r.discovered,
+		})
+	}
+	return st
+}
+
+// AddEndpoint adds a backend endpoint at runtime.
+func (tp *TCPProxy) AddEndpoint(srv *net.SRV) error {
+	addr := fmt.Sprintf("%s:%d", srv.Target, srv.Port)
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	for _, r := range tp.remotes {
+		if r.addr == addr {
+			return ErrEndpointExists
+		}
+	}
+	tp.remotes = append(tp.remotes, &remote{srv: srv, addr: addr})
+	return nil
+}
+
+// RemoveEndpoint removes a backend endpoint at runtime. Established
+// connections are kept. A discovered endpoint comes back on the next
+// discovery if it is still found.
+func (tp *TCPProxy) RemoveEndpoint(addr string) error {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	for i, r := range tp.remotes {
+		if r.addr == addr {
+			tp.remotes = append(tp.remotes[:i:i], tp.remotes[i+1:]...)
+			return nil
+		}
+	}
+	return ErrEndpointNotFound
+}
+
+// AdminHandler serves the endpoints on PathEndpoints: GET lists them,
+// POST adds the one given by the addr, priority and weight parameters and
+// DELETE removes the one given by addr.
+func (tp *TCPProxy) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(PathEndpoints, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			srv, err := srvFromRequest(r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err = tp.AddEndpoint(srv); err != nil {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+		case http.MethodDelete:
+			if err := tp.RemoveEndpoint(r.FormValue("addr")); err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, POST, DELETE")
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tp.EndpointStatuses())
+	})
+	return mux
+}
+
+func srvFromRequest(r *http.Request) (*net.SRV, error) {
+	host, port, err := net.SplitHostPort(r.FormValue("addr"))
+	if err != nil {
+		return nil, err
+	}
+	srv := &net.SRV{Target: host}
+	if srv.Port, err = parseUint16("port", port); err != nil {
+		return nil, err
+	}
+	if srv.Priority, err = parseUint16("priority", r.FormValue("priority")); err != nil {
+		return nil, err
+	}
+	if srv.Weight, err = parseUint16("weight", r.FormValue("weight")); err != nil {
+		return nil, err
+	}
+	return srv, nil
+}
+
+func parseUint16(name, s string) (uint16, error) {
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q", name, s)
+	}
+	return uint16(n), nil
+}
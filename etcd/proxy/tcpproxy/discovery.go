@@ -0,0 +1,170 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcpproxy
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/ls-2018/etcd_cn/client_sdk/pkg/srv"
+	clientv3 "github.com/ls-2018/etcd_cn/client_sdk/v3"
+
+	"go.uber.org/zap"
+)
+
+// Discovery finds backend endpoints at runtime.
+type Discovery interface {
+	Discover(ctx context.Context) ([]*net.SRV, error)
+}
+
+// SRVDiscovery discovers endpoints from the etcd-client DNS SRV records of a domain.
+type SRVDiscovery struct {
+	Domain      string
+	ServiceName string
+}
+
+func (d *SRVDiscovery) Discover(ctx context.Context) ([]*net.SRV, error) {
+	srvs, err := srv.GetClient("etcd-client", d.Domain, d.ServiceName)
+	if err != nil {
+		return nil, err
+	}
+	return srvs.SRVs, nil
+}
+
+// MemberListDiscovery discovers endpoints from the client URLs in the member
+// list of the cluster reachable through the bootstrap Endpoints.
+type MemberListDiscovery struct {
+	Endpoints   []string
+	TLS         *tls.Config
+	DialTimeout time.Duration
+}
+
+func (d *MemberListDiscovery) Discover(ctx context.Context) ([]*net.SRV, error) {
+	dt := d.DialTimeout
+	if dt == 0 {
+		dt = 5 * time.Second
+	}
+	c, err := clientv3.New(clientv3.Config{
+		Endpoints:   d.Endpoints,
+		TLS:         d.TLS,
+		DialTimeout: dt,
+		Context:     ctx,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	resp, err := c.MemberList(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var srvs []*net.SRV
+	for _, m := range resp.Members {
+		// 尚未启动的成员没有客户端地址
+		for _, cu := range m.ClientURLs {
+			u, err := url.Parse(cu)
+			if err != nil || u.Host == "" {
+				continue
+			}
+			host, port, err := net.SplitHostPort(u.Host)
+			if err != nil {
+				continue
+			}
+			p, err := strconv.ParseUint(port, 10, 16)
+			if err != nil {
+				continue
+			}
+			srvs = append(srvs, &net.SRV{Target: host, Port: uint16(p)})
+		}
+	}
+	return srvs, nil
+}
+
+func (tp *TCPProxy) runDiscovery() {
+	ticker := time.NewTicker(tp.DiscoveryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			tp.discover()
+		case <-tp.donec:
+			return
+		}
+	}
+}
+
+// discover replaces the discovered endpoints with the ones currently found by Discovery.
+func (tp *TCPProxy) discover() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-tp.donec:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	srvs, err := tp.Discovery.Discover(ctx)
+	if err != nil {
+		// 发现失败时保留上一次的结果
+		if tp.Logger != nil {
+			tp.Logger.Warn("failed to discover endpoints", zap.Error(err))
+		}
+		return
+	}
+	tp.setDiscovered(srvs)
+}
+
+func (tp *TCPProxy) setDiscovered(srvs []*net.SRV) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	found := make(map[string]*net.SRV, len(srvs))
+	for _, srv := range srvs {
+		found[fmt.Sprintf("%s:%d", srv.Target, srv.Port)] = srv
+	}
+
+	var added, removed []string
+	remotes := make([]*remote, 0, len(tp.remotes)+len(found))
+	for _, r := range tp.remotes {
+		srv, ok := found[r.addr]
+		switch {
+		case !r.discovered:
+			remotes = append(remotes, r)
+		case ok:
+			r.srv = srv
+			remotes = append(remotes, r)
+		default:
+			removed = append(removed, r.addr)
+		}
+		delete(found, r.addr)
+	}
+	for addr, srv := range found {
+		remotes = append(remotes, &remote{srv: srv, addr: addr, discovered: true})
+		added = append(added, addr)
+	}
+	tp.remotes = remotes
+
+	if tp.Logger != nil && len(added)+len(removed) > 0 {
+		tp.Logger.Info("discovered endpoints changed", zap.Strings("added", added), zap.Strings("removed", removed))
+	}
+}
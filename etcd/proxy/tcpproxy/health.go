@@ -0,0 +1,85 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcpproxy
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const defaultHealthCheckTimeout = 5 * time.Second
+
+// dialCheck is the default health check; an endpoint is healthy if it accepts connections.
+func dialCheck(ctx context.Context, addr string) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func (tp *TCPProxy) runHealthCheck() {
+	ticker := time.NewTicker(tp.HealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			tp.checkHealth()
+		case <-tp.donec:
+			return
+		}
+	}
+}
+
+// checkHealth checks every endpoint and activates or deactivates it accordingly.
+func (tp *TCPProxy) checkHealth() {
+	check := tp.HealthCheck
+	if check == nil {
+		check = dialCheck
+	}
+	timeout := tp.HealthCheckTimeout
+	if timeout <= 0 {
+		timeout = defaultHealthCheckTimeout
+	}
+
+	tp.mu.Lock()
+	remotes := append([]*remote(nil), tp.remotes...)
+	tp.mu.Unlock()
+
+	var wg sync.WaitGroup
+	wg.Add(len(remotes))
+	for _, r := range remotes {
+		go func(r *remote) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			err := check(ctx, r.addr)
+			cancel()
+			if !r.setActive(err == nil) || tp.Logger == nil {
+				return
+			}
+			if err != nil {
+				tp.Logger.Warn("deactivated endpoint (health check failed)", zap.String("address", r.addr), zap.Error(err))
+			} else {
+				tp.Logger.Info("activated", zap.String("address", r.addr))
+			}
+		}(r)
+	}
+	wg.Wait()
+}
@@ -15,6 +15,7 @@
 package tcpproxy
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"math/rand"
@@ -32,6 +33,11 @@ type remote struct {
 	srv      *net.SRV
 	addr     string
 	inactive bool
+
+	// discovered is set for endpoints found by Discovery.
+	discovered bool
+	// currentWeight is the smooth weighted round robin state, guarded by TCPProxy.mu.
+	currentWeight int
 }
 
 func (r *remote) inactivate() {
@@ -52,6 +58,14 @@ func (r *remote) tryReactivate() error {
 	return nil
 }
 
+func (r *remote) setActive(active bool) (changed bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	changed = r.inactive == active
+	r.inactive = !active
+	return changed
+}
+
 func (r *remote) isActive() bool {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -64,6 +78,19 @@ type TCPProxy struct {
 	Endpoints       []*net.SRV
 	MonitorInterval time.Duration
 
+	// Discovery, if set, is polled for endpoints in addition to Endpoints;
+	// every DiscoveryInterval if positive, otherwise once at start.
+	Discovery         Discovery
+	DiscoveryInterval time.Duration
+
+	// HealthCheckInterval enables active health checks of all endpoints.
+	// Without it, only endpoints that failed to dial are retried every MonitorInterval.
+	HealthCheckInterval time.Duration
+	// HealthCheckTimeout bounds a single check; defaults to 5 seconds.
+	HealthCheckTimeout time.Duration
+	// HealthCheck checks an endpoint; defaults to dialing it.
+	HealthCheck func(ctx context.Context, addr string) error
+
 	donec chan struct{}
 
 	mu        sync.Mutex // guards the following fields
@@ -76,10 +103,12 @@ func (tp *TCPProxy) Run() error {
 	if tp.MonitorInterval == 0 {
 		tp.MonitorInterval = 5 * time.Minute
 	}
+	tp.mu.Lock()
 	for _, srv := range tp.Endpoints {
 		addr := fmt.Sprintf("%s:%d", srv.Target, srv.Port)
 		tp.remotes = append(tp.remotes, &remote{srv: srv, addr: addr})
 	}
+	tp.mu.Unlock()
 
 	eps := []string{}
 	for _, ep := range tp.Endpoints {
@@ -89,7 +118,17 @@ func (tp *TCPProxy) Run() error {
 		tp.Logger.Info("ready to proxy client requests", zap.Strings("endpoints", eps))
 	}
 
-	go tp.runMonitor()
+	if tp.Discovery != nil {
+		tp.discover()
+		if tp.DiscoveryInterval > 0 {
+			go tp.runDiscovery()
+		}
+	}
+	if tp.HealthCheckInterval > 0 {
+		go tp.runHealthCheck()
+	} else {
+		go tp.runMonitor()
+	}
 	for {
 		in, err := tp.Listener.Accept()
 		if err != nil {
@@ -134,16 +173,18 @@ func (tp *TCPProxy) pick() *remote {
 			tp.pickCount++
 			return r
 		}
-		// choose a uniform random number between 0 and the sum computed
-		// (inclusive), and select the RR whose running sum value is the
-		// first in the selected order
-		choose := rand.Intn(w)
-		for i := 0; i < len(weighted); i++ {
-			choose -= int(weighted[i].srv.Weight)
-			if choose <= 0 {
-				return weighted[i]
+		// smooth weighted round robin: each pick raises every candidate by
+		// its weight and lowers the chosen one by the total, so picks follow
+		// the weights while interleaving the endpoints.
+		var best *remote
+		for _, r := range weighted {
+			r.currentWeight += int(r.srv.Weight)
+			if best == nil || r.currentWeight > best.currentWeight {
+				best = r
 			}
 		}
+		best.currentWeight -= w
+		return best
 	}
 	if unweighted != nil {
 		for i := 0; i < len(tp.remotes); i++ {
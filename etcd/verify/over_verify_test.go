@@ -0,0 +1,86 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver/cindex"
+	"github.com/ls-2018/etcd_cn/etcd/mvcc/backend"
+	betesting "github.com/ls-2018/etcd_cn/etcd/mvcc/backend/testing"
+	"github.com/ls-2018/etcd_cn/etcd/mvcc/buckets"
+	"github.com/ls-2018/etcd_cn/etcd/wal/walpb"
+	"github.com/ls-2018/etcd_cn/raft/raftpb"
+	"go.uber.org/zap"
+)
+
+// newTestBackend 创建consistent_index为10的后端,租约桶中有一个租约并且记录了索引为8的标记
+func newTestBackend(t *testing.T) backend.Backend {
+	be, _ := betesting.NewDefaultTmpBackend(t)
+	t.Cleanup(func() { betesting.Close(t, be) })
+	tx := be.BatchTx()
+	tx.Lock()
+	tx.UnsafeCreateBucket(buckets.Meta)
+	tx.UnsafeCreateBucket(buckets.Lease)
+	cindex.UnsafeUpdateConsistentIndex(tx, 10, 1, false)
+	tx.UnsafePut(buckets.Lease, []byte("lease1"), []byte("ttl=10"))
+	cindex.UnsafeUpdateBucketIndex(tx, buckets.Lease, 8)
+	tx.Unlock()
+	be.ForceCommit()
+	return be
+}
+
+func validate(be backend.Backend) error {
+	cfg := Config{Logger: zap.NewNop()}
+	return validateConsistentIndex(cfg, &raftpb.HardState{Term: 1, Commit: 10}, &walpb.Snapshot{}, be)
+}
+
+func TestValidateBucketIndex(t *testing.T) {
+	be := newTestBackend(t)
+	if err := validate(be); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestValidateBucketIndexDigestMismatch 绕过标记修改租约桶,校验应该失败
+func TestValidateBucketIndexDigestMismatch(t *testing.T) {
+	be := newTestBackend(t)
+	tx := be.BatchTx()
+	tx.Lock()
+	tx.UnsafePut(buckets.Lease, []byte("lease2"), []byte("ttl=20"))
+	tx.Unlock()
+	be.ForceCommit()
+
+	err := validate(be)
+	if err == nil || !strings.Contains(err.Error(), "摘要") {
+		t.Fatalf("validate = %v, want digest mismatch", err)
+	}
+}
+
+// TestValidateBucketIndexAheadOfConsistentIndex 标记的索引超过consistent_index,校验应该失败
+func TestValidateBucketIndexAheadOfConsistentIndex(t *testing.T) {
+	be := newTestBackend(t)
+	tx := be.BatchTx()
+	tx.Lock()
+	cindex.UnsafeUpdateBucketIndex(tx, buckets.Lease, 11)
+	tx.Unlock()
+	be.ForceCommit()
+
+	err := validate(be)
+	if err == nil || !strings.Contains(err.Error(), "ConsistentIndex (11)") {
+		t.Fatalf("validate = %v, want bucket index ahead of consistent index", err)
+	}
+}
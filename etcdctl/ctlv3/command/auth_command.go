@@ -32,6 +32,7 @@ func NewAuthCommand() *cobra.Command {
 	ac.AddCommand(newAuthEnableCommand())
 	ac.AddCommand(newAuthDisableCommand())
 	ac.AddCommand(newAuthStatusCommand())
+	ac.AddCommand(newAuthDenialsCommand())
 
 	return ac
 }
@@ -60,6 +61,39 @@ func authStatusCommandFunc(cmd *cobra.Command, args []string) {
 	display.AuthStatus(*result)
 }
 
+var authDenialsLimit int64
+
+func newAuthDenialsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "denials",
+		Short: "列出所连接节点最近记录的权限检查失败",
+		Long: `列出所连接节点最近记录的权限检查失败(用户、key范围、操作、客户端地址),只有root用户可以查看.
+需要服务端设置 --auth-audit-sample-rate,记录只保存在处理请求的节点.`,
+		Run: authDenialsCommandFunc,
+	}
+	cmd.Flags().Int64Var(&authDenialsLimit, "limit", 0, "最多返回最近的多少条记录,0表示全部")
+	return cmd
+}
+
+// authDenialsCommandFunc executes the "auth denials" command.
+func authDenialsCommandFunc(cmd *cobra.Command, args []string) {
+	if len(args) != 0 {
+		cobrautl.ExitWithError(cobrautl.ExitBadArgs, fmt.Errorf("auth denials命令不接受任何参数"))
+	}
+	if authDenialsLimit < 0 {
+		cobrautl.ExitWithError(cobrautl.ExitBadArgs, fmt.Errorf("--limit 不能为负数"))
+	}
+
+	ctx, cancel := commandCtx(cmd)
+	result, err := mustClientFromCmd(cmd).Auth.Denials(ctx, authDenialsLimit)
+	cancel()
+	if err != nil {
+		cobrautl.ExitWithError(cobrautl.ExitError, err)
+	}
+
+	display.AuthDenials(*result)
+}
+
 func newAuthEnableCommand() *cobra.Command {
 	return &cobra.Command{
 		Use:   "enable",
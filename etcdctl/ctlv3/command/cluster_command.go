@@ -0,0 +1,295 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/ls-2018/etcd_cn/client_sdk/pkg/types"
+	v3 "github.com/ls-2018/etcd_cn/client_sdk/v3"
+	"github.com/ls-2018/etcd_cn/pkg/cobrautl"
+	"github.com/ls-2018/etcd_cn/pkg/topology"
+	"github.com/spf13/cobra"
+)
+
+var (
+	topologyLabel        string
+	upgradeTargetVersion string
+	upgradePromote       bool
+)
+
+// NewClusterCommand returns the cobra command for "cluster".
+func NewClusterCommand() *cobra.Command {
+	cc := &cobra.Command{
+		Use:   "cluster <subcommand>",
+		Short: "集群相关的命令",
+	}
+
+	cc.AddCommand(NewClusterTopologyCommand())
+	cc.AddCommand(NewClusterUpgradeCommand())
+	cc.AddCommand(NewClusterPromoteReplicaCommand())
+
+	return cc
+}
+
+// NewClusterTopologyCommand returns the cobra command for "cluster topology".
+func NewClusterTopologyCommand() *cobra.Command {
+	cc := &cobra.Command{
+		Use:   "topology",
+		Short: "按故障域标签分析投票成员的分布,以及单个故障域失效是否会丢失quorum",
+		Run:   clusterTopologyCommandFunc,
+	}
+	cc.Flags().StringVar(&topologyLabel, "label", "zone", "表示故障域的成员标签")
+
+	return cc
+}
+
+// clusterTopologyCommandFunc executes the "cluster topology" command.
+func clusterTopologyCommandFunc(cmd *cobra.Command, args []string) {
+	ctx, cancel := commandCtx(cmd)
+	resp, err := mustClientFromCmd(cmd).MemberList(ctx)
+	cancel()
+	if err != nil {
+		cobrautl.ExitWithError(cobrautl.ExitError, err)
+	}
+
+	ms := make([]topology.Member, 0, len(resp.Members))
+	for _, m := range resp.Members {
+		ms = append(ms, topology.Member{ID: m.ID, Name: m.Name, IsLearner: m.IsLearner, Domain: m.Labels[topologyLabel]})
+	}
+	display.ClusterTopology(topology.Analyze(topologyLabel, ms))
+}
+
+// NewClusterUpgradeCommand returns the cobra command for "cluster upgrade".
+func NewClusterUpgradeCommand() *cobra.Command {
+	cc := &cobra.Command{
+		Use:   "upgrade --target-version <major.minor> [--promote]",
+		Short: "检查滚动升级的前置条件、给出成员重启顺序,所有成员升级后提升集群版本",
+		Long: `检查所有成员的版本和集群版本,确认没有进行中的降级、没有警报,并按 learner、follower、leader 的顺序
+列出还需要升级重启的成员.所有成员都运行目标版本后,使用 --promote 提升集群版本;
+集群需要以 --experimental-manual-cluster-version-promotion 启动,否则leader会自动提升集群版本.`,
+		Run: clusterUpgradeCommandFunc,
+	}
+	cc.Flags().StringVar(&upgradeTargetVersion, "target-version", "", "升级的目标版本,如 3.6")
+	cc.Flags().BoolVar(&upgradePromote, "promote", false, "所有成员都运行目标版本后提升集群版本")
+
+	return cc
+}
+
+// upgradeMember 是一个成员的升级状态
+type upgradeMember struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Endpoint  string `json:"endpoint"`
+	Version   string `json:"version"`
+	IsLeader  bool   `json:"is-leader"`
+	IsLearner bool   `json:"is-learner"`
+	Upgraded  bool   `json:"upgraded"`
+	Error     string `json:"error,omitempty"`
+}
+
+// upgradePlan 是 cluster upgrade 的检查结果
+type upgradePlan struct {
+	TargetVersion  string          `json:"target-version"`
+	ClusterVersion string          `json:"cluster-version"`
+	Members        []upgradeMember `json:"members"`
+	// Problems 是未满足的前置条件,存在时不能继续升级
+	Problems []string `json:"problems,omitempty"`
+	// RestartOrder 是还需要升级重启的成员,按重启顺序排列
+	RestartOrder []upgradeMember `json:"restart-order,omitempty"`
+	Promoted     bool            `json:"promoted"`
+}
+
+// ReadyToPromote 所有成员都已运行目标版本且前置条件都满足
+func (p upgradePlan) ReadyToPromote() bool {
+	return len(p.Problems) == 0 && len(p.RestartOrder) == 0
+}
+
+// clusterUpgradeCommandFunc executes the "cluster upgrade" command.
+func clusterUpgradeCommandFunc(cmd *cobra.Command, args []string) {
+	if upgradeTargetVersion == "" {
+		cobrautl.ExitWithError(cobrautl.ExitBadArgs, errors.New("target version not provided"))
+	}
+	target, err := parseClusterVersion(upgradeTargetVersion)
+	if err != nil {
+		cobrautl.ExitWithError(cobrautl.ExitBadArgs, err)
+	}
+
+	cli := mustClientFromCmd(cmd)
+	plan := makeUpgradePlan(cmd, cli, target)
+	if upgradePromote && plan.ClusterVersion != plan.TargetVersion {
+		if !plan.ReadyToPromote() {
+			display.ClusterUpgrade(plan)
+			cobrautl.ExitWithError(cobrautl.ExitError, errors.New("cluster is not ready to promote"))
+		}
+		ctx, cancel := commandCtx(cmd)
+		resp, err := cli.Downgrade(ctx, v3.DowngradePromote, plan.TargetVersion)
+		cancel()
+		if err != nil {
+			cobrautl.ExitWithError(cobrautl.ExitError, err)
+		}
+		plan.ClusterVersion = clusterVersionString(resp.Version)
+		plan.Promoted = true
+	}
+	display.ClusterUpgrade(plan)
+}
+
+func makeUpgradePlan(cmd *cobra.Command, cli *v3.Client, target *semver.Version) upgradePlan {
+	plan := upgradePlan{TargetVersion: target.String()}
+
+	ctx, cancel := commandCtx(cmd)
+	mresp, err := cli.MemberList(ctx)
+	cancel()
+	if err != nil {
+		cobrautl.ExitWithError(cobrautl.ExitError, err)
+	}
+
+	var leader uint64
+	downgrading := ""
+	for _, m := range mresp.Members {
+		um := upgradeMember{ID: types.ID(m.ID).String(), Name: m.Name, IsLearner: m.IsLearner}
+		if len(m.ClientURLs) == 0 {
+			um.Error = "成员尚未启动"
+			plan.Members = append(plan.Members, um)
+			continue
+		}
+		um.Endpoint = m.ClientURLs[0]
+		ctx, cancel := commandCtx(cmd)
+		sresp, err := cli.Status(ctx, um.Endpoint)
+		cancel()
+		if err != nil {
+			um.Error = err.Error()
+			plan.Members = append(plan.Members, um)
+			continue
+		}
+		um.Version = sresp.Version
+		if sresp.Leader == sresp.Header.MemberId {
+			leader = m.ID
+		}
+		// 以leader看到的集群版本为准
+		if plan.ClusterVersion == "" || sresp.Leader == sresp.Header.MemberId {
+			plan.ClusterVersion = clusterVersionString(sresp.ClusterVersion)
+		}
+		if sresp.DowngradeTargetVersion != "" {
+			downgrading = sresp.DowngradeTargetVersion
+		}
+		for _, e := range sresp.Errors {
+			plan.Problems = append(plan.Problems, fmt.Sprintf("成员 %s: %s", memberDesc(um), e))
+		}
+		plan.Members = append(plan.Members, um)
+	}
+
+	cv, cvErr := parseClusterVersion(plan.ClusterVersion)
+	switch {
+	case cvErr != nil:
+		plan.Problems = append(plan.Problems, "无法获取集群版本")
+	case cv.Equal(*target):
+	case cv.Major != target.Major || cv.Minor+1 != target.Minor:
+		plan.Problems = append(plan.Problems, fmt.Sprintf("目标版本 %s 只能比集群版本 %s 高一个小版本", target, cv))
+	}
+	if downgrading != "" {
+		plan.Problems = append(plan.Problems, fmt.Sprintf("集群正在降级到 %s,需要先取消降级", downgrading))
+	}
+
+	for i := range plan.Members {
+		um := &plan.Members[i]
+		um.IsLeader = um.ID == types.ID(leader).String()
+		if um.Error != "" {
+			plan.Problems = append(plan.Problems, fmt.Sprintf("成员 %s 不可用: %s", memberDesc(*um), um.Error))
+			continue
+		}
+		mv, err := parseClusterVersion(um.Version)
+		if err != nil {
+			plan.Problems = append(plan.Problems, fmt.Sprintf("成员 %s 的版本 %q 无法解析", memberDesc(*um), um.Version))
+			continue
+		}
+		if target.LessThan(*mv) {
+			plan.Problems = append(plan.Problems, fmt.Sprintf("成员 %s 的版本 %s 高于目标版本", memberDesc(*um), um.Version))
+			continue
+		}
+		um.Upgraded = mv.Equal(*target)
+		if !um.Upgraded {
+			plan.RestartOrder = append(plan.RestartOrder, *um)
+		}
+	}
+
+	// 先重启learner,再重启follower,最后重启leader,尽量减少leader切换
+	rank := func(m upgradeMember) int {
+		switch {
+		case m.IsLearner:
+			return 0
+		case m.IsLeader:
+			return 2
+		}
+		return 1
+	}
+	sort.SliceStable(plan.RestartOrder, func(i, j int) bool {
+		ri, rj := rank(plan.RestartOrder[i]), rank(plan.RestartOrder[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return plan.RestartOrder[i].Name < plan.RestartOrder[j].Name
+	})
+	return plan
+}
+
+// parseClusterVersion 解析 major.minor 或完整的版本号,只保留 major.minor
+func parseClusterVersion(v string) (*semver.Version, error) {
+	ver, err := semver.NewVersion(v)
+	if err != nil {
+		if ver, err = semver.NewVersion(v + ".0"); err != nil {
+			return nil, fmt.Errorf("invalid version %q", v)
+		}
+	}
+	return &semver.Version{Major: ver.Major, Minor: ver.Minor}, nil
+}
+
+func clusterVersionString(v string) string {
+	ver, err := parseClusterVersion(v)
+	if err != nil {
+		return v
+	}
+	return ver.String()
+}
+
+func memberDesc(m upgradeMember) string {
+	if m.Name == "" {
+		return m.ID
+	}
+	return fmt.Sprintf("%s(%s)", m.Name, m.ID)
+}
+
+// NewClusterPromoteReplicaCommand returns the cobra command for "cluster promote-replica".
+func NewClusterPromoteReplicaCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "promote-replica",
+		Short: "提升只读副本集群:停止从上游集群复制并开始接受写请求,提升后不能撤销",
+		Run:   clusterPromoteReplicaCommandFunc,
+	}
+}
+
+// clusterPromoteReplicaCommandFunc executes the "cluster promote-replica" command.
+func clusterPromoteReplicaCommandFunc(cmd *cobra.Command, args []string) {
+	ctx, cancel := commandCtx(cmd)
+	resp, err := mustClientFromCmd(cmd).PromoteReplica(ctx)
+	cancel()
+	if err != nil {
+		cobrautl.ExitWithError(cobrautl.ExitError, err)
+	}
+	fmt.Printf("副本集群已被提升,修订版本 %d\n", resp.Revision)
+}
@@ -18,8 +18,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/url"
+	"regexp"
 	"strings"
-	"sync/atomic"
 	"time"
 
 	"github.com/bgentry/speakeasy"
@@ -27,14 +28,14 @@ import (
 	"github.com/ls-2018/etcd_cn/pkg/cobrautl"
 
 	"github.com/ls-2018/etcd_cn/client_sdk/v3/mirror"
-	"github.com/ls-2018/etcd_cn/offical/api/v3/mvccpb"
-	"github.com/ls-2018/etcd_cn/offical/api/v3/v3rpc/rpctypes"
 
 	"github.com/spf13/cobra"
 )
 
 var (
 	mminsecureTr   bool
+	mmskipverify   bool
+	mmservername   string
 	mmcert         string
 	mmkey          string
 	mmcacert       string
@@ -43,8 +44,22 @@ var (
 	mmuser         string
 	mmpassword     string
 	mmnodestprefix bool
+
+	mmconflict            string
+	mmcheckpointkey       string
+	mmignorecheckpointkey string
+	mmresume              bool
+
+	mmrewritekeys    []string
+	mmexcludekey     string
+	mmvalueregex     string
+	mmmaxvaluebytes  int
+	mmprogressperiod time.Duration
 )
 
+// 未指定 --checkpoint-key 时保存进度的key,后面拼接目标前缀
+const defaultMirrorCheckpointKey = "__make_mirror_checkpoint"
+
 // NewMakeMirrorCommand returns the cobra command for "makeMirror".
 func NewMakeMirrorCommand() *cobra.Command {
 	c := &cobra.Command{
@@ -59,9 +74,20 @@ func NewMakeMirrorCommand() *cobra.Command {
 	c.Flags().StringVar(&mmcert, "dest-cert", "", "使用此TLS证书文件为目标集群识别安全客户端")
 	c.Flags().StringVar(&mmkey, "dest-key", "", "使用此TLS私钥文件为目标集群识别安全客户端")
 	c.Flags().StringVar(&mmcacert, "dest-cacert", "", "使用此CA包验证启用TLS的安全服务器的证书")
-	c.Flags().BoolVar(&mminsecureTr, "dest-insecure-transport", true, "为客户端连接禁用传输安全性")
+	c.Flags().BoolVar(&mminsecureTr, "dest-insecure-transport", true, "为客户端连接禁用传输安全性;目标地址是 https 时总是使用TLS")
+	c.Flags().BoolVar(&mmskipverify, "dest-insecure-skip-tls-verify", false, "跳过目标集群服务端证书的校验")
+	c.Flags().StringVar(&mmservername, "dest-server-name", "", "校验目标集群服务端证书时使用的域名")
 	c.Flags().StringVar(&mmuser, "dest-user", "", "目标集群的 username[:password]")
 	c.Flags().StringVar(&mmpassword, "dest-password", "", "目标集群的密码")
+	c.Flags().StringVar(&mmconflict, "conflict-policy", "source-wins", "目标上的key被本地修改过时的处理方式: source-wins 或 last-writer")
+	c.Flags().StringVar(&mmcheckpointkey, "checkpoint-key", "", "在目标集群中保存复制进度的key,重启后从进度继续;默认 "+defaultMirrorCheckpointKey+"<dest-prefix>")
+	c.Flags().BoolVar(&mmresume, "resume", true, "在目标集群中保存复制进度,重启后从进度继续;false 时每次都从头复制")
+	c.Flags().StringArrayVar(&mmrewritekeys, "rewrite-key", nil, "在前缀替换之后改写目标key的规则 <regexp>=<replacement>,可以重复,按顺序执行")
+	c.Flags().StringVar(&mmexcludekey, "exclude-key", "", "不复制匹配这个正则的源key")
+	c.Flags().StringVar(&mmvalueregex, "value-regex", "", "只复制value匹配这个正则的key,不再匹配时删除目标上的key")
+	c.Flags().IntVar(&mmmaxvaluebytes, "max-value-bytes", 0, "只复制value不超过这个大小的key,超过时删除目标上的key;0表示不限制")
+	c.Flags().DurationVar(&mmprogressperiod, "progress-interval", 30*time.Second, "输出复制速度和延迟的间隔;0表示不输出")
+	c.Flags().StringVar(&mmignorecheckpointkey, "ignore-checkpoint-key", "", "源集群中反向镜像的 --checkpoint-key,用于双向镜像时避免修改被复制回去")
 
 	return c
 }
@@ -103,10 +129,16 @@ func makeMirrorCommandFunc(cmd *cobra.Command, args []string) {
 	keepAliveTime := keepAliveTimeFromCmd(cmd)
 	keepAliveTimeout := keepAliveTimeoutFromCmd(cmd)
 	sec := &secureCfg{
-		cert:              mmcert,
-		key:               mmkey,
-		cacert:            mmcacert,
-		insecureTransport: mminsecureTr,
+		cert:               mmcert,
+		key:                mmkey,
+		cacert:             mmcacert,
+		serverName:         mmservername,
+		insecureTransport:  mminsecureTr,
+		insecureSkipVerify: mmskipverify,
+	}
+	// 源集群使用全局的 TLS 和认证参数,目标集群使用 --dest-* 参数
+	if u, err := url.Parse(args[0]); err == nil && (u.Scheme == "https" || u.Scheme == "unixs") {
+		sec.insecureTransport = false
 	}
 
 	auth := authDestCfg()
@@ -127,19 +159,6 @@ func makeMirrorCommandFunc(cmd *cobra.Command, args []string) {
 }
 
 func makeMirror(ctx context.Context, c *clientv3.Client, dc *clientv3.Client) error {
-	total := int64(0)
-
-	go func() {
-		for {
-			time.Sleep(30 * time.Second)
-			fmt.Println("total--->:", atomic.LoadInt64(&total))
-		}
-	}()
-
-	s := mirror.NewSyncer(c, mmprefix, 0)
-
-	rc, errc := s.SyncBase(ctx)
-
 	// 如果指定并删除目的前缀,则返回错误
 	if mmnodestprefix && len(mmdestprefix) > 0 {
 		cobrautl.ExitWithError(cobrautl.ExitBadArgs, fmt.Errorf("`--dest-prefix` and `--no-dest-prefix` cannot be set at the same time, choose one"))
@@ -150,64 +169,93 @@ func makeMirror(ctx context.Context, c *clientv3.Client, dc *clientv3.Client) er
 		mmdestprefix = mmprefix
 	}
 
-	for r := range rc {
-		for _, kv := range r.Kvs {
-			_, err := dc.Put(ctx, modifyPrefix(kv.Key), kv.Value)
-			if err != nil {
-				return err
-			}
-			atomic.AddInt64(&total, 1)
-		}
-	}
-
-	err := <-errc
+	policy, err := mirror.ParseConflictPolicy(mmconflict)
 	if err != nil {
-		return err
+		cobrautl.ExitWithError(cobrautl.ExitBadArgs, err)
 	}
 
-	wc := s.SyncUpdates(ctx)
-
-	for wr := range wc {
-		if wr.CompactRevision != 0 {
-			return rpctypes.ErrCompacted
+	cfg := mirror.Config{
+		Prefix:              mmprefix,
+		DestPrefix:          mmdestprefix,
+		Conflict:            policy,
+		CheckpointKey:       mmcheckpointkey,
+		IgnoreCheckpointKey: mmignorecheckpointkey,
+	}
+	if cfg.CheckpointKey == "" && mmresume {
+		cfg.CheckpointKey = defaultMirrorCheckpointKey + mmdestprefix
+	}
+	for _, s := range mmrewritekeys {
+		kr, err := mirror.ParseKeyRewrite(s)
+		if err != nil {
+			cobrautl.ExitWithError(cobrautl.ExitBadArgs, err)
 		}
-
-		var lastRev int64
-		var ops []clientv3.Op
-
-		for _, ev := range wr.Events {
-			nextRev := ev.Kv.ModRevision
-			if lastRev != 0 && nextRev > lastRev {
-				_, err := dc.Txn(ctx).Then(ops...).Commit()
-				if err != nil {
-					return err
-				}
-				ops = []clientv3.Op{}
-			}
-			lastRev = nextRev
-			switch ev.Type {
-			case mvccpb.PUT:
-				ops = append(ops, clientv3.OpPut(modifyPrefix(ev.Kv.Key), ev.Kv.Value))
-				atomic.AddInt64(&total, 1)
-			case mvccpb.DELETE:
-				ops = append(ops, clientv3.OpDelete(modifyPrefix(ev.Kv.Key)))
-				atomic.AddInt64(&total, 1)
-			default:
-				panic("unexpected event type")
+		cfg.KeyRewrites = append(cfg.KeyRewrites, kr)
+	}
+	if mmexcludekey != "" {
+		re, err := regexp.Compile(mmexcludekey)
+		if err != nil {
+			cobrautl.ExitWithError(cobrautl.ExitBadArgs, fmt.Errorf("invalid --exclude-key: %v", err))
+		}
+		cfg.KeyFilter = func(key string) bool { return !re.MatchString(key) }
+	}
+	if mmvalueregex != "" || mmmaxvaluebytes > 0 {
+		var re *regexp.Regexp
+		if mmvalueregex != "" {
+			if re, err = regexp.Compile(mmvalueregex); err != nil {
+				cobrautl.ExitWithError(cobrautl.ExitBadArgs, fmt.Errorf("invalid --value-regex: %v", err))
 			}
 		}
-
-		if len(ops) != 0 {
-			_, err := dc.Txn(ctx).Then(ops...).Commit()
-			if err != nil {
-				return err
+		maxBytes := mmmaxvaluebytes
+		cfg.ValueFilter = func(key, value string) bool {
+			if maxBytes > 0 && len(value) > maxBytes {
+				return false
 			}
+			return re == nil || re.MatchString(value)
 		}
 	}
 
-	return nil
+	r := mirror.NewReplicator(c, dc, cfg)
+	if mmprogressperiod > 0 {
+		go reportMirrorProgress(ctx, c, r, mmprogressperiod)
+	}
+	return r.Run(ctx)
+}
+
+// mirrorProgress 复制速度和延迟
+type mirrorProgress struct {
+	Count          int64   `json:"count"`
+	Revision       int64   `json:"revision"`
+	SourceRevision int64   `json:"source-revision"`
+	Lag            int64   `json:"lag"`
+	Throughput     float64 `json:"throughput"`
+	Base           bool    `json:"base,omitempty"`
 }
 
-func modifyPrefix(key string) string {
-	return strings.Replace(key, mmprefix, mmdestprefix, 1)
+// reportMirrorProgress 定期通过 Printer 输出复制了多少修改、每秒复制数和落后源集群的revision数
+func reportMirrorProgress(ctx context.Context, c *clientv3.Client, r *mirror.Replicator, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	last, lastAt := r.Progress(), time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		p, now := r.Progress(), time.Now()
+		mp := mirrorProgress{
+			Count:      p.Count,
+			Revision:   p.Revision,
+			Throughput: float64(p.Count-last.Count) / now.Sub(lastAt).Seconds(),
+			Base:       p.Base,
+		}
+		if resp, err := c.Get(ctx, "\x00", clientv3.WithKeysOnly()); err == nil {
+			mp.SourceRevision = resp.Header.Revision
+			if mp.Lag = mp.SourceRevision - p.Revision; mp.Lag < 0 {
+				mp.Lag = 0
+			}
+		}
+		display.MirrorProgress(mp)
+		last, lastAt = p, now
+	}
 }
@@ -21,6 +21,7 @@ import (
 	"strings"
 
 	clientv3 "github.com/ls-2018/etcd_cn/client_sdk/v3"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
 
 	"github.com/ls-2018/etcd_cn/pkg/cobrautl"
 	"github.com/spf13/cobra"
@@ -28,6 +29,7 @@ import (
 
 var (
 	memberPeerURLs string
+	memberLabels   string
 	isLearner      bool
 )
 
@@ -43,6 +45,7 @@ func NewMemberCommand() *cobra.Command {
 	mc.AddCommand(NewMemberUpdateCommand())
 	mc.AddCommand(NewMemberListCommand())
 	mc.AddCommand(NewMemberPromoteCommand())
+	mc.AddCommand(NewMemberReplaceCommand())
 
 	return mc
 }
@@ -58,6 +61,7 @@ func NewMemberAddCommand() *cobra.Command {
 
 	cc.Flags().StringVar(&memberPeerURLs, "peer-urls", "", "用逗号分隔新成员的对等url.")
 	cc.Flags().BoolVar(&isLearner, "learner", false, "表示新成员是否为learner")
+	cc.Flags().StringVar(&memberLabels, "labels", "", "用逗号分隔新成员的标签,如 zone=z1,rack=r1")
 
 	return cc
 }
@@ -84,6 +88,7 @@ func NewMemberUpdateCommand() *cobra.Command {
 	}
 
 	cc.Flags().StringVar(&memberPeerURLs, "peer-urls", "", "comma separated peer URLs for the updated member.")
+	cc.Flags().StringVar(&memberLabels, "labels", "", "用逗号分隔要合并的标签,如 zone=z1,rack=;值为空表示删除该标签")
 
 	return cc
 }
@@ -110,6 +115,30 @@ func NewMemberPromoteCommand() *cobra.Command {
 	return cc
 }
 
+var (
+	replaceAddMembers []string
+	replacePromote    string
+)
+
+// NewMemberReplaceCommand returns the cobra command for "member replace".
+func NewMemberReplaceCommand() *cobra.Command {
+	cc := &cobra.Command{
+		Use:   "replace <memberID> [<memberID>...] [options]",
+		Short: "通过联合共识原子地移除成员并添加或提升新成员",
+		Long: `通过raft联合共识在一次操作中移除给定的成员,同时添加 --add-member 指定的新成员、提升 --promote 指定的learner.
+变更期间新旧两组投票成员都要多数同意,不会经过只完成部分变更的中间配置.
+新成员添加后才能启动,在它们追上leader之前变更不会完成;也可以先把新成员添加为learner,追上后再用 --promote 替换.
+提升learner时需要连接leader.`,
+		Run: memberReplaceCommandFunc,
+	}
+
+	cc.Flags().StringArrayVar(&replaceAddMembers, "add-member", nil, "要添加的成员,格式为 <name>=<peerURL>[,<peerURL>...],可以指定多次")
+	cc.Flags().StringVar(&replacePromote, "promote", "", "用逗号分隔要提升的learner成员ID")
+	cc.Flags().BoolVar(&isLearner, "learner", false, "表示 --add-member 添加的成员是否为learner")
+
+	return cc
+}
+
 // memberAddCommandFunc executes the "member add" command.
 func memberAddCommandFunc(cmd *cobra.Command, args []string) {
 	if len(args) < 1 {
@@ -131,15 +160,19 @@ func memberAddCommandFunc(cmd *cobra.Command, args []string) {
 	}
 
 	urls := strings.Split(memberPeerURLs, ",")
+	labels, err := parseMemberLabels(memberLabels)
+	if err != nil {
+		cobrautl.ExitWithError(cobrautl.ExitBadArgs, err)
+	}
 	ctx, cancel := commandCtx(cmd)
 	cli := mustClientFromCmd(cmd)
-	var (
-		resp *clientv3.MemberAddResponse
-		err  error
-	)
-	if isLearner {
+	var resp *clientv3.MemberAddResponse
+	switch {
+	case len(labels) > 0:
+		resp, err = cli.MemberAddWithLabels(ctx, urls, isLearner, labels)
+	case isLearner:
 		resp, err = cli.MemberAddAsLearner(ctx, urls)
-	} else {
+	default:
 		resp, err = cli.MemberAdd(ctx, urls)
 	}
 	cancel()
@@ -201,14 +234,26 @@ func memberUpdateCommandFunc(cmd *cobra.Command, args []string) {
 		cobrautl.ExitWithError(cobrautl.ExitBadArgs, fmt.Errorf("bad member ID arg (%v), expecting ID in Hex", err))
 	}
 
-	if len(memberPeerURLs) == 0 {
+	if len(memberPeerURLs) == 0 && len(memberLabels) == 0 {
 		cobrautl.ExitWithError(cobrautl.ExitBadArgs, fmt.Errorf("member peer urls not provided"))
 	}
 
-	urls := strings.Split(memberPeerURLs, ",")
+	var urls []string
+	if len(memberPeerURLs) != 0 {
+		urls = strings.Split(memberPeerURLs, ",")
+	}
+	labels, err := parseMemberLabels(memberLabels)
+	if err != nil {
+		cobrautl.ExitWithError(cobrautl.ExitBadArgs, err)
+	}
 
 	ctx, cancel := commandCtx(cmd)
-	resp, err := mustClientFromCmd(cmd).MemberUpdate(ctx, id, urls)
+	var resp *clientv3.MemberUpdateResponse
+	if len(labels) > 0 || len(urls) == 0 {
+		resp, err = mustClientFromCmd(cmd).MemberUpdateWithLabels(ctx, id, urls, labels)
+	} else {
+		resp, err = mustClientFromCmd(cmd).MemberUpdate(ctx, id, urls)
+	}
 	cancel()
 	if err != nil {
 		cobrautl.ExitWithError(cobrautl.ExitError, err)
@@ -248,3 +293,84 @@ func memberPromoteCommandFunc(cmd *cobra.Command, args []string) {
 	}
 	display.MemberPromote(id, *resp)
 }
+
+// memberReplaceCommandFunc executes the "member replace" command.
+func memberReplaceCommandFunc(cmd *cobra.Command, args []string) {
+	if len(args) == 0 {
+		cobrautl.ExitWithError(cobrautl.ExitBadArgs, fmt.Errorf("member ID is not provided"))
+	}
+	var change clientv3.MemberBatchChange
+	for _, a := range args {
+		id, err := strconv.ParseUint(a, 16, 64)
+		if err != nil {
+			cobrautl.ExitWithError(cobrautl.ExitBadArgs, fmt.Errorf("bad member ID arg (%v), expecting ID in Hex", err))
+		}
+		change.Remove = append(change.Remove, id)
+	}
+	if len(replacePromote) != 0 {
+		for _, a := range strings.Split(replacePromote, ",") {
+			id, err := strconv.ParseUint(a, 16, 64)
+			if err != nil {
+				cobrautl.ExitWithError(cobrautl.ExitBadArgs, fmt.Errorf("bad member ID arg (%v), expecting ID in Hex", err))
+			}
+			change.Promote = append(change.Promote, id)
+		}
+	}
+	var names []string
+	for _, a := range replaceAddMembers {
+		parts := strings.SplitN(a, "=", 2)
+		if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+			cobrautl.ExitWithError(cobrautl.ExitBadArgs, fmt.Errorf("bad --add-member %q, expecting <name>=<peerURLs>", a))
+		}
+		names = append(names, parts[0])
+		change.Add = append(change.Add, &pb.MemberAddRequest{PeerURLs: strings.Split(parts[1], ","), IsLearner: isLearner})
+	}
+
+	ctx, cancel := commandCtx(cmd)
+	resp, err := mustClientFromCmd(cmd).MemberBatchChange(ctx, change)
+	cancel()
+	if err != nil {
+		cobrautl.ExitWithError(cobrautl.ExitError, err)
+	}
+	display.MemberBatchChange(change.Promote, change.Remove, *resp)
+
+	if _, ok := (display).(*simplePrinter); ok && len(resp.Added) > 0 {
+		newNames := make(map[uint64]string)
+		for i, m := range resp.Added {
+			newNames[m.ID] = names[i]
+		}
+		conf := []string{}
+		for _, memb := range resp.Members {
+			for _, u := range memb.PeerURLs {
+				n := memb.Name
+				if nn, ok := newNames[memb.ID]; ok {
+					n = nn
+				}
+				conf = append(conf, fmt.Sprintf("%s=%s", n, u))
+			}
+		}
+		for i, m := range resp.Added {
+			fmt.Print("\n")
+			fmt.Printf("ETCD_NAME=%q\n", names[i])
+			fmt.Printf("ETCD_INITIAL_CLUSTER=%q\n", strings.Join(conf, ","))
+			fmt.Printf("ETCD_INITIAL_ADVERTISE_PEER_URLS=%q\n", strings.Join(m.PeerURLs, ","))
+			fmt.Printf("ETCD_INITIAL_CLUSTER_STATE=\"existing\"\n")
+		}
+	}
+}
+
+// parseMemberLabels 解析 k1=v1,k2=v2 形式的标签
+func parseMemberLabels(s string) (map[string]string, error) {
+	if len(s) == 0 {
+		return nil, nil
+	}
+	labels := make(map[string]string)
+	for _, kv := range strings.Split(s, ",") {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || len(parts[0]) == 0 {
+			return nil, fmt.Errorf("bad label %q, expecting key=value", kv)
+		}
+		labels[parts[0]] = parts[1]
+	}
+	return labels, nil
+}
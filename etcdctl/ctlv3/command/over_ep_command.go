@@ -15,8 +15,13 @@
 package command
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -33,6 +38,14 @@ import (
 var (
 	epClusterEndpoints bool
 	epHashKVRev        int64
+	epCertsReload      bool
+	epStatusDetail     bool
+	epProfileType      string
+	epProfileDuration  time.Duration
+	epProfileOutput    string
+	epFailpointTTL     time.Duration
+	epFailpointRemove  bool
+	epFailpointClear   bool
 )
 
 // NewEndpointCommand returns the cobra command for "endpoint".
@@ -46,6 +59,12 @@ func NewEndpointCommand() *cobra.Command {
 	ec.AddCommand(newEpHealthCommand())
 	ec.AddCommand(newEpStatusCommand())
 	ec.AddCommand(newEpHashKVCommand())
+	ec.AddCommand(newEpCertsCommand())
+	ec.AddCommand(newEpMaintenanceCommand())
+	ec.AddCommand(newEpProfileCommand())
+	ec.AddCommand(newEpLogLevelCommand())
+	ec.AddCommand(newEpFailpointCommand())
+	ec.AddCommand(newEpPeersCommand())
 
 	return ec
 }
@@ -61,12 +80,14 @@ func newEpHealthCommand() *cobra.Command {
 }
 
 func newEpStatusCommand() *cobra.Command {
-	return &cobra.Command{
+	sc := &cobra.Command{
 		Use:   "status",
 		Short: "打印出指定端点的状态",
 		Long:  ``,
 		Run:   epStatusCommandFunc,
 	}
+	sc.Flags().BoolVar(&epStatusDetail, "detail", false, "同时输出写路径各阶段(proposal-commit、apply、backend-commit、wal-fsync)最近耗时的百分位数")
+	return sc
 }
 
 func newEpHashKVCommand() *cobra.Command {
@@ -79,6 +100,83 @@ func newEpHashKVCommand() *cobra.Command {
 	return hc
 }
 
+func newEpCertsCommand() *cobra.Command {
+	cc := &cobra.Command{
+		Use:   "certs",
+		Short: "输出每个端点当前加载的TLS证书指纹和有效期",
+		Run:   epCertsCommandFunc,
+	}
+	cc.Flags().BoolVar(&epCertsReload, "reload", false, "先强制端点重新加载证书、私钥和CA文件")
+	return cc
+}
+
+func newEpMaintenanceCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "maintenance <on|off>",
+		Short: "让端点进入或退出只读维护模式",
+		Long: `只读维护模式下成员不参与竞选(是leader时先转移leader)、拒绝写请求,仍然提供串行化读.
+该模式只保存在内存中,成员重启后自动退出.`,
+		Run: epMaintenanceCommandFunc,
+	}
+}
+
+func newEpLogLevelCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "loglevel [<scope>=<level> ...]",
+		Short: "设置并输出端点各子系统的日志等级",
+		Long: `子系统: raft、mvcc、auth、rafthttp、lease、apply.
+等级为 debug、info、warn、error、dpanic、panic、fatal,或 default 表示跟随全局 --log-level.
+不带参数时只输出当前等级.设置只保存在内存中,成员重启后恢复.`,
+		Run: epLogLevelCommandFunc,
+	}
+}
+
+func newEpFailpointCommand() *cobra.Command {
+	fc := &cobra.Command{
+		Use:   "failpoint [<type>[=<arg>] ...]",
+		Short: "在端点注入或解除故障,用于测试",
+		Long: `故障类型:
+  fsync-delay=<duration>  推迟每次WAL落盘和后端提交
+  drop-peer=<member id>   丢弃发往该成员的raft消息
+  pause-apply             暂停apply已提交的日志
+  commit-error            让下一次后端提交失败,成员会像磁盘故障一样退出
+故障在 --ttl 后自动解除;不带参数时只输出当前生效的故障.
+端点需要以 --experimental-failpoints 启动,需要 root 权限.`,
+		Run: epFailpointCommandFunc,
+	}
+	fc.Flags().DurationVar(&epFailpointTTL, "ttl", 30*time.Second, "故障的有效期")
+	fc.Flags().BoolVar(&epFailpointRemove, "remove", false, "解除给定的故障而不是注入")
+	fc.Flags().BoolVar(&epFailpointClear, "clear", false, "解除全部故障")
+	return fc
+}
+
+func newEpPeersCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "peers",
+		Short: "输出每个端点到各个对端的网络状况",
+		Long: `outbound 表示端点拨号到对端的消息流已连接,inbound 表示对端拨号到端点的消息流已连接;
+只有一个方向连通并持续一段时间时 asymmetric 为 true,疑似单向网络分区.
+rtt 为探测得到的平滑往返时间,clock offset 为端点时钟领先对端的时间(为负表示落后),
+dropped 为发送和接收缓冲区满时丢弃的消息数.`,
+		Run: epPeersCommandFunc,
+	}
+}
+
+func newEpProfileCommand() *cobra.Command {
+	pc := &cobra.Command{
+		Use:   "profile",
+		Short: "通过gRPC从端点采集 heap、cpu profile 或 runtime trace",
+		Long: `不需要开启 pprof HTTP 监听,需要 root 权限.
+cpu 和 trace 按 --duration 采集,其余类型(heap、allocs、goroutine、block、mutex 等)立即返回.
+多个端点时输出文件名后追加端点地址.`,
+		Run: epProfileCommandFunc,
+	}
+	pc.Flags().StringVar(&epProfileType, "type", "heap", "profile 类型: heap、cpu、trace、allocs、goroutine、block、mutex、threadcreate")
+	pc.Flags().DurationVar(&epProfileDuration, "duration", 30*time.Second, "cpu profile 和 trace 的采集时长")
+	pc.Flags().StringVar(&epProfileOutput, "output", "", "输出文件 (默认 <type>.pprof, trace 为 trace.out)")
+	return pc
+}
+
 type epHealth struct {
 	Ep     string `json:"endpoint"`
 	Health bool   `json:"health"`
@@ -144,6 +242,14 @@ func epHealthCommandFunc(cmd *cobra.Command, args []string) {
 							eh.Error = eh.Error + "NOSPACE "
 						case etcdserverpb.AlarmType_CORRUPT:
 							eh.Error = eh.Error + "CORRUPT "
+						case etcdserverpb.AlarmType_UNREACHABLE:
+							eh.Error = eh.Error + "UNREACHABLE "
+						case etcdserverpb.AlarmType_TOPOLOGY:
+							eh.Error = eh.Error + "TOPOLOGY "
+						case etcdserverpb.AlarmType_BACKUP:
+							eh.Error = eh.Error + "BACKUP "
+						case etcdserverpb.AlarmType_CLOCK_SKEW:
+							eh.Error = eh.Error + "CLOCK_SKEW "
 						default:
 							eh.Error = eh.Error + "UNKNOWN "
 						}
@@ -233,6 +339,68 @@ func epHashKVCommandFunc(cmd *cobra.Command, args []string) {
 	}
 }
 
+type epCerts struct {
+	Ep   string                  `json:"Endpoint"`
+	Resp *v3.ReloadCertsResponse `json:"Certs"`
+}
+
+func epCertsCommandFunc(cmd *cobra.Command, args []string) {
+	c := mustClientFromCmd(cmd)
+
+	var certsList []epCerts
+	var err error
+	for _, ep := range endpointsFromCluster(cmd) {
+		ctx, cancel := commandCtx(cmd)
+		resp, serr := c.ReloadCerts(ctx, ep, !epCertsReload)
+		cancel()
+		if serr != nil {
+			err = serr
+			fmt.Fprintf(os.Stderr, "获取端点证书失败%s (%v)\n", ep, serr)
+			continue
+		}
+		if resp.Error != "" {
+			err = errors.New(resp.Error)
+			fmt.Fprintf(os.Stderr, "端点%s 部分证书重新加载失败 (%s)\n", ep, resp.Error)
+		}
+		certsList = append(certsList, epCerts{Ep: ep, Resp: resp})
+	}
+
+	display.EndpointCerts(certsList)
+
+	if err != nil {
+		os.Exit(cobrautl.ExitError)
+	}
+}
+
+func epMaintenanceCommandFunc(cmd *cobra.Command, args []string) {
+	if len(args) != 1 || (args[0] != "on" && args[0] != "off") {
+		cobrautl.ExitWithError(cobrautl.ExitBadArgs, errors.New("maintenance command needs one argument: on or off"))
+	}
+	readOnly := args[0] == "on"
+
+	c := mustClientFromCmd(cmd)
+	var err error
+	for _, ep := range endpointsFromCluster(cmd) {
+		ctx, cancel := commandCtx(cmd)
+		_, merr := c.MaintenanceMode(ctx, ep, readOnly)
+		cancel()
+		if merr != nil {
+			err = merr
+			fmt.Fprintf(os.Stderr, "切换端点%s 的维护模式失败 (%v)\n", ep, merr)
+			continue
+		}
+		if readOnly {
+			fmt.Printf("端点%s 已进入只读维护模式\n", ep)
+		} else {
+			fmt.Printf("端点%s 已退出只读维护模式\n", ep)
+		}
+	}
+
+	if err != nil {
+		os.Exit(cobrautl.ExitError)
+	}
+}
+
 func endpointsFromCluster(cmd *cobra.Command) []string {
 	if !epClusterEndpoints {
 		endpoints, err := cmd.Flags().GetStringSlice("endpoints")
@@ -278,3 +446,209 @@ func endpointsFromCluster(cmd *cobra.Command) []string {
 	}
 	return ret
 }
+
+type epLogLevels struct {
+	Ep   string               `json:"Endpoint"`
+	Resp *v3.LogLevelResponse `json:"LogLevels"`
+}
+
+func epLogLevelCommandFunc(cmd *cobra.Command, args []string) {
+	levels := make(map[string]string, len(args))
+	for _, arg := range args {
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			cobrautl.ExitWithError(cobrautl.ExitBadArgs, fmt.Errorf("invalid log level %q, expected <scope>=<level>", arg))
+		}
+		levels[kv[0]] = kv[1]
+	}
+
+	c := mustClientFromCmd(cmd)
+	var lvList []epLogLevels
+	var err error
+	for _, ep := range endpointsFromCluster(cmd) {
+		ctx, cancel := commandCtx(cmd)
+		resp, lerr := c.LogLevel(ctx, ep, levels)
+		cancel()
+		if lerr != nil {
+			err = lerr
+			fmt.Fprintf(os.Stderr, "设置端点%s 日志等级失败 (%v)\n", ep, lerr)
+			continue
+		}
+		lvList = append(lvList, epLogLevels{Ep: ep, Resp: resp})
+	}
+
+	display.EndpointLogLevels(lvList)
+
+	if err != nil {
+		os.Exit(cobrautl.ExitError)
+	}
+}
+
+type epFailpoints struct {
+	Ep   string                `json:"Endpoint"`
+	Resp *v3.FailpointResponse `json:"Failpoints"`
+}
+
+var failpointTypes = map[string]etcdserverpb.Failpoint_Type{
+	"fsync-delay":  etcdserverpb.Failpoint_FSYNC_DELAY,
+	"drop-peer":    etcdserverpb.Failpoint_DROP_PEER,
+	"pause-apply":  etcdserverpb.Failpoint_PAUSE_APPLY,
+	"commit-error": etcdserverpb.Failpoint_COMMIT_ERROR,
+}
+
+func parseFailpoint(arg string) (*etcdserverpb.Failpoint, error) {
+	kv := strings.SplitN(arg, "=", 2)
+	typ, ok := failpointTypes[kv[0]]
+	if !ok {
+		return nil, fmt.Errorf("unknown failpoint %q", kv[0])
+	}
+	f := &etcdserverpb.Failpoint{Type: typ, Ttl: int64(epFailpointTTL / time.Second)}
+	switch typ {
+	case etcdserverpb.Failpoint_FSYNC_DELAY:
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("failpoint %q expects fsync-delay=<duration>", arg)
+		}
+		d, err := time.ParseDuration(kv[1])
+		if err != nil {
+			return nil, fmt.Errorf("bad fsync delay %q (%v)", kv[1], err)
+		}
+		f.DelayMs = int64(d / time.Millisecond)
+	case etcdserverpb.Failpoint_DROP_PEER:
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("failpoint %q expects drop-peer=<member id>", arg)
+		}
+		id, err := strconv.ParseUint(kv[1], 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad member ID %q (%v)", kv[1], err)
+		}
+		f.Peer = id
+	}
+	return f, nil
+}
+
+func epFailpointCommandFunc(cmd *cobra.Command, args []string) {
+	if !epFailpointRemove && len(args) > 0 && epFailpointTTL < time.Second {
+		cobrautl.ExitWithError(cobrautl.ExitBadArgs, fmt.Errorf("--ttl must be at least 1s"))
+	}
+	req := &etcdserverpb.FailpointRequest{Clear: epFailpointClear}
+	for _, arg := range args {
+		f, err := parseFailpoint(arg)
+		if err != nil {
+			cobrautl.ExitWithError(cobrautl.ExitBadArgs, err)
+		}
+		if epFailpointRemove {
+			req.Remove = append(req.Remove, f)
+		} else {
+			req.Inject = append(req.Inject, f)
+		}
+	}
+
+	c := mustClientFromCmd(cmd)
+	var fpList []epFailpoints
+	var err error
+	for _, ep := range endpointsFromCluster(cmd) {
+		ctx, cancel := commandCtx(cmd)
+		resp, ferr := c.Failpoint(ctx, ep, req)
+		cancel()
+		if ferr != nil {
+			err = ferr
+			fmt.Fprintf(os.Stderr, "端点%s 设置故障失败 (%v)\n", ep, ferr)
+			continue
+		}
+		fpList = append(fpList, epFailpoints{Ep: ep, Resp: resp})
+	}
+
+	display.EndpointFailpoints(fpList)
+
+	if err != nil {
+		os.Exit(cobrautl.ExitError)
+	}
+}
+
+type epPeerStats struct {
+	Ep   string                `json:"Endpoint"`
+	Resp *v3.PeerStatsResponse `json:"PeerStats"`
+}
+
+func epPeersCommandFunc(cmd *cobra.Command, args []string) {
+	c := mustClientFromCmd(cmd)
+	var psList []epPeerStats
+	var err error
+	for _, ep := range endpointsFromCluster(cmd) {
+		ctx, cancel := commandCtx(cmd)
+		resp, perr := c.PeerStats(ctx, ep)
+		cancel()
+		if perr != nil {
+			err = perr
+			fmt.Fprintf(os.Stderr, "获取端点%s 的对端网络状况失败 (%v)\n", ep, perr)
+			continue
+		}
+		psList = append(psList, epPeerStats{Ep: ep, Resp: resp})
+	}
+
+	display.EndpointPeerStats(psList)
+
+	if err != nil {
+		os.Exit(cobrautl.ExitError)
+	}
+}
+
+func epProfileCommandFunc(cmd *cobra.Command, args []string) {
+	output := epProfileOutput
+	if output == "" {
+		output = epProfileType + ".pprof"
+		if epProfileType == "trace" {
+			output = "trace.out"
+		}
+	}
+
+	c := mustClientFromCmd(cmd)
+	eps := endpointsFromCluster(cmd)
+	var err error
+	for _, ep := range eps {
+		path := output
+		if len(eps) > 1 {
+			path = output + "." + strings.NewReplacer("://", "_", ":", "_", "/", "_").Replace(ep)
+		}
+		if perr := epProfile(cmd, c, ep, path); perr != nil {
+			err = perr
+			fmt.Fprintf(os.Stderr, "从端点%s 采集 profile 失败 (%v)\n", ep, perr)
+			continue
+		}
+		fmt.Printf("Profile of %s saved at %s\n", ep, path)
+	}
+	if err != nil {
+		os.Exit(cobrautl.ExitError)
+	}
+}
+
+func epProfile(cmd *cobra.Command, c *v3.Client, ep, path string) error {
+	// 与 snapshot save 一样,未指定 --command-timeout 时不设超时
+	ctx, cancel := context.WithCancel(context.Background())
+	if isCommandTimeoutFlagSet(cmd) {
+		ctx, cancel = commandCtx(cmd)
+	}
+	defer cancel()
+
+	rc, err := c.Profile(ctx, ep, epProfileType, epProfileDuration)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	partpath := path + ".part"
+	f, err := os.Create(partpath)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(f, rc); err != nil {
+		f.Close()
+		os.Remove(partpath)
+		return err
+	}
+	if err = f.Close(); err != nil {
+		os.Remove(partpath)
+		return err
+	}
+	return os.Rename(partpath, path)
+}
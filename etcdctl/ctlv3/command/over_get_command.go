@@ -32,6 +32,7 @@ var (
 	getPrefix      bool
 	getFromKey     bool
 	getRev         int64
+	getSnapToken   string
 	getKeysOnly    bool
 	getCountOnly   bool
 	printValueOnly bool
@@ -51,6 +52,7 @@ func NewGetCommand() *cobra.Command {
 	cmd.Flags().BoolVar(&getPrefix, "prefix", false, "返回前缀匹配的keys")
 	cmd.Flags().BoolVar(&getFromKey, "from-key", false, "使用byte compare获取 >= 给定键的键")
 	cmd.Flags().Int64Var(&getRev, "rev", 0, "指定修订版本")
+	cmd.Flags().StringVar(&getSnapToken, "snapshot-token", "", "在快照会话固定的修订版本上读取,见 snapshot session")
 	cmd.Flags().BoolVar(&getKeysOnly, "keys-only", false, "只获取keys")
 	cmd.Flags().BoolVar(&getCountOnly, "count-only", false, "只获取匹配的数量")
 	cmd.Flags().BoolVar(&printValueOnly, "print-value-only", false, `仅在使用“simple"输出格式时写入值`)
@@ -118,6 +120,9 @@ func getGetOp(args []string) (string, []clientv3.OpOption) {
 	if getRev > 0 {
 		opts = append(opts, clientv3.WithRev(getRev))
 	}
+	if getSnapToken != "" {
+		opts = append(opts, clientv3.WithSnapshotToken(getSnapToken))
+	}
 
 	sortByOrder := clientv3.SortNone
 	sortOrder := strings.ToUpper(getSortOrder)
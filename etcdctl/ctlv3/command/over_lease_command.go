@@ -18,8 +18,10 @@ import (
 	"context"
 	"fmt"
 	"strconv"
+	"strings"
 
 	v3 "github.com/ls-2018/etcd_cn/client_sdk/v3"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
 	"github.com/ls-2018/etcd_cn/pkg/cobrautl"
 
 	"github.com/spf13/cobra"
@@ -37,10 +39,16 @@ func NewLeaseCommand() *cobra.Command {
 	lc.AddCommand(NewLeaseTimeToLiveCommand())
 	lc.AddCommand(NewLeaseListCommand())
 	lc.AddCommand(NewLeaseKeepAliveCommand())
+	lc.AddCommand(NewLeaseWatchCommand())
 
 	return lc
 }
 
+var (
+	leaseGrantParent   string
+	leaseGrantMetadata string
+)
+
 // NewLeaseGrantCommand returns the cobra command for "lease grant".
 func NewLeaseGrantCommand() *cobra.Command {
 	lc := &cobra.Command{
@@ -49,6 +57,8 @@ func NewLeaseGrantCommand() *cobra.Command {
 
 		Run: leaseGrantCommandFunc,
 	}
+	lc.Flags().StringVar(&leaseGrantParent, "parent", "", "父租约ID(16进制),父租约撤销或过期时新租约一起撤销,续约父租约时新租约一起续约")
+	lc.Flags().StringVar(&leaseGrantMetadata, "metadata", "", "随租约保存的数据,例如所属服务名、主机名")
 
 	return lc
 }
@@ -63,8 +73,16 @@ func leaseGrantCommandFunc(cmd *cobra.Command, args []string) {
 		cobrautl.ExitWithError(cobrautl.ExitBadArgs, fmt.Errorf("错误的ttl (%v)", err))
 	}
 
+	var opts []v3.LeaseOption
+	if leaseGrantParent != "" {
+		opts = append(opts, v3.WithLeaseParent(leaseFromArgs(leaseGrantParent)))
+	}
+	if leaseGrantMetadata != "" {
+		opts = append(opts, v3.WithLeaseMetadata(leaseGrantMetadata))
+	}
+
 	ctx, cancel := commandCtx(cmd)
-	resp, err := mustClientFromCmd(cmd).Grant(ctx, ttl)
+	resp, err := mustClientFromCmd(cmd).Grant(ctx, ttl, opts...)
 	cancel()
 	if err != nil {
 		cobrautl.ExitWithError(cobrautl.ExitError, fmt.Errorf("创建租约失败 (%v)", err))
@@ -131,6 +149,8 @@ func leaseTimeToLiveCommandFunc(cmd *cobra.Command, args []string) {
 	display.TimeToLive(*resp, timeToLiveKeys)
 }
 
+var leaseListDetail bool
+
 // NewLeaseListCommand returns the cobra command for "lease list".
 func NewLeaseListCommand() *cobra.Command {
 	lc := &cobra.Command{
@@ -138,6 +158,7 @@ func NewLeaseListCommand() *cobra.Command {
 		Short: "显示所有租约",
 		Run:   leaseListCommandFunc,
 	}
+	lc.Flags().BoolVar(&leaseListDetail, "detail", false, "显示每个租约的剩余时间和metadata")
 	return lc
 }
 
@@ -147,7 +168,24 @@ func leaseListCommandFunc(cmd *cobra.Command, args []string) {
 	if rerr != nil {
 		cobrautl.ExitWithError(cobrautl.ExitBadConnection, rerr)
 	}
-	display.Leases(*resp)
+	if !leaseListDetail {
+		display.Leases(*resp)
+		return
+	}
+
+	// 剩余时间只有leader知道,逐个查询
+	c := mustClientFromCmd(cmd)
+	details := make([]v3.LeaseTimeToLiveResponse, 0, len(resp.Leases))
+	for _, l := range resp.Leases {
+		ctx, cancel := commandCtx(cmd)
+		r, err := c.TimeToLive(ctx, l.ID)
+		cancel()
+		if err != nil {
+			cobrautl.ExitWithError(cobrautl.ExitError, fmt.Errorf("获取租约 %016x 信息失败 (%v)", l.ID, err))
+		}
+		details = append(details, *r)
+	}
+	display.LeasesDetail(details)
 }
 
 var leaseKeepAliveOnce bool
@@ -196,6 +234,57 @@ func leaseKeepAliveCommandFunc(cmd *cobra.Command, args []string) {
 	}
 }
 
+var (
+	leaseWatchIDPrefix       string
+	leaseWatchMetadataPrefix string
+	leaseWatchTypes          []string
+)
+
+// NewLeaseWatchCommand returns the cobra command for "lease watch".
+func NewLeaseWatchCommand() *cobra.Command {
+	lc := &cobra.Command{
+		Use:   "watch [options]",
+		Short: "订阅租约的创建、续约、检查点、过期、撤销事件",
+
+		Run: leaseWatchCommandFunc,
+	}
+	lc.Flags().StringVar(&leaseWatchIDPrefix, "id-prefix", "", "只显示16进制ID以该前缀开头的租约")
+	lc.Flags().StringVar(&leaseWatchMetadataPrefix, "metadata-prefix", "", "只显示metadata以该前缀开头的租约")
+	lc.Flags().StringSliceVar(&leaseWatchTypes, "types", nil, "只显示这些类型的事件,例如 EXPIRED,REVOKED")
+
+	return lc
+}
+
+// leaseWatchCommandFunc executes the "lease watch" command.
+func leaseWatchCommandFunc(cmd *cobra.Command, args []string) {
+	if len(args) != 0 {
+		cobrautl.ExitWithError(cobrautl.ExitBadArgs, fmt.Errorf("lease watch命令不需要参数"))
+	}
+
+	opts := []v3.LeaseOption{
+		v3.WithLeaseIDPrefix(leaseWatchIDPrefix),
+		v3.WithLeaseMetadataPrefix(leaseWatchMetadataPrefix),
+	}
+	if len(leaseWatchTypes) > 0 {
+		types := make([]pb.LeaseEvent_EventType, 0, len(leaseWatchTypes))
+		for _, t := range leaseWatchTypes {
+			v, ok := pb.LeaseEvent_EventType_value[strings.ToUpper(t)]
+			if !ok {
+				cobrautl.ExitWithError(cobrautl.ExitBadArgs, fmt.Errorf("未知的租约事件类型 %q", t))
+			}
+			types = append(types, pb.LeaseEvent_EventType(v))
+		}
+		opts = append(opts, v3.WithLeaseEventTypes(types...))
+	}
+
+	for resp := range mustClientFromCmd(cmd).WatchLeases(context.TODO(), opts...) {
+		if err := resp.Err(); err != nil {
+			cobrautl.ExitWithError(cobrautl.ExitBadConnection, err)
+		}
+		display.LeaseWatch(resp)
+	}
+}
+
 func leaseFromArgs(arg string) v3.LeaseID {
 	id, err := strconv.ParseInt(arg, 16, 64)
 	if err != nil {
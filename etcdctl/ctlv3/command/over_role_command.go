@@ -27,6 +27,7 @@ import (
 var (
 	rolePermPrefix  bool
 	rolePermFromKey bool
+	rolePermDeny    bool
 )
 
 // NewRoleCommand returns the cobra command for "role".
@@ -42,6 +43,8 @@ func NewRoleCommand() *cobra.Command {
 	ac.AddCommand(newRoleListCommand())
 	ac.AddCommand(newRoleGrantPermissionCommand())
 	ac.AddCommand(newRoleRevokePermissionCommand())
+	ac.AddCommand(newRoleGrantOperationCommand())
+	ac.AddCommand(newRoleRevokeOperationCommand())
 
 	return ac
 }
@@ -87,6 +90,7 @@ func newRoleGrantPermissionCommand() *cobra.Command {
 
 	cmd.Flags().BoolVar(&rolePermPrefix, "prefix", false, "授予前缀权限")
 	cmd.Flags().BoolVar(&rolePermFromKey, "from-key", false, "使用byte compare授予大于或等于给定键的权限")
+	cmd.Flags().BoolVar(&rolePermDeny, "deny", false, "授予禁止权限,禁止优先于任何角色授予的允许权限")
 
 	return cmd
 }
@@ -104,6 +108,23 @@ func newRoleRevokePermissionCommand() *cobra.Command {
 	return cmd
 }
 
+func newRoleGrantOperationCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "grant-operation <role name> <operation>",
+		Short: "给角色授予一个非KV操作权限",
+		Long:  "给角色授予一个非KV操作权限,operation: lease, watch, member, defragment, snapshot, hash",
+		Run:   roleGrantOperationCommandFunc,
+	}
+}
+
+func newRoleRevokeOperationCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "revoke-operation <role name> <operation>",
+		Short: "撤销角色的一个非KV操作权限",
+		Run:   roleRevokeOperationCommandFunc,
+	}
+}
+
 func roleAddCommandFunc(cmd *cobra.Command, args []string) {
 	if len(args) != 1 {
 		cobrautl.ExitWithError(cobrautl.ExitBadArgs, fmt.Errorf("role add命令需要角色名作为参数"))
@@ -169,7 +190,12 @@ func roleGrantPermissionCommandFunc(cmd *cobra.Command, args []string) {
 	}
 
 	key, rangeEnd := permRange(args[2:])
-	resp, err := mustClientFromCmd(cmd).Auth.RoleGrantPermission(context.TODO(), args[0], key, rangeEnd, perm)
+	ac := mustClientFromCmd(cmd).Auth
+	grant := ac.RoleGrantPermission
+	if rolePermDeny {
+		grant = ac.RoleDenyPermission
+	}
+	resp, err := grant(context.TODO(), args[0], key, rangeEnd, perm)
 	if err != nil {
 		cobrautl.ExitWithError(cobrautl.ExitError, err)
 	}
@@ -190,6 +216,32 @@ func roleRevokePermissionCommandFunc(cmd *cobra.Command, args []string) {
 	display.RoleRevokePermission(args[0], args[1], rangeEnd, *resp)
 }
 
+func roleGrantOperationCommandFunc(cmd *cobra.Command, args []string) {
+	if len(args) != 2 {
+		cobrautl.ExitWithError(cobrautl.ExitBadArgs, fmt.Errorf("role grant-operation命令需要角色名和操作作为参数"))
+	}
+
+	resp, err := mustClientFromCmd(cmd).Auth.RoleGrantOperation(context.TODO(), args[0], args[1])
+	if err != nil {
+		cobrautl.ExitWithError(cobrautl.ExitError, err)
+	}
+
+	display.RoleGrantPermission(args[0], *resp)
+}
+
+func roleRevokeOperationCommandFunc(cmd *cobra.Command, args []string) {
+	if len(args) != 2 {
+		cobrautl.ExitWithError(cobrautl.ExitBadArgs, fmt.Errorf("role revoke-operation命令需要角色名和操作作为参数"))
+	}
+
+	resp, err := mustClientFromCmd(cmd).Auth.RoleRevokeOperation(context.TODO(), args[0], args[1])
+	if err != nil {
+		cobrautl.ExitWithError(cobrautl.ExitError, err)
+	}
+
+	display.RoleRevokeOperation(args[0], args[1], *resp)
+}
+
 func permRange(args []string) (string, string) {
 	key := args[0]
 	var rangeEnd string
@@ -17,13 +17,16 @@ package command
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/dustin/go-humanize"
 
 	v3 "github.com/ls-2018/etcd_cn/client_sdk/v3"
 	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
 	"github.com/ls-2018/etcd_cn/pkg/cobrautl"
+	"github.com/ls-2018/etcd_cn/pkg/topology"
 )
 
 type printer interface {
@@ -37,14 +40,21 @@ type printer interface {
 	KeepAlive(r v3.LeaseKeepAliveResponse)
 	TimeToLive(r v3.LeaseTimeToLiveResponse, keys bool)
 	Leases(r v3.LeaseLeasesResponse)
+	LeasesDetail([]v3.LeaseTimeToLiveResponse)
+	LeaseWatch(r v3.LeaseWatchResponse)
 	MemberAdd(v3.MemberAddResponse)
 	MemberRemove(id uint64, r v3.MemberRemoveResponse)
 	MemberUpdate(id uint64, r v3.MemberUpdateResponse)
 	MemberPromote(id uint64, r v3.MemberPromoteResponse)
+	MemberBatchChange(promoted, removed []uint64, r v3.MemberBatchChangeResponse)
 	MemberList(v3.MemberListResponse)
 	EndpointHealth([]epHealth)
 	EndpointStatus([]epStatus)
 	EndpointHashKV([]epHashKV)
+	EndpointCerts([]epCerts)
+	EndpointLogLevels([]epLogLevels)
+	EndpointFailpoints([]epFailpoints)
+	EndpointPeerStats([]epPeerStats)
 	MoveLeader(leader, target uint64, r v3.MoveLeaderResponse)
 	Alarm(v3.AlarmResponse)
 	RoleAdd(role string, r v3.AuthRoleAddResponse)
@@ -53,6 +63,7 @@ type printer interface {
 	RoleList(v3.AuthRoleListResponse)
 	RoleGrantPermission(role string, r v3.AuthRoleGrantPermissionResponse)
 	RoleRevokePermission(role string, key string, end string, r v3.AuthRoleRevokePermissionResponse)
+	RoleRevokeOperation(role string, op string, r v3.AuthRoleRevokePermissionResponse)
 	UserAdd(user string, r v3.AuthUserAddResponse)
 	UserGet(user string, r v3.AuthUserGetResponse)
 	UserList(r v3.AuthUserListResponse)
@@ -61,6 +72,10 @@ type printer interface {
 	UserRevokeRole(user string, role string, r v3.AuthUserRevokeRoleResponse)
 	UserDelete(user string, r v3.AuthUserDeleteResponse)
 	AuthStatus(r v3.AuthStatusResponse)
+	AuthDenials(r v3.AuthDenialsResponse)
+	ClusterTopology(r topology.Report)
+	ClusterUpgrade(p upgradePlan)
+	MirrorProgress(p mirrorProgress)
 }
 
 func NewPrinter(printerType string, isHex bool) printer {
@@ -95,6 +110,9 @@ func (p *printerRPC) Revoke(id v3.LeaseID, r v3.LeaseRevokeResponse)     { p.p(r
 func (p *printerRPC) KeepAlive(r v3.LeaseKeepAliveResponse)              { p.p(r) }
 func (p *printerRPC) TimeToLive(r v3.LeaseTimeToLiveResponse, keys bool) { p.p(&r) }
 func (p *printerRPC) Leases(r v3.LeaseLeasesResponse)                    { p.p(&r) }
+func (p *printerRPC) LeaseWatch(r v3.LeaseWatchResponse) {
+	p.p(&pb.LeaseWatchResponse{Header: r.ResponseHeader, Events: r.Events})
+}
 
 func (p *printerRPC) MemberAdd(r v3.MemberAddResponse) { p.p((*pb.MemberAddResponse)(&r)) }
 func (p *printerRPC) MemberRemove(id uint64, r v3.MemberRemoveResponse) {
@@ -104,6 +122,10 @@ func (p *printerRPC) MemberRemove(id uint64, r v3.MemberRemoveResponse) {
 func (p *printerRPC) MemberUpdate(id uint64, r v3.MemberUpdateResponse) {
 	p.p((*pb.MemberUpdateResponse)(&r))
 }
+
+func (p *printerRPC) MemberBatchChange(promoted, removed []uint64, r v3.MemberBatchChangeResponse) {
+	p.p((*pb.MemberBatchChangeResponse)(&r))
+}
 func (p *printerRPC) MemberList(r v3.MemberListResponse) { p.p((*pb.MemberListResponse)(&r)) }
 func (p *printerRPC) Alarm(r v3.AlarmResponse)           { p.p((*pb.AlarmResponse)(&r)) }
 func (p *printerRPC) MoveLeader(leader, target uint64, r v3.MoveLeaderResponse) {
@@ -125,6 +147,10 @@ func (p *printerRPC) RoleGrantPermission(_ string, r v3.AuthRoleGrantPermissionR
 func (p *printerRPC) RoleRevokePermission(_ string, _ string, _ string, r v3.AuthRoleRevokePermissionResponse) {
 	p.p((*pb.AuthRoleRevokePermissionResponse)(&r))
 }
+
+func (p *printerRPC) RoleRevokeOperation(_ string, _ string, r v3.AuthRoleRevokePermissionResponse) {
+	p.p((*pb.AuthRoleRevokePermissionResponse)(&r))
+}
 func (p *printerRPC) UserAdd(_ string, r v3.AuthUserAddResponse) { p.p((*pb.AuthUserAddResponse)(&r)) }
 func (p *printerRPC) UserGet(_ string, r v3.AuthUserGetResponse) { p.p((*pb.AuthUserGetResponse)(&r)) }
 func (p *printerRPC) UserList(r v3.AuthUserListResponse)         { p.p((*pb.AuthUserListResponse)(&r)) }
@@ -148,6 +174,10 @@ func (p *printerRPC) AuthStatus(r v3.AuthStatusResponse) {
 	p.p((*pb.AuthStatusResponse)(&r))
 }
 
+func (p *printerRPC) AuthDenials(r v3.AuthDenialsResponse) {
+	p.p((*pb.AuthDenialsResponse)(&r))
+}
+
 type printerUnsupported struct{ printerRPC }
 
 func newPrinterUnsupported(n string) printer {
@@ -160,11 +190,43 @@ func newPrinterUnsupported(n string) printer {
 func (p *printerUnsupported) EndpointHealth([]epHealth) { p.p(nil) }
 func (p *printerUnsupported) EndpointStatus([]epStatus) { p.p(nil) }
 func (p *printerUnsupported) EndpointHashKV([]epHashKV) { p.p(nil) }
+func (p *printerUnsupported) EndpointCerts([]epCerts)   { p.p(nil) }
+
+func (p *printerUnsupported) EndpointLogLevels([]epLogLevels) { p.p(nil) }
+
+func (p *printerUnsupported) EndpointFailpoints([]epFailpoints) { p.p(nil) }
+
+func (p *printerUnsupported) EndpointPeerStats([]epPeerStats) { p.p(nil) }
+
+func (p *printerUnsupported) LeasesDetail([]v3.LeaseTimeToLiveResponse) { p.p(nil) }
 
 func (p *printerUnsupported) MoveLeader(leader, target uint64, r v3.MoveLeaderResponse) { p.p(nil) }
 
+func (p *printerUnsupported) ClusterTopology(r topology.Report) { p.p(nil) }
+func (p *printerUnsupported) ClusterUpgrade(upgradePlan)        { p.p(nil) }
+func (p *printerUnsupported) MirrorProgress(mirrorProgress)     { p.p(nil) }
+
 func makeMemberListTable(r v3.MemberListResponse) (hdr []string, rows [][]string) {
 	hdr = []string{"ID", "Status", "Name", "Peer Addrs", "Client Addrs", "Is Learner"}
+	// 只有存在带标签的成员时才输出标签列,保持原有输出格式不变
+	withLabels := false
+	for _, m := range r.Members {
+		if len(m.Labels) > 0 {
+			withLabels = true
+			break
+		}
+	}
+	if withLabels {
+		hdr = append(hdr, "Labels")
+	}
+	// 只有leader返回learner复制进度
+	progress := make(map[uint64]*pb.LearnerProgress)
+	for _, lp := range r.LearnerProgress {
+		progress[lp.ID] = lp
+	}
+	if len(progress) > 0 {
+		hdr = append(hdr, "Learner Progress")
+	}
 	for _, m := range r.Members {
 		status := "started"
 		if len(m.Name) == 0 {
@@ -174,18 +236,48 @@ func makeMemberListTable(r v3.MemberListResponse) (hdr []string, rows [][]string
 		if m.IsLearner {
 			isLearner = "true"
 		}
-		rows = append(rows, []string{
+		row := []string{
 			fmt.Sprintf("%x", m.ID),
 			status,
 			m.Name,
 			strings.Join(m.PeerURLs, ","),
 			strings.Join(m.ClientURLs, ","),
 			isLearner,
-		})
+		}
+		if withLabels {
+			row = append(row, formatMemberLabels(m.Labels))
+		}
+		if len(progress) > 0 {
+			row = append(row, formatLearnerProgress(progress[m.ID]))
+		}
+		rows = append(rows, row)
 	}
 	return hdr, rows
 }
 
+func formatLearnerProgress(lp *pb.LearnerProgress) string {
+	if lp == nil {
+		return ""
+	}
+	s := fmt.Sprintf("match=%d lag=%d state=%s", lp.MatchIndex, lp.Lag, lp.State)
+	if lp.PendingSnapshot != 0 {
+		s += fmt.Sprintf(" pending-snapshot=%d", lp.PendingSnapshot)
+	}
+	if lp.ReadySeconds > 0 {
+		s += fmt.Sprintf(" ready=%.0fs", lp.ReadySeconds)
+	}
+	return s
+}
+
+func formatMemberLabels(labels map[string]string) string {
+	kvs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		kvs = append(kvs, k+"="+v)
+	}
+	sort.Strings(kvs)
+	return strings.Join(kvs, ";")
+}
+
 func makeEndpointHealthTable(healthList []epHealth) (hdr []string, rows [][]string) {
 	hdr = []string{"endpoint", "health", "took", "error"}
 	for _, h := range healthList {
@@ -201,8 +293,8 @@ func makeEndpointHealthTable(healthList []epHealth) (hdr []string, rows [][]stri
 
 func makeEndpointStatusTable(statusList []epStatus) (hdr []string, rows [][]string) {
 	hdr = []string{
-		"endpoint", "ID", "version", "db size", "is leader", "is learner", "raft term",
-		"raft index", "raft applied index", "errors",
+		"endpoint", "ID", "version", "db size", "is leader", "is learner", "read only", "replica", "raft term",
+		"raft index", "raft applied index", "startup", "errors",
 	}
 	for _, status := range statusList {
 		rows = append(rows, []string{
@@ -212,15 +304,47 @@ func makeEndpointStatusTable(statusList []epStatus) (hdr []string, rows [][]stri
 			humanize.Bytes(uint64(status.Resp.DbSize)),
 			fmt.Sprint(status.Resp.Leader == status.Resp.Header.MemberId),
 			fmt.Sprint(status.Resp.IsLearner),
+			fmt.Sprint(status.Resp.ReadOnly),
+			fmt.Sprint(status.Resp.Replica),
 			fmt.Sprint(status.Resp.RaftTerm),
 			fmt.Sprint(status.Resp.RaftIndex),
 			fmt.Sprint(status.Resp.RaftAppliedIndex),
+			startupString(status.Resp.Startup),
 			fmt.Sprint(strings.Join(status.Resp.Errors, ", ")),
 		})
 	}
 	return hdr, rows
 }
 
+// startupString 启动完成时只显示阶段,否则附带 WAL replay 进度和当前阶段的耗时
+func startupString(st *pb.StartupStatus) string {
+	if st == nil {
+		return ""
+	}
+	if st.Phase == "ready" {
+		return st.Phase
+	}
+	return fmt.Sprintf("%s (%.1f%%, %s)", st.Phase, st.WalReplayPercent, time.Duration(st.PhaseSeconds*float64(time.Second)).Round(time.Second))
+}
+
+func makeEndpointLatencyTable(statusList []epStatus) (hdr []string, rows [][]string) {
+	hdr = []string{"endpoint", "stage", "samples", "p50", "p90", "p99", "max"}
+	for _, status := range statusList {
+		for _, l := range status.Resp.Latency {
+			rows = append(rows, []string{
+				status.Ep,
+				l.Stage,
+				fmt.Sprint(l.Count),
+				time.Duration(l.P50).String(),
+				time.Duration(l.P90).String(),
+				time.Duration(l.P99).String(),
+				time.Duration(l.Max).String(),
+			})
+		}
+	}
+	return hdr, rows
+}
+
 func makeEndpointHashKVTable(hashList []epHashKV) (hdr []string, rows [][]string) {
 	hdr = []string{"endpoint", "hash"}
 	for _, h := range hashList {
@@ -231,3 +355,137 @@ func makeEndpointHashKVTable(hashList []epHashKV) (hdr []string, rows [][]string
 	}
 	return hdr, rows
 }
+
+func makeEndpointCertsTable(certsList []epCerts) (hdr []string, rows [][]string) {
+	hdr = []string{"endpoint", "kind", "file", "subject", "sha256 fingerprint", "not after", "loaded at"}
+	for _, c := range certsList {
+		for _, ci := range c.Resp.Certs {
+			rows = append(rows, []string{
+				c.Ep,
+				ci.Kind,
+				ci.File,
+				ci.Subject,
+				ci.Fingerprint,
+				time.Unix(ci.NotAfter, 0).UTC().Format(time.RFC3339),
+				time.Unix(ci.LoadedAt, 0).UTC().Format(time.RFC3339),
+			})
+		}
+	}
+	return hdr, rows
+}
+
+func makeEndpointLogLevelsTable(lvList []epLogLevels) (hdr []string, rows [][]string) {
+	hdr = []string{"endpoint", "scope", "level", "inherited"}
+	for _, l := range lvList {
+		for _, sl := range l.Resp.Levels {
+			rows = append(rows, []string{
+				l.Ep,
+				sl.Scope,
+				sl.Level,
+				fmt.Sprint(sl.Inherited),
+			})
+		}
+	}
+	return hdr, rows
+}
+
+func makeEndpointPeerStatsTable(psList []epPeerStats) (hdr []string, rows [][]string) {
+	hdr = []string{"endpoint", "peer", "active", "outbound", "inbound", "asymmetric", "rtt", "clock offset", "send queue", "dropped sent", "dropped received", "last error"}
+	for _, l := range psList {
+		for _, ps := range l.Resp.Peers {
+			rows = append(rows, []string{
+				l.Ep,
+				fmt.Sprintf("%x", ps.ID),
+				fmt.Sprint(ps.Active),
+				fmt.Sprint(ps.Outbound),
+				fmt.Sprint(ps.Inbound),
+				fmt.Sprint(ps.AsymmetricPartition),
+				(time.Duration(ps.RttUs) * time.Microsecond).String(),
+				(time.Duration(ps.ClockOffsetUs) * time.Microsecond).String(),
+				fmt.Sprint(ps.SendQueueDepth),
+				fmt.Sprint(ps.DroppedSent),
+				fmt.Sprint(ps.DroppedReceived),
+				ps.LastError,
+			})
+		}
+	}
+	return hdr, rows
+}
+
+func makeEndpointFailpointsTable(fpList []epFailpoints) (hdr []string, rows [][]string) {
+	hdr = []string{"endpoint", "failpoint", "peer", "delay", "remaining ttl"}
+	for _, l := range fpList {
+		for _, f := range l.Resp.Active {
+			peer, delay := "", ""
+			if f.Type == pb.Failpoint_DROP_PEER {
+				peer = fmt.Sprintf("%x", f.Peer)
+			}
+			if f.Type == pb.Failpoint_FSYNC_DELAY {
+				delay = (time.Duration(f.DelayMs) * time.Millisecond).String()
+			}
+			rows = append(rows, []string{
+				l.Ep,
+				f.Type.String(),
+				peer,
+				delay,
+				fmt.Sprintf("%ds", f.Ttl),
+			})
+		}
+	}
+	return hdr, rows
+}
+
+func makeLeasesDetailTable(ls []v3.LeaseTimeToLiveResponse) (hdr []string, rows [][]string) {
+	hdr = []string{"id", "granted ttl", "remaining ttl", "metadata"}
+	for _, l := range ls {
+		rows = append(rows, []string{
+			fmt.Sprintf("%016x", l.ID),
+			fmt.Sprint(l.GrantedTTL),
+			fmt.Sprint(l.TTL),
+			l.Metadata,
+		})
+	}
+	return hdr, rows
+}
+
+func makeAuthDenialsTable(r v3.AuthDenialsResponse) (hdr []string, rows [][]string) {
+	hdr = []string{"time", "user", "op", "key", "range end", "caller", "app", "request id"}
+	for _, d := range r.Denials {
+		rows = append(rows, []string{
+			time.Unix(d.Time, 0).UTC().Format(time.RFC3339),
+			d.User,
+			d.Op,
+			d.Key,
+			d.RangeEnd,
+			d.Caller,
+			d.App,
+			d.RequestId,
+		})
+	}
+	return hdr, rows
+}
+
+func makeClusterTopologyTable(r topology.Report) (hdr []string, rows [][]string) {
+	hdr = []string{"domain", "voters", "learners", "loses quorum"}
+	for _, d := range r.Domains {
+		rows = append(rows, []string{
+			d.Name,
+			strings.Join(d.Voters, ","),
+			strings.Join(d.Learners, ","),
+			fmt.Sprint(d.LosesQuorum),
+		})
+	}
+	return hdr, rows
+}
+
+// clusterTopologySummary 描述整体的分析结论
+func clusterTopologySummary(r topology.Report) string {
+	switch {
+	case !r.Labeled():
+		return fmt.Sprintf("没有投票成员带有 %q 标签", r.Label)
+	case r.Safe():
+		return fmt.Sprintf("%d 个投票成员(quorum %d)分布在 %d 个故障域,任意单个故障域失效都不会丢失quorum", r.Voters, r.Quorum, len(r.Domains))
+	default:
+		return fmt.Sprintf("%d 个投票成员(quorum %d)分布在 %d 个故障域,故障域 %s 失效就会丢失quorum", r.Voters, r.Quorum, len(r.Domains), strings.Join(r.AtRisk(), ","))
+	}
+}
@@ -98,6 +98,7 @@ func (p *fieldsPrinter) Grant(r v3.LeaseGrantResponse) {
 	p.hdr(r.ResponseHeader)
 	fmt.Println(`"ID" :`, r.ID)
 	fmt.Println(`"TTL" :`, r.TTL)
+	fmt.Println(`"ClockSkewMs" :`, r.ClockSkew.Milliseconds())
 }
 
 func (p *fieldsPrinter) Revoke(id v3.LeaseID, r v3.LeaseRevokeResponse) {
@@ -108,6 +109,7 @@ func (p *fieldsPrinter) KeepAlive(r v3.LeaseKeepAliveResponse) {
 	p.hdr(r.ResponseHeader)
 	fmt.Println(`"ID" :`, r.ID)
 	fmt.Println(`"TTL" :`, r.TTL)
+	fmt.Println(`"ClockSkewMs" :`, r.ClockSkew.Milliseconds())
 }
 
 func (p *fieldsPrinter) TimeToLive(r v3.LeaseTimeToLiveResponse, keys bool) {
@@ -118,12 +120,39 @@ func (p *fieldsPrinter) TimeToLive(r v3.LeaseTimeToLiveResponse, keys bool) {
 	for _, k := range r.Keys {
 		fmt.Printf("\"Key\" : %q\n", string(k))
 	}
+	fmt.Printf("\"Metadata\" : %q\n", r.Metadata)
+	fmt.Println(`"ClockSkewMs" :`, r.ClockSkew.Milliseconds())
 }
 
 func (p *fieldsPrinter) Leases(r v3.LeaseLeasesResponse) {
 	p.hdr(r.ResponseHeader)
 	for _, item := range r.Leases {
 		fmt.Println(`"ID" :`, item.ID)
+		fmt.Println(`"GrantedTTL" :`, item.GrantedTTL)
+		fmt.Printf("\"Metadata\" : %q\n", item.Metadata)
+	}
+}
+
+func (p *fieldsPrinter) LeaseWatch(r v3.LeaseWatchResponse) {
+	p.hdr(r.ResponseHeader)
+	for _, e := range r.Events {
+		fmt.Println(`"Type" :`, e.Type)
+		fmt.Println(`"ID" :`, e.ID)
+		fmt.Println(`"TTL" :`, e.TTL)
+		fmt.Println(`"GrantedTTL" :`, e.GrantedTTL)
+		fmt.Println(`"Parent" :`, e.Parent)
+		fmt.Printf("\"Metadata\" : %q\n", e.Metadata)
+	}
+}
+
+func (p *fieldsPrinter) LeasesDetail(ls []v3.LeaseTimeToLiveResponse) {
+	for _, l := range ls {
+		p.hdr(l.ResponseHeader)
+		fmt.Println(`"ID" :`, l.ID)
+		fmt.Println(`"TTL" :`, l.TTL)
+		fmt.Println(`"GrantedTTL" :`, l.GrantedTTL)
+		fmt.Printf("\"Metadata\" : %q\n", l.Metadata)
+		fmt.Println()
 	}
 }
 
@@ -139,8 +168,14 @@ func (p *fieldsPrinter) MemberList(r v3.MemberListResponse) {
 			fmt.Printf("\"ClientURL\" : %q\n", u)
 		}
 		fmt.Println(`"IsLearner" :`, m.IsLearner)
+		for k, v := range m.Labels {
+			fmt.Printf("\"Label\" : %q\n", k+"="+v)
+		}
 		fmt.Println()
 	}
+	for _, lp := range r.LearnerProgress {
+		fmt.Printf("\"LearnerProgress\" : %d %d %d %q %d %.1f\n", lp.ID, lp.MatchIndex, lp.Lag, lp.State, lp.PendingSnapshot, lp.ReadySeconds)
+	}
 }
 
 func (p *fieldsPrinter) EndpointHealth(hs []epHealth) {
@@ -160,10 +195,21 @@ func (p *fieldsPrinter) EndpointStatus(eps []epStatus) {
 		fmt.Println(`"DBSize" :`, ep.Resp.DbSize)
 		fmt.Println(`"Leader" :`, ep.Resp.Leader)
 		fmt.Println(`"IsLearner" :`, ep.Resp.IsLearner)
+		fmt.Println(`"ReadOnly" :`, ep.Resp.ReadOnly)
+		fmt.Println(`"Replica" :`, ep.Resp.Replica)
 		fmt.Println(`"RaftIndex" :`, ep.Resp.RaftIndex)
 		fmt.Println(`"RaftTerm" :`, ep.Resp.RaftTerm)
 		fmt.Println(`"RaftAppliedIndex" :`, ep.Resp.RaftAppliedIndex)
+		if st := ep.Resp.Startup; st != nil {
+			fmt.Printf("\"Startup\" : %q %.1f %.1f %.1f\n", st.Phase, st.WalReplayPercent, st.PhaseSeconds, st.TotalSeconds)
+		}
 		fmt.Println(`"Errors" :`, ep.Resp.Errors)
+		for _, l := range ep.Resp.Latency {
+			fmt.Printf("\"Latency\" : %q %d %d %d %d %d\n", l.Stage, l.Count, l.P50, l.P90, l.P99, l.Max)
+		}
+		for _, lp := range ep.Resp.LearnerProgress {
+			fmt.Printf("\"LearnerProgress\" : %d %d %d %q %d %.1f\n", lp.ID, lp.MatchIndex, lp.Lag, lp.State, lp.PendingSnapshot, lp.ReadySeconds)
+		}
 		fmt.Printf("\"Endpoint\" : %q\n", ep.Ep)
 		fmt.Println()
 	}
@@ -178,6 +224,74 @@ func (p *fieldsPrinter) EndpointHashKV(hs []epHashKV) {
 	}
 }
 
+func (p *fieldsPrinter) EndpointCerts(cs []epCerts) {
+	for _, c := range cs {
+		p.hdr(c.Resp.Header)
+		fmt.Printf("\"Endpoint\" : %q\n", c.Ep)
+		for _, ci := range c.Resp.Certs {
+			fmt.Printf("\"Kind\" : %q\n", ci.Kind)
+			fmt.Printf("\"File\" : %q\n", ci.File)
+			fmt.Printf("\"Subject\" : %q\n", ci.Subject)
+			fmt.Printf("\"Fingerprint\" : %q\n", ci.Fingerprint)
+			fmt.Println(`"NotBefore" :`, ci.NotBefore)
+			fmt.Println(`"NotAfter" :`, ci.NotAfter)
+			fmt.Println(`"LoadedAt" :`, ci.LoadedAt)
+		}
+		if c.Resp.Error != "" {
+			fmt.Printf("\"Error\" : %q\n", c.Resp.Error)
+		}
+		fmt.Println()
+	}
+}
+
+func (p *fieldsPrinter) EndpointLogLevels(ls []epLogLevels) {
+	for _, l := range ls {
+		p.hdr(l.Resp.Header)
+		fmt.Printf("\"Endpoint\" : %q\n", l.Ep)
+		for _, sl := range l.Resp.Levels {
+			fmt.Printf("\"Scope\" : %q\n", sl.Scope)
+			fmt.Printf("\"Level\" : %q\n", sl.Level)
+			fmt.Println(`"Inherited" :`, sl.Inherited)
+		}
+		fmt.Println()
+	}
+}
+
+func (p *fieldsPrinter) EndpointFailpoints(ls []epFailpoints) {
+	for _, l := range ls {
+		p.hdr(l.Resp.Header)
+		fmt.Printf("\"Endpoint\" : %q\n", l.Ep)
+		for _, f := range l.Resp.Active {
+			fmt.Printf("\"Type\" : %q\n", f.Type)
+			fmt.Printf("\"Peer\" : %d\n", f.Peer)
+			fmt.Printf("\"DelayMs\" : %d\n", f.DelayMs)
+			fmt.Printf("\"TTL\" : %d\n", f.Ttl)
+		}
+		fmt.Println()
+	}
+}
+
+func (p *fieldsPrinter) EndpointPeerStats(ls []epPeerStats) {
+	for _, l := range ls {
+		p.hdr(l.Resp.Header)
+		fmt.Printf("\"Endpoint\" : %q\n", l.Ep)
+		for _, ps := range l.Resp.Peers {
+			fmt.Println(`"PeerID" :`, ps.ID)
+			fmt.Println(`"Active" :`, ps.Active)
+			fmt.Println(`"Outbound" :`, ps.Outbound)
+			fmt.Println(`"Inbound" :`, ps.Inbound)
+			fmt.Println(`"AsymmetricPartition" :`, ps.AsymmetricPartition)
+			fmt.Println(`"RttUs" :`, ps.RttUs)
+			fmt.Println(`"ClockOffsetUs" :`, ps.ClockOffsetUs)
+			fmt.Println(`"SendQueueDepth" :`, ps.SendQueueDepth)
+			fmt.Println(`"DroppedSent" :`, ps.DroppedSent)
+			fmt.Println(`"DroppedReceived" :`, ps.DroppedReceived)
+			fmt.Printf("\"LastError\" : %q\n", ps.LastError)
+		}
+		fmt.Println()
+	}
+}
+
 func (p *fieldsPrinter) Alarm(r v3.AlarmResponse) {
 	p.hdr(r.Header)
 	for _, a := range r.Alarms {
@@ -194,6 +308,10 @@ func (p *fieldsPrinter) RoleGet(role string, r v3.AuthRoleGetResponse) {
 		fmt.Println(`"PermType" : `, p.PermType.String())
 		fmt.Printf("\"Key\" : %q\n", string(p.Key))
 		fmt.Printf("\"RangeEnd\" : %q\n", string(p.RangeEnd))
+		fmt.Println(`"Deny" : `, p.Deny)
+	}
+	for _, op := range r.Operations {
+		fmt.Printf("\"Operation\" : %q\n", op)
 	}
 }
 func (p *fieldsPrinter) RoleDelete(role string, r v3.AuthRoleDeleteResponse) { p.hdr(r.Header) }
@@ -213,8 +331,23 @@ func (p *fieldsPrinter) RoleGrantPermission(role string, r v3.AuthRoleGrantPermi
 func (p *fieldsPrinter) RoleRevokePermission(role string, key string, end string, r v3.AuthRoleRevokePermissionResponse) {
 	p.hdr(r.Header)
 }
+
+func (p *fieldsPrinter) RoleRevokeOperation(role string, op string, r v3.AuthRoleRevokePermissionResponse) {
+	p.hdr(r.Header)
+}
 func (p *fieldsPrinter) UserAdd(user string, r v3.AuthUserAddResponse)          { p.hdr(r.Header) }
 func (p *fieldsPrinter) UserChangePassword(r v3.AuthUserChangePasswordResponse) { p.hdr(r.Header) }
+func (p *fieldsPrinter) UserGet(user string, r v3.AuthUserGetResponse) {
+	p.hdr(r.Header)
+	fmt.Printf(`"Roles" :`)
+	for _, role := range r.Roles {
+		fmt.Printf(" %q", role)
+	}
+	fmt.Println()
+	fmt.Println(`"PasswordChangedAt" :`, r.PasswordChangedAt)
+	fmt.Println(`"FailedLogins" :`, r.FailedLogins)
+	fmt.Println(`"LockedUntil" :`, r.LockedUntil)
+}
 func (p *fieldsPrinter) UserGrantRole(user string, role string, r v3.AuthUserGrantRoleResponse) {
 	p.hdr(r.Header)
 }
@@ -223,3 +356,19 @@ func (p *fieldsPrinter) UserRevokeRole(user string, role string, r v3.AuthUserRe
 	p.hdr(r.Header)
 }
 func (p *fieldsPrinter) UserDelete(user string, r v3.AuthUserDeleteResponse) { p.hdr(r.Header) }
+
+func (p *fieldsPrinter) AuthDenials(r v3.AuthDenialsResponse) {
+	p.hdr(r.Header)
+	for _, d := range r.Denials {
+		fmt.Println(`"Time" :`, d.Time)
+		fmt.Printf("\"User\" : %q\n", d.User)
+		fmt.Printf("\"Op\" : %q\n", d.Op)
+		fmt.Printf("\"Key\" : %q\n", d.Key)
+		fmt.Printf("\"RangeEnd\" : %q\n", d.RangeEnd)
+		fmt.Printf("\"Caller\" : %q\n", d.Caller)
+		fmt.Printf("\"App\" : %q\n", d.App)
+		fmt.Printf("\"RequestID\" : %q\n", d.RequestId)
+		fmt.Printf("\"Priority\" : %q\n", d.Priority)
+		fmt.Println()
+	}
+}
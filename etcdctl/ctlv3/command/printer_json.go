@@ -22,6 +22,7 @@ import (
 	"strconv"
 
 	clientv3 "github.com/ls-2018/etcd_cn/client_sdk/v3"
+	"github.com/ls-2018/etcd_cn/pkg/topology"
 )
 
 type jsonPrinter struct {
@@ -41,6 +42,17 @@ func (p *jsonPrinter) EndpointStatus(r []epStatus) {
 	printJSON(r)
 }
 func (p *jsonPrinter) EndpointHashKV(r []epHashKV) { printJSON(r) }
+func (p *jsonPrinter) EndpointCerts(r []epCerts)   { printJSON(r) }
+
+func (p *jsonPrinter) EndpointLogLevels(r []epLogLevels)   { printJSON(r) }
+func (p *jsonPrinter) EndpointFailpoints(r []epFailpoints) { printJSON(r) }
+func (p *jsonPrinter) EndpointPeerStats(r []epPeerStats)   { printJSON(r) }
+
+func (p *jsonPrinter) ClusterTopology(r topology.Report) { printJSON(r) }
+func (p *jsonPrinter) ClusterUpgrade(r upgradePlan)      { printJSON(r) }
+func (p *jsonPrinter) MirrorProgress(r mirrorProgress)   { printJSON(r) }
+
+func (p *jsonPrinter) LeasesDetail(r []clientv3.LeaseTimeToLiveResponse) { printJSON(r) }
 
 func (p *jsonPrinter) MemberList(r clientv3.MemberListResponse) {
 	if p.isHex {
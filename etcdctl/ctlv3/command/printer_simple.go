@@ -18,9 +18,12 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/ls-2018/etcd_cn/client_sdk/pkg/types"
 	v3 "github.com/ls-2018/etcd_cn/client_sdk/v3"
+	"github.com/ls-2018/etcd_cn/offical/api/v3/authpb"
+	"github.com/ls-2018/etcd_cn/pkg/topology"
 )
 
 type simplePrinter struct {
@@ -108,6 +111,9 @@ func (s *simplePrinter) TimeToLive(resp v3.LeaseTimeToLiveResponse, keys bool) {
 		}
 		txt += fmt.Sprintf(", attached keys(%v)", ks)
 	}
+	if resp.Metadata != "" {
+		txt += fmt.Sprintf(", metadata(%q)", resp.Metadata)
+	}
 	fmt.Println("TimeToLive--->", txt)
 }
 
@@ -118,6 +124,26 @@ func (s *simplePrinter) Leases(resp v3.LeaseLeasesResponse) {
 	}
 }
 
+func (s *simplePrinter) LeaseWatch(resp v3.LeaseWatchResponse) {
+	for _, e := range resp.Events {
+		txt := fmt.Sprintf("%s lease %016x TTL(%ds) granted TTL(%ds)", e.Type, e.ID, e.TTL, e.GrantedTTL)
+		if e.Parent != 0 {
+			txt += fmt.Sprintf(", parent(%016x)", e.Parent)
+		}
+		if e.Metadata != "" {
+			txt += fmt.Sprintf(", metadata(%q)", e.Metadata)
+		}
+		fmt.Println(txt)
+	}
+}
+
+func (s *simplePrinter) LeasesDetail(ls []v3.LeaseTimeToLiveResponse) {
+	_, rows := makeLeasesDetailTable(ls)
+	for _, row := range rows {
+		fmt.Println(strings.Join(row, ", "))
+	}
+}
+
 func (s *simplePrinter) Alarm(resp v3.AlarmResponse) {
 	for _, e := range resp.Alarms {
 		fmt.Printf("%+v\n", e)
@@ -140,6 +166,18 @@ func (s *simplePrinter) MemberPromote(id uint64, r v3.MemberPromoteResponse) {
 	fmt.Printf("Member %16x promoted in cluster %16x\n", id, r.Header.ClusterId)
 }
 
+func (s *simplePrinter) MemberBatchChange(promoted, removed []uint64, r v3.MemberBatchChangeResponse) {
+	for _, m := range r.Added {
+		fmt.Printf("Member %16x added to cluster %16x\n", m.ID, r.Header.ClusterId)
+	}
+	for _, id := range promoted {
+		fmt.Printf("Member %16x promoted in cluster %16x\n", id, r.Header.ClusterId)
+	}
+	for _, id := range removed {
+		fmt.Printf("Member %16x removed from cluster %16x\n", id, r.Header.ClusterId)
+	}
+}
+
 func (s *simplePrinter) MemberList(resp v3.MemberListResponse) {
 	_, rows := makeMemberListTable(resp)
 	for _, row := range rows {
@@ -162,6 +200,12 @@ func (s *simplePrinter) EndpointStatus(statusList []epStatus) {
 	for _, row := range rows {
 		fmt.Println(strings.Join(row, ", "))
 	}
+	if epStatusDetail {
+		_, rows = makeEndpointLatencyTable(statusList)
+		for _, row := range rows {
+			fmt.Println(strings.Join(row, ", "))
+		}
+	}
 }
 
 func (s *simplePrinter) EndpointHashKV(hashList []epHashKV) {
@@ -171,6 +215,89 @@ func (s *simplePrinter) EndpointHashKV(hashList []epHashKV) {
 	}
 }
 
+func (s *simplePrinter) EndpointCerts(certsList []epCerts) {
+	_, rows := makeEndpointCertsTable(certsList)
+	for _, row := range rows {
+		fmt.Println(strings.Join(row, ", "))
+	}
+}
+
+func (s *simplePrinter) EndpointLogLevels(lvList []epLogLevels) {
+	_, rows := makeEndpointLogLevelsTable(lvList)
+	for _, row := range rows {
+		fmt.Println(strings.Join(row, ", "))
+	}
+}
+
+func (s *simplePrinter) EndpointFailpoints(fpList []epFailpoints) {
+	_, rows := makeEndpointFailpointsTable(fpList)
+	for _, row := range rows {
+		fmt.Println(strings.Join(row, ", "))
+	}
+}
+
+func (s *simplePrinter) EndpointPeerStats(psList []epPeerStats) {
+	_, rows := makeEndpointPeerStatsTable(psList)
+	for _, row := range rows {
+		fmt.Println(strings.Join(row, ", "))
+	}
+}
+
+func (s *simplePrinter) ClusterTopology(r topology.Report) {
+	_, rows := makeClusterTopologyTable(r)
+	for _, row := range rows {
+		fmt.Println(strings.Join(row, ", "))
+	}
+	fmt.Println(clusterTopologySummary(r))
+}
+
+func (s *simplePrinter) ClusterUpgrade(p upgradePlan) {
+	fmt.Printf("集群版本: %s, 目标版本: %s\n", p.ClusterVersion, p.TargetVersion)
+	for _, m := range p.Members {
+		state := "待升级"
+		switch {
+		case m.Error != "":
+			state = "不可用"
+		case m.Upgraded:
+			state = "已升级"
+		}
+		fmt.Printf("%s, %s, %s, leader=%v, learner=%v, %s\n", m.ID, m.Name, m.Version, m.IsLeader, m.IsLearner, state)
+	}
+	if len(p.Problems) > 0 {
+		fmt.Println("未满足的前置条件:")
+		for _, pr := range p.Problems {
+			fmt.Printf("  - %s\n", pr)
+		}
+		return
+	}
+	switch {
+	case p.Promoted:
+		fmt.Printf("集群版本已提升到 %s\n", p.ClusterVersion)
+	case p.ClusterVersion == p.TargetVersion:
+		fmt.Println("集群已经完成升级")
+	case len(p.RestartOrder) == 0:
+		fmt.Println("所有成员都已运行目标版本,使用 --promote 提升集群版本")
+	default:
+		fmt.Println("依次升级并重启以下成员,每个成员重启后确认 endpoint health 正常再继续:")
+		for i, m := range p.RestartOrder {
+			note := ""
+			if m.IsLeader {
+				note = " (leader,重启前先用 move-leader 把leader转移到已升级的成员)"
+			}
+			fmt.Printf("  %d. %s %s%s\n", i+1, memberDesc(m), m.Endpoint, note)
+		}
+	}
+}
+
+func (s *simplePrinter) MirrorProgress(p mirrorProgress) {
+	stage := "增量"
+	if p.Base {
+		stage = "全量"
+	}
+	fmt.Printf("已复制: %d, 速度: %.1f/s, 源revision: %d, 已复制到: %d, 落后: %d (%s)\n",
+		p.Count, p.Throughput, p.SourceRevision, p.Revision, p.Lag, stage)
+}
+
 func (s *simplePrinter) MoveLeader(leader, target uint64, r v3.MoveLeaderResponse) {
 	fmt.Printf("Leadership transferred from %s to %s\n", types.ID(leader), types.ID(target))
 }
@@ -197,27 +324,49 @@ func (s *simplePrinter) RoleGet(role string, r v3.AuthRoleGetResponse) {
 		fmt.Printf("\n")
 	}
 
-	for _, perm := range r.Perm {
-		if perm.PermType == v3.PermRead || perm.PermType == v3.PermReadWrite {
-			if len(perm.RangeEnd) == 0 {
-				fmt.Printf("\t%s\n", perm.Key)
-			} else {
-				printRange((*v3.Permission)(perm))
+	printPerms := func(deny bool, types ...authpb.Permission_Type) {
+		for _, perm := range r.Perm {
+			if perm.Deny != deny {
+				continue
+			}
+			for _, t := range types {
+				if perm.PermType != t {
+					continue
+				}
+				if len(perm.RangeEnd) == 0 {
+					fmt.Printf("\t%s\n", perm.Key)
+				} else {
+					printRange((*v3.Permission)(perm))
+				}
 			}
 		}
 	}
-	fmt.Println("---->KV Write:")
+	hasDeny := false
 	for _, perm := range r.Perm {
-		if perm.PermType == v3.PermWrite || perm.PermType == v3.PermReadWrite {
-			if len(perm.RangeEnd) == 0 {
-				fmt.Printf("\t%s\n", perm.Key)
-			} else {
-				printRange((*v3.Permission)(perm))
-			}
+		hasDeny = hasDeny || perm.Deny
+	}
+
+	printPerms(false, v3.PermRead, v3.PermReadWrite)
+	fmt.Println("---->KV Write:")
+	printPerms(false, v3.PermWrite, v3.PermReadWrite)
+	if hasDeny {
+		fmt.Println("---->KV Read Deny:")
+		printPerms(true, v3.PermRead, v3.PermReadWrite)
+		fmt.Println("---->KV Write Deny:")
+		printPerms(true, v3.PermWrite, v3.PermReadWrite)
+	}
+	if len(r.Operations) > 0 {
+		fmt.Println("---->Operations:")
+		for _, op := range r.Operations {
+			fmt.Printf("\t%s\n", op)
 		}
 	}
 }
 
+func (s *simplePrinter) RoleRevokeOperation(role string, op string, r v3.AuthRoleRevokePermissionResponse) {
+	fmt.Printf("Operation %s is revoked from role %s\n", op, role)
+}
+
 func (s *simplePrinter) RoleList(r v3.AuthRoleListResponse) {
 	for _, role := range r.Roles {
 		fmt.Printf("%s\n", role)
@@ -255,6 +404,15 @@ func (s *simplePrinter) UserGet(name string, r v3.AuthUserGetResponse) {
 		fmt.Printf(" %s", role)
 	}
 	fmt.Printf("\n")
+	if r.PasswordChangedAt > 0 {
+		fmt.Printf("Password changed: %s\n", time.Unix(r.PasswordChangedAt, 0).Format(time.RFC3339))
+	}
+	if r.LockedUntil > time.Now().Unix() {
+		fmt.Printf("Locked until: %s\n", time.Unix(r.LockedUntil, 0).Format(time.RFC3339))
+	}
+	if r.FailedLogins > 0 {
+		fmt.Printf("Failed logins: %d\n", r.FailedLogins)
+	}
 }
 
 func (s *simplePrinter) UserChangePassword(v3.AuthUserChangePasswordResponse) {
@@ -283,3 +441,10 @@ func (s *simplePrinter) AuthStatus(r v3.AuthStatusResponse) {
 	fmt.Println("身份认证是否开启:", r.Enabled)
 	fmt.Println("验证版本:", r.AuthRevision)
 }
+
+func (s *simplePrinter) AuthDenials(r v3.AuthDenialsResponse) {
+	_, rows := makeAuthDenialsTable(r)
+	for _, row := range rows {
+		fmt.Println(strings.Join(row, ", "))
+	}
+}
@@ -15,9 +15,11 @@
 package command
 
 import (
+	"fmt"
 	"os"
 
 	v3 "github.com/ls-2018/etcd_cn/client_sdk/v3"
+	"github.com/ls-2018/etcd_cn/pkg/topology"
 
 	"github.com/olekukonko/tablewriter"
 )
@@ -55,6 +57,16 @@ func (tp *tablePrinter) EndpointStatus(r []epStatus) {
 	}
 	table.SetAlignment(tablewriter.ALIGN_RIGHT)
 	table.Render()
+	if epStatusDetail {
+		hdr, rows = makeEndpointLatencyTable(r)
+		table = tablewriter.NewWriter(os.Stdout)
+		table.SetHeader(hdr)
+		for _, row := range rows {
+			table.Append(row)
+		}
+		table.SetAlignment(tablewriter.ALIGN_RIGHT)
+		table.Render()
+	}
 }
 
 func (tp *tablePrinter) EndpointHashKV(r []epHashKV) {
@@ -67,3 +79,81 @@ func (tp *tablePrinter) EndpointHashKV(r []epHashKV) {
 	table.SetAlignment(tablewriter.ALIGN_RIGHT)
 	table.Render()
 }
+
+func (tp *tablePrinter) EndpointCerts(r []epCerts) {
+	hdr, rows := makeEndpointCertsTable(r)
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader(hdr)
+	for _, row := range rows {
+		table.Append(row)
+	}
+	table.SetAlignment(tablewriter.ALIGN_RIGHT)
+	table.Render()
+}
+
+func (tp *tablePrinter) EndpointLogLevels(r []epLogLevels) {
+	hdr, rows := makeEndpointLogLevelsTable(r)
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader(hdr)
+	for _, row := range rows {
+		table.Append(row)
+	}
+	table.SetAlignment(tablewriter.ALIGN_RIGHT)
+	table.Render()
+}
+
+func (tp *tablePrinter) EndpointFailpoints(r []epFailpoints) {
+	hdr, rows := makeEndpointFailpointsTable(r)
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader(hdr)
+	for _, row := range rows {
+		table.Append(row)
+	}
+	table.SetAlignment(tablewriter.ALIGN_RIGHT)
+	table.Render()
+}
+
+func (tp *tablePrinter) EndpointPeerStats(r []epPeerStats) {
+	hdr, rows := makeEndpointPeerStatsTable(r)
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader(hdr)
+	for _, row := range rows {
+		table.Append(row)
+	}
+	table.SetAlignment(tablewriter.ALIGN_RIGHT)
+	table.Render()
+}
+
+func (tp *tablePrinter) ClusterTopology(r topology.Report) {
+	hdr, rows := makeClusterTopologyTable(r)
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader(hdr)
+	for _, row := range rows {
+		table.Append(row)
+	}
+	table.SetAlignment(tablewriter.ALIGN_RIGHT)
+	table.Render()
+	fmt.Println(clusterTopologySummary(r))
+}
+
+func (tp *tablePrinter) LeasesDetail(r []v3.LeaseTimeToLiveResponse) {
+	hdr, rows := makeLeasesDetailTable(r)
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader(hdr)
+	for _, row := range rows {
+		table.Append(row)
+	}
+	table.SetAlignment(tablewriter.ALIGN_RIGHT)
+	table.Render()
+}
+
+func (tp *tablePrinter) AuthDenials(r v3.AuthDenialsResponse) {
+	hdr, rows := makeAuthDenialsTable(r)
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader(hdr)
+	for _, row := range rows {
+		table.Append(row)
+	}
+	table.SetAlignment(tablewriter.ALIGN_RIGHT)
+	table.Render()
+}
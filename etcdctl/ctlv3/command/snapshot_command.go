@@ -18,7 +18,9 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"time"
 
+	clientv3 "github.com/ls-2018/etcd_cn/client_sdk/v3"
 	snapshot "github.com/ls-2018/etcd_cn/client_sdk/v3/snapshot"
 	"github.com/ls-2018/etcd_cn/etcdutl/etcdutl"
 	"github.com/ls-2018/etcd_cn/pkg/cobrautl"
@@ -39,6 +41,11 @@ var (
 	restorePeerURLs     string
 	restoreName         string
 	skipHashCheck       bool
+
+	sessionTTL     int64
+	sessionRev     int64
+	sessionToken   string
+	sessionRelease bool
 )
 
 // NewSnapshotCommand returns the cobra command for "snapshot".
@@ -50,9 +57,56 @@ func NewSnapshotCommand() *cobra.Command {
 	cmd.AddCommand(NewSnapshotSaveCommand())
 	cmd.AddCommand(NewSnapshotRestoreCommand())
 	cmd.AddCommand(newSnapshotStatusCommand())
+	cmd.AddCommand(NewSnapshotSessionCommand())
 	return cmd
 }
 
+// NewSnapshotSessionCommand returns the cobra command for "snapshot session".
+func NewSnapshotSessionCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "session [--ttl <seconds>] [--rev <revision>] [--token <token> [--release]]",
+		Short: "创建、续期或释放快照会话;会话固定的修订版本在有效期内不会被自动压缩",
+		Long: `不指定 --token 时创建新的快照会话并输出token;之后的 get --snapshot-token <token> 都在会话固定的修订版本上读取,
+跨多次分页请求的列表和备份因此是一致的.指定 --token 时续期该会话,和 --release 一起使用时释放该会话.`,
+		Run: snapshotSessionCommandFunc,
+	}
+	cmd.Flags().Int64Var(&sessionTTL, "ttl", 60, "会话的有效期,单位秒")
+	cmd.Flags().Int64Var(&sessionRev, "rev", 0, "新会话固定的修订版本,0表示当前修订版本")
+	cmd.Flags().StringVar(&sessionToken, "token", "", "要续期或释放的会话")
+	cmd.Flags().BoolVar(&sessionRelease, "release", false, "释放 --token 指定的会话")
+	return cmd
+}
+
+func snapshotSessionCommandFunc(cmd *cobra.Command, args []string) {
+	if sessionRelease && sessionToken == "" {
+		cobrautl.ExitWithError(cobrautl.ExitBadArgs, fmt.Errorf("--release requires --token"))
+	}
+	c := mustClientFromCmd(cmd)
+	ctx, cancel := commandCtx(cmd)
+	var (
+		resp *clientv3.SnapshotSessionResponse
+		err  error
+	)
+	ttl := time.Duration(sessionTTL) * time.Second
+	switch {
+	case sessionRelease:
+		resp, err = c.ReleaseSnapshotSession(ctx, sessionToken)
+	case sessionToken != "":
+		resp, err = c.KeepAliveSnapshotSession(ctx, sessionToken, ttl)
+	default:
+		resp, err = c.SnapshotSession(ctx, sessionRev, ttl)
+	}
+	cancel()
+	if err != nil {
+		cobrautl.ExitWithError(cobrautl.ExitError, err)
+	}
+	if sessionRelease {
+		fmt.Printf("快照会话 %s 已释放\n", resp.Token)
+		return
+	}
+	fmt.Printf("token: %s\nrevision: %d\nexpires: %s\n", resp.Token, resp.Revision, time.Unix(resp.Expires, 0).Format(time.RFC3339))
+}
+
 func NewSnapshotSaveCommand() *cobra.Command {
 	return &cobra.Command{
 		Use:   "save <filename>",
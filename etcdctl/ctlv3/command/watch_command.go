@@ -43,6 +43,11 @@ var (
 	watchInteractive bool
 	watchPrevKey     bool
 	progressNotify   bool
+	watchProjections []string
+	watchValueHash   bool
+	watchKeyGlob     string
+	watchKeyRegex    string
+	watchChangedOnly bool
 )
 
 func NewWatchCommand() *cobra.Command {
@@ -57,6 +62,11 @@ func NewWatchCommand() *cobra.Command {
 	cmd.Flags().Int64Var(&watchRev, "rev", 0, "从那个修订版本开始监听")
 	cmd.Flags().BoolVar(&watchPrevKey, "prev-kv", false, "获取事件发生之前的键值对")
 	cmd.Flags().BoolVar(&progressNotify, "progress-notify", false, "从etcd获取定期的监听进度通知")
+	cmd.Flags().StringArrayVar(&watchProjections, "projection", nil, "只返回value的JSONPath投影,如 $.status.phase,可指定多次")
+	cmd.Flags().BoolVar(&watchValueHash, "value-hash", false, "只返回value的sha256摘要")
+	cmd.Flags().StringVar(&watchKeyGlob, "key-glob", "", "只接收key匹配glob模式的事件,'*'不匹配'/'")
+	cmd.Flags().StringVar(&watchKeyRegex, "key-regex", "", "只接收key匹配正则表达式的事件")
+	cmd.Flags().BoolVar(&watchChangedOnly, "changed-only", false, "过滤掉没有改变value的put事件")
 	return cmd
 }
 
@@ -158,6 +168,24 @@ func getWatchChan(c *clientv3.Client, args []string) (clientv3.WatchChan, error)
 	if progressNotify {
 		opts = append(opts, clientv3.WithProgressNotify())
 	}
+	if len(watchProjections) > 0 && watchValueHash {
+		return nil, fmt.Errorf("`--projection` and `--value-hash` are mutually exclusive")
+	}
+	if len(watchProjections) > 0 {
+		opts = append(opts, clientv3.WithProjections(watchProjections...))
+	}
+	if watchValueHash {
+		opts = append(opts, clientv3.WithValueHash())
+	}
+	if watchKeyGlob != "" {
+		opts = append(opts, clientv3.WithKeyGlob(watchKeyGlob))
+	}
+	if watchKeyRegex != "" {
+		opts = append(opts, clientv3.WithKeyRegex(watchKeyRegex))
+	}
+	if watchChangedOnly {
+		opts = append(opts, clientv3.WithFilterUnchanged())
+	}
 	return c.Watch(clientv3.WithRequireLeader(context.Background()), key, opts...), nil
 }
 
@@ -0,0 +1,244 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdutl
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ls-2018/etcd_cn/etcd/datadir"
+	"github.com/ls-2018/etcd_cn/etcd/lease/leasepb"
+	"github.com/ls-2018/etcd_cn/etcd/mvcc/buckets"
+	"github.com/ls-2018/etcd_cn/offical/api/v3/authpb"
+	"github.com/ls-2018/etcd_cn/offical/api/v3/mvccpb"
+	pb "github.com/ls-2018/etcd_cn/offical/etcdserverpb"
+	"github.com/ls-2018/etcd_cn/pkg/cobrautl"
+	"github.com/spf13/cobra"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	backendDataDir string
+	backendBucket  string
+	backendLimit   int
+)
+
+// NewBackendCommand returns the cobra command for "backend".
+func NewBackendCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "backend <subcommand>",
+		Short: "离线解码并查看后端中各个桶的内容",
+	}
+	cmd.PersistentFlags().StringVar(&backendDataDir, "data-dir", "", "Path to the etcd data dir")
+	cmd.PersistentFlags().StringVar(&backendBucket, "bucket", "key", "要查看的桶(key, lease, auth, authUsers, authRoles, meta, alarm ...)")
+	cmd.MarkPersistentFlagRequired("data-dir")
+	cmd.AddCommand(newBackendListCommand())
+	cmd.AddCommand(newBackendGetCommand())
+	return cmd
+}
+
+func newBackendListCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "按存储顺序列出桶中解码后的全部条目",
+		Run:   backendListCommandFunc,
+	}
+	cmd.Flags().IntVar(&backendLimit, "limit", 0, "最多列出的条目数(0表示不限制)")
+	return cmd
+}
+
+func newBackendGetCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "get <key>",
+		Short: "查看桶中指定的条目; key桶中按用户的key匹配,返回该key保存的所有版本",
+		Long: "<key> 与 list 输出的key相同,例如key桶中的 5_0、lease桶中十六进制的租约ID;" +
+			"key桶中也可以直接使用用户的key.",
+		Run: backendGetCommandFunc,
+	}
+}
+
+type backendEntry struct {
+	Key   string      `json:"key"`
+	Value interface{} `json:"value"`
+}
+
+type backendReport struct {
+	Bucket  string         `json:"bucket"`
+	Entries []backendEntry `json:"entries"`
+}
+
+func backendListCommandFunc(cmd *cobra.Command, args []string) {
+	r, err := HandleBackend(backendDataDir, backendBucket, "", backendLimit)
+	if err != nil {
+		cobrautl.ExitWithError(cobrautl.ExitError, err)
+	}
+	initPrinterFromCmd(cmd).Backend(r)
+}
+
+func backendGetCommandFunc(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		cobrautl.ExitWithError(cobrautl.ExitBadArgs, fmt.Errorf("get command needs one key argument"))
+	}
+	r, err := HandleBackend(backendDataDir, backendBucket, args[0], 0)
+	if err != nil {
+		cobrautl.ExitWithError(cobrautl.ExitError, err)
+	}
+	if len(r.Entries) == 0 {
+		cobrautl.ExitWithError(cobrautl.ExitError, fmt.Errorf("key %q not found in bucket %q", args[0], backendBucket))
+	}
+	initPrinterFromCmd(cmd).Backend(r)
+}
+
+// HandleBackend 以只读方式解码 dataDir 后端中 bucket 桶的内容; key 不为空时只返回匹配的条目.
+func HandleBackend(dataDir, bucket, key string, limit int) (*backendReport, error) {
+	db, err := openMemberDB(datadir.ToBackendFileName(dataDir))
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	decode := backendDecoders[bucket]
+	if decode == nil {
+		decode = decodeRaw
+	}
+	r := &backendReport{Bucket: bucket}
+	err = db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return fmt.Errorf("bucket %q not found", bucket)
+		}
+		c := b.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			e, err := decode(k, v)
+			if err != nil {
+				return fmt.Errorf("failed to decode %q in bucket %q (%v)", k, bucket, err)
+			}
+			if key != "" && !backendKeyMatch(e, key) {
+				continue
+			}
+			r.Entries = append(r.Entries, e)
+			if limit > 0 && len(r.Entries) >= limit {
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func backendKeyMatch(e backendEntry, key string) bool {
+	if e.Key == key {
+		return true
+	}
+	kv, ok := e.Value.(*mvccpb.KeyValue)
+	return ok && kv.Key == key
+}
+
+var backendDecoders = map[string]func(k, v []byte) (backendEntry, error){
+	buckets.Key.String():       decodeKey,
+	buckets.Lease.String():     decodeLease,
+	buckets.Meta.String():      decodeMeta,
+	buckets.Alarm.String():     decodeAlarm,
+	buckets.Auth.String():      decodeAuth,
+	buckets.AuthUsers.String(): decodeAuthUser,
+	buckets.AuthRoles.String(): decodeAuthRole,
+}
+
+func decodeRaw(k, v []byte) (backendEntry, error) {
+	return backendEntry{Key: string(k), Value: string(v)}, nil
+}
+
+// decodeKey key桶的键是 主版本_子版本,删除标记的版本末尾多一个't'
+func decodeKey(k, v []byte) (backendEntry, error) {
+	if len(k) < 17 {
+		return backendEntry{}, fmt.Errorf("invalid revision length %d", len(k))
+	}
+	rev := fmt.Sprintf("%d_%d", binary.BigEndian.Uint64(k[0:8]), binary.BigEndian.Uint64(k[9:17]))
+	if len(k) == 18 && k[17] == 't' {
+		rev += "t"
+	}
+	var kv mvccpb.KeyValue
+	if err := kv.Unmarshal(v); err != nil {
+		return backendEntry{}, err
+	}
+	return backendEntry{Key: rev, Value: &kv}, nil
+}
+
+func decodeLease(k, v []byte) (backendEntry, error) {
+	if len(k) != 8 {
+		return backendEntry{}, fmt.Errorf("invalid lease ID length %d", len(k))
+	}
+	var l leasepb.Lease
+	if err := l.Unmarshal(v); err != nil {
+		return backendEntry{}, err
+	}
+	// 与etcdctl一样用十六进制显示租约ID
+	return backendEntry{Key: fmt.Sprintf("%016x", binary.BigEndian.Uint64(k)), Value: &l}, nil
+}
+
+func decodeMeta(k, v []byte) (backendEntry, error) {
+	e := backendEntry{Key: string(k), Value: string(v)}
+	switch e.Key {
+	case string(buckets.MetaScheduledCompactKeyName), string(buckets.MetaFinishedCompactKeyName):
+		e.Value = mainRevision(v)
+	default:
+		// consistent_index、term 等都是8字节的大端整数
+		if len(v) == 8 {
+			e.Value = binary.BigEndian.Uint64(v)
+		}
+	}
+	return e, nil
+}
+
+// decodeAlarm 报警桶的键是序列化的报警成员,值为空
+func decodeAlarm(k, v []byte) (backendEntry, error) {
+	var m pb.AlarmMember
+	if err := m.Unmarshal(k); err != nil {
+		return backendEntry{}, err
+	}
+	return backendEntry{Key: fmt.Sprintf("%x/%s", m.MemberID, m.Alarm), Value: &m}, nil
+}
+
+func decodeAuth(k, v []byte) (backendEntry, error) {
+	e := backendEntry{Key: string(k), Value: string(v)}
+	switch {
+	case e.Key == "authEnabled" && len(v) == 1:
+		e.Value = v[0] == 1
+	case len(v) == 8:
+		e.Value = binary.BigEndian.Uint64(v)
+	}
+	return e, nil
+}
+
+func decodeAuthUser(k, v []byte) (backendEntry, error) {
+	var u authpb.User
+	if err := u.Unmarshal(v); err != nil {
+		return backendEntry{}, err
+	}
+	// 不输出密码哈希
+	u.Password = ""
+	return backendEntry{Key: string(k), Value: &u}, nil
+}
+
+func decodeAuthRole(k, v []byte) (backendEntry, error) {
+	var r authpb.Role
+	if err := r.Unmarshal(v); err != nil {
+		return backendEntry{}, err
+	}
+	return backendEntry{Key: string(k), Value: &r}, nil
+}
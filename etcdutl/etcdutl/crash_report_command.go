@@ -0,0 +1,159 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdutl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver"
+	"github.com/ls-2018/etcd_cn/pkg/cobrautl"
+
+	"github.com/spf13/cobra"
+)
+
+var crashShowGoroutines bool
+
+// NewCrashReportCommand returns the cobra command for "crash-report".
+func NewCrashReportCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "crash-report <subcommand>",
+		Short: "查看etcd致命错误时写入的崩溃报告",
+	}
+	cmd.AddCommand(newCrashReportInspectCommand())
+	return cmd
+}
+
+func newCrashReportInspectCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "inspect <file or crash dir>",
+		Short: "显示崩溃报告;参数为目录时显示其中最新的报告",
+		Run:   crashReportInspectCommandFunc,
+	}
+	cmd.Flags().BoolVar(&crashShowGoroutines, "goroutines", false, "同时输出完整的goroutine dump(json格式总是包含)")
+	return cmd
+}
+
+func crashReportInspectCommandFunc(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		cobrautl.ExitWithError(cobrautl.ExitBadArgs, fmt.Errorf("crash-report inspect requires exactly one argument"))
+	}
+	printer := initPrinterFromCmd(cmd)
+
+	path, err := crashReportPath(args[0])
+	if err != nil {
+		cobrautl.ExitWithError(cobrautl.ExitError, err)
+	}
+	r, err := etcdserver.ReadCrashReport(path)
+	if err != nil {
+		cobrautl.ExitWithError(cobrautl.ExitError, err)
+	}
+	printer.CrashReport(path, r)
+}
+
+// crashReportPath 参数为目录时返回其中最新的崩溃报告
+func crashReportPath(p string) (string, error) {
+	fi, err := os.Stat(p)
+	if err != nil {
+		return "", err
+	}
+	if !fi.IsDir() {
+		return p, nil
+	}
+	fis, err := ioutil.ReadDir(p)
+	if err != nil {
+		return "", err
+	}
+	var names []string
+	for _, f := range fis {
+		if !f.IsDir() && strings.HasPrefix(f.Name(), "crash-") && strings.HasSuffix(f.Name(), ".json") {
+			names = append(names, f.Name())
+		}
+	}
+	if len(names) == 0 {
+		return "", fmt.Errorf("%q 中没有崩溃报告", p)
+	}
+	// 文件名中的时间按字典序即时间顺序
+	sort.Strings(names)
+	return filepath.Join(p, names[len(names)-1]), nil
+}
+
+// goroutineCount 统计goroutine dump中的goroutine数量
+func goroutineCount(dump string) int {
+	n := 0
+	for _, l := range strings.Split(dump, "\n") {
+		if strings.HasPrefix(l, "goroutine ") {
+			n++
+		}
+	}
+	return n
+}
+
+func makeCrashReportTable(r *etcdserver.CrashReport) (hdr []string, rows [][]string) {
+	hdr = []string{"index", "term", "type", "op", "size"}
+	for _, e := range r.RecentEntries {
+		rows = append(rows, []string{
+			fmt.Sprint(e.Index),
+			fmt.Sprint(e.Term),
+			e.Type,
+			e.Op,
+			fmt.Sprint(e.Size),
+		})
+	}
+	return hdr, rows
+}
+
+func makeCrashReportSummary(path string, r *etcdserver.CrashReport) [][]string {
+	rows := [][]string{
+		{"file", path},
+		{"time", r.Time.String()},
+		{"reason", r.Reason},
+		{"caller", r.Caller},
+		{"version", r.Version},
+		{"member id", r.MemberID},
+		{"cluster id", r.ClusterID},
+		{"consistent index", fmt.Sprint(r.ConsistentIndex)},
+		{"applied index", fmt.Sprint(r.AppliedIndex)},
+		{"committed index", fmt.Sprint(r.CommittedIndex)},
+		{"term", fmt.Sprint(r.Term)},
+		{"raft status", compactJSON(r.RaftStatus)},
+	}
+	keys := make([]string, 0, len(r.Config))
+	for k := range r.Config {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		rows = append(rows, []string{"config " + k, r.Config[k]})
+	}
+	for _, e := range r.CaptureErrors {
+		rows = append(rows, []string{"capture error", e})
+	}
+	return rows
+}
+
+func compactJSON(b []byte) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, b); err != nil {
+		return string(b)
+	}
+	return buf.String()
+}
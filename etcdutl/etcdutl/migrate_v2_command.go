@@ -0,0 +1,47 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdutl
+
+import (
+	"fmt"
+
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver"
+	"github.com/ls-2018/etcd_cn/pkg/cobrautl"
+	"github.com/spf13/cobra"
+)
+
+var migrateV2DataDir string
+
+// NewMigrateV2Command returns the cobra command for "migrate-v2".
+func NewMigrateV2Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate-v2",
+		Short: "把数据目录中v2store剩余的内容(包括成员信息)迁移到v3后端",
+		Long: "成员必须已经停止.从最新的快照和WAL恢复v2store,把成员信息写入后端的成员桶,把用户数据写入v2store桶," +
+			"校验数据目录后写入迁移标记;之后成员可以用 --v2-deprecation=write-only 及以上的阶段启动,v2store中已迁移的数据会被丢弃.",
+		Run: migrateV2CommandFunc,
+	}
+	cmd.Flags().StringVar(&migrateV2DataDir, "data-dir", "", "Path to the etcd data dir")
+	cmd.MarkFlagRequired("data-dir")
+	return cmd
+}
+
+func migrateV2CommandFunc(cmd *cobra.Command, args []string) {
+	r, err := etcdserver.MigrateV2Store(GetLogger(), migrateV2DataDir)
+	if err != nil {
+		cobrautl.ExitWithError(cobrautl.ExitError, fmt.Errorf("迁移v2store失败[%s] (%v)", migrateV2DataDir, err))
+	}
+	initPrinterFromCmd(cmd).MigrateV2(r)
+}
@@ -15,9 +15,11 @@
 package etcdutl
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver"
 	"github.com/ls-2018/etcd_cn/etcdutl/snapshot"
 	"github.com/ls-2018/etcd_cn/pkg/cobrautl"
 	"github.com/spf13/cobra"
@@ -29,6 +31,12 @@ var OutputFormat string
 
 type printer interface {
 	DBStatus(snapshot.Status)
+	CrashReport(string, *etcdserver.CrashReport)
+	Replay(*replayReport)
+	MigrateV2(*etcdserver.V2MigrateReport)
+	HashKV(*hashKVReport)
+	Revisions(*revisionsReport)
+	Backend(*backendReport)
 }
 
 func NewPrinter(printerType string) printer {
@@ -61,7 +69,13 @@ func newPrinterUnsupported(n string) printer {
 	return &printerUnsupported{printerRPC{nil, f}}
 }
 
-func (p *printerUnsupported) DBStatus(snapshot.Status) { p.p(nil) }
+func (p *printerUnsupported) DBStatus(snapshot.Status)                    { p.p(nil) }
+func (p *printerUnsupported) CrashReport(string, *etcdserver.CrashReport) { p.p(nil) }
+func (p *printerUnsupported) Replay(*replayReport)                        { p.p(nil) }
+func (p *printerUnsupported) MigrateV2(*etcdserver.V2MigrateReport)       { p.p(nil) }
+func (p *printerUnsupported) HashKV(*hashKVReport)                        { p.p(nil) }
+func (p *printerUnsupported) Revisions(*revisionsReport)                  { p.p(nil) }
+func (p *printerUnsupported) Backend(*backendReport)                      { p.p(nil) }
 
 func makeDBStatusTable(ds snapshot.Status) (hdr []string, rows [][]string) {
 	hdr = []string{"hash", "revision", "total keys", "total size"}
@@ -74,6 +88,88 @@ func makeDBStatusTable(ds snapshot.Status) (hdr []string, rows [][]string) {
 	return hdr, rows
 }
 
+func makeReplaySummary(r *replayReport) [][]string {
+	rows := [][]string{
+		{"first index", fmt.Sprint(r.FirstIndex)},
+		{"last index", fmt.Sprint(r.LastIndex)},
+		{"revision", fmt.Sprint(r.Revision)},
+		{"compact revision", fmt.Sprint(r.CompactRevision)},
+		{"hash", fmt.Sprintf("%x", r.Hash)},
+	}
+	if d := r.Divergence; d != nil {
+		rows = append(rows,
+			[]string{"divergent index", fmt.Sprint(d.Index)},
+			[]string{"divergent term", fmt.Sprint(d.Term)},
+			[]string{"divergent op", d.Op},
+			[]string{"divergent revision", fmt.Sprint(d.Revision)},
+			[]string{"divergent hash", fmt.Sprintf("%x (member %x)", d.Hash, d.MemberHash)},
+		)
+	}
+	return rows
+}
+
+func makeMigrateV2Summary(r *etcdserver.V2MigrateReport) [][]string {
+	return [][]string{
+		{"index", fmt.Sprint(r.Index)},
+		{"members", fmt.Sprint(r.Members)},
+		{"removed members", fmt.Sprint(r.RemovedMembers)},
+		{"cluster version", r.ClusterVersion},
+		{"keys", fmt.Sprint(r.Keys)},
+	}
+}
+
+func makeHashKVSummary(r *hashKVReport) [][]string {
+	return [][]string{
+		{"hash", fmt.Sprint(r.Hash)},
+		{"hash revision", fmt.Sprint(r.HashRevision)},
+		{"revision", fmt.Sprint(r.Revision)},
+		{"compact revision", fmt.Sprint(r.CompactRevision)},
+	}
+}
+
+func makeRevisionsSummary(r *revisionsReport) [][]string {
+	return [][]string{
+		{"first revision", fmt.Sprint(r.FirstRevision)},
+		{"revision", fmt.Sprint(r.Revision)},
+		{"compact revision", fmt.Sprint(r.CompactRevision)},
+		{"scheduled compact revision", fmt.Sprint(r.ScheduledCompactRevision)},
+		{"revision count", fmt.Sprint(r.RevisionCount)},
+		{"consistent index", fmt.Sprint(r.ConsistentIndex)},
+		{"term", fmt.Sprint(r.Term)},
+	}
+}
+
+func makeBackendTable(r *backendReport) (hdr []string, rows [][]string) {
+	hdr = []string{"key", "value"}
+	for _, e := range r.Entries {
+		v, err := json.Marshal(e.Value)
+		if err != nil {
+			v = []byte(fmt.Sprint(e.Value))
+		}
+		rows = append(rows, []string{e.Key, string(v)})
+	}
+	return hdr, rows
+}
+
+func makeReplayCheckpointsTable(r *replayReport) (hdr []string, rows [][]string) {
+	hdr = []string{"index", "revision", "hash", "member hash", "status", "reason"}
+	for _, c := range r.Checkpoints {
+		memberHash := ""
+		if c.Status != replaySkipped {
+			memberHash = fmt.Sprintf("%x", c.MemberHash)
+		}
+		rows = append(rows, []string{
+			fmt.Sprint(c.Index),
+			fmt.Sprint(c.Revision),
+			fmt.Sprintf("%x", c.Hash),
+			memberHash,
+			c.Status,
+			c.Reason,
+		})
+	}
+	return hdr, rows
+}
+
 func initPrinterFromCmd(cmd *cobra.Command) (p printer) {
 	outputType, err := cmd.Flags().GetString("write-out")
 	if err != nil {
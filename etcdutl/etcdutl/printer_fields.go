@@ -17,6 +17,7 @@ package etcdutl
 import (
 	"fmt"
 
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver"
 	"github.com/ls-2018/etcd_cn/etcdutl/snapshot"
 )
 
@@ -28,3 +29,54 @@ func (p *fieldsPrinter) DBStatus(r snapshot.Status) {
 	fmt.Println(`"Keys" :`, r.TotalKey)
 	fmt.Println(`"Size" :`, r.TotalSize)
 }
+
+func (p *fieldsPrinter) CrashReport(path string, r *etcdserver.CrashReport) {
+	for _, row := range makeCrashReportSummary(path, r) {
+		fmt.Printf("%q : %q\n", row[0], row[1])
+	}
+	fmt.Println(`"goroutines" :`, goroutineCount(r.Goroutines))
+	for _, e := range r.RecentEntries {
+		fmt.Printf("\"entry\" : %d %d %s %s %d\n", e.Index, e.Term, e.Type, e.Op, e.Size)
+	}
+}
+
+func (p *fieldsPrinter) MigrateV2(r *etcdserver.V2MigrateReport) {
+	for _, row := range makeMigrateV2Summary(r) {
+		fmt.Printf("%q : %q\n", row[0], row[1])
+	}
+}
+
+func (p *fieldsPrinter) HashKV(r *hashKVReport) {
+	fmt.Println(`"Hash" :`, r.Hash)
+	fmt.Println(`"HashRevision" :`, r.HashRevision)
+	fmt.Println(`"Revision" :`, r.Revision)
+	fmt.Println(`"CompactRevision" :`, r.CompactRevision)
+}
+
+func (p *fieldsPrinter) Revisions(r *revisionsReport) {
+	fmt.Println(`"FirstRevision" :`, r.FirstRevision)
+	fmt.Println(`"Revision" :`, r.Revision)
+	fmt.Println(`"CompactRevision" :`, r.CompactRevision)
+	fmt.Println(`"ScheduledCompactRevision" :`, r.ScheduledCompactRevision)
+	fmt.Println(`"RevisionCount" :`, r.RevisionCount)
+	fmt.Println(`"ConsistentIndex" :`, r.ConsistentIndex)
+	fmt.Println(`"Term" :`, r.Term)
+}
+
+func (p *fieldsPrinter) Backend(r *backendReport) {
+	fmt.Printf("\"Bucket\" : %q\n", r.Bucket)
+	_, rows := makeBackendTable(r)
+	for _, row := range rows {
+		fmt.Printf("\"Key\" : %q\n", row[0])
+		fmt.Printf("\"Value\" : %q\n", row[1])
+	}
+}
+
+func (p *fieldsPrinter) Replay(r *replayReport) {
+	for _, row := range makeReplaySummary(r) {
+		fmt.Printf("%q : %q\n", row[0], row[1])
+	}
+	for _, c := range r.Checkpoints {
+		fmt.Printf("\"checkpoint\" : %d %d %x %x %s %q\n", c.Index, c.Revision, c.Hash, c.MemberHash, c.Status, c.Reason)
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver"
 	"github.com/ls-2018/etcd_cn/etcdutl/snapshot"
 )
 
@@ -32,7 +33,13 @@ func newJSONPrinter() printer {
 	}
 }
 
-func (p *jsonPrinter) DBStatus(r snapshot.Status) { printJSON(r) }
+func (p *jsonPrinter) DBStatus(r snapshot.Status)                      { printJSON(r) }
+func (p *jsonPrinter) CrashReport(_ string, r *etcdserver.CrashReport) { printJSON(r) }
+func (p *jsonPrinter) Replay(r *replayReport)                          { printJSON(r) }
+func (p *jsonPrinter) MigrateV2(r *etcdserver.V2MigrateReport)         { printJSON(r) }
+func (p *jsonPrinter) HashKV(r *hashKVReport)                          { printJSON(r) }
+func (p *jsonPrinter) Revisions(r *revisionsReport)                    { printJSON(r) }
+func (p *jsonPrinter) Backend(r *backendReport)                        { printJSON(r) }
 
 // !!! Share ??
 func printJSON(v interface{}) {
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver"
 	"github.com/ls-2018/etcd_cn/etcdutl/snapshot"
 )
 
@@ -29,3 +30,54 @@ func (s *simplePrinter) DBStatus(ds snapshot.Status) {
 		fmt.Println(strings.Join(row, ", "))
 	}
 }
+
+func (s *simplePrinter) Replay(r *replayReport) {
+	for _, row := range makeReplaySummary(r) {
+		fmt.Printf("%s: %s\n", row[0], row[1])
+	}
+	_, rows := makeReplayCheckpointsTable(r)
+	for _, row := range rows {
+		fmt.Println(strings.Join(row, ", "))
+	}
+}
+
+func (s *simplePrinter) MigrateV2(r *etcdserver.V2MigrateReport) {
+	for _, row := range makeMigrateV2Summary(r) {
+		fmt.Printf("%s: %s\n", row[0], row[1])
+	}
+}
+
+func (s *simplePrinter) HashKV(r *hashKVReport) {
+	for _, row := range makeHashKVSummary(r) {
+		fmt.Printf("%s: %s\n", row[0], row[1])
+	}
+}
+
+func (s *simplePrinter) Revisions(r *revisionsReport) {
+	for _, row := range makeRevisionsSummary(r) {
+		fmt.Printf("%s: %s\n", row[0], row[1])
+	}
+}
+
+func (s *simplePrinter) Backend(r *backendReport) {
+	_, rows := makeBackendTable(r)
+	for _, row := range rows {
+		fmt.Printf("%s: %s\n", row[0], row[1])
+	}
+}
+
+func (s *simplePrinter) CrashReport(path string, r *etcdserver.CrashReport) {
+	for _, row := range makeCrashReportSummary(path, r) {
+		fmt.Printf("%s: %s\n", row[0], row[1])
+	}
+	fmt.Printf("goroutines: %d\n", goroutineCount(r.Goroutines))
+	fmt.Printf("recent applied entries: %d\n", len(r.RecentEntries))
+	_, rows := makeCrashReportTable(r)
+	for _, row := range rows {
+		fmt.Println(strings.Join(row, ", "))
+	}
+	if crashShowGoroutines {
+		fmt.Println()
+		fmt.Print(r.Goroutines)
+	}
+}
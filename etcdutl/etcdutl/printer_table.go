@@ -17,6 +17,7 @@ package etcdutl
 import (
 	"os"
 
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver"
 	"github.com/ls-2018/etcd_cn/etcdutl/snapshot"
 
 	"github.com/olekukonko/tablewriter"
@@ -34,3 +35,78 @@ func (tp *tablePrinter) DBStatus(r snapshot.Status) {
 	table.SetAlignment(tablewriter.ALIGN_RIGHT)
 	table.Render()
 }
+
+func (tp *tablePrinter) Replay(r *replayReport) {
+	summary := tablewriter.NewWriter(os.Stdout)
+	summary.SetHeader([]string{"field", "value"})
+	summary.AppendBulk(makeReplaySummary(r))
+	summary.SetAlignment(tablewriter.ALIGN_LEFT)
+	summary.Render()
+
+	if len(r.Checkpoints) == 0 {
+		return
+	}
+	hdr, rows := makeReplayCheckpointsTable(r)
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader(hdr)
+	for _, row := range rows {
+		table.Append(row)
+	}
+	table.SetAlignment(tablewriter.ALIGN_RIGHT)
+	table.Render()
+}
+
+func (tp *tablePrinter) MigrateV2(r *etcdserver.V2MigrateReport) {
+	summary := tablewriter.NewWriter(os.Stdout)
+	summary.SetHeader([]string{"field", "value"})
+	summary.AppendBulk(makeMigrateV2Summary(r))
+	summary.SetAlignment(tablewriter.ALIGN_LEFT)
+	summary.Render()
+}
+
+func (tp *tablePrinter) HashKV(r *hashKVReport) {
+	summary := tablewriter.NewWriter(os.Stdout)
+	summary.SetHeader([]string{"field", "value"})
+	summary.AppendBulk(makeHashKVSummary(r))
+	summary.SetAlignment(tablewriter.ALIGN_LEFT)
+	summary.Render()
+}
+
+func (tp *tablePrinter) Revisions(r *revisionsReport) {
+	summary := tablewriter.NewWriter(os.Stdout)
+	summary.SetHeader([]string{"field", "value"})
+	summary.AppendBulk(makeRevisionsSummary(r))
+	summary.SetAlignment(tablewriter.ALIGN_LEFT)
+	summary.Render()
+}
+
+func (tp *tablePrinter) Backend(r *backendReport) {
+	hdr, rows := makeBackendTable(r)
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader(hdr)
+	for _, row := range rows {
+		table.Append(row)
+	}
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.Render()
+}
+
+func (tp *tablePrinter) CrashReport(path string, r *etcdserver.CrashReport) {
+	summary := tablewriter.NewWriter(os.Stdout)
+	summary.SetHeader([]string{"field", "value"})
+	summary.AppendBulk(makeCrashReportSummary(path, r))
+	summary.SetAlignment(tablewriter.ALIGN_LEFT)
+	summary.Render()
+
+	hdr, rows := makeCrashReportTable(r)
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader(hdr)
+	for _, row := range rows {
+		table.Append(row)
+	}
+	table.SetAlignment(tablewriter.ALIGN_RIGHT)
+	table.Render()
+	if crashShowGoroutines {
+		os.Stdout.WriteString(r.Goroutines)
+	}
+}
@@ -0,0 +1,334 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdutl
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/ls-2018/etcd_cn/etcd/datadir"
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver"
+	"github.com/ls-2018/etcd_cn/etcd/lease"
+	"github.com/ls-2018/etcd_cn/etcd/mvcc"
+	"github.com/ls-2018/etcd_cn/etcd/mvcc/backend"
+	"github.com/ls-2018/etcd_cn/etcd/wal"
+	"github.com/ls-2018/etcd_cn/etcd/wal/walpb"
+	"github.com/ls-2018/etcd_cn/pkg/cobrautl"
+	"github.com/ls-2018/etcd_cn/raft/raftpb"
+	"github.com/spf13/cobra"
+
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/zap"
+)
+
+var (
+	replayDataDir    string
+	replayWalDir     string
+	replayUntilIndex uint64
+	replayVerify     bool
+)
+
+// NewReplayCommand returns the cobra command for "replay".
+func NewReplayCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "replay",
+		Short: "在全新的后端上重放wal日志,可与成员的后端逐个快照点比对哈希",
+		Long: "使用etcd真实的applier把wal中已提交的日志重新应用到临时的后端上;" +
+			"指定--verify时在每个快照点比较重放结果与成员后端的哈希,并定位第一个不一致的日志.",
+		Run: replayCommandFunc,
+	}
+	cmd.Flags().StringVar(&replayDataDir, "data-dir", "", "Path to the etcd data dir")
+	cmd.Flags().StringVar(&replayWalDir, "wal-dir", "", "Path to the etcd wal dir")
+	cmd.Flags().Uint64Var(&replayUntilIndex, "until-index", 0, "重放到该日志索引为止(0表示重放所有已提交的日志)")
+	cmd.Flags().BoolVar(&replayVerify, "verify", false, "与成员的后端比较哈希并定位第一个不一致的日志")
+	cmd.MarkFlagRequired("data-dir")
+	return cmd
+}
+
+// replayCheckpoint 一个快照点的比对结果
+type replayCheckpoint struct {
+	Index      uint64 `json:"index"`
+	Revision   int64  `json:"revision"`
+	Hash       uint32 `json:"hash"`
+	MemberHash uint32 `json:"member-hash,omitempty"`
+	Status     string `json:"status"`
+	Reason     string `json:"reason,omitempty"`
+}
+
+// replayDivergence 第一个使重放结果与成员后端不一致的日志
+type replayDivergence struct {
+	Index      uint64 `json:"index"`
+	Term       uint64 `json:"term"`
+	Op         string `json:"op"`
+	Revision   int64  `json:"revision"`
+	Hash       uint32 `json:"hash"`
+	MemberHash uint32 `json:"member-hash"`
+}
+
+type replayReport struct {
+	FirstIndex      uint64             `json:"first-index"`
+	LastIndex       uint64             `json:"last-index"`
+	Revision        int64              `json:"revision"`
+	CompactRevision int64              `json:"compact-revision"`
+	Hash            uint32             `json:"hash"`
+	Checkpoints     []replayCheckpoint `json:"checkpoints,omitempty"`
+	Divergence      *replayDivergence  `json:"divergence,omitempty"`
+}
+
+const (
+	replayMatch    = "match"
+	replayMismatch = "mismatch"
+	replaySkipped  = "skipped"
+)
+
+func replayCommandFunc(cmd *cobra.Command, args []string) {
+	printer := initPrinterFromCmd(cmd)
+	r, err := HandleReplay(GetLogger(), replayDataDir, replayWalDir, replayUntilIndex, replayVerify)
+	if err != nil {
+		cobrautl.ExitWithError(cobrautl.ExitError, err)
+	}
+	printer.Replay(r)
+	if r.Divergence != nil {
+		cobrautl.ExitWithError(cobrautl.ExitError, fmt.Errorf("replay diverged from member backend at index %d", r.Divergence.Index))
+	}
+	for _, c := range r.Checkpoints {
+		if c.Status == replayMismatch {
+			cobrautl.ExitWithError(cobrautl.ExitError, fmt.Errorf("replay diverged from member backend before index %d", c.Index))
+		}
+	}
+}
+
+// HandleReplay 重放 dataDir 中的wal日志,verify 为 true 时与成员的后端比较哈希.
+func HandleReplay(lg *zap.Logger, dataDir, walDir string, untilIndex uint64, verify bool) (*replayReport, error) {
+	if walDir == "" {
+		walDir = datadir.ToWalDir(dataDir)
+	}
+	ents, err := readReplayEntries(lg, walDir, untilIndex)
+	if err != nil {
+		return nil, err
+	}
+	r := &replayReport{FirstIndex: ents[0].Index, LastIndex: ents[len(ents)-1].Index}
+
+	tmpDir, err := ioutil.TempDir("", "etcdutl-replay")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var member mvcc.KV
+	if verify {
+		var closer func()
+		if member, closer, err = openMemberKV(lg, datadir.ToBackendFileName(dataDir), filepath.Join(tmpDir, "member.db")); err != nil {
+			return nil, err
+		}
+		defer closer()
+	}
+
+	rp, err := etcdserver.NewReplayer(lg, filepath.Join(tmpDir, "replay.db"))
+	if err != nil {
+		return nil, err
+	}
+	defer rp.Close()
+
+	boundaries, err := replayBoundaries(lg, walDir, r.LastIndex)
+	if err != nil {
+		return nil, err
+	}
+	var lastGood uint64
+	for _, e := range ents {
+		rp.Apply(e)
+		if !verify || len(boundaries) == 0 || e.Index != boundaries[0] {
+			continue
+		}
+		boundaries = boundaries[1:]
+		c, err := compareReplay(rp, member, e.Index)
+		if err != nil {
+			return nil, err
+		}
+		r.Checkpoints = append(r.Checkpoints, c)
+		if c.Status == replayMatch {
+			lastGood = e.Index
+		}
+		if c.Status == replayMismatch {
+			if r.Divergence, err = findDivergence(lg, ents, member, lastGood, e.Index, filepath.Join(tmpDir, "bisect.db")); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	// 发现不一致时重放停在对应的快照点
+	r.LastIndex = rp.ConsistentIndex()
+	if r.Hash, r.Revision, r.CompactRevision, err = rp.HashByRev(0); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// readReplayEntries 读取wal中全部已提交的日志,重放必须从第一条日志开始
+func readReplayEntries(lg *zap.Logger, walDir string, untilIndex uint64) ([]raftpb.Entry, error) {
+	w, err := wal.OpenForRead(lg, walDir, walpb.Snapshot{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open wal from index 1 (%v); replay requires the complete wal history", err)
+	}
+	defer w.Close()
+	_, state, ents, err := w.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(ents) == 0 {
+		return nil, fmt.Errorf("no entries found in wal %q", walDir)
+	}
+	if ents[0].Index != 1 {
+		return nil, fmt.Errorf("wal starts at index %d; replay requires the complete wal history", ents[0].Index)
+	}
+	last := state.Commit
+	if untilIndex != 0 {
+		if untilIndex > last {
+			return nil, fmt.Errorf("--until-index %d is beyond the last committed index %d", untilIndex, last)
+		}
+		last = untilIndex
+	}
+	if last < ents[0].Index {
+		return nil, fmt.Errorf("no committed entries found in wal %q", walDir)
+	}
+	return ents[:last-ents[0].Index+1], nil
+}
+
+// replayBoundaries 返回需要比对的快照点,最后一条重放的日志总是作为最后一个比对点
+func replayBoundaries(lg *zap.Logger, walDir string, last uint64) ([]uint64, error) {
+	snaps, err := wal.ValidSnapshotEntries(lg, walDir)
+	if err != nil {
+		return nil, err
+	}
+	var idxs []uint64
+	for _, s := range snaps {
+		if s.Index > 0 && s.Index < last {
+			idxs = append(idxs, s.Index)
+		}
+	}
+	idxs = append(idxs, last)
+	sort.Slice(idxs, func(i, j int) bool { return idxs[i] < idxs[j] })
+	uniq := idxs[:0]
+	for _, idx := range idxs {
+		if len(uniq) == 0 || uniq[len(uniq)-1] != idx {
+			uniq = append(uniq, idx)
+		}
+	}
+	return uniq, nil
+}
+
+// compareReplay 在重放当前的版本号处比较重放结果与成员后端的哈希;
+// 压缩版本不同或成员还没有该版本时哈希不可比,记为 skipped
+func compareReplay(rp *etcdserver.Replayer, member mvcc.KV, index uint64) (replayCheckpoint, error) {
+	c := replayCheckpoint{Index: index, Revision: rp.Rev()}
+	h, _, compactRev, err := rp.HashByRev(c.Revision)
+	if err != nil {
+		return c, err
+	}
+	c.Hash = h
+	mh, _, memberCompactRev, err := member.HashByRev(c.Revision)
+	switch {
+	case err == mvcc.ErrCompacted:
+		c.Status, c.Reason = replaySkipped, fmt.Sprintf("revision %d compacted on member", c.Revision)
+	case err == mvcc.ErrFutureRev:
+		c.Status, c.Reason = replaySkipped, fmt.Sprintf("member has not reached revision %d", c.Revision)
+	case err != nil:
+		return c, err
+	case compactRev != memberCompactRev:
+		c.Status, c.Reason = replaySkipped, fmt.Sprintf("compact revision %d differs from member %d", compactRev, memberCompactRev)
+	default:
+		c.MemberHash = mh
+		c.Status = replayMatch
+		if h != mh {
+			c.Status = replayMismatch
+		}
+	}
+	return c, nil
+}
+
+// findDivergence 从头重放一遍,在 (from, to] 区间内每次版本号变化后比较哈希,找到第一个不一致的日志
+func findDivergence(lg *zap.Logger, ents []raftpb.Entry, member mvcc.KV, from, to uint64, path string) (*replayDivergence, error) {
+	rp, err := etcdserver.NewReplayer(lg, path)
+	if err != nil {
+		return nil, err
+	}
+	defer rp.Close()
+
+	for _, e := range ents {
+		rev := rp.Rev()
+		op := rp.Apply(e)
+		if e.Index <= from || rp.Rev() == rev {
+			continue
+		}
+		c, err := compareReplay(rp, member, e.Index)
+		if err != nil {
+			return nil, err
+		}
+		if c.Status == replayMismatch {
+			return &replayDivergence{Index: e.Index, Term: e.Term, Op: op, Revision: c.Revision, Hash: c.Hash, MemberHash: c.MemberHash}, nil
+		}
+		if e.Index >= to {
+			break
+		}
+	}
+	lg.Warn("快照点之间没有可比对的版本,无法定位到具体的日志", zap.Uint64("from", from), zap.Uint64("to", to))
+	return nil, nil
+}
+
+// openMemberKV 以只读方式复制成员的后端后打开,避免修改成员的数据
+func openMemberKV(lg *zap.Logger, srcDB, destDB string) (mvcc.KV, func(), error) {
+	src, err := openMemberDB(srcDB)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = src.View(func(tx *bolt.Tx) error { return tx.CopyFile(destDB, 0o600) })
+	src.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	be := backend.NewDefaultBackend(destDB)
+	kv := mvcc.New(lg, be, &lease.FakeLessor{}, mvcc.StoreConfig{})
+	return kv, func() {
+		kv.Close()
+		be.Close()
+	}, nil
+}
+
+// openMemberDB 以只读方式打开成员的后端,成员仍在运行时等待文件锁超时返回错误
+func openMemberDB(path string) (*bolt.DB, error) {
+	ch := make(chan *bolt.DB, 1)
+	errc := make(chan error, 1)
+	go func() {
+		db, err := bolt.Open(path, 0o444, &bolt.Options{ReadOnly: true})
+		if err != nil {
+			errc <- err
+			return
+		}
+		ch <- db
+	}()
+	select {
+	case db := <-ch:
+		return db, nil
+	case err := <-errc:
+		return nil, err
+	case <-time.After(time.Second):
+		return nil, fmt.Errorf("timed out waiting to acquire lock on %q; stop the member first", path)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdutl
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ls-2018/etcd_cn/etcd/datadir"
+	"github.com/ls-2018/etcd_cn/etcd/mvcc/buckets"
+	"github.com/ls-2018/etcd_cn/pkg/cobrautl"
+	"github.com/spf13/cobra"
+	bolt "go.etcd.io/bbolt"
+)
+
+var revisionsDataDir string
+
+// NewRevisionsCommand returns the cobra command for "revisions".
+func NewRevisionsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "revisions",
+		Short: "离线查看成员后端中保存的版本范围与压缩版本",
+		Long: "成员必须已经停止.以只读方式打开后端,输出后端中最早和最新的版本、已完成及已计划的压缩版本和consistent index," +
+			"可用于在 hashkv 之前确定各成员都可比较的版本.",
+		Run: revisionsCommandFunc,
+	}
+	cmd.Flags().StringVar(&revisionsDataDir, "data-dir", "", "Path to the etcd data dir")
+	cmd.MarkFlagRequired("data-dir")
+	return cmd
+}
+
+type revisionsReport struct {
+	FirstRevision            int64  `json:"first-revision"`
+	Revision                 int64  `json:"revision"`
+	CompactRevision          int64  `json:"compact-revision"`
+	ScheduledCompactRevision int64  `json:"scheduled-compact-revision"`
+	RevisionCount            int    `json:"revision-count"`
+	ConsistentIndex          uint64 `json:"consistent-index"`
+	Term                     uint64 `json:"term"`
+}
+
+func revisionsCommandFunc(cmd *cobra.Command, args []string) {
+	r, err := HandleRevisions(revisionsDataDir)
+	if err != nil {
+		cobrautl.ExitWithError(cobrautl.ExitError, fmt.Errorf("读取版本信息失败[%s] (%v)", revisionsDataDir, err))
+	}
+	initPrinterFromCmd(cmd).Revisions(r)
+}
+
+// HandleRevisions 读取 dataDir 中后端的版本范围与压缩版本,不修改成员的数据.
+func HandleRevisions(dataDir string) (*revisionsReport, error) {
+	db, err := openMemberDB(datadir.ToBackendFileName(dataDir))
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	r := &revisionsReport{}
+	err = db.View(func(tx *bolt.Tx) error {
+		if kb := tx.Bucket(buckets.Key.Name()); kb != nil {
+			r.RevisionCount = kb.Stats().KeyN
+			c := kb.Cursor()
+			if k, _ := c.First(); k != nil {
+				r.FirstRevision = mainRevision(k)
+			}
+			if k, _ := c.Last(); k != nil {
+				r.Revision = mainRevision(k)
+			}
+		}
+		mb := tx.Bucket(buckets.Meta.Name())
+		if mb == nil {
+			return nil
+		}
+		r.CompactRevision = mainRevision(mb.Get(buckets.MetaFinishedCompactKeyName))
+		r.ScheduledCompactRevision = mainRevision(mb.Get(buckets.MetaScheduledCompactKeyName))
+		if v := mb.Get(buckets.MetaConsistentIndexKeyName); len(v) == 8 {
+			r.ConsistentIndex = binary.BigEndian.Uint64(v)
+		}
+		if v := mb.Get(buckets.MetaTermKeyName); len(v) == 8 {
+			r.Term = binary.BigEndian.Uint64(v)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// 压缩会删除旧的删除标记,当前版本与mvcc恢复时一样不小于压缩版本
+	if r.Revision < r.CompactRevision {
+		r.Revision = r.CompactRevision
+	}
+	return r, nil
+}
+
+// mainRevision 返回key桶中版本键的主版本号
+func mainRevision(k []byte) int64 {
+	if len(k) < 8 {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(k[:8]))
+}
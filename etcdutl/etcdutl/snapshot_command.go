@@ -37,6 +37,7 @@ var (
 	restoreWalDir       string
 	restorePeerURLs     string
 	restoreName         string
+	restoreManifest     string
 	skipHashCheck       bool
 )
 
@@ -73,8 +74,7 @@ func NewSnapshotRestoreCommand() *cobra.Command {
 	cmd.Flags().StringVar(&restorePeerURLs, "initial-advertise-peer-urls", defaultInitialAdvertisePeerURLs, "List of this member's peer URLs to advertise to the rest of the cluster")
 	cmd.Flags().StringVar(&restoreName, "name", defaultName, "Human-readable name for this member")
 	cmd.Flags().BoolVar(&skipHashCheck, "skip-hash-check", false, "Ignore snapshot integrity hash value (required if copied from data directory)")
-
-	cmd.MarkFlagRequired("data-dir")
+	cmd.Flags().StringVar(&restoreManifest, "cluster-manifest", "", "Path to a YAML cluster manifest; restores every listed member at once, --data-dir is then the parent directory of members without data-dir")
 
 	return cmd
 }
@@ -95,7 +95,19 @@ func SnapshotStatusCommandFunc(cmd *cobra.Command, args []string) {
 	printer.DBStatus(ds)
 }
 
-func snapshotRestoreCommandFunc(_ *cobra.Command, args []string) {
+func snapshotRestoreCommandFunc(cmd *cobra.Command, args []string) {
+	if restoreManifest != "" {
+		for _, f := range []string{"name", "initial-cluster", "initial-advertise-peer-urls", "wal-dir"} {
+			if cmd.Flags().Changed(f) {
+				cobrautl.ExitWithError(cobrautl.ExitBadArgs, fmt.Errorf("--%s conflicts with --cluster-manifest; set it per member in the manifest", f))
+			}
+		}
+		SnapshotRestoreClusterCommandFunc(restoreManifest, restoreClusterToken, restoreDataDir, skipHashCheck, args)
+		return
+	}
+	if restoreDataDir == "" {
+		cobrautl.ExitWithError(cobrautl.ExitBadArgs, fmt.Errorf("--data-dir is required"))
+	}
 	SnapshotRestoreCommandFunc(restoreCluster, restoreClusterToken, restoreDataDir, restoreWalDir, restorePeerURLs, restoreName, skipHashCheck, args)
 }
 
@@ -140,6 +152,36 @@ func SnapshotRestoreCommandFunc(restoreCluster string,
 	}
 }
 
+// SnapshotRestoreClusterCommandFunc 按集群清单恢复所有成员; 清单没有指定token时使用 restoreClusterToken
+func SnapshotRestoreClusterCommandFunc(manifestPath string,
+	restoreClusterToken string,
+	outputDir string,
+	skipHashCheck bool,
+	args []string,
+) {
+	if len(args) != 1 {
+		err := fmt.Errorf("snapshot restore requires exactly one argument")
+		cobrautl.ExitWithError(cobrautl.ExitBadArgs, err)
+	}
+	manifest, err := snapshot.LoadClusterManifest(manifestPath)
+	if err != nil {
+		cobrautl.ExitWithError(cobrautl.ExitBadArgs, err)
+	}
+	if manifest.Token == "" {
+		manifest.Token = restoreClusterToken
+	}
+
+	sp := snapshot.NewV3(GetLogger())
+	if err := sp.RestoreCluster(snapshot.RestoreClusterConfig{
+		SnapshotPath:  args[0],
+		Manifest:      manifest,
+		OutputDir:     outputDir,
+		SkipHashCheck: skipHashCheck,
+	}); err != nil {
+		cobrautl.ExitWithError(cobrautl.ExitError, err)
+	}
+}
+
 func initialClusterFromName(name string) string {
 	n := name
 	if name == "" {
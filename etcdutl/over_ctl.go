@@ -38,6 +38,12 @@ func init() {
 		etcdutl.NewBackupCommand(),   // 备份
 		etcdutl.NewDefragCommand(),   // 清理内存碎片
 		etcdutl.NewSnapshotCommand(), // 快照
+		etcdutl.NewCrashReportCommand(),
+		etcdutl.NewReplayCommand(),
+		etcdutl.NewMigrateV2Command(),
+		etcdutl.NewHashKVCommand(),
+		etcdutl.NewRevisionsCommand(),
+		etcdutl.NewBackendCommand(),
 	)
 }
 
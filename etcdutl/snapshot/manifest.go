@@ -0,0 +1,190 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/ls-2018/etcd_cn/client_sdk/pkg/fileutil"
+	"github.com/ls-2018/etcd_cn/client_sdk/pkg/types"
+	"github.com/ls-2018/etcd_cn/etcd/etcdserver/api/membership"
+	"go.uber.org/zap"
+	"sigs.k8s.io/yaml"
+)
+
+// ClusterManifest 描述恢复后集群的全部成员,例如:
+//
+//	token: etcd-cluster
+//	members:
+//	- name: m1
+//	  peer-urls: [http://10.0.0.1:2380]
+//	  id: 8e9e05c52164694d
+//	  data-dir: /var/lib/etcd/m1
+type ClusterManifest struct {
+	// Token 集群的initial-cluster-token,成员没有指定ID时参与生成成员ID
+	Token   string           `json:"token,omitempty"`
+	Members []ManifestMember `json:"members"`
+}
+
+// ManifestMember 集群清单中的一个成员
+type ManifestMember struct {
+	Name     string   `json:"name"`
+	PeerURLs []string `json:"peer-urls"`
+	// ID 十六进制的成员ID,为空时与 --initial-cluster 一样由peer URL和token生成
+	ID string `json:"id,omitempty"`
+	// DataDir 恢复的数据目录,为空时使用 [OutputDir]/[Name].etcd
+	DataDir string `json:"data-dir,omitempty"`
+	// WALDir 恢复的WAL目录,为空时使用 [DataDir]/member/wal
+	WALDir string `json:"wal-dir,omitempty"`
+}
+
+// LoadClusterManifest 读取YAML(或JSON)格式的集群清单
+func LoadClusterManifest(path string) (*ClusterManifest, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m := &ClusterManifest{}
+	if err = yaml.UnmarshalStrict(b, m); err != nil {
+		return nil, fmt.Errorf("failed to parse cluster manifest %q (%v)", path, err)
+	}
+	return m, nil
+}
+
+// RestoreClusterConfig configures snapshot restore of all members listed in a cluster manifest.
+type RestoreClusterConfig struct {
+	// SnapshotPath is the path of snapshot file to restore from.
+	SnapshotPath string
+
+	// Manifest lists the members of the restored cluster.
+	Manifest *ClusterManifest
+
+	// OutputDir is the parent directory of members without an explicit data-dir.
+	// If empty, the current directory is used.
+	OutputDir string
+
+	// SkipHashCheck is "true" to ignore snapshot integrity hash value
+	// (required if copied from data directory).
+	SkipHashCheck bool
+}
+
+// members 按清单生成成员,每次调用都返回新的对象,各成员的恢复互不影响
+func (m *ClusterManifest) members() ([]*membership.Member, error) {
+	if len(m.Members) == 0 {
+		return nil, fmt.Errorf("cluster manifest has no members")
+	}
+	names := make(map[string]bool)
+	urls := make(map[string]string)
+	membs := make([]*membership.Member, 0, len(m.Members))
+	for _, mm := range m.Members {
+		if mm.Name == "" {
+			return nil, fmt.Errorf("cluster manifest has a member without name")
+		}
+		if names[mm.Name] {
+			return nil, fmt.Errorf("member name %q is duplicated in cluster manifest", mm.Name)
+		}
+		names[mm.Name] = true
+		pURLs, err := types.NewURLs(mm.PeerURLs)
+		if err != nil {
+			return nil, fmt.Errorf("invalid peer-urls of member %q (%v)", mm.Name, err)
+		}
+		for _, u := range pURLs.StringSlice() {
+			if other, ok := urls[u]; ok {
+				return nil, fmt.Errorf("peer URL %q is used by both member %q and %q", u, other, mm.Name)
+			}
+			urls[u] = mm.Name
+		}
+		memb := membership.NewMember(mm.Name, pURLs, m.Token, nil)
+		if mm.ID != "" {
+			if memb.ID, err = types.IDFromString(mm.ID); err != nil {
+				return nil, fmt.Errorf("invalid id %q of member %q (%v)", mm.ID, mm.Name, err)
+			}
+		}
+		membs = append(membs, memb)
+	}
+	return membs, nil
+}
+
+func (mm ManifestMember) dirs(outputDir string) (dataDir, walDir string) {
+	dataDir = mm.DataDir
+	if dataDir == "" {
+		dataDir = filepath.Join(outputDir, mm.Name+".etcd")
+	}
+	walDir = mm.WALDir
+	if walDir == "" {
+		walDir = filepath.Join(dataDir, "member", "wal")
+	}
+	return dataDir, walDir
+}
+
+// RestoreCluster 按集群清单把快照恢复为所有成员的数据目录,各成员的集群ID和成员信息一致.
+// 任何一个成员的目录已经存在数据时不会写入任何成员; 恢复中途失败时删除已经恢复的目录.
+func (s *v3Manager) RestoreCluster(cfg RestoreClusterConfig) error {
+	if cfg.Manifest == nil {
+		return fmt.Errorf("cluster manifest is required")
+	}
+	membs, err := cfg.Manifest.members()
+	if err != nil {
+		return err
+	}
+	cl, err := membership.NewClusterFromMemberList(s.lg, membs)
+	if err != nil {
+		return err
+	}
+
+	dirs := make(map[string]bool)
+	for _, mm := range cfg.Manifest.Members {
+		dataDir, walDir := mm.dirs(cfg.OutputDir)
+		for _, d := range []string{dataDir, walDir} {
+			if dirs[d] {
+				return fmt.Errorf("directory %q is used by more than one member", d)
+			}
+			dirs[d] = true
+		}
+		if fileutil.Exist(dataDir) && !fileutil.DirEmpty(dataDir) {
+			return fmt.Errorf("data-dir %q of member %q not empty or could not be read", dataDir, mm.Name)
+		}
+		if mm.WALDir != "" && fileutil.Exist(walDir) {
+			return fmt.Errorf("wal-dir %q of member %q exists", walDir, mm.Name)
+		}
+	}
+
+	s.lg.Info("restoring cluster from manifest",
+		zap.String("path", cfg.SnapshotPath),
+		zap.String("cluster-id", cl.ID().String()),
+		zap.Int("members", len(membs)),
+	)
+	var restored []string
+	for _, mm := range cfg.Manifest.Members {
+		dataDir, walDir := mm.dirs(cfg.OutputDir)
+		// saveWALAndSnap 会把成员写入新的存储,每个成员使用独立的集群对象
+		membs, _ = cfg.Manifest.members()
+		if s.cl, err = membership.NewClusterFromMemberList(s.lg, membs); err != nil {
+			return err
+		}
+		restored = append(restored, dataDir, walDir)
+		if err = s.restoreMember(mm.Name, cfg.SnapshotPath, dataDir, walDir, cfg.SkipHashCheck); err != nil {
+			for _, d := range restored {
+				os.RemoveAll(d)
+			}
+			return fmt.Errorf("failed to restore member %q (%v)", mm.Name, err)
+		}
+	}
+	s.lg.Info("restored cluster from manifest", zap.String("cluster-id", cl.ID().String()))
+	return nil
+}
@@ -30,6 +30,7 @@ import (
 	"github.com/ls-2018/etcd_cn/client_sdk/pkg/fileutil"
 	"github.com/ls-2018/etcd_cn/client_sdk/pkg/types"
 	"github.com/ls-2018/etcd_cn/etcd/config"
+	"github.com/ls-2018/etcd_cn/etcd/datadir"
 	"github.com/ls-2018/etcd_cn/etcd/etcdserver"
 	"github.com/ls-2018/etcd_cn/etcd/etcdserver/api/membership"
 	"github.com/ls-2018/etcd_cn/etcd/etcdserver/api/snap"
@@ -48,6 +49,7 @@ import (
 type Manager interface {
 	Status(dbPath string) (Status, error) // 快照信息
 	Restore(cfg RestoreConfig) error
+	RestoreCluster(cfg RestoreClusterConfig) error // 按集群清单一次恢复所有成员
 }
 
 // NewV3 v3版本的快照管理
@@ -63,6 +65,7 @@ type v3Manager struct {
 
 	name      string
 	srcDbPath string
+	dataDir   string
 	walDir    string
 	snapDir   string
 	cl        *membership.RaftCluster
@@ -148,11 +151,17 @@ func (s *v3Manager) Restore(cfg RestoreConfig) error {
 		return fmt.Errorf("wal-dir %q exists", walDir)
 	}
 
-	s.name = cfg.Name
-	s.srcDbPath = cfg.SnapshotPath
+	return s.restoreMember(cfg.Name, cfg.SnapshotPath, dataDir, walDir, cfg.SkipHashCheck)
+}
+
+// restoreMember 用 s.cl 中的成员信息把快照恢复为成员 name 的数据目录
+func (s *v3Manager) restoreMember(name, snapshotPath, dataDir, walDir string, skipHashCheck bool) error {
+	s.name = name
+	s.srcDbPath = snapshotPath
+	s.dataDir = dataDir
 	s.walDir = walDir
 	s.snapDir = filepath.Join(dataDir, "member", "snap")
-	s.skipHashCheck = cfg.SkipHashCheck
+	s.skipHashCheck = skipHashCheck
 
 	s.lg.Info(
 		"restoring snapshot",
@@ -163,7 +172,7 @@ func (s *v3Manager) Restore(cfg RestoreConfig) error {
 		zap.Stack("stack"),
 	)
 
-	if err = s.saveDB(); err != nil {
+	if err := s.saveDB(); err != nil {
 		return err
 	}
 	hardstate, err := s.saveWALAndSnap()
@@ -190,8 +199,9 @@ func (s *v3Manager) Restore(cfg RestoreConfig) error {
 	})
 }
 
+// outDbPath 与成员启动时打开的后端文件一致
 func (s *v3Manager) outDbPath() string {
-	return filepath.Join(s.snapDir, "db")
+	return datadir.ToBackendFileName(s.dataDir)
 }
 
 // saveDB 将数据库快照复制到快照目录中.
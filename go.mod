@@ -9,7 +9,9 @@ replace github.com/etcd-io/etcd/api/v3 v3.5.2 => ./offical/api/v3
 replace go.etcd.io/etcd/client/v3 v3.5.2 => github.com/etcd-io/etcd/client/v3 v3.5.2
 
 replace github.com/etcd-io/client/api/v3 v3.5.2 => ./offical/client/v3
+
 replace github.com/ls-2018/etcd_cn/official => ./offical
+
 require (
 	github.com/akhenakh/hunspellgo v0.0.0-20160221122622-9db38fa26e19 // indirect
 	github.com/alexkohler/nakedret v1.0.0
@@ -27,6 +29,7 @@ require (
 	github.com/gogo/protobuf v1.3.2
 	github.com/golang/groupcache v0.0.0-20210331224755-41bb18bfe9da
 	github.com/golang/protobuf v1.5.2
+	github.com/golang/snappy v0.0.4
 	github.com/google/btree v1.0.1
 	github.com/gordonklaus/ineffassign v0.0.0-20200809085317-e36bfde3bb78
 	github.com/grpc-ecosystem/go-grpc-middleware v1.3.0
@@ -36,6 +39,7 @@ require (
 	github.com/hexfusion/schwag v0.0.0-20170606222847-b7d0fc9aadaa
 	github.com/jonboulle/clockwork v0.2.2
 	github.com/json-iterator/go v1.1.11
+	github.com/klauspost/compress v1.15.9
 	github.com/kr/pretty v0.3.0 // indirect
 	github.com/mattn/go-colorable v0.1.12 // indirect
 	github.com/mdempsky/unconvert v0.0.0-20200228143138-95ecdbfc0b5f
@@ -44,6 +48,7 @@ require (
 	github.com/modern-go/reflect2 v1.0.1
 	github.com/olekukonko/tablewriter v0.0.5
 	github.com/prometheus/client_golang v1.11.0
+	github.com/prometheus/common v0.26.0
 	github.com/rogpeppe/go-internal v1.8.1 // indirect
 	github.com/sirupsen/logrus v1.7.0 // indirect
 	github.com/soheilhy/cmux v0.1.5
@@ -59,6 +64,7 @@ require (
 	go.opentelemetry.io/otel v0.20.0
 	go.opentelemetry.io/otel/exporters/otlp v0.20.0
 	go.opentelemetry.io/otel/sdk v0.20.0
+	go.opentelemetry.io/otel/trace v0.20.0
 	go.uber.org/multierr v1.6.0
 	go.uber.org/zap v1.17.0
 	golang.org/x/crypto v0.0.0-20210921155107-089bfa567519
@@ -51,6 +51,19 @@ func (Permission_Type) EnumDescriptor() ([]byte, []int) {
 	return fileDescriptor_8bbd6f3875b0e874, []int{2, 0}
 }
 
+// RefreshToken 用于换取新的token,hash为refresh token的sha256摘要,expires_at单位秒
+type RefreshToken struct {
+	Hash                 string   `protobuf:"bytes,1,opt,name=hash,proto3" json:"hash,omitempty"`
+	ExpiresAt            int64    `protobuf:"varint,2,opt,name=expires_at,json=expiresAt,proto3" json:"expires_at,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RefreshToken) Reset()         { *m = RefreshToken{} }
+func (m *RefreshToken) String() string { return proto.CompactTextString(m) }
+func (*RefreshToken) ProtoMessage()    {}
+
 type UserAddOptions struct {
 	NoPassword           bool     `protobuf:"varint,1,opt,name=no_password,json=noPassword,proto3" json:"no_password,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
@@ -66,10 +79,17 @@ func (*UserAddOptions) Descriptor() ([]byte, []int) {
 }
 
 type User struct {
-	Name                 string          `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
-	Password             string          `protobuf:"bytes,2,opt,name=password,proto3" json:"password,omitempty"`
-	Roles                []string        `protobuf:"bytes,3,rep,name=roles,proto3" json:"roles,omitempty"`
-	Options              *UserAddOptions `protobuf:"bytes,4,opt,name=options,proto3" json:"options,omitempty"`
+	Name     string          `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Password string          `protobuf:"bytes,2,opt,name=password,proto3" json:"password,omitempty"`
+	Roles    []string        `protobuf:"bytes,3,rep,name=roles,proto3" json:"roles,omitempty"`
+	Options  *UserAddOptions `protobuf:"bytes,4,opt,name=options,proto3" json:"options,omitempty"`
+	// 密码修改时间、连续登录失败次数、最后一次失败时间、锁定截止时间,单位秒
+	PasswordChangedAt int64 `protobuf:"varint,5,opt,name=password_changed_at,json=passwordChangedAt,proto3" json:"password_changed_at,omitempty"`
+	FailedLogins      int32 `protobuf:"varint,6,opt,name=failed_logins,json=failedLogins,proto3" json:"failed_logins,omitempty"`
+	LastFailedLogin   int64 `protobuf:"varint,7,opt,name=last_failed_login,json=lastFailedLogin,proto3" json:"last_failed_login,omitempty"`
+	LockedUntil       int64 `protobuf:"varint,8,opt,name=locked_until,json=lockedUntil,proto3" json:"locked_until,omitempty"`
+	// 未过期的refresh token,只保存摘要
+	RefreshTokens        []*RefreshToken `protobuf:"bytes,9,rep,name=refresh_tokens,json=refreshTokens,proto3" json:"refresh_tokens,omitempty"`
 	XXX_NoUnkeyedLiteral struct{}        `json:"-"`
 	XXX_unrecognized     []byte          `json:"-"`
 	XXX_sizecache        int32           `json:"-"`
@@ -84,12 +104,16 @@ func (*User) Descriptor() ([]byte, []int) {
 
 // Permission 是赋予角色的权限.
 type Permission struct {
-	PermType             Permission_Type `protobuf:"varint,1,opt,name=permType,proto3,enum=authpb.Permission_Type" json:"permType,omitempty"`
-	Key                  string          `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
-	RangeEnd             string          `protobuf:"bytes,3,opt,name=range_end,json=rangeEnd,proto3" json:"range_end,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}        `json:"-"`
-	XXX_unrecognized     []byte          `json:"-"`
-	XXX_sizecache        int32           `json:"-"`
+	PermType Permission_Type `protobuf:"varint,1,opt,name=permType,proto3,enum=authpb.Permission_Type" json:"permType,omitempty"`
+	Key      string          `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
+	RangeEnd string          `protobuf:"bytes,3,opt,name=range_end,json=rangeEnd,proto3" json:"range_end,omitempty"`
+	// Operation 非空时表示非KV操作的权限,例如 lease、snapshot,此时忽略 PermType、Key、RangeEnd
+	Operation string `protobuf:"bytes,4,opt,name=operation,proto3" json:"operation,omitempty"`
+	// Deny 为true时表示禁止该范围的 PermType 操作,优先于所有角色授予的允许权限
+	Deny                 bool     `protobuf:"varint,5,opt,name=deny,proto3" json:"deny,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
 }
 
 func (m *Permission) Reset()         { *m = Permission{} }
@@ -101,11 +125,13 @@ func (*Permission) Descriptor() ([]byte, []int) {
 
 // Role is a single entry in the bucket authRoles
 type Role struct {
-	Name                 string        `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
-	KeyPermission        []*Permission `protobuf:"bytes,2,rep,name=keyPermission,proto3" json:"keyPermission,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}      `json:"-"`
-	XXX_unrecognized     []byte        `json:"-"`
-	XXX_sizecache        int32         `json:"-"`
+	Name          string        `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	KeyPermission []*Permission `protobuf:"bytes,2,rep,name=keyPermission,proto3" json:"keyPermission,omitempty"`
+	// OpPermission 角色允许的非KV操作
+	OpPermission         []string `protobuf:"bytes,3,rep,name=opPermission,proto3" json:"opPermission,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
 }
 
 func (m *Role) Reset()         { *m = Role{} }
@@ -121,6 +147,7 @@ func init() {
 	proto.RegisterType((*User)(nil), "authpb.User")
 	proto.RegisterType((*Permission)(nil), "authpb.Permission")
 	proto.RegisterType((*Role)(nil), "authpb.Role")
+	proto.RegisterType((*RefreshToken)(nil), "authpb.RefreshToken")
 }
 
 func init() { proto.RegisterFile("auth.proto", fileDescriptor_8bbd6f3875b0e874) }
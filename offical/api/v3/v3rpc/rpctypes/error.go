@@ -31,11 +31,15 @@ var (
 	ErrGRPCFutureRev     = status.New(codes.OutOfRange, "etcdserver: mvcc: 所需的修订版是一个未来版本").Err()
 	ErrGRPCNoSpace       = status.New(codes.ResourceExhausted, "etcdserver: mvcc: database space exceeded").Err()
 
-	ErrGRPCLeaseNotFound    = status.New(codes.NotFound, "etcdserver: 请求的租约不存在").Err()
-	ErrGRPCLeaseExist       = status.New(codes.FailedPrecondition, "etcdserver: lease already exists").Err()
-	ErrGRPCLeaseTTLTooLarge = status.New(codes.OutOfRange, "etcdserver: too large lease TTL").Err()
+	ErrGRPCLeaseNotFound         = status.New(codes.NotFound, "etcdserver: 请求的租约不存在").Err()
+	ErrGRPCLeaseExist            = status.New(codes.FailedPrecondition, "etcdserver: lease already exists").Err()
+	ErrGRPCLeaseTTLTooLarge      = status.New(codes.OutOfRange, "etcdserver: too large lease TTL").Err()
+	ErrGRPCParentLeaseNotFound   = status.New(codes.NotFound, "etcdserver: 父租约不存在").Err()
+	ErrGRPCLeaseMetadataTooLarge = status.New(codes.InvalidArgument, "etcdserver: lease metadata is too large").Err()
+	ErrGRPCLeaseWatcherSlow      = status.New(codes.ResourceExhausted, "etcdserver: lease watcher is too slow").Err()
 
-	ErrGRPCWatchCanceled = status.New(codes.Canceled, "etcdserver: watch 取消了").Err()
+	ErrGRPCWatchCanceled      = status.New(codes.Canceled, "etcdserver: watch 取消了").Err()
+	ErrGRPCWatchLimitExceeded = status.New(codes.ResourceExhausted, "etcdserver: too many watches").Err()
 
 	ErrGRPCMemberExist            = status.New(codes.FailedPrecondition, "etcdserver: member ID already exist").Err()
 	ErrGRPCPeerURLExist           = status.New(codes.FailedPrecondition, "etcdserver: Peer URLs already exists").Err()
@@ -45,6 +49,8 @@ var (
 	ErrGRPCMemberNotLearner       = status.New(codes.FailedPrecondition, "etcdserver: can only promote a learner member").Err()
 	ErrGRPCLearnerNotReady        = status.New(codes.FailedPrecondition, "etcdserver: can only promote a learner member which is in sync with leader").Err()
 	ErrGRPCTooManyLearners        = status.New(codes.FailedPrecondition, "etcdserver: too many learner members in cluster").Err()
+	ErrGRPCMemberBadLabels        = status.New(codes.InvalidArgument, "etcdserver: given member labels are invalid").Err()
+	ErrGRPCMemberBadBatchChange   = status.New(codes.InvalidArgument, "etcdserver: invalid batch member change").Err()
 
 	ErrGRPCRequestTooLarge        = status.New(codes.InvalidArgument, "etcdserver: 请求体太大").Err()
 	ErrGRPCRequestTooManyRequests = status.New(codes.ResourceExhausted, "etcdserver: 请求次数太多").Err()
@@ -65,7 +71,12 @@ var (
 	ErrGRPCAuthNotEnabled       = status.New(codes.FailedPrecondition, "etcdserver: authentication is not enabled").Err()
 	ErrGRPCInvalidAuthToken     = status.New(codes.Unauthenticated, "etcdserver: invalid auth token").Err()
 	ErrGRPCInvalidAuthMgmt      = status.New(codes.InvalidArgument, "etcdserver: invalid auth management").Err()
+	ErrGRPCInvalidAuthOperation = status.New(codes.InvalidArgument, "etcdserver: invalid auth operation").Err()
 	ErrGRPCAuthOldRevision      = status.New(codes.InvalidArgument, "etcdserver: revision of auth store is old").Err()
+	ErrGRPCPasswordTooWeak      = status.New(codes.InvalidArgument, "etcdserver: password does not satisfy the password policy").Err()
+	ErrGRPCPasswordExpired      = status.New(codes.FailedPrecondition, "etcdserver: password has expired").Err()
+	ErrGRPCAccountLocked        = status.New(codes.PermissionDenied, "etcdserver: account is temporarily locked").Err()
+	ErrGRPCInvalidRefreshToken  = status.New(codes.Unauthenticated, "etcdserver: invalid or revoked refresh token").Err()
 
 	ErrGRPCNoLeader                   = status.New(codes.Unavailable, "etcdserver: 没有leader").Err()
 	ErrGRPCNotLeader                  = status.New(codes.FailedPrecondition, "etcdserver: 不是leader").Err()
@@ -85,6 +96,30 @@ var (
 	ErrGRPCInvalidDowngradeTargetVersion = status.New(codes.InvalidArgument, "etcdserver: invalid downgrade target version").Err()
 	ErrGRPCDowngradeInProcess            = status.New(codes.FailedPrecondition, "etcdserver: cluster has a downgrade job in progress").Err()
 	ErrGRPCNoInflightDowngrade           = status.New(codes.FailedPrecondition, "etcdserver: no inflight downgrade job").Err()
+	ErrGRPCInvalidUpgradeTargetVersion   = status.New(codes.InvalidArgument, "etcdserver: invalid upgrade target version").Err()
+	ErrGRPCMembersNotUpgraded            = status.New(codes.FailedPrecondition, "etcdserver: not all members run the upgrade target version").Err()
+	ErrGRPCDowngradeFeatureBlocked       = status.New(codes.FailedPrecondition, "etcdserver: feature is not supported by the downgrade target version").Err()
+	ErrGRPCMemberReadOnly                = status.New(codes.Unavailable, "etcdserver: member is in read-only maintenance mode").Err()
+	ErrGRPCReadOnlySoleVoter             = status.New(codes.FailedPrecondition, "etcdserver: the only voting member cannot enter read-only maintenance mode").Err()
+	ErrGRPCReplicaReadOnly               = status.New(codes.FailedPrecondition, "etcdserver: cluster is a read-only replica").Err()
+	ErrGRPCNotReplica                    = status.New(codes.FailedPrecondition, "etcdserver: cluster is not a read-only replica").Err()
+	ErrGRPCInvalidProfileType            = status.New(codes.InvalidArgument, "etcdserver: unknown profile type").Err()
+	ErrGRPCInvalidProfileDuration        = status.New(codes.InvalidArgument, "etcdserver: invalid profile duration").Err()
+	ErrGRPCProfileInProgress             = status.New(codes.FailedPrecondition, "etcdserver: another cpu profile or trace is in progress").Err()
+	ErrGRPCUnknownLogScope               = status.New(codes.InvalidArgument, "etcdserver: unknown log scope").Err()
+	ErrGRPCInvalidLogLevel               = status.New(codes.InvalidArgument, "etcdserver: invalid log level").Err()
+	ErrGRPCFailpointsDisabled            = status.New(codes.FailedPrecondition, "etcdserver: failpoints are disabled").Err()
+	ErrGRPCInvalidFailpoint              = status.New(codes.InvalidArgument, "etcdserver: invalid failpoint").Err()
+	ErrGRPCCompactionHoldTTL             = status.New(codes.InvalidArgument, "etcdserver: invalid compaction hold ttl").Err()
+	ErrGRPCCompactionHoldTooOld          = status.New(codes.OutOfRange, "etcdserver: compaction hold revision is too old").Err()
+	ErrGRPCCompactionHoldTooMany         = status.New(codes.ResourceExhausted, "etcdserver: too many compaction holds").Err()
+	ErrGRPCSnapshotSessionNotFound       = status.New(codes.NotFound, "etcdserver: snapshot session not found or expired").Err()
+	ErrGRPCSnapshotSessionRevision       = status.New(codes.InvalidArgument, "etcdserver: revision conflicts with snapshot session").Err()
+	ErrGRPCStagedTxnNotFound             = status.New(codes.NotFound, "etcdserver: staged txn not found").Err()
+	ErrGRPCStagedTxnTooLarge             = status.New(codes.InvalidArgument, "etcdserver: staged txn exceeds the size limit").Err()
+	ErrGRPCStagedTxnTooMany              = status.New(codes.ResourceExhausted, "etcdserver: too many staged txns").Err()
+	ErrGRPCUserQuotaExceeded             = status.New(codes.ResourceExhausted, "etcdserver: user write quota exceeded").Err()
+	ErrGRPCUserRateLimited               = status.New(codes.ResourceExhausted, "etcdserver: user write rate limit exceeded").Err()
 
 	ErrGRPCCanceled         = status.New(codes.Canceled, "etcdserver: 取消请求").Err()
 	ErrGRPCDeadlineExceeded = status.New(codes.DeadlineExceeded, "etcdserver: 上下文超时").Err()
@@ -101,9 +136,12 @@ var (
 		ErrorDesc(ErrGRPCFutureRev):    ErrGRPCFutureRev,
 		ErrorDesc(ErrGRPCNoSpace):      ErrGRPCNoSpace,
 
-		ErrorDesc(ErrGRPCLeaseNotFound):    ErrGRPCLeaseNotFound,
-		ErrorDesc(ErrGRPCLeaseExist):       ErrGRPCLeaseExist,
-		ErrorDesc(ErrGRPCLeaseTTLTooLarge): ErrGRPCLeaseTTLTooLarge,
+		ErrorDesc(ErrGRPCLeaseNotFound):         ErrGRPCLeaseNotFound,
+		ErrorDesc(ErrGRPCLeaseExist):            ErrGRPCLeaseExist,
+		ErrorDesc(ErrGRPCLeaseTTLTooLarge):      ErrGRPCLeaseTTLTooLarge,
+		ErrorDesc(ErrGRPCParentLeaseNotFound):   ErrGRPCParentLeaseNotFound,
+		ErrorDesc(ErrGRPCLeaseMetadataTooLarge): ErrGRPCLeaseMetadataTooLarge,
+		ErrorDesc(ErrGRPCLeaseWatcherSlow):      ErrGRPCLeaseWatcherSlow,
 
 		ErrorDesc(ErrGRPCMemberExist):            ErrGRPCMemberExist,
 		ErrorDesc(ErrGRPCPeerURLExist):           ErrGRPCPeerURLExist,
@@ -113,6 +151,8 @@ var (
 		ErrorDesc(ErrGRPCMemberNotLearner):       ErrGRPCMemberNotLearner,
 		ErrorDesc(ErrGRPCLearnerNotReady):        ErrGRPCLearnerNotReady,
 		ErrorDesc(ErrGRPCTooManyLearners):        ErrGRPCTooManyLearners,
+		ErrorDesc(ErrGRPCMemberBadLabels):        ErrGRPCMemberBadLabels,
+		ErrorDesc(ErrGRPCMemberBadBatchChange):   ErrGRPCMemberBadBatchChange,
 
 		ErrorDesc(ErrGRPCRequestTooLarge):        ErrGRPCRequestTooLarge,
 		ErrorDesc(ErrGRPCRequestTooManyRequests): ErrGRPCRequestTooManyRequests,
@@ -132,7 +172,12 @@ var (
 		ErrorDesc(ErrGRPCAuthNotEnabled):       ErrGRPCAuthNotEnabled,
 		ErrorDesc(ErrGRPCInvalidAuthToken):     ErrGRPCInvalidAuthToken,
 		ErrorDesc(ErrGRPCInvalidAuthMgmt):      ErrGRPCInvalidAuthMgmt,
+		ErrorDesc(ErrGRPCInvalidAuthOperation): ErrGRPCInvalidAuthOperation,
 		ErrorDesc(ErrGRPCAuthOldRevision):      ErrGRPCAuthOldRevision,
+		ErrorDesc(ErrGRPCPasswordTooWeak):      ErrGRPCPasswordTooWeak,
+		ErrorDesc(ErrGRPCPasswordExpired):      ErrGRPCPasswordExpired,
+		ErrorDesc(ErrGRPCAccountLocked):        ErrGRPCAccountLocked,
+		ErrorDesc(ErrGRPCInvalidRefreshToken):  ErrGRPCInvalidRefreshToken,
 
 		ErrorDesc(ErrGRPCNoLeader):                   ErrGRPCNoLeader,
 		ErrorDesc(ErrGRPCNotLeader):                  ErrGRPCNotLeader,
@@ -152,6 +197,31 @@ var (
 		ErrorDesc(ErrGRPCInvalidDowngradeTargetVersion): ErrGRPCInvalidDowngradeTargetVersion,
 		ErrorDesc(ErrGRPCDowngradeInProcess):            ErrGRPCDowngradeInProcess,
 		ErrorDesc(ErrGRPCNoInflightDowngrade):           ErrGRPCNoInflightDowngrade,
+		ErrorDesc(ErrGRPCInvalidUpgradeTargetVersion):   ErrGRPCInvalidUpgradeTargetVersion,
+		ErrorDesc(ErrGRPCMembersNotUpgraded):            ErrGRPCMembersNotUpgraded,
+		ErrorDesc(ErrGRPCDowngradeFeatureBlocked):       ErrGRPCDowngradeFeatureBlocked,
+		ErrorDesc(ErrGRPCMemberReadOnly):                ErrGRPCMemberReadOnly,
+		ErrorDesc(ErrGRPCReadOnlySoleVoter):             ErrGRPCReadOnlySoleVoter,
+		ErrorDesc(ErrGRPCReplicaReadOnly):               ErrGRPCReplicaReadOnly,
+		ErrorDesc(ErrGRPCNotReplica):                    ErrGRPCNotReplica,
+		ErrorDesc(ErrGRPCInvalidProfileType):            ErrGRPCInvalidProfileType,
+		ErrorDesc(ErrGRPCInvalidProfileDuration):        ErrGRPCInvalidProfileDuration,
+		ErrorDesc(ErrGRPCProfileInProgress):             ErrGRPCProfileInProgress,
+		ErrorDesc(ErrGRPCUnknownLogScope):               ErrGRPCUnknownLogScope,
+		ErrorDesc(ErrGRPCInvalidLogLevel):               ErrGRPCInvalidLogLevel,
+		ErrorDesc(ErrGRPCFailpointsDisabled):            ErrGRPCFailpointsDisabled,
+		ErrorDesc(ErrGRPCInvalidFailpoint):              ErrGRPCInvalidFailpoint,
+		ErrorDesc(ErrGRPCCompactionHoldTTL):             ErrGRPCCompactionHoldTTL,
+		ErrorDesc(ErrGRPCCompactionHoldTooOld):          ErrGRPCCompactionHoldTooOld,
+		ErrorDesc(ErrGRPCCompactionHoldTooMany):         ErrGRPCCompactionHoldTooMany,
+		ErrorDesc(ErrGRPCSnapshotSessionNotFound):       ErrGRPCSnapshotSessionNotFound,
+		ErrorDesc(ErrGRPCSnapshotSessionRevision):       ErrGRPCSnapshotSessionRevision,
+		ErrorDesc(ErrGRPCStagedTxnNotFound):             ErrGRPCStagedTxnNotFound,
+		ErrorDesc(ErrGRPCStagedTxnTooLarge):             ErrGRPCStagedTxnTooLarge,
+		ErrorDesc(ErrGRPCStagedTxnTooMany):              ErrGRPCStagedTxnTooMany,
+		ErrorDesc(ErrGRPCUserQuotaExceeded):             ErrGRPCUserQuotaExceeded,
+		ErrorDesc(ErrGRPCUserRateLimited):               ErrGRPCUserRateLimited,
+		ErrorDesc(ErrGRPCWatchLimitExceeded):            ErrGRPCWatchLimitExceeded,
 	}
 )
 
@@ -161,7 +231,9 @@ var (
 	ErrCompacted = Error(ErrGRPCCompacted)
 	ErrFutureRev = Error(ErrGRPCFutureRev)
 
-	ErrLeaseNotFound = Error(ErrGRPCLeaseNotFound)
+	ErrLeaseNotFound       = Error(ErrGRPCLeaseNotFound)
+	ErrParentLeaseNotFound = Error(ErrGRPCParentLeaseNotFound)
+	ErrLeaseWatcherSlow    = Error(ErrGRPCLeaseWatcherSlow)
 
 	ErrMemberNotEnoughStarted = Error(ErrGRPCMemberNotEnoughStarted)
 
@@ -173,8 +245,19 @@ var (
 	ErrAuthNotEnabled   = Error(ErrGRPCAuthNotEnabled)
 	ErrInvalidAuthToken = Error(ErrGRPCInvalidAuthToken)
 	ErrAuthOldRevision  = Error(ErrGRPCAuthOldRevision)
+	ErrPasswordTooWeak  = Error(ErrGRPCPasswordTooWeak)
+	ErrPasswordExpired  = Error(ErrGRPCPasswordExpired)
+	ErrAccountLocked    = Error(ErrGRPCAccountLocked)
+
+	ErrInvalidRefreshToken = Error(ErrGRPCInvalidRefreshToken)
 
 	ErrNoLeader = Error(ErrGRPCNoLeader)
+
+	ErrWatchLimitExceeded = Error(ErrGRPCWatchLimitExceeded)
+
+	ErrReplicaReadOnly = Error(ErrGRPCReplicaReadOnly)
+
+	ErrSnapshotSessionNotFound = Error(ErrGRPCSnapshotSessionNotFound)
 )
 
 // EtcdError defines gRPC server errors.
@@ -19,4 +19,12 @@ var (
 	MetadataHasLeader        = "true"
 
 	MetadataClientAPIVersionKey = "client-api-version"
+
+	// 调用方信息,由客户端附加到请求上,服务端记录在慢请求日志和审计记录中
+	MetadataCallerAppKey       = "caller-app"
+	MetadataCallerRequestIDKey = "caller-request-id"
+	MetadataCallerPriorityKey  = "caller-priority"
+
+	// MetadataRetryAfterKey 服务端过载拒绝请求时通过trailer返回的建议重试间隔,单位秒
+	MetadataRetryAfterKey = "retry-after"
 )
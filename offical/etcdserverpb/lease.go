@@ -14,6 +14,10 @@ type LeaseGrantRequest struct {
 	TTL int64 `protobuf:"varint,1,opt,name=TTL,proto3" json:"TTL,omitempty"`
 	// ID is the requested ID for the lease. If ID is set to 0, the lessor chooses an ID.
 	ID int64 `protobuf:"varint,2,opt,name=ID,proto3" json:"ID,omitempty"`
+	// Parent 父租约ID,不为0时新租约作为其子租约: 父租约撤销或过期时子租约一起撤销,续约父租约时子租约一起续约
+	Parent int64 `protobuf:"varint,3,opt,name=parent,proto3" json:"parent,omitempty"`
+	// Metadata 随租约保存的不透明数据,例如所属服务名、主机名
+	Metadata string `protobuf:"bytes,4,opt,name=metadata,proto3" json:"metadata,omitempty"`
 }
 
 func (m *LeaseGrantRequest) Reset()         { *m = LeaseGrantRequest{} }
@@ -44,6 +48,8 @@ type LeaseGrantResponse struct {
 	// TTL is the server chosen lease time-to-live in seconds.
 	TTL   int64  `protobuf:"varint,3,opt,name=TTL,proto3" json:"TTL,omitempty"`
 	Error string `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"`
+	// ClockSkewMs 处理请求的成员与各对端之间最大的时钟偏差(毫秒)
+	ClockSkewMs int64 `protobuf:"varint,5,opt,name=clock_skew_ms,json=clockSkewMs,proto3" json:"clock_skew_ms,omitempty"`
 }
 
 func (m *LeaseGrantResponse) Reset()         { *m = LeaseGrantResponse{} }
@@ -84,6 +90,8 @@ func (m *LeaseGrantResponse) GetError() string {
 type LeaseRevokeRequest struct {
 	// ID is the lease ID to revoke. When the ID is revoked, all associated keys will be deleted.
 	ID int64 `protobuf:"varint,1,opt,name=ID,proto3" json:"ID,omitempty"`
+	// Expired 由leader撤销过期租约时设置,用于区分LeaseWatch中的EXPIRED和REVOKED事件;客户端设置的值会被忽略
+	Expired bool `protobuf:"varint,2,opt,name=expired,proto3" json:"expired,omitempty"`
 }
 
 func (m *LeaseRevokeRequest) Reset()         { *m = LeaseRevokeRequest{} }
@@ -124,6 +132,8 @@ func (m *LeaseRevokeResponse) GetHeader() *ResponseHeader {
 type LeaseCheckpoint struct {
 	ID           int64 `protobuf:"varint,1,opt,name=ID,proto3" json:"ID,omitempty"`                                         // 租约ID
 	RemainingTtl int64 `protobuf:"varint,2,opt,name=remaining_TTL,json=remainingTTL,proto3" json:"remaining_TTL,omitempty"` // 剩余的存活时间
+	// CheckpointTime leader计算剩余时间时的unix纳秒时间戳,0表示未知(旧版本的检查点)
+	CheckpointTime int64 `protobuf:"varint,3,opt,name=checkpoint_time,json=checkpointTime,proto3" json:"checkpoint_time,omitempty"`
 }
 
 func (m *LeaseCheckpoint) Reset()         { *m = LeaseCheckpoint{} }
@@ -192,6 +202,8 @@ func (m *LeaseCheckpointResponse) GetHeader() *ResponseHeader {
 type LeaseKeepAliveRequest struct {
 	// ID is the lease ID for the lease to keep alive.
 	ID int64 `protobuf:"varint,1,opt,name=ID,proto3" json:"ID,omitempty"`
+	// IDs 批量续约的租约ID,不为空时忽略ID,响应的Results按顺序给出每个租约的结果
+	IDs []int64 `protobuf:"varint,2,rep,packed,name=IDs,proto3" json:"IDs,omitempty"`
 }
 
 func (m *LeaseKeepAliveRequest) Reset()         { *m = LeaseKeepAliveRequest{} }
@@ -213,8 +225,25 @@ type LeaseKeepAliveResponse struct {
 	ID     int64           `protobuf:"varint,2,opt,name=ID,proto3" json:"ID,omitempty"` // 租约ID
 	// TTL is the new time-to-live for the lease.
 	TTL int64 `protobuf:"varint,3,opt,name=TTL,proto3" json:"TTL,omitempty"`
+	// Results 批量续约的结果
+	Results []*LeaseKeepAliveResult `protobuf:"bytes,4,rep,name=results,proto3" json:"results,omitempty"`
+	// NextKeepAliveMs 建议的下次续约时间(毫秒),带有随机抖动,避免大量客户端同时续约
+	NextKeepAliveMs int64 `protobuf:"varint,5,opt,name=next_keep_alive_ms,json=nextKeepAliveMs,proto3" json:"next_keep_alive_ms,omitempty"`
+	// ClockSkewMs 处理请求的成员与各对端之间最大的时钟偏差(毫秒)
+	ClockSkewMs int64 `protobuf:"varint,6,opt,name=clock_skew_ms,json=clockSkewMs,proto3" json:"clock_skew_ms,omitempty"`
 }
 
+type LeaseKeepAliveResult struct {
+	ID int64 `protobuf:"varint,1,opt,name=ID,proto3" json:"ID,omitempty"`
+	// TTL 续约后的TTL,租约不存在或已过期时为0
+	TTL             int64 `protobuf:"varint,2,opt,name=TTL,proto3" json:"TTL,omitempty"`
+	NextKeepAliveMs int64 `protobuf:"varint,3,opt,name=next_keep_alive_ms,json=nextKeepAliveMs,proto3" json:"next_keep_alive_ms,omitempty"`
+}
+
+func (m *LeaseKeepAliveResult) Reset()         { *m = LeaseKeepAliveResult{} }
+func (m *LeaseKeepAliveResult) String() string { return proto.CompactTextString(m) }
+func (*LeaseKeepAliveResult) ProtoMessage()    {}
+
 func (m *LeaseKeepAliveResponse) Reset()         { *m = LeaseKeepAliveResponse{} }
 func (m *LeaseKeepAliveResponse) String() string { return proto.CompactTextString(m) }
 func (*LeaseKeepAliveResponse) ProtoMessage()    {}
@@ -281,6 +310,10 @@ type LeaseTimeToLiveResponse struct {
 	GrantedTTL int64 `protobuf:"varint,4,opt,name=grantedTTL,proto3" json:"grantedTTL,omitempty"`
 	// Keys is the list of keys attached to this lease.
 	Keys [][]byte `protobuf:"bytes,5,rep,name=keys,proto3" json:"keys,omitempty"`
+	// Metadata 创建租约时附带的数据
+	Metadata string `protobuf:"bytes,6,opt,name=metadata,proto3" json:"metadata,omitempty"`
+	// ClockSkewMs 处理请求的成员与各对端之间最大的时钟偏差(毫秒)
+	ClockSkewMs int64 `protobuf:"varint,7,opt,name=clock_skew_ms,json=clockSkewMs,proto3" json:"clock_skew_ms,omitempty"`
 }
 
 func (m *LeaseTimeToLiveResponse) Reset()         { *m = LeaseTimeToLiveResponse{} }
@@ -336,6 +369,10 @@ func (*LeaseLeasesRequest) Descriptor() ([]byte, []int) {
 
 type LeaseStatus struct {
 	ID int64 `protobuf:"varint,1,opt,name=ID,proto3" json:"ID,omitempty"`
+	// GrantedTTL 创建租约时的ttl
+	GrantedTTL int64 `protobuf:"varint,2,opt,name=grantedTTL,proto3" json:"grantedTTL,omitempty"`
+	// Metadata 创建租约时附带的数据
+	Metadata string `protobuf:"bytes,3,opt,name=metadata,proto3" json:"metadata,omitempty"`
 }
 
 func (m *LeaseStatus) Reset()         { *m = LeaseStatus{} }
@@ -381,12 +418,86 @@ func (m *LeaseLeasesResponse) GetLeases() []*LeaseStatus {
 	return nil
 }
 
+type LeaseEvent_EventType int32
+
+const (
+	LeaseEvent_GRANTED      LeaseEvent_EventType = 0
+	LeaseEvent_RENEWED      LeaseEvent_EventType = 1
+	LeaseEvent_CHECKPOINTED LeaseEvent_EventType = 2
+	LeaseEvent_EXPIRED      LeaseEvent_EventType = 3
+	LeaseEvent_REVOKED      LeaseEvent_EventType = 4
+)
+
+var LeaseEvent_EventType_name = map[int32]string{
+	0: "GRANTED",
+	1: "RENEWED",
+	2: "CHECKPOINTED",
+	3: "EXPIRED",
+	4: "REVOKED",
+}
+
+var LeaseEvent_EventType_value = map[string]int32{
+	"GRANTED":      0,
+	"RENEWED":      1,
+	"CHECKPOINTED": 2,
+	"EXPIRED":      3,
+	"REVOKED":      4,
+}
+
+func (x LeaseEvent_EventType) String() string {
+	return proto.EnumName(LeaseEvent_EventType_name, int32(x))
+}
+
+type LeaseWatchRequest struct {
+	// IDPrefix 只返回16进制ID以该前缀开头的租约的事件
+	IDPrefix string `protobuf:"bytes,1,opt,name=id_prefix,json=idPrefix,proto3" json:"id_prefix,omitempty"`
+	// MetadataPrefix 只返回metadata以该前缀开头的租约的事件
+	MetadataPrefix string `protobuf:"bytes,2,opt,name=metadata_prefix,json=metadataPrefix,proto3" json:"metadata_prefix,omitempty"`
+	// Types 只返回这些类型的事件,为空时返回所有事件
+	Types []LeaseEvent_EventType `protobuf:"varint,3,rep,packed,name=types,proto3,enum=etcdserverpb.LeaseEvent_EventType" json:"types,omitempty"`
+}
+
+func (m *LeaseWatchRequest) Reset()         { *m = LeaseWatchRequest{} }
+func (m *LeaseWatchRequest) String() string { return proto.CompactTextString(m) }
+func (*LeaseWatchRequest) ProtoMessage()    {}
+
+type LeaseEvent struct {
+	Type LeaseEvent_EventType `protobuf:"varint,1,opt,name=type,proto3,enum=etcdserverpb.LeaseEvent_EventType" json:"type,omitempty"`
+	ID   int64                `protobuf:"varint,2,opt,name=ID,proto3" json:"ID,omitempty"`
+	// TTL 事件发生时租约的剩余时间(秒),过期和撤销事件为0
+	TTL        int64  `protobuf:"varint,3,opt,name=TTL,proto3" json:"TTL,omitempty"`
+	GrantedTTL int64  `protobuf:"varint,4,opt,name=grantedTTL,proto3" json:"grantedTTL,omitempty"`
+	Metadata   string `protobuf:"bytes,5,opt,name=metadata,proto3" json:"metadata,omitempty"`
+	Parent     int64  `protobuf:"varint,6,opt,name=parent,proto3" json:"parent,omitempty"`
+}
+
+func (m *LeaseEvent) Reset()         { *m = LeaseEvent{} }
+func (m *LeaseEvent) String() string { return proto.CompactTextString(m) }
+func (*LeaseEvent) ProtoMessage()    {}
+
+type LeaseWatchResponse struct {
+	Header *ResponseHeader `protobuf:"bytes,1,opt,name=header,proto3" json:"header,omitempty"`
+	Events []*LeaseEvent   `protobuf:"bytes,2,rep,name=events,proto3" json:"events,omitempty"`
+}
+
+func (m *LeaseWatchResponse) Reset()         { *m = LeaseWatchResponse{} }
+func (m *LeaseWatchResponse) String() string { return proto.CompactTextString(m) }
+func (*LeaseWatchResponse) ProtoMessage()    {}
+
+func (m *LeaseWatchResponse) GetHeader() *ResponseHeader {
+	if m != nil {
+		return m.Header
+	}
+	return nil
+}
+
 type LeaseServer interface {
 	LeaseGrant(context.Context, *LeaseGrantRequest) (*LeaseGrantResponse, error)                // 创建租约
 	LeaseRevoke(context.Context, *LeaseRevokeRequest) (*LeaseRevokeResponse, error)             // 移除租约
 	LeaseKeepAlive(Lease_LeaseKeepAliveServer) error                                            // 租约 续租
 	LeaseTimeToLive(context.Context, *LeaseTimeToLiveRequest) (*LeaseTimeToLiveResponse, error) // 检索租约信息
 	LeaseLeases(context.Context, *LeaseLeasesRequest) (*LeaseLeasesResponse, error)             // 显示所有存在的租约
+	LeaseWatch(*LeaseWatchRequest, Lease_LeaseWatchServer) error                                // 订阅租约的创建、续约、检查点、过期、撤销事件
 }
 
 // UnimplementedLeaseServer can be embedded to have forward compatible implementations.
@@ -412,6 +523,10 @@ func (*UnimplementedLeaseServer) LeaseLeases(ctx context.Context, req *LeaseLeas
 	return nil, status.Errorf(codes.Unimplemented, "method LeaseLeases not implemented")
 }
 
+func (*UnimplementedLeaseServer) LeaseWatch(req *LeaseWatchRequest, srv Lease_LeaseWatchServer) error {
+	return status.Errorf(codes.Unimplemented, "method LeaseWatch not implemented")
+}
+
 func RegisterLeaseServer(s *grpc.Server, srv LeaseServer) {
 	s.RegisterService(&_Lease_serviceDesc, srv)
 }
@@ -514,6 +629,27 @@ func _Lease_LeaseKeepAlive_Handler(srv interface{}, stream grpc.ServerStream) er
 	return srv.(LeaseServer).LeaseKeepAlive(&leaseLeaseKeepAliveServer{stream})
 }
 
+func _Lease_LeaseWatch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(LeaseWatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(LeaseServer).LeaseWatch(m, &leaseLeaseWatchServer{stream})
+}
+
+type Lease_LeaseWatchServer interface {
+	Send(*LeaseWatchResponse) error
+	grpc.ServerStream
+}
+
+type leaseLeaseWatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *leaseLeaseWatchServer) Send(m *LeaseWatchResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 var _Lease_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "etcdserverpb.Lease",
 	HandlerType: (*LeaseServer)(nil),
@@ -542,6 +678,11 @@ var _Lease_serviceDesc = grpc.ServiceDesc{
 			ServerStreams: true,
 			ClientStreams: true,
 		},
+		{
+			StreamName:    "LeaseWatch",
+			Handler:       _Lease_LeaseWatch_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "rpc.proto",
 }
@@ -552,6 +693,7 @@ type LeaseClient interface {
 	LeaseKeepAlive(ctx context.Context, opts ...grpc.CallOption) (Lease_LeaseKeepAliveClient, error)
 	LeaseTimeToLive(ctx context.Context, in *LeaseTimeToLiveRequest, opts ...grpc.CallOption) (*LeaseTimeToLiveResponse, error)
 	LeaseLeases(ctx context.Context, in *LeaseLeasesRequest, opts ...grpc.CallOption) (*LeaseLeasesResponse, error)
+	LeaseWatch(ctx context.Context, in *LeaseWatchRequest, opts ...grpc.CallOption) (Lease_LeaseWatchClient, error)
 }
 
 type leaseClient struct {
@@ -628,3 +770,35 @@ func (c *leaseClient) LeaseLeases(ctx context.Context, in *LeaseLeasesRequest, o
 	}
 	return out, nil
 }
+
+func (c *leaseClient) LeaseWatch(ctx context.Context, in *LeaseWatchRequest, opts ...grpc.CallOption) (Lease_LeaseWatchClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Lease_serviceDesc.Streams[1], "/etcdserverpb.Lease/LeaseWatch", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &leaseLeaseWatchClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Lease_LeaseWatchClient interface {
+	Recv() (*LeaseWatchResponse, error)
+	grpc.ClientStream
+}
+
+type leaseLeaseWatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *leaseLeaseWatchClient) Recv() (*LeaseWatchResponse, error) {
+	m := new(LeaseWatchResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -33,6 +33,13 @@ type ASD struct {
 	AuthDisable              *AuthDisableRequest                       `protobuf:"bytes,1011,opt,name=auth_disable,json=authDisable,proto3" json:"auth_disable,omitempty"`
 	AuthStatus               *AuthStatusRequest                        `protobuf:"bytes,1013,opt,name=auth_status,json=authStatus,proto3" json:"auth_status,omitempty"`
 	Authenticate             *InternalAuthenticateRequest              `protobuf:"bytes,1012,opt,name=authenticate,proto3" json:"authenticate,omitempty"`
+	AuthLoginFailure         *InternalAuthLoginFailureRequest          `protobuf:"bytes,1014,opt,name=auth_login_failure,json=authLoginFailure,proto3" json:"auth_login_failure,omitempty"`
+	NotifyCursor             *InternalNotifyCursorRequest              `protobuf:"bytes,12,opt,name=notify_cursor,json=notifyCursor,proto3" json:"notify_cursor,omitempty"`
+	CompactionHold           *InternalCompactionHoldRequest            `protobuf:"bytes,13,opt,name=compaction_hold,json=compactionHold,proto3" json:"compaction_hold,omitempty"`
+	StagedTxn                *InternalStagedTxnRequest                 `protobuf:"bytes,14,opt,name=staged_txn,json=stagedTxn,proto3" json:"staged_txn,omitempty"`
+	UserUsageReset           *UserUsageRequest                         `protobuf:"bytes,15,opt,name=user_usage_reset,json=userUsageReset,proto3" json:"user_usage_reset,omitempty"`
+	ReplicaPromote           *InternalReplicaPromoteRequest            `protobuf:"bytes,16,opt,name=replica_promote,json=replicaPromote,proto3" json:"replica_promote,omitempty"`
+	LeaseRevokeExpired       *InternalLeaseRevokeExpiredRequest        `protobuf:"bytes,17,opt,name=lease_revoke_expired,json=leaseRevokeExpired,proto3" json:"lease_revoke_expired,omitempty"`
 	AuthUserAdd              *AuthUserAddRequest                       `protobuf:"bytes,1100,opt,name=auth_user_add,json=authUserAdd,proto3" json:"auth_user_add,omitempty"`
 	AuthUserDelete           *AuthUserDeleteRequest                    `protobuf:"bytes,1101,opt,name=auth_user_delete,json=authUserDelete,proto3" json:"auth_user_delete,omitempty"`
 	AuthUserGet              *AuthUserGetRequest                       `protobuf:"bytes,1102,opt,name=auth_user_get,json=authUserGet,proto3" json:"auth_user_get,omitempty"`
@@ -76,6 +83,13 @@ func (m *InternalRaftRequest) Marshal() (dAtA []byte, err error) {
 		AuthEnable:               m.AuthEnable,
 		AuthUserDelete:           m.AuthUserDelete,
 		Authenticate:             m.Authenticate,
+		AuthLoginFailure:         m.AuthLoginFailure,
+		NotifyCursor:             m.NotifyCursor,
+		CompactionHold:           m.CompactionHold,
+		StagedTxn:                m.StagedTxn,
+		UserUsageReset:           m.UserUsageReset,
+		ReplicaPromote:           m.ReplicaPromote,
+		LeaseRevokeExpired:       m.LeaseRevokeExpired,
 		AuthUserGet:              m.AuthUserGet,
 		AuthRoleGrantPermission:  m.AuthRoleGrantPermission,
 		AuthUserRevokeRole:       m.AuthUserRevokeRole,
@@ -144,6 +158,13 @@ func (m *InternalRaftRequest) Unmarshal(dAtA []byte) error {
 	m.AuthUserDelete = a.AuthUserDelete
 	m.AuthRoleGrantPermission = a.AuthRoleGrantPermission
 	m.Authenticate = a.Authenticate
+	m.AuthLoginFailure = a.AuthLoginFailure
+	m.NotifyCursor = a.NotifyCursor
+	m.CompactionHold = a.CompactionHold
+	m.StagedTxn = a.StagedTxn
+	m.UserUsageReset = a.UserUsageReset
+	m.ReplicaPromote = a.ReplicaPromote
+	m.LeaseRevokeExpired = a.LeaseRevokeExpired
 	m.AuthUserGet = a.AuthUserGet
 	m.AuthUserRevokeRole = a.AuthUserRevokeRole
 	m.LeaseGrant = a.LeaseGrant
@@ -29,7 +29,11 @@ type RequestHeader struct {
 	// username is a username that is associated with an auth token of gRPC connection
 	Username string `protobuf:"bytes,2,opt,name=username,proto3" json:"username,omitempty"`
 	// auth_revision is a revision number of auth.authStore. It is not related to mvcc
-	AuthRevision         uint64   `protobuf:"varint,3,opt,name=auth_revision,json=authRevision,proto3" json:"auth_revision,omitempty"`
+	AuthRevision uint64 `protobuf:"varint,3,opt,name=auth_revision,json=authRevision,proto3" json:"auth_revision,omitempty"`
+	// time 提议请求时的时间(UnixNano),apply时用于判断外部用户是否过期
+	Time int64 `protobuf:"varint,4,opt,name=time,proto3" json:"time,omitempty"`
+	// replica 为true表示请求是副本集群从上游复制的写入
+	Replica              bool     `protobuf:"varint,5,opt,name=replica,proto3" json:"replica,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -57,10 +61,17 @@ type InternalRaftRequest struct {
 	LeaseRevoke              *LeaseRevokeRequest                       `protobuf:"bytes,9,opt,name=lease_revoke,json=leaseRevoke,proto3" json:"lease_revoke,omitempty"`
 	Alarm                    *AlarmRequest                             `protobuf:"bytes,10,opt,name=alarm,proto3" json:"alarm,omitempty"`
 	LeaseCheckpoint          *LeaseCheckpointRequest                   `protobuf:"bytes,11,opt,name=lease_checkpoint,json=leaseCheckpoint,proto3" json:"lease_checkpoint,omitempty"`
+	NotifyCursor             *InternalNotifyCursorRequest              `protobuf:"bytes,12,opt,name=notify_cursor,json=notifyCursor,proto3" json:"notify_cursor,omitempty"`
+	CompactionHold           *InternalCompactionHoldRequest            `protobuf:"bytes,13,opt,name=compaction_hold,json=compactionHold,proto3" json:"compaction_hold,omitempty"`
+	StagedTxn                *InternalStagedTxnRequest                 `protobuf:"bytes,14,opt,name=staged_txn,json=stagedTxn,proto3" json:"staged_txn,omitempty"`
+	UserUsageReset           *UserUsageRequest                         `protobuf:"bytes,15,opt,name=user_usage_reset,json=userUsageReset,proto3" json:"user_usage_reset,omitempty"`
+	ReplicaPromote           *InternalReplicaPromoteRequest            `protobuf:"bytes,16,opt,name=replica_promote,json=replicaPromote,proto3" json:"replica_promote,omitempty"`
+	LeaseRevokeExpired       *InternalLeaseRevokeExpiredRequest        `protobuf:"bytes,17,opt,name=lease_revoke_expired,json=leaseRevokeExpired,proto3" json:"lease_revoke_expired,omitempty"`
 	AuthEnable               *AuthEnableRequest                        `protobuf:"bytes,1000,opt,name=auth_enable,json=authEnable,proto3" json:"auth_enable,omitempty"`
 	AuthDisable              *AuthDisableRequest                       `protobuf:"bytes,1011,opt,name=auth_disable,json=authDisable,proto3" json:"auth_disable,omitempty"`
 	AuthStatus               *AuthStatusRequest                        `protobuf:"bytes,1013,opt,name=auth_status,json=authStatus,proto3" json:"auth_status,omitempty"`
 	Authenticate             *InternalAuthenticateRequest              `protobuf:"bytes,1012,opt,name=authenticate,proto3" json:"authenticate,omitempty"`
+	AuthLoginFailure         *InternalAuthLoginFailureRequest          `protobuf:"bytes,1014,opt,name=auth_login_failure,json=authLoginFailure,proto3" json:"auth_login_failure,omitempty"`
 	AuthUserAdd              *AuthUserAddRequest                       `protobuf:"bytes,1100,opt,name=auth_user_add,json=authUserAdd,proto3" json:"auth_user_add,omitempty"`
 	AuthUserDelete           *AuthUserDeleteRequest                    `protobuf:"bytes,1101,opt,name=auth_user_delete,json=authUserDelete,proto3" json:"auth_user_delete,omitempty"`
 	AuthUserGet              *AuthUserGetRequest                       `protobuf:"bytes,1102,opt,name=auth_user_get,json=authUserGet,proto3" json:"auth_user_get,omitempty"`
@@ -109,12 +120,118 @@ type InternalAuthenticateRequest struct {
 	Name     string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
 	Password string `protobuf:"bytes,2,opt,name=password,proto3" json:"password,omitempty"`
 	// simple_token is generated in API layer (etcdserver/v3_server.go)
-	SimpleToken          string   `protobuf:"bytes,3,opt,name=simple_token,json=simpleToken,proto3" json:"simple_token,omitempty"`
+	SimpleToken string `protobuf:"bytes,3,opt,name=simple_token,json=simpleToken,proto3" json:"simple_token,omitempty"`
+	// external 为true表示用户由外部认证,roles为外部认证返回的角色
+	External bool     `protobuf:"varint,4,opt,name=external,proto3" json:"external,omitempty"`
+	Roles    []string `protobuf:"bytes,5,rep,name=roles,proto3" json:"roles,omitempty"`
+	// refresh_token_hash 本次签发的refresh token摘要,prev_refresh_token_hash 被换取(作废)的refresh token摘要
+	RefreshTokenHash     string `protobuf:"bytes,6,opt,name=refresh_token_hash,json=refreshTokenHash,proto3" json:"refresh_token_hash,omitempty"`
+	RefreshTokenExpires  int64  `protobuf:"varint,7,opt,name=refresh_token_expires,json=refreshTokenExpires,proto3" json:"refresh_token_expires,omitempty"`
+	PrevRefreshTokenHash string `protobuf:"bytes,8,opt,name=prev_refresh_token_hash,json=prevRefreshTokenHash,proto3" json:"prev_refresh_token_hash,omitempty"`
+	// issued_at 签发时间,单位秒,用于清理过期的refresh token
+	IssuedAt int64 `protobuf:"varint,9,opt,name=issued_at,json=issuedAt,proto3" json:"issued_at,omitempty"`
+	// external_expires 外部用户的过期时间(UnixNano),external_issued_at 认证时间(UnixNano)
+	ExternalExpires      int64    `protobuf:"varint,10,opt,name=external_expires,json=externalExpires,proto3" json:"external_expires,omitempty"`
+	ExternalIssuedAt     int64    `protobuf:"varint,11,opt,name=external_issued_at,json=externalIssuedAt,proto3" json:"external_issued_at,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
 }
 
+// InternalAuthLoginFailureRequest 记录一次登录失败,由API层在密码校验失败时发起;
+// 时间与锁定策略随请求携带,保证各节点apply结果一致
+type InternalAuthLoginFailureRequest struct {
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// time 失败时间,单位秒
+	Time int64 `protobuf:"varint,2,opt,name=time,proto3" json:"time,omitempty"`
+	// threshold 连续失败多少次后锁定; duration 锁定时长以及失败计数的衰减窗口,单位秒
+	Threshold            int32    `protobuf:"varint,3,opt,name=threshold,proto3" json:"threshold,omitempty"`
+	Duration             int64    `protobuf:"varint,4,opt,name=duration,proto3" json:"duration,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *InternalAuthLoginFailureRequest) Reset()         { *m = InternalAuthLoginFailureRequest{} }
+func (m *InternalAuthLoginFailureRequest) String() string { return proto.CompactTextString(m) }
+func (*InternalAuthLoginFailureRequest) ProtoMessage()    {}
+
+// InternalNotifyCursorRequest 记录通知sink已投递到的修订版本,leader变更后新leader从这里继续投递
+type InternalNotifyCursorRequest struct {
+	Sink                 string   `protobuf:"bytes,1,opt,name=sink,proto3" json:"sink,omitempty"`
+	Revision             int64    `protobuf:"varint,2,opt,name=revision,proto3" json:"revision,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *InternalNotifyCursorRequest) Reset()         { *m = InternalNotifyCursorRequest{} }
+func (m *InternalNotifyCursorRequest) String() string { return proto.CompactTextString(m) }
+func (*InternalNotifyCursorRequest) ProtoMessage()    {}
+
+// InternalCompactionHoldRequest 注册或释放压缩保留;过期时间和当前时间由发起请求的成员填写,保证各成员的过期清理一致
+type InternalCompactionHoldRequest struct {
+	Owner    string `protobuf:"bytes,1,opt,name=owner,proto3" json:"owner,omitempty"`
+	Revision int64  `protobuf:"varint,2,opt,name=revision,proto3" json:"revision,omitempty"`
+	// expires 过期时间,单位秒
+	Expires int64 `protobuf:"varint,3,opt,name=expires,proto3" json:"expires,omitempty"`
+	Release bool  `protobuf:"varint,4,opt,name=release,proto3" json:"release,omitempty"`
+	// time 请求时间,单位秒,此时已过期的保留会被清理
+	Time                 int64    `protobuf:"varint,5,opt,name=time,proto3" json:"time,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *InternalCompactionHoldRequest) Reset()         { *m = InternalCompactionHoldRequest{} }
+func (m *InternalCompactionHoldRequest) String() string { return proto.CompactTextString(m) }
+func (*InternalCompactionHoldRequest) ProtoMessage()    {}
+
+// InternalStagedTxnRequest 追加、提交或放弃暂存事务;暂存ID、过期时间和当前时间由发起请求的成员填写
+type InternalStagedTxnRequest struct {
+	Request *StagedTxnRequest `protobuf:"bytes,1,opt,name=request,proto3" json:"request,omitempty"`
+	// create 追加时创建暂存事务
+	Create bool `protobuf:"varint,2,opt,name=create,proto3" json:"create,omitempty"`
+	// expires 过期时间,单位秒
+	Expires int64 `protobuf:"varint,3,opt,name=expires,proto3" json:"expires,omitempty"`
+	// time 请求时间,单位秒,此时已过期的暂存事务会被清理
+	Time int64 `protobuf:"varint,4,opt,name=time,proto3" json:"time,omitempty"`
+	// max_stages、max_ops、max_bytes 发起请求的成员的暂存事务限制,追加时按这些限制检查,0表示不限制
+	MaxStages            int32    `protobuf:"varint,5,opt,name=max_stages,json=maxStages,proto3" json:"max_stages,omitempty"`
+	MaxOps               int64    `protobuf:"varint,6,opt,name=max_ops,json=maxOps,proto3" json:"max_ops,omitempty"`
+	MaxBytes             int64    `protobuf:"varint,7,opt,name=max_bytes,json=maxBytes,proto3" json:"max_bytes,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *InternalStagedTxnRequest) Reset()         { *m = InternalStagedTxnRequest{} }
+func (m *InternalStagedTxnRequest) String() string { return proto.CompactTextString(m) }
+func (*InternalStagedTxnRequest) ProtoMessage()    {}
+
+// InternalReplicaPromoteRequest 提升只读副本集群,apply后各成员停止从上游集群复制并接受写请求
+type InternalReplicaPromoteRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *InternalReplicaPromoteRequest) Reset()         { *m = InternalReplicaPromoteRequest{} }
+func (m *InternalReplicaPromoteRequest) String() string { return proto.CompactTextString(m) }
+func (*InternalReplicaPromoteRequest) ProtoMessage()    {}
+
+// InternalLeaseRevokeExpiredRequest 按顺序撤销一批过期租约,apply时逐个撤销,已经不存在的租约跳过
+type InternalLeaseRevokeExpiredRequest struct {
+	IDs                  []int64  `protobuf:"varint,1,rep,packed,name=IDs,proto3" json:"IDs,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *InternalLeaseRevokeExpiredRequest) Reset()         { *m = InternalLeaseRevokeExpiredRequest{} }
+func (m *InternalLeaseRevokeExpiredRequest) String() string { return proto.CompactTextString(m) }
+func (*InternalLeaseRevokeExpiredRequest) ProtoMessage()    {}
+
 func (m *InternalAuthenticateRequest) Reset()         { *m = InternalAuthenticateRequest{} }
 func (m *InternalAuthenticateRequest) String() string { return proto.CompactTextString(m) }
 func (*InternalAuthenticateRequest) ProtoMessage()    {}
@@ -127,6 +244,12 @@ func init() {
 	proto.RegisterType((*InternalRaftRequest)(nil), "etcdserverpb.InternalRaftRequest")
 	proto.RegisterType((*EmptyResponse)(nil), "etcdserverpb.EmptyResponse")
 	proto.RegisterType((*InternalAuthenticateRequest)(nil), "etcdserverpb.InternalAuthenticateRequest")
+	proto.RegisterType((*InternalAuthLoginFailureRequest)(nil), "etcdserverpb.InternalAuthLoginFailureRequest")
+	proto.RegisterType((*InternalNotifyCursorRequest)(nil), "etcdserverpb.InternalNotifyCursorRequest")
+	proto.RegisterType((*InternalCompactionHoldRequest)(nil), "etcdserverpb.InternalCompactionHoldRequest")
+	proto.RegisterType((*InternalStagedTxnRequest)(nil), "etcdserverpb.InternalStagedTxnRequest")
+	proto.RegisterType((*InternalReplicaPromoteRequest)(nil), "etcdserverpb.InternalReplicaPromoteRequest")
+	proto.RegisterType((*InternalLeaseRevokeExpiredRequest)(nil), "etcdserverpb.InternalLeaseRevokeExpiredRequest")
 }
 
 func init() { proto.RegisterFile("raft_internal.proto", fileDescriptor_b4c9a9be0cfca103) }
@@ -34,21 +34,33 @@ const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
 type AlarmType int32
 
 const (
-	AlarmType_NONE    AlarmType = 0
-	AlarmType_NOSPACE AlarmType = 1
-	AlarmType_CORRUPT AlarmType = 2
+	AlarmType_NONE        AlarmType = 0
+	AlarmType_NOSPACE     AlarmType = 1
+	AlarmType_CORRUPT     AlarmType = 2
+	AlarmType_UNREACHABLE AlarmType = 3
+	AlarmType_TOPOLOGY    AlarmType = 4
+	AlarmType_BACKUP      AlarmType = 5
+	AlarmType_CLOCK_SKEW  AlarmType = 6
 )
 
 var AlarmType_name = map[int32]string{
 	0: "NONE",
 	1: "NOSPACE",
 	2: "CORRUPT",
+	3: "UNREACHABLE",
+	4: "TOPOLOGY",
+	5: "BACKUP",
+	6: "CLOCK_SKEW",
 }
 
 var AlarmType_value = map[string]int32{
-	"NONE":    0,
-	"NOSPACE": 1,
-	"CORRUPT": 2,
+	"NONE":        0,
+	"NOSPACE":     1,
+	"CORRUPT":     2,
+	"UNREACHABLE": 3,
+	"TOPOLOGY":    4,
+	"BACKUP":      5,
+	"CLOCK_SKEW":  6,
 }
 
 func (x AlarmType) String() string {
@@ -193,16 +205,20 @@ const (
 	WatchCreateRequest_NOPUT WatchCreateRequest_FilterType = 0
 	// filter out delete event.
 	WatchCreateRequest_NODELETE WatchCreateRequest_FilterType = 1
+	// filter out put event that does not change the value.
+	WatchCreateRequest_NOUNCHANGED WatchCreateRequest_FilterType = 2
 )
 
 var WatchCreateRequest_FilterType_name = map[int32]string{
 	0: "NOPUT",
 	1: "NODELETE",
+	2: "NOUNCHANGED",
 }
 
 var WatchCreateRequest_FilterType_value = map[string]int32{
-	"NOPUT":    0,
-	"NODELETE": 1,
+	"NOPUT":       0,
+	"NODELETE":    1,
+	"NOUNCHANGED": 2,
 }
 
 func (x WatchCreateRequest_FilterType) String() string {
@@ -247,18 +263,21 @@ const (
 	DowngradeRequest_VALIDATE DowngradeRequest_DowngradeAction = 0
 	DowngradeRequest_ENABLE   DowngradeRequest_DowngradeAction = 1
 	DowngradeRequest_CANCEL   DowngradeRequest_DowngradeAction = 2
+	DowngradeRequest_PROMOTE  DowngradeRequest_DowngradeAction = 3
 )
 
 var DowngradeRequest_DowngradeAction_name = map[int32]string{
 	0: "VALIDATE",
 	1: "ENABLE",
 	2: "CANCEL",
+	3: "PROMOTE",
 }
 
 var DowngradeRequest_DowngradeAction_value = map[string]int32{
 	"VALIDATE": 0,
 	"ENABLE":   1,
 	"CANCEL":   2,
+	"PROMOTE":  3,
 }
 
 func (x DowngradeRequest_DowngradeAction) String() string {
@@ -269,6 +288,33 @@ func (DowngradeRequest_DowngradeAction) EnumDescriptor() ([]byte, []int) {
 	return fileDescriptor_77a6da22d6a3feb1, []int{57, 0}
 }
 
+type StagedTxnRequest_Action int32
+
+const (
+	// APPEND adds the operations of the request to the stage.
+	StagedTxnRequest_APPEND StagedTxnRequest_Action = 0
+	// COMMIT applies the staged transaction atomically.
+	StagedTxnRequest_COMMIT StagedTxnRequest_Action = 1
+	// ABORT drops the stage.
+	StagedTxnRequest_ABORT StagedTxnRequest_Action = 2
+)
+
+var StagedTxnRequest_Action_name = map[int32]string{
+	0: "APPEND",
+	1: "COMMIT",
+	2: "ABORT",
+}
+
+var StagedTxnRequest_Action_value = map[string]int32{
+	"APPEND": 0,
+	"COMMIT": 1,
+	"ABORT":  2,
+}
+
+func (x StagedTxnRequest_Action) String() string {
+	return proto.EnumName(StagedTxnRequest_Action_name, int32(x))
+}
+
 type ResponseHeader struct {
 	// cluster_id is the ID of the cluster which sent the response.
 	ClusterId uint64 `protobuf:"varint,1,opt,name=cluster_id,json=clusterId,proto3" json:"cluster_id,omitempty"`
@@ -276,6 +322,8 @@ type ResponseHeader struct {
 	Revision  int64  // 当前 watchResponse 实例创建时对应的 revision 值
 	// raft_term is the raft term when the request was applied.
 	RaftTerm uint64 `protobuf:"varint,4,opt,name=raft_term,json=raftTerm,proto3" json:"raft_term,omitempty"`
+	// leader_client_urls is set on write responses served by a follower to the client URLs of the current leader.
+	LeaderClientUrls []string `protobuf:"bytes,5,rep,name=leader_client_urls,json=leaderClientUrls,proto3" json:"leader_client_urls,omitempty"`
 }
 
 func (m *ResponseHeader) Reset()         { *m = ResponseHeader{} }
@@ -313,6 +361,13 @@ func (m *ResponseHeader) GetRaftTerm() uint64 {
 	return 0
 }
 
+func (m *ResponseHeader) GetLeaderClientUrls() []string {
+	if m != nil {
+		return m.LeaderClientUrls
+	}
+	return nil
+}
+
 type RangeRequest struct {
 	// key is the first key for the range. If range_end is not given, the request only looks up key.
 	Key string `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
@@ -350,6 +405,10 @@ type RangeRequest struct {
 	// max_create_revision is the upper bound for returned key create revisions; all keys with
 	// greater create revisions will be filtered away.
 	MaxCreateRevision int64 `protobuf:"varint,13,opt,name=max_create_revision,json=maxCreateRevision,proto3" json:"max_create_revision,omitempty"`
+	// snapshot_token serves the range at the revision pinned by the snapshot
+	// session, see Maintenance.SnapshotSession. An expired or released session
+	// is an error; revision must be 0 or equal to the pinned revision.
+	SnapshotToken string `protobuf:"bytes,14,opt,name=snapshot_token,json=snapshotToken,proto3" json:"snapshot_token,omitempty"`
 }
 
 func (m *RangeRequest) Reset()         { *m = RangeRequest{} }
@@ -450,6 +509,13 @@ func (m *RangeRequest) GetMaxCreateRevision() int64 {
 	return 0
 }
 
+func (m *RangeRequest) GetSnapshotToken() string {
+	if m != nil {
+		return m.SnapshotToken
+	}
+	return ""
+}
+
 type RangeResponse struct {
 	Header *ResponseHeader    `protobuf:"bytes,1,opt,name=header,proto3" json:"header,omitempty"`
 	Kvs    []*mvccpb.KeyValue `protobuf:"bytes,2,rep,name=kvs,proto3" json:"kvs,omitempty"`      // 表示符合range 请求的key-value 对列表.如果Count_Only 设置为true ,则kvs 就为空.
@@ -507,6 +573,8 @@ type PutRequest struct {
 	// If ignore_lease is set, etcd updates the key using its current lease.
 	// Returns an error if the key does not exist.
 	IgnoreLease bool `protobuf:"varint,6,opt,name=ignore_lease,json=ignoreLease,proto3" json:"ignore_lease,omitempty"`
+	// IdempotencyToken 非空时,相同token的重复请求只会应用一次,后续直接返回第一次的响应
+	IdempotencyToken string `protobuf:"bytes,7,opt,name=idempotency_token,json=idempotencyToken,proto3" json:"idempotency_token,omitempty"`
 }
 
 func (m *PutRequest) Reset()         { *m = PutRequest{} }
@@ -986,10 +1054,12 @@ type TxnRequest struct {
 	// success is a list of requests which will be applied when compare evaluates to true.
 	Success []*RequestOp `protobuf:"bytes,2,rep,name=success,proto3" json:"success,omitempty"`
 	// failure is a list of requests which will be applied when compare evaluates to false.
-	Failure              []*RequestOp `protobuf:"bytes,3,rep,name=failure,proto3" json:"failure,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}     `json:"-"`
-	XXX_unrecognized     []byte       `json:"-"`
-	XXX_sizecache        int32        `json:"-"`
+	Failure []*RequestOp `protobuf:"bytes,3,rep,name=failure,proto3" json:"failure,omitempty"`
+	// IdempotencyToken 非空时,相同token的重复请求只会应用一次,后续直接返回第一次的响应
+	IdempotencyToken     string   `protobuf:"bytes,4,opt,name=idempotency_token,json=idempotencyToken,proto3" json:"idempotency_token,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
 }
 
 func (m *TxnRequest) Reset()         { *m = TxnRequest{} }
@@ -1060,6 +1130,105 @@ func (m *TxnResponse) GetResponses() []*ResponseOp {
 	return nil
 }
 
+type StagedTxnRequest struct {
+	Action StagedTxnRequest_Action `protobuf:"varint,1,opt,name=action,proto3,enum=etcdserverpb.StagedTxnRequest_Action" json:"action,omitempty"`
+	// stage_id identifies the stage. APPEND with stage_id 0 creates a new stage.
+	StageId int64 `protobuf:"varint,2,opt,name=stage_id,json=stageId,proto3" json:"stage_id,omitempty"`
+	// compare, success and failure are appended to the staged transaction.
+	Compare []*Compare   `protobuf:"bytes,3,rep,name=compare,proto3" json:"compare,omitempty"`
+	Success []*RequestOp `protobuf:"bytes,4,rep,name=success,proto3" json:"success,omitempty"`
+	Failure []*RequestOp `protobuf:"bytes,5,rep,name=failure,proto3" json:"failure,omitempty"`
+}
+
+func (m *StagedTxnRequest) Reset()         { *m = StagedTxnRequest{} }
+func (m *StagedTxnRequest) String() string { return proto.CompactTextString(m) }
+func (*StagedTxnRequest) ProtoMessage()    {}
+
+func (m *StagedTxnRequest) GetAction() StagedTxnRequest_Action {
+	if m != nil {
+		return m.Action
+	}
+	return StagedTxnRequest_APPEND
+}
+
+func (m *StagedTxnRequest) GetStageId() int64 {
+	if m != nil {
+		return m.StageId
+	}
+	return 0
+}
+
+func (m *StagedTxnRequest) GetCompare() []*Compare {
+	if m != nil {
+		return m.Compare
+	}
+	return nil
+}
+
+func (m *StagedTxnRequest) GetSuccess() []*RequestOp {
+	if m != nil {
+		return m.Success
+	}
+	return nil
+}
+
+func (m *StagedTxnRequest) GetFailure() []*RequestOp {
+	if m != nil {
+		return m.Failure
+	}
+	return nil
+}
+
+type StagedTxnResponse struct {
+	Header  *ResponseHeader `protobuf:"bytes,1,opt,name=header,proto3" json:"header,omitempty"`
+	StageId int64           `protobuf:"varint,2,opt,name=stage_id,json=stageId,proto3" json:"stage_id,omitempty"`
+	// ops is the number of operations staged so far.
+	Ops int64 `protobuf:"varint,3,opt,name=ops,proto3" json:"ops,omitempty"`
+	// bytes is the encoded size of the operations staged so far.
+	Bytes int64 `protobuf:"varint,4,opt,name=bytes,proto3" json:"bytes,omitempty"`
+	// txn is the result of COMMIT.
+	Txn *TxnResponse `protobuf:"bytes,5,opt,name=txn,proto3" json:"txn,omitempty"`
+}
+
+func (m *StagedTxnResponse) Reset()         { *m = StagedTxnResponse{} }
+func (m *StagedTxnResponse) String() string { return proto.CompactTextString(m) }
+func (*StagedTxnResponse) ProtoMessage()    {}
+
+func (m *StagedTxnResponse) GetHeader() *ResponseHeader {
+	if m != nil {
+		return m.Header
+	}
+	return nil
+}
+
+func (m *StagedTxnResponse) GetStageId() int64 {
+	if m != nil {
+		return m.StageId
+	}
+	return 0
+}
+
+func (m *StagedTxnResponse) GetOps() int64 {
+	if m != nil {
+		return m.Ops
+	}
+	return 0
+}
+
+func (m *StagedTxnResponse) GetBytes() int64 {
+	if m != nil {
+		return m.Bytes
+	}
+	return 0
+}
+
+func (m *StagedTxnResponse) GetTxn() *TxnResponse {
+	if m != nil {
+		return m.Txn
+	}
+	return nil
+}
+
 type CompactionRequest struct {
 	//  Revision是用于压缩操作的键-值存储修订.
 	Revision int64 `protobuf:"varint,1,opt,name=revision,proto3" json:"revision,omitempty"`
@@ -1338,6 +1507,14 @@ type WatchCreateRequest struct {
 	WatchId int64 `protobuf:"varint,7,opt,name=watch_id,json=watchId,proto3" json:"watch_id,omitempty"`
 	// 拆分大的变更 成多个watch响应.
 	Fragment bool `protobuf:"varint,8,opt,name=fragment,proto3" json:"fragment,omitempty"`
+	// 在服务端对JSON value求值的JSONPath表达式,事件中的value被替换为表达式到所选元素的JSON对象
+	Projections []string `protobuf:"bytes,9,rep,name=projections,proto3" json:"projections,omitempty"`
+	// 事件中的value被替换为value的sha256十六进制摘要,不能与projections同时使用
+	ValueHash bool `protobuf:"varint,10,opt,name=value_hash,json=valueHash,proto3" json:"value_hash,omitempty"`
+	// 过滤掉key与glob模式(path.Match语法)不匹配的事件
+	KeyGlob string `protobuf:"bytes,11,opt,name=key_glob,json=keyGlob,proto3" json:"key_glob,omitempty"`
+	// 过滤掉key与正则表达式不匹配的事件
+	KeyRegex string `protobuf:"bytes,12,opt,name=key_regex,json=keyRegex,proto3" json:"key_regex,omitempty"`
 }
 
 func (m *WatchCreateRequest) Reset()         { *m = WatchCreateRequest{} }
@@ -1403,6 +1580,34 @@ func (m *WatchCreateRequest) GetFragment() bool {
 	return false
 }
 
+func (m *WatchCreateRequest) GetProjections() []string {
+	if m != nil {
+		return m.Projections
+	}
+	return nil
+}
+
+func (m *WatchCreateRequest) GetValueHash() bool {
+	if m != nil {
+		return m.ValueHash
+	}
+	return false
+}
+
+func (m *WatchCreateRequest) GetKeyGlob() string {
+	if m != nil {
+		return m.KeyGlob
+	}
+	return ""
+}
+
+func (m *WatchCreateRequest) GetKeyRegex() string {
+	if m != nil {
+		return m.KeyRegex
+	}
+	return ""
+}
+
 type WatchCancelRequest struct {
 	// watch_id is the watcher id to cancel so that no more events are transmitted.
 	WatchId int64 `protobuf:"varint,1,opt,name=watch_id,json=watchId,proto3" json:"watch_id,omitempty"`
@@ -1521,6 +1726,8 @@ type Member struct {
 	ClientURLs []string `protobuf:"bytes,4,rep,name=clientURLs,proto3" json:"clientURLs,omitempty"`
 	// isLearner indicates if the member is raft learner.
 	IsLearner bool `protobuf:"varint,5,opt,name=isLearner,proto3" json:"isLearner,omitempty"`
+	// labels is the arbitrary key/value metadata attached to the member, e.g. zone, rack, role.
+	Labels map[string]string `protobuf:"bytes,6,rep,name=labels,proto3" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
 }
 
 func (m *Member) Reset()         { *m = Member{} }
@@ -1565,10 +1772,18 @@ func (m *Member) GetIsLearner() bool {
 	return false
 }
 
+func (m *Member) GetLabels() map[string]string {
+	if m != nil {
+		return m.Labels
+	}
+	return nil
+}
+
 type MemberAddRequest struct {
 	// peerURLs是新增成员用来与集群通信的URL列表.
-	PeerURLs  []string `protobuf:"bytes,1,rep,name=peerURLs,proto3" json:"peerURLs,omitempty"`
-	IsLearner bool     `protobuf:"varint,2,opt,name=isLearner,proto3" json:"isLearner,omitempty"`
+	PeerURLs  []string          `protobuf:"bytes,1,rep,name=peerURLs,proto3" json:"peerURLs,omitempty"`
+	IsLearner bool              `protobuf:"varint,2,opt,name=isLearner,proto3" json:"isLearner,omitempty"`
+	Labels    map[string]string `protobuf:"bytes,3,rep,name=labels,proto3" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
 }
 
 func (m *MemberAddRequest) Reset()         { *m = MemberAddRequest{} }
@@ -1592,6 +1807,13 @@ func (m *MemberAddRequest) GetIsLearner() bool {
 	return false
 }
 
+func (m *MemberAddRequest) GetLabels() map[string]string {
+	if m != nil {
+		return m.Labels
+	}
+	return nil
+}
+
 type MemberAddResponse struct {
 	Header *ResponseHeader `protobuf:"bytes,1,opt,name=header,proto3" json:"header,omitempty"`
 	// member is the member information for the added member.
@@ -1685,6 +1907,8 @@ type MemberUpdateRequest struct {
 	ID uint64 `protobuf:"varint,1,opt,name=ID,proto3" json:"ID,omitempty"`
 	// peerURLs is the new list of URLs the member will use to communicate with the cluster.
 	PeerURLs []string `protobuf:"bytes,2,rep,name=peerURLs,proto3" json:"peerURLs,omitempty"`
+	// labels 会合并到成员现有的标签中,值为空的标签会被删除
+	Labels map[string]string `protobuf:"bytes,3,rep,name=labels,proto3" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
 }
 
 func (m *MemberUpdateRequest) Reset()         { *m = MemberUpdateRequest{} }
@@ -1708,6 +1932,13 @@ func (m *MemberUpdateRequest) GetPeerURLs() []string {
 	return nil
 }
 
+func (m *MemberUpdateRequest) GetLabels() map[string]string {
+	if m != nil {
+		return m.Labels
+	}
+	return nil
+}
+
 type MemberUpdateResponse struct {
 	Header *ResponseHeader `protobuf:"bytes,1,opt,name=header,proto3" json:"header,omitempty"`
 	// members is a list of all members after updating the member.
@@ -1759,10 +1990,13 @@ func (m *MemberListRequest) GetLinearizable() bool {
 type MemberListResponse struct {
 	Header *ResponseHeader `protobuf:"bytes,1,opt,name=header,proto3" json:"header,omitempty"`
 	// members is a list of all members associated with the cluster.
-	Members              []*Member `protobuf:"bytes,2,rep,name=members,proto3" json:"members,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}  `json:"-"`
-	XXX_unrecognized     []byte    `json:"-"`
-	XXX_sizecache        int32     `json:"-"`
+	Members []*Member `protobuf:"bytes,2,rep,name=members,proto3" json:"members,omitempty"`
+	// learnerProgress is the replication progress of the learners, only
+	// reported when the responding member is the leader.
+	LearnerProgress      []*LearnerProgress `protobuf:"bytes,3,rep,name=learnerProgress,proto3" json:"learnerProgress,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}           `json:"-"`
+	XXX_unrecognized     []byte             `json:"-"`
+	XXX_sizecache        int32              `json:"-"`
 }
 
 func (m *MemberListResponse) Reset()         { *m = MemberListResponse{} }
@@ -1786,6 +2020,76 @@ func (m *MemberListResponse) GetMembers() []*Member {
 	return nil
 }
 
+func (m *MemberListResponse) GetLearnerProgress() []*LearnerProgress {
+	if m != nil {
+		return m.LearnerProgress
+	}
+	return nil
+}
+
+type LearnerProgress struct {
+	// ID is the member ID of the learner.
+	ID uint64 `protobuf:"varint,1,opt,name=ID,proto3" json:"ID,omitempty"`
+	// matchIndex is the highest log index the leader knows the learner has replicated.
+	MatchIndex uint64 `protobuf:"varint,2,opt,name=matchIndex,proto3" json:"matchIndex,omitempty"`
+	// lag is the number of entries the learner is behind the leader.
+	Lag uint64 `protobuf:"varint,3,opt,name=lag,proto3" json:"lag,omitempty"`
+	// state is the replication state of the learner on the leader: "probe",
+	// "replicate" or "snapshot".
+	State string `protobuf:"bytes,4,opt,name=state,proto3" json:"state,omitempty"`
+	// pendingSnapshot is the index of the snapshot being sent to the learner, 0 if none.
+	PendingSnapshot uint64 `protobuf:"varint,5,opt,name=pendingSnapshot,proto3" json:"pendingSnapshot,omitempty"`
+	// readySeconds is how long the lag has stayed within the auto-promotion
+	// threshold, 0 when auto-promotion is disabled or the learner is not ready.
+	ReadySeconds float64 `protobuf:"fixed64,6,opt,name=readySeconds,proto3" json:"readySeconds,omitempty"`
+}
+
+func (m *LearnerProgress) Reset()         { *m = LearnerProgress{} }
+func (m *LearnerProgress) String() string { return proto.CompactTextString(m) }
+func (*LearnerProgress) ProtoMessage()    {}
+
+func (m *LearnerProgress) GetID() uint64 {
+	if m != nil {
+		return m.ID
+	}
+	return 0
+}
+
+func (m *LearnerProgress) GetMatchIndex() uint64 {
+	if m != nil {
+		return m.MatchIndex
+	}
+	return 0
+}
+
+func (m *LearnerProgress) GetLag() uint64 {
+	if m != nil {
+		return m.Lag
+	}
+	return 0
+}
+
+func (m *LearnerProgress) GetState() string {
+	if m != nil {
+		return m.State
+	}
+	return ""
+}
+
+func (m *LearnerProgress) GetPendingSnapshot() uint64 {
+	if m != nil {
+		return m.PendingSnapshot
+	}
+	return 0
+}
+
+func (m *LearnerProgress) GetReadySeconds() float64 {
+	if m != nil {
+		return m.ReadySeconds
+	}
+	return 0
+}
+
 type MemberPromoteRequest struct {
 	// ID is the member ID of the member to promote.
 	ID uint64 `protobuf:"varint,1,opt,name=ID,proto3" json:"ID,omitempty"`
@@ -1805,6 +2109,73 @@ func (m *MemberPromoteRequest) GetID() uint64 {
 	return 0
 }
 
+type MemberBatchChangeRequest struct {
+	// add is the list of members to add.
+	Add []*MemberAddRequest `protobuf:"bytes,1,rep,name=add,proto3" json:"add,omitempty"`
+	// promote is the list of learner member IDs to promote to voting members.
+	Promote []uint64 `protobuf:"varint,2,rep,packed,name=promote,proto3" json:"promote,omitempty"`
+	// remove is the list of member IDs to remove.
+	Remove []uint64 `protobuf:"varint,3,rep,packed,name=remove,proto3" json:"remove,omitempty"`
+}
+
+func (m *MemberBatchChangeRequest) Reset()         { *m = MemberBatchChangeRequest{} }
+func (m *MemberBatchChangeRequest) String() string { return proto.CompactTextString(m) }
+func (*MemberBatchChangeRequest) ProtoMessage()    {}
+
+func (m *MemberBatchChangeRequest) GetAdd() []*MemberAddRequest {
+	if m != nil {
+		return m.Add
+	}
+	return nil
+}
+
+func (m *MemberBatchChangeRequest) GetPromote() []uint64 {
+	if m != nil {
+		return m.Promote
+	}
+	return nil
+}
+
+func (m *MemberBatchChangeRequest) GetRemove() []uint64 {
+	if m != nil {
+		return m.Remove
+	}
+	return nil
+}
+
+type MemberBatchChangeResponse struct {
+	Header *ResponseHeader `protobuf:"bytes,1,opt,name=header,proto3" json:"header,omitempty"`
+	// added is the member information for the added members, in request order.
+	Added []*Member `protobuf:"bytes,2,rep,name=added,proto3" json:"added,omitempty"`
+	// members is a list of all members after the change.
+	Members []*Member `protobuf:"bytes,3,rep,name=members,proto3" json:"members,omitempty"`
+}
+
+func (m *MemberBatchChangeResponse) Reset()         { *m = MemberBatchChangeResponse{} }
+func (m *MemberBatchChangeResponse) String() string { return proto.CompactTextString(m) }
+func (*MemberBatchChangeResponse) ProtoMessage()    {}
+
+func (m *MemberBatchChangeResponse) GetHeader() *ResponseHeader {
+	if m != nil {
+		return m.Header
+	}
+	return nil
+}
+
+func (m *MemberBatchChangeResponse) GetAdded() []*Member {
+	if m != nil {
+		return m.Added
+	}
+	return nil
+}
+
+func (m *MemberBatchChangeResponse) GetMembers() []*Member {
+	if m != nil {
+		return m.Members
+	}
+	return nil
+}
+
 type MemberPromoteResponse struct {
 	Header *ResponseHeader `protobuf:"bytes,1,opt,name=header,proto3" json:"header,omitempty"`
 	// members is a list of all members after promoting the member.
@@ -2061,73 +2432,829 @@ func (m *DowngradeResponse) GetVersion() string {
 	return ""
 }
 
-type StatusRequest struct{}
+type ReloadCertsRequest struct {
+	// report_only only reports the loaded certificates without reloading them.
+	ReportOnly bool `protobuf:"varint,1,opt,name=report_only,json=reportOnly,proto3" json:"report_only,omitempty"`
+}
 
-func (m *StatusRequest) Reset()         { *m = StatusRequest{} }
-func (m *StatusRequest) String() string { return proto.CompactTextString(m) }
-func (*StatusRequest) ProtoMessage()    {}
-func (*StatusRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_77a6da22d6a3feb1, []int{59}
+func (m *ReloadCertsRequest) Reset()         { *m = ReloadCertsRequest{} }
+func (m *ReloadCertsRequest) String() string { return proto.CompactTextString(m) }
+func (*ReloadCertsRequest) ProtoMessage()    {}
+
+func (m *ReloadCertsRequest) GetReportOnly() bool {
+	if m != nil {
+		return m.ReportOnly
+	}
+	return false
 }
 
-type StatusResponse struct {
-	Header *ResponseHeader `protobuf:"bytes,1,opt,name=header,proto3" json:"header,omitempty"`
-	// version is the cluster protocol version used by the responding member.
-	Version string `protobuf:"bytes,2,opt,name=version,proto3" json:"version,omitempty"`
-	// dbSize is the size of the backend database physically allocated, in bytes, of the responding member.
-	DbSize int64 `protobuf:"varint,3,opt,name=dbSize,proto3" json:"dbSize,omitempty"`
-	// leader is the member ID which the responding member believes is the current leader.
-	Leader uint64 `protobuf:"varint,4,opt,name=leader,proto3" json:"leader,omitempty"`
-	// raftIndex is the current raft committed index of the responding member.
-	RaftIndex uint64 `protobuf:"varint,5,opt,name=raftIndex,proto3" json:"raftIndex,omitempty"`
-	// raftTerm is the current raft term of the responding member.
-	RaftTerm uint64 `protobuf:"varint,6,opt,name=raftTerm,proto3" json:"raftTerm,omitempty"`
-	// raftAppliedIndex is the current raft applied index of the responding member.
-	RaftAppliedIndex uint64 `protobuf:"varint,7,opt,name=raftAppliedIndex,proto3" json:"raftAppliedIndex,omitempty"`
-	// errors contains alarm/health information and status.
-	Errors []string `protobuf:"bytes,8,rep,name=errors,proto3" json:"errors,omitempty"`
-	// dbSizeInUse is the size of the backend database logically in use, in bytes, of the responding member.
-	DbSizeInUse int64 `protobuf:"varint,9,opt,name=dbSizeInUse,proto3" json:"dbSizeInUse,omitempty"`
-	// isLearner indicates if the member is raft learner.
-	IsLearner bool `protobuf:"varint,10,opt,name=isLearner,proto3" json:"isLearner,omitempty"`
+type CertInfo struct {
+	// kind is one of "cert", "client-cert" or "ca".
+	Kind    string `protobuf:"bytes,1,opt,name=kind,proto3" json:"kind,omitempty"`
+	File    string `protobuf:"bytes,2,opt,name=file,proto3" json:"file,omitempty"`
+	Subject string `protobuf:"bytes,3,opt,name=subject,proto3" json:"subject,omitempty"`
+	// fingerprint is the hex encoded SHA-256 of the DER certificate.
+	Fingerprint string `protobuf:"bytes,4,opt,name=fingerprint,proto3" json:"fingerprint,omitempty"`
+	// not_before, not_after and loaded_at are unix timestamps in seconds.
+	NotBefore int64 `protobuf:"varint,5,opt,name=not_before,json=notBefore,proto3" json:"not_before,omitempty"`
+	NotAfter  int64 `protobuf:"varint,6,opt,name=not_after,json=notAfter,proto3" json:"not_after,omitempty"`
+	LoadedAt  int64 `protobuf:"varint,7,opt,name=loaded_at,json=loadedAt,proto3" json:"loaded_at,omitempty"`
 }
 
-func (m *StatusResponse) Reset()         { *m = StatusResponse{} }
-func (m *StatusResponse) String() string { return proto.CompactTextString(m) }
-func (*StatusResponse) ProtoMessage()    {}
-func (*StatusResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_77a6da22d6a3feb1, []int{60}
+func (m *CertInfo) Reset()         { *m = CertInfo{} }
+func (m *CertInfo) String() string { return proto.CompactTextString(m) }
+func (*CertInfo) ProtoMessage()    {}
+
+type ReloadCertsResponse struct {
+	Header *ResponseHeader `protobuf:"bytes,1,opt,name=header,proto3" json:"header,omitempty"`
+	Certs  []*CertInfo     `protobuf:"bytes,2,rep,name=certs,proto3" json:"certs,omitempty"`
+	// error describes the files that failed to reload; those keep their previous certificates.
+	Error string `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
 }
 
-func (m *StatusResponse) GetHeader() *ResponseHeader {
+func (m *ReloadCertsResponse) Reset()         { *m = ReloadCertsResponse{} }
+func (m *ReloadCertsResponse) String() string { return proto.CompactTextString(m) }
+func (*ReloadCertsResponse) ProtoMessage()    {}
+
+func (m *ReloadCertsResponse) GetHeader() *ResponseHeader {
 	if m != nil {
 		return m.Header
 	}
 	return nil
 }
 
-func (m *StatusResponse) GetVersion() string {
+func (m *ReloadCertsResponse) GetCerts() []*CertInfo {
 	if m != nil {
-		return m.Version
+		return m.Certs
 	}
-	return ""
+	return nil
 }
 
-func (m *StatusResponse) GetDbSize() int64 {
+func (m *ReloadCertsResponse) GetError() string {
 	if m != nil {
-		return m.DbSize
+		return m.Error
 	}
-	return 0
+	return ""
 }
 
-func (m *StatusResponse) GetLeader() uint64 {
-	if m != nil {
-		return m.Leader
-	}
-	return 0
+type MaintenanceModeRequest struct {
+	// read_only enables read-only maintenance mode when true and disables it when false.
+	ReadOnly bool `protobuf:"varint,1,opt,name=read_only,json=readOnly,proto3" json:"read_only,omitempty"`
 }
 
-func (m *StatusResponse) GetRaftIndex() uint64 {
+func (m *MaintenanceModeRequest) Reset()         { *m = MaintenanceModeRequest{} }
+func (m *MaintenanceModeRequest) String() string { return proto.CompactTextString(m) }
+func (*MaintenanceModeRequest) ProtoMessage()    {}
+
+func (m *MaintenanceModeRequest) GetReadOnly() bool {
+	if m != nil {
+		return m.ReadOnly
+	}
+	return false
+}
+
+type MaintenanceModeResponse struct {
+	Header *ResponseHeader `protobuf:"bytes,1,opt,name=header,proto3" json:"header,omitempty"`
+	// read_only is the maintenance mode of the member after the request.
+	ReadOnly bool `protobuf:"varint,2,opt,name=read_only,json=readOnly,proto3" json:"read_only,omitempty"`
+}
+
+func (m *MaintenanceModeResponse) Reset()         { *m = MaintenanceModeResponse{} }
+func (m *MaintenanceModeResponse) String() string { return proto.CompactTextString(m) }
+func (*MaintenanceModeResponse) ProtoMessage()    {}
+
+func (m *MaintenanceModeResponse) GetHeader() *ResponseHeader {
+	if m != nil {
+		return m.Header
+	}
+	return nil
+}
+
+func (m *MaintenanceModeResponse) GetReadOnly() bool {
+	if m != nil {
+		return m.ReadOnly
+	}
+	return false
+}
+
+type PromoteReplicaRequest struct{}
+
+func (m *PromoteReplicaRequest) Reset()         { *m = PromoteReplicaRequest{} }
+func (m *PromoteReplicaRequest) String() string { return proto.CompactTextString(m) }
+func (*PromoteReplicaRequest) ProtoMessage()    {}
+
+type PromoteReplicaResponse struct {
+	Header *ResponseHeader `protobuf:"bytes,1,opt,name=header,proto3" json:"header,omitempty"`
+	// revision is the revision of the cluster when it was promoted; changes of
+	// the upstream cluster after it were not replicated.
+	Revision int64 `protobuf:"varint,2,opt,name=revision,proto3" json:"revision,omitempty"`
+}
+
+func (m *PromoteReplicaResponse) Reset()         { *m = PromoteReplicaResponse{} }
+func (m *PromoteReplicaResponse) String() string { return proto.CompactTextString(m) }
+func (*PromoteReplicaResponse) ProtoMessage()    {}
+
+func (m *PromoteReplicaResponse) GetHeader() *ResponseHeader {
+	if m != nil {
+		return m.Header
+	}
+	return nil
+}
+
+func (m *PromoteReplicaResponse) GetRevision() int64 {
+	if m != nil {
+		return m.Revision
+	}
+	return 0
+}
+
+type LogScopeLevel struct {
+	// scope is the subsystem name.
+	Scope string `protobuf:"bytes,1,opt,name=scope,proto3" json:"scope,omitempty"`
+	// level is the log level; "default" makes the scope follow the member's log level.
+	Level string `protobuf:"bytes,2,opt,name=level,proto3" json:"level,omitempty"`
+	// inherited is true when the scope follows the member's log level.
+	Inherited bool `protobuf:"varint,3,opt,name=inherited,proto3" json:"inherited,omitempty"`
+}
+
+func (m *LogScopeLevel) Reset()         { *m = LogScopeLevel{} }
+func (m *LogScopeLevel) String() string { return proto.CompactTextString(m) }
+func (*LogScopeLevel) ProtoMessage()    {}
+
+func (m *LogScopeLevel) GetScope() string {
+	if m != nil {
+		return m.Scope
+	}
+	return ""
+}
+
+func (m *LogScopeLevel) GetLevel() string {
+	if m != nil {
+		return m.Level
+	}
+	return ""
+}
+
+func (m *LogScopeLevel) GetInherited() bool {
+	if m != nil {
+		return m.Inherited
+	}
+	return false
+}
+
+type LogLevelRequest struct {
+	// levels are the scope levels to set. An empty list only reports the current levels.
+	Levels []*LogScopeLevel `protobuf:"bytes,1,rep,name=levels,proto3" json:"levels,omitempty"`
+}
+
+func (m *LogLevelRequest) Reset()         { *m = LogLevelRequest{} }
+func (m *LogLevelRequest) String() string { return proto.CompactTextString(m) }
+func (*LogLevelRequest) ProtoMessage()    {}
+
+func (m *LogLevelRequest) GetLevels() []*LogScopeLevel {
+	if m != nil {
+		return m.Levels
+	}
+	return nil
+}
+
+type LogLevelResponse struct {
+	Header *ResponseHeader `protobuf:"bytes,1,opt,name=header,proto3" json:"header,omitempty"`
+	// levels are the levels in effect after the request.
+	Levels []*LogScopeLevel `protobuf:"bytes,2,rep,name=levels,proto3" json:"levels,omitempty"`
+}
+
+func (m *LogLevelResponse) Reset()         { *m = LogLevelResponse{} }
+func (m *LogLevelResponse) String() string { return proto.CompactTextString(m) }
+func (*LogLevelResponse) ProtoMessage()    {}
+
+func (m *LogLevelResponse) GetHeader() *ResponseHeader {
+	if m != nil {
+		return m.Header
+	}
+	return nil
+}
+
+func (m *LogLevelResponse) GetLevels() []*LogScopeLevel {
+	if m != nil {
+		return m.Levels
+	}
+	return nil
+}
+
+type Failpoint_Type int32
+
+const (
+	// FSYNC_DELAY delays every WAL fsync and backend commit by delay_ms.
+	Failpoint_FSYNC_DELAY Failpoint_Type = 0
+	// DROP_PEER drops the raft messages sent to member peer.
+	Failpoint_DROP_PEER Failpoint_Type = 1
+	// PAUSE_APPLY stops applying committed entries.
+	Failpoint_PAUSE_APPLY Failpoint_Type = 2
+	// COMMIT_ERROR fails the next backend commit. Like a real disk failure it
+	// makes the member exit.
+	Failpoint_COMMIT_ERROR Failpoint_Type = 3
+)
+
+var Failpoint_Type_name = map[int32]string{
+	0: "FSYNC_DELAY",
+	1: "DROP_PEER",
+	2: "PAUSE_APPLY",
+	3: "COMMIT_ERROR",
+}
+
+var Failpoint_Type_value = map[string]int32{
+	"FSYNC_DELAY":  0,
+	"DROP_PEER":    1,
+	"PAUSE_APPLY":  2,
+	"COMMIT_ERROR": 3,
+}
+
+func (x Failpoint_Type) String() string {
+	return proto.EnumName(Failpoint_Type_name, int32(x))
+}
+
+type Failpoint struct {
+	Type Failpoint_Type `protobuf:"varint,1,opt,name=type,proto3,enum=etcdserverpb.Failpoint_Type" json:"type,omitempty"`
+	// peer is the member ID whose messages are dropped by DROP_PEER.
+	Peer uint64 `protobuf:"varint,2,opt,name=peer,proto3" json:"peer,omitempty"`
+	// delay_ms is the delay added by FSYNC_DELAY in milliseconds.
+	DelayMs int64 `protobuf:"varint,3,opt,name=delay_ms,json=delayMs,proto3" json:"delay_ms,omitempty"`
+	// ttl is the lifetime of the fault in seconds. In responses it is the
+	// remaining lifetime.
+	Ttl int64 `protobuf:"varint,4,opt,name=ttl,proto3" json:"ttl,omitempty"`
+}
+
+func (m *Failpoint) Reset()         { *m = Failpoint{} }
+func (m *Failpoint) String() string { return proto.CompactTextString(m) }
+func (*Failpoint) ProtoMessage()    {}
+
+func (m *Failpoint) GetType() Failpoint_Type {
+	if m != nil {
+		return m.Type
+	}
+	return Failpoint_FSYNC_DELAY
+}
+
+func (m *Failpoint) GetPeer() uint64 {
+	if m != nil {
+		return m.Peer
+	}
+	return 0
+}
+
+func (m *Failpoint) GetDelayMs() int64 {
+	if m != nil {
+		return m.DelayMs
+	}
+	return 0
+}
+
+func (m *Failpoint) GetTtl() int64 {
+	if m != nil {
+		return m.Ttl
+	}
+	return 0
+}
+
+type FailpointRequest struct {
+	// inject are the faults to inject. A fault replaces the active fault of the
+	// same type (and peer for DROP_PEER).
+	Inject []*Failpoint `protobuf:"bytes,1,rep,name=inject,proto3" json:"inject,omitempty"`
+	// remove are the faults to remove, matched by type (and peer for DROP_PEER).
+	Remove []*Failpoint `protobuf:"bytes,2,rep,name=remove,proto3" json:"remove,omitempty"`
+	// clear removes every active fault before inject is applied.
+	Clear bool `protobuf:"varint,3,opt,name=clear,proto3" json:"clear,omitempty"`
+}
+
+func (m *FailpointRequest) Reset()         { *m = FailpointRequest{} }
+func (m *FailpointRequest) String() string { return proto.CompactTextString(m) }
+func (*FailpointRequest) ProtoMessage()    {}
+
+func (m *FailpointRequest) GetInject() []*Failpoint {
+	if m != nil {
+		return m.Inject
+	}
+	return nil
+}
+
+func (m *FailpointRequest) GetRemove() []*Failpoint {
+	if m != nil {
+		return m.Remove
+	}
+	return nil
+}
+
+func (m *FailpointRequest) GetClear() bool {
+	if m != nil {
+		return m.Clear
+	}
+	return false
+}
+
+type FailpointResponse struct {
+	Header *ResponseHeader `protobuf:"bytes,1,opt,name=header,proto3" json:"header,omitempty"`
+	// active are the faults in effect after the request.
+	Active []*Failpoint `protobuf:"bytes,2,rep,name=active,proto3" json:"active,omitempty"`
+}
+
+func (m *FailpointResponse) Reset()         { *m = FailpointResponse{} }
+func (m *FailpointResponse) String() string { return proto.CompactTextString(m) }
+func (*FailpointResponse) ProtoMessage()    {}
+
+func (m *FailpointResponse) GetHeader() *ResponseHeader {
+	if m != nil {
+		return m.Header
+	}
+	return nil
+}
+
+func (m *FailpointResponse) GetActive() []*Failpoint {
+	if m != nil {
+		return m.Active
+	}
+	return nil
+}
+
+type PeerNetworkStats struct {
+	// ID is the member ID of the peer.
+	ID uint64 `protobuf:"varint,1,opt,name=ID,proto3" json:"ID,omitempty"`
+	// active is true if a stream or pipeline to the peer currently works.
+	Active bool `protobuf:"varint,2,opt,name=active,proto3" json:"active,omitempty"`
+	// outbound is true if a stream dialed by this member to the peer is connected.
+	Outbound bool `protobuf:"varint,3,opt,name=outbound,proto3" json:"outbound,omitempty"`
+	// inbound is true if a stream dialed by the peer to this member is connected.
+	Inbound bool `protobuf:"varint,4,opt,name=inbound,proto3" json:"inbound,omitempty"`
+	// rtt_us is the smoothed round trip time to the peer in microseconds.
+	RttUs int64 `protobuf:"varint,5,opt,name=rtt_us,json=rttUs,proto3" json:"rtt_us,omitempty"`
+	// send_queue_depth is the number of messages waiting to be sent to the peer.
+	SendQueueDepth int64 `protobuf:"varint,6,opt,name=send_queue_depth,json=sendQueueDepth,proto3" json:"send_queue_depth,omitempty"`
+	// dropped_sent is the number of messages to the peer dropped because the
+	// sending buffer was full.
+	DroppedSent uint64 `protobuf:"varint,7,opt,name=dropped_sent,json=droppedSent,proto3" json:"dropped_sent,omitempty"`
+	// dropped_received is the number of messages from the peer dropped because
+	// the receiving buffer was full.
+	DroppedReceived uint64 `protobuf:"varint,8,opt,name=dropped_received,json=droppedReceived,proto3" json:"dropped_received,omitempty"`
+	// asymmetric_partition is true if only one of outbound and inbound has
+	// worked for a while.
+	AsymmetricPartition bool `protobuf:"varint,9,opt,name=asymmetric_partition,json=asymmetricPartition,proto3" json:"asymmetric_partition,omitempty"`
+	// last_error is the last error sending to or receiving from the peer.
+	LastError string `protobuf:"bytes,10,opt,name=last_error,json=lastError,proto3" json:"last_error,omitempty"`
+	// clock_offset_us is how far the member clock is ahead of the peer in
+	// microseconds, negative if it is behind. It is 0 if the last probe failed.
+	ClockOffsetUs int64 `protobuf:"varint,11,opt,name=clock_offset_us,json=clockOffsetUs,proto3" json:"clock_offset_us,omitempty"`
+}
+
+func (m *PeerNetworkStats) Reset()         { *m = PeerNetworkStats{} }
+func (m *PeerNetworkStats) String() string { return proto.CompactTextString(m) }
+func (*PeerNetworkStats) ProtoMessage()    {}
+
+type PeerStatsRequest struct{}
+
+func (m *PeerStatsRequest) Reset()         { *m = PeerStatsRequest{} }
+func (m *PeerStatsRequest) String() string { return proto.CompactTextString(m) }
+func (*PeerStatsRequest) ProtoMessage()    {}
+
+type PeerStatsResponse struct {
+	Header *ResponseHeader `protobuf:"bytes,1,opt,name=header,proto3" json:"header,omitempty"`
+	// peers are the stats of every peer of the member, sorted by ID.
+	Peers []*PeerNetworkStats `protobuf:"bytes,2,rep,name=peers,proto3" json:"peers,omitempty"`
+}
+
+func (m *PeerStatsResponse) Reset()         { *m = PeerStatsResponse{} }
+func (m *PeerStatsResponse) String() string { return proto.CompactTextString(m) }
+func (*PeerStatsResponse) ProtoMessage()    {}
+
+func (m *PeerStatsResponse) GetHeader() *ResponseHeader {
+	if m != nil {
+		return m.Header
+	}
+	return nil
+}
+
+func (m *PeerStatsResponse) GetPeers() []*PeerNetworkStats {
+	if m != nil {
+		return m.Peers
+	}
+	return nil
+}
+
+type CompactionHoldRequest struct {
+	// owner identifies the hold. An empty owner only lists the active holds.
+	Owner string `protobuf:"bytes,1,opt,name=owner,proto3" json:"owner,omitempty"`
+	// revision is the lowest revision that must stay readable; 0 holds the
+	// current revision.
+	Revision int64 `protobuf:"varint,2,opt,name=revision,proto3" json:"revision,omitempty"`
+	// ttl is the lifetime of the hold in seconds; it must be refreshed before
+	// it expires.
+	TTL int64 `protobuf:"varint,3,opt,name=ttl,proto3" json:"ttl,omitempty"`
+	// release removes the hold of owner.
+	Release bool `protobuf:"varint,4,opt,name=release,proto3" json:"release,omitempty"`
+}
+
+func (m *CompactionHoldRequest) Reset()         { *m = CompactionHoldRequest{} }
+func (m *CompactionHoldRequest) String() string { return proto.CompactTextString(m) }
+func (*CompactionHoldRequest) ProtoMessage()    {}
+
+func (m *CompactionHoldRequest) GetOwner() string {
+	if m != nil {
+		return m.Owner
+	}
+	return ""
+}
+
+func (m *CompactionHoldRequest) GetRevision() int64 {
+	if m != nil {
+		return m.Revision
+	}
+	return 0
+}
+
+func (m *CompactionHoldRequest) GetTTL() int64 {
+	if m != nil {
+		return m.TTL
+	}
+	return 0
+}
+
+func (m *CompactionHoldRequest) GetRelease() bool {
+	if m != nil {
+		return m.Release
+	}
+	return false
+}
+
+type CompactionHold struct {
+	Owner    string `protobuf:"bytes,1,opt,name=owner,proto3" json:"owner,omitempty"`
+	Revision int64  `protobuf:"varint,2,opt,name=revision,proto3" json:"revision,omitempty"`
+	// expires is the unix time in seconds when the hold expires.
+	Expires int64 `protobuf:"varint,3,opt,name=expires,proto3" json:"expires,omitempty"`
+}
+
+func (m *CompactionHold) Reset()         { *m = CompactionHold{} }
+func (m *CompactionHold) String() string { return proto.CompactTextString(m) }
+func (*CompactionHold) ProtoMessage()    {}
+
+func (m *CompactionHold) GetOwner() string {
+	if m != nil {
+		return m.Owner
+	}
+	return ""
+}
+
+func (m *CompactionHold) GetRevision() int64 {
+	if m != nil {
+		return m.Revision
+	}
+	return 0
+}
+
+func (m *CompactionHold) GetExpires() int64 {
+	if m != nil {
+		return m.Expires
+	}
+	return 0
+}
+
+type CompactionHoldResponse struct {
+	Header *ResponseHeader `protobuf:"bytes,1,opt,name=header,proto3" json:"header,omitempty"`
+	// holds are the active holds after the request.
+	Holds []*CompactionHold `protobuf:"bytes,2,rep,name=holds,proto3" json:"holds,omitempty"`
+}
+
+func (m *CompactionHoldResponse) Reset()         { *m = CompactionHoldResponse{} }
+func (m *CompactionHoldResponse) String() string { return proto.CompactTextString(m) }
+func (*CompactionHoldResponse) ProtoMessage()    {}
+
+func (m *CompactionHoldResponse) GetHeader() *ResponseHeader {
+	if m != nil {
+		return m.Header
+	}
+	return nil
+}
+
+func (m *CompactionHoldResponse) GetHolds() []*CompactionHold {
+	if m != nil {
+		return m.Holds
+	}
+	return nil
+}
+
+type UserUsageRequest struct {
+	// user limits the response to a single user. An empty user returns every
+	// user with recorded usage or a configured budget.
+	User string `protobuf:"bytes,1,opt,name=user,proto3" json:"user,omitempty"`
+	// reset sets the written bytes of user to zero before returning.
+	Reset_ bool `protobuf:"varint,2,opt,name=reset,proto3" json:"reset,omitempty"`
+}
+
+func (m *UserUsageRequest) Reset()         { *m = UserUsageRequest{} }
+func (m *UserUsageRequest) String() string { return proto.CompactTextString(m) }
+func (*UserUsageRequest) ProtoMessage()    {}
+
+func (m *UserUsageRequest) GetUser() string {
+	if m != nil {
+		return m.User
+	}
+	return ""
+}
+
+func (m *UserUsageRequest) GetReset_() bool {
+	if m != nil {
+		return m.Reset_
+	}
+	return false
+}
+
+type UserUsage struct {
+	User string `protobuf:"bytes,1,opt,name=user,proto3" json:"user,omitempty"`
+	// written_bytes is the total size of the keys and values put by the user.
+	WrittenBytes int64 `protobuf:"varint,2,opt,name=written_bytes,json=writtenBytes,proto3" json:"written_bytes,omitempty"`
+	// quota_bytes is the write budget of the user; 0 means unlimited.
+	QuotaBytes int64 `protobuf:"varint,3,opt,name=quota_bytes,json=quotaBytes,proto3" json:"quota_bytes,omitempty"`
+	// rate_bytes is the write rate budget of the user in bytes per second,
+	// enforced by each member separately; 0 means unlimited.
+	RateBytes int64 `protobuf:"varint,4,opt,name=rate_bytes,json=rateBytes,proto3" json:"rate_bytes,omitempty"`
+}
+
+func (m *UserUsage) Reset()         { *m = UserUsage{} }
+func (m *UserUsage) String() string { return proto.CompactTextString(m) }
+func (*UserUsage) ProtoMessage()    {}
+
+func (m *UserUsage) GetUser() string {
+	if m != nil {
+		return m.User
+	}
+	return ""
+}
+
+func (m *UserUsage) GetWrittenBytes() int64 {
+	if m != nil {
+		return m.WrittenBytes
+	}
+	return 0
+}
+
+func (m *UserUsage) GetQuotaBytes() int64 {
+	if m != nil {
+		return m.QuotaBytes
+	}
+	return 0
+}
+
+func (m *UserUsage) GetRateBytes() int64 {
+	if m != nil {
+		return m.RateBytes
+	}
+	return 0
+}
+
+type UserUsageResponse struct {
+	Header *ResponseHeader `protobuf:"bytes,1,opt,name=header,proto3" json:"header,omitempty"`
+	Usages []*UserUsage    `protobuf:"bytes,2,rep,name=usages,proto3" json:"usages,omitempty"`
+}
+
+func (m *UserUsageResponse) Reset()         { *m = UserUsageResponse{} }
+func (m *UserUsageResponse) String() string { return proto.CompactTextString(m) }
+func (*UserUsageResponse) ProtoMessage()    {}
+
+func (m *UserUsageResponse) GetHeader() *ResponseHeader {
+	if m != nil {
+		return m.Header
+	}
+	return nil
+}
+
+func (m *UserUsageResponse) GetUsages() []*UserUsage {
+	if m != nil {
+		return m.Usages
+	}
+	return nil
+}
+
+type SnapshotSessionRequest struct {
+	// token identifies the session to refresh or release. An empty token
+	// creates a new session.
+	Token string `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
+	// revision is the revision a new session is pinned at; 0 pins the current
+	// revision. It is ignored when refreshing a session.
+	Revision int64 `protobuf:"varint,2,opt,name=revision,proto3" json:"revision,omitempty"`
+	// ttl is the lifetime of the session in seconds; the session must be
+	// refreshed before it expires.
+	TTL int64 `protobuf:"varint,3,opt,name=ttl,proto3" json:"ttl,omitempty"`
+	// release ends the session identified by token.
+	Release bool `protobuf:"varint,4,opt,name=release,proto3" json:"release,omitempty"`
+}
+
+func (m *SnapshotSessionRequest) Reset()         { *m = SnapshotSessionRequest{} }
+func (m *SnapshotSessionRequest) String() string { return proto.CompactTextString(m) }
+func (*SnapshotSessionRequest) ProtoMessage()    {}
+
+func (m *SnapshotSessionRequest) GetToken() string {
+	if m != nil {
+		return m.Token
+	}
+	return ""
+}
+
+func (m *SnapshotSessionRequest) GetRevision() int64 {
+	if m != nil {
+		return m.Revision
+	}
+	return 0
+}
+
+func (m *SnapshotSessionRequest) GetTTL() int64 {
+	if m != nil {
+		return m.TTL
+	}
+	return 0
+}
+
+func (m *SnapshotSessionRequest) GetRelease() bool {
+	if m != nil {
+		return m.Release
+	}
+	return false
+}
+
+type SnapshotSessionResponse struct {
+	Header *ResponseHeader `protobuf:"bytes,1,opt,name=header,proto3" json:"header,omitempty"`
+	// token identifies the session in Range requests and later refreshes.
+	Token string `protobuf:"bytes,2,opt,name=token,proto3" json:"token,omitempty"`
+	// revision is the revision the session is pinned at.
+	Revision int64 `protobuf:"varint,3,opt,name=revision,proto3" json:"revision,omitempty"`
+	// expires is the unix time in seconds when the session expires.
+	Expires int64 `protobuf:"varint,4,opt,name=expires,proto3" json:"expires,omitempty"`
+}
+
+func (m *SnapshotSessionResponse) Reset()         { *m = SnapshotSessionResponse{} }
+func (m *SnapshotSessionResponse) String() string { return proto.CompactTextString(m) }
+func (*SnapshotSessionResponse) ProtoMessage()    {}
+
+func (m *SnapshotSessionResponse) GetHeader() *ResponseHeader {
+	if m != nil {
+		return m.Header
+	}
+	return nil
+}
+
+func (m *SnapshotSessionResponse) GetToken() string {
+	if m != nil {
+		return m.Token
+	}
+	return ""
+}
+
+func (m *SnapshotSessionResponse) GetRevision() int64 {
+	if m != nil {
+		return m.Revision
+	}
+	return 0
+}
+
+func (m *SnapshotSessionResponse) GetExpires() int64 {
+	if m != nil {
+		return m.Expires
+	}
+	return 0
+}
+
+type ProfileRequest struct {
+	// type is the kind of profile to collect: "cpu", "trace" or the name of a
+	// runtime profile such as "heap", "allocs", "goroutine", "block" or "mutex".
+	Type string `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`
+	// duration is the collection time in seconds for "cpu" and "trace" profiles.
+	Duration int64 `protobuf:"varint,2,opt,name=duration,proto3" json:"duration,omitempty"`
+}
+
+func (m *ProfileRequest) Reset()         { *m = ProfileRequest{} }
+func (m *ProfileRequest) String() string { return proto.CompactTextString(m) }
+func (*ProfileRequest) ProtoMessage()    {}
+
+func (m *ProfileRequest) GetType() string {
+	if m != nil {
+		return m.Type
+	}
+	return ""
+}
+
+func (m *ProfileRequest) GetDuration() int64 {
+	if m != nil {
+		return m.Duration
+	}
+	return 0
+}
+
+type ProfileResponse struct {
+	Header *ResponseHeader `protobuf:"bytes,1,opt,name=header,proto3" json:"header,omitempty"`
+	// blob contains the next chunk of the profile in the profile stream.
+	Blob []byte `protobuf:"bytes,2,opt,name=blob,proto3" json:"blob,omitempty"`
+}
+
+func (m *ProfileResponse) Reset()         { *m = ProfileResponse{} }
+func (m *ProfileResponse) String() string { return proto.CompactTextString(m) }
+func (*ProfileResponse) ProtoMessage()    {}
+
+func (m *ProfileResponse) GetHeader() *ResponseHeader {
+	if m != nil {
+		return m.Header
+	}
+	return nil
+}
+
+func (m *ProfileResponse) GetBlob() []byte {
+	if m != nil {
+		return m.Blob
+	}
+	return nil
+}
+
+type StatusRequest struct{}
+
+func (m *StatusRequest) Reset()         { *m = StatusRequest{} }
+func (m *StatusRequest) String() string { return proto.CompactTextString(m) }
+func (*StatusRequest) ProtoMessage()    {}
+func (*StatusRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_77a6da22d6a3feb1, []int{59}
+}
+
+type StatusResponse struct {
+	Header *ResponseHeader `protobuf:"bytes,1,opt,name=header,proto3" json:"header,omitempty"`
+	// version is the cluster protocol version used by the responding member.
+	Version string `protobuf:"bytes,2,opt,name=version,proto3" json:"version,omitempty"`
+	// dbSize is the size of the backend database physically allocated, in bytes, of the responding member.
+	DbSize int64 `protobuf:"varint,3,opt,name=dbSize,proto3" json:"dbSize,omitempty"`
+	// leader is the member ID which the responding member believes is the current leader.
+	Leader uint64 `protobuf:"varint,4,opt,name=leader,proto3" json:"leader,omitempty"`
+	// raftIndex is the current raft committed index of the responding member.
+	RaftIndex uint64 `protobuf:"varint,5,opt,name=raftIndex,proto3" json:"raftIndex,omitempty"`
+	// raftTerm is the current raft term of the responding member.
+	RaftTerm uint64 `protobuf:"varint,6,opt,name=raftTerm,proto3" json:"raftTerm,omitempty"`
+	// raftAppliedIndex is the current raft applied index of the responding member.
+	RaftAppliedIndex uint64 `protobuf:"varint,7,opt,name=raftAppliedIndex,proto3" json:"raftAppliedIndex,omitempty"`
+	// errors contains alarm/health information and status.
+	Errors []string `protobuf:"bytes,8,rep,name=errors,proto3" json:"errors,omitempty"`
+	// dbSizeInUse is the size of the backend database logically in use, in bytes, of the responding member.
+	DbSizeInUse int64 `protobuf:"varint,9,opt,name=dbSizeInUse,proto3" json:"dbSizeInUse,omitempty"`
+	// isLearner indicates if the member is raft learner.
+	IsLearner bool `protobuf:"varint,10,opt,name=isLearner,proto3" json:"isLearner,omitempty"`
+	// clusterVersion is the cluster version known by the responding member.
+	ClusterVersion string `protobuf:"bytes,11,opt,name=clusterVersion,proto3" json:"clusterVersion,omitempty"`
+	// downgradeTargetVersion is the target version of the downgrade job in progress, empty if none.
+	DowngradeTargetVersion string `protobuf:"bytes,12,opt,name=downgradeTargetVersion,proto3" json:"downgradeTargetVersion,omitempty"`
+	// downgradeFeatures reports the features the downgrade target version does not support.
+	DowngradeFeatures []*DowngradeFeatureStatus `protobuf:"bytes,13,rep,name=downgradeFeatures,proto3" json:"downgradeFeatures,omitempty"`
+	// readOnly indicates if the member is in read-only maintenance mode.
+	ReadOnly bool `protobuf:"varint,14,opt,name=readOnly,proto3" json:"readOnly,omitempty"`
+	// latency reports recent percentiles of the stages of the write path of the responding member.
+	Latency []*LatencySummary `protobuf:"bytes,15,rep,name=latency,proto3" json:"latency,omitempty"`
+	// startup reports the startup phase of the responding member.
+	Startup *StartupStatus `protobuf:"bytes,16,opt,name=startup,proto3" json:"startup,omitempty"`
+	// replica indicates the cluster is a read-only replica of an upstream cluster
+	// that has not been promoted.
+	Replica bool `protobuf:"varint,17,opt,name=replica,proto3" json:"replica,omitempty"`
+	// learnerProgress is the replication progress of the learners, only
+	// reported when the responding member is the leader.
+	LearnerProgress []*LearnerProgress `protobuf:"bytes,18,rep,name=learnerProgress,proto3" json:"learnerProgress,omitempty"`
+}
+
+func (m *StatusResponse) Reset()         { *m = StatusResponse{} }
+func (m *StatusResponse) String() string { return proto.CompactTextString(m) }
+func (*StatusResponse) ProtoMessage()    {}
+func (*StatusResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_77a6da22d6a3feb1, []int{60}
+}
+
+func (m *StatusResponse) GetHeader() *ResponseHeader {
+	if m != nil {
+		return m.Header
+	}
+	return nil
+}
+
+func (m *StatusResponse) GetVersion() string {
+	if m != nil {
+		return m.Version
+	}
+	return ""
+}
+
+func (m *StatusResponse) GetDbSize() int64 {
+	if m != nil {
+		return m.DbSize
+	}
+	return 0
+}
+
+func (m *StatusResponse) GetLeader() uint64 {
+	if m != nil {
+		return m.Leader
+	}
+	return 0
+}
+
+func (m *StatusResponse) GetRaftIndex() uint64 {
 	if m != nil {
 		return m.RaftIndex
 	}
@@ -2169,6 +3296,180 @@ func (m *StatusResponse) GetIsLearner() bool {
 	return false
 }
 
+func (m *StatusResponse) GetClusterVersion() string {
+	if m != nil {
+		return m.ClusterVersion
+	}
+	return ""
+}
+
+func (m *StatusResponse) GetDowngradeTargetVersion() string {
+	if m != nil {
+		return m.DowngradeTargetVersion
+	}
+	return ""
+}
+
+func (m *StatusResponse) GetDowngradeFeatures() []*DowngradeFeatureStatus {
+	if m != nil {
+		return m.DowngradeFeatures
+	}
+	return nil
+}
+
+func (m *StatusResponse) GetReadOnly() bool {
+	if m != nil {
+		return m.ReadOnly
+	}
+	return false
+}
+
+func (m *StatusResponse) GetLatency() []*LatencySummary {
+	if m != nil {
+		return m.Latency
+	}
+	return nil
+}
+
+func (m *StatusResponse) GetStartup() *StartupStatus {
+	if m != nil {
+		return m.Startup
+	}
+	return nil
+}
+
+func (m *StatusResponse) GetReplica() bool {
+	if m != nil {
+		return m.Replica
+	}
+	return false
+}
+
+func (m *StatusResponse) GetLearnerProgress() []*LearnerProgress {
+	if m != nil {
+		return m.LearnerProgress
+	}
+	return nil
+}
+
+type StartupStatus struct {
+	// phase is the current startup phase: "opening-backend", "loading-snapshot",
+	// "reading-wal", "rebuilding-index", "replaying-wal", "joining" or "ready".
+	Phase string `protobuf:"bytes,1,opt,name=phase,proto3" json:"phase,omitempty"`
+	// walReplayPercent is the percentage of the entries committed at boot that
+	// have been applied, from 0 to 100.
+	WalReplayPercent float64 `protobuf:"fixed64,2,opt,name=walReplayPercent,proto3" json:"walReplayPercent,omitempty"`
+	// phaseSeconds is how long the member has been in the current phase.
+	PhaseSeconds float64 `protobuf:"fixed64,3,opt,name=phaseSeconds,proto3" json:"phaseSeconds,omitempty"`
+	// totalSeconds is how long the member has been starting, or took to start once ready.
+	TotalSeconds float64 `protobuf:"fixed64,4,opt,name=totalSeconds,proto3" json:"totalSeconds,omitempty"`
+}
+
+func (m *StartupStatus) Reset()         { *m = StartupStatus{} }
+func (m *StartupStatus) String() string { return proto.CompactTextString(m) }
+func (*StartupStatus) ProtoMessage()    {}
+
+func (m *StartupStatus) GetPhase() string {
+	if m != nil {
+		return m.Phase
+	}
+	return ""
+}
+
+func (m *StartupStatus) GetWalReplayPercent() float64 {
+	if m != nil {
+		return m.WalReplayPercent
+	}
+	return 0
+}
+
+func (m *StartupStatus) GetPhaseSeconds() float64 {
+	if m != nil {
+		return m.PhaseSeconds
+	}
+	return 0
+}
+
+func (m *StartupStatus) GetTotalSeconds() float64 {
+	if m != nil {
+		return m.TotalSeconds
+	}
+	return 0
+}
+
+type LatencySummary struct {
+	// stage is the stage of the write path: "proposal-commit", "apply",
+	// "backend-commit" or "wal-fsync".
+	Stage string `protobuf:"bytes,1,opt,name=stage,proto3" json:"stage,omitempty"`
+	// count is the number of recent samples the percentiles are computed from.
+	Count int64 `protobuf:"varint,2,opt,name=count,proto3" json:"count,omitempty"`
+	// p50, p90, p99 and max are the percentiles of the recent samples, in nanoseconds.
+	P50 int64 `protobuf:"varint,3,opt,name=p50,proto3" json:"p50,omitempty"`
+	P90 int64 `protobuf:"varint,4,opt,name=p90,proto3" json:"p90,omitempty"`
+	P99 int64 `protobuf:"varint,5,opt,name=p99,proto3" json:"p99,omitempty"`
+	Max int64 `protobuf:"varint,6,opt,name=max,proto3" json:"max,omitempty"`
+}
+
+func (m *LatencySummary) Reset()         { *m = LatencySummary{} }
+func (m *LatencySummary) String() string { return proto.CompactTextString(m) }
+func (*LatencySummary) ProtoMessage()    {}
+
+func (m *LatencySummary) GetStage() string {
+	if m != nil {
+		return m.Stage
+	}
+	return ""
+}
+
+func (m *LatencySummary) GetCount() int64 {
+	if m != nil {
+		return m.Count
+	}
+	return 0
+}
+
+func (m *LatencySummary) GetP50() int64 {
+	if m != nil {
+		return m.P50
+	}
+	return 0
+}
+
+func (m *LatencySummary) GetP90() int64 {
+	if m != nil {
+		return m.P90
+	}
+	return 0
+}
+
+func (m *LatencySummary) GetP99() int64 {
+	if m != nil {
+		return m.P99
+	}
+	return 0
+}
+
+func (m *LatencySummary) GetMax() int64 {
+	if m != nil {
+		return m.Max
+	}
+	return 0
+}
+
+type DowngradeFeatureStatus struct {
+	// name is the name of the feature.
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// state of rewriting the on-disk data of the feature to the older format:
+	// "pending", "translating", "done" or "not-needed".
+	State string `protobuf:"bytes,2,opt,name=state,proto3" json:"state,omitempty"`
+	// translated is the number of records rewritten so far.
+	Translated int64 `protobuf:"varint,3,opt,name=translated,proto3" json:"translated,omitempty"`
+}
+
+func (m *DowngradeFeatureStatus) Reset()         { *m = DowngradeFeatureStatus{} }
+func (m *DowngradeFeatureStatus) String() string { return proto.CompactTextString(m) }
+func (*DowngradeFeatureStatus) ProtoMessage()    {}
+
 type AuthEnableRequest struct{}
 
 func (m *AuthEnableRequest) Reset()         { *m = AuthEnableRequest{} }
@@ -2199,6 +3500,8 @@ func (*AuthStatusRequest) Descriptor() ([]byte, []int) {
 type AuthenticateRequest struct {
 	Name     string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
 	Password string `protobuf:"bytes,2,opt,name=password,proto3" json:"password,omitempty"`
+	// refresh_token 非空时使用refresh token换取新的token,此时不需要name和password
+	RefreshToken string `protobuf:"bytes,3,opt,name=refresh_token,json=refreshToken,proto3" json:"refresh_token,omitempty"`
 }
 
 func (m *AuthenticateRequest) Reset()         { *m = AuthenticateRequest{} }
@@ -2222,14 +3525,23 @@ func (m *AuthenticateRequest) GetPassword() string {
 	return ""
 }
 
+func (m *AuthenticateRequest) GetRefreshToken() string {
+	if m != nil {
+		return m.RefreshToken
+	}
+	return ""
+}
+
 type AuthUserAddRequest struct {
-	Name                 string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
-	Password             string                 `protobuf:"bytes,2,opt,name=password,proto3" json:"password,omitempty"`
-	Options              *authpb.UserAddOptions `protobuf:"bytes,3,opt,name=options,proto3" json:"options,omitempty"`
-	HashedPassword       string                 `protobuf:"bytes,4,opt,name=hashedPassword,proto3" json:"hashedPassword,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}               `json:"-"`
-	XXX_unrecognized     []byte                 `json:"-"`
-	XXX_sizecache        int32                  `json:"-"`
+	Name           string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Password       string                 `protobuf:"bytes,2,opt,name=password,proto3" json:"password,omitempty"`
+	Options        *authpb.UserAddOptions `protobuf:"bytes,3,opt,name=options,proto3" json:"options,omitempty"`
+	HashedPassword string                 `protobuf:"bytes,4,opt,name=hashedPassword,proto3" json:"hashedPassword,omitempty"`
+	// passwordChangedAt 在API层设置,单位秒
+	PasswordChangedAt    int64    `protobuf:"varint,5,opt,name=passwordChangedAt,proto3" json:"passwordChangedAt,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
 }
 
 func (m *AuthUserAddRequest) Reset()         { *m = AuthUserAddRequest{} }
@@ -2311,6 +3623,8 @@ type AuthUserChangePasswordRequest struct {
 	Password string `protobuf:"bytes,2,opt,name=password,proto3" json:"password,omitempty"`
 	// hashedPassword is the new password for the user. Note that this field will be initialized in the API layer.
 	HashedPassword string `protobuf:"bytes,3,opt,name=hashedPassword,proto3" json:"hashedPassword,omitempty"`
+	// passwordChangedAt is the time the password was changed, in unix seconds. Note that this field will be initialized in the API layer.
+	PasswordChangedAt int64 `protobuf:"varint,4,opt,name=passwordChangedAt,proto3" json:"passwordChangedAt,omitempty"`
 }
 
 func (m *AuthUserChangePasswordRequest) Reset()         { *m = AuthUserChangePasswordRequest{} }
@@ -2503,6 +3817,8 @@ type AuthRoleRevokePermissionRequest struct {
 	Role     string `protobuf:"bytes,1,opt,name=role,proto3" json:"role,omitempty"`
 	Key      string `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
 	RangeEnd string `protobuf:"bytes,3,opt,name=range_end,json=rangeEnd,proto3" json:"range_end,omitempty"`
+	// Operation 非空时撤销角色的非KV操作权限,此时忽略 Key、RangeEnd
+	Operation string `protobuf:"bytes,4,opt,name=operation,proto3" json:"operation,omitempty"`
 }
 
 func (m *AuthRoleRevokePermissionRequest) Reset()         { *m = AuthRoleRevokePermissionRequest{} }
@@ -2533,6 +3849,13 @@ func (m *AuthRoleRevokePermissionRequest) GetRangeEnd() []byte {
 	return nil
 }
 
+func (m *AuthRoleRevokePermissionRequest) GetOperation() string {
+	if m != nil {
+		return m.Operation
+	}
+	return ""
+}
+
 type AuthEnableResponse struct {
 	Header               *ResponseHeader `protobuf:"bytes,1,opt,name=header,proto3" json:"header,omitempty"`
 	XXX_NoUnkeyedLiteral struct{}        `json:"-"`
@@ -2613,6 +3936,8 @@ type AuthenticateResponse struct {
 	Header *ResponseHeader `protobuf:"bytes,1,opt,name=header,proto3" json:"header,omitempty"`
 	// token is an authorized token that can be used in succeeding RPCs
 	Token string `protobuf:"bytes,2,opt,name=token,proto3" json:"token,omitempty"`
+	// refresh_token can be used to obtain a new token without the password; it is rotated on every use
+	RefreshToken string `protobuf:"bytes,3,opt,name=refresh_token,json=refreshToken,proto3" json:"refresh_token,omitempty"`
 }
 
 func (m *AuthenticateResponse) Reset()         { *m = AuthenticateResponse{} }
@@ -2636,6 +3961,13 @@ func (m *AuthenticateResponse) GetToken() string {
 	return ""
 }
 
+func (m *AuthenticateResponse) GetRefreshToken() string {
+	if m != nil {
+		return m.RefreshToken
+	}
+	return ""
+}
+
 type AuthUserAddResponse struct {
 	Header               *ResponseHeader `protobuf:"bytes,1,opt,name=header,proto3" json:"header,omitempty"`
 	XXX_NoUnkeyedLiteral struct{}        `json:"-"`
@@ -2658,11 +3990,15 @@ func (m *AuthUserAddResponse) GetHeader() *ResponseHeader {
 }
 
 type AuthUserGetResponse struct {
-	Header               *ResponseHeader `protobuf:"bytes,1,opt,name=header,proto3" json:"header,omitempty"`
-	Roles                []string        `protobuf:"bytes,2,rep,name=roles,proto3" json:"roles,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}        `json:"-"`
-	XXX_unrecognized     []byte          `json:"-"`
-	XXX_sizecache        int32           `json:"-"`
+	Header *ResponseHeader `protobuf:"bytes,1,opt,name=header,proto3" json:"header,omitempty"`
+	Roles  []string        `protobuf:"bytes,2,rep,name=roles,proto3" json:"roles,omitempty"`
+	// 密码修改时间、连续登录失败次数、锁定截止时间,单位秒
+	PasswordChangedAt    int64    `protobuf:"varint,3,opt,name=password_changed_at,json=passwordChangedAt,proto3" json:"password_changed_at,omitempty"`
+	FailedLogins         int32    `protobuf:"varint,4,opt,name=failed_logins,json=failedLogins,proto3" json:"failed_logins,omitempty"`
+	LockedUntil          int64    `protobuf:"varint,5,opt,name=locked_until,json=lockedUntil,proto3" json:"locked_until,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
 }
 
 func (m *AuthUserGetResponse) Reset()         { *m = AuthUserGetResponse{} }
@@ -2686,6 +4022,27 @@ func (m *AuthUserGetResponse) GetRoles() []string {
 	return nil
 }
 
+func (m *AuthUserGetResponse) GetPasswordChangedAt() int64 {
+	if m != nil {
+		return m.PasswordChangedAt
+	}
+	return 0
+}
+
+func (m *AuthUserGetResponse) GetFailedLogins() int32 {
+	if m != nil {
+		return m.FailedLogins
+	}
+	return 0
+}
+
+func (m *AuthUserGetResponse) GetLockedUntil() int64 {
+	if m != nil {
+		return m.LockedUntil
+	}
+	return 0
+}
+
 type AuthUserDeleteResponse struct {
 	Header               *ResponseHeader `protobuf:"bytes,1,opt,name=header,proto3" json:"header,omitempty"`
 	XXX_NoUnkeyedLiteral struct{}        `json:"-"`
@@ -2792,11 +4149,13 @@ func (m *AuthRoleAddResponse) GetHeader() *ResponseHeader {
 }
 
 type AuthRoleGetResponse struct {
-	Header               *ResponseHeader      `protobuf:"bytes,1,opt,name=header,proto3" json:"header,omitempty"`
-	Perm                 []*authpb.Permission `protobuf:"bytes,2,rep,name=perm,proto3" json:"perm,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
-	XXX_unrecognized     []byte               `json:"-"`
-	XXX_sizecache        int32                `json:"-"`
+	Header *ResponseHeader      `protobuf:"bytes,1,opt,name=header,proto3" json:"header,omitempty"`
+	Perm   []*authpb.Permission `protobuf:"bytes,2,rep,name=perm,proto3" json:"perm,omitempty"`
+	// Operations 角色允许的非KV操作
+	Operations           []string `protobuf:"bytes,3,rep,name=operations,proto3" json:"operations,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
 }
 
 func (m *AuthRoleGetResponse) Reset()         { *m = AuthRoleGetResponse{} }
@@ -2820,6 +4179,13 @@ func (m *AuthRoleGetResponse) GetPerm() []*authpb.Permission {
 	return nil
 }
 
+func (m *AuthRoleGetResponse) GetOperations() []string {
+	if m != nil {
+		return m.Operations
+	}
+	return nil
+}
+
 type AuthRoleListResponse struct {
 	Header               *ResponseHeader `protobuf:"bytes,1,opt,name=header,proto3" json:"header,omitempty"`
 	Roles                []string        `protobuf:"bytes,2,rep,name=roles,proto3" json:"roles,omitempty"`
@@ -2849,6 +4215,66 @@ func (m *AuthRoleListResponse) GetRoles() []string {
 	return nil
 }
 
+type AuthDenialsRequest struct {
+	// limit is the maximum number of most recent denials to return; 0 returns all recorded denials.
+	Limit int64 `protobuf:"varint,1,opt,name=limit,proto3" json:"limit,omitempty"`
+}
+
+func (m *AuthDenialsRequest) Reset()         { *m = AuthDenialsRequest{} }
+func (m *AuthDenialsRequest) String() string { return proto.CompactTextString(m) }
+func (*AuthDenialsRequest) ProtoMessage()    {}
+
+func (m *AuthDenialsRequest) GetLimit() int64 {
+	if m != nil {
+		return m.Limit
+	}
+	return 0
+}
+
+type AuthDenial struct {
+	// time is a unix timestamp in seconds.
+	Time     int64  `protobuf:"varint,1,opt,name=time,proto3" json:"time,omitempty"`
+	User     string `protobuf:"bytes,2,opt,name=user,proto3" json:"user,omitempty"`
+	Key      string `protobuf:"bytes,3,opt,name=key,proto3" json:"key,omitempty"`
+	RangeEnd string `protobuf:"bytes,4,opt,name=range_end,json=rangeEnd,proto3" json:"range_end,omitempty"`
+	// op is the name of the denied RPC, e.g. "Range", "Put" or "LeaseGrant".
+	Op string `protobuf:"bytes,5,opt,name=op,proto3" json:"op,omitempty"`
+	// caller is the remote address of the client.
+	Caller string `protobuf:"bytes,6,opt,name=caller,proto3" json:"caller,omitempty"`
+	// app, request_id and priority are the caller metadata attached by the client, if any.
+	App       string `protobuf:"bytes,7,opt,name=app,proto3" json:"app,omitempty"`
+	RequestId string `protobuf:"bytes,8,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	Priority  string `protobuf:"bytes,9,opt,name=priority,proto3" json:"priority,omitempty"`
+}
+
+func (m *AuthDenial) Reset()         { *m = AuthDenial{} }
+func (m *AuthDenial) String() string { return proto.CompactTextString(m) }
+func (*AuthDenial) ProtoMessage()    {}
+
+type AuthDenialsResponse struct {
+	Header *ResponseHeader `protobuf:"bytes,1,opt,name=header,proto3" json:"header,omitempty"`
+	// denials are ordered from the oldest to the newest.
+	Denials []*AuthDenial `protobuf:"bytes,2,rep,name=denials,proto3" json:"denials,omitempty"`
+}
+
+func (m *AuthDenialsResponse) Reset()         { *m = AuthDenialsResponse{} }
+func (m *AuthDenialsResponse) String() string { return proto.CompactTextString(m) }
+func (*AuthDenialsResponse) ProtoMessage()    {}
+
+func (m *AuthDenialsResponse) GetHeader() *ResponseHeader {
+	if m != nil {
+		return m.Header
+	}
+	return nil
+}
+
+func (m *AuthDenialsResponse) GetDenials() []*AuthDenial {
+	if m != nil {
+		return m.Denials
+	}
+	return nil
+}
+
 type AuthUserListResponse struct {
 	Header               *ResponseHeader `protobuf:"bytes,1,opt,name=header,proto3" json:"header,omitempty"`
 	Users                []string        `protobuf:"bytes,2,rep,name=users,proto3" json:"users,omitempty"`
@@ -2943,6 +4369,7 @@ func (m *AuthRoleRevokePermissionResponse) GetHeader() *ResponseHeader {
 
 func init() {
 	proto.RegisterEnum("etcdserverpb.AlarmType", AlarmType_name, AlarmType_value)
+	proto.RegisterEnum("etcdserverpb.LeaseEvent_EventType", LeaseEvent_EventType_name, LeaseEvent_EventType_value)
 	proto.RegisterEnum("etcdserverpb.RangeRequest_SortOrder", RangeRequest_SortOrder_name, RangeRequest_SortOrder_value)
 	proto.RegisterEnum("etcdserverpb.RangeRequest_SortTarget", RangeRequest_SortTarget_name, RangeRequest_SortTarget_value)
 	proto.RegisterEnum("etcdserverpb.Compare_CompareResult", Compare_CompareResult_name, Compare_CompareResult_value)
@@ -2950,6 +4377,8 @@ func init() {
 	proto.RegisterEnum("etcdserverpb.WatchCreateRequest_FilterType", WatchCreateRequest_FilterType_name, WatchCreateRequest_FilterType_value)
 	proto.RegisterEnum("etcdserverpb.AlarmRequest_AlarmAction", AlarmRequest_AlarmAction_name, AlarmRequest_AlarmAction_value)
 	proto.RegisterEnum("etcdserverpb.DowngradeRequest_DowngradeAction", DowngradeRequest_DowngradeAction_name, DowngradeRequest_DowngradeAction_value)
+	proto.RegisterEnum("etcdserverpb.StagedTxnRequest_Action", StagedTxnRequest_Action_name, StagedTxnRequest_Action_value)
+	proto.RegisterEnum("etcdserverpb.Failpoint_Type", Failpoint_Type_name, Failpoint_Type_value)
 	proto.RegisterType((*ResponseHeader)(nil), "etcdserverpb.ResponseHeader")
 	proto.RegisterType((*RangeRequest)(nil), "etcdserverpb.RangeRequest")
 	proto.RegisterType((*RangeResponse)(nil), "etcdserverpb.RangeResponse")
@@ -2962,6 +4391,8 @@ func init() {
 	proto.RegisterType((*Compare)(nil), "etcdserverpb.Compare")
 	proto.RegisterType((*TxnRequest)(nil), "etcdserverpb.TxnRequest")
 	proto.RegisterType((*TxnResponse)(nil), "etcdserverpb.TxnResponse")
+	proto.RegisterType((*StagedTxnRequest)(nil), "etcdserverpb.StagedTxnRequest")
+	proto.RegisterType((*StagedTxnResponse)(nil), "etcdserverpb.StagedTxnResponse")
 	proto.RegisterType((*CompactionRequest)(nil), "etcdserverpb.CompactionRequest")
 	proto.RegisterType((*CompactionResponse)(nil), "etcdserverpb.CompactionResponse")
 	proto.RegisterType((*HashRequest)(nil), "etcdserverpb.HashRequest")
@@ -2984,6 +4415,7 @@ func init() {
 	proto.RegisterType((*LeaseCheckpointResponse)(nil), "etcdserverpb.LeaseCheckpointResponse")
 	proto.RegisterType((*LeaseKeepAliveRequest)(nil), "etcdserverpb.LeaseKeepAliveRequest")
 	proto.RegisterType((*LeaseKeepAliveResponse)(nil), "etcdserverpb.LeaseKeepAliveResponse")
+	proto.RegisterType((*LeaseKeepAliveResult)(nil), "etcdserverpb.LeaseKeepAliveResult")
 	proto.RegisterType((*LeaseTimeToLiveRequest)(nil), "etcdserverpb.LeaseTimeToLiveRequest")
 	proto.RegisterType((*LeaseTimeToLiveResponse)(nil), "etcdserverpb.LeaseTimeToLiveResponse")
 	proto.RegisterType((*LeaseLeasesRequest)(nil), "etcdserverpb.LeaseLeasesRequest")
@@ -2998,8 +4430,11 @@ func init() {
 	proto.RegisterType((*MemberUpdateResponse)(nil), "etcdserverpb.MemberUpdateResponse")
 	proto.RegisterType((*MemberListRequest)(nil), "etcdserverpb.MemberListRequest")
 	proto.RegisterType((*MemberListResponse)(nil), "etcdserverpb.MemberListResponse")
+	proto.RegisterType((*LearnerProgress)(nil), "etcdserverpb.LearnerProgress")
 	proto.RegisterType((*MemberPromoteRequest)(nil), "etcdserverpb.MemberPromoteRequest")
 	proto.RegisterType((*MemberPromoteResponse)(nil), "etcdserverpb.MemberPromoteResponse")
+	proto.RegisterType((*MemberBatchChangeRequest)(nil), "etcdserverpb.MemberBatchChangeRequest")
+	proto.RegisterType((*MemberBatchChangeResponse)(nil), "etcdserverpb.MemberBatchChangeResponse")
 	proto.RegisterType((*DefragmentRequest)(nil), "etcdserverpb.DefragmentRequest")
 	proto.RegisterType((*DefragmentResponse)(nil), "etcdserverpb.DefragmentResponse")
 	proto.RegisterType((*MoveLeaderRequest)(nil), "etcdserverpb.MoveLeaderRequest")
@@ -3009,6 +4444,35 @@ func init() {
 	proto.RegisterType((*AlarmResponse)(nil), "etcdserverpb.AlarmResponse")
 	proto.RegisterType((*DowngradeRequest)(nil), "etcdserverpb.DowngradeRequest")
 	proto.RegisterType((*DowngradeResponse)(nil), "etcdserverpb.DowngradeResponse")
+	proto.RegisterType((*ReloadCertsRequest)(nil), "etcdserverpb.ReloadCertsRequest")
+	proto.RegisterType((*CertInfo)(nil), "etcdserverpb.CertInfo")
+	proto.RegisterType((*DowngradeFeatureStatus)(nil), "etcdserverpb.DowngradeFeatureStatus")
+	proto.RegisterType((*LatencySummary)(nil), "etcdserverpb.LatencySummary")
+	proto.RegisterType((*StartupStatus)(nil), "etcdserverpb.StartupStatus")
+	proto.RegisterType((*ReloadCertsResponse)(nil), "etcdserverpb.ReloadCertsResponse")
+	proto.RegisterType((*MaintenanceModeRequest)(nil), "etcdserverpb.MaintenanceModeRequest")
+	proto.RegisterType((*MaintenanceModeResponse)(nil), "etcdserverpb.MaintenanceModeResponse")
+	proto.RegisterType((*PromoteReplicaRequest)(nil), "etcdserverpb.PromoteReplicaRequest")
+	proto.RegisterType((*PromoteReplicaResponse)(nil), "etcdserverpb.PromoteReplicaResponse")
+	proto.RegisterType((*LogScopeLevel)(nil), "etcdserverpb.LogScopeLevel")
+	proto.RegisterType((*LogLevelRequest)(nil), "etcdserverpb.LogLevelRequest")
+	proto.RegisterType((*LogLevelResponse)(nil), "etcdserverpb.LogLevelResponse")
+	proto.RegisterType((*Failpoint)(nil), "etcdserverpb.Failpoint")
+	proto.RegisterType((*FailpointRequest)(nil), "etcdserverpb.FailpointRequest")
+	proto.RegisterType((*FailpointResponse)(nil), "etcdserverpb.FailpointResponse")
+	proto.RegisterType((*PeerNetworkStats)(nil), "etcdserverpb.PeerNetworkStats")
+	proto.RegisterType((*PeerStatsRequest)(nil), "etcdserverpb.PeerStatsRequest")
+	proto.RegisterType((*PeerStatsResponse)(nil), "etcdserverpb.PeerStatsResponse")
+	proto.RegisterType((*CompactionHoldRequest)(nil), "etcdserverpb.CompactionHoldRequest")
+	proto.RegisterType((*CompactionHold)(nil), "etcdserverpb.CompactionHold")
+	proto.RegisterType((*CompactionHoldResponse)(nil), "etcdserverpb.CompactionHoldResponse")
+	proto.RegisterType((*UserUsageRequest)(nil), "etcdserverpb.UserUsageRequest")
+	proto.RegisterType((*UserUsage)(nil), "etcdserverpb.UserUsage")
+	proto.RegisterType((*UserUsageResponse)(nil), "etcdserverpb.UserUsageResponse")
+	proto.RegisterType((*SnapshotSessionRequest)(nil), "etcdserverpb.SnapshotSessionRequest")
+	proto.RegisterType((*SnapshotSessionResponse)(nil), "etcdserverpb.SnapshotSessionResponse")
+	proto.RegisterType((*ProfileRequest)(nil), "etcdserverpb.ProfileRequest")
+	proto.RegisterType((*ProfileResponse)(nil), "etcdserverpb.ProfileResponse")
 	proto.RegisterType((*StatusRequest)(nil), "etcdserverpb.StatusRequest")
 	proto.RegisterType((*StatusResponse)(nil), "etcdserverpb.StatusResponse")
 	proto.RegisterType((*AuthEnableRequest)(nil), "etcdserverpb.AuthEnableRequest")
@@ -3045,6 +4509,12 @@ func init() {
 	proto.RegisterType((*AuthRoleDeleteResponse)(nil), "etcdserverpb.AuthRoleDeleteResponse")
 	proto.RegisterType((*AuthRoleGrantPermissionResponse)(nil), "etcdserverpb.AuthRoleGrantPermissionResponse")
 	proto.RegisterType((*AuthRoleRevokePermissionResponse)(nil), "etcdserverpb.AuthRoleRevokePermissionResponse")
+	proto.RegisterType((*AuthDenialsRequest)(nil), "etcdserverpb.AuthDenialsRequest")
+	proto.RegisterType((*AuthDenial)(nil), "etcdserverpb.AuthDenial")
+	proto.RegisterType((*AuthDenialsResponse)(nil), "etcdserverpb.AuthDenialsResponse")
+	proto.RegisterType((*LeaseWatchRequest)(nil), "etcdserverpb.LeaseWatchRequest")
+	proto.RegisterType((*LeaseEvent)(nil), "etcdserverpb.LeaseEvent")
+	proto.RegisterType((*LeaseWatchResponse)(nil), "etcdserverpb.LeaseWatchResponse")
 }
 
 func init() { proto.RegisterFile("rpc.proto", fileDescriptor_77a6da22d6a3feb1) }
@@ -3327,6 +4797,7 @@ type KVClient interface {
 	DeleteRange(ctx context.Context, in *DeleteRangeRequest, opts ...grpc.CallOption) (*DeleteRangeResponse, error)
 	Txn(ctx context.Context, in *TxnRequest, opts ...grpc.CallOption) (*TxnResponse, error)
 	Compact(ctx context.Context, in *CompactionRequest, opts ...grpc.CallOption) (*CompactionResponse, error)
+	StagedTxn(ctx context.Context, in *StagedTxnRequest, opts ...grpc.CallOption) (*StagedTxnResponse, error)
 }
 
 type kVClient struct {
@@ -3382,6 +4853,15 @@ func (c *kVClient) Compact(ctx context.Context, in *CompactionRequest, opts ...g
 	return out, nil
 }
 
+func (c *kVClient) StagedTxn(ctx context.Context, in *StagedTxnRequest, opts ...grpc.CallOption) (*StagedTxnResponse, error) {
+	out := new(StagedTxnResponse)
+	err := c.cc.Invoke(ctx, "/etcdserverpb.KV/StagedTxn", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // KVServer k,v服务
 type KVServer interface {
 	Range(context.Context, *RangeRequest) (*RangeResponse, error)                   // 范围查询
@@ -3390,6 +4870,7 @@ type KVServer interface {
 	// Txn 在一个事务中处理多个请求.一个txn请求会增加键值存储的版本并为每个完成的请求生成具有相同版本的事件.不允许在一个txn中多次修改同一个键.
 	Txn(context.Context, *TxnRequest) (*TxnResponse, error)
 	Compact(context.Context, *CompactionRequest) (*CompactionResponse, error) // 压缩 etcd 键值存储中的事件历史
+	StagedTxn(context.Context, *StagedTxnRequest) (*StagedTxnResponse, error)
 }
 
 // UnimplementedKVServer can be embedded to have forward compatible implementations.
@@ -3509,6 +4990,24 @@ func _KV_Compact_Handler(srv interface{}, ctx context.Context, dec func(interfac
 	return interceptor(ctx, in, info, handler)
 }
 
+func _KV_StagedTxn_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StagedTxnRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVServer).StagedTxn(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/etcdserverpb.KV/StagedTxn",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVServer).StagedTxn(ctx, req.(*StagedTxnRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _KV_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "etcdserverpb.KV",
 	HandlerType: (*KVServer)(nil),
@@ -3533,6 +5032,10 @@ var _KV_serviceDesc = grpc.ServiceDesc{
 			MethodName: "Compact",
 			Handler:    _KV_Compact_Handler,
 		},
+		{
+			MethodName: "StagedTxn",
+			Handler:    _KV_StagedTxn_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "rpc.proto",
@@ -3656,6 +5159,7 @@ type ClusterClient interface {
 	MemberUpdate(ctx context.Context, in *MemberUpdateRequest, opts ...grpc.CallOption) (*MemberUpdateResponse, error)
 	MemberList(ctx context.Context, in *MemberListRequest, opts ...grpc.CallOption) (*MemberListResponse, error)
 	MemberPromote(ctx context.Context, in *MemberPromoteRequest, opts ...grpc.CallOption) (*MemberPromoteResponse, error)
+	MemberBatchChange(ctx context.Context, in *MemberBatchChangeRequest, opts ...grpc.CallOption) (*MemberBatchChangeResponse, error)
 }
 
 type clusterClient struct {
@@ -3711,6 +5215,15 @@ func (c *clusterClient) MemberPromote(ctx context.Context, in *MemberPromoteRequ
 	return out, nil
 }
 
+func (c *clusterClient) MemberBatchChange(ctx context.Context, in *MemberBatchChangeRequest, opts ...grpc.CallOption) (*MemberBatchChangeResponse, error) {
+	out := new(MemberBatchChangeResponse)
+	err := c.cc.Invoke(ctx, "/etcdserverpb.Cluster/MemberBatchChange", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // ClusterServer is the server API for Cluster service.
 type ClusterServer interface {
 	MemberAdd(context.Context, *MemberAddRequest) (*MemberAddResponse, error)
@@ -3718,6 +5231,7 @@ type ClusterServer interface {
 	MemberUpdate(context.Context, *MemberUpdateRequest) (*MemberUpdateResponse, error)
 	MemberList(context.Context, *MemberListRequest) (*MemberListResponse, error)
 	MemberPromote(context.Context, *MemberPromoteRequest) (*MemberPromoteResponse, error)
+	MemberBatchChange(context.Context, *MemberBatchChangeRequest) (*MemberBatchChangeResponse, error)
 }
 
 func RegisterClusterServer(s *grpc.Server, srv ClusterServer) {
@@ -3814,6 +5328,24 @@ func _Cluster_MemberPromote_Handler(srv interface{}, ctx context.Context, dec fu
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Cluster_MemberBatchChange_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MemberBatchChangeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).MemberBatchChange(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/etcdserverpb.Cluster/MemberBatchChange",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServer).MemberBatchChange(ctx, req.(*MemberBatchChangeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _Cluster_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "etcdserverpb.Cluster",
 	HandlerType: (*ClusterServer)(nil),
@@ -3838,6 +5370,10 @@ var _Cluster_serviceDesc = grpc.ServiceDesc{
 			MethodName: "MemberPromote",
 			Handler:    _Cluster_MemberPromote_Handler,
 		},
+		{
+			MethodName: "MemberBatchChange",
+			Handler:    _Cluster_MemberBatchChange_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "rpc.proto",
@@ -3855,6 +5391,16 @@ type MaintenanceClient interface {
 	Snapshot(ctx context.Context, in *SnapshotRequest, opts ...grpc.CallOption) (Maintenance_SnapshotClient, error)
 	MoveLeader(ctx context.Context, in *MoveLeaderRequest, opts ...grpc.CallOption) (*MoveLeaderResponse, error)
 	Downgrade(ctx context.Context, in *DowngradeRequest, opts ...grpc.CallOption) (*DowngradeResponse, error)
+	ReloadCerts(ctx context.Context, in *ReloadCertsRequest, opts ...grpc.CallOption) (*ReloadCertsResponse, error)
+	MaintenanceMode(ctx context.Context, in *MaintenanceModeRequest, opts ...grpc.CallOption) (*MaintenanceModeResponse, error)
+	LogLevel(ctx context.Context, in *LogLevelRequest, opts ...grpc.CallOption) (*LogLevelResponse, error)
+	Failpoint(ctx context.Context, in *FailpointRequest, opts ...grpc.CallOption) (*FailpointResponse, error)
+	PeerStats(ctx context.Context, in *PeerStatsRequest, opts ...grpc.CallOption) (*PeerStatsResponse, error)
+	CompactionHold(ctx context.Context, in *CompactionHoldRequest, opts ...grpc.CallOption) (*CompactionHoldResponse, error)
+	UserUsage(ctx context.Context, in *UserUsageRequest, opts ...grpc.CallOption) (*UserUsageResponse, error)
+	SnapshotSession(ctx context.Context, in *SnapshotSessionRequest, opts ...grpc.CallOption) (*SnapshotSessionResponse, error)
+	PromoteReplica(ctx context.Context, in *PromoteReplicaRequest, opts ...grpc.CallOption) (*PromoteReplicaResponse, error)
+	Profile(ctx context.Context, in *ProfileRequest, opts ...grpc.CallOption) (Maintenance_ProfileClient, error)
 }
 
 type maintenanceClient struct {
@@ -3961,6 +5507,119 @@ func (c *maintenanceClient) Downgrade(ctx context.Context, in *DowngradeRequest,
 	return out, nil
 }
 
+func (c *maintenanceClient) ReloadCerts(ctx context.Context, in *ReloadCertsRequest, opts ...grpc.CallOption) (*ReloadCertsResponse, error) {
+	out := new(ReloadCertsResponse)
+	err := c.cc.Invoke(ctx, "/etcdserverpb.Maintenance/ReloadCerts", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *maintenanceClient) MaintenanceMode(ctx context.Context, in *MaintenanceModeRequest, opts ...grpc.CallOption) (*MaintenanceModeResponse, error) {
+	out := new(MaintenanceModeResponse)
+	err := c.cc.Invoke(ctx, "/etcdserverpb.Maintenance/MaintenanceMode", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *maintenanceClient) LogLevel(ctx context.Context, in *LogLevelRequest, opts ...grpc.CallOption) (*LogLevelResponse, error) {
+	out := new(LogLevelResponse)
+	err := c.cc.Invoke(ctx, "/etcdserverpb.Maintenance/LogLevel", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *maintenanceClient) Failpoint(ctx context.Context, in *FailpointRequest, opts ...grpc.CallOption) (*FailpointResponse, error) {
+	out := new(FailpointResponse)
+	err := c.cc.Invoke(ctx, "/etcdserverpb.Maintenance/Failpoint", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *maintenanceClient) PeerStats(ctx context.Context, in *PeerStatsRequest, opts ...grpc.CallOption) (*PeerStatsResponse, error) {
+	out := new(PeerStatsResponse)
+	err := c.cc.Invoke(ctx, "/etcdserverpb.Maintenance/PeerStats", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *maintenanceClient) CompactionHold(ctx context.Context, in *CompactionHoldRequest, opts ...grpc.CallOption) (*CompactionHoldResponse, error) {
+	out := new(CompactionHoldResponse)
+	err := c.cc.Invoke(ctx, "/etcdserverpb.Maintenance/CompactionHold", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *maintenanceClient) UserUsage(ctx context.Context, in *UserUsageRequest, opts ...grpc.CallOption) (*UserUsageResponse, error) {
+	out := new(UserUsageResponse)
+	err := c.cc.Invoke(ctx, "/etcdserverpb.Maintenance/UserUsage", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *maintenanceClient) SnapshotSession(ctx context.Context, in *SnapshotSessionRequest, opts ...grpc.CallOption) (*SnapshotSessionResponse, error) {
+	out := new(SnapshotSessionResponse)
+	err := c.cc.Invoke(ctx, "/etcdserverpb.Maintenance/SnapshotSession", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *maintenanceClient) PromoteReplica(ctx context.Context, in *PromoteReplicaRequest, opts ...grpc.CallOption) (*PromoteReplicaResponse, error) {
+	out := new(PromoteReplicaResponse)
+	err := c.cc.Invoke(ctx, "/etcdserverpb.Maintenance/PromoteReplica", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *maintenanceClient) Profile(ctx context.Context, in *ProfileRequest, opts ...grpc.CallOption) (Maintenance_ProfileClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Maintenance_serviceDesc.Streams[1], "/etcdserverpb.Maintenance/Profile", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &maintenanceProfileClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Maintenance_ProfileClient interface {
+	Recv() (*ProfileResponse, error)
+	grpc.ClientStream
+}
+
+type maintenanceProfileClient struct {
+	grpc.ClientStream
+}
+
+func (x *maintenanceProfileClient) Recv() (*ProfileResponse, error) {
+	m := new(ProfileResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 type MaintenanceServer interface {
 	Alarm(context.Context, *AlarmRequest) (*AlarmResponse, error)
 	Status(context.Context, *StatusRequest) (*StatusResponse, error)
@@ -3970,6 +5629,16 @@ type MaintenanceServer interface {
 	Snapshot(*SnapshotRequest, Maintenance_SnapshotServer) error
 	MoveLeader(context.Context, *MoveLeaderRequest) (*MoveLeaderResponse, error)
 	Downgrade(context.Context, *DowngradeRequest) (*DowngradeResponse, error)
+	ReloadCerts(context.Context, *ReloadCertsRequest) (*ReloadCertsResponse, error)
+	MaintenanceMode(context.Context, *MaintenanceModeRequest) (*MaintenanceModeResponse, error)
+	LogLevel(context.Context, *LogLevelRequest) (*LogLevelResponse, error)
+	Failpoint(context.Context, *FailpointRequest) (*FailpointResponse, error)
+	PeerStats(context.Context, *PeerStatsRequest) (*PeerStatsResponse, error)
+	CompactionHold(context.Context, *CompactionHoldRequest) (*CompactionHoldResponse, error)
+	UserUsage(context.Context, *UserUsageRequest) (*UserUsageResponse, error)
+	SnapshotSession(context.Context, *SnapshotSessionRequest) (*SnapshotSessionResponse, error)
+	PromoteReplica(context.Context, *PromoteReplicaRequest) (*PromoteReplicaResponse, error)
+	Profile(*ProfileRequest, Maintenance_ProfileServer) error
 }
 
 func RegisterMaintenanceServer(s *grpc.Server, srv MaintenanceServer) {
@@ -4123,6 +5792,189 @@ func _Maintenance_Downgrade_Handler(srv interface{}, ctx context.Context, dec fu
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Maintenance_ReloadCerts_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReloadCertsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MaintenanceServer).ReloadCerts(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/etcdserverpb.Maintenance/ReloadCerts",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MaintenanceServer).ReloadCerts(ctx, req.(*ReloadCertsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Maintenance_MaintenanceMode_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MaintenanceModeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MaintenanceServer).MaintenanceMode(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/etcdserverpb.Maintenance/MaintenanceMode",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MaintenanceServer).MaintenanceMode(ctx, req.(*MaintenanceModeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Maintenance_LogLevel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LogLevelRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MaintenanceServer).LogLevel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/etcdserverpb.Maintenance/LogLevel",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MaintenanceServer).LogLevel(ctx, req.(*LogLevelRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Maintenance_Failpoint_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FailpointRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MaintenanceServer).Failpoint(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/etcdserverpb.Maintenance/Failpoint",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MaintenanceServer).Failpoint(ctx, req.(*FailpointRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Maintenance_PeerStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PeerStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MaintenanceServer).PeerStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/etcdserverpb.Maintenance/PeerStats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MaintenanceServer).PeerStats(ctx, req.(*PeerStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Maintenance_CompactionHold_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CompactionHoldRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MaintenanceServer).CompactionHold(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/etcdserverpb.Maintenance/CompactionHold",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MaintenanceServer).CompactionHold(ctx, req.(*CompactionHoldRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Maintenance_UserUsage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UserUsageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MaintenanceServer).UserUsage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/etcdserverpb.Maintenance/UserUsage",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MaintenanceServer).UserUsage(ctx, req.(*UserUsageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Maintenance_SnapshotSession_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SnapshotSessionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MaintenanceServer).SnapshotSession(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/etcdserverpb.Maintenance/SnapshotSession",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MaintenanceServer).SnapshotSession(ctx, req.(*SnapshotSessionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Maintenance_PromoteReplica_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PromoteReplicaRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MaintenanceServer).PromoteReplica(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/etcdserverpb.Maintenance/PromoteReplica",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MaintenanceServer).PromoteReplica(ctx, req.(*PromoteReplicaRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Maintenance_Profile_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ProfileRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MaintenanceServer).Profile(m, &maintenanceProfileServer{stream})
+}
+
+type Maintenance_ProfileServer interface {
+	Send(*ProfileResponse) error
+	grpc.ServerStream
+}
+
+type maintenanceProfileServer struct {
+	grpc.ServerStream
+}
+
+func (x *maintenanceProfileServer) Send(m *ProfileResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 var _Maintenance_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "etcdserverpb.Maintenance",
 	HandlerType: (*MaintenanceServer)(nil),
@@ -4155,6 +6007,42 @@ var _Maintenance_serviceDesc = grpc.ServiceDesc{
 			MethodName: "Downgrade",
 			Handler:    _Maintenance_Downgrade_Handler,
 		},
+		{
+			MethodName: "ReloadCerts",
+			Handler:    _Maintenance_ReloadCerts_Handler,
+		},
+		{
+			MethodName: "MaintenanceMode",
+			Handler:    _Maintenance_MaintenanceMode_Handler,
+		},
+		{
+			MethodName: "LogLevel",
+			Handler:    _Maintenance_LogLevel_Handler,
+		},
+		{
+			MethodName: "Failpoint",
+			Handler:    _Maintenance_Failpoint_Handler,
+		},
+		{
+			MethodName: "PeerStats",
+			Handler:    _Maintenance_PeerStats_Handler,
+		},
+		{
+			MethodName: "CompactionHold",
+			Handler:    _Maintenance_CompactionHold_Handler,
+		},
+		{
+			MethodName: "UserUsage",
+			Handler:    _Maintenance_UserUsage_Handler,
+		},
+		{
+			MethodName: "SnapshotSession",
+			Handler:    _Maintenance_SnapshotSession_Handler,
+		},
+		{
+			MethodName: "PromoteReplica",
+			Handler:    _Maintenance_PromoteReplica_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -4162,6 +6050,11 @@ var _Maintenance_serviceDesc = grpc.ServiceDesc{
 			Handler:       _Maintenance_Snapshot_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "Profile",
+			Handler:       _Maintenance_Profile_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "rpc.proto",
 }
@@ -4187,6 +6080,8 @@ type AuthClient interface {
 	RoleDelete(ctx context.Context, in *AuthRoleDeleteRequest, opts ...grpc.CallOption) (*AuthRoleDeleteResponse, error)
 	RoleGrantPermission(ctx context.Context, in *AuthRoleGrantPermissionRequest, opts ...grpc.CallOption) (*AuthRoleGrantPermissionResponse, error)
 	RoleRevokePermission(ctx context.Context, in *AuthRoleRevokePermissionRequest, opts ...grpc.CallOption) (*AuthRoleRevokePermissionResponse, error)
+	// Denials lists the permission check failures recorded by the member.
+	Denials(ctx context.Context, in *AuthDenialsRequest, opts ...grpc.CallOption) (*AuthDenialsResponse, error)
 }
 
 type authClient struct {
@@ -4350,6 +6245,15 @@ func (c *authClient) RoleRevokePermission(ctx context.Context, in *AuthRoleRevok
 	return out, nil
 }
 
+func (c *authClient) Denials(ctx context.Context, in *AuthDenialsRequest, opts ...grpc.CallOption) (*AuthDenialsResponse, error) {
+	out := new(AuthDenialsResponse)
+	err := c.cc.Invoke(ctx, "/etcdserverpb.Auth/Denials", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 type AuthServer interface {
 	AuthEnable(context.Context, *AuthEnableRequest) (*AuthEnableResponse, error)
 	AuthDisable(context.Context, *AuthDisableRequest) (*AuthDisableResponse, error)
@@ -4368,6 +6272,7 @@ type AuthServer interface {
 	RoleDelete(context.Context, *AuthRoleDeleteRequest) (*AuthRoleDeleteResponse, error)
 	RoleGrantPermission(context.Context, *AuthRoleGrantPermissionRequest) (*AuthRoleGrantPermissionResponse, error)
 	RoleRevokePermission(context.Context, *AuthRoleRevokePermissionRequest) (*AuthRoleRevokePermissionResponse, error)
+	Denials(context.Context, *AuthDenialsRequest) (*AuthDenialsResponse, error)
 }
 
 func RegisterAuthServer(s *grpc.Server, srv AuthServer) {
@@ -4680,6 +6585,24 @@ func _Auth_RoleRevokePermission_Handler(srv interface{}, ctx context.Context, de
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Auth_Denials_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AuthDenialsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthServer).Denials(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/etcdserverpb.Auth/Denials",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthServer).Denials(ctx, req.(*AuthDenialsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _Auth_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "etcdserverpb.Auth",
 	HandlerType: (*AuthServer)(nil),
@@ -4752,6 +6675,10 @@ var _Auth_serviceDesc = grpc.ServiceDesc{
 			MethodName: "RoleRevokePermission",
 			Handler:    _Auth_RoleRevokePermission_Handler,
 		},
+		{
+			MethodName: "Denials",
+			Handler:    _Auth_Denials_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "rpc.proto",
@@ -4781,6 +6708,8 @@ func (m *ResponseOp) Marshal() (dAtA []byte, err error)          { return json.M
 func (m *Compare) Marshal() (dAtA []byte, err error)             { return json.Marshal(m) }
 func (m *TxnRequest) Marshal() (dAtA []byte, err error)          { return json.Marshal(m) }
 func (m *TxnResponse) Marshal() (dAtA []byte, err error)         { return json.Marshal(m) }
+func (m *StagedTxnRequest) Marshal() (dAtA []byte, err error)    { return json.Marshal(m) }
+func (m *StagedTxnResponse) Marshal() (dAtA []byte, err error)   { return json.Marshal(m) }
 func (m *CompactionRequest) Marshal() (dAtA []byte, err error)   { return json.Marshal(m) }
 func (m *CompactionResponse) Marshal() (dAtA []byte, err error)  { return json.Marshal(m) }
 func (m *HashRequest) Marshal() (dAtA []byte, err error)         { return json.Marshal(m) }
@@ -4803,6 +6732,7 @@ func (m *LeaseCheckpointRequest) Marshal() (dAtA []byte, err error)           {
 func (m *LeaseCheckpointResponse) Marshal() (dAtA []byte, err error)          { return json.Marshal(m) }
 func (m *LeaseKeepAliveRequest) Marshal() (dAtA []byte, err error)            { return json.Marshal(m) }
 func (m *LeaseKeepAliveResponse) Marshal() (dAtA []byte, err error)           { return json.Marshal(m) }
+func (m *LeaseKeepAliveResult) Marshal() (dAtA []byte, err error)             { return json.Marshal(m) }
 func (m *LeaseTimeToLiveRequest) Marshal() (dAtA []byte, err error)           { return json.Marshal(m) }
 func (m *LeaseTimeToLiveResponse) Marshal() (dAtA []byte, err error)          { return json.Marshal(m) }
 func (m *LeaseLeasesRequest) Marshal() (dAtA []byte, err error)               { return json.Marshal(m) }
@@ -4817,8 +6747,11 @@ func (m *MemberUpdateRequest) Marshal() (dAtA []byte, err error)              {
 func (m *MemberUpdateResponse) Marshal() (dAtA []byte, err error)             { return json.Marshal(m) }
 func (m *MemberListRequest) Marshal() (dAtA []byte, err error)                { return json.Marshal(m) }
 func (m *MemberListResponse) Marshal() (dAtA []byte, err error)               { return json.Marshal(m) }
+func (m *LearnerProgress) Marshal() (dAtA []byte, err error)                  { return json.Marshal(m) }
 func (m *MemberPromoteRequest) Marshal() (dAtA []byte, err error)             { return json.Marshal(m) }
 func (m *MemberPromoteResponse) Marshal() (dAtA []byte, err error)            { return json.Marshal(m) }
+func (m *MemberBatchChangeRequest) Marshal() (dAtA []byte, err error)         { return json.Marshal(m) }
+func (m *MemberBatchChangeResponse) Marshal() (dAtA []byte, err error)        { return json.Marshal(m) }
 func (m *DefragmentRequest) Marshal() (dAtA []byte, err error)                { return json.Marshal(m) }
 func (m *DefragmentResponse) Marshal() (dAtA []byte, err error)               { return json.Marshal(m) }
 func (m *MoveLeaderRequest) Marshal() (dAtA []byte, err error)                { return json.Marshal(m) }
@@ -4828,6 +6761,35 @@ func (m *AlarmResponse) Marshal() (dAtA []byte, err error)                    {
 func (m *DowngradeRequest) Marshal() (dAtA []byte, err error)                 { return json.Marshal(m) }
 func (m *DowngradeResponse) Marshal() (dAtA []byte, err error)                { return json.Marshal(m) }
 func (m *StatusRequest) Marshal() (dAtA []byte, err error)                    { return json.Marshal(m) }
+func (m *ReloadCertsRequest) Marshal() (dAtA []byte, err error)               { return json.Marshal(m) }
+func (m *CertInfo) Marshal() (dAtA []byte, err error)                         { return json.Marshal(m) }
+func (m *DowngradeFeatureStatus) Marshal() (dAtA []byte, err error)           { return json.Marshal(m) }
+func (m *LatencySummary) Marshal() (dAtA []byte, err error)                   { return json.Marshal(m) }
+func (m *StartupStatus) Marshal() (dAtA []byte, err error)                    { return json.Marshal(m) }
+func (m *ReloadCertsResponse) Marshal() (dAtA []byte, err error)              { return json.Marshal(m) }
+func (m *MaintenanceModeRequest) Marshal() (dAtA []byte, err error)           { return json.Marshal(m) }
+func (m *MaintenanceModeResponse) Marshal() (dAtA []byte, err error)          { return json.Marshal(m) }
+func (m *PromoteReplicaRequest) Marshal() (dAtA []byte, err error)            { return json.Marshal(m) }
+func (m *PromoteReplicaResponse) Marshal() (dAtA []byte, err error)           { return json.Marshal(m) }
+func (m *LogScopeLevel) Marshal() (dAtA []byte, err error)                    { return json.Marshal(m) }
+func (m *LogLevelRequest) Marshal() (dAtA []byte, err error)                  { return json.Marshal(m) }
+func (m *LogLevelResponse) Marshal() (dAtA []byte, err error)                 { return json.Marshal(m) }
+func (m *Failpoint) Marshal() (dAtA []byte, err error)                        { return json.Marshal(m) }
+func (m *FailpointRequest) Marshal() (dAtA []byte, err error)                 { return json.Marshal(m) }
+func (m *FailpointResponse) Marshal() (dAtA []byte, err error)                { return json.Marshal(m) }
+func (m *PeerNetworkStats) Marshal() (dAtA []byte, err error)                 { return json.Marshal(m) }
+func (m *PeerStatsRequest) Marshal() (dAtA []byte, err error)                 { return json.Marshal(m) }
+func (m *PeerStatsResponse) Marshal() (dAtA []byte, err error)                { return json.Marshal(m) }
+func (m *CompactionHoldRequest) Marshal() (dAtA []byte, err error)            { return json.Marshal(m) }
+func (m *CompactionHold) Marshal() (dAtA []byte, err error)                   { return json.Marshal(m) }
+func (m *CompactionHoldResponse) Marshal() (dAtA []byte, err error)           { return json.Marshal(m) }
+func (m *UserUsageRequest) Marshal() (dAtA []byte, err error)                 { return json.Marshal(m) }
+func (m *UserUsage) Marshal() (dAtA []byte, err error)                        { return json.Marshal(m) }
+func (m *UserUsageResponse) Marshal() (dAtA []byte, err error)                { return json.Marshal(m) }
+func (m *SnapshotSessionRequest) Marshal() (dAtA []byte, err error)           { return json.Marshal(m) }
+func (m *SnapshotSessionResponse) Marshal() (dAtA []byte, err error)          { return json.Marshal(m) }
+func (m *ProfileRequest) Marshal() (dAtA []byte, err error)                   { return json.Marshal(m) }
+func (m *ProfileResponse) Marshal() (dAtA []byte, err error)                  { return json.Marshal(m) }
 func (m *StatusResponse) Marshal() (dAtA []byte, err error)                   { return json.Marshal(m) }
 func (m *AuthEnableRequest) Marshal() (dAtA []byte, err error)                { return json.Marshal(m) }
 func (m *AuthDisableRequest) Marshal() (dAtA []byte, err error)               { return json.Marshal(m) }
@@ -4863,6 +6825,12 @@ func (m *AuthUserListResponse) Marshal() (dAtA []byte, err error)             {
 func (m *AuthRoleDeleteResponse) Marshal() (dAtA []byte, err error)           { return json.Marshal(m) }
 func (m *AuthRoleGrantPermissionResponse) Marshal() (dAtA []byte, err error)  { return json.Marshal(m) }
 func (m *AuthRoleRevokePermissionResponse) Marshal() (dAtA []byte, err error) { return json.Marshal(m) }
+func (m *AuthDenialsRequest) Marshal() (dAtA []byte, err error)               { return json.Marshal(m) }
+func (m *AuthDenial) Marshal() (dAtA []byte, err error)                       { return json.Marshal(m) }
+func (m *AuthDenialsResponse) Marshal() (dAtA []byte, err error)              { return json.Marshal(m) }
+func (m *LeaseWatchRequest) Marshal() (dAtA []byte, err error)                { return json.Marshal(m) }
+func (m *LeaseEvent) Marshal() (dAtA []byte, err error)                       { return json.Marshal(m) }
+func (m *LeaseWatchResponse) Marshal() (dAtA []byte, err error)               { return json.Marshal(m) }
 
 func (m *ResponseHeader) Size() (n int)         { marshal, _ := json.Marshal(m); return len(marshal) }
 func (m *RangeRequest) Size() (n int)           { marshal, _ := json.Marshal(m); return len(marshal) }
@@ -4895,6 +6863,8 @@ func (m *Compare_Value) Size() (n int)          { marshal, _ := json.Marshal(m);
 func (m *Compare_Lease) Size() (n int)          { marshal, _ := json.Marshal(m); return len(marshal) }
 func (m *TxnRequest) Size() (n int)             { marshal, _ := json.Marshal(m); return len(marshal) }
 func (m *TxnResponse) Size() (n int)            { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *StagedTxnRequest) Size() (n int)       { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *StagedTxnResponse) Size() (n int)      { marshal, _ := json.Marshal(m); return len(marshal) }
 func (m *CompactionRequest) Size() (n int)      { marshal, _ := json.Marshal(m); return len(marshal) }
 func (m *CompactionResponse) Size() (n int)     { marshal, _ := json.Marshal(m); return len(marshal) }
 func (m *HashRequest) Size() (n int)            { marshal, _ := json.Marshal(m); return len(marshal) }
@@ -4918,35 +6888,42 @@ func (m *WatchRequest_ProgressRequest) Size() (n int) {
 	marshal, _ := json.Marshal(m)
 	return len(marshal)
 }
-func (m *WatchCreateRequest) Size() (n int)      { marshal, _ := json.Marshal(m); return len(marshal) }
-func (m *WatchCancelRequest) Size() (n int)      { marshal, _ := json.Marshal(m); return len(marshal) }
-func (m *WatchProgressRequest) Size() (n int)    { marshal, _ := json.Marshal(m); return len(marshal) }
-func (m *WatchResponse) Size() (n int)           { marshal, _ := json.Marshal(m); return len(marshal) }
-func (m *LeaseGrantRequest) Size() (n int)       { marshal, _ := json.Marshal(m); return len(marshal) }
-func (m *LeaseGrantResponse) Size() (n int)      { marshal, _ := json.Marshal(m); return len(marshal) }
-func (m *LeaseRevokeRequest) Size() (n int)      { marshal, _ := json.Marshal(m); return len(marshal) }
-func (m *LeaseRevokeResponse) Size() (n int)     { marshal, _ := json.Marshal(m); return len(marshal) }
-func (m *LeaseCheckpoint) Size() (n int)         { marshal, _ := json.Marshal(m); return len(marshal) }
-func (m *LeaseCheckpointRequest) Size() (n int)  { marshal, _ := json.Marshal(m); return len(marshal) }
-func (m *LeaseCheckpointResponse) Size() (n int) { marshal, _ := json.Marshal(m); return len(marshal) }
-func (m *LeaseKeepAliveRequest) Size() (n int)   { marshal, _ := json.Marshal(m); return len(marshal) }
-func (m *LeaseKeepAliveResponse) Size() (n int)  { marshal, _ := json.Marshal(m); return len(marshal) }
-func (m *LeaseTimeToLiveRequest) Size() (n int)  { marshal, _ := json.Marshal(m); return len(marshal) }
-func (m *LeaseTimeToLiveResponse) Size() (n int) { marshal, _ := json.Marshal(m); return len(marshal) }
-func (m *LeaseLeasesRequest) Size() (n int)      { marshal, _ := json.Marshal(m); return len(marshal) }
-func (m *LeaseStatus) Size() (n int)             { marshal, _ := json.Marshal(m); return len(marshal) }
-func (m *LeaseLeasesResponse) Size() (n int)     { marshal, _ := json.Marshal(m); return len(marshal) }
-func (m *Member) Size() (n int)                  { marshal, _ := json.Marshal(m); return len(marshal) }
-func (m *MemberAddRequest) Size() (n int)        { marshal, _ := json.Marshal(m); return len(marshal) }
-func (m *MemberAddResponse) Size() (n int)       { marshal, _ := json.Marshal(m); return len(marshal) }
-func (m *MemberRemoveRequest) Size() (n int)     { marshal, _ := json.Marshal(m); return len(marshal) }
-func (m *MemberRemoveResponse) Size() (n int)    { marshal, _ := json.Marshal(m); return len(marshal) }
-func (m *MemberUpdateRequest) Size() (n int)     { marshal, _ := json.Marshal(m); return len(marshal) }
-func (m *MemberUpdateResponse) Size() (n int)    { marshal, _ := json.Marshal(m); return len(marshal) }
-func (m *MemberListRequest) Size() (n int)       { marshal, _ := json.Marshal(m); return len(marshal) }
-func (m *MemberListResponse) Size() (n int)      { marshal, _ := json.Marshal(m); return len(marshal) }
-func (m *MemberPromoteRequest) Size() (n int)    { marshal, _ := json.Marshal(m); return len(marshal) }
-func (m *MemberPromoteResponse) Size() (n int)   { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *WatchCreateRequest) Size() (n int)       { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *WatchCancelRequest) Size() (n int)       { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *WatchProgressRequest) Size() (n int)     { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *WatchResponse) Size() (n int)            { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *LeaseGrantRequest) Size() (n int)        { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *LeaseGrantResponse) Size() (n int)       { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *LeaseRevokeRequest) Size() (n int)       { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *LeaseRevokeResponse) Size() (n int)      { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *LeaseCheckpoint) Size() (n int)          { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *LeaseCheckpointRequest) Size() (n int)   { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *LeaseCheckpointResponse) Size() (n int)  { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *LeaseKeepAliveRequest) Size() (n int)    { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *LeaseKeepAliveResponse) Size() (n int)   { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *LeaseKeepAliveResult) Size() (n int)     { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *LeaseTimeToLiveRequest) Size() (n int)   { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *LeaseTimeToLiveResponse) Size() (n int)  { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *LeaseLeasesRequest) Size() (n int)       { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *LeaseStatus) Size() (n int)              { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *LeaseLeasesResponse) Size() (n int)      { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *Member) Size() (n int)                   { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *MemberAddRequest) Size() (n int)         { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *MemberAddResponse) Size() (n int)        { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *MemberRemoveRequest) Size() (n int)      { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *MemberRemoveResponse) Size() (n int)     { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *MemberUpdateRequest) Size() (n int)      { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *MemberUpdateResponse) Size() (n int)     { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *MemberListRequest) Size() (n int)        { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *MemberListResponse) Size() (n int)       { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *LearnerProgress) Size() (n int)          { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *MemberPromoteRequest) Size() (n int)     { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *MemberPromoteResponse) Size() (n int)    { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *MemberBatchChangeRequest) Size() (n int) { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *MemberBatchChangeResponse) Size() (n int) {
+	marshal, _ := json.Marshal(m)
+	return len(marshal)
+}
 func (m *DefragmentRequest) Size() (n int)       { marshal, _ := json.Marshal(m); return len(marshal) }
 func (m *DefragmentResponse) Size() (n int)      { marshal, _ := json.Marshal(m); return len(marshal) }
 func (m *MoveLeaderRequest) Size() (n int)       { marshal, _ := json.Marshal(m); return len(marshal) }
@@ -4957,6 +6934,35 @@ func (m *AlarmResponse) Size() (n int)           { marshal, _ := json.Marshal(m)
 func (m *DowngradeRequest) Size() (n int)        { marshal, _ := json.Marshal(m); return len(marshal) }
 func (m *DowngradeResponse) Size() (n int)       { marshal, _ := json.Marshal(m); return len(marshal) }
 func (m *StatusRequest) Size() (n int)           { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *ReloadCertsRequest) Size() (n int)      { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *CertInfo) Size() (n int)                { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *DowngradeFeatureStatus) Size() (n int)  { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *LatencySummary) Size() (n int)          { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *StartupStatus) Size() (n int)           { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *ReloadCertsResponse) Size() (n int)     { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *MaintenanceModeRequest) Size() (n int)  { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *MaintenanceModeResponse) Size() (n int) { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *PromoteReplicaRequest) Size() (n int)   { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *PromoteReplicaResponse) Size() (n int)  { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *LogScopeLevel) Size() (n int)           { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *LogLevelRequest) Size() (n int)         { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *LogLevelResponse) Size() (n int)        { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *Failpoint) Size() (n int)               { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *FailpointRequest) Size() (n int)        { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *FailpointResponse) Size() (n int)       { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *PeerNetworkStats) Size() (n int)        { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *PeerStatsRequest) Size() (n int)        { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *PeerStatsResponse) Size() (n int)       { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *CompactionHoldRequest) Size() (n int)   { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *CompactionHold) Size() (n int)          { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *CompactionHoldResponse) Size() (n int)  { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *UserUsageRequest) Size() (n int)        { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *UserUsage) Size() (n int)               { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *UserUsageResponse) Size() (n int)       { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *SnapshotSessionRequest) Size() (n int)  { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *SnapshotSessionResponse) Size() (n int) { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *ProfileRequest) Size() (n int)          { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *ProfileResponse) Size() (n int)         { marshal, _ := json.Marshal(m); return len(marshal) }
 func (m *StatusResponse) Size() (n int)          { marshal, _ := json.Marshal(m); return len(marshal) }
 func (m *AuthEnableRequest) Size() (n int)       { marshal, _ := json.Marshal(m); return len(marshal) }
 func (m *AuthDisableRequest) Size() (n int)      { marshal, _ := json.Marshal(m); return len(marshal) }
@@ -5023,6 +7029,12 @@ func (m *AuthRoleRevokePermissionResponse) Size() (n int) {
 	marshal, _ := json.Marshal(m)
 	return len(marshal)
 }
+func (m *AuthDenialsRequest) Size() (n int)  { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *AuthDenial) Size() (n int)          { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *AuthDenialsResponse) Size() (n int) { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *LeaseWatchRequest) Size() (n int)   { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *LeaseEvent) Size() (n int)          { marshal, _ := json.Marshal(m); return len(marshal) }
+func (m *LeaseWatchResponse) Size() (n int)  { marshal, _ := json.Marshal(m); return len(marshal) }
 
 func sovRpc(x uint64) (n int) {
 	return (math_bits.Len64(x|1) + 6) / 7
@@ -5034,65 +7046,100 @@ var (
 	ErrUnexpectedEndOfGroupRpc = fmt.Errorf("proto: unexpected end of group")
 )
 
-func (m *ResponseHeader) Unmarshal(dAtA []byte) error          { return json.Unmarshal(dAtA, m) }
-func (m *RangeRequest) Unmarshal(dAtA []byte) error            { return json.Unmarshal(dAtA, m) }
-func (m *RangeResponse) Unmarshal(dAtA []byte) error           { return json.Unmarshal(dAtA, m) }
-func (m *PutRequest) Unmarshal(dAtA []byte) error              { return json.Unmarshal(dAtA, m) }
-func (m *PutResponse) Unmarshal(dAtA []byte) error             { return json.Unmarshal(dAtA, m) }
-func (m *DeleteRangeRequest) Unmarshal(dAtA []byte) error      { return json.Unmarshal(dAtA, m) }
-func (m *DeleteRangeResponse) Unmarshal(dAtA []byte) error     { return json.Unmarshal(dAtA, m) }
-func (m *RequestOp) Unmarshal(dAtA []byte) error               { return json.Unmarshal(dAtA, m) }
-func (m *ResponseOp) Unmarshal(dAtA []byte) error              { return json.Unmarshal(dAtA, m) }
-func (m *Compare) Unmarshal(dAtA []byte) error                 { return json.Unmarshal(dAtA, m) }
-func (m *TxnRequest) Unmarshal(dAtA []byte) error              { return json.Unmarshal(dAtA, m) }
-func (m *TxnResponse) Unmarshal(dAtA []byte) error             { return json.Unmarshal(dAtA, m) }
-func (m *CompactionRequest) Unmarshal(dAtA []byte) error       { return json.Unmarshal(dAtA, m) }
-func (m *CompactionResponse) Unmarshal(dAtA []byte) error      { return json.Unmarshal(dAtA, m) }
-func (m *HashRequest) Unmarshal(dAtA []byte) error             { return json.Unmarshal(dAtA, m) }
-func (m *HashKVRequest) Unmarshal(dAtA []byte) error           { return json.Unmarshal(dAtA, m) }
-func (m *HashKVResponse) Unmarshal(dAtA []byte) error          { return json.Unmarshal(dAtA, m) }
-func (m *HashResponse) Unmarshal(dAtA []byte) error            { return json.Unmarshal(dAtA, m) }
-func (m *SnapshotRequest) Unmarshal(dAtA []byte) error         { return json.Unmarshal(dAtA, m) }
-func (m *SnapshotResponse) Unmarshal(dAtA []byte) error        { return json.Unmarshal(dAtA, m) }
-func (m *WatchCreateRequest) Unmarshal(dAtA []byte) error      { return json.Unmarshal(dAtA, m) }
-func (m *WatchCancelRequest) Unmarshal(dAtA []byte) error      { return json.Unmarshal(dAtA, m) }
-func (m *WatchProgressRequest) Unmarshal(dAtA []byte) error    { return json.Unmarshal(dAtA, m) }
-func (m *WatchResponse) Unmarshal(dAtA []byte) error           { return json.Unmarshal(dAtA, m) }
-func (m *LeaseGrantRequest) Unmarshal(dAtA []byte) error       { return json.Unmarshal(dAtA, m) }
-func (m *LeaseGrantResponse) Unmarshal(dAtA []byte) error      { return json.Unmarshal(dAtA, m) }
-func (m *LeaseRevokeRequest) Unmarshal(dAtA []byte) error      { return json.Unmarshal(dAtA, m) }
-func (m *LeaseRevokeResponse) Unmarshal(dAtA []byte) error     { return json.Unmarshal(dAtA, m) }
-func (m *LeaseCheckpoint) Unmarshal(dAtA []byte) error         { return json.Unmarshal(dAtA, m) }
-func (m *LeaseCheckpointRequest) Unmarshal(dAtA []byte) error  { return json.Unmarshal(dAtA, m) }
-func (m *LeaseCheckpointResponse) Unmarshal(dAtA []byte) error { return json.Unmarshal(dAtA, m) }
-func (m *LeaseKeepAliveRequest) Unmarshal(dAtA []byte) error   { return json.Unmarshal(dAtA, m) }
-func (m *LeaseKeepAliveResponse) Unmarshal(dAtA []byte) error  { return json.Unmarshal(dAtA, m) }
-func (m *LeaseTimeToLiveRequest) Unmarshal(dAtA []byte) error  { return json.Unmarshal(dAtA, m) }
-func (m *LeaseTimeToLiveResponse) Unmarshal(dAtA []byte) error { return json.Unmarshal(dAtA, m) }
-func (m *LeaseLeasesRequest) Unmarshal(dAtA []byte) error      { return json.Unmarshal(dAtA, m) }
-func (m *LeaseStatus) Unmarshal(dAtA []byte) error             { return json.Unmarshal(dAtA, m) }
-func (m *LeaseLeasesResponse) Unmarshal(dAtA []byte) error     { return json.Unmarshal(dAtA, m) }
-func (m *Member) Unmarshal(dAtA []byte) error                  { return json.Unmarshal(dAtA, m) }
-func (m *MemberAddRequest) Unmarshal(dAtA []byte) error        { return json.Unmarshal(dAtA, m) }
-func (m *MemberAddResponse) Unmarshal(dAtA []byte) error       { return json.Unmarshal(dAtA, m) }
-func (m *MemberRemoveRequest) Unmarshal(dAtA []byte) error     { return json.Unmarshal(dAtA, m) }
-func (m *MemberRemoveResponse) Unmarshal(dAtA []byte) error    { return json.Unmarshal(dAtA, m) }
-func (m *MemberUpdateRequest) Unmarshal(dAtA []byte) error     { return json.Unmarshal(dAtA, m) }
-func (m *MemberUpdateResponse) Unmarshal(dAtA []byte) error    { return json.Unmarshal(dAtA, m) }
-func (m *MemberListRequest) Unmarshal(dAtA []byte) error       { return json.Unmarshal(dAtA, m) }
-func (m *MemberListResponse) Unmarshal(dAtA []byte) error      { return json.Unmarshal(dAtA, m) }
-func (m *MemberPromoteRequest) Unmarshal(dAtA []byte) error    { return json.Unmarshal(dAtA, m) }
-func (m *MemberPromoteResponse) Unmarshal(dAtA []byte) error   { return json.Unmarshal(dAtA, m) }
-func (m *DefragmentRequest) Unmarshal(dAtA []byte) error       { return json.Unmarshal(dAtA, m) }
-func (m *DefragmentResponse) Unmarshal(dAtA []byte) error      { return json.Unmarshal(dAtA, m) }
-func (m *MoveLeaderRequest) Unmarshal(dAtA []byte) error       { return json.Unmarshal(dAtA, m) }
-func (m *MoveLeaderResponse) Unmarshal(dAtA []byte) error      { return json.Unmarshal(dAtA, m) }
-func (m *AlarmRequest) Unmarshal(dAtA []byte) error            { return json.Unmarshal(dAtA, m) }
+func (m *ResponseHeader) Unmarshal(dAtA []byte) error            { return json.Unmarshal(dAtA, m) }
+func (m *RangeRequest) Unmarshal(dAtA []byte) error              { return json.Unmarshal(dAtA, m) }
+func (m *RangeResponse) Unmarshal(dAtA []byte) error             { return json.Unmarshal(dAtA, m) }
+func (m *PutRequest) Unmarshal(dAtA []byte) error                { return json.Unmarshal(dAtA, m) }
+func (m *PutResponse) Unmarshal(dAtA []byte) error               { return json.Unmarshal(dAtA, m) }
+func (m *DeleteRangeRequest) Unmarshal(dAtA []byte) error        { return json.Unmarshal(dAtA, m) }
+func (m *DeleteRangeResponse) Unmarshal(dAtA []byte) error       { return json.Unmarshal(dAtA, m) }
+func (m *RequestOp) Unmarshal(dAtA []byte) error                 { return json.Unmarshal(dAtA, m) }
+func (m *ResponseOp) Unmarshal(dAtA []byte) error                { return json.Unmarshal(dAtA, m) }
+func (m *Compare) Unmarshal(dAtA []byte) error                   { return json.Unmarshal(dAtA, m) }
+func (m *TxnRequest) Unmarshal(dAtA []byte) error                { return json.Unmarshal(dAtA, m) }
+func (m *TxnResponse) Unmarshal(dAtA []byte) error               { return json.Unmarshal(dAtA, m) }
+func (m *StagedTxnRequest) Unmarshal(dAtA []byte) error          { return json.Unmarshal(dAtA, m) }
+func (m *StagedTxnResponse) Unmarshal(dAtA []byte) error         { return json.Unmarshal(dAtA, m) }
+func (m *CompactionRequest) Unmarshal(dAtA []byte) error         { return json.Unmarshal(dAtA, m) }
+func (m *CompactionResponse) Unmarshal(dAtA []byte) error        { return json.Unmarshal(dAtA, m) }
+func (m *HashRequest) Unmarshal(dAtA []byte) error               { return json.Unmarshal(dAtA, m) }
+func (m *HashKVRequest) Unmarshal(dAtA []byte) error             { return json.Unmarshal(dAtA, m) }
+func (m *HashKVResponse) Unmarshal(dAtA []byte) error            { return json.Unmarshal(dAtA, m) }
+func (m *HashResponse) Unmarshal(dAtA []byte) error              { return json.Unmarshal(dAtA, m) }
+func (m *SnapshotRequest) Unmarshal(dAtA []byte) error           { return json.Unmarshal(dAtA, m) }
+func (m *SnapshotResponse) Unmarshal(dAtA []byte) error          { return json.Unmarshal(dAtA, m) }
+func (m *WatchCreateRequest) Unmarshal(dAtA []byte) error        { return json.Unmarshal(dAtA, m) }
+func (m *WatchCancelRequest) Unmarshal(dAtA []byte) error        { return json.Unmarshal(dAtA, m) }
+func (m *WatchProgressRequest) Unmarshal(dAtA []byte) error      { return json.Unmarshal(dAtA, m) }
+func (m *WatchResponse) Unmarshal(dAtA []byte) error             { return json.Unmarshal(dAtA, m) }
+func (m *LeaseGrantRequest) Unmarshal(dAtA []byte) error         { return json.Unmarshal(dAtA, m) }
+func (m *LeaseGrantResponse) Unmarshal(dAtA []byte) error        { return json.Unmarshal(dAtA, m) }
+func (m *LeaseRevokeRequest) Unmarshal(dAtA []byte) error        { return json.Unmarshal(dAtA, m) }
+func (m *LeaseRevokeResponse) Unmarshal(dAtA []byte) error       { return json.Unmarshal(dAtA, m) }
+func (m *LeaseCheckpoint) Unmarshal(dAtA []byte) error           { return json.Unmarshal(dAtA, m) }
+func (m *LeaseCheckpointRequest) Unmarshal(dAtA []byte) error    { return json.Unmarshal(dAtA, m) }
+func (m *LeaseCheckpointResponse) Unmarshal(dAtA []byte) error   { return json.Unmarshal(dAtA, m) }
+func (m *LeaseKeepAliveRequest) Unmarshal(dAtA []byte) error     { return json.Unmarshal(dAtA, m) }
+func (m *LeaseKeepAliveResponse) Unmarshal(dAtA []byte) error    { return json.Unmarshal(dAtA, m) }
+func (m *LeaseKeepAliveResult) Unmarshal(dAtA []byte) error      { return json.Unmarshal(dAtA, m) }
+func (m *LeaseTimeToLiveRequest) Unmarshal(dAtA []byte) error    { return json.Unmarshal(dAtA, m) }
+func (m *LeaseTimeToLiveResponse) Unmarshal(dAtA []byte) error   { return json.Unmarshal(dAtA, m) }
+func (m *LeaseLeasesRequest) Unmarshal(dAtA []byte) error        { return json.Unmarshal(dAtA, m) }
+func (m *LeaseStatus) Unmarshal(dAtA []byte) error               { return json.Unmarshal(dAtA, m) }
+func (m *LeaseLeasesResponse) Unmarshal(dAtA []byte) error       { return json.Unmarshal(dAtA, m) }
+func (m *Member) Unmarshal(dAtA []byte) error                    { return json.Unmarshal(dAtA, m) }
+func (m *MemberAddRequest) Unmarshal(dAtA []byte) error          { return json.Unmarshal(dAtA, m) }
+func (m *MemberAddResponse) Unmarshal(dAtA []byte) error         { return json.Unmarshal(dAtA, m) }
+func (m *MemberRemoveRequest) Unmarshal(dAtA []byte) error       { return json.Unmarshal(dAtA, m) }
+func (m *MemberRemoveResponse) Unmarshal(dAtA []byte) error      { return json.Unmarshal(dAtA, m) }
+func (m *MemberUpdateRequest) Unmarshal(dAtA []byte) error       { return json.Unmarshal(dAtA, m) }
+func (m *MemberUpdateResponse) Unmarshal(dAtA []byte) error      { return json.Unmarshal(dAtA, m) }
+func (m *MemberListRequest) Unmarshal(dAtA []byte) error         { return json.Unmarshal(dAtA, m) }
+func (m *MemberListResponse) Unmarshal(dAtA []byte) error        { return json.Unmarshal(dAtA, m) }
+func (m *LearnerProgress) Unmarshal(dAtA []byte) error           { return json.Unmarshal(dAtA, m) }
+func (m *MemberPromoteRequest) Unmarshal(dAtA []byte) error      { return json.Unmarshal(dAtA, m) }
+func (m *MemberPromoteResponse) Unmarshal(dAtA []byte) error     { return json.Unmarshal(dAtA, m) }
+func (m *MemberBatchChangeRequest) Unmarshal(dAtA []byte) error  { return json.Unmarshal(dAtA, m) }
+func (m *MemberBatchChangeResponse) Unmarshal(dAtA []byte) error { return json.Unmarshal(dAtA, m) }
+func (m *DefragmentRequest) Unmarshal(dAtA []byte) error         { return json.Unmarshal(dAtA, m) }
+func (m *DefragmentResponse) Unmarshal(dAtA []byte) error        { return json.Unmarshal(dAtA, m) }
+func (m *MoveLeaderRequest) Unmarshal(dAtA []byte) error         { return json.Unmarshal(dAtA, m) }
+func (m *MoveLeaderResponse) Unmarshal(dAtA []byte) error        { return json.Unmarshal(dAtA, m) }
+func (m *AlarmRequest) Unmarshal(dAtA []byte) error              { return json.Unmarshal(dAtA, m) }
 
 func (m *AlarmResponse) Unmarshal(dAtA []byte) error                  { return json.Unmarshal(dAtA, m) }
 func (m *DowngradeRequest) Unmarshal(dAtA []byte) error               { return json.Unmarshal(dAtA, m) }
 func (m *DowngradeResponse) Unmarshal(dAtA []byte) error              { return json.Unmarshal(dAtA, m) }
 func (m *StatusRequest) Unmarshal(dAtA []byte) error                  { return json.Unmarshal(dAtA, m) }
+func (m *ReloadCertsRequest) Unmarshal(dAtA []byte) error             { return json.Unmarshal(dAtA, m) }
+func (m *CertInfo) Unmarshal(dAtA []byte) error                       { return json.Unmarshal(dAtA, m) }
+func (m *DowngradeFeatureStatus) Unmarshal(dAtA []byte) error         { return json.Unmarshal(dAtA, m) }
+func (m *LatencySummary) Unmarshal(dAtA []byte) error                 { return json.Unmarshal(dAtA, m) }
+func (m *StartupStatus) Unmarshal(dAtA []byte) error                  { return json.Unmarshal(dAtA, m) }
+func (m *ReloadCertsResponse) Unmarshal(dAtA []byte) error            { return json.Unmarshal(dAtA, m) }
+func (m *MaintenanceModeRequest) Unmarshal(dAtA []byte) error         { return json.Unmarshal(dAtA, m) }
+func (m *MaintenanceModeResponse) Unmarshal(dAtA []byte) error        { return json.Unmarshal(dAtA, m) }
+func (m *PromoteReplicaRequest) Unmarshal(dAtA []byte) error          { return json.Unmarshal(dAtA, m) }
+func (m *PromoteReplicaResponse) Unmarshal(dAtA []byte) error         { return json.Unmarshal(dAtA, m) }
+func (m *LogScopeLevel) Unmarshal(dAtA []byte) error                  { return json.Unmarshal(dAtA, m) }
+func (m *LogLevelRequest) Unmarshal(dAtA []byte) error                { return json.Unmarshal(dAtA, m) }
+func (m *LogLevelResponse) Unmarshal(dAtA []byte) error               { return json.Unmarshal(dAtA, m) }
+func (m *Failpoint) Unmarshal(dAtA []byte) error                      { return json.Unmarshal(dAtA, m) }
+func (m *FailpointRequest) Unmarshal(dAtA []byte) error               { return json.Unmarshal(dAtA, m) }
+func (m *FailpointResponse) Unmarshal(dAtA []byte) error              { return json.Unmarshal(dAtA, m) }
+func (m *PeerNetworkStats) Unmarshal(dAtA []byte) error               { return json.Unmarshal(dAtA, m) }
+func (m *PeerStatsRequest) Unmarshal(dAtA []byte) error               { return json.Unmarshal(dAtA, m) }
+func (m *PeerStatsResponse) Unmarshal(dAtA []byte) error              { return json.Unmarshal(dAtA, m) }
+func (m *CompactionHoldRequest) Unmarshal(dAtA []byte) error          { return json.Unmarshal(dAtA, m) }
+func (m *CompactionHold) Unmarshal(dAtA []byte) error                 { return json.Unmarshal(dAtA, m) }
+func (m *CompactionHoldResponse) Unmarshal(dAtA []byte) error         { return json.Unmarshal(dAtA, m) }
+func (m *UserUsageRequest) Unmarshal(dAtA []byte) error               { return json.Unmarshal(dAtA, m) }
+func (m *UserUsage) Unmarshal(dAtA []byte) error                      { return json.Unmarshal(dAtA, m) }
+func (m *UserUsageResponse) Unmarshal(dAtA []byte) error              { return json.Unmarshal(dAtA, m) }
+func (m *SnapshotSessionRequest) Unmarshal(dAtA []byte) error         { return json.Unmarshal(dAtA, m) }
+func (m *SnapshotSessionResponse) Unmarshal(dAtA []byte) error        { return json.Unmarshal(dAtA, m) }
+func (m *ProfileRequest) Unmarshal(dAtA []byte) error                 { return json.Unmarshal(dAtA, m) }
+func (m *ProfileResponse) Unmarshal(dAtA []byte) error                { return json.Unmarshal(dAtA, m) }
 func (m *StatusResponse) Unmarshal(dAtA []byte) error                 { return json.Unmarshal(dAtA, m) }
 func (m *AuthEnableRequest) Unmarshal(dAtA []byte) error              { return json.Unmarshal(dAtA, m) }
 func (m *AuthDisableRequest) Unmarshal(dAtA []byte) error             { return json.Unmarshal(dAtA, m) }
@@ -5135,6 +7182,12 @@ func (m *AuthRoleGrantPermissionResponse) Unmarshal(dAtA []byte) error {
 func (m *AuthRoleRevokePermissionResponse) Unmarshal(dAtA []byte) error {
 	return json.Unmarshal(dAtA, m)
 }
+func (m *AuthDenialsRequest) Unmarshal(dAtA []byte) error  { return json.Unmarshal(dAtA, m) }
+func (m *AuthDenial) Unmarshal(dAtA []byte) error          { return json.Unmarshal(dAtA, m) }
+func (m *AuthDenialsResponse) Unmarshal(dAtA []byte) error { return json.Unmarshal(dAtA, m) }
+func (m *LeaseWatchRequest) Unmarshal(dAtA []byte) error   { return json.Unmarshal(dAtA, m) }
+func (m *LeaseEvent) Unmarshal(dAtA []byte) error          { return json.Unmarshal(dAtA, m) }
+func (m *LeaseWatchResponse) Unmarshal(dAtA []byte) error  { return json.Unmarshal(dAtA, m) }
 
 type alarmMember struct {
 	MemberID uint64 `protobuf:"varint,1,opt,name=memberID,proto3" json:"memberID,omitempty"`
@@ -5150,6 +7203,14 @@ func (m *AlarmMember) Marshal() (dAtA []byte, err error) {
 		a.Alarm = "NOSPACE"
 	case 2:
 		a.Alarm = "CORRUPT"
+	case 3:
+		a.Alarm = "UNREACHABLE"
+	case 4:
+		a.Alarm = "TOPOLOGY"
+	case 5:
+		a.Alarm = "BACKUP"
+	case 6:
+		a.Alarm = "CLOCK_SKEW"
 	}
 
 	return json.Marshal(&a)
@@ -5167,6 +7228,14 @@ func (m *AlarmMember) Unmarshal(dAtA []byte) error {
 			m.Alarm = 1
 		case "CORRUPT":
 			m.Alarm = 2
+		case "UNREACHABLE":
+			m.Alarm = 3
+		case "TOPOLOGY":
+			m.Alarm = 4
+		case "BACKUP":
+			m.Alarm = 5
+		case "CLOCK_SKEW":
+			m.Alarm = 6
 		}
 	}
 	return err
@@ -0,0 +1,115 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package jsonpath implements the subset of JSONPath needed to select a single
+// element of a JSON document: the root "$", member access by ".name" or
+// "['name']" and array access by "[index]".
+package jsonpath
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Path is a parsed JSONPath expression.
+type Path struct {
+	expr  string
+	steps []step
+}
+
+// step is a member name, or an array index if name is empty.
+type step struct {
+	name  string
+	index int
+}
+
+// Parse parses expr. The leading "$" is optional, "status.phase" is the same
+// as "$.status.phase".
+func Parse(expr string) (*Path, error) {
+	if expr == "" {
+		return nil, fmt.Errorf("jsonpath: empty expression")
+	}
+	p := &Path{expr: expr}
+	s := strings.TrimPrefix(expr, "$")
+	if s != expr && s != "" && s[0] != '.' && s[0] != '[' {
+		return nil, fmt.Errorf("jsonpath: unexpected %q after $ in %q", s[0], expr)
+	}
+	if s == expr && s != "" && s[0] != '[' {
+		s = "." + s
+	}
+	for len(s) > 0 {
+		switch s[0] {
+		case '.':
+			i := strings.IndexAny(s[1:], ".[")
+			if i < 0 {
+				i = len(s) - 1
+			}
+			name := s[1 : i+1]
+			if name == "" {
+				return nil, fmt.Errorf("jsonpath: empty member name in %q", expr)
+			}
+			p.steps = append(p.steps, step{name: name})
+			s = s[i+1:]
+		case '[':
+			end := strings.IndexByte(s, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("jsonpath: unterminated [ in %q", expr)
+			}
+			in := s[1:end]
+			if len(in) >= 2 && (in[0] == '\'' || in[0] == '"') && in[len(in)-1] == in[0] {
+				if len(in) == 2 {
+					return nil, fmt.Errorf("jsonpath: empty member name in %q", expr)
+				}
+				p.steps = append(p.steps, step{name: in[1 : len(in)-1]})
+			} else {
+				idx, err := strconv.Atoi(in)
+				if err != nil || idx < 0 {
+					return nil, fmt.Errorf("jsonpath: invalid index %q in %q", in, expr)
+				}
+				p.steps = append(p.steps, step{index: idx})
+			}
+			s = s[end+1:]
+		default:
+			return nil, fmt.Errorf("jsonpath: unexpected %q in %q", s[0], expr)
+		}
+	}
+	return p, nil
+}
+
+// String returns the expression the path was parsed from.
+func (p *Path) String() string { return p.expr }
+
+// Lookup returns the element selected by the path in v, a document decoded by
+// encoding/json into interface{}. ok is false if the element does not exist.
+func (p *Path) Lookup(v interface{}) (interface{}, bool) {
+	for _, st := range p.steps {
+		if st.name != "" {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if v, ok = m[st.name]; !ok {
+				return nil, false
+			}
+			continue
+		}
+		a, ok := v.([]interface{})
+		if !ok || st.index >= len(a) {
+			return nil, false
+		}
+		v = a[st.index]
+	}
+	return v, true
+}
@@ -0,0 +1,156 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// natsSink publishes each batch as JSON to a NATS subject using the NATS
+// text protocol. A PING/PONG round trip after PUB confirms that the server
+// has processed the message.
+type natsSink struct {
+	addr    string
+	subject string
+	connect []byte
+
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func newNATSSink(cfg SinkConfig) (Sink, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "nats" {
+		return nil, fmt.Errorf("notify: sink %q: nats url must use the nats:// scheme", cfg.Name)
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	opts := map[string]interface{}{"verbose": false, "pedantic": false, "name": "etcd-notify"}
+	if u.User != nil {
+		opts["user"] = u.User.Username()
+		if p, ok := u.User.Password(); ok {
+			opts["pass"] = p
+		}
+	}
+	connect, err := json.Marshal(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &natsSink{addr: addr, subject: cfg.topic(), connect: connect}, nil
+}
+
+func (n *natsSink) Send(ctx context.Context, b Batch) error {
+	payload, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err = n.send(ctx, payload); err != nil {
+		n.closeConn()
+	}
+	return err
+}
+
+func (n *natsSink) send(ctx context.Context, payload []byte) error {
+	if n.conn == nil {
+		if err := n.dial(ctx); err != nil {
+			return err
+		}
+	}
+	if dl, ok := ctx.Deadline(); ok {
+		n.conn.SetDeadline(dl)
+	} else {
+		n.conn.SetDeadline(time.Time{})
+	}
+	msg := fmt.Sprintf("PUB %s %d\r\n%s\r\nPING\r\n", n.subject, len(payload), payload)
+	if _, err := n.conn.Write([]byte(msg)); err != nil {
+		return err
+	}
+	return n.waitPong()
+}
+
+func (n *natsSink) dial(ctx context.Context) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", n.addr)
+	if err != nil {
+		return err
+	}
+	if dl, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(dl)
+	}
+	n.conn, n.r = conn, bufio.NewReader(conn)
+	// 服务端先发送 INFO
+	line, err := n.r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO") {
+		return fmt.Errorf("notify: unexpected nats greeting %q", strings.TrimSpace(line))
+	}
+	if _, err = fmt.Fprintf(conn, "CONNECT %s\r\nPING\r\n", n.connect); err != nil {
+		return err
+	}
+	return n.waitPong()
+}
+
+func (n *natsSink) waitPong() error {
+	for {
+		line, err := n.r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err = n.conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("notify: nats error: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+		// 忽略 +OK 和 INFO
+	}
+}
+
+func (n *natsSink) closeConn() {
+	if n.conn != nil {
+		n.conn.Close()
+		n.conn, n.r = nil, nil
+	}
+}
+
+func (n *natsSink) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.closeConn()
+	return nil
+}
@@ -0,0 +1,192 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package notify delivers committed key changes to external sinks such as
+// webhooks or message brokers.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	SinkTypeWebhook = "webhook"
+	SinkTypeNATS    = "nats"
+
+	// DefaultTimeout bounds a single delivery attempt.
+	DefaultTimeout = 10 * time.Second
+)
+
+// SinkConfig configures one notification sink.
+type SinkConfig struct {
+	// Name identifies the sink; the delivery cursor is persisted under it.
+	Name string `json:"name"`
+	// Prefix selects the keys whose changes are published.
+	Prefix string `json:"prefix"`
+	// Type is the sink type, e.g. "webhook" or "nats".
+	Type string `json:"type"`
+	// URL is the address of the sink.
+	URL string `json:"url"`
+	// Topic is the subject or topic for broker sinks; defaults to the sink name.
+	Topic string `json:"topic,omitempty"`
+	// Timeout bounds a single delivery attempt.
+	Timeout time.Duration `json:"timeout,omitempty"`
+}
+
+// Event is a single committed change.
+type Event struct {
+	Type           string `json:"type"` // "PUT" or "DELETE"
+	Key            string `json:"key"`
+	Value          string `json:"value,omitempty"`
+	CreateRevision int64  `json:"create-revision,omitempty"`
+	ModRevision    int64  `json:"mod-revision"`
+	Version        int64  `json:"version,omitempty"`
+	Lease          int64  `json:"lease,omitempty"`
+}
+
+// Batch is the unit of delivery. Batches of a sink are delivered in
+// revision order; a batch may be delivered more than once.
+type Batch struct {
+	Sink   string  `json:"sink"`
+	Prefix string  `json:"prefix"`
+	Events []Event `json:"events"`
+	// Revision is the revision of the last event in the batch.
+	Revision int64 `json:"revision"`
+}
+
+// Sink publishes batches to an external system. Send must only return nil
+// once the batch has been accepted by the sink.
+type Sink interface {
+	Send(ctx context.Context, b Batch) error
+	Close() error
+}
+
+// SinkFactory creates a sink from its configuration.
+type SinkFactory func(cfg SinkConfig) (Sink, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = map[string]SinkFactory{
+		SinkTypeWebhook: newWebhookSink,
+		SinkTypeNATS:    newNATSSink,
+	}
+)
+
+// RegisterSinkType registers a factory for a sink type. It allows embedding
+// applications to provide sinks for other brokers.
+func RegisterSinkType(typ string, f SinkFactory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	factories[typ] = f
+}
+
+// New creates the sink described by cfg.
+func New(cfg SinkConfig) (Sink, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	factoriesMu.RLock()
+	f := factories[cfg.Type]
+	factoriesMu.RUnlock()
+	return f(cfg)
+}
+
+// Validate checks the configuration and that its sink type is available.
+func (cfg SinkConfig) Validate() error {
+	if cfg.Name == "" {
+		return fmt.Errorf("notify: sink name is required")
+	}
+	if cfg.URL == "" {
+		return fmt.Errorf("notify: sink %q: url is required", cfg.Name)
+	}
+	factoriesMu.RLock()
+	_, ok := factories[cfg.Type]
+	factoriesMu.RUnlock()
+	if !ok {
+		return fmt.Errorf("notify: sink %q: unknown type %q", cfg.Name, cfg.Type)
+	}
+	return nil
+}
+
+// ValidateSinks validates every sink and checks that names are unique.
+func ValidateSinks(cfgs []SinkConfig) error {
+	names := make(map[string]struct{}, len(cfgs))
+	for _, c := range cfgs {
+		if err := c.Validate(); err != nil {
+			return err
+		}
+		if _, ok := names[c.Name]; ok {
+			return fmt.Errorf("notify: duplicate sink name %q", c.Name)
+		}
+		names[c.Name] = struct{}{}
+	}
+	return nil
+}
+
+// ParseSinkConfig parses a sink given as semicolon separated key=value
+// pairs, e.g. "name=orders;type=webhook;url=http://hook:8080/etcd;prefix=/orders/".
+func ParseSinkConfig(s string) (SinkConfig, error) {
+	var cfg SinkConfig
+	for _, kv := range strings.Split(s, ";") {
+		kv = strings.TrimSpace(kv)
+		if kv == "" {
+			continue
+		}
+		i := strings.Index(kv, "=")
+		if i < 0 {
+			return cfg, fmt.Errorf("notify: invalid sink option %q, expected key=value", kv)
+		}
+		k, v := kv[:i], kv[i+1:]
+		switch k {
+		case "name":
+			cfg.Name = v
+		case "prefix":
+			cfg.Prefix = v
+		case "type":
+			cfg.Type = v
+		case "url":
+			cfg.URL = v
+		case "topic":
+			cfg.Topic = v
+		case "timeout":
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return cfg, fmt.Errorf("notify: invalid sink timeout %q: %v", v, err)
+			}
+			cfg.Timeout = d
+		default:
+			return cfg, fmt.Errorf("notify: unknown sink option %q", k)
+		}
+	}
+	return cfg, nil
+}
+
+// DeliveryTimeout returns the timeout of a single delivery attempt.
+func (cfg SinkConfig) DeliveryTimeout() time.Duration {
+	if cfg.Timeout > 0 {
+		return cfg.Timeout
+	}
+	return DefaultTimeout
+}
+
+func (cfg SinkConfig) topic() string {
+	if cfg.Topic != "" {
+		return cfg.Topic
+	}
+	return cfg.Name
+}
@@ -0,0 +1,124 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package topology analyzes how voting members are spread over failure
+// domains, such as zones or racks, described by member labels.
+package topology
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Member is a cluster member with the failure domain it belongs to.
+type Member struct {
+	ID        uint64
+	Name      string
+	IsLearner bool
+	// Domain is the value of the failure domain label; empty if the member
+	// has no such label.
+	Domain string
+}
+
+// Domain is the distribution of voting members in one failure domain.
+type Domain struct {
+	Name     string   `json:"name"`
+	Voters   []string `json:"voters"`
+	Learners []string `json:"learners,omitempty"`
+	// LosesQuorum is true if the failure of this domain alone loses quorum.
+	LosesQuorum bool `json:"loses-quorum"`
+}
+
+// Report is the result of Analyze.
+type Report struct {
+	Label  string `json:"label"`
+	Voters int    `json:"voters"`
+	Quorum int    `json:"quorum"`
+	// Domains is sorted by the number of voters, largest first. Voting
+	// members without the label are each counted as their own domain.
+	Domains []Domain `json:"domains"`
+	// Unlabeled lists the voting members without the label.
+	Unlabeled []string `json:"unlabeled,omitempty"`
+}
+
+// Labeled reports whether any voting member carries the label. Clusters
+// that do not use the label are not analyzed.
+func (r Report) Labeled() bool {
+	return len(r.Unlabeled) < r.Voters
+}
+
+// AtRisk returns the domains whose failure alone loses quorum.
+func (r Report) AtRisk() []string {
+	var ds []string
+	for _, d := range r.Domains {
+		if d.LosesQuorum {
+			ds = append(ds, d.Name)
+		}
+	}
+	return ds
+}
+
+// Safe reports whether quorum survives the failure of any single domain.
+func (r Report) Safe() bool {
+	return len(r.AtRisk()) == 0
+}
+
+// Analyze groups members by their domain and finds the domains that hold
+// too many voters to lose.
+func Analyze(label string, members []Member) Report {
+	r := Report{Label: label}
+	byName := make(map[string]*Domain)
+	for _, m := range members {
+		name := m.Name
+		if name == "" {
+			name = fmt.Sprintf("%x", m.ID)
+		}
+		domain := m.Domain
+		if domain == "" {
+			if m.IsLearner {
+				continue
+			}
+			r.Unlabeled = append(r.Unlabeled, name)
+			// 没有标签的成员按独立的域计算
+			domain = fmt.Sprintf("<%s>", name)
+		}
+		d, ok := byName[domain]
+		if !ok {
+			d = &Domain{Name: domain}
+			byName[domain] = d
+		}
+		if m.IsLearner {
+			d.Learners = append(d.Learners, name)
+			continue
+		}
+		d.Voters = append(d.Voters, name)
+		r.Voters++
+	}
+	r.Quorum = r.Voters/2 + 1
+
+	for _, d := range byName {
+		sort.Strings(d.Voters)
+		sort.Strings(d.Learners)
+		d.LosesQuorum = len(d.Voters) > 0 && r.Voters-len(d.Voters) < r.Quorum
+		r.Domains = append(r.Domains, *d)
+	}
+	sort.Strings(r.Unlabeled)
+	sort.Slice(r.Domains, func(i, j int) bool {
+		if len(r.Domains[i].Voters) != len(r.Domains[j].Voters) {
+			return len(r.Domains[i].Voters) > len(r.Domains[j].Voters)
+		}
+		return r.Domains[i].Name < r.Domains[j].Name
+	})
+	return r
+}
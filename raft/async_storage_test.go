@@ -0,0 +1,284 @@
+// Copyright 2021 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raft
+
+import (
+	"testing"
+
+	pb "github.com/ls-2018/etcd_cn/raft/raftpb"
+)
+
+// asyncNode is a RawNode in async storage write mode whose Readies are
+// persisted only when the test says so.
+type asyncNode struct {
+	rn      *RawNode
+	storage *MemoryStorage
+	// pending are the Readies accepted but not yet persisted.
+	pending []Ready
+}
+
+func newAsyncStorage(t *testing.T, voters ...uint64) *MemoryStorage {
+	s := NewMemoryStorage()
+	snap := pb.Snapshot{Metadata: pb.SnapshotMetadata{Index: 1, Term: 1, ConfState: pb.ConfState{Voters: voters}}}
+	if err := s.ApplySnapshot(snap); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func newAsyncNode(t *testing.T, id uint64, s *MemoryStorage) *asyncNode {
+	rn, err := NewRawNode(&Config{
+		ID:                 id,
+		ElectionTick:       10,
+		HeartbeatTick:      1,
+		Storage:            s,
+		MaxSizePerMsg:      noLimit,
+		MaxInflightMsgs:    256,
+		AsyncStorageWrites: true,
+		Logger:             discardLogger,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &asyncNode{rn: rn, storage: s}
+}
+
+// ready accepts the next Ready and returns the messages that may be sent
+// before it is persisted, i.e. the leader's messages.
+func (n *asyncNode) ready() []pb.Message {
+	if !n.rn.HasReady() {
+		return nil
+	}
+	rd := n.rn.Ready()
+	n.pending = append(n.pending, rd)
+	if n.rn.raft.state == StateLeader {
+		return rd.Messages
+	}
+	return nil
+}
+
+// persist persists all pending Readies in order, acknowledges them and
+// returns the messages held back until persistence.
+func (n *asyncNode) persist(t *testing.T) []pb.Message {
+	var msgs []pb.Message
+	for _, rd := range n.pending {
+		if !IsEmptySnap(rd.Snapshot) {
+			if err := n.storage.ApplySnapshot(rd.Snapshot); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !IsEmptyHardState(rd.HardState) {
+			if err := n.storage.SetHardState(rd.HardState); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := n.storage.Append(rd.Entries); err != nil {
+			t.Fatal(err)
+		}
+		n.rn.AdvanceStorage(rd)
+		for _, m := range rd.Messages {
+			if n.rn.raft.state != StateLeader || m.Type != pb.MsgApp {
+				msgs = append(msgs, m)
+			}
+		}
+	}
+	n.pending = nil
+	return msgs
+}
+
+type asyncNetwork struct {
+	nodes map[uint64]*asyncNode
+	// down drops every message to and from the member.
+	down map[uint64]bool
+	// sent records every message delivered, in order.
+	sent []pb.Message
+}
+
+func newAsyncNetwork(t *testing.T, ids ...uint64) *asyncNetwork {
+	nw := &asyncNetwork{nodes: make(map[uint64]*asyncNode), down: make(map[uint64]bool)}
+	for _, id := range ids {
+		nw.nodes[id] = newAsyncNode(t, id, newAsyncStorage(t, ids...))
+	}
+	return nw
+}
+
+func (nw *asyncNetwork) deliver(t *testing.T, msgs []pb.Message) {
+	for _, m := range msgs {
+		if nw.down[m.From] || nw.down[m.To] {
+			continue
+		}
+		nw.sent = append(nw.sent, m)
+		if err := nw.nodes[m.To].rn.Step(m); err != nil && err != ErrStepPeerNotFound {
+			t.Fatal(err)
+		}
+	}
+}
+
+// stabilize processes Readies until no member has anything left to do. The
+// members in hold never persist.
+func (nw *asyncNetwork) stabilize(t *testing.T, hold ...uint64) {
+	held := make(map[uint64]bool)
+	for _, id := range hold {
+		held[id] = true
+	}
+	for i := 0; i < 100; i++ {
+		progress := false
+		for id, n := range nw.nodes {
+			if nw.down[id] {
+				continue
+			}
+			if msgs := n.ready(); len(msgs) > 0 || len(n.pending) > 0 {
+				progress = true
+				nw.deliver(t, msgs)
+			}
+			if !held[id] && len(n.pending) > 0 {
+				nw.deliver(t, n.persist(t))
+			}
+		}
+		pending := false
+		for id, n := range nw.nodes {
+			if !nw.down[id] && !held[id] && n.rn.HasReady() {
+				pending = true
+			}
+		}
+		if !progress && !pending {
+			return
+		}
+	}
+}
+
+func TestAsyncStorageWritesSingleVoterCommitsAfterPersist(t *testing.T) {
+	nw := newAsyncNetwork(t, 1)
+	n := nw.nodes[1]
+	if err := n.rn.Campaign(); err != nil {
+		t.Fatal(err)
+	}
+	nw.stabilize(t)
+	if n.rn.raft.state != StateLeader {
+		t.Fatalf("state = %v, want leader", n.rn.raft.state)
+	}
+
+	if err := n.rn.Propose([]byte("foo")); err != nil {
+		t.Fatal(err)
+	}
+	idx := n.rn.raft.raftLog.lastIndex()
+	n.ready()
+	if c := n.rn.raft.raftLog.committed; c >= idx {
+		t.Fatalf("committed = %d before persisting %d", c, idx)
+	}
+	n.persist(t)
+	if c := n.rn.raft.raftLog.committed; c != idx {
+		t.Fatalf("committed = %d after persisting, want %d", c, idx)
+	}
+	rd := n.rn.Ready()
+	if len(rd.CommittedEntries) == 0 || rd.CommittedEntries[len(rd.CommittedEntries)-1].Index != idx {
+		t.Fatalf("committed entries = %v, want up to %d", rd.CommittedEntries, idx)
+	}
+}
+
+func TestAsyncStorageWritesLeaderDoesNotCountUnpersistedEntries(t *testing.T) {
+	nw := newAsyncNetwork(t, 1, 2, 3)
+	if err := nw.nodes[1].rn.Campaign(); err != nil {
+		t.Fatal(err)
+	}
+	nw.stabilize(t)
+	lead := nw.nodes[1]
+	if lead.rn.raft.state != StateLeader {
+		t.Fatalf("state = %v, want leader", lead.rn.raft.state)
+	}
+
+	// Member 3 is partitioned away, member 2 persists, the leader does not.
+	nw.down[3] = true
+	nw.sent = nil
+	if err := lead.rn.Propose([]byte("foo")); err != nil {
+		t.Fatal(err)
+	}
+	idx := lead.rn.raft.raftLog.lastIndex()
+	nw.stabilize(t, 1)
+
+	if m := nw.nodes[2].rn.raft.raftLog.lastIndex(); m != idx {
+		t.Fatalf("follower last index = %d, want %d", m, idx)
+	}
+	if c := lead.rn.raft.raftLog.committed; c >= idx {
+		t.Fatalf("leader committed = %d with only one persisted copy of %d", c, idx)
+	}
+	for _, m := range nw.sent {
+		if m.From == 1 && m.Commit >= idx {
+			t.Fatalf("leader sent commit %d before persisting %d: %+v", m.Commit, idx, m)
+		}
+	}
+
+	// Once the leader persists, it and member 2 form a quorum.
+	nw.stabilize(t)
+	if c := lead.rn.raft.raftLog.committed; c != idx {
+		t.Fatalf("leader committed = %d after persisting, want %d", c, idx)
+	}
+	if c := nw.nodes[2].rn.raft.raftLog.committed; c != idx {
+		t.Fatalf("follower committed = %d, want %d", c, idx)
+	}
+}
+
+func TestAsyncStorageWritesLeaderCrashBeforePersist(t *testing.T) {
+	nw := newAsyncNetwork(t, 1, 2, 3)
+	if err := nw.nodes[1].rn.Campaign(); err != nil {
+		t.Fatal(err)
+	}
+	nw.stabilize(t)
+
+	nw.down[3] = true
+	if err := nw.nodes[1].rn.Propose([]byte("foo")); err != nil {
+		t.Fatal(err)
+	}
+	idx := nw.nodes[1].rn.raft.raftLog.lastIndex()
+	nw.stabilize(t, 1)
+	if c := nw.nodes[2].rn.raft.raftLog.committed; c >= idx {
+		t.Fatalf("follower committed = %d before the leader persisted %d", c, idx)
+	}
+
+	// The leader crashes before persisting and restarts without the entry.
+	restarted := newAsyncNode(t, 1, nw.nodes[1].storage)
+	if li := restarted.rn.raft.raftLog.lastIndex(); li >= idx {
+		t.Fatalf("restarted last index = %d, want < %d", li, idx)
+	}
+	nw.nodes[1] = restarted
+	nw.down[3] = false
+	nw.down[2] = true
+
+	// Member 3 wins with the restarted member's vote and overwrites index
+	// idx on member 2 later; that is only safe because it never committed.
+	if err := nw.nodes[3].rn.Campaign(); err != nil {
+		t.Fatal(err)
+	}
+	nw.stabilize(t)
+	if nw.nodes[3].rn.raft.state != StateLeader {
+		t.Fatalf("state = %v, want leader", nw.nodes[3].rn.raft.state)
+	}
+	nw.down[2] = false
+	if err := nw.nodes[3].rn.Propose([]byte("bar")); err != nil {
+		t.Fatal(err)
+	}
+	// The probe sent while member 2 was down is resumed by a heartbeat.
+	nw.nodes[3].rn.Tick()
+	nw.stabilize(t)
+	for id, n := range nw.nodes {
+		ents, err := n.rn.raft.raftLog.entries(idx, noLimit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ents) == 0 || string(ents[0].Data) == "foo" {
+			t.Fatalf("member %d: entry %d = %v, want it overwritten", id, idx, ents)
+		}
+	}
+}
@@ -86,9 +86,9 @@ func RestartNode(c *Config) RaftNodeInterFace {
 // 的数据都是来源于raft.
 func newReady(r *raft, prevSoftSt *SoftState, prevHardSt pb.HardState) Ready {
 	rd := Ready{
-		Entries:          r.raftLog.unstableEntries(), // 还没有落盘的,需要调用方落盘
-		CommittedEntries: r.raftLog.nextEnts(),        // 已经commit待apply的日志,交给上层应用
-		Messages:         r.msgs,                      // 封装好的需要通过网络发送都其他节点的消息
+		Entries:          r.raftLog.nextUnstableEnts(),              // 还没有落盘的,需要调用方落盘
+		CommittedEntries: r.raftLog.nextEnts(!r.asyncStorageWrites), // 已经commit待apply的日志,交给上层应用
+		Messages:         r.msgs,                                    // 封装好的需要通过网络发送都其他节点的消息
 		SoftState:        nil,
 		HardState:        pb.HardState{},
 		Snapshot:         pb.Snapshot{},
@@ -104,8 +104,8 @@ func newReady(r *raft, prevSoftSt *SoftState, prevHardSt pb.HardState) Ready {
 		rd.HardState = hardSt
 	}
 	// 判断是不是收到snapshot
-	if r.raftLog.unstable.snapshot != nil {
-		rd.Snapshot = *r.raftLog.unstable.snapshot
+	if snap := r.raftLog.unstable.nextSnapshot(); snap != nil {
+		rd.Snapshot = *snap
 	}
 	if len(r.readStates) != 0 {
 		rd.ReadStates = r.readStates
@@ -124,6 +124,7 @@ type localNode struct {
 	confstatec chan pb.ConfState    // 将配置变更后的管道
 	readyc     chan Ready           // 已经准备好apply的信息队列,通知使用者
 	advancec   chan struct{}        // 每次apply好了以后往这个队列里塞个空对象.通知raft可以继续准备Ready消息.
+	storagec   chan Ready           // 异步写模式下,使用者持久化一个Ready后通过这里确认
 	tickc      chan struct{}        // tick信息队列,用于调用心跳
 	done       chan struct{}        //
 	stop       chan struct{}        // 为Stop接口实现的,应该还好理解
@@ -138,8 +139,9 @@ func newLocalNode(rn *RawNode) localNode {
 		propc:      make(chan msgWithResult), // 接收网络层MsgProp类型消息
 		recvc:      make(chan pb.Message),    // 接收网络层除MsgProp类型以外的消息
 		confstatec: make(chan pb.ConfState),
-		readyc:     make(chan Ready),         // 向上层返回 ready
-		advancec:   make(chan struct{}),      // 上层处理往ready后返回给raft的消息
+		readyc:     make(chan Ready),    // 向上层返回 ready
+		advancec:   make(chan struct{}), // 上层处理往ready后返回给raft的消息
+		storagec:   make(chan Ready),
 		tickc:      make(chan struct{}, 128), // 管理超时的管道,繁忙时可以处理之前的事件
 		done:       make(chan struct{}),
 		stop:       make(chan struct{}),
@@ -170,11 +172,12 @@ func (n *localNode) run() {
 	lead := None
 	for {
 		// 这一段 主要是为了 只有只有客户端通知了了,才能继续往readyc放新的
-		if advancec != nil { // 开始时是nil
-			readyc = nil
-		} else if n.rn.HasReady() { // 判断是否有Ready数据:待发送的数据
+		// 异步写模式下advancec始终是nil,上一个Ready交出后就可以计算下一个
+		if advancec == nil && n.rn.HasReady() { // 判断是否有Ready数据:待发送的数据
 			rd = n.rn.readyWithoutAccept() // 计算软硬状态变化;返回ready结构体
 			readyc = n.readyc              // 下边有放入数据的
+		} else {
+			readyc = nil
 		}
 		// 初始时都是0,   lead发生变化
 		if lead != r.lead {
@@ -244,12 +247,16 @@ func (n *localNode) run() {
 		case <-n.tickc: // 超时时间到,包括心跳超时和选举超时等
 			n.rn.Tick()
 		case readyc <- rd: // 数据放入ready channel中,等待上层应用处理
-			n.rn.acceptReady(rd)  // 告诉raft,ready数据已被接收
-			advancec = n.advancec // 赋值Advance channel等待Ready处理完成的消息
+			n.rn.acceptReady(rd) // 告诉raft,ready数据已被接收
+			if !r.asyncStorageWrites {
+				advancec = n.advancec // 赋值Advance channel等待Ready处理完成的消息
+			}
 		case <-advancec: // 使用者处理完Ready数据后,调用了Advance()
 			n.rn.Advance(rd) // 通知RawNode  应用程序已经应用并保存了最后一个Ready结果的进度.
 			rd = Ready{}     // 重置数据
 			advancec = nil
+		case srd := <-n.storagec: // 异步写模式下,使用者确认了一个Ready已经持久化
+			n.rn.AdvanceStorage(srd)
 		case c := <-n.status: // 收取了获取节点状态的信号
 			c <- getStatus(r)
 		case <-n.stop: // 收到停止信号
@@ -301,6 +308,13 @@ func (n *localNode) Advance() {
 	}
 }
 
+func (n *localNode) AdvanceStorage(rd Ready) {
+	select {
+	case n.storagec <- rd:
+	case <-n.done:
+	}
+}
+
 func (n *localNode) Status() Status {
 	c := make(chan Status)
 	select {
@@ -15,6 +15,7 @@ type RaftNodeInterFace interface {
 	Step(ctx context.Context, msg pb.Message) error                  // 处理msg的函数
 	Ready() <-chan Ready                                             // 已经commit,准备apply的数据通过这里通知
 	Advance()                                                        // ready消息处理完后,发送一个通知消息;当处理完这些消息后,必须调用,不然raft会堵塞在这里
+	AdvanceStorage(rd Ready)                                         // 异步写模式下,rd的HardState、Entries、Snapshot持久化后调用,代替Advance
 	ApplyConfChange(cc pb.ConfChangeI) *pb.ConfState                 // 应用集群变化到状态机
 	TransferLeadership(ctx context.Context, lead, transferee uint64) // 将Leader转给transferee.
 	Status() Status                                                  // 返回 raft state machine当前状态.
@@ -100,11 +100,30 @@ func (l *raftLog) unstableEntries() []pb.Entry {
 	return l.unstable.entries
 }
 
+// nextUnstableEnts 返回还没有交给使用者写入的日志
+func (l *raftLog) nextUnstableEnts() []pb.Entry {
+	return l.unstable.nextEntries()
+}
+
+// hasNextUnstableSnapshot 判断是否有还没有交给使用者写入的快照
+func (l *raftLog) hasNextUnstableSnapshot() bool {
+	return l.unstable.nextSnapshot() != nil
+}
+
+// maxAppliableIndex 可以交给应用的最大索引;allowUnstable 为false时只交出已经持久化的日志
+func (l *raftLog) maxAppliableIndex(allowUnstable bool) uint64 {
+	hi := l.committed
+	if !allowUnstable {
+		hi = min(hi, l.unstable.offset-1)
+	}
+	return hi
+}
+
 // nextEnts 获取[applied+1: committed+1] 的所有日志
-func (l *raftLog) nextEnts() (ents []pb.Entry) {
+func (l *raftLog) nextEnts(allowUnstable bool) (ents []pb.Entry) {
 	off := max(l.applied+1, l.firstIndex())
-	if l.committed+1 > off {
-		ents, err := l.slice(off, l.committed+1, l.maxNextEntsSize)
+	if hi := l.maxAppliableIndex(allowUnstable); hi+1 > off {
+		ents, err := l.slice(off, hi+1, l.maxNextEntsSize)
 		if err != nil {
 			l.logger.Panicf("在获取未应用的条目时出现意外错误 (%v)", err)
 		}
@@ -114,9 +133,9 @@ func (l *raftLog) nextEnts() (ents []pb.Entry) {
 }
 
 // hasNextEnts 判断是否有可应用的日志
-func (l *raftLog) hasNextEnts() bool {
+func (l *raftLog) hasNextEnts(allowUnstable bool) bool {
 	off := max(l.applied+1, l.firstIndex())
-	return l.committed+1 > off
+	return l.maxAppliableIndex(allowUnstable)+1 > off
 }
 
 // hasPendingSnapshot 判断是不是正在处理快照
@@ -212,6 +231,7 @@ func newLogWithSize(storage Storage, logger Logger, maxNextEntsSize uint64) *raf
 	// 这个代码印证了前面提到了,当unstable没有不可靠日志的时候,unstable.offset的值就是
 	// 未来的第一个不可靠日志的索引.
 	log.unstable.offset = lastIndex + 1 // 保存了尚未持久化的日志条目或快照
+	log.unstable.offsetInProgress = lastIndex + 1
 	log.unstable.logger = logger
 	//   -------------------------------------
 	//    commit|apply      storage
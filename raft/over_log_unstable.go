@@ -26,7 +26,12 @@ type unstable struct {
 	snapshot *pb.Snapshot // 快照数据,该快照数据也是未写入Storage中的.
 	entries  []pb.Entry   // 用于保存未写入Storage中的Entry记录.刚生成的日志,没确认的
 	offset   uint64       // entries数组中的第一条数据在raft日志中的索引
-	logger   Logger
+	// offsetInProgress 之前的日志已经交给使用者写入但还没有确认,异步写模式下不会再次通过Ready交出;
+	// 同步模式下始终等于offset
+	offsetInProgress uint64
+	// snapshotInProgress 快照已经交给使用者写入但还没有确认
+	snapshotInProgress bool
+	logger             Logger
 }
 
 // maybeFirstIndex 返回unstable数据的第一条数据索引
@@ -85,11 +90,40 @@ func (u *unstable) shrinkEntriesArray() {
 	}
 }
 
+// nextEntries 返回还没有交给使用者写入的日志
+func (u *unstable) nextEntries() []pb.Entry {
+	inProgress := int(u.offsetInProgress - u.offset)
+	if len(u.entries) == inProgress {
+		return nil
+	}
+	return u.entries[inProgress:]
+}
+
+// nextSnapshot 返回还没有交给使用者写入的快照
+func (u *unstable) nextSnapshot() *pb.Snapshot {
+	if u.snapshot == nil || u.snapshotInProgress {
+		return nil
+	}
+	return u.snapshot
+}
+
+// acceptInProgress 把当前所有的日志和快照标记为正在写入,异步写模式下Ready被接收时调用
+func (u *unstable) acceptInProgress() {
+	if len(u.entries) > 0 {
+		u.offsetInProgress = u.entries[len(u.entries)-1].Index + 1
+	}
+	if u.snapshot != nil {
+		u.snapshotInProgress = true
+	}
+}
+
 // 这个函数是接收到leader发来的快照后调用的,暂时存入unstable等待使用者持久化.
 func (u *unstable) restore(s pb.Snapshot) {
 	u.offset = s.Metadata.Index + 1
+	u.offsetInProgress = u.offset
 	u.entries = nil
 	u.snapshot = &s
+	u.snapshotInProgress = false
 }
 
 // 截断和追加
@@ -107,12 +141,15 @@ func (u *unstable) truncateAndAppend(ents []pb.Entry) {
 	case after <= u.offset:
 		u.logger.Infof("直接用待追加的Entry记录替换当前的entries字段,并支新offset %d", after)
 		u.offset = after
+		u.offsetInProgress = after
 		u.entries = ents
 	default:
 		// 有重叠的日志,那就用最新的日志覆盖老日志,覆盖追加
 		u.logger.Infof("截断在after之后数据 %d", after)
 		u.entries = append([]pb.Entry{}, u.slice(u.offset, after)...)
 		u.entries = append(u.entries, ents...)
+		// 被截断的日志即使正在写入,也要重新交给使用者
+		u.offsetInProgress = min(u.offsetInProgress, after)
 	}
 }
 
@@ -145,6 +182,7 @@ func (u *unstable) stableTo(i, t uint64) {
 		// 指定索引位之前的Entry记录都已经完成持久化,则将其之前的全部Entry记录删除
 		u.entries = u.entries[i+1-u.offset:]
 		u.offset = i + 1
+		u.offsetInProgress = max(u.offsetInProgress, u.offset)
 		// 随着多次追加日志和截断日志的操作unstable.entires底层的数组会越来越大,
 		// shrinkEntriesArray方法会在底层数组长度超过实际占用的两倍时,对底层数据进行缩减
 		u.shrinkEntriesArray()
@@ -155,5 +193,6 @@ func (u *unstable) stableTo(i, t uint64) {
 func (u *unstable) stableSnapTo(i uint64) {
 	if u.snapshot != nil && u.snapshot.Metadata.Index == i {
 		u.snapshot = nil
+		u.snapshotInProgress = false
 	}
 }
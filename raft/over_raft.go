@@ -109,6 +109,8 @@ type raft struct {
 	electionTimeout           int                     // 选举超时时间,当electionE!apsed 宇段值到达该值时,就会触发新一轮的选举.
 	randomizedElectionTimeout int                     // 随机选举超时
 	disableProposalForwarding bool                    // 禁止将请求转发到leader,默认FALSE
+	campaignDisabled          func() bool             // 返回true时本节点不参与竞选
+	asyncStorageWrites        bool                    // 异步写存储,Ready交出后不等待Advance
 	tick                      func()                  // 逻辑计数器推进函数, 由 r.ticker = time.NewTicker(r.heartbeat) ;触发该函数的执行  r.start
 	step                      stepFunc                // 阶段函数、在那个角色就执行那个角色的函数、处理接收到的消息
 	logger                    Logger
@@ -124,6 +126,12 @@ type raft struct {
 // 通知RawNode 应用程序已经应用并保存了最后一个Ready结果的进度.
 func (r *raft) advance(rd Ready) {
 	// 此时这些数据,应用到了wal,与应用程序状态机
+	r.advanceApplied(rd)
+	r.advanceStorage(rd)
+}
+
+// advanceApplied 已提交的日志已经交给应用;异步写模式下Ready被接收时就调用
+func (r *raft) advanceApplied(rd Ready) {
 	r.reduceUncommittedSize(rd.CommittedEntries) // 日志committed以后应该从这里扣除
 
 	// 如果应用了条目(或快照),则将游标更新为下一个Ready.请注意,如果当前的HardState包含一个新的Commit索引,
@@ -147,10 +155,17 @@ func (r *raft) advance(rd Ready) {
 			r.logger.Infof("启动自动过渡,脱离joint配置 %s", r.prstrack.Config)
 		}
 	}
+}
+
+// advanceStorage Ready中的日志和快照已经持久化
+func (r *raft) advanceStorage(rd Ready) {
 	// 让unstable 更新数据
 	if len(rd.Entries) > 0 {
 		e := rd.Entries[len(rd.Entries)-1]
 		r.raftLog.unstable.stableTo(e.Index, e.Term)
+		if r.asyncStorageWrites {
+			r.maybeAckSelfAppend(e.Index, e.Term)
+		}
 	}
 	// 更新快照数据
 	if !IsEmptySnap(rd.Snapshot) {
@@ -158,6 +173,22 @@ func (r *raft) advance(rd Ready) {
 	}
 }
 
+// maybeAckSelfAppend 异步写模式下leader的日志落盘后更新自己的进度,相当于收到了自己的MsgAppResp;
+// 落盘的日志已经被截断(任期不匹配)时忽略
+func (r *raft) maybeAckSelfAppend(index, term uint64) {
+	if r.state != StateLeader || !r.raftLog.matchTerm(index, term) {
+		return
+	}
+	pr := r.prstrack.Progress[r.id]
+	if pr == nil || !pr.MaybeUpdate(index) {
+		return
+	}
+	if r.maybeCommit() {
+		releasePendingReadIndexMessages(r)
+		r.bcastAppend()
+	}
+}
+
 // 检测是否有未应用的EntryConfChange记录
 func numOfPendingConf(ents []pb.Entry) int {
 	n := 0
@@ -250,7 +281,13 @@ type Config struct {
 	PreVote                   bool           // PreVote 防止分区服务器[term会很大]重新加入集群时出现中断   是否启用PreVote
 	ReadOnlyOption            ReadOnlyOption // 必须是enabled if ReadOnlyOption is ReadOnlyLeaseBased.
 	DisableProposalForwarding bool           // 禁止将请求转发到leader,默认FALSE
-	Logger                    Logger
+	CampaignDisabled          func() bool    // 返回true时本节点不发起竞选,也不响应leader转移,为nil时不限制
+	// AsyncStorageWrites 为true时,localNode交出一个Ready后不等待Advance就可以交出下一个,
+	// 日志和快照的写入与Ready的处理流水线化.使用者必须按顺序持久化每个Ready的HardState、Entries
+	// 和Snapshot,然后调用AdvanceStorage确认;CommittedEntries只包含已经确认持久化的日志,
+	// 不需要也不能调用Advance.
+	AsyncStorageWrites bool
+	Logger             Logger
 }
 
 // OK
@@ -322,6 +359,8 @@ func newRaft(c *Config) *raft {
 		preVote:                   c.PreVote,                     // PreVote 是否启用PreVote
 		readOnly:                  newReadOnly(c.ReadOnlyOption), // etcd/etcdserver/over_raft.go:469    默认值0 ReadOnlySafe
 		disableProposalForwarding: c.DisableProposalForwarding,   // 禁止将请求转发到leader,默认FALSE
+		campaignDisabled:          c.CampaignDisabled,
+		asyncStorageWrites:        c.AsyncStorageWrites,
 	}
 	// todo 没看懂
 	// -----------------------
@@ -596,9 +635,12 @@ func (r *raft) appendEntry(es ...pb.Entry) (accepted bool) {
 	li = r.raftLog.append(es...)
 	// 5. 检查并更新日志进度
 	// raft的leader节点保存了所有节点的日志同步进度,这里面也包括它自己
-	r.prstrack.Progress[r.id].MaybeUpdate(li)
-	// 6. 判断是否做一次commit
-	r.maybeCommit()
+	// 异步写模式下日志还没有落盘,leader自己的进度要等advanceStorage确认后再更新,否则未落盘的日志会被计入提交的多数派
+	if !r.asyncStorageWrites {
+		r.prstrack.Progress[r.id].MaybeUpdate(li)
+		// 6. 判断是否做一次commit
+		r.maybeCommit()
+	}
 	return true
 }
 
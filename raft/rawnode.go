@@ -114,6 +114,13 @@ func (rn *RawNode) Step(m pb.Message) error {
 	return ErrStepPeerNotFound
 }
 
+// Ready 返回应用需要处理的状态变化,处理完成后必须调用 Advance
+func (rn *RawNode) Ready() Ready {
+	rd := rn.readyWithoutAccept()
+	rn.acceptReady(rd)
+	return rd
+}
+
 //   计算状态变化;返回ready结构体
 func (rn *RawNode) readyWithoutAccept() Ready {
 	return newReady(rn.raft, rn.prevSoftSt, rn.prevHardSt) // 计算状态变化
@@ -129,6 +136,14 @@ func (rn *RawNode) acceptReady(rd Ready) {
 		rn.raft.readStates = nil
 	}
 	rn.raft.msgs = nil
+	if rn.raft.asyncStorageWrites {
+		// 不会再调用Advance:交出的日志和快照标记为正在写入,已提交的日志视为已交给应用
+		if !IsEmptyHardState(rd.HardState) {
+			rn.prevHardSt = rd.HardState
+		}
+		rn.raft.raftLog.unstable.acceptInProgress()
+		rn.raft.advanceApplied(rd)
+	}
 }
 
 // HasReady 检查是否有ready消息未处理 与 Ready.containsUpdates().保持一致
@@ -140,10 +155,10 @@ func (rn *RawNode) HasReady() bool {
 	if hardSt := r.hardState(); !IsEmptyHardState(hardSt) && !isHardStateEqual(hardSt, rn.prevHardSt) {
 		return true
 	}
-	if r.raftLog.hasPendingSnapshot() {
+	if r.raftLog.hasNextUnstableSnapshot() {
 		return true
 	}
-	if len(r.msgs) > 0 || len(r.raftLog.unstableEntries()) > 0 || r.raftLog.hasNextEnts() {
+	if len(r.msgs) > 0 || len(r.raftLog.nextUnstableEnts()) > 0 || r.raftLog.hasNextEnts(!r.asyncStorageWrites) {
 		return true
 	}
 	if len(r.readStates) != 0 {
@@ -160,6 +175,11 @@ func (rn *RawNode) Advance(rd Ready) {
 	rn.raft.advance(rd)
 }
 
+// AdvanceStorage 异步写模式下通知RawNode,rd中的HardState、Entries和Snapshot已经持久化.
+func (rn *RawNode) AdvanceStorage(rd Ready) {
+	rn.raft.advanceStorage(rd)
+}
+
 // Status returns the current status of the given group. This allocates, see
 // BasicStatus and WithProgress for allocation-friendlier choices.
 func (rn *RawNode) Status() Status {
@@ -534,8 +534,9 @@ func stepFollower(r *raft, m pb.Message) error {
 // roleUp 是否可以被提升为leader.
 func (r *raft) roleUp() bool {
 	pr := r.prstrack.Progress[r.id] // 是本节点raft的身份
-	// 节点不是learner 且 没有正在应用快照
-	return pr != nil && !pr.IsLearner && !r.raftLog.hasPendingSnapshot()
+	// 节点不是learner 且 没有正在应用快照 且 没有被禁止竞选
+	return pr != nil && !pr.IsLearner && !r.raftLog.hasPendingSnapshot() &&
+		(r.campaignDisabled == nil || !r.campaignDisabled())
 }
 
 // 变成Follower       当前任期,当前leader